@@ -1,22 +1,48 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
 	"time"
+	_ "time/tzdata" // Task and scheduler time zones resolve on hosts without a zoneinfo database
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
 	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/agents"
 	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
 	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/api/server"
 	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/definitions"
 	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/internal/storage"
 )
 
+// Build info, set at link time by the Makefile
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// anomalySeedRecords bounds the stored execution history read at startup for anomaly baselines
+const anomalySeedRecords = 10000
+
 func main() {
 	// Initialize configuration
 	cfg, err := config.LoadConfig()
@@ -34,6 +60,21 @@ func main() {
 	// Create zap logger instance
 	zap.ReplaceGlobals(logger)
 
+	// Load certificates before anything starts so a bad TLS setup fails fast
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled {
+		var certificates *server.CertificateReloader
+		tlsConfig, certificates, err = server.NewTLSConfig(server.TLSOptions{
+			CertFile:     cfg.TLS.CertFile,
+			KeyFile:      cfg.TLS.KeyFile,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+		})
+		if err != nil {
+			zap.S().Fatalf("Invalid TLS configuration: %v", err)
+		}
+		reloadCertificatesOnSIGHUP(certificates)
+	}
+
 	// Set Gin mode based on config
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -41,30 +82,288 @@ func main() {
 		gin.SetMode(gin.DebugMode)
 	}
 
-	// Create Gin router
+	// Create Gin router; clients are identified by their address unless a trusted proxy names them
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.API.TrustedProxies); err != nil {
+		zap.S().Fatalf("Invalid api trusted_proxies: %v", err)
+	}
 
 	// Add middleware
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
+	// Assign request IDs before logging so every request log line carries one
+	router.Use(logging.RequestIDMiddleware())
+
 	// Add custom logging middleware
 	router.Use(logging.Middleware(logger))
 
+	// File-pattern agents exchange data in per-execution directories under the data dir
+	agents.SetSandboxBaseDir(filepath.Join(cfg.DataDir, "sandbox"))
+	defer agents.CloseLogSinks()
+	defer agents.StopPersistentProcesses()
+
+	// Select the backend keeping agents, tasks and executions
+	stores, err := storage.NewStores(storage.StoreOptions{
+		Backend:      cfg.Storage.Backend,
+		Path:         cfg.Storage.Path,
+		DSN:          cfg.Storage.Postgres.DSN,
+		Driver:       cfg.Storage.Postgres.Driver,
+		MaxOpenConns: cfg.Storage.Postgres.MaxOpenConns,
+	})
+	if err != nil {
+		zap.S().Fatalf("Failed to open state storage: %v", err)
+	}
+	defer stores.Close()
+
 	// Create service instances
 	agentService := services.NewAgentService(logger)
+	agentService.SetAgentStore(stores.Agents)
+	agentService.SetStrictValidation(cfg.Validation.Strict)
+	agentService.SetTemplatePropagation(cfg.AgentTemplates.PropagateUpdates)
+	agentService.SetAgentDefaults(config.ToAgentDefaults(cfg))
 
 	// Create metrics collector
 	metricsCollector := services.NewMetricsCollector(logger)
 
 	// Create execution service with metrics and caching
 	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetExecutionStore(stores.Executions)
+	executionService.SetSupervisorVersion(services.NewBuildInfo(version, commit, date).Version)
+	metricsCollector.SetLabelAllowList(cfg.Metrics.LabelAllowList)
+	metricsCollector.SetDurationWindow(cfg.Metrics.Window, cfg.Metrics.WindowSamples)
+	executionService.SetMetricsCollector(metricsCollector)
+
+	// Rate limit requests and cap concurrent executions per client
+	rateLimitConfig, defaultQuota, clientQuotas := rateLimitSettings(cfg)
+	rateLimiter := middleware.NewRateLimiter(rateLimitConfig, metricsCollector, logger)
+	executionQuota := services.NewExecutionQuota(defaultQuota, clientQuotas)
+	executionService.SetExecutionQuota(executionQuota)
+
+	// Reuse results of read-only agents that opt in with cache_ttl_seconds
+	executionService.SetResultCache(services.NewResultCache(cfg.ResultCache.MaxEntries))
+
+	// Attach retried execute requests to the execution their idempotency key started
+	executionService.SetIdempotencyStore(services.NewIdempotencyStore(cfg.Idempotency.Window, cfg.Idempotency.MaxKeys))
+
+	// Abandon retries once too little of an execution's timeout is left for another attempt
+	executionService.SetMinAttemptDuration(cfg.Retries.MinAttemptDuration)
+
+	// Give executions of agents that set none the default timeout, output limit and retry policy
+	executionService.SetExecutionDefaults(executionDefaults(cfg))
+	agents.SetMaxCapturedOutputBytes(cfg.Defaults.Execution.MaxOutputBytes)
+
+	// Keep the files agents leave in $SUPERVISOR_ARTIFACTS_DIR
+	artifactsDir := cfg.Artifacts.Dir
+	if artifactsDir == "" {
+		artifactsDir = filepath.Join(cfg.DataDir, "artifacts")
+	}
+	artifactStore := services.NewArtifactStore(artifactsDir, cfg.Artifacts.MaxCount, cfg.Artifacts.MaxTotalBytes, logger)
+	executionService.SetArtifactStore(artifactStore)
+
+	// Track running agent processes so the ones left behind by a crash are found at the next start
+	processDir := cfg.Orphans.Dir
+	if processDir == "" {
+		processDir = filepath.Join(cfg.DataDir, "processes")
+	}
+	processRegistry := agents.NewProcessRegistry(processDir, logger)
+	executionService.SetProcessRegistry(processRegistry)
+
+	// Answer CORS preflights before rate limiting, and keep CORS headers on rate limited responses
+	cors := middleware.NewCORS(corsSettings(cfg))
+	router.Use(cors.Middleware("/api/v1"))
+	router.Use(rateLimiter.Middleware())
+
+	// Reject oversized request bodies before the audit log reads them; execute uploads are streamed
+	// to disk under their own larger limit
+	bodyLimit := middleware.NewBodyLimit(bodyLimitSettings(cfg))
+	router.Use(bodyLimit.Middleware())
+
+	// Record every mutating request, after the rate limiter has identified its client
+	var auditLog *services.AuditLog
+	if cfg.Audit.Enabled {
+		auditLog, err = services.NewAuditLog(cfg.Audit.Path, cfg.Audit.MaxBytes, cfg.Audit.Backups, logger)
+		if err != nil {
+			zap.S().Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		auditLog.SetFailClosed(cfg.Audit.FailClosed)
+		if err := auditLog.SetMirrorLevel(cfg.Audit.LogLevel); err != nil {
+			zap.S().Fatalf("Invalid audit configuration: %v", err)
+		}
+		router.Use(middleware.Audit(auditLog, logger))
+		agents.AddLifecycleHookObserver(auditLog.RecordHook)
+	}
+
+	// Check the token of each request grants the permission its route requires; the audit log
+	// middleware runs first so denied requests are recorded
+	authorizer := middleware.NewAuthorizer(authSettings(cfg), handlers.RoutePermissions(), logger)
+	router.Use(authorizer.Middleware())
+
+	// With leader election only the leader serves mutations; followers redirect or proxy them to it
+	var leaderElector *services.LeaderElector
+	if cfg.LeaderElection.Enabled {
+		leaderElector, err = newLeaderElector(cfg, stores, logger)
+		if err != nil {
+			zap.S().Fatalf("Invalid leader election configuration: %v", err)
+		}
+		followerRequests, _ := models.ParseFollowerRequestMode(cfg.LeaderElection.FollowerRequests) // Validated when the config was loaded
+		router.Use(middleware.NewLeaderRouting(leaderElector, followerRequests, logger).Middleware())
+	}
 
 	// Create A2A service with required dependencies
 	a2aService := services.NewA2AService(agentService, executionService, logger)
 
 	// Create scheduler service
 	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	schedulerService.SetTaskStore(stores.Tasks)
+	schedulerService.SetMaxTaskTimeout(time.Duration(cfg.Scheduler.MaxTaskTimeout) * time.Second)
+	schedulerService.SetCatchUpInterval(cfg.Scheduler.CatchUpInterval)
+	schedulerService.SetDriftDetection(cfg.Scheduler.DriftWarnThreshold, cfg.Scheduler.MissedFireTolerance)
+	schedulerService.SetMetricsCollector(metricsCollector)
+	schedulerLocation, err := cfg.SchedulerLocation()
+	if err != nil {
+		zap.S().Fatalf("Invalid scheduler configuration: %v", err)
+	}
+	schedulerService.SetLocation(schedulerLocation)
+	if leaderElector != nil {
+		// Tasks only fire once this instance is elected
+		schedulerService.SetStandby(true)
+	}
+
+	// Publish execution state changes, hung agents, task runs, agent process failures and webhook deliveries to
+	// event stream clients; slow clients lose events instead of holding up the publishers
+	eventBus := services.NewEventBus(logger)
+	executionService.SetEventBus(eventBus)
+	schedulerService.SetEventBus(eventBus)
+	agents.AddProcessStateHook(eventBus.PublishProcessState)
+
+	// Agent status is derived from execution activity and the tasks scheduled for each agent
+	agentService.SetExecutionService(executionService)
+	agentService.SetSchedulerService(schedulerService)
+
+	// Skip scheduled runs, automatic restarts and health check alerts of agents in maintenance
+	maintenanceService := services.NewMaintenanceService(agentService, logger)
+	maintenanceService.SetLocation(schedulerLocation)
+	if err := maintenanceService.SetGlobalWindows(config.ToMaintenanceWindows(cfg.Maintenance.Windows)); err != nil {
+		zap.S().Fatalf("Invalid maintenance configuration: %v", err)
+	}
+	schedulerService.SetMaintenanceService(maintenanceService)
+	agentService.SetMaintenanceService(maintenanceService)
+	agents.SetMaintenanceCheck(maintenanceService.Active)
+
+	// Skip scheduled runs on the days of the calendars a task names
+	calendarService := services.NewCalendarService(logger)
+	for _, calendarConfig := range cfg.Calendars {
+		calendar, err := definitions.LoadCalendar(calendarConfig)
+		if err != nil {
+			zap.S().Fatalf("Invalid calendar configuration: %v", err)
+		}
+		if err := calendarService.CreateCalendar(calendar); err != nil {
+			zap.S().Fatalf("Invalid calendar configuration: %v", err)
+		}
+	}
+	calendarService.SetSchedulerService(schedulerService)
+	schedulerService.SetCalendarService(calendarService)
+
+	// Group and pattern lifecycle operations leave protected agents out and confirm large operations
+	operationGuard := services.NewOperationGuard(logger)
+	if err := operationGuard.SetSafety(config.ToLifecycleSafety(cfg)); err != nil {
+		zap.S().Fatalf("Invalid lifecycle safety configuration: %v", err)
+	}
+
+	// Select the execution history backend
+	historyRepo, err := storage.NewExecutionHistoryRepository(cfg.History.Backend, cfg.History.Path)
+	if err != nil {
+		zap.S().Fatalf("Failed to open execution history: %v", err)
+	}
+	if closer, ok := historyRepo.(io.Closer); ok {
+		defer closer.Close()
+	}
+	schedulerService.SetHistoryRepository(historyRepo)
+	historyRetention := services.NewHistoryRetentionJob(historyRepo, cfg.History.Retention, cfg.History.RetentionInterval, logger)
+	historyRetention.SetArtifactStore(artifactStore)
+	historyRetention.Start(context.Background())
+
+	// Flag executions that run far longer, or fail far more often, than their agent's and task's recent
+	// ones, starting from the history a previous run stored
+	var anomalyDetector *services.AnomalyDetector
+	if cfg.Anomalies.Enabled {
+		anomalyDetector = services.NewAnomalyDetector(anomalySettings(cfg))
+		if recent, err := historyRepo.GetExecutionHistoryByTimeRange(time.Unix(0, 0), time.Now(), anomalySeedRecords); err != nil {
+			logger.Warn("failed to read execution history for anomaly baselines", zap.Error(err))
+		} else {
+			anomalyDetector.Seed(recent)
+		}
+		executionService.SetAnomalyDetector(anomalyDetector)
+	}
+
+	// Purge soft-deleted agents once they are past the retention
+	services.NewAgentRetentionJob(agentService, cfg.AgentDeletion.Retention, cfg.AgentDeletion.SweepInterval, logger).Start(context.Background())
+
+	// Schedule the tasks a previous run stored
+	if loaded, err := schedulerService.LoadTasks(); err != nil {
+		zap.S().Fatalf("Failed to load stored tasks: %v", err)
+	} else if loaded > 0 {
+		logger.Info("scheduled stored tasks", zap.Int("tasks", loaded))
+	}
+
+	// Apply the agents and tasks declared in the config file; later edits are applied via /api/v1/config/update
+	var configReloader *services.ConfigReloader
+	if configFile := config.ConfigFileUsed(); configFile != "" {
+		configReloader = services.NewConfigReloader(configFile, agentService, executionService, schedulerService, logger)
+		configReloader.AddReloadHook(func(reloaded *config.Config) {
+			rateLimitConfig, defaultQuota, clientQuotas := rateLimitSettings(reloaded)
+			rateLimiter.UpdateConfig(rateLimitConfig)
+			executionQuota.SetLimits(defaultQuota, clientQuotas)
+			cors.UpdateConfig(corsSettings(reloaded))
+			bodyLimit.UpdateConfig(bodyLimitSettings(reloaded))
+			if anomalyDetector != nil {
+				anomalyDetector.SetConfig(anomalySettings(reloaded))
+			}
+			if err := maintenanceService.SetGlobalWindows(config.ToMaintenanceWindows(reloaded.Maintenance.Windows)); err != nil {
+				logger.Warn("keeping the previous maintenance windows", zap.Error(err))
+			}
+			if err := operationGuard.SetSafety(config.ToLifecycleSafety(reloaded)); err != nil {
+				logger.Warn("keeping the previous lifecycle safety settings", zap.Error(err))
+			}
+			authorizer.UpdateConfig(authSettings(reloaded))
+			agentService.SetStrictValidation(reloaded.Validation.Strict)
+			agentService.SetTemplatePropagation(reloaded.AgentTemplates.PropagateUpdates)
+			agentService.SetAgentDefaults(config.ToAgentDefaults(reloaded))
+			executionService.SetExecutionDefaults(executionDefaults(reloaded))
+			agents.SetMaxCapturedOutputBytes(reloaded.Defaults.Execution.MaxOutputBytes)
+			if auditLog != nil {
+				auditLog.SetFailClosed(reloaded.Audit.FailClosed)
+				if err := auditLog.SetMirrorLevel(reloaded.Audit.LogLevel); err != nil {
+					logger.Warn("keeping the previous audit log level", zap.Error(err))
+				}
+			}
+		})
+		result, err := configReloader.Update(false)
+		if err != nil {
+			zap.S().Fatalf("Failed to apply configuration: %v", err)
+		}
+		for _, item := range result.Results {
+			if item.Status == models.ConfigUpdateFailed {
+				zap.S().Errorf("Failed to apply %s %s from configuration: %s", item.Scope, item.ID, item.Message)
+			}
+		}
+	}
+
+	// Adopt or terminate the agent processes a previous run left behind, now that the agents are known
+	orphanPolicy, err := models.ParseOrphanPolicy(cfg.Orphans.Policy)
+	if err != nil {
+		zap.S().Fatalf("Invalid orphan configuration: %v", err)
+	}
+	orphanService := services.NewOrphanService(processRegistry, agentService, orphanPolicy, logger)
+	orphanService.SetWatchInterval(cfg.Orphans.WatchInterval)
+	if leaderElector == nil {
+		// With leader election, orphans are recovered once this instance is elected
+		if _, err := orphanService.Recover(context.Background()); err != nil {
+			logger.Error("failed to scan for orphaned agent processes", zap.Error(err))
+		}
+	}
 
 	// Load A2A configuration
 	a2aConfig := a2a.DefaultA2AConfig()
@@ -74,39 +373,397 @@ func main() {
 			zap.S().Errorf("Failed to unmarshal A2A config: %v", err)
 		}
 	}
+	if err := a2aConfig.Validate(); err != nil {
+		zap.S().Fatalf("Invalid A2A configuration: %v", err)
+	}
+	for _, warning := range a2aConfig.Warnings() {
+		zap.S().Warnf("A2A configuration: %s", warning)
+	}
+
+	// Only the tokens of configured clients get rate limit buckets of their own
+	rateLimiter.SetTokenCheck(func(token string) bool {
+		return authorizer.KnownToken(token) || slices.Contains(a2aConfig.Authentication.ValidTokens, token)
+	})
+
+	// REST and JSON-RPC run agents through one coordinator
+	executionCoordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	executionCoordinator.SetOperationWaitTimeout(cfg.API.OperationWaitTimeout)
+	executionCoordinator.SetGroupService(agentService)
+	executionCoordinator.SetOperationGuard(operationGuard)
+
+	// Pipelines run their steps through the coordinator and may be the target of scheduled tasks
+	pipelineService := services.NewPipelineService(agentService, executionCoordinator, logger)
+	schedulerService.SetPipelineService(pipelineService)
+
+	// Deliver A2A push notifications when executions with a registered callback finish
+	pushNotifier := services.NewPushNotifier(executionService, logger)
+	pushNotifier.SetAllowInsecureURLs(a2aConfig.PushNotifications.AllowInsecureURLs)
+	pushNotifier.SetRetryPolicy(a2aConfig.PushNotifications.MaxAttempts, a2aConfig.PushNotifications.RetryBackoff)
+	pushNotifier.SetHTTPClient(&http.Client{Timeout: a2aConfig.PushNotifications.Timeout})
+	pushNotifier.SetEventBus(eventBus)
+
+	// Thread A2A messages sharing a conversation ID, shared by JSON-RPC and the conversation route
+	conversationStore := services.NewConversationStore(a2aConfig.Conversations.IdleTTL)
+	conversationStore.SetHistoryLimits(a2aConfig.Conversations.HistoryMessages, a2aConfig.Conversations.HistoryBytes)
+
+	// Fault injection is for testing automation against supervisor failures and stays off by default
+	var faultInjector *services.FaultInjector
+	if cfg.Debug.FaultInjection {
+		logger.Warn("fault injection is enabled; executions and webhooks may fail on purpose")
+		faultInjector = services.NewFaultInjector(logger)
+		executionService.SetFaultInjector(faultInjector)
+	}
+
+	// Report persistent agents that failed to start too often to the process events webhook
+	var processEvents *services.ProcessEventNotifier
+	if cfg.ProcessEvents.WebhookURL != "" {
+		processEvents = services.NewProcessEventNotifier(cfg.ProcessEvents.WebhookURL, cfg.ProcessEvents.WebhookToken, logger)
+		processEvents.SetFaultInjector(faultInjector)
+		agents.AddProcessStateHook(processEvents.Notify)
+	}
 
 	// Setup A2A routes
 	routeConfig := &routes.A2ARouteConfig{
-		Router:           router,
-		A2AService:       a2aService,
-		AgentService:     agentService,
-		ExecutionService: executionService,
-		A2AConfig:        a2aConfig,
+		Router:               router,
+		A2AService:           a2aService,
+		AgentService:         agentService,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: executionCoordinator,
+		A2AConfig:            a2aConfig,
+		PushNotifier:         pushNotifier,
+		ConversationStore:    conversationStore,
 	}
 	routes.SetupA2ARoutes(routeConfig)
 
-	// Create and register scheduled task handlers
-	taskHandlers := handlers.NewScheduledTaskHandlers(schedulerService, logger)
-	taskHandlers.RegisterScheduledTaskRoutes(router)
+	// Alert on read-write agents whose queue backs up behind a stuck execution
+	if cfg.QueueAlerts.Enabled {
+		defaults, agentThresholds := queueAlertSettings(cfg)
+		queueAlerts := services.NewQueueAlertMonitor(services.ExecutionRouterFor(executionService, logger), defaults, cfg.QueueAlerts.Interval, logger)
+		queueAlerts.SetThresholds(defaults, agentThresholds)
+		queueAlerts.SetMetricsCollector(metricsCollector)
+		if configReloader != nil {
+			configReloader.AddReloadHook(func(reloaded *config.Config) {
+				queueAlerts.SetThresholds(queueAlertSettings(reloaded))
+			})
+		}
+		queueAlerts.Start(context.Background())
+	}
+
+	// Report on the supervisor itself; readiness requires the directories it persists state in to be writable
+	serverMonitor := services.NewServerMonitor(services.NewBuildInfo(version, commit, date), agentService, schedulerService, executionService, logger)
+	serverMonitor.SetMetricsCollector(metricsCollector)
+	serverMonitor.SetEventBus(eventBus)
+	serverMonitor.SetMaxExecutionBacklog(cfg.Health.MaxExecutionBacklog)
+	persistenceDirs := []string{cfg.DataDir}
+	if cfg.Artifacts.Dir != "" {
+		persistenceDirs = append(persistenceDirs, cfg.Artifacts.Dir)
+	}
+	if cfg.API.UploadDir != "" {
+		persistenceDirs = append(persistenceDirs, cfg.API.UploadDir)
+	}
+	if cfg.History.Backend == "sqlite" {
+		persistenceDirs = append(persistenceDirs, filepath.Dir(cfg.History.Path))
+	}
+	if cfg.Storage.Backend == storage.StoreBackendSQLite {
+		persistenceDirs = append(persistenceDirs, filepath.Dir(cfg.Storage.Path))
+	}
+	if cfg.Audit.Enabled {
+		persistenceDirs = append(persistenceDirs, filepath.Dir(cfg.Audit.Path))
+	}
+	serverMonitor.SetPersistenceDirs(persistenceDirs...)
 
-	// Define basic routes
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "healthy",
-			"service": "algonius-supervisor",
-			"timestamp": time.Now().UTC(),
+	// The leader alone schedules tasks, runs agent processes and delivers webhooks. A demoted leader
+	// stops its persistent agents and releases the orphans it adopted, whose state files let the new
+	// leader adopt them; one-shot executions in progress run to completion.
+	if leaderElector != nil {
+		leaderElector.AddLeadershipHook(func(leader bool) {
+			schedulerService.SetStandby(!leader)
+			pushNotifier.SetStandby(!leader)
+			if processEvents != nil {
+				processEvents.SetStandby(!leader)
+			}
+			if leader {
+				if _, err := orphanService.Recover(context.Background()); err != nil {
+					logger.Error("failed to scan for orphaned agent processes", zap.Error(err))
+				}
+				return
+			}
+			orphanService.Release()
+			agents.StopPersistentProcesses()
 		})
-	})
+		pushNotifier.SetStandby(true)
+		if processEvents != nil {
+			processEvents.SetStandby(true)
+		}
+		serverMonitor.SetLeaderElector(leaderElector)
+		leaderElector.Start(context.Background())
+		defer leaderElector.Stop()
+	}
 
-	// Add metrics endpoint
-	router.GET("/metrics", func(c *gin.Context) {
-		metrics := metricsCollector.GetOverallMetrics()
-		c.JSON(200, metrics)
-	})
+	// Export and import the agents, templates, pipelines and tasks for migration and backup
+	stateService := services.NewStateService(agentService, agentService, schedulerService, logger)
+	stateService.SetPipelineService(pipelineService)
+	stateService.SetHistoryRepository(historyRepo)
+
+	// Execute uploads are spooled to files while their execution runs
+	uploadDir := cfg.API.UploadDir
+	if uploadDir == "" {
+		uploadDir = filepath.Join(cfg.DataDir, "uploads")
+	}
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		zap.S().Fatalf("Failed to create upload directory: %v", err)
+	}
+
+	// Binary execute input is spooled next to uploads while its execution runs
+	inputMaterializer := services.NewInputMaterializer(uploadDir, logger)
+	inputMaterializer.SetFetchPolicy(cfg.API.Input.AllowedSchemes, cfg.API.Input.AllowedHosts, cfg.API.Input.MaxBytes, cfg.API.Input.FetchTimeout)
+	executionCoordinator.SetInputMaterializer(inputMaterializer)
 
-	// Start server
-	zap.S().Infof("Starting algonius-supervisor on %s:%d", cfg.Host, cfg.Port)
-	if err := router.Run(cfg.Host + ":" + fmt.Sprintf("%d", cfg.Port)); err != nil {
+	// Setup REST API routes
+	apiRouteConfig := &routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: executionCoordinator,
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		AgentDefaultsService: agentService,
+		AgentGroupService:    agentService,
+		SchedulerService:     schedulerService,
+		PipelineService:      pipelineService,
+		ConfigValidator:      services.NewConfigValidator(cfg, a2aConfig, agentService, schedulerService, logger),
+		ConfigReloader:       configReloader,
+		MetricsCollector:     metricsCollector,
+		AuditLog:             auditLog,
+		ServerMonitor:        serverMonitor,
+		StateService:         stateService,
+		ArtifactStore:        artifactStore,
+		OrphanService:        orphanService,
+		FaultInjector:        faultInjector,
+		EventBus:             eventBus,
+		MaintenanceService:   maintenanceService,
+		CalendarService:      calendarService,
+		ConversationStore:    conversationStore,
+		CORS:                 cors,
+		Logger:               logger,
+		SwaggerUI:            cfg.API.SwaggerUI,
+		AllowSecretReveal:    cfg.Secrets.AllowReveal,
+		SecretRevealTokens:   cfg.Secrets.RevealTokens,
+		StreamHeartbeat:      cfg.API.StreamHeartbeat,
+		UploadDir:            uploadDir,
+		MaxUploadBytes:       cfg.API.MaxUploadBytes,
+		ExportLabels:         cfg.API.ExportLabels,
+	}
+	routes.SetupAPIRoutes(apiRouteConfig)
+
+	// Start server on host:port and the unix socket; with TLS enabled plain HTTP requests to the
+	// port are rejected, requests over the socket never use TLS
+	httpServer := &http.Server{
+		Addr:        cfg.Host + ":" + fmt.Sprintf("%d", cfg.Port),
+		Handler:     router,
+		TLSConfig:   tlsConfig,
+		ConnContext: server.ConnContext,
+	}
+	serveErrors := make(chan error, 2)
+	if cfg.Socket.Path != "" {
+		socketMode, _ := cfg.SocketMode() // Validated when the config was loaded
+		socket, err := server.ListenUnix(server.UnixSocketOptions{Path: cfg.Socket.Path, Mode: socketMode})
+		if err != nil {
+			zap.S().Fatalf("Failed to start server: %v", err)
+		}
+		zap.S().Infof("Starting algonius-supervisor on unix://%s", cfg.Socket.Path)
+		go func() {
+			serveErrors <- httpServer.Serve(socket)
+		}()
+	}
+	if !cfg.Socket.DisableTCP {
+		go func() {
+			if tlsConfig != nil {
+				zap.S().Infof("Starting algonius-supervisor on https://%s", httpServer.Addr)
+				serveErrors <- httpServer.ListenAndServeTLS("", "")
+				return
+			}
+			zap.S().Infof("Starting algonius-supervisor on %s:%d", cfg.Host, cfg.Port)
+			serveErrors <- httpServer.ListenAndServe()
+		}()
+	}
+
+	// Shut down gracefully on SIGINT and SIGTERM: stop accepting requests, then stop the scheduler,
+	// waiting for the runs it cancels to return
+	shutdownSignals := make(chan os.Signal, 1)
+	signal.Notify(shutdownSignals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serveErrors:
 		zap.S().Fatalf("Failed to start server: %v", err)
+	case received := <-shutdownSignals:
+		zap.S().Infof("Received %s, shutting down", received)
+	}
+	shutdown(httpServer, schedulerService, cfg.Scheduler.ShutdownTimeout)
+}
+
+// shutdown stops the HTTP server and the scheduler, giving each up to timeout to finish the
+// requests and runs in progress
+func shutdown(httpServer *http.Server, schedulerService services.ISchedulerService, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		zap.S().Warnf("Failed to shut down the server gracefully: %v", err)
+	}
+
+	ctx, cancelScheduler := context.WithTimeout(context.Background(), timeout)
+	defer cancelScheduler()
+	if err := schedulerService.Shutdown(ctx); err != nil {
+		zap.S().Warnf("Scheduled runs still in progress after %s: %v", timeout, err)
+	}
+}
+
+// reloadCertificatesOnSIGHUP reloads the TLS certificate whenever the process receives SIGHUP
+func reloadCertificatesOnSIGHUP(certificates *server.CertificateReloader) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := certificates.Reload(); err != nil {
+				zap.S().Errorf("Failed to reload TLS certificate, keeping the previous one: %v", err)
+				continue
+			}
+			zap.S().Info("Reloaded TLS certificate")
+		}
+	}()
+}
+
+// newLeaderElector creates the elector competing for the lease of the configured lease backend
+func newLeaderElector(cfg *config.Config, stores *storage.Stores, logger *zap.Logger) (*services.LeaderElector, error) {
+	election := cfg.LeaderElection
+	leases := stores.Leases
+	if election.Backend == "file" {
+		leaseFile := election.LeaseFile
+		if leaseFile == "" {
+			leaseFile = filepath.Join(cfg.DataDir, "leader.lease")
+		}
+		fileLeases, err := storage.NewFileLeaseStore(leaseFile)
+		if err != nil {
+			return nil, err
+		}
+		leases = fileLeases
+	}
+	if leases == nil {
+		return nil, fmt.Errorf("the %s storage backend keeps no leader lease", cfg.Storage.Backend)
+	}
+
+	identity := election.Identity
+	if identity == "" {
+		hostname, _ := os.Hostname()
+		identity = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	elector := services.NewLeaderElector(leases, identity, election.AdvertiseAddress, logger)
+	elector.SetLeaseTiming(election.LeaseDuration, election.RenewInterval)
+	return elector, nil
+}
+
+// corsSettings converts the cors config section into middleware settings
+func corsSettings(cfg *config.Config) middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   []string{logging.RequestIDHeader, "Location", "Retry-After", handlers.IdempotentReplayedHeader},
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}
+}
+
+// bodyLimitSettings converts the api config section into request body limit settings
+func bodyLimitSettings(cfg *config.Config) middleware.BodyLimitConfig {
+	return middleware.BodyLimitConfig{
+		MaxBytes:     cfg.API.MaxBodyBytes,
+		ExemptRoutes: []string{handlers.ExecuteUploadRoute},
+	}
+}
+
+// executionDefaults converts the defaults.execution config section into execution defaults
+func executionDefaults(cfg *config.Config) services.ExecutionDefaults {
+	return services.ExecutionDefaults{
+		Timeout:      time.Duration(cfg.Defaults.Execution.Timeout) * time.Second,
+		MaxRetries:   cfg.Defaults.Execution.MaxRetries,
+		RetryBackoff: cfg.Defaults.Execution.RetryBackoff,
 	}
-}
\ No newline at end of file
+}
+
+// anomalySettings converts the anomalies config section into anomaly detector settings
+func anomalySettings(cfg *config.Config) services.AnomalyConfig {
+	return services.AnomalyConfig{
+		Window:               cfg.Anomalies.Window,
+		MinSamples:           cfg.Anomalies.MinSamples,
+		DurationStdDevs:      cfg.Anomalies.DurationStdDevs,
+		DurationMinRatio:     cfg.Anomalies.DurationMinRatio,
+		FailureRateThreshold: cfg.Anomalies.FailureRateThreshold,
+	}
+}
+
+// authSettings converts the auth config section into middleware settings
+func authSettings(cfg *config.Config) middleware.AuthorizationConfig {
+	tokens := make(map[string]middleware.TokenGrant, len(cfg.Auth.Tokens))
+	for _, grant := range cfg.Auth.Tokens {
+		tokenGrant := middleware.TokenGrant{Role: models.Role(grant.Role)}
+		for _, permission := range grant.Permissions {
+			tokenGrant.Permissions = append(tokenGrant.Permissions, models.Permission(permission))
+		}
+		tokens[grant.Token] = tokenGrant
+	}
+	authorization := middleware.AuthorizationConfig{Enabled: cfg.Auth.Enabled, Tokens: tokens}
+	if peerAuth := cfg.Socket.PeerAuth; peerAuth.Enabled {
+		authorization.SocketPeers = &middleware.SocketPeerAuth{Role: models.Role(peerAuth.Role), AllowedUIDs: peerAuth.AllowedUIDs}
+	}
+	return authorization
+}
+
+// queueAlertSettings converts the configured queue alert thresholds into the default thresholds and
+// the thresholds of agents with overrides
+func queueAlertSettings(cfg *config.Config) (services.QueueAlertThreshold, map[string]services.QueueAlertThreshold) {
+	configured, overrides := cfg.QueueAlertThresholds()
+	threshold := func(t config.QueueAlertThreshold) services.QueueAlertThreshold {
+		return services.QueueAlertThreshold{
+			MaxQueueLength:   t.MaxQueueLength,
+			ClearQueueLength: t.ClearQueueLength,
+			MaxWait:          t.MaxWait,
+			ClearWait:        t.ClearWait,
+		}
+	}
+
+	agents := make(map[string]services.QueueAlertThreshold, len(overrides))
+	for _, override := range overrides {
+		agents[override.AgentID] = threshold(override)
+	}
+	return threshold(configured), agents
+}
+
+// rateLimitSettings converts the rate_limit config section into limiter settings and per-client execution quotas
+func rateLimitSettings(cfg *config.Config) (middleware.RateLimitConfig, int, map[string]int) {
+	limits := cfg.RateLimit
+	rateLimitConfig := middleware.RateLimitConfig{
+		Enabled:     limits.Enabled,
+		Default:     middleware.RateLimit{RequestsPerSecond: limits.RequestsPerSecond, Burst: limits.Burst},
+		Clients:     make(map[string]middleware.RateLimit, len(limits.Tokens)),
+		ExemptPaths: limits.ExemptPaths,
+	}
+	clientQuotas := make(map[string]int, len(limits.Tokens))
+
+	for _, override := range limits.Tokens {
+		clientID := services.ClientIDForToken(override.Token)
+
+		limit := rateLimitConfig.Default
+		if override.RequestsPerSecond > 0 {
+			limit.RequestsPerSecond = override.RequestsPerSecond
+		}
+		if override.Burst > 0 {
+			limit.Burst = override.Burst
+		}
+		rateLimitConfig.Clients[clientID] = limit
+
+		if override.MaxConcurrentExecutions > 0 {
+			clientQuotas[clientID] = override.MaxConcurrentExecutions
+		}
+	}
+
+	return rateLimitConfig, limits.MaxConcurrentExecutions, clientQuotas
+}
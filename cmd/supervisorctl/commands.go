@@ -0,0 +1,542 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+)
+
+// shellCommandName is the command run when supervisorctl is called without one
+const shellCommandName = "shell"
+
+// command is a supervisorctl command
+type command struct {
+	name    string
+	usage   string // Synopsis, after supervisorctl
+	summary string // One line for the command list
+	help    string // What help <command> and -h print after the synopsis
+	remote  bool   // The command talks to the supervisor, so it needs the config and a client
+	run     func(ctx context.Context, env *environment, args []string) error
+}
+
+// printHelp prints the command's synopsis and help
+func (c *command) printHelp(w io.Writer) {
+	fmt.Fprintf(w, "usage: supervisorctl %s\n\n%s\n", c.usage, c.summary)
+	if c.help != "" {
+		fmt.Fprintf(w, "\n%s", c.help)
+	}
+}
+
+// commands are the supervisorctl commands, in the order help lists them
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name: shellCommandName, usage: "[shell]", summary: "Start the interactive shell, also run without a command", remote: true,
+			help: `Reads one command per line until exit, quit or the end of the input, with one client, so the
+session authenticates once. The shell runs status, start, stop, restart, task and logs, keeps their
+history, and prints JSON or tables as set format json|table chooses. Tab completion offers the
+commands, the live agent IDs, group:<name> targets and task IDs; complete <line> lists them.
+`,
+			run: runShell,
+		},
+		{
+			name: "status", usage: "status [target] [--watch]", summary: "Show the status of agents", remote: true,
+			help: `The target is an agent ID, group:<name> for the members of an agent group, or nothing for every
+agent. With --watch the status is printed again whenever it changes: the supervisor holds each
+request until an agent transitions, so an idle dashboard costs one request every 30s.
+`,
+			run: runStatus,
+		},
+		{
+			name: "start", usage: "start <target>...", summary: "Start persistent agents", remote: true,
+			help: targetHelp,
+			run:  runShellCommand("start"),
+		},
+		{
+			name: "stop", usage: "stop <target>...", summary: "Disable agents; their in-flight executions finish", remote: true,
+			help: targetHelp,
+			run:  runShellCommand("stop"),
+		},
+		{
+			name: "restart", usage: "restart <target>...", summary: "Cancel agents' executions and enable them again", remote: true,
+			help: targetHelp,
+			run:  runShellCommand("restart"),
+		},
+		{
+			name: "logs", usage: "logs <agent>", summary: "Show the output of an agent's latest execution", remote: true,
+			run: runShellCommand("logs"),
+		},
+		{
+			name: "task", usage: "task list | task run|schedule|preview-input <id>", summary: "List, run and inspect scheduled tasks", remote: true,
+			help: `task run runs a task now and reports its result; fan-out tasks report the aggregate of their
+agents' executions. task schedule lists the next runs, and task preview-input renders the input a
+run would receive now.
+`,
+			run: runShellCommand("task"),
+		},
+		{
+			name: "disable", usage: "disable <agent> [--cancel-active]", summary: "Make an agent reject new executions", remote: true,
+			help: `The agent rejects executions from every protocol with AGENT_DISABLED and the scheduler skips its
+tasks. Its in-flight executions finish unless --cancel-active is set.
+`,
+			run: runDisable,
+		},
+		{
+			name: "enable", usage: "enable <agent>", summary: "Let a disabled agent run again", remote: true,
+			run: runEnable,
+		},
+		{
+			name: "cancel", usage: "cancel --agent <id> | --task <id> | --execution <id>", summary: "Cancel unfinished executions", remote: true,
+			help: `Cancels every unfinished execution of an agent or a task, or a single execution. Queued executions
+are cancelled without ever running. The outcome is reported per execution.
+`,
+			run: runCancel,
+		},
+		{
+			name: "wait", usage: "wait agent <id> --state <state> | wait execution <id> [--timeout <d>]", summary: "Wait for an agent's status or an execution's end", remote: true,
+			help: `Exits 0 once the agent reaches the state or the execution succeeds, 2 when the timeout passes
+first and 3 when the agent enters the error status or the execution fails.
+`,
+			run: runWait,
+		},
+		{
+			name: "validate", usage: "validate", summary: "Check the configuration the supervisor runs with", remote: true,
+			help: `Checks the supervisor's own and A2A settings, every registered agent, and the scheduled tasks,
+which must run agents that exist. Warnings leave the configuration valid.
+`,
+			run: runValidate,
+		},
+		{
+			name: "reread", usage: "reread", summary: "Show what the supervisor's config file changed", remote: true,
+			help: "Lists the agents and tasks the config file adds, changes or removes compared with what the\nsupervisor applied.\n",
+			run:  runReread,
+		},
+		{
+			name: "update", usage: "update [--yes] [--restart-changed]", summary: "Apply the supervisor's config file", remote: true,
+			help: `Shows the changes reread lists and asks before applying them, unless --yes is set. Changed agents
+with running executions are skipped unless --restart-changed cancels those executions.
+`,
+			run: runUpdate,
+		},
+		{
+			name: "lint", usage: "lint [--warn <rules>] [--format table|json] <path>...", summary: "Check definition files without a supervisor",
+			help: `Decodes and validates agent and task definition files with the supervisor's own code; tasks must
+run agents defined in the linted files. Each problem names its file, line and rule. Rules listed in
+--warn, comma-separated, are reported as warnings, which do not fail the lint.
+`,
+			run: runLint,
+		},
+		{
+			name: "config", usage: "config init|show|get|set|use-profile|profiles", summary: "Manage the supervisorctl config file",
+			help: `config init [--force]            prompt for the server URL, token and format and write the file
+config show [--reveal-secrets]   print the effective config and where each value comes from
+config get <key>                 print one effective value
+config set <key> <value>         validate and write a value, keeping the file's comments
+config use-profile <name>        make a profile of the file the current one
+config profiles                  list the file's profiles
+
+Values come from the global flags --server, --token and --profile, then SUPERVISORCTL_SERVER,
+SUPERVISORCTL_TOKEN and SUPERVISORCTL_PROFILE, then the selected profile, then the file's top
+level, then the defaults.
+`,
+			run: runConfig,
+		},
+		{
+			name: "completion", usage: "completion bash|zsh|fish|powershell", summary: "Print a shell completion script",
+			help: "Load it with, for example, source <(supervisorctl completion bash). Agent targets and task IDs\nare completed from the supervisor, and not at all when it cannot be reached.\n",
+			run:  runCompletion,
+		},
+		{
+			name: "help", usage: "help [command]", summary: "Show the commands, or a command's help",
+			run: runHelp,
+		},
+	}
+}
+
+// targetHelp describes the targets of the lifecycle commands
+const targetHelp = `A target is an agent ID, group:<name>, or an agent pattern such as * or prefix:payments-. Groups
+start their members in order and stop them in reverse. The supervisor asks to confirm operations
+on many agents; the agents are listed and the answer read from stdin.
+`
+
+// lookupCommand returns the command called name
+func lookupCommand(name string) (*command, bool) {
+	for _, command := range commands {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return nil, false
+}
+
+// commandNamed returns the command called name, which exists
+func commandNamed(name string) *command {
+	command, _ := lookupCommand(name)
+	return command
+}
+
+// runShell starts the interactive shell
+func runShell(ctx context.Context, env *environment, args []string) error {
+	if _, err := parseFlags(flagSet(env, commandNamed(shellCommandName)), args); err != nil {
+		return err
+	}
+	return env.shell().Run(ctx)
+}
+
+// runShellCommand returns a command running as the shell's command of the same name
+func runShellCommand(name string) func(ctx context.Context, env *environment, args []string) error {
+	return func(ctx context.Context, env *environment, args []string) error {
+		args, err := parseFlags(flagSet(env, commandNamed(name)), args)
+		if err != nil {
+			return err
+		}
+		return env.shell().Execute(ctx, strings.Join(append([]string{name}, args...), " "))
+	}
+}
+
+// runStatus prints the status of a target, again whenever it changes with --watch
+func runStatus(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("status")
+	flags := flagSet(env, command)
+	watch := flags.Bool("watch", false, "print the status again whenever it changes")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return usageError(command)
+	}
+	if !*watch {
+		return env.shell().Execute(ctx, strings.Join(append([]string{"status"}, args...), " "))
+	}
+
+	target := ""
+	if len(args) == 1 {
+		target = args[0]
+	}
+	return env.client.WatchStatus(ctx, target, 0, func(statuses []supervisorctl.AgentStatus) error {
+		fmt.Fprint(env.stdout, "\x1b[H\x1b[2J") // Clear the screen
+		if env.jsonOutput() {
+			return env.writeJSON(statuses)
+		}
+		return supervisorctl.StatusColumns.Write(env.stdout, statuses, env.tableOptions())
+	})
+}
+
+// runDisable disables an agent
+func runDisable(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("disable")
+	flags := flagSet(env, command)
+	cancelActive := flags.Bool("cancel-active", false, "cancel the agent's in-flight executions")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError(command)
+	}
+	result, err := env.client.DisableAgent(ctx, args[0], supervisorctl.DisableOptions{CancelActive: *cancelActive})
+	if err != nil {
+		return err
+	}
+	return env.printToggle(result)
+}
+
+// runEnable enables an agent
+func runEnable(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("enable")
+	args, err := parseFlags(flagSet(env, command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError(command)
+	}
+	result, err := env.client.EnableAgent(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return env.printToggle(result)
+}
+
+// printToggle prints whether an agent is enabled, and its executions the change left running or cancelled
+func (env *environment) printToggle(result *supervisorctl.AgentToggleResult) error {
+	if env.jsonOutput() {
+		return env.writeJSON(result)
+	}
+	state := "disabled"
+	if result.Enabled {
+		state = "enabled"
+	}
+	fmt.Fprintf(env.stdout, "%s: %s\n", result.AgentID, state)
+	if len(result.RunningExecutions) > 0 {
+		fmt.Fprintf(env.stdout, "still running: %s\n", strings.Join(result.RunningExecutions, ", "))
+	}
+	if len(result.CancelledExecutions) > 0 {
+		fmt.Fprintf(env.stdout, "cancelled: %s\n", strings.Join(result.CancelledExecutions, ", "))
+	}
+	return nil
+}
+
+// runCancel cancels the unfinished executions of an agent or a task, or a single execution
+func runCancel(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("cancel")
+	flags := flagSet(env, command)
+	var target supervisorctl.CancelTarget
+	flags.StringVar(&target.AgentID, "agent", "", "cancel the executions of this agent")
+	flags.StringVar(&target.TaskID, "task", "", "cancel the executions of this task")
+	flags.StringVar(&target.ExecutionID, "execution", "", "cancel this execution")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 || target == (supervisorctl.CancelTarget{}) {
+		return usageError(command)
+	}
+	result, err := env.client.Cancel(ctx, target)
+	if err != nil {
+		return err
+	}
+	if env.jsonOutput() {
+		return env.writeJSON(result)
+	}
+	result.Print(env.stdout)
+	return nil
+}
+
+// runWait waits for an agent's status or an execution's end
+func runWait(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("wait")
+	flags := flagSet(env, command)
+	state := flags.String("state", "", "the agent status to wait for, such as RUNNING")
+	timeout := flags.Duration("timeout", 0, "give up after this long; 0 waits until interrupted")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return usageError(command)
+	}
+
+	options := supervisorctl.WaitOptions{Timeout: *timeout}
+	switch args[0] {
+	case "agent":
+		if *state == "" {
+			return usageError(command)
+		}
+		status, err := env.client.WaitAgent(ctx, args[1], *state, options)
+		if status != nil {
+			if env.jsonOutput() {
+				env.writeJSON(status)
+			} else {
+				fmt.Fprintf(env.stdout, "%s: %s\n", status.ID, status.Status)
+			}
+		}
+		return err
+	case "execution":
+		execution, err := env.client.WaitExecution(ctx, args[1], options)
+		if execution != nil {
+			if env.jsonOutput() {
+				env.writeJSON(execution)
+			} else {
+				fmt.Fprintf(env.stdout, "execution %s: %s\n", execution.ID, execution.State)
+			}
+		}
+		return err
+	}
+	return usageError(command)
+}
+
+// runValidate has the supervisor check its configuration
+func runValidate(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("validate")
+	args, err := parseFlags(flagSet(env, command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError(command)
+	}
+	validation, err := env.client.ValidateConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if env.jsonOutput() {
+		env.writeJSON(validation)
+	} else {
+		validation.Print(env.stdout)
+	}
+	return validation.Err()
+}
+
+// runReread prints what the supervisor's config file changed
+func runReread(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("reread")
+	args, err := parseFlags(flagSet(env, command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError(command)
+	}
+	diff, err := env.client.RereadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if env.jsonOutput() {
+		return env.writeJSON(diff)
+	}
+	diff.Print(env.stdout)
+	return nil
+}
+
+// runUpdate applies the supervisor's config file, once confirmed
+func runUpdate(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("update")
+	flags := flagSet(env, command)
+	assumeYes := flags.Bool("yes", false, "apply the changes without asking")
+	restartChanged := flags.Bool("restart-changed", false, "cancel the running executions of changed agents")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError(command)
+	}
+
+	confirm := supervisorctl.PromptConfigConfirm(env.stdin, env.stdout, *assumeYes)
+	diff, result, err := env.client.ConfirmedUpdateConfig(ctx, supervisorctl.ConfigUpdateOptions{RestartChanged: *restartChanged}, confirm)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		diff.Print(env.stdout)
+		return nil
+	}
+	if env.jsonOutput() {
+		env.writeJSON(result)
+	} else {
+		result.Print(env.stdout)
+	}
+	return result.Err()
+}
+
+// runLint checks definition files
+func runLint(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("lint")
+	flags := flagSet(env, command)
+	warn := flags.String("warn", "", "rules reported as warnings, comma-separated")
+	format := flags.String("format", supervisorctl.OutputTable, "output format, table or json")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageError(command)
+	}
+
+	var options supervisorctl.LintOptions
+	if *warn != "" {
+		options.Warn = strings.Split(*warn, ",")
+	}
+	report, err := supervisorctl.Lint(args, options)
+	if err != nil {
+		return err
+	}
+	if *format == supervisorctl.OutputJSON {
+		env.writeJSON(report)
+	} else {
+		report.Print(env.stdout)
+	}
+	return report.Err()
+}
+
+// runConfig runs a config subcommand
+func runConfig(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("config")
+	flags := flagSet(env, command)
+	force := flags.Bool("force", false, "config init: overwrite an existing file")
+	revealSecrets := flags.Bool("reveal-secrets", false, "config show: print the token unmasked")
+	args, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageError(command)
+	}
+
+	switch subcommand, args := args[0], args[1:]; {
+	case subcommand == "init" && len(args) == 0:
+		if _, err := env.manager.Init(env.stdin, env.stdout, *force); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.stdout, "wrote %s\n", env.manager.Path())
+		return nil
+	case subcommand == "show" && len(args) == 0:
+		return env.manager.Show(env.stdout, *revealSecrets)
+	case subcommand == "get" && len(args) == 1:
+		value, err := env.manager.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.stdout, value)
+		return nil
+	case subcommand == "set" && len(args) == 2:
+		return env.manager.Set(args[0], args[1])
+	case subcommand == "use-profile" && len(args) == 1:
+		return env.manager.UseProfile(args[0])
+	case subcommand == "profiles" && len(args) == 0:
+		names, err := env.manager.Profiles()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintln(env.stdout, name)
+		}
+		return nil
+	}
+	return usageError(command)
+}
+
+// runCompletion prints a shell completion script
+func runCompletion(ctx context.Context, env *environment, args []string) error {
+	command := commandNamed("completion")
+	args, err := parseFlags(flagSet(env, command), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError(command)
+	}
+	return supervisorctl.WriteCompletionScript(env.stdout, args[0])
+}
+
+// runHelp lists the commands, or prints a command's help
+func runHelp(ctx context.Context, env *environment, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(env.stdout, `usage: supervisorctl [--server <url>] [--token <token>] [--profile <name>] [command] [args]
+
+Without a command, supervisorctl starts the interactive shell.
+
+Commands:
+%s
+Run supervisorctl help <command> or supervisorctl <command> -h for a command's arguments and flags.
+
+Exit codes: 0 success, 1 the supervisor rejected or failed the operation, 2 a wait timed out,
+3 the awaited agent or execution failed, 4 the supervisor could not be reached, 5 the supervisor
+rejected the token, 6 the supervisor failed with a 5xx status.
+`, listCommands(commands))
+		return nil
+	}
+	command, ok := lookupCommand(args[0])
+	if !ok || len(args) > 1 {
+		return fmt.Errorf("unknown command %q; supervisorctl help lists the commands", strings.Join(args, " "))
+	}
+	command.printHelp(env.stdout)
+	return nil
+}
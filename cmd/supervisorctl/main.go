@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// environment is what a command runs with: the config resolved from the file, the environment and
+// the global flags, the client of the supervisor it names, and the standard streams
+type environment struct {
+	manager *supervisorctl.ConfigManager
+	config  *supervisorctl.Config
+	client  *supervisorctl.Client
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// run runs the command args name and returns the exit code of its outcome. Without a command it
+// starts the interactive shell.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	path, err := supervisorctl.DefaultConfigPath()
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return supervisorctl.ExitFailure
+	}
+	manager := supervisorctl.NewConfigManager(path)
+
+	// The completion scripts' queries never print errors, which would corrupt the candidates
+	if len(args) > 0 && args[0] == supervisorctl.CompleteCommand {
+		supervisorctl.CompleteWithConfig(ctx, manager, stdout, args[1:])
+		return supervisorctl.ExitOK
+	}
+
+	flags, args, err := supervisorctl.ParseGlobalFlags(args)
+	if err == nil {
+		err = manager.ApplyGlobalFlags(flags)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return supervisorctl.ExitFailure
+	}
+
+	name := shellCommandName
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "-h" || name == "--help" {
+		name = "help"
+	}
+	command, ok := lookupCommand(name)
+	if !ok {
+		fmt.Fprintf(stderr, "error: unknown command %q; supervisorctl help lists the commands\n", name)
+		return supervisorctl.ExitFailure
+	}
+
+	env := &environment{manager: manager, stdin: stdin, stdout: stdout, stderr: stderr}
+	if command.remote {
+		if env.config, err = manager.Load(); err == nil {
+			env.client, err = supervisorctl.NewClientFromConfig(env.config)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return supervisorctl.ExitFailure
+		}
+	}
+
+	err = command.run(ctx, env, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return supervisorctl.ExitOK
+	}
+	if err != nil && !supervisorctl.PrintPermissionError(stderr, err) && !supervisorctl.PrintFieldErrors(stderr, err) {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+	}
+	return supervisorctl.ExitCode(err)
+}
+
+// flagSet returns the flags of a command, printing its help for -h
+func flagSet(env *environment, command *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.Usage = func() {
+		command.printHelp(env.stderr)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses a command's flags, which may come before, between or after its arguments, and
+// returns the arguments in order
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+}
+
+// usageError reports that a command was called with the wrong arguments
+func usageError(command *command) error {
+	return fmt.Errorf("usage: supervisorctl %s", command.usage)
+}
+
+// jsonOutput reports whether the configured format prints JSON
+func (env *environment) jsonOutput() bool {
+	return env.config != nil && env.config.Format == supervisorctl.OutputJSON
+}
+
+// writeJSON prints a result as indented JSON
+func (env *environment) writeJSON(value interface{}) error {
+	encoder := json.NewEncoder(env.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// tableOptions returns how tables are printed on stdout: fitted to the terminal and colored there
+func (env *environment) tableOptions() supervisorctl.TableOptions {
+	options := supervisorctl.TableOptions{}
+	if file, ok := env.stdout.(*os.File); ok {
+		options.Width = supervisorctl.TerminalWidth(file)
+		options.Colors = supervisorctl.ColorsEnabled(file, false)
+	}
+	return options
+}
+
+// shell returns an interactive shell on the command's streams, printing in the configured format
+// where the shell supports it
+func (env *environment) shell() *supervisorctl.Shell {
+	shell := supervisorctl.NewShell(env.client, env.stdin, env.stdout)
+	shell.SetTableOptions(env.tableOptions())
+	if env.config != nil && env.config.Format != "" {
+		_ = shell.SetFormat(env.config.Format) // yaml is left to the commands that print it
+	}
+	return shell
+}
+
+// listCommands returns the names and summaries of commands, aligned
+func listCommands(commands []*command) string {
+	var builder strings.Builder
+	for _, command := range commands {
+		fmt.Fprintf(&builder, "  %-12s %s\n", command.name, command.summary)
+	}
+	return builder.String()
+}
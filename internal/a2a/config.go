@@ -1,6 +1,9 @@
 package a2a
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/algonius/algonius-supervisor/internal/models"
@@ -21,6 +24,12 @@ type A2AConfig struct {
 	// Transport configuration
 	Transports A2ATransportConfig `json:"transports" yaml:"transports"`
 
+	// Push notification configuration
+	PushNotifications A2APushNotificationConfig `json:"push_notifications" yaml:"push_notifications"`
+
+	// Conversation threading configuration
+	Conversations A2AConversationConfig `json:"conversations" yaml:"conversations"`
+
 	// Agent configuration
 	Agents map[string]*models.AgentConfiguration `json:"agents" yaml:"agents"`
 }
@@ -35,9 +44,11 @@ type A2AAuthenticationConfig struct {
 
 // A2AProtocolConfig contains protocol-related configuration
 type A2AProtocolConfig struct {
-	Version       string        `json:"version" yaml:"version"`
+	Version       string        `json:"version" yaml:"version"` // Preferred message version
+	SupportedVersions []string  `json:"supported_versions" yaml:"supported_versions"` // Message versions accepted, only Version when empty
 	Timeout       time.Duration `json:"timeout" yaml:"timeout"`
 	MaxMessageSize int64        `json:"max_message_size" yaml:"max_message_size"`
+	Streaming     bool          `json:"streaming" yaml:"streaming"` // Advertise message streaming to peers
 }
 
 // A2ATransportConfig contains transport protocol configuration
@@ -72,6 +83,22 @@ type A2AJSONRPCConfig struct {
 	MaxBatchSize int `json:"max_batch_size" yaml:"max_batch_size"`
 }
 
+// A2APushNotificationConfig controls delivery of task push notifications to client callback URLs
+type A2APushNotificationConfig struct {
+	AllowInsecureURLs bool          `json:"allow_insecure_urls" yaml:"allow_insecure_urls"` // Accept plain HTTP callback URLs
+	MaxAttempts       int           `json:"max_attempts" yaml:"max_attempts"`
+	RetryBackoff      time.Duration `json:"retry_backoff" yaml:"retry_backoff"` // Doubles after every failed attempt
+	Timeout           time.Duration `json:"timeout" yaml:"timeout"`             // Per attempt
+}
+
+// A2AConversationConfig bounds the threads of messages sharing a conversation ID and the history
+// JSON-RPC-pattern agents are given from them
+type A2AConversationConfig struct {
+	IdleTTL         time.Duration `json:"idle_ttl" yaml:"idle_ttl"`                 // A conversation no message arrived in for this long expires
+	HistoryMessages int           `json:"history_messages" yaml:"history_messages"` // Most prior exchanges an agent is given
+	HistoryBytes    int           `json:"history_bytes" yaml:"history_bytes"`       // Most bytes of input and output those exchanges take
+}
+
 // DefaultA2AConfig returns a default A2A configuration
 func DefaultA2AConfig() *A2AConfig {
 	return &A2AConfig{
@@ -106,6 +133,136 @@ func DefaultA2AConfig() *A2AConfig {
 				MaxBatchSize: 10,
 			},
 		},
+		PushNotifications: A2APushNotificationConfig{
+			MaxAttempts:  5,
+			RetryBackoff: time.Second,
+			Timeout:      10 * time.Second,
+		},
+		Conversations: A2AConversationConfig{
+			IdleTTL:         time.Hour,
+			HistoryMessages: 10,
+			HistoryBytes:    64 * 1024,
+		},
 		Agents: make(map[string]*models.AgentConfiguration),
 	}
-}
\ No newline at end of file
+}
+
+// Validate sanity-checks the configuration and returns every problem found, joined into one error
+func (c *A2AConfig) Validate() error {
+	var errs []error
+
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		errs = append(errs, fmt.Errorf("server_port must be between 1 and 65535, got %d", c.ServerPort))
+	}
+
+	if c.Authentication.Required {
+		if c.Authentication.HeaderName == "" {
+			errs = append(errs, errors.New("authentication.header_name cannot be empty when authentication is required"))
+		}
+		if len(c.Authentication.ValidTokens) == 0 && c.Authentication.TokenEnvVar == "" {
+			errs = append(errs, errors.New("authentication requires valid_tokens or token_env_var"))
+		}
+	}
+
+	if _, _, ok := majorMinor(c.Protocol.Version); !ok {
+		errs = append(errs, fmt.Errorf("protocol.version must be a major.minor.patch version, got %q", c.Protocol.Version))
+	}
+	for _, version := range c.Protocol.SupportedVersions {
+		if _, _, ok := majorMinor(version); !ok {
+			errs = append(errs, fmt.Errorf("protocol.supported_versions must hold major.minor.patch versions, got %q", version))
+		}
+	}
+	if len(c.Protocol.SupportedVersions) > 0 && !containsVersion(c.Protocol.SupportedVersions, c.Protocol.Version) {
+		errs = append(errs, fmt.Errorf("protocol.supported_versions must include protocol.version %s", c.Protocol.Version))
+	}
+	if c.Protocol.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("protocol.timeout must be positive, got %s", c.Protocol.Timeout))
+	}
+	if c.Protocol.MaxMessageSize <= 0 {
+		errs = append(errs, fmt.Errorf("protocol.max_message_size must be positive, got %d", c.Protocol.MaxMessageSize))
+	}
+
+	transports := c.Transports
+	if !transports.HTTPEnabled && !transports.GRPCEnabled && !transports.JSONRPCEnabled {
+		errs = append(errs, errors.New("at least one transport must be enabled"))
+	}
+	if transports.GRPCEnabled && (transports.GRPCConfig.MaxRecvMsgSize <= 0 || transports.GRPCConfig.MaxSendMsgSize <= 0) {
+		errs = append(errs, errors.New("grpc_config message size limits must be positive when gRPC is enabled"))
+	}
+
+	if transports.HTTPConfig.EnableCORS {
+		for _, origin := range transports.HTTPConfig.AllowedOrigins {
+			if err := validateOrigin(origin); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	push := c.PushNotifications
+	if push.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("push_notifications.max_attempts must be at least 1, got %d", push.MaxAttempts))
+	}
+	if push.RetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("push_notifications.retry_backoff cannot be negative, got %s", push.RetryBackoff))
+	}
+	if push.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("push_notifications.timeout must be positive, got %s", push.Timeout))
+	}
+
+	conversations := c.Conversations
+	if conversations.IdleTTL < 0 {
+		errs = append(errs, fmt.Errorf("conversations.idle_ttl cannot be negative, got %s", conversations.IdleTTL))
+	}
+	if conversations.HistoryMessages < 0 {
+		errs = append(errs, fmt.Errorf("conversations.history_messages cannot be negative, got %d", conversations.HistoryMessages))
+	}
+	if conversations.HistoryBytes < 0 {
+		errs = append(errs, fmt.Errorf("conversations.history_bytes cannot be negative, got %d", conversations.HistoryBytes))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Warnings returns non-fatal concerns about the configuration
+func (c *A2AConfig) Warnings() []string {
+	var warnings []string
+
+	if !c.Authentication.Required {
+		warnings = append(warnings, "authentication is disabled")
+	} else if len(c.Authentication.ValidTokens) == 0 {
+		warnings = append(warnings, fmt.Sprintf("no valid_tokens configured; relying on token_env_var %s", c.Authentication.TokenEnvVar))
+	}
+
+	if c.PushNotifications.AllowInsecureURLs {
+		warnings = append(warnings, "push notifications may be sent to plain HTTP callback URLs")
+	}
+
+	httpConfig := c.Transports.HTTPConfig
+	if httpConfig.EnableCORS {
+		for _, origin := range httpConfig.AllowedOrigins {
+			if origin == "*" {
+				warnings = append(warnings, "CORS allows any origin while credentials are allowed")
+				break
+			}
+		}
+	}
+
+	return warnings
+}
+
+// validateOrigin checks that a CORS origin is either "*" or a bare scheme://host[:port]
+func validateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid CORS origin %q: must be \"*\" or scheme://host[:port]", origin)
+	}
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid CORS origin %q: must not contain a path, query or fragment", origin)
+	}
+
+	return nil
+}
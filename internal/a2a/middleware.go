@@ -1,10 +1,10 @@
 package a2a
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/algonius/algonius-supervisor/internal/api"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,10 +18,7 @@ func AuthenticationMiddleware(config *A2AConfig) gin.HandlerFunc {
 
 		authHeader := c.GetHeader(config.Authentication.HeaderName)
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header is required",
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "Authorization header is required")
 			return
 		}
 
@@ -31,10 +28,7 @@ func AuthenticationMiddleware(config *A2AConfig) gin.HandlerFunc {
 
 		// Check if the token is valid
 		if !isValidToken(token, config) {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid or expired token",
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "Invalid or expired token")
 			return
 		}
 
@@ -109,20 +103,12 @@ func RequestValidationMiddleware(config *A2AConfig) gin.HandlerFunc {
 		// Check content type
 		contentType := c.GetHeader("Content-Type")
 		if contentType != "application/json" && contentType != "application/json; charset=utf-8" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Content-Type must be application/json",
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnsupportedMediaType, api.CodeUnsupportedMediaType, "Content-Type must be application/json")
 			return
 		}
 
-		// Check message size
-		contentLength := c.Request.ContentLength
-		if contentLength > config.Protocol.MaxMessageSize {
-			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-				"error": fmt.Sprintf("Request body too large: max size is %d bytes", config.Protocol.MaxMessageSize),
-			})
-			c.Abort()
+		// Check message size, including bodies sent without a Content-Length
+		if !api.LimitRequestBody(c, config.Protocol.MaxMessageSize) {
 			return
 		}
 
@@ -0,0 +1,106 @@
+package a2a
+
+import (
+	"strconv"
+	"strings"
+
+	protocol "github.com/algonius/algonius-supervisor/pkg/a2a"
+)
+
+// Negotiation tells a peer what the supervisor supports before it sends work: the result of the
+// negotiate JSON-RPC method and gRPC call
+type Negotiation struct {
+	ProtocolVersions []string     `json:"protocol_versions"` // Message versions accepted; later patch releases of each are accepted too
+	PreferredVersion string       `json:"preferred_version"`
+	Methods          []string     `json:"methods"`
+	MaxMessageSize   int64        `json:"max_message_size"` // Bytes
+	Streaming        bool         `json:"streaming"`
+	Transports       []string     `json:"transports"`
+	AuthSchemes      []AuthScheme `json:"auth_schemes"` // Empty when no authentication is required
+}
+
+// AuthScheme is a way for a peer to authenticate
+type AuthScheme struct {
+	Scheme string `json:"scheme"` // bearer
+	Header string `json:"header"` // Header carrying the credentials
+}
+
+// SupportedVersions returns the message versions the supervisor accepts
+func (c *A2AConfig) SupportedVersions() []string {
+	if len(c.Protocol.SupportedVersions) == 0 {
+		return []string{c.Protocol.Version}
+	}
+	return append([]string(nil), c.Protocol.SupportedVersions...)
+}
+
+// Negotiate describes what the supervisor supports; methods lists the methods the transport serves
+func (c *A2AConfig) Negotiate(methods []string) Negotiation {
+	negotiation := Negotiation{
+		ProtocolVersions: c.SupportedVersions(),
+		PreferredVersion: c.Protocol.Version,
+		Methods:          methods,
+		MaxMessageSize:   c.Protocol.MaxMessageSize,
+		Streaming:        c.Protocol.Streaming,
+		Transports:       []string{},
+		AuthSchemes:      []AuthScheme{},
+	}
+	if c.Transports.HTTPEnabled {
+		negotiation.Transports = append(negotiation.Transports, "http_json")
+	}
+	if c.Transports.GRPCEnabled {
+		negotiation.Transports = append(negotiation.Transports, "grpc")
+	}
+	if c.Transports.JSONRPCEnabled {
+		negotiation.Transports = append(negotiation.Transports, "json_rpc")
+	}
+	if c.Authentication.Required {
+		negotiation.AuthSchemes = append(negotiation.AuthSchemes, AuthScheme{Scheme: "bearer", Header: c.Authentication.HeaderName})
+	}
+	return negotiation
+}
+
+// CheckProtocolVersion accepts an empty version, meaning the preferred one, and versions sharing
+// their major and minor version with a supported version. Others get an
+// UnsupportedProtocolVersionError listing the supported versions.
+func (c *A2AConfig) CheckProtocolVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+	supported := c.SupportedVersions()
+	if major, minor, ok := majorMinor(version); ok {
+		for _, candidate := range supported {
+			if candidateMajor, candidateMinor, _ := majorMinor(candidate); major == candidateMajor && minor == candidateMinor {
+				return nil
+			}
+		}
+	}
+	return protocol.NewA2AErrorWithData(protocol.UnsupportedProtocolVersionError, "Unsupported protocol version "+version,
+		protocol.UnsupportedVersion{Requested: version, Supported: supported})
+}
+
+// majorMinor parses the major and minor numbers of a major.minor.patch version
+func majorMinor(version string) (int, int, bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return 0, 0, false
+		}
+		numbers[i] = number
+	}
+	return numbers[0], numbers[1], true
+}
+
+// containsVersion reports whether versions holds version
+func containsVersion(versions []string, version string) bool {
+	for _, candidate := range versions {
+		if candidate == version {
+			return true
+		}
+	}
+	return false
+}
@@ -4,17 +4,23 @@ import (
 	"fmt"
 
 	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
 )
 
-// AgentFactory implements the IAgentFactory interface
+// AgentFactory implements the IAgentFactory interface. It is the one place runtime agents are built
+// from their configuration, whichever protocol or the scheduler runs them.
 type AgentFactory struct {
 	// supportedTypes is a list of agent types that can be created
 	supportedTypes []string
+
+	// logger is handed to the agents the factory creates
+	logger *zap.Logger
 }
 
 // NewAgentFactory creates a new instance of AgentFactory
-func NewAgentFactory() *AgentFactory {
+func NewAgentFactory(logger *zap.Logger) *AgentFactory {
 	return &AgentFactory{
+		logger: logger,
 		supportedTypes: []string{
 			"generic",
 			"cli",
@@ -24,6 +30,7 @@ func NewAgentFactory() *AgentFactory {
 			"claude",
 			"codex",
 			"gemini",
+			models.SyntheticAgentType,
 		},
 	}
 }
@@ -34,19 +41,16 @@ func (af *AgentFactory) CreateAgent(config *models.AgentConfiguration) (IAgent,
 		return nil, fmt.Errorf("agent configuration cannot be nil")
 	}
 
-	// Validate the config first
-	if err := af.ValidateConfig(config); err != nil {
-		return nil, fmt.Errorf("invalid agent configuration: %w", err)
-	}
-
-	// Create the appropriate agent based on the configuration
-	// For now, we'll create a generic agent for all types
-	// In a more complex implementation, we might have different agent types
-	agent := &GenericAgent{
-		config: config,
+	// Synthetic agents only simulate work and persistent agents share one long-lived process; every
+	// other agent runs a CLI process per execution. The agent validates its configuration when it
+	// executes, so a broken configuration is recorded as a failed execution.
+	switch {
+	case config.AgentType == models.SyntheticAgentType:
+		return NewSyntheticAgent(config, af.logger), nil
+	case config.Mode == models.PersistentMode:
+		return NewPersistentAgent(config, af.logger), nil
 	}
-
-	return agent, nil
+	return NewGenericAgent(config, af.logger), nil
 }
 
 // GetSupportedTypes returns a list of supported agent types
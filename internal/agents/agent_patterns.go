@@ -2,10 +2,10 @@ package agents
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -14,13 +14,19 @@ import (
 	"github.com/algonius/algonius-supervisor/pkg/types"
 )
 
-// InputPatternHandler handles different input patterns for agents
+// InputPatternHandler handles different input patterns for agents. It also processes the output
+// of agents whose output pattern has no handler of its own.
 type InputPatternHandler interface {
 	// PrepareInput prepares the input for the agent based on the pattern
 	PrepareInput(input string, config *models.AgentConfiguration) ([]string, io.Reader, error)
-	
+
+	OutputPatternHandler
+}
+
+// OutputPatternHandler turns an agent's stdout into its output
+type OutputPatternHandler interface {
 	// ProcessOutput processes the output from the agent based on the pattern
-	ProcessOutput(output []byte, config *models.AgentConfiguration) (string, error)
+	ProcessOutput(output []byte, config *models.AgentConfiguration) ([]byte, error)
 }
 
 // StdinHandler handles stdin input pattern
@@ -34,8 +40,8 @@ func (h *StdinHandler) PrepareInput(input string, config *models.AgentConfigurat
 }
 
 // ProcessOutput for StdinHandler
-func (h *StdinHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) (string, error) {
-	return string(output), nil
+func (h *StdinHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) ([]byte, error) {
+	return output, nil
 }
 
 // buildArgs builds command line arguments for stdin handler
@@ -55,23 +61,30 @@ func (h *StdinHandler) buildArgs(config *models.AgentConfiguration) []string {
 	return args
 }
 
-// FileHandler handles file input pattern
-type FileHandler struct{}
+// FileHandler handles file input pattern; files live in the execution's sandbox
+type FileHandler struct {
+	sandbox   *ExecutionSandbox
+	inputFile string          // Uploaded file linked at the input file template in place of the input, if any
+	ctx       context.Context // The execution's context, ending the wait for the output file
+}
 
 // PrepareInput for FileHandler
 func (h *FileHandler) PrepareInput(input string, config *models.AgentConfiguration) ([]string, io.Reader, error) {
 	if config.InputFileTemplate == "" {
 		return nil, nil, fmt.Errorf("input file template not specified in configuration")
 	}
+	if h.sandbox == nil {
+		return nil, nil, fmt.Errorf("file input pattern requires an execution sandbox")
+	}
 
-	// Generate the input filename based on the template
-	inputFilename := processTemplate(config.InputFileTemplate, map[string]interface{}{
-		"timestamp": time.Now().Unix(),
-		"agent_id":  config.ID,
-	})
+	// Resolve the input filename inside the sandbox
+	inputFilename, err := h.sandbox.Path(config.InputFileTemplate, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid input file template: %w", err)
+	}
 
-	// Write input to the file
-	if err := os.WriteFile(inputFilename, []byte(input), 0644); err != nil {
+	// Write input to the file, or link an uploaded input file there
+	if err := writeInputFile(inputFilename, input, h.inputFile); err != nil {
 		return nil, nil, fmt.Errorf("failed to write input to file: %w", err)
 	}
 
@@ -82,25 +95,21 @@ func (h *FileHandler) PrepareInput(input string, config *models.AgentConfigurati
 }
 
 // ProcessOutput for FileHandler
-func (h *FileHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) (string, error) {
+func (h *FileHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) ([]byte, error) {
 	// For file output, we need to read the output file
 	if config.OutputFileTemplate == "" {
-		return string(output), nil
+		return output, nil
 	}
-
-	// Generate the output filename based on the template
-	outputFilename := processTemplate(config.OutputFileTemplate, map[string]interface{}{
-		"timestamp": time.Now().Unix(),
-		"agent_id":  config.ID,
-	})
-
-	// Read the output file
-	outputContent, err := os.ReadFile(outputFilename)
-	if err != nil {
-		return "", fmt.Errorf("failed to read output file: %w", err)
+	if h.sandbox == nil {
+		return nil, fmt.Errorf("file output pattern requires an execution sandbox")
 	}
 
-	return string(outputContent), nil
+	// Read the output file from the sandbox, waiting for it as configured
+	ctx := h.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return readOutputFile(ctx, h.sandbox, config)
 }
 
 // buildArgs builds command line arguments for file handler
@@ -134,8 +143,8 @@ func (h *ArgsHandler) PrepareInput(input string, config *models.AgentConfigurati
 }
 
 // ProcessOutput for ArgsHandler
-func (h *ArgsHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) (string, error) {
-	return string(output), nil
+func (h *ArgsHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) ([]byte, error) {
+	return output, nil
 }
 
 // buildArgs builds command line arguments for args handler
@@ -181,28 +190,28 @@ func (h *JSONRPCHandler) PrepareInput(input string, config *models.AgentConfigur
 }
 
 // ProcessOutput for JSONRPCHandler
-func (h *JSONRPCHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) (string, error) {
+func (h *JSONRPCHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) ([]byte, error) {
 	// For JSON-RPC, we parse the output as a JSON-RPC response
 	var rpcResponse map[string]interface{}
 	if err := json.Unmarshal(output, &rpcResponse); err != nil {
-		return "", fmt.Errorf("failed to unmarshal JSON-RPC response: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal JSON-RPC response: %w", err)
 	}
 
 	// Check if it's an error response
 	if err, hasError := rpcResponse["error"]; hasError {
-		return "", fmt.Errorf("JSON-RPC error response: %v", err)
+		return nil, fmt.Errorf("JSON-RPC error response: %v", err)
 	}
 
 	// Extract the result
 	if result, hasResult := rpcResponse["result"]; hasResult {
 		resultBytes, err := json.Marshal(result)
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal result: %w", err)
+			return nil, fmt.Errorf("failed to marshal result: %w", err)
 		}
-		return string(resultBytes), nil
+		return resultBytes, nil
 	}
 
-	return string(output), nil
+	return output, nil
 }
 
 // buildArgs builds command line arguments for JSON-RPC handler
@@ -239,6 +248,39 @@ func GetInputPatternHandler(inputPattern types.InputPattern) InputPatternHandler
 	}
 }
 
+// GetOutputPatternHandler returns the handler of output patterns processed independently of the
+// input pattern, or nil when the input pattern handler processes the output
+func GetOutputPatternHandler(outputPattern types.OutputPattern) OutputPatternHandler {
+	switch outputPattern {
+	case types.JsonPatternOut:
+		return &JSONOutputHandler{}
+	default:
+		return nil
+	}
+}
+
+// outputHandler returns the handler processing the agent's stdout, falling back to its input handler.
+// The file output pattern reads the output file from the sandbox whatever the input pattern.
+func outputHandler(ctx context.Context, config *models.AgentConfiguration, input InputPatternHandler, sandbox *ExecutionSandbox) OutputPatternHandler {
+	if handler := GetOutputPatternHandler(config.OutputPattern); handler != nil {
+		return handler
+	}
+	if config.OutputPattern == types.FilePatternOut {
+		if _, ok := input.(*FileHandler); !ok {
+			return &FileHandler{sandbox: sandbox, ctx: ctx}
+		}
+	}
+	return input
+}
+
+// patternHandler returns the input pattern handler, giving the file handler the execution's sandbox
+func patternHandler(ctx context.Context, inputPattern types.InputPattern, sandbox *ExecutionSandbox) InputPatternHandler {
+	if inputPattern == types.FilePattern {
+		return &FileHandler{sandbox: sandbox, ctx: ctx}
+	}
+	return GetInputPatternHandler(inputPattern)
+}
+
 // processTemplate processes a template string with the given variables
 func processTemplate(template string, vars map[string]interface{}) string {
 	result := template
@@ -255,81 +297,108 @@ func generateRequestID() string {
 	return fmt.Sprintf("req-%d", time.Now().Unix())
 }
 
-// ExecuteAgentWithPattern executes an agent using the appropriate pattern handler
-func ExecuteAgentWithPattern(config *models.AgentConfiguration, input string) (string, error) {
+// ExecuteAgentWithPattern executes an agent using the appropriate pattern handler.
+// Stdout and stderr are captured separately; only stdout is passed to the output handler.
+func ExecuteAgentWithPattern(ctx context.Context, config *models.AgentConfiguration, input string) (*ProcessResult, error) {
+	// File patterns exchange data through a private per-execution directory
+	var sandbox *ExecutionSandbox
+	if usesSandbox(config) {
+		var err error
+		sandbox, err = NewExecutionSandbox(config)
+		if err != nil {
+			return nil, err
+		}
+		defer sandbox.Cleanup()
+	}
+
 	// Get the appropriate handler for the input pattern
-	handler := GetInputPatternHandler(config.InputPattern)
+	handler := patternHandler(ctx, config.InputPattern, sandbox)
+	if fileHandler, ok := handler.(*FileHandler); ok {
+		fileHandler.inputFile = inputFileFromContext(ctx)
+	}
 
 	// Prepare the command arguments and input
 	args, inputReader, err := handler.PrepareInput(input, config)
 	if err != nil {
-		return "", fmt.Errorf("failed to prepare input: %w", err)
+		return nil, fmt.Errorf("failed to prepare input: %w", err)
 	}
 
-	// Create the command
-	cmd := exec.Command(config.ExecutablePath, args...)
+	// The watchdog cancels ctx, stopping the agent, when it stays silent for too long
+	watchdog := newWatchdog(config, config.WorkingDirectory)
+	ctx, stopWatching := watchdog.watch(ctx)
+	defer stopWatching()
+
+	// Create the command; batch files on Windows run through cmd.exe
+	program, programArgs := commandLine(config.ExecutablePath, args)
+	cmd := exec.CommandContext(ctx, program, programArgs...)
 
 	// Set working directory if specified
 	if config.WorkingDirectory != "" {
 		cmd.Dir = config.WorkingDirectory
 	}
 
-	// Set environment variables
-	if config.Envs != nil {
-		envVars := make([]string, 0, len(config.Envs))
-		for key, value := range config.Envs {
-			envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
-		}
-		cmd.Env = append(os.Environ(), envVars...)
-	}
+	// Set environment variables, including the request ID when known
+	cmd.Env = withSandboxEnv(processEnv(ctx, config.Envs), sandbox)
 
-	// Set up stdin if we have an input reader
-	var stdinPipe io.WriteCloser
+	// Feed stdin from the prepared input, if any
 	if inputReader != nil {
-		stdinPipe, err = cmd.StdinPipe()
-		if err != nil {
-			return "", fmt.Errorf("failed to create stdin pipe: %w", err)
+		cmd.Stdin = inputReader
+	}
+
+	// Run as the agent's user with its nice level and resource limits
+	if err := applyProcessLimits(cmd, config); err != nil {
+		return nil, fmt.Errorf("failed to apply process limits: %w", err)
+	}
+
+	// Cancelling ctx sends the agent's process tree its stop signal; it is killed after the stop wait
+	terminator := newProcessTerminator()
+	terminator.Prepare(cmd)
+	cmd.Cancel = func() error {
+		signal, _ := stopSettings(ctx, config)
+		if signal == "KILL" {
+			return terminator.Kill(cmd)
 		}
+		return terminator.Terminate(cmd, signal)
 	}
+	_, wait := stopSettings(ctx, config)
+	cmd.WaitDelay = wait
 
-	// Start the command
+	stdout, stderr := captureOutput(ctx, cmd, config, watchdog)
+
+	// Run the command to completion, tracking it in the process registry while it runs
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start command: %w", err)
+		return nil, fmt.Errorf("command execution failed: %w", err)
 	}
-
-	// Write input to stdin if needed
-	if stdinPipe != nil {
-		go func() {
-			defer stdinPipe.Close()
-			_, err := io.Copy(stdinPipe, inputReader)
-			if err != nil {
-				// Log the error but don't fail the entire operation
-				// as the command might have already started successfully
-			}
-		}()
+	untrack := trackProcess(ctx, cmd, config.ID)
+	runErr := cmd.Wait()
+	untrack()
+	if hung := hungCause(ctx); hung != nil {
+		result := newProcessResult(cmd, stdout, stderr)
+		result.Output = string(result.Stdout)
+		return result, hung
+	}
+	if runErr != nil && !isExitError(runErr) {
+		return nil, fmt.Errorf("command execution failed: %w", runErr)
 	}
 
-	// Wait for command to finish and get output
-	output, err := cmd.Output()
-	if err != nil {
-		// Check if the error is due to a non-zero exit code
-		if exitError, ok := err.(*exec.ExitError); ok {
-			// Use stderr if stdout is empty
-			if len(exitError.Stderr) > 0 {
-				output = exitError.Stderr
-			} else {
-				output = []byte(err.Error())
-			}
-		} else {
-			return "", fmt.Errorf("command execution failed: %w", err)
+	result := newProcessResult(cmd, stdout, stderr)
+	if _, mapped := mappedExitStatus(config, result.ExitCode); runErr != nil && !mapped {
+		result.Output = string(result.Stdout)
+		if violation := resourceLimitViolation(config, cmd.ProcessState, result.Stderr); violation != "" {
+			return result, fmt.Errorf("%w: %s", models.ErrResourceLimitExceeded, violation)
 		}
+		if result.Signal != "" {
+			return result, fmt.Errorf("agent terminated by signal %s", result.Signal)
+		}
+		return result, fmt.Errorf("agent exited with code %d", result.ExitCode)
 	}
 
-	// Process the output using the handler
-	result, err := handler.ProcessOutput(output, config)
+	// Process stdout using the output pattern's handler
+	output, err := outputHandler(ctx, config, handler, sandbox).ProcessOutput(result.Stdout, config)
 	if err != nil {
-		return "", fmt.Errorf("failed to process output: %w", err)
+		return result, fmt.Errorf("failed to process output: %w", err)
 	}
+	result.Output = string(output)
 
 	return result, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,129 @@
+package agents
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// ExecutionDeadline bounds an execution like context.WithTimeout, except that the deadline can be
+// pushed outward while the execution runs
+type ExecutionDeadline struct {
+	mutex    sync.Mutex
+	start    time.Time
+	deadline time.Time
+	timer    *time.Timer
+	done     chan struct{}
+	err      error
+}
+
+// deadlineContext is the context of an execution bounded by an ExecutionDeadline. Contexts derived
+// from it see context.DeadlineExceeded once the deadline passes, as with context.WithTimeout.
+type deadlineContext struct {
+	context.Context
+	deadline *ExecutionDeadline
+}
+
+// executionDeadlineKey carries the ExecutionDeadline of an execution on its context
+type executionDeadlineKey struct{}
+
+// WithExecutionDeadline returns a context that is done timeout from now, or when parent is done,
+// along with the deadline that moves it. The returned cancel function releases the timer and must be
+// called once the execution ends.
+func WithExecutionDeadline(parent context.Context, timeout time.Duration) (context.Context, *ExecutionDeadline, context.CancelFunc) {
+	now := time.Now()
+	d := &ExecutionDeadline{start: now, deadline: now.Add(timeout), done: make(chan struct{})}
+	d.timer = time.AfterFunc(timeout, func() { d.close(context.DeadlineExceeded) })
+	stop := context.AfterFunc(parent, func() { d.close(parent.Err()) })
+
+	return &deadlineContext{Context: parent, deadline: d}, d, func() {
+		stop()
+		d.close(context.Canceled)
+	}
+}
+
+// ExecutionDeadlineFromContext returns the deadline bounding the execution of ctx, nil when the
+// execution has none the supervisor can move
+func ExecutionDeadlineFromContext(ctx context.Context) *ExecutionDeadline {
+	d, _ := ctx.Value(executionDeadlineKey{}).(*ExecutionDeadline)
+	return d
+}
+
+// Start returns when the deadline started counting
+func (d *ExecutionDeadline) Start() time.Time {
+	return d.start
+}
+
+// Deadline returns the time the execution is stopped at
+func (d *ExecutionDeadline) Deadline() time.Time {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.deadline
+}
+
+// Extend moves the deadline to deadline and reports whether it did; deadlines only move outward, and
+// not once the execution is done
+func (d *ExecutionDeadline) Extend(deadline time.Time) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.err != nil || !deadline.After(d.deadline) {
+		return false
+	}
+	if !d.timer.Stop() {
+		return false // The timer fired and is closing the context
+	}
+	d.deadline = deadline
+	d.timer.Reset(time.Until(deadline))
+	return true
+}
+
+// close ends the context with err unless it already ended
+func (d *ExecutionDeadline) close(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.err != nil {
+		return
+	}
+	d.timer.Stop()
+	d.err = err
+	close(d.done)
+}
+
+// Deadline returns the current deadline; it may move later
+func (c *deadlineContext) Deadline() (time.Time, bool) {
+	return c.deadline.Deadline(), true
+}
+
+// Done is closed when the deadline passes or the parent is done
+func (c *deadlineContext) Done() <-chan struct{} {
+	return c.deadline.done
+}
+
+// Err returns context.DeadlineExceeded once the deadline passed, the parent's error when it ended
+// first, nil before
+func (c *deadlineContext) Err() error {
+	c.deadline.mutex.Lock()
+	defer c.deadline.mutex.Unlock()
+	return c.deadline.err
+}
+
+// Value returns the execution's deadline for executionDeadlineKey, the parent's values otherwise
+func (c *deadlineContext) Value(key any) any {
+	if key == (executionDeadlineKey{}) {
+		return c.deadline
+	}
+	return c.Context.Value(key)
+}
+
+// withAgentTimeout bounds an agent's execution by its timeout, unless the supervisor manages the
+// execution's deadline
+func withAgentTimeout(ctx context.Context, config *models.AgentConfiguration) (context.Context, context.CancelFunc) {
+	if config.Timeout <= 0 || ExecutionDeadlineFromContext(ctx) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second)
+}
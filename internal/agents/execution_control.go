@@ -0,0 +1,108 @@
+package agents
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ControlFDEnvVar tells agent processes the file descriptor they may write control messages to, one
+// JSON ControlMessage per line. It is only set for executions the supervisor accepts messages for.
+const ControlFDEnvVar = "SUPERVISOR_CONTROL_FD"
+
+// ControlExtendDeadline asks for the execution's deadline to be pushed out by Seconds
+const ControlExtendDeadline = "extend_deadline"
+
+// ControlMessage is a request an agent process writes to its control file descriptor, such as
+// {"type":"extend_deadline","seconds":300,"reason":"waiting for approval"}
+type ControlMessage struct {
+	Type    string `json:"type"`
+	Seconds int    `json:"seconds,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// IExecutionControl handles the control messages the agent process of an execution writes
+type IExecutionControl interface {
+	// ExtendDeadline pushes the execution's deadline out by the given duration
+	ExtendDeadline(by time.Duration, reason string) error
+}
+
+// executionControlKey carries the IExecutionControl of an execution on its context
+type executionControlKey struct{}
+
+// WithExecutionControl returns a context whose agent processes may send control to control
+func WithExecutionControl(ctx context.Context, control IExecutionControl) context.Context {
+	return context.WithValue(ctx, executionControlKey{}, control)
+}
+
+// executionControlFromContext returns the context's execution control, or nil
+func executionControlFromContext(ctx context.Context) IExecutionControl {
+	control, _ := ctx.Value(executionControlKey{}).(IExecutionControl)
+	return control
+}
+
+// controlChannel is the pipe an agent process writes control messages to; a nil channel does nothing
+type controlChannel struct {
+	reader  *os.File
+	writer  *os.File
+	control IExecutionControl
+	logger  *zap.Logger
+}
+
+// started hands the write end over to the started process and serves its messages in the background
+func (c *controlChannel) started() {
+	if c == nil {
+		return
+	}
+	c.writer.Close()
+	go c.serve()
+}
+
+// Close stops serving messages, including those of children of the agent still holding the pipe
+func (c *controlChannel) Close() {
+	if c == nil {
+		return
+	}
+	c.writer.Close()
+	c.reader.Close()
+}
+
+// serve handles control messages until the pipe is closed
+func (c *controlChannel) serve() {
+	scanner := bufio.NewScanner(c.reader)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := c.handle(scanner.Bytes()); err != nil {
+			c.logger.Warn("rejected agent control message", zap.ByteString("message", scanner.Bytes()), zap.Error(err))
+		}
+	}
+}
+
+// handle applies one control message
+func (c *controlChannel) handle(line []byte) error {
+	var message ControlMessage
+	if err := json.Unmarshal(line, &message); err != nil {
+		return fmt.Errorf("invalid control message: %w", err)
+	}
+
+	switch message.Type {
+	case ControlExtendDeadline:
+		if message.Seconds <= 0 {
+			return fmt.Errorf("%s requires a positive number of seconds", ControlExtendDeadline)
+		}
+		reason := message.Reason
+		if reason == "" {
+			reason = "requested by the agent"
+		}
+		return c.control.ExtendDeadline(time.Duration(message.Seconds)*time.Second, reason)
+	default:
+		return fmt.Errorf("unknown control message type %q", message.Type)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package agents
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"go.uber.org/zap"
+)
+
+// openControlChannel passes cmd a pipe to write control messages to, announced by ControlFDEnvVar,
+// when the execution of ctx accepts them
+func openControlChannel(ctx context.Context, cmd *exec.Cmd, logger *zap.Logger) (*controlChannel, error) {
+	control := executionControlFromContext(ctx)
+	if control == nil {
+		return nil, nil
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control pipe: %w", err)
+	}
+
+	// ExtraFiles start at file descriptor 3
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, writer)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", ControlFDEnvVar, fd))
+
+	return &controlChannel{reader: reader, writer: writer, control: control, logger: logger}, nil
+}
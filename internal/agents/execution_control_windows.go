@@ -0,0 +1,16 @@
+//go:build windows
+
+package agents
+
+import (
+	"context"
+	"os/exec"
+
+	"go.uber.org/zap"
+)
+
+// openControlChannel does nothing on Windows, which cannot pass processes extra file descriptors;
+// deadlines there are only extended through the API
+func openControlChannel(ctx context.Context, cmd *exec.Cmd, logger *zap.Logger) (*controlChannel, error) {
+	return nil, nil
+}
@@ -0,0 +1,157 @@
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// ISnapshotRecorder keeps the environment snapshot of an execution's agent process
+type ISnapshotRecorder interface {
+	// RecordSnapshot records what the agent process of the execution was started with
+	RecordSnapshot(snapshot *models.ExecutionSnapshot)
+}
+
+// snapshotRecorderKey carries the ISnapshotRecorder of an execution on its context
+type snapshotRecorderKey struct{}
+
+// WithSnapshotRecorder returns a context whose agent processes are recorded by recorder before they start
+func WithSnapshotRecorder(ctx context.Context, recorder ISnapshotRecorder) context.Context {
+	return context.WithValue(ctx, snapshotRecorderKey{}, recorder)
+}
+
+// recordSnapshot hands the snapshot of the prepared cmd to the context's recorder, if any
+func recordSnapshot(ctx context.Context, cmd *exec.Cmd, config *models.AgentConfiguration, logger *zap.Logger) {
+	recorder, _ := ctx.Value(snapshotRecorderKey{}).(ISnapshotRecorder)
+	if recorder == nil {
+		return
+	}
+
+	snapshot := CaptureExecutable(config)
+	snapshot.Argv = append([]string(nil), cmd.Args...)
+	if cmd.Dir != "" {
+		snapshot.WorkingDir = cmd.Dir
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	snapshot.EnvNames = envNames(env)
+	if snapshot.ExecutableSHA256 == "" {
+		logger.Warn("failed to hash agent executable", zap.String("agent_id", config.ID), zap.String("path", snapshot.ExecutablePath))
+	}
+	recorder.RecordSnapshot(snapshot)
+}
+
+// CaptureExecutable returns the part of an execution snapshot an agent's configuration determines
+// before anything runs: the executable it resolves to and its hash, the working directory and the
+// configuration's revision. Replays compare it with the snapshot of the execution they replay.
+func CaptureExecutable(config *models.AgentConfiguration) *models.ExecutionSnapshot {
+	snapshot := &models.ExecutionSnapshot{
+		ExecutablePath:       config.ExecutablePath,
+		WorkingDir:           config.WorkingDirectory,
+		AgentConfigUpdatedAt: config.UpdatedAt,
+		CapturedAt:           time.Now(),
+	}
+	if snapshot.WorkingDir == "" {
+		snapshot.WorkingDir, _ = os.Getwd()
+	}
+	if path, err := ResolveExecutable(config.ExecutablePath, config.WorkingDirectory); err == nil {
+		snapshot.ExecutablePath = path
+		snapshot.ExecutableSHA256, _ = HashExecutable(path)
+	}
+	return snapshot
+}
+
+// ResolveExecutable returns the absolute path an agent executable runs from: bare command names are
+// looked up in PATH and other relative paths are taken from workingDirectory
+func ResolveExecutable(path, workingDirectory string) (string, error) {
+	if !strings.ContainsRune(path, os.PathSeparator) && !strings.ContainsRune(path, '/') {
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Abs(resolved)
+	}
+
+	resolved := path
+	if !filepath.IsAbs(path) && workingDirectory != "" {
+		resolved = filepath.Join(workingDirectory, path)
+	}
+	resolved, _, err := statExecutable(resolved)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// executableHash is the hash of an executable as of its modification time and size
+type executableHash struct {
+	modTime time.Time
+	size    int64
+	sum     string
+}
+
+var (
+	executableHashMutex sync.Mutex
+	executableHashes    = make(map[string]executableHash)
+)
+
+// HashExecutable returns the hex SHA-256 of the file at path. Hashes are cached by path and only
+// recomputed once the file's modification time or size changes, so large binaries are read once.
+func HashExecutable(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	executableHashMutex.Lock()
+	cached, ok := executableHashes[path]
+	executableHashMutex.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.sum, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	executableHashMutex.Lock()
+	executableHashes[path] = executableHash{modTime: info.ModTime(), size: info.Size(), sum: sum}
+	executableHashMutex.Unlock()
+	return sum, nil
+}
+
+// envNames returns the sorted, distinct names of the NAME=value entries of env
+func envNames(env []string) []string {
+	seen := make(map[string]bool, len(env))
+	names := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,163 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Errors reported by CheckFilesystem, one per kind of problem
+var (
+	ErrExecutableNotFound           = errors.New("executable not found")
+	ErrExecutableNotExecutable      = errors.New("executable is not executable")
+	ErrWorkingDirectoryNotFound     = errors.New("working directory does not exist")
+	ErrWorkingDirectoryNotDirectory = errors.New("working directory is not a directory")
+	ErrTemplateDirectoryNotWritable = errors.New("file template directory is not writable")
+)
+
+// FilesystemIssue is a filesystem problem with one field of an agent configuration
+type FilesystemIssue struct {
+	Field string // Configuration field, such as "executable_path"
+	Err   error  // Wraps one of the Err* kinds above
+}
+
+// Error returns the field and the problem found with it
+func (i FilesystemIssue) Error() string {
+	return i.Field + ": " + i.Err.Error()
+}
+
+// Unwrap returns the underlying error so callers can match the kind with errors.Is
+func (i FilesystemIssue) Unwrap() error {
+	return i.Err
+}
+
+// CheckFilesystem checks that the agent's executable exists and is executable, that its working
+// directory exists, and that the directory its file templates are written to is writable
+func CheckFilesystem(config *models.AgentConfiguration) []FilesystemIssue {
+	var issues []FilesystemIssue
+
+	if err := checkExecutable(config.ExecutablePath, config.WorkingDirectory); err != nil {
+		issues = append(issues, FilesystemIssue{Field: "executable_path", Err: err})
+	}
+	if err := checkWorkingDirectory(config.WorkingDirectory); err != nil {
+		issues = append(issues, FilesystemIssue{Field: "working_directory", Err: err})
+	}
+
+	if config.InputFileTemplate != "" || config.OutputFileTemplate != "" {
+		if err := checkWritableDirectory(SandboxRoot(config)); err != nil {
+			field := "input_file_template"
+			if config.InputFileTemplate == "" {
+				field = "output_file_template"
+			}
+			issues = append(issues, FilesystemIssue{Field: field, Err: err})
+		}
+	}
+
+	return issues
+}
+
+// checkExecutable resolves a bare command name via PATH and other paths against the working
+// directory the agent runs in
+func checkExecutable(path, workingDirectory string) error {
+	if path == "" {
+		return nil
+	}
+
+	if !strings.ContainsRune(path, os.PathSeparator) && !strings.ContainsRune(path, '/') {
+		if _, err := exec.LookPath(path); err != nil {
+			if errors.Is(err, exec.ErrNotFound) {
+				return fmt.Errorf("%w: %s is not in PATH", ErrExecutableNotFound, path)
+			}
+			return fmt.Errorf("%w: %s: %v", ErrExecutableNotExecutable, path, err)
+		}
+		return nil
+	}
+
+	resolved := path
+	if !filepath.IsAbs(path) && workingDirectory != "" {
+		resolved = filepath.Join(workingDirectory, path)
+	}
+
+	resolved, info, err := statExecutable(resolved)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrExecutableNotFound, resolved)
+		}
+		return fmt.Errorf("%w: %s: %v", ErrExecutableNotFound, resolved, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s is a directory", ErrExecutableNotExecutable, resolved)
+	}
+	if _, err := exec.LookPath(resolved); err != nil {
+		return fmt.Errorf("%w: %s", ErrExecutableNotExecutable, resolved)
+	}
+	return nil
+}
+
+// statExecutable stats path or, when it does not exist and has no extension, the first existing
+// path with one of the platform's executable extensions, such as .exe on Windows
+func statExecutable(path string) (string, os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err == nil || !errors.Is(err, os.ErrNotExist) || filepath.Ext(path) != "" {
+		return path, info, err
+	}
+
+	for _, extension := range executableExtensions() {
+		if candidate, candidateErr := os.Stat(path + extension); candidateErr == nil {
+			return path + extension, candidate, nil
+		}
+	}
+	return path, nil, err
+}
+
+// checkWorkingDirectory checks that the working directory, when set, is an existing directory
+func checkWorkingDirectory(workingDirectory string) error {
+	if workingDirectory == "" {
+		return nil
+	}
+
+	info, err := os.Stat(workingDirectory)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrWorkingDirectoryNotFound, workingDirectory)
+		}
+		return fmt.Errorf("%w: %s: %v", ErrWorkingDirectoryNotFound, workingDirectory, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrWorkingDirectoryNotDirectory, workingDirectory)
+	}
+	return nil
+}
+
+// checkWritableDirectory checks that files can be created in dir or, when it does not exist yet,
+// in its nearest existing parent, where it will be created
+func checkWritableDirectory(dir string) error {
+	existing := dir
+	for {
+		info, err := os.Stat(existing)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%w: %s is not a directory", ErrTemplateDirectoryNotWritable, existing)
+			}
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return fmt.Errorf("%w: no parent of %s exists", ErrTemplateDirectoryNotWritable, dir)
+		}
+		existing = parent
+	}
+
+	probe, err := os.CreateTemp(existing, ".write-check-")
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrTemplateDirectoryNotWritable, existing, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
@@ -2,28 +2,31 @@ package agents
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/logging"
 	"github.com/algonius/algonius-supervisor/internal/models"
 	"go.uber.org/zap"
 )
 
 // GenericAgent implements the IAgent interface for a generic CLI agent
 type GenericAgent struct {
-	config *models.AgentConfiguration
-	logger *zap.Logger
+	config     *models.AgentConfiguration
+	logger     *zap.Logger
+	terminator ProcessTerminator
 }
 
 // NewGenericAgent creates a new instance of GenericAgent
 func NewGenericAgent(config *models.AgentConfiguration, logger *zap.Logger) *GenericAgent {
 	return &GenericAgent{
-		config: config,
-		logger: logger,
+		config:     config,
+		logger:     logger,
+		terminator: newProcessTerminator(),
 	}
 }
 
@@ -33,6 +36,7 @@ func (ga *GenericAgent) Execute(ctx context.Context, input string) (*models.Exec
 		return nil, fmt.Errorf("agent configuration is nil")
 	}
 
+	logger := logging.LoggerFromContext(ctx, ga.logger)
 	startTime := time.Now()
 
 	// Create execution result
@@ -45,7 +49,7 @@ func (ga *GenericAgent) Execute(ctx context.Context, input string) (*models.Exec
 
 	// Validate the agent configuration
 	if err := ga.Validate(); err != nil {
-		ga.logger.Error("agent validation failed", zap.Error(err))
+		logger.Error("agent validation failed", zap.Error(err))
 		result.Status = models.FailureStatus
 		result.Error = err.Error()
 		result.EndTime = time.Now()
@@ -53,39 +57,82 @@ func (ga *GenericAgent) Execute(ctx context.Context, input string) (*models.Exec
 		return result, err
 	}
 
+	// File patterns exchange data through a private per-execution directory
+	var sandbox *ExecutionSandbox
+	if usesSandbox(ga.config) {
+		var err error
+		sandbox, err = NewExecutionSandbox(ga.config)
+		if err != nil {
+			logger.Error("failed to create execution sandbox", zap.Error(err))
+			result.Status = models.FailureStatus
+			result.Error = err.Error()
+			result.EndTime = time.Now()
+			result.SanitizeInput()
+			return result, err
+		}
+		defer func() {
+			if err := sandbox.Cleanup(); err != nil {
+				logger.Warn("failed to remove execution sandbox", zap.String("dir", sandbox.Dir), zap.Error(err))
+			}
+		}()
+	}
+
 	// Prepare command execution based on input pattern
-	cmd, stdin, err := ga.prepareCommand(input)
+	cmd, stdin, err := ga.prepareCommand(ctx, input, sandbox)
+	var stdout, stderr *cappedBuffer
+	var watchdog *watchdog
+	if err == nil {
+		watchdog = newWatchdog(ga.config, cmd.Dir)
+		stdout, stderr = captureOutput(ctx, cmd, ga.config, watchdog)
+	}
 	if err != nil {
-		ga.logger.Error("failed to prepare command", zap.Error(err))
+		logger.Error("failed to prepare command", zap.Error(err))
 		result.Status = models.FailureStatus
 		result.Error = err.Error()
 		result.EndTime = time.Now()
 		result.SanitizeInput()
 		return result, err
 	}
+	recordSnapshot(ctx, cmd, ga.config, logger)
 
-	// Set context with timeout
-	if ga.config.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(ga.config.Timeout)*time.Second)
-		defer cancel()
+	// The agent may ask for more time through its control file descriptor
+	control, err := openControlChannel(ctx, cmd, logger)
+	if err != nil {
+		logger.Error("failed to open control channel", zap.Error(err))
+		result.Status = models.FailureStatus
+		result.Error = err.Error()
+		result.EndTime = time.Now()
+		result.SanitizeInput()
+		return result, err
 	}
+	defer control.Close()
+
+	// Set context with timeout, unless the execution service manages the deadline
+	ctx, cancel := withAgentTimeout(ctx, ga.config)
+	defer cancel()
+
+	// The watchdog cancels ctx when the agent stays silent for too long
+	ctx, stopWatching := watchdog.watch(ctx)
+	defer stopWatching()
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		ga.logger.Error("failed to start command", zap.Error(err))
+		logger.Error("failed to start command", zap.Error(err))
 		result.Status = models.FailureStatus
 		result.Error = err.Error()
 		result.EndTime = time.Now()
 		result.SanitizeInput()
 		return result, err
 	}
+	control.started()
+	untrack := trackProcess(ctx, cmd, ga.config.ID)
+	defer untrack()
 
 	// Write input to stdin if needed
 	if stdin != nil {
 		_, err := stdin.Write([]byte(input))
 		if err != nil {
-			ga.logger.Error("failed to write to stdin", zap.Error(err))
+			logger.Error("failed to write to stdin", zap.Error(err))
 			// Continue execution even if input write fails
 		}
 		stdin.Close()
@@ -97,35 +144,49 @@ func (ga *GenericAgent) Execute(ctx context.Context, input string) (*models.Exec
 		done <- cmd.Wait()
 	}()
 
+	var execErr error
 	select {
 	case <-ctx.Done():
-		// Context was cancelled (timeout or cancellation)
-		if ctx.Err() == context.DeadlineExceeded {
-			ga.logger.Info("agent execution timed out", zap.String("agent_id", ga.config.ID))
-			// Attempt to kill the process
-			if cmd.Process != nil {
-				cmd.Process.Kill()
-			}
+		// Context was cancelled (hung agent, timeout or cancellation)
+		if hung := hungCause(ctx); hung != nil {
+			logger.Warn("agent hung and is being stopped",
+				zap.String("agent_id", ga.config.ID),
+				zap.Duration("silence", hung.Silence),
+				zap.Time("last_activity", hung.LastActivity))
+			result.Status = models.FailureStatus
+			result.Error = hung.Error()
+			execErr = hung
+		} else if ctx.Err() == context.DeadlineExceeded {
+			logger.Info("agent execution timed out", zap.String("agent_id", ga.config.ID))
 			result.Status = models.TimeoutStatus
 			result.Error = "execution timed out"
+			execErr = fmt.Errorf("execution timed out: %w", ctx.Err())
 		} else {
-			ga.logger.Info("agent execution cancelled", zap.String("agent_id", ga.config.ID))
-			if cmd.Process != nil {
-				cmd.Process.Kill()
-			}
+			logger.Info("agent execution cancelled", zap.String("agent_id", ga.config.ID))
 			result.Status = models.CancelledStatus
 			result.Error = "execution cancelled"
+			execErr = fmt.Errorf("execution cancelled: %w", ctx.Err())
+		}
+		// Stop the process tree and reap it so its exit state and output are complete
+		signal, wait := stopSettings(ctx, ga.config)
+		if forced, _ := stopProcess(ga.terminator, cmd, done, signal, wait); forced {
+			logger.Warn("agent did not exit after being terminated and was killed",
+				zap.String("agent_id", ga.config.ID),
+				zap.String("stop_signal", signal),
+				zap.Duration("stop_wait", wait))
+			result.ForcedKill = true
 		}
 	case err := <-done:
 		// Command completed
 		if err != nil {
-			ga.logger.Info("agent execution completed with error", 
+			logger.Info("agent execution completed with error", 
 				zap.String("agent_id", ga.config.ID), 
 				zap.Error(err))
 			result.Status = models.FailureStatus
 			result.Error = err.Error()
+			execErr = err
 		} else {
-			ga.logger.Info("agent execution completed successfully", 
+			logger.Info("agent execution completed successfully", 
 				zap.String("agent_id", ga.config.ID))
 			result.Status = models.SuccessStatus
 		}
@@ -139,44 +200,80 @@ func (ga *GenericAgent) Execute(ctx context.Context, input string) (*models.Exec
 		result.ProcessID = cmd.ProcessState.Pid()
 	}
 
-	// Get output based on output pattern
-	output, err := ga.getOutput()
-	if err != nil {
-		ga.logger.Warn("failed to get output", zap.Error(err))
-		// Continue with empty output
+	// Record exit information and the separated output streams
+	processResult := newProcessResult(cmd, stdout, stderr)
+	result.ExitCode = processResult.ExitCode
+	result.Signal = processResult.Signal
+	result.Stderr = string(processResult.Stderr)
+
+	// Failures caused by the agent's memory or CPU limit are reported as such
+	if execErr != nil && result.Status == models.FailureStatus && !errors.Is(execErr, models.ErrAgentHung) {
+		if violation := resourceLimitViolation(ga.config, cmd.ProcessState, processResult.Stderr); violation != "" {
+			logger.Info("agent exceeded its resource limits",
+				zap.String("agent_id", ga.config.ID),
+				zap.String("violation", violation))
+			execErr = fmt.Errorf("%w: %s", models.ErrResourceLimitExceeded, violation)
+			result.Error = execErr.Error()
+		}
+	}
+
+	// Nonzero exit codes the agent maps to success or warning do not fail the execution
+	if isExitError(execErr) {
+		if status, mapped := mappedExitStatus(ga.config, processResult.ExitCode); mapped {
+			logger.Info("agent exit code mapped to a non-failure status",
+				zap.String("agent_id", ga.config.ID),
+				zap.Int("exit_code", processResult.ExitCode),
+				zap.String("status", string(status)))
+			result.Status = status
+			result.Error = ""
+			if status == models.WarningStatus {
+				result.Error = fmt.Sprintf("agent exited with code %d, mapped to warning", processResult.ExitCode)
+			}
+			execErr = nil
+		}
+	}
+
+	// Only stdout is handed to the output handler
+	if execErr == nil {
+		output, err := ga.getOutput(ctx, processResult.Stdout, sandbox)
+		if err != nil {
+			logger.Warn("failed to process output", zap.Error(err))
+			result.Status = models.FailureStatus
+			result.Error = err.Error()
+			execErr = err
+		}
+		result.SetOutput(output)
 	} else {
-		result.Output = output
+		result.SetOutput(processResult.Stdout)
+		if processResult.ExitCode > 0 {
+			execErr = fmt.Errorf("agent exited with code %d: %w", processResult.ExitCode, execErr)
+		}
 	}
 
 	// Sanitize sensitive data
 	result.SanitizeInput()
 	result.SanitizeOutput()
 
-	return result, nil
+	return result, execErr
 }
 
 // prepareCommand prepares the command based on the agent configuration
-func (ga *GenericAgent) prepareCommand(input string) (*exec.Cmd, io.WriteCloser, error) {
+func (ga *GenericAgent) prepareCommand(ctx context.Context, input string, sandbox *ExecutionSandbox) (*exec.Cmd, io.WriteCloser, error) {
 	// Split the executable path and arguments
 	executable := ga.config.ExecutablePath
 	args := ga.buildArgs(input)
 
-	// Create the command
-	cmd := exec.CommandContext(context.Background(), executable, args...)
+	// Create the command; batch files on Windows run through cmd.exe
+	program, programArgs := commandLine(executable, args)
+	cmd := exec.CommandContext(context.Background(), program, programArgs...)
 	
 	// Set working directory if specified
 	if ga.config.WorkingDirectory != "" {
 		cmd.Dir = ga.config.WorkingDirectory
 	}
 
-	// Set environment variables
-	if ga.config.Envs != nil {
-		envVars := make([]string, 0, len(ga.config.Envs))
-		for key, value := range ga.config.Envs {
-			envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
-		}
-		cmd.Env = append(os.Environ(), envVars...)
-	}
+	// Set environment variables, including the request ID and sandbox when known
+	cmd.Env = withSandboxEnv(processEnv(ctx, ga.config.Envs), sandbox)
 
 	// Handle input based on pattern
 	var stdin io.WriteCloser
@@ -192,21 +289,30 @@ func (ga *GenericAgent) prepareCommand(input string) (*exec.Cmd, io.WriteCloser,
 	case models.FilePattern:
 		// Create input file based on template
 		if ga.config.InputFileTemplate != "" {
-			filename := ga.processTemplate(ga.config.InputFileTemplate, map[string]interface{}{
+			if sandbox == nil {
+				return nil, nil, fmt.Errorf("file input pattern requires an execution sandbox")
+			}
+
+			// Resolve the input filename inside the sandbox
+			filename, err := sandbox.Path(ga.config.InputFileTemplate, map[string]interface{}{
 				"input": input,
-				"agent_id": ga.config.ID,
-				"execution_id": generateExecutionID(),
 			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid input file template: %w", err)
+			}
 			
-			// Write input to the file
-			err := os.WriteFile(filename, []byte(input), 0644)
+			// Write input to the file, or link an uploaded input file there
+			err = writeInputFile(filename, input, inputFileFromContext(ctx))
 			if err != nil {
 				return nil, nil, fmt.Errorf("failed to write input to file: %w", err)
 			}
 			
 			// Add the file as an argument
 			args = append(args, filename)
-			cmd = exec.CommandContext(context.Background(), executable, args...)
+			program, programArgs = commandLine(executable, args)
+			fileCmd := exec.CommandContext(context.Background(), program, programArgs...)
+			fileCmd.Dir, fileCmd.Env = cmd.Dir, cmd.Env
+			cmd = fileCmd
 		}
 	case models.ArgsPattern:
 		// Input is passed as command line arguments, already handled in buildArgs
@@ -218,6 +324,14 @@ func (ga *GenericAgent) prepareCommand(input string) (*exec.Cmd, io.WriteCloser,
 		}
 	}
 
+	// Run as the agent's user with its nice level and resource limits
+	if err := applyProcessLimits(cmd, ga.config); err != nil {
+		return nil, nil, fmt.Errorf("failed to apply process limits: %w", err)
+	}
+
+	// Start the agent in its own process group so cancellation stops its children too
+	ga.terminator.Prepare(cmd)
+
 	return cmd, stdin, nil
 }
 
@@ -243,12 +357,9 @@ func (ga *GenericAgent) buildArgs(input string) []string {
 	return args
 }
 
-// getOutput gets the output based on the output pattern
-func (ga *GenericAgent) getOutput() (string, error) {
-	// This would need to be implemented based on the output pattern
-	// For now, we'll return an empty string as output capture
-	// would require more complex handling based on the output pattern
-	return "", nil
+// getOutput processes captured stdout according to the agent's output pattern handler
+func (ga *GenericAgent) getOutput(ctx context.Context, stdout []byte, sandbox *ExecutionSandbox) ([]byte, error) {
+	return outputHandler(ctx, ga.config, patternHandler(ctx, ga.config.InputPattern, sandbox), sandbox).ProcessOutput(stdout, ga.config)
 }
 
 // processTemplate processes a template string with the given variables
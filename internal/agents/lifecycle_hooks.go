@@ -0,0 +1,241 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Environment variables of lifecycle hook commands, besides the agent's envs
+const (
+	AgentIDEnvVar  = "SUPERVISOR_AGENT_ID"  // ID of the agent the hook runs for
+	AgentPIDEnvVar = "SUPERVISOR_AGENT_PID" // Process ID of the agent's persistent process
+	HookEnvVar     = "SUPERVISOR_HOOK"      // post_start or pre_stop
+)
+
+// hookOutputTail bounds the output of a hook kept in its result
+const hookOutputTail = 4096
+
+var (
+	hookObserverMutex sync.Mutex
+	hookObservers     []func(models.HookResult)
+)
+
+// AddLifecycleHookObserver registers an observer called with the result of every lifecycle hook
+// run, e.g. to audit it. Observers are called on the goroutine that ran the hook.
+func AddLifecycleHookObserver(observer func(models.HookResult)) {
+	hookObserverMutex.Lock()
+	defer hookObserverMutex.Unlock()
+	hookObservers = append(hookObservers, observer)
+}
+
+// RunPreStopHook runs the pre-stop hook of an agent's running persistent process ahead of stopping
+// it, so stopping it does not run the hook again. When the hook fails under the abort policy, it
+// returns an error wrapping ErrHookFailed and the process is to be left running. The hook's result
+// is nil when the agent has no hook or no running process.
+func RunPreStopHook(agentID string) (*models.HookResult, error) {
+	persistentMutex.Lock()
+	process := persistentProcesses[agentID]
+	persistentMutex.Unlock()
+
+	result := runPreStopHook(process)
+	if result != nil && !result.Success && result.Policy == models.HookPolicyAbort {
+		return result, models.NewKindError(models.ErrHookFailed, "pre-stop hook of agent %s failed, so it was not stopped: %s", agentID, result.Error)
+	}
+	return result, nil
+}
+
+// runPreStopHook runs the pre-stop hook of a running process unless it ran already, returning its
+// result, or nil when it did not run
+func runPreStopHook(process *persistentProcess) *models.HookResult {
+	if process == nil || process.config.PreStopHook == nil || !process.usable() {
+		return nil
+	}
+	process.mutex.Lock()
+	ran := process.preStopped
+	process.mutex.Unlock()
+	if ran {
+		return nil
+	}
+
+	result := runLifecycleHook(models.HookPreStop, process.config, process.pid)
+	if !result.Success {
+		process.logger.Warn("pre-stop hook failed",
+			zap.Int("pid", process.pid),
+			zap.String("policy", string(result.Policy)),
+			zap.String("error", result.Error))
+	}
+	// A process whose stop was aborted runs the hook again the next time it is stopped
+	if result.Success || result.Policy != models.HookPolicyAbort {
+		process.mutex.Lock()
+		process.preStopped = true
+		process.mutex.Unlock()
+	}
+	return &result
+}
+
+// runPostStartHook runs the post-start hook of a process that reached the running state. A
+// failing hook puts the process in the degraded state, or under the fail policy stops it and
+// counts a failed start. Passing hooks forget the earlier failed starts, as reaching the running
+// state does for agents without one.
+func runPostStartHook(state *restartState, process *persistentProcess) {
+	result := runLifecycleHook(models.HookPostStart, process.config, process.pid)
+
+	persistentMutex.Lock()
+	if state.process != process || state.state != models.ProcessRunning || restartStates[process.config.ID] != state {
+		// The process exited or was stopped while the hook ran
+		persistentMutex.Unlock()
+		return
+	}
+	if result.Success {
+		state.failures = 0
+		state.lastError = ""
+		persistentMutex.Unlock()
+		return
+	}
+
+	err := fmt.Errorf("%w: post-start hook: %s", models.ErrHookFailed, result.Error)
+	if result.Policy != models.HookPolicyFail {
+		state.state = models.ProcessDegraded
+		state.lastError = err.Error()
+		process.logger.Warn("post-start hook failed, the process keeps running degraded",
+			zap.Int("pid", process.pid),
+			zap.Error(err))
+		emitProcessState(process.config.ID, state.status())
+		persistentMutex.Unlock()
+		return
+	}
+
+	// The process is forgotten before it is stopped, so its exit is not recorded again
+	state.process = nil
+	if persistentProcesses[process.config.ID] == process {
+		delete(persistentProcesses, process.config.ID)
+	}
+	state.startFailed(process.registry, process.config, err, process.logger)
+	persistentMutex.Unlock()
+	process.stop()
+}
+
+// runLifecycleHook runs the agent's hook of kind for its process pid and reports its result to the
+// restart state and the observers
+func runLifecycleHook(kind models.HookKind, config *models.AgentConfiguration, pid int) models.HookResult {
+	hook := config.PostStartHook
+	if kind == models.HookPreStop {
+		hook = config.PreStopHook
+	}
+	result := models.HookResult{
+		Hook:      kind,
+		AgentID:   config.ID,
+		PID:       pid,
+		Policy:    hook.Policy(kind),
+		StartedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout())
+	defer cancel()
+	var output []byte
+	var err error
+	if hook.URL != "" {
+		output, err = callHookURL(ctx, hook, &result)
+	} else {
+		output, err = runHookCommand(ctx, hook, config, &result)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("hook timed out after %s", hook.Timeout())
+	}
+	if len(output) > hookOutputTail {
+		output = output[len(output)-hookOutputTail:]
+	}
+	result.Output = string(output)
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+
+	persistentMutex.Lock()
+	if state := restartStates[config.ID]; state != nil {
+		state.recordHook(result)
+	}
+	persistentMutex.Unlock()
+
+	hookObserverMutex.Lock()
+	observers := append([]func(models.HookResult){}, hookObservers...)
+	hookObserverMutex.Unlock()
+	for _, observer := range observers {
+		observer(result)
+	}
+	return result
+}
+
+// runHookCommand runs a command hook in the agent's working directory with its envs, failing when
+// it exits with a nonzero code
+func runHookCommand(ctx context.Context, hook *models.LifecycleHook, config *models.AgentConfiguration, result *models.HookResult) ([]byte, error) {
+	program, args := commandLine(hook.Command[0], hook.Command[1:])
+	cmd := exec.CommandContext(ctx, program, args...)
+	if config.WorkingDirectory != "" {
+		cmd.Dir = config.WorkingDirectory
+	}
+	env := processEnv(context.Background(), config.Envs)
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env,
+		fmt.Sprintf("%s=%s", AgentIDEnvVar, config.ID),
+		fmt.Sprintf("%s=%d", AgentPIDEnvVar, result.PID),
+		fmt.Sprintf("%s=%s", HookEnvVar, result.Hook))
+	// Children left holding the output pipes do not keep the hook running past its timeout
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	}
+	return output, err
+}
+
+// callHookURL calls a URL hook with the agent's ID, process ID and the hook's kind as a JSON body,
+// failing unless it answers with a 2xx status
+func callHookURL(ctx context.Context, hook *models.LifecycleHook, result *models.HookResult) ([]byte, error) {
+	method := hook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"agent_id": result.AgentID,
+		"pid":      result.PID,
+		"hook":     result.Hook,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode hook request: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	result.StatusCode = response.StatusCode
+	output, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return output, fmt.Errorf("hook url answered %d", response.StatusCode)
+	}
+	return output, nil
+}
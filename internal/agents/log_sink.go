@@ -0,0 +1,224 @@
+package agents
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+const (
+	// DefaultLogfileMaxBytes is the size at which agent log files rotate when the agent doesn't set one
+	DefaultLogfileMaxBytes = 50 << 20
+
+	// DefaultLogfileBackups is the number of rotated agent log files kept when the agent doesn't set one
+	DefaultLogfileBackups = 10
+)
+
+var (
+	logSinksMutex sync.Mutex
+	logSinks      = make(map[string]*RotatingFile) // Shared by every execution writing to the same path
+)
+
+// RotatingFile is an append-only log file that rotates to path.1 ... path.N once it reaches maxBytes.
+// Writes and rotation happen under one lock, so no write is lost or interleaved during a swap.
+type RotatingFile struct {
+	path     string
+	maxBytes int64
+	backups  int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// NewRotatingFile creates a rotating log file; the file is opened on first write
+func NewRotatingFile(path string, maxBytes int64, backups int) *RotatingFile {
+	return &RotatingFile{path: path, maxBytes: maxBytes, backups: backups}
+}
+
+// Write appends p, rotating whenever the file would grow past maxBytes. Writes larger than the
+// remaining room are split at the last newline that fits, so files break between lines.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if r.maxBytes > 0 && r.size+int64(len(p)) > r.maxBytes {
+			cut := 0
+			if room := r.maxBytes - r.size; room > 0 {
+				cut = bytes.LastIndexByte(p[:room], '\n') + 1
+			}
+			if cut == 0 {
+				if r.size > 0 {
+					if err := r.rotate(); err != nil {
+						return written, err
+					}
+					continue
+				}
+				// A single line longer than maxBytes fills the empty file
+				cut = int(r.maxBytes)
+			}
+			chunk = p[:cut]
+		}
+
+		n, err := r.file.Write(chunk)
+		r.size += int64(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close closes the current file; a later write reopens it
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// setLimits updates the rotation limits, e.g. after the agent configuration changed
+func (r *RotatingFile) setLimits(maxBytes int64, backups int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.maxBytes = maxBytes
+	r.backups = backups
+}
+
+// open opens the log file for appending, creating it and its directory if needed
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 to path.N ... path to path.1, dropping the oldest, and starts a new file
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.file = nil
+
+	if r.backups > 0 {
+		for i := r.backups - 1; i >= 1; i-- {
+			from := fmt.Sprintf("%s.%d", r.path, i)
+			if _, err := os.Stat(from); err == nil {
+				if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil {
+					return fmt.Errorf("failed to rotate log file: %w", err)
+				}
+			}
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	} else if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to truncate log file: %w", err)
+	}
+
+	return r.open()
+}
+
+// LogfilePath expands a stdout or stderr log file template for the agent; empty means logging is disabled
+func LogfilePath(config *models.AgentConfiguration, template string) string {
+	if template == "" {
+		return ""
+	}
+	return processTemplate(template, map[string]interface{}{
+		"agent_id": config.ID,
+	})
+}
+
+// agentLogSink returns the shared rotating file for path, or nil when path is empty
+func agentLogSink(config *models.AgentConfiguration, path string) *RotatingFile {
+	if path == "" {
+		return nil
+	}
+
+	maxBytes := config.LogfileMaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultLogfileMaxBytes
+	}
+	backups := config.LogfileBackups
+	if backups == 0 {
+		backups = DefaultLogfileBackups
+	}
+
+	logSinksMutex.Lock()
+	defer logSinksMutex.Unlock()
+
+	sink, exists := logSinks[path]
+	if !exists {
+		sink = NewRotatingFile(path, maxBytes, backups)
+		logSinks[path] = sink
+	} else {
+		sink.setLimits(maxBytes, backups)
+	}
+	return sink
+}
+
+// CloseLogSinks closes every agent log file; later writes reopen them
+func CloseLogSinks() {
+	logSinksMutex.Lock()
+	defer logSinksMutex.Unlock()
+
+	for _, sink := range logSinks {
+		sink.Close()
+	}
+}
+
+// teeWriter copies output to the capture buffer and, best-effort, to a log file and an output
+// observer. Log file errors are dropped so a full disk never breaks the agent's pipe.
+type teeWriter struct {
+	capture  io.Writer
+	sink     io.Writer
+	observer OutputObserver
+	stream   string
+}
+
+// Write writes p to every destination and always reports success to the child's pipe
+func (w *teeWriter) Write(p []byte) (int, error) {
+	w.capture.Write(p)
+	if w.sink != nil {
+		w.sink.Write(p)
+	}
+	if w.observer != nil && len(p) > 0 {
+		w.observer(w.stream, p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,145 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// ErrOutputFileMissing is returned when the output file of the file output pattern does not exist
+// once the agent's output file wait is over
+var ErrOutputFileMissing = errors.New("output file not found")
+
+// outputFilePollInterval is how often a file output is checked while waiting for it
+var outputFilePollInterval = 50 * time.Millisecond
+
+// readOutputFile reads the output file of the agent, resolved from its output file template inside
+// the sandbox. It waits up to OutputFileWaitSeconds for the file to appear, and with
+// OutputFileStable until it is non-empty and its size holds between two checks. A template holding
+// a glob reads the newest matching file. Only regular files inside the sandbox are read, never
+// symlinks. The wait ends with ctx. The file is removed once read unless artifacts are kept.
+func readOutputFile(ctx context.Context, sandbox *ExecutionSandbox, config *models.AgentConfiguration) ([]byte, error) {
+	pattern, err := ResolveSandboxPath(sandbox.Dir, processTemplate(config.OutputFileTemplate, sandbox.vars))
+	if err != nil {
+		return nil, fmt.Errorf("invalid output file template: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(sandbox.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve sandbox %s: %w", sandbox.Dir, err)
+	}
+
+	deadline := time.Now().Add(time.Duration(config.OutputFileWaitSeconds) * time.Second)
+	var path string
+	var size int64 = -1
+	for {
+		path, err = findOutputFile(root, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if path != "" {
+			if !config.OutputFileStable {
+				break
+			}
+			// A file is complete once it has content that did not change since the previous check
+			info, ok := sandboxedFile(root, path)
+			if ok && info.Size() > 0 && info.Size() == size {
+				break
+			}
+			if ok {
+				size = info.Size()
+			}
+		}
+		if !time.Now().Before(deadline) {
+			if path == "" {
+				return nil, fmt.Errorf("%w after waiting %ds: %s", ErrOutputFileMissing, config.OutputFileWaitSeconds, pattern)
+			}
+			// The wait is over; read whatever the agent wrote
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for output file %s: %w", pattern, ctx.Err())
+		case <-time.After(outputFilePollInterval):
+		}
+	}
+
+	content, err := readSandboxedFile(root, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output file %s: %w", path, err)
+	}
+	if !sandbox.keep {
+		_ = os.Remove(path)
+	}
+	return content, nil
+}
+
+// findOutputFile returns the file at path, or with a glob the most recently modified regular file
+// matching it, and an empty path when there is none yet. Files that are not regular files inside
+// the sandbox directory dir are left out.
+func findOutputFile(dir, path string) (string, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		if _, ok := sandboxedFile(dir, path); ok {
+			return path, nil
+		}
+		return "", nil
+	}
+
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid output file template: %w", err)
+	}
+	newest, newestTime := "", time.Time{}
+	for _, match := range matches {
+		info, ok := sandboxedFile(dir, match)
+		if !ok {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = match, info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// sandboxedFile returns the file at path when it is a regular file, not a symlink, that stays inside
+// the sandbox directory dir once the symlinks among its parents are resolved
+func sandboxedFile(dir, path string) (os.FileInfo, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, false
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || !filepath.IsLocal(rel) {
+		return nil, false
+	}
+	return info, true
+}
+
+// readSandboxedFile reads the file at path, failing when it was replaced since it was found by
+// anything sandboxedFile refuses
+func readSandboxedFile(dir, path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	opened, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := sandboxedFile(dir, path); !ok || !os.SameFile(opened, info) {
+		return nil, fmt.Errorf("%w: %s is not a regular file in the sandbox", ErrPathEscapesSandbox, path)
+	}
+	return io.ReadAll(file)
+}
@@ -0,0 +1,200 @@
+package agents
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Errors returned by the json output pattern
+var (
+	ErrOutputNotJSON          = errors.New("agent output is not valid JSON")
+	ErrOutputSelectorNotFound = errors.New("output selector did not match")
+)
+
+// JSONOutputHandler handles the json output pattern: stdout must be a single JSON document, from
+// which OutputSelector picks the value returned as the output
+type JSONOutputHandler struct{}
+
+// ProcessOutput for JSONOutputHandler
+func (h *JSONOutputHandler) ProcessOutput(output []byte, config *models.AgentConfiguration) ([]byte, error) {
+	selected, err := SelectJSON(output, config.OutputSelector)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(selected), nil
+}
+
+// selectorStep is one object key or array index of an output selector
+type selectorStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// String formats the step as it appears in a selector
+func (s selectorStep) String() string {
+	if s.isIndex {
+		return "[" + strconv.Itoa(s.index) + "]"
+	}
+	if strings.ContainsAny(s.key, ".[]\"' ") || s.key == "" {
+		return "[" + strconv.Quote(s.key) + "]"
+	}
+	return "." + s.key
+}
+
+// ValidateOutputSelector checks the syntax of an output selector
+func ValidateOutputSelector(selector string) error {
+	_, err := parseOutputSelector(selector)
+	return err
+}
+
+// parseOutputSelector parses a dotted selector such as "$.items[0].name", "items[0].name" or
+// `data["key.with.dots"]`; an empty selector or "$" selects the whole document
+func parseOutputSelector(selector string) ([]selectorStep, error) {
+	rest := strings.TrimSpace(selector)
+	// A bare first key is allowed only without the "$" root
+	bareKey := !strings.HasPrefix(rest, "$")
+	rest = strings.TrimPrefix(rest, "$")
+	var steps []selectorStep
+
+	for first := bareKey; rest != ""; first = false {
+		switch {
+		case rest[0] == '[':
+			if len(rest) > 1 && (rest[1] == '"' || rest[1] == '\'') {
+				// A quoted key may contain any character but its quote
+				closing := strings.IndexByte(rest[2:], rest[1])
+				if closing < 0 || !strings.HasPrefix(rest[2+closing+1:], "]") {
+					return nil, fmt.Errorf("invalid output selector %q: unterminated quoted key", selector)
+				}
+				steps = append(steps, selectorStep{key: rest[2 : 2+closing]})
+				rest = rest[2+closing+2:]
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid output selector %q: unclosed [", selector)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid output selector %q: %q is not an array index", selector, rest[1:end])
+			}
+			steps = append(steps, selectorStep{index: index, isIndex: true})
+			rest = rest[end+1:]
+
+		case rest[0] == '.' || first:
+			if rest[0] == '.' {
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid output selector %q: empty key", selector)
+			}
+			steps = append(steps, selectorStep{key: rest[:end]})
+			rest = rest[end:]
+
+		default:
+			return nil, fmt.Errorf("invalid output selector %q: unexpected %q", selector, rest[:1])
+		}
+	}
+
+	return steps, nil
+}
+
+// SelectJSON parses output as a single JSON document and returns the value selector picks. Strings
+// are returned as they are; other values are returned as compact JSON.
+func SelectJSON(output []byte, selector string) (string, error) {
+	steps, err := parseOutputSelector(selector)
+	if err != nil {
+		return "", err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOutputNotJSON, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", fmt.Errorf("%w: unexpected data after the JSON document", ErrOutputNotJSON)
+	}
+
+	value := document
+	path := "$"
+	for _, step := range steps {
+		value, err = selectStep(value, step, path)
+		if err != nil {
+			return "", err
+		}
+		path += step.String()
+	}
+
+	return stringifyJSON(value)
+}
+
+// selectStep returns the member of value that step names; path is where value sits in the document
+func selectStep(value interface{}, step selectorStep, path string) (interface{}, error) {
+	if step.isIndex {
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is %s, not an array", ErrOutputSelectorNotFound, path, jsonKind(value))
+		}
+		if step.index >= len(array) {
+			return nil, fmt.Errorf("%w: index %d is out of range at %s (length %d)", ErrOutputSelectorNotFound, step.index, path, len(array))
+		}
+		return array[step.index], nil
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is %s, not an object", ErrOutputSelectorNotFound, path, jsonKind(value))
+	}
+	member, exists := object[step.key]
+	if !exists {
+		return nil, fmt.Errorf("%w: key %q not found at %s", ErrOutputSelectorNotFound, step.key, path)
+	}
+	return member, nil
+}
+
+// stringifyJSON returns strings unquoted and any other value as compact JSON
+func stringifyJSON(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal selected value: %w", err)
+	}
+	return string(data), nil
+}
+
+// jsonKind names the JSON type of a decoded value for error messages
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,653 @@
+package agents
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPingInterval is how often a persistent agent is health-checked when it doesn't set an interval
+	DefaultPingInterval = 30 * time.Second
+
+	// DefaultPingTimeout is how long a persistent agent has to answer a ping when it doesn't set a timeout
+	DefaultPingTimeout = 5 * time.Second
+)
+
+// JSON-RPC methods a persistent agent answers over its stdin and stdout, one message per line
+const (
+	PersistentExecuteMethod = "execute" // Runs an execution; params is the input, or in an A2A conversation an object of the input and conversation_history; result is the output
+	PersistentPingMethod    = "ping"    // Health check; any response, even an error, counts as an answer
+)
+
+// ErrPersistentProcessExited is the error of executions whose persistent agent process exited
+// before answering them
+var ErrPersistentProcessExited = errors.New("persistent agent process exited")
+
+var (
+	persistentMutex     sync.Mutex
+	persistentProcesses = make(map[string]*persistentProcess) // By agent ID
+)
+
+// PersistentAgent implements the IAgent interface for JSON-RPC agents in persistent mode. All
+// executions of the agent share one long-lived process, started by the first execution and
+// restarted by the next one after it exited, was stopped or failed a health check. A process that
+// exits before running for the agent's start seconds is restarted after a backoff instead, until
+// too many failed starts put the agent in the fatal state. Each execution is an execute call over
+// the process's stdin, matched with its response on stdout by ID.
+type PersistentAgent struct {
+	config *models.AgentConfiguration
+	logger *zap.Logger
+}
+
+// NewPersistentAgent creates a new instance of PersistentAgent
+func NewPersistentAgent(config *models.AgentConfiguration, logger *zap.Logger) *PersistentAgent {
+	return &PersistentAgent{config: config, logger: logger}
+}
+
+// Execute sends the input to the agent's process and waits for its response
+func (pa *PersistentAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
+	if pa.config == nil {
+		return nil, fmt.Errorf("agent configuration is nil")
+	}
+
+	logger := logging.LoggerFromContext(ctx, pa.logger)
+	result := &models.ExecutionResult{
+		ID:        generateExecutionID(),
+		AgentID:   pa.config.ID,
+		StartTime: time.Now(),
+		Input:     input,
+	}
+	fail := func(err error) (*models.ExecutionResult, error) {
+		result.Status = models.FailureStatus
+		result.Error = err.Error()
+		result.EndTime = time.Now()
+		result.SanitizeInput()
+		return result, err
+	}
+
+	if err := pa.Validate(); err != nil {
+		logger.Error("agent validation failed", zap.Error(err))
+		return fail(err)
+	}
+
+	ctx, cancel := withAgentTimeout(ctx, pa.config)
+	defer cancel()
+
+	process, err := persistentProcessFor(ctx, pa.config, pa.logger)
+	if err != nil {
+		logger.Error("failed to start persistent agent process", zap.Error(err))
+		return fail(err)
+	}
+	result.ProcessID = process.pid
+
+	response, execErr := process.execute(ctx, executeParams(ctx, input))
+	switch {
+	case execErr == nil:
+		if observer := outputObserverFromContext(ctx); observer != nil {
+			observer(StdoutStream, response)
+		}
+		output, err := outputHandler(ctx, pa.config, &JSONRPCHandler{}, nil).ProcessOutput(response, pa.config)
+		if err != nil {
+			result.Status = models.FailureStatus
+			result.Error = err.Error()
+			execErr = err
+		} else {
+			result.Status = models.SuccessStatus
+		}
+		result.SetOutput(output)
+	case errors.Is(execErr, context.DeadlineExceeded):
+		logger.Info("agent execution timed out", zap.String("agent_id", pa.config.ID))
+		result.Status = models.TimeoutStatus
+		result.Error = "execution timed out"
+		execErr = fmt.Errorf("execution timed out: %w", execErr)
+	case errors.Is(execErr, context.Canceled):
+		logger.Info("agent execution cancelled", zap.String("agent_id", pa.config.ID))
+		result.Status = models.CancelledStatus
+		result.Error = "execution cancelled"
+		execErr = fmt.Errorf("execution cancelled: %w", execErr)
+	default:
+		result.Status = models.FailureStatus
+		result.Error = execErr.Error()
+	}
+
+	result.EndTime = time.Now()
+	result.SanitizeInput()
+	result.SanitizeOutput()
+	return result, execErr
+}
+
+// GetID returns the agent's ID
+func (pa *PersistentAgent) GetID() string {
+	return pa.config.ID
+}
+
+// GetName returns the agent's name
+func (pa *PersistentAgent) GetName() string {
+	return pa.config.Name
+}
+
+// GetType returns the agent's type
+func (pa *PersistentAgent) GetType() string {
+	return pa.config.AgentType
+}
+
+// IsReadOnly returns whether the agent is read-only or read-write
+func (pa *PersistentAgent) IsReadOnly() bool {
+	return pa.config.AccessType == models.ReadOnlyAccessType
+}
+
+// GetConfig returns the agent's configuration
+func (pa *PersistentAgent) GetConfig() *models.AgentConfiguration {
+	return pa.config
+}
+
+// Validate checks if the agent configuration is valid
+func (pa *PersistentAgent) Validate() error {
+	if pa.config == nil {
+		return fmt.Errorf("agent configuration is nil")
+	}
+	return pa.config.Validate()
+}
+
+// StopPersistentProcess stops the persistent process of an agent, if it has one, and forgets its
+// failed starts; the agent's next execution starts a new one. The agent's pre-stop hook runs
+// first unless RunPreStopHook ran it, the process being stopped even when it fails.
+func StopPersistentProcess(agentID string) {
+	persistentMutex.Lock()
+	running := persistentProcesses[agentID]
+	persistentMutex.Unlock()
+	runPreStopHook(running)
+
+	persistentMutex.Lock()
+	process := persistentProcesses[agentID]
+	delete(persistentProcesses, agentID)
+	forgetRestartState(agentID)
+	persistentMutex.Unlock()
+
+	if process != nil {
+		process.stop()
+	}
+}
+
+// StopPersistentProcesses stops every persistent agent process, e.g. when the supervisor exits,
+// after running their pre-stop hooks
+func StopPersistentProcesses() {
+	persistentMutex.Lock()
+	processes := persistentProcesses
+	persistentProcesses = make(map[string]*persistentProcess)
+	for agentID := range restartStates {
+		forgetRestartState(agentID)
+	}
+	persistentMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, process := range processes {
+		wg.Add(1)
+		go func(process *persistentProcess) {
+			defer wg.Done()
+			runPreStopHook(process)
+			process.stop()
+		}(process)
+	}
+	wg.Wait()
+}
+
+// persistentProcessFor returns the running process of the agent, starting one when it has none or
+// its launch settings changed since it was started. While the process backs off after a failed
+// start, it waits for the backoff to end.
+func persistentProcessFor(ctx context.Context, config *models.AgentConfiguration, logger *zap.Logger) (*persistentProcess, error) {
+	fingerprint := persistentFingerprint(config)
+	registry, _ := ctx.Value(processRegistryKey{}).(*ProcessRegistry)
+
+	for {
+		persistentMutex.Lock()
+		if process := persistentProcesses[config.ID]; process != nil {
+			if process.fingerprint == fingerprint && process.usable() {
+				persistentMutex.Unlock()
+				return process, nil
+			}
+			delete(persistentProcesses, config.ID)
+			// Count an exit the process's watcher has not recorded yet before starting another
+			if process.exitErr() != nil {
+				processExited(process)
+			}
+			go process.stop()
+		}
+
+		wait, err := backoffWait(config.ID)
+		if err != nil {
+			persistentMutex.Unlock()
+			return nil, err
+		}
+		if wait <= 0 {
+			process, err := startRestartable(registry, config, logger)
+			persistentMutex.Unlock()
+			return process, err
+		}
+		persistentMutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("persistent agent process is backing off after failed starts: %w", ctx.Err())
+		}
+	}
+}
+
+// persistentFingerprint identifies the settings a persistent process was started with, so a
+// process is replaced once the agent's configuration changes them
+func persistentFingerprint(config *models.AgentConfiguration) string {
+	nonEmpty := func(values map[string]string) map[string]string {
+		if len(values) == 0 {
+			return nil
+		}
+		return values
+	}
+	data, _ := json.Marshal([]interface{}{
+		config.ExecutablePath, config.WorkingDirectory, nonEmpty(config.Envs), nonEmpty(config.CliArgs),
+		config.RunAsUser, config.RunAsGroup, config.NiceLevel, config.MaxMemoryMB, config.MaxCPUSeconds,
+		config.StdoutLogfile, config.StderrLogfile, config.AccessType, config.MaxConcurrentExecutions,
+		config.PingIntervalSeconds, config.PingTimeoutSeconds,
+	})
+	return string(data)
+}
+
+// rpcMessage is a JSON-RPC response read from a persistent process
+type rpcMessage struct {
+	ID *int64 `json:"id"`
+}
+
+// persistentProcess is the long-lived process of a persistent agent and its pending calls
+type persistentProcess struct {
+	config      *models.AgentConfiguration
+	fingerprint string
+	logger      *zap.Logger
+	registry    *ProcessRegistry // Tracks the process, and the process restarted after it
+	cmd         *exec.Cmd
+	pid         int
+	terminator  ProcessTerminator
+	stdoutSink  io.Writer
+	slots       chan struct{} // One per execution the agent's access type lets run at once
+	done        chan struct{} // Closed once the process exited
+
+	writeMutex sync.Mutex
+	stdin      io.WriteCloser
+
+	mutex      sync.Mutex
+	nextID     int64
+	pending    map[int64]chan []byte
+	stopping   bool
+	err        error          // Why the process exited
+	attached   *AttachSession // The operator attached to the process's stdio, if any
+	preStopped bool           // Its pre-stop hook ran; stopping it does not run it again
+}
+
+// startPersistentProcess starts the process of a persistent agent and its health checks
+func startPersistentProcess(registry *ProcessRegistry, config *models.AgentConfiguration, fingerprint string, logger *zap.Logger) (*persistentProcess, error) {
+	program, args := commandLine(config.ExecutablePath, (&JSONRPCHandler{}).buildArgs(config))
+	cmd := exec.Command(program, args...)
+	if config.WorkingDirectory != "" {
+		cmd.Dir = config.WorkingDirectory
+	}
+	// The process outlives the request that started it, so it gets no request ID
+	cmd.Env = processEnv(context.Background(), config.Envs)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe for JSON-RPC: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe for JSON-RPC: %w", err)
+	}
+	if err := applyProcessLimits(cmd, config); err != nil {
+		return nil, fmt.Errorf("failed to apply process limits: %w", err)
+	}
+	terminator := newProcessTerminator()
+	terminator.Prepare(cmd)
+
+	slots := 1
+	if config.AccessType == models.ReadOnlyAccessType && config.MaxConcurrentExecutions > 1 {
+		slots = config.MaxConcurrentExecutions
+	}
+	process := &persistentProcess{
+		config:      config,
+		fingerprint: fingerprint,
+		logger:      logger.With(zap.String("agent_id", config.ID)),
+		registry:    registry,
+		cmd:         cmd,
+		terminator:  terminator,
+		slots:       make(chan struct{}, slots),
+		done:        make(chan struct{}),
+		stdin:       stdin,
+		pending:     make(map[int64]chan []byte),
+	}
+	if sink := agentLogSink(config, LogfilePath(config, config.StdoutLogfile)); sink != nil {
+		process.stdoutSink = sink
+	}
+	stderrTee := &attachTee{process: process, stream: StderrStream}
+	if sink := agentLogSink(config, LogfilePath(config, config.StderrLogfile)); sink != nil {
+		stderrTee.sink = sink
+	}
+	cmd.Stderr = stderrTee
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start persistent agent process: %w", err)
+	}
+	process.pid = cmd.Process.Pid
+
+	// The process is tracked for as long as it runs, not for the execution that started it
+	untrack := trackProcess(WithProcessRegistry(context.Background(), registry), cmd, config.ID)
+
+	go func() {
+		process.read(stdout)
+		err := cmd.Wait()
+		untrack()
+		process.exited(err)
+	}()
+	go process.healthCheck()
+
+	process.logger.Info("persistent agent process started", zap.Int("pid", process.pid))
+	return process, nil
+}
+
+// executeParams returns the params of the execute request running input: the input itself, or in an
+// A2A conversation the input and the conversation's prior exchanges
+func executeParams(ctx context.Context, input string) interface{} {
+	history, ok := conversationHistoryFromContext(ctx)
+	if !ok {
+		return input
+	}
+	if history == nil {
+		history = []models.ConversationExchange{}
+	}
+	return map[string]interface{}{
+		"input":                             input,
+		models.ConversationHistoryParameter: history,
+	}
+}
+
+// execute calls the execute method with params once the access type lets the execution run. A
+// cancelled execution keeps its slot until the agent answers it, so a read-write agent never
+// works on two executions at once.
+func (p *persistentProcess) execute(ctx context.Context, params interface{}) ([]byte, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.done:
+		return nil, p.exitErr()
+	}
+
+	id, responses, err := p.send(PersistentExecuteMethod, params)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	select {
+	case response := <-responses:
+		<-p.slots
+		return response, nil
+	case <-p.done:
+		<-p.slots
+		return nil, p.exitErr()
+	case <-ctx.Done():
+		go func() {
+			select {
+			case <-responses:
+			case <-p.done:
+			}
+			p.forget(id)
+			<-p.slots
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// ping calls the ping method, failing when the process doesn't answer within timeout
+func (p *persistentProcess) ping(timeout time.Duration) error {
+	id, responses, err := p.send(PersistentPingMethod, nil)
+	if err != nil {
+		return err
+	}
+	defer p.forget(id)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-responses:
+		return nil
+	case <-p.done:
+		return p.exitErr()
+	case <-timer.C:
+		return fmt.Errorf("no answer to %s within %s", PersistentPingMethod, timeout)
+	}
+}
+
+// send writes a call of method to the process and returns its ID and the channel its response
+// is delivered on
+func (p *persistentProcess) send(method string, params interface{}) (int64, <-chan []byte, error) {
+	p.mutex.Lock()
+	if p.err != nil {
+		p.mutex.Unlock()
+		return 0, nil, p.err
+	}
+	if p.stopping && method == PersistentExecuteMethod {
+		p.mutex.Unlock()
+		return 0, nil, fmt.Errorf("%w: it is being stopped", ErrPersistentProcessExited)
+	}
+	p.nextID++
+	id := p.nextID
+	responses := make(chan []byte, 1)
+	p.pending[id] = responses
+	p.mutex.Unlock()
+
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		p.forget(id)
+		return 0, nil, fmt.Errorf("failed to marshal JSON-RPC request: %w", err)
+	}
+
+	p.writeMutex.Lock()
+	_, err = p.stdin.Write(append(request, '\n'))
+	p.writeMutex.Unlock()
+	if err != nil {
+		p.forget(id)
+		return 0, nil, fmt.Errorf("failed to write JSON-RPC request: %w", err)
+	}
+	return id, responses, nil
+}
+
+// forget drops a call that is no longer waited for
+func (p *persistentProcess) forget(id int64) {
+	p.mutex.Lock()
+	delete(p.pending, id)
+	p.mutex.Unlock()
+}
+
+// read delivers every response on stdout to the call with its ID until the process closes stdout.
+// Lines that are not responses to a pending call are logged and dropped. An attach session gets
+// stdout as it is read, before it is split into lines.
+func (p *persistentProcess) read(stdout io.Reader) {
+	reader := bufio.NewReaderSize(io.TeeReader(stdout, &attachTee{process: p, stream: StdoutStream}), 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if p.stdoutSink != nil {
+				p.stdoutSink.Write(line)
+			}
+			p.deliver(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// deliver hands a line of output to the pending call it answers
+func (p *persistentProcess) deliver(line []byte) {
+	var message rpcMessage
+	if err := json.Unmarshal(line, &message); err != nil || message.ID == nil {
+		p.logger.Debug("ignoring persistent agent output that is not a JSON-RPC response",
+			zap.ByteString("line", line))
+		return
+	}
+
+	p.mutex.Lock()
+	responses, ok := p.pending[*message.ID]
+	delete(p.pending, *message.ID)
+	p.mutex.Unlock()
+
+	if !ok {
+		p.logger.Debug("ignoring JSON-RPC response to no pending call", zap.Int64("id", *message.ID))
+		return
+	}
+	responses <- line
+}
+
+// healthCheck pings the process every ping interval and stops it when it doesn't answer, so the
+// next execution starts a new one
+func (p *persistentProcess) healthCheck() {
+	interval, timeout := DefaultPingInterval, DefaultPingTimeout
+	if p.config.PingIntervalSeconds > 0 {
+		interval = time.Duration(p.config.PingIntervalSeconds) * time.Second
+	}
+	if p.config.PingTimeoutSeconds > 0 {
+		timeout = time.Duration(p.config.PingTimeoutSeconds) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			// Agents under maintenance may be unresponsive on purpose
+			if inMaintenance(p.config) {
+				continue
+			}
+			if err := p.ping(timeout); err != nil && p.running() {
+				p.logger.Warn("persistent agent process stopped responding and is restarted",
+					zap.Int("pid", p.pid),
+					zap.Error(err))
+				persistentMutex.Lock()
+				if persistentProcesses[p.config.ID] == p {
+					delete(persistentProcesses, p.config.ID)
+				}
+				persistentMutex.Unlock()
+				p.stop()
+				return
+			}
+		}
+	}
+}
+
+// running reports whether the process has not exited
+func (p *persistentProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// usable reports whether the process runs and is not being stopped, so it can take executions
+func (p *persistentProcess) usable() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err == nil && !p.stopping
+}
+
+// wasStopped reports whether the supervisor stopped the process, rather than it exiting on its own
+func (p *persistentProcess) wasStopped() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.stopping
+}
+
+// exitErr returns why the process exited
+func (p *persistentProcess) exitErr() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+// exited records the exit of the process, failing the calls it did not answer
+func (p *persistentProcess) exited(waitErr error) {
+	p.mutex.Lock()
+	if waitErr != nil {
+		p.err = fmt.Errorf("%w: %v", ErrPersistentProcessExited, waitErr)
+	} else {
+		p.err = ErrPersistentProcessExited
+	}
+	p.pending = make(map[int64]chan []byte)
+	p.mutex.Unlock()
+	close(p.done)
+
+	p.logger.Info("persistent agent process exited", zap.Int("pid", p.pid), zap.Error(waitErr))
+
+	persistentMutex.Lock()
+	if persistentProcesses[p.config.ID] == p {
+		delete(persistentProcesses, p.config.ID)
+	}
+	processExited(p)
+	persistentMutex.Unlock()
+}
+
+// stop closes the process's stdin, asks its process tree to exit with the agent's stop signal
+// and kills it when it has not exited after the stop wait
+func (p *persistentProcess) stop() {
+	if !p.running() {
+		return
+	}
+	p.mutex.Lock()
+	p.stopping = true
+	p.mutex.Unlock()
+
+	p.writeMutex.Lock()
+	p.stdin.Close()
+	p.writeMutex.Unlock()
+
+	signal, wait := stopSettings(context.Background(), p.config)
+	if signal == "KILL" {
+		p.terminator.Kill(p.cmd)
+		<-p.done
+		return
+	}
+	if err := p.terminator.Terminate(p.cmd, signal); err != nil {
+		wait = 0
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+	case <-timer.C:
+		p.logger.Warn("persistent agent process did not exit after being terminated and was killed",
+			zap.Int("pid", p.pid),
+			zap.String("stop_signal", signal))
+		p.terminator.Kill(p.cmd)
+		<-p.done
+	}
+}
@@ -0,0 +1,161 @@
+package agents
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// attachOutputBuffer bounds the output chunks queued for an attach session; chunks arriving while
+// it is full are dropped rather than slowing the process down
+const attachOutputBuffer = 256
+
+// ErrAttachSessionDetached is the error of input written to a session after it detached
+var ErrAttachSessionDetached = errors.New("attach session detached")
+
+// AttachOutput is a chunk of a persistent process's output, as it was written
+type AttachOutput struct {
+	Stream string // StdoutStream or StderrStream
+	Data   []byte
+}
+
+// AttachSession is an operator attached to the stdin, stdout and stderr of an agent's persistent
+// process. The process's output keeps going to its logfiles and executions keep being answered;
+// the session only gets a copy of it. A process has at most one session at a time.
+type AttachSession struct {
+	process  *persistentProcess
+	output   chan AttachOutput
+	detached chan struct{}
+	once     sync.Once
+	dropped  atomic.Int64 // Bytes of output dropped while the session fell behind
+}
+
+// AttachPersistentProcess attaches a session to the running persistent process of an agent. It
+// fails with ErrInvalidTransition when the agent has no running process and with ErrAttachConflict
+// when another session is attached.
+func AttachPersistentProcess(agentID string) (*AttachSession, error) {
+	persistentMutex.Lock()
+	process := persistentProcesses[agentID]
+	persistentMutex.Unlock()
+	if process == nil || !process.usable() {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "agent %s has no running process to attach to", agentID)
+	}
+
+	process.mutex.Lock()
+	defer process.mutex.Unlock()
+	if process.err != nil || process.stopping {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "agent %s has no running process to attach to", agentID)
+	}
+	if process.attached != nil {
+		return nil, models.NewKindError(models.ErrAttachConflict, "agent %s already has an attach session", agentID)
+	}
+
+	session := &AttachSession{
+		process:  process,
+		output:   make(chan AttachOutput, attachOutputBuffer),
+		detached: make(chan struct{}),
+	}
+	process.attached = session
+	process.logger.Info("attach session started", zap.Int("pid", process.pid))
+	return session, nil
+}
+
+// PID returns the ID of the process the session is attached to
+func (s *AttachSession) PID() int {
+	return s.process.pid
+}
+
+// Output delivers the process's output from the moment the session attached
+func (s *AttachSession) Output() <-chan AttachOutput {
+	return s.output
+}
+
+// Exited is closed once the process exited; its output is then all on Output
+func (s *AttachSession) Exited() <-chan struct{} {
+	return s.process.done
+}
+
+// ExitErr returns why the process exited
+func (s *AttachSession) ExitErr() error {
+	return s.process.exitErr()
+}
+
+// Detached is closed once the session detached
+func (s *AttachSession) Detached() <-chan struct{} {
+	return s.detached
+}
+
+// Dropped returns how many bytes of output were dropped because the session read them too slowly
+func (s *AttachSession) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Write writes input to the process's stdin, between the JSON-RPC calls of executions
+func (s *AttachSession) Write(input []byte) (int, error) {
+	select {
+	case <-s.detached:
+		return 0, ErrAttachSessionDetached
+	default:
+	}
+
+	p := s.process
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	if !p.usable() {
+		return 0, ErrPersistentProcessExited
+	}
+	return p.stdin.Write(input)
+}
+
+// Detach ends the session, leaving the process running; another session may then attach
+func (s *AttachSession) Detach() {
+	s.once.Do(func() {
+		p := s.process
+		p.mutex.Lock()
+		if p.attached == s {
+			p.attached = nil
+		}
+		p.mutex.Unlock()
+		close(s.detached)
+
+		p.logger.Info("attach session detached",
+			zap.Int("pid", p.pid),
+			zap.Int64("dropped_bytes", s.dropped.Load()))
+	})
+}
+
+// deliver queues a copy of output for the session without waiting for it
+func (s *AttachSession) deliver(stream string, data []byte) {
+	select {
+	case s.output <- AttachOutput{Stream: stream, Data: append([]byte(nil), data...)}:
+	case <-s.detached:
+	default:
+		s.dropped.Add(int64(len(data)))
+	}
+}
+
+// attachTee copies a stream of a persistent process to its attach session, if any, and to sink,
+// if set. It never fails, so a slow or missing session cannot disturb the process or its logs.
+type attachTee struct {
+	process *persistentProcess
+	stream  string
+	sink    io.Writer
+}
+
+// Write implements io.Writer
+func (t *attachTee) Write(data []byte) (int, error) {
+	if t.sink != nil {
+		t.sink.Write(data)
+	}
+	t.process.mutex.Lock()
+	session := t.process.attached
+	t.process.mutex.Unlock()
+	if session != nil {
+		session.deliver(t.stream, data)
+	}
+	return len(data), nil
+}
@@ -0,0 +1,301 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// MaxCapturedOutputBytes caps how much of each output stream is kept per execution, unless the
+// agent or SetMaxCapturedOutputBytes sets another cap
+const MaxCapturedOutputBytes = 1 << 20
+
+// capturedOutputDefault is the cap of agents setting none, MaxCapturedOutputBytes when 0
+var capturedOutputDefault atomic.Int64
+
+// SetMaxCapturedOutputBytes sets how much of each output stream is kept per execution of the agents
+// that set no max_output_bytes; 0 restores MaxCapturedOutputBytes
+func SetMaxCapturedOutputBytes(limit int64) {
+	capturedOutputDefault.Store(limit)
+}
+
+// capturedOutputLimit returns how much of each output stream an agent's executions keep
+func capturedOutputLimit(config *models.AgentConfiguration) int {
+	if config != nil && config.MaxOutputBytes > 0 {
+		return int(config.MaxOutputBytes)
+	}
+	if limit := capturedOutputDefault.Load(); limit > 0 {
+		return int(limit)
+	}
+	return MaxCapturedOutputBytes
+}
+
+// RequestIDEnvVar passes the originating request ID to agent processes
+const RequestIDEnvVar = "SUPERVISOR_REQUEST_ID"
+
+// ArtifactsDirEnvVar passes the directory an execution may leave files in to agent processes
+const ArtifactsDirEnvVar = "SUPERVISOR_ARTIFACTS_DIR"
+
+// InputFileEnvVar passes the path of a file uploaded as an execution's input to agent processes
+const InputFileEnvVar = "SUPERVISOR_INPUT_FILE"
+
+// ConversationHistoryEnvVar passes the prior exchanges of an execution's A2A conversation to agent
+// processes, as a JSON array
+const ConversationHistoryEnvVar = "SUPERVISOR_CONVERSATION_HISTORY"
+
+// ProcessResult holds the separated output streams and exit information of an agent process
+type ProcessResult struct {
+	Output    string // Stdout after processing by the output handler
+	Stdout    []byte
+	Stderr    []byte
+	ExitCode  int
+	Signal    string
+	Truncated bool
+}
+
+// cappedBuffer keeps at most limit bytes but accepts every write so the child never sees EPIPE
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	progress  *progressFilter // Filters progress markers out of the stream, holding back its last line
+}
+
+// Write stores as much of p as fits under the limit
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// Bytes returns the captured data
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Names of the output streams reported to an OutputObserver
+const (
+	StdoutStream = "stdout"
+	StderrStream = "stderr"
+)
+
+// OutputObserver receives each chunk an agent process writes to stdout or stderr, as it is written.
+// The chunk is only valid during the call.
+type OutputObserver func(stream string, chunk []byte)
+
+// outputObserverKey carries the OutputObserver of executions started with a context
+type outputObserverKey struct{}
+
+// WithOutputObserver returns a context whose agent processes report their output to observer
+func WithOutputObserver(ctx context.Context, observer OutputObserver) context.Context {
+	return context.WithValue(ctx, outputObserverKey{}, observer)
+}
+
+// outputObserverFromContext returns the context's OutputObserver, or nil
+func outputObserverFromContext(ctx context.Context) OutputObserver {
+	observer, _ := ctx.Value(outputObserverKey{}).(OutputObserver)
+	return observer
+}
+
+// captureOutput wires size-capped stdout and stderr buffers onto the command, taking progress
+// markers out of stderr for the context's ProgressReporter when it has one, teeing each stream
+// to the agent's log file when one is configured, to the context's OutputObserver and to the
+// execution's watchdog
+func captureOutput(ctx context.Context, cmd *exec.Cmd, config *models.AgentConfiguration, watchdog *watchdog) (stdout, stderr *cappedBuffer) {
+	limit := capturedOutputLimit(config)
+	stdout = &cappedBuffer{limit: limit}
+	stderr = &cappedBuffer{limit: limit}
+	observer := outputObserverFromContext(ctx)
+	cmd.Stdout = streamWriter(stdout, agentLogSink(config, LogfilePath(config, config.StdoutLogfile)), observer, StdoutStream)
+	cmd.Stderr = streamWriter(stderr, agentLogSink(config, LogfilePath(config, config.StderrLogfile)), observer, StderrStream)
+	if reporter := progressReporterFromContext(ctx); reporter != nil {
+		stderr.progress = &progressFilter{next: cmd.Stderr, reporter: reporter}
+		cmd.Stderr = stderr.progress
+	}
+	if activity := watchdog.stream(); activity != nil {
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, activity)
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, watchdog.stream())
+	}
+	return stdout, stderr
+}
+
+// streamWriter returns the capture buffer alone, or a tee to it, the log file and the observer
+func streamWriter(capture *cappedBuffer, sink *RotatingFile, observer OutputObserver, stream string) io.Writer {
+	if sink == nil && observer == nil {
+		return capture
+	}
+
+	tee := &teeWriter{capture: capture, observer: observer, stream: stream}
+	if sink != nil {
+		tee.sink = sink
+	}
+	return tee
+}
+
+// newProcessResult builds a ProcessResult from the finished command and its captured output
+func newProcessResult(cmd *exec.Cmd, stdout, stderr *cappedBuffer) *ProcessResult {
+	stderr.progress.flush()
+	result := &ProcessResult{
+		Stdout:    stdout.Bytes(),
+		Stderr:    stderr.Bytes(),
+		ExitCode:  -1,
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+
+	if state := cmd.ProcessState; state != nil {
+		result.ExitCode = state.ExitCode()
+		if result.ExitCode == -1 {
+			// ProcessState reports "signal: <name>" for processes terminated by a signal
+			result.Signal = strings.TrimPrefix(state.String(), "signal: ")
+		}
+	}
+
+	return result
+}
+
+// isExitError reports whether err only signals a non-zero exit of a process that did run
+func isExitError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// mappedExitStatus returns the status the agent's exit code map gives the nonzero exit code of a
+// process that ran to completion; false when that exit is a failure
+func mappedExitStatus(config *models.AgentConfiguration, exitCode int) (types.ExecutionStatus, bool) {
+	if exitCode <= 0 {
+		return "", false
+	}
+	status, ok := config.ExitCodeMap.StatusOf(exitCode)
+	if !ok || status == types.FailureStatus {
+		return "", false
+	}
+	return status, true
+}
+
+// artifactsDirKey carries the artifacts directory of executions started with a context
+type artifactsDirKey struct{}
+
+// WithArtifactsDir returns a context whose agent processes are told to leave their artifacts in dir
+func WithArtifactsDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, artifactsDirKey{}, dir)
+}
+
+// artifactsDirFromContext returns the context's artifacts directory, or ""
+func artifactsDirFromContext(ctx context.Context) string {
+	dir, _ := ctx.Value(artifactsDirKey{}).(string)
+	return dir
+}
+
+// inputFileKey carries the uploaded input file of executions started with a context
+type inputFileKey struct{}
+
+// WithInputFile returns a context whose executions take the file at path as their input: agents
+// with the file input pattern find it at their input file template, other agents are told its path
+// in $SUPERVISOR_INPUT_FILE. The file must stay in place until the executions finish.
+func WithInputFile(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, inputFileKey{}, path)
+}
+
+// inputFileFromContext returns the context's input file, or ""
+func inputFileFromContext(ctx context.Context) string {
+	path, _ := ctx.Value(inputFileKey{}).(string)
+	return path
+}
+
+// conversationHistoryKey carries the prior exchanges of the A2A conversation executions started with
+// a context belong to
+type conversationHistoryKey struct{}
+
+// WithConversationHistory returns a context whose executions are given the prior exchanges of their
+// A2A conversation: persistent agents receive them in the conversation_history param of the execute
+// request, other agents in $SUPERVISOR_CONVERSATION_HISTORY
+func WithConversationHistory(ctx context.Context, history []models.ConversationExchange) context.Context {
+	return context.WithValue(ctx, conversationHistoryKey{}, history)
+}
+
+// conversationHistoryFromContext returns the context's conversation history, and false when the
+// executions are not part of a conversation
+func conversationHistoryFromContext(ctx context.Context) ([]models.ConversationExchange, bool) {
+	history, ok := ctx.Value(conversationHistoryKey{}).([]models.ConversationExchange)
+	return history, ok
+}
+
+// writeInputFile writes an execution's input to filename, or when the execution has an input file
+// links that file there, copying it only across filesystems, so large uploads never pass through
+// memory
+func writeInputFile(filename, input, inputFile string) error {
+	if inputFile == "" {
+		return os.WriteFile(filename, []byte(input), 0600)
+	}
+	if err := os.Link(inputFile, filename); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+// processEnv builds the agent process environment, or returns nil to inherit the supervisor's unchanged
+func processEnv(ctx context.Context, envs map[string]string) []string {
+	requestID := logging.RequestIDFromContext(ctx)
+	artifactsDir := artifactsDirFromContext(ctx)
+	inputFile := inputFileFromContext(ctx)
+	history, inConversation := conversationHistoryFromContext(ctx)
+	if len(envs) == 0 && requestID == "" && artifactsDir == "" && inputFile == "" && !inConversation {
+		return nil
+	}
+
+	env := os.Environ()
+	for key, value := range envs {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	if requestID != "" {
+		env = append(env, fmt.Sprintf("%s=%s", RequestIDEnvVar, requestID))
+	}
+	if artifactsDir != "" {
+		env = append(env, fmt.Sprintf("%s=%s", ArtifactsDirEnvVar, artifactsDir))
+	}
+	if inputFile != "" {
+		env = append(env, fmt.Sprintf("%s=%s", InputFileEnvVar, inputFile))
+	}
+	if inConversation {
+		if history == nil {
+			history = []models.ConversationExchange{}
+		}
+		data, _ := json.Marshal(history)
+		env = append(env, fmt.Sprintf("%s=%s", ConversationHistoryEnvVar, data))
+	}
+
+	return env
+}
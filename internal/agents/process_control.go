@@ -0,0 +1,95 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// DefaultStopWait is how long a terminated agent process tree may take to exit before it is killed
+const DefaultStopWait = 10 * time.Second
+
+// ProcessTerminator stops an agent process together with the processes it started. Each platform
+// provides its own; newProcessTerminator returns the one of the running platform.
+type ProcessTerminator interface {
+	// Prepare configures cmd before it starts so its whole process tree can be stopped
+	Prepare(cmd *exec.Cmd)
+
+	// Terminate asks the process tree of the started cmd to exit gracefully with signal, a name from
+	// models.StopSignals; platforms without signals ignore it
+	Terminate(cmd *exec.Cmd, signal string) error
+
+	// Kill forcibly ends the process tree of the started cmd
+	Kill(cmd *exec.Cmd) error
+}
+
+// StopRequest overrides the stop signal of an agent for one execution. Cancelling the execution's
+// context with a StopRequest as the cause stops the agent with Signal instead of its own.
+type StopRequest struct {
+	Signal string
+}
+
+func (r *StopRequest) Error() string {
+	return fmt.Sprintf("execution stopped with %s", r.Signal)
+}
+
+// stopSettings returns the signal and wait that stop an agent whose execution context ended: a
+// StopRequest cause wins over the agent's configuration, which falls back to TERM and DefaultStopWait
+func stopSettings(ctx context.Context, config *models.AgentConfiguration) (string, time.Duration) {
+	signal, wait := models.DefaultStopSignal, DefaultStopWait
+	if config != nil {
+		if normalized, err := models.NormalizeStopSignal(config.StopSignal); err == nil && normalized != "" {
+			signal = normalized
+		}
+		if config.StopWaitSeconds > 0 {
+			wait = time.Duration(config.StopWaitSeconds) * time.Second
+		}
+	}
+
+	var request *StopRequest
+	if errors.As(context.Cause(ctx), &request) {
+		if normalized, err := models.NormalizeStopSignal(request.Signal); err == nil && normalized != "" {
+			signal = normalized
+		}
+	}
+	return signal, wait
+}
+
+// stopProcess terminates the process tree of cmd with signal and kills it when it has not exited
+// after wait. done must deliver the result of cmd.Wait; stopProcess reports whether a kill was
+// needed and returns that result.
+func stopProcess(terminator ProcessTerminator, cmd *exec.Cmd, done <-chan error, signal string, wait time.Duration) (bool, error) {
+	if signal == "KILL" {
+		terminator.Kill(cmd)
+		return false, <-done
+	}
+	if err := terminator.Terminate(cmd, signal); err != nil {
+		// A tree that cannot be asked to exit is killed right away
+		wait = 0
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return false, err
+	case <-timer.C:
+	}
+
+	terminator.Kill(cmd)
+	return true, <-done
+}
+
+// LimitWarning reports a process limit of an agent that this platform cannot apply and ignores
+type LimitWarning struct {
+	Field string
+}
+
+func (w LimitWarning) String() string {
+	return fmt.Sprintf("%s is not supported on %s and is ignored", w.Field, runtime.GOOS)
+}
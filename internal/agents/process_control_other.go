@@ -0,0 +1,68 @@
+//go:build !windows
+
+package agents
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// posixTerminator starts agents in their own process group, sends the group their stop signal and
+// SIGKILL when they do not exit in time
+type posixTerminator struct{}
+
+// newProcessTerminator returns the terminator of the running platform
+func newProcessTerminator() ProcessTerminator {
+	return posixTerminator{}
+}
+
+// Prepare makes the process lead a new process group, which its children join
+func (posixTerminator) Prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// stopSignals maps the names of models.StopSignals to their signals
+var stopSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"HUP":  syscall.SIGHUP,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"KILL": syscall.SIGKILL,
+}
+
+// Terminate sends signal to the process group, SIGTERM when the name is unknown
+func (posixTerminator) Terminate(cmd *exec.Cmd, signal string) error {
+	sig, ok := stopSignals[signal]
+	if !ok {
+		sig = syscall.SIGTERM
+	}
+	return signalGroup(cmd, sig)
+}
+
+// Kill sends SIGKILL to the process group
+func (posixTerminator) Kill(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGKILL)
+}
+
+// signalGroup sends signal to the process group led by the started cmd
+func signalGroup(cmd *exec.Cmd, signal syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, signal)
+}
+
+// commandLine returns the program and arguments that run executable with args
+func commandLine(executable string, args []string) (string, []string) {
+	return executable, args
+}
+
+// executableExtensions lists the extensions tried when an executable path has none
+func executableExtensions() []string {
+	return nil
+}
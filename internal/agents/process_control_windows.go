@@ -0,0 +1,83 @@
+//go:build windows
+
+package agents
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// generateConsoleCtrlEvent sends console control events to a process group
+var generateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// windowsTerminator starts agents in their own process group, sends the group CTRL_BREAK to stop
+// them and ends the process tree when they do not exit in time
+type windowsTerminator struct{}
+
+// newProcessTerminator returns the terminator of the running platform
+func newProcessTerminator() ProcessTerminator {
+	return windowsTerminator{}
+}
+
+// Prepare makes the process the root of a new process group, so console events reach only its tree
+func (windowsTerminator) Prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// Terminate sends CTRL_BREAK to the process group whatever the signal, as Windows has no signals.
+// Processes without a console don't receive console events, so taskkill without /F then asks the
+// tree's windows to close.
+func (windowsTerminator) Terminate(cmd *exec.Cmd, signal string) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if ok, _, _ := generateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(cmd.Process.Pid)); ok != 0 {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// Kill ends the process tree with taskkill /T /F, falling back to TerminateProcess on the process
+// itself when taskkill fails
+func (windowsTerminator) Kill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// commandLine returns the program and arguments that run executable with args; batch files are
+// run through cmd.exe
+func commandLine(executable string, args []string) (string, []string) {
+	switch strings.ToLower(filepath.Ext(executable)) {
+	case ".bat", ".cmd":
+		return "cmd.exe", append([]string{"/C", executable}, args...)
+	}
+	return executable, args
+}
+
+// executableExtensions lists the extensions tried when an executable path has none, from PATHEXT
+func executableExtensions() []string {
+	pathext := os.Getenv("PATHEXT")
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+
+	var extensions []string
+	for _, extension := range strings.Split(strings.ToLower(pathext), ";") {
+		if extension != "" {
+			extensions = append(extensions, extension)
+		}
+	}
+	return extensions
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package agents
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// inspectProcess reports whether pid is running and returns its start time in clock ticks since
+// boot from /proc. Zombies count as exited.
+func inspectProcess(pid int) (bool, string) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false, ""
+	}
+
+	// The command name in parentheses may itself contain spaces and parentheses
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return false, ""
+	}
+	// fields[0] is the state, fields[19] the start time
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return false, ""
+	}
+	if fields[0] == "Z" || fields[0] == "X" {
+		return false, ""
+	}
+	return true, fields[19]
+}
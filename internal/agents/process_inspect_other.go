@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package agents
+
+import "syscall"
+
+// inspectProcess reports whether pid is running. The start identity is only read on Linux and
+// Windows, so a reused PID is taken for the recorded process.
+func inspectProcess(pid int) (bool, string) {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM, ""
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package agents
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// processQueryLimitedInformation is the access right needed to query the exit code and times of a process
+const processQueryLimitedInformation = 0x1000
+
+// stillActive is the exit code of processes that have not exited
+const stillActive = 259
+
+// inspectProcess reports whether pid is running and returns its creation time
+func inspectProcess(pid int) (bool, string) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false, ""
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil || exitCode != stillActive {
+		return false, ""
+	}
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return true, ""
+	}
+	return true, strconv.FormatInt(creation.Nanoseconds(), 10)
+}
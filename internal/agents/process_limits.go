@@ -0,0 +1,13 @@
+package agents
+
+import "github.com/algonius/algonius-supervisor/internal/models"
+
+// hasProcessLimits reports whether the agent runs as another user or with a nice level or resource limits
+func hasProcessLimits(config *models.AgentConfiguration) bool {
+	return config.RunAsUser != "" || config.RunAsGroup != "" || hasLauncherLimits(config)
+}
+
+// hasLauncherLimits reports whether the agent needs the launcher to apply a nice level or resource limits
+func hasLauncherLimits(config *models.AgentConfiguration) bool {
+	return config.NiceLevel != 0 || config.MaxMemoryMB > 0 || config.MaxCPUSeconds > 0
+}
@@ -0,0 +1,309 @@
+//go:build linux
+
+package agents
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// agentLauncherName is the argv[0] under which the supervisor binary acts as the agent launcher.
+// The launcher applies the agent's nice level and resource limits to itself, then execs the agent,
+// since os/exec offers no hook between fork and exec.
+const agentLauncherName = "algonius-agent-launcher"
+
+// rlimInfinity is RLIM_INFINITY as the uint64 limits of syscall.Rlimit
+const rlimInfinity = ^uint64(0)
+
+// outOfMemoryMessages are lower-cased stderr fragments of programs that failed to allocate memory
+var outOfMemoryMessages = []string{
+	"out of memory",
+	"cannot allocate memory",
+	"memoryerror",
+	"memory exhausted",
+	"bad_alloc",
+	"allocation failed",
+}
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == agentLauncherName {
+		os.Exit(runAgentLauncher(os.Args[1:]))
+	}
+}
+
+// launcherLimits are the limits the launcher applies before exec'ing the agent
+type launcherLimits struct {
+	nice       int
+	memoryMB   int64
+	cpuSeconds int64
+}
+
+// UnsupportedProcessLimits returns nothing, since Linux supports every process limit
+func UnsupportedProcessLimits(config *models.AgentConfiguration) []LimitWarning {
+	return nil
+}
+
+// CheckProcessLimits reports whether the agent's user, group, nice level and resource limits can be
+// applied by this supervisor process; the error is a models.FieldError naming the offending field
+func CheckProcessLimits(config *models.AgentConfiguration) error {
+	if !hasProcessLimits(config) {
+		return nil
+	}
+
+	euid := os.Geteuid()
+	credential, err := processCredential(config)
+	if err != nil {
+		return err
+	}
+	if credential != nil && euid != 0 {
+		if int(credential.Uid) != euid || int(credential.Gid) != os.Getegid() {
+			field := "run_as_user"
+			if config.RunAsUser == "" {
+				field = "run_as_group"
+			}
+			return models.NewFieldError(field, models.ValidationUnavailable,
+				fmt.Errorf("running agent %s as another user or group requires the supervisor to run as root", config.ID))
+		}
+	}
+
+	if config.NiceLevel < 0 && (euid != 0 || (credential != nil && credential.Uid != 0)) {
+		return models.NewFieldError("nice_level", models.ValidationUnavailable,
+			fmt.Errorf("negative nice_level for agent %s requires the supervisor and the agent to run as root", config.ID))
+	}
+
+	if err := checkRlimit(syscall.RLIMIT_AS, uint64(config.MaxMemoryMB)<<20, euid); err != nil {
+		return models.NewFieldError("max_memory_mb", models.ValidationUnavailable, fmt.Errorf("max_memory_mb for agent %s: %w", config.ID, err))
+	}
+	if err := checkRlimit(syscall.RLIMIT_CPU, uint64(config.MaxCPUSeconds), euid); err != nil {
+		return models.NewFieldError("max_cpu_seconds", models.ValidationUnavailable, fmt.Errorf("max_cpu_seconds for agent %s: %w", config.ID, err))
+	}
+
+	if hasLauncherLimits(config) {
+		if _, err := os.Executable(); err != nil {
+			return fmt.Errorf("cannot locate the supervisor executable to launch agent %s: %w", config.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkRlimit fails when an unprivileged process would have to raise the hard limit to apply value
+func checkRlimit(resource int, value uint64, euid int) error {
+	if value == 0 || euid == 0 {
+		return nil
+	}
+
+	var current syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &current); err != nil {
+		return fmt.Errorf("failed to read the current limit: %w", err)
+	}
+	if current.Max != rlimInfinity && value > current.Max {
+		return fmt.Errorf("%d exceeds the supervisor's hard limit of %d", value, current.Max)
+	}
+	return nil
+}
+
+// processCredential resolves the agent's user and group, or returns nil when it runs as the supervisor
+func processCredential(config *models.AgentConfiguration) (*syscall.Credential, error) {
+	if config.RunAsUser == "" && config.RunAsGroup == "" {
+		return nil, nil
+	}
+
+	uid, gid := uint32(os.Geteuid()), uint32(os.Getegid())
+	if config.RunAsUser != "" {
+		account, err := lookupUser(config.RunAsUser)
+		if err != nil {
+			return nil, models.NewFieldError("run_as_user", models.ValidationNotFound, fmt.Errorf("run_as_user %s for agent %s: %w", config.RunAsUser, config.ID, err))
+		}
+		uid, gid = parseID(account.Uid), parseID(account.Gid)
+	}
+	if config.RunAsGroup != "" {
+		group, err := lookupGroup(config.RunAsGroup)
+		if err != nil {
+			return nil, models.NewFieldError("run_as_group", models.ValidationNotFound, fmt.Errorf("run_as_group %s for agent %s: %w", config.RunAsGroup, config.ID, err))
+		}
+		gid = parseID(group.Gid)
+	}
+
+	return &syscall.Credential{Uid: uid, Gid: gid}, nil
+}
+
+// lookupUser resolves a user by name, falling back to a numeric ID
+func lookupUser(name string) (*user.User, error) {
+	account, err := user.Lookup(name)
+	if err == nil {
+		return account, nil
+	}
+	if _, convErr := strconv.ParseUint(name, 10, 32); convErr == nil {
+		return user.LookupId(name)
+	}
+	return nil, err
+}
+
+// lookupGroup resolves a group by name, falling back to a numeric ID
+func lookupGroup(name string) (*user.Group, error) {
+	group, err := user.LookupGroup(name)
+	if err == nil {
+		return group, nil
+	}
+	if _, convErr := strconv.ParseUint(name, 10, 32); convErr == nil {
+		return user.LookupGroupId(name)
+	}
+	return nil, err
+}
+
+// parseID converts a numeric user or group ID returned by os/user
+func parseID(id string) uint32 {
+	value, _ := strconv.ParseUint(id, 10, 32)
+	return uint32(value)
+}
+
+// applyProcessLimits makes cmd run as the agent's user and group and, when the agent has a nice
+// level or resource limits, through the launcher that applies them before exec'ing the agent
+func applyProcessLimits(cmd *exec.Cmd, config *models.AgentConfiguration) error {
+	if !hasProcessLimits(config) {
+		return nil
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	credential, err := processCredential(config)
+	if err != nil {
+		return err
+	}
+	if credential != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+	}
+
+	if !hasLauncherLimits(config) {
+		return nil
+	}
+	launcher, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the supervisor executable to launch the agent: %w", err)
+	}
+
+	args := []string{
+		agentLauncherName,
+		"--nice=" + strconv.Itoa(config.NiceLevel),
+		"--memory-mb=" + strconv.FormatInt(config.MaxMemoryMB, 10),
+		"--cpu-seconds=" + strconv.FormatInt(config.MaxCPUSeconds, 10),
+		"--",
+		cmd.Path,
+	}
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = launcher
+	return nil
+}
+
+// runAgentLauncher applies the limits given on the command line to this process and execs the
+// agent after "--"; it only returns when that fails
+func runAgentLauncher(args []string) int {
+	limits, argv, err := parseLauncherArgs(args)
+	if err == nil {
+		err = limits.apply()
+	}
+	if err == nil {
+		err = syscall.Exec(argv[0], argv, os.Environ())
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", agentLauncherName, err)
+	return 126
+}
+
+// parseLauncherArgs parses the launcher's --name=value limits and the agent command line after "--"
+func parseLauncherArgs(args []string) (launcherLimits, []string, error) {
+	var limits launcherLimits
+	for i, arg := range args {
+		if arg == "--" {
+			if i == len(args)-1 {
+				return limits, nil, fmt.Errorf("missing agent command")
+			}
+			return limits, args[i+1:], nil
+		}
+
+		name, value, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return limits, nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		switch name {
+		case "nice":
+			limits.nice = int(number)
+		case "memory-mb":
+			limits.memoryMB = number
+		case "cpu-seconds":
+			limits.cpuSeconds = number
+		default:
+			return limits, nil, fmt.Errorf("unknown option %s", arg)
+		}
+	}
+	return limits, nil, fmt.Errorf("missing agent command")
+}
+
+// apply sets the nice level and resource limits of the current process
+func (l launcherLimits) apply() error {
+	if l.nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, l.nice); err != nil {
+			return fmt.Errorf("failed to set nice level %d: %w", l.nice, err)
+		}
+	}
+	if l.memoryMB > 0 {
+		limit := uint64(l.memoryMB) << 20
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("failed to limit memory to %d MB: %w", l.memoryMB, err)
+		}
+	}
+	if l.cpuSeconds > 0 {
+		// The soft limit delivers SIGXCPU; the hard limit a second later kills agents that ignore it
+		limit := uint64(l.cpuSeconds)
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: limit, Max: limit + 1}); err != nil {
+			return fmt.Errorf("failed to limit CPU time to %d seconds: %w", l.cpuSeconds, err)
+		}
+	}
+	return nil
+}
+
+// resourceLimitViolation describes the limit a failed agent process exceeded, or returns "" when
+// its failure does not look like a limit violation
+func resourceLimitViolation(config *models.AgentConfiguration, state *os.ProcessState, stderr []byte) string {
+	if state == nil || state.Success() {
+		return ""
+	}
+	status, _ := state.Sys().(syscall.WaitStatus)
+
+	if config.MaxCPUSeconds > 0 {
+		cpuTime := state.UserTime() + state.SystemTime()
+		limit := time.Duration(config.MaxCPUSeconds) * time.Second
+		if status.Signaled() && (status.Signal() == syscall.SIGXCPU || (status.Signal() == syscall.SIGKILL && cpuTime >= limit)) {
+			return fmt.Sprintf("CPU time limit of %d seconds exceeded", config.MaxCPUSeconds)
+		}
+	}
+
+	if config.MaxMemoryMB > 0 {
+		if reportsOutOfMemory(stderr) || (status.Signaled() && (status.Signal() == syscall.SIGSEGV || status.Signal() == syscall.SIGABRT || status.Signal() == syscall.SIGBUS)) {
+			return fmt.Sprintf("memory limit of %d MB exceeded", config.MaxMemoryMB)
+		}
+	}
+
+	return ""
+}
+
+// reportsOutOfMemory reports whether stderr looks like the output of a failed allocation
+func reportsOutOfMemory(stderr []byte) bool {
+	text := strings.ToLower(string(stderr))
+	for _, message := range outOfMemoryMessages {
+		if strings.Contains(text, message) {
+			return true
+		}
+	}
+	return false
+}
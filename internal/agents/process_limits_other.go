@@ -0,0 +1,47 @@
+//go:build !linux
+
+package agents
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// CheckProcessLimits accepts every agent: users, groups, nice levels and resource limits are only
+// supported on Linux, and UnsupportedProcessLimits reports the ones ignored here
+func CheckProcessLimits(config *models.AgentConfiguration) error {
+	return nil
+}
+
+// UnsupportedProcessLimits returns a warning for each user, group, nice level or resource limit the
+// agent sets, since none of them are applied off Linux
+func UnsupportedProcessLimits(config *models.AgentConfiguration) []LimitWarning {
+	var warnings []LimitWarning
+	for _, limit := range []struct {
+		field string
+		set   bool
+	}{
+		{"run_as_user", config.RunAsUser != ""},
+		{"run_as_group", config.RunAsGroup != ""},
+		{"nice_level", config.NiceLevel != 0},
+		{"max_memory_mb", config.MaxMemoryMB > 0},
+		{"max_cpu_seconds", config.MaxCPUSeconds > 0},
+	} {
+		if limit.set {
+			warnings = append(warnings, LimitWarning{Field: limit.field})
+		}
+	}
+	return warnings
+}
+
+// applyProcessLimits leaves cmd unchanged, since process limits are only supported on Linux
+func applyProcessLimits(cmd *exec.Cmd, config *models.AgentConfiguration) error {
+	return nil
+}
+
+// resourceLimitViolation never reports a violation, since no limits are applied
+func resourceLimitViolation(config *models.AgentConfiguration, state *os.ProcessState, stderr []byte) string {
+	return ""
+}
@@ -0,0 +1,219 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// orphanKillWait is how long a killed orphan may take to disappear
+const orphanKillWait = 5 * time.Second
+
+// processPollInterval is how often a stopped process is checked for having exited
+const processPollInterval = 50 * time.Millisecond
+
+// ProcessRegistry keeps a state file for every agent process the supervisor spawns, so processes
+// left running by a supervisor that crashed or was killed can be found after it restarts
+type ProcessRegistry struct {
+	dir     string
+	tracked map[int]bool // PIDs tracked by this registry, as opposed to a previous supervisor's
+	mutex   sync.Mutex
+	logger  *zap.Logger
+}
+
+// NewProcessRegistry creates a ProcessRegistry keeping its state files in dir
+func NewProcessRegistry(dir string, logger *zap.Logger) *ProcessRegistry {
+	return &ProcessRegistry{dir: dir, tracked: make(map[int]bool), logger: logger}
+}
+
+// Dir returns the directory holding the state files
+func (r *ProcessRegistry) Dir() string {
+	return r.dir
+}
+
+// Track writes the state file of a started process, recording its start identity when the
+// record has none
+func (r *ProcessRegistry) Track(record models.ProcessRecord) error {
+	if record.StartIdentity == "" {
+		if alive, identity := inspectProcess(record.PID); alive {
+			record.StartIdentity = identity
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode process state: %w", err)
+	}
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create process state directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial state file behind
+	path := r.path(record.PID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write process state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write process state: %w", err)
+	}
+
+	r.mutex.Lock()
+	r.tracked[record.PID] = true
+	r.mutex.Unlock()
+	return nil
+}
+
+// Untrack removes the state file of a process
+func (r *ProcessRegistry) Untrack(pid int) error {
+	r.mutex.Lock()
+	delete(r.tracked, pid)
+	r.mutex.Unlock()
+
+	if err := os.Remove(r.path(pid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove process state: %w", err)
+	}
+	return nil
+}
+
+// Records returns the processes with a state file that were not started through this registry,
+// ordered by PID. Unreadable state files are logged and removed.
+func (r *ProcessRegistry) Records() ([]models.ProcessRecord, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read process state directory: %w", err)
+	}
+
+	var records []models.ProcessRecord
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		path := filepath.Join(r.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read process state: %w", err)
+		}
+		var record models.ProcessRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.PID <= 0 {
+			r.logger.Warn("removing unreadable process state file", zap.String("path", path), zap.Error(err))
+			os.Remove(path)
+			continue
+		}
+		r.mutex.Lock()
+		own := r.tracked[record.PID]
+		r.mutex.Unlock()
+		if !own {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].PID < records[j].PID })
+	return records, nil
+}
+
+// Alive reports whether the recorded process is still running. A running process with another
+// start identity has reused the PID and does not count.
+func (r *ProcessRegistry) Alive(record models.ProcessRecord) bool {
+	alive, identity := inspectProcess(record.PID)
+	if !alive {
+		return false
+	}
+	return record.StartIdentity == "" || identity == "" || identity == record.StartIdentity
+}
+
+// Terminate stops the process tree of a recorded process with the stop signal of its agent and
+// kills it when it has not exited after the agent's stop wait; config may be nil for the defaults.
+// The state file is removed once the process is gone.
+func (r *ProcessRegistry) Terminate(record models.ProcessRecord, config *models.AgentConfiguration) error {
+	if !r.Alive(record) {
+		return r.Untrack(record.PID)
+	}
+	process, err := os.FindProcess(record.PID)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %w", record.PID, err)
+	}
+	defer process.Release()
+
+	cmd := &exec.Cmd{Process: process}
+	terminator := newProcessTerminator()
+	signal, wait := stopSettings(context.Background(), config)
+	if signal != "KILL" {
+		terminator.Terminate(cmd, signal)
+		if r.waitExit(record, wait) {
+			return r.Untrack(record.PID)
+		}
+	}
+	terminator.Kill(cmd)
+	if !r.waitExit(record, orphanKillWait) {
+		return fmt.Errorf("process %d did not exit after being killed", record.PID)
+	}
+	return r.Untrack(record.PID)
+}
+
+// waitExit reports whether the recorded process exits within timeout
+func (r *ProcessRegistry) waitExit(record models.ProcessRecord, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for r.Alive(record) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(processPollInterval)
+	}
+	return true
+}
+
+// path returns the state file of pid
+func (r *ProcessRegistry) path(pid int) string {
+	return filepath.Join(r.dir, strconv.Itoa(pid)+".json")
+}
+
+// processRegistryKey carries the registry agent processes started with a context are tracked in
+type processRegistryKey struct{}
+
+// WithProcessRegistry returns a context whose agent processes are tracked in registry while they run
+func WithProcessRegistry(ctx context.Context, registry *ProcessRegistry) context.Context {
+	return context.WithValue(ctx, processRegistryKey{}, registry)
+}
+
+// trackProcess records the started cmd in the context's process registry, if any, and returns
+// the function that forgets it once it has exited
+func trackProcess(ctx context.Context, cmd *exec.Cmd, agentID string) func() {
+	registry, _ := ctx.Value(processRegistryKey{}).(*ProcessRegistry)
+	if registry == nil || cmd.Process == nil {
+		return func() {}
+	}
+
+	pid := cmd.Process.Pid
+	record := models.ProcessRecord{
+		PID:         pid,
+		AgentID:     agentID,
+		ExecutionID: logging.ExecutionIDFromContext(ctx),
+		StartedAt:   time.Now(),
+	}
+	if err := registry.Track(record); err != nil {
+		registry.logger.Warn("failed to track agent process", zap.String("agent_id", agentID), zap.Int("pid", pid), zap.Error(err))
+		return func() {}
+	}
+	return func() {
+		if err := registry.Untrack(pid); err != nil {
+			registry.logger.Warn("failed to untrack agent process", zap.String("agent_id", agentID), zap.Int("pid", pid), zap.Error(err))
+		}
+	}
+}
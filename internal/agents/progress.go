@@ -0,0 +1,128 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// ProgressMarker starts the stderr lines an agent reports its progress with, followed by a JSON
+// object such as {"percent": 42, "message": "indexing"}
+const ProgressMarker = "@@progress "
+
+// maxProgressLineBytes caps how much of an unterminated line is held back while it may still be a
+// progress marker; longer lines pass through as ordinary output
+const maxProgressLineBytes = 4096
+
+// ProgressReporter receives each progress report an agent process writes to stderr
+type ProgressReporter func(progress models.ExecutionProgress)
+
+// progressReporterKey carries the ProgressReporter of executions started with a context
+type progressReporterKey struct{}
+
+// WithProgressReporter returns a context whose agent processes report their progress to reporter
+func WithProgressReporter(ctx context.Context, reporter ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressReporterKey{}, reporter)
+}
+
+// progressReporterFromContext returns the context's ProgressReporter, or nil
+func progressReporterFromContext(ctx context.Context) ProgressReporter {
+	reporter, _ := ctx.Value(progressReporterKey{}).(ProgressReporter)
+	return reporter
+}
+
+// ParseProgressLine parses a stderr line holding a progress marker. Lines without the marker, with
+// a malformed JSON object or with a percent outside 0..100 are not progress reports.
+func ParseProgressLine(line []byte) (models.ExecutionProgress, bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if !bytes.HasPrefix(line, []byte(ProgressMarker)) {
+		return models.ExecutionProgress{}, false
+	}
+
+	var report struct {
+		Percent *float64 `json:"percent"`
+		Message string   `json:"message"`
+	}
+	if err := json.Unmarshal(line[len(ProgressMarker):], &report); err != nil {
+		return models.ExecutionProgress{}, false
+	}
+	if report.Percent == nil || *report.Percent < 0 || *report.Percent > 100 {
+		return models.ExecutionProgress{}, false
+	}
+	return models.ExecutionProgress{Percent: *report.Percent, Message: report.Message, UpdatedAt: time.Now().UTC()}, true
+}
+
+// progressFilter takes progress markers out of an agent's stderr before it reaches the capture
+// buffer, log file and observers, reporting them instead. Lines that may still turn out to be a
+// marker are held back until they end; every other byte passes through as it is written.
+type progressFilter struct {
+	next     io.Writer
+	reporter ProgressReporter
+	line     []byte // Start of the current line, held back while it may be a marker
+	passing  bool   // Whether the current line was found not to be a marker and is passing through
+}
+
+// Write filters p and always reports success to the child's pipe
+func (f *progressFilter) Write(p []byte) (int, error) {
+	data := p
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if f.passing {
+			if end == 0 {
+				f.next.Write(data)
+				break
+			}
+			f.next.Write(data[:end])
+			f.passing = false
+			data = data[end:]
+			continue
+		}
+
+		if end == 0 {
+			f.line = append(f.line, data...)
+			if !f.mayBeMarker() {
+				f.next.Write(f.line)
+				f.line = f.line[:0]
+				f.passing = true
+			}
+			break
+		}
+		f.line = append(f.line, data[:end]...)
+		f.emit()
+		data = data[end:]
+	}
+	return len(p), nil
+}
+
+// mayBeMarker reports whether the held back line may still become a progress marker
+func (f *progressFilter) mayBeMarker() bool {
+	if len(f.line) > maxProgressLineBytes {
+		return false
+	}
+	if len(f.line) < len(ProgressMarker) {
+		return bytes.HasPrefix([]byte(ProgressMarker), f.line)
+	}
+	return bytes.HasPrefix(f.line, []byte(ProgressMarker))
+}
+
+// emit reports the held back line when it is a progress marker, or passes it through
+func (f *progressFilter) emit() {
+	if progress, ok := ParseProgressLine(f.line); ok {
+		f.reporter(progress)
+	} else {
+		f.next.Write(f.line)
+	}
+	f.line = f.line[:0]
+}
+
+// flush handles a line still held back once the agent process exited; nil does nothing
+func (f *progressFilter) flush() {
+	if f == nil || len(f.line) == 0 {
+		return
+	}
+	f.emit()
+}
@@ -0,0 +1,333 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultStartRetries is how many failed starts in a row put a persistent agent in the fatal
+	// state when it doesn't set start_retries
+	DefaultStartRetries = 3
+
+	// DefaultStartSecs is how long a persistent agent's process must run for its start to count as
+	// successful when it doesn't set start_secs
+	DefaultStartSecs = 1
+
+	// MaxStartBackoff caps the wait before a failed start is retried, which doubles with every failure
+	MaxStartBackoff = time.Minute
+)
+
+// ErrPersistentAgentFatal is the error of executions of a persistent agent that failed to start too
+// often in a row; it is not restarted until it is started explicitly
+var ErrPersistentAgentFatal = errors.New("persistent agent is in the fatal state")
+
+var (
+	restartStates = make(map[string]*restartState) // By agent ID, guarded by persistentMutex
+
+	processStateHookMutex sync.Mutex
+	processStateHooks     []func(models.ProcessStateEvent)
+
+	maintenanceCheckMutex sync.Mutex
+	maintenanceCheck      func(config *models.AgentConfiguration) bool
+)
+
+// SetMaintenanceCheck sets how to tell whether an agent is in a maintenance window, during which
+// its persistent process is not restarted after failed starts, its health checks are skipped and
+// no process state events are emitted for it; nil disables maintenance
+func SetMaintenanceCheck(check func(config *models.AgentConfiguration) bool) {
+	maintenanceCheckMutex.Lock()
+	defer maintenanceCheckMutex.Unlock()
+	maintenanceCheck = check
+}
+
+// inMaintenance reports whether an agent is in a maintenance window
+func inMaintenance(config *models.AgentConfiguration) bool {
+	maintenanceCheckMutex.Lock()
+	check := maintenanceCheck
+	maintenanceCheckMutex.Unlock()
+	return check != nil && check(config)
+}
+
+// AddProcessStateHook registers a hook called whenever a persistent agent's process enters the
+// backoff or fatal state. Hooks run on their own goroutine.
+func AddProcessStateHook(hook func(models.ProcessStateEvent)) {
+	processStateHookMutex.Lock()
+	defer processStateHookMutex.Unlock()
+	processStateHooks = append(processStateHooks, hook)
+}
+
+// PersistentProcessStatus returns the state of an agent's persistent process and its failed
+// starts, false when the agent has not started one
+func PersistentProcessStatus(agentID string) (models.ProcessStatus, bool) {
+	persistentMutex.Lock()
+	defer persistentMutex.Unlock()
+
+	state := restartStates[agentID]
+	if state == nil {
+		return models.ProcessStatus{}, false
+	}
+	return state.status(), true
+}
+
+// StartPersistentAgent forgets the failed starts of an agent, taking it out of the backoff or
+// fatal state, and starts its persistent process unless one runs
+func StartPersistentAgent(ctx context.Context, config *models.AgentConfiguration, logger *zap.Logger) (models.ProcessStatus, error) {
+	persistentMutex.Lock()
+	if state := restartStates[config.ID]; state != nil {
+		state.cancelTimer()
+		state.state = models.ProcessStopped
+		state.failures = 0
+		state.lastError = ""
+	}
+	persistentMutex.Unlock()
+
+	_, err := persistentProcessFor(ctx, config, logger)
+	status, _ := PersistentProcessStatus(config.ID)
+	return status, err
+}
+
+// restartState follows the starts of an agent's persistent process under its restart policy: a
+// process that exits before running for start_secs failed to start and is restarted after a
+// backoff, until start_retries failures in a row put the agent in the fatal state
+type restartState struct {
+	state        models.ProcessState
+	failures     int
+	backoffUntil time.Time
+	lastError    string
+	process      *persistentProcess // The latest process started
+	startedAt    time.Time
+	starts       int                 // Processes started, successfully or not
+	timer        *time.Timer         // Marks the process running after start_secs, or restarts it after a backoff
+	hooks        []models.HookResult // Latest run of each lifecycle hook
+}
+
+// status reports the state; persistentMutex must be held
+func (s *restartState) status() models.ProcessStatus {
+	status := models.ProcessStatus{
+		State:               s.state,
+		ConsecutiveFailures: s.failures,
+		LastError:           s.lastError,
+		Restarts:            max(s.starts-1, 0),
+	}
+	if s.process != nil && (s.state == models.ProcessStarting || s.state == models.ProcessRunning || s.state == models.ProcessDegraded) {
+		startedAt := s.startedAt
+		status.PID = s.process.pid
+		status.StartedAt = &startedAt
+	}
+	if s.state == models.ProcessBackoff {
+		backoffUntil := s.backoffUntil
+		status.BackoffUntil = &backoffUntil
+	}
+	status.Hooks = append([]models.HookResult(nil), s.hooks...)
+	return status
+}
+
+// recordHook keeps result as the latest run of its hook; persistentMutex must be held
+func (s *restartState) recordHook(result models.HookResult) {
+	for i := range s.hooks {
+		if s.hooks[i].Hook == result.Hook {
+			s.hooks[i] = result
+			return
+		}
+	}
+	s.hooks = append(s.hooks, result)
+}
+
+// cancelTimer stops the pending timer, if any; persistentMutex must be held
+func (s *restartState) cancelTimer() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// restartStateFor returns the restart state of an agent, creating it; persistentMutex must be held
+func restartStateFor(agentID string) *restartState {
+	state := restartStates[agentID]
+	if state == nil {
+		state = &restartState{state: models.ProcessStopped}
+		restartStates[agentID] = state
+	}
+	return state
+}
+
+// forgetRestartState drops the restart state of an agent; persistentMutex must be held
+func forgetRestartState(agentID string) {
+	if state := restartStates[agentID]; state != nil {
+		state.cancelTimer()
+		delete(restartStates, agentID)
+	}
+}
+
+// startRestartable starts the agent's persistent process and follows it under the agent's restart
+// policy, counting a process that cannot be started as a failed start; persistentMutex must be held
+func startRestartable(registry *ProcessRegistry, config *models.AgentConfiguration, logger *zap.Logger) (*persistentProcess, error) {
+	state := restartStateFor(config.ID)
+	state.cancelTimer()
+	state.starts++
+
+	process, err := startPersistentProcess(registry, config, persistentFingerprint(config), logger)
+	if err != nil {
+		state.startFailed(registry, config, err, logger)
+		return nil, err
+	}
+	persistentProcesses[config.ID] = process
+
+	state.state = models.ProcessStarting
+	state.process = process
+	state.startedAt = time.Now()
+	_, startSecs := startSettings(config)
+	state.timer = time.AfterFunc(startSecs, func() {
+		persistentMutex.Lock()
+		defer persistentMutex.Unlock()
+		if state.process == process && state.state == models.ProcessStarting && process.running() {
+			state.state = models.ProcessRunning
+			// With a post-start hook, the start only succeeds once the hook passed
+			if config.PostStartHook != nil {
+				go runPostStartHook(state, process)
+				return
+			}
+			state.failures = 0
+			state.lastError = ""
+		}
+	})
+	return process, nil
+}
+
+// processExited records the exit of a process once; one that exited on its own before running
+// for start_secs failed to start. persistentMutex must be held.
+func processExited(p *persistentProcess) {
+	state := restartStates[p.config.ID]
+	if state == nil || state.process != p {
+		return
+	}
+	state.process = nil
+	state.cancelTimer()
+
+	_, startSecs := startSettings(p.config)
+	switch {
+	case p.wasStopped():
+		state.state = models.ProcessStopped
+	case state.state == models.ProcessRunning || state.state == models.ProcessDegraded || time.Since(state.startedAt) >= startSecs:
+		state.state = models.ProcessExited
+		state.failures = 0
+	default:
+		state.startFailed(p.registry, p.config, p.exitErr(), p.logger)
+	}
+}
+
+// startFailed counts a failed start, restarting the process after a backoff or, after too many
+// failures in a row, entering the fatal state. During maintenance the process is left exited
+// instead. persistentMutex must be held.
+func (s *restartState) startFailed(registry *ProcessRegistry, config *models.AgentConfiguration, err error, logger *zap.Logger) {
+	retries, _ := startSettings(config)
+	s.failures++
+	s.lastError = ""
+	if err != nil {
+		s.lastError = err.Error()
+	}
+
+	if inMaintenance(config) {
+		s.state = models.ProcessExited
+		logger.Info("persistent agent failed to start during maintenance and is not restarted",
+			zap.String("agent_id", config.ID),
+			zap.Int("consecutive_failures", s.failures),
+			zap.Error(err))
+		return
+	}
+
+	if s.failures >= retries {
+		s.state = models.ProcessFatal
+		logger.Error("persistent agent failed to start too often and will not be restarted",
+			zap.String("agent_id", config.ID),
+			zap.Int("consecutive_failures", s.failures),
+			zap.Error(err))
+		emitProcessState(config.ID, s.status())
+		return
+	}
+
+	backoff := startBackoff(s.failures)
+	s.state = models.ProcessBackoff
+	s.backoffUntil = time.Now().Add(backoff)
+	s.timer = time.AfterFunc(backoff, func() {
+		persistentMutex.Lock()
+		defer persistentMutex.Unlock()
+		// An execution or an explicit start may have started the process meanwhile
+		if restartStates[config.ID] != s || s.state != models.ProcessBackoff || persistentProcesses[config.ID] != nil {
+			return
+		}
+		if inMaintenance(config) {
+			s.state = models.ProcessExited
+			logger.Info("persistent agent is not restarted during maintenance", zap.String("agent_id", config.ID))
+			return
+		}
+		startRestartable(registry, config, logger)
+	})
+	logger.Warn("persistent agent failed to start and is restarted after a backoff",
+		zap.String("agent_id", config.ID),
+		zap.Int("consecutive_failures", s.failures),
+		zap.Duration("backoff", backoff),
+		zap.Error(err))
+	emitProcessState(config.ID, s.status())
+}
+
+// backoffWait returns how long an execution must wait before it may start the agent's process and
+// fails for agents in the fatal state; persistentMutex must be held
+func backoffWait(agentID string) (time.Duration, error) {
+	state := restartStates[agentID]
+	switch {
+	case state == nil:
+		return 0, nil
+	case state.state == models.ProcessFatal:
+		return 0, fmt.Errorf("%w after %d failed starts, start it to clear it: %s", ErrPersistentAgentFatal, state.failures, state.lastError)
+	case state.state == models.ProcessBackoff:
+		return time.Until(state.backoffUntil), nil
+	}
+	return 0, nil
+}
+
+// startSettings returns the agent's start retries and start seconds, defaults filled in
+func startSettings(config *models.AgentConfiguration) (int, time.Duration) {
+	retries, startSecs := DefaultStartRetries, DefaultStartSecs
+	if config.StartRetries > 0 {
+		retries = config.StartRetries
+	}
+	if config.StartSecs > 0 {
+		startSecs = config.StartSecs
+	}
+	return retries, time.Duration(startSecs) * time.Second
+}
+
+// startBackoff returns the wait before retrying after the given number of failed starts in a row:
+// a second after the first, doubling with every further failure
+func startBackoff(failures int) time.Duration {
+	backoff := time.Second
+	for i := 1; i < failures && backoff < MaxStartBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, MaxStartBackoff)
+}
+
+// emitProcessState passes a process state event to the hooks
+func emitProcessState(agentID string, status models.ProcessStatus) {
+	event := models.ProcessStateEvent{
+		Type:    models.ProcessStateEventType,
+		AgentID: agentID,
+		Status:  status,
+		Time:    time.Now().UTC(),
+	}
+
+	processStateHookMutex.Lock()
+	hooks := append([]func(models.ProcessStateEvent){}, processStateHooks...)
+	processStateHookMutex.Unlock()
+	for _, hook := range hooks {
+		go hook(event)
+	}
+}
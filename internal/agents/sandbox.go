@@ -0,0 +1,140 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// SandboxDirEnvVar passes the per-execution sandbox directory to agent processes
+const SandboxDirEnvVar = "SUPERVISOR_SANDBOX_DIR"
+
+// ErrPathEscapesSandbox is returned when a file template resolves outside the agent's sandbox
+var ErrPathEscapesSandbox = errors.New("path escapes the agent sandbox")
+
+var (
+	sandboxMutex   sync.RWMutex
+	sandboxBaseDir = filepath.Join("data", "sandbox")
+)
+
+// templatePlaceholder matches {{name}} placeholders in file templates
+var templatePlaceholder = regexp.MustCompile(`\{\{[^}]*\}\}`)
+
+// SetSandboxBaseDir sets the directory under which agents without an explicit sandbox get one
+func SetSandboxBaseDir(dir string) {
+	sandboxMutex.Lock()
+	defer sandboxMutex.Unlock()
+
+	sandboxBaseDir = dir
+}
+
+// SandboxRoot returns the sandbox root of an agent: its SandboxDir, or a directory named after it under the base dir
+func SandboxRoot(config *models.AgentConfiguration) string {
+	if config.SandboxDir != "" {
+		return config.SandboxDir
+	}
+
+	sandboxMutex.RLock()
+	defer sandboxMutex.RUnlock()
+
+	return filepath.Join(sandboxBaseDir, config.ID)
+}
+
+// ResolveSandboxPath joins name onto root, rejecting absolute names and names that climb out of root
+func ResolveSandboxPath(root, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %q", ErrPathEscapesSandbox, name)
+	}
+	return filepath.Join(root, filepath.Clean(name)), nil
+}
+
+// ValidateFileTemplate checks that a file template cannot escape the sandbox regardless of its placeholder values
+func ValidateFileTemplate(template string) error {
+	if template == "" {
+		return nil
+	}
+	_, err := ResolveSandboxPath(".", templatePlaceholder.ReplaceAllString(template, "x"))
+	return err
+}
+
+// ExecutionSandbox is the private directory of a single execution inside its agent's sandbox root
+type ExecutionSandbox struct {
+	Dir  string
+	keep bool
+	vars map[string]interface{}
+}
+
+// NewExecutionSandbox creates a unique, owner-only directory for one execution of the agent
+func NewExecutionSandbox(config *models.AgentConfiguration) (*ExecutionSandbox, error) {
+	root := SandboxRoot(config)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox root: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(root, "exec-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create execution sandbox: %w", err)
+	}
+
+	return &ExecutionSandbox{
+		Dir:  dir,
+		keep: config.KeepArtifacts,
+		vars: map[string]interface{}{
+			"timestamp":    time.Now().Unix(),
+			"agent_id":     config.ID,
+			"execution_id": filepath.Base(dir),
+		},
+	}, nil
+}
+
+// Path expands template with the execution's variables plus extra and resolves it inside the sandbox
+func (s *ExecutionSandbox) Path(template string, extra map[string]interface{}) (string, error) {
+	vars := make(map[string]interface{}, len(s.vars)+len(extra))
+	for key, value := range s.vars {
+		vars[key] = value
+	}
+	for key, value := range extra {
+		vars[key] = value
+	}
+
+	path, err := ResolveSandboxPath(s.Dir, processTemplate(template, vars))
+	if err != nil {
+		return "", err
+	}
+
+	// Templates may name subdirectories of the sandbox
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	return path, nil
+}
+
+// Cleanup removes the execution directory unless the agent keeps its artifacts
+func (s *ExecutionSandbox) Cleanup() error {
+	if s == nil || s.keep {
+		return nil
+	}
+	return os.RemoveAll(s.Dir)
+}
+
+// usesSandbox reports whether the agent exchanges input or output through files
+func usesSandbox(config *models.AgentConfiguration) bool {
+	return config.InputPattern == models.FilePattern || config.OutputPattern == models.FilePatternOut
+}
+
+// withSandboxEnv adds the sandbox directory to a process environment built by processEnv
+func withSandboxEnv(env []string, sandbox *ExecutionSandbox) []string {
+	if sandbox == nil {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(env, fmt.Sprintf("%s=%s", SandboxDirEnvVar, sandbox.Dir))
+}
@@ -0,0 +1,140 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// ErrSyntheticFailure is the error of a synthetic execution failing on purpose
+var ErrSyntheticFailure = errors.New("synthetic agent failure")
+
+// syntheticExitCode is the exit code reported by a failed synthetic execution
+const syntheticExitCode = 1
+
+// SyntheticAgent implements the IAgent interface without starting a process: each execution
+// sleeps for the configured duration, produces output of the configured size and fails with the
+// configured probability. It lets the queues, pools, history and metrics of the supervisor be
+// benchmarked without the cost of exec'ing real agents.
+type SyntheticAgent struct {
+	config *models.AgentConfiguration
+	logger *zap.Logger
+}
+
+// NewSyntheticAgent creates a new instance of SyntheticAgent
+func NewSyntheticAgent(config *models.AgentConfiguration, logger *zap.Logger) *SyntheticAgent {
+	return &SyntheticAgent{config: config, logger: logger}
+}
+
+// Execute simulates a run of the agent with the given input
+func (sa *SyntheticAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
+	if sa.config == nil {
+		return nil, fmt.Errorf("agent configuration is nil")
+	}
+
+	logger := logging.LoggerFromContext(ctx, sa.logger)
+	result := &models.ExecutionResult{
+		ID:        generateExecutionID(),
+		AgentID:   sa.config.ID,
+		StartTime: time.Now(),
+		Input:     input,
+	}
+
+	settings, err := models.ParseSyntheticSettings(sa.config.Parameters)
+	if err != nil {
+		logger.Error("agent validation failed", zap.Error(err))
+		result.Status = models.FailureStatus
+		result.Error = err.Error()
+		result.EndTime = time.Now()
+		result.SanitizeInput()
+		return result, err
+	}
+
+	ctx, cancel := withAgentTimeout(ctx, sa.config)
+	defer cancel()
+
+	timer := time.NewTimer(syntheticDuration(settings))
+	defer timer.Stop()
+
+	var execErr error
+	select {
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Status = models.TimeoutStatus
+			result.Error = "execution timed out"
+			execErr = fmt.Errorf("execution timed out: %w", ctx.Err())
+		} else {
+			result.Status = models.CancelledStatus
+			result.Error = "execution cancelled"
+			execErr = fmt.Errorf("execution cancelled: %w", ctx.Err())
+		}
+	case <-timer.C:
+		result.SetOutput(bytes.Repeat([]byte("x"), settings.OutputBytes))
+		if settings.FailureRate > 0 && rand.Float64() < settings.FailureRate {
+			result.Status = models.FailureStatus
+			result.ExitCode = syntheticExitCode
+			result.Error = ErrSyntheticFailure.Error()
+			execErr = fmt.Errorf("agent exited with code %d: %w", syntheticExitCode, ErrSyntheticFailure)
+		} else {
+			result.Status = models.SuccessStatus
+		}
+	}
+
+	result.EndTime = time.Now()
+	logger.Debug("synthetic agent execution finished",
+		zap.String("agent_id", sa.config.ID),
+		zap.String("status", string(result.Status)),
+		zap.Duration("duration", result.EndTime.Sub(result.StartTime)))
+
+	result.SanitizeInput()
+	return result, execErr
+}
+
+// syntheticDuration returns how long an execution takes, drawn uniformly from the configured
+// range when it has an upper bound
+func syntheticDuration(settings models.SyntheticSettings) time.Duration {
+	if settings.DurationMax <= settings.Duration {
+		return settings.Duration
+	}
+	return settings.Duration + time.Duration(rand.Int63n(int64(settings.DurationMax-settings.Duration)+1))
+}
+
+// GetID returns the agent's ID
+func (sa *SyntheticAgent) GetID() string {
+	return sa.config.ID
+}
+
+// GetName returns the agent's name
+func (sa *SyntheticAgent) GetName() string {
+	return sa.config.Name
+}
+
+// GetType returns the agent's type
+func (sa *SyntheticAgent) GetType() string {
+	return sa.config.AgentType
+}
+
+// IsReadOnly returns whether the agent is read-only or read-write
+func (sa *SyntheticAgent) IsReadOnly() bool {
+	return sa.config.AccessType == models.ReadOnlyAccessType
+}
+
+// GetConfig returns the agent's configuration
+func (sa *SyntheticAgent) GetConfig() *models.AgentConfiguration {
+	return sa.config
+}
+
+// Validate checks if the agent configuration is valid
+func (sa *SyntheticAgent) Validate() error {
+	if sa.config == nil {
+		return fmt.Errorf("agent configuration is nil")
+	}
+	return sa.config.Validate()
+}
@@ -0,0 +1,168 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// maxHeartbeatLineBytes caps how much of an unterminated line the watchdog keeps while looking for
+// the heartbeat line; longer lines cannot be heartbeats
+const maxHeartbeatLineBytes = 4096
+
+// watchdog stops an agent that shows no sign of life for its max_silence_seconds. Without a
+// heartbeat any output counts as activity; with one, only the heartbeat line on either stream or
+// touching the heartbeat file does.
+type watchdog struct {
+	silence      time.Duration
+	line         []byte
+	file         string
+	lastActivity atomic.Int64 // Unix nanoseconds
+}
+
+// newWatchdog returns the watchdog of an execution of an agent with config whose process runs in
+// dir, or nil when the agent has no max_silence_seconds
+func newWatchdog(config *models.AgentConfiguration, dir string) *watchdog {
+	if config == nil || config.MaxSilenceSeconds <= 0 {
+		return nil
+	}
+
+	w := &watchdog{silence: time.Duration(config.MaxSilenceSeconds) * time.Second}
+	if line := bytes.TrimSpace([]byte(config.HeartbeatLine)); len(line) > 0 {
+		w.line = line
+	}
+	if config.HeartbeatFile != "" {
+		w.file = config.HeartbeatFile
+		if !filepath.IsAbs(w.file) && dir != "" {
+			w.file = filepath.Join(dir, w.file)
+		}
+	}
+	return w
+}
+
+// heartbeat reports whether only heartbeats count as activity
+func (w *watchdog) heartbeat() bool {
+	return w.line != nil || w.file != ""
+}
+
+// touch records activity now
+func (w *watchdog) touch() {
+	w.lastActivity.Store(time.Now().UnixNano())
+}
+
+// stream returns the writer observing one of the agent's output streams, or nil when the stream
+// cannot keep the agent alive
+func (w *watchdog) stream() io.Writer {
+	if w == nil || (w.heartbeat() && w.line == nil) {
+		return nil
+	}
+	return &activityWriter{watchdog: w}
+}
+
+// watch starts the silence clock and returns ctx, cancelled with a *models.HungAgentError once the
+// agent stays silent for too long. The returned cancel function stops the watchdog.
+func (w *watchdog) watch(ctx context.Context) (context.Context, context.CancelFunc) {
+	if w == nil {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	w.touch()
+	go w.run(ctx, cancel)
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// run polls for silence until ctx is done
+func (w *watchdog) run(ctx context.Context, cancel context.CancelCauseFunc) {
+	interval := min(max(w.silence/4, 10*time.Millisecond), time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var fileModTime time.Time
+	if w.file != "" {
+		if info, err := os.Stat(w.file); err == nil {
+			fileModTime = info.ModTime()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if w.file != "" {
+			if info, err := os.Stat(w.file); err == nil && !info.ModTime().Equal(fileModTime) {
+				fileModTime = info.ModTime()
+				w.touch()
+			}
+		}
+
+		lastActivity := time.Unix(0, w.lastActivity.Load())
+		if time.Since(lastActivity) >= w.silence {
+			cancel(&models.HungAgentError{Silence: w.silence, LastActivity: lastActivity, Heartbeat: w.heartbeat()})
+			return
+		}
+	}
+}
+
+// hungCause returns the error the watchdog cancelled ctx with, if it did
+func hungCause(ctx context.Context) *models.HungAgentError {
+	if hung, ok := context.Cause(ctx).(*models.HungAgentError); ok {
+		return hung
+	}
+	return nil
+}
+
+// activityWriter records an output stream's activity with its watchdog. With a heartbeat line,
+// only complete lines equal to it count.
+type activityWriter struct {
+	watchdog   *watchdog
+	partial    []byte
+	discarding bool // Whether the current line outgrew maxHeartbeatLineBytes
+}
+
+// Write observes p and never fails
+func (w *activityWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.watchdog.line == nil {
+		w.watchdog.touch()
+		return len(p), nil
+	}
+
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := data[:i]
+		if len(w.partial) > 0 {
+			line = append(w.partial, line...)
+			w.partial = w.partial[:0]
+		}
+		if !w.discarding && bytes.Equal(bytes.TrimSpace(line), w.watchdog.line) {
+			w.watchdog.touch()
+		}
+		w.discarding = false
+		data = data[i+1:]
+	}
+	switch {
+	case w.discarding:
+	case len(w.partial)+len(data) <= maxHeartbeatLineBytes:
+		w.partial = append(w.partial, data...)
+	default:
+		w.partial = w.partial[:0]
+		w.discarding = true
+	}
+	return len(p), nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitRequestBody caps the request body at limit bytes, a limit of 0 or less leaving it uncapped.
+// A larger body is rejected with 413 PAYLOAD_TOO_LARGE. Bodies of unknown length, such as chunked
+// ones, are read up front, so handlers decoding the body see all of it or none. Returns false when
+// the request was rejected.
+func LimitRequestBody(c *gin.Context, limit int64) bool {
+	if !StreamRequestBody(c, limit) {
+		return false
+	}
+	if limit <= 0 || c.Request.ContentLength >= 0 {
+		return true
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		if IsBodyTooLarge(err) {
+			RespondBodyTooLarge(c, limit)
+		} else {
+			RespondError(c, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body: "+err.Error())
+		}
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	return true
+}
+
+// StreamRequestBody caps the request body at limit bytes without reading it, for handlers that
+// stream large bodies; reading past the limit fails with an error IsBodyTooLarge reports. A body
+// whose Content-Length exceeds the limit is rejected with 413 PAYLOAD_TOO_LARGE at once. Returns
+// false when the request was rejected.
+func StreamRequestBody(c *gin.Context, limit int64) bool {
+	if limit <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return true
+	}
+	if c.Request.ContentLength > limit {
+		RespondBodyTooLarge(c, limit)
+		return false
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	return true
+}
+
+// IsBodyTooLarge reports whether err comes from reading past the limit of a request body
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// RespondBodyTooLarge aborts the request with 413 PAYLOAD_TOO_LARGE for a body over limit bytes
+func RespondBodyTooLarge(c *gin.Context, limit int64) {
+	RespondErrorWithDetails(c, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+		fmt.Sprintf("Request body too large: max size is %d bytes", limit),
+		map[string]interface{}{"max_bytes": limit})
+}
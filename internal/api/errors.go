@@ -0,0 +1,171 @@
+// Package api holds what the REST handlers and middlewares share, such as the error envelope
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode is a machine-readable error code returned in the error envelope
+type ErrorCode string
+
+const (
+	CodeInvalidRequest       ErrorCode = "INVALID_REQUEST"
+	CodeValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	CodeUnauthorized         ErrorCode = "UNAUTHORIZED"
+	CodeForbidden            ErrorCode = "FORBIDDEN"
+	CodeAgentNotFound        ErrorCode = "AGENT_NOT_FOUND"
+	CodeAgentConflict        ErrorCode = "AGENT_CONFLICT"
+	CodeAgentDisabled        ErrorCode = "AGENT_DISABLED"
+	CodeAgentDeleted         ErrorCode = "AGENT_DELETED"
+	CodeAgentInUse           ErrorCode = "AGENT_IN_USE"
+	CodeTemplateNotFound     ErrorCode = "TEMPLATE_NOT_FOUND"
+	CodeTemplateConflict     ErrorCode = "TEMPLATE_CONFLICT"
+	CodeTemplateInUse        ErrorCode = "TEMPLATE_IN_USE"
+	CodeGroupNotFound        ErrorCode = "GROUP_NOT_FOUND"
+	CodeGroupConflict        ErrorCode = "GROUP_CONFLICT"
+	CodeTaskNotFound         ErrorCode = "TASK_NOT_FOUND"
+	CodeTaskConflict         ErrorCode = "TASK_CONFLICT"
+	CodeExecutionNotFound    ErrorCode = "EXECUTION_NOT_FOUND"
+	CodeExecutionConflict    ErrorCode = "EXECUTION_CONFLICT"
+	CodeArtifactNotFound     ErrorCode = "ARTIFACT_NOT_FOUND"
+	CodePipelineNotFound     ErrorCode = "PIPELINE_NOT_FOUND"
+	CodePipelineConflict     ErrorCode = "PIPELINE_CONFLICT"
+	CodeQuotaExceeded        ErrorCode = "QUOTA_EXCEEDED"
+	CodeRateLimited          ErrorCode = "RATE_LIMITED"
+	CodePayloadTooLarge      ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	CodeOperationInProgress  ErrorCode = "OPERATION_IN_PROGRESS"
+	CodeInvalidTransition    ErrorCode = "INVALID_STATE_TRANSITION"
+	CodeConfirmationRequired ErrorCode = "CONFIRMATION_REQUIRED"
+	CodeInputInvalid         ErrorCode = "INPUT_INVALID"
+	CodeConfigUnavailable    ErrorCode = "CONFIG_UNAVAILABLE"
+	CodeConfigInvalid        ErrorCode = "CONFIG_INVALID"
+	CodeAuditUnavailable     ErrorCode = "AUDIT_UNAVAILABLE"
+	CodeFaultRuleNotFound    ErrorCode = "FAULT_RULE_NOT_FOUND"
+	CodeCalendarNotFound     ErrorCode = "CALENDAR_NOT_FOUND"
+	CodeCalendarConflict     ErrorCode = "CALENDAR_CONFLICT"
+	CodeCalendarInUse        ErrorCode = "CALENDAR_IN_USE"
+	CodeAttachConflict       ErrorCode = "ATTACH_CONFLICT"
+	CodeHookFailed           ErrorCode = "HOOK_FAILED"
+	CodeUnsupportedProtocol  ErrorCode = "UNSUPPORTED_PROTOCOL_VERSION"
+	CodeNoLeader             ErrorCode = "NO_LEADER"
+	CodeSchedulerStopped     ErrorCode = "SCHEDULER_STOPPED"
+	CodeConversationNotFound ErrorCode = "CONVERSATION_NOT_FOUND"
+	CodeInputURLNotAllowed   ErrorCode = "INPUT_URL_NOT_ALLOWED"
+	CodeInputFetchFailed     ErrorCode = "INPUT_FETCH_FAILED"
+	CodeInternalError        ErrorCode = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the body of every 4xx and 5xx REST response
+type ErrorResponse struct {
+	Success bool                   `json:"success"`
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"error"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// serviceErrors maps service-layer sentinel errors to their status and code, checked in order
+var serviceErrors = []struct {
+	err    error
+	status int
+	code   ErrorCode
+}{
+	{models.ErrInvalidTask, http.StatusBadRequest, CodeValidationFailed},
+	{models.ErrTaskNotFound, http.StatusNotFound, CodeTaskNotFound},
+	{models.ErrTaskConflict, http.StatusConflict, CodeTaskConflict},
+	{models.ErrExecutionNotFound, http.StatusNotFound, CodeExecutionNotFound},
+	{models.ErrExecutionConflict, http.StatusConflict, CodeExecutionConflict},
+	{models.ErrArtifactNotFound, http.StatusNotFound, CodeArtifactNotFound},
+	{models.ErrAgentNotFound, http.StatusNotFound, CodeAgentNotFound},
+	{models.ErrAgentConflict, http.StatusConflict, CodeAgentConflict},
+	{models.ErrAgentDisabled, http.StatusForbidden, CodeAgentDisabled},
+	{models.ErrAgentDeleted, http.StatusGone, CodeAgentDeleted},
+	{models.ErrAgentInUse, http.StatusConflict, CodeAgentInUse},
+	{models.ErrInvalidAgent, http.StatusBadRequest, CodeValidationFailed},
+	{models.ErrTemplateNotFound, http.StatusNotFound, CodeTemplateNotFound},
+	{models.ErrTemplateConflict, http.StatusConflict, CodeTemplateConflict},
+	{models.ErrTemplateInUse, http.StatusConflict, CodeTemplateInUse},
+	{models.ErrGroupNotFound, http.StatusNotFound, CodeGroupNotFound},
+	{models.ErrGroupConflict, http.StatusConflict, CodeGroupConflict},
+	{models.ErrPipelineNotFound, http.StatusNotFound, CodePipelineNotFound},
+	{models.ErrPipelineConflict, http.StatusConflict, CodePipelineConflict},
+	{models.ErrExecutionQuotaExceeded, http.StatusTooManyRequests, CodeQuotaExceeded},
+	{models.ErrOperationInProgress, http.StatusConflict, CodeOperationInProgress},
+	{models.ErrInvalidTransition, http.StatusConflict, CodeInvalidTransition},
+	{models.ErrConfirmationRequired, http.StatusPreconditionRequired, CodeConfirmationRequired},
+	{models.ErrInvalidInput, http.StatusUnprocessableEntity, CodeInputInvalid},
+	{models.ErrFaultRuleNotFound, http.StatusNotFound, CodeFaultRuleNotFound},
+	{models.ErrCalendarNotFound, http.StatusNotFound, CodeCalendarNotFound},
+	{models.ErrCalendarConflict, http.StatusConflict, CodeCalendarConflict},
+	{models.ErrCalendarInUse, http.StatusConflict, CodeCalendarInUse},
+	{models.ErrAttachConflict, http.StatusConflict, CodeAttachConflict},
+	{models.ErrHookFailed, http.StatusConflict, CodeHookFailed},
+	{models.ErrSchedulerStopped, http.StatusServiceUnavailable, CodeSchedulerStopped},
+	{models.ErrConversationNotFound, http.StatusNotFound, CodeConversationNotFound},
+	{models.ErrInputURLNotAllowed, http.StatusForbidden, CodeInputURLNotAllowed},
+	{models.ErrInputFetchFailed, http.StatusBadGateway, CodeInputFetchFailed},
+}
+
+// RespondError aborts the request with an error envelope
+func RespondError(c *gin.Context, status int, code ErrorCode, message string) {
+	RespondErrorWithDetails(c, status, code, message, nil)
+}
+
+// RespondErrorWithDetails aborts the request with an error envelope carrying extra details
+func RespondErrorWithDetails(c *gin.Context, status int, code ErrorCode, message string, details map[string]interface{}) {
+	c.AbortWithStatusJSON(status, ErrorResponse{
+		Success: false,
+		Code:    code,
+		Message: message,
+		Details: details,
+	})
+}
+
+// RespondServiceError aborts the request with the status and code matching a service error. Errors
+// that match no known kind are reported as internal errors with fallbackMessage, hiding their text.
+// The field errors of models.ValidationErrors are listed in the details under "errors", and the
+// token and agents of an operation that needs confirming under "confirmation_token" and "agents".
+func RespondServiceError(c *gin.Context, err error, fallbackMessage string) {
+	status, code := ClassifyError(err)
+	if code == CodeInternalError {
+		RespondError(c, status, code, fallbackMessage)
+		return
+	}
+
+	var fieldErrs models.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		RespondErrorWithDetails(c, status, code, err.Error(), map[string]interface{}{"errors": fieldErrs})
+		return
+	}
+	var confirmation *models.ConfirmationRequiredError
+	if errors.As(err, &confirmation) {
+		RespondErrorWithDetails(c, status, code, err.Error(), map[string]interface{}{
+			"confirmation_token": confirmation.Token,
+			"expires_at":         confirmation.ExpiresAt,
+			"agents":             confirmation.Agents,
+		})
+		return
+	}
+	RespondError(c, status, code, err.Error())
+}
+
+// ClassifyError returns the HTTP status and error code for a service error
+func ClassifyError(err error) (int, ErrorCode) {
+	for _, known := range serviceErrors {
+		if errors.Is(err, known.err) {
+			return known.status, known.code
+		}
+	}
+
+	var validationErr models.ValidationError
+	var fieldErrs models.ValidationErrors
+	if errors.As(err, &validationErr) || errors.As(err, &fieldErrs) {
+		return http.StatusBadRequest, CodeValidationFailed
+	}
+
+	return http.StatusInternalServerError, CodeInternalError
+}
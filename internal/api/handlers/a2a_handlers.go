@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -58,13 +61,20 @@ func (ah *A2AHandlers) HandleSendMessage(c *gin.Context) {
 	var requestData map[string]interface{}
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		ah.logger.Error("failed to parse A2A request body", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid JSON in request body",
-			"code":  -32700, // Parse error according to A2A spec
-		})
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid JSON in request body")
 		return
 	}
 
+	// A message in a protocol version the supervisor does not speak is rejected before it is processed
+	if version, exists := requestData["protocol_version"]; exists {
+		requested, _ := version.(string)
+		if err := ah.config.CheckProtocolVersion(requested); err != nil {
+			api.RespondErrorWithDetails(c, http.StatusBadRequest, api.CodeUnsupportedProtocol, "Unsupported protocol version "+requested,
+				map[string]interface{}{"supported_versions": ah.config.SupportedVersions()})
+			return
+		}
+	}
+
 	// In a real implementation, you would process the request using the A2A service
 	// and return an appropriate A2A response
 	response := gin.H{
@@ -115,12 +125,17 @@ func (ah *A2AHandlers) GetAgentCard(c *gin.Context) {
 		zap.String("agent_id", agentID),
 		zap.String("path", c.Request.URL.Path))
 
-	// In a real implementation, you would get the agent details and return them in A2A agent card format
-	// For now, return a placeholder
+	agent, err := ah.a2aService.GetAgentService().GetAgent(agentID)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent")
+		return
+	}
+
 	agentCard := gin.H{
-		"agentId": agentID,
-		"name":    "Sample Agent",
-		"version": "1.0.0",
+		"agentId":     agentID,
+		"name":        agent.Name,
+		"description": agent.Description,
+		"version":     "1.0.0",
 		"capabilities": gin.H{
 			"supportedMethods":      []string{"execute-agent", "status", "list-agents"},
 			"streamingSupport":      true,
@@ -137,11 +152,40 @@ func (ah *A2AHandlers) GetAgentCard(c *gin.Context) {
 			"required": true,
 			"methods":  []string{"bearer_token"},
 		},
+		"skills": []gin.H{agentSkill(agent)},
 	}
 
 	c.JSON(http.StatusOK, agentCard)
 }
 
+// agentSkill describes how to call an agent as the skill of its agent card. Examples are execute
+// request bodies consumers can send as they are; inputSchema extends the A2A skill with the JSON
+// Schema of their parameters.
+func agentSkill(agent *models.AgentConfiguration) gin.H {
+	examples := make([]string, 0, len(agent.Examples))
+	for _, example := range agent.Examples {
+		body, err := json.Marshal(AgentExecuteRequest{Input: example.Input, Parameters: example.Parameters})
+		if err != nil {
+			continue
+		}
+		examples = append(examples, string(body))
+	}
+
+	skill := gin.H{
+		"id":          agent.ID,
+		"name":        agent.Name,
+		"description": agent.Description,
+		"tags":        []string{agent.AgentType, string(agent.AccessType)},
+		"examples":    examples,
+		"inputModes":  []string{"text/plain", "application/json"},
+		"outputModes": []string{"text/plain"},
+	}
+	if agent.InputSchema != nil {
+		skill["inputSchema"] = agent.InputSchema
+	}
+	return skill
+}
+
 // ListTasks returns a list of tasks for an agent
 func (ah *A2AHandlers) ListTasks(c *gin.Context) {
 	agentID := c.Param("agentId")
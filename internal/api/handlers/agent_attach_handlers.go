@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// Channels of GET /api/v1/agents/:agentId/attach. Every binary WebSocket message starts with the
+// byte of its channel, followed by its data.
+const (
+	AttachChannelStdin  byte = 0 // Client to server: input for the process's stdin
+	AttachChannelStdout byte = 1 // Server to client: output the process wrote to stdout
+	AttachChannelStderr byte = 2 // Server to client: output the process wrote to stderr
+	AttachChannelStatus byte = 3 // Server to client: why the server ended the session, as text, before closing
+)
+
+// attachWriteTimeout is how long a message to an attached client may take before the session ends
+const attachWriteTimeout = 10 * time.Second
+
+// AttachAgent attaches the requesting WebSocket to the stdio of a persistent agent's running
+// process: input on the stdin channel is written to the process's stdin and its stdout and stderr
+// are streamed back as they are written. Closing the WebSocket detaches without stopping the
+// process. Requests that are not WebSocket upgrades get 400, those from foreign origins 403 and
+// agents with an attached session 409.
+func (aeh *AgentExecutionHandlers) AttachAgent(c *gin.Context) {
+	agentID := c.Param("agentId")
+	logger := logging.LoggerFromContext(c.Request.Context(), aeh.logger)
+
+	if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "attaching to an agent requires a WebSocket upgrade")
+		return
+	}
+	if origin := c.GetHeader("Origin"); !aeh.attachOriginAllowed(origin, c.Request.Host) {
+		logger.Warn("rejected attach from a foreign origin",
+			zap.String("agent_id", agentID),
+			zap.String("origin", origin))
+		api.RespondError(c, http.StatusForbidden, api.CodeForbidden, "origin "+origin+" may not attach to agents")
+		return
+	}
+
+	session, err := aeh.coordinator.AttachAgent(agentID)
+	if err != nil {
+		logger.Warn("failed to attach to agent",
+			zap.String("agent_id", agentID),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to attach to agent")
+		return
+	}
+	defer session.Detach()
+
+	server := websocket.Server{
+		// The origin was checked above
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			streamAttachSession(ws, session)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// attachOriginAllowed reports whether a WebSocket upgrade from origin may attach: browsers cannot
+// be stopped by CORS from opening WebSockets, so any site a user visits could otherwise attach with
+// the user's access. Clients sending no Origin, pages of the supervisor's own host and origins the
+// CORS settings list outright are allowed.
+func (aeh *AgentExecutionHandlers) attachOriginAllowed(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+	if parsed, err := url.Parse(origin); err == nil && strings.EqualFold(parsed.Host, host) {
+		return true
+	}
+	return aeh.cors != nil && aeh.cors.ListsOrigin(origin)
+}
+
+// streamAttachSession relays a WebSocket and an attach session until the client goes away, which
+// detaches, or the process exits, which is reported on the status channel
+func streamAttachSession(ws *websocket.Conn, session *agents.AttachSession) {
+	go func() {
+		defer session.Detach()
+		for {
+			var message []byte
+			if err := websocket.Message.Receive(ws, &message); err != nil {
+				return
+			}
+			if len(message) < 2 || message[0] != AttachChannelStdin {
+				continue
+			}
+			if _, err := session.Write(message[1:]); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(channel byte, data []byte) bool {
+		ws.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+		return websocket.Message.Send(ws, append([]byte{channel}, data...)) == nil
+	}
+	sendOutput := func(output agents.AttachOutput) bool {
+		channel := AttachChannelStdout
+		if output.Stream == agents.StderrStream {
+			channel = AttachChannelStderr
+		}
+		return send(channel, output.Data)
+	}
+
+	for {
+		select {
+		case output := <-session.Output():
+			if !sendOutput(output) {
+				return
+			}
+		case <-session.Exited():
+			// The process's output is all queued once it exited
+			for drained := false; !drained; {
+				select {
+				case output := <-session.Output():
+					if !sendOutput(output) {
+						return
+					}
+				default:
+					drained = true
+				}
+			}
+			send(AttachChannelStatus, []byte(session.ExitErr().Error()))
+			return
+		case <-session.Detached():
+			return
+		}
+	}
+}
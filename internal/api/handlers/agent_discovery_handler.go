@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/algonius/algonius-supervisor/internal/api"
 	"github.com/algonius/algonius-supervisor/internal/services"
 	"github.com/algonius/algonius-supervisor/internal/a2a"
 
@@ -45,9 +46,7 @@ func (adh *AgentDiscoveryHandlers) ListAgents(c *gin.Context) {
 	agents, err := adh.agentService.ListAgents()
 	if err != nil {
 		adh.logger.Error("failed to list agents", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to list agents",
-		})
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to list agents")
 		return
 	}
 
@@ -83,16 +82,14 @@ func (adh *AgentDiscoveryHandlers) GetAgent(c *gin.Context) {
 		adh.logger.Error("agent not found", 
 			zap.String("agent_id", agentID), 
 			zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Agent not found",
-			"code": -32001, // A2A agent not found error code
-		})
+		api.RespondServiceError(c, err, "Failed to get agent")
 		return
 	}
 
 	response := gin.H{
 		"id":                    agent.ID,
 		"name":                  agent.Name,
+		"description":           agent.Description,
 		"agent_type":            agent.AgentType,
 		"access_type":           string(agent.AccessType),
 		"max_concurrent":        agent.MaxConcurrentExecutions,
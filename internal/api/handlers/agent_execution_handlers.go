@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Headers of idempotent execute requests
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed" // Set to "true" when a repeated key returned an earlier execution
+)
+
+// TriggerTypeHeader lets interactive clients such as supervisorctl mark their executions as manual
+// rather than api
+const TriggerTypeHeader = "X-Trigger-Type"
+
+// AgentExecutionHandlers handles REST requests that run agents
+type AgentExecutionHandlers struct {
+	coordinator       *services.ExecutionCoordinator
+	logger            *zap.Logger
+	heartbeatInterval time.Duration                // Between heartbeats of quiet execution streams
+	uploadDir         string                       // Where uploaded input files are spooled, the system temp directory when empty
+	maxUploadBytes    int64                        // Largest upload accepted, 0 for no limit
+	maintenance       *services.MaintenanceService // Agents in maintenance still run, with a warning
+	cors              *middleware.CORS             // Origins besides the supervisor's own that may attach
+}
+
+// AgentExecuteRequest is the request body of POST /api/v1/agents/:agentId/execute
+type AgentExecuteRequest struct {
+	Input          string                 `json:"input"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`  // Passed as --name value arguments
+	WorkingDir     string                 `json:"working_dir,omitempty"` // Absolute directory overriding the agent's
+	Env            map[string]string      `json:"env,omitempty"`         // Added to the agent's environment
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"`
+	Async          bool                   `json:"async,omitempty"` // Return at once with the execution ID to poll
+	Labels         map[string]string      `json:"labels,omitempty"`
+	NoCache        bool                   `json:"no_cache,omitempty"`
+	OutputEncoding models.OutputEncoding  `json:"output_encoding,omitempty"` // text, json or base64; defaults to the agent's
+	QueueBehavior  services.QueueBehavior `json:"queue_behavior,omitempty"`  // wait (the default) or return_position to return at once when the agent is busy
+
+	// Binary input handed to the agent as a file, sent base64-encoded or as a URL the supervisor
+	// fetches; at most one of the two. File-pattern agents find it at their input file template,
+	// others at $SUPERVISOR_INPUT_FILE.
+	InputBase64      string `json:"input_base64,omitempty"`
+	InputURL         string `json:"input_url,omitempty"`
+	InputContentType string `json:"input_content_type,omitempty"` // Taken from the fetched response when empty
+}
+
+// AgentExecuteAccepted is the response to an asynchronous execute request, or to one that queued
+// with queue_behavior return_position
+type AgentExecuteAccepted struct {
+	ExecutionID     string `json:"execution_id"`
+	AgentID         string `json:"agent_id"`
+	State           string `json:"state"`
+	Location        string `json:"location"`
+	Deduplicated    bool   `json:"deduplicated,omitempty"`      // The idempotency key was already used; no new execution started
+	QueuePosition   int    `json:"queue_position,omitempty"`    // Place in the agent's queue, 1 runs next
+	EstimatedWaitMs int64  `json:"estimated_wait_ms,omitempty"` // From the agent's recent average duration
+}
+
+// ReplayExecutionRequest is the optional request body of POST /api/v1/executions/:executionId/replay.
+// Fields left out keep the replayed execution's values; parameters and env entries are merged over
+// the original's.
+type ReplayExecutionRequest struct {
+	Input          *string                `json:"input,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	WorkingDir     *string                `json:"working_dir,omitempty"`
+	Env            map[string]string      `json:"env,omitempty"`
+	TimeoutSeconds *int                   `json:"timeout_seconds,omitempty"`
+	OutputEncoding models.OutputEncoding  `json:"output_encoding,omitempty"`
+	Async          bool                   `json:"async,omitempty"` // Return at once with the replay's execution ID to poll
+}
+
+// ReplayExecutionResponse links a replay to the execution it replays
+type ReplayExecutionResponse struct {
+	ExecutionID string                  `json:"execution_id"`
+	ReplayOf    string                  `json:"replay_of"`
+	State       string                  `json:"state"`
+	Location    string                  `json:"location"`
+	Result      *models.ExecutionResult `json:"result,omitempty"`   // The replay's result, unless async was set
+	Warnings    []string                `json:"warnings,omitempty"` // How the replay's environment differs from the replayed execution's, such as a changed executable
+}
+
+// NewAgentExecutionHandlers creates a new instance of AgentExecutionHandlers
+func NewAgentExecutionHandlers(coordinator *services.ExecutionCoordinator, logger *zap.Logger) *AgentExecutionHandlers {
+	return &AgentExecutionHandlers{
+		coordinator:       coordinator,
+		logger:            logger,
+		heartbeatInterval: DefaultStreamHeartbeatInterval,
+	}
+}
+
+// SetMaintenanceService sets the maintenance windows that manual operations warn about
+func (aeh *AgentExecutionHandlers) SetMaintenanceService(maintenance *services.MaintenanceService) {
+	aeh.maintenance = maintenance
+}
+
+// SetCORS sets the CORS settings whose listed origins browsers may attach to agents from
+func (aeh *AgentExecutionHandlers) SetCORS(cors *middleware.CORS) {
+	aeh.cors = cors
+}
+
+// RegisterAgentExecutionRoutes registers the agent execution routes. The lifecycle routes also
+// accept a group:<name> target, which operates on the members of the agent group.
+func (aeh *AgentExecutionHandlers) RegisterAgentExecutionRoutes(router gin.IRouter) {
+	agentGroup := router.Group("/agents")
+
+	agentGroup.POST("/:agentId/execute", aeh.ExecuteAgent)
+	agentGroup.POST("/:agentId/execute/stream", aeh.StreamExecuteAgent)
+	agentGroup.POST("/:agentId/execute/upload", aeh.UploadExecuteAgent)
+	agentGroup.POST("/:agentId/disable", aeh.DisableAgent)
+	agentGroup.POST("/:agentId/enable", aeh.EnableAgent)
+	agentGroup.POST("/:agentId/restart", aeh.RestartAgent)
+	agentGroup.POST("/:agentId/start", aeh.StartAgent)
+	agentGroup.GET("/:agentId/attach", aeh.AttachAgent)
+	agentGroup.POST("/:agentId/cancel-all", aeh.CancelAllExecutions)
+	agentGroup.GET("/:agentId/operations/current", aeh.GetCurrentOperation)
+
+	router.POST("/executions/:executionId/replay", aeh.ReplayExecution)
+}
+
+// ReplayExecution runs a past execution again with the inputs it recorded, changed by the fields of
+// the request body. Without async it waits for the replay and includes its result.
+func (aeh *AgentExecutionHandlers) ReplayExecution(c *gin.Context) {
+	executionID := c.Param("executionId")
+	logger := logging.LoggerFromContext(c.Request.Context(), aeh.logger)
+
+	var requestData ReplayExecutionRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil && !errors.Is(err, io.EOF) {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	triggerType, err := restTriggerType(c)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+
+	overrides := services.ReplayOverrides{
+		Input:          requestData.Input,
+		Parameters:     requestData.Parameters,
+		Env:            requestData.Env,
+		WorkingDir:     requestData.WorkingDir,
+		TimeoutSeconds: requestData.TimeoutSeconds,
+		OutputEncoding: requestData.OutputEncoding,
+	}
+	execution, warnings, err := aeh.coordinator.Replay(triggerContext(c, triggerType), executionID, overrides, requestData.Async)
+	if execution == nil {
+		logger.Warn("rejected replay request", zap.String("execution_id", executionID), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to replay execution")
+		return
+	}
+	logging.SetExecutionID(c, execution.ID)
+
+	location := "/api/v1/executions/" + execution.ID
+	c.Header("Location", location)
+	response := ReplayExecutionResponse{
+		ExecutionID: execution.ID,
+		ReplayOf:    executionID,
+		State:       string(execution.State),
+		Location:    location,
+		Warnings:    warnings,
+	}
+	if requestData.Async {
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	if result, err := aeh.coordinator.ExecutionService().GetExecutionResult(execution.ID); err == nil {
+		encoded := result.Encoded()
+		response.Result = &encoded
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DisableAgent stops an agent from accepting new executions; in-flight executions finish unless
+// cancel_active is set
+func (aeh *AgentExecutionHandlers) DisableAgent(c *gin.Context) {
+	cancelActive, _ := strconv.ParseBool(c.Query("cancel_active"))
+	aeh.setAgentEnabled(c, false, cancelActive)
+}
+
+// EnableAgent lets a disabled agent accept executions again
+func (aeh *AgentExecutionHandlers) EnableAgent(c *gin.Context) {
+	aeh.setAgentEnabled(c, true, false)
+}
+
+// RestartAgent cancels an agent's in-flight executions, waits for them to exit and enables the agent
+func (aeh *AgentExecutionHandlers) RestartAgent(c *gin.Context) {
+	agentID := c.Param("agentId")
+	if aeh.planOperation(c, agentID, models.AgentActionRestart) || aeh.batchOperation(c, agentID, models.AgentActionRestart, false) {
+		return
+	}
+
+	warnMaintenance(c, aeh.maintenance, agentID, "restart", aeh.logger)
+	result, err := aeh.coordinator.RestartAgent(agentID, waitForOperation(c), callerID(c))
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), aeh.logger).Warn("failed to restart agent",
+			zap.String("agent_id", agentID),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to restart agent")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// StartAgent starts a persistent agent's process, taking the agent out of the backoff or fatal state
+func (aeh *AgentExecutionHandlers) StartAgent(c *gin.Context) {
+	agentID := c.Param("agentId")
+	if aeh.planOperation(c, agentID, models.AgentActionStart) || aeh.batchOperation(c, agentID, models.AgentActionStart, false) {
+		return
+	}
+
+	warnMaintenance(c, aeh.maintenance, agentID, "start", aeh.logger)
+	status, err := aeh.coordinator.StartAgent(agentID, waitForOperation(c))
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), aeh.logger).Warn("failed to start agent",
+			zap.String("agent_id", agentID),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to start agent")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// CancelAllExecutions cancels every queued, starting and running execution of an agent and reports
+// the outcome per execution; the agent stays enabled
+func (aeh *AgentExecutionHandlers) CancelAllExecutions(c *gin.Context) {
+	agentID := c.Param("agentId")
+
+	result, err := aeh.coordinator.CancelAgentExecutions(agentID, callerID(c))
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), aeh.logger).Warn("failed to cancel executions of agent",
+			zap.String("agent_id", agentID),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to cancel executions of agent")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// batchOperation applies a lifecycle action to the members of the agent group a group:<name> target
+// names, in dependency order, or to the agents an agent pattern such as * or prefix:payments-
+// matches; false when the target names a single agent. Protected agents are left out unless force
+// is set, and operations on many agents answer 428 with a token to resend as confirm.
+func (aeh *AgentExecutionHandlers) batchOperation(c *gin.Context, target string, action models.TaskAction, cancelActive bool) bool {
+	group, isGroup := models.GroupTarget(target)
+	if _, isPattern := models.PatternTarget(target); !isGroup && !isPattern {
+		return false
+	}
+
+	force, _ := strconv.ParseBool(c.Query("force"))
+	options := services.BatchOptions{
+		CancelActive: cancelActive,
+		Wait:         waitForOperation(c),
+		Force:        force,
+		Confirmation: c.Query("confirm"),
+		RequestedBy:  callerID(c),
+	}
+	var result *models.GroupOperationResult
+	var err error
+	if isGroup {
+		result, err = aeh.coordinator.GroupOperation(group, action, options)
+	} else {
+		result, err = aeh.coordinator.PatternOperation(target, action, options)
+	}
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), aeh.logger).Warn("failed to operate on several agents",
+			zap.String("target", target),
+			zap.String("action", string(action)),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to operate on "+target)
+		return true
+	}
+
+	c.JSON(http.StatusOK, result)
+	return true
+}
+
+// planOperation answers a lifecycle request with dry_run=true with what the action would do, an
+// OperationResult for an agent or a BatchOperationResult for a group or pattern, without performing
+// it; false when the request is not a dry run. Failed preconditions are reported in the result.
+func (aeh *AgentExecutionHandlers) planOperation(c *gin.Context, target string, action models.TaskAction) bool {
+	dryRun, ok := boolQuery(c, "dry_run")
+	if !ok {
+		return true
+	}
+	if !dryRun {
+		return false
+	}
+
+	_, isGroup := models.GroupTarget(target)
+	if _, isPattern := models.PatternTarget(target); !isGroup && !isPattern {
+		c.JSON(http.StatusOK, aeh.coordinator.PlanAgentOperation(target, action))
+		return true
+	}
+
+	force, _ := strconv.ParseBool(c.Query("force"))
+	result, err := aeh.coordinator.PlanBatchOperation(target, action, force)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to plan operation on "+target)
+		return true
+	}
+	c.JSON(http.StatusOK, result)
+	return true
+}
+
+// GetCurrentOperation returns the lifecycle operation in progress on an agent, or 204 when there is none
+func (aeh *AgentExecutionHandlers) GetCurrentOperation(c *gin.Context) {
+	operation, err := aeh.coordinator.CurrentAgentOperation(c.Param("agentId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get current agent operation")
+		return
+	}
+	if operation == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, operation)
+}
+
+// waitForOperation reports whether a lifecycle request asked to wait for a conflicting operation
+// instead of failing with 409
+func waitForOperation(c *gin.Context) bool {
+	wait, _ := strconv.ParseBool(c.Query("wait"))
+	return wait
+}
+
+// setAgentEnabled applies the agent's new enabled state and reports its in-flight executions
+func (aeh *AgentExecutionHandlers) setAgentEnabled(c *gin.Context, enabled, cancelActive bool) {
+	agentID := c.Param("agentId")
+	action := models.AgentActionDisable
+	if enabled {
+		action = models.AgentActionEnable
+	}
+	if aeh.planOperation(c, agentID, action) || aeh.batchOperation(c, agentID, action, cancelActive) {
+		return
+	}
+
+	result, err := aeh.coordinator.SetAgentEnabled(agentID, enabled, cancelActive, waitForOperation(c), callerID(c))
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), aeh.logger).Warn("failed to change agent enabled state",
+			zap.String("agent_id", agentID),
+			zap.Bool("enabled", enabled),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to change agent enabled state")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ExecuteAgent runs an agent and returns its result, or with async returns the execution ID to poll
+func (aeh *AgentExecutionHandlers) ExecuteAgent(c *gin.Context) {
+	agentID := c.Param("agentId")
+	logger := logging.LoggerFromContext(c.Request.Context(), aeh.logger)
+
+	var requestData AgentExecuteRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse execute agent request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	triggerType, err := restTriggerType(c)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+	ctx := triggerContext(c, triggerType)
+
+	request, err := newExecutionRequest(c, agentID, requestData)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+	warnMaintenance(c, aeh.maintenance, agentID, "execute", aeh.logger)
+
+	if requestData.Async {
+		execution, deduplicated, err := aeh.coordinator.Start(ctx, request)
+		if err != nil {
+			logger.Warn("rejected execute agent request", zap.String("agent_id", agentID), zap.Error(err))
+			api.RespondServiceError(c, err, "Failed to start execution")
+			return
+		}
+
+		logging.SetExecutionID(c, execution.ID)
+		location := "/api/v1/executions/" + execution.ID
+		c.Header("Location", location)
+		if deduplicated {
+			c.Header(IdempotentReplayedHeader, "true")
+		}
+		c.JSON(http.StatusAccepted, AgentExecuteAccepted{
+			ExecutionID:  execution.ID,
+			AgentID:      agentID,
+			State:        string(execution.State),
+			Location:     location,
+			Deduplicated: deduplicated,
+		})
+		return
+	}
+
+	aeh.executeAndRespond(c, ctx, request)
+}
+
+// executeAndRespond runs an execute request and responds with its result, or with the execution to
+// poll when it queued with queue_behavior return_position
+func (aeh *AgentExecutionHandlers) executeAndRespond(c *gin.Context, ctx context.Context, request services.ExecutionRequest) {
+	agentID := request.AgentID
+	logger := logging.LoggerFromContext(c.Request.Context(), aeh.logger)
+
+	execution, deduplicated, err := aeh.coordinator.Execute(ctx, request)
+	if execution == nil {
+		logger.Warn("rejected execute agent request", zap.String("agent_id", agentID), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to execute agent")
+		return
+	}
+	logging.SetExecutionID(c, execution.ID)
+
+	// The agent is busy and the caller asked not to wait; the execution can be polled until it starts
+	if execution.State == models.QueuedState {
+		location := "/api/v1/executions/" + execution.ID
+		c.Header("Location", location)
+		c.JSON(http.StatusAccepted, AgentExecuteAccepted{
+			ExecutionID:     execution.ID,
+			AgentID:         agentID,
+			State:           string(execution.State),
+			Location:        location,
+			QueuePosition:   execution.QueuePosition,
+			EstimatedWaitMs: execution.EstimatedWaitMs,
+		})
+		return
+	}
+
+	// A run that failed still has a result with its status, exit code and stderr
+	result, resultErr := aeh.coordinator.ExecutionService().GetExecutionResult(execution.ID)
+	if resultErr != nil {
+		logger.Error("agent execution produced no result",
+			zap.String("agent_id", agentID),
+			zap.String("execution_id", execution.ID),
+			zap.Error(resultErr))
+		api.RespondErrorWithDetails(c, http.StatusInternalServerError, api.CodeInternalError, "Agent execution failed",
+			map[string]interface{}{"execution_id": execution.ID})
+		return
+	}
+
+	// Encode and flag the response without touching the stored result
+	response := result.Encoded()
+	if deduplicated {
+		response.Deduplicated = true
+		c.Header(IdempotentReplayedHeader, "true")
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// newExecutionRequest builds the coordinator request for an execute request body
+func newExecutionRequest(c *gin.Context, agentID string, requestData AgentExecuteRequest) (services.ExecutionRequest, error) {
+	binary, err := binaryInput(requestData)
+	if err != nil {
+		return services.ExecutionRequest{}, err
+	}
+	return services.ExecutionRequest{
+		AgentID:        agentID,
+		Input:          requestData.Input,
+		Parameters:     requestData.Parameters,
+		WorkingDir:     requestData.WorkingDir,
+		Env:            requestData.Env,
+		TimeoutSeconds: requestData.TimeoutSeconds,
+		Labels:         requestData.Labels,
+		NoCache:        requestData.NoCache,
+		OutputEncoding: requestData.OutputEncoding,
+		IdempotencyKey: c.GetHeader(IdempotencyKeyHeader),
+		QueueBehavior:  requestData.QueueBehavior,
+		BinaryInput:    binary,
+	}, nil
+}
+
+// binaryInput returns the binary input of an execute request, nil when it has none
+func binaryInput(requestData AgentExecuteRequest) (*services.BinaryInput, error) {
+	switch {
+	case requestData.InputBase64 != "" && requestData.InputURL != "":
+		return nil, errors.New("input_base64 and input_url cannot both be set")
+	case requestData.InputURL != "":
+		return &services.BinaryInput{URL: requestData.InputURL, ContentType: requestData.InputContentType}, nil
+	case requestData.InputBase64 != "":
+		data, err := base64.StdEncoding.DecodeString(requestData.InputBase64)
+		if err != nil {
+			return nil, fmt.Errorf("input_base64 is not valid base64: %v", err)
+		}
+		return &services.BinaryInput{Data: data, ContentType: requestData.InputContentType}, nil
+	case requestData.InputContentType != "":
+		return nil, errors.New("input_content_type needs input_base64 or input_url")
+	default:
+		return nil, nil
+	}
+}
+
+// restTriggerType returns the trigger type of a REST execute request: api unless the client sent
+// X-Trigger-Type: manual
+func restTriggerType(c *gin.Context) (types.TaskTriggerType, error) {
+	switch triggerType := types.TaskTriggerType(c.GetHeader(TriggerTypeHeader)); triggerType {
+	case "", types.TaskTriggerTypeAPI:
+		return types.TaskTriggerTypeAPI, nil
+	case types.TaskTriggerTypeManual:
+		return triggerType, nil
+	default:
+		return "", fmt.Errorf("%s must be %s or %s", TriggerTypeHeader, types.TaskTriggerTypeAPI, types.TaskTriggerTypeManual)
+	}
+}
+
+// triggerContext returns the request context attributing its executions to triggerType and the
+// caller's client identity
+func triggerContext(c *gin.Context, triggerType types.TaskTriggerType) context.Context {
+	return services.WithExecutionTrigger(c.Request.Context(), triggerType, callerID(c))
+}
+
+// callerID returns the client identity of the request, as assigned by the rate limiter or derived
+// from its credentials
+func callerID(c *gin.Context) string {
+	if clientID := services.ClientIDFromContext(c.Request.Context()); clientID != "" {
+		return clientID
+	}
+	return middleware.ClientID(c, "")
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AgentGroupHandlers handles REST requests that manage agent groups
+type AgentGroupHandlers struct {
+	groupService services.IAgentGroupService
+	agentService services.IAgentService
+	logger       *zap.Logger
+}
+
+// AgentGroupRequest is the body accepted when creating or updating an agent group
+type AgentGroupRequest struct {
+	Name        string   `json:"name"` // Ignored on update
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members"` // Agent IDs in start order
+}
+
+// groupActionResponse is returned by agent group mutation endpoints
+type groupActionResponse struct {
+	Message string `json:"message"`
+	Group   string `json:"group"`
+}
+
+// GroupStatusResponse is the body of GET /api/v1/groups/:groupName/status
+type GroupStatusResponse struct {
+	Group  string                  `json:"group"`
+	Agents []*services.AgentStatus `json:"agents"` // In member order
+}
+
+// NewAgentGroupHandlers creates a new instance of AgentGroupHandlers
+func NewAgentGroupHandlers(groupService services.IAgentGroupService, agentService services.IAgentService, logger *zap.Logger) *AgentGroupHandlers {
+	return &AgentGroupHandlers{
+		groupService: groupService,
+		agentService: agentService,
+		logger:       logger,
+	}
+}
+
+// RegisterAgentGroupRoutes registers the agent group routes
+func (gh *AgentGroupHandlers) RegisterAgentGroupRoutes(router gin.IRouter) {
+	groupRoutes := router.Group("/groups")
+
+	groupRoutes.GET("", gh.ListGroups)
+	groupRoutes.POST("", gh.CreateGroup)
+	groupRoutes.GET("/:groupName", gh.GetGroup)
+	groupRoutes.PUT("/:groupName", gh.UpdateGroup)
+	groupRoutes.DELETE("/:groupName", gh.DeleteGroup)
+	groupRoutes.GET("/:groupName/status", gh.GetGroupStatus)
+}
+
+// ListGroups returns all agent groups
+func (gh *AgentGroupHandlers) ListGroups(c *gin.Context) {
+	groups, err := gh.groupService.ListGroups()
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), gh.logger).Error("failed to list agent groups", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to list agent groups")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups": groups,
+		"total":  len(groups),
+	})
+}
+
+// GetGroup returns an agent group and its members
+func (gh *AgentGroupHandlers) GetGroup(c *gin.Context) {
+	group, err := gh.groupService.GetGroup(c.Param("groupName"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent group")
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// GetGroupStatus returns the runtime status of the members of an agent group, in member order
+func (gh *AgentGroupHandlers) GetGroupStatus(c *gin.Context) {
+	group, err := gh.groupService.GetGroup(c.Param("groupName"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent group")
+		return
+	}
+
+	response := GroupStatusResponse{Group: group.Name, Agents: make([]*services.AgentStatus, 0, len(group.Members))}
+	for _, agentID := range group.Members {
+		status, err := gh.agentService.GetAgentStatus(agentID)
+		if err != nil {
+			api.RespondServiceError(c, err, "Failed to get agent status")
+			return
+		}
+		response.Agents = append(response.Agents, status)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateGroup creates a new agent group
+func (gh *AgentGroupHandlers) CreateGroup(c *gin.Context) {
+	logger := logging.LoggerFromContext(c.Request.Context(), gh.logger)
+
+	var requestData AgentGroupRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse create agent group request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	group := &models.AgentGroup{Name: requestData.Name, Description: requestData.Description, Members: requestData.Members}
+	if err := gh.groupService.CreateGroup(group); err != nil {
+		logger.Warn("failed to create agent group", zap.String("group", group.Name), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to create agent group")
+		return
+	}
+
+	c.JSON(http.StatusCreated, groupActionResponse{
+		Message: "Agent group created successfully",
+		Group:   group.Name,
+	})
+}
+
+// UpdateGroup replaces the description and members of an agent group
+func (gh *AgentGroupHandlers) UpdateGroup(c *gin.Context) {
+	groupName := c.Param("groupName")
+	logger := logging.LoggerFromContext(c.Request.Context(), gh.logger)
+
+	var requestData AgentGroupRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse update agent group request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	group := &models.AgentGroup{Name: groupName, Description: requestData.Description, Members: requestData.Members}
+	if err := gh.groupService.UpdateGroup(group); err != nil {
+		logger.Warn("failed to update agent group", zap.String("group", groupName), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to update agent group")
+		return
+	}
+
+	c.JSON(http.StatusOK, groupActionResponse{
+		Message: "Agent group updated successfully",
+		Group:   groupName,
+	})
+}
+
+// DeleteGroup deletes an agent group, leaving its members as they are
+func (gh *AgentGroupHandlers) DeleteGroup(c *gin.Context) {
+	groupName := c.Param("groupName")
+
+	if err := gh.groupService.DeleteGroup(groupName); err != nil {
+		api.RespondServiceError(c, err, "Failed to delete agent group")
+		return
+	}
+
+	c.JSON(http.StatusOK, groupActionResponse{
+		Message: "Agent group deleted successfully",
+		Group:   groupName,
+	})
+}
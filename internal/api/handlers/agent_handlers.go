@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AgentHandlers handles REST requests that register, describe, delete and restore agents. The
+// values of sensitive environment variables are masked in every configuration returned.
+type AgentHandlers struct {
+	agentService    services.IAgentService
+	defaultsService services.IAgentDefaultsService // Serves raw configurations and reapplying defaults when set
+	events          *services.EventBus             // Wakes held status requests when set; they only recheck periodically otherwise
+	logger          *zap.Logger
+	revealEnabled   bool
+	revealClients   map[string]bool // Client identities allowed to reveal, any client when empty
+}
+
+// NewAgentHandlers creates a new instance of AgentHandlers
+func NewAgentHandlers(agentService services.IAgentService, logger *zap.Logger) *AgentHandlers {
+	return &AgentHandlers{
+		agentService: agentService,
+		logger:       logger,
+	}
+}
+
+// ReapplyDefaultsRequest is the body of a reapply-defaults request; no agent IDs reapply the
+// defaults to every agent
+type ReapplyDefaultsRequest struct {
+	AgentIDs []string `json:"agent_ids,omitempty"`
+}
+
+// SetDefaultsService sets the service GET requests for raw configurations and reapply-defaults
+// requests are answered from
+func (ah *AgentHandlers) SetDefaultsService(defaultsService services.IAgentDefaultsService) {
+	ah.defaultsService = defaultsService
+}
+
+// SetEventBus sets the bus whose events wake status requests held with the wait parameter
+func (ah *AgentHandlers) SetEventBus(events *services.EventBus) {
+	ah.events = events
+}
+
+// SetSecretReveal lets GET requests for agents pass reveal=true to see the unmasked values of
+// sensitive environment variables. Only callers presenting one of tokens may, or any caller when
+// tokens is empty; every reveal is logged.
+func (ah *AgentHandlers) SetSecretReveal(enabled bool, tokens []string) {
+	ah.revealEnabled = enabled
+	ah.revealClients = make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		ah.revealClients[services.ClientIDForToken(token)] = true
+	}
+}
+
+// RegisterAgentRoutes registers the agent registration routes
+func (ah *AgentHandlers) RegisterAgentRoutes(router gin.IRouter) {
+	router.POST("/agents", ah.CreateAgent)
+	router.GET("/agents", ah.ListAgents)
+	router.GET("/agents/status", ah.ListAgentStatuses)
+	if ah.defaultsService != nil {
+		router.POST("/agents/reapply-defaults", ah.ReapplyDefaults)
+	}
+	router.GET("/agents/:agentId", ah.GetAgent)
+	router.DELETE("/agents/:agentId", ah.DeleteAgent)
+	router.POST("/agents/:agentId/restore", ah.RestoreAgent)
+	router.GET("/agents/:agentId/status", ah.GetAgentStatus)
+}
+
+// CreateAgent registers an agent and returns its configuration, merged with its template if it
+// names one
+func (ah *AgentHandlers) CreateAgent(c *gin.Context) {
+	logger := logging.LoggerFromContext(c.Request.Context(), ah.logger)
+
+	var config models.AgentConfiguration
+	if err := c.ShouldBindJSON(&config); err != nil {
+		logger.Error("failed to parse create agent request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := ah.agentService.RegisterAgent(&config); err != nil {
+		logger.Warn("failed to register agent", zap.String("agent_id", config.ID), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to register agent")
+		return
+	}
+
+	registered, err := ah.agentService.GetAgent(config.ID)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent")
+		return
+	}
+
+	c.JSON(http.StatusCreated, registered.Masked())
+}
+
+// ListAgents returns the agents ordered by ID, or by sort=name|created_at in order=asc|desc, a page
+// of them when limit or offset is set. enabled=true|false and access_type=read_only|read_write filter
+// them; include_deleted=true adds the soft-deleted ones and reveal=true, when allowed, unmasks their
+// sensitive environment variables. total counts the matching agents across all pages.
+func (ah *AgentHandlers) ListAgents(c *gin.Context) {
+	includeDeleted, ok := boolQuery(c, "include_deleted")
+	if !ok {
+		return
+	}
+	reveal, ok := ah.revealQuery(c)
+	if !ok {
+		return
+	}
+	listOptions, ok := listOptionsQuery(c)
+	if !ok {
+		return
+	}
+	enabled, ok := optionalBoolQuery(c, "enabled")
+	if !ok {
+		return
+	}
+
+	options := services.AgentListOptions{
+		ListOptions:    listOptions,
+		Enabled:        enabled,
+		AccessType:     services.NormalizeAccessType(c.Query("access_type")),
+		IncludeDeleted: includeDeleted,
+	}
+	agents, total, err := ah.agentService.QueryAgents(options)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to list agents")
+		return
+	}
+	if !reveal {
+		for i, agent := range agents {
+			agents[i] = agent.Masked()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agents": agents,
+		"total":  total,
+		"limit":  listOptions.Limit,
+		"offset": listOptions.Offset,
+	})
+}
+
+// GetAgent returns the effective configuration of an agent, merged with its template and the
+// defaults; raw=true returns it as it was submitted instead. reveal=true, when allowed, unmasks its
+// sensitive environment variables.
+func (ah *AgentHandlers) GetAgent(c *gin.Context) {
+	reveal, ok := ah.revealQuery(c)
+	if !ok {
+		return
+	}
+	raw, ok := boolQuery(c, "raw")
+	if !ok {
+		return
+	}
+	if raw && ah.defaultsService == nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "raw agent configurations are not available")
+		return
+	}
+
+	var config *models.AgentConfiguration
+	var err error
+	if raw {
+		config, err = ah.defaultsService.GetAgentSpec(c.Param("agentId"))
+	} else {
+		config, err = ah.agentService.GetAgent(c.Param("agentId"))
+	}
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent")
+		return
+	}
+
+	if !reveal {
+		config = config.Masked()
+	}
+	c.JSON(http.StatusOK, config)
+}
+
+// GetAgentStatus returns the runtime status of an agent: idle, running, disabled or error. Like
+// ListAgentStatuses, it answers with an ETag and supports conditional and long-poll requests.
+func (ah *AgentHandlers) GetAgentStatus(c *gin.Context) {
+	agentID := c.Param("agentId")
+	ah.respondStatus(c, agentID, func() (interface{}, string, error) {
+		status, err := ah.agentService.GetAgentStatus(agentID)
+		if err != nil {
+			return nil, "", err
+		}
+		return status, services.AgentStatusETag(status), nil
+	})
+}
+
+// DeleteAgent soft-deletes an agent. It is refused with 409 AGENT_IN_USE and the referencing task
+// IDs while scheduled tasks run the agent, unless force=true, which pauses them.
+func (ah *AgentHandlers) DeleteAgent(c *gin.Context) {
+	logger := logging.LoggerFromContext(c.Request.Context(), ah.logger)
+	agentID := c.Param("agentId")
+	force, ok := boolQuery(c, "force")
+	if !ok {
+		return
+	}
+
+	result, err := ah.agentService.SoftDeleteAgent(agentID, force)
+	if err != nil {
+		logger.Warn("failed to delete agent", zap.String("agent_id", agentID), zap.Error(err))
+		var inUse *models.AgentInUseError
+		if errors.As(err, &inUse) {
+			api.RespondErrorWithDetails(c, http.StatusConflict, api.CodeAgentInUse, err.Error(),
+				map[string]interface{}{"task_ids": inUse.TaskIDs})
+			return
+		}
+		api.RespondServiceError(c, err, "Failed to delete agent")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RestoreAgent undoes the soft delete of an agent and returns its configuration
+func (ah *AgentHandlers) RestoreAgent(c *gin.Context) {
+	config, err := ah.agentService.RestoreAgent(c.Param("agentId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to restore agent")
+		return
+	}
+
+	c.JSON(http.StatusOK, config.Masked())
+}
+
+// ReapplyDefaults merges the current defaults into the agents named in the body, or every agent,
+// reporting the settings each one changes; dry_run=true only reports them
+func (ah *AgentHandlers) ReapplyDefaults(c *gin.Context) {
+	var requestData ReapplyDefaultsRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil && !errors.Is(err, io.EOF) {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	dryRun, ok := boolQuery(c, "dry_run")
+	if !ok {
+		return
+	}
+
+	result, err := ah.defaultsService.ReapplyDefaults(requestData.AgentIDs, dryRun)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to reapply agent defaults")
+		return
+	}
+
+	logging.LoggerFromContext(c.Request.Context(), ah.logger).Info("reapplied agent defaults",
+		zap.Bool("dry_run", dryRun),
+		zap.Int("updated", result.Updated),
+		zap.Int("failed", result.Failed))
+	c.JSON(http.StatusOK, result)
+}
+
+// revealQuery parses the reveal query parameter, responding with 403 when the caller may not reveal
+// secrets. Granted reveals are logged with the caller's identity.
+func (ah *AgentHandlers) revealQuery(c *gin.Context) (bool, bool) {
+	reveal, ok := boolQuery(c, "reveal")
+	if !ok || !reveal {
+		return false, ok
+	}
+
+	logger := logging.LoggerFromContext(c.Request.Context(), ah.logger)
+	caller := callerID(c)
+	if !ah.revealEnabled || (len(ah.revealClients) > 0 && !ah.revealClients[caller]) {
+		logger.Warn("refused to reveal agent secrets", zap.String("caller", caller), zap.String("path", c.Request.URL.Path))
+		api.RespondError(c, http.StatusForbidden, api.CodeForbidden, "revealing secrets is not permitted")
+		return false, false
+	}
+
+	logger.Warn("revealing agent secrets", zap.String("caller", caller), zap.String("path", c.Request.URL.Path))
+	return true, true
+}
+
+// boolQuery parses an optional boolean query parameter, responding with 400 when it is malformed
+func boolQuery(c *gin.Context, name string) (bool, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return false, true
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, name+" must be true or false")
+		return false, false
+	}
+	return parsed, true
+}
+
+// optionalBoolQuery parses an optional boolean filter, nil when it is absent, responding with 400
+// when it is malformed
+func optionalBoolQuery(c *gin.Context, name string) (*bool, bool) {
+	if c.Query(name) == "" {
+		return nil, true
+	}
+	value, ok := boolQuery(c, name)
+	return &value, ok
+}
+
+// intQuery parses an optional integer query parameter, responding with 400 when it is malformed
+func intQuery(c *gin.Context, name string) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, name+" must be an integer")
+		return 0, false
+	}
+	return parsed, true
+}
+
+// listOptionsQuery parses the sort, order, limit and offset query parameters of list endpoints; the
+// list services validate their values
+func listOptionsQuery(c *gin.Context) (services.ListOptions, bool) {
+	options := services.ListOptions{Sort: c.Query("sort"), Order: c.Query("order")}
+	var ok bool
+	if options.Limit, ok = intQuery(c, "limit"); !ok {
+		return options, false
+	}
+	if options.Offset, ok = intQuery(c, "offset"); !ok {
+		return options, false
+	}
+	return options, true
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MaxStatusWait is the longest an agent status request may be held with the wait query parameter;
+// longer waits are shortened to it
+const MaxStatusWait = 60 * time.Second
+
+// statusRecheckInterval is how often a held status request rechecks the status when no event
+// arrives, catching changes such as an agent being disabled that publish none
+const statusRecheckInterval = time.Second
+
+// statusChangeEvents are the events that may change an agent's status
+var statusChangeEvents = []string{models.EventExecutionState, models.EventProcessState}
+
+// AgentStatusesResponse is the response of GET /api/v1/agents/status
+type AgentStatusesResponse struct {
+	Agents []*services.AgentStatus `json:"agents"`
+}
+
+// statusLoader loads a status response and its ETag
+type statusLoader func() (interface{}, string, error)
+
+// ListAgentStatuses returns the runtime status of every agent, like GetAgentStatus does for one
+func (ah *AgentHandlers) ListAgentStatuses(c *gin.Context) {
+	ah.respondStatus(c, "", func() (interface{}, string, error) {
+		statuses, err := ah.agentService.ListAgentStatuses()
+		if err != nil {
+			return nil, "", err
+		}
+		return AgentStatusesResponse{Agents: statuses}, services.AgentStatusETag(statuses...), nil
+	})
+}
+
+// respondStatus answers a status request with what load returns, under its ETag. A request naming
+// the current ETag in its If-None-Match header or etag parameter gets 304 Not Modified; with wait=30s
+// it is first held until the status changes, then answered with the new status, or until the wait
+// expires. Executions and process state changes of agentID, or of any agent when it is empty, wake
+// held requests.
+func (ah *AgentHandlers) respondStatus(c *gin.Context, agentID string, load statusLoader) {
+	wait, ok := waitQuery(c)
+	if !ok {
+		return
+	}
+	known := c.Query("etag")
+	if known == "" {
+		known = c.GetHeader("If-None-Match")
+	}
+
+	// Subscribing before loading the status leaves no gap for a change to slip through
+	var subscription *services.EventSubscription
+	if wait > 0 && known != "" && ah.events != nil {
+		var err error
+		subscription, err = ah.events.Subscribe(services.SubscriptionOptions{
+			SubscriberType: "status_poll",
+			BufferSize:     16,
+			Types:          statusChangeEvents,
+			AgentID:        agentID,
+		})
+		if err != nil {
+			ah.logger.Warn("failed to subscribe to status changes", zap.Error(err))
+		} else {
+			defer subscription.Close()
+		}
+	}
+
+	status, etag, err := load()
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent status")
+		return
+	}
+	if wait > 0 && etagMatches(known, etag) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+		defer cancel()
+		for etagMatches(known, etag) && waitForStatusChange(ctx, subscription) {
+			if status, etag, err = load(); err != nil {
+				api.RespondServiceError(c, err, "Failed to get agent status")
+				return
+			}
+		}
+	}
+
+	c.Header("ETag", etag)
+	if etagMatches(known, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// waitForStatusChange waits for an event that may have changed the status, or the recheck
+// interval, reporting false once ctx ended instead
+func waitForStatusChange(ctx context.Context, subscription *services.EventSubscription) bool {
+	recheckCtx, cancel := context.WithTimeout(ctx, statusRecheckInterval)
+	defer cancel()
+	if subscription == nil {
+		<-recheckCtx.Done()
+	} else if _, err := subscription.Next(recheckCtx); err != nil && recheckCtx.Err() == nil {
+		// A subscriber disconnected for lagging falls back to rechecking
+		<-recheckCtx.Done()
+	}
+	return ctx.Err() == nil
+}
+
+// waitQuery parses the optional wait query parameter, a duration such as 30s capped at
+// MaxStatusWait, responding with 400 when it is malformed
+func waitQuery(c *gin.Context) (time.Duration, bool) {
+	value := c.Query("wait")
+	if value == "" {
+		return 0, true
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "wait must be a duration such as 30s")
+		return 0, false
+	}
+	return min(wait, MaxStatusWait), true
+}
+
+// etagMatches reports whether an If-None-Match value, a list of ETags or *, names etag; weak and
+// strong forms of the same ETag match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || (candidate != "" && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DefaultStreamHeartbeatInterval is how often a quiet execution stream sends a heartbeat event
+const DefaultStreamHeartbeatInterval = 15 * time.Second
+
+// Event names of POST /api/v1/agents/:agentId/execute/stream
+const (
+	StreamEventState     = "state"     // StreamStateEvent
+	StreamEventOutput    = "output"    // StreamOutputEvent
+	StreamEventProgress  = "progress"  // StreamProgressEvent
+	StreamEventHeartbeat = "heartbeat" // StreamHeartbeatEvent
+	StreamEventResult    = "result"    // StreamResultEvent, always the last event
+)
+
+// streamEventBuffer bounds the events queued between the execution and the response writer
+const streamEventBuffer = 256
+
+// streamEvent is a server-sent event queued for the response writer
+type streamEvent struct {
+	name string
+	data interface{}
+}
+
+// AgentStreamRequest is the request body of POST /api/v1/agents/:agentId/execute/stream; async is ignored
+type AgentStreamRequest struct {
+	AgentExecuteRequest
+	CancelOnDisconnect bool `json:"cancel_on_disconnect,omitempty"` // Cancel the execution when the client goes away
+}
+
+// StreamStateEvent reports that the execution entered a new state
+type StreamStateEvent struct {
+	ExecutionID string           `json:"execution_id"`
+	State       types.AgentState `json:"state"`
+}
+
+// StreamOutputEvent carries a chunk of the agent's output as it was written
+type StreamOutputEvent struct {
+	ExecutionID string `json:"execution_id"`
+	Stream      string `json:"stream"` // stdout or stderr
+	Data        string `json:"data"`
+}
+
+// StreamProgressEvent carries a progress report of the agent, taken out of its stderr
+type StreamProgressEvent struct {
+	ExecutionID string `json:"execution_id"`
+	models.ExecutionProgress
+}
+
+// StreamHeartbeatEvent keeps proxies from closing a quiet stream
+type StreamHeartbeatEvent struct {
+	Time time.Time `json:"time"`
+}
+
+// StreamResultEvent summarizes the finished execution, or why it could not run
+type StreamResultEvent struct {
+	ExecutionID   string                `json:"execution_id,omitempty"`
+	AgentID       string                `json:"agent_id"`
+	State         types.AgentState      `json:"state,omitempty"`
+	Status        types.ExecutionStatus `json:"status,omitempty"`
+	ExitCode      int                   `json:"exit_code"`
+	Signal        string                `json:"signal,omitempty"`
+	Output        string                `json:"output"`
+	Error         string                `json:"error,omitempty"`
+	StderrTail    string                `json:"stderr_tail,omitempty"`
+	ExecutionTime int64                 `json:"execution_time"` // milliseconds
+	FromCache     bool                  `json:"from_cache,omitempty"`
+	Deduplicated  bool                  `json:"deduplicated,omitempty"`
+}
+
+// SetStreamHeartbeatInterval sets how often quiet execution streams send a heartbeat event
+func (aeh *AgentExecutionHandlers) SetStreamHeartbeatInterval(interval time.Duration) {
+	aeh.heartbeatInterval = interval
+}
+
+// StreamExecuteAgent runs an agent and streams its state changes and output as server-sent events,
+// ending with a result event. Requests rejected before the agent starts get a plain error response.
+func (aeh *AgentExecutionHandlers) StreamExecuteAgent(c *gin.Context) {
+	agentID := c.Param("agentId")
+	logger := logging.LoggerFromContext(c.Request.Context(), aeh.logger)
+
+	var requestData AgentStreamRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse stream execute agent request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	triggerType, err := restTriggerType(c)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+	request, err := newExecutionRequest(c, agentID, requestData.AgentExecuteRequest)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+
+	// The execution reports to the handler through events; once the handler returns, reports are dropped
+	events := make(chan streamEvent, streamEventBuffer)
+	stop := make(chan struct{})
+	defer close(stop)
+	emit := func(name string, data interface{}) {
+		select {
+		case events <- streamEvent{name: name, data: data}:
+		case <-stop:
+		}
+	}
+
+	// State changes name the execution before the agent writes any output
+	var executionID atomic.Value
+	executionID.Store("")
+	ctx := triggerContext(c, triggerType)
+	ctx = services.WithStateObserver(ctx, func(id string, state types.AgentState) {
+		executionID.Store(id)
+		emit(StreamEventState, StreamStateEvent{ExecutionID: id, State: state})
+	})
+	ctx = agents.WithOutputObserver(ctx, func(stream string, chunk []byte) {
+		emit(StreamEventOutput, StreamOutputEvent{ExecutionID: executionID.Load().(string), Stream: stream, Data: string(chunk)})
+	})
+	ctx = services.WithProgressObserver(ctx, func(id string, progress models.ExecutionProgress) {
+		emit(StreamEventProgress, StreamProgressEvent{ExecutionID: id, ExecutionProgress: progress})
+	})
+	if !requestData.CancelOnDisconnect {
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	type outcome struct {
+		execution    *models.AgentExecution
+		deduplicated bool
+		err          error
+	}
+	warnMaintenance(c, aeh.maintenance, agentID, "execute", aeh.logger)
+	done := make(chan outcome, 1)
+	go func() {
+		execution, deduplicated, err := aeh.coordinator.Execute(ctx, request)
+		done <- outcome{execution, deduplicated, err}
+	}()
+
+	interval := aeh.heartbeatInterval
+	if interval <= 0 {
+		interval = DefaultStreamHeartbeatInterval
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	streaming := false
+	write := func(event streamEvent) {
+		if !streaming {
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+			streaming = true
+		}
+		c.SSEvent(event.name, event.data)
+		c.Writer.Flush()
+	}
+
+	for {
+		select {
+		case event := <-events:
+			write(event)
+
+		case <-heartbeat.C:
+			write(streamEvent{StreamEventHeartbeat, StreamHeartbeatEvent{Time: time.Now().UTC()}})
+
+		case finished := <-done:
+			if finished.execution == nil && !streaming {
+				logger.Warn("rejected stream execute agent request", zap.String("agent_id", agentID), zap.Error(finished.err))
+				api.RespondServiceError(c, finished.err, "Failed to execute agent")
+				return
+			}
+
+			// The execution has returned, so every event it reported is already queued
+			for pending := len(events); pending > 0; pending-- {
+				write(<-events)
+			}
+			write(streamEvent{StreamEventResult, aeh.streamResult(agentID, finished.execution, finished.deduplicated, finished.err)})
+			return
+
+		case <-c.Request.Context().Done():
+			logger.Info("stream execute agent client disconnected",
+				zap.String("agent_id", agentID),
+				zap.Bool("cancel_on_disconnect", requestData.CancelOnDisconnect))
+			return
+		}
+	}
+}
+
+// streamResult summarizes a finished execution for the final stream event
+func (aeh *AgentExecutionHandlers) streamResult(agentID string, execution *models.AgentExecution, deduplicated bool, err error) StreamResultEvent {
+	summary := StreamResultEvent{AgentID: agentID, Deduplicated: deduplicated}
+	if execution == nil {
+		summary.Status = types.FailureStatus
+		summary.Error = err.Error()
+		return summary
+	}
+
+	summary.ExecutionID = execution.ID
+	summary.State = execution.State
+	summary.ExitCode = execution.ExitCode
+	summary.Error = execution.ErrorMessage
+	if result, resultErr := aeh.coordinator.ExecutionService().GetExecutionResult(execution.ID); resultErr == nil {
+		summary.Status = result.Status
+		summary.ExitCode = result.ExitCode
+		summary.Signal = result.Signal
+		summary.Output = result.Output
+		summary.StderrTail = result.StderrTail(stderrTailBytes)
+		summary.ExecutionTime = result.EndTime.Sub(result.StartTime).Milliseconds()
+		summary.FromCache = result.FromCache
+	}
+	return summary
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AgentTemplateHandlers handles REST requests that manage agent templates
+type AgentTemplateHandlers struct {
+	templateService services.IAgentTemplateService
+	logger          *zap.Logger
+}
+
+// AgentTemplateRequest is the body accepted when creating or updating an agent template
+type AgentTemplateRequest struct {
+	Name     string                    `json:"name"` // Ignored on update
+	Settings models.AgentConfiguration `json:"settings"`
+}
+
+// templateActionResponse is returned by agent template mutation endpoints
+type templateActionResponse struct {
+	Message  string `json:"message"`
+	Template string `json:"template"`
+}
+
+// NewAgentTemplateHandlers creates a new instance of AgentTemplateHandlers
+func NewAgentTemplateHandlers(templateService services.IAgentTemplateService, logger *zap.Logger) *AgentTemplateHandlers {
+	return &AgentTemplateHandlers{
+		templateService: templateService,
+		logger:          logger,
+	}
+}
+
+// RegisterAgentTemplateRoutes registers the agent template routes
+func (th *AgentTemplateHandlers) RegisterAgentTemplateRoutes(router gin.IRouter) {
+	templateGroup := router.Group("/agent-templates")
+
+	templateGroup.GET("", th.ListTemplates)
+	templateGroup.POST("", th.CreateTemplate)
+	templateGroup.GET("/:templateName", th.GetTemplate)
+	templateGroup.PUT("/:templateName", th.UpdateTemplate)
+	templateGroup.DELETE("/:templateName", th.DeleteTemplate)
+}
+
+// ListTemplates returns all agent templates, their sensitive environment variables masked
+func (th *AgentTemplateHandlers) ListTemplates(c *gin.Context) {
+	templates, err := th.templateService.ListTemplates()
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), th.logger).Error("failed to list agent templates", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to list agent templates")
+		return
+	}
+	for i, template := range templates {
+		templates[i] = template.Masked()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"total":     len(templates),
+	})
+}
+
+// GetTemplate returns an agent template, its sensitive environment variables masked
+func (th *AgentTemplateHandlers) GetTemplate(c *gin.Context) {
+	template, err := th.templateService.GetTemplate(c.Param("templateName"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent template")
+		return
+	}
+
+	c.JSON(http.StatusOK, template.Masked())
+}
+
+// CreateTemplate creates a new agent template
+func (th *AgentTemplateHandlers) CreateTemplate(c *gin.Context) {
+	logger := logging.LoggerFromContext(c.Request.Context(), th.logger)
+
+	var requestData AgentTemplateRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse create agent template request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	template := &models.AgentTemplate{Name: requestData.Name, Settings: requestData.Settings}
+	if err := th.templateService.CreateTemplate(template); err != nil {
+		logger.Warn("failed to create agent template", zap.String("template", template.Name), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to create agent template")
+		return
+	}
+
+	c.JSON(http.StatusCreated, templateActionResponse{
+		Message:  "Agent template created successfully",
+		Template: template.Name,
+	})
+}
+
+// UpdateTemplate replaces the settings of an agent template
+func (th *AgentTemplateHandlers) UpdateTemplate(c *gin.Context) {
+	templateName := c.Param("templateName")
+	logger := logging.LoggerFromContext(c.Request.Context(), th.logger)
+
+	var requestData AgentTemplateRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse update agent template request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	template := &models.AgentTemplate{Name: templateName, Settings: requestData.Settings}
+	if err := th.templateService.UpdateTemplate(template); err != nil {
+		logger.Warn("failed to update agent template", zap.String("template", templateName), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to update agent template")
+		return
+	}
+
+	c.JSON(http.StatusOK, templateActionResponse{
+		Message:  "Agent template updated successfully",
+		Template: templateName,
+	})
+}
+
+// DeleteTemplate deletes an agent template no agent uses
+func (th *AgentTemplateHandlers) DeleteTemplate(c *gin.Context) {
+	templateName := c.Param("templateName")
+
+	if err := th.templateService.DeleteTemplate(templateName); err != nil {
+		api.RespondServiceError(c, err, "Failed to delete agent template")
+		return
+	}
+
+	c.JSON(http.StatusOK, templateActionResponse{
+		Message:  "Agent template deleted successfully",
+		Template: templateName,
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ExecuteUploadRoute is the route of upload executions, which caps its body at the upload limit
+// rather than at the request body limit
+const ExecuteUploadRoute = "POST /api/v1/agents/:agentId/execute/upload"
+
+// Parts of a multipart upload execute request
+const (
+	UploadFilePart    = "file"    // The uploaded input file
+	UploadRequestPart = "request" // Optional AgentExecuteRequest JSON; async is not supported
+)
+
+// maxUploadRequestBytes bounds the request part of a multipart upload
+const maxUploadRequestBytes = 1 << 20
+
+// errUploadRejected marks upload requests that are malformed rather than too large
+var errUploadRejected = errors.New("invalid upload")
+
+// SetUploads sets where uploaded input files are spooled, the system temp directory when dir is
+// empty, and the largest upload accepted, 0 for no limit
+func (aeh *AgentExecutionHandlers) SetUploads(dir string, maxBytes int64) {
+	aeh.uploadDir = dir
+	aeh.maxUploadBytes = maxBytes
+}
+
+// UploadExecuteAgent runs an agent on an uploaded file and returns its result. The body is either
+// multipart/form-data with the file in a "file" part and optionally an execute request in a
+// "request" part, or the file itself, sent with a Content-Length or chunked. The file is streamed to
+// a spool file, never held in memory: agents with the file input pattern find it at their input
+// file template, other agents get its path in $SUPERVISOR_INPUT_FILE. The spool file is removed once
+// the execution finishes, so uploads always wait for their execution.
+func (aeh *AgentExecutionHandlers) UploadExecuteAgent(c *gin.Context) {
+	agentID := c.Param("agentId")
+	logger := logging.LoggerFromContext(c.Request.Context(), aeh.logger)
+
+	if !api.StreamRequestBody(c, aeh.maxUploadBytes) {
+		return
+	}
+
+	triggerType, err := restTriggerType(c)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+
+	var requestData AgentExecuteRequest
+	path, size, err := aeh.spoolUpload(c, &requestData)
+	if err != nil {
+		switch {
+		case api.IsBodyTooLarge(err):
+			api.RespondBodyTooLarge(c, aeh.maxUploadBytes)
+		case errors.Is(err, errUploadRejected):
+			api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		default:
+			logger.Error("failed to spool upload", zap.String("agent_id", agentID), zap.Error(err))
+			api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to store upload")
+		}
+		return
+	}
+	defer os.Remove(path)
+
+	if requestData.InputBase64 != "" || requestData.InputURL != "" {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "Uploads carry their input file; input_base64 and input_url are not supported")
+		return
+	}
+	if requestData.Async || requestData.QueueBehavior == services.QueueBehaviorReturnPosition {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed,
+			"Uploads wait for their execution; async and queue_behavior return_position are not supported")
+		return
+	}
+	logger.Debug("spooled upload", zap.String("agent_id", agentID), zap.Int64("bytes", size))
+
+	// The same input means nothing without the same file, so upload results are never cached
+	// Binary input was refused above, so the request cannot be invalid
+	request, _ := newExecutionRequest(c, agentID, requestData)
+	request.NoCache = true
+	warnMaintenance(c, aeh.maintenance, agentID, "execute", aeh.logger)
+	ctx := agents.WithInputFile(triggerContext(c, triggerType), path)
+	aeh.executeAndRespond(c, ctx, request)
+}
+
+// spoolUpload streams the uploaded file of the request body to a new spool file and decodes the
+// execute request part of multipart bodies into requestData. Returns the spool file's path and size.
+func (aeh *AgentExecutionHandlers) spoolUpload(c *gin.Context, requestData *AgentExecuteRequest) (string, int64, error) {
+	spool, err := os.CreateTemp(aeh.uploadDir, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := copyUpload(c, spool, requestData)
+	if closeErr := spool.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(spool.Name())
+		return "", 0, err
+	}
+	return spool.Name(), size, nil
+}
+
+// copyUpload copies the uploaded file of the request body to spool
+func copyUpload(c *gin.Context, spool io.Writer, requestData *AgentExecuteRequest) (int64, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.Copy(spool, c.Request.Body)
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errUploadRejected, err)
+	}
+	var size int64
+	files := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, wrapUploadError(err)
+		}
+
+		switch part.FormName() {
+		case UploadFilePart:
+			files++
+			if files > 1 {
+				return 0, fmt.Errorf("%w: only one %q part may be sent", errUploadRejected, UploadFilePart)
+			}
+			// Failing to read the part or to write the spool file does not make the request malformed
+			if size, err = io.Copy(spool, part); err != nil {
+				part.Close()
+				return 0, err
+			}
+		case UploadRequestPart:
+			if err = json.NewDecoder(io.LimitReader(part, maxUploadRequestBytes)).Decode(requestData); err != nil && !api.IsBodyTooLarge(err) {
+				err = fmt.Errorf("%w: request part: %v", errUploadRejected, err)
+			}
+		default:
+			_, err = io.Copy(io.Discard, part)
+		}
+		part.Close()
+		if err != nil {
+			return 0, wrapUploadError(err)
+		}
+	}
+
+	if files == 0 {
+		return 0, fmt.Errorf("%w: multipart uploads need a %q part", errUploadRejected, UploadFilePart)
+	}
+	return size, nil
+}
+
+// wrapUploadError marks multipart decoding errors as rejections, keeping errors that already say
+// what went wrong
+func wrapUploadError(err error) error {
+	if api.IsBodyTooLarge(err) || errors.Is(err, errUploadRejected) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errUploadRejected, err)
+}
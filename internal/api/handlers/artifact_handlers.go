@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ArtifactHandlers lists and serves the files executions left in their artifacts directory
+type ArtifactHandlers struct {
+	executionService services.IExecutionService
+	store            *services.ArtifactStore
+	logger           *zap.Logger
+}
+
+// NewArtifactHandlers creates a new instance of ArtifactHandlers
+func NewArtifactHandlers(executionService services.IExecutionService, store *services.ArtifactStore, logger *zap.Logger) *ArtifactHandlers {
+	return &ArtifactHandlers{
+		executionService: executionService,
+		store:            store,
+		logger:           logger,
+	}
+}
+
+// RegisterArtifactRoutes registers the execution artifact routes
+func (ah *ArtifactHandlers) RegisterArtifactRoutes(router gin.IRouter) {
+	router.GET("/executions/:executionId/artifacts", ah.ListArtifacts)
+	router.GET("/executions/:executionId/artifacts/:name", ah.GetArtifact)
+}
+
+// ListArtifacts returns the artifacts kept for an execution and the ones rejected for exceeding a
+// limit. Executions that have not finished yet have no artifacts.
+func (ah *ArtifactHandlers) ListArtifacts(c *gin.Context) {
+	executionID := c.Param("executionId")
+	result, ok := ah.executionResult(c, executionID)
+	if !ok {
+		return
+	}
+
+	artifacts := []models.Artifact{}
+	var rejected []models.RejectedArtifact
+	if result != nil {
+		if result.Artifacts != nil {
+			artifacts = result.Artifacts
+		}
+		rejected = result.RejectedArtifacts
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"execution_id":       executionID,
+		"artifacts":          artifacts,
+		"rejected_artifacts": rejected,
+		"total":              len(artifacts),
+	})
+}
+
+// GetArtifact downloads an artifact of an execution. Range and conditional requests are honoured.
+func (ah *ArtifactHandlers) GetArtifact(c *gin.Context) {
+	executionID := c.Param("executionId")
+	name := c.Param("name")
+	result, ok := ah.executionResult(c, executionID)
+	if !ok {
+		return
+	}
+
+	var artifact *models.Artifact
+	if result != nil {
+		for i := range result.Artifacts {
+			if result.Artifacts[i].Name == name {
+				artifact = &result.Artifacts[i]
+				break
+			}
+		}
+	}
+	if artifact == nil {
+		api.RespondError(c, http.StatusNotFound, api.CodeArtifactNotFound, "Artifact "+name+" not found")
+		return
+	}
+
+	// Cached results share the artifacts of the execution that produced them
+	owner := executionID
+	if result.CachedExecutionID != "" {
+		owner = result.CachedExecutionID
+	}
+	file, err := ah.store.Open(owner, name)
+	if err != nil {
+		if !errors.Is(err, models.ErrArtifactNotFound) {
+			ah.logger.Error("failed to open artifact",
+				zap.String("execution_id", executionID),
+				zap.String("artifact", name),
+				zap.Error(err))
+		}
+		api.RespondServiceError(c, err, "Failed to open artifact")
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", artifact.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("ETag", `"`+artifact.SHA256+`"`)
+	c.Header("X-Checksum-SHA256", artifact.SHA256)
+	http.ServeContent(c.Writer, c.Request, name, artifact.ModifiedAt, file)
+}
+
+// executionResult returns the result of an execution, nil while it is still running. It responds
+// with an error and returns false when the execution does not exist.
+func (ah *ArtifactHandlers) executionResult(c *gin.Context, executionID string) (*models.ExecutionResult, bool) {
+	if _, err := ah.executionService.GetExecution(executionID); err != nil {
+		api.RespondServiceError(c, err, "Failed to get execution")
+		return nil, false
+	}
+	result, err := ah.executionService.GetExecutionResult(executionID)
+	if err != nil {
+		return nil, true
+	}
+	return result, true
+}
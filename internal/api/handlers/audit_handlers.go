@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AuditHandlers serves the audit log
+type AuditHandlers struct {
+	auditLog *services.AuditLog
+	logger   *zap.Logger
+}
+
+// NewAuditHandlers creates a new instance of AuditHandlers
+func NewAuditHandlers(auditLog *services.AuditLog, logger *zap.Logger) *AuditHandlers {
+	return &AuditHandlers{
+		auditLog: auditLog,
+		logger:   logger,
+	}
+}
+
+// RegisterAuditRoutes registers the audit log routes
+func (ah *AuditHandlers) RegisterAuditRoutes(router gin.IRouter) {
+	router.GET("/audit", ah.QueryAudit)
+}
+
+// QueryAudit returns a page of audit entries, oldest first, filtered by the since, actor and action
+// query parameters and paged by offset and limit
+func (ah *AuditHandlers) QueryAudit(c *gin.Context) {
+	var filter services.AuditFilter
+	var err error
+
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "since must be an RFC 3339 time")
+			return
+		}
+	}
+	if filter.Offset, err = queryInt(c, "offset"); err != nil || filter.Offset < 0 {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "offset must be a non-negative integer")
+		return
+	}
+	if filter.Limit, err = queryInt(c, "limit"); err != nil || filter.Limit < 0 {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "limit must be a non-negative integer")
+		return
+	}
+	filter.Actor = c.Query("actor")
+	filter.Action = c.Query("action")
+
+	page, err := ah.auditLog.Query(filter)
+	if err != nil {
+		ah.logger.Error("failed to query audit log", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to query audit log")
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// queryInt parses an integer query parameter, 0 when it is absent
+func queryInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
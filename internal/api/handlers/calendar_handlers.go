@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CalendarHandlers handles REST requests that manage the calendars scheduled tasks skip the days of
+type CalendarHandlers struct {
+	calendarService services.ICalendarService
+	logger          *zap.Logger
+}
+
+// CalendarRequest is the JSON body accepted when creating or updating a calendar. Calendars can
+// also be sent as an iCalendar file (text/calendar) or a YAML list of dates (application/yaml),
+// with the name and description as query parameters.
+type CalendarRequest struct {
+	Name        string             `json:"name"` // Ignored on update
+	Description string             `json:"description,omitempty"`
+	Dates       []models.DateRange `json:"dates"` // Objects, or strings such as "2026-12-25" or "2026-12-24..2026-12-26"
+}
+
+// calendarActionResponse is returned by calendar mutation endpoints
+type calendarActionResponse struct {
+	Message  string `json:"message"`
+	Calendar string `json:"calendar"`
+}
+
+// NewCalendarHandlers creates a new instance of CalendarHandlers
+func NewCalendarHandlers(calendarService services.ICalendarService, logger *zap.Logger) *CalendarHandlers {
+	return &CalendarHandlers{
+		calendarService: calendarService,
+		logger:          logger,
+	}
+}
+
+// RegisterCalendarRoutes registers the calendar routes
+func (ch *CalendarHandlers) RegisterCalendarRoutes(router gin.IRouter) {
+	calendarGroup := router.Group("/calendars")
+
+	calendarGroup.GET("", ch.ListCalendars)
+	calendarGroup.POST("", ch.CreateCalendar)
+	calendarGroup.GET("/:calendarName", ch.GetCalendar)
+	calendarGroup.PUT("/:calendarName", ch.UpdateCalendar)
+	calendarGroup.DELETE("/:calendarName", ch.DeleteCalendar)
+}
+
+// ListCalendars returns all calendars
+func (ch *CalendarHandlers) ListCalendars(c *gin.Context) {
+	calendars, err := ch.calendarService.ListCalendars()
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), ch.logger).Error("failed to list calendars", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to list calendars")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"calendars": calendars,
+		"total":     len(calendars),
+	})
+}
+
+// GetCalendar returns a calendar and its dates
+func (ch *CalendarHandlers) GetCalendar(c *gin.Context) {
+	calendar, err := ch.calendarService.GetCalendar(c.Param("calendarName"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get calendar")
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// CreateCalendar creates a new calendar
+func (ch *CalendarHandlers) CreateCalendar(c *gin.Context) {
+	logger := logging.LoggerFromContext(c.Request.Context(), ch.logger)
+
+	calendar, err := calendarFromRequest(c)
+	if err != nil {
+		logger.Error("failed to parse create calendar request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := ch.calendarService.CreateCalendar(calendar); err != nil {
+		logger.Warn("failed to create calendar", zap.String("calendar", calendar.Name), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to create calendar")
+		return
+	}
+
+	c.JSON(http.StatusCreated, calendarActionResponse{
+		Message:  "Calendar created successfully",
+		Calendar: calendar.Name,
+	})
+}
+
+// UpdateCalendar replaces the description and dates of a calendar
+func (ch *CalendarHandlers) UpdateCalendar(c *gin.Context) {
+	name := c.Param("calendarName")
+	logger := logging.LoggerFromContext(c.Request.Context(), ch.logger)
+
+	calendar, err := calendarFromRequest(c)
+	if err != nil {
+		logger.Error("failed to parse update calendar request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	calendar.Name = name
+
+	if err := ch.calendarService.UpdateCalendar(calendar); err != nil {
+		logger.Warn("failed to update calendar", zap.String("calendar", name), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to update calendar")
+		return
+	}
+
+	c.JSON(http.StatusOK, calendarActionResponse{
+		Message:  "Calendar updated successfully",
+		Calendar: name,
+	})
+}
+
+// DeleteCalendar deletes a calendar no scheduled task skips
+func (ch *CalendarHandlers) DeleteCalendar(c *gin.Context) {
+	name := c.Param("calendarName")
+
+	if err := ch.calendarService.DeleteCalendar(name); err != nil {
+		api.RespondServiceError(c, err, "Failed to delete calendar")
+		return
+	}
+
+	c.JSON(http.StatusOK, calendarActionResponse{
+		Message:  "Calendar deleted successfully",
+		Calendar: name,
+	})
+}
+
+// calendarFromRequest reads the calendar of a create or update request from a JSON body, an
+// iCalendar file or a YAML list of dates, as the Content-Type tells
+func calendarFromRequest(c *gin.Context) (*models.Calendar, error) {
+	contentType := c.ContentType()
+	if !strings.Contains(contentType, "calendar") && !strings.Contains(contentType, "yaml") {
+		var requestData CalendarRequest
+		if err := c.ShouldBindJSON(&requestData); err != nil {
+			return nil, err
+		}
+		return &models.Calendar{
+			Name:        requestData.Name,
+			Description: requestData.Description,
+			Dates:       requestData.Dates,
+		}, nil
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	parse := definitions.ParseDateList
+	if strings.Contains(contentType, "calendar") {
+		parse = definitions.ParseICalendar
+	}
+	dates, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", contentType, err)
+	}
+	return &models.Calendar{
+		Name:        c.Query("name"),
+		Description: c.Query("description"),
+		Dates:       dates,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ConfigHandlers handles configuration API requests
+type ConfigHandlers struct {
+	validator *services.ConfigValidator
+	reloader  *services.ConfigReloader
+	logger    *zap.Logger
+}
+
+// ConfigUpdateRequest is the optional request body of POST /config/update
+type ConfigUpdateRequest struct {
+	RestartChanged bool `json:"restart_changed"` // Restart changed agents that have running executions
+}
+
+// NewConfigHandlers creates a new instance of ConfigHandlers; reloader may be nil when no config file is in use
+func NewConfigHandlers(validator *services.ConfigValidator, reloader *services.ConfigReloader, logger *zap.Logger) *ConfigHandlers {
+	return &ConfigHandlers{
+		validator: validator,
+		reloader:  reloader,
+		logger:    logger,
+	}
+}
+
+// RegisterConfigRoutes registers all configuration-related routes
+func (ch *ConfigHandlers) RegisterConfigRoutes(router gin.IRouter) {
+	configGroup := router.Group("/config")
+
+	configGroup.POST("/validate", ch.ValidateConfig)
+	configGroup.POST("/reread", ch.RereadConfig)
+	configGroup.POST("/update", ch.UpdateConfig)
+}
+
+// ValidateConfig validates the running configuration and returns errors and warnings
+func (ch *ConfigHandlers) ValidateConfig(c *gin.Context) {
+	result := ch.validator.Validate()
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RereadConfig reports the agents and tasks that differ between the config file and the applied configuration
+func (ch *ConfigHandlers) RereadConfig(c *gin.Context) {
+	if ch.reloader == nil {
+		api.RespondError(c, http.StatusServiceUnavailable, api.CodeConfigUnavailable, "no config file is in use")
+		return
+	}
+
+	diff, err := ch.reloader.Reread()
+	if err != nil {
+		ch.logger.Error("failed to reread configuration", zap.Error(err))
+		api.RespondError(c, http.StatusUnprocessableEntity, api.CodeConfigInvalid, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// UpdateConfig applies the differences between the config file and the applied configuration
+func (ch *ConfigHandlers) UpdateConfig(c *gin.Context) {
+	if ch.reloader == nil {
+		api.RespondError(c, http.StatusServiceUnavailable, api.CodeConfigUnavailable, "no config file is in use")
+		return
+	}
+
+	var req ConfigUpdateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	result, err := ch.reloader.Update(req.RestartChanged)
+	if err != nil {
+		ch.logger.Error("failed to update configuration", zap.Error(err))
+		api.RespondError(c, http.StatusUnprocessableEntity, api.CodeConfigInvalid, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ConversationHandlers serves the threads of A2A messages sharing a conversation ID
+type ConversationHandlers struct {
+	store  *services.ConversationStore
+	logger *zap.Logger
+}
+
+// ConversationResponse is a conversation with the IDs of the executions its messages ran
+type ConversationResponse struct {
+	*models.Conversation
+	ExecutionIDs []string `json:"execution_ids"`
+}
+
+// NewConversationHandlers creates a new instance of ConversationHandlers
+func NewConversationHandlers(store *services.ConversationStore, logger *zap.Logger) *ConversationHandlers {
+	return &ConversationHandlers{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// RegisterConversationRoutes registers the conversation route
+func (ch *ConversationHandlers) RegisterConversationRoutes(router gin.IRouter) {
+	router.GET("/conversations/:conversationId", ch.GetConversation)
+}
+
+// GetConversation returns the ordered thread of a conversation that has not expired
+func (ch *ConversationHandlers) GetConversation(c *gin.Context) {
+	conversation, err := ch.store.Get(c.Param("conversationId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get conversation")
+		return
+	}
+	c.JSON(http.StatusOK, ConversationResponse{
+		Conversation: conversation,
+		ExecutionIDs: conversation.ExecutionIDs(),
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// DebugHandlers manages the fault injection rules used to test automation against supervisor
+// failures; the routes are only served when debug.fault_injection is enabled
+type DebugHandlers struct {
+	faults *services.FaultInjector
+	logger *zap.Logger
+}
+
+// NewDebugHandlers creates a new instance of DebugHandlers
+func NewDebugHandlers(faults *services.FaultInjector, logger *zap.Logger) *DebugHandlers {
+	return &DebugHandlers{
+		faults: faults,
+		logger: logger,
+	}
+}
+
+// RegisterDebugRoutes registers the fault injection routes
+func (dh *DebugHandlers) RegisterDebugRoutes(router gin.IRouter) {
+	faultRoutes := router.Group("/debug/faults")
+
+	faultRoutes.GET("", dh.ListFaults)
+	faultRoutes.POST("", dh.AddFault)
+	faultRoutes.DELETE("/:ruleId", dh.DeleteFault)
+}
+
+// ListFaults returns the fault injection rules that have not expired
+func (dh *DebugHandlers) ListFaults(c *gin.Context) {
+	rules := dh.faults.ListRules()
+	c.JSON(http.StatusOK, gin.H{
+		"faults": rules,
+		"total":  len(rules),
+	})
+}
+
+// AddFault registers a fault injection rule
+func (dh *DebugHandlers) AddFault(c *gin.Context) {
+	var rule models.FaultRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	added, err := dh.faults.AddRule(rule)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to add fault rule")
+		return
+	}
+
+	logging.LoggerFromContext(c.Request.Context(), dh.logger).Warn("fault injection rule added through the API",
+		zap.String("rule_id", added.ID))
+	c.JSON(http.StatusCreated, added)
+}
+
+// DeleteFault removes a fault injection rule
+func (dh *DebugHandlers) DeleteFault(c *gin.Context) {
+	ruleID := c.Param("ruleId")
+	if err := dh.faults.DeleteRule(ruleID); err != nil {
+		api.RespondServiceError(c, err, "Failed to delete fault rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Fault rule deleted",
+		"id":      ruleID,
+	})
+}
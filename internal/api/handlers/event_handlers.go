@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// EventSubscriberTypeSSE is the subscriber type of clients of GET /api/v1/events in the bus metrics
+const EventSubscriberTypeSSE = "sse"
+
+// EventHandlers streams the event bus to clients as server-sent events and reports its traffic
+type EventHandlers struct {
+	bus               *services.EventBus
+	heartbeatInterval time.Duration
+	logger            *zap.Logger
+}
+
+// NewEventHandlers creates a new instance of EventHandlers
+func NewEventHandlers(bus *services.EventBus, logger *zap.Logger) *EventHandlers {
+	return &EventHandlers{
+		bus:               bus,
+		heartbeatInterval: DefaultStreamHeartbeatInterval,
+		logger:            logger,
+	}
+}
+
+// SetHeartbeatInterval sets how often a quiet event stream sends a heartbeat event
+func (eh *EventHandlers) SetHeartbeatInterval(interval time.Duration) {
+	eh.heartbeatInterval = interval
+}
+
+// RegisterEventRoutes registers the event stream and event bus stats routes
+func (eh *EventHandlers) RegisterEventRoutes(router gin.IRouter) {
+	router.GET("/events", eh.StreamEvents)
+	router.GET("/events/stats", eh.GetEventStats)
+}
+
+// StreamEvents subscribes to the event bus and sends every event as a server-sent event named after
+// its type. A client that falls behind gets an events.dropped event counting what it missed, or with
+// overflow=disconnect, a final events.disconnected event once it lags more than lag_limit events.
+func (eh *EventHandlers) StreamEvents(c *gin.Context) {
+	options, err := subscriptionOptions(c)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+	subscription, err := eh.bus.Subscribe(options)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// Events are read on another goroutine so the stream can send heartbeats while waiting
+	type next struct {
+		event models.Event
+		err   error
+	}
+	ctx := c.Request.Context()
+	events := make(chan next)
+	go func() {
+		for {
+			event, err := subscription.Next(ctx)
+			select {
+			case events <- next{event, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(eh.heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case received := <-events:
+			if errors.Is(received.err, services.ErrSubscriberLagging) {
+				eh.logger.Warn("disconnected lagging event stream client", zap.Uint64("subscription_id", subscription.ID()))
+				c.SSEvent(models.EventEventsDisconnected, models.Event{
+					Type: models.EventEventsDisconnected,
+					Time: time.Now().UTC(),
+					Data: models.EventsDropped{Reason: received.err.Error()},
+				})
+				c.Writer.Flush()
+				return
+			}
+			if received.err != nil {
+				return
+			}
+			c.SSEvent(received.event.Type, received.event)
+			c.Writer.Flush()
+
+		case <-heartbeat.C:
+			c.SSEvent(StreamEventHeartbeat, StreamHeartbeatEvent{Time: time.Now().UTC()})
+			c.Writer.Flush()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetEventStats returns the events published on the bus and delivered to and dropped by its
+// subscribers, by subscriber type
+func (eh *EventHandlers) GetEventStats(c *gin.Context) {
+	c.JSON(http.StatusOK, eh.bus.Stats())
+}
+
+// subscriptionOptions reads the subscription of an event stream from its query parameters
+func subscriptionOptions(c *gin.Context) (services.SubscriptionOptions, error) {
+	options := services.SubscriptionOptions{
+		SubscriberType: EventSubscriberTypeSSE,
+		Overflow:       services.EventOverflowPolicy(c.Query("overflow")),
+		AgentID:        c.Query("agent_id"),
+	}
+	if types := c.Query("types"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				options.Types = append(options.Types, eventType)
+			}
+		}
+	}
+
+	integer := func(name string) (int, error) {
+		value := c.Query(name)
+		if value == "" {
+			return 0, nil
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, errors.New(name + " must be a positive integer")
+		}
+		return parsed, nil
+	}
+	var err error
+	if options.BufferSize, err = integer("buffer"); err != nil {
+		return options, err
+	}
+	if options.LagLimit, err = integer("lag_limit"); err != nil {
+		return options, err
+	}
+	return options, nil
+}
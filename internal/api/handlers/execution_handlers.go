@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ExtendExecutionRequest is the body of POST /api/v1/executions/:executionId/extend
+type ExtendExecutionRequest struct {
+	Seconds int    `json:"seconds"` // Additional time the execution needs
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ExecutionHandlers handles execution query API requests
+type ExecutionHandlers struct {
+	executionService services.IExecutionService
+	exportLabels     []string
+	logger           *zap.Logger
+}
+
+// NewExecutionHandlers creates a new instance of ExecutionHandlers
+func NewExecutionHandlers(executionService services.IExecutionService, logger *zap.Logger) *ExecutionHandlers {
+	return &ExecutionHandlers{
+		executionService: executionService,
+		logger:           logger,
+	}
+}
+
+// RegisterExecutionRoutes registers all execution-related routes
+func (eh *ExecutionHandlers) RegisterExecutionRoutes(router gin.IRouter) {
+	executionGroup := router.Group("/executions")
+
+	executionGroup.GET("", eh.ListExecutions)
+	executionGroup.GET("/export", eh.ExportExecutions)
+	executionGroup.GET("/:executionId", eh.GetExecution)
+	executionGroup.POST("/:executionId/stop", eh.StopExecution)
+	executionGroup.POST("/:executionId/extend", eh.ExtendExecution)
+	executionGroup.GET("/:executionId/diff/:otherId", eh.DiffExecutions)
+	executionGroup.GET("/:executionId/snapshot", eh.GetExecutionSnapshot)
+}
+
+// ListExecutions returns executions filtered by agent_id and repeated label=key=value query
+// parameters; anomalous=true returns only the executions flagged with anomalies
+func (eh *ExecutionHandlers) ListExecutions(c *gin.Context) {
+	labels, err := models.ParseLabelSelector(c.QueryArray("label"))
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+
+	filter := services.ExecutionFilter{
+		AgentID:     c.Query("agent_id"),
+		Labels:      labels,
+		TriggerType: types.TaskTriggerType(c.Query("trigger_type")),
+		TriggeredBy: c.Query("triggered_by"),
+		TaskID:      c.Query("task_id"),
+	}
+	if value := c.Query("anomalous"); value != "" {
+		anomalous, err := strconv.ParseBool(value)
+		if err != nil {
+			api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "anomalous must be true or false, got "+value)
+			return
+		}
+		filter.Anomalous = &anomalous
+	}
+
+	executions, err := eh.executionService.QueryExecutions(filter)
+	if err != nil {
+		eh.logger.Error("failed to query executions", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to query executions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"executions": executions,
+		"total":      len(executions),
+	})
+}
+
+// SetExportLabels sets the label keys exports have a column for; other labels are not exported
+func (eh *ExecutionHandlers) SetExportLabels(keys []string) {
+	eh.exportLabels = keys
+}
+
+// ExportExecutions streams the executions matching agent_id, label and the since and until RFC 3339
+// times as JSON lines (format=jsonl, the default) or CSV (format=csv) for offline analysis. The
+// executions are read and written a page at a time, so exports of any size are never held in
+// memory, and the response is gzipped when the client accepts it.
+func (eh *ExecutionHandlers) ExportExecutions(c *gin.Context) {
+	format := c.DefaultQuery("format", models.ExportFormatJSONL)
+	if format != models.ExportFormatJSONL && format != models.ExportFormatCSV {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "format must be jsonl or csv, got "+format)
+		return
+	}
+	labels, err := models.ParseLabelSelector(c.QueryArray("label"))
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+	filter := services.ExecutionFilter{AgentID: c.Query("agent_id"), Labels: labels}
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if value := c.Query(bound.name); value != "" {
+			if *bound.value, err = time.Parse(time.RFC3339, value); err != nil {
+				api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, bound.name+" must be an RFC 3339 time")
+				return
+			}
+		}
+	}
+
+	filename := fmt.Sprintf("executions-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if format == models.ExportFormatCSV {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	var out io.Writer = c.Writer
+	var compressor *gzip.Writer
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		c.Header("Vary", "Accept-Encoding")
+		compressor = gzip.NewWriter(c.Writer)
+		out = compressor
+	}
+	c.Status(http.StatusOK)
+
+	// Both encoders buffer, so nothing reaches the client before the first page is flushed
+	csvWriter := csv.NewWriter(out)
+	encoder := json.NewEncoder(out)
+	flush := func() error {
+		if format == models.ExportFormatCSV {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if compressor != nil {
+			if err := compressor.Flush(); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	if format == models.ExportFormatCSV {
+		csvWriter.Write(models.ExportColumns(eh.exportLabels))
+	}
+
+	rows := 0
+	err = eh.executionService.IterateExecutions(filter, func(execution *models.AgentExecution) error {
+		record := models.NewExecutionExportRecord(execution, eh.exportLabels)
+		var err error
+		if format == models.ExportFormatCSV {
+			err = csvWriter.Write(record.CSVRow(eh.exportLabels))
+		} else {
+			err = encoder.Encode(record)
+		}
+		if err != nil {
+			return err
+		}
+		if rows++; rows%services.ExecutionPageSize == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		// A client that went away stops the export
+		return c.Request.Context().Err()
+	})
+	if err != nil && !c.Writer.Written() {
+		for _, header := range []string{"Content-Encoding", "Content-Disposition", "Content-Type"} {
+			c.Writer.Header().Del(header)
+		}
+		eh.logger.Error("failed to export executions", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to export executions")
+		return
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && compressor != nil {
+		err = compressor.Close()
+	}
+	if err != nil {
+		// The status is sent already; the client sees a truncated export
+		eh.logger.Warn("execution export ended early", zap.Int("rows", rows), zap.Error(err))
+	}
+}
+
+// GetExecution returns a single execution and its result when available
+func (eh *ExecutionHandlers) GetExecution(c *gin.Context) {
+	executionID := c.Param("executionId")
+
+	execution, err := eh.executionService.GetExecution(executionID)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get execution")
+		return
+	}
+
+	response := gin.H{
+		"execution": execution,
+	}
+	if result, err := eh.executionService.GetExecutionResult(executionID); err == nil {
+		response["result"] = result.Encoded()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// StopExecution cancels a running execution. Its agent is sent the signal query parameter, or its
+// configured stop signal, and is killed when it has not exited after its stop wait; the execution
+// records whether that was needed once it ends.
+func (eh *ExecutionHandlers) StopExecution(c *gin.Context) {
+	executionID := c.Param("executionId")
+
+	if err := eh.executionService.StopExecution(executionID, c.Query("signal"), "stopped through the API", callerID(c)); err != nil {
+		api.RespondServiceError(c, err, "Failed to stop execution")
+		return
+	}
+
+	execution, err := eh.executionService.GetExecution(executionID)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get execution")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"execution": execution,
+	})
+}
+
+// ExtendExecution pushes the deadline of a running execution out, for agents that legitimately need
+// more time than their timeout, such as those waiting for human input. Extensions are capped by the
+// agent's max_total_timeout and recorded in the execution's state history.
+func (eh *ExecutionHandlers) ExtendExecution(c *gin.Context) {
+	executionID := c.Param("executionId")
+
+	var requestData ExtendExecutionRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	reason := requestData.Reason
+	if reason == "" {
+		reason = "extended through the API"
+	}
+
+	extension, err := eh.executionService.ExtendExecution(executionID, time.Duration(requestData.Seconds)*time.Second, reason, callerID(c))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to extend execution")
+		return
+	}
+
+	c.JSON(http.StatusOK, extension)
+}
+
+// DiffExecutions compares two finished executions, typically one and its replay: their states,
+// statuses, exit codes, durations and inputs, and a unified diff of their outputs cut at the limit
+// query parameter, in bytes
+func (eh *ExecutionHandlers) DiffExecutions(c *gin.Context) {
+	limit := models.DefaultOutputDiffLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, "limit must be a positive number of bytes")
+			return
+		}
+		limit = parsed
+	}
+
+	var executions [2]*models.AgentExecution
+	var results [2]*models.ExecutionResult
+	for i, executionID := range []string{c.Param("executionId"), c.Param("otherId")} {
+		execution, err := eh.executionService.GetExecution(executionID)
+		if err != nil {
+			api.RespondServiceError(c, err, "Failed to get execution")
+			return
+		}
+		if !models.IsTerminalState(execution.State) {
+			api.RespondServiceError(c, models.NewKindError(models.ErrExecutionConflict, "execution %s has not finished", executionID), "Failed to diff executions")
+			return
+		}
+		executions[i] = execution
+		results[i], _ = eh.executionService.GetExecutionResult(executionID)
+	}
+
+	c.JSON(http.StatusOK, models.DiffExecutions(executions[0], executions[1], results[0], results[1], limit))
+}
+
+// GetExecutionSnapshot returns the environment the execution's agent process saw: its resolved
+// executable and hash, argv, working directory, environment variable names, the supervisor version,
+// the agent configuration revision and the host
+func (eh *ExecutionHandlers) GetExecutionSnapshot(c *gin.Context) {
+	snapshot, err := eh.executionService.GetExecutionSnapshot(c.Param("executionId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get execution snapshot")
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
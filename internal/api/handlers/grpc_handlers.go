@@ -3,14 +3,17 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
-	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/internal/services"
 	"github.com/algonius/algonius-supervisor/internal/a2a"
+	protocol "github.com/algonius/algonius-supervisor/pkg/a2a"
+	"github.com/algonius/algonius-supervisor/pkg/types"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"go.uber.org/zap"
 )
@@ -19,9 +22,11 @@ import (
 type GRPCHandlers struct {
 	agentService     *services.AgentService
 	executionService services.IExecutionService
+	router           *services.ExecutionRouter
 	a2aService       *services.A2AService
 	logger           *zap.Logger
 	config           *a2a.A2AConfig
+	conversations    *services.ConversationStore
 	
 	// Embed the gRPC server interface to satisfy the interface requirements
 	// This would typically be a generated interface from a .proto file
@@ -37,12 +42,18 @@ func NewGRPCHandlers(agentService *services.AgentService, executionService servi
 	return &GRPCHandlers{
 		agentService:     agentService,
 		executionService: executionService,
+		router:           services.ExecutionRouterFor(executionService, logger),
 		a2aService:       a2aService,
 		logger:           logger,
 		config:           config,
 	}
 }
 
+// SetConversationStore threads messages carrying a conversation ID into conversations
+func (gh *GRPCHandlers) SetConversationStore(conversations *services.ConversationStore) {
+	gh.conversations = conversations
+}
+
 // RegisterGRPCRoutes registers all gRPC routes and services
 func (gh *GRPCHandlers) RegisterGRPCRoutes(server *grpc.Server) {
 	// Register the A2A service with the gRPC server
@@ -66,6 +77,9 @@ func (gh *GRPCHandlers) SendMessage(ctx context.Context, req *A2AMessageSendRequ
 	if req.Message == nil {
 		return nil, status.Error(codes.InvalidArgument, "Message is required")
 	}
+	if err := gh.checkMessage(req.Message); err != nil {
+		return nil, err
+	}
 
 	// Get the agent configuration
 	agent, err := gh.agentService.GetAgent(req.AgentId)
@@ -79,9 +93,11 @@ func (gh *GRPCHandlers) SendMessage(ctx context.Context, req *A2AMessageSendRequ
 		return nil, status.Error(codes.Unavailable, "Agent is disabled")
 	}
 
-	// Create a simple agent wrapper for execution
-	simpleAgent := &SimpleGRPCAgent{
-		config: agent,
+	// Build the runtime agent; the router queues it behind other runs of a read-write agent
+	runtimeAgent, err := gh.router.CreateAgent(agent)
+	if err != nil {
+		gh.logger.Error("failed to create agent", zap.String("agent_id", req.AgentId), zap.Error(err))
+		return nil, status.Error(codes.Internal, "Agent execution failed")
 	}
 
 	// Execute the agent with the provided input
@@ -96,12 +112,40 @@ func (gh *GRPCHandlers) SendMessage(ctx context.Context, req *A2AMessageSendRequ
 		input = ""
 	}
 
-	execution, err := gh.executionService.ExecuteAgent(ctx, simpleAgent, input)
+	// A message in a conversation is given the exchanges before it
+	conversationID := ""
+	if req.Message.Context != nil {
+		conversationID = req.Message.Context.ConversationId
+	}
+	ctx = services.WithConversationHistory(ctx, gh.conversations.HistoryFor(conversationID, agent))
+
+	ctx = services.WithExecutionTrigger(ctx, types.TaskTriggerTypeGRPC, grpcClientID(ctx))
+	execution, err := gh.router.ExecuteAgent(ctx, runtimeAgent, input)
 	if err != nil {
+		if execution != nil {
+			gh.conversations.RecordExecution(conversationID, req.Message.Id, execution, "")
+		}
 		gh.logger.Error("agent execution failed", zap.Error(err))
 		return nil, status.Error(codes.Internal, "Agent execution failed")
 	}
 
+	// Report what the agent actually produced
+	resultStatus, output := "", ""
+	if result, resultErr := gh.executionService.GetExecutionResult(execution.ID); resultErr == nil {
+		resultStatus = string(result.Status)
+		output = result.Output
+	} else if endStatus, ok := execution.EndStatus(); ok {
+		resultStatus = string(endStatus)
+	} else {
+		gh.logger.Error("agent execution produced no result",
+			zap.String("agent_id", req.AgentId),
+			zap.String("execution_id", execution.ID),
+			zap.String("state", string(execution.State)),
+			zap.Error(resultErr))
+		return nil, status.Error(codes.Internal, "Agent execution produced no result")
+	}
+	gh.conversations.RecordExecution(conversationID, req.Message.Id, execution, output)
+
 	// Create response
 	response := &A2AMessageSendResponse{
 		Message: &A2AMessage{
@@ -117,8 +161,8 @@ func (gh *GRPCHandlers) SendMessage(ctx context.Context, req *A2AMessageSendRequ
 			},
 			Payload: &A2APayload{
 				Result: &A2AResult{
-					Status: "success",
-					Output: "Agent execution completed",
+					Status: resultStatus,
+					Output: output,
 					ExecutionId: execution.ID,
 				},
 			},
@@ -135,6 +179,13 @@ func (gh *GRPCHandlers) StreamMessage(req *A2AMessageStreamRequest, srv A2AServi
 	gh.logger.Info("handling gRPC A2A stream message request",
 		zap.String("agent_id", req.AgentId))
 
+	if req.Message == nil {
+		return status.Error(codes.InvalidArgument, "Message is required")
+	}
+	if err := gh.checkMessage(req.Message); err != nil {
+		return err
+	}
+
 	// For now, we'll simulate a streaming response
 	// In a real implementation, this would connect to an actual streaming agent
 
@@ -345,6 +396,32 @@ func (gh *GRPCHandlers) CancelTask(ctx context.Context, req *A2ACancelTaskReques
 	return response, nil
 }
 
+// Negotiate describes the protocol versions, methods, message size, streaming and authentication
+// the supervisor supports
+func (gh *GRPCHandlers) Negotiate(ctx context.Context, req *A2ANegotiateRequest) (*A2ANegotiateResponse, error) {
+	return &A2ANegotiateResponse{
+		Negotiation: gh.config.Negotiate([]string{"Negotiate", "SendMessage", "StreamMessage", "GetTask", "ListTasks", "CancelTask"}),
+	}, nil
+}
+
+// checkMessage rejects a message whose protocol version is not supported with FailedPrecondition,
+// and one missing a required field with InvalidArgument naming the field
+func (gh *GRPCHandlers) checkMessage(message *A2AMessage) error {
+	if err := gh.config.CheckProtocolVersion(message.ProtocolVersion); err != nil {
+		if a2aErr, ok := protocol.AsA2AError(err); ok {
+			return status.Error(codes.FailedPrecondition, a2aErr.Message)
+		}
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	switch {
+	case message.Id == "":
+		return status.Error(codes.InvalidArgument, "message.id is required")
+	case message.Context == nil:
+		return status.Error(codes.InvalidArgument, "message.context is required")
+	}
+	return nil
+}
+
 // Helper functions (stubs for now, would be properly implemented in a real system)
 func generateA2AID() string {
 	// In a real implementation, this would generate a proper A2A ID
@@ -411,12 +488,19 @@ type A2ACancelTaskResponse struct {
 }
 
 type A2AMessage struct {
-	Id           string      `json:"id"`
-	Type         string      `json:"type"`
-	Timestamp    string      `json:"timestamp"`
-	InResponseTo string      `json:"in_response_to"`
-	Context      *A2AContext `json:"context"`
-	Payload      *A2APayload `json:"payload"`
+	Id              string      `json:"id"`
+	Type            string      `json:"type"`
+	Timestamp       string      `json:"timestamp"`
+	InResponseTo    string      `json:"in_response_to"`
+	ProtocolVersion string      `json:"protocol_version"`
+	Context         *A2AContext `json:"context"`
+	Payload         *A2APayload `json:"payload"`
+}
+
+type A2ANegotiateRequest struct{}
+
+type A2ANegotiateResponse struct {
+	Negotiation a2a.Negotiation `json:"negotiation"`
 }
 
 type A2AContext struct {
@@ -475,6 +559,10 @@ var A2AService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CancelTask",
 			Handler:    _A2AService_CancelTask_Handler,
 		},
+		{
+			MethodName: "Negotiate",
+			Handler:    _A2AService_Negotiate_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -508,6 +596,11 @@ func _A2AService_CancelTask_Handler(srv interface{}, ctx context.Context, dec fu
 	return nil, status.Error(codes.Unimplemented, "not implemented")
 }
 
+func _A2AService_Negotiate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	// Actual implementation would be generated
+	return nil, status.Error(codes.Unimplemented, "not implemented")
+}
+
 func _A2AService_StreamMessage_Handler(srv interface{}, stream grpc.ServerStream) error {
 	// Actual implementation would be generated
 	return status.Error(codes.Unimplemented, "not implemented")
@@ -520,6 +613,7 @@ type A2AServiceServer interface {
 	GetTask(context.Context, *A2AGetTaskRequest) (*A2AGetTaskResponse, error)
 	ListTasks(context.Context, *A2AListTasksRequest) (*A2AListTasksResponse, error)
 	CancelTask(context.Context, *A2ACancelTaskRequest) (*A2ACancelTaskResponse, error)
+	Negotiate(context.Context, *A2ANegotiateRequest) (*A2ANegotiateResponse, error)
 }
 
 type A2AService_StreamMessageServer interface {
@@ -527,46 +621,17 @@ type A2AService_StreamMessageServer interface {
 	grpc.ServerStream
 }
 
-// SimpleGRPCAgent is a wrapper to make our agent configuration compatible with the execution service
-type SimpleGRPCAgent struct {
-	config *models.AgentConfiguration
-}
-
-func (sgr *SimpleGRPCAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
-	// In a real implementation, this would execute the actual agent process
-	// For this implementation, we'll return a mock result
-	result := &models.ExecutionResult{
-		ID:        "grpc-" + time.Now().Format("20060102-150405"),
-		AgentID:   sgr.config.ID,
-		Status:    models.SuccessStatus,
-		Input:     input,
-		Output:    fmt.Sprintf("Executed command: %s with input: %s", sgr.config.ExecutablePath, input),
-		StartTime: time.Now(),
-		EndTime:   time.Now(),
+// grpcClientID identifies a gRPC caller by its authorization token, or by its address when it sent none
+func grpcClientID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if token := strings.TrimSpace(strings.TrimPrefix(value, "Bearer ")); token != "" {
+				return services.ClientIDForToken(token)
+			}
+		}
 	}
-	return result, nil
-}
-
-func (sgr *SimpleGRPCAgent) GetID() string {
-	return sgr.config.ID
-}
-
-func (sgr *SimpleGRPCAgent) GetName() string {
-	return sgr.config.Name
-}
-
-func (sgr *SimpleGRPCAgent) GetType() string {
-	return sgr.config.AgentType
-}
-
-func (sgr *SimpleGRPCAgent) IsReadOnly() bool {
-	return sgr.config.AccessType == models.ReadOnlyAccessType
-}
-
-func (sgr *SimpleGRPCAgent) GetConfig() *models.AgentConfiguration {
-	return sgr.config
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return services.ClientIDForAddress(p.Addr.String())
+	}
+	return ""
 }
-
-func (sgr *SimpleGRPCAgent) Validate() error {
-	return sgr.config.Validate()
-}
\ No newline at end of file
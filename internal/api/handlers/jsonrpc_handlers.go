@@ -1,16 +1,19 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/api"
 	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/internal/services"
 	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	protocol "github.com/algonius/algonius-supervisor/pkg/a2a"
+	"github.com/algonius/algonius-supervisor/pkg/types"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -20,10 +23,22 @@ import (
 type JSONRPCHandlers struct {
 	agentService     *services.AgentService
 	executionService services.IExecutionService
+	coordinator      *services.ExecutionCoordinator
 	logger           *zap.Logger
 	config           *a2a.A2AConfig
+	pushNotifier     *services.PushNotifier
+	conversations    *services.ConversationStore
 }
 
+// rpcRateLimitedCode is the JSON-RPC server error code for requests rejected by rate limits or quotas
+const rpcRateLimitedCode = -32000
+
+// JSON-RPC error codes defined by the A2A protocol
+const (
+	rpcTaskNotFoundCode                 = -32001
+	rpcPushNotificationNotSupportedCode = -32003
+)
+
 // JSONRPCRequest represents a JSON-RPC 2.0 request
 type JSONRPCRequest struct {
 	Jsonrpc string      `json:"jsonrpc"`
@@ -44,19 +59,30 @@ type JSONRPCResponse struct {
 type RPCError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
-	Data    string `json:"data,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
-// NewJSONRPCHandlers creates a new instance of JSONRPCHandlers
-func NewJSONRPCHandlers(agentService *services.AgentService, executionService services.IExecutionService, logger *zap.Logger, config *a2a.A2AConfig) *JSONRPCHandlers {
+// NewJSONRPCHandlers creates a new instance of JSONRPCHandlers that runs agents through coordinator
+func NewJSONRPCHandlers(agentService *services.AgentService, coordinator *services.ExecutionCoordinator, logger *zap.Logger, config *a2a.A2AConfig) *JSONRPCHandlers {
 	return &JSONRPCHandlers{
 		agentService:     agentService,
-		executionService: executionService,
+		executionService: coordinator.ExecutionService(),
+		coordinator:      coordinator,
 		logger:           logger,
 		config:           config,
 	}
 }
 
+// SetPushNotifier enables the tasks/pushNotificationConfig methods
+func (jrh *JSONRPCHandlers) SetPushNotifier(notifier *services.PushNotifier) {
+	jrh.pushNotifier = notifier
+}
+
+// SetConversationStore threads execute-agent requests carrying a conversation ID into conversations
+func (jrh *JSONRPCHandlers) SetConversationStore(conversations *services.ConversationStore) {
+	jrh.conversations = conversations
+}
+
 // RegisterJSONRPCRoutes registers JSON-RPC routes
 func (jrh *JSONRPCHandlers) RegisterJSONRPCRoutes(router *gin.Engine) {
 	// Apply authentication and validation middleware
@@ -68,16 +94,21 @@ func (jrh *JSONRPCHandlers) RegisterJSONRPCRoutes(router *gin.Engine) {
 	jsonrpcGroup.POST("", jrh.HandleJSONRPC)
 }
 
+// requestLogger returns the handler logger annotated with the request ID
+func (jrh *JSONRPCHandlers) requestLogger(c *gin.Context) *zap.Logger {
+	return logging.LoggerFromContext(c.Request.Context(), jrh.logger)
+}
+
 // HandleJSONRPC handles incoming JSON-RPC requests
 func (jrh *JSONRPCHandlers) HandleJSONRPC(c *gin.Context) {
 	// Log the incoming request
-	jrh.logger.Info("handling JSON-RPC request",
+	jrh.requestLogger(c).Info("handling JSON-RPC request",
 		zap.String("path", c.Request.URL.Path))
 
 	// Read the request body
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		jrh.logger.Error("failed to read request body", zap.Error(err))
+		jrh.requestLogger(c).Error("failed to read request body", zap.Error(err))
 		c.JSON(http.StatusBadRequest, jrh.createJSONRPCError(nil, -32700, "Parse error", "Failed to parse request body"))
 		return
 	}
@@ -85,7 +116,7 @@ func (jrh *JSONRPCHandlers) HandleJSONRPC(c *gin.Context) {
 	// Parse the JSON-RPC request
 	var req JSONRPCRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		jrh.logger.Error("failed to parse JSON-RPC request", zap.Error(err))
+		jrh.requestLogger(c).Error("failed to parse JSON-RPC request", zap.Error(err))
 		c.JSON(http.StatusBadRequest, jrh.createJSONRPCError(nil, -32700, "Parse error", "Invalid JSON was received"))
 		return
 	}
@@ -102,18 +133,42 @@ func (jrh *JSONRPCHandlers) HandleJSONRPC(c *gin.Context) {
 
 	// Set content type and return response
 	c.Header("Content-Type", "application/json")
+	if response.Error != nil && response.Error.Code == rpcRateLimitedCode {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, response)
+		return
+	}
 	c.JSON(http.StatusOK, response)
 }
 
-// processRequest processes the JSON-RPC request based on the method
+// processRequest processes the JSON-RPC request based on the method. Params may carry the
+// protocol_version the caller speaks, which must be one the supervisor supports.
 func (jrh *JSONRPCHandlers) processRequest(c *gin.Context, req JSONRPCRequest) JSONRPCResponse {
+	if params, ok := req.Params.(map[string]interface{}); ok {
+		if raw, exists := params["protocol_version"]; exists {
+			version, _ := raw.(string)
+			if err := jrh.config.CheckProtocolVersion(version); err != nil {
+				if a2aErr, ok := protocol.AsA2AError(err); ok {
+					return jrh.createJSONRPCError(req.ID, a2aErr.Code, a2aErr.Message, a2aErr.Data)
+				}
+				return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", err.Error())
+			}
+		}
+	}
+
 	switch req.Method {
+	case "negotiate":
+		return jrh.handleNegotiate(c, req)
 	case "execute-agent":
 		return jrh.handleExecuteAgent(c, req)
 	case "status":
 		return jrh.handleStatus(c, req)
 	case "list-agents":
 		return jrh.handleListAgents(c, req)
+	case "tasks/pushNotificationConfig/set":
+		return jrh.handleSetPushNotification(c, req)
+	case "tasks/pushNotificationConfig/get":
+		return jrh.handleGetPushNotification(c, req)
 	default:
 		return jrh.createJSONRPCError(req.ID, -32601, "Method not found", fmt.Sprintf("Method %s not found", req.Method))
 	}
@@ -136,42 +191,143 @@ func (jrh *JSONRPCHandlers) handleExecuteAgent(c *gin.Context, req JSONRPCReques
 			// Default to the first path parameter if available in context
 			agentID = c.Param("agentId")
 			if agentID == "" {
-				return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "agentId is required")
+				return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", protocol.FieldError{Field: "agentId", Reason: "required"})
 			}
 		}
 	}
 
-	// Get the agent configuration
-	agent, err := jrh.agentService.GetAgent(agentID)
+	// Extract input from parameters
+	input, exists := params["input"].(string)
+	if !exists {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", protocol.FieldError{Field: "input", Reason: "required"})
+	}
+
+	// Extract optional labels
+	labels, err := parseLabelsParam(params["labels"])
 	if err != nil {
-		jrh.logger.Error("agent not found", zap.String("agent_id", agentID), zap.Error(err))
-		return jrh.createJSONRPCError(req.ID, -32001, "Agent not found", fmt.Sprintf("Agent with ID %s not found", agentID))
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", err.Error())
 	}
 
-	// Extract input from parameters
-	input, exists := params["input"].(string)
+	// Extract optional cache bypass
+	noCache, _ := params["noCache"].(bool)
+
+	// Extract the optional idempotency key under either naming style
+	idempotencyKey, exists := params["idempotency_key"].(string)
+	if !exists {
+		idempotencyKey, _ = params["idempotencyKey"].(string)
+	}
+
+	// Extract the optional queue behavior under either naming style
+	queueBehavior, exists := params["queue_behavior"].(string)
 	if !exists {
-		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "input is required")
+		queueBehavior, _ = params["queueBehavior"].(string)
 	}
 
-	// Create a simple agent wrapper for execution
-	simpleAgent := &SimpleJSONRPCAgent{
-		config: agent,
+	// Extract the optional A2A conversation and message IDs under either naming style; JSON-RPC-pattern
+	// agents are given the conversation's prior exchanges
+	conversationID, exists := params["conversation_id"].(string)
+	if !exists {
+		conversationID, _ = params["conversationId"].(string)
+	}
+	messageID, exists := params["message_id"].(string)
+	if !exists {
+		messageID, _ = params["messageId"].(string)
+	}
+	var history []models.ConversationExchange
+	if agentConfig, err := jrh.agentService.GetAgent(agentID); err == nil {
+		history = jrh.conversations.HistoryFor(conversationID, agentConfig)
 	}
 
-	// Execute the agent
-	execution, err := jrh.executionService.ExecuteAgent(c.Request.Context(), simpleAgent, input)
+	// Execute the agent the same way the REST execute endpoint does
+	execution, deduplicated, err := jrh.coordinator.Execute(triggerContext(c, types.TaskTriggerTypeJSONRPC), services.ExecutionRequest{
+		AgentID:        agentID,
+		Input:          input,
+		Labels:         labels,
+		NoCache:        noCache,
+		IdempotencyKey: idempotencyKey,
+		QueueBehavior:  services.QueueBehavior(queueBehavior),
+
+		ConversationHistory: history,
+	})
+	if execution != nil {
+		logging.SetExecutionID(c, execution.ID)
+		// A retried request is the same message, already in the conversation
+		if !deduplicated {
+			jrh.recordExchange(conversationID, messageID, execution)
+		}
+	}
+	if errors.Is(err, models.ErrAgentNotFound) {
+		jrh.requestLogger(c).Error("agent not found", zap.String("agent_id", agentID), zap.Error(err))
+		return jrh.createJSONRPCError(req.ID, -32001, "Agent not found", fmt.Sprintf("Agent with ID %s not found", agentID))
+	}
+	if errors.Is(err, models.ErrAgentDeleted) {
+		return jrh.createJSONRPCError(req.ID, -32001, "Agent is deleted", map[string]interface{}{
+			"code":     api.CodeAgentDeleted,
+			"message":  err.Error(),
+			"agent_id": agentID,
+		})
+	}
+	if errors.Is(err, models.ErrAgentDisabled) {
+		return jrh.createJSONRPCError(req.ID, -32001, "Agent is disabled", map[string]interface{}{
+			"code":     api.CodeAgentDisabled,
+			"message":  err.Error(),
+			"agent_id": agentID,
+		})
+	}
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", err.Error())
+	}
+	if errors.Is(err, services.ErrExecutionQuotaExceeded) {
+		jrh.requestLogger(c).Warn("execution quota exceeded", zap.Error(err))
+		return jrh.createJSONRPCError(req.ID, rpcRateLimitedCode, "Rate limit exceeded", err.Error())
+	}
 	if err != nil {
-		jrh.logger.Error("agent execution failed", zap.Error(err))
-		return jrh.createJSONRPCError(req.ID, -32002, "Agent execution failed", err.Error())
+		jrh.requestLogger(c).Error("agent execution failed", zap.Error(err))
+		return jrh.createJSONRPCError(req.ID, -32002, "Agent execution failed", jrh.executionFailureData(c, execution, err))
+	}
+
+	// The agent is busy and the caller asked not to wait; the execution can be polled until it starts
+	if execution.State == models.QueuedState {
+		return JSONRPCResponse{
+			Jsonrpc: "2.0",
+			Result: map[string]interface{}{
+				"execution_id":      execution.ID,
+				"status":            string(execution.State),
+				"agent_id":          agentID,
+				"queue_position":    execution.QueuePosition,
+				"estimated_wait_ms": execution.EstimatedWaitMs,
+				"request_id":        c.GetString(logging.RequestIDKey),
+				"conversation_id":   conversationID,
+			},
+			ID: req.ID,
+		}
 	}
 
 	// Create result
 	result := map[string]interface{}{
 		"execution_id": execution.ID,
 		"status":       string(execution.State),
-		"output":       "Agent execution completed",
+		"output":       "",
 		"agent_id":     agentID,
+		"labels":       execution.Labels,
+		"exit_code":    execution.ExitCode,
+		"request_id":   c.GetString(logging.RequestIDKey),
+		"trigger_type": string(execution.TriggerType),
+		"triggered_by": execution.TriggeredBy,
+	}
+	if executionResult, resultErr := jrh.executionService.GetExecutionResult(execution.ID); resultErr == nil {
+		result["output"] = executionResult.Output
+		if executionResult.FromCache {
+			result["from_cache"] = true
+			result["cached_execution_id"] = executionResult.CachedExecutionID
+		}
+	}
+	if deduplicated {
+		result["deduplicated"] = true
+	}
+	if conversationID != "" {
+		result["conversation_id"] = conversationID
 	}
 
 	return JSONRPCResponse{
@@ -181,13 +337,78 @@ func (jrh *JSONRPCHandlers) handleExecuteAgent(c *gin.Context, req JSONRPCReques
 	}
 }
 
+// recordExchange adds the message an execution ran and the agent's reply to its conversation, if any
+func (jrh *JSONRPCHandlers) recordExchange(conversationID, messageID string, execution *models.AgentExecution) {
+	if jrh.conversations == nil || conversationID == "" {
+		return
+	}
+	output := ""
+	if result, err := jrh.executionService.GetExecutionResult(execution.ID); err == nil {
+		output = result.Output
+	}
+	jrh.conversations.RecordExecution(conversationID, messageID, execution, output)
+}
+
+// stderrTailBytes bounds how much stderr is echoed back in error responses
+const stderrTailBytes = 4096
+
+// executionFailureData describes a failed execution, including exit code and stderr tail when known
+func (jrh *JSONRPCHandlers) executionFailureData(c *gin.Context, execution *models.AgentExecution, err error) interface{} {
+	if execution == nil {
+		return err.Error()
+	}
+
+	data := map[string]interface{}{
+		"message":      err.Error(),
+		"execution_id": execution.ID,
+		"exit_code":    execution.ExitCode,
+		"request_id":   c.GetString(logging.RequestIDKey),
+	}
+	if result, resultErr := jrh.executionService.GetExecutionResult(execution.ID); resultErr == nil {
+		data["exit_code"] = result.ExitCode
+		data["stderr_tail"] = result.StderrTail(stderrTailBytes)
+		if result.Signal != "" {
+			data["signal"] = result.Signal
+		}
+	}
+
+	return data
+}
+
+// parseLabelsParam converts the optional labels param into a validated string map
+func parseLabelsParam(raw interface{}) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	rawLabels, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("labels must be an object of string values")
+	}
+
+	labels := make(map[string]string, len(rawLabels))
+	for key, value := range rawLabels {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("label %s must be a string", key)
+		}
+		labels[key] = str
+	}
+
+	if err := models.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
 // handleStatus handles status method
 func (jrh *JSONRPCHandlers) handleStatus(c *gin.Context, req JSONRPCRequest) JSONRPCResponse {
 	result := map[string]interface{}{
 		"status":       "healthy",
 		"uptime":       "running",
 		"version":      "1.0.0",
-		"capabilities": []string{"execute-agent", "status", "list-agents"},
+		"capabilities": jrh.capabilities(),
 	}
 
 	return JSONRPCResponse{
@@ -197,11 +418,118 @@ func (jrh *JSONRPCHandlers) handleStatus(c *gin.Context, req JSONRPCRequest) JSO
 	}
 }
 
+// handleNegotiate handles negotiate method, describing the protocol versions, methods, message size,
+// streaming and authentication the supervisor supports
+func (jrh *JSONRPCHandlers) handleNegotiate(c *gin.Context, req JSONRPCRequest) JSONRPCResponse {
+	return JSONRPCResponse{
+		Jsonrpc: "2.0",
+		Result:  jrh.config.Negotiate(jrh.capabilities()),
+		ID:      req.ID,
+	}
+}
+
+// capabilities lists the supported methods
+func (jrh *JSONRPCHandlers) capabilities() []string {
+	capabilities := []string{"negotiate", "execute-agent", "status", "list-agents"}
+	if jrh.pushNotifier != nil {
+		capabilities = append(capabilities, "tasks/pushNotificationConfig/set", "tasks/pushNotificationConfig/get")
+	}
+	return capabilities
+}
+
+// handleSetPushNotification handles tasks/pushNotificationConfig/set, registering a callback for when
+// the task (an execution) finishes
+func (jrh *JSONRPCHandlers) handleSetPushNotification(c *gin.Context, req JSONRPCRequest) JSONRPCResponse {
+	if jrh.pushNotifier == nil {
+		return jrh.createJSONRPCError(req.ID, rpcPushNotificationNotSupportedCode, "Push Notification is not supported", nil)
+	}
+
+	params, ok := req.Params.(map[string]interface{})
+	if !ok {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "Parameters must be an object")
+	}
+	taskID, _ := params["taskId"].(string)
+	if taskID == "" {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "taskId is required")
+	}
+	rawConfig, ok := params["pushNotificationConfig"].(map[string]interface{})
+	if !ok {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "pushNotificationConfig is required")
+	}
+	callbackURL, _ := rawConfig["url"].(string)
+	token, _ := rawConfig["token"].(string)
+
+	config, err := jrh.pushNotifier.SetTaskPushNotification(taskID, models.PushNotificationConfig{URL: callbackURL, Token: token})
+	if err != nil {
+		return jrh.pushNotificationError(c, req, taskID, err)
+	}
+
+	return JSONRPCResponse{
+		Jsonrpc: "2.0",
+		Result:  pushNotificationResult(taskID, config),
+		ID:      req.ID,
+	}
+}
+
+// handleGetPushNotification handles tasks/pushNotificationConfig/get, returning the registered callback
+// and its delivery status
+func (jrh *JSONRPCHandlers) handleGetPushNotification(c *gin.Context, req JSONRPCRequest) JSONRPCResponse {
+	if jrh.pushNotifier == nil {
+		return jrh.createJSONRPCError(req.ID, rpcPushNotificationNotSupportedCode, "Push Notification is not supported", nil)
+	}
+
+	params, ok := req.Params.(map[string]interface{})
+	if !ok {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "Parameters must be an object")
+	}
+	taskID, _ := params["id"].(string)
+	if taskID == "" {
+		taskID, _ = params["taskId"].(string)
+	}
+	if taskID == "" {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", "id is required")
+	}
+
+	config, err := jrh.pushNotifier.GetTaskPushNotification(taskID)
+	if err != nil {
+		return jrh.pushNotificationError(c, req, taskID, err)
+	}
+
+	return JSONRPCResponse{
+		Jsonrpc: "2.0",
+		Result:  pushNotificationResult(taskID, config),
+		ID:      req.ID,
+	}
+}
+
+// pushNotificationError maps errors of the push notification methods to JSON-RPC errors
+func (jrh *JSONRPCHandlers) pushNotificationError(c *gin.Context, req JSONRPCRequest, taskID string, err error) JSONRPCResponse {
+	if errors.Is(err, models.ErrExecutionNotFound) {
+		return jrh.createJSONRPCError(req.ID, rpcTaskNotFoundCode, "Task not found", fmt.Sprintf("Task with ID %s not found", taskID))
+	}
+	var validationErr models.ValidationError
+	if errors.As(err, &validationErr) {
+		return jrh.createJSONRPCError(req.ID, -32602, "Invalid params", err.Error())
+	}
+	jrh.requestLogger(c).Error("push notification request failed", zap.String("execution_id", taskID), zap.Error(err))
+	return jrh.createJSONRPCError(req.ID, -32603, "Internal error", err.Error())
+}
+
+// pushNotificationResult is the TaskPushNotificationConfig returned by both methods; config is nil when
+// no callback is registered
+func pushNotificationResult(taskID string, config *models.PushNotificationConfig) map[string]interface{} {
+	result := map[string]interface{}{"taskId": taskID}
+	if config != nil {
+		result["pushNotificationConfig"] = config
+	}
+	return result
+}
+
 // handleListAgents handles list-agents method
 func (jrh *JSONRPCHandlers) handleListAgents(c *gin.Context, req JSONRPCRequest) JSONRPCResponse {
 	agents, err := jrh.agentService.ListAgents()
 	if err != nil {
-		jrh.logger.Error("failed to list agents", zap.Error(err))
+		jrh.requestLogger(c).Error("failed to list agents", zap.Error(err))
 		return jrh.createJSONRPCError(req.ID, -32603, "Internal error", "Failed to list agents")
 	}
 
@@ -230,7 +558,7 @@ func (jrh *JSONRPCHandlers) handleListAgents(c *gin.Context, req JSONRPCRequest)
 }
 
 // createJSONRPCError creates a JSON-RPC error response
-func (jrh *JSONRPCHandlers) createJSONRPCError(id interface{}, code int, message, data string) JSONRPCResponse {
+func (jrh *JSONRPCHandlers) createJSONRPCError(id interface{}, code int, message string, data interface{}) JSONRPCResponse {
 	return JSONRPCResponse{
 		Jsonrpc: "2.0",
 		Error: &RPCError{
@@ -241,47 +569,3 @@ func (jrh *JSONRPCHandlers) createJSONRPCError(id interface{}, code int, message
 		ID: id,
 	}
 }
-
-// SimpleJSONRPCAgent is a wrapper to make our agent configuration compatible with the execution service
-type SimpleJSONRPCAgent struct {
-	config *models.AgentConfiguration
-}
-
-func (sjra *SimpleJSONRPCAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
-	// In a real implementation, this would execute the actual agent process
-	// For this implementation, we'll return a mock result
-	result := &models.ExecutionResult{
-		ID:        "jsonrpc-" + time.Now().Format("20060102-150405"),
-		AgentID:   sjra.config.ID,
-		Status:    models.SuccessStatus,
-		Input:     input,
-		Output:    fmt.Sprintf("Executed command: %s with input: %s", sjra.config.ExecutablePath, input),
-		StartTime: time.Now(),
-		EndTime:   time.Now(),
-	}
-	return result, nil
-}
-
-func (sjra *SimpleJSONRPCAgent) GetID() string {
-	return sjra.config.ID
-}
-
-func (sjra *SimpleJSONRPCAgent) GetName() string {
-	return sjra.config.Name
-}
-
-func (sjra *SimpleJSONRPCAgent) GetType() string {
-	return sjra.config.AgentType
-}
-
-func (sjra *SimpleJSONRPCAgent) IsReadOnly() bool {
-	return sjra.config.AccessType == models.ReadOnlyAccessType
-}
-
-func (sjra *SimpleJSONRPCAgent) GetConfig() *models.AgentConfiguration {
-	return sjra.config
-}
-
-func (sjra *SimpleJSONRPCAgent) Validate() error {
-	return sjra.config.Validate()
-}
\ No newline at end of file
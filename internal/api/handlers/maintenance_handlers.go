@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MaintenanceHandlers handles REST requests about agent maintenance windows
+type MaintenanceHandlers struct {
+	maintenance *services.MaintenanceService
+	logger      *zap.Logger
+}
+
+// MaintenanceRequest is the request body of POST /api/v1/agents/:agentId/maintenance
+type MaintenanceRequest struct {
+	Duration string `json:"duration" binding:"required"` // How long the window lasts from now, e.g. "1h"
+	Reason   string `json:"reason,omitempty"`
+}
+
+// NewMaintenanceHandlers creates a new instance of MaintenanceHandlers
+func NewMaintenanceHandlers(maintenance *services.MaintenanceService, logger *zap.Logger) *MaintenanceHandlers {
+	return &MaintenanceHandlers{
+		maintenance: maintenance,
+		logger:      logger,
+	}
+}
+
+// RegisterMaintenanceRoutes registers the maintenance routes
+func (mh *MaintenanceHandlers) RegisterMaintenanceRoutes(router gin.IRouter) {
+	router.GET("/agents/:agentId/maintenance", mh.GetMaintenance)
+	router.POST("/agents/:agentId/maintenance", mh.BeginMaintenance)
+	router.DELETE("/agents/:agentId/maintenance", mh.EndMaintenance)
+}
+
+// GetMaintenance returns an agent's current and next maintenance periods
+func (mh *MaintenanceHandlers) GetMaintenance(c *gin.Context) {
+	status, err := mh.maintenance.Status(c.Param("agentId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get agent maintenance")
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// BeginMaintenance puts an agent in an ad-hoc maintenance window starting now, replacing the ad-hoc
+// window it is in, and returns its maintenance periods
+func (mh *MaintenanceHandlers) BeginMaintenance(c *gin.Context) {
+	agentID := c.Param("agentId")
+
+	var request MaintenanceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	duration, err := time.ParseDuration(request.Duration)
+	if err != nil || duration <= 0 {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed,
+			fmt.Sprintf("duration must be a positive duration such as '1h30m', got %q", request.Duration))
+		return
+	}
+
+	if _, err := mh.maintenance.Begin(agentID, duration, request.Reason, callerID(c)); err != nil {
+		logging.LoggerFromContext(c.Request.Context(), mh.logger).Warn("failed to begin agent maintenance",
+			zap.String("agent_id", agentID),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to begin agent maintenance")
+		return
+	}
+	mh.GetMaintenance(c)
+}
+
+// EndMaintenance ends an agent's ad-hoc maintenance window early and returns its maintenance
+// periods; its recurring windows still apply
+func (mh *MaintenanceHandlers) EndMaintenance(c *gin.Context) {
+	agentID := c.Param("agentId")
+	if !mh.maintenance.End(agentID) {
+		logging.LoggerFromContext(c.Request.Context(), mh.logger).Debug("agent was in no ad-hoc maintenance window",
+			zap.String("agent_id", agentID))
+	}
+	mh.GetMaintenance(c)
+}
+
+// warnMaintenance adds a Warning header to manual operations on an agent in maintenance, which
+// still run
+func warnMaintenance(c *gin.Context, maintenance *services.MaintenanceService, agentID, operation string, logger *zap.Logger) {
+	if maintenance == nil {
+		return
+	}
+	period, ok := maintenance.InMaintenance(agentID)
+	if !ok {
+		return
+	}
+
+	message := fmt.Sprintf("agent %s is in maintenance until %s", agentID, period.End.Format(time.RFC3339))
+	if period.Reason != "" {
+		message += ": " + period.Reason
+	}
+	c.Header("Warning", fmt.Sprintf("299 - %q", message))
+	logging.LoggerFromContext(c.Request.Context(), logger).Warn("manual operation on agent in maintenance",
+		zap.String("agent_id", agentID),
+		zap.String("operation", operation),
+		zap.Time("until", period.End))
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PatternMatrixResponse lists the agent input and output patterns and which pairs of them an agent
+// may combine
+type PatternMatrixResponse struct {
+	InputPatterns  []types.InputPattern         `json:"input_patterns"`
+	OutputPatterns []types.OutputPattern        `json:"output_patterns"`
+	Matrix         []types.PatternCompatibility `json:"matrix"`
+}
+
+// MetaHandlers describes the settings agents accept, so clients can check them before registering
+type MetaHandlers struct {
+	logger *zap.Logger
+}
+
+// NewMetaHandlers creates a new instance of MetaHandlers
+func NewMetaHandlers(logger *zap.Logger) *MetaHandlers {
+	return &MetaHandlers{
+		logger: logger,
+	}
+}
+
+// RegisterMetaRoutes registers the meta routes
+func (mh *MetaHandlers) RegisterMetaRoutes(router gin.IRouter) {
+	router.GET("/meta/patterns", mh.GetPatternMatrix)
+}
+
+// GetPatternMatrix returns the input/output pattern compatibility matrix
+func (mh *MetaHandlers) GetPatternMatrix(c *gin.Context) {
+	c.JSON(http.StatusOK, PatternMatrixResponse{
+		InputPatterns:  types.InputPatterns,
+		OutputPatterns: types.OutputPatterns,
+		Matrix:         types.PatternMatrix(),
+	})
+}
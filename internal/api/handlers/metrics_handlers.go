@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MetricsHandlers handles metrics API requests
+type MetricsHandlers struct {
+	collector    *services.MetricsCollector
+	agentService services.IAgentService
+	logger       *zap.Logger
+}
+
+// AgentMetricsSummary is the response of GET /metrics/json
+type AgentMetricsSummary struct {
+	WindowSeconds float64                `json:"window_seconds"` // Sliding window of the duration percentiles
+	Agents        []services.AgentMetric `json:"agents"`
+	Total         int                    `json:"total"`
+}
+
+// NewMetricsHandlers creates a new instance of MetricsHandlers. When agentService is nil, unknown
+// agents are reported with empty metrics instead of as not found.
+func NewMetricsHandlers(collector *services.MetricsCollector, agentService services.IAgentService, logger *zap.Logger) *MetricsHandlers {
+	return &MetricsHandlers{
+		collector:    collector,
+		agentService: agentService,
+		logger:       logger,
+	}
+}
+
+// RegisterMetricsRoutes registers the system-wide metrics routes
+func (mh *MetricsHandlers) RegisterMetricsRoutes(router gin.IRouter) {
+	router.GET("/metrics", mh.GetMetrics)
+	router.GET("/metrics/json", mh.GetAgentMetricsSummary)
+}
+
+// RegisterAgentMetricsRoutes registers the per-agent metrics routes
+func (mh *MetricsHandlers) RegisterAgentMetricsRoutes(router gin.IRouter) {
+	agentGroup := router.Group("/agents")
+
+	agentGroup.GET("/:agentId/metrics", mh.GetAgentMetrics)
+}
+
+// GetMetrics returns all system metrics
+func (mh *MetricsHandlers) GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, mh.collector.GetOverallMetrics())
+}
+
+// GetAgentMetricsSummary returns the metrics of every agent that has run, ordered by agent ID
+func (mh *MetricsHandlers) GetAgentMetricsSummary(c *gin.Context) {
+	metrics := mh.collector.GetAllAgentMetrics()
+
+	agents := make([]services.AgentMetric, 0, len(metrics))
+	for _, metric := range metrics {
+		agents = append(agents, *metric)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+
+	c.JSON(http.StatusOK, AgentMetricsSummary{
+		WindowSeconds: mh.collector.DurationWindow().Seconds(),
+		Agents:        agents,
+		Total:         len(agents),
+	})
+}
+
+// GetAgentMetrics returns the metrics of one agent
+func (mh *MetricsHandlers) GetAgentMetrics(c *gin.Context) {
+	agentID := c.Param("agentId")
+
+	if mh.agentService != nil {
+		if _, err := mh.agentService.GetAgent(agentID); err != nil {
+			api.RespondServiceError(c, err, "Failed to get agent metrics")
+			return
+		}
+	}
+
+	metric, exists := mh.collector.GetAgentMetrics(agentID)
+	if !exists {
+		metric = &services.AgentMetric{ID: agentID}
+	}
+
+	c.JSON(http.StatusOK, metric)
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/openapi"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// APIVersion is the version reported in the OpenAPI document
+const APIVersion = "1.0.0"
+
+//go:embed swagger_ui.html
+var swaggerUIPage []byte
+
+// taskActionResponse is returned by task mutation endpoints
+type taskActionResponse struct {
+	Message string `json:"message"`
+	TaskID  string `json:"task_id"`
+}
+
+// APIRoutes lists every documented HTTP endpoint; keep it in sync with the Register*Routes functions
+func APIRoutes() []openapi.Route {
+	labelQuery := openapi.Parameter{Name: "label", In: "query", Description: "Label selector key=value, may be repeated", Schema: openapi.Schema{"type": "array", "items": openapi.Schema{"type": "string"}}}
+	revealParameter := openapi.Parameter{Name: "reveal", In: "query", Description: "Return secret environment values unmasked; 403 unless secrets.allow_reveal permits the caller, always audited", Schema: openapi.Schema{"type": "boolean"}}
+	dryRunQuery := openapi.Parameter{Name: "dry_run", In: "query", Description: "Check preconditions and return the planned OperationResult without performing the operation", Schema: openapi.Schema{"type": "boolean"}}
+	idempotencyHeader := openapi.Parameter{Name: IdempotencyKeyHeader, In: "header", Description: "Repeating a key for the same agent returns the first request's execution instead of running again", Schema: openapi.Schema{"type": "string"}}
+	agentQuery := openapi.Parameter{Name: "agent_id", In: "query", Description: "Only return executions of this agent", Schema: openapi.Schema{"type": "string"}}
+	triggerTypeQuery := openapi.Parameter{Name: "trigger_type", In: "query", Description: "Only return executions started this way: scheduled, catch_up, manual, api, jsonrpc, grpc or a2a", Schema: openapi.Schema{"type": "string"}}
+	triggeredByQuery := openapi.Parameter{Name: "triggered_by", In: "query", Description: "Only return executions started by this client identity or scheduler:<task id>", Schema: openapi.Schema{"type": "string"}}
+	taskQuery := openapi.Parameter{Name: "task_id", In: "query", Description: "Only return executions run for this scheduled task", Schema: openapi.Schema{"type": "string"}}
+	anomalousQuery := openapi.Parameter{Name: "anomalous", In: "query", Description: "Only return executions flagged with anomalies when true, or only unflagged ones when false", Schema: openapi.Schema{"type": "boolean"}}
+	waitQuery := openapi.Parameter{Name: "wait", In: "query", Description: "Wait for a conflicting operation on the agent to finish instead of failing with 409 OPERATION_IN_PROGRESS", Schema: openapi.Schema{"type": "boolean"}}
+	batchQuery := []openapi.Parameter{
+		{Name: "force", In: "query", Description: "Include protected agents in a group or pattern operation", Schema: openapi.Schema{"type": "boolean"}},
+		{Name: "confirm", In: "query", Description: "Confirmation token of the 428 CONFIRMATION_REQUIRED response to an operation on many agents", Schema: openapi.Schema{"type": "string"}},
+		{Name: "dry_run", In: "query", Description: "Check preconditions and return the planned OperationResult, or BatchOperationResult for a group or pattern, without performing the operation", Schema: openapi.Schema{"type": "boolean"}},
+	}
+	triggerTypeHeader := openapi.Parameter{Name: TriggerTypeHeader, In: "header", Description: "Set to manual when a person started the execution, e.g. from supervisorctl; defaults to api", Schema: openapi.Schema{"type": "string", "enum": []string{"api", "manual"}}}
+	pageQuery := []openapi.Parameter{
+		{Name: "sort", In: "query", Description: "Field to sort by; ties are broken by ID", Schema: openapi.Schema{"type": "string", "enum": []string{"id", "name", "created_at"}, "default": "id"}},
+		{Name: "order", In: "query", Description: "Sort direction", Schema: openapi.Schema{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}},
+		{Name: "limit", In: "query", Description: "Results per page, 0 for all", Schema: openapi.Schema{"type": "integer", "minimum": 0}},
+		{Name: "offset", In: "query", Description: "Results skipped before the page", Schema: openapi.Schema{"type": "integer", "minimum": 0}},
+	}
+	enabledQuery := openapi.Parameter{Name: "enabled", In: "query", Description: "Only return enabled, or disabled, items", Schema: openapi.Schema{"type": "boolean"}}
+	statusPollQuery := []openapi.Parameter{
+		{Name: "If-None-Match", In: "header", Description: "ETag of a status seen before; 304 Not Modified while it is still current", Schema: openapi.Schema{"type": "string"}},
+		{Name: "etag", In: "query", Description: "ETag of a status seen before, like If-None-Match", Schema: openapi.Schema{"type": "string"}},
+		{Name: "wait", In: "query", Description: "Hold a request whose ETag is current until the status changes or this duration, at most 60s, expires", Schema: openapi.Schema{"type": "string", "example": "30s"}},
+	}
+
+	return []openapi.Route{
+		// Health and metrics
+		{Method: http.MethodGet, Path: "/health", OperationID: "getHealth", Summary: "Service health", Tag: "system", Permission: openapi.PermissionPublic,
+			Response: struct {
+				Status    string    `json:"status"`
+				Service   string    `json:"service"`
+				Timestamp time.Time `json:"timestamp"`
+			}{}},
+		{Method: http.MethodGet, Path: "/health/live", OperationID: "getLiveness", Summary: "Liveness probe: the process responds", Tag: "system", Permission: openapi.PermissionPublic,
+			Response: struct {
+				Status string `json:"status"`
+			}{}},
+		{Method: http.MethodGet, Path: "/health/ready", OperationID: "getReadiness", Summary: "Readiness probe: the scheduler runs, persistence is writable and the execution backlog is within bounds; 503 otherwise", Tag: "system", Permission: openapi.PermissionPublic, Response: services.Readiness{}},
+		{Method: http.MethodGet, Path: "/api/v1/server/info", OperationID: "getServerInfo", Summary: "Version, build, runtime and workload info of the supervisor", Tag: "system", Response: services.ServerInfo{}},
+		{Method: http.MethodGet, Path: "/api/v1/meta/patterns", OperationID: "getPatternMatrix", Summary: "Which input and output patterns an agent may combine, with the reason each incompatible pair is rejected", Tag: "agents", Response: PatternMatrixResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/events", OperationID: "streamEvents", Summary: "Server-sent events of execution state changes and progress, hung agents, execution anomalies, task runs, agent process failures and webhook deliveries; slow clients are sent events.dropped notices so they can resync through the query APIs", Tag: "system",
+			Query: []openapi.Parameter{
+				{Name: "types", In: "query", Description: "Comma-separated event types to receive, all when empty", Schema: openapi.Schema{"type": "string"}},
+				{Name: "agent_id", In: "query", Description: "Only receive events about this agent", Schema: openapi.Schema{"type": "string"}},
+				{Name: "buffer", In: "query", Description: "Events buffered for the client before the oldest are dropped", Schema: openapi.Schema{"type": "integer", "minimum": 1, "maximum": services.MaxEventBufferSize, "default": services.DefaultEventBufferSize}},
+				{Name: "overflow", In: "query", Description: "What happens once the buffer is full: drop the oldest events, or also disconnect the client once it lags more than lag_limit events", Schema: openapi.Schema{"type": "string", "enum": []string{"drop", "disconnect"}, "default": "drop"}},
+				{Name: "lag_limit", In: "query", Description: "Unread events tolerated before a client with overflow=disconnect is disconnected, the buffer size by default", Schema: openapi.Schema{"type": "integer", "minimum": 1}},
+			},
+			Response: models.Event{}, ContentType: "text/event-stream"},
+		{Method: http.MethodGet, Path: "/api/v1/events/stats", OperationID: "getEventStats", Summary: "Events published on the event bus, and delivered to and dropped by its subscribers by subscriber type", Tag: "system", Response: models.EventBusStats{}},
+		{Method: http.MethodGet, Path: "/api/v1/orphans", OperationID: "listOrphans", Summary: "Agent processes a previous supervisor left running that have not been adopted or terminated", Tag: "system",
+			Query: []openapi.Parameter{{Name: "all", In: "query", Description: "Also return orphans that were adopted, terminated or have exited", Schema: openapi.Schema{"type": "boolean"}}},
+			Response: struct {
+				Orphans []models.OrphanProcess `json:"orphans"`
+				Total   int                    `json:"total"`
+			}{}},
+		{Method: http.MethodGet, Path: "/metrics/prometheus", OperationID: "getPrometheusMetrics", Summary: "Supervisor, Go runtime and process metrics in the Prometheus text format", Tag: "system", Response: "", ContentType: "text/plain"},
+		{Method: http.MethodGet, Path: "/metrics", OperationID: "getMetrics", Summary: "Execution metrics", Tag: "system"},
+		{Method: http.MethodGet, Path: "/metrics/json", OperationID: "getAgentMetricsSummary", Summary: "Metrics of every agent that has run", Tag: "system", Response: AgentMetricsSummary{}},
+
+		// Scheduled tasks
+		{Method: http.MethodGet, Path: "/tasks", OperationID: "listTasks", Summary: "List scheduled tasks ordered by ID; total counts the matches across all pages", Tag: "tasks",
+			Query: append([]openapi.Parameter{enabledQuery, {Name: "agent_id", In: "query", Description: "Only return tasks running this agent", Schema: openapi.Schema{"type": "string"}}}, pageQuery...),
+			Response: struct {
+				Tasks  []models.ScheduledTask `json:"tasks"`
+				Total  int                    `json:"total"`
+				Limit  int                    `json:"limit"`
+				Offset int                    `json:"offset"`
+			}{}},
+		{Method: http.MethodPost, Path: "/tasks", OperationID: "createTask", Summary: "Create a scheduled task", Tag: "tasks", Status: http.StatusCreated,
+			Request: ScheduledTaskRequest{},
+			Response: struct {
+				Message       string      `json:"message"`
+				TaskID        string      `json:"task_id"`
+				NextFireTimes []time.Time `json:"next_fire_times"`
+			}{}},
+		{Method: http.MethodGet, Path: "/tasks/:taskId", OperationID: "getTask", Summary: "Get a scheduled task", Tag: "tasks", Response: models.ScheduledTask{}},
+		{Method: http.MethodGet, Path: "/tasks/:taskId/schedule", OperationID: "getTaskSchedule", Summary: "Upcoming fire times of a task, in the scheduler's time zone and UTC", Tag: "tasks",
+			Query:    []openapi.Parameter{{Name: "count", In: "query", Description: "Number of upcoming runs, 5 by default", Schema: openapi.Schema{"type": "integer", "minimum": 1, "maximum": services.MaxNextRuns}}},
+			Response: TaskScheduleResponse{}},
+		{Method: http.MethodPut, Path: "/tasks/:taskId", OperationID: "updateTask", Summary: "Update a scheduled task", Tag: "tasks", Request: ScheduledTaskRequest{}, Response: taskActionResponse{}},
+		{Method: http.MethodDelete, Path: "/tasks/:taskId", OperationID: "deleteTask", Summary: "Delete a scheduled task", Tag: "tasks", Query: []openapi.Parameter{dryRunQuery}, Response: taskActionResponse{}},
+		{Method: http.MethodPost, Path: "/tasks/:taskId/execute", OperationID: "executeTask", Summary: "Run a task immediately", Tag: "tasks", Permission: string(models.PermissionExecute),
+			Query: []openapi.Parameter{dryRunQuery},
+			Response: struct {
+				Message string                 `json:"message"`
+				TaskID  string                 `json:"task_id"`
+				Result  map[string]interface{} `json:"result"`
+			}{}},
+		{Method: http.MethodPost, Path: "/tasks/:taskId/preview-input", OperationID: "previewTaskInput", Summary: "Render the input a run of the task would receive now, without running it", Tag: "tasks", Permission: string(models.PermissionRead),
+			Response: struct {
+				TaskID string `json:"task_id"`
+				Input  string `json:"input"`
+			}{}},
+		{Method: http.MethodPost, Path: "/tasks/:taskId/pause", OperationID: "pauseTask", Summary: "Pause a scheduled task", Tag: "tasks", Permission: string(models.PermissionOperate), Query: []openapi.Parameter{dryRunQuery}, Response: taskActionResponse{}},
+		{Method: http.MethodPost, Path: "/tasks/:taskId/resume", OperationID: "resumeTask", Summary: "Resume a paused task", Tag: "tasks", Permission: string(models.PermissionOperate), Query: []openapi.Parameter{dryRunQuery}, Response: taskActionResponse{}},
+		{Method: http.MethodPost, Path: "/tasks/:taskId/cancel-active", OperationID: "cancelActiveTaskRuns", Summary: "Cancel every queued, starting and running execution a task started, reporting the outcome per execution", Tag: "tasks", Permission: string(models.PermissionOperate), Response: models.CancelAllResult{}},
+		{Method: http.MethodPost, Path: "/tasks/bulk", OperationID: "bulkTaskOperation", Summary: "Pause, resume, delete or run every task matching a selector", Tag: "tasks",
+			Query: []openapi.Parameter{dryRunQuery}, Request: BulkTaskRequest{}, Response: models.BatchOperationResult{}},
+
+		// Executions
+		{Method: http.MethodGet, Path: "/api/v1/executions", OperationID: "listExecutions", Summary: "List executions", Tag: "executions",
+			Query: []openapi.Parameter{agentQuery, labelQuery, triggerTypeQuery, triggeredByQuery, taskQuery, anomalousQuery},
+			Response: struct {
+				Executions []models.AgentExecution `json:"executions"`
+				Total      int                     `json:"total"`
+			}{}},
+		{Method: http.MethodGet, Path: "/api/v1/executions/export", OperationID: "exportExecutions", Tag: "executions",
+			Summary: "Stream the matching executions as JSON lines or CSV for offline analysis, gzipped when accepted; the configured export labels get a label_<key> column",
+			Query: []openapi.Parameter{
+				{Name: "format", In: "query", Description: "jsonl (default) or csv", Schema: openapi.Schema{"type": "string", "enum": []string{models.ExportFormatJSONL, models.ExportFormatCSV}}},
+				agentQuery, labelQuery,
+				{Name: "since", In: "query", Description: "Only export executions started at or after this RFC 3339 time", Schema: openapi.Schema{"type": "string", "format": "date-time"}},
+				{Name: "until", In: "query", Description: "Only export executions started before this RFC 3339 time", Schema: openapi.Schema{"type": "string", "format": "date-time"}},
+			},
+			Response: models.ExecutionExportRecord{}, ContentType: "application/x-ndjson"},
+		{Method: http.MethodGet, Path: "/api/v1/executions/:executionId", OperationID: "getExecution", Summary: "Get an execution and its result", Tag: "executions",
+			Response: struct {
+				Execution models.AgentExecution   `json:"execution"`
+				Result    *models.ExecutionResult `json:"result,omitempty"`
+			}{}},
+		{Method: http.MethodGet, Path: "/api/v1/conversations/:conversationId", OperationID: "getConversation", Tag: "executions",
+			Summary:  "The ordered exchanges of an A2A conversation that has not expired, with the executions its messages ran",
+			Response: ConversationResponse{}},
+		{Method: http.MethodPost, Path: "/api/v1/executions/:executionId/stop", OperationID: "stopExecution", Tag: "executions", Permission: string(models.PermissionOperate), Status: http.StatusAccepted,
+			Summary: "Cancel a running execution, sending its agent the stop signal and killing it after the stop wait",
+			Query:   []openapi.Parameter{{Name: "signal", In: "query", Description: "Signal to send instead of the agent's stop_signal: TERM, INT, QUIT, HUP, USR1, USR2 or KILL", Schema: openapi.Schema{"type": "string"}}},
+			Response: struct {
+				Execution models.AgentExecution `json:"execution"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/executions/:executionId/extend", OperationID: "extendExecution", Tag: "executions", Permission: string(models.PermissionOperate),
+			Summary: "Push the deadline of a running execution out, up to its agent's max_total_timeout",
+			Request: ExtendExecutionRequest{}, Response: models.DeadlineExtension{}},
+		{Method: http.MethodPost, Path: "/api/v1/executions/:executionId/replay", OperationID: "replayExecution", Tag: "executions", Permission: string(models.PermissionExecute),
+			Summary: "Run an execution again with its recorded input, parameters, env overrides and working directory, changed by the body's fields; 202 with async. Warns when the executable changed since",
+			Query:   []openapi.Parameter{triggerTypeHeader}, Request: ReplayExecutionRequest{}, Response: ReplayExecutionResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/executions/:executionId/diff/:otherId", OperationID: "diffExecutions", Tag: "executions",
+			Summary: "Compare two finished executions: state, status, exit code, duration delta, inputs and a unified diff of their outputs",
+			Query: []openapi.Parameter{
+				{Name: "limit", In: "query", Description: "Bytes of output diff returned, 65536 by default", Schema: openapi.Schema{"type": "integer", "minimum": 1}},
+			},
+			Response: models.ExecutionDiff{}},
+		{Method: http.MethodGet, Path: "/api/v1/executions/:executionId/snapshot", OperationID: "getExecutionSnapshot", Tag: "executions",
+			Summary:  "Get the environment an execution's agent process saw: executable path and SHA-256, argv, working directory, env var names, supervisor version, agent config revision and host",
+			Response: models.ExecutionSnapshot{}},
+		{Method: http.MethodGet, Path: "/api/v1/executions/:executionId/artifacts", OperationID: "listExecutionArtifacts", Summary: "List the files an execution left in $SUPERVISOR_ARTIFACTS_DIR", Tag: "executions",
+			Response: struct {
+				ExecutionID       string                    `json:"execution_id"`
+				Artifacts         []models.Artifact         `json:"artifacts"`
+				RejectedArtifacts []models.RejectedArtifact `json:"rejected_artifacts,omitempty"`
+				Total             int                       `json:"total"`
+			}{}},
+		{Method: http.MethodGet, Path: "/api/v1/executions/:executionId/artifacts/:name", OperationID: "getExecutionArtifact", Summary: "Download an execution artifact; Range requests are supported", Tag: "executions",
+			Response: "", ContentType: "application/octet-stream"},
+
+		// Agents
+		{Method: http.MethodPost, Path: "/api/v1/agents", OperationID: "createAgent", Summary: "Register an agent, merging in the settings of its template", Tag: "agents", Status: http.StatusCreated,
+			Request: models.AgentConfiguration{}, Response: models.AgentConfiguration{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents", OperationID: "listAgents", Summary: "List agents ordered by ID, their secret environment values masked; total counts the matches across all pages", Tag: "agents",
+			Query: append([]openapi.Parameter{
+				{Name: "include_deleted", In: "query", Description: "Also return soft-deleted agents", Schema: openapi.Schema{"type": "boolean"}},
+				enabledQuery,
+				{Name: "access_type", In: "query", Description: "Only return agents with this access type", Schema: openapi.Schema{"type": "string", "enum": []string{"read-only", "read-write", "read_only", "read_write"}}},
+				revealParameter,
+			}, pageQuery...),
+			Response: struct {
+				Agents []models.AgentConfiguration `json:"agents"`
+				Total  int                         `json:"total"`
+				Limit  int                         `json:"limit"`
+				Offset int                         `json:"offset"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/reapply-defaults", OperationID: "reapplyAgentDefaults", Tag: "agents",
+			Summary: "Merge the current defaults.agent settings into the named agents, or every agent, which otherwise keep the defaults they were registered with; reports the settings each agent changes",
+			Query:   []openapi.Parameter{{Name: "dry_run", In: "query", Description: "Report the settings each agent would change without changing them", Schema: openapi.Schema{"type": "boolean"}}},
+			Request: ReapplyDefaultsRequest{}, Response: models.ReapplyDefaultsResult{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/:agentId", OperationID: "getAgent", Summary: "Get an agent's effective configuration, merged with its template and the defaults, its secret environment values masked", Tag: "agents",
+			Query: []openapi.Parameter{
+				{Name: "raw", In: "query", Description: "Return the configuration as it was submitted, before its template and the defaults were merged in", Schema: openapi.Schema{"type": "boolean"}},
+				revealParameter,
+			}, Response: models.AgentConfiguration{}},
+		{Method: http.MethodDelete, Path: "/api/v1/agents/:agentId", OperationID: "deleteAgent", Summary: "Soft-delete an agent; 409 AGENT_IN_USE lists the scheduled tasks running it unless force is set", Tag: "agents",
+			Query:    []openapi.Parameter{{Name: "force", In: "query", Description: "Delete even while scheduled tasks run the agent, pausing the active ones", Schema: openapi.Schema{"type": "boolean"}}},
+			Response: services.AgentDeleteResult{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/restore", OperationID: "restoreAgent", Summary: "Restore a soft-deleted agent; tasks paused by its deletion stay paused", Tag: "agents", Response: models.AgentConfiguration{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/status", OperationID: "listAgentStatuses", Summary: "Get the runtime status of every agent, under an ETag; conditional requests may long-poll for a change", Tag: "agents",
+			Query: statusPollQuery, Response: AgentStatusesResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/:agentId/status", OperationID: "getAgentStatus", Summary: "Get an agent's runtime status: idle, running, disabled, deleted or error, under an ETag; conditional requests may long-poll for a change", Tag: "agents",
+			Query: statusPollQuery, Response: services.AgentStatus{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/execute", OperationID: "executeAgent", Tag: "agents", Permission: string(models.PermissionExecute),
+			Summary: "Run an agent and return its result; with async, or with queue_behavior return_position while the agent is busy, returns 202 with the execution to poll instead. input_base64 or input_url hand the agent binary input as a file",
+			Query:   []openapi.Parameter{idempotencyHeader, triggerTypeHeader},
+			Request: AgentExecuteRequest{}, Response: models.ExecutionResult{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/execute/stream", OperationID: "streamExecuteAgent", Tag: "agents", Permission: string(models.PermissionExecute),
+			Summary: "Run an agent and stream state, output, progress and heartbeat events, ending with a result event",
+			Query:   []openapi.Parameter{idempotencyHeader, triggerTypeHeader},
+			Request: AgentStreamRequest{}, Response: "", ContentType: "text/event-stream"},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/execute/upload", OperationID: "uploadExecuteAgent", Tag: "agents", Permission: string(models.PermissionExecute),
+			Summary:  "Run an agent on an uploaded file, sent as the body or as the file part of multipart/form-data with an optional request part; file-pattern agents read it as their input file, others at $SUPERVISOR_INPUT_FILE",
+			Query:    []openapi.Parameter{idempotencyHeader, triggerTypeHeader},
+			Response: models.ExecutionResult{}},
+		// Lifecycle routes take group:<name> or an agent pattern such as * or prefix:payments- as the agent ID to operate on several agents, returning a GroupOperationResult
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/disable", OperationID: "disableAgent", Summary: "Reject new executions of an agent; in-flight ones finish unless cancel_active is set", Tag: "agents", Permission: string(models.PermissionOperate),
+			Query:    append([]openapi.Parameter{{Name: "cancel_active", In: "query", Description: "Cancel the agent's in-flight executions", Schema: openapi.Schema{"type": "boolean"}}, waitQuery}, batchQuery...),
+			Response: services.AgentToggleResult{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/enable", OperationID: "enableAgent", Summary: "Let a disabled agent accept executions again", Tag: "agents", Permission: string(models.PermissionOperate),
+			Query: append([]openapi.Parameter{waitQuery}, batchQuery...), Response: services.AgentToggleResult{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/restart", OperationID: "restartAgent", Summary: "Cancel an agent's in-flight executions, wait for them to exit and enable it, after running a persistent agent's pre-stop hook; 409 HOOK_FAILED when the hook fails with on_failure abort", Tag: "agents", Permission: string(models.PermissionOperate),
+			Query: append([]openapi.Parameter{waitQuery}, batchQuery...), Response: services.AgentToggleResult{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/start", OperationID: "startAgent", Summary: "Start a persistent agent's process, clearing its failed starts and the fatal state", Tag: "agents", Permission: string(models.PermissionOperate),
+			Query: append([]openapi.Parameter{waitQuery}, batchQuery...), Response: models.ProcessStatus{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/:agentId/attach", OperationID: "attachAgent", Tag: "agents", Permission: string(models.PermissionOperate),
+			Summary:  "Attach a WebSocket to a persistent agent's running process, like supervisorctl fg: binary messages start with their channel byte, 0 for stdin from the client, 1 and 2 for stdout and stderr and 3 for why the server ended the session; closing the WebSocket detaches and leaves the process running. 409 ATTACH_CONFLICT while another session is attached",
+			Response: "", Status: http.StatusSwitchingProtocols, ContentType: "application/octet-stream"},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/cancel-all", OperationID: "cancelAllAgentExecutions", Summary: "Cancel every queued, starting and running execution of an agent, reporting the outcome per execution", Tag: "agents", Permission: string(models.PermissionOperate),
+			Response: models.CancelAllResult{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/:agentId/operations/current", OperationID: "getCurrentAgentOperation", Summary: "The lifecycle operation in progress on an agent; 204 when there is none", Tag: "agents",
+			Response: models.OperationResult{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/:agentId/maintenance", OperationID: "getAgentMaintenance", Summary: "An agent's current and next maintenance periods, from its own windows, global windows and ad-hoc windows", Tag: "agents",
+			Response: models.MaintenanceStatus{}},
+		{Method: http.MethodPost, Path: "/api/v1/agents/:agentId/maintenance", OperationID: "beginAgentMaintenance", Tag: "agents", Permission: string(models.PermissionOperate),
+			Summary: "Put an agent in maintenance from now for the duration: its scheduled runs are skipped, it is not restarted automatically and manual operations answer with a Warning header",
+			Request: MaintenanceRequest{}, Response: models.MaintenanceStatus{}},
+		{Method: http.MethodDelete, Path: "/api/v1/agents/:agentId/maintenance", OperationID: "endAgentMaintenance", Summary: "End an agent's ad-hoc maintenance window early; its recurring windows still apply", Tag: "agents", Permission: string(models.PermissionOperate),
+			Response: models.MaintenanceStatus{}},
+		{Method: http.MethodGet, Path: "/api/v1/agents/:agentId/metrics", OperationID: "getAgentMetrics", Summary: "Execution counts, success rate and windowed duration percentiles of an agent", Tag: "agents",
+			Response: services.AgentMetric{}},
+
+		// Agent templates
+		{Method: http.MethodGet, Path: "/api/v1/agent-templates", OperationID: "listAgentTemplates", Summary: "List agent templates", Tag: "agents",
+			Response: struct {
+				Templates []models.AgentTemplate `json:"templates"`
+				Total     int                    `json:"total"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/agent-templates", OperationID: "createAgentTemplate", Summary: "Create a template whose settings agents naming it inherit", Tag: "agents", Status: http.StatusCreated,
+			Request: AgentTemplateRequest{}, Response: templateActionResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/agent-templates/:templateName", OperationID: "getAgentTemplate", Summary: "Get an agent template", Tag: "agents", Response: models.AgentTemplate{}},
+		{Method: http.MethodPut, Path: "/api/v1/agent-templates/:templateName", OperationID: "updateAgentTemplate", Summary: "Replace a template's settings, merging them into its agents when propagation is on", Tag: "agents",
+			Request: AgentTemplateRequest{}, Response: templateActionResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/agent-templates/:templateName", OperationID: "deleteAgentTemplate", Summary: "Delete an agent template no agent uses", Tag: "agents", Response: templateActionResponse{}},
+
+		// Agent groups
+		{Method: http.MethodGet, Path: "/api/v1/groups", OperationID: "listAgentGroups", Summary: "List agent groups", Tag: "agents",
+			Response: struct {
+				Groups []models.AgentGroup `json:"groups"`
+				Total  int                 `json:"total"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/groups", OperationID: "createAgentGroup", Summary: "Create a group of agents that lifecycle routes can target as group:<name>", Tag: "agents", Status: http.StatusCreated,
+			Request: AgentGroupRequest{}, Response: groupActionResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/groups/:groupName", OperationID: "getAgentGroup", Summary: "Get an agent group", Tag: "agents", Response: models.AgentGroup{}},
+		{Method: http.MethodPut, Path: "/api/v1/groups/:groupName", OperationID: "updateAgentGroup", Summary: "Replace a group's description and members", Tag: "agents",
+			Request: AgentGroupRequest{}, Response: groupActionResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/groups/:groupName", OperationID: "deleteAgentGroup", Summary: "Delete an agent group, leaving its members as they are", Tag: "agents", Response: groupActionResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/groups/:groupName/status", OperationID: "getAgentGroupStatus", Summary: "Get the runtime status of a group's members, in member order", Tag: "agents", Response: GroupStatusResponse{}},
+
+		// Pipelines
+		{Method: http.MethodGet, Path: "/api/v1/pipelines", OperationID: "listPipelines", Summary: "List pipelines", Tag: "pipelines",
+			Response: struct {
+				Pipelines []models.Pipeline `json:"pipelines"`
+				Total     int               `json:"total"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/pipelines", OperationID: "createPipeline", Summary: "Create a pipeline of agents, each step's output feeding the next", Tag: "pipelines", Status: http.StatusCreated,
+			Request: PipelineRequest{}, Response: pipelineActionResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/pipelines/:pipelineId", OperationID: "getPipeline", Summary: "Get a pipeline", Tag: "pipelines", Response: models.Pipeline{}},
+		{Method: http.MethodPut, Path: "/api/v1/pipelines/:pipelineId", OperationID: "updatePipeline", Summary: "Replace a pipeline's steps", Tag: "pipelines", Request: PipelineRequest{}, Response: pipelineActionResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/pipelines/:pipelineId", OperationID: "deletePipeline", Summary: "Delete a pipeline and its runs", Tag: "pipelines", Response: pipelineActionResponse{}},
+		{Method: http.MethodPost, Path: "/api/v1/pipelines/:pipelineId/execute", OperationID: "executePipeline", Summary: "Run a pipeline and return the status of each step", Tag: "pipelines", Permission: string(models.PermissionExecute),
+			Query: []openapi.Parameter{triggerTypeHeader}, Request: PipelineExecuteRequest{}, Response: models.PipelineExecution{}},
+		{Method: http.MethodGet, Path: "/api/v1/pipelines/:pipelineId/executions", OperationID: "listPipelineExecutions", Summary: "List recent runs of a pipeline", Tag: "pipelines",
+			Response: struct {
+				Executions []models.PipelineExecution `json:"executions"`
+				Total      int                        `json:"total"`
+			}{}},
+		{Method: http.MethodGet, Path: "/api/v1/pipelines/:pipelineId/executions/:executionId", OperationID: "getPipelineExecution", Summary: "Get a run of a pipeline", Tag: "pipelines", Response: models.PipelineExecution{}},
+
+		// Calendars
+		{Method: http.MethodGet, Path: "/api/v1/calendars", OperationID: "listCalendars", Summary: "List the calendars of days scheduled tasks can skip", Tag: "tasks",
+			Response: struct {
+				Calendars []models.Calendar `json:"calendars"`
+				Total     int               `json:"total"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/calendars", OperationID: "createCalendar", Tag: "tasks", Status: http.StatusCreated,
+			Summary: "Create a calendar of excluded days from JSON, an iCalendar file (text/calendar) or a YAML list of dates (application/yaml), the latter two named by the name query parameter",
+			Query:   []openapi.Parameter{{Name: "name", In: "query", Description: "Name of a calendar sent as text/calendar or application/yaml", Schema: openapi.Schema{"type": "string"}}},
+			Request: CalendarRequest{}, Response: calendarActionResponse{}},
+		{Method: http.MethodGet, Path: "/api/v1/calendars/:calendarName", OperationID: "getCalendar", Summary: "Get a calendar and its excluded days", Tag: "tasks", Response: models.Calendar{}},
+		{Method: http.MethodPut, Path: "/api/v1/calendars/:calendarName", OperationID: "updateCalendar", Summary: "Replace a calendar's excluded days, from JSON, text/calendar or application/yaml", Tag: "tasks", Request: CalendarRequest{}, Response: calendarActionResponse{}},
+		{Method: http.MethodDelete, Path: "/api/v1/calendars/:calendarName", OperationID: "deleteCalendar", Summary: "Delete a calendar no scheduled task skips", Tag: "tasks", Response: calendarActionResponse{}},
+
+		// Configuration and API description
+		{Method: http.MethodPost, Path: "/api/v1/config/validate", OperationID: "validateConfig", Summary: "Validate the running configuration", Tag: "config", Permission: string(models.PermissionAdmin), Response: models.ConfigValidation{}},
+		{Method: http.MethodPost, Path: "/api/v1/config/reread", OperationID: "rereadConfig", Summary: "Show agents and tasks changed in the config file", Tag: "config", Permission: string(models.PermissionAdmin), Response: models.ConfigDiff{}},
+		{Method: http.MethodPost, Path: "/api/v1/config/update", OperationID: "updateConfig", Summary: "Apply agents and tasks changed in the config file", Tag: "config", Permission: string(models.PermissionAdmin),
+			Request: ConfigUpdateRequest{}, Response: models.ConfigUpdateResult{}},
+		{Method: http.MethodGet, Path: "/api/v1/export", OperationID: "exportState", Summary: "Export agents, templates, pipelines and scheduled tasks as a versioned state document, secrets masked", Tag: "config", Permission: string(models.PermissionAdmin),
+			Query: []openapi.Parameter{
+				{Name: "format", In: "query", Description: "json (the default) or yaml", Schema: openapi.Schema{"type": "string", "enum": []string{"json", "yaml"}}},
+				{Name: "include_history", In: "query", Description: "Include the execution history of every task", Schema: openapi.Schema{"type": "boolean"}},
+			},
+			Response: models.StateDocument{}},
+		{Method: http.MethodPost, Path: "/api/v1/import", OperationID: "importState", Summary: "Import a state document; nothing is applied when any item is invalid", Tag: "config", Permission: string(models.PermissionAdmin),
+			Query: []openapi.Parameter{
+				{Name: "mode", In: "query", Description: "merge (the default) adds missing items and reports differing ones as conflicts; replace also updates them and removes items the document lacks", Schema: openapi.Schema{"type": "string", "enum": []string{"merge", "replace"}}},
+				{Name: "format", In: "query", Description: "Format of the body, json or yaml; defaults to yaml for a YAML Content-Type and json otherwise", Schema: openapi.Schema{"type": "string", "enum": []string{"json", "yaml"}}},
+			},
+			Request: models.StateDocument{}, Response: models.ImportResult{}},
+		{Method: http.MethodGet, Path: "/api/v1/audit", OperationID: "queryAudit", Summary: "Query the audit log of mutating requests, oldest first", Tag: "system", Permission: string(models.PermissionAdmin),
+			Query: []openapi.Parameter{
+				{Name: "since", In: "query", Description: "Only return entries recorded at or after this RFC 3339 time", Schema: openapi.Schema{"type": "string", "format": "date-time"}},
+				{Name: "actor", In: "query", Description: "Only return entries of this principal, such as token:<hash> or ip:<address>", Schema: openapi.Schema{"type": "string"}},
+				{Name: "action", In: "query", Description: "Only return entries of this action and the actions under it, e.g. agents or agents.disable", Schema: openapi.Schema{"type": "string"}},
+				{Name: "offset", In: "query", Description: "Matching entries to skip", Schema: openapi.Schema{"type": "integer"}},
+				{Name: "limit", In: "query", Description: "Entries to return, 100 by default and at most 1000", Schema: openapi.Schema{"type": "integer"}},
+			},
+			Response: services.AuditPage{}},
+		{Method: http.MethodGet, Path: "/api/v1/openapi.json", OperationID: "getOpenAPI", Summary: "This OpenAPI document", Tag: "system", Permission: openapi.PermissionPublic},
+		{Method: http.MethodGet, Path: "/api/v1/docs", OperationID: "getSwaggerUI", Summary: "Swagger UI, when enabled", Tag: "system", Permission: openapi.PermissionPublic, Response: "", ContentType: "text/html"},
+
+		// Fault injection, only served when debug.fault_injection is enabled
+		{Method: http.MethodGet, Path: "/api/v1/debug/faults", OperationID: "listFaultRules", Summary: "Fault injection rules that have not expired", Tag: "debug", Permission: string(models.PermissionAdmin),
+			Response: struct {
+				Faults []models.FaultRule `json:"faults"`
+				Total  int                `json:"total"`
+			}{}},
+		{Method: http.MethodPost, Path: "/api/v1/debug/faults", OperationID: "addFaultRule", Summary: "Inject failures or delays into executions, or drop or delay webhook requests, until the rule expires", Tag: "debug", Permission: string(models.PermissionAdmin), Status: http.StatusCreated,
+			Request: models.FaultRule{}, Response: models.FaultRule{}},
+		{Method: http.MethodDelete, Path: "/api/v1/debug/faults/:ruleId", OperationID: "deleteFaultRule", Summary: "Delete a fault injection rule", Tag: "debug", Permission: string(models.PermissionAdmin),
+			Response: struct {
+				Message string `json:"message"`
+				ID      string `json:"id"`
+			}{}},
+
+		// Agent discovery
+		{Method: http.MethodGet, Path: "/discovery/agents", OperationID: "discoverAgents", Summary: "List discoverable agents", Tag: "agents",
+			Response: struct {
+				Agents []map[string]interface{} `json:"agents"`
+				Total  int                      `json:"total"`
+			}{}},
+		{Method: http.MethodGet, Path: "/discovery/agents/:agentId", OperationID: "discoverAgent", Summary: "Describe a discoverable agent", Tag: "agents"},
+		{Method: http.MethodGet, Path: "/discovery/capabilities", OperationID: "getCapabilities", Summary: "Supervisor capabilities", Tag: "agents"},
+
+		// A2A protocol; these routes authenticate with the a2a settings rather than auth tokens
+		{Method: http.MethodGet, Path: "/a2a/status", OperationID: "getA2AStatus", Summary: "A2A service status", Tag: "a2a", Permission: openapi.PermissionPublic},
+		{Method: http.MethodPost, Path: "/agents/:agentId/v1/message/send", OperationID: "a2aSendMessage", Summary: "Send an A2A message to an agent", Tag: "a2a", Permission: openapi.PermissionPublic, Request: map[string]interface{}{}},
+		{Method: http.MethodPost, Path: "/agents/:agentId/v1/message/stream", OperationID: "a2aStreamMessage", Summary: "Stream an A2A message to an agent", Tag: "a2a", Permission: openapi.PermissionPublic, Request: map[string]interface{}{}},
+		{Method: http.MethodGet, Path: "/agents/:agentId/v1/.well-known/agent-card.json", OperationID: "a2aGetAgentCard", Summary: "A2A agent card", Tag: "a2a", Permission: openapi.PermissionPublic},
+		{Method: http.MethodGet, Path: "/agents/:agentId/v1/tasks", OperationID: "a2aListTasks", Summary: "List A2A tasks of an agent", Tag: "a2a", Permission: openapi.PermissionPublic},
+		{Method: http.MethodGet, Path: "/agents/:agentId/v1/tasks/:taskId", OperationID: "a2aGetTask", Summary: "Get an A2A task", Tag: "a2a", Permission: openapi.PermissionPublic},
+		{Method: http.MethodPost, Path: "/jsonrpc", OperationID: "jsonrpc", Summary: "JSON-RPC 2.0 endpoint (execute-agent, status, list-agents)", Tag: "a2a", Permission: openapi.PermissionPublic,
+			Request: JSONRPCRequest{}, Response: JSONRPCResponse{}},
+	}
+}
+
+// RoutePermissions maps each documented route that needs an auth token, keyed by method and gin
+// path such as "GET /api/v1/agents", to the permission it requires
+func RoutePermissions() map[string]models.Permission {
+	permissions := make(map[string]models.Permission)
+	for _, route := range APIRoutes() {
+		if permission := route.RequiredPermission(); permission != openapi.PermissionPublic {
+			permissions[route.Method+" "+route.Path] = models.Permission(permission)
+		}
+	}
+	return permissions
+}
+
+// OpenAPIDocument builds the OpenAPI document for the supervisor's HTTP API
+func OpenAPIDocument() *openapi.Document {
+	return openapi.NewDocument(openapi.Info{
+		Title:       "Algonius Supervisor API",
+		Description: "Manage agents, executions and scheduled tasks, and talk to agents over A2A.",
+		Version:     APIVersion,
+	}, APIRoutes())
+}
+
+// OpenAPIHandlers serves the OpenAPI document and the optional Swagger UI
+type OpenAPIHandlers struct {
+	document  *openapi.Document
+	swaggerUI bool
+	logger    *zap.Logger
+}
+
+// NewOpenAPIHandlers creates a new instance of OpenAPIHandlers
+func NewOpenAPIHandlers(swaggerUI bool, logger *zap.Logger) *OpenAPIHandlers {
+	return &OpenAPIHandlers{
+		document:  OpenAPIDocument(),
+		swaggerUI: swaggerUI,
+		logger:    logger,
+	}
+}
+
+// RegisterOpenAPIRoutes registers the OpenAPI routes
+func (oh *OpenAPIHandlers) RegisterOpenAPIRoutes(router gin.IRouter) {
+	router.GET("/openapi.json", oh.GetOpenAPI)
+	if oh.swaggerUI {
+		router.GET("/docs", oh.GetSwaggerUI)
+	}
+}
+
+// GetOpenAPI returns the OpenAPI document
+func (oh *OpenAPIHandlers) GetOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, oh.document)
+}
+
+// GetSwaggerUI serves a Swagger UI page pointed at the OpenAPI document
+func (oh *OpenAPIHandlers) GetSwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerUIPage)
+}
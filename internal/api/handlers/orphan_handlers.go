@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OrphanHandlers lists the agent processes found still running when the supervisor started
+type OrphanHandlers struct {
+	orphanService *services.OrphanService
+	logger        *zap.Logger
+}
+
+// NewOrphanHandlers creates a new instance of OrphanHandlers
+func NewOrphanHandlers(orphanService *services.OrphanService, logger *zap.Logger) *OrphanHandlers {
+	return &OrphanHandlers{
+		orphanService: orphanService,
+		logger:        logger,
+	}
+}
+
+// RegisterOrphanRoutes registers the orphan route
+func (oh *OrphanHandlers) RegisterOrphanRoutes(router gin.IRouter) {
+	router.GET("/orphans", oh.ListOrphans)
+}
+
+// ListOrphans returns the orphaned agent processes that have not been handled; all=true also
+// returns the ones adopted, terminated or exited since
+func (oh *OrphanHandlers) ListOrphans(c *gin.Context) {
+	all := false
+	if value := c.Query("all"); value != "" {
+		var err error
+		if all, err = strconv.ParseBool(value); err != nil {
+			api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "all must be true or false")
+			return
+		}
+	}
+
+	orphans := oh.orphanService.List(all)
+	c.JSON(http.StatusOK, gin.H{
+		"orphans": orphans,
+		"total":   len(orphans),
+	})
+}
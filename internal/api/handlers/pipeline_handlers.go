@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PipelineHandlers handles REST requests that manage and run pipelines
+type PipelineHandlers struct {
+	pipelineService services.IPipelineService
+	logger          *zap.Logger
+}
+
+// PipelineRequest is the body accepted when creating or updating a pipeline
+type PipelineRequest struct {
+	ID          string                `json:"id,omitempty"` // Generated when creating without one; ignored on update
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Steps       []models.PipelineStep `json:"steps"`
+}
+
+// PipelineExecuteRequest is the request body of POST /api/v1/pipelines/:pipelineId/execute
+type PipelineExecuteRequest struct {
+	Input  string            `json:"input"`
+	Labels map[string]string `json:"labels,omitempty"` // Applied to every step's execution
+}
+
+// pipelineActionResponse is returned by pipeline mutation endpoints
+type pipelineActionResponse struct {
+	Message    string `json:"message"`
+	PipelineID string `json:"pipeline_id"`
+}
+
+// NewPipelineHandlers creates a new instance of PipelineHandlers
+func NewPipelineHandlers(pipelineService services.IPipelineService, logger *zap.Logger) *PipelineHandlers {
+	return &PipelineHandlers{
+		pipelineService: pipelineService,
+		logger:          logger,
+	}
+}
+
+// RegisterPipelineRoutes registers the pipeline routes
+func (ph *PipelineHandlers) RegisterPipelineRoutes(router gin.IRouter) {
+	pipelineGroup := router.Group("/pipelines")
+
+	pipelineGroup.GET("", ph.ListPipelines)
+	pipelineGroup.POST("", ph.CreatePipeline)
+	pipelineGroup.GET("/:pipelineId", ph.GetPipeline)
+	pipelineGroup.PUT("/:pipelineId", ph.UpdatePipeline)
+	pipelineGroup.DELETE("/:pipelineId", ph.DeletePipeline)
+	pipelineGroup.POST("/:pipelineId/execute", ph.ExecutePipeline)
+	pipelineGroup.GET("/:pipelineId/executions", ph.ListPipelineExecutions)
+	pipelineGroup.GET("/:pipelineId/executions/:executionId", ph.GetPipelineExecution)
+}
+
+// ListPipelines returns all pipelines
+func (ph *PipelineHandlers) ListPipelines(c *gin.Context) {
+	pipelines, err := ph.pipelineService.ListPipelines()
+	if err != nil {
+		logging.LoggerFromContext(c.Request.Context(), ph.logger).Error("failed to list pipelines", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to list pipelines")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pipelines": pipelines,
+		"total":     len(pipelines),
+	})
+}
+
+// GetPipeline returns a pipeline and its steps
+func (ph *PipelineHandlers) GetPipeline(c *gin.Context) {
+	pipeline, err := ph.pipelineService.GetPipeline(c.Param("pipelineId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get pipeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, pipeline)
+}
+
+// CreatePipeline creates a new pipeline
+func (ph *PipelineHandlers) CreatePipeline(c *gin.Context) {
+	logger := logging.LoggerFromContext(c.Request.Context(), ph.logger)
+
+	var requestData PipelineRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse create pipeline request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	pipeline := &models.Pipeline{
+		ID:          requestData.ID,
+		Name:        requestData.Name,
+		Description: requestData.Description,
+		Steps:       requestData.Steps,
+	}
+	if pipeline.ID == "" {
+		pipeline.ID = generatePipelineID()
+	}
+
+	if err := ph.pipelineService.CreatePipeline(pipeline); err != nil {
+		logger.Warn("failed to create pipeline", zap.String("pipeline_id", pipeline.ID), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to create pipeline")
+		return
+	}
+
+	c.JSON(http.StatusCreated, pipelineActionResponse{
+		Message:    "Pipeline created successfully",
+		PipelineID: pipeline.ID,
+	})
+}
+
+// UpdatePipeline replaces the name, description and steps of a pipeline
+func (ph *PipelineHandlers) UpdatePipeline(c *gin.Context) {
+	pipelineID := c.Param("pipelineId")
+	logger := logging.LoggerFromContext(c.Request.Context(), ph.logger)
+
+	var requestData PipelineRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse update pipeline request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	pipeline := &models.Pipeline{
+		ID:          pipelineID,
+		Name:        requestData.Name,
+		Description: requestData.Description,
+		Steps:       requestData.Steps,
+	}
+	if err := ph.pipelineService.UpdatePipeline(pipeline); err != nil {
+		logger.Warn("failed to update pipeline", zap.String("pipeline_id", pipelineID), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to update pipeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, pipelineActionResponse{
+		Message:    "Pipeline updated successfully",
+		PipelineID: pipelineID,
+	})
+}
+
+// DeletePipeline deletes a pipeline and its recorded runs
+func (ph *PipelineHandlers) DeletePipeline(c *gin.Context) {
+	pipelineID := c.Param("pipelineId")
+
+	if err := ph.pipelineService.DeletePipeline(pipelineID); err != nil {
+		api.RespondServiceError(c, err, "Failed to delete pipeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, pipelineActionResponse{
+		Message:    "Pipeline deleted successfully",
+		PipelineID: pipelineID,
+	})
+}
+
+// ExecutePipeline runs a pipeline and returns the run with the status of each step. A run that
+// failed is still returned with 200; its state and steps tell where it stopped.
+func (ph *PipelineHandlers) ExecutePipeline(c *gin.Context) {
+	pipelineID := c.Param("pipelineId")
+	logger := logging.LoggerFromContext(c.Request.Context(), ph.logger)
+
+	var requestData PipelineExecuteRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		logger.Error("failed to parse execute pipeline request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	triggerType, err := restTriggerType(c)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed, err.Error())
+		return
+	}
+
+	execution, err := ph.pipelineService.ExecutePipeline(triggerContext(c, triggerType), pipelineID, requestData.Input, requestData.Labels)
+	if err != nil {
+		logger.Warn("rejected execute pipeline request", zap.String("pipeline_id", pipelineID), zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to execute pipeline")
+		return
+	}
+
+	c.JSON(http.StatusOK, execution)
+}
+
+// ListPipelineExecutions returns the recorded runs of a pipeline
+func (ph *PipelineHandlers) ListPipelineExecutions(c *gin.Context) {
+	executions, err := ph.pipelineService.ListPipelineExecutions(c.Param("pipelineId"))
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to list pipeline executions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"executions": executions,
+		"total":      len(executions),
+	})
+}
+
+// GetPipelineExecution returns a run of a pipeline
+func (ph *PipelineHandlers) GetPipelineExecution(c *gin.Context) {
+	execution, err := ph.pipelineService.GetPipelineExecution(c.Param("executionId"))
+	if err == nil && execution.PipelineID != c.Param("pipelineId") {
+		err = models.NewKindError(models.ErrExecutionNotFound, "pipeline execution %s not found", c.Param("executionId"))
+	}
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get pipeline execution")
+		return
+	}
+
+	c.JSON(http.StatusOK, execution)
+}
+
+// generatePipelineID returns an ID for a pipeline created without one
+func generatePipelineID() string {
+	return "pipeline-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/api"
 	"github.com/algonius/algonius-supervisor/internal/services"
 	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -18,6 +22,55 @@ type ScheduledTaskHandlers struct {
 	logger           *zap.Logger
 }
 
+// ScheduledTaskRequest is the body accepted when creating or updating a scheduled task
+type ScheduledTaskRequest struct {
+	Name            string                 `json:"name"`
+	AgentID         string                 `json:"agent_id"`
+	PipelineID      string                 `json:"pipeline_id"` // Runs a pipeline instead of AgentID
+	AgentSelector   *models.AgentSelector  `json:"agent_selector"` // Runs the input against several agents instead of AgentID
+	MaxParallel     int                    `json:"max_parallel"`
+	SuccessPolicy   models.FanOutSuccessPolicy `json:"success_policy"` // all, any or at_least
+	MinSuccesses    int                    `json:"min_successes"`
+	CronExpression  string                 `json:"cron_expression"`
+	Timezone        string                 `json:"timezone"` // IANA zone of the cron expression, the scheduler's when empty
+	Enabled         bool                   `json:"enabled"`
+	InputParameters map[string]interface{} `json:"input_parameters"`
+	InputTemplate   string                 `json:"input_template"` // Rendered into the input at fire time, e.g. "report for {{yesterday}}"
+	OverlapPolicy   types.OverlapPolicy    `json:"overlap_policy"`
+	Timeout         int                    `json:"timeout"`
+	MaxRetries      int                    `json:"max_retries"`
+	RetryBackoff    int                    `json:"retry_backoff"`
+	CatchUpPolicy   types.CatchUpPolicy    `json:"catch_up_policy"`
+	MaxCatchUpRuns  int                    `json:"max_catch_up_runs"`
+	SkipCalendars   []string               `json:"skip_calendars"` // Calendars whose days the task does not run on
+	DeferOnSkip     bool                   `json:"defer_on_skip"`  // Runs fires on excluded days after the next fire instead
+	Labels          map[string]string      `json:"labels"`
+}
+
+// TaskFireTime is an upcoming run of a task, in the task's time zone and in UTC
+type TaskFireTime struct {
+	Time time.Time `json:"time"`
+	UTC  time.Time `json:"utc"`
+}
+
+// TaskScheduleResponse is the body of GET /tasks/:taskId/schedule
+type TaskScheduleResponse struct {
+	TaskID         string         `json:"task_id"`
+	CronExpression string         `json:"cron_expression"`
+	Active         bool           `json:"active"`   // Paused tasks are inactive and have no upcoming runs
+	Timezone       string         `json:"timezone"` // Time zone the cron expression is evaluated in: the task's, or the scheduler's
+	NextRuns       []TaskFireTime `json:"next_runs"`
+}
+
+// DefaultScheduleCount is how many upcoming runs GET /tasks/:taskId/schedule returns without ?count
+const DefaultScheduleCount = 5
+
+// BulkTaskRequest is the body of POST /tasks/bulk
+type BulkTaskRequest struct {
+	Action   models.TaskAction   `json:"action"` // pause, resume, delete or execute
+	Selector models.TaskSelector `json:"selector"`
+}
+
 // NewScheduledTaskHandlers creates a new instance of ScheduledTaskHandlers
 func NewScheduledTaskHandlers(schedulerService services.ISchedulerService, logger *zap.Logger) *ScheduledTaskHandlers {
 	return &ScheduledTaskHandlers{
@@ -36,24 +89,38 @@ func (sth *ScheduledTaskHandlers) RegisterScheduledTaskRoutes(router *gin.Engine
 	
 	taskGroup.GET("", sth.ListTasks)
 	taskGroup.GET("/:taskId", sth.GetTask)
+	taskGroup.GET("/:taskId/schedule", sth.GetTaskSchedule)
 	taskGroup.POST("", sth.CreateTask)
 	taskGroup.PUT("/:taskId", sth.UpdateTask)
 	taskGroup.DELETE("/:taskId", sth.DeleteTask)
 	taskGroup.POST("/:taskId/execute", sth.ExecuteTask)
+	taskGroup.POST("/:taskId/preview-input", sth.PreviewTaskInput)
 	taskGroup.POST("/:taskId/pause", sth.PauseTask)
 	taskGroup.POST("/:taskId/resume", sth.ResumeTask)
+	taskGroup.POST("/:taskId/cancel-active", sth.CancelActiveRuns)
+	taskGroup.POST("/bulk", sth.BulkTaskOperation)
 }
 
-// ListTasks returns a list of all scheduled tasks
+// ListTasks returns the scheduled tasks ordered by ID, or by sort=name|created_at in order=asc|desc,
+// a page of them when limit or offset is set. enabled=true|false and agent_id filter them; total
+// counts the matching tasks across all pages.
 func (sth *ScheduledTaskHandlers) ListTasks(c *gin.Context) {
 	sth.logger.Info("handling list tasks request")
 
-	tasks, err := sth.schedulerService.ListScheduledTasks()
+	listOptions, ok := listOptionsQuery(c)
+	if !ok {
+		return
+	}
+	enabled, ok := optionalBoolQuery(c, "enabled")
+	if !ok {
+		return
+	}
+
+	options := services.TaskListOptions{ListOptions: listOptions, Enabled: enabled, AgentID: c.Query("agent_id")}
+	tasks, total, err := sth.schedulerService.QueryScheduledTasks(options)
 	if err != nil {
 		sth.logger.Error("failed to list tasks", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to list tasks",
-		})
+		api.RespondServiceError(c, err, "Failed to list tasks")
 		return
 	}
 
@@ -64,17 +131,25 @@ func (sth *ScheduledTaskHandlers) ListTasks(c *gin.Context) {
 			"id":             task.ID,
 			"name":           task.Name,
 			"agent_id":       task.AgentID,
+			"pipeline_id":    task.PipelineID,
+			"agent_selector": task.AgentSelector,
 			"cron_expression": task.CronExpression,
+			"timezone":       task.Timezone,
 			"enabled":        task.Enabled,
 			"active":         task.Active,
+			"overlap_policy": task.GetOverlapPolicy(),
+			"next_run":       sth.nextRun(task.ID),
+			"last_run":       task.LastExecution,
 			"created_at":     task.CreatedAt,
 			"updated_at":     task.UpdatedAt,
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"tasks": taskList,
-		"total": len(taskList),
+		"tasks":  taskList,
+		"total":  total,
+		"limit":  listOptions.Limit,
+		"offset": listOptions.Offset,
 	})
 }
 
@@ -90,22 +165,44 @@ func (sth *ScheduledTaskHandlers) GetTask(c *gin.Context) {
 		sth.logger.Error("task not found",
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Task not found",
-		})
+		api.RespondServiceError(c, err, "Failed to get task")
 		return
 	}
 
+	nextRun := sth.nextRun(task.ID)
 	response := gin.H{
-		"id":               task.ID,
-		"name":             task.Name,
-		"agent_id":         task.AgentID,
-		"cron_expression":  task.CronExpression,
-		"enabled":          task.Enabled,
-		"active":           task.Active,
-		"input_parameters": task.InputParameters,
-		"created_at":       task.CreatedAt,
-		"updated_at":       task.UpdatedAt,
+		"id":                 task.ID,
+		"name":               task.Name,
+		"agent_id":           task.AgentID,
+		"pipeline_id":        task.PipelineID,
+		"agent_selector":     task.AgentSelector,
+		"max_parallel":       task.MaxParallel,
+		"success_policy":     task.SuccessPolicy,
+		"min_successes":      task.MinSuccesses,
+		"cron_expression":    task.CronExpression,
+		"timezone":           task.Timezone,
+		"enabled":            task.Enabled,
+		"active":             task.Active,
+		"input_parameters":   task.InputParameters,
+		"input_template":     task.InputTemplate,
+		"overlap_policy":     task.GetOverlapPolicy(),
+		"timeout":            task.Timeout,
+		"max_retries":        task.MaxRetries,
+		"retry_backoff":      task.RetryBackoff,
+		"catch_up_policy":    task.CatchUpPolicy,
+		"max_catch_up_runs":  task.MaxCatchUpRuns,
+		"skip_calendars":     task.SkipCalendars,
+		"defer_on_skip":      task.DeferOnSkip,
+		"deferred_runs":      task.DeferredRuns,
+		"last_execution":     task.LastExecution,
+		"last_scheduled_run": task.LastScheduledRun,
+		"schedule_drift":     sth.schedulerService.ScheduleDrift(task.ID),
+		"next_execution":     nextRun,
+		"next_run":           nextRun,
+		"last_run":           task.LastExecution,
+		"labels":             task.Labels,
+		"created_at":         task.CreatedAt,
+		"updated_at":         task.UpdatedAt,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -113,19 +210,11 @@ func (sth *ScheduledTaskHandlers) GetTask(c *gin.Context) {
 
 // CreateTask creates a new scheduled task
 func (sth *ScheduledTaskHandlers) CreateTask(c *gin.Context) {
-	var requestData struct {
-		Name            string                 `json:"name"`
-		AgentID         string                 `json:"agent_id"`
-		CronExpression  string                 `json:"cron_expression"`
-		Enabled         bool                   `json:"enabled"`
-		InputParameters map[string]interface{} `json:"input_parameters"`
-	}
+	var requestData ScheduledTaskRequest
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		sth.logger.Error("failed to parse create task request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request body",
-		})
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -134,25 +223,52 @@ func (sth *ScheduledTaskHandlers) CreateTask(c *gin.Context) {
 		ID:              generateTaskID(), // This would be a function to generate unique IDs
 		Name:            requestData.Name,
 		AgentID:         requestData.AgentID,
+		PipelineID:      requestData.PipelineID,
+		AgentSelector:   requestData.AgentSelector,
+		MaxParallel:     requestData.MaxParallel,
+		SuccessPolicy:   requestData.SuccessPolicy,
+		MinSuccesses:    requestData.MinSuccesses,
 		CronExpression:  requestData.CronExpression,
+		Timezone:        requestData.Timezone,
 		Enabled:         requestData.Enabled,
 		Active:          requestData.Enabled, // Active by default if enabled
 		InputParameters: requestData.InputParameters,
+		InputTemplate:   requestData.InputTemplate,
+		OverlapPolicy:   requestData.OverlapPolicy,
+		Timeout:         requestData.Timeout,
+		MaxRetries:      requestData.MaxRetries,
+		RetryBackoff:    requestData.RetryBackoff,
+		CatchUpPolicy:   requestData.CatchUpPolicy,
+		MaxCatchUpRuns:  requestData.MaxCatchUpRuns,
+		SkipCalendars:   requestData.SkipCalendars,
+		DeferOnSkip:     requestData.DeferOnSkip,
+		Labels:          requestData.Labels,
 	}
 
-	// Schedule the task
+	// Schedule the task; the scheduler validates it, reporting every problem found
 	err := sth.schedulerService.ScheduleTask(task)
 	if err != nil {
 		sth.logger.Error("failed to schedule task", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to schedule task",
-		})
+		api.RespondServiceError(c, err, "Failed to schedule task")
 		return
 	}
 
+	// The schedule was validated above, so the fire times can be computed; those of an active task
+	// leave out the days its calendars exclude
+	var nextFireTimes []time.Time
+	if task.Active {
+		nextFireTimes, err = sth.schedulerService.NextRuns(task.ID, 3)
+	} else {
+		nextFireTimes, err = services.TaskFireTimes(task, sth.schedulerService.Location(), time.Now(), 3)
+	}
+	if err != nil {
+		sth.logger.Error("failed to compute next fire times", zap.Error(err))
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Task scheduled successfully",
-		"task_id": task.ID,
+		"message":         "Task scheduled successfully",
+		"task_id":         task.ID,
+		"next_fire_times": nextFireTimes,
 	})
 }
 
@@ -160,19 +276,11 @@ func (sth *ScheduledTaskHandlers) CreateTask(c *gin.Context) {
 func (sth *ScheduledTaskHandlers) UpdateTask(c *gin.Context) {
 	taskID := c.Param("taskId")
 
-	var requestData struct {
-		Name            string                 `json:"name"`
-		AgentID         string                 `json:"agent_id"`
-		CronExpression  string                 `json:"cron_expression"`
-		Enabled         bool                   `json:"enabled"`
-		InputParameters map[string]interface{} `json:"input_parameters"`
-	}
+	var requestData ScheduledTaskRequest
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		sth.logger.Error("failed to parse update task request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request body",
-		})
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -182,32 +290,49 @@ func (sth *ScheduledTaskHandlers) UpdateTask(c *gin.Context) {
 		sth.logger.Error("task not found for update",
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Task not found",
-		})
+		api.RespondServiceError(c, err, "Failed to get task")
 		return
 	}
 
-	// Update the task properties
-	existingTask.Name = requestData.Name
-	existingTask.AgentID = requestData.AgentID
-	existingTask.CronExpression = requestData.CronExpression
-	existingTask.Enabled = requestData.Enabled
-	existingTask.InputParameters = requestData.InputParameters
+	// Update a copy of the task, so the scheduler sees the change and reschedules it
+	updatedTask := *existingTask
+	updatedTask.Name = requestData.Name
+	updatedTask.AgentID = requestData.AgentID
+	updatedTask.PipelineID = requestData.PipelineID
+	updatedTask.AgentSelector = requestData.AgentSelector
+	updatedTask.MaxParallel = requestData.MaxParallel
+	updatedTask.SuccessPolicy = requestData.SuccessPolicy
+	updatedTask.MinSuccesses = requestData.MinSuccesses
+	updatedTask.CronExpression = requestData.CronExpression
+	updatedTask.Timezone = requestData.Timezone
+	updatedTask.Enabled = requestData.Enabled
+	updatedTask.InputParameters = requestData.InputParameters
+	updatedTask.InputTemplate = requestData.InputTemplate
+	if requestData.OverlapPolicy != "" {
+		updatedTask.OverlapPolicy = requestData.OverlapPolicy
+	}
+	updatedTask.Timeout = requestData.Timeout
+	updatedTask.MaxRetries = requestData.MaxRetries
+	updatedTask.RetryBackoff = requestData.RetryBackoff
+	if requestData.CatchUpPolicy != "" {
+		updatedTask.CatchUpPolicy = requestData.CatchUpPolicy
+	}
+	updatedTask.MaxCatchUpRuns = requestData.MaxCatchUpRuns
+	updatedTask.SkipCalendars = requestData.SkipCalendars
+	updatedTask.DeferOnSkip = requestData.DeferOnSkip
+	updatedTask.Labels = requestData.Labels
 
 	// Update the task in the scheduler
-	err = sth.schedulerService.UpdateTask(existingTask)
+	err = sth.schedulerService.UpdateTask(&updatedTask)
 	if err != nil {
 		sth.logger.Error("failed to update task", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update task",
-		})
+		api.RespondServiceError(c, err, "Failed to update task")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Task updated successfully",
-		"task_id": existingTask.ID,
+		"task_id": updatedTask.ID,
 	})
 }
 
@@ -215,6 +340,10 @@ func (sth *ScheduledTaskHandlers) UpdateTask(c *gin.Context) {
 func (sth *ScheduledTaskHandlers) DeleteTask(c *gin.Context) {
 	taskID := c.Param("taskId")
 
+	if sth.respondDryRun(c, taskID, models.TaskActionDelete) {
+		return
+	}
+
 	sth.logger.Info("handling delete task request",
 		zap.String("task_id", taskID))
 
@@ -223,9 +352,7 @@ func (sth *ScheduledTaskHandlers) DeleteTask(c *gin.Context) {
 		sth.logger.Error("failed to delete task",
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to delete task",
-		})
+		api.RespondServiceError(c, err, "Failed to delete task")
 		return
 	}
 
@@ -239,36 +366,115 @@ func (sth *ScheduledTaskHandlers) DeleteTask(c *gin.Context) {
 func (sth *ScheduledTaskHandlers) ExecuteTask(c *gin.Context) {
 	taskID := c.Param("taskId")
 
+	if sth.respondDryRun(c, taskID, models.TaskActionExecute) {
+		return
+	}
+
 	sth.logger.Info("handling execute task request",
 		zap.String("task_id", taskID))
 
-	result, err := sth.schedulerService.ExecuteTask(taskID)
+	// Running a task on demand is always a manual run, attributed to the caller
+	result, err := sth.schedulerService.ExecuteTask(triggerContext(c, types.TaskTriggerTypeManual), taskID)
 	if err != nil {
 		sth.logger.Error("failed to execute task",
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to execute task",
-		})
+		api.RespondServiceError(c, err, "Failed to execute task")
 		return
 	}
 
+	response := gin.H{
+		"execution_id": result.ID,
+		"status":       string(result.Status),
+		"output":       result.Output,
+		"execution_time_ms": result.ExecutionTime,
+		"trigger_type": string(result.TriggerType),
+		"triggered_by": result.TriggeredBy,
+	}
+	// A fan-out task reports the aggregate of its agents' executions
+	if result.FanOut != nil {
+		response["error"] = result.Error
+		response["fan_out"] = result.FanOut
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Task executed successfully",
 		"task_id": taskID,
-		"result": gin.H{
-			"execution_id": result.ID,
-			"status":       string(result.Status),
-			"output":       result.Output,
-			"execution_time_ms": result.ExecutionTime,
-		},
+		"result":  response,
 	})
 }
 
+// PreviewTaskInput renders the input a run of the task would receive now, without running it
+func (sth *ScheduledTaskHandlers) PreviewTaskInput(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	input, err := sth.schedulerService.PreviewTaskInput(taskID)
+	if err != nil {
+		if errors.Is(err, models.ErrTaskNotFound) {
+			api.RespondServiceError(c, err, "Failed to get task")
+			return
+		}
+		api.RespondError(c, http.StatusUnprocessableEntity, api.CodeValidationFailed, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"input":   input,
+	})
+}
+
+// GetTaskSchedule returns the task's next ?count fire times, DefaultScheduleCount by default, in the
+// task's time zone and in UTC. A paused task has none.
+func (sth *ScheduledTaskHandlers) GetTaskSchedule(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	count := DefaultScheduleCount
+	if value := c.Query("count"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > services.MaxNextRuns {
+			api.RespondError(c, http.StatusBadRequest, api.CodeValidationFailed,
+				fmt.Sprintf("count must be an integer between 1 and %d", services.MaxNextRuns))
+			return
+		}
+		count = parsed
+	}
+
+	task, err := sth.schedulerService.GetTask(taskID)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to get task")
+		return
+	}
+	runs, err := sth.schedulerService.NextRuns(taskID, count)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to compute task schedule")
+		return
+	}
+
+	response := TaskScheduleResponse{
+		TaskID:         task.ID,
+		CronExpression: task.CronExpression,
+		Active:         task.Active,
+		Timezone:       task.Timezone,
+		NextRuns:       make([]TaskFireTime, len(runs)),
+	}
+	if response.Timezone == "" {
+		response.Timezone = sth.schedulerService.Location().String()
+	}
+	for i, run := range runs {
+		response.NextRuns[i] = TaskFireTime{Time: run, UTC: run.UTC()}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // PauseTask pauses a scheduled task
 func (sth *ScheduledTaskHandlers) PauseTask(c *gin.Context) {
 	taskID := c.Param("taskId")
 
+	if sth.respondDryRun(c, taskID, models.TaskActionPause) {
+		return
+	}
+
 	sth.logger.Info("handling pause task request",
 		zap.String("task_id", taskID))
 
@@ -277,15 +483,7 @@ func (sth *ScheduledTaskHandlers) PauseTask(c *gin.Context) {
 		sth.logger.Error("failed to pause task",
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		if err.Error() == "task with ID "+taskID+" not found" {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Task not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to pause task",
-		})
+		api.RespondServiceError(c, err, "Failed to pause task")
 		return
 	}
 
@@ -299,6 +497,10 @@ func (sth *ScheduledTaskHandlers) PauseTask(c *gin.Context) {
 func (sth *ScheduledTaskHandlers) ResumeTask(c *gin.Context) {
 	taskID := c.Param("taskId")
 
+	if sth.respondDryRun(c, taskID, models.TaskActionResume) {
+		return
+	}
+
 	sth.logger.Info("handling resume task request",
 		zap.String("task_id", taskID))
 
@@ -307,15 +509,7 @@ func (sth *ScheduledTaskHandlers) ResumeTask(c *gin.Context) {
 		sth.logger.Error("failed to resume task",
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		if err.Error() == "task with ID "+taskID+" not found" {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Task not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to resume task",
-		})
+		api.RespondServiceError(c, err, "Failed to resume task")
 		return
 	}
 
@@ -325,8 +519,81 @@ func (sth *ScheduledTaskHandlers) ResumeTask(c *gin.Context) {
 	})
 }
 
+// BulkTaskOperation pauses, resumes, deletes or runs every task picked by the selector and returns
+// the outcome per task; failures on some tasks are reported without stopping the others
+func (sth *ScheduledTaskHandlers) BulkTaskOperation(c *gin.Context) {
+	var requestData BulkTaskRequest
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		sth.logger.Error("failed to parse bulk task request", zap.Error(err))
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	dryRun, ok := boolQuery(c, "dry_run")
+	if !ok {
+		return
+	}
+
+	ctx := triggerContext(c, types.TaskTriggerTypeManual)
+	result, err := sth.schedulerService.BulkTaskOperation(ctx, requestData.Action, requestData.Selector, dryRun)
+	if err != nil {
+		api.RespondServiceError(c, err, "Failed to run bulk task operation")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// respondDryRun answers a request with dry_run=true with the planned outcome of a task operation,
+// failed preconditions reported in the result, and a malformed dry_run with 400; false when the
+// request is not a dry run
+func (sth *ScheduledTaskHandlers) respondDryRun(c *gin.Context, taskID string, action models.TaskAction) bool {
+	dryRun, ok := boolQuery(c, "dry_run")
+	if !ok {
+		return true
+	}
+	if !dryRun {
+		return false
+	}
+	result := sth.schedulerService.PlanTaskOperation(taskID, action)
+
+	sth.logger.Info("planned task operation",
+		zap.String("task_id", taskID),
+		zap.String("action", string(action)),
+		zap.String("status", string(result.Status)))
+
+	c.JSON(http.StatusOK, result)
+	return true
+}
+
+// nextRun returns the next fire time of a task, or nil when it won't fire, e.g. because it is paused
+func (sth *ScheduledTaskHandlers) nextRun(taskID string) *time.Time {
+	runs, err := sth.schedulerService.NextRuns(taskID, 1)
+	if err != nil || len(runs) == 0 {
+		return nil
+	}
+	return &runs[0]
+}
+
 // Helper function to generate task IDs (in a real implementation, this would be more sophisticated)
 func generateTaskID() string {
 	// In a real implementation, this could use UUID generation
 	return "task-" + strconv.FormatInt(time.Now().UnixNano(), 10)
-}
\ No newline at end of file
+}
+
+// CancelActiveRuns cancels every queued, starting and running execution the task started and
+// reports the outcome per execution; the task stays scheduled
+func (sth *ScheduledTaskHandlers) CancelActiveRuns(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	result, err := sth.schedulerService.CancelActiveRuns(taskID, callerID(c))
+	if err != nil {
+		sth.logger.Error("failed to cancel active runs of task",
+			zap.String("task_id", taskID),
+			zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to cancel active runs of task")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
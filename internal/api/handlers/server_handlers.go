@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ServerHandlers reports on the supervisor itself: server info, readiness and Prometheus metrics
+type ServerHandlers struct {
+	monitor *services.ServerMonitor
+	logger  *zap.Logger
+}
+
+// NewServerHandlers creates a new instance of ServerHandlers
+func NewServerHandlers(monitor *services.ServerMonitor, logger *zap.Logger) *ServerHandlers {
+	return &ServerHandlers{
+		monitor: monitor,
+		logger:  logger,
+	}
+}
+
+// RegisterServerRoutes registers the server info route
+func (sh *ServerHandlers) RegisterServerRoutes(router gin.IRouter) {
+	router.GET("/server/info", sh.GetServerInfo)
+}
+
+// RegisterProbeRoutes registers the readiness probe and the Prometheus scrape endpoint
+func (sh *ServerHandlers) RegisterProbeRoutes(router gin.IRouter) {
+	router.GET("/health/ready", sh.GetReadiness)
+	router.GET("/metrics/prometheus", sh.GetPrometheusMetrics)
+}
+
+// GetServerInfo returns the build, runtime and workload info of the supervisor
+func (sh *ServerHandlers) GetServerInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, sh.monitor.Info())
+}
+
+// GetReadiness returns 200 when the supervisor can take work and 503 with the failed checks when
+// it cannot
+func (sh *ServerHandlers) GetReadiness(c *gin.Context) {
+	readiness := sh.monitor.Readiness()
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
+
+// GetPrometheusMetrics returns the supervisor, Go runtime and process metrics in the Prometheus text
+// exposition format
+func (sh *ServerHandlers) GetPrometheusMetrics(c *gin.Context) {
+	var body bytes.Buffer
+	if err := sh.monitor.WritePrometheusMetrics(&body); err != nil {
+		sh.logger.Error("failed to write Prometheus metrics", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, services.PrometheusContentType, body.Bytes())
+}
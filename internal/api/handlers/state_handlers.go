@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Content types of state documents
+const (
+	stateContentTypeJSON = "application/json"
+	stateContentTypeYAML = "application/yaml"
+)
+
+// StateHandlers exports and imports the supervisor's state for migration and backup
+type StateHandlers struct {
+	stateService *services.StateService
+	logger       *zap.Logger
+}
+
+// NewStateHandlers creates a new instance of StateHandlers
+func NewStateHandlers(stateService *services.StateService, logger *zap.Logger) *StateHandlers {
+	return &StateHandlers{
+		stateService: stateService,
+		logger:       logger,
+	}
+}
+
+// RegisterStateRoutes registers the export and import routes
+func (sh *StateHandlers) RegisterStateRoutes(router gin.IRouter) {
+	router.GET("/export", sh.ExportState)
+	router.POST("/import", sh.ImportState)
+}
+
+// ExportState returns the state document of the supervisor as JSON, or as YAML with format=yaml.
+// include_history=true adds the execution history of every task.
+func (sh *StateHandlers) ExportState(c *gin.Context) {
+	format, err := services.ParseStateFormat(c.Query("format"))
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	includeHistory := false
+	if value := c.Query("include_history"); value != "" {
+		if includeHistory, err = strconv.ParseBool(value); err != nil {
+			api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "include_history must be true or false")
+			return
+		}
+	}
+
+	doc, err := sh.stateService.Export(includeHistory)
+	if err != nil {
+		sh.logger.Error("failed to export state", zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to export state")
+		return
+	}
+	data, err := services.EncodeStateDocument(doc, format)
+	if err != nil {
+		sh.logger.Error("failed to encode state document", zap.Error(err))
+		api.RespondError(c, http.StatusInternalServerError, api.CodeInternalError, "Failed to encode state document")
+		return
+	}
+
+	contentType := stateContentTypeJSON
+	if format == services.StateFormatYAML {
+		contentType = stateContentTypeYAML
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportState applies a state document in merge mode, or in replace mode with mode=replace. The
+// document is YAML when the format query parameter or the Content-Type says so, JSON otherwise.
+func (sh *StateHandlers) ImportState(c *gin.Context) {
+	mode, err := models.ParseImportMode(c.Query("mode"))
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	format := c.Query("format")
+	if format == "" && strings.Contains(c.ContentType(), "yaml") {
+		format = services.StateFormatYAML
+	}
+	if format, err = services.ParseStateFormat(format); err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	doc, err := services.DecodeStateDocument(data, format)
+	if err != nil {
+		api.RespondServiceError(c, err, "Invalid state document")
+		return
+	}
+
+	result, err := sh.stateService.Import(doc, mode)
+	if err != nil {
+		sh.logger.Warn("state import rejected", zap.Error(err))
+		api.RespondServiceError(c, err, "Failed to import state")
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
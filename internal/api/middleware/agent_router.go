@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"net/http"
 	"strings"
 
+	"github.com/algonius/algonius-supervisor/internal/api"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -74,8 +76,7 @@ func (arm *AgentRouterMiddleware) AgentValidatorMiddleware(agentProvider AgentPr
 			if arm.logger != nil {
 				arm.logger.Error("agent_id not found in context")
 			}
-			c.JSON(400, gin.H{"error": "Invalid request path"})
-			c.Abort()
+			api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request path")
 			return
 		}
 		
@@ -84,8 +85,7 @@ func (arm *AgentRouterMiddleware) AgentValidatorMiddleware(agentProvider AgentPr
 			if arm.logger != nil {
 				arm.logger.Error("agent_id is not a string in context")
 			}
-			c.JSON(400, gin.H{"error": "Invalid agent ID format"})
-			c.Abort()
+			api.RespondError(c, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid agent ID format")
 			return
 		}
 		
@@ -95,8 +95,7 @@ func (arm *AgentRouterMiddleware) AgentValidatorMiddleware(agentProvider AgentPr
 			if arm.logger != nil {
 				arm.logger.Error("agent not found or invalid", zap.String("agent_id", agentIDStr))
 			}
-			c.JSON(404, gin.H{"error": "Agent not found", "code": -32001})
-			c.Abort()
+			api.RespondError(c, http.StatusNotFound, api.CodeAgentNotFound, "Agent not found")
 			return
 		}
 		
@@ -104,8 +103,7 @@ func (arm *AgentRouterMiddleware) AgentValidatorMiddleware(agentProvider AgentPr
 			if arm.logger != nil {
 				arm.logger.Warn("agent is disabled", zap.String("agent_id", agentIDStr))
 			}
-			c.JSON(403, gin.H{"error": "Agent is disabled"})
-			c.Abort()
+			api.RespondError(c, http.StatusForbidden, api.CodeAgentDisabled, "Agent is disabled")
 			return
 		}
 		
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxAuditedRPCBody bounds how much of a JSON-RPC request is read to find its method
+	maxAuditedRPCBody = 1 << 20
+
+	// maxAuditedField bounds the request-controlled fields of an entry, keeping entries small
+	maxAuditedField = 1024
+)
+
+// Audit records every POST, PUT, PATCH and DELETE request to a route in the audit log once it has
+// been handled, as well as GET requests asking to reveal secrets with reveal=true and requests the
+// Authorizer denied. Entries carry the authorization decision when auth is enabled. When the audit
+// log is fail-closed, mutating and reveal requests are rejected with 503 while the log cannot be
+// written; otherwise they proceed and the failure is logged.
+func Audit(auditLog *services.AuditLog, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		audited := isMutatingMethod(c.Request.Method) || isRevealRequest(c)
+		if audited && auditLog.FailClosed() {
+			if err := auditLog.Writable(); err != nil {
+				logger.Error("rejecting request, the audit log cannot be written",
+					zap.String("path", c.Request.URL.Path),
+					zap.Error(err))
+				api.RespondError(c, http.StatusServiceUnavailable, api.CodeAuditUnavailable, "audit log unavailable")
+				return
+			}
+		}
+
+		entry := &models.AuditEntry{
+			Timestamp: time.Now().UTC(),
+			Actor:     auditActor(c),
+			SourceIP:  c.ClientIP(),
+			Action:    auditAction(c),
+			Target:    auditTarget(c),
+			Summary:   c.Request.Method + " " + c.Request.URL.RequestURI(),
+		}
+
+		c.Next()
+
+		decision := AuthorizationFromContext(c)
+		if !audited && (decision == nil || decision.Allowed) {
+			return
+		}
+		if decision != nil {
+			entry.Role = string(decision.Role)
+			entry.Permission = string(decision.Permission)
+			entry.Decision = models.AuditDecisionDeny
+			if decision.Allowed {
+				entry.Decision = models.AuditDecisionAllow
+			}
+		}
+		entry.RequestID = logging.RequestIDFromContext(c.Request.Context())
+		entry.Status = c.Writer.Status()
+		entry.Outcome = models.AuditOutcomeSuccess
+		if entry.Status >= 400 {
+			entry.Outcome = models.AuditOutcomeFailure
+		}
+		if err := auditLog.Record(entry); err != nil {
+			logger.Error("failed to record audit entry",
+				zap.String("action", entry.Action),
+				zap.String("actor", entry.Actor),
+				zap.Error(err))
+		}
+	}
+}
+
+// isMutatingMethod reports whether requests with the method change state
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRevealRequest reports whether the request is a GET asking for unmasked secrets
+func isRevealRequest(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet {
+		return false
+	}
+	reveal, err := strconv.ParseBool(c.Query("reveal"))
+	return err == nil && reveal
+}
+
+// auditActor returns the principal of the request, as identified for rate limiting
+func auditActor(c *gin.Context) string {
+	if clientID := services.ClientIDFromContext(c.Request.Context()); clientID != "" {
+		return clientID
+	}
+	return ClientID(c, "")
+}
+
+// auditAction names the operation from its route: the route's fixed segments joined by dots,
+// after create, update or delete for routes addressing a collection or a single resource, e.g.
+// agents.create, agents.disable or tasks.delete. GET requests are named after reveal when they
+// reveal secrets, e.g. agents.reveal, and after read otherwise, e.g. audit.read for a denied query
+// of the audit log. JSON-RPC requests are named by their method.
+func auditAction(c *gin.Context) string {
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(c.FullPath(), "/api/v1"), "/") {
+		if segment != "" && !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			segments = append(segments, segment)
+		}
+	}
+
+	if len(segments) == 1 && segments[0] == "jsonrpc" {
+		if method := jsonRPCMethod(c); method != "" {
+			return "jsonrpc." + method
+		}
+	}
+	if isRevealRequest(c) {
+		segments = append(segments, "reveal")
+	} else if c.Request.Method == http.MethodGet {
+		segments = append(segments, "read")
+	}
+	if len(segments) == 1 {
+		switch c.Request.Method {
+		case http.MethodPost:
+			segments = append(segments, "create")
+		case http.MethodPut, http.MethodPatch:
+			segments = append(segments, "update")
+		case http.MethodDelete:
+			segments = append(segments, "delete")
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// auditTarget returns the ID of the resource the request addressed, the last path parameter
+func auditTarget(c *gin.Context) string {
+	if len(c.Params) == 0 {
+		return ""
+	}
+	return c.Params[len(c.Params)-1].Value
+}
+
+// truncateField cuts value to maxAuditedField bytes
+func truncateField(value string) string {
+	if len(value) > maxAuditedField {
+		return value[:maxAuditedField]
+	}
+	return value
+}
+
+// jsonRPCMethod reads the method of a JSON-RPC request, leaving the body for its handler
+func jsonRPCMethod(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditedRPCBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+
+	var request struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+	return request.Method
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/algonius/algonius-supervisor/internal/api"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -32,11 +33,7 @@ func BearerTokenAuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 					zap.String("method", c.Request.Method))
 			}
 			
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header is required",
-				"code":  -32003, // A2A authentication required error code
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "Authorization header is required")
 			return
 		}
 
@@ -52,11 +49,7 @@ func BearerTokenAuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 					zap.String("method", c.Request.Method))
 			}
 			
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid or expired token",
-				"code":  -32003, // A2A authentication required error code
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "Invalid or expired token")
 			return
 		}
 
@@ -91,10 +84,7 @@ func APIKeyAuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 					zap.String("method", c.Request.Method))
 			}
 			
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "API key header is required",
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "API key header is required")
 			return
 		}
 
@@ -106,10 +96,7 @@ func APIKeyAuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 					zap.String("method", c.Request.Method))
 			}
 			
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid API key",
-			})
-			c.Abort()
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "Invalid API key")
 			return
 		}
 
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/server"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// authorizationKey is the gin context key of the request's AuthorizationDecision
+const authorizationKey = "authorization"
+
+// TokenGrant is what a token may do: the permissions of its role, or its own list of permissions
+type TokenGrant struct {
+	Role        models.Role
+	Permissions []models.Permission
+}
+
+// Grants reports whether the grant includes permission
+func (g TokenGrant) Grants(permission models.Permission) bool {
+	if g.Role != "" {
+		return g.Role.Grants(permission)
+	}
+	for _, granted := range g.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationConfig holds the configuration for authorization
+type AuthorizationConfig struct {
+	Enabled     bool
+	Tokens      map[string]TokenGrant // Grants keyed by auth token
+	TokenHeader string                // Header carrying the auth token, "Authorization" when empty
+	SocketPeers *SocketPeerAuth       // Authorizes requests over the unix socket without a token, nil requires one
+}
+
+// SocketPeerAuth grants requests arriving over the unix socket without a token the permissions of
+// Role, when the user running the peer process is allowed
+type SocketPeerAuth struct {
+	Role        models.Role
+	AllowedUIDs []int // Any user when empty
+}
+
+// grant returns the grant of a tokenless request over the unix socket, false when the request did
+// not arrive over the socket or its peer is not allowed
+func (s *SocketPeerAuth) grant(c *gin.Context) (TokenGrant, bool) {
+	peer, overSocket := server.PeerFromContext(c.Request.Context())
+	if s == nil || !overSocket {
+		return TokenGrant{}, false
+	}
+	if len(s.AllowedUIDs) > 0 && (!peer.Known || !slices.Contains(s.AllowedUIDs, peer.UID)) {
+		return TokenGrant{}, false
+	}
+	return TokenGrant{Role: s.Role}, true
+}
+
+// AuthorizationDecision records whether a request was allowed and why
+type AuthorizationDecision struct {
+	Role       models.Role // Empty when the token is granted a list of permissions
+	Permission models.Permission
+	Allowed    bool
+}
+
+// Authorizer checks that the token of each request grants the permission its route requires
+type Authorizer struct {
+	mutex  sync.Mutex
+	config AuthorizationConfig
+	routes map[string]models.Permission
+	logger *zap.Logger
+}
+
+// NewAuthorizer creates an authorizer for routes, the permission each requires keyed by method
+// and gin path, e.g. "GET /api/v1/agents". Routes not listed are served without a token.
+func NewAuthorizer(config AuthorizationConfig, routes map[string]models.Permission, logger *zap.Logger) *Authorizer {
+	return &Authorizer{
+		config: config,
+		routes: routes,
+		logger: logger,
+	}
+}
+
+// UpdateConfig replaces the token grants, e.g. after the config file was reloaded
+func (a *Authorizer) UpdateConfig(config AuthorizationConfig) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.config = config
+}
+
+// KnownToken reports whether token is one of the configured auth tokens, whether or not
+// authorization is enabled
+func (a *Authorizer) KnownToken(token string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	_, known := a.config.Tokens[token]
+	return known
+}
+
+// Middleware rejects requests without a known token with 401, unless socket peer auth grants them a
+// role, and requests whose token or role does not grant the route's permission with 403, naming the
+// permission and the least privileged role granting it. The decision is kept on the context for the
+// audit log.
+func (a *Authorizer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.mutex.Lock()
+		config := a.config
+		a.mutex.Unlock()
+
+		permission, protected := a.routes[c.Request.Method+" "+c.FullPath()]
+		if !config.Enabled || !protected {
+			c.Next()
+			return
+		}
+
+		tokenHeader := config.TokenHeader
+		if tokenHeader == "" {
+			tokenHeader = "Authorization"
+		}
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader(tokenHeader), "Bearer "))
+		grant, known := config.Tokens[token]
+		if token == "" {
+			grant, known = config.SocketPeers.grant(c)
+		}
+		if !known {
+			a.logger.Warn("rejecting request without a valid token",
+				zap.String("path", c.Request.URL.Path),
+				zap.String("method", c.Request.Method))
+			api.RespondError(c, http.StatusUnauthorized, api.CodeUnauthorized, "a valid auth token is required")
+			return
+		}
+
+		decision := &AuthorizationDecision{Role: grant.Role, Permission: permission, Allowed: grant.Grants(permission)}
+		c.Set(authorizationKey, decision)
+		if decision.Allowed {
+			c.Next()
+			return
+		}
+
+		requiredRole := models.MinimumRole(permission)
+		a.logger.Warn("rejecting request the token is not permitted to make",
+			zap.String("path", c.Request.URL.Path),
+			zap.String("method", c.Request.Method),
+			zap.String("permission", string(permission)),
+			zap.String("role", string(grant.Role)))
+		details := map[string]interface{}{
+			"required_permission": permission,
+			"required_role":       requiredRole,
+		}
+		if grant.Role != "" {
+			details["role"] = grant.Role
+		}
+		api.RespondErrorWithDetails(c, http.StatusForbidden, api.CodeForbidden,
+			"this request requires the "+string(permission)+" permission, granted by the "+string(requiredRole)+" role", details)
+	}
+}
+
+// AuthorizationFromContext returns the authorization decision made for the request, nil when the
+// route required no token or authorization is disabled
+func AuthorizationFromContext(c *gin.Context) *AuthorizationDecision {
+	value, exists := c.Get(authorizationKey)
+	if !exists {
+		return nil
+	}
+	decision, _ := value.(*AuthorizationDecision)
+	return decision
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimitConfig caps the size of request bodies
+type BodyLimitConfig struct {
+	MaxBytes     int64    // Largest body accepted, 0 for no limit
+	ExemptRoutes []string // Routes as "METHOD /path" whose handlers cap their bodies themselves, such as uploads
+}
+
+// BodyLimit rejects requests whose body exceeds the configured size with 413 PAYLOAD_TOO_LARGE
+type BodyLimit struct {
+	mutex  sync.RWMutex
+	config BodyLimitConfig
+}
+
+// NewBodyLimit creates a BodyLimit middleware with the given configuration
+func NewBodyLimit(config BodyLimitConfig) *BodyLimit {
+	return &BodyLimit{config: config}
+}
+
+// UpdateConfig replaces the configuration, e.g. after the config file is reloaded
+func (bl *BodyLimit) UpdateConfig(config BodyLimitConfig) {
+	bl.mutex.Lock()
+	bl.config = config
+	bl.mutex.Unlock()
+}
+
+// Middleware caps the body of every request to a route that is not exempt. Bodies sent without a
+// Content-Length are read up to the limit before the handler runs, so every handler answers an
+// oversized body with 413 rather than with a decoding error.
+func (bl *BodyLimit) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bl.mutex.RLock()
+		config := bl.config
+		bl.mutex.RUnlock()
+
+		route := c.Request.Method + " " + c.FullPath()
+		for _, exempt := range config.ExemptRoutes {
+			if route == exempt {
+				c.Next()
+				return
+			}
+		}
+
+		if api.LimitRequestBody(c, config.MaxBytes) {
+			c.Next()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig lists the cross-origin requests browsers may make; no allowed origins disables CORS
+type CORSConfig struct {
+	AllowedOrigins   []string // Exact origins such as https://console.example.com, or "*" for any
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string      // Response headers scripts may read
+	AllowCredentials bool          // Only ever sent to listed origins, not to those "*" allows
+	MaxAge           time.Duration // How long browsers may cache preflight responses
+}
+
+// CORS answers preflight requests and adds CORS headers for allowed origins. Requests from other
+// origins get no CORS headers, so browsers block them.
+type CORS struct {
+	mutex  sync.RWMutex
+	config CORSConfig
+}
+
+// NewCORS creates a CORS middleware with the given configuration
+func NewCORS(config CORSConfig) *CORS {
+	return &CORS{config: config}
+}
+
+// UpdateConfig replaces the configuration, e.g. after the config file is reloaded
+func (cors *CORS) UpdateConfig(config CORSConfig) {
+	cors.mutex.Lock()
+	cors.config = config
+	cors.mutex.Unlock()
+}
+
+// Middleware applies CORS to requests whose path starts with pathPrefix. It runs before routing so
+// preflight requests for routes without an OPTIONS handler are answered too.
+func (cors *CORS) Middleware(pathPrefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !strings.HasPrefix(c.Request.URL.Path, pathPrefix) {
+			c.Next()
+			return
+		}
+
+		cors.mutex.RLock()
+		config := cors.config
+		cors.mutex.RUnlock()
+
+		allowed, wildcard := matchOrigin(config.AllowedOrigins, origin)
+		c.Writer.Header().Add("Vary", "Origin")
+		if !allowed {
+			c.Next()
+			return
+		}
+
+		// Credentials are only allowed for listed origins: with the wildcard any site could send them
+		if wildcard {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			if config.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			if len(config.AllowedHeaders) > 0 {
+				c.Header("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			}
+			if config.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if len(config.ExposedHeaders) > 0 {
+			c.Header("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+		}
+		c.Next()
+	}
+}
+
+// ListsOrigin reports whether origin is listed outright, not only allowed by the "*" wildcard; only
+// listed origins are trusted with credentials
+func (cors *CORS) ListsOrigin(origin string) bool {
+	cors.mutex.RLock()
+	defer cors.mutex.RUnlock()
+	allowed, wildcard := matchOrigin(cors.config.AllowedOrigins, origin)
+	return allowed && !wildcard
+}
+
+// matchOrigin reports whether origin is allowed and whether it was allowed by the "*" wildcard
+func matchOrigin(allowedOrigins []string, origin string) (bool, bool) {
+	for _, allowed := range allowedOrigins {
+		if allowed == origin {
+			return true, false
+		}
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" {
+			return true, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Headers of requests a follower hands to the leader
+const (
+	LeaderHeader      = "X-Supervisor-Leader"       // Identity of the leader, set on redirected and proxied responses
+	ForwardedByHeader = "X-Supervisor-Forwarded-By" // Identity of the follower that proxied the request
+)
+
+// LeaderRouting sends the requests only the leader may serve, every request that is not a GET, HEAD
+// or OPTIONS, from a follower to the leader. Reads are served by every instance from the shared
+// storage.
+type LeaderRouting struct {
+	elector *services.LeaderElector
+	mode    models.FollowerRequestMode
+	proxies map[string]*httputil.ReverseProxy // Proxies by leader address
+	mutex   sync.Mutex
+	logger  *zap.Logger
+}
+
+// NewLeaderRouting creates a LeaderRouting that redirects or proxies to the leader elector last
+// observed, as mode says
+func NewLeaderRouting(elector *services.LeaderElector, mode models.FollowerRequestMode, logger *zap.Logger) *LeaderRouting {
+	if mode == "" {
+		mode = models.FollowerRequestRedirect
+	}
+	return &LeaderRouting{
+		elector: elector,
+		mode:    mode,
+		proxies: make(map[string]*httputil.ReverseProxy),
+		logger:  logger,
+	}
+}
+
+// Middleware passes reads and every request on the leader on, and answers mutations on a follower
+// with a 307 redirect to the leader or the leader's response. Without a known leader, or for a
+// request another follower proxied already, it responds 503.
+func (lr *LeaderRouting) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if lr.elector.IsLeader() {
+			c.Next()
+			return
+		}
+
+		status := lr.elector.Status()
+		if status.LeaderAddress == "" || c.GetHeader(ForwardedByHeader) != "" {
+			c.Header("Retry-After", "1")
+			api.RespondError(c, http.StatusServiceUnavailable, api.CodeNoLeader, "this supervisor is a follower and no leader is available to serve the request")
+			return
+		}
+
+		c.Header(LeaderHeader, status.Leader)
+		if lr.mode == models.FollowerRequestProxy {
+			lr.proxy(c, status)
+			return
+		}
+		c.Redirect(http.StatusTemporaryRedirect, strings.TrimSuffix(status.LeaderAddress, "/")+c.Request.URL.RequestURI())
+		c.Abort()
+	}
+}
+
+// proxy forwards the request to the leader and relays its response
+func (lr *LeaderRouting) proxy(c *gin.Context, status models.LeadershipStatus) {
+	proxy, err := lr.proxyFor(status.LeaderAddress)
+	if err != nil {
+		lr.logger.Error("invalid leader address", zap.String("address", status.LeaderAddress), zap.Error(err))
+		api.RespondError(c, http.StatusBadGateway, api.CodeNoLeader, "the leader's address is invalid")
+		return
+	}
+
+	c.Request.Header.Set(ForwardedByHeader, status.Identity)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+}
+
+// proxyFor returns the reverse proxy to the leader at address
+func (lr *LeaderRouting) proxyFor(address string) (*httputil.ReverseProxy, error) {
+	lr.mutex.Lock()
+	defer lr.mutex.Unlock()
+
+	if proxy, exists := lr.proxies[address]; exists {
+		return proxy, nil
+	}
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("leader address %q is not an absolute URL", address)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		lr.logger.Warn("failed to proxy request to the leader", zap.String("address", address), zap.Error(err))
+		body, _ := json.Marshal(api.ErrorResponse{Code: api.CodeNoLeader, Message: "the leader did not answer"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write(body)
+	}
+	lr.proxies[address] = proxy
+	return proxy, nil
+}
@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// rpcRateLimitedCode is the JSON-RPC server error code returned when a request is rate limited
+const rpcRateLimitedCode = -32000
+
+// RateLimit is a token bucket refilled at RequestsPerSecond holding at most Burst requests
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RateLimitConfig holds the configuration for rate limiting
+type RateLimitConfig struct {
+	Enabled     bool
+	Default     RateLimit            // Applies to clients without an override
+	Clients     map[string]RateLimit // Per-client overrides keyed by client ID
+	ExemptPaths []string             // Paths that are never rate limited
+	TokenHeader string               // Header carrying the auth token, "Authorization" when empty
+}
+
+// bucketSweepInterval is how often buckets that refilled completely are dropped; a new bucket
+// starts full, so dropping them changes no limit
+const bucketSweepInterval = time.Minute
+
+// RateLimiter limits the request rate of each client
+type RateLimiter struct {
+	mutex      sync.Mutex
+	config     RateLimitConfig
+	buckets    map[string]*tokenBucket
+	lastSweep  time.Time
+	knownToken func(token string) bool
+	metrics    *services.MetricsCollector
+	logger     *zap.Logger
+}
+
+// tokenBucket tracks the tokens available to a single client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	fullAt time.Time // When the bucket will have refilled completely
+}
+
+// NewRateLimiter creates a new RateLimiter; metrics may be nil
+func NewRateLimiter(config RateLimitConfig, metrics *services.MetricsCollector, logger *zap.Logger) *RateLimiter {
+	return &RateLimiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		metrics: metrics,
+		logger:  logger,
+	}
+}
+
+// SetTokenCheck sets how the limiter tells the tokens of known clients, which get a bucket of their
+// own, from made-up ones, whose requests are limited by address like those without a token. Tokens
+// with a per-client override are always known; without a check no other token is.
+func (rl *RateLimiter) SetTokenCheck(knownToken func(token string) bool) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.knownToken = knownToken
+}
+
+// UpdateConfig replaces the limits; client buckets restart full under the new limits
+func (rl *RateLimiter) UpdateConfig(config RateLimitConfig) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.config = config
+	rl.buckets = make(map[string]*tokenBucket)
+}
+
+// Allow consumes a token for the client and reports how long to wait when none is available
+func (rl *RateLimiter) Allow(clientID string, now time.Time) (bool, time.Duration) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if now.Sub(rl.lastSweep) >= bucketSweepInterval {
+		rl.sweep(now)
+	}
+
+	limit, exists := rl.config.Clients[clientID]
+	if !exists {
+		limit = rl.config.Default
+	}
+	if limit.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+
+	bucket, exists := rl.buckets[clientID]
+	if !exists {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		rl.buckets[clientID] = bucket
+	}
+
+	// Refill for the time elapsed since the last request
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.RequestsPerSecond)
+	bucket.last = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.fullAt = now.Add(time.Duration((burst - bucket.tokens) / limit.RequestsPerSecond * float64(time.Second)))
+	if allowed {
+		return true, 0
+	}
+
+	wait := (1 - bucket.tokens) / limit.RequestsPerSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep drops the buckets that refilled completely by now; the caller holds the mutex
+func (rl *RateLimiter) sweep(now time.Time) {
+	for clientID, bucket := range rl.buckets {
+		if !bucket.fullAt.After(now) {
+			delete(rl.buckets, clientID)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// Buckets returns the number of clients the limiter tracks
+func (rl *RateLimiter) Buckets() int {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return len(rl.buckets)
+}
+
+// Middleware identifies the client of every request and rejects requests over its rate limit
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rl.mutex.Lock()
+		config := rl.config
+		knownToken := rl.knownToken
+		rl.mutex.Unlock()
+
+		// The client identity also drives the execution service's concurrency quota
+		clientID := limitedClientID(c, config, knownToken)
+		c.Request = c.Request.WithContext(services.WithClientID(c.Request.Context(), clientID))
+
+		if !config.Enabled || isExemptPath(c.Request.URL.Path, config.ExemptPaths) {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := rl.Allow(clientID, time.Now())
+		if allowed {
+			c.Next()
+			return
+		}
+
+		if rl.metrics != nil {
+			rl.metrics.RecordRateLimitRejection(clientID, services.RateLimitReasonRate)
+		}
+		if rl.logger != nil {
+			rl.logger.Warn("request rate limited",
+				zap.String("client_id", clientID),
+				zap.String("path", c.Request.URL.Path),
+				zap.Duration("retry_after", retryAfter))
+		}
+
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		c.Header("Retry-After", strconv.Itoa(seconds))
+
+		if strings.HasPrefix(c.Request.URL.Path, "/jsonrpc") {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"jsonrpc": "2.0",
+				"error": gin.H{
+					"code":    rpcRateLimitedCode,
+					"message": "Rate limit exceeded",
+					"data":    gin.H{"retry_after": seconds},
+				},
+				"id": nil,
+			})
+			return
+		}
+
+		api.RespondErrorWithDetails(c, http.StatusTooManyRequests, api.CodeRateLimited, "rate limit exceeded",
+			map[string]interface{}{"retry_after": seconds})
+	}
+}
+
+// ClientID identifies the caller by its auth token, or by its address when it sent none
+func ClientID(c *gin.Context, tokenHeader string) string {
+	if token := requestToken(c, tokenHeader); token != "" {
+		return services.ClientIDForToken(token)
+	}
+	return services.ClientIDForAddress(c.ClientIP())
+}
+
+// requestToken returns the auth token the request carries in tokenHeader, Authorization when empty
+func requestToken(c *gin.Context, tokenHeader string) string {
+	if tokenHeader == "" {
+		tokenHeader = "Authorization"
+	}
+	return strings.TrimSpace(strings.TrimPrefix(c.GetHeader(tokenHeader), "Bearer "))
+}
+
+// limitedClientID identifies the client of a request by its token when the token has an override
+// or knownToken knows it, and otherwise by its address, so that made-up tokens, such as a new one
+// with every request, get around neither the limit nor the quota
+func limitedClientID(c *gin.Context, config RateLimitConfig, knownToken func(string) bool) string {
+	if token := requestToken(c, config.TokenHeader); token != "" {
+		clientID := services.ClientIDForToken(token)
+		if _, override := config.Clients[clientID]; override || (knownToken != nil && knownToken(token)) {
+			return clientID
+		}
+	}
+	return services.ClientIDForAddress(c.ClientIP())
+}
+
+// isExemptPath reports whether path matches one of the exempt paths
+func isExemptPath(path string, exemptPaths []string) bool {
+	for _, exempt := range exemptPaths {
+		if path == exempt {
+			return true
+		}
+	}
+	return false
+}
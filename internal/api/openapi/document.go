@@ -0,0 +1,197 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+)
+
+// Version is the OpenAPI specification version emitted by Document
+const Version = "3.0.3"
+
+// Document is a minimal OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Components holds reusable schemas
+type Components struct {
+	Schemas map[string]Schema `json:"schemas"`
+}
+
+// Operation describes a single method on a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Permission  string               `json:"x-required-permission,omitempty"` // Permission a token needs when auth is enabled
+}
+
+// Parameter describes a path or query parameter
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+// RequestBody describes a JSON request body
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes a response for one status code
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType wraps the schema of a body
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// Schema is a JSON schema object
+type Schema map[string]interface{}
+
+// Route describes one documented endpoint
+type Route struct {
+	Method      string
+	Path        string // Gin-style path, e.g. /tasks/:taskId
+	OperationID string
+	Summary     string
+	Tag         string
+	Query       []Parameter
+	Request     interface{} // Example value whose type describes the JSON request body, nil for none
+	Response    interface{} // Example value whose type describes the JSON success response, nil for a generic object
+	Status      int         // Success status code, defaults to 200
+	ContentType string      // Success content type, defaults to application/json
+	Permission  string      // Permission a token needs when auth is enabled, see RequiredPermission
+}
+
+// PermissionPublic marks routes callers may use without a token
+const PermissionPublic = "public"
+
+// RequiredPermission returns the permission a token needs to call the route: the route's own
+// Permission, otherwise read for GET requests and manage for the others
+func (r Route) RequiredPermission() string {
+	if r.Permission != "" {
+		return r.Permission
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return "read"
+	}
+	return "manage"
+}
+
+// NewDocument builds a document from the given routes, deriving schemas from the Go types they reference
+func NewDocument(info Info, routes []Route) *Document {
+	doc := &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]map[string]*Operation),
+		Components: Components{Schemas: make(map[string]Schema)},
+	}
+	generator := &schemaGenerator{schemas: doc.Components.Schemas}
+
+	for _, route := range routes {
+		path, pathParams := convertPath(route.Path)
+
+		operation := &Operation{
+			OperationID: route.OperationID,
+			Summary:     route.Summary,
+			Parameters:  append(pathParams, route.Query...),
+			Responses:   make(map[string]*Response),
+		}
+		if route.Tag != "" {
+			operation.Tags = []string{route.Tag}
+		}
+		if permission := route.RequiredPermission(); permission != PermissionPublic {
+			operation.Permission = permission
+		}
+
+		if route.Request != nil {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content: map[string]MediaType{
+					"application/json": {Schema: generator.schemaFor(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = 200
+		}
+		contentType := route.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		responseSchema := Schema{"type": "object"}
+		if route.Response != nil {
+			responseSchema = generator.schemaFor(reflect.TypeOf(route.Response))
+		}
+		operation.Responses[fmt.Sprintf("%d", status)] = &Response{
+			Description: "Success",
+			Content:     map[string]MediaType{contentType: {Schema: responseSchema}},
+		}
+		operation.Responses["default"] = &Response{
+			Description: "Error",
+			Content:     map[string]MediaType{"application/json": {Schema: generator.schemaFor(reflect.TypeOf(api.ErrorResponse{}))}},
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	return doc
+}
+
+// HasOperation reports whether the document describes method on the gin-style path
+func (d *Document) HasOperation(method, ginPath string) bool {
+	path, _ := convertPath(ginPath)
+	operations, ok := d.Paths[path]
+	if !ok {
+		return false
+	}
+	_, ok = operations[strings.ToLower(method)]
+	return ok
+}
+
+// convertPath turns a gin path into an OpenAPI path and its path parameters
+func convertPath(ginPath string) (string, []Parameter) {
+	segments := strings.Split(ginPath, "/")
+	var params []Parameter
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   Schema{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
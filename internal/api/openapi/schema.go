@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawJSONType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schemaGenerator derives JSON schemas from Go types, registering named structs as components
+type schemaGenerator struct {
+	schemas map[string]Schema
+}
+
+// schemaFor returns the schema for t, using a $ref for named struct types
+func (g *schemaGenerator) schemaFor(t reflect.Type) Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case durationType:
+		return Schema{"type": "integer", "format": "int64", "description": "Duration in nanoseconds"}
+	case rawJSONType:
+		// Embedded JSON documents may hold any value
+		return Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "format": "byte"}
+		}
+		return Schema{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, exists := g.schemas[t.Name()]; !exists {
+			// Register a placeholder first so self-referencing types terminate
+			g.schemas[t.Name()] = Schema{}
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		// interface{} and anything else accepts any JSON value
+		return Schema{}
+	}
+}
+
+// structSchema builds an object schema from the exported, JSON-visible fields of t
+func (g *schemaGenerator) structSchema(t reflect.Type) Schema {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for key, value := range g.structSchema(field.Type)["properties"].(map[string]interface{}) {
+				properties[key] = value
+			}
+			continue
+		}
+
+		properties[name] = g.schemaFor(field.Type)
+	}
+
+	return Schema{"type": "object", "properties": properties}
+}
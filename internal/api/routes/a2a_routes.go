@@ -10,11 +10,14 @@ import (
 
 // A2ARouteConfig holds the configuration for A2A routes
 type A2ARouteConfig struct {
-	Router              *gin.Engine
-	A2AService          *services.A2AService
-	AgentService        *services.AgentService
-	ExecutionService    services.IExecutionService
-	A2AConfig           *a2a.A2AConfig
+	Router               *gin.Engine
+	A2AService           *services.A2AService
+	AgentService         *services.AgentService
+	ExecutionService     services.IExecutionService
+	ExecutionCoordinator *services.ExecutionCoordinator
+	A2AConfig            *a2a.A2AConfig
+	PushNotifier         *services.PushNotifier // Optional; enables A2A push notification methods
+	ConversationStore    *services.ConversationStore // Optional; threads messages carrying a conversation ID
 }
 
 // SetupA2ARoutes sets up all A2A-related routes
@@ -22,7 +25,11 @@ func SetupA2ARoutes(config *A2ARouteConfig) {
 	// Create handlers
 	a2aHandler := handlers.NewA2AHandlers(config.A2AService, config.A2AService.GetLogger(), config.A2AConfig)
 	agentDiscoveryHandler := handlers.NewAgentDiscoveryHandlers(config.AgentService, config.A2AService.GetLogger(), config.A2AConfig)
-	jsonrpcHandler := handlers.NewJSONRPCHandlers(config.AgentService, config.ExecutionService, config.A2AService.GetLogger(), config.A2AConfig)
+	jsonrpcHandler := handlers.NewJSONRPCHandlers(config.AgentService, config.ExecutionCoordinator, config.A2AService.GetLogger(), config.A2AConfig)
+	if config.PushNotifier != nil {
+		jsonrpcHandler.SetPushNotifier(config.PushNotifier)
+	}
+	jsonrpcHandler.SetConversationStore(config.ConversationStore)
 
 	// Register A2A protocol routes
 	a2aHandler.RegisterA2ARoutes(config.Router)
@@ -0,0 +1,196 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/services"
+)
+
+// APIRouteConfig holds the configuration for the REST API routes
+type APIRouteConfig struct {
+	Router               *gin.Engine
+	ExecutionService     services.IExecutionService
+	ExecutionCoordinator *services.ExecutionCoordinator
+	AgentService         services.IAgentService         // Serves agent registration and lets agent metrics report unknown agents as not found when set
+	AgentTemplateService services.IAgentTemplateService // Agent template routes are only served when set
+	AgentDefaultsService services.IAgentDefaultsService // Raw agent configurations and reapply-defaults are only served when set
+	AgentGroupService    services.IAgentGroupService    // Agent group routes are only served when set
+	SchedulerService     services.ISchedulerService
+	PipelineService      services.IPipelineService // Pipeline routes are only served when set
+	ConfigValidator      *services.ConfigValidator
+	ConfigReloader       *services.ConfigReloader
+	MetricsCollector     *services.MetricsCollector
+	AuditLog             *services.AuditLog           // The audit query route is only served when set
+	ServerMonitor        *services.ServerMonitor      // Server info, readiness and Prometheus routes are only served when set
+	StateService         *services.StateService       // Export and import routes are only served when set
+	ArtifactStore        *services.ArtifactStore      // Execution artifact routes are only served when set
+	OrphanService        *services.OrphanService      // The orphaned process route is only served when set
+	FaultInjector        *services.FaultInjector      // Fault injection routes are only served when set
+	EventBus             *services.EventBus           // Event stream routes are only served when set; held agent status requests are woken by its events
+	MaintenanceService   *services.MaintenanceService // Maintenance routes are only served when set
+	CalendarService      services.ICalendarService    // Calendar routes are only served when set
+	ConversationStore    *services.ConversationStore  // The A2A conversation route is only served when set
+	CORS                 *middleware.CORS             // Browsers may attach to agents from the origins it lists
+	Logger               *zap.Logger
+	SwaggerUI            bool
+	AllowSecretReveal    bool          // Honour reveal=true on GET agent requests
+	SecretRevealTokens   []string      // Auth tokens that may reveal secrets, any caller when empty
+	StreamHeartbeat      time.Duration // Heartbeat interval of execution streams, 0 for the default
+	UploadDir            string        // Where execute uploads are spooled, the system temp directory when empty
+	MaxUploadBytes       int64         // Largest execute upload accepted, 0 for no limit
+	ExportLabels         []string      // Execution label keys exports have a column for
+}
+
+// SetupAPIRoutes sets up the REST API, health and metrics routes
+func SetupAPIRoutes(config *APIRouteConfig) {
+	// Create and register scheduled task handlers
+	taskHandlers := handlers.NewScheduledTaskHandlers(config.SchedulerService, config.Logger)
+	taskHandlers.RegisterScheduledTaskRoutes(config.Router)
+
+	// Versioned REST API
+	apiV1 := config.Router.Group("/api/v1")
+
+	// Create and register execution query handlers
+	executionHandlers := handlers.NewExecutionHandlers(config.ExecutionService, config.Logger)
+	executionHandlers.SetExportLabels(config.ExportLabels)
+	executionHandlers.RegisterExecutionRoutes(apiV1)
+
+	// Create and register execution artifact handlers
+	if config.ArtifactStore != nil {
+		artifactHandlers := handlers.NewArtifactHandlers(config.ExecutionService, config.ArtifactStore, config.Logger)
+		artifactHandlers.RegisterArtifactRoutes(apiV1)
+	}
+
+	// Running agents needs the coordinator shared with JSON-RPC, so it is only served when one is set
+	if config.ExecutionCoordinator != nil {
+		agentExecutionHandlers := handlers.NewAgentExecutionHandlers(config.ExecutionCoordinator, config.Logger)
+		if config.StreamHeartbeat > 0 {
+			agentExecutionHandlers.SetStreamHeartbeatInterval(config.StreamHeartbeat)
+		}
+		agentExecutionHandlers.SetUploads(config.UploadDir, config.MaxUploadBytes)
+		agentExecutionHandlers.SetMaintenanceService(config.MaintenanceService)
+		agentExecutionHandlers.SetCORS(config.CORS)
+		agentExecutionHandlers.RegisterAgentExecutionRoutes(apiV1)
+	}
+
+	// Create and register agent registration handlers
+	if config.AgentService != nil {
+		agentHandlers := handlers.NewAgentHandlers(config.AgentService, config.Logger)
+		agentHandlers.SetSecretReveal(config.AllowSecretReveal, config.SecretRevealTokens)
+		agentHandlers.SetDefaultsService(config.AgentDefaultsService)
+		agentHandlers.SetEventBus(config.EventBus)
+		agentHandlers.RegisterAgentRoutes(apiV1)
+	}
+
+	// Create and register agent maintenance handlers
+	if config.MaintenanceService != nil {
+		maintenanceHandlers := handlers.NewMaintenanceHandlers(config.MaintenanceService, config.Logger)
+		maintenanceHandlers.RegisterMaintenanceRoutes(apiV1)
+	}
+
+	// Create and register agent template handlers
+	if config.AgentTemplateService != nil {
+		templateHandlers := handlers.NewAgentTemplateHandlers(config.AgentTemplateService, config.Logger)
+		templateHandlers.RegisterAgentTemplateRoutes(apiV1)
+	}
+
+	// Create and register agent group handlers
+	if config.AgentGroupService != nil {
+		groupHandlers := handlers.NewAgentGroupHandlers(config.AgentGroupService, config.AgentService, config.Logger)
+		groupHandlers.RegisterAgentGroupRoutes(apiV1)
+	}
+
+	// Create and register pipeline handlers
+	if config.PipelineService != nil {
+		pipelineHandlers := handlers.NewPipelineHandlers(config.PipelineService, config.Logger)
+		pipelineHandlers.RegisterPipelineRoutes(apiV1)
+	}
+
+	// Create and register calendar handlers
+	if config.CalendarService != nil {
+		calendarHandlers := handlers.NewCalendarHandlers(config.CalendarService, config.Logger)
+		calendarHandlers.RegisterCalendarRoutes(apiV1)
+	}
+
+	// Create and register A2A conversation handlers
+	if config.ConversationStore != nil {
+		conversationHandlers := handlers.NewConversationHandlers(config.ConversationStore, config.Logger)
+		conversationHandlers.RegisterConversationRoutes(apiV1)
+	}
+
+	// Create and register metrics handlers
+	metricsHandlers := handlers.NewMetricsHandlers(config.MetricsCollector, config.AgentService, config.Logger)
+	metricsHandlers.RegisterAgentMetricsRoutes(apiV1)
+	metricsHandlers.RegisterMetricsRoutes(config.Router)
+
+	// Create and register the supervisor's self-monitoring handlers
+	if config.ServerMonitor != nil {
+		serverHandlers := handlers.NewServerHandlers(config.ServerMonitor, config.Logger)
+		serverHandlers.RegisterServerRoutes(apiV1)
+		serverHandlers.RegisterProbeRoutes(config.Router)
+	}
+
+	// Create and register event stream handlers
+	if config.EventBus != nil {
+		eventHandlers := handlers.NewEventHandlers(config.EventBus, config.Logger)
+		if config.StreamHeartbeat > 0 {
+			eventHandlers.SetHeartbeatInterval(config.StreamHeartbeat)
+		}
+		eventHandlers.RegisterEventRoutes(apiV1)
+	}
+
+	// Create and register audit log handlers
+	if config.AuditLog != nil {
+		auditHandlers := handlers.NewAuditHandlers(config.AuditLog, config.Logger)
+		auditHandlers.RegisterAuditRoutes(apiV1)
+	}
+
+	// Create and register orphaned process handlers
+	if config.OrphanService != nil {
+		orphanHandlers := handlers.NewOrphanHandlers(config.OrphanService, config.Logger)
+		orphanHandlers.RegisterOrphanRoutes(apiV1)
+	}
+
+	// Create and register state export and import handlers
+	if config.StateService != nil {
+		stateHandlers := handlers.NewStateHandlers(config.StateService, config.Logger)
+		stateHandlers.RegisterStateRoutes(apiV1)
+	}
+
+	// Create and register fault injection handlers
+	if config.FaultInjector != nil {
+		debugHandlers := handlers.NewDebugHandlers(config.FaultInjector, config.Logger)
+		debugHandlers.RegisterDebugRoutes(apiV1)
+	}
+
+	// Create and register configuration handlers
+	configHandlers := handlers.NewConfigHandlers(config.ConfigValidator, config.ConfigReloader, config.Logger)
+	configHandlers.RegisterConfigRoutes(apiV1)
+
+	// Describe the input/output patterns agents may combine
+	metaHandlers := handlers.NewMetaHandlers(config.Logger)
+	metaHandlers.RegisterMetaRoutes(apiV1)
+
+	// Serve the OpenAPI document and optional Swagger UI
+	openAPIHandlers := handlers.NewOpenAPIHandlers(config.SwaggerUI, config.Logger)
+	openAPIHandlers.RegisterOpenAPIRoutes(apiV1)
+
+	// Define basic routes
+	config.Router.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"status":    "healthy",
+			"service":   "algonius-supervisor",
+			"timestamp": time.Now().UTC(),
+		})
+	})
+
+	// Liveness only checks that the process responds; /health/ready checks it can take work
+	config.Router.GET("/health/live", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "alive"})
+	})
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials asks the kernel for the process on the other end of conn with SO_PEERCRED
+func peerCredentials(conn *net.UnixConn) PeerCredentials {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return PeerCredentials{}
+	}
+	var ucred *syscall.Ucred
+	controlErr := raw.Control(func(fd uintptr) {
+		ucred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if controlErr != nil || err != nil {
+		return PeerCredentials{}
+	}
+	return PeerCredentials{Known: true, PID: int(ucred.Pid), UID: int(ucred.Uid), GID: int(ucred.Gid)}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "net"
+
+// peerCredentials cannot identify the peer on this platform
+func peerCredentials(conn *net.UnixConn) PeerCredentials {
+	return PeerCredentials{}
+}
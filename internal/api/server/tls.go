@@ -0,0 +1,90 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TLSOptions selects the certificate the HTTP server presents and, for mTLS, the CA that client
+// certificates must chain to
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // Empty accepts clients without certificates
+}
+
+// CertificateReloader serves the server certificate and swaps it in place when Reload reads the
+// files again, so renewed certificates apply without restarting the listener
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+}
+
+// NewCertificateReloader loads the certificate and key, failing when either cannot be read or parsed
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	cr := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Reload reads the certificate and key again; on error the previous certificate stays in use
+func (cr *CertificateReloader) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate %s and key %s: %w", cr.certFile, cr.keyFile, err)
+	}
+
+	cr.mutex.Lock()
+	cr.certificate = &certificate
+	cr.mutex.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate; it is used as tls.Config.GetCertificate
+func (cr *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mutex.RLock()
+	defer cr.mutex.RUnlock()
+	return cr.certificate, nil
+}
+
+// NewTLSConfig builds the server TLS configuration from options. With a client CA, clients must
+// present a certificate it signed.
+func NewTLSConfig(options TLSOptions) (*tls.Config, *CertificateReloader, error) {
+	if options.CertFile == "" || options.KeyFile == "" {
+		return nil, nil, errors.New("TLS requires both cert_file and key_file")
+	}
+
+	reloader, err := NewCertificateReloader(options.CertFile, options.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if options.ClientCAFile != "" {
+		pem, err := os.ReadFile(options.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read TLS client CA %s: %w", options.ClientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("TLS client CA %s contains no PEM certificates", options.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, reloader, nil
+}
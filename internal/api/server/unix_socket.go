@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+// DefaultSocketMode is the permissions of the socket file when UnixSocketOptions sets none
+const DefaultSocketMode os.FileMode = 0660
+
+// UnixSocketOptions locates the unix domain socket the API is served on
+type UnixSocketOptions struct {
+	Path string
+	Mode os.FileMode // Permissions of the socket file, DefaultSocketMode when 0
+}
+
+// PeerCredentials identify the process on the other end of a unix socket connection
+type PeerCredentials struct {
+	Known bool // False where the platform cannot tell; the IDs are then unset
+	PID   int
+	UID   int
+	GID   int
+}
+
+// peerKey is the context key of the credentials of a unix socket connection's peer
+type peerKey struct{}
+
+// ListenUnix listens on the socket and sets its permissions. A socket file left behind by a
+// supervisor that did not shut down cleanly is replaced; a socket something still listens on, or a
+// file that is not a socket, is not.
+func ListenUnix(options UnixSocketOptions) (net.Listener, error) {
+	if err := removeStaleSocket(options.Path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", options.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket %s: %w", options.Path, err)
+	}
+	mode := options.Mode
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err := os.Chmod(options.Path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions %#o of unix socket %s: %w", mode, options.Path, err)
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket file at path unless something listens on it
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check unix socket %s: %w", path, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unix socket path %s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("unix socket %s is in use by another process", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// ConnContext records the peer credentials of unix socket connections on the context of their
+// requests; it is used as http.Server.ConnContext
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, peerKey{}, peerCredentials(unixConn))
+}
+
+// PeerFromContext returns the credentials of the peer a request arrived from over the unix socket,
+// false for requests over TCP
+func PeerFromContext(ctx context.Context) (PeerCredentials, bool) {
+	peer, ok := ctx.Value(peerKey{}).(PeerCredentials)
+	return peer, ok
+}
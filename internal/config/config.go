@@ -2,17 +2,31 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
 )
 
+// MinAuditMaxBytes is the smallest size at which the audit log may rotate, well above the size of an entry
+const MinAuditMaxBytes = 64 << 10
+
 // Config holds the application configuration
 type Config struct {
 	Host       string `mapstructure:"host"`
 	Port       int    `mapstructure:"port"`
 	Environment string `mapstructure:"environment"`
 	LogLevel   string `mapstructure:"log_level"`
+	DataDir    string `mapstructure:"data_dir"` // Directory for supervisor-managed state such as agent sandboxes
 	
 	// A2A Configuration
 	A2A struct {
@@ -24,35 +38,517 @@ type Config struct {
 	
 	// Agent Configuration
 	Agents []AgentConfig `mapstructure:"agents"`
+
+	// Scheduled Task Configuration
+	Tasks []TaskConfig `mapstructure:"tasks"`
 	
 	// Scheduler Configuration
 	Scheduler struct {
-		Enabled bool `mapstructure:"enabled"`
+		Enabled             bool          `mapstructure:"enabled"`
+		MaxTaskTimeout      int           `mapstructure:"max_task_timeout"`      // Upper bound for per-task timeouts in seconds, 0 for no cap
+		CatchUpInterval     time.Duration `mapstructure:"catch_up_interval"`     // Delay between consecutive catch-up runs of a task
+		Timezone            string        `mapstructure:"timezone"`              // IANA time zone cron expressions are evaluated in, e.g. "Europe/Berlin"; empty for the server's local time
+		DriftWarnThreshold  time.Duration `mapstructure:"drift_warn_threshold"`  // A fire running this long after its planned time is logged as late
+		MissedFireTolerance time.Duration `mapstructure:"missed_fire_tolerance"` // A planned fire that has not happened this long after its time is reported missed
+		ShutdownTimeout     time.Duration `mapstructure:"shutdown_timeout"`      // How long shutting down waits for the cancelled runs in progress to return
 	} `mapstructure:"scheduler"`
+
+	// Execution History Configuration
+	History struct {
+		Backend           string        `mapstructure:"backend"`            // "memory" or "sqlite"
+		Path              string        `mapstructure:"path"`               // Database file for the sqlite backend
+		Retention         time.Duration `mapstructure:"retention"`          // Maximum age of history records, 0 to keep forever
+		RetentionInterval time.Duration `mapstructure:"retention_interval"` // How often expired records are deleted
+	} `mapstructure:"history"`
+
+	// State Storage Configuration; agents, tasks and executions are kept in memory unless a database
+	// stores them, which several supervisor instances may share with the postgres backend
+	Storage struct {
+		Backend  string `mapstructure:"backend"` // "memory", "sqlite" or "postgres"
+		Path     string `mapstructure:"path"`    // Database file for the sqlite backend
+		Postgres struct {
+			DSN          string `mapstructure:"dsn"`            // Connection string, e.g. postgres://supervisor@db/supervisor
+			Driver       string `mapstructure:"driver"`         // database/sql driver, "pgx" unless overridden
+			MaxOpenConns int    `mapstructure:"max_open_conns"` // Connections opened at most, 0 for no limit
+		} `mapstructure:"postgres"`
+	} `mapstructure:"storage"`
+
+	// Leader Election Configuration; supervisor instances sharing storage elect one leader that alone
+	// schedules tasks, runs agent processes and delivers webhooks while every instance serves reads
+	LeaderElection struct {
+		Enabled          bool          `mapstructure:"enabled"`
+		Backend          string        `mapstructure:"backend"`           // "storage" for a lease row in the shared database, "file" for a lease file on one host
+		LeaseFile        string        `mapstructure:"lease_file"`        // Lease file of the file backend, <data_dir>/leader.lease when empty
+		LeaseDuration    time.Duration `mapstructure:"lease_duration"`    // How long a lease lasts without renewal
+		RenewInterval    time.Duration `mapstructure:"renew_interval"`    // How often the leader renews its lease, at most a third of the duration
+		Identity         string        `mapstructure:"identity"`          // Name of this instance, <hostname>-<pid> when empty
+		AdvertiseAddress string        `mapstructure:"advertise_address"` // Base URL other instances reach this one at, e.g. http://supervisor-a:8080
+		FollowerRequests string        `mapstructure:"follower_requests"` // redirect or proxy mutations a follower receives to the leader
+	} `mapstructure:"leader_election"`
+
+	// Execution Artifact Configuration; artifacts are deleted along with history records past the retention
+	Artifacts struct {
+		Dir           string `mapstructure:"dir"`             // Directory holding each execution's artifacts, <data_dir>/artifacts when empty
+		MaxCount      int    `mapstructure:"max_count"`       // Files kept per execution, the rest are rejected
+		MaxTotalBytes int64  `mapstructure:"max_total_bytes"` // Total size of the files kept per execution
+	} `mapstructure:"artifacts"`
+
+	// Orphaned Agent Process Configuration; running agent processes are tracked in state files so
+	// the ones a crashed supervisor left behind are found at startup
+	Orphans struct {
+		Dir           string        `mapstructure:"dir"`            // Directory holding the state files, <data_dir>/processes when empty
+		Policy        string        `mapstructure:"policy"`         // auto, adopt, terminate or report; auto adopts interactive agents and terminates task executions
+		WatchInterval time.Duration `mapstructure:"watch_interval"` // How often adopted orphans are checked for having exited
+	} `mapstructure:"orphans"`
+
+	// Execution Result Cache Configuration
+	ResultCache struct {
+		MaxEntries int `mapstructure:"max_entries"` // Results kept for agents with cache_ttl_seconds, least recently used evicted first
+	} `mapstructure:"result_cache"`
+
+	// Idempotency Key Configuration
+	Idempotency struct {
+		Window  time.Duration `mapstructure:"window"`   // How long a key keeps returning its finished execution
+		MaxKeys int           `mapstructure:"max_keys"` // Keys remembered, oldest evicted first
+	} `mapstructure:"idempotency"`
+
+	// Execution Retry Configuration; an execution's attempts and the waits between them share its
+	// timeout as a budget
+	Retries struct {
+		MinAttemptDuration time.Duration `mapstructure:"min_attempt_duration"` // Retries are abandoned once less of the budget remains
+	} `mapstructure:"retries"`
+
+	// Defaults Configuration; settings agents and executions get when they set none of their own.
+	// Changed defaults only apply to agents registered or updated afterwards; POST
+	// /api/v1/agents/reapply-defaults merges them into the agents already registered.
+	Defaults struct {
+		Agent     AgentConfig `mapstructure:"agent"` // Fills each agent's unset settings after its template; id and name are ignored, booleans can only be turned on
+		Execution struct {
+			Timeout        int           `mapstructure:"timeout"`          // Seconds executions of agents without a timeout may run, 0 for no limit
+			MaxOutputBytes int64         `mapstructure:"max_output_bytes"` // Output kept per stream of each execution of agents without max_output_bytes
+			MaxRetries     int           `mapstructure:"max_retries"`      // Most attempts of a transiently failing execution, the first included
+			RetryBackoff   time.Duration `mapstructure:"retry_backoff"`    // Wait before the first retry, growing linearly with each retry
+		} `mapstructure:"execution"`
+	} `mapstructure:"defaults"`
+
+	// API Configuration
+	API struct {
+		SwaggerUI            bool          `mapstructure:"swagger_ui"`             // Serve Swagger UI at /api/v1/docs
+		OperationWaitTimeout time.Duration `mapstructure:"operation_wait_timeout"` // How long ?wait=true lifecycle requests wait for a conflicting operation
+		StreamHeartbeat      time.Duration `mapstructure:"stream_heartbeat"`       // Heartbeat interval of server-sent execution streams
+		MaxBodyBytes         int64         `mapstructure:"max_body_bytes"`         // Largest request body accepted, 0 for no limit; larger ones get 413
+		MaxUploadBytes       int64         `mapstructure:"max_upload_bytes"`       // Largest file accepted by execute/upload, 0 for no limit
+		UploadDir            string        `mapstructure:"upload_dir"`             // Directory uploads are spooled to while their execution runs, <data_dir>/uploads when empty
+		ExportLabels         []string      `mapstructure:"export_labels"`          // Execution label keys executions/export has a column for
+		TrustedProxies       []string      `mapstructure:"trusted_proxies"`        // Addresses or CIDRs of proxies whose X-Forwarded-For names the client; none trusts no header
+
+		// Binary input of execute requests, sent as input_base64 or fetched from input_url
+		Input struct {
+			AllowedSchemes []string      `mapstructure:"allowed_schemes"` // Schemes input_url may use
+			AllowedHosts   []string      `mapstructure:"allowed_hosts"`   // Hosts input_url may name, *.example.com matching subdomains; none disables input_url
+			MaxBytes       int64         `mapstructure:"max_bytes"`       // Largest input accepted, 0 for no limit
+			FetchTimeout   time.Duration `mapstructure:"fetch_timeout"`   // How long fetching input_url may take
+		} `mapstructure:"input"`
+	} `mapstructure:"api"`
+
+	// HTTPS Configuration; when enabled the server only accepts TLS connections
+	TLS struct {
+		Enabled      bool   `mapstructure:"enabled"`
+		CertFile     string `mapstructure:"cert_file"`
+		KeyFile      string `mapstructure:"key_file"`
+		ClientCAFile string `mapstructure:"client_ca_file"` // Require client certificates signed by this CA (mTLS)
+	} `mapstructure:"tls"`
+
+	// Unix Domain Socket Configuration; the REST API is served on the socket besides host:port, or
+	// instead of it with disable_tcp. Requests over the socket never use TLS.
+	Socket struct {
+		Path       string `mapstructure:"path"`        // e.g. /var/run/supervisor.sock; empty serves no socket
+		Mode       string `mapstructure:"mode"`        // Octal permissions of the socket file
+		DisableTCP bool   `mapstructure:"disable_tcp"` // Only serve on the socket
+
+		// With auth enabled, requests over the socket without a token are authorized by the
+		// credentials of the process on the other end
+		PeerAuth struct {
+			Enabled     bool   `mapstructure:"enabled"`
+			Role        string `mapstructure:"role"`         // Role granted to tokenless socket requests
+			AllowedUIDs []int  `mapstructure:"allowed_uids"` // Users whose processes may omit the token, any user when empty
+		} `mapstructure:"peer_auth"`
+	} `mapstructure:"socket"`
+
+	// CORS Configuration for /api/v1 routes
+	CORS struct {
+		AllowedOrigins   []string      `mapstructure:"allowed_origins"` // Empty disables CORS; "*" allows any origin
+		AllowedMethods   []string      `mapstructure:"allowed_methods"`
+		AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+		AllowCredentials bool          `mapstructure:"allow_credentials"` // Not allowed with "*"
+		MaxAge           time.Duration `mapstructure:"max_age"` // How long browsers may cache preflight responses
+	} `mapstructure:"cors"`
+
+	// Rate Limiting Configuration
+	RateLimit struct {
+		Enabled                 bool             `mapstructure:"enabled"`
+		RequestsPerSecond       float64          `mapstructure:"requests_per_second"`       // Default request rate per client
+		Burst                   int              `mapstructure:"burst"`                     // Default burst size per client
+		MaxConcurrentExecutions int              `mapstructure:"max_concurrent_executions"` // Default in-flight executions per client, 0 for unlimited
+		ExemptPaths             []string         `mapstructure:"exempt_paths"`              // Paths that are never rate limited
+		Tokens                  []TokenRateLimit `mapstructure:"tokens"`                    // Per auth token overrides
+	} `mapstructure:"rate_limit"`
+
+	// REST API Authentication and Authorization Configuration; A2A and JSON-RPC routes authenticate
+	// with the a2a settings instead
+	Auth struct {
+		Enabled bool         `mapstructure:"enabled"` // Require a token listed in tokens on REST API requests
+		Tokens  []TokenGrant `mapstructure:"tokens"`
+	} `mapstructure:"auth"`
+
+	// Audit Log Configuration
+	Audit struct {
+		Enabled    bool   `mapstructure:"enabled"`
+		Path       string `mapstructure:"path"`        // Append-only JSONL file of mutating requests
+		MaxBytes   int64  `mapstructure:"max_bytes"`   // Size at which the file rotates to path.1, 0 never rotates
+		Backups    int    `mapstructure:"backups"`     // Rotated files kept
+		FailClosed bool   `mapstructure:"fail_closed"` // Reject mutating requests while the audit log cannot be written
+		LogLevel   string `mapstructure:"log_level"`   // Also log entries at this level, e.g. "info"; empty disables it
+	} `mapstructure:"audit"`
+
+	// Secret Configuration; the values of sensitive agent environment variables are masked in API
+	// responses and exports
+	Secrets struct {
+		AllowReveal  bool     `mapstructure:"allow_reveal"`  // Let GET agent requests pass reveal=true; requires the audit log
+		RevealTokens []string `mapstructure:"reveal_tokens"` // Auth tokens that may reveal, any caller when empty
+	} `mapstructure:"secrets"`
+
+	// Persistent Agent Process Event Configuration
+	ProcessEvents struct {
+		WebhookURL   string `mapstructure:"webhook_url"`   // Receives a POST when a persistent agent enters the fatal state, empty to only log it
+		WebhookToken string `mapstructure:"webhook_token"` // Bearer token sent with webhook requests
+	} `mapstructure:"process_events"`
+
+	// Agent Template Configuration
+	AgentTemplates struct {
+		PropagateUpdates bool `mapstructure:"propagate_updates"` // Merge template updates into the agents using the template; false only affects agents registered afterwards
+	} `mapstructure:"agent_templates"`
+
+	// Deleted Agent Configuration; deleted agents can be restored until they are purged
+	AgentDeletion struct {
+		Retention     time.Duration `mapstructure:"retention"`      // How long soft-deleted agents are kept, 0 to keep them until restored
+		SweepInterval time.Duration `mapstructure:"sweep_interval"` // How often agents past the retention are purged
+	} `mapstructure:"agent_deletion"`
+
+	// Agent Validation Configuration
+	Validation struct {
+		Strict bool `mapstructure:"strict"` // Reject agents whose executable or directories are missing; false only warns
+	} `mapstructure:"validation"`
+
+	// Metrics Configuration
+	Metrics struct {
+		LabelAllowList []string      `mapstructure:"label_allowlist"` // Execution label keys tracked as metric dimensions
+		Window         time.Duration `mapstructure:"window"`          // Sliding window for per-agent duration percentiles
+		WindowSamples  int           `mapstructure:"window_samples"`  // Executions kept per agent for the sliding window
+	} `mapstructure:"metrics"`
+
+	// Health Probe Configuration
+	Health struct {
+		MaxExecutionBacklog int `mapstructure:"max_execution_backlog"` // /health/ready fails while more executions wait to start
+	} `mapstructure:"health"`
+
+	// Read-Write Agent Queue Alert Configuration; an alert fires when a queue rises above a max bound
+	// and clears once it is back within every clear bound
+	QueueAlerts struct {
+		Enabled          bool                  `mapstructure:"enabled"`
+		Interval         time.Duration         `mapstructure:"interval"`           // How often queues are checked
+		MaxQueueLength   int                   `mapstructure:"max_queue_length"`   // Waiting executions that fire an alert when exceeded, 0 to ignore
+		ClearQueueLength int                   `mapstructure:"clear_queue_length"` // Waiting executions an alert clears at, half of max_queue_length when 0
+		MaxWait          time.Duration         `mapstructure:"max_wait"`           // Wait of the oldest queued execution that fires an alert when exceeded, 0 to ignore
+		ClearWait        time.Duration         `mapstructure:"clear_wait"`         // Wait an alert clears at, half of max_wait when 0
+		Agents           []QueueAlertThreshold `mapstructure:"agents"`             // Per agent overrides
+	} `mapstructure:"queue_alerts"`
+
+	// Execution Anomaly Configuration; finished executions are flagged when they run far longer, or
+	// fail while far more fail, than the recent executions of their agent or task
+	Anomalies struct {
+		Enabled              bool    `mapstructure:"enabled"`
+		Window               int     `mapstructure:"window"`                 // Recent executions of each agent and task the baseline covers
+		MinSamples           int     `mapstructure:"min_samples"`            // Executions a baseline needs before anything is flagged
+		DurationStdDevs      float64 `mapstructure:"duration_stddevs"`       // Standard deviations above the mean a duration_high execution ran
+		DurationMinRatio     float64 `mapstructure:"duration_min_ratio"`     // Multiple of the mean a duration_high execution ran at least
+		FailureRateThreshold float64 `mapstructure:"failure_rate_threshold"` // Share of failed executions that flags failure_rate_high, 0 to never flag
+	} `mapstructure:"anomalies"`
+
+	// Maintenance Configuration; during these windows no agent's scheduled tasks run, persistent
+	// agents are not restarted automatically and health checks raise no alerts
+	Maintenance struct {
+		Windows []MaintenanceWindowConfig `mapstructure:"windows"`
+	} `mapstructure:"maintenance"`
+
+	// Lifecycle Safety Configuration; guards restarts, starts, enables and disables of agent groups
+	// and agent patterns such as * against hitting more agents than meant
+	LifecycleSafety struct {
+		ProtectedAgents     []string      `mapstructure:"protected_agents"`      // Agent IDs or patterns left out of such operations unless force=true
+		ConfirmAboveAgents  int           `mapstructure:"confirm_above_agents"`  // Operations on more agents answer 428 until confirmed, 0 for no limit
+		ConfirmAbovePercent float64       `mapstructure:"confirm_above_percent"` // Operations on a larger share of all agents answer 428 until confirmed, 0 for no limit
+		ConfirmationTTL     time.Duration `mapstructure:"confirmation_ttl"`      // How long a confirmation token can be resent
+	} `mapstructure:"lifecycle_safety"`
+
+	// Calendars of days on which the scheduled tasks skipping them do not run, such as exchange
+	// holidays; more can be managed at /api/v1/calendars
+	Calendars []CalendarConfig `mapstructure:"calendars"`
+
+	// Debug Configuration; never enable in production
+	Debug struct {
+		FaultInjection bool `mapstructure:"fault_injection"` // Serve /api/v1/debug/faults to inject failures and delays into executions and webhooks
+	} `mapstructure:"debug"`
+}
+
+// MaintenanceWindowConfig is a recurring maintenance window: it starts whenever the cron schedule
+// fires and lasts for the duration
+type MaintenanceWindowConfig struct {
+	Schedule string `mapstructure:"schedule"` // Cron expression, e.g. "0 2 * * sun"
+	Duration string `mapstructure:"duration"` // e.g. "1h30m"
+	Timezone string `mapstructure:"timezone"` // IANA zone; the scheduler's time zone when empty
+	Reason   string `mapstructure:"reason"`
+}
+
+// LifecycleHookConfig is a command run, or a URL called, at a point of a persistent agent's
+// lifecycle
+type LifecycleHookConfig struct {
+	Command        []string `mapstructure:"command"`         // Program and its arguments
+	URL            string   `mapstructure:"url"`             // Called with a JSON body instead; 2xx responses succeed
+	Method         string   `mapstructure:"method"`          // POST when empty
+	TimeoutSeconds int      `mapstructure:"timeout_seconds"` // 0 uses the 30s default
+	OnFailure      string   `mapstructure:"on_failure"`      // post_start_hook: degrade or fail; pre_stop_hook: proceed or abort
+}
+
+// validate checks the window's duration and time zone; its schedule is checked where the
+// scheduler's cron parser is available
+func (w MaintenanceWindowConfig) validate() error {
+	if w.Schedule == "" {
+		return fmt.Errorf("schedule is required")
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("duration must be a positive duration such as '1h30m', got %q", w.Duration)
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+		}
+	}
+	return nil
+}
+
+// CalendarConfig is a named calendar of excluded days, listed inline, read from an iCalendar file
+// or read from a YAML file listing them, or any combination of these
+type CalendarConfig struct {
+	Name        string   `mapstructure:"name"`
+	Description string   `mapstructure:"description"`
+	Dates       []string `mapstructure:"dates"`      // Days such as "2026-12-25" or ranges such as "2026-12-24..2026-12-26"
+	ICalFile    string   `mapstructure:"ical_file"`  // .ics file whose events' days are excluded
+	DatesFile   string   `mapstructure:"dates_file"` // YAML list of days, ranges or {start, end, reason} entries
+}
+
+// validate checks the calendar's name and inline dates; its files are read when it is loaded
+func (c CalendarConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	for _, dates := range c.Dates {
+		if _, err := models.ParseDateRange(dates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueAlertThreshold overrides the queue alert thresholds for one agent; zero values inherit the defaults
+type QueueAlertThreshold struct {
+	AgentID          string        `mapstructure:"agent_id"`
+	MaxQueueLength   int           `mapstructure:"max_queue_length"`
+	ClearQueueLength int           `mapstructure:"clear_queue_length"`
+	MaxWait          time.Duration `mapstructure:"max_wait"`
+	ClearWait        time.Duration `mapstructure:"clear_wait"`
+}
+
+// QueueAlertThresholds returns the default queue alert thresholds and the thresholds of every agent
+// with overrides, merged with the defaults
+func (c *Config) QueueAlertThresholds() (QueueAlertThreshold, []QueueAlertThreshold) {
+	alerts := c.QueueAlerts
+	defaults := QueueAlertThreshold{
+		MaxQueueLength:   alerts.MaxQueueLength,
+		ClearQueueLength: alerts.ClearQueueLength,
+		MaxWait:          alerts.MaxWait,
+		ClearWait:        alerts.ClearWait,
+	}
+
+	agents := make([]QueueAlertThreshold, 0, len(alerts.Agents))
+	for _, override := range alerts.Agents {
+		threshold := defaults
+		threshold.AgentID = override.AgentID
+		if override.MaxQueueLength != 0 {
+			threshold.MaxQueueLength = override.MaxQueueLength
+		}
+		if override.ClearQueueLength != 0 {
+			threshold.ClearQueueLength = override.ClearQueueLength
+		}
+		if override.MaxWait != 0 {
+			threshold.MaxWait = override.MaxWait
+		}
+		if override.ClearWait != 0 {
+			threshold.ClearWait = override.ClearWait
+		}
+		agents = append(agents, threshold)
+	}
+	return defaults, agents
+}
+
+// validate checks that the thresholds are non-negative and every clear bound lies below its max
+func (t QueueAlertThreshold) validate() error {
+	if t.MaxQueueLength < 0 || t.ClearQueueLength < 0 || t.MaxWait < 0 || t.ClearWait < 0 {
+		return fmt.Errorf("queue alert thresholds cannot be negative")
+	}
+	if t.MaxQueueLength > 0 && t.ClearQueueLength >= t.MaxQueueLength {
+		return fmt.Errorf("queue alert clear_queue_length %d must be below max_queue_length %d", t.ClearQueueLength, t.MaxQueueLength)
+	}
+	if t.MaxWait > 0 && t.ClearWait >= t.MaxWait {
+		return fmt.Errorf("queue alert clear_wait %s must be below max_wait %s", t.ClearWait, t.MaxWait)
+	}
+	return nil
+}
+
+// SchedulerLocation returns the time zone the scheduler evaluates cron expressions in
+func (c *Config) SchedulerLocation() (*time.Location, error) {
+	if c.Scheduler.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(c.Scheduler.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler timezone %q is not a known time zone: %w", c.Scheduler.Timezone, err)
+	}
+	return location, nil
+}
+
+// SocketMode returns the permissions of the unix socket file, 0660 when unset
+func (c *Config) SocketMode() (os.FileMode, error) {
+	if c.Socket.Mode == "" {
+		return 0660, nil
+	}
+	mode, err := strconv.ParseUint(c.Socket.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("socket mode must be octal permissions such as 0660, got %q", c.Socket.Mode)
+	}
+	return os.FileMode(mode), nil
 }
 
 // AgentConfig defines the configuration for an individual agent
 type AgentConfig struct {
 	ID                  string            `mapstructure:"id"`
 	Name                string            `mapstructure:"name"`
+	Description         string            `mapstructure:"description"`
+	InputSchema         string            `mapstructure:"input_schema"` // JSON Schema of execute request parameters, as a JSON string since config keys are read regardless of case
+	Examples            []AgentExampleConfig `mapstructure:"examples"`
+	ValidateInput       bool              `mapstructure:"validate_input"` // Reject execute requests whose parameters violate input_schema
 	AgentType           string            `mapstructure:"agent_type"`
 	ExecutablePath      string            `mapstructure:"executable_path"`
 	WorkingDirectory    string            `mapstructure:"working_directory"`
 	Envs                map[string]string `mapstructure:"envs"`
+	SensitiveEnvKeys    []string          `mapstructure:"sensitive_env_keys"` // Envs masked in API responses besides secret-like names
 	CliArgs             map[string]string `mapstructure:"cli_args"`
-	Mode                string            `mapstructure:"mode"` // "task" or "interactive"
+	Parameters          map[string]string `mapstructure:"parameters"` // Settings of built-in agent types, e.g. the synthetic agent's duration
+	Mode                string            `mapstructure:"mode"` // "task", "interactive" or "persistent"
 	InputPattern        string            `mapstructure:"input_pattern"`
 	OutputPattern       string            `mapstructure:"output_pattern"`
 	InputFileTemplate   string            `mapstructure:"input_file_template"`
-	OutputFileTemplate  string            `mapstructure:"output_file_template"`
+	OutputFileTemplate  string            `mapstructure:"output_file_template"` // May hold a glob; the newest match is read
+	OutputFileWaitSeconds int             `mapstructure:"output_file_wait_seconds"` // Wait for the output file to appear; 0 reads it at once
+	OutputFileStable    bool              `mapstructure:"output_file_stable"`   // Within the wait, also until the file is non-empty and stops growing
+	OutputSelector      string            `mapstructure:"output_selector"` // For output_pattern json, e.g. "$.items[0].name"
+	AllowIncompatiblePatterns bool        `mapstructure:"allow_incompatible_patterns"` // Only warn when input and output patterns are incompatible
+	OutputEncoding      string            `mapstructure:"output_encoding"` // text, json or base64; executions may override it
+	SandboxDir          string            `mapstructure:"sandbox_dir"`    // Defaults to <data_dir>/sandbox/<id>
+	KeepArtifacts       bool              `mapstructure:"keep_artifacts"` // Keep per-execution sandbox directories
+	MaxOutputBytes      int64             `mapstructure:"max_output_bytes"` // Output kept per stream of each execution; 0 uses defaults.execution.max_output_bytes
+	StdoutLogfile       string            `mapstructure:"stdout_logfile"`   // May use {{agent_id}}; empty disables it
+	StderrLogfile       string            `mapstructure:"stderr_logfile"`   // May use {{agent_id}}; empty disables it
+	LogfileMaxBytes     int64             `mapstructure:"logfile_maxbytes"` // 0 uses the 50MiB default
+	LogfileBackups      int               `mapstructure:"logfile_backups"`  // 0 uses the default of 10
+	CacheTTLSeconds     int               `mapstructure:"cache_ttl_seconds"` // Read-only agents only; 0 disables result caching
+	RunAsUser           string            `mapstructure:"run_as_user"`     // Linux only; switching users requires running as root
+	RunAsGroup          string            `mapstructure:"run_as_group"`    // Defaults to the primary group of run_as_user
+	NiceLevel           int               `mapstructure:"nice_level"`      // -20 to 19; negative values require root
+	MaxMemoryMB         int64             `mapstructure:"max_memory_mb"`   // Linux only; 0 for unlimited
+	MaxCPUSeconds       int64             `mapstructure:"max_cpu_seconds"` // Linux only; 0 for unlimited
+	SkipFSChecks        bool              `mapstructure:"skip_fs_checks"`  // Only warn about missing executables and directories
+	StopSignal          string            `mapstructure:"stop_signal"`     // TERM, INT, QUIT, HUP, USR1, USR2 or KILL; defaults to TERM
+	StopWaitSeconds     int               `mapstructure:"stop_wait_seconds"` // Wait for exit before killing; 0 uses the 10s default
+	MaxSilenceSeconds   int               `mapstructure:"max_silence_seconds"` // Watchdog: stop executions silent this long; at most the timeout
+	HeartbeatFile       string            `mapstructure:"heartbeat_file"`      // Watchdog: touching this file counts as activity
+	HeartbeatLine       string            `mapstructure:"heartbeat_line"`      // Watchdog: only this output line counts as activity
+	PingIntervalSeconds int               `mapstructure:"ping_interval_seconds"` // Persistent mode health checks; 0 uses the 30s default
+	PingTimeoutSeconds  int               `mapstructure:"ping_timeout_seconds"`  // Persistent mode; 0 uses the 5s default
+	StartRetries        int               `mapstructure:"start_retries"`         // Persistent mode failed starts before FATAL; 0 uses the default of 3
+	StartSecs           int               `mapstructure:"start_secs"`            // Persistent mode run time a start must last; 0 uses the 1s default
+	PostStartHook       *LifecycleHookConfig `mapstructure:"post_start_hook"`    // Persistent mode: run once the process is running, e.g. to warm caches
+	PreStopHook         *LifecycleHookConfig `mapstructure:"pre_stop_hook"`      // Persistent mode: run before the stop signal, e.g. to drain a queue
+	MaintenanceWindows  []MaintenanceWindowConfig `mapstructure:"maintenance_windows"` // No scheduled runs, automatic restarts or health check alerts during these
+	ExitCodeMap         map[string]string `mapstructure:"exit_code_map"` // Code or range, e.g. "1" or "2-5", to success, warning or failure
 	AccessType          string            `mapstructure:"access_type"` // "read-only" or "read-write"
 	MaxConcurrentExecutions int           `mapstructure:"max_concurrent_executions"`
+	Weight              int               `mapstructure:"weight"` // Read-only agents' share of contended pool slots; 0 means 1
 	Timeout             int               `mapstructure:"timeout"`
 	SessionTimeout      int               `mapstructure:"session_timeout"`
+	MaxTotalTimeout     int               `mapstructure:"max_total_timeout"` // Cap in seconds for executions whose deadline is extended; 0 allows no extensions
 	KeepAlive           bool              `mapstructure:"keep_alive"`
 	Enabled             bool              `mapstructure:"enabled"`
 }
 
+// AgentExampleConfig is an example call of an agent shown to consumers discovering it
+type AgentExampleConfig struct {
+	Description string `mapstructure:"description"`
+	Input       string `mapstructure:"input"`
+	Parameters  string `mapstructure:"parameters"` // JSON object, as a string like input_schema
+}
+
+// TokenRateLimit overrides the default rate limits for one auth token; zero values inherit the defaults
+type TokenRateLimit struct {
+	Token                   string  `mapstructure:"token"`
+	RequestsPerSecond       float64 `mapstructure:"requests_per_second"`
+	Burst                   int     `mapstructure:"burst"`
+	MaxConcurrentExecutions int     `mapstructure:"max_concurrent_executions"`
+}
+
+// TokenGrant gives one auth token a built-in role, or a list of permissions instead
+type TokenGrant struct {
+	Token       string   `mapstructure:"token"`
+	Role        string   `mapstructure:"role"`        // viewer, operator or admin
+	Permissions []string `mapstructure:"permissions"` // read, execute, operate, manage or admin
+}
+
+// TaskConfig defines a scheduled task declared in the config file
+type TaskConfig struct {
+	ID              string                 `mapstructure:"id"`
+	Name            string                 `mapstructure:"name"`
+	AgentID         string                 `mapstructure:"agent_id"`
+	AgentIDs        []string               `mapstructure:"agent_ids"`     // Fan-out: run the input against each of these agents instead of agent_id
+	AgentPattern    string                 `mapstructure:"agent_pattern"` // Fan-out: the agents matching "prefix:<prefix>" or a glob
+	MaxParallel     int                    `mapstructure:"max_parallel"`   // Fan-out agents run at once; 0 runs all of them
+	SuccessPolicy   string                 `mapstructure:"success_policy"` // Fan-out: "all" (default), "any" or "at_least"
+	MinSuccesses    int                    `mapstructure:"min_successes"`  // Fan-out successes required by at_least
+	CronExpression  string                 `mapstructure:"cron_expression"`
+	Timezone        string                 `mapstructure:"timezone"` // IANA time zone of the cron expression, e.g. "America/New_York"; scheduler.timezone when empty
+	Enabled         bool                   `mapstructure:"enabled"`
+	InputParameters map[string]interface{} `mapstructure:"input_parameters"`
+	InputTemplate   string                 `mapstructure:"input_template"` // text/template for the input, e.g. "report for {{yesterday}}"
+	Timeout         int                    `mapstructure:"timeout"`
+	MaxRetries      int                    `mapstructure:"max_retries"`
+	RetryBackoff    int                    `mapstructure:"retry_backoff"`
+	OverlapPolicy   string                 `mapstructure:"overlap_policy"`  // "skip", "queue" or "allow"
+	CatchUpPolicy   string                 `mapstructure:"catch_up_policy"` // "none", "run_once" or "run_all"
+	Description     string                 `mapstructure:"description"`
+	Labels          map[string]string      `mapstructure:"labels"`
+	SkipCalendars   []string               `mapstructure:"skip_calendars"` // Calendars whose days the task does not run on
+	DeferOnSkip     bool                   `mapstructure:"defer_on_skip"`  // Run fires on excluded days after the next fire no calendar excludes
+}
+
 // LoadConfig loads the application configuration using viper
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
@@ -62,16 +558,7 @@ func LoadConfig() (*Config, error) {
 	viper.AddConfigPath("/etc/github.com/algonius/algonius-supervisor/")
 	
 	// Set default values
-	viper.SetDefault("host", "localhost")
-	viper.SetDefault("port", 8080)
-	viper.SetDefault("environment", "development")
-	viper.SetDefault("log_level", "info")
-	
-	viper.SetDefault("a2a.enabled", true)
-	viper.SetDefault("a2a.timeout", "30s")
-	viper.SetDefault("a2a.auth_enabled", true)
-	
-	viper.SetDefault("scheduler.enabled", true)
+	setDefaults(viper.GetViper())
 
 	// Allow environment variables to override config
 	viper.AutomaticEnv()
@@ -84,48 +571,206 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	return decodeConfig(viper.GetViper())
+}
+
+// LoadConfigFile reads the configuration from path without touching the global viper instance
+func LoadConfigFile(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	setDefaults(v)
+	v.AutomaticEnv()
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	return decodeConfig(v)
+}
+
+// ConfigFileUsed returns the path of the config file read by LoadConfig, or "" when none was found
+func ConfigFileUsed() string {
+	return viper.ConfigFileUsed()
+}
+
+// setDefaults registers the default configuration values on v
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("host", "localhost")
+	v.SetDefault("port", 8080)
+	v.SetDefault("environment", "development")
+	v.SetDefault("log_level", "info")
+	v.SetDefault("data_dir", "./data")
+	
+	v.SetDefault("a2a.enabled", true)
+	v.SetDefault("a2a.timeout", "30s")
+	v.SetDefault("a2a.auth_enabled", true)
+	
+	v.SetDefault("scheduler.enabled", true)
+	v.SetDefault("scheduler.max_task_timeout", 86400)
+	v.SetDefault("scheduler.catch_up_interval", "1s")
+	v.SetDefault("scheduler.drift_warn_threshold", "1s")
+	v.SetDefault("scheduler.missed_fire_tolerance", "1m")
+	v.SetDefault("scheduler.shutdown_timeout", "30s")
+
+	v.SetDefault("history.backend", "memory")
+	v.SetDefault("history.path", "./data/history.db")
+	v.SetDefault("history.retention", "0s")
+	v.SetDefault("history.retention_interval", "1h")
+	v.SetDefault("storage.backend", "memory")
+	v.SetDefault("storage.path", "./data/supervisor.db")
+	v.SetDefault("storage.postgres.driver", "pgx")
+	v.SetDefault("leader_election.backend", "storage")
+	v.SetDefault("leader_election.lease_duration", "15s")
+	v.SetDefault("leader_election.renew_interval", "5s")
+	v.SetDefault("leader_election.follower_requests", "redirect")
+
+	v.SetDefault("artifacts.max_count", 20)
+	v.SetDefault("artifacts.max_total_bytes", 100<<20)
+	v.SetDefault("orphans.policy", "auto")
+	v.SetDefault("orphans.watch_interval", "5s")
+
+	// Result cache defaults
+	v.SetDefault("result_cache.max_entries", 1000)
+
+	v.SetDefault("idempotency.window", "1h")
+	v.SetDefault("idempotency.max_keys", 10000)
+	v.SetDefault("retries.min_attempt_duration", "1s")
+	v.SetDefault("defaults.execution.timeout", 0)
+	v.SetDefault("defaults.execution.max_output_bytes", 1<<20)
+	v.SetDefault("defaults.execution.max_retries", 3)
+	v.SetDefault("defaults.execution.retry_backoff", "1s")
+
+	v.SetDefault("api.swagger_ui", false)
+	v.SetDefault("api.operation_wait_timeout", "30s")
+	v.SetDefault("api.stream_heartbeat", "15s")
+	v.SetDefault("api.max_body_bytes", 10<<20)
+	v.SetDefault("api.max_upload_bytes", 1<<30)
+	v.SetDefault("api.input.allowed_schemes", []string{"https"})
+	v.SetDefault("api.input.max_bytes", 100<<20)
+	v.SetDefault("api.input.fetch_timeout", "30s")
+
+	v.SetDefault("queue_alerts.enabled", false)
+	v.SetDefault("queue_alerts.interval", "15s")
+
+	v.SetDefault("anomalies.enabled", true)
+	v.SetDefault("anomalies.window", 50)
+	v.SetDefault("anomalies.min_samples", 10)
+	v.SetDefault("anomalies.duration_stddevs", 3)
+	v.SetDefault("anomalies.duration_min_ratio", 2)
+	v.SetDefault("anomalies.failure_rate_threshold", 0.5)
+
+	v.SetDefault("tls.enabled", false)
+
+	v.SetDefault("socket.path", "")
+	v.SetDefault("socket.mode", "0660")
+	v.SetDefault("socket.disable_tcp", false)
+	v.SetDefault("socket.peer_auth.enabled", false)
+	v.SetDefault("socket.peer_auth.role", "admin")
+
+	v.SetDefault("cors.allowed_origins", []string{})
+	v.SetDefault("cors.allowed_methods", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
+	v.SetDefault("cors.allowed_headers", []string{"Authorization", "Content-Type", "Idempotency-Key", "X-Request-ID", "X-Trigger-Type"})
+	v.SetDefault("cors.allow_credentials", false)
+	v.SetDefault("cors.max_age", "10m")
+
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.requests_per_second", 10)
+	v.SetDefault("rate_limit.burst", 20)
+	v.SetDefault("rate_limit.max_concurrent_executions", 0)
+	v.SetDefault("rate_limit.exempt_paths", []string{"/health", "/health/live", "/health/ready"})
+
+	v.SetDefault("audit.enabled", true)
+	v.SetDefault("audit.path", "./data/audit.jsonl")
+	v.SetDefault("audit.max_bytes", 100<<20)
+	v.SetDefault("audit.backups", 10)
+	v.SetDefault("audit.fail_closed", false)
+	v.SetDefault("audit.log_level", "")
+
+	v.SetDefault("agent_templates.propagate_updates", true)
+	v.SetDefault("agent_deletion.retention", "168h")
+	v.SetDefault("agent_deletion.sweep_interval", "1h")
+	v.SetDefault("validation.strict", true)
+
+	v.SetDefault("metrics.window", "15m")
+	v.SetDefault("metrics.window_samples", 1024)
+
+	v.SetDefault("health.max_execution_backlog", 100)
+	v.SetDefault("lifecycle_safety.confirm_above_agents", 10)
+	v.SetDefault("lifecycle_safety.confirm_above_percent", 50)
+	v.SetDefault("lifecycle_safety.confirmation_ttl", "5m")
+
+	v.SetDefault("debug.fault_injection", false)
+}
+
+// decodeConfig unmarshals v, fills in agent defaults and validates the result
+func decodeConfig(v *viper.Viper) (*Config, error) {
 	var config Config
-	err = viper.Unmarshal(&config)
+	err := v.Unmarshal(&config)
 	if err != nil {
 		return nil, err
 	}
 
-	// Validate and set defaults for agents
+	// Set defaults for agents
 	for i := range config.Agents {
-		if config.Agents[i].MaxConcurrentExecutions == 0 {
-			if config.Agents[i].AccessType == "read-write" {
-				config.Agents[i].MaxConcurrentExecutions = 1
-			} else {
-				config.Agents[i].MaxConcurrentExecutions = 10 // default for read-only
-			}
-		}
+		config.Agents[i].applyDefaults()
+	}
 
-		// Validate access type
-		if config.Agents[i].AccessType != "read-only" && config.Agents[i].AccessType != "read-write" {
-			config.Agents[i].AccessType = "read-only" // Default to read-only
-		}
+	return &config, validateConfig(&config)
+}
 
-		// Validate mode
-		if config.Agents[i].Mode != "task" && config.Agents[i].Mode != "interactive" {
-			config.Agents[i].Mode = "task" // Default to task mode
+// applyDefaults fills in the defaults of the agent's unset or unknown settings
+func (a *AgentConfig) applyDefaults() {
+	if a.MaxConcurrentExecutions == 0 {
+		if a.AccessType == "read-write" {
+			a.MaxConcurrentExecutions = 1
+		} else {
+			a.MaxConcurrentExecutions = 10 // default for read-only
 		}
+	}
 
-		// Validate input/output patterns
-		if config.Agents[i].InputPattern == "" {
-			config.Agents[i].InputPattern = "stdin" // Default input pattern
-		}
+	// Validate access type
+	if a.AccessType != "read-only" && a.AccessType != "read-write" {
+		a.AccessType = "read-only" // Default to read-only
+	}
 
-		if config.Agents[i].OutputPattern == "" {
-			config.Agents[i].OutputPattern = "stdout" // Default output pattern
-		}
+	// Validate mode
+	if a.Mode != "task" && a.Mode != "interactive" && a.Mode != "persistent" {
+		a.Mode = "task" // Default to task mode
+	}
 
-		// Validate timeouts
-		if config.Agents[i].Timeout <= 0 {
-			config.Agents[i].Timeout = 300 // Default to 5 minutes
-		}
+	// Validate input/output patterns
+	if a.InputPattern == "" {
+		a.InputPattern = "stdin" // Default input pattern
 	}
 
-	return &config, validateConfig(&config)
+	if a.OutputPattern == "" {
+		a.OutputPattern = "stdout" // Default output pattern
+	}
+
+	// Validate timeouts
+	if a.Timeout <= 0 {
+		a.Timeout = 300 // Default to 5 minutes
+	}
+}
+
+// Validate validates an already loaded configuration
+func Validate(config *Config) error {
+	return validateConfig(config)
+}
+
+// UnknownFields returns the keys of the loaded configuration that do not map to any Config field
+func UnknownFields() ([]string, error) {
+	var config Config
+	var metadata mapstructure.Metadata
+	err := viper.Unmarshal(&config, func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.Metadata = &metadata
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(metadata.Unused)
+	return metadata.Unused, nil
 }
 
 // validateConfig validates the configuration values
@@ -148,9 +793,297 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("log level must be one of: debug, info, warn, error, got %s", config.LogLevel)
 	}
 
-	// Validate agent configurations
+	// Validate scheduler settings
+	if config.Scheduler.MaxTaskTimeout < 0 {
+		return fmt.Errorf("scheduler max task timeout cannot be negative, got %d", config.Scheduler.MaxTaskTimeout)
+	}
+	if _, err := config.SchedulerLocation(); err != nil {
+		return err
+	}
+	if config.Scheduler.DriftWarnThreshold < 0 {
+		return fmt.Errorf("scheduler drift warn threshold cannot be negative, got %s", config.Scheduler.DriftWarnThreshold)
+	}
+	if config.Scheduler.MissedFireTolerance < 0 {
+		return fmt.Errorf("scheduler missed fire tolerance cannot be negative, got %s", config.Scheduler.MissedFireTolerance)
+	}
+	if config.Scheduler.ShutdownTimeout < 0 {
+		return fmt.Errorf("scheduler shutdown timeout cannot be negative, got %s", config.Scheduler.ShutdownTimeout)
+	}
+
+	// Validate history settings
+	switch config.History.Backend {
+	case "", "memory", "sqlite":
+	default:
+		return fmt.Errorf("history backend must be 'memory' or 'sqlite', got %s", config.History.Backend)
+	}
+	if config.History.Retention < 0 {
+		return fmt.Errorf("history retention cannot be negative, got %s", config.History.Retention)
+	}
+
+	// Validate storage settings
+	switch config.Storage.Backend {
+	case "", "memory", "sqlite":
+	case "postgres":
+		if config.Storage.Postgres.DSN == "" {
+			return fmt.Errorf("storage.postgres.dsn is required for the postgres storage backend")
+		}
+	default:
+		return fmt.Errorf("storage backend must be 'memory', 'sqlite' or 'postgres', got %s", config.Storage.Backend)
+	}
+	if config.Storage.Postgres.MaxOpenConns < 0 {
+		return fmt.Errorf("storage postgres max_open_conns cannot be negative, got %d", config.Storage.Postgres.MaxOpenConns)
+	}
+
+	// Validate leader election settings
+	if election := config.LeaderElection; election.Enabled {
+		switch election.Backend {
+		case "", "storage", "file":
+		default:
+			return fmt.Errorf("leader election backend must be 'storage' or 'file', got %s", election.Backend)
+		}
+		if config.Storage.Backend == "" || config.Storage.Backend == "memory" {
+			return fmt.Errorf("leader election requires storage shared by the instances, not the memory backend")
+		}
+		if election.LeaseDuration <= 0 || election.RenewInterval <= 0 {
+			return fmt.Errorf("leader election lease_duration and renew_interval must be positive")
+		}
+		if election.RenewInterval*3 > election.LeaseDuration {
+			return fmt.Errorf("leader election renew_interval %s must be at most a third of lease_duration %s", election.RenewInterval, election.LeaseDuration)
+		}
+		if _, err := models.ParseFollowerRequestMode(election.FollowerRequests); err != nil {
+			return err
+		}
+		if address, err := url.Parse(election.AdvertiseAddress); err != nil || address.Scheme == "" || address.Host == "" {
+			return fmt.Errorf("leader_election.advertise_address must be the base URL followers reach this instance at, got %q", election.AdvertiseAddress)
+		}
+	}
+
+	if config.Artifacts.MaxCount < 0 || config.Artifacts.MaxTotalBytes < 0 {
+		return fmt.Errorf("artifacts max_count and max_total_bytes cannot be negative")
+	}
+
+	if config.AgentDeletion.Retention < 0 {
+		return fmt.Errorf("agent deletion retention cannot be negative, got %s", config.AgentDeletion.Retention)
+	}
+
+	if _, err := models.ParseOrphanPolicy(config.Orphans.Policy); err != nil {
+		return err
+	}
+	if config.Orphans.WatchInterval < 0 {
+		return fmt.Errorf("orphan watch interval cannot be negative, got %s", config.Orphans.WatchInterval)
+	}
+
+	if config.Idempotency.Window < 0 || config.Idempotency.MaxKeys < 0 {
+		return fmt.Errorf("idempotency window and max keys cannot be negative")
+	}
+
+	if config.Retries.MinAttemptDuration < 0 {
+		return fmt.Errorf("retries min_attempt_duration cannot be negative, got %s", config.Retries.MinAttemptDuration)
+	}
+
+	if execution := config.Defaults.Execution; execution.Timeout < 0 || execution.MaxOutputBytes < 0 || execution.MaxRetries < 0 || execution.RetryBackoff < 0 {
+		return fmt.Errorf("defaults execution timeout, max_output_bytes, max_retries and retry_backoff cannot be negative")
+	}
+
+	if config.Audit.MaxBytes < 0 || config.Audit.Backups < 0 {
+		return fmt.Errorf("audit max_bytes and backups cannot be negative")
+	}
+	// Rotation splits entries longer than the limit, so it must leave room for whole entries
+	if config.Audit.MaxBytes > 0 && config.Audit.MaxBytes < MinAuditMaxBytes {
+		return fmt.Errorf("audit max_bytes must be 0 or at least %d", MinAuditMaxBytes)
+	}
+	if config.Audit.LogLevel != "" {
+		if _, err := zapcore.ParseLevel(config.Audit.LogLevel); err != nil {
+			return fmt.Errorf("invalid audit log_level: %w", err)
+		}
+	}
+
+	// Injected faults must never reach production executions
+	if config.Debug.FaultInjection && config.Environment == "production" {
+		return fmt.Errorf("debug fault_injection cannot be enabled in the production environment")
+	}
+
+	// Every reveal of a secret must leave an audit entry
+	if config.Secrets.AllowReveal && !config.Audit.Enabled {
+		return fmt.Errorf("secrets allow_reveal requires the audit log to be enabled")
+	}
+
+	if config.ProcessEvents.WebhookURL != "" {
+		if err := models.ValidatePushNotificationURL(config.ProcessEvents.WebhookURL, true); err != nil {
+			return fmt.Errorf("invalid process events webhook url: %w", err)
+		}
+	}
+
+	if config.Metrics.Window < 0 || config.Metrics.WindowSamples < 0 {
+		return fmt.Errorf("metrics window and window samples cannot be negative")
+	}
+
+	if config.Health.MaxExecutionBacklog < 0 {
+		return fmt.Errorf("health max execution backlog cannot be negative, got %d", config.Health.MaxExecutionBacklog)
+	}
+
+	if config.ResultCache.MaxEntries < 0 {
+		return fmt.Errorf("result cache max entries cannot be negative, got %d", config.ResultCache.MaxEntries)
+	}
+
+	// Validate rate limits
+	if config.RateLimit.RequestsPerSecond < 0 || config.RateLimit.Burst < 0 || config.RateLimit.MaxConcurrentExecutions < 0 {
+		return fmt.Errorf("rate limits cannot be negative")
+	}
+	if config.RateLimit.Enabled && config.RateLimit.RequestsPerSecond == 0 {
+		return fmt.Errorf("rate limit requests_per_second must be positive when rate limiting is enabled")
+	}
+	for _, limit := range config.RateLimit.Tokens {
+		if limit.Token == "" {
+			return fmt.Errorf("rate limit token overrides must specify a token")
+		}
+		if limit.RequestsPerSecond < 0 || limit.Burst < 0 || limit.MaxConcurrentExecutions < 0 {
+			return fmt.Errorf("rate limits cannot be negative")
+		}
+	}
+
+	// Validate token grants
+	if config.Auth.Enabled && len(config.Auth.Tokens) == 0 && !config.Socket.PeerAuth.Enabled {
+		return fmt.Errorf("auth tokens must list at least one token when auth is enabled without socket peer_auth")
+	}
+	grantedTokens := make(map[string]bool)
+	for i, grant := range config.Auth.Tokens {
+		if grant.Token == "" {
+			return fmt.Errorf("auth token %d must specify a token", i+1)
+		}
+		if grantedTokens[grant.Token] {
+			return fmt.Errorf("auth token %d is listed twice", i+1)
+		}
+		grantedTokens[grant.Token] = true
+		if (grant.Role == "") == (len(grant.Permissions) == 0) {
+			return fmt.Errorf("auth token %d must specify either a role or permissions", i+1)
+		}
+		if grant.Role != "" && !models.Role(grant.Role).IsValid() {
+			return fmt.Errorf("auth token %d has unknown role %q, expected viewer, operator or admin", i+1, grant.Role)
+		}
+		for _, permission := range grant.Permissions {
+			if !models.Permission(permission).IsValid() {
+				return fmt.Errorf("auth token %d has unknown permission %q, expected read, execute, operate, manage or admin", i+1, permission)
+			}
+		}
+	}
+
+	// Validate queue alert thresholds
+	if config.QueueAlerts.Interval < 0 {
+		return fmt.Errorf("queue alert interval cannot be negative, got %s", config.QueueAlerts.Interval)
+	}
+	defaults, agentThresholds := config.QueueAlertThresholds()
+	if err := defaults.validate(); err != nil {
+		return err
+	}
+	for _, threshold := range agentThresholds {
+		if threshold.AgentID == "" {
+			return fmt.Errorf("queue alert agent overrides must specify an agent_id")
+		}
+		if err := threshold.validate(); err != nil {
+			return fmt.Errorf("agent %s: %w", threshold.AgentID, err)
+		}
+	}
+
+	// Validate global maintenance windows
+	for i, window := range config.Maintenance.Windows {
+		if err := window.validate(); err != nil {
+			return fmt.Errorf("maintenance window %d: %w", i, err)
+		}
+	}
+
+	// Validate lifecycle safety settings
+	if err := ToLifecycleSafety(config).Validate(); err != nil {
+		return fmt.Errorf("lifecycle_safety: %w", err)
+	}
+
+	// Validate calendars
+	calendarNames := make(map[string]bool, len(config.Calendars))
+	for i, calendar := range config.Calendars {
+		if err := calendar.validate(); err != nil {
+			return fmt.Errorf("calendar %d: %w", i, err)
+		}
+		if calendarNames[calendar.Name] {
+			return fmt.Errorf("duplicate calendar name: %s", calendar.Name)
+		}
+		calendarNames[calendar.Name] = true
+	}
+
+	// Validate anomaly settings
+	if anomalies := config.Anomalies; anomalies.Enabled {
+		if anomalies.Window < 1 || anomalies.MinSamples < 1 {
+			return fmt.Errorf("anomalies window and min_samples must be at least 1")
+		}
+		if anomalies.MinSamples > anomalies.Window {
+			return fmt.Errorf("anomalies min_samples %d cannot exceed window %d", anomalies.MinSamples, anomalies.Window)
+		}
+		if anomalies.DurationStdDevs < 0 || anomalies.DurationMinRatio < 0 {
+			return fmt.Errorf("anomalies duration_stddevs and duration_min_ratio cannot be negative")
+		}
+		if anomalies.FailureRateThreshold < 0 || anomalies.FailureRateThreshold > 1 {
+			return fmt.Errorf("anomalies failure_rate_threshold must be between 0 and 1, got %g", anomalies.FailureRateThreshold)
+		}
+	}
+
+	// Validate TLS settings; the files themselves are read when the server starts
+	if config.TLS.Enabled && (config.TLS.CertFile == "" || config.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file are required when TLS is enabled")
+	}
+
+	// Validate unix socket settings
+	if config.Socket.DisableTCP && config.Socket.Path == "" {
+		return fmt.Errorf("socket path is required when disable_tcp is set")
+	}
+	if _, err := config.SocketMode(); err != nil {
+		return err
+	}
+	if config.Socket.PeerAuth.Enabled && !models.Role(config.Socket.PeerAuth.Role).IsValid() {
+		return fmt.Errorf("socket peer_auth has unknown role %q, expected viewer, operator or admin", config.Socket.PeerAuth.Role)
+	}
+
+	// Validate CORS settings
+	for _, origin := range config.CORS.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			return fmt.Errorf("cors allowed origin must be \"*\" or start with http:// or https://, got %s", origin)
+		}
+		// Credentials for any origin would let every site act as the logged-in user
+		if origin == "*" && config.CORS.AllowCredentials {
+			return fmt.Errorf("cors allow_credentials cannot be combined with the \"*\" allowed origin; list the origins instead")
+		}
+	}
+	if config.CORS.MaxAge < 0 {
+		return fmt.Errorf("cors max_age cannot be negative, got %s", config.CORS.MaxAge)
+	}
+
+	// Validate API settings
+	if config.API.OperationWaitTimeout < 0 {
+		return fmt.Errorf("api operation_wait_timeout cannot be negative, got %s", config.API.OperationWaitTimeout)
+	}
+	if config.API.StreamHeartbeat < 0 {
+		return fmt.Errorf("api stream_heartbeat cannot be negative, got %s", config.API.StreamHeartbeat)
+	}
+	if config.API.MaxBodyBytes < 0 || config.API.MaxUploadBytes < 0 {
+		return fmt.Errorf("api max_body_bytes and max_upload_bytes cannot be negative")
+	}
+	if config.API.Input.MaxBytes < 0 || config.API.Input.FetchTimeout < 0 {
+		return fmt.Errorf("api input max_bytes and fetch_timeout cannot be negative")
+	}
+	for _, scheme := range config.API.Input.AllowedSchemes {
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("api input allowed_schemes may only hold http and https, got %q", scheme)
+		}
+	}
+	for _, proxy := range config.API.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("api trusted_proxies must hold IP addresses or CIDRs, got %q", proxy)
+		}
+	}
+
+	// Validate agent configurations as they are registered, with the defaults merged in
 	agentIds := make(map[string]bool)
 	for _, agent := range config.Agents {
+		agent = agent.WithDefaults(config.Defaults.Agent)
+
 		// Validate ID is unique and not empty
 		if agent.ID == "" {
 			return fmt.Errorf("agent ID cannot be empty")
@@ -171,8 +1104,65 @@ func validateConfig(config *Config) error {
 		}
 
 		// Validate mode
-		if agent.Mode != "task" && agent.Mode != "interactive" {
-			return fmt.Errorf("agent mode must be 'task' or 'interactive', got %s for agent %s", agent.Mode, agent.ID)
+		if agent.Mode != "task" && agent.Mode != "interactive" && agent.Mode != "persistent" {
+			return fmt.Errorf("agent mode must be 'task', 'interactive' or 'persistent', got %s for agent %s", agent.Mode, agent.ID)
+		}
+		if agent.Mode == "persistent" && (agent.InputPattern != "json-rpc" || agent.OutputPattern != "json-rpc") {
+			return fmt.Errorf("persistent mode requires the json-rpc input and output patterns for agent %s", agent.ID)
+		}
+		if !agent.AllowIncompatiblePatterns {
+			if err := types.CheckPatternCompatibility(types.InputPattern(agent.InputPattern), types.OutputPattern(agent.OutputPattern)); err != nil {
+				return fmt.Errorf("agent %s: %w (set allow_incompatible_patterns to register it anyway)", agent.ID, err)
+			}
+		}
+
+		// Validate result caching
+		if agent.CacheTTLSeconds < 0 {
+			return fmt.Errorf("cache_ttl_seconds cannot be negative for agent %s", agent.ID)
+		}
+		if agent.CacheTTLSeconds > 0 && agent.AccessType != "read-only" {
+			return fmt.Errorf("only read-only agents may cache results, agent %s is %s", agent.ID, agent.AccessType)
+		}
+
+		// Validate log file rotation settings and the output kept
+		if agent.MaxOutputBytes < 0 {
+			return fmt.Errorf("max_output_bytes cannot be negative for agent %s", agent.ID)
+		}
+		if agent.LogfileMaxBytes < 0 || agent.LogfileBackups < 0 {
+			return fmt.Errorf("logfile_maxbytes and logfile_backups cannot be negative for agent %s", agent.ID)
+		}
+
+		// Validate process limits; whether they can be applied is checked when the agent is registered
+		if agent.NiceLevel < -20 || agent.NiceLevel > 19 {
+			return fmt.Errorf("nice_level must be between -20 and 19, got %d for agent %s", agent.NiceLevel, agent.ID)
+		}
+		if agent.MaxMemoryMB < 0 || agent.MaxCPUSeconds < 0 {
+			return fmt.Errorf("max_memory_mb and max_cpu_seconds cannot be negative for agent %s", agent.ID)
+		}
+
+		// Validate how the agent is stopped
+		if _, err := models.NormalizeStopSignal(agent.StopSignal); err != nil {
+			return fmt.Errorf("invalid stop_signal for agent %s: %w", agent.ID, err)
+		}
+		if agent.StopWaitSeconds < 0 {
+			return fmt.Errorf("stop_wait_seconds cannot be negative for agent %s", agent.ID)
+		}
+		if agent.PingIntervalSeconds < 0 || agent.PingTimeoutSeconds < 0 {
+			return fmt.Errorf("ping_interval_seconds and ping_timeout_seconds cannot be negative for agent %s", agent.ID)
+		}
+		if agent.StartRetries < 0 || agent.StartSecs < 0 {
+			return fmt.Errorf("start_retries and start_secs cannot be negative for agent %s", agent.ID)
+		}
+		if agent.MaxTotalTimeout < 0 || (agent.MaxTotalTimeout > 0 && agent.MaxTotalTimeout < agent.Timeout) {
+			return fmt.Errorf("max_total_timeout cannot be negative or less than the timeout for agent %s", agent.ID)
+		}
+
+		// Validate the watchdog; a silence window beyond the timeout could never trip
+		if agent.MaxSilenceSeconds < 0 || (agent.Timeout > 0 && agent.MaxSilenceSeconds > agent.Timeout) {
+			return fmt.Errorf("max_silence_seconds cannot be negative or exceed the timeout for agent %s", agent.ID)
+		}
+		if (agent.HeartbeatFile != "" || agent.HeartbeatLine != "") && agent.MaxSilenceSeconds <= 0 {
+			return fmt.Errorf("heartbeat_file and heartbeat_line require max_silence_seconds for agent %s", agent.ID)
 		}
 
 		// Validate max concurrent executions
@@ -183,6 +1173,61 @@ func validateConfig(config *Config) error {
 		if agent.AccessType == "read-write" && agent.MaxConcurrentExecutions > 1 {
 			return fmt.Errorf("read-write agents must have max concurrent executions of 1, got %d for agent %s", agent.MaxConcurrentExecutions, agent.ID)
 		}
+		if agent.Weight < 0 {
+			return fmt.Errorf("weight cannot be negative for agent %s", agent.ID)
+		}
+		for i, window := range agent.MaintenanceWindows {
+			if err := window.validate(); err != nil {
+				return fmt.Errorf("maintenance window %d of agent %s: %w", i, agent.ID, err)
+			}
+		}
+		if hook := ToLifecycleHook(agent.PostStartHook); hook != nil {
+			if err := hook.Validate(models.HookPostStart); err != nil {
+				return fmt.Errorf("post_start_hook of agent %s: %w", agent.ID, err)
+			}
+		}
+		if hook := ToLifecycleHook(agent.PreStopHook); hook != nil {
+			if err := hook.Validate(models.HookPreStop); err != nil {
+				return fmt.Errorf("pre_stop_hook of agent %s: %w", agent.ID, err)
+			}
+		}
+		if err := ToExitCodeMap(agent.ExitCodeMap).Validate(); err != nil {
+			return fmt.Errorf("exit code map of agent %s: %w", agent.ID, err)
+		}
+		schema, err := ToInputSchema(agent.InputSchema)
+		if err == nil {
+			err = schema.Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("input schema of agent %s: %w", agent.ID, err)
+		}
+		if _, err := ToAgentExamples(agent.Examples); err != nil {
+			return fmt.Errorf("examples of agent %s: %w", agent.ID, err)
+		}
+	}
+
+	// Validate scheduled task configurations
+	taskIds := make(map[string]bool)
+	for _, task := range config.Tasks {
+		if task.ID == "" {
+			return fmt.Errorf("task ID cannot be empty")
+		}
+		if taskIds[task.ID] {
+			return fmt.Errorf("duplicate task ID found: %s", task.ID)
+		}
+		taskIds[task.ID] = true
+
+		if task.AgentID == "" && len(task.AgentIDs) == 0 && task.AgentPattern == "" {
+			return fmt.Errorf("task %s must reference an agent", task.ID)
+		}
+		if task.CronExpression == "" {
+			return fmt.Errorf("task %s must have a cron expression", task.ID)
+		}
+		if task.Timezone != "" {
+			if _, err := time.LoadLocation(task.Timezone); err != nil {
+				return fmt.Errorf("task %s timezone %q is not a known time zone: %w", task.ID, task.Timezone, err)
+			}
+		}
 	}
 
 	return nil
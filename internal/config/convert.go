@@ -0,0 +1,262 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// ToAgentConfiguration converts an agent declared in the config file into a registrable agent configuration
+func (a AgentConfig) ToAgentConfiguration() *models.AgentConfiguration {
+	// Malformed documents are reported by Validate; they are left out here
+	inputSchema, _ := ToInputSchema(a.InputSchema)
+	examples, _ := ToAgentExamples(a.Examples)
+	return &models.AgentConfiguration{
+		ID:                        a.ID,
+		Name:                      a.Name,
+		Description:               a.Description,
+		InputSchema:               inputSchema,
+		Examples:                  examples,
+		ValidateInput:             a.ValidateInput,
+		AgentType:                 a.AgentType,
+		ExecutablePath:            a.ExecutablePath,
+		WorkingDirectory:          a.WorkingDirectory,
+		Envs:                      copyStringMap(a.Envs),
+		SensitiveEnvKeys:          append([]string(nil), a.SensitiveEnvKeys...),
+		CliArgs:                   copyStringMap(a.CliArgs),
+		Parameters:                copyStringMap(a.Parameters),
+		Mode:                      types.AgentMode(a.Mode),
+		InputPattern:              types.InputPattern(a.InputPattern),
+		OutputPattern:             types.OutputPattern(a.OutputPattern),
+		InputFileTemplate:         a.InputFileTemplate,
+		OutputFileTemplate:        a.OutputFileTemplate,
+		OutputFileWaitSeconds:     a.OutputFileWaitSeconds,
+		OutputFileStable:          a.OutputFileStable,
+		OutputSelector:            a.OutputSelector,
+		AllowIncompatiblePatterns: a.AllowIncompatiblePatterns,
+		OutputEncoding:            models.OutputEncoding(a.OutputEncoding),
+		SandboxDir:                a.SandboxDir,
+		KeepArtifacts:             a.KeepArtifacts,
+		MaxOutputBytes:            a.MaxOutputBytes,
+		StdoutLogfile:             a.StdoutLogfile,
+		StderrLogfile:             a.StderrLogfile,
+		LogfileMaxBytes:           a.LogfileMaxBytes,
+		LogfileBackups:            a.LogfileBackups,
+		CacheTTLSeconds:           a.CacheTTLSeconds,
+		RunAsUser:                 a.RunAsUser,
+		RunAsGroup:                a.RunAsGroup,
+		NiceLevel:                 a.NiceLevel,
+		MaxMemoryMB:               a.MaxMemoryMB,
+		MaxCPUSeconds:             a.MaxCPUSeconds,
+		SkipFSChecks:              a.SkipFSChecks,
+		StopSignal:                a.StopSignal,
+		StopWaitSeconds:           a.StopWaitSeconds,
+		MaxSilenceSeconds:         a.MaxSilenceSeconds,
+		HeartbeatFile:             a.HeartbeatFile,
+		HeartbeatLine:             a.HeartbeatLine,
+		PingIntervalSeconds:       a.PingIntervalSeconds,
+		PingTimeoutSeconds:        a.PingTimeoutSeconds,
+		StartRetries:              a.StartRetries,
+		StartSecs:                 a.StartSecs,
+		PostStartHook:             ToLifecycleHook(a.PostStartHook),
+		PreStopHook:               ToLifecycleHook(a.PreStopHook),
+		MaintenanceWindows:        ToMaintenanceWindows(a.MaintenanceWindows),
+		ExitCodeMap:               ToExitCodeMap(a.ExitCodeMap),
+		AccessType:                types.AgentAccessType(a.AccessType),
+		MaxConcurrentExecutions:   a.MaxConcurrentExecutions,
+		Weight:                    a.Weight,
+		Timeout:                   a.Timeout,
+		SessionTimeout:            a.SessionTimeout,
+		MaxTotalTimeout:           a.MaxTotalTimeout,
+		KeepAlive:                 a.KeepAlive,
+		Enabled:                   a.Enabled,
+	}
+}
+
+// WithDefaults returns the agent with the settings it leaves unset taken from defaults, merging maps
+// key by key, the way the agent service merges the defaults into the agent once it is registered
+func (a AgentConfig) WithDefaults(defaults AgentConfig) AgentConfig {
+	merged := a
+	target := reflect.ValueOf(&merged).Elem()
+	source := reflect.ValueOf(defaults)
+
+	for i := 0; i < target.NumField(); i++ {
+		if name := target.Type().Field(i).Name; name == "ID" || name == "Name" {
+			continue
+		}
+
+		field, inherited := target.Field(i), source.Field(i)
+		if field.Kind() == reflect.Map && !field.IsNil() && inherited.Len() > 0 {
+			combined := reflect.MakeMapWithSize(field.Type(), field.Len()+inherited.Len())
+			for _, m := range []reflect.Value{inherited, field} {
+				iter := m.MapRange()
+				for iter.Next() {
+					combined.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			field.Set(combined)
+			continue
+		}
+		if field.IsZero() {
+			field.Set(inherited)
+		}
+	}
+
+	return merged
+}
+
+// ToAgentDefaults converts the agent defaults of the config file into the settings the agent
+// service merges into agents, nil when none are set
+func ToAgentDefaults(config *Config) *models.AgentConfiguration {
+	if reflect.ValueOf(config.Defaults.Agent).IsZero() {
+		return nil
+	}
+
+	defaults := config.Defaults.Agent.ToAgentConfiguration()
+	defaults.ID, defaults.Name = "", ""
+	return defaults
+}
+
+// ToMaintenanceWindows converts maintenance windows declared in the config file, nil when there
+// are none
+func ToMaintenanceWindows(windows []MaintenanceWindowConfig) []models.MaintenanceWindow {
+	if len(windows) == 0 {
+		return nil
+	}
+	converted := make([]models.MaintenanceWindow, len(windows))
+	for i, window := range windows {
+		converted[i] = models.MaintenanceWindow{
+			Schedule: window.Schedule,
+			Duration: window.Duration,
+			Timezone: window.Timezone,
+			Reason:   window.Reason,
+		}
+	}
+	return converted
+}
+
+// ToLifecycleHook converts a lifecycle hook declared in the config file, nil when there is none
+func ToLifecycleHook(hook *LifecycleHookConfig) *models.LifecycleHook {
+	if hook == nil {
+		return nil
+	}
+	return &models.LifecycleHook{
+		Command:        append([]string(nil), hook.Command...),
+		URL:            hook.URL,
+		Method:         hook.Method,
+		TimeoutSeconds: hook.TimeoutSeconds,
+		OnFailure:      models.HookFailurePolicy(hook.OnFailure),
+	}
+}
+
+// ToLifecycleSafety converts the lifecycle safety settings of the config file
+func ToLifecycleSafety(config *Config) models.LifecycleSafety {
+	safety := config.LifecycleSafety
+	return models.LifecycleSafety{
+		ProtectedAgents:     safety.ProtectedAgents,
+		ConfirmAboveAgents:  safety.ConfirmAboveAgents,
+		ConfirmAbovePercent: safety.ConfirmAbovePercent,
+		ConfirmationTTL:     safety.ConfirmationTTL,
+	}
+}
+
+// ToScheduledTask converts a task declared in the config file into a schedulable task
+func (t TaskConfig) ToScheduledTask() *models.ScheduledTask {
+	name := t.Name
+	if name == "" {
+		name = t.ID
+	}
+
+	parameters := make(map[string]interface{}, len(t.InputParameters))
+	for key, value := range t.InputParameters {
+		parameters[key] = value
+	}
+
+	var selector *models.AgentSelector
+	if len(t.AgentIDs) > 0 || t.AgentPattern != "" {
+		selector = &models.AgentSelector{AgentIDs: append([]string(nil), t.AgentIDs...), Pattern: t.AgentPattern}
+	}
+
+	return &models.ScheduledTask{
+		ID:              t.ID,
+		Name:            name,
+		AgentID:         t.AgentID,
+		AgentSelector:   selector,
+		MaxParallel:     t.MaxParallel,
+		SuccessPolicy:   models.FanOutSuccessPolicy(t.SuccessPolicy),
+		MinSuccesses:    t.MinSuccesses,
+		CronExpression:  t.CronExpression,
+		Timezone:        t.Timezone,
+		Enabled:         t.Enabled,
+		InputParameters: parameters,
+		InputTemplate:   t.InputTemplate,
+		Timeout:         t.Timeout,
+		MaxRetries:      t.MaxRetries,
+		RetryBackoff:    t.RetryBackoff,
+		OverlapPolicy:   types.OverlapPolicy(t.OverlapPolicy),
+		CatchUpPolicy:   types.CatchUpPolicy(t.CatchUpPolicy),
+		Description:     t.Description,
+		Labels:          copyStringMap(t.Labels),
+		SkipCalendars:   append([]string(nil), t.SkipCalendars...),
+		DeferOnSkip:     t.DeferOnSkip,
+	}
+}
+
+// copyStringMap returns a shallow copy of m, or nil when m is empty
+func copyStringMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// ToInputSchema parses the JSON Schema of an agent declared in the config file, nil when it is empty
+func ToInputSchema(text string) (models.JSONSchema, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	var schema models.JSONSchema
+	if err := json.Unmarshal([]byte(text), &schema); err != nil {
+		return nil, fmt.Errorf("input_schema must be a JSON object: %w", err)
+	}
+	return schema, nil
+}
+
+// ToAgentExamples converts the examples of an agent declared in the config file, nil when there
+// are none
+func ToAgentExamples(examples []AgentExampleConfig) ([]models.AgentExample, error) {
+	if len(examples) == 0 {
+		return nil, nil
+	}
+	converted := make([]models.AgentExample, len(examples))
+	for i, example := range examples {
+		converted[i] = models.AgentExample{Description: example.Description, Input: example.Input}
+		if strings.TrimSpace(example.Parameters) == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(example.Parameters), &converted[i].Parameters); err != nil {
+			return nil, fmt.Errorf("example %d parameters must be a JSON object: %w", i, err)
+		}
+	}
+	return converted, nil
+}
+
+// ToExitCodeMap converts an exit code map declared in the config file, nil when it is empty
+func ToExitCodeMap(codes map[string]string) models.ExitCodeMap {
+	if len(codes) == 0 {
+		return nil
+	}
+	converted := make(models.ExitCodeMap, len(codes))
+	for code, status := range codes {
+		converted[code] = types.ExecutionStatus(strings.ToLower(strings.TrimSpace(status)))
+	}
+	return converted
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// Definitions are the agents and tasks sections of a configuration document, such as a file
+// holding only some of the supervisor's agents and tasks
+type Definitions struct {
+	Agents []AgentConfig `mapstructure:"agents"`
+	Tasks  []TaskConfig  `mapstructure:"tasks"`
+}
+
+// ReadDefinitions decodes the agents and tasks sections of a yaml or json document from r the way
+// LoadConfigFile decodes them, agent defaults included. It also returns the document's keys that
+// map to no field, sorted, such as "agents[0].timeot".
+func ReadDefinitions(r io.Reader, format string) (*Definitions, []string, error) {
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(r); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", format, err)
+	}
+
+	var definitions Definitions
+	var metadata mapstructure.Metadata
+	err := v.Unmarshal(&definitions, func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.Metadata = &metadata
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range definitions.Agents {
+		definitions.Agents[i].applyDefaults()
+	}
+	sort.Strings(metadata.Unused)
+	return &definitions, metadata.Unused, nil
+}
@@ -0,0 +1,188 @@
+package definitions
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.yaml.in/yaml/v3"
+)
+
+// iCalendarDateLayout is the layout of DATE values of iCalendar files, such as 20261225
+const iCalendarDateLayout = "20060102"
+
+// LoadCalendar builds a calendar declared in the config file from its inline dates and the files
+// it names
+func LoadCalendar(calendar config.CalendarConfig) (*models.Calendar, error) {
+	loaded := &models.Calendar{Name: calendar.Name, Description: calendar.Description}
+	for _, text := range calendar.Dates {
+		dates, err := models.ParseDateRange(text)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %s: %w", calendar.Name, err)
+		}
+		loaded.Dates = append(loaded.Dates, dates)
+	}
+
+	for _, file := range []struct {
+		path  string
+		parse func([]byte) ([]models.DateRange, error)
+	}{
+		{calendar.ICalFile, ParseICalendar},
+		{calendar.DatesFile, ParseDateList},
+	} {
+		if file.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %s: %w", calendar.Name, err)
+		}
+		dates, err := file.parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %s: %s: %w", calendar.Name, file.path, err)
+		}
+		loaded.Dates = append(loaded.Dates, dates...)
+	}
+
+	if err := loaded.Validate(); err != nil {
+		return nil, fmt.Errorf("calendar %s: %w", calendar.Name, err)
+	}
+	return loaded, nil
+}
+
+// ParseDateList parses a YAML list of excluded days, each a day such as 2026-12-25, a range such
+// as 2026-12-24..2026-12-26 or a mapping with start, end and reason
+func ParseDateList(data []byte) ([]models.DateRange, error) {
+	var entries []yaml.Node
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("expected a YAML list of dates: %w", err)
+	}
+
+	dates := make([]models.DateRange, 0, len(entries))
+	for i, entry := range entries {
+		var parsed models.DateRange
+		var err error
+		switch entry.Kind {
+		case yaml.ScalarNode:
+			parsed, err = models.ParseDateRange(entry.Value)
+		case yaml.MappingNode:
+			if err = entry.Decode(&parsed); err == nil {
+				err = parsed.Validate()
+			}
+		default:
+			err = fmt.Errorf("expected a date or a mapping with start, end and reason")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d (line %d): %w", i, entry.Line, err)
+		}
+		dates = append(dates, parsed)
+	}
+	return dates, nil
+}
+
+// ParseICalendar parses the days of the events of an iCalendar (.ics) file. An event excludes the
+// days from its DTSTART up to its DTEND, which is exclusive for all-day events as in RFC 5545, and
+// its SUMMARY becomes the reason. Recurring events are refused rather than read as one day.
+func ParseICalendar(data []byte) ([]models.DateRange, error) {
+	var dates []models.DateRange
+	var event map[string]string
+	inCalendar := false
+
+	for number, line := range unfoldICalendar(data) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		property, _, _ := strings.Cut(name, ";") // Parameters such as VALUE=DATE only tell the format
+		property = strings.ToUpper(property)
+
+		switch {
+		case property == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			inCalendar = true
+		case property == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = make(map[string]string)
+		case property == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN:VEVENT", number+1)
+			}
+			parsed, err := iCalendarEvent(event)
+			if err != nil {
+				return nil, fmt.Errorf("event ending on line %d: %w", number+1, err)
+			}
+			dates = append(dates, parsed)
+			event = nil
+		case event != nil:
+			event[property] = value
+		}
+	}
+
+	if !inCalendar {
+		return nil, fmt.Errorf("not an iCalendar file: BEGIN:VCALENDAR is missing")
+	}
+	return dates, nil
+}
+
+// unfoldICalendar splits iCalendar data into its content lines, joining the continuation lines
+// RFC 5545 folds long lines into
+func unfoldICalendar(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// iCalendarEvent returns the days an event's properties cover
+func iCalendarEvent(event map[string]string) (models.DateRange, error) {
+	if _, ok := event["RRULE"]; ok {
+		return models.DateRange{}, fmt.Errorf("recurring events (RRULE) are not supported, list each occurrence")
+	}
+	start, allDay, err := iCalendarDay(event["DTSTART"])
+	if err != nil {
+		return models.DateRange{}, fmt.Errorf("DTSTART: %w", err)
+	}
+
+	end := start
+	if value, ok := event["DTEND"]; ok {
+		var endAllDay bool
+		if end, endAllDay, err = iCalendarDay(value); err != nil {
+			return models.DateRange{}, fmt.Errorf("DTEND: %w", err)
+		}
+		// All-day events end on the day after their last one
+		if (allDay || endAllDay) && end.After(start) {
+			end = end.AddDate(0, 0, -1)
+		}
+	}
+
+	dates := models.DateRange{Start: start.Format(models.CalendarDateLayout), Reason: event["SUMMARY"]}
+	if end.After(start) {
+		dates.End = end.Format(models.CalendarDateLayout)
+	}
+	return dates, nil
+}
+
+// iCalendarDay parses the day of a DATE or DATE-TIME value, reporting whether it is a DATE. The
+// day is the one written, whatever time zone the value names.
+func iCalendarDay(value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < len(iCalendarDateLayout) {
+		return time.Time{}, false, fmt.Errorf("invalid date %q: expected YYYYMMDD", value)
+	}
+	day, err := time.Parse(iCalendarDateLayout, value[:len(iCalendarDateLayout)])
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date %q: expected YYYYMMDD", value)
+	}
+	return day, len(value) == len(iCalendarDateLayout), nil
+}
@@ -0,0 +1,71 @@
+package definitions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/robfig/cron/v3"
+)
+
+// CronFormatsHelp describes the cron expression formats accepted by the scheduler
+const CronFormatsHelp = "accepted formats: 5-field 'min hour dom month dow' (e.g. '*/5 * * * *'), " +
+	"6-field 'sec min hour dom month dow' (e.g. '0 */5 * * * *'), " +
+	"or descriptors such as '@hourly', '@daily' and '@every 1m30s'"
+
+// standardCronParser parses 5-field expressions and descriptors
+var standardCronParser = cron.NewParser(
+	cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// secondsCronParser parses 6-field expressions with a leading seconds field
+var secondsCronParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ParseCronExpression parses a 5-field, 6-field or descriptor cron expression
+func ParseCronExpression(expression string) (cron.Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, fmt.Errorf("cron expression cannot be empty; %s", CronFormatsHelp)
+	}
+
+	parser := standardCronParser
+	fields := strings.Fields(expression)
+	if !strings.HasPrefix(expression, "@") {
+		// Strip an optional TZ=/CRON_TZ= prefix before counting fields
+		if strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=") {
+			fields = fields[1:]
+		}
+		switch len(fields) {
+		case 5:
+			parser = standardCronParser
+		case 6:
+			parser = secondsCronParser
+		default:
+			return nil, fmt.Errorf("invalid cron expression '%s': expected 5 or 6 fields, got %d; %s",
+				expression, len(fields), CronFormatsHelp)
+		}
+	}
+
+	schedule, err := parser.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression '%s': %v; %s", expression, err, CronFormatsHelp)
+	}
+
+	return schedule, nil
+}
+
+// TaskLocation returns the time zone a task's cron expression is evaluated in: its own IANA zone,
+// or fallback when it names none
+func TaskLocation(task *models.ScheduledTask, fallback *time.Location) (*time.Location, error) {
+	if task.Timezone == "" {
+		return fallback, nil
+	}
+	location, err := time.LoadLocation(task.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: expected an IANA name such as 'America/New_York': %w", task.Timezone, err)
+	}
+	return location, nil
+}
@@ -0,0 +1,186 @@
+// Package definitions checks agent and task definitions without a running supervisor. The
+// supervisor validates the agents and tasks it is given with it, and supervisorctl lint validates
+// definition files with it, so both accept the same definitions.
+package definitions
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// ValidateAgent returns every problem with an agent's definition that does not depend on the host
+// it runs on, and as warnings the problems the agent opts to tolerate, such as incompatible
+// patterns with allow_incompatible_patterns. Whether its executable and directories exist and its
+// process limits can be applied is for the host to check.
+func ValidateAgent(config *models.AgentConfiguration) (errs, warnings models.ValidationErrors) {
+	// Use the built-in field validation first
+	errs = config.ValidateFields()
+	warnings = models.ValidationErrors{}
+
+	// Perform additional validation for environment variables (T036)
+	validateEnvVars(config, &errs)
+
+	// Perform input/output pattern validation (T037)
+	validateInputOutputPatterns(config, &errs, &warnings)
+
+	// Perform access type validation (T038)
+	validateAccessType(config, &errs)
+
+	validateMaintenanceWindows(config, &errs)
+
+	return errs, warnings
+}
+
+// validateEnvVars validates the environment variables (T036)
+func validateEnvVars(config *models.AgentConfiguration, errs *models.ValidationErrors) {
+	// Validate environment variables don't contain sensitive data in their keys, unless the agent
+	// declares them sensitive so their values are masked
+	keys := make([]string, 0, len(config.Envs))
+	for key := range config.Envs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if models.IsSensitiveEnvKey(key) && !slices.Contains(config.SensitiveEnvKeys, key) {
+			errs.Add("envs."+key, models.ValidationInvalid,
+				fmt.Sprintf("environment variable key '%s' might contain sensitive information, list it in sensitive_env_keys to store it masked", key))
+		}
+	}
+
+	// A masked value read back from the API is not the secret it stands for
+	for _, key := range config.MaskedEnvKeys() {
+		errs.Add("envs."+key, models.ValidationInvalid,
+			fmt.Sprintf("environment variable '%s' holds the masked value %s instead of its real value", key, models.MaskedValue))
+	}
+}
+
+// validateInputOutputPatterns validates the input and output patterns (T037)
+func validateInputOutputPatterns(config *models.AgentConfiguration, errs, warnings *models.ValidationErrors) {
+	// Validate input/output patterns are compatible
+	// For example, if using file patterns, ensure the templates are properly formatted
+
+	if config.InputPattern == models.FilePattern && config.InputFileTemplate == "" {
+		errs.Add("input_file_template", models.ValidationRequired, "input file pattern requires an input file template")
+	}
+
+	if config.OutputPattern == models.FilePatternOut && config.OutputFileTemplate == "" {
+		errs.Add("output_file_template", models.ValidationRequired, "output file pattern requires an output file template")
+	}
+
+	// File templates are resolved inside the agent's sandbox and must not climb out of it
+	if err := agents.ValidateFileTemplate(config.InputFileTemplate); err != nil {
+		errs.AddError("input_file_template", models.ValidationInvalid, fmt.Errorf("invalid input file template: %w", err))
+	}
+	if err := agents.ValidateFileTemplate(config.OutputFileTemplate); err != nil {
+		errs.AddError("output_file_template", models.ValidationInvalid, fmt.Errorf("invalid output file template: %w", err))
+	}
+	if err := agents.ValidateOutputSelector(config.OutputSelector); err != nil {
+		errs.AddError("output_selector", models.ValidationInvalid, err)
+	}
+
+	// The pattern pair must be compatible per the matrix, unless the agent opts out with
+	// allow_incompatible_patterns; persistent mode already requires json-rpc for both
+	if config.Mode == types.PersistentMode {
+		return
+	}
+	if err := types.CheckPatternCompatibility(config.InputPattern, config.OutputPattern); err != nil {
+		if config.AllowIncompatiblePatterns {
+			warnings.AddError("output_pattern", models.ValidationConflict, err)
+			return
+		}
+		errs.AddError("output_pattern", models.ValidationConflict, err)
+	}
+}
+
+// validateAccessType validates the access type (T038); problems the field validation already
+// reported are not repeated
+func validateAccessType(config *models.AgentConfiguration, errs *models.ValidationErrors) {
+	if errs.Has("access_type") || errs.Has("max_concurrent_executions") {
+		return
+	}
+
+	// Already validated in basic validation, but we can add more complex logic here
+	// For example, ensure MaxConcurrentExecutions is properly set based on AccessType
+	switch config.AccessType {
+	case models.ReadOnlyAccessType:
+		if config.MaxConcurrentExecutions <= 0 {
+			config.MaxConcurrentExecutions = 10 // Default to 10 for read-only agents
+		}
+	case models.ReadWriteAccessType:
+		if config.MaxConcurrentExecutions != 1 {
+			errs.Add("max_concurrent_executions", models.ValidationConflict,
+				fmt.Sprintf("read-write agents must have MaxConcurrentExecutions equal to 1, got %d", config.MaxConcurrentExecutions))
+		}
+	}
+}
+
+// ValidateTask returns every problem with a task's definition that does not depend on the
+// supervisor it is scheduled on, such as whether the agent it runs is registered there
+func ValidateTask(task *models.ScheduledTask) models.ValidationErrors {
+	errs := models.ValidationErrors{}
+
+	if task.ID == "" {
+		errs.Add("id", models.ValidationRequired, "task ID cannot be empty")
+	}
+
+	if task.AgentID == "" && task.PipelineID == "" && !task.IsFanOut() {
+		errs.Add("agent_id", models.ValidationRequired, "agent ID cannot be empty")
+	}
+
+	if task.AgentID != "" && task.PipelineID != "" {
+		errs.Add("pipeline_id", models.ValidationConflict, "a task runs either an agent or a pipeline, not both")
+	}
+
+	task.ValidateFanOut(&errs)
+
+	if task.MaxRetries < 0 {
+		errs.Add("max_retries", models.ValidationOutOfRange, "max retries cannot be negative")
+	}
+
+	if task.RetryBackoff < 0 {
+		errs.Add("retry_backoff", models.ValidationOutOfRange, "retry backoff cannot be negative")
+	}
+
+	if task.Timeout < 0 {
+		errs.Add("timeout", models.ValidationOutOfRange, "timeout cannot be negative")
+	}
+
+	if err := models.ValidateOverlapPolicy(task.OverlapPolicy); err != nil {
+		errs.AddError("overlap_policy", models.ValidationInvalid, err)
+	}
+
+	if err := models.ValidateCatchUpPolicy(task.CatchUpPolicy); err != nil {
+		errs.AddError("catch_up_policy", models.ValidationInvalid, err)
+	}
+
+	if task.MaxCatchUpRuns < 0 {
+		errs.Add("max_catch_up_runs", models.ValidationOutOfRange, "max catch-up runs cannot be negative")
+	}
+
+	if err := models.ValidateLabels(task.Labels); err != nil {
+		errs.AddError("labels", models.ValidationInvalid, err)
+	}
+
+	if task.InputTemplate != "" {
+		if err := ValidateTaskInputTemplate(task.InputTemplate); err != nil {
+			errs.AddError("input_template", models.ValidationInvalid, err)
+		}
+	}
+
+	// Validate cron expression against the formats the scheduler accepts
+	if _, err := ParseCronExpression(task.CronExpression); err != nil {
+		errs.AddError("cron_expression", models.ValidationInvalid, err)
+	}
+
+	if _, err := TaskLocation(task, time.UTC); err != nil {
+		errs.AddError("timezone", models.ValidationInvalid, err)
+	}
+
+	return errs
+}
@@ -0,0 +1,138 @@
+package definitions
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.yaml.in/yaml/v3"
+)
+
+// fileFormats maps the extensions of definition files to their format
+var fileFormats = map[string]string{".yaml": "yaml", ".yml": "yaml", ".json": "json"}
+
+// yamlErrorLine finds the line a yaml parse error reports
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// IsDefinitionFile reports whether path names a yaml or json file
+func IsDefinitionFile(path string) bool {
+	_, ok := fileFormats[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// File is a definition file: a yaml or json document with agents and tasks sections like those of
+// the supervisor config file
+type File struct {
+	Path    string
+	Agents  []*models.AgentConfiguration // In file order, as the supervisor would register them
+	Tasks   []*models.ScheduledTask      // In file order, as the supervisor would schedule them
+	Unknown []string                     // Keys that map to no field, such as "agents[0].timeot"
+	root    *yaml.Node
+}
+
+// SyntaxError reports a definition file that cannot be decoded
+type SyntaxError struct {
+	Path string
+	Line int // 0 when unknown
+	Err  error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// LoadFile reads the definition file at path and decodes it as the supervisor decodes its config
+// file. A file that cannot be decoded fails with a *SyntaxError.
+func LoadFile(path string) (*File, error) {
+	format, ok := fileFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("%s: definition files must be .yaml, .yml or .json", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The yaml parser reads json as well and keeps the position of every key
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		syntaxErr := &SyntaxError{Path: path, Err: err}
+		if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			syntaxErr.Line, _ = strconv.Atoi(match[1])
+		}
+		return nil, syntaxErr
+	}
+
+	definitions, unknown, err := config.ReadDefinitions(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, &SyntaxError{Path: path, Err: err}
+	}
+
+	file := &File{Path: path, Unknown: unknown, root: &root}
+	for _, agent := range definitions.Agents {
+		file.Agents = append(file.Agents, agent.ToAgentConfiguration())
+	}
+	for _, task := range definitions.Tasks {
+		file.Tasks = append(file.Tasks, task.ToScheduledTask())
+	}
+	return file, nil
+}
+
+// Position returns the line and column of key in the file, such as "agents[1].cron_expression",
+// or of the closest enclosing key found; both are 0 when not even the first part is found. Names
+// are matched regardless of case, as the supervisor reads them.
+func (f *File) Position(key string) (line, column int) {
+	node := f.root
+	if node != nil && node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, part := range strings.Split(key, ".") {
+		name, index := part, -1
+		if open := strings.IndexByte(part, '['); open >= 0 && strings.HasSuffix(part, "]") {
+			name = part[:open]
+			index, _ = strconv.Atoi(part[open+1 : len(part)-1])
+		}
+
+		keyNode, value := mappingValue(node, name)
+		if keyNode == nil {
+			return line, column
+		}
+		line, column, node = keyNode.Line, keyNode.Column, value
+		if index >= 0 {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return line, column
+			}
+			node = node.Content[index]
+			line, column = node.Line, node.Column
+		}
+	}
+	return line, column
+}
+
+// mappingValue returns the key and value nodes of name in a mapping node, or nils
+func mappingValue(node *yaml.Node, name string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, name) {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
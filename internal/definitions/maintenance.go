@@ -0,0 +1,85 @@
+package definitions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/robfig/cron/v3"
+)
+
+// maxMaintenanceStarts bounds the starts of a window looked at to find the period in progress, so a
+// window starting every second with a long duration cannot stall the check
+const maxMaintenanceStarts = 10000
+
+// MaintenanceSchedule is a parsed maintenance window
+type MaintenanceSchedule struct {
+	Window   models.MaintenanceWindow
+	schedule cron.Schedule
+	duration time.Duration
+	location *time.Location
+}
+
+// ParseMaintenanceWindow parses a maintenance window, whose schedule is evaluated in its own time
+// zone or in fallback when it names none
+func ParseMaintenanceWindow(window models.MaintenanceWindow, fallback *time.Location) (*MaintenanceSchedule, error) {
+	schedule, err := ParseCronExpression(window.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := time.ParseDuration(window.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q: expected e.g. '1h30m': %w", window.Duration, err)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive, got %s", window.Duration)
+	}
+	location := fallback
+	if window.Timezone != "" {
+		if location, err = time.LoadLocation(window.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: expected an IANA name such as 'America/New_York': %w", window.Timezone, err)
+		}
+	}
+	return &MaintenanceSchedule{Window: window, schedule: schedule, duration: duration, location: location}, nil
+}
+
+// Current returns the period of the window in progress at now, the one ending last when periods
+// overlap
+func (s *MaintenanceSchedule) Current(now time.Time) (*models.MaintenancePeriod, bool) {
+	var first, last time.Time
+	start := s.schedule.Next(now.Add(-s.duration).In(s.location))
+	for i := 0; i < maxMaintenanceStarts && !start.IsZero() && !start.After(now); i++ {
+		if first.IsZero() {
+			first = start
+		}
+		last = start
+		start = s.schedule.Next(start)
+	}
+	if first.IsZero() {
+		return nil, false
+	}
+	return s.period(first, last.Add(s.duration)), true
+}
+
+// Next returns the first period of the window starting after now
+func (s *MaintenanceSchedule) Next(now time.Time) (*models.MaintenancePeriod, bool) {
+	start := s.schedule.Next(now.In(s.location))
+	if start.IsZero() {
+		return nil, false
+	}
+	return s.period(start, start.Add(s.duration)), true
+}
+
+// period returns a period of the window
+func (s *MaintenanceSchedule) period(start, end time.Time) *models.MaintenancePeriod {
+	return &models.MaintenancePeriod{Start: start, End: end, Reason: s.Window.Reason}
+}
+
+// validateMaintenanceWindows checks every maintenance window of an agent parses
+func validateMaintenanceWindows(config *models.AgentConfiguration, errs *models.ValidationErrors) {
+	for i, window := range config.MaintenanceWindows {
+		if _, err := ParseMaintenanceWindow(window, time.UTC); err != nil {
+			errs.AddError(fmt.Sprintf("maintenance_windows[%d]", i), models.ValidationInvalid, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package definitions
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Layouts the input template variables render in unless formatted with date
+const (
+	templateDateLayout     = "2006-01-02"
+	templateDateTimeLayout = time.RFC3339
+)
+
+// templateTime is a time an input template renders in a fixed layout; the zero time renders empty
+type templateTime struct {
+	time.Time
+	layout string
+}
+
+// String renders the time in its layout
+func (t templateTime) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(t.layout)
+}
+
+// taskInputVariables are the values an input template can use, as {{today}} or {{.today}}
+type taskInputVariables struct {
+	now     time.Time
+	lastRun *time.Time
+	taskID  string
+	agentID string
+	params  map[string]interface{}
+}
+
+// values returns the variables by name
+func (v taskInputVariables) values() map[string]interface{} {
+	today := time.Date(v.now.Year(), v.now.Month(), v.now.Day(), 0, 0, 0, 0, v.now.Location())
+	lastRun := templateTime{layout: templateDateTimeLayout}
+	if v.lastRun != nil {
+		lastRun.Time = *v.lastRun
+	}
+	params := v.params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"now":       templateTime{Time: v.now, layout: templateDateTimeLayout},
+		"today":     templateTime{Time: today, layout: templateDateLayout},
+		"yesterday": templateTime{Time: today.AddDate(0, 0, -1), layout: templateDateLayout},
+		"last_run":  lastRun,
+		"task_id":   v.taskID,
+		"agent_id":  v.agentID,
+		"params":    params,
+	}
+}
+
+// taskInputFuncs returns the functions of an input template: each variable, plus date, upper,
+// lower and default
+func taskInputFuncs(values map[string]interface{}) template.FuncMap {
+	funcs := template.FuncMap{
+		"date":    formatTemplateDate,
+		"upper":   func(value interface{}) string { return strings.ToUpper(fmt.Sprint(value)) },
+		"lower":   func(value interface{}) string { return strings.ToLower(fmt.Sprint(value)) },
+		"default": templateDefault,
+	}
+	for name, value := range values {
+		value := value
+		funcs[name] = func() interface{} { return value }
+	}
+	return funcs
+}
+
+// parseTaskInputTemplate parses an input template; values supplies the variables, which only
+// matter once it is executed
+func parseTaskInputTemplate(text string, values map[string]interface{}) (*template.Template, error) {
+	return template.New("input_template").
+		Option("missingkey=error").
+		Funcs(taskInputFuncs(values)).
+		Parse(text)
+}
+
+// ValidateTaskInputTemplate checks that an input template parses and only calls known functions
+func ValidateTaskInputTemplate(text string) error {
+	if _, err := parseTaskInputTemplate(text, taskInputVariables{}.values()); err != nil {
+		return fmt.Errorf("invalid input template: %w", err)
+	}
+	return nil
+}
+
+// RenderTaskInput builds the input of a run of task fired at now. A task with an input template
+// renders it; otherwise its input parameters are passed as key=value pairs.
+func RenderTaskInput(task *models.ScheduledTask, now time.Time) (string, error) {
+	if task.InputTemplate == "" {
+		return buildInputFromParameters(task.InputParameters), nil
+	}
+
+	values := taskInputVariables{
+		now:     now,
+		lastRun: task.LastExecution,
+		taskID:  task.ID,
+		agentID: task.AgentID,
+		params:  task.InputParameters,
+	}.values()
+	tmpl, err := parseTaskInputTemplate(task.InputTemplate, values)
+	if err != nil {
+		return "", fmt.Errorf("invalid input template: %w", err)
+	}
+
+	var input bytes.Buffer
+	if err := tmpl.Execute(&input, values); err != nil {
+		return "", fmt.Errorf("failed to render input template: %w", err)
+	}
+	return input.String(), nil
+}
+
+// formatTemplateDate formats a time with a Go layout such as 2006-01-02; the zero time formats empty
+func formatTemplateDate(layout string, value interface{}) (string, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case templateTime:
+		t = v.Time
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v != nil {
+			t = *v
+		}
+	default:
+		return "", fmt.Errorf("date cannot format %T", value)
+	}
+	if t.IsZero() {
+		return "", nil
+	}
+	return t.Format(layout), nil
+}
+
+// templateDefault returns value, or fallback when value is empty, e.g. {{default "never" last_run}}
+func templateDefault(fallback, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return fallback
+	case templateTime:
+		if v.IsZero() {
+			return fallback
+		}
+		return v
+	}
+	if reflect.ValueOf(value).IsZero() {
+		return fallback
+	}
+	return value
+}
+
+// buildInputFromParameters builds an input string from task parameters
+func buildInputFromParameters(params map[string]interface{}) string {
+	if len(params) == 0 {
+		return ""
+	}
+
+	input := ""
+	for key, value := range params {
+		input += fmt.Sprintf("%s=%v ", key, value)
+	}
+
+	return input
+}
@@ -1,6 +1,9 @@
 package logging
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"os"
 	"time"
 
@@ -100,7 +103,7 @@ func Middleware(logger *zap.Logger) gin.HandlerFunc {
 			path = path + "?" + raw
 		}
 
-		logger.Info("HTTP Request",
+		fields := []zap.Field{
 			zap.String("client_ip", clientIP),
 			zap.String("method", method),
 			zap.String("path", path),
@@ -108,8 +111,121 @@ func Middleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.Duration("latency", latency),
 			zap.String("user_agent", c.Request.UserAgent()),
 			zap.Int("bytes", c.Writer.Size()),
-		)
+		}
+		if requestID := c.GetString(RequestIDKey); requestID != "" {
+			fields = append(fields, zap.String("request_id", requestID))
+		}
+		if executionID := c.GetString(ExecutionIDKey); executionID != "" {
+			fields = append(fields, zap.String("execution_id", executionID))
+		}
+
+		logger.Info("HTTP Request", fields...)
+	}
+}
+
+const (
+	// RequestIDHeader is the HTTP header used to pass and return the request ID
+	RequestIDHeader = "X-Request-ID"
+
+	// RequestIDKey is the gin context key holding the request ID
+	RequestIDKey = "request_id"
+
+	// ExecutionIDKey is the gin context key holding the ID of the execution started by a request
+	ExecutionIDKey = "execution_id"
+
+	// maxRequestIDLength bounds client-supplied request IDs
+	maxRequestIDLength = 128
+)
+
+type contextKey string
+
+const (
+	requestIDContextKey   contextKey = "request_id"
+	executionIDContextKey contextKey = "execution_id"
+)
+
+// RequestIDMiddleware extracts X-Request-ID or generates one, and exposes it to handlers, services and the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(ContextWithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// SetExecutionID records the execution started by the current request for request logging
+func SetExecutionID(c *gin.Context, executionID string) {
+	c.Set(ExecutionIDKey, executionID)
+}
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
+
+// isValidRequestID accepts short IDs made of letters, digits, '-', '_' and '.'
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithRequestID returns a context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// ContextWithExecutionID returns a context carrying the execution ID
+func ContextWithExecutionID(ctx context.Context, executionID string) context.Context {
+	return context.WithValue(ctx, executionIDContextKey, executionID)
+}
+
+// ExecutionIDFromContext returns the execution ID carried by ctx, if any
+func ExecutionIDFromContext(ctx context.Context) string {
+	executionID, _ := ctx.Value(executionIDContextKey).(string)
+	return executionID
+}
+
+// LoggerFromContext adds the request and execution IDs carried by ctx to the logger
+func LoggerFromContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	logger = WithRequestID(logger, RequestIDFromContext(ctx))
+	if executionID := ExecutionIDFromContext(ctx); executionID != "" {
+		logger = WithExecutionID(logger, executionID)
+	}
+	return logger
+}
+
+// WithRequestID adds request ID to the logger context, leaving the logger unchanged when empty
+func WithRequestID(logger *zap.Logger, requestID string) *zap.Logger {
+	if requestID == "" {
+		return logger
 	}
+	return logger.With(zap.String("request_id", requestID))
 }
 
 // WithExecutionID adds execution ID to the logger context
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"github.com/algonius/algonius-supervisor/pkg/types"
 	"time"
 )
@@ -10,55 +11,121 @@ import (
 type AgentConfiguration struct {
 	ID                    string            `json:"id"`
 	Name                  string            `json:"name"`
+	Template              string            `json:"template,omitempty"` // Agent template supplying the settings left zero-valued
+	Description           string            `json:"description,omitempty"` // What the agent does and how to call it, for consumers discovering it
+	InputSchema           JSONSchema        `json:"input_schema,omitempty"` // JSON Schema of the parameters map of execute requests
+	Examples              []AgentExample    `json:"examples,omitempty"`
+	ValidateInput         bool              `json:"validate_input,omitempty"` // Reject execute requests whose parameters violate InputSchema with 422
 	AgentType             string            `json:"agent_type"`
 	ExecutablePath        string            `json:"executable_path"`
 	WorkingDirectory      string            `json:"working_directory"`
 	Envs                  map[string]string `json:"envs"`
+	SensitiveEnvKeys      []string          `json:"sensitive_env_keys,omitempty"` // Envs whose values are masked in API responses, besides those with secret-like names
 	CliArgs               map[string]string `json:"cli_args"`
+	Parameters            map[string]string `json:"parameters,omitempty"` // Settings of built-in agent types, such as the synthetic agent's duration
 	Mode                  types.AgentMode   `json:"mode"`
 	InputPattern          types.InputPattern `json:"input_pattern"`
 	OutputPattern         types.OutputPattern `json:"output_pattern"`
 	InputFileTemplate     string            `json:"input_file_template"`
-	OutputFileTemplate    string            `json:"output_file_template"`
+	OutputFileTemplate    string            `json:"output_file_template"` // May hold a glob, in which case the newest matching file is read
+	OutputFileWaitSeconds int               `json:"output_file_wait_seconds,omitempty"` // Time the output file has to appear after the agent exits, 0 to read it at once
+	OutputFileStable      bool              `json:"output_file_stable,omitempty"` // Within the wait, also wait for the output file to be non-empty and stop growing
+	OutputSelector        string            `json:"output_selector,omitempty"` // Value picked from the JSON document of the json output pattern, e.g. "$.items[0].name"
+	AllowIncompatiblePatterns bool          `json:"allow_incompatible_patterns,omitempty"` // Only warn when the input and output patterns are incompatible
+	OutputEncoding        OutputEncoding    `json:"output_encoding,omitempty"` // Default encoding of execution output in responses: text, json or base64
+	SandboxDir            string            `json:"sandbox_dir,omitempty"` // Root for input/output files, defaults to a per-agent directory under the data dir
+	KeepArtifacts         bool              `json:"keep_artifacts"` // Keep per-execution sandbox directories after the run
+	MaxOutputBytes        int64             `json:"max_output_bytes,omitempty"` // Bytes of each output stream kept per execution, 0 for the server default
+	StdoutLogfile         string            `json:"stdout_logfile,omitempty"` // Log file for agent stdout, may use {{agent_id}}; empty disables it
+	StderrLogfile         string            `json:"stderr_logfile,omitempty"` // Log file for agent stderr, may use {{agent_id}}; empty disables it
+	LogfileMaxBytes       int64             `json:"logfile_maxbytes,omitempty"` // Size at which log files rotate, 0 for the default
+	LogfileBackups        int               `json:"logfile_backups,omitempty"` // Rotated log files to keep, 0 for the default
+	CacheTTLSeconds       int               `json:"cache_ttl_seconds,omitempty"` // Reuse successful results for identical input this long, 0 disables caching
+	RunAsUser             string            `json:"run_as_user,omitempty"` // User name or ID the agent process runs as, empty for the supervisor's own
+	RunAsGroup            string            `json:"run_as_group,omitempty"` // Group name or ID, defaults to the primary group of RunAsUser
+	NiceLevel             int               `json:"nice_level,omitempty"` // Scheduling priority from -20 (highest) to 19 (lowest)
+	MaxMemoryMB           int64             `json:"max_memory_mb,omitempty"` // Address space limit (RLIMIT_AS), 0 for unlimited
+	MaxCPUSeconds         int64             `json:"max_cpu_seconds,omitempty"` // CPU time limit (RLIMIT_CPU), 0 for unlimited
+	SkipFSChecks          bool              `json:"skip_fs_checks,omitempty"` // Only warn when the executable or directories are missing at registration
+	StopSignal            string            `json:"stop_signal,omitempty"` // Signal that asks the agent's process tree to exit, TERM when empty
+	StopWaitSeconds       int               `json:"stop_wait_seconds,omitempty"` // Time to exit after the stop signal before being killed, 0 for the default
+	MaxSilenceSeconds     int               `json:"max_silence_seconds,omitempty"` // Stop an execution whose agent shows no activity this long, 0 to never
+	HeartbeatFile         string            `json:"heartbeat_file,omitempty"` // File, relative to the working directory, the agent touches to count as active
+	HeartbeatLine         string            `json:"heartbeat_line,omitempty"` // Output line the agent writes to count as active; other output then does not count
+	PingIntervalSeconds   int               `json:"ping_interval_seconds,omitempty"` // How often a persistent agent is health-checked, 0 for the default
+	PingTimeoutSeconds    int               `json:"ping_timeout_seconds,omitempty"` // Time a persistent agent has to answer a ping before it is restarted, 0 for the default
+	StartRetries          int               `json:"start_retries,omitempty"` // Failed starts in a row after which a persistent agent enters the fatal state, 0 for the default
+	StartSecs             int               `json:"start_secs,omitempty"` // Time a persistent agent's process must run for its start to count as successful, 0 for the default
+	PostStartHook         *LifecycleHook    `json:"post_start_hook,omitempty"` // Run once a persistent agent's process reached the running state
+	PreStopHook           *LifecycleHook    `json:"pre_stop_hook,omitempty"` // Run before a persistent agent's process is sent the stop signal
+	MaintenanceWindows    []MaintenanceWindow `json:"maintenance_windows,omitempty"` // Recurring periods without scheduled runs, automatic restarts or health check alerts
+	ExitCodeMap           ExitCodeMap       `json:"exit_code_map,omitempty"` // Statuses of nonzero exit codes, e.g. {"1": "success"}; unmapped ones are failures
 	AccessType            types.AgentAccessType `json:"access_type"`
 	MaxConcurrentExecutions int             `json:"max_concurrent_executions"`
+	Weight                int               `json:"weight,omitempty"` // Share of the read-only pool's slots when it is contended, 1 when 0
 	Timeout               int               `json:"timeout"` // seconds
 	SessionTimeout        int               `json:"session_timeout"` // seconds
+	MaxTotalTimeout       int               `json:"max_total_timeout,omitempty"` // Seconds an execution may run once its deadline is extended, 0 to allow no extensions
 	KeepAlive             bool              `json:"keep_alive"`
 	Enabled               bool              `json:"enabled"`
 	CreatedAt             time.Time         `json:"created_at"`
 	UpdatedAt             time.Time         `json:"updated_at"`
+	DeletedAt             *time.Time        `json:"deleted_at,omitempty"` // Set while the agent is soft-deleted and can still be restored
 }
 
-// Validate validates the agent configuration fields
+// IsDeleted reports whether the agent is soft-deleted
+func (ac *AgentConfiguration) IsDeleted() bool {
+	return ac.DeletedAt != nil
+}
+
+// Validate validates the agent configuration fields, returning every problem found as
+// ValidationErrors
 func (ac *AgentConfiguration) Validate() error {
+	return ac.ValidateFields().Err()
+}
+
+// ValidateFields returns every problem with the agent configuration fields, empty when it is valid
+func (ac *AgentConfiguration) ValidateFields() ValidationErrors {
+	errs := ValidationErrors{}
+
 	if ac.ID == "" {
-		return ValidationError("AgentConfiguration ID cannot be empty")
+		errs.Add("id", ValidationRequired, "AgentConfiguration ID cannot be empty")
 	}
 
 	if ac.Name == "" {
-		return ValidationError("AgentConfiguration Name cannot be empty")
+		errs.Add("name", ValidationRequired, "AgentConfiguration Name cannot be empty")
 	}
 
-	if ac.ExecutablePath == "" {
-		return ValidationError("AgentConfiguration ExecutablePath cannot be empty")
+	// Synthetic agents run no executable
+	if ac.AgentType == SyntheticAgentType {
+		if _, err := ParseSyntheticSettings(ac.Parameters); err != nil {
+			errs.AddError("parameters", ValidationInvalid, err)
+		}
+	} else if ac.ExecutablePath == "" {
+		errs.Add("executable_path", ValidationRequired, "AgentConfiguration ExecutablePath cannot be empty")
 	}
 
 	if ac.AccessType != types.ReadOnlyAccessType && ac.AccessType != types.ReadWriteAccessType {
-		return ValidationError("AgentConfiguration AccessType must be 'read-only' or 'read-write'")
+		errs.Add("access_type", ValidationInvalid, "AgentConfiguration AccessType must be 'read-only' or 'read-write'")
 	}
 
 	if ac.MaxConcurrentExecutions < 1 {
-		return ValidationError("AgentConfiguration MaxConcurrentExecutions must be at least 1")
-	}
-
-	if ac.AccessType == types.ReadWriteAccessType && ac.MaxConcurrentExecutions > 1 {
-		return ValidationError("ReadWrite agents must have MaxConcurrentExecutions of 1")
+		errs.Add("max_concurrent_executions", ValidationOutOfRange, "AgentConfiguration MaxConcurrentExecutions must be at least 1")
+	} else if ac.AccessType == types.ReadWriteAccessType && ac.MaxConcurrentExecutions > 1 {
+		errs.Add("max_concurrent_executions", ValidationConflict, "ReadWrite agents must have MaxConcurrentExecutions of 1")
 	}
 
 	// Validate mode
-	if ac.Mode != types.TaskMode && ac.Mode != types.InteractiveMode {
-		return ValidationError("AgentConfiguration Mode must be 'task' or 'interactive'")
+	switch ac.Mode {
+	case types.TaskMode, types.InteractiveMode:
+		// Valid
+	case types.PersistentMode:
+		// Executions are JSON-RPC calls over the process's stdin and stdout
+		if ac.InputPattern != types.JsonRpcPattern || ac.OutputPattern != types.JsonRpcPatternOut {
+			errs.Add("mode", ValidationConflict, "AgentConfiguration Mode 'persistent' requires the 'json-rpc' input and output patterns")
+		}
+	default:
+		errs.Add("mode", ValidationInvalid, "AgentConfiguration Mode must be 'task', 'interactive' or 'persistent'")
 	}
 
 	// Validate input pattern
@@ -66,18 +133,149 @@ func (ac *AgentConfiguration) Validate() error {
 	case types.StdinPattern, types.FilePattern, types.ArgsPattern, types.JsonRpcPattern:
 		// Valid
 	default:
-		return ValidationError("AgentConfiguration InputPattern must be 'stdin', 'file', 'args', or 'json-rpc'")
+		errs.Add("input_pattern", ValidationInvalid, "AgentConfiguration InputPattern must be 'stdin', 'file', 'args', or 'json-rpc'")
 	}
 
 	// Validate output pattern
 	switch ac.OutputPattern {
-	case types.StdoutPattern, types.FilePatternOut, types.JsonRpcPatternOut:
+	case types.StdoutPattern, types.FilePatternOut, types.JsonRpcPatternOut, types.JsonPatternOut:
 		// Valid
 	default:
-		return ValidationError("AgentConfiguration OutputPattern must be 'stdout', 'file', or 'json-rpc'")
+		errs.Add("output_pattern", ValidationInvalid, "AgentConfiguration OutputPattern must be 'stdout', 'file', 'json', or 'json-rpc'")
+	}
+
+	if ac.OutputSelector != "" && ac.OutputPattern != types.JsonPatternOut {
+		errs.Add("output_selector", ValidationConflict, "AgentConfiguration OutputSelector requires the 'json' OutputPattern")
+	}
+
+	if err := ac.InputSchema.Validate(); err != nil {
+		errs.Add("input_schema", ValidationInvalid, "AgentConfiguration InputSchema is not a valid JSON Schema: "+err.Error())
+	} else {
+		for i, example := range ac.Examples {
+			for _, fieldErr := range ac.InputSchema.ValidateParameters(example.Parameters) {
+				errs.Add(fmt.Sprintf("examples[%d].%s", i, fieldErr.Field), fieldErr.Code, "AgentConfiguration example "+fieldErr.Message)
+			}
+		}
+	}
+	if ac.ValidateInput && ac.InputSchema == nil {
+		errs.Add("validate_input", ValidationConflict, "AgentConfiguration ValidateInput requires an InputSchema")
+	}
+
+	if err := ac.ExitCodeMap.Validate(); err != nil {
+		errs.AddError("exit_code_map", ValidationInvalid, err)
+	}
+
+	if !ac.OutputEncoding.IsValid() {
+		errs.Add("output_encoding", ValidationInvalid, "AgentConfiguration OutputEncoding must be 'text', 'json' or 'base64'")
+	}
+
+	if ac.OutputFileWaitSeconds < 0 {
+		errs.Add("output_file_wait_seconds", ValidationOutOfRange, "AgentConfiguration OutputFileWaitSeconds cannot be negative")
+	}
+
+	if ac.MaxOutputBytes < 0 {
+		errs.Add("max_output_bytes", ValidationOutOfRange, "AgentConfiguration MaxOutputBytes cannot be negative")
+	}
+
+	if ac.LogfileMaxBytes < 0 {
+		errs.Add("logfile_maxbytes", ValidationOutOfRange, "AgentConfiguration LogfileMaxBytes cannot be negative")
+	}
+
+	if ac.LogfileBackups < 0 {
+		errs.Add("logfile_backups", ValidationOutOfRange, "AgentConfiguration LogfileBackups cannot be negative")
+	}
+
+	if ac.CacheTTLSeconds < 0 {
+		errs.Add("cache_ttl_seconds", ValidationOutOfRange, "AgentConfiguration CacheTTLSeconds cannot be negative")
+	} else if ac.CacheTTLSeconds > 0 && ac.AccessType != types.ReadOnlyAccessType {
+		errs.Add("cache_ttl_seconds", ValidationConflict, "Only read-only agents may cache execution results")
+	}
+
+	if ac.NiceLevel < -20 || ac.NiceLevel > 19 {
+		errs.Add("nice_level", ValidationOutOfRange, "AgentConfiguration NiceLevel must be between -20 and 19")
+	}
+
+	if ac.MaxMemoryMB < 0 {
+		errs.Add("max_memory_mb", ValidationOutOfRange, "AgentConfiguration MaxMemoryMB and MaxCPUSeconds cannot be negative")
+	}
+
+	if ac.MaxCPUSeconds < 0 {
+		errs.Add("max_cpu_seconds", ValidationOutOfRange, "AgentConfiguration MaxMemoryMB and MaxCPUSeconds cannot be negative")
+	}
+
+	if _, err := NormalizeStopSignal(ac.StopSignal); err != nil {
+		errs.Add("stop_signal", ValidationInvalid, "AgentConfiguration StopSignal is invalid: "+err.Error())
+	}
+
+	if ac.StopWaitSeconds < 0 {
+		errs.Add("stop_wait_seconds", ValidationOutOfRange, "AgentConfiguration StopWaitSeconds cannot be negative")
+	}
+
+	if ac.MaxSilenceSeconds < 0 {
+		errs.Add("max_silence_seconds", ValidationOutOfRange, "AgentConfiguration MaxSilenceSeconds cannot be negative")
+	} else if ac.Timeout > 0 && ac.MaxSilenceSeconds > ac.Timeout {
+		errs.Add("max_silence_seconds", ValidationOutOfRange, "AgentConfiguration MaxSilenceSeconds cannot exceed Timeout")
+	} else if ac.MaxSilenceSeconds > 0 && ac.Mode == types.PersistentMode {
+		errs.Add("max_silence_seconds", ValidationConflict, "AgentConfiguration MaxSilenceSeconds does not apply to persistent agents, which are health-checked with pings")
+	}
+
+	if (ac.HeartbeatFile != "" || ac.HeartbeatLine != "") && ac.MaxSilenceSeconds <= 0 {
+		field := "heartbeat_file"
+		if ac.HeartbeatFile == "" {
+			field = "heartbeat_line"
+		}
+		errs.Add(field, ValidationConflict, "AgentConfiguration heartbeats require MaxSilenceSeconds")
+	}
+
+	if ac.PingIntervalSeconds < 0 {
+		errs.Add("ping_interval_seconds", ValidationOutOfRange, "AgentConfiguration PingIntervalSeconds cannot be negative")
+	}
+
+	if ac.PingTimeoutSeconds < 0 {
+		errs.Add("ping_timeout_seconds", ValidationOutOfRange, "AgentConfiguration PingTimeoutSeconds cannot be negative")
+	}
+
+	if ac.StartRetries < 0 {
+		errs.Add("start_retries", ValidationOutOfRange, "AgentConfiguration StartRetries cannot be negative")
+	}
+
+	if ac.StartSecs < 0 {
+		errs.Add("start_secs", ValidationOutOfRange, "AgentConfiguration StartSecs cannot be negative")
+	}
+
+	for _, hook := range []struct {
+		field string
+		kind  HookKind
+		hook  *LifecycleHook
+	}{{"post_start_hook", HookPostStart, ac.PostStartHook}, {"pre_stop_hook", HookPreStop, ac.PreStopHook}} {
+		if hook.hook == nil {
+			continue
+		}
+		if ac.Mode != types.PersistentMode {
+			errs.Add(hook.field, ValidationConflict, "AgentConfiguration lifecycle hooks only apply to persistent agents")
+		} else if err := hook.hook.Validate(hook.kind); err != nil {
+			errs.AddError(hook.field, ValidationInvalid, err)
+		}
+	}
+
+	if ac.MaxTotalTimeout < 0 {
+		errs.Add("max_total_timeout", ValidationOutOfRange, "AgentConfiguration MaxTotalTimeout cannot be negative")
+	} else if ac.MaxTotalTimeout > 0 && ac.MaxTotalTimeout < ac.Timeout {
+		errs.Add("max_total_timeout", ValidationOutOfRange, "AgentConfiguration MaxTotalTimeout cannot be less than Timeout")
+	}
+
+	if ac.Weight < 0 {
+		errs.Add("weight", ValidationOutOfRange, "AgentConfiguration Weight cannot be negative")
+	}
+
+	for _, key := range ac.SensitiveEnvKeys {
+		if key == "" {
+			errs.Add("sensitive_env_keys", ValidationInvalid, "AgentConfiguration SensitiveEnvKeys cannot contain empty keys")
+			break
+		}
 	}
 
-	return nil
+	return errs
 }
 
 // ValidationError represents an error during validation
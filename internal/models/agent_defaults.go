@@ -0,0 +1,75 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ApplyDefaults returns a copy of agent whose zero-valued fields are taken from the server-wide
+// agent defaults, merged the way a template is. Agents get the defaults after their template, so
+// what they set wins over the template, which wins over the defaults. Nil defaults return agent.
+func ApplyDefaults(agent, defaults *AgentConfiguration) *AgentConfiguration {
+	if defaults == nil {
+		return agent
+	}
+	return (&AgentTemplate{Settings: *defaults}).Apply(agent)
+}
+
+// unchangedFields are the AgentConfiguration fields ChangedFields does not compare
+var unchangedFields = map[string]bool{
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+}
+
+// ChangedFields returns the JSON names of the settings that differ between two configurations of an
+// agent, in field order; timestamps are not compared
+func ChangedFields(before, after *AgentConfiguration) []string {
+	var changed []string
+	beforeValue := reflect.ValueOf(before).Elem()
+	afterValue := reflect.ValueOf(after).Elem()
+
+	for i := 0; i < beforeValue.NumField(); i++ {
+		field := beforeValue.Type().Field(i)
+		if unchangedFields[field.Name] {
+			continue
+		}
+		if !reflect.DeepEqual(beforeValue.Field(i).Interface(), afterValue.Field(i).Interface()) {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// AgentDefaultsResult reports what reapplying the defaults did, or would do, to one agent
+type AgentDefaultsResult struct {
+	AgentID       string          `json:"agent_id"`
+	Status        OperationStatus `json:"status"` // applied, pending in dry runs, skipped when nothing changes, or failed
+	ChangedFields []string        `json:"changed_fields,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// ReapplyDefaultsResult summarizes reapplying the current defaults to registered agents
+type ReapplyDefaultsResult struct {
+	DryRun  bool                  `json:"dry_run,omitempty"`
+	Matched int                   `json:"matched"`
+	Updated int                   `json:"updated"` // Agents changed, or that a dry run would change
+	Skipped int                   `json:"skipped"`
+	Failed  int                   `json:"failed"`
+	Results []AgentDefaultsResult `json:"results"`
+}
+
+// Add records the result of one agent and counts it by status
+func (r *ReapplyDefaultsResult) Add(result AgentDefaultsResult) {
+	r.Matched++
+	switch result.Status {
+	case OperationApplied, OperationPending:
+		r.Updated++
+	case OperationSkipped:
+		r.Skipped++
+	case OperationFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
@@ -19,13 +19,28 @@ type AgentExecution struct {
 	Input            string                 `json:"input"` // sanitized of sensitive data
 	ProcessID        int                    `json:"process_id"` // OS process ID of the executed agent (if applicable)
 	ExitCode         int                    `json:"exit_code"`
+	ForcedKill       bool                   `json:"forced_kill,omitempty"` // The agent ignored its stop signal and was killed
 	ErrorMessage     string                 `json:"error_message"`
 	ErrorCategory    types.ErrorCategory    `json:"error_category"`
+	Status           types.ExecutionStatus  `json:"status,omitempty"` // Outcome once finished: success, warning, failure, timeout or cancelled
 	RetryCount       int                    `json:"retry_count"`
 	MaxRetries       int                    `json:"max_retries"`
 	Timeout          int                    `json:"timeout"` // seconds
+	Deadline         *time.Time             `json:"deadline,omitempty"` // When the running attempt times out; extensions move it later
 	ResourceUsage    *ResourceUsage         `json:"resource_usage"`
 	Context          map[string]interface{} `json:"context"`
+	Labels           map[string]string      `json:"labels,omitempty"` // Caller-supplied attribution labels
+	TriggerType      types.TaskTriggerType  `json:"trigger_type,omitempty"` // Entry point that started the execution: scheduled, manual, api, jsonrpc, grpc, a2a
+	TriggeredBy      string                 `json:"triggered_by,omitempty"` // Client identity of the caller, or scheduler:<task id>
+	PushNotification *PushNotificationConfig `json:"push_notification,omitempty"` // A2A callback for when the execution finishes
+	Inputs           *ExecutionInputs       `json:"inputs,omitempty"` // What the execution ran with, for replays
+	ReplayOf         string                 `json:"replay_of,omitempty"` // ID of the execution this one replays
+	Snapshot         *ExecutionSnapshot     `json:"-"` // Environment the agent process saw, served by GET /api/v1/executions/:id/snapshot
+	QueuePosition    int                    `json:"queue_position,omitempty"` // Place in its agent's queue while queued, 1 runs next
+	EstimatedWaitMs  int64                  `json:"estimated_wait_ms,omitempty"` // Expected wait before a queued execution starts
+	StateHistory     []StateTransition      `json:"state_history"` // Every state change, oldest first
+	Anomalies        []string               `json:"anomalies,omitempty"` // How the finished execution deviated from its agent's and task's recent ones
+	Progress         *ExecutionProgress     `json:"progress,omitempty"` // The latest progress the agent reported, nil until it reports any
 	CreatedAt        time.Time              `json:"created_at"`
 	UpdatedAt        time.Time              `json:"updated_at"`
 }
@@ -54,7 +69,7 @@ func (ae *AgentExecution) Validate() error {
 // isValidAgentState checks if the state is one of the valid AgentState values
 func isValidAgentState(state types.AgentState) bool {
 	switch state {
-	case types.IdleState, types.StartingState, types.RunningState, types.CompletedState,
+	case types.IdleState, types.QueuedState, types.StartingState, types.RunningState, types.CompletedState,
 	     types.FailedState, types.CleanupState, types.TimeoutState, types.CancelledState:
 		return true
 	default:
@@ -64,45 +79,79 @@ func isValidAgentState(state types.AgentState) bool {
 
 // CanTransitionTo checks if the current state can transition to the target state
 func (ae *AgentExecution) CanTransitionTo(targetState types.AgentState) bool {
-	allowedTransitions := map[types.AgentState][]types.AgentState{
-		types.IdleState:      {types.StartingState},
-		types.StartingState:  {types.RunningState, types.FailedState},
-		types.RunningState:   {types.CompletedState, types.FailedState, types.TimeoutState, types.CancelledState},
-		types.CompletedState: {types.CleanupState},
-		types.FailedState:    {types.CleanupState, types.StartingState}, // Allow retry from Failed state
-		types.TimeoutState:   {types.CleanupState},
-		types.CancelledState: {types.CleanupState},
-		types.CleanupState:   {types.IdleState},
-	}
-
-	allowed, exists := allowedTransitions[ae.State]
-	if !exists {
-		return false
-	}
-
-	for _, validState := range allowed {
-		if targetState == validState {
-			return true
-		}
-	}
-
-	return false
+	return DefaultStateMachine().Allows(ae.State, targetState)
 }
 
-// UpdateState updates the state and timestamp for the execution
+// UpdateState moves the execution to newState under the default state machine
 func (ae *AgentExecution) UpdateState(newState types.AgentState) error {
-	if !ae.CanTransitionTo(newState) {
-		return ValidationError("Invalid state transition from " + string(ae.State) + " to " + string(newState))
+	return ae.Transition(DefaultStateMachine(), newState, "", "")
+}
+
+// Transition moves the execution to newState and records the step in its history. Changes the state
+// machine does not allow fail with an *InvalidTransitionError and leave the execution untouched.
+func (ae *AgentExecution) Transition(sm *StateMachine, newState types.AgentState, reason, requestedBy string) error {
+	if !sm.Allows(ae.State, newState) {
+		return &InvalidTransitionError{ExecutionID: ae.ID, From: ae.State, To: newState}
 	}
 
+	now := time.Now()
+	ae.StateHistory = append(ae.StateHistory, StateTransition{
+		FromState:   ae.State,
+		ToState:     newState,
+		Timestamp:   now,
+		Reason:      reason,
+		RequestedBy: requestedBy,
+	})
 	ae.PreviousState = ae.State
 	ae.State = newState
-	ae.LastStateChange = time.Now()
-	ae.UpdatedAt = time.Now()
+	ae.LastStateChange = now
+	ae.UpdatedAt = now
 
 	return nil
 }
 
+// ExtendDeadline records that the deadline of the running execution moved to deadline. The
+// extension is kept in the state history as a step that leaves the state unchanged.
+func (ae *AgentExecution) ExtendDeadline(deadline time.Time, reason, requestedBy string) {
+	now := time.Now()
+	ae.StateHistory = append(ae.StateHistory, StateTransition{
+		FromState:   ae.State,
+		ToState:     ae.State,
+		Timestamp:   now,
+		Reason:      reason,
+		RequestedBy: requestedBy,
+	})
+	ae.Deadline = &deadline
+	ae.UpdatedAt = now
+}
+
+// DeadlineExtension reports how far an extension moved the deadline of a running execution. The
+// granted time is less than requested when the agent's max_total_timeout caps it.
+type DeadlineExtension struct {
+	ExecutionID      string    `json:"execution_id"`
+	RequestedSeconds int       `json:"requested_seconds"`
+	GrantedSeconds   int       `json:"granted_seconds"`
+	Deadline         time.Time `json:"deadline"`
+	MaxDeadline      time.Time `json:"max_deadline"` // The latest the deadline can be extended to
+}
+
+// Clone returns a copy of the execution that later changes to it do not reach: the state history,
+// anomalies and push notification are copied, and the other pointers are only ever replaced
+func (ae *AgentExecution) Clone() *AgentExecution {
+	clone := *ae
+	clone.StateHistory = append([]StateTransition(nil), ae.StateHistory...)
+	clone.Anomalies = append([]string(nil), ae.Anomalies...)
+	if ae.PushNotification != nil {
+		push := *ae.PushNotification
+		if push.Delivery != nil {
+			delivery := *push.Delivery
+			push.Delivery = &delivery
+		}
+		clone.PushNotification = &push
+	}
+	return &clone
+}
+
 // IsComplete returns true if the execution is in a completed state
 func (ae *AgentExecution) IsComplete() bool {
 	switch ae.State {
@@ -113,6 +162,20 @@ func (ae *AgentExecution) IsComplete() bool {
 	}
 }
 
+// EndStatus returns the status of an execution that ended without success, or false when its state
+// alone does not tell how it ended
+func (ae *AgentExecution) EndStatus() (types.ExecutionStatus, bool) {
+	switch ae.State {
+	case types.FailedState:
+		return types.FailureStatus, true
+	case types.TimeoutState:
+		return types.TimeoutStatus, true
+	case types.CancelledState:
+		return types.CancelledStatus, true
+	}
+	return "", false
+}
+
 // IsRunning returns true if the execution is currently running
 func (ae *AgentExecution) IsRunning() bool {
 	return ae.State == types.RunningState
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GroupTargetPrefix marks a lifecycle target naming an agent group instead of an agent, as in
+// group:payments
+const GroupTargetPrefix = "group:"
+
+// AgentGroup is a named, ordered list of agents operated on together. Members start in their order,
+// so an agent is listed after the agents it depends on, and stop in the reverse order.
+type AgentGroup struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Members     []string  `json:"members"` // Agent IDs
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupTarget returns the group named by a lifecycle target such as group:payments, false when the
+// target names an agent
+func GroupTarget(target string) (string, bool) {
+	name, ok := strings.CutPrefix(target, GroupTargetPrefix)
+	return name, ok && name != ""
+}
+
+// Validate checks the group's own fields, returning every problem found as ValidationErrors; that
+// the members exist is checked against the registered agents
+func (g *AgentGroup) Validate() error {
+	errs := ValidationErrors{}
+
+	if g.Name == "" {
+		errs.Add("name", ValidationRequired, "AgentGroup Name cannot be empty")
+	} else if strings.ContainsAny(g.Name, ":/") {
+		errs.Add("name", ValidationInvalid, "AgentGroup Name cannot contain ':' or '/'")
+	}
+
+	if len(g.Members) == 0 {
+		errs.Add("members", ValidationRequired, "AgentGroup must have at least one member")
+	}
+
+	seen := make(map[string]bool, len(g.Members))
+	for i, member := range g.Members {
+		field := fmt.Sprintf("members[%d]", i)
+		switch {
+		case member == "":
+			errs.Add(field, ValidationRequired, "AgentGroup member cannot be empty")
+		case seen[member]:
+			errs.Add(field, ValidationConflict, fmt.Sprintf("AgentGroup member %s is listed more than once", member))
+		}
+		seen[member] = true
+	}
+
+	return errs.Err()
+}
+
+// GroupStep is what a group operation does to one member
+type GroupStep string
+
+const (
+	GroupStepStop  GroupStep = "stop"
+	GroupStepStart GroupStep = "start"
+)
+
+// GroupOperationStep reports the operation on one member of a group
+type GroupOperationStep struct {
+	AgentID             string          `json:"agent_id"`
+	Step                GroupStep       `json:"step"`
+	Status              OperationStatus `json:"status"` // applied, skipped when the member has nothing to do, or failed
+	Message             string          `json:"message,omitempty"`
+	CancelledExecutions []string        `json:"cancelled_executions,omitempty"`
+}
+
+// GroupOperationResult reports a lifecycle operation on every member of a group, or on every agent
+// matching a pattern in ID order. Steps are listed in the order they were taken: stops in reverse
+// member order, then starts in member order. The operation ends at the first step that fails.
+type GroupOperationResult struct {
+	Group     string               `json:"group,omitempty"`
+	Pattern   string               `json:"pattern,omitempty"`
+	Action    TaskAction           `json:"action"`
+	Steps     []GroupOperationStep `json:"steps"`
+	Protected []string             `json:"protected,omitempty"` // Protected agents left out because the operation was not forced
+}
+
+// Add records a step and reports whether it did not fail, so the operation goes on
+func (r *GroupOperationResult) Add(step GroupOperationStep) bool {
+	r.Steps = append(r.Steps, step)
+	return step.Status != OperationFailed
+}
+
+// Failed returns the step the operation stopped at, nil when every step succeeded or was skipped
+func (r *GroupOperationResult) Failed() *GroupOperationStep {
+	for i := range r.Steps {
+		if r.Steps[i].Status == OperationFailed {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"reflect"
+	"time"
+)
+
+// AgentTemplate holds settings shared by many agents. An agent naming the template inherits every
+// setting it leaves zero-valued; the ID, Name and Template of the settings are ignored.
+type AgentTemplate struct {
+	Name      string             `json:"name"`
+	Settings  AgentConfiguration `json:"settings"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// uninheritedFields are the AgentConfiguration fields an agent never takes from its template
+var uninheritedFields = map[string]bool{
+	"ID":        true,
+	"Name":      true,
+	"Template":  true,
+	"CreatedAt": true,
+	"UpdatedAt": true,
+}
+
+// Validate checks the template's own fields; the settings are validated once merged into an agent
+func (t *AgentTemplate) Validate() error {
+	if t.Name == "" {
+		return ValidationError("AgentTemplate Name cannot be empty")
+	}
+
+	if t.Settings.Template != "" {
+		return ValidationError("AgentTemplate settings cannot reference another template")
+	}
+
+	return nil
+}
+
+// Apply returns a copy of agent whose zero-valued fields are taken from the template. Maps are
+// merged key by key, the agent's entries winning; agent itself is not modified.
+func (t *AgentTemplate) Apply(agent *AgentConfiguration) *AgentConfiguration {
+	merged := *agent
+	target := reflect.ValueOf(&merged).Elem()
+	source := reflect.ValueOf(&t.Settings).Elem()
+
+	for i := 0; i < target.NumField(); i++ {
+		if uninheritedFields[target.Type().Field(i).Name] {
+			continue
+		}
+
+		field, inherited := target.Field(i), source.Field(i)
+		if field.Kind() == reflect.Map {
+			field.Set(mergeMaps(inherited, field))
+			continue
+		}
+		if field.IsZero() {
+			field.Set(inherited)
+		}
+	}
+
+	return &merged
+}
+
+// mergeMaps returns a new map holding the entries of base overridden by those of overrides, or
+// overrides itself when base is empty
+func mergeMaps(base, overrides reflect.Value) reflect.Value {
+	if base.Len() == 0 {
+		return overrides
+	}
+
+	merged := reflect.MakeMapWithSize(base.Type(), base.Len()+overrides.Len())
+	for _, m := range []reflect.Value{base, overrides} {
+		iter := m.MapRange()
+		for iter.Next() {
+			merged.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return merged
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Artifact is a file an agent left in its execution's artifacts directory
+type Artifact struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`         // Bytes
+	ContentType string    `json:"content_type"` // Sniffed from the content, or from the extension when the content is generic
+	SHA256      string    `json:"sha256"`       // Hex-encoded checksum of the content
+	ModifiedAt  time.Time `json:"modified_at"`
+}
+
+// RejectedArtifact is a file an agent left in its artifacts directory that was discarded
+type RejectedArtifact struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
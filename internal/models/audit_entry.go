@@ -0,0 +1,52 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Outcomes of an audited request
+const (
+	AuditOutcomeSuccess = "success" // The request succeeded with a 1xx, 2xx or 3xx status
+	AuditOutcomeFailure = "failure" // The request failed with a 4xx or 5xx status
+)
+
+// Authorization decisions of an audited request
+const (
+	AuditDecisionAllow = "allow" // The token grants the permission the route requires
+	AuditDecisionDeny  = "deny"  // The token lacks the permission; the request was rejected with 403
+)
+
+// AuditEntry records one mutating or denied API request. Entries form a hash chain: each holds the
+// hash of its predecessor and its own hash over its other fields, so edited or removed entries are
+// detected.
+type AuditEntry struct {
+	Sequence   int64     `json:"seq"`
+	Timestamp  time.Time `json:"timestamp"`
+	Actor      string    `json:"actor"` // Authenticated principal: token:<hash>, or ip:<address> without a token
+	SourceIP   string    `json:"source_ip"`
+	Action     string    `json:"action"`           // Operation, such as agents.create or tasks.delete
+	Target     string    `json:"target,omitempty"` // ID of the resource the request addressed
+	Summary    string    `json:"summary"`          // Method and URI of the request
+	RequestID  string    `json:"request_id,omitempty"`
+	Status     int       `json:"status"`
+	Outcome    string    `json:"outcome"`
+	Role       string    `json:"role,omitempty"`       // Role of the token, when auth is enabled and it has one
+	Permission string    `json:"permission,omitempty"` // Permission the route requires, when auth is enabled
+	Decision   string    `json:"decision,omitempty"`   // allow or deny, when auth is enabled
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+// ComputeHash returns the hash of the entry's fields other than Hash, which covers PrevHash
+func (e AuditEntry) ComputeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,72 @@
+package models
+
+// Permission is a class of REST API requests a token may be allowed to make
+type Permission string
+
+const (
+	PermissionRead    Permission = "read"    // GET requests: status, executions, logs, metrics and events
+	PermissionExecute Permission = "execute" // Run agents, pipelines and tasks
+	PermissionOperate Permission = "operate" // Enable, disable, start and restart agents, pause and resume tasks, stop and extend executions
+	PermissionManage  Permission = "manage"  // Create, update and delete agents, tasks, templates, groups and pipelines
+	PermissionAdmin   Permission = "admin"   // Import and export state, validate and update the configuration, read the audit log, inject faults
+)
+
+// Role names a built-in set of permissions
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// Roles lists the built-in roles from the least to the most privileged
+var Roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+// rolePermissions holds the permissions each built-in role grants
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:   {PermissionRead},
+	RoleOperator: {PermissionRead, PermissionExecute, PermissionOperate},
+	RoleAdmin:    {PermissionRead, PermissionExecute, PermissionOperate, PermissionManage, PermissionAdmin},
+}
+
+// IsValid reports whether the permission is a known one
+func (p Permission) IsValid() bool {
+	switch p {
+	case PermissionRead, PermissionExecute, PermissionOperate, PermissionManage, PermissionAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValid reports whether the role is a built-in one
+func (r Role) IsValid() bool {
+	_, exists := rolePermissions[r]
+	return exists
+}
+
+// Permissions returns the permissions the role grants, none for unknown roles
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
+
+// Grants reports whether the role grants permission
+func (r Role) Grants(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// MinimumRole returns the least privileged built-in role granting permission
+func MinimumRole(permission Permission) Role {
+	for _, role := range Roles {
+		if role.Grants(permission) {
+			return role
+		}
+	}
+	return RoleAdmin
+}
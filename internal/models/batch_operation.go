@@ -0,0 +1,67 @@
+package models
+
+import (
+	"path"
+)
+
+// TaskSelector picks the tasks of a bulk operation. AgentID and NamePattern may be combined, and a
+// task must then match both; TaskIDs names the tasks outright and cannot be combined with either.
+type TaskSelector struct {
+	AgentID     string   `json:"agent_id,omitempty"`
+	NamePattern string   `json:"name_pattern,omitempty"` // Glob over task names, such as nightly-*
+	TaskIDs     []string `json:"task_ids,omitempty"`
+}
+
+// Validate checks that the selector picks tasks in exactly one way and that its pattern is well formed
+func (s TaskSelector) Validate() error {
+	if len(s.TaskIDs) > 0 {
+		if s.AgentID != "" || s.NamePattern != "" {
+			return ValidationError("task_ids cannot be combined with agent_id or name_pattern")
+		}
+		return nil
+	}
+	if s.AgentID == "" && s.NamePattern == "" {
+		return ValidationError("selector needs agent_id, name_pattern or task_ids")
+	}
+	if _, err := path.Match(s.NamePattern, ""); err != nil {
+		return ValidationError("invalid name_pattern " + s.NamePattern + ": " + err.Error())
+	}
+	return nil
+}
+
+// Matches reports whether the agent and name pattern of the selector match task
+func (s TaskSelector) Matches(task *ScheduledTask) bool {
+	if s.AgentID != "" && task.AgentID != s.AgentID {
+		return false
+	}
+	if s.NamePattern != "" {
+		matched, _ := path.Match(s.NamePattern, task.Name)
+		return matched
+	}
+	return true
+}
+
+// BatchOperationResult reports the outcome of a bulk operation on each task it selected, in the
+// order they were processed. A failure on one task does not stop the others.
+type BatchOperationResult struct {
+	Action    TaskAction        `json:"action"`
+	DryRun    bool              `json:"dry_run,omitempty"`
+	Matched   int               `json:"matched"`
+	Succeeded int               `json:"succeeded"`
+	Skipped   int               `json:"skipped"`
+	Failed    int               `json:"failed"`
+	Results   []OperationResult `json:"results"`
+}
+
+// Add records the outcome of the operation on one task
+func (r *BatchOperationResult) Add(result OperationResult) {
+	switch result.Status {
+	case OperationApplied:
+		r.Succeeded++
+	case OperationSkipped:
+		r.Skipped++
+	case OperationFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CalendarDateLayout is the layout of the dates of a calendar, such as 2026-12-25
+const CalendarDateLayout = "2006-01-02"
+
+// DateRange is a day or a run of days excluded by a calendar, both ends included
+type DateRange struct {
+	Start  string `json:"start" yaml:"start"`                       // First excluded day, e.g. 2026-12-24
+	End    string `json:"end,omitempty" yaml:"end,omitempty"`       // Last excluded day; Start alone when empty
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"` // e.g. Christmas
+}
+
+// ParseDateRange parses a day such as 2026-12-25 or a range of days such as 2026-12-24..2026-12-26
+func ParseDateRange(text string) (DateRange, error) {
+	start, end, isRange := strings.Cut(strings.TrimSpace(text), "..")
+	dates := DateRange{Start: strings.TrimSpace(start)}
+	if isRange {
+		dates.End = strings.TrimSpace(end)
+	}
+	if err := dates.Validate(); err != nil {
+		return DateRange{}, err
+	}
+	return dates, nil
+}
+
+// UnmarshalJSON reads a range given as an object or as a string ParseDateRange reads
+func (r *DateRange) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		parsed, err := ParseDateRange(text)
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	}
+
+	type dateRange DateRange // Without this method
+	return json.Unmarshal(data, (*dateRange)(r))
+}
+
+// Validate checks that the range's days are dates and that it does not end before it starts
+func (r DateRange) Validate() error {
+	start, err := time.Parse(CalendarDateLayout, r.Start)
+	if err != nil {
+		return fmt.Errorf("invalid date %q: expected YYYY-MM-DD", r.Start)
+	}
+	if r.End == "" {
+		return nil
+	}
+	end, err := time.Parse(CalendarDateLayout, r.End)
+	if err != nil {
+		return fmt.Errorf("invalid date %q: expected YYYY-MM-DD", r.End)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("date range %s..%s ends before it starts", r.Start, r.End)
+	}
+	return nil
+}
+
+// Contains reports whether the range includes a day given as YYYY-MM-DD
+func (r DateRange) Contains(day string) bool {
+	end := r.End
+	if end == "" {
+		end = r.Start
+	}
+	// Dates in the layout sort as strings do
+	return r.Start <= day && day <= end
+}
+
+// String renders the range as ParseDateRange reads it
+func (r DateRange) String() string {
+	if r.End == "" || r.End == r.Start {
+		return r.Start
+	}
+	return r.Start + ".." + r.End
+}
+
+// Calendar is a named list of days on which the scheduled tasks skipping it do not run, such as
+// exchange holidays
+type Calendar struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Dates       []DateRange `json:"dates"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// Validate checks the calendar's name and dates, returning every problem found as ValidationErrors
+func (c *Calendar) Validate() error {
+	errs := ValidationErrors{}
+
+	if c.Name == "" {
+		errs.Add("name", ValidationRequired, "Calendar Name cannot be empty")
+	} else if strings.ContainsAny(c.Name, ":/") {
+		errs.Add("name", ValidationInvalid, "Calendar Name cannot contain ':' or '/'")
+	}
+
+	for i, dates := range c.Dates {
+		if err := dates.Validate(); err != nil {
+			errs.AddError(fmt.Sprintf("dates[%d]", i), ValidationInvalid, err)
+		}
+	}
+
+	return errs.Err()
+}
+
+// Excludes returns the range of the calendar containing the day of t, in t's time zone
+func (c *Calendar) Excludes(t time.Time) (DateRange, bool) {
+	day := t.Format(CalendarDateLayout)
+	for _, dates := range c.Dates {
+		if dates.Contains(day) {
+			return dates, true
+		}
+	}
+	return DateRange{}, false
+}
+
+// CalendarExclusion tells why a fire time of a task is excluded
+type CalendarExclusion struct {
+	Calendar string `json:"calendar"`
+	Date     string `json:"date"` // Excluded day of the fire time, in the task's time zone
+	Reason   string `json:"reason,omitempty"`
+}
+
+// String describes the exclusion, e.g. 2026-12-25 is excluded by calendar exchange-holidays (Christmas)
+func (e CalendarExclusion) String() string {
+	text := fmt.Sprintf("%s is excluded by calendar %s", e.Date, e.Calendar)
+	if e.Reason != "" {
+		text += " (" + e.Reason + ")"
+	}
+	return text
+}
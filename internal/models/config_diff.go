@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// ConfigChangeType describes how an agent or task differs between the applied and on-disk config
+type ConfigChangeType string
+
+const (
+	ConfigAdded   ConfigChangeType = "added"
+	ConfigChanged ConfigChangeType = "changed"
+	ConfigRemoved ConfigChangeType = "removed"
+)
+
+// ConfigChange is a single agent or task that differs from the applied configuration
+type ConfigChange struct {
+	Scope  string           `json:"scope"` // agent or task
+	ID     string           `json:"id"`
+	Change ConfigChangeType `json:"change"`
+	Fields []string         `json:"fields,omitempty"` // Changed config keys, for changed items only
+}
+
+// ConfigDiff lists what would change if the on-disk configuration were applied
+type ConfigDiff struct {
+	ConfigFile string         `json:"config_file"`
+	Changes    []ConfigChange `json:"changes"`
+	ReadAt     time.Time      `json:"read_at"`
+}
+
+// HasChanges reports whether applying the diff would change anything
+func (d *ConfigDiff) HasChanges() bool {
+	return len(d.Changes) > 0
+}
+
+// Outcomes of applying a single ConfigChange
+const (
+	ConfigUpdateApplied   = "applied"
+	ConfigUpdateRestarted = "restarted"
+	ConfigUpdateSkipped   = "skipped"
+	ConfigUpdateFailed    = "failed"
+)
+
+// ConfigUpdateItem is the result of applying one ConfigChange
+type ConfigUpdateItem struct {
+	ConfigChange
+	Status  string `json:"status"` // applied, restarted, skipped or failed
+	Message string `json:"message,omitempty"`
+}
+
+// ConfigUpdateResult is the per-item result of applying a ConfigDiff
+type ConfigUpdateResult struct {
+	ConfigFile string             `json:"config_file"`
+	Results    []ConfigUpdateItem `json:"results"`
+	AppliedAt  time.Time          `json:"applied_at"`
+}
+
+// Succeeded reports whether no item failed
+func (r *ConfigUpdateResult) Succeeded() bool {
+	for _, item := range r.Results {
+		if item.Status == ConfigUpdateFailed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ConfigIssue describes a single problem found while validating the running configuration
+type ConfigIssue struct {
+	Scope   string `json:"scope"`           // supervisor, a2a, agent or task
+	ID      string `json:"id,omitempty"`    // Agent or task ID the issue belongs to
+	Field   string `json:"field,omitempty"` // Offending field, when known
+	Message string `json:"message"`
+}
+
+// ConfigValidation is the structured result of validating the supervisor, A2A, agent and task configuration
+type ConfigValidation struct {
+	Valid       bool          `json:"valid"`
+	Errors      []ConfigIssue `json:"errors"`
+	Warnings    []ConfigIssue `json:"warnings"`
+	ValidatedAt time.Time     `json:"validated_at"`
+}
+
+// NewConfigValidation creates an empty, valid result
+func NewConfigValidation() *ConfigValidation {
+	return &ConfigValidation{
+		Valid:       true,
+		Errors:      []ConfigIssue{},
+		Warnings:    []ConfigIssue{},
+		ValidatedAt: time.Now(),
+	}
+}
+
+// AddError records an error and marks the result invalid
+func (cv *ConfigValidation) AddError(scope, id, field, message string) {
+	cv.Errors = append(cv.Errors, ConfigIssue{Scope: scope, ID: id, Field: field, Message: message})
+	cv.Valid = false
+}
+
+// AddWarning records a warning; warnings do not affect validity
+func (cv *ConfigValidation) AddWarning(scope, id, field, message string) {
+	cv.Warnings = append(cv.Warnings, ConfigIssue{Scope: scope, ID: id, Field: field, Message: message})
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// ConversationHistoryParameter is the parameter JSON-RPC-pattern agents receive the prior exchanges
+// of their A2A conversation in
+const ConversationHistoryParameter = "conversation_history"
+
+// ConversationExchange is one message of an A2A conversation and the reply of the agent it ran
+type ConversationExchange struct {
+	MessageID   string           `json:"message_id,omitempty"`
+	AgentID     string           `json:"agent_id"`
+	ExecutionID string           `json:"execution_id"`
+	Input       string           `json:"input"` // Sanitized like the execution's input
+	Output      string           `json:"output,omitempty"`
+	State       types.AgentState `json:"state"` // The execution's state when the reply was sent; queued when it had not run yet
+	Timestamp   time.Time        `json:"timestamp"`
+}
+
+// size is how many bytes the exchange's input and output take
+func (e ConversationExchange) size() int {
+	return len(e.Input) + len(e.Output)
+}
+
+// Conversation is the ordered thread of messages sharing an A2A conversation ID
+type Conversation struct {
+	ID        string                 `json:"id"`
+	Exchanges []ConversationExchange `json:"exchanges"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	ExpiresAt time.Time              `json:"expires_at"` // When it is pruned unless another message arrives
+}
+
+// ExecutionIDs returns the IDs of the executions the conversation's messages ran, in order
+func (c *Conversation) ExecutionIDs() []string {
+	ids := make([]string, 0, len(c.Exchanges))
+	for _, exchange := range c.Exchanges {
+		ids = append(ids, exchange.ExecutionID)
+	}
+	return ids
+}
+
+// History returns the latest exchanges of the conversation, at most maxMessages of them taking at
+// most maxBytes together; a limit of 0 leaves that bound out
+func (c *Conversation) History(maxMessages, maxBytes int) []ConversationExchange {
+	start, size := len(c.Exchanges), 0
+	for start > 0 {
+		exchange := c.Exchanges[start-1]
+		if maxMessages > 0 && len(c.Exchanges)-start >= maxMessages {
+			break
+		}
+		if maxBytes > 0 && size+exchange.size() > maxBytes {
+			break
+		}
+		size += exchange.size()
+		start--
+	}
+	return append([]ConversationExchange(nil), c.Exchanges[start:]...)
+}
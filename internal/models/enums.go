@@ -9,6 +9,8 @@ const (
 	TaskMode = "task"
 	// InteractiveMode represents persistent session allowing multiple exchanges, suitable for ongoing conversations
 	InteractiveMode = "interactive"
+	// PersistentMode represents a long-lived JSON-RPC process serving every execution over its stdin
+	PersistentMode = "persistent"
 )
 
 // Constants for access types
@@ -39,12 +41,16 @@ const (
 	FilePatternOut = "file"
 	// JsonRpcPatternOut agent returns output via JSON-RPC over stdin/stdout
 	JsonRpcPatternOut = "json-rpc"
+	// JsonPatternOut agent prints a JSON document on stdout, from which OutputSelector picks the output
+	JsonPatternOut = "json"
 )
 
 // Constants for execution statuses
 const (
 	// SuccessStatus execution completed successfully
 	SuccessStatus = "success"
+	// WarningStatus execution completed, but its agent exited with a code mapped to a warning
+	WarningStatus = "warning"
 	// FailureStatus execution failed due to an error
 	FailureStatus = "failure"
 	// TimeoutStatus execution exceeded timeout limit
@@ -57,6 +63,8 @@ const (
 const (
 	// IdleState agent is not currently executing
 	IdleState = "idle"
+	// QueuedState execution is waiting behind another execution of its agent
+	QueuedState = "queued"
 	// StartingState agent is being initialized for execution
 	StartingState = "starting"
 	// RunningState agent is currently executing
@@ -83,6 +91,10 @@ const (
 	AgentError = "agent_error"
 	// SystemError errors from the algonius-supervisor system
 	SystemError = "system_error"
+	// ResourceLimitError the agent exceeded its memory or CPU time limit
+	ResourceLimitError = "resource_limit"
+	// HungError the watchdog stopped an agent that went silent for longer than max_silence_seconds
+	HungError = "hung"
 )
 
 // A2AProtocolVersion represents the version of the A2A protocol
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors the services wrap so callers can classify failures with errors.Is
+var (
+	ErrAgentNotFound          = errors.New("agent not found")
+	ErrAgentConflict          = errors.New("agent already exists")
+	ErrAgentDisabled          = errors.New("agent is disabled")
+	ErrAgentDeleted           = errors.New("agent is deleted")
+	ErrAgentInUse             = errors.New("agent is referenced by scheduled tasks")
+	ErrInvalidAgent           = errors.New("invalid agent configuration")
+	ErrTemplateNotFound       = errors.New("agent template not found")
+	ErrTemplateConflict       = errors.New("agent template already exists")
+	ErrTemplateInUse          = errors.New("agent template is in use")
+	ErrGroupNotFound          = errors.New("agent group not found")
+	ErrGroupConflict          = errors.New("agent group already exists")
+	ErrTaskNotFound           = errors.New("task not found")
+	ErrTaskConflict           = errors.New("task conflicts with its current state")
+	ErrInvalidTask            = errors.New("invalid task configuration")
+	ErrExecutionNotFound      = errors.New("execution not found")
+	ErrExecutionConflict      = errors.New("execution conflicts with its current state")
+	ErrArtifactNotFound       = errors.New("artifact not found")
+	ErrExecutionQuotaExceeded = errors.New("concurrent execution quota exceeded")
+	ErrResourceLimitExceeded  = errors.New("resource limit exceeded")
+	ErrAgentHung              = errors.New("agent hung")
+	ErrPipelineNotFound       = errors.New("pipeline not found")
+	ErrPipelineConflict       = errors.New("pipeline already exists")
+	ErrOperationInProgress    = errors.New("another lifecycle operation is in progress")
+	ErrInvalidTransition      = errors.New("invalid state transition")
+	ErrConfirmationRequired   = errors.New("operation needs confirming")
+	ErrInvalidInput           = errors.New("parameters do not match the agent's input schema")
+	ErrFaultRuleNotFound      = errors.New("fault rule not found")
+	ErrCalendarNotFound       = errors.New("calendar not found")
+	ErrCalendarConflict       = errors.New("calendar already exists")
+	ErrCalendarInUse          = errors.New("calendar is referenced by scheduled tasks")
+	ErrAttachConflict         = errors.New("agent already has an attach session")
+	ErrHookFailed             = errors.New("lifecycle hook failed")
+	ErrSchedulerStopped       = errors.New("scheduler stopped")
+	ErrConversationNotFound   = errors.New("conversation not found")
+	ErrInputURLNotAllowed     = errors.New("input URL not allowed")
+	ErrInputFetchFailed       = errors.New("fetching input failed")
+)
+
+// KindError is an error with its own message that matches one of the sentinel errors above
+type KindError struct {
+	Kind    error
+	Message string
+}
+
+// NewKindError creates an error of the given kind with a formatted message
+func NewKindError(kind error, format string, args ...interface{}) error {
+	return &KindError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *KindError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel error, so errors.Is(err, e.Kind) holds
+func (e *KindError) Unwrap() error {
+	return e.Kind
+}
+
+// AgentInUseError refuses to delete an agent that scheduled tasks still run
+type AgentInUseError struct {
+	AgentID string
+	TaskIDs []string
+}
+
+func (e *AgentInUseError) Error() string {
+	return fmt.Sprintf("agent %s is referenced by scheduled tasks %s; delete with force to pause them",
+		e.AgentID, strings.Join(e.TaskIDs, ", "))
+}
+
+// Unwrap returns ErrAgentInUse, so errors.Is(err, ErrAgentInUse) holds
+func (e *AgentInUseError) Unwrap() error {
+	return ErrAgentInUse
+}
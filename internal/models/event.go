@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Types of the events published on the event bus
+const (
+	EventExecutionState     = "execution.state"     // An execution entered a new state; Data is an ExecutionStateEvent
+	EventTaskRun            = "task.run"            // A scheduled task run finished; Data is its ExecutionHistory
+	EventTaskMissedFire     = "task.missed_fire"    // A planned fire of a task's schedule did not happen in time; Data is a MissedFire
+	EventProcessState       = ProcessStateEventType // A persistent agent process is backing off or fatal; Data is its ProcessStatus
+	EventWebhookDelivery    = "webhook.delivery"    // A push notification was delivered or gave up; Data is its PushNotificationDelivery
+	EventExecutionHung      = "execution.hung"      // The watchdog stopped a silent agent; Data is an ExecutionHung
+	EventExecutionAnomaly   = "execution.anomaly"   // A finished execution was flagged with a new anomaly; Data is an ExecutionAnomaly
+	EventExecutionProgress  = "execution.progress"  // A running execution's agent reported progress; Data is an ExecutionProgress
+	EventEventsDropped      = "events.dropped"      // The subscriber fell behind and missed events; Data is an EventsDropped
+	EventEventsDisconnected = "events.disconnected" // The subscriber fell too far behind and was disconnected; Data is an EventsDropped
+)
+
+// Event is something that happened in the supervisor, as delivered to event bus subscribers
+type Event struct {
+	ID          uint64      `json:"id"` // Increases with every published event; 0 for notices about the subscription
+	Type        string      `json:"type"`
+	Time        time.Time   `json:"time"`
+	AgentID     string      `json:"agent_id,omitempty"`
+	ExecutionID string      `json:"execution_id,omitempty"`
+	TaskID      string      `json:"task_id,omitempty"`
+	Data        interface{} `json:"data,omitempty"`
+}
+
+// ExecutionStateEvent is the data of an execution.state event
+type ExecutionStateEvent struct {
+	State       string `json:"state"`
+	Error       string `json:"error,omitempty"`
+	TriggerType string `json:"trigger_type,omitempty"`
+}
+
+// EventsDropped tells a subscriber how many events it missed since the previous notice, so it can
+// resync through the REST query APIs
+type EventsDropped struct {
+	DroppedCount uint64 `json:"dropped_count"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// EventSubscriberStats counts the events of the subscribers of one type, e.g. sse
+type EventSubscriberStats struct {
+	Subscribers  int    `json:"subscribers"`  // Currently subscribed
+	Delivered    uint64 `json:"delivered"`    // Events read by subscribers
+	Dropped      uint64 `json:"dropped"`      // Events subscribers missed because they fell behind
+	Disconnected uint64 `json:"disconnected"` // Subscribers disconnected for falling too far behind
+}
+
+// EventSubscriptionStats describes one current subscription
+type EventSubscriptionStats struct {
+	ID             uint64 `json:"id"`
+	SubscriberType string `json:"subscriber_type"`
+	Buffered       int    `json:"buffered"` // Events waiting to be read
+	Capacity       int    `json:"capacity"` // Size of the subscription's buffer
+	Lag            uint64 `json:"lag"`      // Buffered events plus events dropped since the last notice
+	Delivered      uint64 `json:"delivered"`
+	Dropped        uint64 `json:"dropped"`
+}
+
+// EventBusStats reports the traffic of the event bus
+type EventBusStats struct {
+	Published       uint64                          `json:"published"`
+	SubscriberTypes map[string]EventSubscriberStats `json:"subscriber_types"`
+	Subscriptions   []EventSubscriptionStats        `json:"subscriptions"`
+}
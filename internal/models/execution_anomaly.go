@@ -0,0 +1,24 @@
+package models
+
+// Anomalies flagged on executions that behave unlike the recent executions of their agent or task
+const (
+	AnomalyDurationHigh    = "duration_high"     // The execution ran far longer than the recent ones
+	AnomalyFailureRateHigh = "failure_rate_high" // The execution failed while most recent ones failed too
+)
+
+// Baselines an anomaly is found against
+const (
+	AnomalyScopeAgent = "agent" // The recent executions of the execution's agent
+	AnomalyScopeTask  = "task"  // The recent executions of the scheduled task that started it
+)
+
+// ExecutionAnomaly is the Data of an EventExecutionAnomaly event
+type ExecutionAnomaly struct {
+	Anomaly          string  `json:"anomaly"`
+	Scope            string  `json:"scope"`
+	ExecutionTimeMs  int64   `json:"execution_time_ms"`
+	BaselineMeanMs   float64 `json:"baseline_mean_ms"`
+	BaselineStdDevMs float64 `json:"baseline_stddev_ms"`
+	FailureRate      float64 `json:"failure_rate"` // Share of the baseline's executions that failed
+	Samples          int     `json:"samples"`      // Executions in the baseline
+}
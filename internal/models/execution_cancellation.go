@@ -0,0 +1,47 @@
+package models
+
+import "github.com/algonius/algonius-supervisor/pkg/types"
+
+// CancellationOutcome is what a cascading cancellation did to one execution
+type CancellationOutcome string
+
+const (
+	CancellationCancelled       CancellationOutcome = "cancelled"        // The execution was cancelled; a queued one never runs
+	CancellationAlreadyTerminal CancellationOutcome = "already_terminal" // It finished before it could be cancelled
+	CancellationNotCancellable  CancellationOutcome = "not_cancellable"  // Its state does not allow cancelling it
+)
+
+// ExecutionCancellation is the outcome of a cascading cancellation on one execution
+type ExecutionCancellation struct {
+	ExecutionID   string              `json:"execution_id"`
+	AgentID       string              `json:"agent_id"`
+	PreviousState types.AgentState    `json:"previous_state"` // State the execution was in when it was enumerated
+	Outcome       CancellationOutcome `json:"outcome"`
+	Message       string              `json:"message,omitempty"`
+}
+
+// CancelAllResult reports the outcome of cancelling every unfinished execution of an agent or a
+// task, in the order the executions started. A failure on one does not stop the others.
+type CancelAllResult struct {
+	AgentID         string                  `json:"agent_id,omitempty"`
+	TaskID          string                  `json:"task_id,omitempty"`
+	Matched         int                     `json:"matched"`
+	Cancelled       int                     `json:"cancelled"`
+	AlreadyTerminal int                     `json:"already_terminal"`
+	NotCancellable  int                     `json:"not_cancellable"`
+	Results         []ExecutionCancellation `json:"results"`
+}
+
+// Add records the outcome of the cancellation on one execution
+func (r *CancelAllResult) Add(cancellation ExecutionCancellation) {
+	r.Matched++
+	switch cancellation.Outcome {
+	case CancellationCancelled:
+		r.Cancelled++
+	case CancellationAlreadyTerminal:
+		r.AlreadyTerminal++
+	case CancellationNotCancellable:
+		r.NotCancellable++
+	}
+	r.Results = append(r.Results, cancellation)
+}
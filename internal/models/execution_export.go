@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// Formats of GET /api/v1/executions/export
+const (
+	ExportFormatJSONL = "jsonl" // One JSON object per line
+	ExportFormatCSV   = "csv"   // A header row, then one row per execution
+)
+
+// ExportLabelColumnPrefix prefixes the CSV columns of exported labels: the team label is exported as
+// label_team
+const ExportLabelColumnPrefix = "label_"
+
+// ExecutionExportColumns are the CSV columns of an exported execution, before its label columns
+var ExecutionExportColumns = []string{
+	"id", "agent_id", "state", "trigger_type", "start_time", "end_time",
+	"duration_ms", "retry_count", "error_category", "exit_code", "error",
+}
+
+// ExecutionExportRecord is an execution flattened for offline analysis, as the export streams it
+type ExecutionExportRecord struct {
+	ID            string                `json:"id"`
+	AgentID       string                `json:"agent_id"`
+	State         types.AgentState      `json:"state"`
+	TriggerType   types.TaskTriggerType `json:"trigger_type,omitempty"`
+	StartTime     time.Time             `json:"start_time"`
+	EndTime       *time.Time            `json:"end_time,omitempty"`    // nil while running
+	DurationMs    *int64                `json:"duration_ms,omitempty"` // nil while running
+	RetryCount    int                   `json:"retry_count"`
+	ErrorCategory types.ErrorCategory   `json:"error_category,omitempty"`
+	ExitCode      int                   `json:"exit_code"`
+	Error         string                `json:"error,omitempty"`
+	Labels        map[string]string     `json:"labels,omitempty"` // Only the exported label keys
+}
+
+// NewExecutionExportRecord flattens an execution, keeping the labels whose keys are in labelKeys
+func NewExecutionExportRecord(execution *AgentExecution, labelKeys []string) ExecutionExportRecord {
+	record := ExecutionExportRecord{
+		ID:            execution.ID,
+		AgentID:       execution.AgentID,
+		State:         execution.State,
+		TriggerType:   execution.TriggerType,
+		StartTime:     execution.StartTime,
+		EndTime:       execution.EndTime,
+		RetryCount:    execution.RetryCount,
+		ErrorCategory: execution.ErrorCategory,
+		ExitCode:      execution.ExitCode,
+		Error:         execution.ErrorMessage,
+	}
+	if execution.EndTime != nil {
+		duration := execution.EndTime.Sub(execution.StartTime).Milliseconds()
+		record.DurationMs = &duration
+	}
+	for _, key := range labelKeys {
+		if value, ok := execution.Labels[key]; ok {
+			if record.Labels == nil {
+				record.Labels = make(map[string]string)
+			}
+			record.Labels[key] = value
+		}
+	}
+	return record
+}
+
+// ExportColumns returns the CSV header of an export with the label keys
+func ExportColumns(labelKeys []string) []string {
+	columns := append([]string{}, ExecutionExportColumns...)
+	for _, key := range labelKeys {
+		columns = append(columns, ExportLabelColumnPrefix+key)
+	}
+	return columns
+}
+
+// CSVRow returns the record's cells in the order of ExportColumns; times are RFC 3339 in UTC and
+// the cells of a running execution's end and duration are empty
+func (r ExecutionExportRecord) CSVRow(labelKeys []string) []string {
+	var endTime, duration string
+	if r.EndTime != nil {
+		endTime = r.EndTime.UTC().Format(time.RFC3339Nano)
+	}
+	if r.DurationMs != nil {
+		duration = strconv.FormatInt(*r.DurationMs, 10)
+	}
+	row := []string{
+		r.ID, r.AgentID, string(r.State), string(r.TriggerType), r.StartTime.UTC().Format(time.RFC3339Nano), endTime,
+		duration, strconv.Itoa(r.RetryCount), string(r.ErrorCategory), strconv.Itoa(r.ExitCode), r.Error,
+	}
+	for _, key := range labelKeys {
+		row = append(row, r.Labels[key])
+	}
+	return row
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"math"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/algonius/algonius-supervisor/pkg/types"
@@ -12,15 +14,23 @@ type ExecutionHistory struct {
 	ID               string                    `json:"id" yaml:"id"`
 	TaskID           string                    `json:"task_id" yaml:"task_id"`
 	ExecutionID      string                    `json:"execution_id" yaml:"execution_id"`
+	AgentID          string                    `json:"agent_id,omitempty" yaml:"agent_id,omitempty"` // Agent of a fan-out task's child entry
+	ParentID         string                    `json:"parent_id,omitempty" yaml:"parent_id,omitempty"` // Entry of the fan-out run a child entry belongs to
 	StartTime        time.Time                 `json:"start_time" yaml:"start_time"`
 	EndTime          time.Time                 `json:"end_time" yaml:"end_time"`
 	Status           types.ExecutionStatus     `json:"status" yaml:"status"`
 	Input            string                    `json:"input" yaml:"input"`
 	Output           string                    `json:"output" yaml:"output"`
 	Error            string                    `json:"error,omitempty" yaml:"error,omitempty"`
+	SkipReason       string                    `json:"skip_reason,omitempty" yaml:"skip_reason,omitempty"` // Why a skipped run did not start: overlap, agent_disabled, maintenance or calendar
 	ExecutionTimeMs  int64                     `json:"execution_time_ms" yaml:"execution_time_ms"`
 	RetryCount       int                       `json:"retry_count" yaml:"retry_count"`
+	FanOut           *FanOutResult             `json:"fan_out,omitempty" yaml:"fan_out,omitempty"` // Per-agent outcome of a fan-out run's parent entry
 	TriggerType      types.TaskTriggerType     `json:"trigger_type" yaml:"trigger_type"` // scheduled, manual, api, event
+	TriggeredBy      string                    `json:"triggered_by,omitempty" yaml:"triggered_by,omitempty"` // Client identity of the caller, or scheduler:<task id>
+	PlannedTime      *time.Time                `json:"planned_time,omitempty" yaml:"planned_time,omitempty"` // When the cron schedule planned the fire that started a scheduled run
+	DriftMs          int64                     `json:"drift_ms,omitempty" yaml:"drift_ms,omitempty"` // How long after PlannedTime the fire ran
+	Labels           map[string]string         `json:"labels,omitempty" yaml:"labels,omitempty"`
 	CreatedAt        time.Time                 `json:"created_at" yaml:"created_at"`
 }
 
@@ -94,11 +104,15 @@ type ExecutionHistoryRepository interface {
 	
 	// DeleteExecutionHistory deletes execution history records for a task
 	DeleteExecutionHistory(taskID string) error
+
+	// DeleteExecutionHistoryBefore deletes records that started before the cutoff and returns how many were removed
+	DeleteExecutionHistoryBefore(cutoff time.Time) (int, error)
 }
 
 // InMemoryExecutionHistoryRepository is an in-memory implementation of ExecutionHistoryRepository
 type InMemoryExecutionHistoryRepository struct {
 	histories map[string][]*ExecutionHistory
+	mutex     sync.RWMutex
 }
 
 // NewInMemoryExecutionHistoryRepository creates a new in-memory history repository
@@ -110,6 +124,9 @@ func NewInMemoryExecutionHistoryRepository() *InMemoryExecutionHistoryRepository
 
 // StoreExecutionHistory stores an execution history record
 func (r *InMemoryExecutionHistoryRepository) StoreExecutionHistory(history *ExecutionHistory) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	if err := history.Validate(); err != nil {
 		return err
 	}
@@ -120,6 +137,9 @@ func (r *InMemoryExecutionHistoryRepository) StoreExecutionHistory(history *Exec
 
 // GetExecutionHistory retrieves execution history for a specific task
 func (r *InMemoryExecutionHistoryRepository) GetExecutionHistory(taskID string, limit int) ([]*ExecutionHistory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	histories, exists := r.histories[taskID]
 	if !exists {
 		return []*ExecutionHistory{}, nil
@@ -144,6 +164,9 @@ func (r *InMemoryExecutionHistoryRepository) GetExecutionHistory(taskID string,
 
 // GetExecutionHistoryByTaskAndStatus retrieves execution history for a task with a specific status
 func (r *InMemoryExecutionHistoryRepository) GetExecutionHistoryByTaskAndStatus(taskID string, status types.ExecutionStatus, limit int) ([]*ExecutionHistory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	histories, exists := r.histories[taskID]
 	if !exists {
 		return []*ExecutionHistory{}, nil
@@ -175,6 +198,9 @@ func (r *InMemoryExecutionHistoryRepository) GetExecutionHistoryByTaskAndStatus(
 
 // GetExecutionHistoryByTimeRange retrieves execution history within a time range
 func (r *InMemoryExecutionHistoryRepository) GetExecutionHistoryByTimeRange(start, end time.Time, limit int) ([]*ExecutionHistory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	var filteredHistories []*ExecutionHistory
 	
 	for _, histories := range r.histories {
@@ -205,6 +231,9 @@ func (r *InMemoryExecutionHistoryRepository) GetExecutionHistoryByTimeRange(star
 
 // GetLatestExecutionHistory retrieves the most recent execution history for a task
 func (r *InMemoryExecutionHistoryRepository) GetLatestExecutionHistory(taskID string) (*ExecutionHistory, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
 	histories, exists := r.histories[taskID]
 	if !exists || len(histories) == 0 {
 		return nil, nil
@@ -223,10 +252,38 @@ func (r *InMemoryExecutionHistoryRepository) GetLatestExecutionHistory(taskID st
 
 // DeleteExecutionHistory deletes execution history records for a task
 func (r *InMemoryExecutionHistoryRepository) DeleteExecutionHistory(taskID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	delete(r.histories, taskID)
 	return nil
 }
 
+// DeleteExecutionHistoryBefore deletes records that started before the cutoff
+func (r *InMemoryExecutionHistoryRepository) DeleteExecutionHistoryBefore(cutoff time.Time) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deleted := 0
+	for taskID, histories := range r.histories {
+		kept := histories[:0]
+		for _, history := range histories {
+			if history.StartTime.Before(cutoff) {
+				deleted++
+				continue
+			}
+			kept = append(kept, history)
+		}
+		if len(kept) == 0 {
+			delete(r.histories, taskID)
+		} else {
+			r.histories[taskID] = kept
+		}
+	}
+
+	return deleted, nil
+}
+
 // Additional utility functions for working with execution history
 
 // ExecutionStats provides statistics about task execution
@@ -234,8 +291,11 @@ type ExecutionStats struct {
 	TaskID          string          `json:"task_id"`
 	TotalExecutions int             `json:"total_executions"`
 	Successful      int             `json:"successful"`
+	Warnings        int             `json:"warnings"` // Succeeded, but exited with a code mapped to warning
 	Failed          int             `json:"failed"`
 	AverageTimeMs   float64         `json:"average_time_ms"`
+	StdDevTimeMs    float64         `json:"stddev_time_ms"`
+	FailureRate     float64         `json:"failure_rate"` // Share of the executions that did not succeed
 	LastExecution   *ExecutionHistory `json:"last_execution"`
 }
 
@@ -255,9 +315,12 @@ func CalculateExecutionStats(histories []*ExecutionHistory) *ExecutionStats {
 	var latest *ExecutionHistory
 
 	for _, history := range histories {
-		if history.Status == types.SuccessStatus {
+		switch history.Status {
+		case types.SuccessStatus:
 			stats.Successful++
-		} else {
+		case types.WarningStatus:
+			stats.Warnings++
+		default:
 			stats.Failed++
 		}
 
@@ -273,6 +336,14 @@ func CalculateExecutionStats(histories []*ExecutionHistory) *ExecutionStats {
 
 	if stats.TotalExecutions > 0 {
 		stats.AverageTimeMs = float64(totalTime) / float64(stats.TotalExecutions)
+		stats.FailureRate = float64(stats.Failed) / float64(stats.TotalExecutions)
+
+		var squares float64
+		for _, history := range histories {
+			deviation := float64(history.ExecutionTimeMs) - stats.AverageTimeMs
+			squares += deviation * deviation
+		}
+		stats.StdDevTimeMs = math.Sqrt(squares / float64(stats.TotalExecutions))
 	}
 
 	return stats
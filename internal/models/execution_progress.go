@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ExecutionProgress is how far a running execution's agent says it has come, as it last reported
+// on stderr with a progress marker such as @@progress {"percent": 42, "message": "indexing"}
+type ExecutionProgress struct {
+	Percent   float64   `json:"percent"` // 0 to 100
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DefaultOutputDiffLimit bounds the size of the output diff of an ExecutionDiff, in bytes
+const DefaultOutputDiffLimit = 64 * 1024
+
+// ExecutionInputs is what an execution ran with, kept so it can be replayed. Parameters, Env,
+// WorkingDir and TimeoutSeconds are the overrides the caller asked for, empty when the execution
+// used the agent's own settings.
+type ExecutionInputs struct {
+	Input          string                 `json:"-"` // Unsanitized; AgentExecution.Input holds the sanitized copy
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	Env            map[string]string      `json:"-"`                  // Values may be secrets
+	EnvKeys        []string               `json:"env_keys,omitempty"` // Sorted names of the Env overrides
+	WorkingDir     string                 `json:"working_dir,omitempty"`
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"`
+	OutputEncoding OutputEncoding         `json:"output_encoding,omitempty"`
+	Content        *InputContent          `json:"content,omitempty"` // The binary input handed to the agent as a file, if any
+}
+
+// Sources of binary execution input
+const (
+	InputContentInline = "inline" // Sent base64-encoded in the request
+	InputContentURL    = "url"    // Fetched from input_url
+)
+
+// InputContent describes the binary input an execution was handed as a file. The content itself is
+// never kept; its file is removed once the execution finishes.
+type InputContent struct {
+	Source      string `json:"source"`        // inline or url
+	URL         string `json:"url,omitempty"` // The fetched URL, without credentials, query or fragment
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"` // Hex-encoded checksum of the content
+}
+
+// SetEnv sets the environment overrides and their listed names
+func (in *ExecutionInputs) SetEnv(env map[string]string) {
+	in.Env = env
+	in.EnvKeys = nil
+	for name := range env {
+		in.EnvKeys = append(in.EnvKeys, name)
+	}
+	sort.Strings(in.EnvKeys)
+}
+
+// ExecutionDiff compares a finished execution with another, typically its replay. Other* fields
+// describe the other execution.
+type ExecutionDiff struct {
+	ExecutionID         string   `json:"execution_id"`
+	OtherID             string   `json:"other_id"`
+	State               string   `json:"state"`
+	OtherState          string   `json:"other_state"`
+	Status              string   `json:"status,omitempty"` // Result status, empty when the execution left no result
+	OtherStatus         string   `json:"other_status,omitempty"`
+	ExitCode            int      `json:"exit_code"`
+	OtherExitCode       int      `json:"other_exit_code"`
+	DurationMs          int64    `json:"duration_ms"`
+	OtherDurationMs     int64    `json:"other_duration_ms"`
+	DurationDeltaMs     int64    `json:"duration_delta_ms"` // The other execution's duration minus this one's
+	Changed             []string `json:"changed"`           // Compared fields that differ, such as status, output or input
+	OutputDiff          string   `json:"output_diff,omitempty"`
+	OutputDiffTruncated bool     `json:"output_diff_truncated,omitempty"`
+}
+
+// DiffExecutions compares two finished executions and their results, which may be nil. The output
+// diff is a unified diff cut at limit bytes, DefaultOutputDiffLimit when limit is not positive.
+func DiffExecutions(execution, other *AgentExecution, result, otherResult *ExecutionResult, limit int) *ExecutionDiff {
+	if limit <= 0 {
+		limit = DefaultOutputDiffLimit
+	}
+
+	diff := &ExecutionDiff{
+		ExecutionID:     execution.ID,
+		OtherID:         other.ID,
+		State:           string(execution.State),
+		OtherState:      string(other.State),
+		ExitCode:        execution.ExitCode,
+		OtherExitCode:   other.ExitCode,
+		DurationMs:      executionDuration(execution),
+		OtherDurationMs: executionDuration(other),
+		Changed:         []string{},
+	}
+	diff.DurationDeltaMs = diff.OtherDurationMs - diff.DurationMs
+
+	output, otherOutput := "", ""
+	if result != nil {
+		diff.Status = string(result.Status)
+		output = result.Output
+	}
+	if otherResult != nil {
+		diff.OtherStatus = string(otherResult.Status)
+		otherOutput = otherResult.Output
+	}
+
+	changed := func(field string, differs bool) {
+		if differs {
+			diff.Changed = append(diff.Changed, field)
+		}
+	}
+	changed("agent_id", execution.AgentID != other.AgentID)
+	changed("state", diff.State != diff.OtherState)
+	changed("status", diff.Status != diff.OtherStatus)
+	changed("exit_code", diff.ExitCode != diff.OtherExitCode)
+	changed("input", execution.Input != other.Input)
+	inputs, otherInputs := inputsOf(execution), inputsOf(other)
+	changed("parameters", !reflect.DeepEqual(inputs.Parameters, otherInputs.Parameters))
+	changed("env", !reflect.DeepEqual(inputs.Env, otherInputs.Env))
+	changed("working_dir", inputs.WorkingDir != otherInputs.WorkingDir)
+	changed("timeout_seconds", inputs.TimeoutSeconds != otherInputs.TimeoutSeconds)
+	changed("output_encoding", inputs.OutputEncoding != otherInputs.OutputEncoding)
+	changed("output", output != otherOutput)
+
+	if output != otherOutput {
+		diff.OutputDiff, diff.OutputDiffTruncated = unifiedDiff(output, otherOutput, execution.ID, other.ID, limit)
+	}
+	return diff
+}
+
+// executionDuration returns how long a finished execution ran, in milliseconds
+func executionDuration(execution *AgentExecution) int64 {
+	if execution.EndTime == nil {
+		return 0
+	}
+	return execution.EndTime.Sub(execution.StartTime).Milliseconds()
+}
+
+// inputsOf returns the recorded inputs of an execution, empty ones when none were recorded
+func inputsOf(execution *AgentExecution) ExecutionInputs {
+	if execution.Inputs == nil {
+		return ExecutionInputs{}
+	}
+	return *execution.Inputs
+}
+
+// unifiedDiff returns the unified diff turning a into b, cut at the last whole line within limit bytes
+func unifiedDiff(a, b, fromName, toName string, limit int) (string, bool) {
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+	if err != nil {
+		return "", false
+	}
+	if len(text) <= limit {
+		return text, false
+	}
+
+	text = text[:limit]
+	if cut := strings.LastIndexByte(text, '\n'); cut >= 0 {
+		text = text[:cut+1]
+	}
+	return text, true
+}
@@ -1,8 +1,12 @@
 package models
 
 import (
-	"github.com/algonius/algonius-supervisor/pkg/types"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
 	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
 )
 
 // ExecutionResult represents the output, status, and metadata from an agent execution,
@@ -15,7 +19,12 @@ type ExecutionResult struct {
 	EndTime         time.Time         `json:"end_time"`
 	Status          types.ExecutionStatus `json:"status"`
 	Input           string            `json:"input"` // sanitized of sensitive data
-	Output          string            `json:"output"` // sanitized of sensitive data
+	Output          string            `json:"output"` // sanitized of sensitive data; base64 with the base64 encoding
+	OutputBytes     []byte            `json:"-"` // Raw output the agent produced, Output holds it as text
+	Encoding        OutputEncoding    `json:"encoding,omitempty"` // How the response represents the output
+	OutputJSON      json.RawMessage   `json:"output_json,omitempty"` // The output document, with the json encoding
+	ContentLength   int               `json:"content_length,omitempty"` // Size of the raw output, with the base64 encoding
+	ContentType     string            `json:"content_type,omitempty"` // Sniffed media type of the raw output, when recognized
 	Error           string            `json:"error"`
 	ExecutionTime   int64             `json:"execution_time"` // milliseconds
 	ProcessID       int               `json:"process_id"` // OS process ID of the executed agent (if applicable)
@@ -23,6 +32,20 @@ type ExecutionResult struct {
 	ResourceUsage   *ResourceUsage    `json:"resource_usage"`
 	PreviousRetries []*ExecutionResult `json:"previous_retries"` // References to previous retry attempts
 	StateTransitions []StateTransition `json:"state_transitions"` // Log of all state changes during execution
+	Labels          map[string]string `json:"labels,omitempty"` // Caller-supplied attribution labels
+	TriggerType     types.TaskTriggerType `json:"trigger_type,omitempty"` // Entry point that started the execution
+	TriggeredBy     string            `json:"triggered_by,omitempty"` // Client identity of the caller, or scheduler:<task id>
+	ExitCode        int               `json:"exit_code"` // Process exit code, -1 when terminated by a signal
+	Signal          string            `json:"signal,omitempty"` // Signal that terminated the process (if any)
+	ForcedKill      bool              `json:"forced_kill,omitempty"` // The process ignored its stop signal and was killed after the stop wait
+	Stderr          string            `json:"stderr,omitempty"` // Captured stderr, kept separate from Output
+	FromCache       bool              `json:"from_cache,omitempty"` // Served from the result cache without running the agent
+	CachedExecutionID string          `json:"cached_execution_id,omitempty"` // Execution that produced a cached result
+	Deduplicated    bool              `json:"deduplicated,omitempty"` // Returned for a repeated idempotency key instead of running again
+	Artifacts       []Artifact        `json:"artifacts,omitempty"` // Files the agent left in its artifacts directory
+	RejectedArtifacts []RejectedArtifact `json:"rejected_artifacts,omitempty"` // Files discarded for exceeding the artifact limits
+	FanOut          *FanOutResult     `json:"fan_out,omitempty"` // Per-agent outcome of a fan-out task run
+	Anomalies       []string          `json:"anomalies,omitempty"` // How the execution deviated from its agent's and task's recent ones, e.g. duration_high
 	CreatedAt       time.Time         `json:"created_at"`
 	UpdatedAt       time.Time         `json:"updated_at"`
 }
@@ -33,6 +56,7 @@ type StateTransition struct {
 	ToState       types.AgentState  `json:"to_state"`
 	Timestamp     time.Time         `json:"timestamp"`
 	Reason        string            `json:"reason"`
+	RequestedBy   string            `json:"requested_by,omitempty"` // Client identity that asked for the change, such as a cancellation
 }
 
 // Validate validates the execution result fields
@@ -46,10 +70,10 @@ func (er *ExecutionResult) Validate() error {
 	}
 
 	switch er.Status {
-	case types.SuccessStatus, types.FailureStatus, types.TimeoutStatus, types.CancelledStatus:
+	case types.SuccessStatus, types.WarningStatus, types.FailureStatus, types.TimeoutStatus, types.CancelledStatus:
 		// Valid status
 	default:
-		return ValidationError("ExecutionResult Status must be 'success', 'failure', 'timeout', or 'cancelled'")
+		return ValidationError("ExecutionResult Status must be 'success', 'warning', 'failure', 'timeout', or 'cancelled'")
 	}
 
 	if er.ExecutionTime < 0 {
@@ -80,6 +104,59 @@ func SanitizeData(data string) string {
 	return data
 }
 
+// SetOutput records the raw output of the agent along with its text form
+func (er *ExecutionResult) SetOutput(output []byte) {
+	er.OutputBytes = output
+	er.Output = string(output)
+}
+
+// RawOutput returns the raw output, falling back to the text form for results without one
+func (er *ExecutionResult) RawOutput() []byte {
+	if er.OutputBytes != nil {
+		return er.OutputBytes
+	}
+	return []byte(er.Output)
+}
+
+// ApplyOutputEncoding sets the encoding the output is returned in, checking that output asked to be
+// JSON is a JSON document
+func (er *ExecutionResult) ApplyOutputEncoding(encoding OutputEncoding) error {
+	er.Encoding = encoding
+	if encoding == OutputEncodingJSON {
+		return checkJSONOutput(er.RawOutput())
+	}
+	return nil
+}
+
+// Encoded returns a copy of the result whose output is represented in its encoding, for API
+// responses. JSON output is returned in OutputJSON besides Output; base64 output replaces Output
+// with the encoded raw bytes and reports their length and, when recognized, their media type.
+func (er *ExecutionResult) Encoded() ExecutionResult {
+	encoded := *er
+	switch er.Encoding {
+	case OutputEncodingJSON:
+		if raw := er.RawOutput(); json.Valid(raw) {
+			encoded.OutputJSON = json.RawMessage(raw)
+		}
+	case OutputEncodingBase64:
+		raw := er.RawOutput()
+		encoded.Output = base64.StdEncoding.EncodeToString(raw)
+		encoded.ContentLength = len(raw)
+		if contentType := http.DetectContentType(raw); contentType != "application/octet-stream" {
+			encoded.ContentType = contentType
+		}
+	}
+	return encoded
+}
+
+// StderrTail returns at most the last maxBytes of captured stderr
+func (er *ExecutionResult) StderrTail(maxBytes int) string {
+	if len(er.Stderr) <= maxBytes {
+		return er.Stderr
+	}
+	return er.Stderr[len(er.Stderr)-maxBytes:]
+}
+
 // CalculateExecutionTime calculates the execution time in milliseconds
 func (er *ExecutionResult) CalculateExecutionTime() int64 {
 	duration := er.EndTime.Sub(er.StartTime)
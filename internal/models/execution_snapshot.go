@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExecutionSnapshot is the environment an execution's agent process saw, kept to reproduce runs that
+// fail only in one place. Environment variable values are left out since they may be secrets.
+type ExecutionSnapshot struct {
+	ExecutablePath       string    `json:"executable_path"`             // Absolute path the agent executable resolved to
+	ExecutableSHA256     string    `json:"executable_sha256,omitempty"` // Empty when the executable could not be read
+	Argv                 []string  `json:"argv"`
+	WorkingDir           string    `json:"working_dir"`
+	EnvNames             []string  `json:"env_names"` // Sorted names of the variables the process was given
+	SupervisorVersion    string    `json:"supervisor_version"`
+	AgentConfigUpdatedAt time.Time `json:"agent_config_updated_at"` // Revision of the agent configuration the execution ran with
+	Host                 string    `json:"host"`
+	CapturedAt           time.Time `json:"captured_at"`
+}
+
+// ReplayWarnings returns what differs between the snapshot of a replayed execution and current, the
+// executable and configuration a replay of it runs with, in ways that may make the replay behave
+// differently. A nil snapshot, from an execution that never started its agent, yields none.
+func ReplayWarnings(original, current *ExecutionSnapshot) []string {
+	if original == nil || current == nil {
+		return nil
+	}
+
+	var warnings []string
+	if original.ExecutablePath != current.ExecutablePath {
+		warnings = append(warnings, fmt.Sprintf("executable resolves to %s instead of %s", current.ExecutablePath, original.ExecutablePath))
+	}
+	if original.ExecutableSHA256 != "" && current.ExecutableSHA256 != "" && original.ExecutableSHA256 != current.ExecutableSHA256 {
+		warnings = append(warnings, fmt.Sprintf("executable %s changed: sha256 %s, originally %s", current.ExecutablePath, current.ExecutableSHA256, original.ExecutableSHA256))
+	}
+	if !original.AgentConfigUpdatedAt.IsZero() && !current.AgentConfigUpdatedAt.Equal(original.AgentConfigUpdatedAt) {
+		warnings = append(warnings, fmt.Sprintf("agent configuration was updated at %s", current.AgentConfigUpdatedAt.Format(time.RFC3339)))
+	}
+	if original.Host != "" && current.Host != "" && original.Host != current.Host {
+		warnings = append(warnings, fmt.Sprintf("running on host %s instead of %s", current.Host, original.Host))
+	}
+	return warnings
+}
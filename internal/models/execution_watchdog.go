@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// HungAgentError reports an execution the watchdog stopped because its agent showed no sign of
+// life for the agent's max_silence_seconds. It matches ErrAgentHung.
+type HungAgentError struct {
+	Silence      time.Duration // The silence that tripped the watchdog
+	LastActivity time.Time     // When the agent last wrote output, a heartbeat line or its heartbeat file
+	Heartbeat    bool          // Whether only heartbeats counted as activity
+}
+
+func (e *HungAgentError) Error() string {
+	if e.Heartbeat {
+		return fmt.Sprintf("%s: no heartbeat for %s", ErrAgentHung, e.Silence)
+	}
+	return fmt.Sprintf("%s: no output for %s", ErrAgentHung, e.Silence)
+}
+
+// Is matches ErrAgentHung
+func (e *HungAgentError) Is(target error) bool {
+	return target == ErrAgentHung
+}
+
+// ExecutionHung is the Data of an EventExecutionHung event
+type ExecutionHung struct {
+	SilenceSeconds int       `json:"silence_seconds"` // The agent's max_silence_seconds
+	LastActivity   time.Time `json:"last_activity"`
+	Error          string    `json:"error"`
+}
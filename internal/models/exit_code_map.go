@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// ExitCodeMap maps nonzero exit codes of an agent to the status of its executions, for tools that
+// exit nonzero on conditions that are not errors, such as grep exiting 1 when nothing matched.
+// Keys are a code, e.g. "1", or an inclusive range, e.g. "2-5"; values are success, warning or
+// failure. Unmapped nonzero codes are failures.
+type ExitCodeMap map[string]types.ExecutionStatus
+
+// exitCodeRange is a parsed key of an ExitCodeMap
+type exitCodeRange struct {
+	key  string
+	low  int
+	high int
+}
+
+// parseExitCodeRange parses a key of an ExitCodeMap
+func parseExitCodeRange(key string) (exitCodeRange, error) {
+	lowText, highText, isRange := strings.Cut(strings.TrimSpace(key), "-")
+	low, err := strconv.Atoi(strings.TrimSpace(lowText))
+	if err != nil {
+		return exitCodeRange{}, fmt.Errorf("invalid exit code %q: expected a code such as '1' or a range such as '2-5'", key)
+	}
+	high := low
+	if isRange {
+		if high, err = strconv.Atoi(strings.TrimSpace(highText)); err != nil {
+			return exitCodeRange{}, fmt.Errorf("invalid exit code %q: expected a code such as '1' or a range such as '2-5'", key)
+		}
+	}
+	if low < 1 || high > 255 || low > high {
+		return exitCodeRange{}, fmt.Errorf("invalid exit code %q: codes must be between 1 and 255, the lower bound first", key)
+	}
+	return exitCodeRange{key: key, low: low, high: high}, nil
+}
+
+// Validate checks every key parses, no two keys overlap and every status is success, warning or
+// failure
+func (m ExitCodeMap) Validate() error {
+	ranges := make([]exitCodeRange, 0, len(m))
+	for key, status := range m {
+		codes, err := parseExitCodeRange(key)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case types.SuccessStatus, types.WarningStatus, types.FailureStatus:
+		default:
+			return fmt.Errorf("invalid status %q for exit code %q: must be 'success', 'warning' or 'failure'", status, key)
+		}
+		ranges = append(ranges, codes)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].low < ranges[j].low })
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].low <= ranges[i-1].high {
+			return fmt.Errorf("exit codes %q and %q overlap", ranges[i-1].key, ranges[i].key)
+		}
+	}
+	return nil
+}
+
+// StatusOf returns the status an exit code is mapped to; false when it is not mapped
+func (m ExitCodeMap) StatusOf(code int) (types.ExecutionStatus, bool) {
+	for key, status := range m {
+		codes, err := parseExitCodeRange(key)
+		if err != nil {
+			continue
+		}
+		if code >= codes.low && code <= codes.high {
+			return status, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"path"
+	"strings"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// FanOutSuccessPolicy decides the status of a fan-out task run from the statuses of its agents
+type FanOutSuccessPolicy string
+
+const (
+	FanOutSuccessAll     FanOutSuccessPolicy = "all"      // Every agent must succeed (the default)
+	FanOutSuccessAny     FanOutSuccessPolicy = "any"      // One successful agent is enough
+	FanOutSuccessAtLeast FanOutSuccessPolicy = "at_least" // MinSuccesses agents must succeed
+)
+
+// agentPatternPrefix introduces an agent pattern matching agent IDs by prefix
+const agentPatternPrefix = "prefix:"
+
+// AgentSelector picks the agents a fan-out task runs: the agents listed in AgentIDs, or the agents
+// whose ID matches Pattern when the task fires. Pattern is "prefix:<prefix>" or a glob such as
+// region-*.
+type AgentSelector struct {
+	AgentIDs []string `json:"agent_ids,omitempty" yaml:"agent_ids,omitempty"`
+	Pattern  string   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// Validate checks that the selector picks agents in exactly one way and that its pattern is well formed
+func (s *AgentSelector) Validate() error {
+	if len(s.AgentIDs) > 0 {
+		if s.Pattern != "" {
+			return ValidationError("agent_selector takes agent_ids or a pattern, not both")
+		}
+		for _, id := range s.AgentIDs {
+			if id == "" {
+				return ValidationError("agent_selector agent_ids cannot hold empty IDs")
+			}
+		}
+		return nil
+	}
+	if s.Pattern == "" {
+		return ValidationError("agent_selector needs agent_ids or a pattern")
+	}
+	if strings.HasPrefix(s.Pattern, agentPatternPrefix) {
+		if strings.TrimPrefix(s.Pattern, agentPatternPrefix) == "" {
+			return ValidationError("agent_selector pattern prefix cannot be empty")
+		}
+		return nil
+	}
+	if _, err := path.Match(s.Pattern, ""); err != nil {
+		return ValidationError("invalid agent_selector pattern " + s.Pattern + ": " + err.Error())
+	}
+	return nil
+}
+
+// Matches reports whether the pattern of the selector matches agentID; a selector listing its
+// agents matches those
+func (s *AgentSelector) Matches(agentID string) bool {
+	if len(s.AgentIDs) > 0 {
+		for _, id := range s.AgentIDs {
+			if id == agentID {
+				return true
+			}
+		}
+		return false
+	}
+	if prefix, ok := strings.CutPrefix(s.Pattern, agentPatternPrefix); ok {
+		return strings.HasPrefix(agentID, prefix)
+	}
+	matched, _ := path.Match(s.Pattern, agentID)
+	return matched
+}
+
+// ValidateFanOutSuccessPolicy checks that the success policy is empty or one of all, any, at_least
+func ValidateFanOutSuccessPolicy(policy FanOutSuccessPolicy) error {
+	switch policy {
+	case "", FanOutSuccessAll, FanOutSuccessAny, FanOutSuccessAtLeast:
+		return nil
+	}
+	return ValidationError("ScheduledTask SuccessPolicy must be one of all, any, at_least")
+}
+
+// FanOutAgentResult is the outcome of one agent's execution in a fan-out task run
+type FanOutAgentResult struct {
+	AgentID     string                `json:"agent_id"`
+	ExecutionID string                `json:"execution_id,omitempty"`
+	Status      types.ExecutionStatus `json:"status"`
+	Output      string                `json:"output,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	RetryCount  int                   `json:"retry_count,omitempty"`
+}
+
+// FanOutResult aggregates the executions of a fan-out task run, ordered by agent ID
+type FanOutResult struct {
+	SuccessPolicy FanOutSuccessPolicy   `json:"success_policy"`
+	MinSuccesses  int                   `json:"min_successes,omitempty"`
+	Matched       int                   `json:"matched"`
+	Succeeded     int                   `json:"succeeded"`
+	Failed        int                   `json:"failed"`
+	Status        types.ExecutionStatus `json:"status"`
+	Results       []FanOutAgentResult   `json:"results"`
+}
+
+// Add records the outcome of one agent's execution
+func (r *FanOutResult) Add(result FanOutAgentResult) {
+	r.Results = append(r.Results, result)
+	if result.Status.Succeeded() {
+		r.Succeeded++
+	} else {
+		r.Failed++
+	}
+}
+
+// Decide sets the status of the run by applying the success policy; a run that matched no agents
+// fails
+func (r *FanOutResult) Decide() types.ExecutionStatus {
+	succeeded := r.Matched > 0
+	switch r.SuccessPolicy {
+	case FanOutSuccessAny:
+		succeeded = succeeded && r.Succeeded >= 1
+	case FanOutSuccessAtLeast:
+		succeeded = succeeded && r.Succeeded >= r.MinSuccesses
+	default:
+		succeeded = succeeded && r.Succeeded == r.Matched
+	}
+
+	r.Status = types.FailureStatus
+	if succeeded {
+		r.Status = types.SuccessStatus
+	}
+	return r.Status
+}
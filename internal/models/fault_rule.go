@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// FaultPoint is where in the execution pipeline a fault injection rule applies
+type FaultPoint string
+
+const (
+	FaultPointPreExecution  FaultPoint = "pre_execution"  // Before each attempt runs the agent
+	FaultPointPostExecution FaultPoint = "post_execution" // After each attempt ran the agent successfully
+	FaultPointWebhookSend   FaultPoint = "webhook_send"   // Before each push notification or process event webhook request
+)
+
+// FaultAction is what a fault injection rule does when it triggers
+type FaultAction string
+
+const (
+	FaultActionFail  FaultAction = "fail"  // Fail the execution attempt
+	FaultActionDelay FaultAction = "delay" // Hold the execution or webhook request for DelayMs
+	FaultActionDrop  FaultAction = "drop"  // Lose the webhook request as if the network dropped it
+)
+
+// MaxFaultRuleTTLSeconds caps how long a fault injection rule lives
+const MaxFaultRuleTTLSeconds = 24 * 60 * 60
+
+// FaultRule injects failures or delays at one point of the execution pipeline, so automation can be
+// tested against supervisor failures. A rule triggers on every match, on every nth match when
+// EveryNth is set, or with the given probability, and expires after its TTL.
+type FaultRule struct {
+	ID          string      `json:"id"`
+	Point       FaultPoint  `json:"point"`
+	Action      FaultAction `json:"action"`
+	AgentID     string      `json:"agent_id,omitempty"`    // Only matches this agent, every agent when empty
+	Probability float64     `json:"probability,omitempty"` // Chance from 0 to 1 that a match triggers
+	EveryNth    int         `json:"every_nth,omitempty"`   // Trigger on every nth match instead
+	DelayMs     int         `json:"delay_ms,omitempty"`    // For the delay action
+	Transient   bool        `json:"transient,omitempty"`   // Injected failures are retried like transient errors
+	Message     string      `json:"message,omitempty"`     // Error message of injected failures
+	TTLSeconds  int         `json:"ttl_seconds"`
+	CreatedAt   time.Time   `json:"created_at"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	Matched     int64       `json:"matched"`   // Times the rule applied
+	Triggered   int64       `json:"triggered"` // Times it injected its fault
+}
+
+// Validate checks the rule, returning every problem found as ValidationErrors
+func (r *FaultRule) Validate() error {
+	errs := ValidationErrors{}
+
+	switch r.Point {
+	case FaultPointPreExecution, FaultPointPostExecution, FaultPointWebhookSend:
+	case "":
+		errs.Add("point", ValidationRequired, "FaultRule point cannot be empty")
+	default:
+		errs.Add("point", ValidationInvalid, "FaultRule point must be pre_execution, post_execution or webhook_send")
+	}
+
+	switch r.Action {
+	case FaultActionFail:
+		if r.Point == FaultPointWebhookSend {
+			errs.Add("action", ValidationInvalid, "webhook_send rules drop or delay requests instead of failing them")
+		}
+	case FaultActionDrop:
+		if r.Point != FaultPointWebhookSend {
+			errs.Add("action", ValidationInvalid, "only webhook_send rules can drop")
+		}
+	case FaultActionDelay:
+		if r.DelayMs <= 0 {
+			errs.Add("delay_ms", ValidationOutOfRange, "delay rules need a positive delay_ms")
+		}
+	case "":
+		errs.Add("action", ValidationRequired, "FaultRule action cannot be empty")
+	default:
+		errs.Add("action", ValidationInvalid, "FaultRule action must be fail, delay or drop")
+	}
+
+	if r.Probability < 0 || r.Probability > 1 {
+		errs.Add("probability", ValidationOutOfRange, "probability must be between 0 and 1")
+	}
+	if r.EveryNth < 0 {
+		errs.Add("every_nth", ValidationOutOfRange, "every_nth cannot be negative")
+	}
+	if r.Probability > 0 && r.EveryNth > 0 {
+		errs.Add("every_nth", ValidationConflict, "set either probability or every_nth")
+	}
+	if r.TTLSeconds < 0 || r.TTLSeconds > MaxFaultRuleTTLSeconds {
+		errs.Add("ttl_seconds", ValidationOutOfRange, fmt.Sprintf("ttl_seconds cannot be negative or exceed %d", MaxFaultRuleTTLSeconds))
+	}
+
+	return errs.Err()
+}
+
+// InjectedFault is the error of a failure injected by a fault injection rule
+type InjectedFault struct {
+	RuleID    string
+	Point     FaultPoint
+	Message   string
+	Transient bool
+}
+
+func (e *InjectedFault) Error() string {
+	return fmt.Sprintf("injected fault at %s (rule %s): %s", e.Point, e.RuleID, e.Message)
+}
@@ -0,0 +1,484 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// JSONSchema is a JSON Schema document, draft-07 or later, describing the parameters map of an
+// agent's execute requests. The supervisor checks type, properties, required, additionalProperties,
+// items, enum, const, the numeric, length and size bounds, pattern, uniqueItems, allOf, anyOf, oneOf
+// and not; other keywords, such as title or format, are kept for readers and not checked.
+type JSONSchema map[string]interface{}
+
+// AgentExample is an example call of an agent, shown to consumers discovering how to call it
+type AgentExample struct {
+	Description string                 `json:"description,omitempty"`
+	Input       string                 `json:"input,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// jsonSchemaTypes are the values of the type keyword
+var jsonSchemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "integer": true, "string": true,
+}
+
+// Validate checks the document compiles: every keyword the supervisor checks has a well-formed
+// value, $schema names draft-07 or later and no $ref is used
+func (s JSONSchema) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if schema, ok := s["$schema"]; ok {
+		uri, isString := schema.(string)
+		if !isString {
+			return fmt.Errorf("$schema must be a string")
+		}
+		for _, draft := range []string{"draft-03", "draft-04", "draft-06"} {
+			if strings.Contains(uri, draft) {
+				return fmt.Errorf("$schema %s is not supported, use draft-07 or later", uri)
+			}
+		}
+	}
+	return compileSchema("", s)
+}
+
+// compileSchema checks the keywords of a schema at path, a dotted keyword path empty for the root
+func compileSchema(path string, schema map[string]interface{}) error {
+	at := func(keyword string) string {
+		if path == "" {
+			return keyword
+		}
+		return path + "." + keyword
+	}
+
+	keywords := make([]string, 0, len(schema))
+	for keyword := range schema {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		value := schema[keyword]
+		switch keyword {
+		case "$ref":
+			return fmt.Errorf("%s is not supported, inline the referenced schema", at(keyword))
+		case "type":
+			names, ok := schemaTypes(value)
+			if !ok || len(names) == 0 {
+				return fmt.Errorf("%s must be a type name or a list of them", at(keyword))
+			}
+			for _, name := range names {
+				if !jsonSchemaTypes[name] {
+					return fmt.Errorf("%s has unknown type %q", at(keyword), name)
+				}
+			}
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be an object", at(keyword))
+			}
+			for name, property := range properties {
+				if err := compileSubschema(at(keyword)+"."+name, property); err != nil {
+					return err
+				}
+			}
+		case "required":
+			names, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be a list of property names", at(keyword))
+			}
+			for _, name := range names {
+				if _, ok := name.(string); !ok {
+					return fmt.Errorf("%s must be a list of property names", at(keyword))
+				}
+			}
+		case "additionalProperties":
+			if _, ok := value.(bool); ok {
+				continue
+			}
+			if err := compileSubschema(at(keyword), value); err != nil {
+				return err
+			}
+		case "items", "not":
+			if err := compileSubschema(at(keyword), value); err != nil {
+				return err
+			}
+		case "allOf", "anyOf", "oneOf":
+			schemas, ok := value.([]interface{})
+			if !ok || len(schemas) == 0 {
+				return fmt.Errorf("%s must be a non-empty list of schemas", at(keyword))
+			}
+			for i, subschema := range schemas {
+				if err := compileSubschema(fmt.Sprintf("%s[%d]", at(keyword), i), subschema); err != nil {
+					return err
+				}
+			}
+		case "enum":
+			if values, ok := value.([]interface{}); !ok || len(values) == 0 {
+				return fmt.Errorf("%s must be a non-empty list", at(keyword))
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			// Draft-04 made exclusiveMinimum and exclusiveMaximum booleans; draft-07 made them numbers
+			if _, ok := schemaNumber(value); !ok {
+				return fmt.Errorf("%s must be a number", at(keyword))
+			}
+		case "multipleOf":
+			if n, ok := schemaNumber(value); !ok || n <= 0 {
+				return fmt.Errorf("%s must be a number above 0", at(keyword))
+			}
+		case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			if n, ok := schemaNumber(value); !ok || n < 0 || n != math.Trunc(n) {
+				return fmt.Errorf("%s must be a non-negative integer", at(keyword))
+			}
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", at(keyword))
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s is not a valid regular expression: %w", at(keyword), err)
+			}
+		case "uniqueItems":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s must be a boolean", at(keyword))
+			}
+		}
+	}
+	return nil
+}
+
+// compileSubschema checks a schema nested at path; true and false are schemas too
+func compileSubschema(path string, value interface{}) error {
+	switch v := value.(type) {
+	case bool:
+		return nil
+	case map[string]interface{}:
+		return compileSchema(path, v)
+	case JSONSchema:
+		return compileSchema(path, v)
+	}
+	return fmt.Errorf("%s must be a schema", path)
+}
+
+// ValidateParameters checks the parameters of an execute request against the schema, returning
+// every problem found under parameters.<property>; each problem matches ErrInvalidInput
+func (s JSONSchema) ValidateParameters(parameters map[string]interface{}) ValidationErrors {
+	errs := ValidationErrors{}
+	if s == nil {
+		return errs
+	}
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+	validateValue(&errs, "parameters", s, normalizeValue(parameters))
+	return errs
+}
+
+// normalizeValue converts a decoded value into the types encoding/json decodes into, so values
+// from config files and Go callers compare like values from requests
+func normalizeValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch value.(type) {
+	case string, bool, float64:
+		return value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if json.Unmarshal(data, &normalized) != nil {
+		return value
+	}
+	return normalized
+}
+
+// addInputError records a problem with the value at field
+func addInputError(errs *ValidationErrors, field, code, format string, args ...interface{}) {
+	*errs = append(*errs, NewFieldError(field, code, NewKindError(ErrInvalidInput, "%s %s", field, fmt.Sprintf(format, args...))))
+}
+
+// validateValue checks a value at field against a schema, recording every problem in errs
+func validateValue(errs *ValidationErrors, field string, schema interface{}, value interface{}) {
+	var keywords map[string]interface{}
+	switch v := schema.(type) {
+	case bool:
+		if !v {
+			addInputError(errs, field, ValidationInvalid, "is not allowed")
+		}
+		return
+	case JSONSchema:
+		keywords = v
+	case map[string]interface{}:
+		keywords = v
+	default:
+		return
+	}
+
+	if names, ok := schemaTypes(keywords["type"]); ok {
+		matched := false
+		for _, name := range names {
+			if valueHasType(value, name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addInputError(errs, field, ValidationInvalid, "must be of type %s, got %s", strings.Join(names, " or "), valueType(value))
+			return
+		}
+	}
+
+	if allowed, ok := keywords["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range allowed {
+			if reflect.DeepEqual(normalizeValue(candidate), value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addInputError(errs, field, ValidationInvalid, "must be one of %s", formatValues(allowed))
+		}
+	}
+	if constant, ok := keywords["const"]; ok && !reflect.DeepEqual(normalizeValue(constant), value) {
+		addInputError(errs, field, ValidationInvalid, "must be %s", formatValues([]interface{}{constant}))
+	}
+
+	switch v := value.(type) {
+	case float64:
+		validateNumber(errs, field, keywords, v)
+	case string:
+		validateString(errs, field, keywords, v)
+	case []interface{}:
+		validateArray(errs, field, keywords, v)
+	case map[string]interface{}:
+		validateObject(errs, field, keywords, v)
+	}
+
+	if schemas, ok := keywords["allOf"].([]interface{}); ok {
+		for _, subschema := range schemas {
+			validateValue(errs, field, subschema, value)
+		}
+	}
+	if schemas, ok := keywords["anyOf"].([]interface{}); ok && countMatches(field, schemas, value) == 0 {
+		addInputError(errs, field, ValidationInvalid, "must match at least one of the anyOf schemas")
+	}
+	if schemas, ok := keywords["oneOf"].([]interface{}); ok {
+		if matches := countMatches(field, schemas, value); matches != 1 {
+			addInputError(errs, field, ValidationInvalid, "must match exactly one of the oneOf schemas, matched %d", matches)
+		}
+	}
+	if not, ok := keywords["not"]; ok && countMatches(field, []interface{}{not}, value) == 1 {
+		addInputError(errs, field, ValidationInvalid, "must not match the not schema")
+	}
+}
+
+// countMatches returns how many of the schemas the value at field satisfies
+func countMatches(field string, schemas []interface{}, value interface{}) int {
+	matches := 0
+	for _, subschema := range schemas {
+		subErrs := ValidationErrors{}
+		validateValue(&subErrs, field, subschema, value)
+		if len(subErrs) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// validateNumber checks the numeric bounds of a number
+func validateNumber(errs *ValidationErrors, field string, keywords map[string]interface{}, value float64) {
+	if minimum, ok := schemaNumber(keywords["minimum"]); ok && value < minimum {
+		addInputError(errs, field, ValidationOutOfRange, "must be at least %g, got %g", minimum, value)
+	}
+	if maximum, ok := schemaNumber(keywords["maximum"]); ok && value > maximum {
+		addInputError(errs, field, ValidationOutOfRange, "must be at most %g, got %g", maximum, value)
+	}
+	if minimum, ok := schemaNumber(keywords["exclusiveMinimum"]); ok && value <= minimum {
+		addInputError(errs, field, ValidationOutOfRange, "must be above %g, got %g", minimum, value)
+	}
+	if maximum, ok := schemaNumber(keywords["exclusiveMaximum"]); ok && value >= maximum {
+		addInputError(errs, field, ValidationOutOfRange, "must be below %g, got %g", maximum, value)
+	}
+	if factor, ok := schemaNumber(keywords["multipleOf"]); ok && factor > 0 {
+		if quotient := value / factor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			addInputError(errs, field, ValidationInvalid, "must be a multiple of %g", factor)
+		}
+	}
+}
+
+// validateString checks the length and pattern of a string
+func validateString(errs *ValidationErrors, field string, keywords map[string]interface{}, value string) {
+	length := float64(len([]rune(value)))
+	if minimum, ok := schemaNumber(keywords["minLength"]); ok && length < minimum {
+		addInputError(errs, field, ValidationOutOfRange, "must be at least %g characters long", minimum)
+	}
+	if maximum, ok := schemaNumber(keywords["maxLength"]); ok && length > maximum {
+		addInputError(errs, field, ValidationOutOfRange, "must be at most %g characters long", maximum)
+	}
+	if pattern, ok := keywords["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			addInputError(errs, field, ValidationInvalid, "must match pattern %s", pattern)
+		}
+	}
+}
+
+// validateArray checks the size, uniqueness and items of an array
+func validateArray(errs *ValidationErrors, field string, keywords map[string]interface{}, value []interface{}) {
+	size := float64(len(value))
+	if minimum, ok := schemaNumber(keywords["minItems"]); ok && size < minimum {
+		addInputError(errs, field, ValidationOutOfRange, "must have at least %g items", minimum)
+	}
+	if maximum, ok := schemaNumber(keywords["maxItems"]); ok && size > maximum {
+		addInputError(errs, field, ValidationOutOfRange, "must have at most %g items", maximum)
+	}
+	if unique, _ := keywords["uniqueItems"].(bool); unique {
+		for i := range value {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					addInputError(errs, field, ValidationInvalid, "must not repeat items, item %d repeats item %d", i, j)
+				}
+			}
+		}
+	}
+	if items, ok := keywords["items"]; ok {
+		for i, item := range value {
+			validateValue(errs, fmt.Sprintf("%s[%d]", field, i), items, item)
+		}
+	}
+}
+
+// validateObject checks the properties of an object
+func validateObject(errs *ValidationErrors, field string, keywords map[string]interface{}, value map[string]interface{}) {
+	size := float64(len(value))
+	if minimum, ok := schemaNumber(keywords["minProperties"]); ok && size < minimum {
+		addInputError(errs, field, ValidationOutOfRange, "must have at least %g properties", minimum)
+	}
+	if maximum, ok := schemaNumber(keywords["maxProperties"]); ok && size > maximum {
+		addInputError(errs, field, ValidationOutOfRange, "must have at most %g properties", maximum)
+	}
+
+	if required, ok := keywords["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, exists := value[name]; !exists {
+					addInputError(errs, field+"."+name, ValidationRequired, "is required")
+				}
+			}
+		}
+	}
+
+	properties, _ := keywords["properties"].(map[string]interface{})
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := properties[name]; ok {
+			validateValue(errs, field+"."+name, property, value[name])
+			continue
+		}
+		if additional, ok := keywords["additionalProperties"]; ok {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				addInputError(errs, field+"."+name, ValidationInvalid, "is not a known parameter")
+				continue
+			}
+			validateValue(errs, field+"."+name, additional, value[name])
+		}
+	}
+}
+
+// schemaTypes returns the type names of a type keyword
+func schemaTypes(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for _, name := range v {
+			name, ok := name.(string)
+			if !ok {
+				return nil, false
+			}
+			names = append(names, name)
+		}
+		return names, true
+	case []string:
+		return v, true
+	}
+	return nil, false
+}
+
+// schemaNumber returns the number a keyword holds
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// valueHasType reports whether a decoded value is of a JSON Schema type
+func valueHasType(value interface{}, name string) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return valueType(value) == name
+}
+
+// valueType returns the JSON Schema type of a decoded value
+func valueType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// formatValues renders values as JSON for messages
+func formatValues(values []interface{}) string {
+	rendered := make([]string, len(values))
+	for i, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			rendered[i] = fmt.Sprint(value)
+			continue
+		}
+		rendered[i] = string(data)
+	}
+	return strings.Join(rendered, ", ")
+}
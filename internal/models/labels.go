@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxLabels is the maximum number of labels allowed on an execution
+	MaxLabels = 16
+
+	// MaxLabelLength is the maximum length in bytes of a label key or value
+	MaxLabelLength = 256
+)
+
+// ValidateLabels checks label count and key/value sizes
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return ValidationError(fmt.Sprintf("at most %d labels are allowed, got %d", MaxLabels, len(labels)))
+	}
+
+	for key, value := range labels {
+		if key == "" {
+			return ValidationError("label keys cannot be empty")
+		}
+		if len(key) > MaxLabelLength {
+			return ValidationError(fmt.Sprintf("label key %q exceeds %d bytes", key[:32]+"...", MaxLabelLength))
+		}
+		if len(value) > MaxLabelLength {
+			return ValidationError(fmt.Sprintf("value of label %q exceeds %d bytes", key, MaxLabelLength))
+		}
+	}
+
+	return nil
+}
+
+// ParseLabelSelector parses "key=value" selectors into a map of required labels
+func ParseLabelSelector(selectors []string) (map[string]string, error) {
+	required := make(map[string]string, len(selectors))
+	for _, selector := range selectors {
+		key, value, found := strings.Cut(selector, "=")
+		if !found || key == "" {
+			return nil, ValidationError(fmt.Sprintf("invalid label selector %q, expected key=value", selector))
+		}
+		required[key] = value
+	}
+	return required, nil
+}
+
+// MatchLabels reports whether labels contain every required key/value pair
+func MatchLabels(labels, required map[string]string) bool {
+	for key, value := range required {
+		if actual, ok := labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeLabels returns a new map with override applied on top of base
+func MergeLabels(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
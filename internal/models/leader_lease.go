@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// LeaderRole is the part a supervisor instance plays in an active/standby pair
+type LeaderRole string
+
+// Leader roles
+const (
+	LeaderRoleLeader   LeaderRole = "leader"   // Runs the scheduler, agent processes and webhooks
+	LeaderRoleFollower LeaderRole = "follower" // Serves reads and hands mutations to the leader
+)
+
+// FollowerRequestMode is what a follower does with requests only the leader may serve
+type FollowerRequestMode string
+
+// Follower request modes
+const (
+	FollowerRequestRedirect FollowerRequestMode = "redirect" // Answer 307 with the request's URL on the leader
+	FollowerRequestProxy    FollowerRequestMode = "proxy"    // Forward the request to the leader and relay its response
+)
+
+// ParseFollowerRequestMode returns the mode named by value, redirect when empty
+func ParseFollowerRequestMode(value string) (FollowerRequestMode, error) {
+	switch mode := FollowerRequestMode(value); mode {
+	case "":
+		return FollowerRequestRedirect, nil
+	case FollowerRequestRedirect, FollowerRequestProxy:
+		return mode, nil
+	}
+	return "", ValidationError(fmt.Sprintf("follower request mode must be redirect or proxy, got %q", value))
+}
+
+// LeaderLease names the instance holding leadership until the lease expires
+type LeaderLease struct {
+	Holder    string    `json:"holder"`  // Identity of the leader
+	Address   string    `json:"address"` // Base URL other instances reach the leader at
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LeaseStore keeps the leader lease shared by supervisor instances
+type LeaseStore interface {
+	// AcquireLease makes holder the leader until now+duration when the lease is free, expired or
+	// already held by holder, and returns the lease as it stands afterwards
+	AcquireLease(holder, address string, now time.Time, duration time.Duration) (*LeaderLease, error)
+
+	// ReleaseLease ends the lease early when holder holds it, so another instance takes over
+	// without waiting for it to expire
+	ReleaseLease(holder string) error
+}
+
+// LeadershipStatus is the role of an instance and the lease it last observed
+type LeadershipStatus struct {
+	Role           LeaderRole `json:"role"`
+	Identity       string     `json:"identity,omitempty"`       // Identity of this instance
+	Leader         string     `json:"leader,omitempty"`         // Identity of the leader, when known
+	LeaderAddress  string     `json:"leader_address,omitempty"` // Base URL of the leader, when known
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+}
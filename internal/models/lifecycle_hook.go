@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultHookTimeoutSeconds is how long a lifecycle hook may run when it doesn't set a timeout
+const DefaultHookTimeoutSeconds = 30
+
+// HookKind names the point of a persistent agent's lifecycle a hook runs at
+type HookKind string
+
+const (
+	HookPostStart HookKind = "post_start" // After the process reached the running state, e.g. to warm caches up
+	HookPreStop   HookKind = "pre_stop"   // Before the stop signal is sent, e.g. to drain a queue
+)
+
+// HookFailurePolicy is what a failing lifecycle hook does to the operation it is part of
+type HookFailurePolicy string
+
+const (
+	HookPolicyDegrade HookFailurePolicy = "degrade" // Post-start: the process keeps running in the degraded state (default)
+	HookPolicyFail    HookFailurePolicy = "fail"    // Post-start: the process is stopped and the start counts as failed
+	HookPolicyProceed HookFailurePolicy = "proceed" // Pre-stop: the process is stopped anyway, with a warning (default)
+	HookPolicyAbort   HookFailurePolicy = "abort"   // Pre-stop: the stop is aborted and the process keeps running
+)
+
+// LifecycleHook is a command run, or a URL called, at a point of a persistent agent's lifecycle.
+// Commands run in the agent's working directory with its envs, plus SUPERVISOR_AGENT_ID,
+// SUPERVISOR_AGENT_PID and SUPERVISOR_HOOK; they succeed by exiting with 0. URLs succeed by
+// answering with a 2xx status.
+type LifecycleHook struct {
+	Command        []string          `json:"command,omitempty"`         // Program and its arguments
+	URL            string            `json:"url,omitempty"`             // Called instead of running a command
+	Method         string            `json:"method,omitempty"`          // HTTP method of URL, POST when empty
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // 0 for DefaultHookTimeoutSeconds
+	OnFailure      HookFailurePolicy `json:"on_failure,omitempty"`      // degrade or fail after starting, proceed or abort before stopping
+}
+
+// Validate checks the hook runs exactly one of a command or a URL and its failure policy applies to
+// hooks of kind
+func (h *LifecycleHook) Validate(kind HookKind) error {
+	switch {
+	case len(h.Command) == 0 && h.URL == "":
+		return errors.New("hook needs a command or a url")
+	case len(h.Command) > 0 && h.URL != "":
+		return errors.New("hook cannot have both a command and a url")
+	case len(h.Command) > 0 && h.Command[0] == "":
+		return errors.New("hook command cannot start with an empty program")
+	case len(h.Command) > 0 && h.Method != "":
+		return errors.New("hook method only applies to urls")
+	}
+	if h.URL != "" {
+		parsed, err := url.Parse(h.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("hook url %q must be an absolute http or https url", h.URL)
+		}
+	}
+	if h.TimeoutSeconds < 0 {
+		return errors.New("hook timeout_seconds cannot be negative")
+	}
+
+	switch {
+	case h.OnFailure == "":
+	case kind == HookPostStart && (h.OnFailure == HookPolicyDegrade || h.OnFailure == HookPolicyFail):
+	case kind == HookPreStop && (h.OnFailure == HookPolicyProceed || h.OnFailure == HookPolicyAbort):
+	case kind == HookPostStart:
+		return fmt.Errorf("post-start hook on_failure must be %q or %q", HookPolicyDegrade, HookPolicyFail)
+	default:
+		return fmt.Errorf("pre-stop hook on_failure must be %q or %q", HookPolicyProceed, HookPolicyAbort)
+	}
+	return nil
+}
+
+// Timeout returns how long the hook may run, the default filled in
+func (h *LifecycleHook) Timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return DefaultHookTimeoutSeconds * time.Second
+}
+
+// Policy returns the hook's failure policy for hooks of kind, the default filled in
+func (h *LifecycleHook) Policy(kind HookKind) HookFailurePolicy {
+	switch {
+	case h.OnFailure != "":
+		return h.OnFailure
+	case kind == HookPostStart:
+		return HookPolicyDegrade
+	}
+	return HookPolicyProceed
+}
+
+// HookResult records one run of a lifecycle hook
+type HookResult struct {
+	Hook       HookKind          `json:"hook"`
+	AgentID    string            `json:"agent_id"`
+	PID        int               `json:"pid,omitempty"` // Process of the agent the hook ran for
+	Success    bool              `json:"success"`
+	Policy     HookFailurePolicy `json:"policy"`                // Policy applied, had the hook failed
+	ExitCode   int               `json:"exit_code,omitempty"`   // Of a command hook
+	StatusCode int               `json:"status_code,omitempty"` // Of a URL hook
+	Output     string            `json:"output,omitempty"`      // Tail of a command's output or a URL's response body
+	Error      string            `json:"error,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMs int64             `json:"duration_ms"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PatternTarget returns the selector of a lifecycle target matching agents by pattern, such as *,
+// payments-* or prefix:payments-; false when the target names an agent or a group
+func PatternTarget(target string) (*AgentSelector, bool) {
+	if !strings.HasPrefix(target, agentPatternPrefix) && !strings.ContainsAny(target, "*?[") {
+		return nil, false
+	}
+	return &AgentSelector{Pattern: target}, true
+}
+
+// LifecycleSafety guards lifecycle operations on several agents at once, through a group or an
+// agent pattern, against typos such as stopping every agent: protected agents are left out unless
+// the operation is forced, and operations matching many agents must be confirmed
+type LifecycleSafety struct {
+	ProtectedAgents     []string      `json:"protected_agents,omitempty"`      // Agent IDs or patterns such as payments-* or prefix:prod-
+	ConfirmAboveAgents  int           `json:"confirm_above_agents,omitempty"`  // Operations on more agents need confirming, 0 for no limit
+	ConfirmAbovePercent float64       `json:"confirm_above_percent,omitempty"` // Operations on a larger share of all agents need confirming, 0 for no limit
+	ConfirmationTTL     time.Duration `json:"confirmation_ttl,omitempty"`      // How long a confirmation token can be resent
+}
+
+// Validate checks the thresholds and that every protected pattern is well formed
+func (s LifecycleSafety) Validate() error {
+	if s.ConfirmAboveAgents < 0 {
+		return ValidationError("confirm_above_agents cannot be negative")
+	}
+	if s.ConfirmAbovePercent < 0 || s.ConfirmAbovePercent > 100 {
+		return ValidationError("confirm_above_percent must be between 0 and 100")
+	}
+	for _, pattern := range s.ProtectedAgents {
+		if pattern == "" {
+			return ValidationError("protected_agents cannot hold empty patterns")
+		}
+		if err := (&AgentSelector{Pattern: pattern}).Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Protects reports whether an agent is protected
+func (s LifecycleSafety) Protects(agentID string) bool {
+	for _, pattern := range s.ProtectedAgents {
+		if (&AgentSelector{Pattern: pattern}).Matches(agentID) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfirmationReason returns why an operation on matched of total agents must be confirmed, empty
+// when it need not be; an operation on a single agent never needs confirming
+func (s LifecycleSafety) ConfirmationReason(matched, total int) string {
+	if matched < 2 {
+		return ""
+	}
+	if s.ConfirmAboveAgents > 0 && matched > s.ConfirmAboveAgents {
+		return fmt.Sprintf("it matches %d agents, more than %d", matched, s.ConfirmAboveAgents)
+	}
+	if percent := float64(matched) / float64(total) * 100; s.ConfirmAbovePercent > 0 && total > 0 && percent > s.ConfirmAbovePercent {
+		return fmt.Sprintf("it matches %d of %d agents, more than %g%%", matched, total, s.ConfirmAbovePercent)
+	}
+	return ""
+}
+
+// ConfirmationRequiredError refuses a lifecycle operation on many agents until it is resent with
+// the one-time confirmation token
+type ConfirmationRequiredError struct {
+	Target    string
+	Action    TaskAction
+	Agents    []string // The agents the confirmed operation applies to
+	Reason    string
+	Token     string
+	ExpiresAt time.Time
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("%s of %s needs confirming because %s; resend it with the confirmation token", e.Action, e.Target, e.Reason)
+}
+
+// Unwrap returns ErrConfirmationRequired, so errors.Is(err, ErrConfirmationRequired) holds
+func (e *ConfirmationRequiredError) Unwrap() error {
+	return ErrConfirmationRequired
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Reasons a scheduled run was skipped, recorded in ExecutionHistory.SkipReason
+const (
+	SkipReasonOverlap       = "overlap"        // A previous run of the task was still in progress
+	SkipReasonAgentDisabled = "agent_disabled" // The task's agent was disabled
+	SkipReasonMaintenance   = "maintenance"    // The task's agent was in a maintenance window
+	SkipReasonCalendar      = "calendar"       // The fire's day is excluded by a calendar the task skips
+)
+
+// Sources of a maintenance period
+const (
+	MaintenanceSourceAgent  = "agent"  // One of the agent's own maintenance windows
+	MaintenanceSourceGlobal = "global" // A maintenance window of every agent
+	MaintenanceSourceAdHoc  = "ad_hoc" // A window started through the API
+)
+
+// MaintenanceWindow is a recurring period during which an agent's scheduled tasks are skipped,
+// it is not restarted automatically and its health checks raise no alerts
+type MaintenanceWindow struct {
+	Schedule string `json:"schedule"`           // Cron expression of the window's starts, e.g. "0 2 * * sun"
+	Duration string `json:"duration"`           // How long the window lasts from each start, e.g. "1h30m"
+	Timezone string `json:"timezone,omitempty"` // IANA zone the schedule is evaluated in, the supervisor's own when empty
+	Reason   string `json:"reason,omitempty"`
+}
+
+// MaintenancePeriod is one occurrence of a maintenance window
+type MaintenancePeriod struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Reason      string    `json:"reason,omitempty"`
+	Source      string    `json:"source"`                 // agent, global or ad_hoc
+	RequestedBy string    `json:"requested_by,omitempty"` // Client identity that started an ad-hoc window
+}
+
+// MaintenanceStatus describes an agent's current and next maintenance periods
+type MaintenanceStatus struct {
+	Active  bool               `json:"active"`
+	Current *MaintenancePeriod `json:"current,omitempty"` // Period in progress, the one ending last when several overlap
+	Next    *MaintenancePeriod `json:"next,omitempty"`    // Earliest period starting after now
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// TaskAction is a lifecycle operation on a scheduled task or an agent
+type TaskAction string
+
+const (
+	TaskActionPause   TaskAction = "pause"
+	TaskActionResume  TaskAction = "resume"
+	TaskActionExecute TaskAction = "execute"
+	TaskActionDelete  TaskAction = "delete"
+
+	AgentActionEnable  TaskAction = "enable"
+	AgentActionDisable TaskAction = "disable"
+	AgentActionRestart TaskAction = "restart"
+	AgentActionStart   TaskAction = "start"
+)
+
+// OperationStatus is the outcome of a lifecycle operation
+type OperationStatus string
+
+const (
+	OperationPending OperationStatus = "pending" // Preconditions hold; the operation would be performed, or is in progress
+	OperationSkipped OperationStatus = "skipped" // The target is already in the requested state
+	OperationFailed  OperationStatus = "failed"  // A precondition does not hold, or the operation failed
+	OperationApplied OperationStatus = "applied" // The operation was performed, as reported by bulk operations
+)
+
+// OperationResult describes what a lifecycle operation would do to its target, as returned by dry runs
+// and for operations in progress
+type OperationResult struct {
+	Target        string          `json:"target"`
+	Action        TaskAction      `json:"action"`
+	CurrentState  string          `json:"current_state,omitempty"`
+	ExpectedState string          `json:"expected_state,omitempty"`
+	Status        OperationStatus `json:"status"`
+	Message       string          `json:"message,omitempty"`
+	StartedAt     *time.Time      `json:"started_at,omitempty"` // Set for operations in progress
+	Hooks         []HookResult    `json:"hooks,omitempty"`      // Lifecycle hooks the operation ran so far
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrphanPolicy decides what happens to agent processes left running by a previous supervisor
+type OrphanPolicy string
+
+// Orphan policies
+const (
+	OrphanPolicyAuto      OrphanPolicy = "auto"      // Adopt interactive agents, terminate task executions
+	OrphanPolicyAdopt     OrphanPolicy = "adopt"     // Keep every orphan running and watch it until it exits
+	OrphanPolicyTerminate OrphanPolicy = "terminate" // Stop every orphan
+	OrphanPolicyReport    OrphanPolicy = "report"    // Only log and list orphans, leaving them untouched
+)
+
+// ParseOrphanPolicy returns the policy named by value, auto when empty
+func ParseOrphanPolicy(value string) (OrphanPolicy, error) {
+	switch policy := OrphanPolicy(value); policy {
+	case "":
+		return OrphanPolicyAuto, nil
+	case OrphanPolicyAuto, OrphanPolicyAdopt, OrphanPolicyTerminate, OrphanPolicyReport:
+		return policy, nil
+	}
+	return "", ValidationError(fmt.Sprintf("orphan policy must be one of auto, adopt, terminate or report, got %q", value))
+}
+
+// OrphanStatus is how far an orphaned process has been handled
+type OrphanStatus string
+
+// Orphan statuses
+const (
+	OrphanDetected   OrphanStatus = "detected"   // Found running and left alone
+	OrphanAdopted    OrphanStatus = "adopted"    // Kept running and watched by the supervisor
+	OrphanTerminated OrphanStatus = "terminated" // Stopped by the supervisor
+	OrphanExited     OrphanStatus = "exited"     // Exited on its own after being adopted
+	OrphanFailed     OrphanStatus = "failed"     // Could not be stopped
+)
+
+// Handled reports whether the supervisor has dealt with an orphan in this status
+func (s OrphanStatus) Handled() bool {
+	return s != OrphanDetected && s != OrphanFailed
+}
+
+// ProcessRecord identifies an agent process spawned by the supervisor
+type ProcessRecord struct {
+	PID         int       `json:"pid"`
+	AgentID     string    `json:"agent_id"`
+	ExecutionID string    `json:"execution_id,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	// StartIdentity is the operating system's start time of the process, which tells a live
+	// process from a later one reusing its PID; empty where the platform does not report one
+	StartIdentity string `json:"start_identity,omitempty"`
+}
+
+// OrphanProcess is an agent process found still running when the supervisor started
+type OrphanProcess struct {
+	ProcessRecord
+	AgentMode  string       `json:"agent_mode,omitempty"` // Mode of the agent, empty when it is no longer registered
+	Status     OrphanStatus `json:"status"`
+	DetectedAt time.Time    `json:"detected_at"`
+	HandledAt  *time.Time   `json:"handled_at,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// OutputEncoding is how an execution's output is represented in API responses
+type OutputEncoding string
+
+const (
+	OutputEncodingText   OutputEncoding = "text"   // Output as a string, the default
+	OutputEncodingJSON   OutputEncoding = "json"   // Output must be a JSON document, returned structured in output_json
+	OutputEncodingBase64 OutputEncoding = "base64" // Raw output bytes base64-encoded, for agents emitting binary data
+)
+
+// ErrOutputNotJSON is returned when an execution asked for the json output encoding produced
+// output that is not a JSON document
+var ErrOutputNotJSON = errors.New("agent output is not valid JSON")
+
+// IsValid reports whether the encoding is empty or one of the known encodings
+func (e OutputEncoding) IsValid() bool {
+	switch e {
+	case "", OutputEncodingText, OutputEncodingJSON, OutputEncodingBase64:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateOutputEncoding returns a validation error for unknown encodings, reported on field
+func ValidateOutputEncoding(field string, encoding OutputEncoding) error {
+	if encoding.IsValid() {
+		return nil
+	}
+	errs := ValidationErrors{}
+	errs.Add(field, ValidationInvalid, fmt.Sprintf("%s must be 'text', 'json' or 'base64'", field))
+	return errs.Err()
+}
+
+// ResolveOutputEncoding returns the requested encoding, falling back to the agent's default and
+// then to text
+func ResolveOutputEncoding(requested OutputEncoding, config *AgentConfiguration) OutputEncoding {
+	if requested != "" {
+		return requested
+	}
+	if config != nil && config.OutputEncoding != "" {
+		return config.OutputEncoding
+	}
+	return OutputEncodingText
+}
+
+// checkJSONOutput returns ErrOutputNotJSON with the parser's reason when output is not a single
+// JSON document
+func checkJSONOutput(output []byte) error {
+	var document interface{}
+	if err := json.Unmarshal(output, &document); err != nil {
+		return fmt.Errorf("%w: %v", ErrOutputNotJSON, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// Placeholders of a pipeline step's input mapping
+const (
+	PipelineOutputPlaceholder = "{{output}}" // Output of the previous step that succeeded, or the pipeline input
+	PipelineInputPlaceholder  = "{{input}}"  // Input the pipeline was started with
+)
+
+// Pipeline is an ordered list of agent executions where each step's output feeds the next step
+type Pipeline struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Steps       []PipelineStep `json:"steps"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// PipelineStep runs one agent of a pipeline
+type PipelineStep struct {
+	Name            string                 `json:"name,omitempty"` // Defaults to step-N, N counting from 1
+	AgentID         string                 `json:"agent_id"`
+	Parameters      map[string]interface{} `json:"parameters,omitempty"`    // Passed to the agent as --name value arguments
+	InputMapping    string                 `json:"input_mapping,omitempty"` // Step input using {{output}} and {{input}}; empty passes the previous output as is
+	ContinueOnError bool                   `json:"continue_on_error,omitempty"`
+}
+
+// StepName returns the step's name, or step-N for the step at index when it has none
+func (ps *PipelineStep) StepName(index int) string {
+	if ps.Name != "" {
+		return ps.Name
+	}
+	return fmt.Sprintf("step-%d", index+1)
+}
+
+// Validate validates the pipeline fields
+func (p *Pipeline) Validate() error {
+	if p.ID == "" {
+		return ValidationError("Pipeline ID cannot be empty")
+	}
+
+	if p.Name == "" {
+		return ValidationError("Pipeline Name cannot be empty")
+	}
+
+	if len(p.Steps) == 0 {
+		return ValidationError("Pipeline must have at least one step")
+	}
+
+	names := make(map[string]bool, len(p.Steps))
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		name := step.StepName(i)
+		if names[name] {
+			return ValidationError(fmt.Sprintf("Pipeline step name %q is used more than once", name))
+		}
+		names[name] = true
+
+		if step.AgentID == "" {
+			return ValidationError(fmt.Sprintf("Pipeline step %s AgentID cannot be empty", name))
+		}
+	}
+
+	return nil
+}
+
+// PipelineExecution is one run of a pipeline. It links the executions of its steps, which carry
+// the pipeline_id and pipeline_execution_id labels.
+type PipelineExecution struct {
+	ID           string                `json:"id"`
+	PipelineID   string                `json:"pipeline_id"`
+	State        types.AgentState      `json:"state"` // running, completed or failed
+	Input        string                `json:"input"`
+	Output       string                `json:"output"` // Output of the last step that succeeded
+	Error        string                `json:"error,omitempty"`
+	Steps        []PipelineStepResult  `json:"steps"`
+	ExecutionIDs []string              `json:"execution_ids"` // Agent executions started by the steps, in order
+	Labels       map[string]string     `json:"labels,omitempty"`
+	TriggerType  types.TaskTriggerType `json:"trigger_type,omitempty"`
+	TriggeredBy  string                `json:"triggered_by,omitempty"`
+	StartTime    time.Time             `json:"start_time"`
+	EndTime      *time.Time            `json:"end_time"` // nil while running
+}
+
+// PipelineStepResult is the outcome of one step of a pipeline execution
+type PipelineStepResult struct {
+	Name            string                `json:"name"`
+	AgentID         string                `json:"agent_id"`
+	ExecutionID     string                `json:"execution_id,omitempty"` // Empty when the step did not run
+	Status          types.ExecutionStatus `json:"status"`                 // skipped for steps after an aborting failure
+	Output          string                `json:"output,omitempty"`
+	Error           string                `json:"error,omitempty"`
+	ExecutionTimeMs int64                 `json:"execution_time_ms"`
+}
+
+// IsComplete returns true once the pipeline execution has finished
+func (pe *PipelineExecution) IsComplete() bool {
+	return pe.State == types.CompletedState || pe.State == types.FailedState
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ProcessState is the state of a persistent agent's process under its restart policy
+type ProcessState string
+
+// Process states, after supervisord's
+const (
+	ProcessStopped  ProcessState = "stopped"  // Stopped by the supervisor; the next execution starts it
+	ProcessStarting ProcessState = "starting" // Started, but not yet running for the agent's start seconds
+	ProcessRunning  ProcessState = "running"  // Ran for the start seconds; earlier failed starts are forgotten
+	ProcessDegraded ProcessState = "degraded" // Running, but its post-start hook failed
+	ProcessExited   ProcessState = "exited"   // Exited after running; the next execution starts it
+	ProcessBackoff  ProcessState = "backoff"  // Failed to start and waits to be restarted
+	ProcessFatal    ProcessState = "fatal"    // Failed to start too often in a row; it is not restarted until started explicitly
+)
+
+// ProcessStatus reports the process of a persistent agent and its failed starts
+type ProcessStatus struct {
+	State               ProcessState `json:"state"`
+	PID                 int          `json:"pid,omitempty"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`    // Failed starts since the process last ran long enough
+	BackoffUntil        *time.Time   `json:"backoff_until,omitempty"` // When a backing off process is restarted
+	LastError           string       `json:"last_error,omitempty"`    // Why the last start failed
+	StartedAt           *time.Time   `json:"started_at,omitempty"`    // When the starting or running process started
+	Restarts            int          `json:"restarts"`                // Starts of the process after its first
+	Hooks               []HookResult `json:"hooks,omitempty"`         // Latest run of each of the agent's lifecycle hooks
+}
+
+// ProcessStateEventType is the type of events reporting a persistent agent process failing to start
+const ProcessStateEventType = "agent.process_state"
+
+// ProcessStateEvent reports a persistent agent process entering the backoff or fatal state
+type ProcessStateEvent struct {
+	Type    string        `json:"type"`
+	AgentID string        `json:"agent_id"`
+	Status  ProcessStatus `json:"status"`
+	Time    time.Time     `json:"time"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// Push notification delivery statuses
+const (
+	PushDeliveryPending   = "pending"   // The task has not finished, or delivery is being retried
+	PushDeliveryDelivered = "delivered" // The callback accepted the notification
+	PushDeliveryFailed    = "failed"    // Every attempt failed, or the callback rejected the notification
+)
+
+// PushNotificationConfig is an A2A push notification registration: the supervisor POSTs the final
+// task to URL once the task reaches a terminal state
+type PushNotificationConfig struct {
+	URL      string                    `json:"url"`
+	Token    string                    `json:"-"` // Sent as a bearer token; never echoed back
+	Delivery *PushNotificationDelivery `json:"delivery,omitempty"`
+}
+
+// PushNotificationDelivery records how the notification of a finished task was delivered
+type PushNotificationDelivery struct {
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// PushNotificationPayload is the body POSTed to a push notification URL
+type PushNotificationPayload struct {
+	TaskID string           `json:"task_id"`
+	State  types.AgentState `json:"state"`
+	Task   *AgentExecution  `json:"task"`
+	Result *ExecutionResult `json:"result,omitempty"` // Absent when the task was rejected before it ran
+}
+
+// ValidatePushNotificationURL checks a callback URL is absolute and uses HTTPS, or plain HTTP when
+// allowInsecure is set
+func ValidatePushNotificationURL(callbackURL string, allowInsecure bool) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || parsed.Host == "" {
+		return ValidationError(fmt.Sprintf("push notification url %q must be an absolute URL", callbackURL))
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if allowInsecure {
+			return nil
+		}
+		return ValidationError("push notification url must use https")
+	default:
+		return ValidationError(fmt.Sprintf("push notification url scheme %q is not supported", parsed.Scheme))
+	}
+}
+
+// IsTerminalState reports whether an execution in state has finished
+func IsTerminalState(state types.AgentState) bool {
+	switch state {
+	case types.CompletedState, types.FailedState, types.TimeoutState, types.CancelledState:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// QueueAlertEventType tells whether a queue alert fired or cleared
+type QueueAlertEventType string
+
+// Queue alert event types
+const (
+	QueueAlertFired   QueueAlertEventType = "queue_alert.fired"   // A queue rose above a threshold
+	QueueAlertCleared QueueAlertEventType = "queue_alert.cleared" // The queue of a fired alert fell back to its clear bounds
+)
+
+// Thresholds a queue alert can be raised for
+const (
+	QueueAlertReasonLength = "queue_length" // Too many executions wait
+	QueueAlertReasonWait   = "wait"         // The oldest waiting execution has waited too long
+)
+
+// QueueAlertEvent reports a read-write agent's execution queue rising above or falling back below
+// its alert thresholds
+type QueueAlertEvent struct {
+	Type               QueueAlertEventType `json:"type"`
+	AgentID            string              `json:"agent_id"`
+	QueueLength        int                 `json:"queue_length"`
+	OldestWaitSeconds  float64             `json:"oldest_wait_seconds"`
+	CurrentExecutionID string              `json:"current_execution_id,omitempty"`
+	Reasons            []string            `json:"reasons,omitempty"` // Thresholds exceeded, only set on fired events
+	Time               time.Time           `json:"time"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ScheduleDrift summarizes how late the cron scheduler fired a task, as shown by GET /tasks/:id
+type ScheduleDrift struct {
+	LastDriftMs  int64      `json:"last_drift_ms"`            // How long after its planned time the last fire ran
+	MaxDriftMs   int64      `json:"max_drift_ms"`             // Largest drift among the recent fires
+	WindowFires  int        `json:"window_fires"`             // Recent fires MaxDriftMs covers
+	Fires        int64      `json:"fires"`                    // Fires measured since the task was scheduled
+	MissedFires  int64      `json:"missed_fires"`             // Planned fires that did not happen within the tolerance
+	LastFireAt   *time.Time `json:"last_fire_at,omitempty"`   // Planned time of the last fire
+	LastMissedAt *time.Time `json:"last_missed_at,omitempty"` // Planned time of the last missed fire
+}
+
+// MissedFire is the Data of an EventTaskMissedFire event: a planned fire of a task's schedule
+// that did not happen within the tolerance, e.g. because the scheduler was stalled
+type MissedFire struct {
+	TaskID      string    `json:"task_id"`
+	PlannedTime time.Time `json:"planned_time"`
+	DetectedAt  time.Time `json:"detected_at"`
+	ToleranceMs int64     `json:"tolerance_ms"`
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
 
 // ScheduledTask represents an automated task that executes an agent at specified intervals or times,
 // including timing configuration and execution context.
@@ -8,11 +13,18 @@ type ScheduledTask struct {
 	ID               string                 `json:"id"`
 	Name             string                 `json:"name"`
 	AgentID          string                 `json:"agent_id"` // Reference to the agent configuration ID to execute
+	PipelineID       string                 `json:"pipeline_id,omitempty"` // Pipeline to execute instead of a single agent
+	AgentSelector    *AgentSelector         `json:"agent_selector,omitempty"` // Agents a fan-out task runs the same input against, instead of a single agent
+	MaxParallel      int                    `json:"max_parallel,omitempty"` // Agents of a fan-out task run at once, 0 for all of them
+	SuccessPolicy    FanOutSuccessPolicy    `json:"success_policy,omitempty"` // How a fan-out run's status follows from its agents', all when empty
+	MinSuccesses     int                    `json:"min_successes,omitempty"` // Agents that must succeed under the at_least success policy
 	CronExpression   string                 `json:"cron_expression"`
+	Timezone         string                 `json:"timezone,omitempty"` // IANA time zone the cron expression is evaluated in, the scheduler's when empty
 	Enabled          bool                   `json:"enabled"`
 	LastExecution    *time.Time             `json:"last_execution"` // Time of last execution
 	NextExecution    *time.Time             `json:"next_execution"` // Time of next scheduled execution
 	InputParameters  map[string]interface{} `json:"input_parameters"` // Parameters to pass to the agent during execution
+	InputTemplate    string                 `json:"input_template,omitempty"` // text/template rendered into the input at fire time, e.g. "report for {{yesterday}}"
 	Active           bool                   `json:"active"`
 	CreatedAt        time.Time              `json:"created_at"`
 	UpdatedAt        time.Time              `json:"updated_at"`
@@ -23,39 +35,152 @@ type ScheduledTask struct {
 	Description      string                 `json:"description"` // Optional description of the task
 	Owner            string                 `json:"owner"` // Optional owner of the task
 	Tags             []string               `json:"tags"` // Optional tags for task categorization
+	OverlapPolicy    types.OverlapPolicy    `json:"overlap_policy"` // What to do when a run fires while the previous one is still running
+	RetryBackoff     int                    `json:"retry_backoff"` // Seconds to wait between retry attempts, multiplied by the attempt number
+	LastScheduledRun *time.Time             `json:"last_scheduled_run"` // Fire time of the last cron-triggered run
+	CatchUpPolicy    types.CatchUpPolicy    `json:"catch_up_policy"` // How runs missed during downtime are handled
+	MaxCatchUpRuns   int                    `json:"max_catch_up_runs"` // Cap on catch-up runs under run_all, 0 for the default
+	Labels           map[string]string      `json:"labels,omitempty"` // Default labels applied to executions of this task
+	SkipCalendars    []string               `json:"skip_calendars,omitempty"` // Calendars whose days the task does not run on
+	DeferOnSkip      bool                   `json:"defer_on_skip,omitempty"` // Run fires on excluded days after the next fire no calendar excludes, instead of dropping them
+	DeferredRuns     int                    `json:"deferred_runs,omitempty"` // Fires on excluded days waiting for the next fire no calendar excludes
 }
 
-// Validate validates the scheduled task fields
+// Validate validates the scheduled task fields, returning every problem found as ValidationErrors
 func (st *ScheduledTask) Validate() error {
+	return st.ValidateFields().Err()
+}
+
+// ValidateFields returns every problem with the scheduled task fields, empty when it is valid
+func (st *ScheduledTask) ValidateFields() ValidationErrors {
+	errs := ValidationErrors{}
+
 	if st.ID == "" {
-		return ValidationError("ScheduledTask ID cannot be empty")
+		errs.Add("id", ValidationRequired, "ScheduledTask ID cannot be empty")
 	}
 
 	if st.Name == "" {
-		return ValidationError("ScheduledTask Name cannot be empty")
+		errs.Add("name", ValidationRequired, "ScheduledTask Name cannot be empty")
+	}
+
+	if st.AgentID == "" && st.PipelineID == "" && st.AgentSelector == nil {
+		errs.Add("agent_id", ValidationRequired, "ScheduledTask AgentID cannot be empty")
 	}
 
-	if st.AgentID == "" {
-		return ValidationError("ScheduledTask AgentID cannot be empty")
+	if st.AgentID != "" && st.PipelineID != "" {
+		errs.Add("pipeline_id", ValidationConflict, "ScheduledTask cannot target both an AgentID and a PipelineID")
 	}
 
-	// Note: We're not validating the cron expression format here to avoid adding a dependency
-	// In a real implementation, you might want to use a library like "github.com/robfig/cron"
+	st.ValidateFanOut(&errs)
+
+	// The cron expression is parsed by the scheduler, which knows the formats it accepts
 	if st.CronExpression == "" {
-		return ValidationError("ScheduledTask CronExpression cannot be empty")
+		errs.Add("cron_expression", ValidationRequired, "ScheduledTask CronExpression cannot be empty")
 	}
 
 	// Validate max retries
 	if st.MaxRetries < 0 {
-		return ValidationError("ScheduledTask MaxRetries cannot be negative")
+		errs.Add("max_retries", ValidationOutOfRange, "ScheduledTask MaxRetries cannot be negative")
 	}
 
 	// Validate timeout
 	if st.Timeout < 0 {
-		return ValidationError("ScheduledTask Timeout cannot be negative")
+		errs.Add("timeout", ValidationOutOfRange, "ScheduledTask Timeout cannot be negative")
+	}
+
+	// Validate retry backoff
+	if st.RetryBackoff < 0 {
+		errs.Add("retry_backoff", ValidationOutOfRange, "ScheduledTask RetryBackoff cannot be negative")
+	}
+
+	if err := ValidateOverlapPolicy(st.OverlapPolicy); err != nil {
+		errs.AddError("overlap_policy", ValidationInvalid, err)
+	}
+
+	if err := ValidateCatchUpPolicy(st.CatchUpPolicy); err != nil {
+		errs.AddError("catch_up_policy", ValidationInvalid, err)
+	}
+
+	if st.MaxCatchUpRuns < 0 {
+		errs.Add("max_catch_up_runs", ValidationOutOfRange, "ScheduledTask MaxCatchUpRuns cannot be negative")
+	}
+
+	if err := ValidateLabels(st.Labels); err != nil {
+		errs.AddError("labels", ValidationInvalid, err)
+	}
+
+	for i, name := range st.SkipCalendars {
+		if name == "" {
+			errs.Add(fmt.Sprintf("skip_calendars[%d]", i), ValidationRequired, "ScheduledTask SkipCalendars cannot name an empty calendar")
+		}
+	}
+
+	return errs
+}
+
+// ValidateFanOut adds the problems with the fan-out settings of the task to errs
+func (st *ScheduledTask) ValidateFanOut(errs *ValidationErrors) {
+	if st.AgentSelector != nil {
+		if st.AgentID != "" || st.PipelineID != "" {
+			errs.Add("agent_selector", ValidationConflict, "ScheduledTask AgentSelector cannot be combined with an AgentID or a PipelineID")
+		}
+		if err := st.AgentSelector.Validate(); err != nil {
+			errs.AddError("agent_selector", ValidationInvalid, err)
+		}
+	}
+
+	if st.MaxParallel < 0 {
+		errs.Add("max_parallel", ValidationOutOfRange, "ScheduledTask MaxParallel cannot be negative")
+	}
+
+	if err := ValidateFanOutSuccessPolicy(st.SuccessPolicy); err != nil {
+		errs.AddError("success_policy", ValidationInvalid, err)
 	}
 
-	return nil
+	if st.SuccessPolicy == FanOutSuccessAtLeast && st.MinSuccesses < 1 {
+		errs.Add("min_successes", ValidationOutOfRange, "ScheduledTask MinSuccesses must be at least 1 under the at_least SuccessPolicy")
+	} else if st.MinSuccesses < 0 {
+		errs.Add("min_successes", ValidationOutOfRange, "ScheduledTask MinSuccesses cannot be negative")
+	}
+}
+
+// IsFanOut reports whether the task runs its input against the agents of an agent selector
+func (st *ScheduledTask) IsFanOut() bool {
+	return st.AgentSelector != nil
+}
+
+// GetSuccessPolicy returns the task's fan-out success policy, defaulting to all
+func (st *ScheduledTask) GetSuccessPolicy() FanOutSuccessPolicy {
+	if st.SuccessPolicy == "" {
+		return FanOutSuccessAll
+	}
+	return st.SuccessPolicy
+}
+
+// ValidateOverlapPolicy checks that the overlap policy is empty or one of skip, queue, allow
+func ValidateOverlapPolicy(policy types.OverlapPolicy) error {
+	switch policy {
+	case "", types.OverlapPolicySkip, types.OverlapPolicyQueue, types.OverlapPolicyAllow:
+		return nil
+	}
+	return ValidationError("ScheduledTask OverlapPolicy must be one of skip, queue, allow")
+}
+
+// ValidateCatchUpPolicy checks that the catch-up policy is empty or one of none, run_once, run_all
+func ValidateCatchUpPolicy(policy types.CatchUpPolicy) error {
+	switch policy {
+	case "", types.CatchUpPolicyNone, types.CatchUpPolicyRunOnce, types.CatchUpPolicyRunAll:
+		return nil
+	}
+	return ValidationError("ScheduledTask CatchUpPolicy must be one of none, run_once, run_all")
+}
+
+// GetOverlapPolicy returns the task's overlap policy, defaulting to skip
+func (st *ScheduledTask) GetOverlapPolicy() types.OverlapPolicy {
+	if st.OverlapPolicy == "" {
+		return types.OverlapPolicySkip
+	}
+	return st.OverlapPolicy
 }
 
 // IsActive returns true if the task is currently active and enabled
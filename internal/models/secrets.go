@@ -0,0 +1,87 @@
+package models
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// MaskedValue replaces the values of sensitive environment variables in API responses
+const MaskedValue = "*****"
+
+// sensitiveKeyPatterns are the substrings of environment variable names that suggest a secret value
+var sensitiveKeyPatterns = []string{
+	"password", "secret", "key", "token", "auth", "credential", "private", "api", "cert", "ssl", "tls",
+}
+
+// IsSensitiveEnvKey reports whether the name of an environment variable suggests its value is a secret
+func IsSensitiveEnvKey(key string) bool {
+	lowerKey := strings.ToLower(key)
+	for _, pattern := range sensitiveKeyPatterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSensitiveEnv reports whether the value of the agent's environment variable is masked in API
+// responses: its name suggests a secret, or the agent lists it in SensitiveEnvKeys
+func (ac *AgentConfiguration) IsSensitiveEnv(key string) bool {
+	return IsSensitiveEnvKey(key) || slices.Contains(ac.SensitiveEnvKeys, key)
+}
+
+// Masked returns a copy of the configuration whose sensitive environment variable values are
+// replaced by MaskedValue. The configuration itself is left intact for executions.
+func (ac *AgentConfiguration) Masked() *AgentConfiguration {
+	masked := *ac
+	if len(ac.Envs) == 0 {
+		return &masked
+	}
+	masked.Envs = make(map[string]string, len(ac.Envs))
+	for key, value := range ac.Envs {
+		if ac.IsSensitiveEnv(key) {
+			value = MaskedValue
+		}
+		masked.Envs[key] = value
+	}
+	return &masked
+}
+
+// MaskedEnvKeys returns the sorted keys of the environment variables whose value is MaskedValue,
+// such as those of a configuration read back from the API
+func (ac *AgentConfiguration) MaskedEnvKeys() []string {
+	var keys []string
+	for key, value := range ac.Envs {
+		if value == MaskedValue {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Unmask replaces the masked environment variable values with those current has for the same
+// keys, so a masked configuration can be applied again without losing its secrets. Envs is
+// replaced rather than modified, leaving copies that share it untouched.
+func (ac *AgentConfiguration) Unmask(current *AgentConfiguration) {
+	keys := ac.MaskedEnvKeys()
+	if current == nil || len(keys) == 0 {
+		return
+	}
+	envs := maps.Clone(ac.Envs)
+	for _, key := range keys {
+		if value, ok := current.Envs[key]; ok {
+			envs[key] = value
+		}
+	}
+	ac.Envs = envs
+}
+
+// Masked returns a copy of the template whose settings have their sensitive environment variable
+// values masked
+func (t *AgentTemplate) Masked() *AgentTemplate {
+	masked := *t
+	masked.Settings = *t.Settings.Masked()
+	return &masked
+}
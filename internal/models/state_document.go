@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// StateDocumentVersion is the version of the state document format this supervisor writes and reads
+const StateDocumentVersion = 1
+
+// StateDocument is a snapshot of the supervisor's configuration state, as written by GET
+// /api/v1/export and read by POST /api/v1/import. Agents are recorded as they were registered,
+// before their template was merged in, and each task's Active field records whether it is paused.
+// Environment values are recorded verbatim, so placeholders such as ${DATABASE_URL} stay placeholders.
+type StateDocument struct {
+	Version    int                   `json:"version"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Templates  []*AgentTemplate      `json:"templates"`
+	Agents     []*AgentConfiguration `json:"agents"`
+	Pipelines  []*Pipeline           `json:"pipelines"`
+	Tasks      []*ScheduledTask      `json:"tasks"`
+	History    []*ExecutionHistory   `json:"history,omitempty"` // Only exported on request
+}
+
+// Validate checks the document's version
+func (d *StateDocument) Validate() error {
+	if d.Version != StateDocumentVersion {
+		return ValidationError(fmt.Sprintf("unsupported state document version %d, expected %d", d.Version, StateDocumentVersion))
+	}
+	return nil
+}
+
+// ImportMode is how an imported state document is combined with the current state
+type ImportMode string
+
+const (
+	ImportModeMerge   ImportMode = "merge"   // Add missing items; items that differ are reported as conflicts and left alone
+	ImportModeReplace ImportMode = "replace" // Make the state match the document: differing items are updated, missing ones removed
+)
+
+// ParseImportMode returns the import mode named by mode, merge when it is empty
+func ParseImportMode(mode string) (ImportMode, error) {
+	switch ImportMode(mode) {
+	case "", ImportModeMerge:
+		return ImportModeMerge, nil
+	case ImportModeReplace:
+		return ImportModeReplace, nil
+	}
+	return "", ValidationError(fmt.Sprintf("unknown import mode %q, expected merge or replace", mode))
+}
+
+// ImportScope is the kind of item an import result refers to
+type ImportScope string
+
+const (
+	ImportScopeTemplate ImportScope = "template"
+	ImportScopeAgent    ImportScope = "agent"
+	ImportScopePipeline ImportScope = "pipeline"
+	ImportScopeTask     ImportScope = "task"
+	ImportScopeHistory  ImportScope = "history"
+)
+
+// ImportStatus is the outcome of importing one item
+type ImportStatus string
+
+const (
+	ImportCreated  ImportStatus = "created"  // The item did not exist and was added
+	ImportUpdated  ImportStatus = "updated"  // The item differed and was replaced, in replace mode
+	ImportSkipped  ImportStatus = "skipped"  // The item already exists as in the document
+	ImportConflict ImportStatus = "conflict" // The item differs and was left alone, in merge mode
+	ImportRemoved  ImportStatus = "removed"  // The item is not in the document and was removed, in replace mode
+	ImportFailed   ImportStatus = "failed"   // Applying the item failed
+)
+
+// ImportItem is the outcome of importing one item of a state document
+type ImportItem struct {
+	Scope   ImportScope  `json:"scope"`
+	ID      string       `json:"id"`
+	Status  ImportStatus `json:"status"`
+	Message string       `json:"message,omitempty"`
+}
+
+// ImportResult reports the outcome of an import on each item, in the order the items were applied
+type ImportResult struct {
+	Mode      ImportMode   `json:"mode"`
+	Created   int          `json:"created"`
+	Updated   int          `json:"updated"`
+	Skipped   int          `json:"skipped"`
+	Conflicts int          `json:"conflicts"`
+	Removed   int          `json:"removed"`
+	Failed    int          `json:"failed"`
+	Results   []ImportItem `json:"results"`
+}
+
+// Add records the outcome of importing one item
+func (r *ImportResult) Add(item ImportItem) {
+	switch item.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportUpdated:
+		r.Updated++
+	case ImportSkipped:
+		r.Skipped++
+	case ImportConflict:
+		r.Conflicts++
+	case ImportRemoved:
+		r.Removed++
+	case ImportFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, item)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// InvalidTransitionError reports a state change the state machine does not allow
+type InvalidTransitionError struct {
+	ExecutionID string
+	From        types.AgentState
+	To          types.AgentState
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("invalid state transition of execution %s from %s to %s", e.ExecutionID, e.From, e.To)
+}
+
+// Unwrap returns ErrInvalidTransition, so errors.Is(err, ErrInvalidTransition) holds
+func (e *InvalidTransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// StateMachine is the table of state changes an execution may make
+type StateMachine struct {
+	transitions map[types.AgentState][]types.AgentState
+}
+
+// defaultStateMachine is returned by DefaultStateMachine; state machines are immutable, so it is shared
+var defaultStateMachine = NewStateMachine(map[types.AgentState][]types.AgentState{
+	types.IdleState:      {types.StartingState, types.QueuedState, types.FailedState}, // Reserved executions fail when rejected before they start
+	types.QueuedState:    {types.StartingState, types.FailedState, types.CancelledState},
+	types.StartingState:  {types.RunningState, types.FailedState, types.CancelledState},
+	types.RunningState:   {types.CompletedState, types.FailedState, types.TimeoutState, types.CancelledState},
+	types.CompletedState: {types.CleanupState},
+	types.FailedState:    {types.CleanupState, types.StartingState}, // Allow retry from Failed state
+	types.TimeoutState:   {types.CleanupState},
+	types.CancelledState: {types.CleanupState},
+	types.CleanupState:   {types.IdleState},
+})
+
+// NewStateMachine creates a state machine allowing the given transitions; states without an entry
+// are final
+func NewStateMachine(transitions map[types.AgentState][]types.AgentState) *StateMachine {
+	sm := &StateMachine{transitions: make(map[types.AgentState][]types.AgentState, len(transitions))}
+	for from, to := range transitions {
+		sm.transitions[from] = append([]types.AgentState(nil), to...)
+	}
+	return sm
+}
+
+// DefaultStateMachine returns the state machine executions follow unless configured otherwise
+func DefaultStateMachine() *StateMachine {
+	return defaultStateMachine
+}
+
+// Allows reports whether an execution in state from may move to state to
+func (sm *StateMachine) Allows(from, to types.AgentState) bool {
+	for _, allowed := range sm.transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transitions returns a copy of the transition table
+func (sm *StateMachine) Transitions() map[types.AgentState][]types.AgentState {
+	return NewStateMachine(sm.transitions).transitions
+}
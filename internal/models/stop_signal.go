@@ -0,0 +1,27 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultStopSignal is sent to an agent's process tree to stop it when the agent configures none
+const DefaultStopSignal = "TERM"
+
+// StopSignals lists the signals an agent may be stopped with, by name without the SIG prefix
+var StopSignals = []string{"TERM", "INT", "QUIT", "HUP", "USR1", "USR2", "KILL"}
+
+// NormalizeStopSignal returns the canonical name of a stop signal, accepting any case and an
+// optional SIG prefix, e.g. "sighup" becomes "HUP". An empty name stays empty.
+func NormalizeStopSignal(name string) (string, error) {
+	normalized := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if normalized == "" {
+		return "", nil
+	}
+	for _, signal := range StopSignals {
+		if normalized == signal {
+			return normalized, nil
+		}
+	}
+	return "", ValidationError(fmt.Sprintf("unsupported stop signal %q, must be one of %s", name, strings.Join(StopSignals, ", ")))
+}
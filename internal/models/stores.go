@@ -0,0 +1,380 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// AgentStore keeps the agent configurations of a supervisor; stores shared by several supervisor
+// instances must make CreateAgent atomic, so two instances cannot register the same agent
+type AgentStore interface {
+	// CreateAgent stores a new agent, failing with ErrAgentConflict when an agent with its ID is stored
+	CreateAgent(config *AgentConfiguration) error
+
+	// GetAgent returns the agent with the ID, failing with ErrAgentNotFound
+	GetAgent(agentID string) (*AgentConfiguration, error)
+
+	// SaveAgent replaces a stored agent, failing with ErrAgentNotFound
+	SaveAgent(config *AgentConfiguration) error
+
+	// DeleteAgent removes the agent with the ID, failing with ErrAgentNotFound
+	DeleteAgent(agentID string) error
+
+	// ListAgents returns every stored agent, soft-deleted ones included, ordered by ID
+	ListAgents() ([]*AgentConfiguration, error)
+}
+
+// TaskStore keeps the scheduled tasks of a supervisor; like AgentStore, CreateTask must be atomic
+type TaskStore interface {
+	// CreateTask stores a new task, failing with ErrTaskConflict when a task with its ID is stored
+	CreateTask(task *ScheduledTask) error
+
+	// GetTask returns the task with the ID, failing with ErrTaskNotFound
+	GetTask(taskID string) (*ScheduledTask, error)
+
+	// SaveTask replaces a stored task, failing with ErrTaskNotFound
+	SaveTask(task *ScheduledTask) error
+
+	// DeleteTask removes the task with the ID, failing with ErrTaskNotFound
+	DeleteTask(taskID string) error
+
+	// ListTasks returns every stored task ordered by ID
+	ListTasks() ([]*ScheduledTask, error)
+}
+
+// ExecutionStore keeps the executions of a supervisor and the results of finished ones
+type ExecutionStore interface {
+	// SaveExecution stores an execution or its new state; a finished execution keeps its final
+	// state, so moving it to another one fails with ErrExecutionConflict
+	SaveExecution(execution *AgentExecution) error
+
+	// GetExecution returns the execution with the ID, failing with ErrExecutionNotFound
+	GetExecution(executionID string) (*AgentExecution, error)
+
+	// QueryExecutions returns the executions matching the filter, oldest first
+	QueryExecutions(filter ExecutionFilter) ([]*AgentExecution, error)
+
+	// QueryExecutionsAfter returns at most limit executions matching the filter that follow the
+	// cursor, ordered by start time then ID; fewer than limit means there are no more
+	QueryExecutionsAfter(filter ExecutionFilter, after ExecutionCursor, limit int) ([]*AgentExecution, error)
+
+	// SaveExecutionResult stores the result of a finished execution
+	SaveExecutionResult(executionID string, result *ExecutionResult) error
+
+	// GetExecutionResult returns the result of an execution, failing with ErrExecutionNotFound
+	GetExecutionResult(executionID string) (*ExecutionResult, error)
+}
+
+// ExecutionFilter selects executions; zero-valued fields match everything
+type ExecutionFilter struct {
+	AgentID     string                `json:"agent_id"`
+	Labels      map[string]string     `json:"labels"`
+	TriggerType types.TaskTriggerType `json:"trigger_type"`
+	TriggeredBy string                `json:"triggered_by"`
+	TaskID      string                `json:"task_id"`
+	Anomalous   *bool                 `json:"anomalous"` // Whether executions must or must not have been flagged with anomalies
+	Since       time.Time             `json:"since"`     // Executions started at or after
+	Until       time.Time             `json:"until"`     // Executions started before
+}
+
+// Matches reports whether the execution passes every set field of the filter
+func (f ExecutionFilter) Matches(execution *AgentExecution) bool {
+	if f.AgentID != "" && execution.AgentID != f.AgentID {
+		return false
+	}
+	if !MatchLabels(execution.Labels, f.Labels) {
+		return false
+	}
+	if f.TriggerType != "" && execution.TriggerType != f.TriggerType {
+		return false
+	}
+	if f.TriggeredBy != "" && execution.TriggeredBy != f.TriggeredBy {
+		return false
+	}
+	if f.Anomalous != nil && (len(execution.Anomalies) > 0) != *f.Anomalous {
+		return false
+	}
+	if !f.Since.IsZero() && execution.StartTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !execution.StartTime.Before(f.Until) {
+		return false
+	}
+	return f.TaskID == "" || execution.TaskID == f.TaskID
+}
+
+// ExecutionCursor is a position in the order of executions by start time then ID, as iterating
+// them a page at a time needs; the zero cursor comes before every execution
+type ExecutionCursor struct {
+	StartTime time.Time `json:"start_time"`
+	ID        string    `json:"id"`
+}
+
+// CursorAt returns the cursor right after the execution
+func CursorAt(execution *AgentExecution) ExecutionCursor {
+	return ExecutionCursor{StartTime: execution.StartTime, ID: execution.ID}
+}
+
+// Precedes reports whether the cursor comes before the execution. Start times are compared in
+// nanoseconds, as stores keep them.
+func (c ExecutionCursor) Precedes(execution *AgentExecution) bool {
+	if c == (ExecutionCursor{}) {
+		return true
+	}
+	start, cursorStart := execution.StartTime.UnixNano(), c.StartTime.UnixNano()
+	return start > cursorStart || (start == cursorStart && execution.ID > c.ID)
+}
+
+// FinalStateConflict reports whether saving execution over stored would move a finished execution
+// to another state
+func FinalStateConflict(stored, execution *AgentExecution) bool {
+	return stored != nil && stored.IsComplete() && stored.State != execution.State
+}
+
+// InMemoryAgentStore is an in-memory implementation of AgentStore; it keeps the configurations it is
+// given, so changes to them are seen without saving them
+type InMemoryAgentStore struct {
+	agents map[string]*AgentConfiguration
+	mutex  sync.RWMutex
+}
+
+// NewInMemoryAgentStore creates an empty in-memory agent store
+func NewInMemoryAgentStore() *InMemoryAgentStore {
+	return &InMemoryAgentStore{agents: make(map[string]*AgentConfiguration)}
+}
+
+// CreateAgent stores a new agent
+func (s *InMemoryAgentStore) CreateAgent(config *AgentConfiguration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.agents[config.ID]; exists {
+		return NewKindError(ErrAgentConflict, "agent with ID %s already exists", config.ID)
+	}
+	s.agents[config.ID] = config
+	return nil
+}
+
+// GetAgent returns the agent with the ID
+func (s *InMemoryAgentStore) GetAgent(agentID string) (*AgentConfiguration, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	config, exists := s.agents[agentID]
+	if !exists {
+		return nil, NewKindError(ErrAgentNotFound, "agent with ID %s not found", agentID)
+	}
+	return config, nil
+}
+
+// SaveAgent replaces a stored agent
+func (s *InMemoryAgentStore) SaveAgent(config *AgentConfiguration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.agents[config.ID]; !exists {
+		return NewKindError(ErrAgentNotFound, "agent with ID %s not found", config.ID)
+	}
+	s.agents[config.ID] = config
+	return nil
+}
+
+// DeleteAgent removes the agent with the ID
+func (s *InMemoryAgentStore) DeleteAgent(agentID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.agents[agentID]; !exists {
+		return NewKindError(ErrAgentNotFound, "agent with ID %s not found", agentID)
+	}
+	delete(s.agents, agentID)
+	return nil
+}
+
+// ListAgents returns every stored agent ordered by ID
+func (s *InMemoryAgentStore) ListAgents() ([]*AgentConfiguration, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	configs := make([]*AgentConfiguration, 0, len(s.agents))
+	for _, config := range s.agents {
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ID < configs[j].ID })
+	return configs, nil
+}
+
+// InMemoryTaskStore is an in-memory implementation of TaskStore; it keeps the tasks it is given, so
+// changes to them are seen without saving them
+type InMemoryTaskStore struct {
+	tasks map[string]*ScheduledTask
+	mutex sync.RWMutex
+}
+
+// NewInMemoryTaskStore creates an empty in-memory task store
+func NewInMemoryTaskStore() *InMemoryTaskStore {
+	return &InMemoryTaskStore{tasks: make(map[string]*ScheduledTask)}
+}
+
+// CreateTask stores a new task
+func (s *InMemoryTaskStore) CreateTask(task *ScheduledTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.tasks[task.ID]; exists {
+		return NewKindError(ErrTaskConflict, "task with ID %s already exists", task.ID)
+	}
+	s.tasks[task.ID] = task
+	return nil
+}
+
+// GetTask returns the task with the ID
+func (s *InMemoryTaskStore) GetTask(taskID string) (*ScheduledTask, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	task, exists := s.tasks[taskID]
+	if !exists {
+		return nil, NewKindError(ErrTaskNotFound, "task with ID %s not found", taskID)
+	}
+	return task, nil
+}
+
+// SaveTask replaces a stored task
+func (s *InMemoryTaskStore) SaveTask(task *ScheduledTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.tasks[task.ID]; !exists {
+		return NewKindError(ErrTaskNotFound, "task with ID %s not found", task.ID)
+	}
+	s.tasks[task.ID] = task
+	return nil
+}
+
+// DeleteTask removes the task with the ID
+func (s *InMemoryTaskStore) DeleteTask(taskID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.tasks[taskID]; !exists {
+		return NewKindError(ErrTaskNotFound, "task with ID %s not found", taskID)
+	}
+	delete(s.tasks, taskID)
+	return nil
+}
+
+// ListTasks returns every stored task ordered by ID
+func (s *InMemoryTaskStore) ListTasks() ([]*ScheduledTask, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tasks := make([]*ScheduledTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// InMemoryExecutionStore is an in-memory implementation of ExecutionStore; it keeps the executions
+// it is given, so state changes made to them are seen without saving them
+type InMemoryExecutionStore struct {
+	executions map[string]*AgentExecution
+	results    map[string]*ExecutionResult
+	mutex      sync.RWMutex
+}
+
+// NewInMemoryExecutionStore creates an empty in-memory execution store
+func NewInMemoryExecutionStore() *InMemoryExecutionStore {
+	return &InMemoryExecutionStore{
+		executions: make(map[string]*AgentExecution),
+		results:    make(map[string]*ExecutionResult),
+	}
+}
+
+// SaveExecution stores an execution or its new state
+func (s *InMemoryExecutionStore) SaveExecution(execution *AgentExecution) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if FinalStateConflict(s.executions[execution.ID], execution) {
+		return NewKindError(ErrExecutionConflict, "execution with ID %s already finished as %s", execution.ID, s.executions[execution.ID].State)
+	}
+	s.executions[execution.ID] = execution
+	return nil
+}
+
+// GetExecution returns the execution with the ID
+func (s *InMemoryExecutionStore) GetExecution(executionID string) (*AgentExecution, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	execution, exists := s.executions[executionID]
+	if !exists {
+		return nil, NewKindError(ErrExecutionNotFound, "execution with ID %s not found", executionID)
+	}
+	return execution, nil
+}
+
+// QueryExecutions returns the executions matching the filter, oldest first
+func (s *InMemoryExecutionStore) QueryExecutions(filter ExecutionFilter) ([]*AgentExecution, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	executions := make([]*AgentExecution, 0)
+	for _, execution := range s.executions {
+		if filter.Matches(execution) {
+			executions = append(executions, execution)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartTime.Before(executions[j].StartTime)
+	})
+	return executions, nil
+}
+
+// QueryExecutionsAfter returns at most limit executions matching the filter that follow the cursor,
+// ordered by start time then ID
+func (s *InMemoryExecutionStore) QueryExecutionsAfter(filter ExecutionFilter, after ExecutionCursor, limit int) ([]*AgentExecution, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	executions := make([]*AgentExecution, 0)
+	for _, execution := range s.executions {
+		if after.Precedes(execution) && filter.Matches(execution) {
+			executions = append(executions, execution)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return CursorAt(executions[i]).Precedes(executions[j])
+	})
+	if len(executions) > limit {
+		executions = executions[:limit]
+	}
+	return executions, nil
+}
+
+// SaveExecutionResult stores the result of a finished execution
+func (s *InMemoryExecutionStore) SaveExecutionResult(executionID string, result *ExecutionResult) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.results[executionID] = result
+	return nil
+}
+
+// GetExecutionResult returns the result of an execution
+func (s *InMemoryExecutionStore) GetExecutionResult(executionID string) (*ExecutionResult, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result, exists := s.results[executionID]
+	if !exists {
+		return nil, NewKindError(ErrExecutionNotFound, "execution result with ID %s not found", executionID)
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SyntheticAgentType is the agent type of the built-in synthetic agent, which simulates work
+// without starting a process so the supervisor itself can be benchmarked
+const SyntheticAgentType = "synthetic"
+
+// Parameters of the synthetic agent
+const (
+	SyntheticDurationParam    = "duration"     // Time each execution takes, e.g. "50ms"
+	SyntheticDurationMaxParam = "duration_max" // Upper bound of a random duration from duration, e.g. "200ms"
+	SyntheticOutputBytesParam = "output_bytes" // Size of the output each execution produces
+	SyntheticFailureRateParam = "failure_rate" // Probability from 0 to 1 that an execution fails
+)
+
+// SyntheticSettings is how a synthetic agent behaves
+type SyntheticSettings struct {
+	Duration    time.Duration
+	DurationMax time.Duration // Zero for a fixed Duration
+	OutputBytes int
+	FailureRate float64
+}
+
+// ParseSyntheticSettings reads the settings of a synthetic agent from its parameters; missing
+// parameters leave executions instant, silent and successful. Invalid parameters are returned as
+// ValidationErrors under parameters.<name>.
+func ParseSyntheticSettings(parameters map[string]string) (SyntheticSettings, error) {
+	var settings SyntheticSettings
+	errs := ValidationErrors{}
+	var err error
+
+	if value, ok := parameters[SyntheticDurationParam]; ok {
+		if settings.Duration, err = time.ParseDuration(value); err != nil || settings.Duration < 0 {
+			errs.Add("parameters."+SyntheticDurationParam, ValidationInvalid,
+				fmt.Sprintf("synthetic agent %s must be a non-negative duration, got %q", SyntheticDurationParam, value))
+		}
+	}
+	if value, ok := parameters[SyntheticDurationMaxParam]; ok {
+		if settings.DurationMax, err = time.ParseDuration(value); err != nil || settings.DurationMax < settings.Duration {
+			errs.Add("parameters."+SyntheticDurationMaxParam, ValidationInvalid,
+				fmt.Sprintf("synthetic agent %s must be a duration of at least %s, got %q", SyntheticDurationMaxParam, SyntheticDurationParam, value))
+		}
+	}
+	if value, ok := parameters[SyntheticOutputBytesParam]; ok {
+		if settings.OutputBytes, err = strconv.Atoi(value); err != nil || settings.OutputBytes < 0 {
+			errs.Add("parameters."+SyntheticOutputBytesParam, ValidationInvalid,
+				fmt.Sprintf("synthetic agent %s must be a non-negative integer, got %q", SyntheticOutputBytesParam, value))
+		}
+	}
+	if value, ok := parameters[SyntheticFailureRateParam]; ok {
+		if settings.FailureRate, err = strconv.ParseFloat(value, 64); err != nil || settings.FailureRate < 0 || settings.FailureRate > 1 {
+			errs.Add("parameters."+SyntheticFailureRateParam, ValidationOutOfRange,
+				fmt.Sprintf("synthetic agent %s must be between 0 and 1, got %q", SyntheticFailureRateParam, value))
+		}
+	}
+	return settings, errs.Err()
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Codes of field validation errors
+const (
+	ValidationRequired    = "required"     // The field must be set
+	ValidationInvalid     = "invalid"      // The value is malformed or not one of the accepted values
+	ValidationOutOfRange  = "out_of_range" // The value is outside the accepted range
+	ValidationConflict    = "conflict"     // The value contradicts another field
+	ValidationNotFound    = "not_found"    // The value names something that does not exist
+	ValidationUnavailable = "unavailable"  // The value cannot be honored on this host, e.g. a missing executable
+)
+
+// FieldError is a problem with one field of a configuration
+type FieldError struct {
+	Field   string `json:"field"` // JSON path of the field, such as "access_type" or "parameters.duration"; empty for the configuration as a whole
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	cause   error
+}
+
+// Error returns the message of the problem
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error the problem was found from, so its kind can be matched with errors.Is
+func (e FieldError) Unwrap() error {
+	return e.cause
+}
+
+// ValidationErrors is every problem found validating a configuration
+type ValidationErrors []FieldError
+
+// Error joins the messages of the problems, as a single validation error used to read
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the problems, so errors.Is and errors.As look into each of them
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fieldErr := range e {
+		errs[i] = fieldErr
+	}
+	return errs
+}
+
+// Err returns the problems as an error, nil when there are none
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Has reports whether a problem with field was found
+func (e ValidationErrors) Has(field string) bool {
+	for _, fieldErr := range e {
+		if fieldErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Add records a problem with field
+func (e *ValidationErrors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message, cause: ValidationError(message)})
+}
+
+// AddError records err as a problem with field. The problems of a ValidationErrors are recorded
+// as they are, under field when they have none; a FieldError keeps its own field and code.
+func (e *ValidationErrors) AddError(field, code string, err error) {
+	var fieldErrs ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		for _, fieldErr := range fieldErrs {
+			if fieldErr.Field == "" {
+				fieldErr.Field = field
+			}
+			*e = append(*e, fieldErr)
+		}
+		return
+	}
+	var fieldErr FieldError
+	if errors.As(err, &fieldErr) {
+		*e = append(*e, FieldError{Field: fieldErr.Field, Code: fieldErr.Code, Message: err.Error(), cause: err})
+		return
+	}
+	*e = append(*e, FieldError{Field: field, Code: code, Message: err.Error(), cause: err})
+}
+
+// NewFieldError creates the problem err is with field, keeping err for errors.Is
+func NewFieldError(field, code string, err error) FieldError {
+	return FieldError{Field: field, Code: code, Message: err.Error(), cause: err}
+}
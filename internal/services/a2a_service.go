@@ -31,6 +31,7 @@ func NewA2AService(agentService IAgentService, executionService IExecutionServic
 	agentExecutor := &AgentExecutor{
 		agentService:    agentService,
 		executionService: executionService,
+		router:          ExecutionRouterFor(executionService, logger),
 		logger:          logger,
 	}
 
@@ -47,6 +48,11 @@ func (as *A2AService) GetAgentExecutor() *AgentExecutor {
 	return as.agentExecutor
 }
 
+// GetAgentService returns the agent service the A2A service runs agents of
+func (as *A2AService) GetAgentService() IAgentService {
+	return as.agentService
+}
+
 // GetLogger returns the logger used by the A2A service
 func (as *A2AService) GetLogger() *zap.Logger {
 	return as.logger
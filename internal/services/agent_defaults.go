@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// IAgentDefaultsService interface for the server-wide settings agents get for the fields they and
+// their template leave unset
+type IAgentDefaultsService interface {
+	// GetAgentDefaults returns the agent defaults, nil when there are none
+	GetAgentDefaults() *models.AgentConfiguration
+
+	// ReapplyDefaults merges the current defaults into the named agents, or every agent when none
+	// is named, reporting what changed; dry runs only report
+	ReapplyDefaults(agentIDs []string, dryRun bool) (*models.ReapplyDefaultsResult, error)
+
+	// GetAgentSpec returns an agent's configuration as it was registered, before its template and
+	// the defaults were merged in
+	GetAgentSpec(agentID string) (*models.AgentConfiguration, error)
+}
+
+// SetAgentDefaults sets the settings agents get for the fields they and their template leave unset.
+// Only agents registered or updated afterwards get them; ReapplyDefaults merges them into the
+// agents already registered.
+func (as *AgentService) SetAgentDefaults(defaults *models.AgentConfiguration) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+	as.defaults = defaults
+}
+
+// GetAgentDefaults returns the agent defaults, nil when there are none
+func (as *AgentService) GetAgentDefaults() *models.AgentConfiguration {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+	return as.defaults
+}
+
+// ReapplyDefaults merges an agent's configuration as it was registered again with its template and
+// the current defaults, for the named agents or every agent when none is named. Agents keep their
+// enabled state; those the merge leaves unchanged are skipped and those it would make invalid fail.
+func (as *AgentService) ReapplyDefaults(agentIDs []string, dryRun bool) (*models.ReapplyDefaultsResult, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	if len(agentIDs) == 0 {
+		stored, err := as.store.ListAgents()
+		if err != nil {
+			return nil, err
+		}
+		for _, config := range stored {
+			if !config.IsDeleted() {
+				agentIDs = append(agentIDs, config.ID)
+			}
+		}
+		sort.Strings(agentIDs)
+	}
+
+	result := &models.ReapplyDefaultsResult{DryRun: dryRun, Results: []models.AgentDefaultsResult{}}
+	for _, agentID := range agentIDs {
+		result.Add(as.reapplyDefaults(agentID, dryRun))
+	}
+
+	if !dryRun {
+		as.logger.Info("reapply defaults finished",
+			zap.Int("matched", result.Matched),
+			zap.Int("updated", result.Updated),
+			zap.Int("failed", result.Failed))
+	}
+	return result, nil
+}
+
+// reapplyDefaults merges the current defaults into one agent. The caller must hold templateMutex.
+func (as *AgentService) reapplyDefaults(agentID string, dryRun bool) models.AgentDefaultsResult {
+	failed := func(err error) models.AgentDefaultsResult {
+		return models.AgentDefaultsResult{AgentID: agentID, Status: models.OperationFailed, Message: err.Error()}
+	}
+
+	current, err := as.store.GetAgent(agentID)
+	if err != nil {
+		return failed(err)
+	}
+	if current.IsDeleted() {
+		return failed(models.NewKindError(models.ErrAgentDeleted, "agent with ID %s is deleted", agentID))
+	}
+
+	// Agents registered elsewhere have no spec; their configuration stands for it
+	spec, known := as.specs[agentID]
+	if !known {
+		spec = current
+	}
+	resolved, err := as.resolveConfig(spec)
+	if err != nil {
+		return failed(err)
+	}
+	merged := *resolved
+	merged.Enabled = current.Enabled
+	merged.CreatedAt = current.CreatedAt
+	merged.UpdatedAt = current.UpdatedAt
+	merged.DeletedAt = nil
+
+	changed := models.ChangedFields(current, &merged)
+	if len(changed) == 0 {
+		if !dryRun {
+			as.storeSpec(spec)
+		}
+		return models.AgentDefaultsResult{AgentID: agentID, Status: models.OperationSkipped, Message: "agent already has the current defaults"}
+	}
+	if err := as.ValidateAgentConfiguration(&merged); err != nil {
+		return failed(fmt.Errorf("%w: %w", models.ErrInvalidAgent, err))
+	}
+	if dryRun {
+		return models.AgentDefaultsResult{AgentID: agentID, Status: models.OperationPending, ChangedFields: changed}
+	}
+
+	merged.UpdatedAt = time.Now()
+	if err := as.store.SaveAgent(&merged); err != nil {
+		return failed(err)
+	}
+	as.storeSpec(spec)
+
+	as.logger.Info("agent defaults reapplied",
+		zap.String("agent_id", agentID),
+		zap.Strings("changed_fields", changed))
+	return models.AgentDefaultsResult{AgentID: agentID, Status: models.OperationApplied, ChangedFields: changed}
+}
+
+// resolveConfig returns config merged with the template it names, if any, and then with the
+// defaults. The caller must hold templateMutex.
+func (as *AgentService) resolveConfig(config *models.AgentConfiguration) (*models.AgentConfiguration, error) {
+	resolved, err := as.resolveTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+	return models.ApplyDefaults(resolved, as.defaults), nil
+}
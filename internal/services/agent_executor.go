@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/algonius/algonius-supervisor/internal/models"
@@ -16,6 +17,7 @@ import (
 type AgentExecutor struct {
 	agentService    IAgentService
 	executionService IExecutionService
+	router          *ExecutionRouter
 	logger          *zap.Logger
 }
 
@@ -71,13 +73,23 @@ func (ae *AgentExecutor) Execute(ctx context.Context, reqCtx *a2asrv.RequestCont
 		return nil
 	}
 
-	// Create an agent wrapper for execution
-	simpleAgent := &SimpleA2AAgent{
-		config: agentConfig,
+	if err := checkAgentEnabled(agentConfig); err != nil {
+		ae.logger.Warn("rejected execution of disabled agent", zap.String("agent_id", agentID), zap.Error(err))
+		title := "Agent is disabled"
+		if errors.Is(err, models.ErrAgentDeleted) {
+			title = "Agent is deleted"
+		}
+		errorEvent := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateFailed, ae.createErrorMessage(title, err.Error()))
+		if err := queue.Write(ctx, errorEvent); err != nil {
+			return fmt.Errorf("failed to write error event: %w", err)
+		}
+		return nil
 	}
 
-	// Execute the agent
-	execution, err := ae.executionService.ExecuteAgent(ctx, simpleAgent, input)
+	// Execute the agent, attributed to the client the A2A request came from; the router queues it
+	// behind other runs of a read-write agent
+	ctx = WithExecutionTrigger(ctx, types.TaskTriggerTypeA2A, ClientIDFromContext(ctx))
+	execution, err := ae.router.Execute(ctx, agentConfig, input)
 	if err != nil {
 		ae.logger.Error("agent execution failed", zap.Error(err))
 		errorEvent := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateFailed, ae.createErrorMessage("Agent execution failed", err.Error()))
@@ -87,10 +99,14 @@ func (ae *AgentExecutor) Execute(ctx context.Context, reqCtx *a2asrv.RequestCont
 		return nil
 	}
 
-	// Create response parts
+	// Create response parts from the agent's output, summarising the execution when there is no result
+	text := fmt.Sprintf("Agent execution completed. Execution ID: %s, Status: %s", execution.ID, string(execution.State))
+	if result, resultErr := ae.executionService.GetExecutionResult(execution.ID); resultErr == nil {
+		text = result.Output
+	}
 	parts := []a2a.Part{
 		&a2a.TextPart{
-			Text: fmt.Sprintf("Agent execution completed. Execution ID: %s, Status: %s", execution.ID, string(execution.State)),
+			Text: text,
 		},
 	}
 
@@ -133,62 +149,6 @@ func (ae *AgentExecutor) createErrorMessage(message, data string) *a2a.Message {
 	}
 }
 
-// SimpleA2AAgent is a basic implementation of the agents.IAgent interface
-type SimpleA2AAgent struct {
-	config *models.AgentConfiguration
-}
-
-// Execute implements the agents.IAgent interface
-func (s *SimpleA2AAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
-	// In a real implementation, this would execute the actual agent
-	// For now, we'll return a simple success result
-
-	result := &models.ExecutionResult{
-		ID:      generateA2AID(),
-		AgentID: s.config.ID,
-		Status:  types.SuccessStatus,
-		Input:   input,
-		Output:  fmt.Sprintf("Executed agent '%s' with input: %s", s.config.Name, input),
-		Error:   "",
-	}
-
-	return result, nil
-}
-
-// GetID implements the agents.IAgent interface
-func (s *SimpleA2AAgent) GetID() string {
-	return s.config.ID
-}
-
-// GetName implements the agents.IAgent interface
-func (s *SimpleA2AAgent) GetName() string {
-	return s.config.Name
-}
-
-// GetType implements the agents.IAgent interface
-func (s *SimpleA2AAgent) GetType() string {
-	return string(s.config.AgentType)
-}
-
-// IsReadOnly implements the agents.IAgent interface
-func (s *SimpleA2AAgent) IsReadOnly() bool {
-	return s.config.AccessType == models.ReadOnlyAccessType
-}
-
-// GetConfig implements the agents.IAgent interface
-func (s *SimpleA2AAgent) GetConfig() *models.AgentConfiguration {
-	return s.config
-}
-
-// Validate implements the agents.IAgent interface
-func (s *SimpleA2AAgent) Validate() error {
-	if s.config == nil {
-		return fmt.Errorf("agent configuration is nil")
-	}
-
-	return s.config.Validate()
-}
-
 // Helper functions
 func generateA2AID() string {
 	// In a real implementation, this would generate a proper A2A ID
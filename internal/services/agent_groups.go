@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// IAgentGroupService interface for managing the named groups agents are operated on in
+type IAgentGroupService interface {
+	// CreateGroup stores a new agent group
+	CreateGroup(group *models.AgentGroup) error
+
+	// UpdateGroup replaces the description and members of an existing agent group
+	UpdateGroup(group *models.AgentGroup) error
+
+	// DeleteGroup removes an agent group; its members are left as they are
+	DeleteGroup(name string) error
+
+	// GetGroup returns an agent group by its name
+	GetGroup(name string) (*models.AgentGroup, error)
+
+	// ListGroups returns all agent groups, ordered by name
+	ListGroups() ([]*models.AgentGroup, error)
+}
+
+// CreateGroup stores a new agent group whose members are registered agents
+func (as *AgentService) CreateGroup(group *models.AgentGroup) error {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	if err := as.validateGroup(group); err != nil {
+		return err
+	}
+	if _, exists := as.groups[group.Name]; exists {
+		return models.NewKindError(models.ErrGroupConflict, "agent group %s already exists", group.Name)
+	}
+
+	stored := copyGroup(group)
+	stored.CreatedAt = time.Now()
+	stored.UpdatedAt = stored.CreatedAt
+	as.groups[group.Name] = stored
+	group.CreatedAt, group.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+
+	as.logger.Info("agent group created",
+		zap.String("group", group.Name),
+		zap.Strings("members", group.Members))
+	return nil
+}
+
+// UpdateGroup replaces the description and members of an existing agent group
+func (as *AgentService) UpdateGroup(group *models.AgentGroup) error {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	existing, exists := as.groups[group.Name]
+	if !exists {
+		return models.NewKindError(models.ErrGroupNotFound, "agent group %s not found", group.Name)
+	}
+	if err := as.validateGroup(group); err != nil {
+		return err
+	}
+
+	stored := copyGroup(group)
+	stored.CreatedAt = existing.CreatedAt
+	stored.UpdatedAt = time.Now()
+	as.groups[group.Name] = stored
+	group.CreatedAt, group.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+
+	as.logger.Info("agent group updated",
+		zap.String("group", group.Name),
+		zap.Strings("members", group.Members))
+	return nil
+}
+
+// DeleteGroup removes an agent group; its members are left as they are
+func (as *AgentService) DeleteGroup(name string) error {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	if _, exists := as.groups[name]; !exists {
+		return models.NewKindError(models.ErrGroupNotFound, "agent group %s not found", name)
+	}
+	delete(as.groups, name)
+
+	as.logger.Info("agent group deleted", zap.String("group", name))
+	return nil
+}
+
+// GetGroup returns a copy of an agent group
+func (as *AgentService) GetGroup(name string) (*models.AgentGroup, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	group, exists := as.groups[name]
+	if !exists {
+		return nil, models.NewKindError(models.ErrGroupNotFound, "agent group %s not found", name)
+	}
+	return copyGroup(group), nil
+}
+
+// ListGroups returns copies of all agent groups, ordered by name
+func (as *AgentService) ListGroups() ([]*models.AgentGroup, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	groups := make([]*models.AgentGroup, 0, len(as.groups))
+	for _, group := range as.groups {
+		groups = append(groups, copyGroup(group))
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups, nil
+}
+
+// validateGroup checks the group's fields and that every member is a registered agent that is not
+// deleted. The caller must hold templateMutex.
+func (as *AgentService) validateGroup(group *models.AgentGroup) error {
+	errs := models.ValidationErrors{}
+	if err := group.Validate(); err != nil {
+		errs.AddError("", models.ValidationInvalid, err)
+	}
+
+	for i, member := range group.Members {
+		if member == "" {
+			continue
+		}
+		if config, err := as.store.GetAgent(member); err != nil || config.IsDeleted() {
+			errs.Add(fmt.Sprintf("members[%d]", i), models.ValidationNotFound, fmt.Sprintf("agent group member %s is not a registered agent", member))
+		}
+	}
+
+	if err := errs.Err(); err != nil {
+		return fmt.Errorf("%w: %w", models.ErrInvalidAgent, err)
+	}
+	return nil
+}
+
+// removeFromGroups takes a deleted agent out of every group listing it, with a warning since the
+// groups no longer operate on it, and returns the names of those groups in order. The caller must
+// hold templateMutex.
+func (as *AgentService) removeFromGroups(agentID string) []string {
+	var names []string
+	for name, group := range as.groups {
+		index := slices.Index(group.Members, agentID)
+		if index < 0 {
+			continue
+		}
+
+		updated := copyGroup(group)
+		updated.Members = slices.Delete(updated.Members, index, index+1)
+		updated.UpdatedAt = time.Now()
+		as.groups[name] = updated
+		names = append(names, name)
+
+		as.logger.Warn("deleted agent removed from agent group",
+			zap.String("agent_id", agentID),
+			zap.String("group", name),
+			zap.Int("members_left", len(updated.Members)))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyGroup returns a copy of group that shares no members slice with it
+func copyGroup(group *models.AgentGroup) *models.AgentGroup {
+	copied := *group
+	copied.Members = slices.Clone(group.Members)
+	return &copied
+}
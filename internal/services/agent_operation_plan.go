@@ -0,0 +1,103 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// PlanAgentOperation checks a lifecycle action's preconditions on an agent and reports its outcome
+// without performing it: failed when the agent is unknown or deleted, another operation holds it or
+// a persistent process cannot be started, skipped when the agent is already in the requested state
+func (ec *ExecutionCoordinator) PlanAgentOperation(agentID string, action models.TaskAction) *models.OperationResult {
+	result := &models.OperationResult{Target: agentID, Action: action, Status: models.OperationPending}
+	fail := func(err error) *models.OperationResult {
+		result.Status = models.OperationFailed
+		result.Message = err.Error()
+		return result
+	}
+
+	agentConfig, err := ec.agentService.GetAgent(agentID)
+	if err != nil {
+		return fail(err)
+	}
+	if agentConfig.IsDeleted() {
+		return fail(models.NewKindError(models.ErrAgentDeleted, "agent %s is deleted", agentID))
+	}
+	result.CurrentState = enabledState(agentConfig.Enabled)
+	result.ExpectedState = enabledState(action != models.AgentActionDisable)
+
+	if current := ec.operations.Current(agentID); current != nil {
+		return fail(fmt.Errorf("agent %s is busy with a %s operation", agentID, current.Action))
+	}
+
+	switch action {
+	case models.AgentActionEnable, models.AgentActionDisable:
+		if result.CurrentState == result.ExpectedState {
+			result.Status = models.OperationSkipped
+			result.Message = "agent is already " + result.CurrentState
+		}
+
+	case models.AgentActionRestart:
+		// A restart cancels the agent's executions and leaves it enabled, whatever its state
+
+	case models.AgentActionStart:
+		if agentConfig.Mode != models.PersistentMode {
+			return fail(models.NewKindError(models.ErrInvalidTransition, "agent %s is not a persistent agent and has no process to start", agentID))
+		}
+		result.CurrentState = string(models.ProcessStopped)
+		if status, ok := agents.PersistentProcessStatus(agentID); ok {
+			result.CurrentState = string(status.State)
+		}
+		result.ExpectedState = string(models.ProcessRunning)
+		switch models.ProcessState(result.CurrentState) {
+		case models.ProcessStarting, models.ProcessRunning, models.ProcessDegraded:
+			result.Status = models.OperationSkipped
+			result.Message = "process is already " + result.CurrentState
+		}
+
+	default:
+		return fail(models.NewKindError(models.ErrInvalidTransition, "action %s cannot be applied to %s", action, agentID))
+	}
+	return result
+}
+
+// PlanBatchOperation reports what a lifecycle action on a group:<name> target or an agent pattern
+// would do to each agent, in the order the operation would reach them, without performing it.
+// Protected agents the operation would leave out are reported as skipped; no confirmation is asked
+// for. Errors are returned for unknown groups and patterns matching no agent.
+func (ec *ExecutionCoordinator) PlanBatchOperation(target string, action models.TaskAction, force bool) (*models.BatchOperationResult, error) {
+	var members []string
+	var err error
+	if group, ok := models.GroupTarget(target); ok {
+		members, err = ec.groupMembers(group)
+	} else {
+		members, err = ec.patternMembers(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &models.BatchOperationResult{Action: action, DryRun: true, Matched: len(members), Results: []models.OperationResult{}}
+	allowed, protected := members, []string(nil)
+	if ec.guard != nil {
+		allowed, protected = ec.guard.Filter(members, force)
+	}
+	if action == models.AgentActionDisable {
+		// Disabling stops members in the reverse order
+		reversed := make([]string, len(allowed))
+		for i, agentID := range allowed {
+			reversed[len(allowed)-1-i] = agentID
+		}
+		allowed = reversed
+	}
+
+	for _, agentID := range allowed {
+		batch.Add(*ec.PlanAgentOperation(agentID, action))
+	}
+	for _, agentID := range protected {
+		batch.Add(models.OperationResult{Target: agentID, Action: action, Status: models.OperationSkipped, Message: "protected agent, left out unless forced"})
+	}
+	return batch, nil
+}
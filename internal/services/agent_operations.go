@@ -0,0 +1,95 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// DefaultOperationWaitTimeout bounds how long a lifecycle operation waits for a conflicting one
+const DefaultOperationWaitTimeout = 30 * time.Second
+
+// AgentOperationLocks serializes lifecycle operations per agent: while one operation on an agent is
+// in flight, others on the same agent are rejected or wait for it to finish
+type AgentOperationLocks struct {
+	mutex    sync.Mutex
+	inFlight map[string]*agentOperation
+}
+
+// agentOperation is an operation holding an agent's lock; done is closed when it is released
+type agentOperation struct {
+	result models.OperationResult
+	done   chan struct{}
+}
+
+// NewAgentOperationLocks creates a new AgentOperationLocks
+func NewAgentOperationLocks() *AgentOperationLocks {
+	return &AgentOperationLocks{inFlight: make(map[string]*agentOperation)}
+}
+
+// Acquire takes the agent's lock for operation and returns the function that releases it. When
+// another operation holds the lock it fails with ErrOperationInProgress at once, or with a positive
+// wait after waiting that long for the lock to become free.
+func (l *AgentOperationLocks) Acquire(operation models.OperationResult, wait time.Duration) (func(), error) {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		l.mutex.Lock()
+		current, busy := l.inFlight[operation.Target]
+		if !busy {
+			now := time.Now()
+			operation.Status = models.OperationPending
+			operation.StartedAt = &now
+			held := &agentOperation{result: operation, done: make(chan struct{})}
+			l.inFlight[operation.Target] = held
+			l.mutex.Unlock()
+
+			return func() {
+				l.mutex.Lock()
+				delete(l.inFlight, operation.Target)
+				l.mutex.Unlock()
+				close(held.done)
+			}, nil
+		}
+		l.mutex.Unlock()
+
+		if timeout == nil {
+			return nil, models.NewKindError(models.ErrOperationInProgress, "agent %s has a %s operation in progress", operation.Target, current.result.Action)
+		}
+		select {
+		case <-current.done:
+		case <-timeout:
+			return nil, models.NewKindError(models.ErrOperationInProgress, "agent %s still has a %s operation in progress after waiting %s", operation.Target, current.result.Action, wait)
+		}
+	}
+}
+
+// RecordHook adds the result of a lifecycle hook to the operation in flight on the agent, if any
+func (l *AgentOperationLocks) RecordHook(agentID string, result models.HookResult) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if current, busy := l.inFlight[agentID]; busy {
+		current.result.Hooks = append(current.result.Hooks, result)
+	}
+}
+
+// Current returns the operation in flight on the agent, or nil when there is none
+func (l *AgentOperationLocks) Current(agentID string) *models.OperationResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current, busy := l.inFlight[agentID]
+	if !busy {
+		return nil
+	}
+	result := current.result
+	result.Hooks = append([]models.HookResult(nil), result.Hooks...)
+	return &result
+}
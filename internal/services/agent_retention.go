@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AgentRetentionJob periodically purges agents that were soft-deleted longer ago than a maximum age
+type AgentRetentionJob struct {
+	agentService *AgentService
+	maxAge       time.Duration
+	interval     time.Duration
+	logger       *zap.Logger
+}
+
+// NewAgentRetentionJob creates a new AgentRetentionJob
+func NewAgentRetentionJob(agentService *AgentService, maxAge, interval time.Duration, logger *zap.Logger) *AgentRetentionJob {
+	return &AgentRetentionJob{
+		agentService: agentService,
+		maxAge:       maxAge,
+		interval:     interval,
+		logger:       logger,
+	}
+}
+
+// Start runs the job every interval until ctx is cancelled; it does nothing when maxAge is not positive
+func (j *AgentRetentionJob) Start(ctx context.Context) {
+	if j.maxAge <= 0 || j.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			j.RunOnce()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce purges agents deleted more than maxAge ago and returns their IDs
+func (j *AgentRetentionJob) RunOnce() []string {
+	cutoff := time.Now().Add(-j.maxAge)
+	purged := j.agentService.PurgeDeletedAgents(cutoff)
+	if len(purged) > 0 {
+		j.logger.Info("purged deleted agents",
+			zap.Strings("agent_ids", purged),
+			zap.Time("cutoff", cutoff))
+	}
+	return purged
+}
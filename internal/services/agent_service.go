@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/definitions"
 	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/pkg/types"
 	"go.uber.org/zap"
@@ -26,6 +29,9 @@ type IAgentService interface {
 	// GetAgentStatus returns the status of an agent with the specified ID
 	GetAgentStatus(agentID string) (*AgentStatus, error)
 
+	// ListAgentStatuses returns the status of every agent that is not deleted, ordered by ID
+	ListAgentStatuses() ([]*AgentStatus, error)
+
 	// GetAgentExecution returns the execution details for the specified execution ID
 	GetAgentExecution(executionID string) (*models.AgentExecution, error)
 
@@ -38,9 +44,12 @@ type IAgentService interface {
 	// CancelExecution cancels the execution with the specified ID
 	CancelExecution(executionID string) error
 
-	// ListAgents returns a list of all available agent configurations
+	// ListAgents returns a list of all available agent configurations, ordered by ID
 	ListAgents() ([]*models.AgentConfiguration, error)
 
+	// QueryAgents returns the page of agents matching the options and how many match in total
+	QueryAgents(options AgentListOptions) ([]*models.AgentConfiguration, int, error)
+
 	// GetAgent returns the configuration for an agent with the specified ID
 	GetAgent(agentID string) (*models.AgentConfiguration, error)
 
@@ -50,21 +59,37 @@ type IAgentService interface {
 	// UpdateAgent updates an existing agent configuration
 	UpdateAgent(config *models.AgentConfiguration) error
 
-	// DeleteAgent deletes an agent configuration with the specified ID
+	// DeleteAgent removes an agent configuration with the specified ID immediately
 	DeleteAgent(agentID string) error
+
+	// SoftDeleteAgent marks an agent deleted, refusing while scheduled tasks run it unless force is set
+	SoftDeleteAgent(agentID string, force bool) (*AgentDeleteResult, error)
+
+	// RestoreAgent undoes the soft delete of an agent
+	RestoreAgent(agentID string) (*models.AgentConfiguration, error)
+
+	// ListDeletedAgents returns the soft-deleted agent configurations
+	ListDeletedAgents() ([]*models.AgentConfiguration, error)
+
+	// SetAgentEnabled enables or disables the agent with the specified ID
+	SetAgentEnabled(agentID string, enabled bool) error
 }
 
 // AgentStatus represents the current status of an agent
 type AgentStatus struct {
 	ID          string                    `json:"id"`
 	Name        string                    `json:"name"`
-	Status      string                    `json:"status"`      // "idle", "running", "error", "disabled"
+	Status      string                    `json:"status"`      // "idle", "running", "error", "disabled", "deleted"
 	Mode        types.AgentMode          `json:"mode"`
 	LastRun     *time.Time                `json:"last_run"`    // Time of last execution
 	NextRun     *time.Time                `json:"next_run"`    // Time of next scheduled execution (if applicable)
 	ActiveTasks int                       `json:"active_tasks"` // Number of active tasks
 	Executions  []*models.AgentExecution  `json:"executions"`
 	Health      AgentHealthStatus         `json:"health"`      // Health status of the agent
+	StdoutLogfile string                  `json:"stdout_logfile,omitempty"` // Current stdout log file, if logging is enabled
+	StderrLogfile string                  `json:"stderr_logfile,omitempty"` // Current stderr log file, if logging is enabled
+	Process     *models.ProcessStatus     `json:"process,omitempty"` // Persistent process state and failed starts, for persistent agents
+	Maintenance *models.MaintenanceStatus `json:"maintenance,omitempty"` // Current and next maintenance periods, when maintenance is configured
 }
 
 // AgentHealthStatus represents the health status of an agent
@@ -79,8 +104,8 @@ const (
 
 // AgentService provides a concrete implementation of IAgentService
 type AgentService struct {
-	// Agents is a map of agent configurations by ID
-	Agents map[string]*models.AgentConfiguration
+	// store keeps the agent configurations
+	store models.AgentStore
 
 	// ActiveExecutions tracks currently running executions
 	ActiveExecutions map[string]*models.AgentExecution
@@ -88,6 +113,43 @@ type AgentService struct {
 	// ExecutionResults stores the results of completed executions
 	ExecutionResults map[string]*models.ExecutionResult
 
+	// executionService, when set, is the source of execution activity for agent status
+	executionService IExecutionService
+
+	// schedulerService, when set, supplies the scheduled tasks targeting each agent
+	schedulerService ISchedulerService
+
+	// maintenance, when set, supplies each agent's maintenance periods
+	maintenance *MaintenanceService
+
+	// templates holds the agent templates by name
+	templates map[string]*models.AgentTemplate
+
+	// specs holds the configuration of each agent as it was given, before its template and the
+	// defaults were merged in, so template updates and new defaults can be merged again
+	specs map[string]*models.AgentConfiguration
+
+	// defaults holds the server-wide agent settings merged in after templates, nil for none
+	defaults *models.AgentConfiguration
+
+	// appliedDefaults holds the defaults each agent was last merged with, so template updates
+	// leave agents with the defaults they had
+	appliedDefaults map[string]*models.AgentConfiguration
+
+	// propagateTemplates merges template updates into the agents already using the template;
+	// when false only agents registered or updated afterwards see them
+	propagateTemplates bool
+
+	// groups holds the agent groups by name
+	groups map[string]*models.AgentGroup
+
+	// templateMutex serializes changes to templates, groups and the agents they reference
+	templateMutex sync.Mutex
+
+	// strictValidation rejects agents whose executable or directories fail the filesystem checks;
+	// when false the failures are only logged
+	strictValidation bool
+
 	// logger for logging
 	logger *zap.Logger
 }
@@ -105,36 +167,86 @@ func NewAgentService(logger *zap.Logger) *AgentService {
 	}
 
 	return &AgentService{
-		Agents:           make(map[string]*models.AgentConfiguration),
-		ActiveExecutions: make(map[string]*models.AgentExecution),
-		ExecutionResults: make(map[string]*models.ExecutionResult),
-		logger:           logger,
+		store:              models.NewInMemoryAgentStore(),
+		ActiveExecutions:   make(map[string]*models.AgentExecution),
+		ExecutionResults:   make(map[string]*models.ExecutionResult),
+		templates:          make(map[string]*models.AgentTemplate),
+		specs:              make(map[string]*models.AgentConfiguration),
+		appliedDefaults:    make(map[string]*models.AgentConfiguration),
+		groups:             make(map[string]*models.AgentGroup),
+		propagateTemplates: true,
+		strictValidation:   true,
+		logger:             logger,
 	}
 }
 
+// SetAgentStore replaces the store keeping the agent configurations; it is set before agents are
+// registered
+func (as *AgentService) SetAgentStore(store models.AgentStore) {
+	as.store = store
+}
+
+// SetExecutionService sets the execution service used to derive agent status
+func (as *AgentService) SetExecutionService(executionService IExecutionService) {
+	as.executionService = executionService
+}
+
+// SetSchedulerService sets the scheduler used to report an agent's scheduled tasks
+func (as *AgentService) SetSchedulerService(schedulerService ISchedulerService) {
+	as.schedulerService = schedulerService
+}
+
+// SetMaintenanceService sets the maintenance windows reported in agent status
+func (as *AgentService) SetMaintenanceService(maintenance *MaintenanceService) {
+	as.maintenance = maintenance
+}
+
+// SetStrictValidation sets whether failed filesystem checks reject an agent or are only logged
+func (as *AgentService) SetStrictValidation(strict bool) {
+	as.strictValidation = strict
+}
+
+// EnforcesFilesystemChecks reports whether failed filesystem checks reject the agent
+func (as *AgentService) EnforcesFilesystemChecks(config *models.AgentConfiguration) bool {
+	return as.strictValidation && !config.SkipFSChecks
+}
+
 // RegisterAgent registers a new agent configuration
 func (as *AgentService) RegisterAgent(config *models.AgentConfiguration) error {
 	if config == nil {
 		return errors.New("agent configuration cannot be nil")
 	}
 
-	// Validate configuration comprehensively
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	// Merge in the agent's template, if any, and the defaults, and validate the result comprehensively
+	spec := config
+	config, err := as.resolveConfig(spec)
+	if err != nil {
+		return err
+	}
 	if err := as.ValidateAgentConfiguration(config); err != nil {
 		as.logger.Error("invalid agent configuration", zap.Error(err))
-		return fmt.Errorf("invalid agent configuration: %w", err)
+		return fmt.Errorf("%w: %w", models.ErrInvalidAgent, err)
 	}
 
 	// Check if agent with this ID already exists
-	if _, exists := as.Agents[config.ID]; exists {
-		return fmt.Errorf("agent with ID %s already exists", config.ID)
+	if existing, err := as.store.GetAgent(config.ID); err == nil && existing.IsDeleted() {
+		return models.NewKindError(models.ErrAgentConflict, "agent with ID %s is deleted; restore it or wait until it is purged", config.ID)
 	}
 
 	// Set timestamps
 	config.CreatedAt = time.Now()
 	config.UpdatedAt = time.Now()
+	config.DeletedAt = nil
 
-	// Store the agent configuration
-	as.Agents[config.ID] = config
+	// Store the agent configuration; the store refuses an ID that is taken, even when another
+	// supervisor sharing it registered the agent since the check above
+	if err := as.store.CreateAgent(config); err != nil {
+		return err
+	}
+	as.storeSpec(spec)
 
 	as.logger.Info("agent registered successfully",
 		zap.String("agent_id", config.ID),
@@ -145,19 +257,58 @@ func (as *AgentService) RegisterAgent(config *models.AgentConfiguration) error {
 
 // GetAgent returns the configuration for an agent with the specified ID
 func (as *AgentService) GetAgent(agentID string) (*models.AgentConfiguration, error) {
-	config, exists := as.Agents[agentID]
-	if !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
+	return as.store.GetAgent(agentID)
+}
+
+// ListAgents returns a list of all available agent configurations ordered by ID; soft-deleted agents
+// are left out
+func (as *AgentService) ListAgents() ([]*models.AgentConfiguration, error) {
+	configs, _, err := as.QueryAgents(AgentListOptions{})
+	return configs, err
+}
+
+// QueryAgents returns the agents matching the options' filters, sorted and paged as they ask, along
+// with how many agents match across all pages
+func (as *AgentService) QueryAgents(options AgentListOptions) ([]*models.AgentConfiguration, int, error) {
+	if err := options.Validate(); err != nil {
+		return nil, 0, err
 	}
 
-	return config, nil
+	stored, err := as.store.ListAgents()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	configs := []*models.AgentConfiguration{}
+	for _, config := range stored {
+		if config.IsDeleted() && !options.IncludeDeleted {
+			continue
+		}
+		if options.Enabled != nil && config.Enabled != *options.Enabled {
+			continue
+		}
+		if options.AccessType != "" && config.AccessType != options.AccessType {
+			continue
+		}
+		configs = append(configs, config)
+	}
+
+	total := len(configs)
+	return sortAndPage(configs, options.ListOptions, agentListKeys), total, nil
 }
 
-// ListAgents returns a list of all available agent configurations
-func (as *AgentService) ListAgents() ([]*models.AgentConfiguration, error) {
+// ListDeletedAgents returns the soft-deleted agent configurations
+func (as *AgentService) ListDeletedAgents() ([]*models.AgentConfiguration, error) {
+	stored, err := as.store.ListAgents()
+	if err != nil {
+		return nil, err
+	}
+
 	var configs []*models.AgentConfiguration
-	for _, config := range as.Agents {
-		configs = append(configs, config)
+	for _, config := range stored {
+		if config.IsDeleted() {
+			configs = append(configs, config)
+		}
 	}
 
 	return configs, nil
@@ -169,23 +320,41 @@ func (as *AgentService) UpdateAgent(config *models.AgentConfiguration) error {
 		return errors.New("agent configuration cannot be nil")
 	}
 
-	// Validate configuration comprehensively
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	// Merge in the agent's template, if any, and the defaults, and validate the result comprehensively
+	spec := config
+	config, err := as.resolveConfig(spec)
+	if err != nil {
+		return err
+	}
 	if err := as.ValidateAgentConfiguration(config); err != nil {
 		as.logger.Error("invalid agent configuration", zap.Error(err))
-		return fmt.Errorf("invalid agent configuration: %w", err)
+		return fmt.Errorf("%w: %w", models.ErrInvalidAgent, err)
 	}
 
 	// Check if agent with this ID exists
-	_, exists := as.Agents[config.ID]
-	if !exists {
+	existing, err := as.store.GetAgent(config.ID)
+	if errors.Is(err, models.ErrAgentNotFound) {
 		return fmt.Errorf("agent with ID %s does not exist", config.ID)
 	}
+	if err != nil {
+		return err
+	}
+	if existing.IsDeleted() {
+		return models.NewKindError(models.ErrAgentDeleted, "agent with ID %s is deleted", config.ID)
+	}
 
 	// Update timestamps
 	config.UpdatedAt = time.Now()
+	config.DeletedAt = nil
 
 	// Update the agent configuration
-	as.Agents[config.ID] = config
+	if err := as.store.SaveAgent(config); err != nil {
+		return err
+	}
+	as.storeSpec(spec)
 
 	as.logger.Info("agent updated successfully",
 		zap.String("agent_id", config.ID),
@@ -194,145 +363,239 @@ func (as *AgentService) UpdateAgent(config *models.AgentConfiguration) error {
 	return nil
 }
 
-// ValidateAgentConfiguration performs comprehensive validation of an agent configuration
+// SetAgentEnabled enables or disables an agent without revalidating the rest of its configuration
+func (as *AgentService) SetAgentEnabled(agentID string, enabled bool) error {
+	config, err := as.store.GetAgent(agentID)
+	if err != nil {
+		return err
+	}
+
+	// Replace the stored configuration so callers holding the old one see a consistent copy
+	updated := *config
+	updated.Enabled = enabled
+	updated.UpdatedAt = time.Now()
+	if err := as.store.SaveAgent(&updated); err != nil {
+		return err
+	}
+
+	as.logger.Info("agent enabled state changed",
+		zap.String("agent_id", agentID),
+		zap.Bool("enabled", enabled))
+
+	return nil
+}
+
+// ValidateAgentConfiguration performs comprehensive validation of an agent configuration,
+// returning every problem found as models.ValidationErrors
 func (as *AgentService) ValidateAgentConfiguration(config *models.AgentConfiguration) error {
 	if config == nil {
 		return errors.New("agent configuration cannot be nil")
 	}
 
-	// Use the built-in Validate method first
-	if err := config.Validate(); err != nil {
-		return fmt.Errorf("basic validation failed: %w", err)
+	// The definition itself is checked as supervisorctl lint checks it
+	errs, warnings := definitions.ValidateAgent(config)
+	for _, warning := range warnings {
+		as.logger.Warn("agent configuration warning",
+			zap.String("agent_id", config.ID),
+			zap.String("field", warning.Field),
+			zap.String("reason", warning.Message))
 	}
 
-	// Perform additional validation for working directory and environment variables (T036)
-	if err := as.validateWorkingDirectoryAndEnvVars(config); err != nil {
-		return fmt.Errorf("working directory or environment variable validation failed: %w", err)
-	}
+	// Make sure the executable and the agent's directories exist and are usable
+	as.validateFilesystem(config, &errs)
 
-	// Perform input/output pattern validation (T037)
-	if err := as.validateInputOutputPatterns(config); err != nil {
-		return fmt.Errorf("input/output pattern validation failed: %w", err)
+	// Make sure the agent's user, group, nice level and resource limits can be applied here
+	if err := agents.CheckProcessLimits(config); err != nil {
+		errs.AddError("", models.ValidationUnavailable, err)
 	}
-
-	// Perform access type validation (T038)
-	if err := as.validateAccessType(config); err != nil {
-		return fmt.Errorf("access type validation failed: %w", err)
+	for _, warning := range agents.UnsupportedProcessLimits(config) {
+		as.logger.Warn("agent process limit ignored",
+			zap.String("agent_id", config.ID),
+			zap.String("field", warning.Field),
+			zap.String("reason", warning.String()))
 	}
 
-	return nil
+	return errs.Err()
 }
 
-// validateWorkingDirectoryAndEnvVars validates the working directory and environment variables (T036)
-func (as *AgentService) validateWorkingDirectoryAndEnvVars(config *models.AgentConfiguration) error {
-	// Validate working directory exists if specified
-	if config.WorkingDirectory != "" {
-		// In a real implementation, we would check if the directory exists
-		// For now, we'll just log it
-		as.logger.Debug("validating working directory",
-			zap.String("agent_id", config.ID),
-			zap.String("working_directory", config.WorkingDirectory))
+// validateFilesystem runs the filesystem checks, logging their failures instead of reporting them
+// when validation is not strict or the agent opts out with skip_fs_checks
+func (as *AgentService) validateFilesystem(config *models.AgentConfiguration, errs *models.ValidationErrors) {
+	issues := agents.CheckFilesystem(config)
+	if len(issues) == 0 {
+		return
 	}
 
-	// Validate environment variables don't contain sensitive data in their keys
-	for key := range config.Envs {
-		if as.isPotentialSensitiveKey(key) {
-			return fmt.Errorf("environment variable key '%s' might contain sensitive information", key)
+	if !as.EnforcesFilesystemChecks(config) {
+		for _, issue := range issues {
+			as.logger.Warn("agent filesystem check failed",
+				zap.String("agent_id", config.ID),
+				zap.String("field", issue.Field),
+				zap.Error(issue.Err))
 		}
+		return
 	}
 
-	return nil
+	for _, issue := range issues {
+		*errs = append(*errs, models.NewFieldError(issue.Field, models.ValidationUnavailable, issue))
+	}
 }
 
-// validateInputOutputPatterns validates the input and output patterns (T037)
-func (as *AgentService) validateInputOutputPatterns(config *models.AgentConfiguration) error {
-	// Validate input/output patterns are compatible
-	// For example, if using file patterns, ensure the templates are properly formatted
-
-	if config.InputPattern == models.FilePattern && config.InputFileTemplate == "" {
-		return fmt.Errorf("input file pattern requires an input file template")
-	}
+// DeleteAgent deletes an agent configuration with the specified ID
+func (as *AgentService) DeleteAgent(agentID string) error {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
 
-	if config.OutputPattern == models.FilePatternOut && config.OutputFileTemplate == "" {
-		return fmt.Errorf("output file pattern requires an output file template")
+	// Delete the agent configuration
+	if err := as.store.DeleteAgent(agentID); err != nil {
+		return err
 	}
+	as.forgetSpec(agentID)
+	as.removeFromGroups(agentID)
+	go agents.StopPersistentProcess(agentID)
 
-	// Additional pattern compatibility checks can be added here
-	switch {
-	case config.InputPattern == models.JsonRpcPattern && config.OutputPattern != models.JsonRpcPatternOut:
-		as.logger.Warn("input/output patterns might not be compatible",
-			zap.String("agent_id", config.ID),
-			zap.String("input_pattern", string(config.InputPattern)),
-			zap.String("output_pattern", string(config.OutputPattern)),
-		)
-	case config.OutputPattern == models.JsonRpcPatternOut && config.InputPattern != models.JsonRpcPattern:
-		as.logger.Warn("input/output patterns might not be compatible",
-			zap.String("agent_id", config.ID),
-			zap.String("input_pattern", string(config.InputPattern)),
-			zap.String("output_pattern", string(config.OutputPattern)),
-		)
-	}
+	as.logger.Info("agent deleted successfully",
+		zap.String("agent_id", agentID))
 
 	return nil
 }
 
-// validateAccessType validates the access type (T038)
-func (as *AgentService) validateAccessType(config *models.AgentConfiguration) error {
-	// Already validated in basic validation, but we can add more complex logic here
-	// For example, ensure MaxConcurrentExecutions is properly set based on AccessType
-	switch config.AccessType {
-	case models.ReadOnlyAccessType:
-		if config.MaxConcurrentExecutions <= 0 {
-			config.MaxConcurrentExecutions = 10 // Default to 10 for read-only agents
+// AgentDeleteResult reports the soft delete of an agent
+type AgentDeleteResult struct {
+	AgentID     string    `json:"agent_id"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	PausedTasks []string  `json:"paused_tasks"` // Active tasks running the agent that a forced delete paused
+	Groups      []string  `json:"removed_from_groups,omitempty"` // Agent groups the agent was taken out of; restoring it does not add it back
+}
+
+// SoftDeleteAgent marks an agent deleted: it is hidden from ListAgents, its executions are rejected
+// and it can be restored until PurgeDeletedAgents removes it. While scheduled tasks run the agent
+// the delete is refused with an AgentInUseError, unless force is set, which pauses the active ones
+// so they don't fail on their next run.
+func (as *AgentService) SoftDeleteAgent(agentID string, force bool) (*AgentDeleteResult, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	config, err := as.store.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if config.IsDeleted() {
+		return nil, models.NewKindError(models.ErrAgentDeleted, "agent with ID %s is already deleted", agentID)
+	}
+
+	tasks, err := as.referencingTasks(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) > 0 && !force {
+		taskIDs := make([]string, 0, len(tasks))
+		for _, task := range tasks {
+			taskIDs = append(taskIDs, task.ID)
+		}
+		return nil, &models.AgentInUseError{AgentID: agentID, TaskIDs: taskIDs}
+	}
+
+	result := &AgentDeleteResult{AgentID: agentID, DeletedAt: time.Now(), PausedTasks: []string{}}
+	for _, task := range tasks {
+		if !task.IsActive() {
+			continue
 		}
-	case models.ReadWriteAccessType:
-		if config.MaxConcurrentExecutions != 1 {
-			return fmt.Errorf("read-write agents must have MaxConcurrentExecutions equal to 1, got %d", config.MaxConcurrentExecutions)
+		if err := as.schedulerService.PauseTask(task.ID); err != nil {
+			return result, fmt.Errorf("failed to pause task %s of deleted agent %s: %w", task.ID, agentID, err)
 		}
-	default:
-		return fmt.Errorf("invalid access type: %s", config.AccessType)
+		result.PausedTasks = append(result.PausedTasks, task.ID)
 	}
 
-	return nil
+	// Replace the stored configuration so callers holding the old one see a consistent copy
+	deleted := *config
+	deleted.DeletedAt = &result.DeletedAt
+	deleted.UpdatedAt = result.DeletedAt
+	if err := as.store.SaveAgent(&deleted); err != nil {
+		return result, err
+	}
+	result.Groups = as.removeFromGroups(agentID)
+	go agents.StopPersistentProcess(agentID)
+
+	as.logger.Info("agent soft-deleted",
+		zap.String("agent_id", agentID),
+		zap.Strings("paused_tasks", result.PausedTasks),
+		zap.Strings("removed_from_groups", result.Groups))
+
+	return result, nil
 }
 
-// isPotentialSensitiveKey checks if an environment variable key might contain sensitive data
-func (as *AgentService) isPotentialSensitiveKey(key string) bool {
-	// Convert to lowercase for comparison
-	lowerKey := strings.ToLower(key)
+// RestoreAgent undoes the soft delete of an agent. Tasks paused by a forced delete stay paused.
+func (as *AgentService) RestoreAgent(agentID string) (*models.AgentConfiguration, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
 
-	// Check for common sensitive key patterns
-	sensitivePatterns := []string{
-		"password", "secret", "key", "token", "auth", "credential", "private", "api", "cert", "ssl", "tls",
+	config, err := as.store.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if !config.IsDeleted() {
+		return nil, models.NewKindError(models.ErrAgentConflict, "agent with ID %s is not deleted", agentID)
 	}
 
-	for _, pattern := range sensitivePatterns {
-		if strings.Contains(lowerKey, pattern) {
-			return true
-		}
+	restored := *config
+	restored.DeletedAt = nil
+	restored.UpdatedAt = time.Now()
+	if err := as.store.SaveAgent(&restored); err != nil {
+		return nil, err
 	}
 
-	return false
+	as.logger.Info("agent restored", zap.String("agent_id", agentID))
+
+	return &restored, nil
 }
 
-// DeleteAgent deletes an agent configuration with the specified ID
-func (as *AgentService) DeleteAgent(agentID string) error {
-	// Check if agent with this ID exists
-	_, exists := as.Agents[agentID]
-	if !exists {
-		return fmt.Errorf("agent with ID %s not found", agentID)
+// PurgeDeletedAgents removes the agents soft-deleted before cutoff and returns their IDs
+func (as *AgentService) PurgeDeletedAgents(cutoff time.Time) []string {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	stored, err := as.store.ListAgents()
+	if err != nil {
+		as.logger.Error("failed to list agents to purge", zap.Error(err))
+		return nil
 	}
 
-	// TODO: Check if agent is currently in use before deletion
-	// For now, we'll allow deletion
+	var purged []string
+	for _, config := range stored {
+		if config.IsDeleted() && config.DeletedAt.Before(cutoff) {
+			// Another supervisor sharing the store may have purged it already
+			if err := as.store.DeleteAgent(config.ID); err != nil && !errors.Is(err, models.ErrAgentNotFound) {
+				as.logger.Error("failed to purge deleted agent", zap.String("agent_id", config.ID), zap.Error(err))
+				continue
+			}
+			as.forgetSpec(config.ID)
+			purged = append(purged, config.ID)
+		}
+	}
+	sort.Strings(purged)
+	return purged
+}
 
-	// Delete the agent configuration
-	delete(as.Agents, agentID)
+// referencingTasks returns the scheduled tasks that run the agent, ordered by ID
+func (as *AgentService) referencingTasks(agentID string) ([]*models.ScheduledTask, error) {
+	if as.schedulerService == nil {
+		return nil, nil
+	}
 
-	as.logger.Info("agent deleted successfully",
-		zap.String("agent_id", agentID))
+	tasks, err := as.schedulerService.ListScheduledTasks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled tasks: %w", err)
+	}
 
-	return nil
+	var referencing []*models.ScheduledTask
+	for _, task := range tasks {
+		if task.AgentID == agentID {
+			referencing = append(referencing, task)
+		}
+	}
+	sort.Slice(referencing, func(i, j int) bool { return referencing[i].ID < referencing[j].ID })
+	return referencing, nil
 }
 
 // ExecuteAgent executes an agent with the specified ID and input string
@@ -355,38 +618,133 @@ func (as *AgentService) ExecuteAgentWithOptions(ctx context.Context, agentID str
 
 // GetAgentStatus returns the status of an agent with the specified ID
 func (as *AgentService) GetAgentStatus(agentID string) (*AgentStatus, error) {
-	config, exists := as.Agents[agentID]
-	if !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
+	config, err := as.store.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	agentStatus := &AgentStatus{
+		ID:         config.ID,
+		Name:       config.Name,
+		Status:     "idle",
+		Mode:       config.Mode,
+		Executions: []*models.AgentExecution{},
+		Health:     AgentHealthy, // No health checks exist yet, so registered agents are assumed healthy
+
+		StdoutLogfile: agents.LogfilePath(config, config.StdoutLogfile),
+		StderrLogfile: agents.LogfilePath(config, config.StderrLogfile),
+	}
+	if config.IsDeleted() {
+		agentStatus.Status = "deleted"
+	} else if !config.Enabled {
+		agentStatus.Status = "disabled"
 	}
 
-	// For now, we'll set a simple status based on whether there are active executions
-	status := "idle"
-	activeExecutions, err := as.ListActiveExecutions()
+	// Only this agent's executions count towards its status
+	executions, err := as.agentExecutions(agentID)
 	if err != nil {
-		status = "error"
-	} else if len(activeExecutions) > 0 {
-		status = "running"
+		as.logger.Warn("failed to list agent executions", zap.String("agent_id", agentID), zap.Error(err))
+		agentStatus.Status = "error"
+		agentStatus.Health = AgentUnknown
+	}
+	for _, execution := range executions {
+		switch execution.State {
+		case models.StartingState, models.RunningState:
+			agentStatus.Executions = append(agentStatus.Executions, execution)
+		default:
+			if execution.EndTime != nil && (agentStatus.LastRun == nil || execution.EndTime.After(*agentStatus.LastRun)) {
+				lastRun := *execution.EndTime
+				agentStatus.LastRun = &lastRun
+			}
+		}
+	}
+	if len(agentStatus.Executions) > 0 {
+		agentStatus.Status = "running"
 	}
 
-	agentStatus := &AgentStatus{
-		ID:     config.ID,
-		Name:   config.Name,
-		Status: status,
-		Mode:   config.Mode,
-		Health: AgentHealthy, // Default to healthy
+	if process, ok := agents.PersistentProcessStatus(agentID); ok {
+		agentStatus.Process = &process
+		switch process.State {
+		case models.ProcessFatal:
+			agentStatus.Status = "error"
+			agentStatus.Health = AgentUnhealthy
+		case models.ProcessBackoff, models.ProcessDegraded:
+			agentStatus.Health = AgentDegraded
+		}
+	}
+
+	as.fillScheduleStatus(agentStatus)
+
+	if as.maintenance != nil {
+		agentStatus.Maintenance = as.maintenance.StatusOf(config)
+	}
+
+	return agentStatus, nil
+}
+
+// ListAgentStatuses returns the status of every agent that is not deleted, ordered by ID
+func (as *AgentService) ListAgentStatuses() ([]*AgentStatus, error) {
+	configs, err := as.ListAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*AgentStatus, 0, len(configs))
+	for _, config := range configs {
+		status, err := as.GetAgentStatus(config.ID)
+		if errors.Is(err, models.ErrAgentNotFound) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// agentExecutions returns the executions of an agent, preferring the execution service when one is set
+func (as *AgentService) agentExecutions(agentID string) ([]*models.AgentExecution, error) {
+	if as.executionService != nil {
+		return as.executionService.ListExecutions(agentID)
 	}
 
-	// Find executions for this agent
 	var executions []*models.AgentExecution
 	for _, exec := range as.ActiveExecutions {
 		if exec.AgentID == agentID {
 			executions = append(executions, exec)
 		}
 	}
-	agentStatus.Executions = executions
+	return executions, nil
+}
 
-	return agentStatus, nil
+// fillScheduleStatus sets the number of active scheduled tasks targeting the agent and their earliest next run
+func (as *AgentService) fillScheduleStatus(agentStatus *AgentStatus) {
+	if as.schedulerService == nil {
+		return
+	}
+
+	tasks, err := as.schedulerService.ListScheduledTasks()
+	if err != nil {
+		as.logger.Warn("failed to list scheduled tasks", zap.String("agent_id", agentStatus.ID), zap.Error(err))
+		return
+	}
+
+	for _, task := range tasks {
+		if task.AgentID != agentStatus.ID || !task.IsActive() {
+			continue
+		}
+		agentStatus.ActiveTasks++
+
+		nextRun, err := as.schedulerService.GetNextRun(task.ID)
+		if err != nil || nextRun == nil {
+			continue
+		}
+		if agentStatus.NextRun == nil || nextRun.Before(*agentStatus.NextRun) {
+			agentStatus.NextRun = nextRun
+		}
+	}
 }
 
 // GetAgentExecution returns the execution details for the specified execution ID
@@ -398,7 +756,7 @@ func (as *AgentService) GetAgentExecution(executionID string) (*models.AgentExec
 
 	// For now, we'll return not found
 	// In a complete implementation, we'd check a persistence store for completed executions
-	return nil, fmt.Errorf("execution with ID %s not found", executionID)
+	return nil, models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
 }
 
 // ListAgentExecutions returns a list of executions for the specified agent ID
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// AgentStatusETag returns a weak ETag of agent statuses. It changes when an agent's state, health,
+// process, counts or runs do, so a client holding it can tell the statuses were not worth
+// downloading again.
+func AgentStatusETag(statuses ...*AgentStatus) string {
+	hash := sha256.New()
+	for _, status := range statuses {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%d\x00%s\x00%s",
+			status.ID, status.Status, status.Health, status.ActiveTasks, etagTime(status.LastRun), etagTime(status.NextRun))
+		for _, execution := range status.Executions {
+			fmt.Fprintf(hash, "\x00%s:%s", execution.ID, execution.State)
+		}
+		if status.Process != nil {
+			fmt.Fprintf(hash, "\x00%s\x00%d\x00%d\x00%d",
+				status.Process.State, status.Process.PID, status.Process.Restarts, status.Process.ConsecutiveFailures)
+		}
+		if status.Maintenance != nil {
+			fmt.Fprintf(hash, "\x00%t", status.Maintenance.Active)
+		}
+		hash.Write([]byte{'\n'})
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagTime formats an optional time for an ETag, empty when it is unset
+func etagTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
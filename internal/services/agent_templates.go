@@ -0,0 +1,220 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// IAgentTemplateService interface for managing the templates agents inherit settings from
+type IAgentTemplateService interface {
+	// CreateTemplate stores a new agent template
+	CreateTemplate(template *models.AgentTemplate) error
+
+	// UpdateTemplate replaces the settings of an existing agent template
+	UpdateTemplate(template *models.AgentTemplate) error
+
+	// DeleteTemplate removes an agent template no agent uses
+	DeleteTemplate(name string) error
+
+	// GetTemplate returns an agent template by its name
+	GetTemplate(name string) (*models.AgentTemplate, error)
+
+	// ListTemplates returns all agent templates, ordered by name
+	ListTemplates() ([]*models.AgentTemplate, error)
+
+	// GetAgentSpec returns an agent's configuration as it was registered, before its template and
+	// the defaults were merged in
+	GetAgentSpec(agentID string) (*models.AgentConfiguration, error)
+}
+
+// SetTemplatePropagation sets whether template updates are merged into the agents already using the
+// template, or only apply to agents registered or updated afterwards
+func (as *AgentService) SetTemplatePropagation(propagate bool) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+	as.propagateTemplates = propagate
+}
+
+// CreateTemplate stores a new agent template
+func (as *AgentService) CreateTemplate(template *models.AgentTemplate) error {
+	if err := template.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", models.ErrInvalidAgent, err)
+	}
+
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	if _, exists := as.templates[template.Name]; exists {
+		return models.NewKindError(models.ErrTemplateConflict, "agent template %s already exists", template.Name)
+	}
+
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = template.CreatedAt
+	as.templates[template.Name] = template
+
+	as.logger.Info("agent template created", zap.String("template", template.Name))
+	return nil
+}
+
+// UpdateTemplate replaces the settings of an existing agent template. When propagation is on, the
+// agents using the template are merged again, with the defaults they were given, and the update is
+// rejected if any of them would become invalid; they keep their enabled state and timestamps.
+func (as *AgentService) UpdateTemplate(template *models.AgentTemplate) error {
+	if err := template.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", models.ErrInvalidAgent, err)
+	}
+
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	existing, exists := as.templates[template.Name]
+	if !exists {
+		return models.NewKindError(models.ErrTemplateNotFound, "agent template %s not found", template.Name)
+	}
+
+	var updated []*models.AgentConfiguration
+	if as.propagateTemplates {
+		for _, agentID := range as.templateAgents(template.Name) {
+			current, err := as.store.GetAgent(agentID)
+			if err != nil {
+				return err
+			}
+			merged := models.ApplyDefaults(template.Apply(as.specs[agentID]), as.appliedDefaults[agentID])
+			merged.Enabled = current.Enabled
+			merged.CreatedAt = current.CreatedAt
+			if err := as.ValidateAgentConfiguration(merged); err != nil {
+				return models.NewKindError(models.ErrInvalidAgent, "template update would make agent %s invalid: %v", agentID, err)
+			}
+			updated = append(updated, merged)
+		}
+	}
+
+	template.CreatedAt = existing.CreatedAt
+	template.UpdatedAt = time.Now()
+	as.templates[template.Name] = template
+	for _, config := range updated {
+		config.UpdatedAt = template.UpdatedAt
+		if err := as.store.SaveAgent(config); err != nil {
+			return err
+		}
+	}
+
+	as.logger.Info("agent template updated",
+		zap.String("template", template.Name),
+		zap.Int("agents_updated", len(updated)))
+	return nil
+}
+
+// DeleteTemplate removes an agent template; templates still used by agents cannot be deleted
+func (as *AgentService) DeleteTemplate(name string) error {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	if _, exists := as.templates[name]; !exists {
+		return models.NewKindError(models.ErrTemplateNotFound, "agent template %s not found", name)
+	}
+	if agentIDs := as.templateAgents(name); len(agentIDs) > 0 {
+		return models.NewKindError(models.ErrTemplateInUse, "agent template %s is used by agents %s", name, strings.Join(agentIDs, ", "))
+	}
+
+	delete(as.templates, name)
+
+	as.logger.Info("agent template deleted", zap.String("template", name))
+	return nil
+}
+
+// GetTemplate returns an agent template by its name
+func (as *AgentService) GetTemplate(name string) (*models.AgentTemplate, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	template, exists := as.templates[name]
+	if !exists {
+		return nil, models.NewKindError(models.ErrTemplateNotFound, "agent template %s not found", name)
+	}
+	return template, nil
+}
+
+// ListTemplates returns all agent templates, ordered by name
+func (as *AgentService) ListTemplates() ([]*models.AgentTemplate, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	templates := make([]*models.AgentTemplate, 0, len(as.templates))
+	for _, template := range as.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// GetAgentSpec returns a copy of an agent's configuration as it was registered, before its template
+// and the defaults were merged in, with the agent's current enabled state and timestamps. Agents
+// registered elsewhere, such as by another supervisor sharing the store, return a copy of their
+// configuration.
+func (as *AgentService) GetAgentSpec(agentID string) (*models.AgentConfiguration, error) {
+	as.templateMutex.Lock()
+	defer as.templateMutex.Unlock()
+
+	current, err := as.store.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := *current
+	if stored, ok := as.specs[agentID]; ok {
+		spec = *stored
+		spec.Enabled = current.Enabled
+		spec.CreatedAt = current.CreatedAt
+		spec.UpdatedAt = current.UpdatedAt
+	}
+	return &spec, nil
+}
+
+// resolveTemplate returns config merged with the template it names, or config itself when it names
+// none. The caller must hold templateMutex.
+func (as *AgentService) resolveTemplate(config *models.AgentConfiguration) (*models.AgentConfiguration, error) {
+	if config.Template == "" {
+		return config, nil
+	}
+
+	template, exists := as.templates[config.Template]
+	if !exists {
+		return nil, models.NewKindError(models.ErrInvalidAgent, "agent %s references unknown template %s", config.ID, config.Template)
+	}
+	return template.Apply(config), nil
+}
+
+// storeSpec remembers the configuration an agent was given and the defaults it was merged with.
+// The caller must hold templateMutex.
+func (as *AgentService) storeSpec(spec *models.AgentConfiguration) {
+	stored := *spec
+	as.specs[spec.ID] = &stored
+	as.appliedDefaults[spec.ID] = as.defaults
+}
+
+// forgetSpec forgets the configuration an agent was given. The caller must hold templateMutex.
+func (as *AgentService) forgetSpec(agentID string) {
+	delete(as.specs, agentID)
+	delete(as.appliedDefaults, agentID)
+}
+
+// templateAgents returns the IDs of the agents using the named template, sorted. The caller must
+// hold templateMutex.
+func (as *AgentService) templateAgents(name string) []string {
+	var agentIDs []string
+	for agentID, spec := range as.specs {
+		if spec.Template == name {
+			agentIDs = append(agentIDs, agentID)
+		}
+	}
+	sort.Strings(agentIDs)
+	return agentIDs
+}
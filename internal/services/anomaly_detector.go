@@ -0,0 +1,196 @@
+package services
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// AnomalyConfig sets when finished executions are flagged as anomalous against the recent
+// executions of their agent and of their task
+type AnomalyConfig struct {
+	Window               int     // Recent executions of each agent and task a baseline covers
+	MinSamples           int     // Executions a baseline needs before anything is flagged against it
+	DurationStdDevs      float64 // duration_high needs a duration this many standard deviations above the mean
+	DurationMinRatio     float64 // and at least this multiple of the mean
+	FailureRateThreshold float64 // failure_rate_high once this share of a baseline failed, 0 to never flag
+}
+
+// DefaultAnomalyConfig returns the anomaly settings used when none are configured
+func DefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{
+		Window:               50,
+		MinSamples:           10,
+		DurationStdDevs:      3,
+		DurationMinRatio:     2,
+		FailureRateThreshold: 0.5,
+	}
+}
+
+// withDefaults keeps the window and sample count usable
+func (c AnomalyConfig) withDefaults() AnomalyConfig {
+	if c.Window <= 0 {
+		c.Window = DefaultAnomalyConfig().Window
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = 1
+	}
+	return c
+}
+
+// AnomalyDetector keeps a rolling window of the recent executions of every agent and task and
+// flags executions whose duration or failure deviates from them. A baseline's failure rate anomaly
+// appears once when the rate crosses the threshold and again only after it fell back below it;
+// every long execution is a new duration anomaly.
+type AnomalyDetector struct {
+	config  AnomalyConfig
+	windows map[string][]*models.ExecutionHistory // Recent executions by agent:<id> and task:<id>, oldest first
+	failing map[string]bool                       // Baselines whose failure rate is at the threshold
+	mutex   sync.Mutex
+}
+
+// NewAnomalyDetector creates an AnomalyDetector without any history
+func NewAnomalyDetector(config AnomalyConfig) *AnomalyDetector {
+	return &AnomalyDetector{
+		config:  config.withDefaults(),
+		windows: make(map[string][]*models.ExecutionHistory),
+		failing: make(map[string]bool),
+	}
+}
+
+// SetConfig replaces the settings, e.g. after the config file is reloaded; windows longer than the
+// new window drop their oldest executions
+func (d *AnomalyDetector) SetConfig(config AnomalyConfig) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.config = config.withDefaults()
+	for key, window := range d.windows {
+		d.windows[key] = trimWindow(window, d.config.Window)
+	}
+}
+
+// Seed adds past executions to the baselines without flagging them, e.g. the execution history a
+// previous run stored. Fan-out runs are left out, their child entries record each agent's execution,
+// and so are skipped runs, which never executed.
+func (d *AnomalyDetector) Seed(histories []*models.ExecutionHistory) {
+	sorted := make([]*models.ExecutionHistory, 0, len(histories))
+	for _, history := range histories {
+		if history.FanOut == nil && history.Status != types.SkippedStatus {
+			sorted = append(sorted, history)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartTime.Before(sorted[j].StartTime) })
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	seeded := make(map[string]bool)
+	for _, history := range sorted {
+		for _, baseline := range anomalyBaselines(history) {
+			d.windows[baseline.key] = trimWindow(append(d.windows[baseline.key], history), d.config.Window)
+			seeded[baseline.key] = true
+		}
+	}
+	// A failure rate that was already high is not a new anomaly
+	for key := range seeded {
+		d.failing[key] = d.failureRateHigh(models.CalculateExecutionStats(d.windows[key]))
+	}
+}
+
+// Observe adds a finished execution to the baselines of its agent and task. Returns the anomalies
+// it is flagged with, and the anomalies that newly appeared with it.
+func (d *AnomalyDetector) Observe(record *models.ExecutionHistory) ([]string, []models.ExecutionAnomaly) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var flags []string
+	var appeared []models.ExecutionAnomaly
+	flag := func(anomaly string) {
+		for _, flagged := range flags {
+			if flagged == anomaly {
+				return
+			}
+		}
+		flags = append(flags, anomaly)
+	}
+
+	for _, baseline := range anomalyBaselines(record) {
+		// The duration is compared with the executions before this one
+		stats := models.CalculateExecutionStats(d.windows[baseline.key])
+		if d.durationHigh(stats, record.ExecutionTimeMs) {
+			flag(models.AnomalyDurationHigh)
+			appeared = append(appeared, anomalyFrom(models.AnomalyDurationHigh, baseline.scope, record, stats))
+		}
+
+		window := trimWindow(append(d.windows[baseline.key], record), d.config.Window)
+		d.windows[baseline.key] = window
+		stats = models.CalculateExecutionStats(window)
+		failing := d.failureRateHigh(stats)
+		if failing && !record.Status.Succeeded() {
+			flag(models.AnomalyFailureRateHigh)
+			if !d.failing[baseline.key] {
+				appeared = append(appeared, anomalyFrom(models.AnomalyFailureRateHigh, baseline.scope, record, stats))
+			}
+		}
+		d.failing[baseline.key] = failing
+	}
+	return flags, appeared
+}
+
+// durationHigh reports whether an execution taking durationMs is far above the baseline of stats
+func (d *AnomalyDetector) durationHigh(stats *models.ExecutionStats, durationMs int64) bool {
+	if stats.TotalExecutions < d.config.MinSamples {
+		return false
+	}
+	duration := float64(durationMs)
+	return duration > stats.AverageTimeMs+d.config.DurationStdDevs*stats.StdDevTimeMs &&
+		duration >= d.config.DurationMinRatio*stats.AverageTimeMs
+}
+
+// failureRateHigh reports whether the failure rate of a baseline is at the threshold
+func (d *AnomalyDetector) failureRateHigh(stats *models.ExecutionStats) bool {
+	return d.config.FailureRateThreshold > 0 && stats.TotalExecutions >= d.config.MinSamples &&
+		stats.FailureRate >= d.config.FailureRateThreshold
+}
+
+// anomalyBaseline names the baseline of an agent or a task
+type anomalyBaseline struct {
+	scope string
+	key   string
+}
+
+// anomalyBaselines returns the baselines an execution counts towards
+func anomalyBaselines(record *models.ExecutionHistory) []anomalyBaseline {
+	var baselines []anomalyBaseline
+	if record.AgentID != "" {
+		baselines = append(baselines, anomalyBaseline{scope: models.AnomalyScopeAgent, key: "agent:" + record.AgentID})
+	}
+	if record.TaskID != "" {
+		baselines = append(baselines, anomalyBaseline{scope: models.AnomalyScopeTask, key: "task:" + record.TaskID})
+	}
+	return baselines
+}
+
+// anomalyFrom describes an anomaly of record found against a baseline with stats
+func anomalyFrom(anomaly, scope string, record *models.ExecutionHistory, stats *models.ExecutionStats) models.ExecutionAnomaly {
+	return models.ExecutionAnomaly{
+		Anomaly:          anomaly,
+		Scope:            scope,
+		ExecutionTimeMs:  record.ExecutionTimeMs,
+		BaselineMeanMs:   stats.AverageTimeMs,
+		BaselineStdDevMs: stats.StdDevTimeMs,
+		FailureRate:      stats.FailureRate,
+		Samples:          stats.TotalExecutions,
+	}
+}
+
+// trimWindow drops the oldest executions of a window longer than size
+func trimWindow(window []*models.ExecutionHistory, size int) []*models.ExecutionHistory {
+	if len(window) > size {
+		window = append([]*models.ExecutionHistory(nil), window[len(window)-size:]...)
+	}
+	return window
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Default limits on the artifacts of one execution
+const (
+	DefaultMaxArtifacts          = 20
+	DefaultMaxArtifactTotalBytes = 100 << 20
+)
+
+// sniffLength is how much of an artifact its content type is sniffed from
+const sniffLength = 512
+
+// ArtifactStore keeps the files executions leave in their artifacts directory. Each execution gets
+// a directory named after its ID; after the execution the files in it are checked against the
+// count and total size limits, and the ones over a limit are deleted.
+type ArtifactStore struct {
+	dir           string
+	maxCount      int
+	maxTotalBytes int64
+	logger        *zap.Logger
+}
+
+// NewArtifactStore creates an ArtifactStore keeping artifacts under dir. maxCount and maxTotalBytes
+// limit the files kept per execution, 0 for the defaults.
+func NewArtifactStore(dir string, maxCount int, maxTotalBytes int64, logger *zap.Logger) *ArtifactStore {
+	if maxCount <= 0 {
+		maxCount = DefaultMaxArtifacts
+	}
+	if maxTotalBytes <= 0 {
+		maxTotalBytes = DefaultMaxArtifactTotalBytes
+	}
+	return &ArtifactStore{
+		dir:           dir,
+		maxCount:      maxCount,
+		maxTotalBytes: maxTotalBytes,
+		logger:        logger,
+	}
+}
+
+// Dir returns the artifacts directory of an execution
+func (s *ArtifactStore) Dir(executionID string) string {
+	return filepath.Join(s.dir, executionID)
+}
+
+// Prepare creates the owner-only artifacts directory of an execution and returns it
+func (s *ArtifactStore) Prepare(executionID string) (string, error) {
+	dir, err := filepath.Abs(s.Dir(executionID))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve artifacts directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+	return dir, nil
+}
+
+// Collect records the files an execution left in its artifacts directory, ordered by name. Files
+// beyond the count or total size limit, directories and links are deleted and returned as rejected.
+// The directory itself is removed when nothing is kept.
+func (s *ArtifactStore) Collect(executionID string) ([]models.Artifact, []models.RejectedArtifact, error) {
+	dir := s.Dir(executionID)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to read artifacts directory: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var artifacts []models.Artifact
+	var rejected []models.RejectedArtifact
+	var totalBytes int64
+	reject := func(name string, size int64, reason string) {
+		rejected = append(rejected, models.RejectedArtifact{Name: name, Size: size, Reason: reason})
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			s.logger.Warn("failed to remove rejected artifact",
+				zap.String("execution_id", executionID),
+				zap.String("artifact", name),
+				zap.Error(err))
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() {
+			reject(name, 0, "not a regular file")
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			reject(name, 0, fmt.Sprintf("cannot be read: %v", err))
+			continue
+		}
+		switch {
+		case len(artifacts) >= s.maxCount:
+			reject(name, info.Size(), fmt.Sprintf("exceeds the limit of %d artifacts per execution", s.maxCount))
+			continue
+		case totalBytes+info.Size() > s.maxTotalBytes:
+			reject(name, info.Size(), fmt.Sprintf("exceeds the limit of %d bytes of artifacts per execution", s.maxTotalBytes))
+			continue
+		}
+
+		artifact, err := describeArtifact(filepath.Join(dir, name), info)
+		if err != nil {
+			reject(name, info.Size(), fmt.Sprintf("cannot be read: %v", err))
+			continue
+		}
+		totalBytes += artifact.Size
+		artifacts = append(artifacts, artifact)
+	}
+
+	if len(artifacts) == 0 {
+		os.Remove(dir)
+	}
+	if len(rejected) > 0 {
+		s.logger.Warn("rejected execution artifacts",
+			zap.String("execution_id", executionID),
+			zap.Int("kept", len(artifacts)),
+			zap.Int("rejected", len(rejected)))
+	}
+	return artifacts, rejected, nil
+}
+
+// Open opens a kept artifact of an execution for reading
+func (s *ArtifactStore) Open(executionID, name string) (*os.File, error) {
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return nil, models.NewKindError(models.ErrArtifactNotFound, "artifact %s not found", name)
+	}
+	file, err := os.Open(filepath.Join(s.Dir(executionID), name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, models.NewKindError(models.ErrArtifactNotFound, "artifact %s of execution %s not found", name, executionID)
+		}
+		return nil, fmt.Errorf("failed to open artifact: %w", err)
+	}
+	return file, nil
+}
+
+// DeleteBefore deletes the artifacts of executions whose directory was last modified before cutoff
+// and returns how many executions' artifacts were removed
+func (s *ArtifactStore) DeleteBefore(cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read artifacts directory: %w", err)
+	}
+
+	deleted := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return deleted, fmt.Errorf("failed to delete artifacts of execution %s: %w", entry.Name(), err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// describeArtifact checksums a file and determines its content type
+func describeArtifact(path string, info os.FileInfo) (models.Artifact, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return models.Artifact{}, err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return models.Artifact{}, err
+	}
+	hash := sha256.New()
+	hash.Write(head[:n])
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return models.Artifact{}, err
+	}
+
+	return models.Artifact{
+		Name:        info.Name(),
+		Size:        int64(n) + size,
+		ContentType: artifactContentType(info.Name(), head[:n]),
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		ModifiedAt:  info.ModTime(),
+	}, nil
+}
+
+// artifactContentType sniffs the content type of an artifact. Content sniffing cannot tell CSV or
+// JSON from other text, so generic results defer to the file extension when it is known.
+func artifactContentType(name string, head []byte) string {
+	sniffed := http.DetectContentType(head)
+	if strings.HasPrefix(sniffed, "text/plain") || sniffed == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(filepath.Ext(name)); byExtension != "" {
+			return byExtension
+		}
+	}
+	return sniffed
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// DefaultAuditPageSize is the number of entries an audit query returns when it sets no limit
+	DefaultAuditPageSize = 100
+
+	// MaxAuditPageSize caps the number of entries one audit query returns
+	MaxAuditPageSize = 1000
+)
+
+// AuditFilter selects entries in AuditLog.Query; zero-valued fields match everything
+type AuditFilter struct {
+	Since  time.Time
+	Actor  string
+	Action string // Matches the action and the actions under it, e.g. agents matches agents.create
+	Offset int
+	Limit  int // DefaultAuditPageSize when 0, at most MaxAuditPageSize
+}
+
+// AuditPage is a page of the audit entries matching a filter, oldest first
+type AuditPage struct {
+	Entries []models.AuditEntry `json:"entries"`
+	Total   int                 `json:"total"` // Entries matching the filter across all pages
+	Offset  int                 `json:"offset"`
+	Limit   int                 `json:"limit"`
+}
+
+// AuditLog appends audit entries to a JSONL file that rotates to path.1 ... path.N, continuing the
+// entries' hash chain across rotations and restarts
+type AuditLog struct {
+	path    string
+	backups int
+	file    *agents.RotatingFile
+	logger  *zap.Logger
+
+	mutex         sync.Mutex
+	sequence      int64
+	lastHash      string
+	failClosed    bool
+	mirrorEnabled bool
+	mirrorLevel   zapcore.Level
+}
+
+// NewAuditLog opens the audit log at path, resuming the sequence and hash chain of its last entry
+func NewAuditLog(path string, maxBytes int64, backups int, logger *zap.Logger) (*AuditLog, error) {
+	al := &AuditLog{
+		path:    path,
+		backups: backups,
+		file:    agents.NewRotatingFile(path, maxBytes, backups),
+		logger:  logger,
+	}
+
+	// The newest entry is the last one of the current file, or of the latest backup after a rotation
+	for _, file := range []string{path, path + ".1"} {
+		var last *models.AuditEntry
+		err := readAuditFile(file, func(entry models.AuditEntry) error {
+			last = &entry
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			al.sequence = last.Sequence
+			al.lastHash = last.Hash
+			break
+		}
+	}
+	return al, nil
+}
+
+// SetFailClosed sets whether mutating requests are rejected while the audit log cannot be written
+func (al *AuditLog) SetFailClosed(failClosed bool) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	al.failClosed = failClosed
+}
+
+// FailClosed reports whether mutating requests are rejected while the audit log cannot be written
+func (al *AuditLog) FailClosed() bool {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	return al.failClosed
+}
+
+// SetMirrorLevel also logs every entry to the logger at level, such as "info"; empty disables it
+func (al *AuditLog) SetMirrorLevel(level string) error {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	if level == "" {
+		al.mirrorEnabled = false
+		return nil
+	}
+	parsed, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid audit log level: %w", err)
+	}
+	al.mirrorEnabled = true
+	al.mirrorLevel = parsed
+	return nil
+}
+
+// Record numbers and chains the entry and appends it to the audit log
+func (al *AuditLog) Record(entry *models.AuditEntry) error {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	entry.Sequence = al.sequence + 1
+	entry.PrevHash = al.lastHash
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	hash, err := entry.ComputeHash()
+	if err != nil {
+		return fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := al.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	al.sequence = entry.Sequence
+	al.lastHash = entry.Hash
+
+	if al.mirrorEnabled {
+		if check := al.logger.Named("audit").Check(al.mirrorLevel, "audit"); check != nil {
+			check.Write(
+				zap.Int64("seq", entry.Sequence),
+				zap.String("actor", entry.Actor),
+				zap.String("source_ip", entry.SourceIP),
+				zap.String("action", entry.Action),
+				zap.String("target", entry.Target),
+				zap.String("summary", entry.Summary),
+				zap.String("request_id", entry.RequestID),
+				zap.Int("status", entry.Status),
+				zap.String("outcome", entry.Outcome))
+		}
+	}
+	return nil
+}
+
+// RecordHook appends an entry for a lifecycle hook run, attributed to the supervisor itself, such
+// as agents.hooks.pre_stop targeting the agent; it suits agents.AddLifecycleHookObserver
+func (al *AuditLog) RecordHook(result models.HookResult) {
+	entry := &models.AuditEntry{
+		Timestamp: result.StartedAt,
+		Actor:     "supervisor",
+		Action:    "agents.hooks." + string(result.Hook),
+		Target:    result.AgentID,
+		Summary:   fmt.Sprintf("%s hook of agent %s, pid %d", result.Hook, result.AgentID, result.PID),
+		Outcome:   models.AuditOutcomeSuccess,
+	}
+	if !result.Success {
+		entry.Outcome = models.AuditOutcomeFailure
+		entry.Summary += fmt.Sprintf(", failed with policy %s: %s", result.Policy, result.Error)
+	}
+	if err := al.Record(entry); err != nil {
+		al.logger.Error("failed to audit lifecycle hook",
+			zap.String("agent_id", result.AgentID),
+			zap.String("hook", string(result.Hook)),
+			zap.Error(err))
+	}
+}
+
+// Writable reports why the audit log cannot be appended to, or nil when it can
+func (al *AuditLog) Writable() error {
+	if err := os.MkdirAll(filepath.Dir(al.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(al.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// Query returns the page of entries matching the filter, oldest first
+func (al *AuditLog) Query(filter AuditFilter) (*AuditPage, error) {
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditPageSize
+	}
+	if filter.Limit > MaxAuditPageSize {
+		filter.Limit = MaxAuditPageSize
+	}
+
+	page := &AuditPage{Entries: []models.AuditEntry{}, Offset: filter.Offset, Limit: filter.Limit}
+	err := al.visit(func(entry models.AuditEntry) error {
+		if !auditEntryMatches(entry, filter) {
+			return nil
+		}
+		if page.Total >= filter.Offset && len(page.Entries) < filter.Limit {
+			page.Entries = append(page.Entries, entry)
+		}
+		page.Total++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Verify checks the hash chain of the entries still on disk; entries dropped by rotation are not an error
+func (al *AuditLog) Verify() error {
+	var previous *models.AuditEntry
+	return al.visit(func(entry models.AuditEntry) error {
+		hash, err := entry.ComputeHash()
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("audit entry %d was modified", entry.Sequence)
+		}
+		if previous != nil && (entry.PrevHash != previous.Hash || entry.Sequence != previous.Sequence+1) {
+			return fmt.Errorf("audit entries between %d and %d are missing or out of order", previous.Sequence, entry.Sequence)
+		}
+		previous = &entry
+		return nil
+	})
+}
+
+// Close closes the audit log file
+func (al *AuditLog) Close() error {
+	return al.file.Close()
+}
+
+// visit calls fn for every entry on disk, oldest first
+func (al *AuditLog) visit(fn func(models.AuditEntry) error) error {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	for i := al.backups; i >= 1; i-- {
+		if err := readAuditFile(fmt.Sprintf("%s.%d", al.path, i), fn); err != nil {
+			return err
+		}
+	}
+	return readAuditFile(al.path, fn)
+}
+
+// readAuditFile calls fn for every entry of an audit file; a missing file has none
+func readAuditFile(path string, fn func(models.AuditEntry) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("failed to decode audit entry in %s: %w", path, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+// auditEntryMatches reports whether the entry passes the filter
+func auditEntryMatches(entry models.AuditEntry, filter AuditFilter) bool {
+	if !filter.Since.IsZero() && entry.Timestamp.Before(filter.Since) {
+		return false
+	}
+	if filter.Actor != "" && entry.Actor != filter.Actor {
+		return false
+	}
+	if filter.Action != "" && entry.Action != filter.Action && !strings.HasPrefix(entry.Action, filter.Action+".") {
+		return false
+	}
+	return true
+}
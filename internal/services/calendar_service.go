@@ -0,0 +1,196 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// ICalendarService interface for managing the calendars scheduled tasks skip the days of
+type ICalendarService interface {
+	// CreateCalendar stores a new calendar
+	CreateCalendar(calendar *models.Calendar) error
+
+	// UpdateCalendar replaces the dates and description of an existing calendar
+	UpdateCalendar(calendar *models.Calendar) error
+
+	// DeleteCalendar removes a calendar no scheduled task skips
+	DeleteCalendar(name string) error
+
+	// GetCalendar returns a calendar by its name
+	GetCalendar(name string) (*models.Calendar, error)
+
+	// ListCalendars returns all calendars, ordered by name
+	ListCalendars() ([]*models.Calendar, error)
+
+	// Exclusion returns the first of the named calendars excluding the day of t
+	Exclusion(names []string, t time.Time) (*models.CalendarExclusion, bool)
+}
+
+// CalendarService implements ICalendarService, keeping calendars in memory. Calendars declared in
+// the config file are created again at every start.
+type CalendarService struct {
+	scheduler ISchedulerService // Refuses to delete the calendars of its tasks when set
+	logger    *zap.Logger
+
+	mutex     sync.RWMutex
+	calendars map[string]*models.Calendar
+}
+
+// NewCalendarService creates a new instance of CalendarService
+func NewCalendarService(logger *zap.Logger) *CalendarService {
+	return &CalendarService{
+		logger:    logger,
+		calendars: make(map[string]*models.Calendar),
+	}
+}
+
+// SetSchedulerService sets the scheduler whose tasks' calendars cannot be deleted
+func (cs *CalendarService) SetSchedulerService(scheduler ISchedulerService) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.scheduler = scheduler
+}
+
+// CreateCalendar stores a new calendar
+func (cs *CalendarService) CreateCalendar(calendar *models.Calendar) error {
+	if err := calendar.Validate(); err != nil {
+		return err
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if _, exists := cs.calendars[calendar.Name]; exists {
+		return models.NewKindError(models.ErrCalendarConflict, "calendar %s already exists", calendar.Name)
+	}
+
+	calendar.CreatedAt = time.Now()
+	calendar.UpdatedAt = calendar.CreatedAt
+	cs.calendars[calendar.Name] = calendar
+
+	cs.logger.Info("calendar created",
+		zap.String("calendar", calendar.Name),
+		zap.Int("dates", len(calendar.Dates)))
+
+	return nil
+}
+
+// UpdateCalendar replaces the dates and description of an existing calendar; the tasks skipping it
+// skip the new dates from their next fire
+func (cs *CalendarService) UpdateCalendar(calendar *models.Calendar) error {
+	if err := calendar.Validate(); err != nil {
+		return err
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	existing, exists := cs.calendars[calendar.Name]
+	if !exists {
+		return models.NewKindError(models.ErrCalendarNotFound, "calendar %s not found", calendar.Name)
+	}
+
+	calendar.CreatedAt = existing.CreatedAt
+	calendar.UpdatedAt = time.Now()
+	cs.calendars[calendar.Name] = calendar
+
+	cs.logger.Info("calendar updated",
+		zap.String("calendar", calendar.Name),
+		zap.Int("dates", len(calendar.Dates)))
+
+	return nil
+}
+
+// DeleteCalendar removes a calendar, refusing while a scheduled task skips it
+func (cs *CalendarService) DeleteCalendar(name string) error {
+	if _, err := cs.GetCalendar(name); err != nil {
+		return err
+	}
+
+	// The scheduler checks calendars while holding its own lock, so its tasks are listed without
+	// holding this service's
+	cs.mutex.RLock()
+	scheduler := cs.scheduler
+	cs.mutex.RUnlock()
+	if scheduler != nil {
+		tasks, err := scheduler.ListScheduledTasks()
+		if err != nil {
+			return err
+		}
+		var users []string
+		for _, task := range tasks {
+			for _, skipped := range task.SkipCalendars {
+				if skipped == name {
+					users = append(users, task.ID)
+					break
+				}
+			}
+		}
+		if len(users) > 0 {
+			sort.Strings(users)
+			return models.NewKindError(models.ErrCalendarInUse, "calendar %s is skipped by scheduled tasks %v", name, users)
+		}
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if _, exists := cs.calendars[name]; !exists {
+		return models.NewKindError(models.ErrCalendarNotFound, "calendar %s not found", name)
+	}
+	delete(cs.calendars, name)
+
+	cs.logger.Info("calendar deleted", zap.String("calendar", name))
+	return nil
+}
+
+// GetCalendar returns a calendar by its name
+func (cs *CalendarService) GetCalendar(name string) (*models.Calendar, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	calendar, exists := cs.calendars[name]
+	if !exists {
+		return nil, models.NewKindError(models.ErrCalendarNotFound, "calendar %s not found", name)
+	}
+	return calendar, nil
+}
+
+// ListCalendars returns all calendars, ordered by name
+func (cs *CalendarService) ListCalendars() ([]*models.Calendar, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	calendars := make([]*models.Calendar, 0, len(cs.calendars))
+	for _, calendar := range cs.calendars {
+		calendars = append(calendars, calendar)
+	}
+	sort.Slice(calendars, func(i, j int) bool { return calendars[i].Name < calendars[j].Name })
+	return calendars, nil
+}
+
+// Exclusion returns the first of the named calendars excluding the day of t, in t's time zone.
+// Calendars that do not exist exclude nothing.
+func (cs *CalendarService) Exclusion(names []string, t time.Time) (*models.CalendarExclusion, bool) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	for _, name := range names {
+		calendar, exists := cs.calendars[name]
+		if !exists {
+			continue
+		}
+		if dates, excluded := calendar.Excludes(t); excluded {
+			return &models.CalendarExclusion{
+				Calendar: name,
+				Date:     t.Format(models.CalendarDateLayout),
+				Reason:   dates.Reason,
+			}, true
+		}
+	}
+	return nil, false
+}
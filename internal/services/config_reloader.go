@@ -0,0 +1,345 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// configReloadPrincipal is recorded as the requester of executions cancelled by a config update
+const configReloadPrincipal = "config-reload"
+
+// ConfigReloader compares the on-disk config file with the applied agents and tasks and applies the
+// difference, mirroring supervisord's reread and update commands. Agents and tasks created through
+// the API are never touched; only items that came from the config file are tracked.
+type ConfigReloader struct {
+	path             string
+	agentService     IAgentService
+	executionService IExecutionService
+	schedulerService ISchedulerService
+	logger           *zap.Logger
+
+	mutex  sync.Mutex
+	agents map[string]config.AgentConfig // Agents applied from the config file
+	tasks  map[string]config.TaskConfig  // Tasks applied from the config file
+	hooks  []func(*config.Config)        // Called with every configuration applied by Update
+}
+
+// NewConfigReloader creates a new ConfigReloader for the config file at path
+func NewConfigReloader(path string, agentService IAgentService, executionService IExecutionService, schedulerService ISchedulerService, logger *zap.Logger) *ConfigReloader {
+	return &ConfigReloader{
+		path:             path,
+		agentService:     agentService,
+		executionService: executionService,
+		schedulerService: schedulerService,
+		logger:           logger,
+		agents:           make(map[string]config.AgentConfig),
+		tasks:            make(map[string]config.TaskConfig),
+	}
+}
+
+// AddReloadHook registers fn to be called with the loaded configuration on every Update, before its
+// agents and tasks are applied, so settings other than agents and tasks can be hot-reloaded
+func (cr *ConfigReloader) AddReloadHook(fn func(*config.Config)) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	cr.hooks = append(cr.hooks, fn)
+}
+
+// Reread loads the config file and reports what an update would change, without applying anything
+func (cr *ConfigReloader) Reread() (*models.ConfigDiff, error) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	diff, _, err := cr.diff()
+	return diff, err
+}
+
+// Update loads the config file and applies every added, changed and removed agent and task.
+// Changed agents with running executions are skipped unless restartChanged is set, in which
+// case those executions are cancelled before the new configuration is applied.
+func (cr *ConfigReloader) Update(restartChanged bool) (*models.ConfigUpdateResult, error) {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	diff, loaded, err := cr.diff()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ConfigUpdateResult{
+		ConfigFile: cr.path,
+		Results:    []models.ConfigUpdateItem{},
+		AppliedAt:  time.Now(),
+	}
+
+	desiredAgents := make(map[string]config.AgentConfig, len(loaded.Agents))
+	for _, agent := range loaded.Agents {
+		desiredAgents[agent.ID] = agent
+	}
+	desiredTasks := make(map[string]config.TaskConfig, len(loaded.Tasks))
+	for _, task := range loaded.Tasks {
+		desiredTasks[task.ID] = task
+	}
+
+	// Settings such as the agent defaults are updated before the agents they apply to
+	for _, hook := range cr.hooks {
+		hook(loaded)
+	}
+
+	// Tasks are removed before their agents and added after them so references stay valid
+	apply := func(scope string, removals bool) {
+		for _, change := range diff.Changes {
+			if change.Scope != scope || (change.Change == models.ConfigRemoved) != removals {
+				continue
+			}
+
+			var item models.ConfigUpdateItem
+			if scope == ConfigScopeAgent {
+				item = cr.applyAgent(change, desiredAgents[change.ID], restartChanged)
+			} else {
+				item = cr.applyTask(change, desiredTasks[change.ID])
+			}
+			result.Results = append(result.Results, item)
+		}
+	}
+	apply(ConfigScopeTask, true)
+	apply(ConfigScopeAgent, true)
+	apply(ConfigScopeAgent, false)
+	apply(ConfigScopeTask, false)
+
+	cr.logger.Info("configuration update applied",
+		zap.String("config_file", cr.path),
+		zap.Int("changes", len(diff.Changes)),
+		zap.Bool("succeeded", result.Succeeded()))
+
+	return result, nil
+}
+
+// diff loads the config file and compares it with the applied agents and tasks
+func (cr *ConfigReloader) diff() (*models.ConfigDiff, *config.Config, error) {
+	if cr.path == "" {
+		return nil, nil, fmt.Errorf("no config file is in use")
+	}
+
+	loaded, err := config.LoadConfigFile(cr.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diff := &models.ConfigDiff{
+		ConfigFile: cr.path,
+		Changes:    []models.ConfigChange{},
+		ReadAt:     time.Now(),
+	}
+
+	agents := make(map[string]interface{}, len(loaded.Agents))
+	for _, agent := range loaded.Agents {
+		agents[agent.ID] = agent
+	}
+	applied := make(map[string]interface{}, len(cr.agents))
+	for id, agent := range cr.agents {
+		applied[id] = agent
+	}
+	diff.Changes = append(diff.Changes, diffItems(ConfigScopeAgent, applied, agents)...)
+
+	tasks := make(map[string]interface{}, len(loaded.Tasks))
+	for _, task := range loaded.Tasks {
+		tasks[task.ID] = task
+	}
+	applied = make(map[string]interface{}, len(cr.tasks))
+	for id, task := range cr.tasks {
+		applied[id] = task
+	}
+	diff.Changes = append(diff.Changes, diffItems(ConfigScopeTask, applied, tasks)...)
+
+	return diff, loaded, nil
+}
+
+// applyAgent registers, updates or deletes a single agent
+func (cr *ConfigReloader) applyAgent(change models.ConfigChange, desired config.AgentConfig, restartChanged bool) models.ConfigUpdateItem {
+	item := models.ConfigUpdateItem{ConfigChange: change, Status: models.ConfigUpdateApplied}
+
+	switch change.Change {
+	case models.ConfigAdded, models.ConfigChanged:
+		if change.Change == models.ConfigAdded {
+			err := cr.agentService.RegisterAgent(desired.ToAgentConfiguration())
+			if err == nil {
+				break
+			}
+			// An agent a previous run or another supervisor sharing the state storage stored is
+			// updated to the configuration instead
+			if existing, getErr := cr.agentService.GetAgent(change.ID); !errors.Is(err, models.ErrAgentConflict) || getErr != nil || existing.IsDeleted() {
+				return failedItem(item, err)
+			}
+		}
+
+		running := cr.runningExecutions(change.ID)
+		if len(running) > 0 {
+			if !restartChanged {
+				item.Status = models.ConfigUpdateSkipped
+				item.Message = fmt.Sprintf("agent has %d running execution(s); pass restart_changed to restart it", len(running))
+				return item
+			}
+			if err := cr.cancelExecutions(running, "agent configuration changed"); err != nil {
+				return failedItem(item, err)
+			}
+			item.Status = models.ConfigUpdateRestarted
+		}
+
+		updated := desired.ToAgentConfiguration()
+		if existing, err := cr.agentService.GetAgent(change.ID); err == nil {
+			updated.CreatedAt = existing.CreatedAt
+		}
+		if err := cr.agentService.UpdateAgent(updated); err != nil {
+			return failedItem(item, err)
+		}
+
+	case models.ConfigRemoved:
+		if err := cr.cancelExecutions(cr.runningExecutions(change.ID), "agent removed from configuration"); err != nil {
+			return failedItem(item, err)
+		}
+		if err := cr.agentService.DeleteAgent(change.ID); err != nil {
+			return failedItem(item, err)
+		}
+		delete(cr.agents, change.ID)
+		return item
+	}
+
+	cr.agents[change.ID] = desired
+	return item
+}
+
+// applyTask schedules, updates or unschedules a single task
+func (cr *ConfigReloader) applyTask(change models.ConfigChange, desired config.TaskConfig) models.ConfigUpdateItem {
+	item := models.ConfigUpdateItem{ConfigChange: change, Status: models.ConfigUpdateApplied}
+
+	switch change.Change {
+	case models.ConfigAdded, models.ConfigChanged:
+		if change.Change == models.ConfigAdded {
+			err := cr.schedulerService.ScheduleTask(desired.ToScheduledTask())
+			if err == nil {
+				break
+			}
+			// A task a previous run or another supervisor sharing the state storage stored is
+			// updated to the configuration instead
+			if !errors.Is(err, models.ErrTaskConflict) {
+				return failedItem(item, err)
+			}
+		}
+
+		existing, err := cr.schedulerService.GetTask(change.ID)
+		if err != nil {
+			return failedItem(item, err)
+		}
+
+		// Keep the runtime state the scheduler has accumulated for the task
+		updated := desired.ToScheduledTask()
+		updated.Active = existing.Active
+		updated.CreatedAt = existing.CreatedAt
+		updated.LastExecution = existing.LastExecution
+		updated.NextExecution = existing.NextExecution
+		updated.LastResult = existing.LastResult
+		updated.LastScheduledRun = existing.LastScheduledRun
+		updated.DeferredRuns = existing.DeferredRuns
+		updated.RetryCount = existing.RetryCount
+		if err := cr.schedulerService.UpdateTask(updated); err != nil {
+			return failedItem(item, err)
+		}
+
+	case models.ConfigRemoved:
+		if err := cr.schedulerService.UnscheduleTask(change.ID); err != nil {
+			return failedItem(item, err)
+		}
+		delete(cr.tasks, change.ID)
+		return item
+	}
+
+	cr.tasks[change.ID] = desired
+	return item
+}
+
+// runningExecutions returns the IDs of the agent's executions that are still starting or running
+func (cr *ConfigReloader) runningExecutions(agentID string) []string {
+	if cr.executionService == nil {
+		return nil
+	}
+
+	ids, err := runningExecutionIDs(cr.executionService, agentID)
+	if err != nil {
+		cr.logger.Warn("failed to list active executions", zap.String("agent_id", agentID), zap.Error(err))
+		return nil
+	}
+	return ids
+}
+
+// cancelExecutions cancels every execution in ids for reason
+func (cr *ConfigReloader) cancelExecutions(ids []string, reason string) error {
+	for _, id := range ids {
+		if err := cr.executionService.CancelExecution(id, reason, configReloadPrincipal); err != nil {
+			return fmt.Errorf("failed to cancel execution %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// failedItem marks item as failed with err
+func failedItem(item models.ConfigUpdateItem, err error) models.ConfigUpdateItem {
+	item.Status = models.ConfigUpdateFailed
+	item.Message = err.Error()
+	return item
+}
+
+// diffItems compares applied and desired items of one scope, sorted by ID
+func diffItems(scope string, applied, desired map[string]interface{}) []models.ConfigChange {
+	var changes []models.ConfigChange
+
+	for id, item := range desired {
+		current, exists := applied[id]
+		switch {
+		case !exists:
+			changes = append(changes, models.ConfigChange{Scope: scope, ID: id, Change: models.ConfigAdded})
+		case !reflect.DeepEqual(current, item):
+			changes = append(changes, models.ConfigChange{Scope: scope, ID: id, Change: models.ConfigChanged, Fields: changedFields(current, item)})
+		}
+	}
+	for id := range applied {
+		if _, exists := desired[id]; !exists {
+			changes = append(changes, models.ConfigChange{Scope: scope, ID: id, Change: models.ConfigRemoved})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+	return changes
+}
+
+// changedFields returns the config keys whose values differ between two structs of the same type
+func changedFields(current, desired interface{}) []string {
+	currentValue := reflect.ValueOf(current)
+	desiredValue := reflect.ValueOf(desired)
+
+	var fields []string
+	for i := 0; i < currentValue.NumField(); i++ {
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), desiredValue.Field(i).Interface()) {
+			continue
+		}
+
+		field := currentValue.Type().Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/server"
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Validation scopes reported in ConfigIssue.Scope
+const (
+	ConfigScopeSupervisor = "supervisor"
+	ConfigScopeA2A        = "a2a"
+	ConfigScopeAgent      = "agent"
+	ConfigScopeTask       = "task"
+)
+
+// ConfigValidator checks the loaded supervisor config, A2A config, registered agents and scheduled tasks
+type ConfigValidator struct {
+	config           *config.Config
+	a2aConfig        *a2a.A2AConfig
+	agentService     *AgentService
+	schedulerService ISchedulerService
+	logger           *zap.Logger
+}
+
+// NewConfigValidator creates a new ConfigValidator; any dependency may be nil to skip its checks
+func NewConfigValidator(cfg *config.Config, a2aConfig *a2a.A2AConfig, agentService *AgentService, schedulerService ISchedulerService, logger *zap.Logger) *ConfigValidator {
+	return &ConfigValidator{
+		config:           cfg,
+		a2aConfig:        a2aConfig,
+		agentService:     agentService,
+		schedulerService: schedulerService,
+		logger:           logger,
+	}
+}
+
+// Validate runs every check and returns the collected errors and warnings
+func (cv *ConfigValidator) Validate() *models.ConfigValidation {
+	result := models.NewConfigValidation()
+
+	cv.validateSupervisor(result)
+	cv.validateA2A(result)
+	cv.validateAgents(result)
+	cv.validateTasks(result)
+
+	cv.logger.Info("configuration validated",
+		zap.Bool("valid", result.Valid),
+		zap.Int("errors", len(result.Errors)),
+		zap.Int("warnings", len(result.Warnings)))
+
+	return result
+}
+
+// validateSupervisor checks the top-level supervisor configuration
+func (cv *ConfigValidator) validateSupervisor(result *models.ConfigValidation) {
+	if cv.config == nil {
+		return
+	}
+
+	if err := config.Validate(cv.config); err != nil {
+		result.AddError(ConfigScopeSupervisor, "", "", err.Error())
+	}
+
+	// Certificates are read at startup, so unreadable files would stop the server from starting
+	if cv.config.TLS.Enabled {
+		_, _, err := server.NewTLSConfig(server.TLSOptions{
+			CertFile:     cv.config.TLS.CertFile,
+			KeyFile:      cv.config.TLS.KeyFile,
+			ClientCAFile: cv.config.TLS.ClientCAFile,
+		})
+		if err != nil {
+			result.AddError(ConfigScopeSupervisor, "", "tls", err.Error())
+		}
+	}
+
+	unknown, err := config.UnknownFields()
+	if err != nil {
+		result.AddWarning(ConfigScopeSupervisor, "", "", fmt.Sprintf("could not check for unknown fields: %v", err))
+	}
+	for _, field := range unknown {
+		result.AddWarning(ConfigScopeSupervisor, "", field, "unknown configuration field")
+	}
+
+	// Agents declared in the config file are checked alongside registered ones
+	for _, agent := range cv.config.Agents {
+		if cv.isRegistered(agent.ID) {
+			continue
+		}
+		declared := agent.ToAgentConfiguration()
+		cv.checkAgentPaths(result, declared, cv.config.Validation.Strict && !declared.SkipFSChecks)
+		cv.checkProcessLimits(result, declared)
+	}
+}
+
+// validateA2A checks the A2A protocol configuration
+func (cv *ConfigValidator) validateA2A(result *models.ConfigValidation) {
+	if cv.a2aConfig == nil {
+		return
+	}
+
+	if err := cv.a2aConfig.Validate(); err != nil {
+		for _, e := range unwrapJoined(err) {
+			result.AddError(ConfigScopeA2A, "", "", e.Error())
+		}
+	}
+
+	for _, warning := range cv.a2aConfig.Warnings() {
+		result.AddWarning(ConfigScopeA2A, "", "", warning)
+	}
+
+	// A2A routes are served by the supervisor's own listener
+	if cv.config != nil && cv.a2aConfig.ServerPort != cv.config.Port {
+		result.AddWarning(ConfigScopeA2A, "", "server_port",
+			fmt.Sprintf("server_port %d differs from supervisor port %d; A2A endpoints are served on port %d",
+				cv.a2aConfig.ServerPort, cv.config.Port, cv.config.Port))
+	}
+}
+
+// validateAgents checks every registered agent
+func (cv *ConfigValidator) validateAgents(result *models.ConfigValidation) {
+	if cv.agentService == nil {
+		return
+	}
+
+	registered, err := cv.agentService.ListAgents()
+	if err != nil {
+		result.AddError(ConfigScopeAgent, "", "", fmt.Sprintf("failed to list agents: %v", err))
+		return
+	}
+	sort.Slice(registered, func(i, j int) bool { return registered[i].ID < registered[j].ID })
+
+	for _, agent := range registered {
+		for _, fieldErr := range agent.ValidateFields() {
+			result.AddError(ConfigScopeAgent, agent.ID, fieldErr.Field, fieldErr.Message)
+		}
+		cv.checkAgentPaths(result, agent, cv.agentService.EnforcesFilesystemChecks(agent))
+		cv.checkProcessLimits(result, agent)
+	}
+}
+
+// validateTasks checks every scheduled task and the agent it references
+func (cv *ConfigValidator) validateTasks(result *models.ConfigValidation) {
+	if cv.schedulerService == nil {
+		return
+	}
+
+	tasks, err := cv.schedulerService.ListScheduledTasks()
+	if err != nil {
+		result.AddError(ConfigScopeTask, "", "", fmt.Sprintf("failed to list scheduled tasks: %v", err))
+		return
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	for _, task := range tasks {
+		for _, fieldErr := range task.ValidateFields() {
+			result.AddError(ConfigScopeTask, task.ID, fieldErr.Field, fieldErr.Message)
+		}
+
+		if _, err := definitions.ParseCronExpression(task.CronExpression); err != nil {
+			result.AddError(ConfigScopeTask, task.ID, "cron_expression", err.Error())
+		}
+
+		// Pipelines are checked when their tasks are scheduled, and fan-out tasks pick their agents
+		// when they fire
+		if cv.agentService == nil || task.PipelineID != "" || task.IsFanOut() {
+			continue
+		}
+		agent, err := cv.agentService.GetAgent(task.AgentID)
+		if err != nil {
+			result.AddError(ConfigScopeTask, task.ID, "agent_id", fmt.Sprintf("task references agent %s which does not exist", task.AgentID))
+			continue
+		}
+		if !agent.Enabled {
+			result.AddWarning(ConfigScopeTask, task.ID, "agent_id", fmt.Sprintf("task references agent %s which is disabled", task.AgentID))
+		}
+	}
+}
+
+// checkAgentPaths reports the agent's failed filesystem checks, as errors when they are enforced
+// for an enabled agent and as warnings otherwise
+func (cv *ConfigValidator) checkAgentPaths(result *models.ConfigValidation, agent *models.AgentConfiguration, enforced bool) {
+	for _, issue := range agents.CheckFilesystem(agent) {
+		if enforced && agent.Enabled {
+			result.AddError(ConfigScopeAgent, agent.ID, issue.Field, issue.Err.Error())
+		} else {
+			result.AddWarning(ConfigScopeAgent, agent.ID, issue.Field, issue.Err.Error())
+		}
+	}
+}
+
+// checkProcessLimits warns about the agent's process limits this platform ignores
+func (cv *ConfigValidator) checkProcessLimits(result *models.ConfigValidation, agent *models.AgentConfiguration) {
+	for _, warning := range agents.UnsupportedProcessLimits(agent) {
+		result.AddWarning(ConfigScopeAgent, agent.ID, warning.Field, warning.String())
+	}
+}
+
+// isRegistered reports whether the agent is known to the agent service
+func (cv *ConfigValidator) isRegistered(agentID string) bool {
+	if cv.agentService == nil {
+		return false
+	}
+	_, err := cv.agentService.GetAgent(agentID)
+	return err == nil
+}
+
+// unwrapJoined splits an errors.Join result back into its parts
+func unwrapJoined(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
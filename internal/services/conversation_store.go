@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// Defaults for A2A conversations when no idle TTL or history bounds are configured
+const (
+	DefaultConversationIdleTTL         = time.Hour
+	DefaultConversationHistoryMessages = 10
+	DefaultConversationHistoryBytes    = 64 * 1024
+)
+
+// ConversationStore links the A2A messages sharing a conversation ID into a thread, so the agent
+// running a message can be given the exchanges before it. A conversation no message arrived in for
+// the idle TTL expires with its history.
+type ConversationStore struct {
+	idleTTL         time.Duration
+	historyMessages int
+	historyBytes    int
+	now             func() time.Time
+
+	mutex         sync.Mutex
+	conversations map[string]*models.Conversation
+}
+
+// NewConversationStore creates a store expiring conversations idle for idleTTL, passing agents the
+// default number of prior exchanges
+func NewConversationStore(idleTTL time.Duration) *ConversationStore {
+	if idleTTL <= 0 {
+		idleTTL = DefaultConversationIdleTTL
+	}
+	return &ConversationStore{
+		idleTTL:         idleTTL,
+		historyMessages: DefaultConversationHistoryMessages,
+		historyBytes:    DefaultConversationHistoryBytes,
+		now:             time.Now,
+		conversations:   make(map[string]*models.Conversation),
+	}
+}
+
+// SetHistoryLimits bounds the history agents are given to the last messages exchanges taking at
+// most bytes of input and output together; 0 keeps the default
+func (cs *ConversationStore) SetHistoryLimits(messages, bytes int) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if messages > 0 {
+		cs.historyMessages = messages
+	}
+	if bytes > 0 {
+		cs.historyBytes = bytes
+	}
+}
+
+// SetClock replaces the clock idle conversations are expired by
+func (cs *ConversationStore) SetClock(now func() time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.now = now
+}
+
+// HistoryFor returns the prior exchanges of the conversation to give a message for agent, nil
+// when there is no conversation or the agent does not take JSON-RPC input, which is the only input
+// the history is passed with. A new conversation has an empty history.
+func (cs *ConversationStore) HistoryFor(conversationID string, agent *models.AgentConfiguration) []models.ConversationExchange {
+	if cs == nil || conversationID == "" || agent == nil || agent.InputPattern != types.JsonRpcPattern {
+		return nil
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.expire()
+
+	conversation, ok := cs.conversations[conversationID]
+	if !ok {
+		return []models.ConversationExchange{}
+	}
+	return conversation.History(cs.historyMessages, cs.historyBytes)
+}
+
+// Record appends an exchange to the conversation, starting it when it is new
+func (cs *ConversationStore) Record(conversationID string, exchange models.ConversationExchange) {
+	if cs == nil || conversationID == "" {
+		return
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.expire()
+
+	now := cs.now()
+	if exchange.Timestamp.IsZero() {
+		exchange.Timestamp = now
+	}
+	conversation, ok := cs.conversations[conversationID]
+	if !ok {
+		conversation = &models.Conversation{ID: conversationID, CreatedAt: now}
+		cs.conversations[conversationID] = conversation
+	}
+	conversation.Exchanges = append(conversation.Exchanges, exchange)
+	conversation.UpdatedAt = now
+	conversation.ExpiresAt = now.Add(cs.idleTTL)
+}
+
+// RecordExecution appends the exchange of a message the execution ran, the agent replying output
+func (cs *ConversationStore) RecordExecution(conversationID, messageID string, execution *models.AgentExecution, output string) {
+	cs.Record(conversationID, models.ConversationExchange{
+		MessageID:   messageID,
+		AgentID:     execution.AgentID,
+		ExecutionID: execution.ID,
+		Input:       execution.Input,
+		Output:      output,
+		State:       execution.State,
+	})
+}
+
+// Get returns a copy of the conversation's whole thread
+func (cs *ConversationStore) Get(conversationID string) (*models.Conversation, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.expire()
+
+	conversation, ok := cs.conversations[conversationID]
+	if !ok {
+		return nil, models.NewKindError(models.ErrConversationNotFound, "conversation %s not found", conversationID)
+	}
+	snapshot := *conversation
+	snapshot.Exchanges = append([]models.ConversationExchange(nil), conversation.Exchanges...)
+	return &snapshot, nil
+}
+
+// expire drops the conversations idle for longer than the TTL; callers hold the mutex
+func (cs *ConversationStore) expire() {
+	now := cs.now()
+	for id, conversation := range cs.conversations {
+		if !now.Before(conversation.ExpiresAt) {
+			delete(cs.conversations, id)
+		}
+	}
+}
+
+// WithConversationHistory returns a context whose executions are given the prior exchanges of their
+// A2A conversation and record them among their parameters. Their output depends on the history, so
+// they bypass the result cache. History nil leaves ctx unchanged.
+func WithConversationHistory(ctx context.Context, history []models.ConversationExchange) context.Context {
+	if history == nil {
+		return ctx
+	}
+	inputs, _ := ctx.Value(executionInputsContextKey).(models.ExecutionInputs)
+	inputs.Parameters = mergeParameters(inputs.Parameters, map[string]interface{}{models.ConversationHistoryParameter: history})
+	return agents.WithConversationHistory(WithNoCache(WithExecutionInputs(ctx, inputs), true), history)
+}
+
+// splitConversationHistory takes the conversation history a replayed execution recorded out of its
+// parameters, which may have been decoded from JSON
+func splitConversationHistory(parameters map[string]interface{}) ([]models.ConversationExchange, map[string]interface{}) {
+	raw, ok := parameters[models.ConversationHistoryParameter]
+	if !ok {
+		return nil, parameters
+	}
+	rest := make(map[string]interface{}, len(parameters)-1)
+	for name, value := range parameters {
+		if name != models.ConversationHistoryParameter {
+			rest[name] = value
+		}
+	}
+	if len(rest) == 0 {
+		rest = nil
+	}
+
+	history, ok := raw.([]models.ConversationExchange)
+	if !ok {
+		data, _ := json.Marshal(raw)
+		history = []models.ConversationExchange{}
+		_ = json.Unmarshal(data, &history)
+	}
+	return history, rest
+}
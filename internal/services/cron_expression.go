@@ -0,0 +1,70 @@
+package services
+
+import (
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/robfig/cron/v3"
+)
+
+// zonedSchedule evaluates a cron schedule in a fixed time zone, whichever zone it is asked about;
+// expressions with their own TZ= prefix keep that zone
+type zonedSchedule struct {
+	cron.Schedule
+	location *time.Location
+}
+
+// Next returns the next fire time after t, in the schedule's time zone
+func (s zonedSchedule) Next(t time.Time) time.Time {
+	return s.Schedule.Next(t.In(s.location))
+}
+
+// NextFireTimes returns the next count fire times of a cron expression after from
+func NextFireTimes(expression string, from time.Time, count int) ([]time.Time, error) {
+	schedule, err := definitions.ParseCronExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, 0, count)
+	next := from
+	for i := 0; i < count; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		times = append(times, next)
+	}
+
+	return times, nil
+}
+
+// TaskSchedule parses a task's cron expression evaluated in its time zone, or fallback when it
+// names none. Like robfig/cron, a wall time skipped by a daylight saving change does not fire
+// that day and one repeated by it fires twice.
+func TaskSchedule(task *models.ScheduledTask, fallback *time.Location) (cron.Schedule, error) {
+	location, err := definitions.TaskLocation(task, fallback)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := definitions.ParseCronExpression(task.CronExpression)
+	if err != nil {
+		return nil, err
+	}
+	return zonedSchedule{Schedule: schedule, location: location}, nil
+}
+
+// TaskFireTimes returns the next count fire times of a task after from, in its time zone
+func TaskFireTimes(task *models.ScheduledTask, fallback *time.Location, from time.Time, count int) ([]time.Time, error) {
+	schedule, err := TaskSchedule(task, fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, 0, count)
+	for next := schedule.Next(from); !next.IsZero() && len(times) < count; next = schedule.Next(next) {
+		times = append(times, next)
+	}
+	return times, nil
+}
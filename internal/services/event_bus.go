@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Bounds of an event subscription's buffer
+const (
+	DefaultEventBufferSize = 256
+	MaxEventBufferSize     = 65536
+)
+
+// EventOverflowPolicy is what happens to a subscriber whose buffer is full when an event is published
+type EventOverflowPolicy string
+
+const (
+	// EventOverflowDrop drops the oldest buffered event and tells the subscriber how many it missed
+	EventOverflowDrop EventOverflowPolicy = "drop"
+	// EventOverflowDisconnect drops like EventOverflowDrop, but disconnects the subscriber once it
+	// falls more than its lag limit behind
+	EventOverflowDisconnect EventOverflowPolicy = "disconnect"
+)
+
+// ErrSubscriberLagging is returned to subscribers disconnected for falling too far behind
+var ErrSubscriberLagging = errors.New("subscriber fell too far behind and was disconnected")
+
+// ErrSubscriptionClosed is returned by Next once the subscription was closed
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// SubscriptionOptions configures an event subscription
+type SubscriptionOptions struct {
+	SubscriberType string              // Groups subscribers in the bus metrics, e.g. sse
+	BufferSize     int                 // Events buffered for the subscriber, DefaultEventBufferSize when 0
+	Overflow       EventOverflowPolicy // EventOverflowDrop when empty
+	LagLimit       int                 // Unread events tolerated before disconnecting, BufferSize when 0
+	Types          []string            // Event types to receive, all when empty
+	AgentID        string              // Only receive events about this agent when set
+}
+
+// Validate checks the options and fills in the defaults
+func (o *SubscriptionOptions) Validate() error {
+	if o.SubscriberType == "" {
+		o.SubscriberType = "internal"
+	}
+	if o.BufferSize == 0 {
+		o.BufferSize = DefaultEventBufferSize
+	}
+	if o.BufferSize < 1 || o.BufferSize > MaxEventBufferSize {
+		return fmt.Errorf("buffer size must be between 1 and %d", MaxEventBufferSize)
+	}
+	switch o.Overflow {
+	case "":
+		o.Overflow = EventOverflowDrop
+	case EventOverflowDrop, EventOverflowDisconnect:
+	default:
+		return fmt.Errorf("unknown overflow policy %q, expected drop or disconnect", o.Overflow)
+	}
+	if o.LagLimit < 0 {
+		return fmt.Errorf("lag limit must not be negative")
+	}
+	if o.LagLimit == 0 {
+		o.LagLimit = o.BufferSize
+	}
+	return nil
+}
+
+// EventBus fans the supervisor's events out to subscribers. Every subscriber has a bounded ring
+// buffer, so publishing never waits for a slow subscriber: a subscriber that falls behind loses its
+// oldest events and is told how many it missed, or is disconnected, as its overflow policy says.
+type EventBus struct {
+	mutex         sync.RWMutex
+	subscriptions map[uint64]*EventSubscription
+	retired       map[string]models.EventSubscriberStats // Counts of closed subscriptions by type
+	nextSubID     uint64
+	published     uint64 // Also the ID of the last published event
+	logger        *zap.Logger
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus(logger *zap.Logger) *EventBus {
+	return &EventBus{
+		subscriptions: make(map[uint64]*EventSubscription),
+		retired:       make(map[string]models.EventSubscriberStats),
+		logger:        logger,
+	}
+}
+
+// Publish assigns the event its ID and time and offers it to every matching subscriber; it never
+// waits for a subscriber to read. Publishing on a nil bus does nothing.
+func (b *EventBus) Publish(event models.Event) {
+	if b == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	// Publishers take turns so every subscriber sees events in ID order
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.published++
+	event.ID = b.published
+	for _, subscription := range b.subscriptions {
+		subscription.offer(event)
+	}
+}
+
+// PublishProcessState publishes a persistent agent process entering the backoff or fatal state;
+// it has the signature of a process state hook
+func (b *EventBus) PublishProcessState(event models.ProcessStateEvent) {
+	b.Publish(models.Event{
+		Type:    models.EventProcessState,
+		Time:    event.Time,
+		AgentID: event.AgentID,
+		Data:    event.Status,
+	})
+}
+
+// Subscribe attaches a subscriber; it must Close the subscription once done
+func (b *EventBus) Subscribe(options SubscriptionOptions) (*EventSubscription, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextSubID++
+	subscription := &EventSubscription{
+		id:      b.nextSubID,
+		options: options,
+		types:   make(map[string]bool, len(options.Types)),
+		buffer:  make([]models.Event, options.BufferSize),
+		ready:   make(chan struct{}, 1),
+		bus:     b,
+	}
+	for _, eventType := range options.Types {
+		subscription.types[eventType] = true
+	}
+	b.subscriptions[subscription.id] = subscription
+	return subscription, nil
+}
+
+// remove detaches a subscription and keeps its counts in the totals of its type
+func (b *EventBus) remove(subscription *EventSubscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, exists := b.subscriptions[subscription.id]; !exists {
+		return
+	}
+	delete(b.subscriptions, subscription.id)
+
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	totals := b.retired[subscription.options.SubscriberType]
+	totals.Delivered += subscription.delivered
+	totals.Dropped += subscription.dropped
+	if subscription.err == ErrSubscriberLagging {
+		totals.Disconnected++
+	}
+	b.retired[subscription.options.SubscriberType] = totals
+}
+
+// Stats returns the bus' traffic by subscriber type and its current subscriptions
+func (b *EventBus) Stats() models.EventBusStats {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	stats := models.EventBusStats{
+		Published:       b.published,
+		SubscriberTypes: make(map[string]models.EventSubscriberStats, len(b.retired)),
+		Subscriptions:   make([]models.EventSubscriptionStats, 0, len(b.subscriptions)),
+	}
+	for subscriberType, totals := range b.retired {
+		stats.SubscriberTypes[subscriberType] = totals
+	}
+	for _, subscription := range b.subscriptions {
+		current := subscription.stats()
+		stats.Subscriptions = append(stats.Subscriptions, current)
+
+		totals := stats.SubscriberTypes[current.SubscriberType]
+		totals.Subscribers++
+		totals.Delivered += current.Delivered
+		totals.Dropped += current.Dropped
+		if subscription.lagging() {
+			totals.Disconnected++
+		}
+		stats.SubscriberTypes[current.SubscriberType] = totals
+	}
+	sort.Slice(stats.Subscriptions, func(i, j int) bool {
+		return stats.Subscriptions[i].ID < stats.Subscriptions[j].ID
+	})
+	return stats
+}
+
+// EventSubscription receives the events published after it subscribed, through a ring buffer
+type EventSubscription struct {
+	id      uint64
+	options SubscriptionOptions
+	types   map[string]bool
+	bus     *EventBus
+	ready   chan struct{} // Signalled when an event was buffered or the subscription closed
+
+	mutex     sync.Mutex
+	buffer    []models.Event
+	head      int    // Index of the oldest buffered event
+	count     int    // Buffered events
+	pending   uint64 // Events dropped since the last notice
+	delivered uint64
+	dropped   uint64
+	err       error // Set once the subscription was closed or disconnected
+}
+
+// ID returns the subscription's ID, unique within its bus
+func (s *EventSubscription) ID() uint64 {
+	return s.id
+}
+
+// offer buffers the event if the subscription wants it, dropping the oldest buffered event when
+// the buffer is full
+func (s *EventSubscription) offer(event models.Event) {
+	if len(s.types) > 0 && !s.types[event.Type] {
+		return
+	}
+	if s.options.AgentID != "" && event.AgentID != s.options.AgentID {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.err != nil {
+		s.mutex.Unlock()
+		return
+	}
+	if s.count == len(s.buffer) {
+		s.head = (s.head + 1) % len(s.buffer)
+		s.count--
+		s.dropped++
+		s.pending++
+	}
+	s.buffer[(s.head+s.count)%len(s.buffer)] = event
+	s.count++
+
+	if s.options.Overflow == EventOverflowDisconnect && uint64(s.count)+s.pending > uint64(s.options.LagLimit) {
+		// Events still buffered are never read, so they count as dropped too
+		s.dropped += uint64(s.count)
+		s.pending += uint64(s.count)
+		s.count = 0
+		s.err = ErrSubscriberLagging
+		s.bus.logger.Warn("disconnecting lagging event subscriber",
+			zap.Uint64("subscription_id", s.id),
+			zap.String("subscriber_type", s.options.SubscriberType),
+			zap.Int("lag_limit", s.options.LagLimit))
+	}
+	s.mutex.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the next event, waiting for one to be published. When events were dropped since the
+// previous call, it first returns an events.dropped notice counting them. A disconnected subscriber
+// gets its final notice, then ErrSubscriberLagging.
+func (s *EventSubscription) Next(ctx context.Context) (models.Event, error) {
+	for {
+		s.mutex.Lock()
+		if s.pending > 0 {
+			notice := models.Event{
+				Type: models.EventEventsDropped,
+				Time: time.Now().UTC(),
+				Data: models.EventsDropped{DroppedCount: s.pending},
+			}
+			s.pending = 0
+			s.mutex.Unlock()
+			return notice, nil
+		}
+		if s.count > 0 {
+			event := s.buffer[s.head]
+			s.buffer[s.head] = models.Event{}
+			s.head = (s.head + 1) % len(s.buffer)
+			s.count--
+			s.delivered++
+			s.mutex.Unlock()
+			return event, nil
+		}
+		err := s.err
+		s.mutex.Unlock()
+		if err != nil {
+			return models.Event{}, err
+		}
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return models.Event{}, ctx.Err()
+		}
+	}
+}
+
+// Close detaches the subscription from the bus; further calls to Next fail
+func (s *EventSubscription) Close() {
+	s.mutex.Lock()
+	if s.err == nil {
+		s.err = ErrSubscriptionClosed
+	}
+	s.mutex.Unlock()
+	s.bus.remove(s)
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// lagging reports whether the subscription was disconnected for falling behind
+func (s *EventSubscription) lagging() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err == ErrSubscriberLagging
+}
+
+// stats reports the subscription's buffer and counts
+func (s *EventSubscription) stats() models.EventSubscriptionStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return models.EventSubscriptionStats{
+		ID:             s.id,
+		SubscriberType: s.options.SubscriberType,
+		Buffered:       s.count,
+		Capacity:       len(s.buffer),
+		Lag:            uint64(s.count) + s.pending,
+		Delivered:      s.delivered,
+		Dropped:        s.dropped,
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// DefaultMinAttemptDuration is the least time left of an execution's budget worth another attempt
+const DefaultMinAttemptDuration = time.Second
+
+// Retry policy of executions unless SetExecutionDefaults sets another
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = time.Second
+)
+
+// ExecutionDefaults are the server-wide settings of executions whose agent sets none of its own
+type ExecutionDefaults struct {
+	Timeout      time.Duration // Timeout of agents with none, 0 for no timeout
+	MaxRetries   int           // Most attempts of a transiently failing execution, the first included
+	RetryBackoff time.Duration // Wait before the first retry, growing linearly with each retry
+}
+
+// executionBudget is the time an execution's attempts and the waits between them share, so retries
+// cannot run past the timeout the execution was given. It is the caller's deadline, such as a task's
+// timeout, or else the agent's timeout; a zero total is unlimited.
+type executionBudget struct {
+	total    time.Duration
+	deadline time.Time
+}
+
+// newExecutionBudget starts the budget of an execution under ctx of an agent with the given timeout
+func newExecutionBudget(ctx context.Context, timeout time.Duration) executionBudget {
+	now := time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		return executionBudget{total: deadline.Sub(now), deadline: deadline}
+	}
+	if timeout > 0 {
+		return executionBudget{total: timeout, deadline: now.Add(timeout)}
+	}
+	return executionBudget{}
+}
+
+// limited reports whether the execution has a budget at all
+func (b executionBudget) limited() bool {
+	return b.total > 0
+}
+
+// remaining returns the time left of the budget, never negative
+func (b executionBudget) remaining() time.Duration {
+	return max(time.Until(b.deadline), 0)
+}
+
+// attemptTimeout bounds an attempt capped at attemptCap by the time left of the budget
+func (b executionBudget) attemptTimeout(attemptCap time.Duration) time.Duration {
+	if !b.limited() {
+		return attemptCap
+	}
+	return min(b.remaining(), attemptCap)
+}
+
+// abandon returns err explaining that retries were abandoned with remaining time left of the budget
+func (b executionBudget) abandon(err error, remaining time.Duration) error {
+	return fmt.Errorf("%w; retries abandoned: %s remaining of %s budget", err,
+		remaining.Round(100*time.Millisecond), b.total.Round(100*time.Millisecond))
+}
+
+// SetMinAttemptDuration sets the least time left of an execution's budget for which a failed
+// attempt is retried; with less left, retries are abandoned
+func (es *ExecutionService) SetMinAttemptDuration(duration time.Duration) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.minAttemptDuration = duration
+}
+
+// getMinAttemptDuration returns the least time left of a budget worth another attempt
+func (es *ExecutionService) getMinAttemptDuration() time.Duration {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+	return es.minAttemptDuration
+}
+
+// SetExecutionDefaults sets the timeout of agents with none and the retry policy of executions
+// started afterwards
+func (es *ExecutionService) SetExecutionDefaults(defaults ExecutionDefaults) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.defaults = defaults
+}
+
+// getExecutionDefaults returns the server-wide execution settings
+func (es *ExecutionService) getExecutionDefaults() ExecutionDefaults {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+	return es.defaults
+}
+
+// agentTimeout returns the timeout of an agent's executions: its own, or else the default one
+func (es *ExecutionService) agentTimeout(config *models.AgentConfiguration) time.Duration {
+	if config != nil && config.Timeout > 0 {
+		return time.Duration(config.Timeout) * time.Second
+	}
+	return es.getExecutionDefaults().Timeout
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// CancelActiveExecutions cancels every unfinished execution matching filter through CancelExecution:
+// running executions have their agent stopped, and queued ones are marked cancelled and skipped by
+// their queue without ever running. It reports the outcome on each, in the order they started.
+func (es *ExecutionService) CancelActiveExecutions(filter ExecutionFilter, reason, requestedBy string) *models.CancelAllResult {
+	result := &models.CancelAllResult{AgentID: filter.AgentID, Results: []models.ExecutionCancellation{}}
+	for _, cancellation := range es.unfinishedExecutions(filter) {
+		err := es.CancelExecution(cancellation.ExecutionID, reason, requestedBy)
+		switch {
+		case err == nil:
+			cancellation.Outcome = models.CancellationCancelled
+		case errors.Is(err, models.ErrExecutionNotFound) || es.executionTerminal(cancellation.ExecutionID):
+			// It finished, or was forgotten, between being listed and being cancelled
+			cancellation.Outcome = models.CancellationAlreadyTerminal
+			cancellation.Message = err.Error()
+		default:
+			cancellation.Outcome = models.CancellationNotCancellable
+			cancellation.Message = err.Error()
+		}
+		result.Add(cancellation)
+	}
+	return result
+}
+
+// unfinishedExecutions lists the executions matching filter that have not reached a terminal state,
+// oldest first, with the state each is in
+func (es *ExecutionService) unfinishedExecutions(filter ExecutionFilter) []models.ExecutionCancellation {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	var executions []*models.AgentExecution
+	for _, execution := range es.executions {
+		if filter.Matches(execution) && !models.IsTerminalState(execution.State) {
+			executions = append(executions, execution)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartTime.Before(executions[j].StartTime)
+	})
+
+	cancellations := make([]models.ExecutionCancellation, 0, len(executions))
+	for _, execution := range executions {
+		cancellations = append(cancellations, models.ExecutionCancellation{
+			ExecutionID:   execution.ID,
+			AgentID:       execution.AgentID,
+			PreviousState: execution.State,
+		})
+	}
+	return cancellations
+}
+
+// executionTerminal reports whether the execution has reached a terminal state
+func (es *ExecutionService) executionTerminal(executionID string) bool {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	execution, exists := es.executions[executionID]
+	return exists && models.IsTerminalState(execution.State)
+}
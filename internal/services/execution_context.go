@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// executionContextKey namespaces values the execution service reads from a request context
+type executionContextKey string
+
+const labelsContextKey executionContextKey = "labels"
+
+// WithExecutionLabels returns a context carrying labels to attach to executions started with it
+func WithExecutionLabels(ctx context.Context, labels map[string]string) context.Context {
+	if len(labels) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, labelsContextKey, labels)
+}
+
+// ExecutionLabelsFromContext returns the labels attached to the context, if any
+func ExecutionLabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsContextKey).(map[string]string)
+	return labels
+}
+
+// clientIDContextKey carries the identity of the caller that requested an execution
+const clientIDContextKey executionContextKey = "client_id"
+
+// WithClientID returns a context identifying the client that starts executions with it
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	if clientID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIDContextKey, clientID)
+}
+
+// ClientIDFromContext returns the client identity attached to the context, if any
+func ClientIDFromContext(ctx context.Context) string {
+	clientID, _ := ctx.Value(clientIDContextKey).(string)
+	return clientID
+}
+
+// ClientIDForToken derives a stable client identity from an auth token without exposing the token
+func ClientIDForToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+// ClientIDForAddress derives a client identity for unauthenticated callers from their address
+func ClientIDForAddress(address string) string {
+	return "ip:" + address
+}
+
+// noCacheContextKey marks executions that must bypass the result cache
+const noCacheContextKey executionContextKey = "no_cache"
+
+// WithNoCache returns a context whose executions skip cached results when noCache is set
+func WithNoCache(ctx context.Context, noCache bool) context.Context {
+	if !noCache {
+		return ctx
+	}
+	return context.WithValue(ctx, noCacheContextKey, true)
+}
+
+// NoCacheFromContext reports whether executions started with the context must bypass the result cache
+func NoCacheFromContext(ctx context.Context) bool {
+	noCache, _ := ctx.Value(noCacheContextKey).(bool)
+	return noCache
+}
+
+// outputEncodingContextKey carries the output encoding requested for executions started with a context
+const outputEncodingContextKey executionContextKey = "output_encoding"
+
+// WithOutputEncoding returns a context whose executions return their output in encoding, overriding
+// the agent's default
+func WithOutputEncoding(ctx context.Context, encoding models.OutputEncoding) context.Context {
+	if encoding == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, outputEncodingContextKey, encoding)
+}
+
+// OutputEncodingFromContext returns the output encoding requested on the context, empty for the
+// agent's default
+func OutputEncodingFromContext(ctx context.Context) models.OutputEncoding {
+	encoding, _ := ctx.Value(outputEncodingContextKey).(models.OutputEncoding)
+	return encoding
+}
+
+// executionInputsContextKey carries the overrides executions started with a context run with
+const executionInputsContextKey executionContextKey = "execution_inputs"
+
+// WithExecutionInputs returns a context whose executions record inputs, so they can be replayed
+func WithExecutionInputs(ctx context.Context, inputs models.ExecutionInputs) context.Context {
+	return context.WithValue(ctx, executionInputsContextKey, inputs)
+}
+
+// executionInputs returns the inputs an execution of input started with ctx records
+func executionInputs(ctx context.Context, input string) *models.ExecutionInputs {
+	inputs, _ := ctx.Value(executionInputsContextKey).(models.ExecutionInputs)
+	inputs.Input = input
+	return &inputs
+}
+
+// replayOfContextKey carries the ID of the execution that executions started with a context replay
+const replayOfContextKey executionContextKey = "replay_of"
+
+// WithReplayOf returns a context whose executions are recorded as replays of executionID
+func WithReplayOf(ctx context.Context, executionID string) context.Context {
+	return context.WithValue(ctx, replayOfContextKey, executionID)
+}
+
+// ReplayOfFromContext returns the ID of the execution replayed by executions started with ctx, if any
+func ReplayOfFromContext(ctx context.Context) string {
+	executionID, _ := ctx.Value(replayOfContextKey).(string)
+	return executionID
+}
+
+// reservedExecutionIDContextKey carries an execution ID handed out before the execution starts
+const reservedExecutionIDContextKey executionContextKey = "reserved_execution_id"
+
+// WithReservedExecutionID returns a context whose execution is recorded under executionID
+func WithReservedExecutionID(ctx context.Context, executionID string) context.Context {
+	if executionID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, reservedExecutionIDContextKey, executionID)
+}
+
+// ReservedExecutionIDFromContext returns the execution ID reserved on the context, if any
+func ReservedExecutionIDFromContext(ctx context.Context) string {
+	executionID, _ := ctx.Value(reservedExecutionIDContextKey).(string)
+	return executionID
+}
+
+// triggerContextKey carries how and by whom executions started with a context were triggered
+const triggerContextKey executionContextKey = "trigger"
+
+// ExecutionTrigger records the entry point that started an execution and the caller behind it
+type ExecutionTrigger struct {
+	Type types.TaskTriggerType
+	By   string
+}
+
+// WithExecutionTrigger returns a context whose executions are attributed to triggerType and triggeredBy
+func WithExecutionTrigger(ctx context.Context, triggerType types.TaskTriggerType, triggeredBy string) context.Context {
+	return context.WithValue(ctx, triggerContextKey, ExecutionTrigger{Type: triggerType, By: triggeredBy})
+}
+
+// ExecutionTriggerFromContext returns the trigger attached to the context, or the zero trigger
+func ExecutionTriggerFromContext(ctx context.Context) ExecutionTrigger {
+	trigger, _ := ctx.Value(triggerContextKey).(ExecutionTrigger)
+	return trigger
+}
+
+// SchedulerTriggeredBy is the TriggeredBy value of executions the scheduler starts for a task
+func SchedulerTriggeredBy(taskID string) string {
+	return "scheduler:" + taskID
+}
+
+// taskContextKey carries the ID of the scheduled task executions started with a context run for
+const taskContextKey executionContextKey = "task_id"
+
+// WithExecutionTask returns a context whose executions are recorded as runs of the task
+func WithExecutionTask(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, taskContextKey, taskID)
+}
+
+// ExecutionTaskFromContext returns the ID of the task executions started with ctx run for, if any
+func ExecutionTaskFromContext(ctx context.Context) string {
+	taskID, _ := ctx.Value(taskContextKey).(string)
+	return taskID
+}
+
+// stateObserverContextKey carries the StateObserver of executions started with a context
+const stateObserverContextKey executionContextKey = "state_observer"
+
+// StateObserver is called as an execution moves through its starting and running states
+type StateObserver func(executionID string, state types.AgentState)
+
+// WithStateObserver returns a context whose executions report their state changes to observer
+func WithStateObserver(ctx context.Context, observer StateObserver) context.Context {
+	return context.WithValue(ctx, stateObserverContextKey, observer)
+}
+
+// observeState reports the execution's current state to the context's StateObserver, if any
+func observeState(ctx context.Context, execution *models.AgentExecution) {
+	if observer, _ := ctx.Value(stateObserverContextKey).(StateObserver); observer != nil {
+		observer(execution.ID, execution.State)
+	}
+}
+
+// progressObserverContextKey carries the ProgressObserver of executions started with a context
+const progressObserverContextKey executionContextKey = "progress_observer"
+
+// ProgressObserver is called as a running execution's agent reports its progress
+type ProgressObserver func(executionID string, progress models.ExecutionProgress)
+
+// WithProgressObserver returns a context whose executions report their agents' progress to observer
+func WithProgressObserver(ctx context.Context, observer ProgressObserver) context.Context {
+	return context.WithValue(ctx, progressObserverContextKey, observer)
+}
+
+// observeProgress reports the execution's progress to the context's ProgressObserver, if any
+func observeProgress(ctx context.Context, executionID string, progress models.ExecutionProgress) {
+	if observer, _ := ctx.Value(progressObserverContextKey).(ProgressObserver); observer != nil {
+		observer(executionID, progress)
+	}
+}
@@ -0,0 +1,796 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// ExecutionRequest describes an agent execution requested over REST or JSON-RPC
+type ExecutionRequest struct {
+	AgentID        string
+	Input          string
+	Parameters     map[string]interface{} // Passed to the agent as --name value arguments
+	WorkingDir     string                 // Overrides the agent's working directory
+	Env            map[string]string      // Added to the agent's environment, overriding its own values
+	TimeoutSeconds int                    // Overrides the agent's timeout, 0 keeps it
+	Labels         map[string]string
+	NoCache        bool
+	OutputEncoding models.OutputEncoding // How the output is returned, the agent's default when empty
+	IdempotencyKey string                // Requests repeating a key for the same agent attach to the first request's execution
+	QueueBehavior  QueueBehavior         // With return_position, Execute returns at once with the queued execution when the agent is busy
+
+	// Prior exchanges of the A2A conversation the request belongs to, nil outside conversations;
+	// recorded among the parameters as conversation_history
+	ConversationHistory []models.ConversationExchange
+
+	// Handed to the agent as a file besides Input, bypassing the result cache; only its metadata is
+	// recorded
+	BinaryInput *BinaryInput
+}
+
+// ExecutionCoordinator validates execution requests and runs them through the execution service's
+// router, so every protocol runs agents the same way
+type ExecutionCoordinator struct {
+	agentService     IAgentService
+	executionService *ExecutionService
+	router           *ExecutionRouter
+	logger           *zap.Logger
+	operations       *AgentOperationLocks
+	operationWait    time.Duration      // How long a lifecycle operation asked to wait waits for a conflicting one
+	groups           IAgentGroupService // Agent groups lifecycle operations may target, none when nil
+	guard            *OperationGuard    // Checks operations on several agents at once, none when nil
+	inputs           *InputMaterializer // Writes binary input to the files agents are handed
+}
+
+// NewExecutionCoordinator creates an ExecutionCoordinator recording executions in executionService
+func NewExecutionCoordinator(agentService IAgentService, executionService *ExecutionService, logger *zap.Logger) *ExecutionCoordinator {
+	return &ExecutionCoordinator{
+		agentService:     agentService,
+		executionService: executionService,
+		router:           executionService.Router(),
+		logger:           logger,
+		operations:       NewAgentOperationLocks(),
+		operationWait:    DefaultOperationWaitTimeout,
+		inputs:           NewInputMaterializer("", logger),
+	}
+}
+
+// SetOperationWaitTimeout sets how long lifecycle operations asked to wait for a conflicting
+// operation on the same agent wait before failing
+func (ec *ExecutionCoordinator) SetOperationWaitTimeout(timeout time.Duration) {
+	ec.operationWait = timeout
+}
+
+// SetGroupService sets the agent groups lifecycle operations may target
+func (ec *ExecutionCoordinator) SetGroupService(groups IAgentGroupService) {
+	ec.groups = groups
+}
+
+// SetInputMaterializer replaces the materializer writing binary input to files, which spools to the
+// system temp directory and fetches no URLs by default
+func (ec *ExecutionCoordinator) SetInputMaterializer(inputs *InputMaterializer) {
+	ec.inputs = inputs
+}
+
+// ExecutionService returns the service the coordinator records executions in
+func (ec *ExecutionCoordinator) ExecutionService() *ExecutionService {
+	return ec.executionService
+}
+
+// Execute validates the request, runs the agent and waits for the execution to finish. When another
+// request already used the request's idempotency key, it waits for that execution instead and
+// reports it as deduplicated. With QueueBehaviorReturnPosition, an execution that has to wait behind
+// another one of its agent is returned at once in QueuedState with its queue position.
+func (ec *ExecutionCoordinator) Execute(ctx context.Context, request ExecutionRequest) (*models.AgentExecution, bool, error) {
+	agent, err := ec.prepare(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entry, duplicate := ec.claimIdempotencyKey(request)
+	if duplicate {
+		execution, err := ec.attach(ctx, entry, entry.finished)
+		return execution, execution != nil, err
+	}
+
+	// Reserve the execution so concurrent duplicates can find it before it starts
+	runCtx := requestContext(ctx, request)
+	reservedID := ""
+	if entry != nil {
+		reservedID = ec.executionService.reserveExecution(ctx, agent.GetID(), request.Labels).ID
+		ec.executionService.idempotency.assign(entry, reservedID)
+		runCtx = WithReservedExecutionID(runCtx, reservedID)
+	}
+
+	runCtx, release, err := ec.materializeInput(runCtx, request)
+	if err != nil {
+		if reservedID != "" {
+			ec.executionService.failReservedExecution(reservedID, err)
+		}
+		ec.settle(entry, nil, err)
+		return nil, false, err
+	}
+
+	if request.QueueBehavior == QueueBehaviorReturnPosition {
+		execution, err := ec.executeOrQueue(ctx, runCtx, agent, request.Input, entry, release)
+		return execution, false, err
+	}
+
+	execution, err := ec.router.ExecuteAgent(runCtx, agent, request.Input)
+	release()
+	if execution == nil && reservedID != "" {
+		ec.executionService.failReservedExecution(reservedID, err)
+	}
+	ec.settle(entry, execution, err)
+	return execution, false, err
+}
+
+// Start validates the request and runs the agent in the background. The returned execution is
+// pending; its ID can be polled until the execution completes. When another request already used
+// the request's idempotency key, that execution is returned instead and reported as deduplicated.
+func (ec *ExecutionCoordinator) Start(ctx context.Context, request ExecutionRequest) (*models.AgentExecution, bool, error) {
+	agent, err := ec.prepare(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entry, duplicate := ec.claimIdempotencyKey(request)
+	if duplicate {
+		execution, err := ec.attach(ctx, entry, entry.assigned)
+		if execution == nil {
+			return nil, false, err
+		}
+		return execution, true, nil
+	}
+
+	pending := ec.executionService.reserveExecution(ctx, agent.GetID(), request.Labels)
+	if entry != nil {
+		ec.executionService.idempotency.assign(entry, pending.ID)
+	}
+
+	// The execution outlives the request, but keeps its request ID and other values
+	runCtx := WithReservedExecutionID(requestContext(context.WithoutCancel(ctx), request), pending.ID)
+	go func() {
+		runCtx, release, err := ec.materializeInput(runCtx, request)
+		if err != nil {
+			ec.executionService.failReservedExecution(pending.ID, err)
+			ec.settle(entry, nil, err)
+			return
+		}
+		execution, err := ec.router.ExecuteAgent(runCtx, agent, request.Input)
+		release()
+		if execution == nil && err != nil {
+			ec.logger.Warn("asynchronous execution was rejected",
+				zap.String("agent_id", agent.GetID()),
+				zap.String("execution_id", pending.ID),
+				zap.Error(err))
+			ec.executionService.failReservedExecution(pending.ID, err)
+		}
+		ec.settle(entry, execution, err)
+	}()
+
+	return pending, false, nil
+}
+
+// executeOrQueue runs the agent like Execute when it starts at once. When it has to wait behind
+// another execution it keeps waiting in the background, and a snapshot of its queued record is
+// returned instead. release is called once the execution finished.
+func (ec *ExecutionCoordinator) executeOrQueue(ctx, runCtx context.Context, agent agents.IAgent, input string, entry *idempotencyEntry, release func()) (*models.AgentExecution, error) {
+	// A queued execution outlives the request; one starting at once still stops with it
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(runCtx))
+	pending, err := ec.router.Enqueue(runCtx, agent, input)
+	if err != nil {
+		cancel()
+		release()
+		if reservedID := ReservedExecutionIDFromContext(runCtx); reservedID != "" {
+			ec.executionService.failReservedExecution(reservedID, err)
+		}
+		ec.settle(entry, nil, err)
+		return nil, err
+	}
+
+	if pending.Queued == nil {
+		stop := context.AfterFunc(ctx, cancel)
+		execution, err := pending.Wait(runCtx)
+		stop()
+		cancel()
+		release()
+		if execution == nil && err != nil {
+			ec.executionService.failReservedExecution(pending.ExecutionID, err)
+		}
+		ec.settle(entry, execution, err)
+		return execution, err
+	}
+
+	go func() {
+		defer cancel()
+		defer release()
+		execution, err := pending.Wait(runCtx)
+		ec.settle(entry, execution, err)
+	}()
+	return pending.Queued, nil
+}
+
+// ReplayOverrides changes what a replay runs with; unset fields keep the replayed execution's values.
+// Parameters and Env entries are merged over the original's.
+type ReplayOverrides struct {
+	Input          *string
+	Parameters     map[string]interface{}
+	Env            map[string]string
+	WorkingDir     *string
+	TimeoutSeconds *int
+	OutputEncoding models.OutputEncoding
+}
+
+// Replay runs the agent of an execution again with the input, parameters, env overrides, working
+// directory, timeout and labels it ran with, changed by overrides and bypassing the result cache.
+// The new execution records the replayed one in ReplayOf. Like Start with async set and like Execute
+// otherwise, it returns the pending or the finished execution, along with warnings about what the
+// replay runs with that differs from the replayed execution's snapshot, such as a changed executable.
+func (ec *ExecutionCoordinator) Replay(ctx context.Context, executionID string, overrides ReplayOverrides, async bool) (*models.AgentExecution, []string, error) {
+	original, err := ec.executionService.GetExecution(executionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if original.Inputs == nil {
+		return nil, nil, models.NewKindError(models.ErrExecutionConflict, "execution %s has not recorded its inputs yet", executionID)
+	}
+	if original.Inputs.Content != nil {
+		return nil, nil, models.NewKindError(models.ErrExecutionConflict, "execution %s ran on binary input, which is not kept", executionID)
+	}
+
+	inputs := *original.Inputs
+	history, parameters := splitConversationHistory(mergeParameters(inputs.Parameters, overrides.Parameters))
+	request := ExecutionRequest{
+		AgentID:        original.AgentID,
+		Input:          inputs.Input,
+		Parameters:     parameters,
+		Env:            mergeStringMaps(inputs.Env, overrides.Env),
+		WorkingDir:     inputs.WorkingDir,
+		TimeoutSeconds: inputs.TimeoutSeconds,
+		Labels:         original.Labels,
+		NoCache:        true,
+		OutputEncoding: inputs.OutputEncoding,
+
+		ConversationHistory: history,
+	}
+	if overrides.Input != nil {
+		request.Input = *overrides.Input
+	}
+	if overrides.WorkingDir != nil {
+		request.WorkingDir = *overrides.WorkingDir
+	}
+	if overrides.TimeoutSeconds != nil {
+		request.TimeoutSeconds = *overrides.TimeoutSeconds
+	}
+	if overrides.OutputEncoding != "" {
+		request.OutputEncoding = overrides.OutputEncoding
+	}
+
+	warnings := ec.replayWarnings(original, request)
+	ctx = WithReplayOf(ctx, executionID)
+	if async {
+		execution, _, err := ec.Start(ctx, request)
+		return execution, warnings, err
+	}
+	execution, _, err := ec.Execute(ctx, request)
+	return execution, warnings, err
+}
+
+// replayWarnings compares the snapshot of the replayed execution with what the replay request would
+// run with now
+func (ec *ExecutionCoordinator) replayWarnings(original *models.AgentExecution, request ExecutionRequest) []string {
+	snapshot, err := ec.executionService.GetExecutionSnapshot(original.ID)
+	if err != nil {
+		return nil
+	}
+	agentConfig, err := ec.agentService.GetAgent(request.AgentID)
+	if err != nil {
+		return nil
+	}
+
+	config := *agentConfig
+	if request.WorkingDir != "" {
+		config.WorkingDirectory = request.WorkingDir
+	}
+	warnings := models.ReplayWarnings(snapshot, ec.executionService.currentSnapshot(&config))
+	for _, warning := range warnings {
+		ec.logger.Warn("replay differs from the replayed execution",
+			zap.String("execution_id", original.ID),
+			zap.String("agent_id", request.AgentID),
+			zap.String("warning", warning))
+	}
+	return warnings
+}
+
+// mergeParameters returns base with overrides applied, nil when both are empty
+func mergeParameters(base, overrides map[string]interface{}) map[string]interface{} {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := make(map[string]interface{}, len(base)+len(overrides))
+	for name, value := range base {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	return merged
+}
+
+// claimIdempotencyKey claims the request's idempotency key, returning its entry and whether another
+// request claimed it first; requests without a key get a nil entry
+func (ec *ExecutionCoordinator) claimIdempotencyKey(request ExecutionRequest) (*idempotencyEntry, bool) {
+	if request.IdempotencyKey == "" || ec.executionService.idempotency == nil {
+		return nil, false
+	}
+	return ec.executionService.idempotency.claim(request.AgentID, request.IdempotencyKey)
+}
+
+// attach waits on signal of an entry claimed by another request and returns its execution
+func (ec *ExecutionCoordinator) attach(ctx context.Context, entry *idempotencyEntry, signal chan struct{}) (*models.AgentExecution, error) {
+	executionID, err := ec.executionService.idempotency.await(ctx, entry, signal)
+	if executionID == "" {
+		return nil, err
+	}
+
+	execution, getErr := ec.executionService.GetExecution(executionID)
+	if getErr != nil {
+		return nil, getErr
+	}
+	return execution, err
+}
+
+// settle records the outcome of the execution started for a claimed idempotency key
+func (ec *ExecutionCoordinator) settle(entry *idempotencyEntry, execution *models.AgentExecution, err error) {
+	if entry == nil {
+		return
+	}
+	if execution == nil {
+		// The request was rejected before it ran, so a retry may run it
+		ec.executionService.idempotency.reject(entry, err)
+		return
+	}
+	ec.executionService.idempotency.finish(entry, err)
+}
+
+// AgentToggleResult is the outcome of enabling or disabling an agent
+type AgentToggleResult struct {
+	AgentID             string              `json:"agent_id"`
+	Enabled             bool                `json:"enabled"`
+	RunningExecutions   []string            `json:"running_executions"`             // In-flight executions left to finish
+	CancelledExecutions []string            `json:"cancelled_executions,omitempty"` // In-flight executions cancelled on disable
+	Hooks               []models.HookResult `json:"hooks,omitempty"`                // Lifecycle hooks run, such as a restarted persistent agent's pre-stop hook
+}
+
+// AgentRestartDrainTimeout bounds how long a restart waits for the executions it cancelled to exit
+const AgentRestartDrainTimeout = 30 * time.Second
+
+// SetAgentEnabled enables or disables an agent. A disabled agent rejects new executions from every
+// protocol and the scheduler; its in-flight executions finish unless cancelActive is set. It fails
+// with ErrOperationInProgress while another lifecycle operation runs on the agent, unless wait is
+// set and that operation finishes within the operation wait timeout. Cancelled executions record
+// requestedBy as the client that asked for the cancellation.
+func (ec *ExecutionCoordinator) SetAgentEnabled(agentID string, enabled, cancelActive, wait bool, requestedBy string) (*AgentToggleResult, error) {
+	action := models.AgentActionDisable
+	if enabled {
+		action = models.AgentActionEnable
+	}
+	release, err := ec.lockAgent(agentID, action, wait)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return ec.setAgentEnabled(agentID, enabled, cancelActive, "agent disabled", requestedBy)
+}
+
+// RestartAgent cancels the agent's in-flight executions, waits for them to exit and leaves the agent
+// enabled, so it starts afresh. Like SetAgentEnabled it holds the agent's operation lock throughout.
+func (ec *ExecutionCoordinator) RestartAgent(agentID string, wait bool, requestedBy string) (*AgentToggleResult, error) {
+	release, err := ec.lockAgent(agentID, models.AgentActionRestart, wait)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	stopped, err := ec.stopForRestart(agentID, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ec.setAgentEnabled(agentID, true, false, "", requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	result.CancelledExecutions = stopped.CancelledExecutions
+	result.Hooks = stopped.Hooks
+
+	ec.logger.Info("agent restarted",
+		zap.String("agent_id", agentID),
+		zap.Int("cancelled_executions", len(stopped.CancelledExecutions)))
+	return result, nil
+}
+
+// stopForRestart disables the agent, cancelling its in-flight executions, waits for them to exit and
+// stops its persistent process; the caller holds the agent's operation lock. A persistent agent's
+// pre-stop hook runs first, so a hook aborting the stop leaves the agent untouched.
+func (ec *ExecutionCoordinator) stopForRestart(agentID, requestedBy string) (*AgentToggleResult, error) {
+	hook, err := agents.RunPreStopHook(agentID)
+	if hook != nil {
+		ec.operations.RecordHook(agentID, *hook)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stopped, err := ec.setAgentEnabled(agentID, false, true, "agent restarted", requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	if hook != nil {
+		stopped.Hooks = []models.HookResult{*hook}
+	}
+
+	deadline := time.Now().Add(AgentRestartDrainTimeout)
+	for _, executionID := range stopped.CancelledExecutions {
+		for !ec.executionService.executionFinished(executionID) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !ec.executionService.executionFinished(executionID) {
+			ec.logger.Warn("cancelled execution still running after restart drain timeout",
+				zap.String("agent_id", agentID),
+				zap.String("execution_id", executionID))
+		}
+	}
+
+	// A persistent agent gets a new process with its next execution
+	agents.StopPersistentProcess(agentID)
+	return stopped, nil
+}
+
+// CancelAgentExecutions cancels every unfinished execution of the agent, queued ones included, and
+// reports the outcome per execution. Unlike disabling the agent with cancel_active, the agent keeps
+// accepting new executions.
+func (ec *ExecutionCoordinator) CancelAgentExecutions(agentID, requestedBy string) (*models.CancelAllResult, error) {
+	if _, err := ec.agentService.GetAgent(agentID); err != nil {
+		return nil, err
+	}
+
+	result := ec.executionService.CancelActiveExecutions(ExecutionFilter{AgentID: agentID}, "all executions of agent cancelled", requestedBy)
+	ec.logger.Info("cancelled all executions of agent",
+		zap.String("agent_id", agentID),
+		zap.Int("matched", result.Matched),
+		zap.Int("cancelled", result.Cancelled),
+		zap.String("requested_by", requestedBy))
+	return result, nil
+}
+
+// StartAgent starts a persistent agent's process, forgetting its failed starts: it takes the agent
+// out of the backoff and fatal states, in which its process is not started on demand
+func (ec *ExecutionCoordinator) StartAgent(agentID string, wait bool) (*models.ProcessStatus, error) {
+	release, err := ec.lockAgent(agentID, models.AgentActionStart, wait)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	agentConfig, err := ec.agentService.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if agentConfig.Mode != models.PersistentMode {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "agent %s is not a persistent agent and has no process to start", agentID)
+	}
+	return ec.startPersistent(agentConfig)
+}
+
+// AttachAgent attaches a session to the stdio of a persistent agent's running process; detaching
+// the session leaves the process running. An agent has at most one session at a time.
+func (ec *ExecutionCoordinator) AttachAgent(agentID string) (*agents.AttachSession, error) {
+	agentConfig, err := ec.agentService.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if agentConfig.Mode != models.PersistentMode {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "agent %s is not a persistent agent and has no process to attach to", agentID)
+	}
+
+	session, err := agents.AttachPersistentProcess(agentID)
+	if err != nil {
+		return nil, err
+	}
+	ec.logger.Info("attached to persistent agent", zap.String("agent_id", agentID), zap.Int("pid", session.PID()))
+	return session, nil
+}
+
+// startPersistent starts a persistent agent's process, clearing its failed starts; the caller holds
+// the agent's operation lock
+func (ec *ExecutionCoordinator) startPersistent(agentConfig *models.AgentConfiguration) (*models.ProcessStatus, error) {
+	agentID := agentConfig.ID
+	ctx := context.Background()
+	if ec.executionService.processRegistry != nil {
+		ctx = agents.WithProcessRegistry(ctx, ec.executionService.processRegistry)
+	}
+	status, err := agents.StartPersistentAgent(ctx, agentConfig, ec.logger)
+	if err != nil {
+		return &status, fmt.Errorf("failed to start persistent agent %s: %w", agentID, err)
+	}
+
+	ec.logger.Info("persistent agent started", zap.String("agent_id", agentID), zap.Int("pid", status.PID))
+	return &status, nil
+}
+
+// CurrentAgentOperation returns the lifecycle operation in progress on the agent, or nil when there is none
+func (ec *ExecutionCoordinator) CurrentAgentOperation(agentID string) (*models.OperationResult, error) {
+	if _, err := ec.agentService.GetAgent(agentID); err != nil {
+		return nil, err
+	}
+	return ec.operations.Current(agentID), nil
+}
+
+// lockAgent takes the agent's operation lock for action, waiting up to the operation wait timeout
+// for a conflicting operation when wait is set
+func (ec *ExecutionCoordinator) lockAgent(agentID string, action models.TaskAction, wait bool) (func(), error) {
+	agentConfig, err := ec.agentService.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := models.OperationResult{Target: agentID, Action: action, CurrentState: enabledState(agentConfig.Enabled), ExpectedState: enabledState(action != models.AgentActionDisable)}
+	timeout := time.Duration(0)
+	if wait {
+		timeout = ec.operationWait
+	}
+	return ec.operations.Acquire(operation, timeout)
+}
+
+// enabledState names an agent's enabled state in operation results
+func enabledState(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// setAgentEnabled applies the agent's new enabled state, cancelling executions for reason when asked;
+// callers hold the agent's operation lock
+func (ec *ExecutionCoordinator) setAgentEnabled(agentID string, enabled, cancelActive bool, reason, requestedBy string) (*AgentToggleResult, error) {
+	if err := ec.agentService.SetAgentEnabled(agentID, enabled); err != nil {
+		return nil, err
+	}
+
+	result := &AgentToggleResult{AgentID: agentID, Enabled: enabled}
+	running, err := runningExecutionIDs(ec.executionService, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list running executions of agent %s: %w", agentID, err)
+	}
+
+	if enabled || !cancelActive {
+		result.RunningExecutions = running
+		return result, nil
+	}
+
+	result.RunningExecutions = []string{}
+	for _, executionID := range running {
+		if err := ec.executionService.CancelExecution(executionID, reason, requestedBy); err != nil {
+			// The execution may have finished since it was listed
+			ec.logger.Warn("failed to cancel execution of disabled agent",
+				zap.String("agent_id", agentID),
+				zap.String("execution_id", executionID),
+				zap.Error(err))
+			continue
+		}
+		result.CancelledExecutions = append(result.CancelledExecutions, executionID)
+	}
+	return result, nil
+}
+
+// checkAgentEnabled rejects executions of a deleted or disabled agent; every path that runs agents
+// checks it
+func checkAgentEnabled(agentConfig *models.AgentConfiguration) error {
+	if agentConfig.IsDeleted() {
+		return models.NewKindError(models.ErrAgentDeleted, "agent %s is deleted", agentConfig.ID)
+	}
+	if !agentConfig.Enabled {
+		return models.NewKindError(models.ErrAgentDisabled, "agent %s is disabled", agentConfig.ID)
+	}
+	return nil
+}
+
+// runningExecutionIDs returns the IDs of the agent's executions that are still starting or running
+func runningExecutionIDs(executionService IExecutionService, agentID string) ([]string, error) {
+	executions, err := executionService.GetActiveExecutions()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, execution := range executions {
+		if execution.AgentID != agentID {
+			continue
+		}
+		if execution.State == models.RunningState || execution.State == models.StartingState {
+			ids = append(ids, execution.ID)
+		}
+	}
+	return ids, nil
+}
+
+// prepare validates the request and returns the agent with the request's overrides applied
+func (ec *ExecutionCoordinator) prepare(request ExecutionRequest) (agents.IAgent, error) {
+	agentConfig, err := ec.agentService.GetAgent(request.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAgentEnabled(agentConfig); err != nil {
+		return nil, err
+	}
+
+	if err := models.ValidateLabels(request.Labels); err != nil {
+		return nil, err
+	}
+	if err := ValidateIdempotencyKey(request.IdempotencyKey); err != nil {
+		return nil, err
+	}
+	if request.TimeoutSeconds < 0 {
+		return nil, models.ValidationError("timeout_seconds cannot be negative")
+	}
+	if err := models.ValidateOutputEncoding("output_encoding", request.OutputEncoding); err != nil {
+		return nil, err
+	}
+	if err := ValidateQueueBehavior(request.QueueBehavior); err != nil {
+		return nil, err
+	}
+	if request.BinaryInput != nil {
+		if err := ec.inputs.Check(request.BinaryInput); err != nil {
+			return nil, err
+		}
+	}
+
+	if agentConfig.ValidateInput {
+		if err := agentConfig.InputSchema.ValidateParameters(request.Parameters).Err(); err != nil {
+			return nil, err
+		}
+	}
+	parameterArgs, err := parameterArgs(request.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEnvOverrides(request.Env); err != nil {
+		return nil, err
+	}
+	if request.WorkingDir != "" {
+		if err := validateWorkingDir(request.WorkingDir); err != nil {
+			return nil, err
+		}
+	}
+	// The process of a persistent agent is shared by its executions, so it cannot differ per request
+	if agentConfig.Mode == models.PersistentMode && (len(parameterArgs) > 0 || len(request.Env) > 0 || request.WorkingDir != "") {
+		return nil, models.ValidationError("parameters, env and working_dir cannot be overridden for persistent agents")
+	}
+
+	// Apply overrides to a copy so the registered configuration is untouched
+	config := *agentConfig
+	config.CliArgs = mergeStringMaps(agentConfig.CliArgs, parameterArgs)
+	config.Envs = mergeStringMaps(agentConfig.Envs, request.Env)
+	if request.WorkingDir != "" {
+		config.WorkingDirectory = request.WorkingDir
+	}
+	if request.TimeoutSeconds > 0 {
+		config.Timeout = request.TimeoutSeconds
+	}
+
+	return ec.router.CreateAgent(&config)
+}
+
+// requestContext attaches the request's labels, cache bypass, output encoding and the overrides to
+// record for replays to ctx
+func requestContext(ctx context.Context, request ExecutionRequest) context.Context {
+	ctx = WithNoCache(WithExecutionLabels(ctx, request.Labels), request.NoCache)
+	inputs := models.ExecutionInputs{
+		Parameters:     request.Parameters,
+		WorkingDir:     request.WorkingDir,
+		TimeoutSeconds: request.TimeoutSeconds,
+		OutputEncoding: request.OutputEncoding,
+	}
+	inputs.SetEnv(request.Env)
+	return WithConversationHistory(WithExecutionInputs(WithOutputEncoding(ctx, request.OutputEncoding), inputs), request.ConversationHistory)
+}
+
+// materializeInput writes the request's binary input to the file its execution is handed, recording
+// what it was among the execution's inputs; release removes the file once the execution finished
+func (ec *ExecutionCoordinator) materializeInput(ctx context.Context, request ExecutionRequest) (context.Context, func(), error) {
+	if request.BinaryInput == nil {
+		return ctx, func() {}, nil
+	}
+	path, content, err := ec.inputs.Materialize(ctx, request.BinaryInput)
+	if err != nil {
+		return ctx, func() {}, err
+	}
+
+	// The same input means nothing without the same content, so the result is never cached
+	inputs, _ := ctx.Value(executionInputsContextKey).(models.ExecutionInputs)
+	inputs.Content = content
+	ctx = agents.WithInputFile(WithNoCache(WithExecutionInputs(ctx, inputs), true), path)
+	return ctx, func() { os.Remove(path) }, nil
+}
+
+// parameterArgs converts execution parameters into CLI arguments. Values must be strings, numbers or
+// booleans; true passes the bare flag and false omits it.
+func parameterArgs(parameters map[string]interface{}) (map[string]string, error) {
+	args := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		if strings.TrimLeft(name, "-") == "" {
+			return nil, models.ValidationError("parameter names cannot be empty")
+		}
+		flag := name
+		if !strings.HasPrefix(flag, "-") {
+			flag = "--" + name
+		}
+
+		switch v := value.(type) {
+		case string:
+			args[flag] = v
+		case float64:
+			args[flag] = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			args[flag] = strconv.Itoa(v)
+		case int64:
+			args[flag] = strconv.FormatInt(v, 10)
+		case bool:
+			if v {
+				args[flag] = ""
+			}
+		default:
+			return nil, models.ValidationError(fmt.Sprintf("parameter %s must be a string, number or boolean", name))
+		}
+	}
+	return args, nil
+}
+
+// validateEnvOverrides rejects environment variable names a process environment can't carry
+func validateEnvOverrides(env map[string]string) error {
+	for name := range env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return models.ValidationError(fmt.Sprintf("invalid environment variable name %q", name))
+		}
+	}
+	return nil
+}
+
+// validateWorkingDir requires a working directory override to be an existing absolute directory
+func validateWorkingDir(dir string) error {
+	if !filepath.IsAbs(dir) {
+		return models.ValidationError("working_dir must be an absolute path")
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return models.ValidationError(fmt.Sprintf("working_dir %s is not a directory", dir))
+	}
+	return nil
+}
+
+// mergeStringMaps returns base with overrides applied, without modifying either map
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
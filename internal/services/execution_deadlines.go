@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// attemptDeadline is the deadline of an execution's running attempt and how far it may be extended
+type attemptDeadline struct {
+	*agents.ExecutionDeadline
+	maxTotal time.Duration // Measured from the start of the attempt, 0 when no extensions are allowed
+}
+
+// attemptDeadline bounds an attempt of the execution by its agent's timeout, or the default one, or
+// what is left of the execution's budget, whichever is less, registering the deadline so
+// ExtendExecution can move it. The returned function releases the deadline once the attempt ends.
+func (es *ExecutionService) attemptDeadline(ctx context.Context, agent agents.IAgent, execution *models.AgentExecution, budget executionBudget) (context.Context, func()) {
+	config := agent.GetConfig()
+	timeout := es.agentTimeout(config)
+	if config == nil || timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	ctx, deadline, cancel := agents.WithExecutionDeadline(ctx, budget.attemptTimeout(timeout))
+	registered := &attemptDeadline{ExecutionDeadline: deadline, maxTotal: time.Duration(config.MaxTotalTimeout) * time.Second}
+	at := deadline.Deadline()
+
+	es.mutex.Lock()
+	es.deadlines[execution.ID] = registered
+	execution.Timeout = int(timeout / time.Second)
+	execution.Deadline = &at
+	es.mutex.Unlock()
+
+	return ctx, func() {
+		es.mutex.Lock()
+		if es.deadlines[execution.ID] == registered {
+			delete(es.deadlines, execution.ID)
+		}
+		es.mutex.Unlock()
+		cancel()
+	}
+}
+
+// ExtendExecution pushes the deadline of a running execution out by the given duration, recording the
+// extension in its state history. The new deadline is capped at the agent's max_total_timeout after
+// the attempt started; agents without one cannot be extended, and neither can executions that ended.
+func (es *ExecutionService) ExtendExecution(executionID string, by time.Duration, reason, requestedBy string) (*models.DeadlineExtension, error) {
+	if by <= 0 {
+		errs := models.ValidationErrors{}
+		errs.Add("seconds", models.ValidationOutOfRange, "the deadline can only be extended by a positive number of seconds")
+		return nil, errs.Err()
+	}
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	execution, exists := es.executions[executionID]
+	if !exists {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
+	}
+	if execution.State != models.RunningState && execution.State != models.StartingState {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "execution with ID %s cannot be extended in state %s", executionID, execution.State)
+	}
+
+	deadline, ok := es.deadlines[executionID]
+	if !ok {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "execution with ID %s has no deadline to extend", executionID)
+	}
+	if deadline.maxTotal <= 0 {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "agent %s does not allow deadline extensions without a max_total_timeout", execution.AgentID)
+	}
+
+	current := deadline.Deadline()
+	maxDeadline := deadline.Start().Add(deadline.maxTotal)
+	target := current.Add(by)
+	if target.After(maxDeadline) {
+		target = maxDeadline
+	}
+	if !target.After(current) {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "execution with ID %s already reached its max total timeout of %s", executionID, deadline.maxTotal)
+	}
+	if !deadline.Extend(target) {
+		return nil, models.NewKindError(models.ErrInvalidTransition, "execution with ID %s ended before its deadline could be extended", executionID)
+	}
+
+	granted := target.Sub(current)
+	execution.ExtendDeadline(target, fmt.Sprintf("deadline extended by %s: %s", granted, reason), requestedBy)
+	es.executions[executionID] = execution
+	es.storeExecution(execution)
+
+	es.logger.Info("execution deadline extended",
+		zap.String("execution_id", executionID),
+		zap.String("agent_id", execution.AgentID),
+		zap.Duration("requested", by),
+		zap.Duration("granted", granted),
+		zap.Time("deadline", target),
+		zap.String("reason", reason),
+		zap.String("requested_by", requestedBy))
+
+	return &models.DeadlineExtension{
+		ExecutionID:      executionID,
+		RequestedSeconds: int(by.Round(time.Second) / time.Second),
+		GrantedSeconds:   int(granted.Round(time.Second) / time.Second),
+		Deadline:         target,
+		MaxDeadline:      maxDeadline,
+	}, nil
+}
+
+// executionControl extends the deadline of an execution when its agent process asks for more time
+type executionControl struct {
+	service     *ExecutionService
+	executionID string
+	agentID     string
+}
+
+// ExtendDeadline extends the execution's deadline on behalf of its agent
+func (c *executionControl) ExtendDeadline(by time.Duration, reason string) error {
+	_, err := c.service.ExtendExecution(c.executionID, by, reason, "agent:"+c.agentID)
+	return err
+}
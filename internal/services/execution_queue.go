@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// QueueBehavior tells an execute request what to do when its agent is busy with another execution
+type QueueBehavior string
+
+const (
+	QueueBehaviorWait           QueueBehavior = "wait"            // Wait in the queue until the execution finishes (the default)
+	QueueBehaviorReturnPosition QueueBehavior = "return_position" // Return the queued execution and its position at once
+)
+
+// ValidateQueueBehavior checks that behavior is empty or one of wait, return_position
+func ValidateQueueBehavior(behavior QueueBehavior) error {
+	switch behavior {
+	case "", QueueBehaviorWait, QueueBehaviorReturnPosition:
+		return nil
+	}
+	return models.ValidationError(fmt.Sprintf("queue_behavior must be %s or %s, got %q", QueueBehaviorWait, QueueBehaviorReturnPosition, behavior))
+}
+
+// queuedExecution is an execution waiting in its read-write agent's queue
+type queuedExecution struct {
+	executionID string
+	queuedAt    time.Time
+}
+
+// PendingExecution is an execution handed to the execution router. Position is its place in its
+// agent's queue, 1 running next, and 0 when it starts without waiting; Queued is then nil, and a
+// snapshot of its queued record otherwise.
+type PendingExecution struct {
+	ExecutionID string
+	Position    int
+	Queued      *models.AgentExecution
+	wait        func(ctx context.Context) (*models.AgentExecution, error)
+}
+
+// Wait blocks until the execution finishes, or ctx is done
+func (p *PendingExecution) Wait(ctx context.Context) (*models.AgentExecution, error) {
+	return p.wait(ctx)
+}
+
+// Enqueue hands the agent's execution to the execution service matching its access type without
+// waiting for it. Read-only executions never queue; they run when the pending execution is waited on.
+func (er *ExecutionRouter) Enqueue(ctx context.Context, agent agents.IAgent, input string) (*PendingExecution, error) {
+	executor := er.ExecutorFor(agent)
+	if readWrite, ok := executor.(*ReadWriteExecutionService); ok {
+		return readWrite.Enqueue(ctx, agent, input)
+	}
+	return &PendingExecution{
+		ExecutionID: ReservedExecutionIDFromContext(ctx),
+		wait: func(context.Context) (*models.AgentExecution, error) {
+			return executor.ExecuteAgent(ctx, agent, input)
+		},
+	}, nil
+}
+
+// estimatedWait estimates how long an execution at position in the agent's queue waits before it
+// starts from the agent's recent average duration; 0 without metrics
+func (es *ExecutionService) estimatedWait(agentID string, position int) time.Duration {
+	if es.metricsCollector == nil {
+		return 0
+	}
+	return es.metricsCollector.RecentAverageDuration(agentID) * time.Duration(position)
+}
+
+// queueExecution records that an execution waits at position in its agent's queue, creating its
+// record unless it was reserved, and returns a snapshot of the record
+func (es *ExecutionService) queueExecution(ctx context.Context, agentID, executionID string, position int) *models.AgentExecution {
+	wait := es.estimatedWait(agentID, position)
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	execution, exists := es.executions[executionID]
+	if !exists {
+		execution = newPendingExecution(ctx, executionID, agentID, ExecutionLabelsFromContext(ctx))
+		es.executions[executionID] = execution
+	}
+	reason := fmt.Sprintf("waiting for %d execution(s) of agent %s", position, agentID)
+	if err := execution.Transition(es.stateMachine, models.QueuedState, reason, ""); err != nil {
+		es.logger.Warn("failed to record queued execution", zap.String("execution_id", executionID), zap.Error(err))
+	}
+	execution.QueuePosition = position
+	execution.EstimatedWaitMs = wait.Milliseconds()
+	es.storeExecution(execution)
+
+	return execution.Clone()
+}
+
+// updateQueuePositions renumbers the executions still waiting in an agent's queue once startedID left it
+func (es *ExecutionService) updateQueuePositions(agentID, startedID string, waiting []queuedExecution) {
+	average := es.estimatedWait(agentID, 1)
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if started, exists := es.executions[startedID]; exists {
+		started.QueuePosition = 0
+		started.EstimatedWaitMs = 0
+	}
+	for i, queued := range waiting {
+		if execution, exists := es.executions[queued.executionID]; exists && execution.State == models.QueuedState {
+			execution.QueuePosition = i + 1
+			execution.EstimatedWaitMs = (average * time.Duration(i+1)).Milliseconds()
+		}
+	}
+}
+
+// stoppedWhileQueued reports whether the execution was stopped before it left its queue
+func (es *ExecutionService) stoppedWhileQueued(executionID string) bool {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	execution, exists := es.executions[executionID]
+	return exists && execution.State == models.CancelledState
+}
+
+// cancelQueuedExecution cancels the record of a queued execution whose caller gave up before it
+// started; executions stopped while queued are already cancelled
+func (es *ExecutionService) cancelQueuedExecution(executionID string, cause error) {
+	es.mutex.Lock()
+	execution, exists := es.executions[executionID]
+	if !exists || execution.State != models.QueuedState {
+		es.mutex.Unlock()
+		return
+	}
+	if err := execution.Transition(es.stateMachine, models.CancelledState, cause.Error(), ""); err != nil {
+		es.mutex.Unlock()
+		es.logger.Error("failed to cancel queued execution", zap.String("execution_id", executionID), zap.Error(err))
+		return
+	}
+	now := time.Now()
+	execution.ErrorMessage = cause.Error()
+	execution.EndTime = &now
+	execution.QueuePosition = 0
+	execution.EstimatedWaitMs = 0
+	es.mutex.Unlock()
+
+	es.notifyCompletion(execution)
+}
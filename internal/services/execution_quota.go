@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// ErrExecutionQuotaExceeded is returned when a client already has its maximum number of executions running
+var ErrExecutionQuotaExceeded = models.ErrExecutionQuotaExceeded
+
+// ExecutionQuota caps the number of executions each client may have in flight at once
+type ExecutionQuota struct {
+	mutex        sync.Mutex
+	defaultLimit int            // Applies to clients without an override, 0 for unlimited
+	limits       map[string]int // Per-client overrides keyed by client ID
+	active       map[string]int
+}
+
+// NewExecutionQuota creates a new ExecutionQuota
+func NewExecutionQuota(defaultLimit int, limits map[string]int) *ExecutionQuota {
+	quota := &ExecutionQuota{active: make(map[string]int)}
+	quota.SetLimits(defaultLimit, limits)
+	return quota
+}
+
+// SetLimits replaces the configured limits; executions already running are unaffected
+func (q *ExecutionQuota) SetLimits(defaultLimit int, limits map[string]int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.defaultLimit = defaultLimit
+	q.limits = make(map[string]int, len(limits))
+	for clientID, limit := range limits {
+		q.limits[clientID] = limit
+	}
+}
+
+// Acquire reserves an execution slot for the client
+func (q *ExecutionQuota) Acquire(clientID string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	limit, exists := q.limits[clientID]
+	if !exists {
+		limit = q.defaultLimit
+	}
+
+	if limit > 0 && q.active[clientID] >= limit {
+		return fmt.Errorf("%w: client %s is limited to %d concurrent executions", ErrExecutionQuotaExceeded, clientID, limit)
+	}
+
+	q.active[clientID]++
+	return nil
+}
+
+// Release frees a slot reserved with Acquire
+func (q *ExecutionQuota) Release(clientID string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.active[clientID] <= 1 {
+		delete(q.active, clientID)
+		return
+	}
+	q.active[clientID]--
+}
+
+// Active returns the number of executions the client currently has in flight
+func (q *ExecutionQuota) Active(clientID string) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.active[clientID]
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// ExecutionRouter builds runtime agents with the agent factory and runs them through the execution
+// service matching their access type: read-write agents queue so one execution runs at a time,
+// read-only agents share the read-only pool. REST, JSON-RPC, gRPC and the scheduler all run agents
+// through the router of their execution service, so they queue behind each other.
+type ExecutionRouter struct {
+	factory   agents.IAgentFactory
+	readWrite IExecutionService
+	readOnly  IExecutionService
+}
+
+// NewExecutionRouter creates an ExecutionRouter over executionService. Executions are queued and
+// pooled when executionService is an *ExecutionService; other implementations run every execution
+// directly.
+func NewExecutionRouter(executionService IExecutionService, factory agents.IAgentFactory, logger *zap.Logger) *ExecutionRouter {
+	router := &ExecutionRouter{
+		factory:   factory,
+		readWrite: executionService,
+		readOnly:  executionService,
+	}
+	if base, ok := executionService.(*ExecutionService); ok {
+		router.readWrite = NewReadWriteExecutionServiceOn(base, logger)
+		router.readOnly = NewReadOnlyExecutionServiceOn(base, logger, 0)
+	}
+	return router
+}
+
+// ExecutionRouterFor returns the router every caller of executionService shares, so that they
+// serialize on the same read-write queues and share the same read-only pool
+func ExecutionRouterFor(executionService IExecutionService, logger *zap.Logger) *ExecutionRouter {
+	if base, ok := executionService.(*ExecutionService); ok {
+		return base.Router()
+	}
+	return NewExecutionRouter(executionService, agents.NewAgentFactory(logger), logger)
+}
+
+// CreateAgent builds the runtime agent of an agent configuration
+func (er *ExecutionRouter) CreateAgent(config *models.AgentConfiguration) (agents.IAgent, error) {
+	return er.factory.CreateAgent(config)
+}
+
+// ExecutorFor returns the execution service matching the agent's access type
+func (er *ExecutionRouter) ExecutorFor(agent agents.IAgent) IExecutionService {
+	if agent.IsReadOnly() {
+		return er.readOnly
+	}
+	return er.readWrite
+}
+
+// ExecuteAgent runs the agent through the execution service matching its access type
+func (er *ExecutionRouter) ExecuteAgent(ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, error) {
+	return er.ExecutorFor(agent).ExecuteAgent(ctx, agent, input)
+}
+
+// Backlog returns the number of executions waiting to start: read-write executions queued behind
+// their agent's running execution and read-only executions waiting for a pool slot
+func (er *ExecutionRouter) Backlog() int {
+	backlog := 0
+	if readWrite, ok := er.readWrite.(*ReadWriteExecutionService); ok {
+		backlog += readWrite.QueuedExecutions()
+	}
+	if readOnly, ok := er.readOnly.(*ReadOnlyExecutionService); ok {
+		for _, pending := range readOnly.pool.Pending() {
+			backlog += pending
+		}
+	}
+	return backlog
+}
+
+// QueueStats returns the queues of the read-write agents, empty when executions are not queued
+func (er *ExecutionRouter) QueueStats() []AgentQueueStats {
+	if readWrite, ok := er.readWrite.(*ReadWriteExecutionService); ok {
+		return readWrite.QueueStats()
+	}
+	return nil
+}
+
+// Execute builds the runtime agent of config and runs it through the execution service matching
+// its access type
+func (er *ExecutionRouter) Execute(ctx context.Context, config *models.AgentConfiguration, input string) (*models.AgentExecution, error) {
+	agent, err := er.CreateAgent(config)
+	if err != nil {
+		return nil, err
+	}
+	return er.ExecuteAgent(ctx, agent, input)
+}
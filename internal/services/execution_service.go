@@ -2,13 +2,17 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/logging"
 	"github.com/algonius/algonius-supervisor/pkg/types"
 	"go.uber.org/zap"
 )
@@ -24,8 +28,15 @@ type IExecutionService interface {
 	// ListExecutions retrieves all executions for a specific agent
 	ListExecutions(agentID string) ([]*models.AgentExecution, error)
 
-	// CancelExecution cancels the execution with the specified ID
-	CancelExecution(executionID string) error
+	// CancelExecution cancels the execution with the specified ID, recording why and at whose request
+	CancelExecution(executionID, reason, requestedBy string) error
+
+	// StopExecution cancels an execution like CancelExecution, stopping its agent with signal instead
+	// of the agent's configured stop signal unless signal is empty
+	StopExecution(executionID, signal, reason, requestedBy string) error
+
+	// ExtendExecution pushes the deadline of a running execution out, up to its agent's max total timeout
+	ExtendExecution(executionID string, by time.Duration, reason, requestedBy string) (*models.DeadlineExtension, error)
 
 	// GetActiveExecutions retrieves all currently active executions
 	GetActiveExecutions() ([]*models.AgentExecution, error)
@@ -35,8 +46,23 @@ type IExecutionService interface {
 
 	// UpdateExecutionState updates the state of an execution
 	UpdateExecutionState(executionID string, newState types.AgentState) error
+
+	// QueryExecutions retrieves executions matching the filter
+	QueryExecutions(filter ExecutionFilter) ([]*models.AgentExecution, error)
+
+	// IterateExecutions calls fn with every execution matching the filter, a page at a time
+	IterateExecutions(filter ExecutionFilter, fn func(*models.AgentExecution) error) error
+
+	// GetExecutionSnapshot retrieves the environment snapshot of an execution's agent process
+	GetExecutionSnapshot(executionID string) (*models.ExecutionSnapshot, error)
+
+	// CancelActiveExecutions cancels every unfinished execution matching the filter, queued ones included
+	CancelActiveExecutions(filter ExecutionFilter, reason, requestedBy string) *models.CancelAllResult
 }
 
+// ExecutionFilter selects executions in QueryExecutions; zero-valued fields match everything
+type ExecutionFilter = models.ExecutionFilter
+
 // IReadWriteExecutionService specialized interface for read-write agents (single concurrent execution)
 type IReadWriteExecutionService interface {
 	IExecutionService
@@ -61,20 +87,24 @@ type IReadOnlyExecutionService interface {
 
 // ResourcePoolMetrics represents resource pool metrics for read-only agents
 type ResourcePoolMetrics struct {
-	TotalCapacity   int     `json:"total_capacity"`   // Total number of available execution slots
-	UsedCapacity    int     `json:"used_capacity"`    // Number of currently used execution slots
-	AvailableCount  int     `json:"available_count"`  // Number of currently available execution slots
-	UtilizationRate float64 `json:"utilization_rate"` // Utilization rate as a percentage
-	MaxConcurrent   int     `json:"max_concurrent"`   // Maximum allowed concurrent executions
+	TotalCapacity   int            `json:"total_capacity"`   // Total number of available execution slots
+	UsedCapacity    int            `json:"used_capacity"`    // Number of currently used execution slots
+	AvailableCount  int            `json:"available_count"`  // Number of currently available execution slots
+	UtilizationRate float64        `json:"utilization_rate"` // Utilization rate as a percentage
+	MaxConcurrent   int            `json:"max_concurrent"`   // Maximum allowed concurrent executions
+	PendingCount    int            `json:"pending_count"`    // Executions waiting for a slot
+	PendingByAgent  map[string]int `json:"pending_by_agent"` // Executions waiting for a slot per agent
 }
 
 // ExecutionService provides a concrete implementation of IExecutionService
 type ExecutionService struct {
-	// executions tracks all executions
+	// executions tracks the executions this instance started, with what only it knows of them such
+	// as their snapshots
 	executions map[string]*models.AgentExecution
 
-	// results stores execution results
-	results map[string]*models.ExecutionResult
+	// store keeps every execution and the results of finished ones, including executions of other
+	// supervisors sharing it and of previous runs
+	store models.ExecutionStore
 
 	// activeExecutions tracks currently running executions
 	activeExecutions map[string]*models.AgentExecution
@@ -94,8 +124,61 @@ type ExecutionService struct {
 	// contextMap tracks execution contexts
 	contextMap map[string]context.Context
 
-	// cancelFuncMap tracks cancel functions for executions
-	cancelFuncMap map[string]context.CancelFunc
+	// cancelFuncMap tracks cancel functions for executions whose agent is running
+	cancelFuncMap map[string]context.CancelCauseFunc
+
+	// deadlines tracks the deadline of each execution's running attempt, which ExtendExecution moves
+	deadlines map[string]*attemptDeadline
+
+	// metricsCollector receives completed execution metrics when set
+	metricsCollector *MetricsCollector
+
+	// quota caps concurrent executions per client when set
+	quota *ExecutionQuota
+
+	// resultCache serves repeated input to agents with a cache TTL
+	resultCache *ResultCache
+
+	// idempotency maps idempotency keys of execute requests to the executions they started
+	idempotency *IdempotencyStore
+
+	// completionHooks run once each execution reaches its final state
+	completionHooks []func(*models.AgentExecution)
+
+	// finished holds the IDs of executions whose completion hooks have run
+	finished map[string]bool
+
+	// stateMachine validates every state change of an execution
+	stateMachine *models.StateMachine
+
+	// artifactStore keeps the files executions leave in their artifacts directory when set
+	artifactStore *ArtifactStore
+
+	// processRegistry tracks the running agent processes in state files when set
+	processRegistry *agents.ProcessRegistry
+
+	// faults injects failures and delays for testing when fault injection is enabled
+	faults *FaultInjector
+
+	// events receives the state changes of executions when set
+	events *EventBus
+
+	// anomalies flags finished executions that deviate from their agent's and task's recent ones when set
+	anomalies *AnomalyDetector
+
+	// router routes the executions of every protocol and the scheduler by access type
+	router     *ExecutionRouter
+	routerOnce sync.Once
+
+	// supervisorVersion and host identify the supervisor in execution snapshots
+	supervisorVersion string
+	host              string
+
+	// minAttemptDuration is the least time left of an execution's budget worth retrying in
+	minAttemptDuration time.Duration
+
+	// defaults are the timeout of agents with none and the retry policy of executions
+	defaults ExecutionDefaults
 }
 
 // executionRequest represents a request to execute an agent
@@ -111,6 +194,7 @@ type executionRequest struct {
 type executionResult struct {
 	execution *models.AgentExecution
 	result    *models.ExecutionResult
+	err       error
 }
 
 // NewExecutionService creates a new instance of ExecutionService
@@ -127,26 +211,66 @@ func NewExecutionService(agentService IAgentService, logger *zap.Logger) *Execut
 
 	service := &ExecutionService{
 		executions:       make(map[string]*models.AgentExecution),
-		results:          make(map[string]*models.ExecutionResult),
+		store:            models.NewInMemoryExecutionStore(),
 		activeExecutions: make(map[string]*models.AgentExecution),
 		agentService:     agentService,
 		logger:           logger,
 		executionQueue:   make(map[string]chan *executionRequest),
 		contextMap:       make(map[string]context.Context),
-		cancelFuncMap:    make(map[string]context.CancelFunc),
+		cancelFuncMap:    make(map[string]context.CancelCauseFunc),
+		deadlines:        make(map[string]*attemptDeadline),
+		resultCache:      NewResultCache(DefaultResultCacheEntries),
+		idempotency:      NewIdempotencyStore(DefaultIdempotencyWindow, DefaultIdempotencyMaxKeys),
+		finished:         make(map[string]bool),
+		stateMachine:     models.DefaultStateMachine(),
 	}
+	service.supervisorVersion = NewBuildInfo("", "", "").Version
+	service.minAttemptDuration = DefaultMinAttemptDuration
+	service.defaults = ExecutionDefaults{MaxRetries: DefaultMaxRetries, RetryBackoff: DefaultRetryBackoff}
+	service.host, _ = os.Hostname()
 
 	return service
 }
 
 // ExecuteAgent executes an agent with the given context, agent interface, and input
 func (es *ExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, error) {
+	// Labels travel on the context so every protocol entry point can supply them
+	labels := ExecutionLabelsFromContext(ctx)
+	if err := models.ValidateLabels(labels); err != nil {
+		return nil, fmt.Errorf("invalid execution labels: %w", err)
+	}
+	trigger := ExecutionTriggerFromContext(ctx)
+	encoding := models.ResolveOutputEncoding(OutputEncodingFromContext(ctx), agent.GetConfig())
+
+	// Serve identical input from the result cache when the agent opts in, unless the caller bypasses it
+	cacheKey := ""
+	if config := agent.GetConfig(); config != nil && config.CacheTTLSeconds > 0 && es.resultCache != nil {
+		cacheKey = resultCacheKey(config, input, encoding)
+		if !NoCacheFromContext(ctx) {
+			ttl := time.Duration(config.CacheTTLSeconds) * time.Second
+			if cached, cachedExecutionID, hit := es.resultCache.Get(cacheKey, ttl); hit {
+				return es.recordCachedExecution(ctx, agent, input, labels, trigger, cached, cachedExecutionID), nil
+			}
+		}
+	}
+
+	// Enforce the caller's concurrent execution quota
+	if clientID := ClientIDFromContext(ctx); clientID != "" && es.quota != nil {
+		if err := es.quota.Acquire(clientID); err != nil {
+			if es.metricsCollector != nil {
+				es.metricsCollector.RecordRateLimitRejection(clientID, RateLimitReasonConcurrency)
+			}
+			return nil, err
+		}
+		defer es.quota.Release(clientID)
+	}
+
 	// Sanitize input before storing
 	sanitizedInput := es.sanitizeSensitiveData(input)
 
 	// Create a new execution record
 	execution := &models.AgentExecution{
-		ID:              generateExecutionID(),
+		ID:              executionIDFor(ctx),
 		AgentID:         agent.GetID(),
 		State:           models.IdleState,
 		PreviousState:   "",
@@ -156,19 +280,64 @@ func (es *ExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgen
 		Context:         make(map[string]interface{}),
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
-		MaxRetries:      3, // Default maximum retries
+		MaxRetries:      es.getExecutionDefaults().MaxRetries,
 		RetryCount:      0,
+		Labels:          labels,
+		TriggerType:     trigger.Type,
+		TriggeredBy:     trigger.By,
+		TaskID:          ExecutionTaskFromContext(ctx),
+		Inputs:          executionInputs(ctx, input),
+		ReplayOf:        ReplayOfFromContext(ctx),
+	}
+
+	// Correlate logs and the agent process with the originating request
+	requestID := logging.RequestIDFromContext(ctx)
+	if requestID != "" {
+		execution.Context["request_id"] = requestID
+	}
+	logger := logging.WithRequestID(es.logger, requestID)
+	ctx = logging.ContextWithExecutionID(ctx, execution.ID)
+
+	// Give the agent a directory of its own to leave files in
+	if es.artifactStore != nil {
+		dir, err := es.artifactStore.Prepare(execution.ID)
+		if err != nil {
+			return nil, err
+		}
+		ctx = agents.WithArtifactsDir(ctx, dir)
+	}
+	if es.processRegistry != nil {
+		ctx = agents.WithProcessRegistry(ctx, es.processRegistry)
 	}
 
+	// The agent process may ask for its deadline to be extended, and records what it was started with
+	control := &executionControl{service: es, executionID: execution.ID, agentID: agent.GetID()}
+	ctx = agents.WithSnapshotRecorder(agents.WithExecutionControl(ctx, control), control)
+	observerCtx := ctx
+	ctx = agents.WithProgressReporter(ctx, func(progress models.ExecutionProgress) {
+		es.reportProgress(observerCtx, execution, progress)
+	})
+
+	// CancelExecution stops the agent by cancelling this context
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer func() {
+		es.mutex.Lock()
+		delete(es.cancelFuncMap, execution.ID)
+		es.mutex.Unlock()
+		cancel(nil)
+	}()
+
 	// Add execution to the tracking maps
 	es.mutex.Lock()
+	es.inheritReservation(execution)
 	es.executions[execution.ID] = execution
 	es.activeExecutions[execution.ID] = execution
+	es.cancelFuncMap[execution.ID] = cancel
 	es.mutex.Unlock()
 
 	// Update state to starting
-	if err := execution.UpdateState(models.StartingState); err != nil {
-		es.logger.Error("failed to update execution state to starting",
+	if err := es.transition(execution, models.StartingState, ""); err != nil {
+		logger.Error("failed to update execution state to starting",
 			zap.String("execution_id", execution.ID),
 			zap.Error(err))
 		return nil, fmt.Errorf("failed to update execution state: %w", err)
@@ -179,40 +348,96 @@ func (es *ExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgen
 	es.activeExecutions[execution.ID] = execution
 	es.executions[execution.ID] = execution
 	es.mutex.Unlock()
+	es.reportState(ctx, execution)
 
 	// Attempt execution with retry logic
 	result, err := es.executeWithRetry(ctx, execution, agent, input) // Use original input for execution
+	if result != nil {
+		// Output asked to be JSON fails the execution when it is not
+		if encodingErr := result.ApplyOutputEncoding(encoding); encodingErr != nil && err == nil {
+			result.Status = types.FailureStatus
+			result.Error = encodingErr.Error()
+			err = encodingErr
+		}
+	}
+	if es.artifactStore != nil {
+		artifacts, rejected, collectErr := es.artifactStore.Collect(execution.ID)
+		if collectErr != nil {
+			logger.Warn("failed to collect execution artifacts",
+				zap.String("execution_id", execution.ID),
+				zap.Error(collectErr))
+		}
+		if result != nil {
+			result.Artifacts = artifacts
+			result.RejectedArtifacts = rejected
+		}
+	}
 
-	// Update execution state based on result
+	// Update execution state based on result. Callers read copies of the execution under the mutex,
+	// so it only changes while holding it.
+	status := executionStatus(result, err)
+	var anomalies []models.ExecutionAnomaly
 	if err != nil {
 		// Determine if this is a permanent or transient error for better error categorization
-		if es.IsTransientError(err) {
-			execution.ErrorCategory = models.TransientError
-		} else {
-			execution.ErrorCategory = models.PermanentError
+		var hung *models.HungAgentError
+		var category types.ErrorCategory = models.PermanentError
+		if errors.Is(err, models.ErrResourceLimitExceeded) {
+			category = models.ResourceLimitError
+		} else if errors.As(err, &hung) {
+			category = models.HungError
+			es.publishHung(execution, agent.GetConfig(), hung)
+		} else if es.IsTransientError(err) {
+			category = models.TransientError
 		}
 
-		// Update state to failed (only if not already failed)
-		if execution.State != types.FailedState {
-			if updateErr := execution.UpdateState(models.FailedState); updateErr != nil {
-				es.logger.Error("failed to update execution state to failed",
-					zap.String("execution_id", execution.ID),
-					zap.Error(updateErr))
+		// Update state to failed, unless the execution already ended as failed or cancelled
+		es.mutex.Lock()
+		execution.Status = status
+		execution.ErrorCategory = category
+		if !execution.IsComplete() {
+			if updateErr := execution.Transition(es.stateMachine, models.FailedState, es.sanitizeSensitiveData(err.Error()), ""); updateErr != nil {
+				err = errors.Join(err, updateErr)
 			}
 		}
 		// Sanitize error message before storing
 		execution.ErrorMessage = es.sanitizeSensitiveData(err.Error())
 		endTime := time.Now()
 		execution.EndTime = &endTime
+		if result != nil {
+			execution.ExitCode = result.ExitCode
+			execution.ForcedKill = result.ForcedKill
+		}
+		es.storeExecution(execution)
+		es.mutex.Unlock()
+		anomalies = es.flagAnomalies(execution, result)
+
+		// Keep the failed result so exit code and stderr remain retrievable
+		if result != nil {
+			result.Input = es.sanitizeSensitiveData(result.Input)
+			result.Output = es.sanitizeSensitiveData(result.Output)
+			result.Error = es.sanitizeSensitiveData(err.Error())
+			result.Stderr = es.sanitizeSensitiveData(result.Stderr)
+			result.Labels = labels
+			result.TriggerType = trigger.Type
+			result.TriggeredBy = trigger.By
+			es.storeResult(execution.ID, result)
+		}
 	} else {
-		// Update state to completed
-		if updateErr := execution.UpdateState(models.CompletedState); updateErr != nil {
-			es.logger.Error("failed to update execution state to completed",
-				zap.String("execution_id", execution.ID),
-				zap.Error(updateErr))
+		// Update state to completed; an execution cancelled while its agent finished stays cancelled
+		es.mutex.Lock()
+		execution.Status = status
+		if execution.State != models.CancelledState {
+			err = execution.Transition(es.stateMachine, models.CompletedState, "", "")
 		}
 		endTime := time.Now()
 		execution.EndTime = &endTime
+		if result != nil {
+			execution.ExitCode = result.ExitCode
+			execution.ForcedKill = result.ForcedKill
+		}
+		es.storeExecution(execution)
+		es.mutex.Unlock()
+		anomalies = es.flagAnomalies(execution, result)
 
 		// Store the result with sanitized data
 		if result != nil {
@@ -220,59 +445,148 @@ func (es *ExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgen
 			result.Input = es.sanitizeSensitiveData(result.Input)
 			result.Output = es.sanitizeSensitiveData(result.Output)
 			result.Error = es.sanitizeSensitiveData(result.Error)
-			es.results[execution.ID] = result
+			result.Labels = labels
+			result.TriggerType = trigger.Type
+			result.TriggeredBy = trigger.By
+			es.storeResult(execution.ID, result)
+
+		// Only successful results are reused
+			if cacheKey != "" && result.Status == types.SuccessStatus {
+				es.resultCache.Put(cacheKey, execution.ID, result)
+			}
 		}
 	}
 
-	// Update in tracking maps
+	if es.metricsCollector != nil {
+		es.metricsCollector.RecordExecution(agent.GetID(), execution.EndTime.Sub(execution.StartTime), execution.Status, execution.ResourceUsage)
+		es.metricsCollector.RecordLabeledExecution(labels, execution.Status)
+	}
+
+	// Update in tracking maps; the caller gets a copy, as the execution's records may still change
 	es.mutex.Lock()
 	es.activeExecutions[execution.ID] = execution
 	es.executions[execution.ID] = execution
+	final := execution.Clone()
 	es.mutex.Unlock()
 
 	// Add execution result logging with context (T041)
 	if err != nil {
-		es.logger.Error("agent execution failed",
+		logger.Error("agent execution failed",
 			zap.String("agent_id", agent.GetID()),
 			zap.String("agent_type", agent.GetType()),
-			zap.String("execution_id", execution.ID),
-			zap.String("error_category", string(execution.ErrorCategory)),
-			zap.Int("retry_count", execution.RetryCount),
-			zap.Int64("execution_time_ms", execution.EndTime.Sub(execution.StartTime).Milliseconds()),
+			zap.String("execution_id", final.ID),
+			zap.String("trigger_type", string(trigger.Type)),
+			zap.String("triggered_by", trigger.By),
+			zap.String("error_category", string(final.ErrorCategory)),
+			zap.Int("retry_count", final.RetryCount),
+			zap.Int64("execution_time_ms", final.EndTime.Sub(final.StartTime).Milliseconds()),
 			zap.Error(err))
 	} else {
-		es.logger.Info("agent execution completed successfully",
+		logger.Info("agent execution completed successfully",
 			zap.String("agent_id", agent.GetID()),
 			zap.String("agent_type", agent.GetType()),
-			zap.String("execution_id", execution.ID),
-			zap.String("state", string(execution.State)),
-			zap.Int64("execution_time_ms", execution.EndTime.Sub(execution.StartTime).Milliseconds()),
+			zap.String("execution_id", final.ID),
+			zap.String("trigger_type", string(trigger.Type)),
+			zap.String("triggered_by", trigger.By),
+			zap.String("state", string(final.State)),
+			zap.Int64("execution_time_ms", final.EndTime.Sub(final.StartTime).Milliseconds()),
 			zap.Int64("output_length", int64(len(result.Output))),
 			zap.String("result_status", string(result.Status)))
 	}
 
-	return execution, err
+	es.notifyCompletion(execution)
+	es.publishAnomalies(execution, anomalies)
+	return final, err
 }
 
-// executeWithRetry handles execution with retry logic
+// recordCachedExecution records a completed execution whose result is copied from the result cache
+func (es *ExecutionService) recordCachedExecution(ctx context.Context, agent agents.IAgent, input string, labels map[string]string, trigger ExecutionTrigger, cached *models.ExecutionResult, cachedExecutionID string) *models.AgentExecution {
+	now := time.Now()
+	execution := &models.AgentExecution{
+		ID:              executionIDFor(ctx),
+		AgentID:         agent.GetID(),
+		State:           models.CompletedState,
+		PreviousState:   models.IdleState,
+		StartTime:       now,
+		EndTime:         &now,
+		LastStateChange: now,
+		Input:           es.sanitizeSensitiveData(input),
+		ExitCode:        cached.ExitCode,
+		Status:          cached.Status,
+		Context:         map[string]interface{}{"cached_execution_id": cachedExecutionID},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Labels:          labels,
+		TriggerType:     trigger.Type,
+		TriggeredBy:     trigger.By,
+		TaskID:          ExecutionTaskFromContext(ctx),
+		Inputs:          executionInputs(ctx, input),
+		ReplayOf:        ReplayOfFromContext(ctx),
+	}
+	requestID := logging.RequestIDFromContext(ctx)
+	if requestID != "" {
+		execution.Context["request_id"] = requestID
+	}
+
+	result := *cached
+	result.ID = execution.ID
+	result.StartTime = now
+	result.EndTime = now
+	result.ExecutionTime = 0
+	result.Labels = labels
+	result.TriggerType = trigger.Type
+	result.TriggeredBy = trigger.By
+	result.PreviousRetries = nil
+	result.FromCache = true
+	result.CachedExecutionID = cachedExecutionID
+	result.Anomalies = nil
+
+	es.mutex.Lock()
+	es.inheritReservation(execution)
+	es.executions[execution.ID] = execution
+	es.mutex.Unlock()
+	es.storeResult(execution.ID, &result)
+
+	// The agent did not run, so the execution is kept out of its duration statistics
+	if es.metricsCollector != nil {
+		es.metricsCollector.RecordLabeledExecution(labels, types.SuccessStatus)
+	}
+
+	logging.WithRequestID(es.logger, requestID).Info("agent execution served from result cache",
+		zap.String("agent_id", agent.GetID()),
+		zap.String("execution_id", execution.ID),
+		zap.String("trigger_type", string(trigger.Type)),
+		zap.String("triggered_by", trigger.By),
+		zap.String("cached_execution_id", cachedExecutionID))
+
+	es.notifyCompletion(execution)
+	return execution
+}
+
+// executeWithRetry handles execution with retry logic. The attempts and the waits between them share
+// the execution's budget; retries are abandoned once too little of it remains.
 func (es *ExecutionService) executeWithRetry(ctx context.Context, execution *models.AgentExecution, agent agents.IAgent, input string) (*models.ExecutionResult, error) {
 	var lastErr error
 	var lastResult *models.ExecutionResult
+	logger := logging.WithRequestID(es.logger, logging.RequestIDFromContext(ctx))
+	budget := newExecutionBudget(ctx, es.agentTimeout(agent.GetConfig()))
 
 	// Retry loop - will execute at least once (retry count 0)
 	for execution.RetryCount <= execution.MaxRetries {
+		es.mutex.Lock()
 		execution.RetryCount++
+		es.mutex.Unlock()
 
-		es.logger.Info("executing agent",
+		logger.Info("executing agent",
 			zap.String("agent_id", agent.GetID()),
 			zap.String("execution_id", execution.ID),
 			zap.Int("retry_count", execution.RetryCount))
 
 		// Update state to running
 		// On retry, the state should be Failed -> Starting -> Running
-		if execution.State != types.RunningState {
-			if err := execution.UpdateState(models.RunningState); err != nil {
-				es.logger.Error("failed to update execution state to running",
+		if es.executionState(execution) != types.RunningState {
+			if err := es.transition(execution, models.RunningState, ""); err != nil {
+				logger.Error("failed to update execution state to running",
 					zap.String("execution_id", execution.ID),
 					zap.Error(err))
 				return nil, fmt.Errorf("failed to update execution state: %w", err)
@@ -284,36 +598,64 @@ func (es *ExecutionService) executeWithRetry(ctx context.Context, execution *mod
 		es.activeExecutions[execution.ID] = execution
 		es.executions[execution.ID] = execution
 		es.mutex.Unlock()
+		es.reportState(ctx, execution)
 
 		// Execute the agent with resource monitoring
-		result, err := es.executeWithResourceMonitoring(ctx, agent, input, execution)
+		result, err := es.executeWithResourceMonitoring(ctx, agent, input, execution, budget)
 
 		if err != nil {
 			// Log the error
-			es.logger.Warn("agent execution failed, checking for retry",
+			logger.Warn("agent execution failed, checking for retry",
 				zap.String("agent_id", agent.GetID()),
 				zap.String("execution_id", execution.ID),
 				zap.Int("retry_count", execution.RetryCount),
 				zap.Error(err))
 
-			// Store the error for potential retry
+			// Store the error and any partial result (exit code, stderr) for potential retry
 			lastErr = err
+			lastResult = result
+
+			// A cancelled execution is not retried
+			if es.executionState(execution) == models.CancelledState {
+				break
+			}
 
 			// Update state to failed before retry logic
-			execution.UpdateState(models.FailedState)
+			if updateErr := es.transition(execution, models.FailedState, es.sanitizeSensitiveData(err.Error())); updateErr != nil {
+				return lastResult, errors.Join(err, updateErr)
+			}
 
 			// Check if this is a transient error and we haven't exceeded max retries
 			if execution.RetryCount < execution.MaxRetries && es.IsTransientError(err) {
-				// Wait before retrying (exponential backoff)
-				waitTime := time.Duration(execution.RetryCount) * time.Second
-				time.Sleep(waitTime)
+				// Wait before retrying (linear backoff), unless too little of the budget would be
+				// left for the next attempt
+				waitTime := time.Duration(execution.RetryCount) * es.getExecutionDefaults().RetryBackoff
+				if remaining := budget.remaining(); budget.limited() && remaining-waitTime < es.getMinAttemptDuration() {
+					logger.Warn("retries abandoned, execution budget nearly spent",
+						zap.String("execution_id", execution.ID),
+						zap.Duration("remaining", remaining),
+						zap.Duration("budget", budget.total))
+					lastErr = budget.abandon(err, remaining)
+					break
+				}
+				if waitErr := waitForRetry(ctx, waitTime); waitErr != nil {
+					// The caller gave up or the execution was stopped while it waited
+					lastErr = waitErr
+					break
+				}
 
-				// Transition to starting state for retry
-				if err := execution.UpdateState(models.StartingState); err != nil {
-					es.logger.Error("failed to update execution state to starting for retry",
+				// Transition to starting state for retry; the execution may have been cancelled meanwhile
+				reason := fmt.Sprintf("retry %d of %d", execution.RetryCount, execution.MaxRetries)
+				if updateErr := es.transition(execution, models.StartingState, reason); updateErr != nil {
+					if es.executionState(execution) == models.CancelledState {
+						break
+					}
+					logger.Error("failed to update execution state to starting for retry",
 						zap.String("execution_id", execution.ID),
-						zap.Error(err))
+						zap.Error(updateErr))
+					return lastResult, errors.Join(err, updateErr)
 				}
+				es.reportState(ctx, execution)
 				continue // Retry
 			} else {
 				// Permanent error or max retries reached
@@ -331,8 +673,18 @@ func (es *ExecutionService) executeWithRetry(ctx context.Context, execution *mod
 	return lastResult, lastErr
 }
 
+// waitForRetry waits the backoff before the next attempt, or until ctx is done and returns its error
+func waitForRetry(ctx context.Context, backoff time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(backoff):
+		return nil
+	}
+}
+
 // executeWithResourceMonitoring executes an agent while monitoring resource usage
-func (es *ExecutionService) executeWithResourceMonitoring(ctx context.Context, agent agents.IAgent, input string, execution *models.AgentExecution) (*models.ExecutionResult, error) {
+func (es *ExecutionService) executeWithResourceMonitoring(ctx context.Context, agent agents.IAgent, input string, execution *models.AgentExecution, budget executionBudget) (*models.ExecutionResult, error) {
 	// Start resource monitoring
 	startTime := time.Now()
 	resourceUsage := &models.ResourceUsage{
@@ -340,8 +692,21 @@ func (es *ExecutionService) executeWithResourceMonitoring(ctx context.Context, a
 		MeasurementUnit: "MB", // Default unit
 	}
 
-	// Execute the agent
-	result, err := agent.Execute(ctx, input)
+	// Bound the attempt by a deadline the execution's extensions can move
+	ctx, release := es.attemptDeadline(ctx, agent, execution, budget)
+	defer release()
+
+	// Execute the agent, unless an injected fault fails the attempt first
+	var result *models.ExecutionResult
+	err := es.faults.Inject(ctx, models.FaultPointPreExecution, agent.GetID())
+	if err == nil {
+		result, err = agent.Execute(ctx, input)
+	}
+	if err == nil {
+		if err = es.faults.Inject(ctx, models.FaultPointPostExecution, agent.GetID()); err != nil && result != nil {
+			result.Status = types.FailureStatus
+		}
+	}
 
 	// End resource monitoring
 	endTime := time.Now()
@@ -369,7 +734,9 @@ func (es *ExecutionService) executeWithResourceMonitoring(ctx context.Context, a
 	resourceUsage.NetworkInMB = int64(executionDuration / 3)
 	resourceUsage.NetworkOutMB = int64(executionDuration / 4)
 
+	es.mutex.Lock()
 	execution.ResourceUsage = resourceUsage
+	es.mutex.Unlock()
 	if result != nil {
 		result.ResourceUsage = resourceUsage
 	}
@@ -383,6 +750,27 @@ func (es *ExecutionService) IsTransientError(err error) bool {
 		return false
 	}
 
+	// Retrying under the same limits would exceed them again
+	if errors.Is(err, models.ErrResourceLimitExceeded) {
+		return false
+	}
+
+	// A hung agent is likely to hang again
+	if errors.Is(err, models.ErrAgentHung) {
+		return false
+	}
+
+	// A persistent agent in the fatal state stays there until it is started explicitly
+	if errors.Is(err, agents.ErrPersistentAgentFatal) {
+		return false
+	}
+
+	// Injected faults say themselves whether they are transient
+	var fault *models.InjectedFault
+	if errors.As(err, &fault) {
+		return fault.Transient
+	}
+
 	errStr := err.Error()
 
 	// Check for known transient error patterns
@@ -483,6 +871,9 @@ type ReadWriteExecutionService struct {
 	// executionQueue manages execution order for read-write agents (only one at a time)
 	executionQueue map[string]chan *executionRequest
 
+	// waiting holds the executions of each agent waiting in its queue, oldest first
+	waiting map[string][]queuedExecution
+
 	// queueMutex protects access to the execution queue
 	queueMutex sync.RWMutex
 
@@ -492,18 +883,33 @@ type ReadWriteExecutionService struct {
 
 // NewReadWriteExecutionService creates a new instance of ReadWriteExecutionService
 func NewReadWriteExecutionService(agentService IAgentService, logger *zap.Logger) *ReadWriteExecutionService {
-	baseService := NewExecutionService(agentService, logger)
+	return NewReadWriteExecutionServiceOn(NewExecutionService(agentService, logger), logger)
+}
 
+// NewReadWriteExecutionServiceOn creates a ReadWriteExecutionService that records executions in baseService
+func NewReadWriteExecutionServiceOn(baseService *ExecutionService, logger *zap.Logger) *ReadWriteExecutionService {
 	return &ReadWriteExecutionService{
 		ExecutionService: baseService,
 		activeExecution:  make(map[string]*models.AgentExecution),
 		executionQueue:   make(map[string]chan *executionRequest),
+		waiting:          make(map[string][]queuedExecution),
 		logger:           logger,
 	}
 }
 
 // ExecuteAgent executes an agent with the given context, enforcing single concurrent execution for read-write agents
 func (rw *ReadWriteExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, error) {
+	pending, err := rw.Enqueue(ctx, agent, input)
+	if err != nil {
+		return nil, err
+	}
+	return pending.Wait(ctx)
+}
+
+// Enqueue adds an execution to its agent's queue without waiting for it. An execution that has to
+// wait behind another one is recorded in QueuedState, under the execution ID reserved on ctx or a
+// new one, until it starts.
+func (rw *ReadWriteExecutionService) Enqueue(ctx context.Context, agent agents.IAgent, input string) (*PendingExecution, error) {
 	// Verify this is a read-write agent
 	if agent.IsReadOnly() {
 		return nil, fmt.Errorf("cannot use ReadWriteExecutionService with read-only agent %s", agent.GetID())
@@ -511,14 +917,12 @@ func (rw *ReadWriteExecutionService) ExecuteAgent(ctx context.Context, agent age
 
 	agentID := agent.GetID()
 
-	// Get or create the agent-specific execution queue
-	rw.queueMutex.Lock()
-	queue, exists := rw.executionQueue[agentID]
-	if !exists {
-		queue = make(chan *executionRequest, 10) // buffered channel to queue requests
-		rw.executionQueue[agentID] = queue
+	// The execution keeps its ID while it waits, so callers can poll it
+	executionID := ReservedExecutionIDFromContext(ctx)
+	if executionID == "" {
+		executionID = generateExecutionID()
+		ctx = WithReservedExecutionID(ctx, executionID)
 	}
-	rw.queueMutex.Unlock()
 
 	// Create channels for result and error
 	resultCh := make(chan *executionResult, 1)
@@ -533,23 +937,91 @@ func (rw *ReadWriteExecutionService) ExecuteAgent(ctx context.Context, agent age
 		errorCh:  errorCh,
 	}
 
-	// Add request to queue
+	// Get or create the agent-specific execution queue and add the request, recording it as waiting
+	// while holding the lock so processQueue never dequeues it before that
+	rw.queueMutex.Lock()
+	queue, exists := rw.executionQueue[agentID]
+	if !exists {
+		queue = make(chan *executionRequest, 10) // buffered channel to queue requests
+		rw.executionQueue[agentID] = queue
+		go rw.processQueue(agentID, queue)
+	}
+	_, active := rw.activeExecution[agentID]
+	busy := active || len(rw.waiting[agentID]) > 0
 	select {
 	case queue <- request:
 		// Request successfully added to queue
+		rw.waiting[agentID] = append(rw.waiting[agentID], queuedExecution{executionID: executionID, queuedAt: time.Now()})
 	default:
 		// Queue full, reject request
+		rw.queueMutex.Unlock()
 		return nil, fmt.Errorf("execution queue for agent %s is full", agentID)
 	}
 
-	// Wait for result or error
-	select {
-	case result := <-resultCh:
-		return result.execution, nil
-	case err := <-errorCh:
-		return nil, err
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	pending := &PendingExecution{
+		ExecutionID: executionID,
+		wait: func(ctx context.Context) (*models.AgentExecution, error) {
+			select {
+			case result := <-resultCh:
+				return result.execution, result.err
+			case err := <-errorCh:
+				return nil, err
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+	if busy {
+		pending.Position = len(rw.waiting[agentID])
+		pending.Queued = rw.queueExecution(ctx, agentID, executionID, pending.Position)
+	}
+	rw.queueMutex.Unlock()
+
+	if pending.Queued != nil {
+		rw.reportState(ctx, pending.Queued)
+	}
+	return pending, nil
+}
+
+// processQueue runs the queued executions of one read-write agent one at a time
+func (rw *ReadWriteExecutionService) processQueue(agentID string, queue chan *executionRequest) {
+	for request := range queue {
+		executionID := ReservedExecutionIDFromContext(request.ctx)
+
+		// The request becomes the agent's active execution as it leaves the queue, so that requests
+		// enqueued meanwhile know they have to wait
+		rw.queueMutex.Lock()
+		if waiting := rw.waiting[agentID]; len(waiting) > 0 {
+			rw.waiting[agentID] = waiting[1:]
+		}
+		rw.activeExecution[agentID] = &models.AgentExecution{ID: executionID, AgentID: agentID, State: models.StartingState}
+		rw.updateQueuePositions(agentID, executionID, rw.waiting[agentID])
+		rw.queueMutex.Unlock()
+
+		// The caller gave up while the request was queued, or the execution was stopped
+		err := request.ctx.Err()
+		if err == nil && rw.stoppedWhileQueued(executionID) {
+			err = fmt.Errorf("execution %s was cancelled while queued", executionID)
+		}
+		if err != nil {
+			rw.cancelQueuedExecution(executionID, err)
+			rw.queueMutex.Lock()
+			delete(rw.activeExecution, agentID)
+			rw.queueMutex.Unlock()
+			request.errorCh <- err
+			continue
+		}
+
+		execution, err := rw.ExecutionService.ExecuteAgent(request.ctx, request.agent, request.input)
+		if execution == nil && err != nil {
+			rw.failReservedExecution(executionID, err)
+		}
+
+		rw.queueMutex.Lock()
+		delete(rw.activeExecution, agentID)
+		rw.queueMutex.Unlock()
+
+		request.resultCh <- &executionResult{execution: execution, err: err}
 	}
 }
 
@@ -563,6 +1035,10 @@ func (rw *ReadWriteExecutionService) GetActiveExecution(agentID string) (*models
 		return nil, fmt.Errorf("no active execution for agent %s", agentID)
 	}
 
+	// Prefer the live record once the execution service has created it
+	if live, err := rw.GetExecution(execution.ID); err == nil {
+		return live, nil
+	}
 	return execution, nil
 }
 
@@ -611,22 +1087,53 @@ func (rw *ReadWriteExecutionService) GetQueueLength(agentID string) (int, error)
 	return len(queue), nil
 }
 
+// QueuedExecutions returns the number of executions waiting behind another execution of their agent
+func (rw *ReadWriteExecutionService) QueuedExecutions() int {
+	rw.queueMutex.RLock()
+	defer rw.queueMutex.RUnlock()
+
+	queued := 0
+	for _, queue := range rw.executionQueue {
+		queued += len(queue)
+	}
+	return queued
+}
+
+// AgentQueueStats describes the executions of a read-write agent waiting behind its running execution
+type AgentQueueStats struct {
+	AgentID            string    `json:"agent_id"`
+	QueueLength        int       `json:"queue_length"`
+	OldestQueuedAt     time.Time `json:"oldest_queued_at,omitempty"` // When the longest waiting execution was queued
+	CurrentExecutionID string    `json:"current_execution_id,omitempty"`
+}
+
+// QueueStats returns the queue of every read-write agent that has run, ordered by agent ID
+func (rw *ReadWriteExecutionService) QueueStats() []AgentQueueStats {
+	rw.queueMutex.RLock()
+	defer rw.queueMutex.RUnlock()
+
+	stats := make([]AgentQueueStats, 0, len(rw.executionQueue))
+	for agentID, queue := range rw.executionQueue {
+		entry := AgentQueueStats{AgentID: agentID, QueueLength: len(queue)}
+		if waiting := rw.waiting[agentID]; len(waiting) > 0 {
+			entry.OldestQueuedAt = waiting[0].queuedAt
+		}
+		if active, exists := rw.activeExecution[agentID]; exists {
+			entry.CurrentExecutionID = active.ID
+		}
+		stats = append(stats, entry)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].AgentID < stats[j].AgentID })
+	return stats
+}
+
 // ReadOnlyExecutionService implements IReadOnlyExecutionService for read-only agents
 type ReadOnlyExecutionService struct {
 	// Base execution service
 	*ExecutionService
 
-	// resourcePoolMetrics tracks resource pool metrics
-	resourcePoolMetrics *ResourcePoolMetrics
-
-	// maxConcurrent is the maximum number of concurrent executions allowed
-	maxConcurrent int
-
-	// activeExecutions tracks currently running read-only executions
-	activeExecutions map[string]*models.AgentExecution
-
-	// activeExecutionsMutex protects access to activeExecutions
-	activeExecutionsMutex sync.RWMutex
+	// pool limits the read-only executions running at once and shares its slots fairly between agents
+	pool *FairPool
 
 	// logger for logging
 	logger *zap.Logger
@@ -634,136 +1141,330 @@ type ReadOnlyExecutionService struct {
 
 // NewReadOnlyExecutionService creates a new instance of ReadOnlyExecutionService
 func NewReadOnlyExecutionService(agentService IAgentService, logger *zap.Logger, maxConcurrent int) *ReadOnlyExecutionService {
+	return NewReadOnlyExecutionServiceOn(NewExecutionService(agentService, logger), logger, maxConcurrent)
+}
+
+// NewReadOnlyExecutionServiceOn creates a ReadOnlyExecutionService that records executions in baseService
+func NewReadOnlyExecutionServiceOn(baseService *ExecutionService, logger *zap.Logger, maxConcurrent int) *ReadOnlyExecutionService {
 	if maxConcurrent <= 0 {
 		maxConcurrent = 10 // Default to 10 concurrent executions
 	}
 
-	baseService := NewExecutionService(agentService, logger)
-
 	return &ReadOnlyExecutionService{
 		ExecutionService: baseService,
-		resourcePoolMetrics: &ResourcePoolMetrics{
-			TotalCapacity: maxConcurrent,
-			MaxConcurrent: maxConcurrent,
-		},
-		maxConcurrent:    maxConcurrent,
-		activeExecutions: make(map[string]*models.AgentExecution),
+		pool:             NewFairPool(maxConcurrent),
 		logger:           logger,
 	}
 }
 
-// ExecuteAgent executes an agent with the given context, allowing multiple concurrent executions for read-only agents
+// ExecuteAgent executes an agent with the given context, allowing multiple concurrent executions for
+// read-only agents. When the pool is full the execution waits for a slot, which agents with waiting
+// executions receive in turn.
 func (ro *ReadOnlyExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, error) {
 	// Verify this is a read-only agent
 	if !agent.IsReadOnly() {
 		return nil, fmt.Errorf("cannot use ReadOnlyExecutionService with read-write agent %s", agent.GetID())
 	}
 
-	// Check if we're at max concurrent capacity
-	ro.activeExecutionsMutex.RLock()
-	activeCount := len(ro.activeExecutions)
-	ro.activeExecutionsMutex.RUnlock()
-
-	if activeCount >= ro.maxConcurrent {
-		return nil, fmt.Errorf("maximum concurrent executions reached for read-only agent %s", agent.GetID())
+	weight, limit := 1, 0
+	if config := agent.GetConfig(); config != nil {
+		weight, limit = config.Weight, config.MaxConcurrentExecutions
 	}
+	if err := ro.pool.Acquire(ctx, agent.GetID(), weight, limit); err != nil {
+		return nil, fmt.Errorf("read-only agent %s gave up waiting for an execution slot: %w", agent.GetID(), err)
+	}
+	defer ro.pool.Release(agent.GetID())
 
 	// Execute using the base service
-	execution, err := ro.ExecutionService.ExecuteAgent(ctx, agent, input)
+	return ro.ExecutionService.ExecuteAgent(ctx, agent, input)
+}
+
+// GetResourcePoolMetrics returns resource pool utilization metrics
+func (ro *ReadOnlyExecutionService) GetResourcePoolMetrics() (*ResourcePoolMetrics, error) {
+	capacity := ro.pool.Capacity()
+	used := ro.pool.InUse()
+	pending := ro.pool.Pending()
+
+	metrics := &ResourcePoolMetrics{
+		TotalCapacity:   capacity,
+		UsedCapacity:    used,
+		AvailableCount:  capacity - used,
+		UtilizationRate: float64(used) / float64(capacity) * 100,
+		MaxConcurrent:   capacity,
+		PendingByAgent:  pending,
+	}
+	for _, count := range pending {
+		metrics.PendingCount += count
+	}
+	return metrics, nil
+}
+
+// Router returns the execution router shared by everything that records executions in this service
+func (es *ExecutionService) Router() *ExecutionRouter {
+	es.routerOnce.Do(func() {
+		es.router = NewExecutionRouter(es, agents.NewAgentFactory(es.logger), es.logger)
+	})
+	return es.router
+}
+
+// SetMetricsCollector sets the collector that receives completed execution metrics
+func (es *ExecutionService) SetMetricsCollector(collector *MetricsCollector) {
+	es.metricsCollector = collector
+}
+
+// SetResultCache replaces the cache used for agents with a cache TTL
+func (es *ExecutionService) SetResultCache(cache *ResultCache) {
+	es.resultCache = cache
+}
+
+// SetIdempotencyStore replaces the store deduplicating execute requests by idempotency key
+func (es *ExecutionService) SetIdempotencyStore(store *IdempotencyStore) {
+	es.idempotency = store
+}
+
+// SetExecutionQuota sets the per-client concurrent execution quota
+func (es *ExecutionService) SetExecutionQuota(quota *ExecutionQuota) {
+	es.quota = quota
+}
+
+// SetStateMachine replaces the state machine that validates execution state changes
+func (es *ExecutionService) SetStateMachine(stateMachine *models.StateMachine) {
+	es.stateMachine = stateMachine
+}
+
+// SetProcessRegistry sets the registry agent processes are tracked in while they run
+func (es *ExecutionService) SetProcessRegistry(registry *agents.ProcessRegistry) {
+	es.processRegistry = registry
+}
+
+// SetFaultInjector sets the fault injection rules applied to executions; nil disables fault injection
+func (es *ExecutionService) SetFaultInjector(faults *FaultInjector) {
+	es.faults = faults
+}
+
+// FaultInjector returns the fault injection rules applied to executions, nil when disabled
+func (es *ExecutionService) FaultInjector() *FaultInjector {
+	return es.faults
+}
+
+// SetEventBus sets the bus execution state changes are published on
+func (es *ExecutionService) SetEventBus(bus *EventBus) {
+	es.events = bus
+}
+
+// SetAnomalyDetector sets the detector flagging finished executions that deviate from their agent's
+// and task's recent ones; nil disables anomaly flags
+func (es *ExecutionService) SetAnomalyDetector(detector *AnomalyDetector) {
+	es.anomalies = detector
+}
+
+// SetArtifactStore sets the store keeping the files executions leave in their artifacts directory
+func (es *ExecutionService) SetArtifactStore(store *ArtifactStore) {
+	es.artifactStore = store
+}
+
+// transition moves an execution to newState under the service's state machine and stores it
+func (es *ExecutionService) transition(execution *models.AgentExecution, newState types.AgentState, reason string) error {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if err := execution.Transition(es.stateMachine, newState, reason, ""); err != nil {
+		return err
+	}
+	es.storeExecution(execution)
+	return nil
+}
+
+// QueryExecutions retrieves copies of the executions matching the filter, oldest first
+func (es *ExecutionService) QueryExecutions(filter ExecutionFilter) ([]*models.AgentExecution, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	stored, err := es.store.QueryExecutions(filter)
 	if err != nil {
 		return nil, err
 	}
 
-	// Track the active execution
-	ro.activeExecutionsMutex.Lock()
-	ro.activeExecutions[execution.ID] = execution
-	ro.resourcePoolMetrics.UsedCapacity = len(ro.activeExecutions)
-	ro.resourcePoolMetrics.AvailableCount = ro.resourcePoolMetrics.MaxConcurrent - ro.resourcePoolMetrics.UsedCapacity
-	ro.resourcePoolMetrics.UtilizationRate = float64(ro.resourcePoolMetrics.UsedCapacity) / float64(ro.resourcePoolMetrics.MaxConcurrent) * 100
-	ro.activeExecutionsMutex.Unlock()
+	// The executions this instance started are served from memory, with what the store does not keep
+	executions := make([]*models.AgentExecution, 0, len(stored))
+	listed := make(map[string]bool, len(stored))
+	for _, execution := range stored {
+		if live, exists := es.executions[execution.ID]; exists {
+			execution = live
+		}
+		listed[execution.ID] = true
+		executions = append(executions, execution.Clone())
+	}
+	for _, execution := range es.executions {
+		if !listed[execution.ID] && filter.Matches(execution) {
+			executions = append(executions, execution.Clone())
+		}
+	}
 
-	return execution, nil
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartTime.Before(executions[j].StartTime)
+	})
+
+	return executions, nil
 }
 
-// GetResourcePoolMetrics returns resource pool utilization metrics
-func (ro *ReadOnlyExecutionService) GetResourcePoolMetrics() (*ResourcePoolMetrics, error) {
-	ro.activeExecutionsMutex.RLock()
-	defer ro.activeExecutionsMutex.RUnlock()
+// ExecutionPageSize is the number of executions IterateExecutions reads from the store at a time
+const ExecutionPageSize = 500
+
+// IterateExecutions calls fn with a copy of every execution matching the filter, ordered by start
+// time then ID, reading the store a page at a time so the matching executions are never all held
+// in memory. The executions this instance started are served from memory; those the store failed
+// to keep follow the stored ones. Iteration stops at the first error fn returns, which is returned.
+func (es *ExecutionService) IterateExecutions(filter ExecutionFilter, fn func(*models.AgentExecution) error) error {
+	// Only the live executions seen are remembered, which are in memory anyway
+	seen := make(map[string]bool)
+	var cursor models.ExecutionCursor
+	for {
+		// The store may hold the live executions, which only change under the mutex
+		es.mutex.RLock()
+		page, err := es.store.QueryExecutionsAfter(filter, cursor, ExecutionPageSize)
+		if err != nil {
+			es.mutex.RUnlock()
+			return err
+		}
+		if len(page) > 0 {
+			cursor = models.CursorAt(page[len(page)-1])
+		}
+		for i, execution := range page {
+			if live, exists := es.executions[execution.ID]; exists {
+				execution = live
+				seen[execution.ID] = true
+			}
+			page[i] = execution.Clone()
+		}
+		es.mutex.RUnlock()
+
+		for _, execution := range page {
+			if err := fn(execution); err != nil {
+				return err
+			}
+		}
+		if len(page) < ExecutionPageSize {
+			break
+		}
+	}
 
-	return ro.resourcePoolMetrics, nil
+	es.mutex.RLock()
+	var unstored []*models.AgentExecution
+	for _, execution := range es.executions {
+		if !seen[execution.ID] && filter.Matches(execution) {
+			unstored = append(unstored, execution.Clone())
+		}
+	}
+	es.mutex.RUnlock()
+	sort.Slice(unstored, func(i, j int) bool {
+		return models.CursorAt(unstored[i]).Precedes(unstored[j])
+	})
+	for _, execution := range unstored {
+		if err := fn(execution); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetExecution retrieves an execution by its ID
+// GetExecution retrieves a copy of an execution by its ID, which its run does not change under the
+// caller
 func (es *ExecutionService) GetExecution(executionID string) (*models.AgentExecution, error) {
 	es.mutex.RLock()
 	defer es.mutex.RUnlock()
 
 	execution, exists := es.executions[executionID]
 	if !exists {
-		return nil, fmt.Errorf("execution with ID %s not found", executionID)
+		stored, err := es.store.GetExecution(executionID)
+		if err != nil {
+			return nil, err
+		}
+		execution = stored
 	}
 
-	return execution, nil
+	return execution.Clone(), nil
 }
 
-// ListExecutions retrieves all executions for a specific agent
+// ListExecutions retrieves copies of all executions for a specific agent, oldest first
 func (es *ExecutionService) ListExecutions(agentID string) ([]*models.AgentExecution, error) {
-	es.mutex.RLock()
-	defer es.mutex.RUnlock()
-
-	var executions []*models.AgentExecution
-	for _, execution := range es.executions {
-		if execution.AgentID == agentID {
-			executions = append(executions, execution)
-		}
-	}
+	return es.QueryExecutions(ExecutionFilter{AgentID: agentID})
+}
 
-	return executions, nil
+// CancelExecution cancels the execution with the specified ID, recording why and at whose request.
+// The agent is stopped with its configured stop signal.
+func (es *ExecutionService) CancelExecution(executionID, reason, requestedBy string) error {
+	return es.StopExecution(executionID, "", reason, requestedBy)
 }
 
-// CancelExecution cancels the execution with the specified ID
-func (es *ExecutionService) CancelExecution(executionID string) error {
+// StopExecution cancels the execution with the specified ID like CancelExecution, stopping the agent
+// with signal instead of its configured stop signal unless signal is empty
+func (es *ExecutionService) StopExecution(executionID, signal, reason, requestedBy string) error {
+	signal, err := models.NormalizeStopSignal(signal)
+	if err != nil {
+		return err
+	}
+
 	es.mutex.Lock()
 	defer es.mutex.Unlock()
 
 	execution, exists := es.executions[executionID]
 	if !exists {
-		return fmt.Errorf("execution with ID %s not found", executionID)
+		return models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
 	}
 
-	// Check if the execution can be cancelled (is running)
-	if execution.State != models.RunningState && execution.State != models.StartingState {
-		return fmt.Errorf("execution with ID %s cannot be cancelled in state %s", executionID, execution.State)
+	// Check if the execution can be cancelled (is running, or waiting to run)
+	if execution.State != models.RunningState && execution.State != models.StartingState && execution.State != models.QueuedState {
+		return models.NewKindError(models.ErrInvalidTransition, "execution with ID %s cannot be cancelled in state %s", executionID, execution.State)
 	}
 
 	// Update state to cancelled
 	oldState := execution.State
-	if err := execution.UpdateState(models.CancelledState); err != nil {
-		es.logger.Error("failed to update execution state to cancelled",
-			zap.String("execution_id", executionID),
-			zap.Error(err))
+	if err := execution.Transition(es.stateMachine, models.CancelledState, reason, requestedBy); err != nil {
 		return fmt.Errorf("failed to update execution state: %w", err)
 	}
 
 	// Update in tracking maps
 	es.activeExecutions[executionID] = execution
 	es.executions[executionID] = execution
+	es.storeExecution(execution)
+
+	// Stop the agent; it sends the stop signal and waits for the process tree to exit in the background
+	if cancel, ok := es.cancelFuncMap[executionID]; ok {
+		if signal != "" {
+			cancel(&agents.StopRequest{Signal: signal})
+		} else {
+			cancel(context.Canceled)
+		}
+	}
+
+	// A queued execution never started, so it is over at once; its queue skips it when it comes up
+	if oldState == models.QueuedState {
+		now := time.Now()
+		execution.EndTime = &now
+		execution.QueuePosition = 0
+		execution.EstimatedWaitMs = 0
+		go es.notifyCompletion(execution)
+	}
 
 	es.logger.Info("execution cancelled",
 		zap.String("execution_id", executionID),
-		zap.String("previous_state", string(oldState)))
+		zap.String("previous_state", string(oldState)),
+		zap.String("reason", reason),
+		zap.String("requested_by", requestedBy),
+		zap.String("signal", signal))
 
 	return nil
 }
 
-// GetActiveExecutions retrieves all currently active executions
+// GetActiveExecutions retrieves copies of all currently active executions
 func (es *ExecutionService) GetActiveExecutions() ([]*models.AgentExecution, error) {
 	es.mutex.RLock()
 	defer es.mutex.RUnlock()
 
 	var executions []*models.AgentExecution
 	for _, execution := range es.activeExecutions {
-		executions = append(executions, execution)
+		executions = append(executions, execution.Clone())
 	}
 
 	return executions, nil
@@ -771,15 +1472,7 @@ func (es *ExecutionService) GetActiveExecutions() ([]*models.AgentExecution, err
 
 // GetExecutionResult retrieves results for a specific execution
 func (es *ExecutionService) GetExecutionResult(executionID string) (*models.ExecutionResult, error) {
-	es.mutex.RLock()
-	defer es.mutex.RUnlock()
-
-	result, exists := es.results[executionID]
-	if !exists {
-		return nil, fmt.Errorf("execution result with ID %s not found", executionID)
-	}
-
-	return result, nil
+	return es.store.GetExecutionResult(executionID)
 }
 
 // UpdateExecutionState updates the state of an execution
@@ -789,22 +1482,18 @@ func (es *ExecutionService) UpdateExecutionState(executionID string, newState ty
 
 	execution, exists := es.executions[executionID]
 	if !exists {
-		return fmt.Errorf("execution with ID %s not found", executionID)
+		return models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
 	}
 
 	oldState := execution.State
-	if err := execution.UpdateState(newState); err != nil {
-		es.logger.Error("failed to update execution state",
-			zap.String("execution_id", executionID),
-			zap.String("from_state", string(oldState)),
-			zap.String("to_state", string(newState)),
-			zap.Error(err))
+	if err := execution.Transition(es.stateMachine, newState, "", ""); err != nil {
 		return fmt.Errorf("failed to update execution state: %w", err)
 	}
 
 	// Update in tracking maps
 	es.activeExecutions[executionID] = execution
 	es.executions[executionID] = execution
+	es.storeExecution(execution)
 
 	es.logger.Info("execution state updated",
 		zap.String("execution_id", executionID),
@@ -820,4 +1509,341 @@ func generateExecutionID() string {
 	// For example, using github.com/google/uuid
 	// Using nanosecond precision and a random component to ensure uniqueness
 	return fmt.Sprintf("exec-%s-%d", time.Now().Format("20060102-150405"), time.Now().Nanosecond())
-}
\ No newline at end of file
+}
+// executionIDFor returns the execution ID reserved on the context, or a new one
+func executionIDFor(ctx context.Context) string {
+	if executionID := ReservedExecutionIDFromContext(ctx); executionID != "" {
+		return executionID
+	}
+	return generateExecutionID()
+}
+
+// reserveExecution records a pending execution so callers can poll it before it starts and returns
+// a copy of the record; ExecuteAgent replaces the record once it runs with the reserved ID
+func (es *ExecutionService) reserveExecution(ctx context.Context, agentID string, labels map[string]string) *models.AgentExecution {
+	execution := newPendingExecution(ctx, generateExecutionID(), agentID, labels)
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.executions[execution.ID] = execution
+	es.storeExecution(execution)
+
+	return execution.Clone()
+}
+
+// newPendingExecution returns the record of an execution that has not started yet
+func newPendingExecution(ctx context.Context, executionID, agentID string, labels map[string]string) *models.AgentExecution {
+	now := time.Now()
+	trigger := ExecutionTriggerFromContext(ctx)
+	return &models.AgentExecution{
+		ID:              executionID,
+		AgentID:         agentID,
+		State:           models.IdleState,
+		StartTime:       now,
+		LastStateChange: now,
+		Context:         make(map[string]interface{}),
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Labels:          labels,
+		TriggerType:     trigger.Type,
+		TriggeredBy:     trigger.By,
+		TaskID:          ExecutionTaskFromContext(ctx),
+		ReplayOf:        ReplayOfFromContext(ctx),
+	}
+}
+
+// failReservedExecution marks a reserved execution failed when it was rejected before it could start
+func (es *ExecutionService) failReservedExecution(executionID string, err error) {
+	es.mutex.Lock()
+	execution, exists := es.executions[executionID]
+	if !exists || (execution.State != models.IdleState && execution.State != models.QueuedState) {
+		es.mutex.Unlock()
+		return
+	}
+
+	message := es.sanitizeSensitiveData(err.Error())
+	if transitionErr := execution.Transition(es.stateMachine, models.FailedState, message, ""); transitionErr != nil {
+		es.mutex.Unlock()
+		es.logger.Error("failed to fail rejected execution", zap.String("execution_id", executionID), zap.Error(transitionErr))
+		return
+	}
+	now := time.Now()
+	execution.ErrorMessage = message
+	execution.EndTime = &now
+	if errors.Is(err, models.ErrInputFetchFailed) {
+		execution.ErrorCategory = types.InputFetchError
+	}
+	es.mutex.Unlock()
+
+	es.notifyCompletion(execution)
+}
+
+// inheritReservation carries state registered on a reserved execution over to the execution that
+// replaces it; callers hold the mutex
+func (es *ExecutionService) inheritReservation(execution *models.AgentExecution) {
+	if reserved, exists := es.executions[execution.ID]; exists && reserved != execution {
+		execution.PushNotification = reserved.PushNotification
+	}
+}
+
+// SetExecutionStore replaces the store keeping executions and their results; it is set before
+// executions start
+func (es *ExecutionService) SetExecutionStore(store models.ExecutionStore) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.store = store
+}
+
+// storeExecution writes the execution's current state to the execution store; callers hold the
+// mutex, so the execution does not change while it is written
+func (es *ExecutionService) storeExecution(execution *models.AgentExecution) {
+	if err := es.store.SaveExecution(execution); err != nil {
+		es.logger.Warn("failed to store execution",
+			zap.String("execution_id", execution.ID),
+			zap.String("state", string(execution.State)),
+			zap.Error(err))
+	}
+}
+
+// storeResult writes the result of a finished execution to the execution store
+func (es *ExecutionService) storeResult(executionID string, result *models.ExecutionResult) {
+	if err := es.store.SaveExecutionResult(executionID, result); err != nil {
+		es.logger.Warn("failed to store execution result", zap.String("execution_id", executionID), zap.Error(err))
+	}
+}
+
+// AddCompletionHook registers a function called once each execution reaches its final state
+func (es *ExecutionService) AddCompletionHook(hook func(*models.AgentExecution)) {
+	es.mutex.Lock()
+	es.completionHooks = append(es.completionHooks, hook)
+	es.mutex.Unlock()
+}
+
+// notifyCompletion marks the execution finished and runs the completion hooks
+func (es *ExecutionService) notifyCompletion(execution *models.AgentExecution) {
+	es.mutex.Lock()
+	es.finished[execution.ID] = true
+	es.storeExecution(execution)
+	hooks := append([]func(*models.AgentExecution){}, es.completionHooks...)
+	snapshot := execution.Clone()
+	es.mutex.Unlock()
+
+	es.publishState(snapshot)
+	for _, hook := range hooks {
+		hook(snapshot)
+	}
+}
+
+// reportState reports the execution's current state to the context's StateObserver and the event bus
+func (es *ExecutionService) reportState(ctx context.Context, execution *models.AgentExecution) {
+	es.mutex.RLock()
+	snapshot := execution.Clone()
+	es.mutex.RUnlock()
+
+	observeState(ctx, snapshot)
+	es.publishState(snapshot)
+}
+
+// executionState returns the execution's current state, which StopExecution changes from other goroutines
+func (es *ExecutionService) executionState(execution *models.AgentExecution) types.AgentState {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+	return execution.State
+}
+
+// publishState publishes the execution's current state on the event bus, if one is set
+func (es *ExecutionService) publishState(execution *models.AgentExecution) {
+	es.events.Publish(models.Event{
+		Type:        models.EventExecutionState,
+		AgentID:     execution.AgentID,
+		ExecutionID: execution.ID,
+		TaskID:      execution.TaskID,
+		Data: models.ExecutionStateEvent{
+			State:       string(execution.State),
+			Error:       execution.ErrorMessage,
+			TriggerType: string(execution.TriggerType),
+		},
+	})
+}
+
+// reportProgress records the progress the execution's agent reported as its current progress and
+// reports it to the context's ProgressObserver and the event bus
+func (es *ExecutionService) reportProgress(ctx context.Context, execution *models.AgentExecution, progress models.ExecutionProgress) {
+	es.mutex.Lock()
+	execution.Progress = &progress
+	execution.UpdatedAt = progress.UpdatedAt
+	es.storeExecution(execution)
+	es.mutex.Unlock()
+
+	observeProgress(ctx, execution.ID, progress)
+	es.events.Publish(models.Event{
+		Type:        models.EventExecutionProgress,
+		AgentID:     execution.AgentID,
+		ExecutionID: execution.ID,
+		TaskID:      execution.TaskID,
+		Data:        progress,
+	})
+}
+
+// publishHung publishes that the watchdog stopped the execution's hung agent, whose configuration
+// is config, on the event bus, if one is set
+func (es *ExecutionService) publishHung(execution *models.AgentExecution, config *models.AgentConfiguration, hung *models.HungAgentError) {
+	data := models.ExecutionHung{LastActivity: hung.LastActivity, Error: hung.Error()}
+	if config != nil {
+		data.SilenceSeconds = config.MaxSilenceSeconds
+	}
+	es.events.Publish(models.Event{
+		Type:        models.EventExecutionHung,
+		AgentID:     execution.AgentID,
+		ExecutionID: execution.ID,
+		TaskID:      execution.TaskID,
+		Data:        data,
+	})
+}
+
+// executionStatus returns the outcome of a finished execution: success, warning when its agent
+// exited with a code mapped to warning, or why it failed
+func executionStatus(result *models.ExecutionResult, err error) types.ExecutionStatus {
+	if err == nil {
+		if result != nil && result.Status == types.WarningStatus {
+			return types.WarningStatus
+		}
+		return types.SuccessStatus
+	}
+	if result != nil && result.Status != "" && !result.Status.Succeeded() {
+		return result.Status // Keeps timeouts and cancellations apart from failures
+	}
+	return types.FailureStatus
+}
+
+// flagAnomalies adds the finished execution to the anomaly detector's baselines, if one is set, and
+// flags the execution and its result with the anomalies found. Cancelled executions say nothing
+// about their agent and are left out. Returns the anomalies that newly appeared.
+func (es *ExecutionService) flagAnomalies(execution *models.AgentExecution, result *models.ExecutionResult) []models.ExecutionAnomaly {
+	if es.anomalies == nil {
+		return nil
+	}
+	state := es.executionState(execution)
+	if state == models.CancelledState {
+		return nil
+	}
+
+	status := types.SuccessStatus
+	if state != models.CompletedState {
+		status = types.FailureStatus
+	}
+	flags, appeared := es.anomalies.Observe(&models.ExecutionHistory{
+		ExecutionID:     execution.ID,
+		TaskID:          execution.TaskID,
+		AgentID:         execution.AgentID,
+		StartTime:       execution.StartTime,
+		EndTime:         *execution.EndTime,
+		Status:          status,
+		ExecutionTimeMs: execution.EndTime.Sub(execution.StartTime).Milliseconds(),
+	})
+	es.mutex.Lock()
+	execution.Anomalies = flags
+	es.mutex.Unlock()
+	if result != nil {
+		result.Anomalies = flags
+	}
+	return appeared
+}
+
+// publishAnomalies logs the anomalies that newly appeared with the execution and publishes them on
+// the event bus, if one is set
+func (es *ExecutionService) publishAnomalies(execution *models.AgentExecution, anomalies []models.ExecutionAnomaly) {
+	for _, anomaly := range anomalies {
+		es.logger.Warn("execution anomaly",
+			zap.String("execution_id", execution.ID),
+			zap.String("agent_id", execution.AgentID),
+			zap.String("task_id", execution.TaskID),
+			zap.String("anomaly", anomaly.Anomaly),
+			zap.String("scope", anomaly.Scope),
+			zap.Int64("execution_time_ms", anomaly.ExecutionTimeMs),
+			zap.Float64("baseline_mean_ms", anomaly.BaselineMeanMs),
+			zap.Float64("failure_rate", anomaly.FailureRate))
+		es.events.Publish(models.Event{
+			Type:        models.EventExecutionAnomaly,
+			AgentID:     execution.AgentID,
+			ExecutionID: execution.ID,
+			TaskID:      execution.TaskID,
+			Data:        anomaly,
+		})
+	}
+}
+
+// executionFinished reports whether the execution has reached its final state and run its completion hooks
+func (es *ExecutionService) executionFinished(executionID string) bool {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+	return es.finished[executionID]
+}
+
+// SetPushNotification registers config on the execution, replacing any earlier registration, and
+// reports whether the execution has already finished
+func (es *ExecutionService) SetPushNotification(executionID string, config *models.PushNotificationConfig) (bool, error) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	execution, exists := es.executions[executionID]
+	if !exists {
+		return false, models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
+	}
+
+	execution.PushNotification = config
+	return es.finished[executionID], nil
+}
+
+// GetPushNotification returns a copy of the push notification config registered on the execution,
+// or nil when there is none
+func (es *ExecutionService) GetPushNotification(executionID string) (*models.PushNotificationConfig, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	execution, exists := es.executions[executionID]
+	if !exists {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
+	}
+
+	return copyPushNotification(execution.PushNotification), nil
+}
+
+// ClaimPushNotification hands out the push notification of a finished execution exactly once,
+// marking its delivery pending; it returns nil when there is nothing to deliver
+func (es *ExecutionService) ClaimPushNotification(executionID string) *models.PushNotificationConfig {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	execution, exists := es.executions[executionID]
+	if !exists || !es.finished[executionID] || execution.PushNotification == nil || execution.PushNotification.Delivery != nil {
+		return nil
+	}
+
+	execution.PushNotification.Delivery = &models.PushNotificationDelivery{Status: models.PushDeliveryPending}
+	return copyPushNotification(execution.PushNotification)
+}
+
+// RecordPushDelivery stores the delivery status of the push notification registered on the execution
+func (es *ExecutionService) RecordPushDelivery(executionID string, delivery models.PushNotificationDelivery) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if execution, exists := es.executions[executionID]; exists && execution.PushNotification != nil {
+		execution.PushNotification.Delivery = &delivery
+	}
+}
+
+// copyPushNotification copies config so callers can read it without holding the mutex
+func copyPushNotification(config *models.PushNotificationConfig) *models.PushNotificationConfig {
+	if config == nil {
+		return nil
+	}
+
+	clone := *config
+	if config.Delivery != nil {
+		delivery := *config.Delivery
+		clone.Delivery = &delivery
+	}
+	return &clone
+}
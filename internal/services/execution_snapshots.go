@@ -0,0 +1,59 @@
+package services
+
+import (
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// SetSupervisorVersion sets the supervisor version execution snapshots record
+func (es *ExecutionService) SetSupervisorVersion(version string) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.supervisorVersion = version
+}
+
+// RecordSnapshot records the environment snapshot of the execution's agent process
+func (c *executionControl) RecordSnapshot(snapshot *models.ExecutionSnapshot) {
+	c.service.recordSnapshot(c.executionID, snapshot)
+}
+
+// recordSnapshot stamps snapshot with the supervisor's version and host and keeps it on the
+// execution, replacing the snapshot of an earlier attempt
+func (es *ExecutionService) recordSnapshot(executionID string, snapshot *models.ExecutionSnapshot) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	snapshot.SupervisorVersion = es.supervisorVersion
+	snapshot.Host = es.host
+	if execution, ok := es.executions[executionID]; ok {
+		execution.Snapshot = snapshot
+	}
+}
+
+// GetExecutionSnapshot returns the environment snapshot of an execution's agent process. Executions
+// that never started a process, such as queued, cached or synthetic ones, have none.
+func (es *ExecutionService) GetExecutionSnapshot(executionID string) (*models.ExecutionSnapshot, error) {
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+
+	execution, exists := es.executions[executionID]
+	if !exists {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
+	}
+	if execution.Snapshot == nil {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "execution %s has no environment snapshot", executionID)
+	}
+	return execution.Snapshot, nil
+}
+
+// currentSnapshot returns the snapshot a new execution of the agent would start from, stamped like
+// recorded ones, for replays to compare with the snapshot of the execution they replay
+func (es *ExecutionService) currentSnapshot(config *models.AgentConfiguration) *models.ExecutionSnapshot {
+	snapshot := agents.CaptureExecutable(config)
+
+	es.mutex.RLock()
+	defer es.mutex.RUnlock()
+	snapshot.SupervisorVersion = es.supervisorVersion
+	snapshot.Host = es.host
+	return snapshot
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// FairPool hands out a fixed number of execution slots. When the slots are contended, free slots go
+// round-robin to the agents with waiting requests instead of to the oldest request, so one agent's
+// backlog cannot starve the others. An agent with weight n receives up to n slots per turn, and an
+// agent at its own concurrency limit is skipped until one of its executions finishes.
+type FairPool struct {
+	mutex    sync.Mutex
+	capacity int
+	inUse    int
+	running  map[string]int           // Slots held per agent
+	waiting  map[string][]*poolWaiter // Waiting requests per agent, oldest first
+	order    []string                 // Agents with waiting requests, in round-robin order
+	cursor   int                      // Index in order of the agent whose turn it is
+	credits  map[string]int           // Slots left in the current turn of an agent
+}
+
+// poolWaiter is a request waiting for a slot
+type poolWaiter struct {
+	weight  int
+	limit   int
+	granted bool
+	ready   chan struct{}
+}
+
+// NewFairPool creates a pool of capacity slots
+func NewFairPool(capacity int) *FairPool {
+	return &FairPool{
+		capacity: capacity,
+		running:  make(map[string]int),
+		waiting:  make(map[string][]*poolWaiter),
+		credits:  make(map[string]int),
+	}
+}
+
+// Acquire waits for a slot for agentID, which may hold at most limit slots at once (0 for no
+// limit), and shares contended slots with the other agents in proportion to weight (1 when 0).
+// It returns ctx's error if ctx ends first. Every successful Acquire must be matched by Release.
+func (p *FairPool) Acquire(ctx context.Context, agentID string, weight, limit int) error {
+	if weight < 1 {
+		weight = 1
+	}
+	waiter := &poolWaiter{weight: weight, limit: limit, ready: make(chan struct{})}
+
+	p.mutex.Lock()
+	if len(p.waiting[agentID]) == 0 {
+		p.order = append(p.order, agentID)
+	}
+	p.waiting[agentID] = append(p.waiting[agentID], waiter)
+	p.dispatch()
+	p.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mutex.Lock()
+	if waiter.granted {
+		// The slot was granted as ctx ended; hand it on
+		p.release(agentID)
+	} else {
+		p.removeWaiter(agentID, waiter)
+	}
+	p.mutex.Unlock()
+	return ctx.Err()
+}
+
+// Release returns a slot held by agentID to the pool
+func (p *FairPool) Release(agentID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.release(agentID)
+}
+
+// Capacity returns the number of slots in the pool
+func (p *FairPool) Capacity() int {
+	return p.capacity
+}
+
+// InUse returns the number of slots held
+func (p *FairPool) InUse() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.inUse
+}
+
+// Pending returns the number of requests waiting for a slot per agent
+func (p *FairPool) Pending() map[string]int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pending := make(map[string]int, len(p.waiting))
+	for agentID, queue := range p.waiting {
+		pending[agentID] = len(queue)
+	}
+	return pending
+}
+
+// release frees a slot of agentID and grants it on; callers hold mutex
+func (p *FairPool) release(agentID string) {
+	p.inUse--
+	if p.running[agentID]--; p.running[agentID] <= 0 {
+		delete(p.running, agentID)
+	}
+	p.dispatch()
+}
+
+// dispatch grants free slots to waiting requests in round-robin order; callers hold mutex
+func (p *FairPool) dispatch() {
+	for p.inUse < p.capacity {
+		agentID, ok := p.nextAgent()
+		if !ok {
+			return
+		}
+
+		queue := p.waiting[agentID]
+		waiter := queue[0]
+		p.waiting[agentID] = queue[1:]
+		if len(p.waiting[agentID]) == 0 {
+			p.removeAgent(agentID)
+		}
+
+		p.inUse++
+		p.running[agentID]++
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+// nextAgent picks the agent whose turn it is among those below their limit, charging one slot of
+// its turn; callers hold mutex
+func (p *FairPool) nextAgent() (string, bool) {
+	for n := 0; n < len(p.order); n++ {
+		if p.cursor >= len(p.order) {
+			p.cursor = 0
+		}
+		agentID := p.order[p.cursor]
+		head := p.waiting[agentID][0]
+
+		if head.limit > 0 && p.running[agentID] >= head.limit {
+			p.credits[agentID] = 0
+			p.cursor++
+			continue
+		}
+
+		if p.credits[agentID] <= 0 {
+			p.credits[agentID] = head.weight
+		}
+		p.credits[agentID]--
+		if p.credits[agentID] == 0 {
+			p.cursor++
+		}
+		return agentID, true
+	}
+	return "", false
+}
+
+// removeWaiter drops a request that stopped waiting; callers hold mutex
+func (p *FairPool) removeWaiter(agentID string, waiter *poolWaiter) {
+	queue := p.waiting[agentID]
+	for i, queued := range queue {
+		if queued == waiter {
+			p.waiting[agentID] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(p.waiting[agentID]) == 0 {
+		p.removeAgent(agentID)
+	}
+}
+
+// removeAgent takes an agent without waiting requests out of the round-robin order, keeping the
+// turn with the agent that has it; callers hold mutex
+func (p *FairPool) removeAgent(agentID string) {
+	delete(p.waiting, agentID)
+	delete(p.credits, agentID)
+	for i, queued := range p.order {
+		if queued == agentID {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			if i < p.cursor {
+				p.cursor--
+			}
+			break
+		}
+	}
+	if p.cursor >= len(p.order) {
+		p.cursor = 0
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultFaultRuleTTL is how long fault injection rules registered without a TTL live
+const DefaultFaultRuleTTL = 5 * time.Minute
+
+// FaultInjector holds the fault injection rules applied at the hook points of the execution
+// pipeline. It only exists when debug.fault_injection is enabled; a nil FaultInjector injects nothing.
+type FaultInjector struct {
+	mutex  sync.Mutex
+	rules  map[string]*models.FaultRule
+	nextID int
+	random func() float64
+	logger *zap.Logger
+}
+
+// NewFaultInjector creates a FaultInjector without rules
+func NewFaultInjector(logger *zap.Logger) *FaultInjector {
+	return &FaultInjector{
+		rules:  make(map[string]*models.FaultRule),
+		random: rand.Float64,
+		logger: logger,
+	}
+}
+
+// SetRandom sets the source of the probabilities rules trigger with, returning values in [0, 1)
+func (fi *FaultInjector) SetRandom(random func() float64) {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.random = random
+}
+
+// AddRule validates and registers a rule, returning it with its ID and expiry filled in
+func (fi *FaultInjector) AddRule(rule models.FaultRule) (*models.FaultRule, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	if rule.Message == "" {
+		rule.Message = "fault injected for testing"
+	}
+
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+
+	fi.nextID++
+	rule.ID = fmt.Sprintf("fault-%d", fi.nextID)
+	rule.CreatedAt = time.Now()
+	ttl := DefaultFaultRuleTTL
+	if rule.TTLSeconds > 0 {
+		ttl = time.Duration(rule.TTLSeconds) * time.Second
+	}
+	rule.TTLSeconds = int(ttl / time.Second)
+	rule.ExpiresAt = rule.CreatedAt.Add(ttl)
+	rule.Matched = 0
+	rule.Triggered = 0
+	fi.rules[rule.ID] = &rule
+
+	fi.logger.Warn("fault injection rule registered",
+		zap.String("rule_id", rule.ID),
+		zap.String("point", string(rule.Point)),
+		zap.String("action", string(rule.Action)),
+		zap.String("agent_id", rule.AgentID),
+		zap.Time("expires_at", rule.ExpiresAt))
+	copied := rule
+	return &copied, nil
+}
+
+// ListRules returns the rules that have not expired, oldest first
+func (fi *FaultInjector) ListRules() []*models.FaultRule {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.pruneExpired(time.Now())
+
+	rules := make([]*models.FaultRule, 0, len(fi.rules))
+	for _, rule := range fi.rules {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if !rules[i].CreatedAt.Equal(rules[j].CreatedAt) {
+			return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
+
+// DeleteRule removes a rule before it expires
+func (fi *FaultInjector) DeleteRule(ruleID string) error {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	fi.pruneExpired(time.Now())
+
+	if _, exists := fi.rules[ruleID]; !exists {
+		return models.NewKindError(models.ErrFaultRuleNotFound, "fault rule %s not found", ruleID)
+	}
+	delete(fi.rules, ruleID)
+	return nil
+}
+
+// Inject applies the rules matching the hook point and agent: triggered delays are waited out, then
+// the first triggered failure or drop is returned as a *models.InjectedFault
+func (fi *FaultInjector) Inject(ctx context.Context, point models.FaultPoint, agentID string) error {
+	if fi == nil {
+		return nil
+	}
+
+	var delay time.Duration
+	var fault error
+	fi.mutex.Lock()
+	fi.pruneExpired(time.Now())
+	ruleIDs := make([]string, 0, len(fi.rules))
+	for id := range fi.rules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+	for _, id := range ruleIDs {
+		rule := fi.rules[id]
+		if rule.Point != point || (rule.AgentID != "" && rule.AgentID != agentID) {
+			continue
+		}
+		rule.Matched++
+		if !fi.triggers(rule) {
+			continue
+		}
+		rule.Triggered++
+		if rule.Action == models.FaultActionDelay {
+			delay += time.Duration(rule.DelayMs) * time.Millisecond
+		} else if fault == nil {
+			fault = &models.InjectedFault{RuleID: rule.ID, Point: point, Message: rule.Message, Transient: rule.Transient}
+		}
+	}
+	fi.mutex.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if fault != nil {
+		fi.logger.Info("fault injected",
+			zap.String("point", string(point)),
+			zap.String("agent_id", agentID),
+			zap.Error(fault))
+	}
+	return fault
+}
+
+// triggers reports whether a matched rule injects its fault this time
+func (fi *FaultInjector) triggers(rule *models.FaultRule) bool {
+	switch {
+	case rule.EveryNth > 0:
+		return rule.Matched%int64(rule.EveryNth) == 0
+	case rule.Probability > 0:
+		return fi.random() < rule.Probability
+	default:
+		return true
+	}
+}
+
+// pruneExpired drops the rules past their TTL
+func (fi *FaultInjector) pruneExpired(now time.Time) {
+	for id, rule := range fi.rules {
+		if !now.Before(rule.ExpiresAt) {
+			delete(fi.rules, id)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// BatchOptions are the options of a lifecycle operation on several agents at once
+type BatchOptions struct {
+	CancelActive bool   // Disable cancels the agents' in-flight executions
+	Wait         bool   // Wait for conflicting operations instead of failing
+	Force        bool   // Include protected agents
+	Confirmation string // Token from an earlier ConfirmationRequiredError
+	RequestedBy  string
+}
+
+// SetOperationGuard sets the lifecycle safety settings group and pattern operations are checked
+// against; without one every operation goes ahead
+func (ec *ExecutionCoordinator) SetOperationGuard(guard *OperationGuard) {
+	ec.guard = guard
+}
+
+// GroupOperation applies a lifecycle action to every member of an agent group: disable stops the
+// members in reverse order, enable and start start them in member order, and restart does both. The
+// operation locks of every member are taken before any is touched, so the group is operated on as a
+// whole or, when another operation holds a member, not at all. Steps stop at the first that fails,
+// which the result reports; errors are returned for unknown groups, unknown actions, held locks and
+// operations that need confirming.
+func (ec *ExecutionCoordinator) GroupOperation(name string, action models.TaskAction, options BatchOptions) (*models.GroupOperationResult, error) {
+	members, err := ec.groupMembers(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.GroupOperationResult{Group: name, Action: action, Steps: []models.GroupOperationStep{}}
+	return ec.batchOperation(result, models.GroupTargetPrefix+name, members, options)
+}
+
+// PatternOperation applies a lifecycle action to every agent whose ID matches pattern, such as * or
+// prefix:payments-, in ID order, like GroupOperation does to a group's members
+func (ec *ExecutionCoordinator) PatternOperation(pattern string, action models.TaskAction, options BatchOptions) (*models.GroupOperationResult, error) {
+	matched, err := ec.patternMembers(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.GroupOperationResult{Pattern: pattern, Action: action, Steps: []models.GroupOperationStep{}}
+	return ec.batchOperation(result, pattern, matched, options)
+}
+
+// groupMembers returns the members of an agent group in member order
+func (ec *ExecutionCoordinator) groupMembers(name string) ([]string, error) {
+	if ec.groups == nil {
+		return nil, models.NewKindError(models.ErrGroupNotFound, "agent group %s not found", name)
+	}
+	group, err := ec.groups.GetGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	return group.Members, nil
+}
+
+// patternMembers returns the IDs of the agents pattern matches in ID order, failing when none does
+func (ec *ExecutionCoordinator) patternMembers(pattern string) ([]string, error) {
+	selector := &models.AgentSelector{Pattern: pattern}
+	if err := selector.Validate(); err != nil {
+		return nil, err
+	}
+	agentConfigs, err := ec.agentService.ListAgents()
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, agentConfig := range agentConfigs {
+		if selector.Matches(agentConfig.ID) {
+			matched = append(matched, agentConfig.ID)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, models.NewKindError(models.ErrAgentNotFound, "no agent matches %s", pattern)
+	}
+	return matched, nil
+}
+
+// batchOperation applies the action of result to members, once the operation guard allows it
+func (ec *ExecutionCoordinator) batchOperation(result *models.GroupOperationResult, target string, members []string, options BatchOptions) (*models.GroupOperationResult, error) {
+	action := result.Action
+	var stop, start bool
+	switch action {
+	case models.AgentActionDisable:
+		stop = true
+	case models.AgentActionEnable, models.AgentActionStart:
+		start = true
+	case models.AgentActionRestart:
+		stop, start = true, true
+	default:
+		return nil, models.NewKindError(models.ErrInvalidTransition, "action %s cannot be applied to %s", action, target)
+	}
+
+	if ec.guard != nil {
+		agentConfigs, err := ec.agentService.ListAgents()
+		if err != nil {
+			return nil, err
+		}
+		if members, result.Protected, err = ec.guard.Check(target, action, members, len(agentConfigs), options.Force, options.Confirmation); err != nil {
+			return nil, err
+		}
+	}
+
+	releases := make([]func(), 0, len(members))
+	defer func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}()
+	for _, agentID := range members {
+		release, err := ec.lockAgent(agentID, action, options.Wait)
+		if err != nil {
+			return nil, fmt.Errorf("%s member %s: %w", target, agentID, err)
+		}
+		releases = append(releases, release)
+	}
+
+	if stop {
+		for i := len(members) - 1; i >= 0; i-- {
+			if !result.Add(ec.stopMember(members[i], action, options.CancelActive, options.RequestedBy)) {
+				return ec.logGroupOperation(result), nil
+			}
+		}
+	}
+	if start {
+		for _, agentID := range members {
+			if !result.Add(ec.startMember(agentID, action, options.RequestedBy)) {
+				return ec.logGroupOperation(result), nil
+			}
+		}
+	}
+	return ec.logGroupOperation(result), nil
+}
+
+// stopMember disables a group member, cancelling its executions and stopping its persistent process
+// when the group restarts
+func (ec *ExecutionCoordinator) stopMember(agentID string, action models.TaskAction, cancelActive bool, requestedBy string) models.GroupOperationStep {
+	step := models.GroupOperationStep{AgentID: agentID, Step: models.GroupStepStop, Status: models.OperationApplied}
+
+	var stopped *AgentToggleResult
+	var err error
+	if action == models.AgentActionRestart {
+		stopped, err = ec.stopForRestart(agentID, requestedBy)
+	} else {
+		stopped, err = ec.setAgentEnabled(agentID, false, cancelActive, "agent group disabled", requestedBy)
+	}
+	if err != nil {
+		step.Status, step.Message = models.OperationFailed, err.Error()
+		return step
+	}
+	step.CancelledExecutions = stopped.CancelledExecutions
+	return step
+}
+
+// startMember enables a group member or, for the start action, starts its persistent process;
+// members that are not persistent agents have no process to start and are skipped
+func (ec *ExecutionCoordinator) startMember(agentID string, action models.TaskAction, requestedBy string) models.GroupOperationStep {
+	step := models.GroupOperationStep{AgentID: agentID, Step: models.GroupStepStart, Status: models.OperationApplied}
+
+	if action != models.AgentActionStart {
+		if _, err := ec.setAgentEnabled(agentID, true, false, "", requestedBy); err != nil {
+			step.Status, step.Message = models.OperationFailed, err.Error()
+		}
+		return step
+	}
+
+	agentConfig, err := ec.agentService.GetAgent(agentID)
+	if err != nil {
+		step.Status, step.Message = models.OperationFailed, err.Error()
+		return step
+	}
+	if agentConfig.Mode != models.PersistentMode {
+		step.Status, step.Message = models.OperationSkipped, "not a persistent agent"
+		return step
+	}
+	if _, err := ec.startPersistent(agentConfig); err != nil {
+		step.Status, step.Message = models.OperationFailed, err.Error()
+	}
+	return step
+}
+
+// logGroupOperation logs the outcome of a group operation and returns it
+func (ec *ExecutionCoordinator) logGroupOperation(result *models.GroupOperationResult) *models.GroupOperationResult {
+	if failed := result.Failed(); failed != nil {
+		ec.logger.Warn("agent group operation stopped at a failed step",
+			zap.String("group", result.Group),
+			zap.String("pattern", result.Pattern),
+			zap.String("action", string(result.Action)),
+			zap.String("agent_id", failed.AgentID),
+			zap.String("step", string(failed.Step)),
+			zap.String("error", failed.Message))
+		return result
+	}
+
+	ec.logger.Info("agent group operation applied",
+		zap.String("group", result.Group),
+		zap.String("pattern", result.Pattern),
+		zap.String("action", string(result.Action)),
+		zap.Int("steps", len(result.Steps)),
+		zap.Strings("protected", result.Protected))
+	return result
+}
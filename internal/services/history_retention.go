@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// HistoryRetentionJob periodically deletes execution history older than a maximum age
+type HistoryRetentionJob struct {
+	repo     models.ExecutionHistoryRepository
+	maxAge   time.Duration
+	interval time.Duration
+	logger   *zap.Logger
+
+	// artifacts, when set, loses the artifacts of executions past maxAge along with their history
+	artifacts *ArtifactStore
+}
+
+// NewHistoryRetentionJob creates a new HistoryRetentionJob
+func NewHistoryRetentionJob(repo models.ExecutionHistoryRepository, maxAge, interval time.Duration, logger *zap.Logger) *HistoryRetentionJob {
+	return &HistoryRetentionJob{
+		repo:     repo,
+		maxAge:   maxAge,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// SetArtifactStore makes the job also delete execution artifacts older than maxAge
+func (j *HistoryRetentionJob) SetArtifactStore(store *ArtifactStore) {
+	j.artifacts = store
+}
+
+// Start runs the job every interval until ctx is cancelled; it does nothing when maxAge is not positive
+func (j *HistoryRetentionJob) Start(ctx context.Context) {
+	if j.maxAge <= 0 || j.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			j.RunOnce()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce deletes records and artifacts older than maxAge and returns how many records were removed
+func (j *HistoryRetentionJob) RunOnce() int {
+	cutoff := time.Now().Add(-j.maxAge)
+	if j.artifacts != nil {
+		if removed, err := j.artifacts.DeleteBefore(cutoff); err != nil {
+			j.logger.Error("failed to apply execution artifact retention", zap.Error(err))
+		} else if removed > 0 {
+			j.logger.Info("deleted expired execution artifacts",
+				zap.Int("executions", removed),
+				zap.Time("cutoff", cutoff))
+		}
+	}
+
+	deleted, err := j.repo.DeleteExecutionHistoryBefore(cutoff)
+	if err != nil {
+		j.logger.Error("failed to apply execution history retention", zap.Error(err))
+		return 0
+	}
+
+	if deleted > 0 {
+		j.logger.Info("deleted expired execution history",
+			zap.Int("deleted", deleted),
+			zap.Time("cutoff", cutoff))
+	}
+	return deleted
+}
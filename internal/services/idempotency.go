@@ -0,0 +1,167 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Defaults for the idempotency key store when no window or size is configured
+const (
+	DefaultIdempotencyWindow  = time.Hour
+	DefaultIdempotencyMaxKeys = 10000
+)
+
+// MaxIdempotencyKeyLength bounds the idempotency keys callers may send
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyStore remembers which execution each idempotency key started, per agent, so retried
+// requests attach to the first execution instead of starting another. Keys of finished executions
+// expire after the window; the oldest keys are evicted when the store is full.
+type IdempotencyStore struct {
+	window  time.Duration
+	maxKeys int
+
+	mutex   sync.Mutex
+	order   *list.List // Oldest claim at the front
+	entries map[string]*list.Element
+}
+
+// idempotencyEntry tracks the execution claimed by one key
+type idempotencyEntry struct {
+	key         string
+	executionID string
+	err         error         // Error the first request returned, if any
+	assigned    chan struct{} // Closed once executionID is set or the request was rejected
+	finished    chan struct{} // Closed once the execution finished or the request was rejected
+	finishedAt  time.Time     // Zero while the execution runs; keys only expire after it finishes
+}
+
+// NewIdempotencyStore creates a store keeping keys for window after their execution finishes and at
+// most maxKeys keys
+func NewIdempotencyStore(window time.Duration, maxKeys int) *IdempotencyStore {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	if maxKeys <= 0 {
+		maxKeys = DefaultIdempotencyMaxKeys
+	}
+	return &IdempotencyStore{
+		window:  window,
+		maxKeys: maxKeys,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// ValidateIdempotencyKey rejects keys that are too long or contain control characters
+func ValidateIdempotencyKey(key string) error {
+	if len(key) > MaxIdempotencyKeyLength {
+		return models.ValidationError("idempotency key cannot be longer than 255 characters")
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return models.ValidationError("idempotency key cannot contain control characters")
+		}
+	}
+	return nil
+}
+
+// claim returns the entry of key for agentID and whether another request already claimed it. A new
+// entry belongs to the caller, which must assign and finish it.
+func (s *IdempotencyStore) claim(agentID, key string) (*idempotencyEntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scoped := agentID + "\x00" + key
+	if element, exists := s.entries[scoped]; exists {
+		entry := element.Value.(*idempotencyEntry)
+		if entry.finishedAt.IsZero() || time.Since(entry.finishedAt) <= s.window {
+			return entry, true
+		}
+		s.order.Remove(element)
+		delete(s.entries, scoped)
+	}
+
+	entry := &idempotencyEntry{
+		key:      scoped,
+		assigned: make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	s.entries[scoped] = s.order.PushBack(entry)
+	s.evict()
+	return entry, false
+}
+
+// evict drops expired keys, then the oldest keys while the store is over its size; callers hold the mutex
+func (s *IdempotencyStore) evict() {
+	for element := s.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*idempotencyEntry)
+		if !entry.finishedAt.IsZero() && time.Since(entry.finishedAt) > s.window {
+			s.order.Remove(element)
+			delete(s.entries, entry.key)
+		}
+		element = next
+	}
+
+	for s.order.Len() > s.maxKeys {
+		oldest := s.order.Front()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*idempotencyEntry).key)
+	}
+}
+
+// assign records the execution started for a claimed entry
+func (s *IdempotencyStore) assign(entry *idempotencyEntry, executionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry.executionID = executionID
+	close(entry.assigned)
+}
+
+// finish records that the execution of a claimed entry finished with err, starting its expiry
+func (s *IdempotencyStore) finish(entry *idempotencyEntry, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry.err = err
+	entry.finishedAt = time.Now()
+	close(entry.finished)
+}
+
+// reject releases a claimed entry whose request was rejected before an execution started, so a
+// retry of the request may claim the key again
+func (s *IdempotencyStore) reject(entry *idempotencyEntry, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry.err = err
+	if element, exists := s.entries[entry.key]; exists && element.Value == entry {
+		s.order.Remove(element)
+		delete(s.entries, entry.key)
+	}
+	select {
+	case <-entry.assigned:
+	default:
+		close(entry.assigned)
+	}
+	close(entry.finished)
+}
+
+// await waits on signal, then returns the entry's execution ID and error
+func (s *IdempotencyStore) await(ctx context.Context, entry *idempotencyEntry, signal chan struct{}) (string, error) {
+	select {
+	case <-signal:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return entry.executionID, entry.err
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Defaults of an InputMaterializer's fetch policy
+const (
+	DefaultInputFetchMaxBytes = 100 << 20
+	DefaultInputFetchTimeout  = 30 * time.Second
+)
+
+// BinaryInput is execution input given as bytes rather than text: data sent inline, or a URL the
+// supervisor fetches. Either is handed to the agent as a file.
+type BinaryInput struct {
+	Data        []byte // Decoded inline content, used when URL is empty
+	URL         string
+	ContentType string // The fetched response's Content-Type is used for URLs when empty
+}
+
+// InputMaterializer writes binary execution input to spool files agents are handed. Input URLs
+// are only fetched when their scheme and host are allowed, at most once and without following
+// redirects, so a failed fetch is never retried against another URL.
+type InputMaterializer struct {
+	dir            string
+	allowedSchemes []string
+	allowedHosts   []string
+	maxBytes       int64
+	client         *http.Client
+	logger         *zap.Logger
+}
+
+// NewInputMaterializer creates a materializer spooling to dir, the system temp directory when
+// empty. It fetches no URLs until hosts are allowed with SetFetchPolicy.
+func NewInputMaterializer(dir string, logger *zap.Logger) *InputMaterializer {
+	m := &InputMaterializer{
+		dir:            dir,
+		allowedSchemes: []string{"https"},
+		maxBytes:       DefaultInputFetchMaxBytes,
+		logger:         logger,
+	}
+	m.client = m.newClient(DefaultInputFetchTimeout)
+	return m
+}
+
+// SetFetchPolicy sets the URL schemes and hosts input URLs may use, a leading "*." matching any
+// subdomain and "*" any host, the largest input accepted, 0 for no limit, and how long fetching may
+// take, 0 keeping the default. Schemes default to https when empty.
+func (m *InputMaterializer) SetFetchPolicy(schemes, hosts []string, maxBytes int64, timeout time.Duration) {
+	if len(schemes) > 0 {
+		m.allowedSchemes = schemes
+	}
+	m.allowedHosts = hosts
+	m.maxBytes = maxBytes
+	if timeout <= 0 {
+		timeout = DefaultInputFetchTimeout
+	}
+	m.client = m.newClient(timeout)
+}
+
+// newClient returns a client fetching with timeout that does not follow redirects
+func (m *InputMaterializer) newClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Materialize writes the input to a new spool file and returns its path and what is recorded about
+// it. The caller removes the file once the execution finished.
+func (m *InputMaterializer) Materialize(ctx context.Context, input *BinaryInput) (string, *models.InputContent, error) {
+	if err := m.Check(input); err != nil {
+		return "", nil, err
+	}
+
+	content := &models.InputContent{Source: models.InputContentInline, ContentType: input.ContentType}
+	var source io.Reader
+	if input.URL == "" {
+		source = bytes.NewReader(input.Data)
+	} else {
+		target, _ := url.Parse(input.URL)
+		body, contentType, err := m.fetch(ctx, target)
+		if err != nil {
+			return "", nil, err
+		}
+		defer body.Close()
+		content.Source, content.URL = models.InputContentURL, redactURL(target)
+		if content.ContentType == "" {
+			content.ContentType = contentType
+		}
+		source = body
+	}
+
+	spool, err := os.CreateTemp(m.dir, "input-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create input file: %w", err)
+	}
+	checksum := sha256.New()
+	content.Size, err = m.copyLimited(io.MultiWriter(spool, checksum), source)
+	if closeErr := spool.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write input file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(spool.Name())
+		return "", nil, err
+	}
+	content.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+	return spool.Name(), content, nil
+}
+
+// Check refuses inline input over the input limit and URLs whose scheme or host is not allowed,
+// before anything is fetched
+func (m *InputMaterializer) Check(input *BinaryInput) error {
+	if input.URL == "" {
+		if m.maxBytes > 0 && int64(len(input.Data)) > m.maxBytes {
+			return models.ValidationError(fmt.Sprintf("input_base64 exceeds the input limit of %d bytes", m.maxBytes))
+		}
+		return nil
+	}
+
+	target, err := url.Parse(input.URL)
+	if err != nil || target.Host == "" {
+		return models.ValidationError(fmt.Sprintf("input_url %q is not an absolute URL", input.URL))
+	}
+	if !containsFold(m.allowedSchemes, target.Scheme) {
+		return models.NewKindError(models.ErrInputURLNotAllowed, "input_url scheme %s is not allowed", target.Scheme)
+	}
+	if !m.hostAllowed(target.Hostname()) {
+		return models.NewKindError(models.ErrInputURLNotAllowed, "input_url host %s is not allowed", target.Hostname())
+	}
+	return nil
+}
+
+// hostAllowed reports whether host matches an allowed host
+func (m *InputMaterializer) hostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range m.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*" || allowed == host:
+			return true
+		case strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// fetch requests the input URL and returns the body of a successful response and its content type
+func (m *InputMaterializer) fetch(ctx context.Context, target *url.URL) (io.ReadCloser, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, "", models.NewKindError(models.ErrInputFetchFailed, "failed to fetch input_url %s: %v", redactURL(target), err)
+	}
+	response, err := m.client.Do(request)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, "", models.NewKindError(models.ErrInputFetchFailed, "failed to fetch input_url %s: %v", redactURL(target), err)
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, "", models.NewKindError(models.ErrInputFetchFailed, "failed to fetch input_url %s: %s", redactURL(target), response.Status)
+	}
+	if m.maxBytes > 0 && response.ContentLength > m.maxBytes {
+		response.Body.Close()
+		return nil, "", models.NewKindError(models.ErrInputFetchFailed, "input_url %s is %d bytes, over the input limit of %d bytes",
+			redactURL(target), response.ContentLength, m.maxBytes)
+	}
+	m.logger.Debug("fetching input", zap.String("url", redactURL(target)), zap.Int64("content_length", response.ContentLength))
+	return response.Body, response.Header.Get("Content-Type"), nil
+}
+
+// copyLimited copies source to spool, failing once it exceeds the input limit
+func (m *InputMaterializer) copyLimited(spool io.Writer, source io.Reader) (int64, error) {
+	if m.maxBytes <= 0 {
+		size, err := io.Copy(spool, source)
+		if err != nil {
+			return 0, models.NewKindError(models.ErrInputFetchFailed, "failed to read input: %v", err)
+		}
+		return size, nil
+	}
+	size, err := io.Copy(spool, io.LimitReader(source, m.maxBytes+1))
+	if err != nil {
+		return 0, models.NewKindError(models.ErrInputFetchFailed, "failed to read input: %v", err)
+	}
+	if size > m.maxBytes {
+		return 0, models.NewKindError(models.ErrInputFetchFailed, "input exceeds the input limit of %d bytes", m.maxBytes)
+	}
+	return size, nil
+}
+
+// redactURL returns the URL without credentials, query or fragment, which may carry secrets
+func redactURL(target *url.URL) string {
+	redacted := *target
+	redacted.User, redacted.RawQuery, redacted.Fragment = nil, "", ""
+	return redacted.String()
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
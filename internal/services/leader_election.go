@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Defaults for leader election
+const (
+	DefaultLeaseDuration      = 15 * time.Second
+	DefaultLeaseRenewInterval = 5 * time.Second
+)
+
+// LeaderElector decides which of the supervisor instances sharing a lease store leads. The leader
+// renews its lease every renew interval; once the lease expires without renewal another instance
+// takes it. Leadership hooks run whenever this instance gains or loses leadership, so the leader
+// alone schedules tasks, runs agent processes and delivers webhooks.
+type LeaderElector struct {
+	leases        models.LeaseStore
+	identity      string
+	address       string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	now           func() time.Time
+	hooks         []func(leader bool)
+	leader        bool
+	lease         *models.LeaderLease // Lease as last observed
+	campaignMutex sync.Mutex          // Serializes campaigns and the hooks they run
+	mutex         sync.RWMutex
+	cancel        context.CancelFunc
+	done          chan struct{}
+	logger        *zap.Logger
+}
+
+// NewLeaderElector creates a LeaderElector competing for the lease in leases as identity; address
+// is the base URL followers send the requests only the leader serves to
+func NewLeaderElector(leases models.LeaseStore, identity, address string, logger *zap.Logger) *LeaderElector {
+	return &LeaderElector{
+		leases:        leases,
+		identity:      identity,
+		address:       address,
+		leaseDuration: DefaultLeaseDuration,
+		renewInterval: DefaultLeaseRenewInterval,
+		now:           time.Now,
+		logger:        logger,
+	}
+}
+
+// SetLeaseTiming sets how long a lease lasts and how often the leader renews it; zero values keep
+// the current setting. The renew interval is capped to a third of the lease so a leader misses a
+// renewal or two before losing it.
+func (le *LeaderElector) SetLeaseTiming(duration, renewInterval time.Duration) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+
+	if duration > 0 {
+		le.leaseDuration = duration
+	}
+	if renewInterval > 0 {
+		le.renewInterval = renewInterval
+	}
+	if le.renewInterval > le.leaseDuration/3 {
+		le.renewInterval = le.leaseDuration / 3
+	}
+}
+
+// SetClock replaces the clock campaigns read, for tests
+func (le *LeaderElector) SetClock(now func() time.Time) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	le.now = now
+}
+
+// AddLeadershipHook registers a hook called with true when this instance becomes the leader and with
+// false when it stops being the leader
+func (le *LeaderElector) AddLeadershipHook(hook func(leader bool)) {
+	le.mutex.Lock()
+	defer le.mutex.Unlock()
+	le.hooks = append(le.hooks, hook)
+}
+
+// Start campaigns right away and then every renew interval until Stop is called or ctx is cancelled
+func (le *LeaderElector) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	le.mutex.Lock()
+	le.cancel = cancel
+	le.done = make(chan struct{})
+	interval := le.renewInterval
+	done := le.done
+	le.mutex.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			le.Campaign()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops campaigning; a leader steps down and releases its lease so a follower takes over at
+// its next campaign
+func (le *LeaderElector) Stop() {
+	le.mutex.Lock()
+	cancel, done := le.cancel, le.done
+	le.cancel = nil
+	le.mutex.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+
+	le.campaignMutex.Lock()
+	defer le.campaignMutex.Unlock()
+	if le.IsLeader() {
+		le.setLeader(false)
+		if err := le.leases.ReleaseLease(le.identity); err != nil {
+			le.logger.Warn("failed to release leader lease", zap.Error(err))
+		}
+	}
+}
+
+// Campaign tries once to take or renew the lease and returns whether this instance leads. A leader
+// that cannot renew steps down once its lease would expire before the next attempt, so it stops
+// leading before a follower can take the lease.
+func (le *LeaderElector) Campaign() bool {
+	le.campaignMutex.Lock()
+	defer le.campaignMutex.Unlock()
+
+	le.mutex.RLock()
+	now := le.now()
+	duration, renewInterval := le.leaseDuration, le.renewInterval
+	le.mutex.RUnlock()
+
+	lease, err := le.leases.AcquireLease(le.identity, le.address, now, duration)
+	if err != nil {
+		le.logger.Warn("failed to renew leader lease", zap.String("identity", le.identity), zap.Error(err))
+		le.mutex.RLock()
+		expiring := le.leader && le.lease != nil && !now.Add(renewInterval).Before(le.lease.ExpiresAt)
+		le.mutex.RUnlock()
+		if expiring {
+			le.setLeader(false)
+		}
+		return le.IsLeader()
+	}
+
+	le.mutex.Lock()
+	le.lease = lease
+	le.mutex.Unlock()
+	if leading := lease.Holder == le.identity; leading != le.IsLeader() {
+		le.setLeader(leading)
+	}
+	return le.IsLeader()
+}
+
+// setLeader records a change of role and runs the leadership hooks; callers hold campaignMutex
+func (le *LeaderElector) setLeader(leader bool) {
+	le.mutex.Lock()
+	le.leader = leader
+	hooks := append([]func(bool){}, le.hooks...)
+	le.mutex.Unlock()
+
+	if leader {
+		le.logger.Info("became the leader", zap.String("identity", le.identity))
+	} else {
+		le.logger.Warn("stopped being the leader", zap.String("identity", le.identity))
+	}
+	for _, hook := range hooks {
+		hook(leader)
+	}
+}
+
+// IsLeader reports whether this instance leads
+func (le *LeaderElector) IsLeader() bool {
+	le.mutex.RLock()
+	defer le.mutex.RUnlock()
+	return le.leader
+}
+
+// Status returns the role of this instance and the lease it last observed
+func (le *LeaderElector) Status() models.LeadershipStatus {
+	le.mutex.RLock()
+	defer le.mutex.RUnlock()
+
+	status := models.LeadershipStatus{Role: models.LeaderRoleFollower, Identity: le.identity}
+	if le.leader {
+		status.Role = models.LeaderRoleLeader
+	}
+	if le.lease != nil && le.lease.ExpiresAt.After(le.now()) {
+		expiresAt := le.lease.ExpiresAt
+		status.Leader = le.lease.Holder
+		status.LeaderAddress = le.lease.Address
+		status.LeaseExpiresAt = &expiresAt
+	}
+	return status
+}
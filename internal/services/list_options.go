@@ -0,0 +1,141 @@
+package services
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// Fields list queries sort by
+const (
+	SortByID        = "id"
+	SortByName      = "name"
+	SortByCreatedAt = "created_at"
+)
+
+// Directions list queries sort in
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// ListOptions orders and pages the results of a list query. Results are sorted by ID unless Sort
+// names another field, ties broken by ID, so pages stay stable between calls.
+type ListOptions struct {
+	Sort   string // id, name or created_at; id when empty
+	Order  string // asc or desc; asc when empty
+	Limit  int    // Results per page, 0 for all
+	Offset int    // Results skipped before the page
+}
+
+// AgentListOptions selects, orders and pages agents in QueryAgents; zero-valued filters match every agent
+type AgentListOptions struct {
+	ListOptions
+	Enabled        *bool
+	AccessType     types.AgentAccessType
+	IncludeDeleted bool // Soft-deleted agents are left out unless set
+}
+
+// TaskListOptions selects, orders and pages scheduled tasks in QueryScheduledTasks; zero-valued
+// filters match every task
+type TaskListOptions struct {
+	ListOptions
+	Enabled *bool
+	AgentID string
+}
+
+// Validate checks the options, returning every problem found as ValidationErrors
+func (o ListOptions) Validate() error {
+	errs := models.ValidationErrors{}
+	switch o.Sort {
+	case "", SortByID, SortByName, SortByCreatedAt:
+	default:
+		errs.Add("sort", models.ValidationInvalid, "sort must be id, name or created_at")
+	}
+	switch o.Order {
+	case "", SortAscending, SortDescending:
+	default:
+		errs.Add("order", models.ValidationInvalid, "order must be asc or desc")
+	}
+	if o.Limit < 0 {
+		errs.Add("limit", models.ValidationOutOfRange, "limit cannot be negative")
+	}
+	if o.Offset < 0 {
+		errs.Add("offset", models.ValidationOutOfRange, "offset cannot be negative")
+	}
+	return errs.Err()
+}
+
+// Validate checks the options and the access type filter
+func (o AgentListOptions) Validate() error {
+	errs := models.ValidationErrors{}
+	if err := o.ListOptions.Validate(); err != nil {
+		errs.AddError("", models.ValidationInvalid, err)
+	}
+	switch o.AccessType {
+	case "", types.ReadOnlyAccessType, types.ReadWriteAccessType:
+	default:
+		errs.Add("access_type", models.ValidationInvalid, "access_type must be read-only or read-write")
+	}
+	return errs.Err()
+}
+
+// NormalizeAccessType accepts the read_only spelling of access types
+func NormalizeAccessType(accessType string) types.AgentAccessType {
+	return types.AgentAccessType(strings.ReplaceAll(accessType, "_", "-"))
+}
+
+// listKeys are the fields a list query can sort items by
+type listKeys[T any] struct {
+	id        func(T) string
+	name      func(T) string
+	createdAt func(T) time.Time
+}
+
+// sortAndPage sorts items as the options ask and returns the requested page
+func sortAndPage[T any](items []T, options ListOptions, keys listKeys[T]) []T {
+	compare := func(a, b T) int {
+		result := 0
+		switch options.Sort {
+		case SortByName:
+			result = cmp.Compare(keys.name(a), keys.name(b))
+		case SortByCreatedAt:
+			result = keys.createdAt(a).Compare(keys.createdAt(b))
+		}
+		if result == 0 {
+			result = cmp.Compare(keys.id(a), keys.id(b))
+		}
+		if options.Order == SortDescending {
+			return -result
+		}
+		return result
+	}
+	slices.SortFunc(items, compare)
+
+	if options.Offset >= len(items) {
+		return items[:0]
+	}
+	items = items[options.Offset:]
+	if options.Limit > 0 && options.Limit < len(items) {
+		items = items[:options.Limit]
+	}
+	return items
+}
+
+// agentListKeys sorts agents
+var agentListKeys = listKeys[*models.AgentConfiguration]{
+	id:        func(a *models.AgentConfiguration) string { return a.ID },
+	name:      func(a *models.AgentConfiguration) string { return a.Name },
+	createdAt: func(a *models.AgentConfiguration) time.Time { return a.CreatedAt },
+}
+
+// taskListKeys sorts scheduled tasks
+var taskListKeys = listKeys[*models.ScheduledTask]{
+	id:        func(t *models.ScheduledTask) string { return t.ID },
+	name:      func(t *models.ScheduledTask) string { return t.Name },
+	createdAt: func(t *models.ScheduledTask) time.Time { return t.CreatedAt },
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// MaintenanceService tells whether agents are in maintenance: in one of their own maintenance
+// windows, in a global window of every agent, or in an ad-hoc window started through the API.
+// Ad-hoc windows are kept in memory only and end with the supervisor.
+type MaintenanceService struct {
+	agentService IAgentService
+	global       []*definitions.MaintenanceSchedule
+	adHoc        map[string]models.MaintenancePeriod // By agent ID
+	location     *time.Location                      // Windows without a time zone are evaluated in it
+	now          func() time.Time
+	mutex        sync.RWMutex
+	logger       *zap.Logger
+}
+
+// NewMaintenanceService creates a MaintenanceService without global windows
+func NewMaintenanceService(agentService IAgentService, logger *zap.Logger) *MaintenanceService {
+	return &MaintenanceService{
+		agentService: agentService,
+		adHoc:        make(map[string]models.MaintenancePeriod),
+		location:     time.Local,
+		now:          time.Now,
+		logger:       logger,
+	}
+}
+
+// SetLocation sets the time zone of windows that name none, such as the scheduler's
+func (ms *MaintenanceService) SetLocation(location *time.Location) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.location = location
+}
+
+// SetGlobalWindows replaces the maintenance windows applying to every agent, keeping the current
+// ones when any is invalid
+func (ms *MaintenanceService) SetGlobalWindows(windows []models.MaintenanceWindow) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	global := make([]*definitions.MaintenanceSchedule, 0, len(windows))
+	for i, window := range windows {
+		schedule, err := definitions.ParseMaintenanceWindow(window, ms.location)
+		if err != nil {
+			return fmt.Errorf("maintenance window %d: %w", i, err)
+		}
+		global = append(global, schedule)
+	}
+	ms.global = global
+	return nil
+}
+
+// Begin starts an ad-hoc maintenance window of an agent lasting duration from now, replacing any
+// ad-hoc window it is in
+func (ms *MaintenanceService) Begin(agentID string, duration time.Duration, reason, requestedBy string) (*models.MaintenancePeriod, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("maintenance duration must be positive, got %s", duration)
+	}
+	if _, err := ms.agentService.GetAgent(agentID); err != nil {
+		return nil, err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := ms.now()
+	period := models.MaintenancePeriod{
+		Start:       now,
+		End:         now.Add(duration),
+		Reason:      reason,
+		Source:      models.MaintenanceSourceAdHoc,
+		RequestedBy: requestedBy,
+	}
+	ms.adHoc[agentID] = period
+	ms.logger.Info("agent entered ad-hoc maintenance",
+		zap.String("agent_id", agentID),
+		zap.Time("until", period.End),
+		zap.String("reason", reason),
+		zap.String("requested_by", requestedBy))
+	return &period, nil
+}
+
+// End ends the ad-hoc maintenance window of an agent early; recurring windows are unaffected.
+// Returns false when the agent was in no ad-hoc window.
+func (ms *MaintenanceService) End(agentID string) bool {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	period, exists := ms.adHoc[agentID]
+	delete(ms.adHoc, agentID)
+	return exists && period.End.After(ms.now())
+}
+
+// Status returns an agent's current and next maintenance periods
+func (ms *MaintenanceService) Status(agentID string) (*models.MaintenanceStatus, error) {
+	config, err := ms.agentService.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	return ms.StatusOf(config), nil
+}
+
+// InMaintenance reports whether an agent is in maintenance, and until when
+func (ms *MaintenanceService) InMaintenance(agentID string) (*models.MaintenancePeriod, bool) {
+	config, err := ms.agentService.GetAgent(agentID)
+	if err != nil {
+		return nil, false
+	}
+	status := ms.StatusOf(config)
+	return status.Current, status.Active
+}
+
+// Active reports whether the agent is in maintenance; it does not look the agent up, so the
+// agents package can call it while holding its own locks
+func (ms *MaintenanceService) Active(config *models.AgentConfiguration) bool {
+	return ms.StatusOf(config).Active
+}
+
+// StatusOf returns the current and next maintenance periods of an agent
+func (ms *MaintenanceService) StatusOf(config *models.AgentConfiguration) *models.MaintenanceStatus {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	now := ms.now()
+	status := &models.MaintenanceStatus{}
+	consider := func(schedule *definitions.MaintenanceSchedule, source string) {
+		if current, ok := schedule.Current(now); ok {
+			current.Source = source
+			status.Current = laterEnd(status.Current, current)
+		}
+		if next, ok := schedule.Next(now); ok {
+			next.Source = source
+			if status.Next == nil || next.Start.Before(status.Next.Start) {
+				status.Next = next
+			}
+		}
+	}
+
+	for i, window := range config.MaintenanceWindows {
+		schedule, err := definitions.ParseMaintenanceWindow(window, ms.location)
+		if err != nil {
+			// Registration rejects invalid windows, so this agent predates the check
+			ms.logger.Debug("ignoring invalid maintenance window",
+				zap.String("agent_id", config.ID),
+				zap.Int("window", i),
+				zap.Error(err))
+			continue
+		}
+		consider(schedule, models.MaintenanceSourceAgent)
+	}
+	for _, schedule := range ms.global {
+		consider(schedule, models.MaintenanceSourceGlobal)
+	}
+
+	if period, exists := ms.adHoc[config.ID]; exists {
+		if period.End.After(now) {
+			status.Current = laterEnd(status.Current, &period)
+		} else {
+			delete(ms.adHoc, config.ID)
+		}
+	}
+
+	status.Active = status.Current != nil
+	return status
+}
+
+// laterEnd returns the period ending last
+func laterEnd(current, period *models.MaintenancePeriod) *models.MaintenancePeriod {
+	if current == nil || period.End.After(current.End) {
+		return period
+	}
+	return current
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/models"
 	"github.com/algonius/algonius-supervisor/pkg/types"
 	"go.uber.org/zap"
 )
@@ -15,12 +16,16 @@ type MetricsCollector struct {
 	
 	// Execution metrics
 	executionCount       int64
+	warningExecutionCount int64
 	failedExecutionCount int64
 	totalExecutionTime   time.Duration
 	executionHistory     []ExecutionMetric
 	
-	// Agent metrics
-	agentMetrics map[string]*AgentMetric
+	// Agent metrics, with recent executions of each agent kept in a sliding window
+	agentMetrics  map[string]*AgentMetric
+	agentWindows  map[string]*durationWindow
+	window        time.Duration
+	windowSamples int
 	
 	// Resource usage
 	resourceUsage *types.ResourceUsage
@@ -33,6 +38,51 @@ type MetricsCollector struct {
 	// A2A protocol metrics
 	a2aRequestCount int64
 	a2aErrorCount   int64
+
+	// Label metrics, restricted to allow-listed keys to bound cardinality
+	labelAllowList map[string]bool
+	labelMetrics   map[string]*LabelMetric
+
+	// Rate limit rejections keyed by client ID
+	rateLimitMetrics map[string]*RateLimitMetric
+
+	// Fired execution queue alerts keyed by agent ID
+	queueAlerts map[string]int64
+
+	// Drift of scheduled fires and missed fires keyed by task ID
+	scheduleDrift map[string]*ScheduleDriftHistogram
+}
+
+// Reasons passed to RecordRateLimitRejection
+const (
+	RateLimitReasonRate        = "rate"        // Request rate exceeded
+	RateLimitReasonConcurrency = "concurrency" // Concurrent execution quota exceeded
+)
+
+// RateLimitMetric counts requests rejected for a single client
+type RateLimitMetric struct {
+	ClientID             string `json:"client_id"`
+	RateRejections       int64  `json:"rate_rejections"`
+	ConcurrencyRejections int64 `json:"concurrency_rejections"`
+}
+
+// ScheduleDriftBuckets are the upper bounds, in seconds, of the schedule drift histogram buckets
+var ScheduleDriftBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// ScheduleDriftHistogram is the distribution of how late the cron scheduler fired a task
+type ScheduleDriftHistogram struct {
+	Buckets     []int64 `json:"buckets"` // Fires at most ScheduleDriftBuckets[i] seconds late, cumulative
+	SumSeconds  float64 `json:"sum_seconds"`
+	Count       int64   `json:"count"`
+	MissedFires int64   `json:"missed_fires"`
+}
+
+// LabelMetric counts executions carrying a specific allow-listed label value
+type LabelMetric struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	TotalExecutions  int64  `json:"total_executions"`
+	FailedExecutions int64  `json:"failed_executions"`
 }
 
 // ExecutionMetric represents metrics for a single execution
@@ -42,18 +92,27 @@ type ExecutionMetric struct {
 	ExecutionTime   time.Duration
 	Status          types.ExecutionStatus
 	StartTime       time.Time
-	IsScheduled     bool
 }
 
-// AgentMetric represents metrics for a specific agent
+// AgentMetric represents metrics for a specific agent. Counts cover every execution; the window
+// fields and duration percentiles only cover executions within the sliding window.
 type AgentMetric struct {
-	ID                  string
-	TotalExecutions     int64
-	SuccessfulExecutions int64
-	FailedExecutions    int64
-	AvgExecutionTime    time.Duration
-	LastExecutionTime   time.Time
-	ActiveExecutions    int
+	ID                   string        `json:"id"`
+	TotalExecutions      int64         `json:"total_executions"`
+	SuccessfulExecutions int64         `json:"successful_executions"`
+	WarningExecutions    int64         `json:"warning_executions"` // Exited with a code mapped to warning; count as succeeded in rates
+	FailedExecutions     int64         `json:"failed_executions"`
+	SuccessRate          float64       `json:"success_rate_percentage"`
+	AvgExecutionTime     time.Duration `json:"avg_execution_time"`
+	LastExecutionTime    time.Time     `json:"last_execution_time"`
+	LastFailureTime      *time.Time    `json:"last_failure_time,omitempty"`
+	ActiveExecutions     int           `json:"active_executions"`
+	PeakMemoryMB         int64         `json:"peak_memory_mb"`
+	WindowExecutions     int           `json:"window_executions"`
+	WindowSuccessRate    float64       `json:"window_success_rate_percentage"`
+	P50ExecutionTime     time.Duration `json:"p50_execution_time"`
+	P95ExecutionTime     time.Duration `json:"p95_execution_time"`
+	P99ExecutionTime     time.Duration `json:"p99_execution_time"`
 }
 
 // NewMetricsCollector creates a new metrics collector
@@ -65,19 +124,54 @@ func NewMetricsCollector(logger *zap.Logger) *MetricsCollector {
 	return &MetricsCollector{
 		logger:         logger,
 		agentMetrics:   make(map[string]*AgentMetric),
+		agentWindows:   make(map[string]*durationWindow),
+		window:         DefaultMetricsWindow,
+		windowSamples:  DefaultMetricsWindowSamples,
 		executionHistory: make([]ExecutionMetric, 0),
+		labelAllowList: make(map[string]bool),
+		labelMetrics:   make(map[string]*LabelMetric),
+		rateLimitMetrics: make(map[string]*RateLimitMetric),
+		queueAlerts:    make(map[string]int64),
+		scheduleDrift:  make(map[string]*ScheduleDriftHistogram),
 	}
 }
 
-// RecordExecution records metrics for an execution
-func (mc *MetricsCollector) RecordExecution(agentID string, executionTime time.Duration, status types.ExecutionStatus, isScheduled bool) {
+// SetDurationWindow sets how long and how many executions per agent are kept for duration
+// percentiles; samples recorded so far are discarded
+func (mc *MetricsCollector) SetDurationWindow(window time.Duration, samples int) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if samples <= 0 {
+		samples = DefaultMetricsWindowSamples
+	}
+	mc.window = window
+	mc.windowSamples = samples
+	mc.agentWindows = make(map[string]*durationWindow)
+}
+
+// DurationWindow returns the sliding window used for duration percentiles
+func (mc *MetricsCollector) DurationWindow() time.Duration {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+
+	return mc.window
+}
+
+// RecordExecution records metrics for a completed execution; resourceUsage may be nil
+func (mc *MetricsCollector) RecordExecution(agentID string, executionTime time.Duration, status types.ExecutionStatus, resourceUsage *models.ResourceUsage) {
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 	
-	// Update overall execution metrics
-	if status == types.SuccessStatus {
+	now := time.Now()
+
+	// Update overall execution metrics; warnings are counted apart from plain successes
+	switch status {
+	case types.SuccessStatus:
 		mc.executionCount++
-	} else {
+	case types.WarningStatus:
+		mc.warningExecutionCount++
+	default:
 		mc.failedExecutionCount++
 	}
 	mc.totalExecutionTime += executionTime
@@ -88,8 +182,7 @@ func (mc *MetricsCollector) RecordExecution(agentID string, executionTime time.D
 		AgentID:       agentID,
 		ExecutionTime: executionTime,
 		Status:        status,
-		StartTime:     time.Now(),
-		IsScheduled:   isScheduled,
+		StartTime:     now.Add(-executionTime),
 	}
 	
 	mc.executionHistory = append(mc.executionHistory, executionMetric)
@@ -107,16 +200,180 @@ func (mc *MetricsCollector) RecordExecution(agentID string, executionTime time.D
 	}
 	
 	agentMetric.TotalExecutions++
-	if status == types.SuccessStatus {
+	switch status {
+	case types.SuccessStatus:
 		agentMetric.SuccessfulExecutions++
-	} else {
+	case types.WarningStatus:
+		agentMetric.WarningExecutions++
+	default:
 		agentMetric.FailedExecutions++
+		failedAt := now
+		agentMetric.LastFailureTime = &failedAt
+	}
+	if resourceUsage != nil && resourceUsage.PeakMemoryMB > agentMetric.PeakMemoryMB {
+		agentMetric.PeakMemoryMB = resourceUsage.PeakMemoryMB
 	}
 	
 	// Update average execution time
 	totalTime := agentMetric.AvgExecutionTime*time.Duration(agentMetric.TotalExecutions-1) + executionTime
 	agentMetric.AvgExecutionTime = totalTime / time.Duration(agentMetric.TotalExecutions)
-	agentMetric.LastExecutionTime = time.Now()
+	agentMetric.LastExecutionTime = now
+
+	window, exists := mc.agentWindows[agentID]
+	if !exists {
+		window = newDurationWindow(mc.window, mc.windowSamples)
+		mc.agentWindows[agentID] = window
+	}
+	window.add(durationSample{at: now, duration: executionTime, success: status.Succeeded()})
+}
+
+// SetLabelAllowList sets the label keys that are tracked as metric dimensions
+func (mc *MetricsCollector) SetLabelAllowList(keys []string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.labelAllowList = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		mc.labelAllowList[key] = true
+	}
+}
+
+// RecordLabeledExecution records an execution against each of its allow-listed labels
+func (mc *MetricsCollector) RecordLabeledExecution(labels map[string]string, status types.ExecutionStatus) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	for key, value := range labels {
+		if !mc.labelAllowList[key] {
+			continue
+		}
+
+		id := key + "=" + value
+		metric, exists := mc.labelMetrics[id]
+		if !exists {
+			metric = &LabelMetric{Key: key, Value: value}
+			mc.labelMetrics[id] = metric
+		}
+
+		metric.TotalExecutions++
+		if !status.Succeeded() {
+			metric.FailedExecutions++
+		}
+	}
+}
+
+// GetLabelMetrics returns execution counts keyed by "key=value" for allow-listed labels
+func (mc *MetricsCollector) GetLabelMetrics() map[string]LabelMetric {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+
+	result := make(map[string]LabelMetric, len(mc.labelMetrics))
+	for id, metric := range mc.labelMetrics {
+		result[id] = *metric
+	}
+
+	return result
+}
+
+// RecordRateLimitRejection records a request rejected by rate limiting or the execution quota
+func (mc *MetricsCollector) RecordRateLimitRejection(clientID string, reason string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	metric, exists := mc.rateLimitMetrics[clientID]
+	if !exists {
+		metric = &RateLimitMetric{ClientID: clientID}
+		mc.rateLimitMetrics[clientID] = metric
+	}
+
+	if reason == RateLimitReasonConcurrency {
+		metric.ConcurrencyRejections++
+	} else {
+		metric.RateRejections++
+	}
+}
+
+// GetRateLimitMetrics returns rejection counts keyed by client ID
+func (mc *MetricsCollector) GetRateLimitMetrics() map[string]RateLimitMetric {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+
+	result := make(map[string]RateLimitMetric, len(mc.rateLimitMetrics))
+	for clientID, metric := range mc.rateLimitMetrics {
+		result[clientID] = *metric
+	}
+
+	return result
+}
+
+// RecordQueueAlert counts an execution queue alert fired for an agent
+func (mc *MetricsCollector) RecordQueueAlert(agentID string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.queueAlerts[agentID]++
+}
+
+// GetQueueAlertCounts returns the number of fired execution queue alerts keyed by agent ID
+func (mc *MetricsCollector) GetQueueAlertCounts() map[string]int64 {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+
+	result := make(map[string]int64, len(mc.queueAlerts))
+	for agentID, count := range mc.queueAlerts {
+		result[agentID] = count
+	}
+
+	return result
+}
+
+// RecordScheduleDrift adds how late a fire of a task's schedule ran to the task's drift histogram
+func (mc *MetricsCollector) RecordScheduleDrift(taskID string, drift time.Duration) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	histogram := mc.driftHistogram(taskID)
+	seconds := drift.Seconds()
+	for i, bound := range ScheduleDriftBuckets {
+		if seconds <= bound {
+			histogram.Buckets[i]++
+		}
+	}
+	histogram.SumSeconds += seconds
+	histogram.Count++
+}
+
+// RecordMissedFire counts a planned fire of a task's schedule that never happened
+func (mc *MetricsCollector) RecordMissedFire(taskID string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.driftHistogram(taskID).MissedFires++
+}
+
+// driftHistogram returns the drift histogram of a task, creating it; the caller holds the lock
+func (mc *MetricsCollector) driftHistogram(taskID string) *ScheduleDriftHistogram {
+	histogram, exists := mc.scheduleDrift[taskID]
+	if !exists {
+		histogram = &ScheduleDriftHistogram{Buckets: make([]int64, len(ScheduleDriftBuckets))}
+		mc.scheduleDrift[taskID] = histogram
+	}
+	return histogram
+}
+
+// GetScheduleDrift returns the drift histograms keyed by task ID
+func (mc *MetricsCollector) GetScheduleDrift() map[string]ScheduleDriftHistogram {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+
+	result := make(map[string]ScheduleDriftHistogram, len(mc.scheduleDrift))
+	for taskID, histogram := range mc.scheduleDrift {
+		histogramCopy := *histogram
+		histogramCopy.Buckets = append([]int64(nil), histogram.Buckets...)
+		result[taskID] = histogramCopy
+	}
+
+	return result
 }
 
 // RecordScheduledTask records metrics for a scheduled task
@@ -125,7 +382,7 @@ func (mc *MetricsCollector) RecordScheduledTask(status types.ExecutionStatus) {
 	defer mc.mutex.Unlock()
 	
 	mc.scheduledTaskCount++
-	if status == types.SuccessStatus {
+	if status.Succeeded() {
 		mc.successfulTaskCount++
 	} else {
 		mc.failedTaskCount++
@@ -143,25 +400,33 @@ func (mc *MetricsCollector) RecordA2ARequest(isError bool) {
 	}
 }
 
+// ExecutionCounts returns how many executions succeeded, succeeded with a warning and failed
+func (mc *MetricsCollector) ExecutionCounts() (succeeded, warned, failed int64) {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	return mc.executionCount, mc.warningExecutionCount, mc.failedExecutionCount
+}
+
 // GetExecutionMetrics returns overall execution metrics
 func (mc *MetricsCollector) GetExecutionMetrics() map[string]interface{} {
 	mc.mutex.RLock()
 	defer mc.mutex.RUnlock()
 	
-	totalExecutions := mc.executionCount + mc.failedExecutionCount
+	totalExecutions := mc.executionCount + mc.warningExecutionCount + mc.failedExecutionCount
 	successRate := 0.0
 	if totalExecutions > 0 {
-		successRate = float64(mc.executionCount) / float64(totalExecutions) * 100
+		successRate = float64(mc.executionCount+mc.warningExecutionCount) / float64(totalExecutions) * 100
 	}
 	
 	avgExecutionTime := time.Duration(0)
-	if mc.executionCount > 0 {
-		avgExecutionTime = time.Duration(int64(mc.totalExecutionTime) / mc.executionCount)
+	if totalExecutions > 0 {
+		avgExecutionTime = time.Duration(int64(mc.totalExecutionTime) / totalExecutions)
 	}
 	
 	return map[string]interface{}{
 		"total_executions":        totalExecutions,
 		"successful_executions":   mc.executionCount,
+		"warning_executions":      mc.warningExecutionCount,
 		"failed_executions":       mc.failedExecutionCount,
 		"success_rate_percentage": successRate,
 		"average_execution_time":  avgExecutionTime,
@@ -174,14 +439,28 @@ func (mc *MetricsCollector) GetAgentMetrics(agentID string) (*AgentMetric, bool)
 	mc.mutex.RLock()
 	defer mc.mutex.RUnlock()
 	
-	agentMetric, exists := mc.agentMetrics[agentID]
-	if !exists {
+	if _, exists := mc.agentMetrics[agentID]; !exists {
 		return nil, false
 	}
 	
-	// Make a copy to prevent race conditions
-	metricCopy := *agentMetric
-	return &metricCopy, true
+	return mc.agentMetricSnapshot(agentID, time.Now()), true
+}
+
+// RecentAverageDuration returns the mean duration of the agent's executions within the sliding
+// window, of all its executions when none is recent, and 0 when the agent never ran
+func (mc *MetricsCollector) RecentAverageDuration(agentID string) time.Duration {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+
+	if window, exists := mc.agentWindows[agentID]; exists {
+		if stats := window.stats(time.Now()); stats.executions > 0 {
+			return stats.mean
+		}
+	}
+	if metric, exists := mc.agentMetrics[agentID]; exists {
+		return metric.AvgExecutionTime
+	}
+	return 0
 }
 
 // GetAllAgentMetrics returns metrics for all agents
@@ -189,16 +468,42 @@ func (mc *MetricsCollector) GetAllAgentMetrics() map[string]*AgentMetric {
 	mc.mutex.RLock()
 	defer mc.mutex.RUnlock()
 	
-	// Make a copy to prevent race conditions
+	now := time.Now()
 	result := make(map[string]*AgentMetric)
-	for id, metric := range mc.agentMetrics {
-		metricCopy := *metric
-		result[id] = &metricCopy
+	for id := range mc.agentMetrics {
+		result[id] = mc.agentMetricSnapshot(id, now)
 	}
 	
 	return result
 }
 
+// agentMetricSnapshot copies an agent's metrics and fills in its rates and window statistics;
+// callers hold the mutex
+func (mc *MetricsCollector) agentMetricSnapshot(agentID string, now time.Time) *AgentMetric {
+	// Make a copy to prevent race conditions
+	metricCopy := *mc.agentMetrics[agentID]
+	if metricCopy.LastFailureTime != nil {
+		failedAt := *metricCopy.LastFailureTime
+		metricCopy.LastFailureTime = &failedAt
+	}
+	if metricCopy.TotalExecutions > 0 {
+		metricCopy.SuccessRate = float64(metricCopy.SuccessfulExecutions+metricCopy.WarningExecutions) / float64(metricCopy.TotalExecutions) * 100
+	}
+
+	if window, exists := mc.agentWindows[agentID]; exists {
+		stats := window.stats(now)
+		metricCopy.WindowExecutions = stats.executions
+		if stats.executions > 0 {
+			metricCopy.WindowSuccessRate = float64(stats.successes) / float64(stats.executions) * 100
+		}
+		metricCopy.P50ExecutionTime = stats.p50
+		metricCopy.P95ExecutionTime = stats.p95
+		metricCopy.P99ExecutionTime = stats.p99
+	}
+
+	return &metricCopy
+}
+
 // GetSchedulerMetrics returns scheduler-specific metrics
 func (mc *MetricsCollector) GetSchedulerMetrics() map[string]interface{} {
 	mc.mutex.RLock()
@@ -243,6 +548,10 @@ func (mc *MetricsCollector) GetOverallMetrics() map[string]interface{} {
 		"agent_metrics":     mc.GetAllAgentMetrics(),
 		"scheduler_metrics": mc.GetSchedulerMetrics(),
 		"a2a_metrics":       mc.GetA2AMetrics(),
+		"label_metrics":     mc.GetLabelMetrics(),
+		"rate_limit_metrics": mc.GetRateLimitMetrics(),
+		"queue_alerts":      mc.GetQueueAlertCounts(),
+		"schedule_drift":    mc.GetScheduleDrift(),
 	}
 }
 
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Defaults for the per-agent sliding window used for duration percentiles
+const (
+	DefaultMetricsWindow        = 15 * time.Minute
+	DefaultMetricsWindowSamples = 1024
+)
+
+// durationSample is one execution recorded in a durationWindow
+type durationSample struct {
+	at       time.Time
+	duration time.Duration
+	success  bool
+}
+
+// durationWindow keeps the most recent executions in a fixed-size ring buffer. Statistics only
+// consider samples younger than the window, so memory stays bounded however many executions run.
+type durationWindow struct {
+	samples []durationSample
+	next    int
+	count   int
+	window  time.Duration
+}
+
+// windowStats summarizes the samples of a durationWindow
+type windowStats struct {
+	executions int
+	successes  int
+	mean       time.Duration
+	p50        time.Duration
+	p95        time.Duration
+	p99        time.Duration
+}
+
+// newDurationWindow creates a durationWindow holding at most capacity samples
+func newDurationWindow(window time.Duration, capacity int) *durationWindow {
+	if capacity <= 0 {
+		capacity = DefaultMetricsWindowSamples
+	}
+	return &durationWindow{
+		samples: make([]durationSample, capacity),
+		window:  window,
+	}
+}
+
+// add records a sample, overwriting the oldest one when the buffer is full
+func (w *durationWindow) add(sample durationSample) {
+	w.samples[w.next] = sample
+	w.next = (w.next + 1) % len(w.samples)
+	if w.count < len(w.samples) {
+		w.count++
+	}
+}
+
+// stats returns the count, successes and nearest-rank duration percentiles of the samples
+// recorded within the window before now
+func (w *durationWindow) stats(now time.Time) windowStats {
+	var stats windowStats
+	durations := make([]time.Duration, 0, w.count)
+	var total time.Duration
+	for i := 0; i < w.count; i++ {
+		sample := w.samples[i]
+		if w.window > 0 && now.Sub(sample.at) > w.window {
+			continue
+		}
+		durations = append(durations, sample.duration)
+		total += sample.duration
+		if sample.success {
+			stats.successes++
+		}
+	}
+
+	stats.executions = len(durations)
+	if stats.executions == 0 {
+		return stats
+	}
+
+	stats.mean = total / time.Duration(stats.executions)
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.p50 = percentile(durations, 50)
+	stats.p95 = percentile(durations, 95)
+	stats.p99 = percentile(durations, 99)
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultConfirmationTTL is how long a confirmation token can be resent when the safety settings
+// set no time
+const DefaultConfirmationTTL = 5 * time.Minute
+
+// pendingConfirmation is a lifecycle operation waiting to be resent with its confirmation token
+type pendingConfirmation struct {
+	operation string // What the token confirms: action, target, agents and force
+	expiresAt time.Time
+}
+
+// OperationGuard applies the lifecycle safety settings to operations on several agents at once. It
+// hands out one-time confirmation tokens, kept in memory, for operations that match too many agents.
+type OperationGuard struct {
+	safety  models.LifecycleSafety
+	pending map[string]pendingConfirmation // By token
+	now     func() time.Time
+	mutex   sync.Mutex
+	logger  *zap.Logger
+}
+
+// NewOperationGuard creates an OperationGuard protecting no agent and confirming no operation
+func NewOperationGuard(logger *zap.Logger) *OperationGuard {
+	return &OperationGuard{
+		pending: make(map[string]pendingConfirmation),
+		now:     time.Now,
+		logger:  logger,
+	}
+}
+
+// SetSafety replaces the safety settings, keeping the current ones when the new ones are invalid
+func (og *OperationGuard) SetSafety(safety models.LifecycleSafety) error {
+	if err := safety.Validate(); err != nil {
+		return err
+	}
+
+	og.mutex.Lock()
+	defer og.mutex.Unlock()
+	og.safety = safety
+	return nil
+}
+
+// Check returns the agents a lifecycle operation on target may apply to and the protected agents
+// it leaves out, which force keeps in. total is the number of registered agents. When the agents
+// are too many, it fails with a ConfirmationRequiredError holding a new token unless confirmation
+// is an unexpired token issued for the same operation on the same agents, which it uses up.
+func (og *OperationGuard) Check(target string, action models.TaskAction, agentIDs []string, total int, force bool, confirmation string) ([]string, []string, error) {
+	og.mutex.Lock()
+	defer og.mutex.Unlock()
+
+	allowed, protected := og.filter(agentIDs, force)
+	reason := og.safety.ConfirmationReason(len(allowed), total)
+	if reason == "" {
+		return allowed, protected, nil
+	}
+
+	now := og.now()
+	for token, pending := range og.pending {
+		if !pending.expiresAt.After(now) {
+			delete(og.pending, token)
+		}
+	}
+	operation := strings.Join([]string{string(action), target, strconv.FormatBool(force), strings.Join(allowed, ",")}, "\x00")
+	if pending, exists := og.pending[confirmation]; exists && pending.operation == operation {
+		delete(og.pending, confirmation)
+		og.logger.Info("confirmed lifecycle operation on many agents",
+			zap.String("target", target),
+			zap.String("action", string(action)),
+			zap.Int("agents", len(allowed)))
+		return allowed, protected, nil
+	}
+
+	ttl := og.safety.ConfirmationTTL
+	if ttl <= 0 {
+		ttl = DefaultConfirmationTTL
+	}
+	token := newConfirmationToken()
+	og.pending[token] = pendingConfirmation{operation: operation, expiresAt: now.Add(ttl)}
+	og.logger.Info("lifecycle operation on many agents needs confirming",
+		zap.String("target", target),
+		zap.String("action", string(action)),
+		zap.Int("agents", len(allowed)),
+		zap.String("reason", reason))
+	return nil, nil, &models.ConfirmationRequiredError{
+		Target:    target,
+		Action:    action,
+		Agents:    allowed,
+		Reason:    reason,
+		Token:     token,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// Filter returns the agents a lifecycle operation may apply to and the protected agents it leaves
+// out, like Check does but without asking for confirmation, as dry runs need
+func (og *OperationGuard) Filter(agentIDs []string, force bool) ([]string, []string) {
+	og.mutex.Lock()
+	defer og.mutex.Unlock()
+	return og.filter(agentIDs, force)
+}
+
+// filter splits agentIDs into the allowed and the protected agents; the caller holds the mutex
+func (og *OperationGuard) filter(agentIDs []string, force bool) ([]string, []string) {
+	allowed := make([]string, 0, len(agentIDs))
+	var protected []string
+	for _, agentID := range agentIDs {
+		if !force && og.safety.Protects(agentID) {
+			protected = append(protected, agentID)
+			continue
+		}
+		allowed = append(allowed, agentID)
+	}
+	return allowed, protected
+}
+
+// newConfirmationToken returns a random confirmation token
+func newConfirmationToken() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
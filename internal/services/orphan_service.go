@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"go.uber.org/zap"
+)
+
+// DefaultOrphanWatchInterval is how often adopted orphans are checked for having exited
+const DefaultOrphanWatchInterval = 5 * time.Second
+
+// OrphanService finds the agent processes a previous supervisor left running, from the state files
+// of the process registry, and adopts, terminates or only reports them according to its policy.
+// Each orphan is logged and passed to the orphan hooks once handled, and again when an adopted
+// orphan exits.
+type OrphanService struct {
+	registry     *agents.ProcessRegistry
+	agentService IAgentService
+	policy       models.OrphanPolicy
+	interval     time.Duration
+	orphans      map[int]*models.OrphanProcess
+	hooks        []func(models.OrphanProcess)
+	stopWatching context.CancelFunc // Stops watching the orphans adopted by the last Recover
+	mutex        sync.Mutex
+	logger       *zap.Logger
+}
+
+// NewOrphanService creates an OrphanService over registry applying policy to the orphans it finds
+func NewOrphanService(registry *agents.ProcessRegistry, agentService IAgentService, policy models.OrphanPolicy, logger *zap.Logger) *OrphanService {
+	if policy == "" {
+		policy = models.OrphanPolicyAuto
+	}
+	return &OrphanService{
+		registry:     registry,
+		agentService: agentService,
+		policy:       policy,
+		interval:     DefaultOrphanWatchInterval,
+		orphans:      make(map[int]*models.OrphanProcess),
+		logger:       logger,
+	}
+}
+
+// SetWatchInterval sets how often adopted orphans are checked for having exited
+func (s *OrphanService) SetWatchInterval(interval time.Duration) {
+	if interval > 0 {
+		s.interval = interval
+	}
+}
+
+// AddOrphanHook registers a hook called with every orphan found and again whenever its status changes
+func (s *OrphanService) AddOrphanHook(hook func(models.OrphanProcess)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Recover scans the process registry at startup before any agent runs, and again whenever this
+// instance becomes the leader. State files of processes that exited, or whose PID now belongs to
+// another process, are removed; live processes are handled according to the policy. Adopted
+// orphans are watched until they exit, ctx is cancelled or they are released. Recover returns the
+// orphans found.
+func (s *OrphanService) Recover(ctx context.Context) ([]models.OrphanProcess, error) {
+	records, err := s.registry.Records()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, stopWatching := context.WithCancel(ctx)
+	s.mutex.Lock()
+	if s.stopWatching != nil {
+		s.stopWatching()
+	}
+	s.stopWatching = stopWatching
+	s.mutex.Unlock()
+
+	var found []models.OrphanProcess
+	for _, record := range records {
+		if !s.registry.Alive(record) {
+			s.logger.Debug("removing state of exited agent process",
+				zap.Int("pid", record.PID),
+				zap.String("agent_id", record.AgentID),
+				zap.String("execution_id", record.ExecutionID))
+			if err := s.registry.Untrack(record.PID); err != nil {
+				s.logger.Warn("failed to remove process state", zap.Int("pid", record.PID), zap.Error(err))
+			}
+			continue
+		}
+
+		var config *models.AgentConfiguration
+		if agent, err := s.agentService.GetAgent(record.AgentID); err == nil {
+			config = agent
+		}
+		orphan := &models.OrphanProcess{
+			ProcessRecord: record,
+			Status:        models.OrphanDetected,
+			DetectedAt:    time.Now(),
+		}
+		if config != nil {
+			orphan.AgentMode = string(config.Mode)
+		}
+		s.logger.Warn("found orphaned agent process",
+			zap.Int("pid", record.PID),
+			zap.String("agent_id", record.AgentID),
+			zap.String("execution_id", record.ExecutionID),
+			zap.Time("started_at", record.StartedAt),
+			zap.String("policy", string(s.policy)))
+
+		s.mutex.Lock()
+		s.orphans[record.PID] = orphan
+		s.mutex.Unlock()
+
+		switch s.action(config) {
+		case models.OrphanPolicyAdopt:
+			s.update(orphan, models.OrphanAdopted, "")
+			go s.watch(ctx, orphan)
+		case models.OrphanPolicyTerminate:
+			if err := s.registry.Terminate(record, config); err != nil {
+				s.update(orphan, models.OrphanFailed, err.Error())
+			} else {
+				s.update(orphan, models.OrphanTerminated, "")
+			}
+		default:
+			s.update(orphan, models.OrphanDetected, "")
+		}
+
+		s.mutex.Lock()
+		found = append(found, *orphan)
+		s.mutex.Unlock()
+	}
+	return found, nil
+}
+
+// Release stops watching the adopted orphans and forgets them, leaving them running with their state
+// files in place; the supervisor instance taking over leadership adopts them again when it recovers
+// orphans from the shared process registry. Release returns how many orphans it released.
+func (s *OrphanService) Release() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopWatching != nil {
+		s.stopWatching()
+		s.stopWatching = nil
+	}
+	released := 0
+	for pid, orphan := range s.orphans {
+		if orphan.Status == models.OrphanAdopted {
+			delete(s.orphans, pid)
+			released++
+		}
+	}
+	if released > 0 {
+		s.logger.Info("released adopted orphan processes", zap.Int("processes", released))
+	}
+	return released
+}
+
+// List returns the orphans that have not been handled, or every orphan found when all is set,
+// ordered by PID
+func (s *OrphanService) List(all bool) []models.OrphanProcess {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	orphans := make([]models.OrphanProcess, 0, len(s.orphans))
+	for _, orphan := range s.orphans {
+		if all || !orphan.Status.Handled() {
+			orphans = append(orphans, *orphan)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].PID < orphans[j].PID })
+	return orphans
+}
+
+// action returns what the policy does with an orphan of an agent; auto adopts interactive agents,
+// which are meant to keep running, and terminates task executions and agents no longer registered
+func (s *OrphanService) action(config *models.AgentConfiguration) models.OrphanPolicy {
+	if s.policy != models.OrphanPolicyAuto {
+		return s.policy
+	}
+	if config != nil && config.Mode == types.InteractiveMode {
+		return models.OrphanPolicyAdopt
+	}
+	return models.OrphanPolicyTerminate
+}
+
+// watch checks an adopted orphan every interval and forgets it once it has exited
+func (s *OrphanService) watch(ctx context.Context, orphan *models.OrphanProcess) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.registry.Alive(orphan.ProcessRecord) {
+				continue
+			}
+			if err := s.registry.Untrack(orphan.PID); err != nil {
+				s.logger.Warn("failed to remove process state", zap.Int("pid", orphan.PID), zap.Error(err))
+			}
+			s.update(orphan, models.OrphanExited, "")
+			return
+		}
+	}
+}
+
+// update records the new status of an orphan, logs it and passes it to the orphan hooks
+func (s *OrphanService) update(orphan *models.OrphanProcess, status models.OrphanStatus, message string) {
+	s.mutex.Lock()
+	orphan.Status = status
+	orphan.Error = message
+	if status.Handled() {
+		now := time.Now()
+		orphan.HandledAt = &now
+	}
+	snapshot := *orphan
+	hooks := append([]func(models.OrphanProcess){}, s.hooks...)
+	s.mutex.Unlock()
+
+	fields := []zap.Field{
+		zap.Int("pid", snapshot.PID),
+		zap.String("agent_id", snapshot.AgentID),
+		zap.String("execution_id", snapshot.ExecutionID),
+		zap.String("status", string(status)),
+	}
+	switch status {
+	case models.OrphanFailed:
+		s.logger.Error("failed to terminate orphaned agent process", append(fields, zap.String("error", message))...)
+	case models.OrphanDetected:
+		s.logger.Warn("orphaned agent process left running", fields...)
+	default:
+		s.logger.Info("orphaned agent process handled", fields...)
+	}
+	for _, hook := range hooks {
+		hook(snapshot)
+	}
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"go.uber.org/zap"
+)
+
+// Labels added to the agent executions started by a pipeline
+const (
+	PipelineIDLabel          = "pipeline_id"
+	PipelineExecutionIDLabel = "pipeline_execution_id"
+)
+
+// maxPipelineExecutions caps how many runs of each pipeline are kept
+const maxPipelineExecutions = 100
+
+// IPipelineService interface for managing and running pipelines
+type IPipelineService interface {
+	// CreatePipeline stores a new pipeline
+	CreatePipeline(pipeline *models.Pipeline) error
+
+	// UpdatePipeline replaces the steps and description of an existing pipeline
+	UpdatePipeline(pipeline *models.Pipeline) error
+
+	// DeletePipeline removes a pipeline and its recorded runs
+	DeletePipeline(pipelineID string) error
+
+	// GetPipeline returns a pipeline by its ID
+	GetPipeline(pipelineID string) (*models.Pipeline, error)
+
+	// ListPipelines returns all pipelines, ordered by ID
+	ListPipelines() ([]*models.Pipeline, error)
+
+	// ExecutePipeline runs the pipeline's steps in order and waits for it to finish
+	ExecutePipeline(ctx context.Context, pipelineID, input string, labels map[string]string) (*models.PipelineExecution, error)
+
+	// GetPipelineExecution returns a run of a pipeline by its ID
+	GetPipelineExecution(executionID string) (*models.PipelineExecution, error)
+
+	// ListPipelineExecutions returns the recorded runs of a pipeline, oldest first
+	ListPipelineExecutions(pipelineID string) ([]*models.PipelineExecution, error)
+}
+
+// PipelineService implements IPipelineService, running each step through the execution coordinator
+type PipelineService struct {
+	agentService IAgentService
+	coordinator  *ExecutionCoordinator
+	logger       *zap.Logger
+
+	mutex      sync.RWMutex
+	pipelines  map[string]*models.Pipeline
+	executions map[string]*models.PipelineExecution
+	runs       map[string][]string // Execution IDs of each pipeline, oldest first
+}
+
+// NewPipelineService creates a new instance of PipelineService
+func NewPipelineService(agentService IAgentService, coordinator *ExecutionCoordinator, logger *zap.Logger) *PipelineService {
+	return &PipelineService{
+		agentService: agentService,
+		coordinator:  coordinator,
+		logger:       logger,
+		pipelines:    make(map[string]*models.Pipeline),
+		executions:   make(map[string]*models.PipelineExecution),
+		runs:         make(map[string][]string),
+	}
+}
+
+// CreatePipeline stores a new pipeline
+func (ps *PipelineService) CreatePipeline(pipeline *models.Pipeline) error {
+	if err := ps.validatePipeline(pipeline); err != nil {
+		return err
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if _, exists := ps.pipelines[pipeline.ID]; exists {
+		return models.NewKindError(models.ErrPipelineConflict, "pipeline with ID %s already exists", pipeline.ID)
+	}
+
+	pipeline.CreatedAt = time.Now()
+	pipeline.UpdatedAt = pipeline.CreatedAt
+	ps.pipelines[pipeline.ID] = pipeline
+
+	ps.logger.Info("pipeline created",
+		zap.String("pipeline_id", pipeline.ID),
+		zap.Int("steps", len(pipeline.Steps)))
+
+	return nil
+}
+
+// UpdatePipeline replaces the steps and description of an existing pipeline; runs in progress
+// keep the steps they started with
+func (ps *PipelineService) UpdatePipeline(pipeline *models.Pipeline) error {
+	if err := ps.validatePipeline(pipeline); err != nil {
+		return err
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	existing, exists := ps.pipelines[pipeline.ID]
+	if !exists {
+		return models.NewKindError(models.ErrPipelineNotFound, "pipeline with ID %s not found", pipeline.ID)
+	}
+
+	pipeline.CreatedAt = existing.CreatedAt
+	pipeline.UpdatedAt = time.Now()
+	ps.pipelines[pipeline.ID] = pipeline
+
+	ps.logger.Info("pipeline updated",
+		zap.String("pipeline_id", pipeline.ID),
+		zap.Int("steps", len(pipeline.Steps)))
+
+	return nil
+}
+
+// DeletePipeline removes a pipeline and its recorded runs
+func (ps *PipelineService) DeletePipeline(pipelineID string) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if _, exists := ps.pipelines[pipelineID]; !exists {
+		return models.NewKindError(models.ErrPipelineNotFound, "pipeline with ID %s not found", pipelineID)
+	}
+
+	delete(ps.pipelines, pipelineID)
+	for _, executionID := range ps.runs[pipelineID] {
+		delete(ps.executions, executionID)
+	}
+	delete(ps.runs, pipelineID)
+
+	ps.logger.Info("pipeline deleted", zap.String("pipeline_id", pipelineID))
+	return nil
+}
+
+// GetPipeline returns a pipeline by its ID
+func (ps *PipelineService) GetPipeline(pipelineID string) (*models.Pipeline, error) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	pipeline, exists := ps.pipelines[pipelineID]
+	if !exists {
+		return nil, models.NewKindError(models.ErrPipelineNotFound, "pipeline with ID %s not found", pipelineID)
+	}
+	return pipeline, nil
+}
+
+// ListPipelines returns all pipelines, ordered by ID
+func (ps *PipelineService) ListPipelines() ([]*models.Pipeline, error) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	pipelines := make([]*models.Pipeline, 0, len(ps.pipelines))
+	for _, pipeline := range ps.pipelines {
+		pipelines = append(pipelines, pipeline)
+	}
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].ID < pipelines[j].ID })
+	return pipelines, nil
+}
+
+// ExecutePipeline runs the pipeline's steps in order and waits for it to finish. A failed step
+// aborts the run and skips the remaining steps unless it is marked continue_on_error. The returned
+// error is only set when the run could not start; failed runs are reported in the execution.
+func (ps *PipelineService) ExecutePipeline(ctx context.Context, pipelineID, input string, labels map[string]string) (*models.PipelineExecution, error) {
+	pipeline, err := ps.GetPipeline(pipelineID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step executions inherit the trigger through ctx
+	trigger := ExecutionTriggerFromContext(ctx)
+	execution := &models.PipelineExecution{
+		ID:           generatePipelineExecutionID(),
+		PipelineID:   pipeline.ID,
+		State:        types.RunningState,
+		Input:        input,
+		Steps:        make([]models.PipelineStepResult, len(pipeline.Steps)),
+		ExecutionIDs: []string{},
+		Labels:       labels,
+		TriggerType:  trigger.Type,
+		TriggeredBy:  trigger.By,
+		StartTime:    time.Now(),
+	}
+
+	// Steps carry the caller's labels along with the run they belong to
+	stepLabels := models.MergeLabels(labels, map[string]string{
+		PipelineIDLabel:          pipeline.ID,
+		PipelineExecutionIDLabel: execution.ID,
+	})
+	if err := models.ValidateLabels(stepLabels); err != nil {
+		return nil, err
+	}
+
+	for i := range pipeline.Steps {
+		execution.Steps[i] = models.PipelineStepResult{
+			Name:    pipeline.Steps[i].StepName(i),
+			AgentID: pipeline.Steps[i].AgentID,
+			Status:  types.SkippedStatus,
+		}
+	}
+	ps.recordExecution(execution)
+
+	ps.logger.Info("executing pipeline",
+		zap.String("pipeline_id", pipeline.ID),
+		zap.String("pipeline_execution_id", execution.ID))
+
+	previousOutput := input
+	var failure string
+	for i, step := range pipeline.Steps {
+		if ctx.Err() != nil {
+			failure = fmt.Sprintf("pipeline stopped before step %s: %v", execution.Steps[i].Name, ctx.Err())
+			break
+		}
+
+		result := ps.runStep(ctx, step, stepInput(step, previousOutput, input), stepLabels)
+		result.Name = execution.Steps[i].Name
+
+		ps.mutex.Lock()
+		execution.Steps[i] = result
+		if result.ExecutionID != "" {
+			execution.ExecutionIDs = append(execution.ExecutionIDs, result.ExecutionID)
+		}
+		ps.mutex.Unlock()
+
+		if result.Status.Succeeded() {
+			previousOutput = result.Output
+			continue
+		}
+
+		ps.logger.Warn("pipeline step failed",
+			zap.String("pipeline_id", pipeline.ID),
+			zap.String("pipeline_execution_id", execution.ID),
+			zap.String("step", result.Name),
+			zap.Bool("continue_on_error", step.ContinueOnError),
+			zap.String("error", result.Error))
+
+		if !step.ContinueOnError {
+			failure = fmt.Sprintf("step %s failed: %s", result.Name, result.Error)
+			break
+		}
+	}
+
+	ps.mutex.Lock()
+	now := time.Now()
+	execution.EndTime = &now
+	execution.Output = previousOutput
+	execution.State = types.CompletedState
+	if failure != "" {
+		execution.State = types.FailedState
+		execution.Error = failure
+	}
+	snapshot := snapshotPipelineExecution(execution)
+	ps.mutex.Unlock()
+
+	ps.logger.Info("pipeline execution finished",
+		zap.String("pipeline_id", pipeline.ID),
+		zap.String("pipeline_execution_id", execution.ID),
+		zap.String("state", string(snapshot.State)))
+
+	return snapshot, nil
+}
+
+// runStep executes a single step and returns its outcome
+func (ps *PipelineService) runStep(ctx context.Context, step models.PipelineStep, input string, labels map[string]string) models.PipelineStepResult {
+	result := models.PipelineStepResult{AgentID: step.AgentID, Status: types.FailureStatus}
+	started := time.Now()
+	defer func() { result.ExecutionTimeMs = time.Since(started).Milliseconds() }()
+
+	execution, _, err := ps.coordinator.Execute(ctx, ExecutionRequest{
+		AgentID:    step.AgentID,
+		Input:      input,
+		Parameters: step.Parameters,
+		Labels:     labels,
+	})
+	if execution == nil {
+		// The step was rejected before its agent ran, e.g. because the agent is disabled
+		result.Error = err.Error()
+		return result
+	}
+	result.ExecutionID = execution.ID
+
+	executionResult, resultErr := ps.coordinator.ExecutionService().GetExecutionResult(execution.ID)
+	if resultErr == nil {
+		result.Output = executionResult.Output
+		result.Error = executionResult.Error
+		if executionResult.Status != "" {
+			result.Status = executionResult.Status
+		}
+	}
+	if err != nil {
+		if result.Status.Succeeded() {
+			result.Status = types.FailureStatus
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// GetPipelineExecution returns a run of a pipeline by its ID
+func (ps *PipelineService) GetPipelineExecution(executionID string) (*models.PipelineExecution, error) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	execution, exists := ps.executions[executionID]
+	if !exists {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "pipeline execution %s not found", executionID)
+	}
+	return snapshotPipelineExecution(execution), nil
+}
+
+// ListPipelineExecutions returns the recorded runs of a pipeline, oldest first
+func (ps *PipelineService) ListPipelineExecutions(pipelineID string) ([]*models.PipelineExecution, error) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if _, exists := ps.pipelines[pipelineID]; !exists {
+		return nil, models.NewKindError(models.ErrPipelineNotFound, "pipeline with ID %s not found", pipelineID)
+	}
+
+	executions := make([]*models.PipelineExecution, 0, len(ps.runs[pipelineID]))
+	for _, executionID := range ps.runs[pipelineID] {
+		executions = append(executions, snapshotPipelineExecution(ps.executions[executionID]))
+	}
+	return executions, nil
+}
+
+// recordExecution stores a new run, dropping the pipeline's oldest runs beyond the cap
+func (ps *PipelineService) recordExecution(execution *models.PipelineExecution) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.executions[execution.ID] = execution
+	runs := append(ps.runs[execution.PipelineID], execution.ID)
+	for len(runs) > maxPipelineExecutions {
+		delete(ps.executions, runs[0])
+		runs = runs[1:]
+	}
+	ps.runs[execution.PipelineID] = runs
+}
+
+// validatePipeline checks the pipeline's fields and that its steps reference known agents with
+// parameters the agents can be passed
+func (ps *PipelineService) validatePipeline(pipeline *models.Pipeline) error {
+	if err := pipeline.Validate(); err != nil {
+		return err
+	}
+
+	for i, step := range pipeline.Steps {
+		name := step.StepName(i)
+		if _, err := ps.agentService.GetAgent(step.AgentID); err != nil {
+			return models.ValidationError(fmt.Sprintf("pipeline step %s references agent %s which does not exist", name, step.AgentID))
+		}
+		if _, err := parameterArgs(step.Parameters); err != nil {
+			return models.ValidationError(fmt.Sprintf("pipeline step %s: %v", name, err))
+		}
+	}
+	return nil
+}
+
+// stepInput builds a step's input from its input mapping, the previous output and the pipeline input
+func stepInput(step models.PipelineStep, previousOutput, pipelineInput string) string {
+	if step.InputMapping == "" {
+		return previousOutput
+	}
+	return strings.NewReplacer(
+		models.PipelineOutputPlaceholder, previousOutput,
+		models.PipelineInputPlaceholder, pipelineInput,
+	).Replace(step.InputMapping)
+}
+
+// snapshotPipelineExecution copies a run so callers can read it while it is still being updated
+func snapshotPipelineExecution(execution *models.PipelineExecution) *models.PipelineExecution {
+	snapshot := *execution
+	snapshot.Steps = append([]models.PipelineStepResult(nil), execution.Steps...)
+	snapshot.ExecutionIDs = append([]string{}, execution.ExecutionIDs...)
+	return &snapshot
+}
+
+// generatePipelineExecutionID returns a new pipeline execution ID
+func generatePipelineExecutionID() string {
+	return fmt.Sprintf("pipeline-exec-%s-%d", time.Now().Format("20060102-150405"), time.Now().Nanosecond())
+}
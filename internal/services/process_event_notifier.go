@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// ProcessEventNotifier POSTs the events of persistent agents entering the fatal state to a webhook,
+// retrying transient failures like push notifications
+type ProcessEventNotifier struct {
+	url          string
+	token        string
+	client       *http.Client
+	maxAttempts  int
+	retryBackoff time.Duration
+	faults       *FaultInjector
+	standby      atomic.Bool
+	logger       *zap.Logger
+}
+
+// NewProcessEventNotifier creates a ProcessEventNotifier delivering to url, sending token as a bearer
+// token when set
+func NewProcessEventNotifier(url, token string, logger *zap.Logger) *ProcessEventNotifier {
+	return &ProcessEventNotifier{
+		url:          url,
+		token:        token,
+		client:       &http.Client{Timeout: DefaultPushNotificationTimeout},
+		maxAttempts:  DefaultPushNotificationMaxAttempts,
+		retryBackoff: DefaultPushNotificationRetryBackoff,
+		logger:       logger,
+	}
+}
+
+// SetRetryPolicy sets how many times delivery is attempted and the delay before the first retry,
+// which doubles on every further retry
+func (n *ProcessEventNotifier) SetRetryPolicy(maxAttempts int, backoff time.Duration) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	n.maxAttempts = maxAttempts
+	n.retryBackoff = backoff
+}
+
+// SetFaultInjector sets the fault injection rules applied to webhook requests; nil disables them
+func (n *ProcessEventNotifier) SetFaultInjector(faults *FaultInjector) {
+	n.faults = faults
+}
+
+// SetStandby sets whether events are dropped because another supervisor instance leads and
+// delivers webhooks
+func (n *ProcessEventNotifier) SetStandby(standby bool) {
+	n.standby.Store(standby)
+}
+
+// Notify delivers the event when it reports the fatal state and ignores it otherwise. It blocks
+// until delivery succeeds or every attempt failed.
+func (n *ProcessEventNotifier) Notify(event models.ProcessStateEvent) {
+	if event.Status.State != models.ProcessFatal || n.standby.Load() {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Warn("failed to encode process event", zap.String("agent_id", event.AgentID), zap.Error(err))
+		return
+	}
+
+	backoff := n.retryBackoff
+	attempts := 0
+	for attempts < n.maxAttempts {
+		if attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		attempts++
+
+		statusCode, postErr := n.post(event.AgentID, body)
+		if postErr == nil && statusCode >= 200 && statusCode < 300 {
+			n.logger.Info("process event delivered",
+				zap.String("agent_id", event.AgentID),
+				zap.Int("attempts", attempts))
+			return
+		}
+		err = postErr
+		if err == nil {
+			err = fmt.Errorf("webhook returned status %d", statusCode)
+			if !retryableStatus(statusCode) {
+				break
+			}
+		}
+	}
+
+	n.logger.Warn("process event delivery failed",
+		zap.String("agent_id", event.AgentID),
+		zap.String("url", n.url),
+		zap.Int("attempts", attempts),
+		zap.Error(err))
+}
+
+// post sends one event about the agent and returns the webhook's status code
+func (n *ProcessEventNotifier) post(agentID string, body []byte) (int, error) {
+	if err := n.faults.Inject(context.Background(), models.FaultPointWebhookSend, agentID); err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		request.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.StatusCode, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// readProcessStats reads the supervisor's resource usage from /proc/self and getrusage
+func readProcessStats() (processStats, bool) {
+	var stats processStats
+
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return stats, false
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return stats, false
+	}
+	pageSize := uint64(os.Getpagesize())
+	virtualPages, _ := strconv.ParseUint(fields[0], 10, 64)
+	residentPages, _ := strconv.ParseUint(fields[1], 10, 64)
+	stats.virtualBytes = virtualPages * pageSize
+	stats.residentBytes = residentPages * pageSize
+
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		stats.openFDs = len(fds)
+	}
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err == nil {
+		stats.cpuSeconds = float64(usage.Utime.Sec+usage.Stime.Sec) +
+			float64(usage.Utime.Usec+usage.Stime.Usec)/1e6
+	}
+
+	return stats, true
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package services
+
+// readProcessStats reports no resource usage: it is only read from /proc on Linux
+func readProcessStats() (processStats, bool) {
+	return processStats{}, false
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// processStats is the resource usage of the supervisor process
+type processStats struct {
+	cpuSeconds    float64
+	residentBytes uint64
+	virtualBytes  uint64
+	openFDs       int
+}
+
+// processStartTime approximates when the process started with when this package was initialized
+var processStartTime = time.Now()
+
+// prometheusLabelEscaper escapes label values for the text exposition format
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusWriter writes metrics in the text exposition format and keeps the first write error
+type prometheusWriter struct {
+	w   io.Writer
+	err error
+}
+
+// metric writes a metric family with a single sample; labels are name, value pairs
+func (pw *prometheusWriter) metric(name, kind, help string, value float64, labels ...string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	pw.sample(name, value, labels...)
+}
+
+// sample writes one sample of the current metric family
+func (pw *prometheusWriter) sample(name string, value float64, labels ...string) {
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], prometheusLabelEscaper.Replace(labels[i+1])))
+		}
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	pw.printf("%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// printf writes unless an earlier write failed
+func (pw *prometheusWriter) printf(format string, args ...interface{}) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, args...)
+	}
+}
+
+// WritePrometheusMetrics writes the supervisor's metrics in the Prometheus text exposition format,
+// followed by the Go runtime and process metrics of the standard Prometheus collectors
+func (sm *ServerMonitor) WritePrometheusMetrics(w io.Writer) error {
+	pw := &prometheusWriter{w: w}
+	info := sm.Info()
+
+	pw.metric("supervisor_build_info", "gauge", "Build of the running supervisor.", 1,
+		"version", info.Version, "commit", info.Commit, "goversion", info.GoVersion)
+	pw.metric("supervisor_uptime_seconds", "gauge", "Seconds since the supervisor started.", info.UptimeSeconds)
+	pw.metric("supervisor_agents", "gauge", "Registered agents.", float64(info.Agents))
+	pw.metric("supervisor_scheduled_tasks", "gauge", "Scheduled tasks, paused or not.", float64(info.Scheduler.Tasks))
+	pw.metric("supervisor_active_executions", "gauge", "Executions in progress.", float64(info.ActiveExecutions))
+	pw.metric("supervisor_queued_executions", "gauge", "Executions waiting to start.", float64(info.QueuedExecutions))
+	pw.metric("supervisor_scheduler_running", "gauge", "Whether the scheduler fires tasks.", boolGauge(info.Scheduler.Running))
+	if sm.collector != nil {
+		succeeded, warned, failed := sm.collector.ExecutionCounts()
+		pw.printf("# HELP supervisor_executions_total Finished executions by outcome.\n# TYPE supervisor_executions_total counter\n")
+		pw.sample("supervisor_executions_total", float64(succeeded), "status", "succeeded")
+		pw.sample("supervisor_executions_total", float64(warned), "status", "warning")
+		pw.sample("supervisor_executions_total", float64(failed), "status", "failed")
+
+		alerts := sm.collector.GetQueueAlertCounts()
+		pw.printf("# HELP supervisor_queue_alerts_total Execution queue alerts fired by agent.\n# TYPE supervisor_queue_alerts_total counter\n")
+		for _, agentID := range sortedKeys(alerts) {
+			pw.sample("supervisor_queue_alerts_total", float64(alerts[agentID]), "agent_id", agentID)
+		}
+
+		drift := sm.collector.GetScheduleDrift()
+		pw.printf("# HELP supervisor_schedule_drift_seconds How late the scheduler fired each task after its planned time.\n# TYPE supervisor_schedule_drift_seconds histogram\n")
+		for _, taskID := range sortedKeys(drift) {
+			histogram := drift[taskID]
+			for i, bound := range ScheduleDriftBuckets {
+				pw.sample("supervisor_schedule_drift_seconds_bucket", float64(histogram.Buckets[i]), "task_id", taskID, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+			}
+			pw.sample("supervisor_schedule_drift_seconds_bucket", float64(histogram.Count), "task_id", taskID, "le", "+Inf")
+			pw.sample("supervisor_schedule_drift_seconds_sum", histogram.SumSeconds, "task_id", taskID)
+			pw.sample("supervisor_schedule_drift_seconds_count", float64(histogram.Count), "task_id", taskID)
+		}
+		pw.printf("# HELP supervisor_schedule_missed_fires_total Planned fires of each task's schedule that did not happen in time.\n# TYPE supervisor_schedule_missed_fires_total counter\n")
+		for _, taskID := range sortedKeys(drift) {
+			pw.sample("supervisor_schedule_missed_fires_total", float64(drift[taskID].MissedFires), "task_id", taskID)
+		}
+	}
+
+	if sm.events != nil {
+		stats := sm.events.Stats()
+		pw.metric("supervisor_events_published_total", "counter", "Events published on the event bus.", float64(stats.Published))
+		subscriberTypes := sortedKeys(stats.SubscriberTypes)
+		pw.printf("# HELP supervisor_event_subscribers Event bus subscribers by subscriber type.\n# TYPE supervisor_event_subscribers gauge\n")
+		for _, subscriberType := range subscriberTypes {
+			pw.sample("supervisor_event_subscribers", float64(stats.SubscriberTypes[subscriberType].Subscribers), "subscriber_type", subscriberType)
+		}
+		pw.printf("# HELP supervisor_events_delivered_total Events read by event bus subscribers by subscriber type.\n# TYPE supervisor_events_delivered_total counter\n")
+		for _, subscriberType := range subscriberTypes {
+			pw.sample("supervisor_events_delivered_total", float64(stats.SubscriberTypes[subscriberType].Delivered), "subscriber_type", subscriberType)
+		}
+		pw.printf("# HELP supervisor_events_dropped_total Events dropped for lagging event bus subscribers by subscriber type.\n# TYPE supervisor_events_dropped_total counter\n")
+		for _, subscriberType := range subscriberTypes {
+			pw.sample("supervisor_events_dropped_total", float64(stats.SubscriberTypes[subscriberType].Dropped), "subscriber_type", subscriberType)
+		}
+	}
+
+	writeGoMetrics(pw)
+	writeProcessMetrics(pw)
+	return pw.err
+}
+
+// writeGoMetrics writes the metrics of Prometheus' Go collector
+func writeGoMetrics(pw *prometheusWriter) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	pw.metric("go_info", "gauge", "Information about the Go environment.", 1, "version", runtime.Version())
+	pw.metric("go_goroutines", "gauge", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	pw.metric("go_threads", "gauge", "Number of OS threads created.", float64(pprof.Lookup("threadcreate").Count()))
+
+	pw.printf("# HELP go_gc_duration_seconds A summary of the pause duration of garbage collection cycles.\n# TYPE go_gc_duration_seconds summary\n")
+	pw.sample("go_gc_duration_seconds_sum", time.Duration(memory.PauseTotalNs).Seconds())
+	pw.sample("go_gc_duration_seconds_count", float64(memory.NumGC))
+
+	pw.metric("go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.", float64(memory.Alloc))
+	pw.metric("go_memstats_alloc_bytes_total", "counter", "Total number of bytes allocated, even if freed.", float64(memory.TotalAlloc))
+	pw.metric("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.", float64(memory.Sys))
+	pw.metric("go_memstats_mallocs_total", "counter", "Total number of mallocs.", float64(memory.Mallocs))
+	pw.metric("go_memstats_frees_total", "counter", "Total number of frees.", float64(memory.Frees))
+	pw.metric("go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.", float64(memory.HeapAlloc))
+	pw.metric("go_memstats_heap_sys_bytes", "gauge", "Number of heap bytes obtained from system.", float64(memory.HeapSys))
+	pw.metric("go_memstats_heap_idle_bytes", "gauge", "Number of heap bytes waiting to be used.", float64(memory.HeapIdle))
+	pw.metric("go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.", float64(memory.HeapInuse))
+	pw.metric("go_memstats_heap_released_bytes", "gauge", "Number of heap bytes released to OS.", float64(memory.HeapReleased))
+	pw.metric("go_memstats_heap_objects", "gauge", "Number of allocated objects.", float64(memory.HeapObjects))
+	pw.metric("go_memstats_stack_inuse_bytes", "gauge", "Number of bytes in use by the stack allocator.", float64(memory.StackInuse))
+	pw.metric("go_memstats_next_gc_bytes", "gauge", "Number of heap bytes when next garbage collection will take place.", float64(memory.NextGC))
+	pw.metric("go_memstats_last_gc_time_seconds", "gauge", "Number of seconds since 1970 of last garbage collection.", float64(memory.LastGC)/1e9)
+}
+
+// writeProcessMetrics writes the metrics of Prometheus' process collector; resource usage is only
+// available on Linux
+func writeProcessMetrics(pw *prometheusWriter) {
+	pw.metric("process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.",
+		float64(processStartTime.UnixNano())/1e9)
+
+	stats, ok := readProcessStats()
+	if !ok {
+		return
+	}
+	pw.metric("process_cpu_seconds_total", "counter", "Total user and system CPU time spent in seconds.", stats.cpuSeconds)
+	pw.metric("process_resident_memory_bytes", "gauge", "Resident memory size in bytes.", float64(stats.residentBytes))
+	pw.metric("process_virtual_memory_bytes", "gauge", "Virtual memory size in bytes.", float64(stats.virtualBytes))
+	pw.metric("process_open_fds", "gauge", "Number of open file descriptors.", float64(stats.openFDs))
+}
+
+// boolGauge returns 1 for true and 0 for false
+func boolGauge(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
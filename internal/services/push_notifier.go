@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// Defaults for delivering push notifications
+const (
+	DefaultPushNotificationMaxAttempts  = 5
+	DefaultPushNotificationRetryBackoff = time.Second
+	DefaultPushNotificationTimeout      = 10 * time.Second
+)
+
+// PushNotifier delivers A2A push notifications: once a task with a registered callback finishes, the
+// final task is POSTed to the callback URL, retrying transient failures
+type PushNotifier struct {
+	executionService *ExecutionService
+	logger           *zap.Logger
+	client           *http.Client
+	allowInsecure    bool
+	maxAttempts      int
+	retryBackoff     time.Duration
+	events           *EventBus
+	standby          atomic.Bool
+}
+
+// NewPushNotifier creates a PushNotifier that delivers notifications for executions of executionService
+func NewPushNotifier(executionService *ExecutionService, logger *zap.Logger) *PushNotifier {
+	notifier := &PushNotifier{
+		executionService: executionService,
+		logger:           logger,
+		client:           &http.Client{Timeout: DefaultPushNotificationTimeout},
+		maxAttempts:      DefaultPushNotificationMaxAttempts,
+		retryBackoff:     DefaultPushNotificationRetryBackoff,
+	}
+	executionService.AddCompletionHook(func(execution *models.AgentExecution) {
+		go notifier.deliver(execution.ID)
+	})
+	return notifier
+}
+
+// SetEventBus sets the bus the outcome of each delivery is published on
+func (pn *PushNotifier) SetEventBus(bus *EventBus) {
+	pn.events = bus
+}
+
+// SetStandby sets whether deliveries are skipped because another supervisor instance leads and
+// delivers webhooks
+func (pn *PushNotifier) SetStandby(standby bool) {
+	pn.standby.Store(standby)
+}
+
+// SetHTTPClient sets the client used to call callback URLs
+func (pn *PushNotifier) SetHTTPClient(client *http.Client) {
+	pn.client = client
+}
+
+// SetAllowInsecureURLs sets whether plain HTTP callback URLs are accepted
+func (pn *PushNotifier) SetAllowInsecureURLs(allow bool) {
+	pn.allowInsecure = allow
+}
+
+// SetRetryPolicy sets how many times delivery is attempted and the delay before the first retry,
+// which doubles on every further retry
+func (pn *PushNotifier) SetRetryPolicy(maxAttempts int, backoff time.Duration) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	pn.maxAttempts = maxAttempts
+	pn.retryBackoff = backoff
+}
+
+// SetTaskPushNotification registers a callback on the task; a task that already finished is delivered
+// right away
+func (pn *PushNotifier) SetTaskPushNotification(taskID string, config models.PushNotificationConfig) (*models.PushNotificationConfig, error) {
+	if err := models.ValidatePushNotificationURL(config.URL, pn.allowInsecure); err != nil {
+		return nil, err
+	}
+
+	registration := &models.PushNotificationConfig{URL: config.URL, Token: config.Token}
+	finished, err := pn.executionService.SetPushNotification(taskID, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	pn.logger.Info("push notification registered",
+		zap.String("execution_id", taskID),
+		zap.String("url", config.URL))
+
+	if finished {
+		go pn.deliver(taskID)
+	}
+	return pn.executionService.GetPushNotification(taskID)
+}
+
+// GetTaskPushNotification returns the callback registered on the task with its delivery status, or
+// nil when there is none
+func (pn *PushNotifier) GetTaskPushNotification(taskID string) (*models.PushNotificationConfig, error) {
+	return pn.executionService.GetPushNotification(taskID)
+}
+
+// deliver POSTs the finished task to its callback URL, unless it has no callback or was delivered already
+func (pn *PushNotifier) deliver(taskID string) {
+	if pn.standby.Load() {
+		pn.logger.Debug("skipping push notification on standby", zap.String("execution_id", taskID))
+		return
+	}
+	config := pn.executionService.ClaimPushNotification(taskID)
+	if config == nil {
+		return
+	}
+
+	execution, err := pn.executionService.GetExecution(taskID)
+	if err != nil {
+		return
+	}
+	payload := models.PushNotificationPayload{TaskID: taskID, State: execution.State, Task: execution}
+	if result, resultErr := pn.executionService.GetExecutionResult(taskID); resultErr == nil {
+		payload.Result = result
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		pn.executionService.RecordPushDelivery(taskID, models.PushNotificationDelivery{
+			Status:    models.PushDeliveryFailed,
+			LastError: fmt.Sprintf("failed to encode notification: %v", err),
+		})
+		return
+	}
+
+	delivery := models.PushNotificationDelivery{Status: models.PushDeliveryPending}
+	backoff := pn.retryBackoff
+	for delivery.Attempts < pn.maxAttempts {
+		if delivery.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		delivery.Attempts++
+
+		statusCode, err := pn.post(execution.AgentID, config, body)
+		delivery.LastStatusCode = statusCode
+		delivery.LastError = ""
+		if err != nil {
+			delivery.LastError = err.Error()
+		}
+
+		if err == nil && statusCode >= 200 && statusCode < 300 {
+			now := time.Now()
+			delivery.Status = models.PushDeliveryDelivered
+			delivery.DeliveredAt = &now
+			pn.executionService.RecordPushDelivery(taskID, delivery)
+			pn.publish(execution, delivery)
+			pn.logger.Info("push notification delivered",
+				zap.String("execution_id", taskID),
+				zap.Int("attempts", delivery.Attempts))
+			return
+		}
+
+		if err == nil {
+			delivery.LastError = fmt.Sprintf("callback returned status %d", statusCode)
+			if !retryableStatus(statusCode) {
+				break
+			}
+		}
+		pn.executionService.RecordPushDelivery(taskID, delivery)
+	}
+
+	delivery.Status = models.PushDeliveryFailed
+	pn.executionService.RecordPushDelivery(taskID, delivery)
+	pn.publish(execution, delivery)
+	pn.logger.Warn("push notification delivery failed",
+		zap.String("execution_id", taskID),
+		zap.String("url", config.URL),
+		zap.Int("attempts", delivery.Attempts),
+		zap.String("error", delivery.LastError))
+}
+
+// publish publishes the final outcome of delivering the execution's notification
+func (pn *PushNotifier) publish(execution *models.AgentExecution, delivery models.PushNotificationDelivery) {
+	pn.events.Publish(models.Event{
+		Type:        models.EventWebhookDelivery,
+		AgentID:     execution.AgentID,
+		ExecutionID: execution.ID,
+		Data:        delivery,
+	})
+}
+
+// post sends one notification about an execution of the agent and returns the callback's status code
+func (pn *PushNotifier) post(agentID string, config *models.PushNotificationConfig, body []byte) (int, error) {
+	if err := pn.executionService.FaultInjector().Inject(context.Background(), models.FaultPointWebhookSend, agentID); err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequest(http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if config.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+
+	response, err := pn.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// retryableStatus reports whether a callback response status is worth retrying
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultQueueAlertInterval is how often queues are checked when no interval is configured
+const DefaultQueueAlertInterval = 15 * time.Second
+
+// QueueAlertThreshold sets when the queue of a read-write agent raises an alert. An alert fires once
+// the queue rises above a Max bound and clears only when it is back within every Clear bound, so a
+// queue hovering around a threshold does not flap.
+type QueueAlertThreshold struct {
+	MaxQueueLength   int           // Fire when more executions wait, 0 to ignore queue length
+	ClearQueueLength int           // Clear once at most this many wait, half of MaxQueueLength when 0
+	MaxWait          time.Duration // Fire when the oldest waiting execution has waited longer, 0 to ignore waits
+	ClearWait        time.Duration // Clear once the oldest has waited at most this long, half of MaxWait when 0
+}
+
+// withClearDefaults fills in the clear bounds left at 0
+func (t QueueAlertThreshold) withClearDefaults() QueueAlertThreshold {
+	if t.ClearQueueLength == 0 {
+		t.ClearQueueLength = t.MaxQueueLength / 2
+	}
+	if t.ClearWait == 0 {
+		t.ClearWait = t.MaxWait / 2
+	}
+	return t
+}
+
+// IQueueStatsSource reports the queues of read-write agents
+type IQueueStatsSource interface {
+	QueueStats() []AgentQueueStats
+}
+
+// QueueAlertMonitor periodically checks the queues of read-write agents against their alert
+// thresholds. Alerts that fire or clear are logged, counted by the metrics collector and passed to
+// the alert hooks.
+type QueueAlertMonitor struct {
+	source    IQueueStatsSource
+	defaults  QueueAlertThreshold
+	agents    map[string]QueueAlertThreshold
+	interval  time.Duration
+	now       func() time.Time
+	collector *MetricsCollector
+	hooks     []func(models.QueueAlertEvent)
+	active    map[string]models.QueueAlertEvent
+	mutex     sync.Mutex
+	logger    *zap.Logger
+}
+
+// NewQueueAlertMonitor creates a QueueAlertMonitor over source applying defaults to every agent
+// without thresholds of its own
+func NewQueueAlertMonitor(source IQueueStatsSource, defaults QueueAlertThreshold, interval time.Duration, logger *zap.Logger) *QueueAlertMonitor {
+	if interval <= 0 {
+		interval = DefaultQueueAlertInterval
+	}
+	return &QueueAlertMonitor{
+		source:   source,
+		defaults: defaults.withClearDefaults(),
+		agents:   make(map[string]QueueAlertThreshold),
+		interval: interval,
+		now:      time.Now,
+		active:   make(map[string]models.QueueAlertEvent),
+		logger:   logger,
+	}
+}
+
+// SetThresholds replaces the default thresholds and the thresholds of agents with their own;
+// alerts that already fired clear under the new thresholds
+func (m *QueueAlertMonitor) SetThresholds(defaults QueueAlertThreshold, agents map[string]QueueAlertThreshold) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.defaults = defaults.withClearDefaults()
+	m.agents = make(map[string]QueueAlertThreshold, len(agents))
+	for agentID, threshold := range agents {
+		m.agents[agentID] = threshold.withClearDefaults()
+	}
+}
+
+// SetMetricsCollector sets the collector counting fired alerts
+func (m *QueueAlertMonitor) SetMetricsCollector(collector *MetricsCollector) {
+	m.collector = collector
+}
+
+// SetClock replaces the clock queue waits are measured with
+func (m *QueueAlertMonitor) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+// AddAlertHook registers a hook called with every alert that fires or clears
+func (m *QueueAlertMonitor) AddAlertHook(hook func(models.QueueAlertEvent)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// ActiveAlerts returns the alerts that fired and have not cleared, ordered by agent ID
+func (m *QueueAlertMonitor) ActiveAlerts() []models.QueueAlertEvent {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	alerts := make([]models.QueueAlertEvent, 0, len(m.active))
+	for _, alert := range m.active {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].AgentID < alerts[j].AgentID })
+	return alerts
+}
+
+// Start checks the queues every interval until ctx is cancelled
+func (m *QueueAlertMonitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check()
+			}
+		}
+	}()
+}
+
+// Check compares every queue with its thresholds once and returns the alerts that fired or cleared
+func (m *QueueAlertMonitor) Check() []models.QueueAlertEvent {
+	now := m.now()
+	stats := make(map[string]AgentQueueStats)
+	for _, entry := range m.source.QueueStats() {
+		stats[entry.AgentID] = entry
+	}
+
+	m.mutex.Lock()
+	// Alerted agents whose queue is gone are checked as empty so their alert clears
+	for agentID := range m.active {
+		if _, exists := stats[agentID]; !exists {
+			stats[agentID] = AgentQueueStats{AgentID: agentID}
+		}
+	}
+	agentIDs := sortedKeys(stats)
+
+	var events []models.QueueAlertEvent
+	for _, agentID := range agentIDs {
+		entry := stats[agentID]
+		threshold, exists := m.agents[agentID]
+		if !exists {
+			threshold = m.defaults
+		}
+		var wait time.Duration
+		if entry.QueueLength > 0 && !entry.OldestQueuedAt.IsZero() {
+			wait = now.Sub(entry.OldestQueuedAt)
+		}
+		event := models.QueueAlertEvent{
+			AgentID:            agentID,
+			QueueLength:        entry.QueueLength,
+			OldestWaitSeconds:  wait.Seconds(),
+			CurrentExecutionID: entry.CurrentExecutionID,
+			Time:               now,
+		}
+
+		if _, alerting := m.active[agentID]; alerting {
+			if queueWithin(threshold, entry.QueueLength, wait) {
+				event.Type = models.QueueAlertCleared
+				delete(m.active, agentID)
+				events = append(events, event)
+			}
+			continue
+		}
+		if reasons := queueBreaches(threshold, entry.QueueLength, wait); len(reasons) > 0 {
+			event.Type = models.QueueAlertFired
+			event.Reasons = reasons
+			m.active[agentID] = event
+			events = append(events, event)
+		}
+	}
+	hooks := append([]func(models.QueueAlertEvent){}, m.hooks...)
+	m.mutex.Unlock()
+
+	for _, event := range events {
+		fields := []zap.Field{
+			zap.String("agent_id", event.AgentID),
+			zap.Int("queue_length", event.QueueLength),
+			zap.Float64("oldest_wait_seconds", event.OldestWaitSeconds),
+			zap.String("current_execution_id", event.CurrentExecutionID),
+		}
+		if event.Type == models.QueueAlertFired {
+			m.logger.Warn("execution queue alert fired", append(fields, zap.Strings("reasons", event.Reasons))...)
+			if m.collector != nil {
+				m.collector.RecordQueueAlert(event.AgentID)
+			}
+		} else {
+			m.logger.Info("execution queue alert cleared", fields...)
+		}
+		for _, hook := range hooks {
+			hook(event)
+		}
+	}
+	return events
+}
+
+// queueBreaches returns the thresholds a queue has risen above
+func queueBreaches(threshold QueueAlertThreshold, length int, wait time.Duration) []string {
+	var reasons []string
+	if threshold.MaxQueueLength > 0 && length > threshold.MaxQueueLength {
+		reasons = append(reasons, models.QueueAlertReasonLength)
+	}
+	if threshold.MaxWait > 0 && wait > threshold.MaxWait {
+		reasons = append(reasons, models.QueueAlertReasonWait)
+	}
+	return reasons
+}
+
+// queueWithin reports whether a queue is back within every clear bound of its thresholds
+func queueWithin(threshold QueueAlertThreshold, length int, wait time.Duration) bool {
+	if threshold.MaxQueueLength > 0 && length > threshold.ClearQueueLength {
+		return false
+	}
+	if threshold.MaxWait > 0 && wait > threshold.ClearWait {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// DefaultResultCacheEntries bounds the result cache when no size is configured
+const DefaultResultCacheEntries = 1000
+
+// ResultCache is a bounded LRU cache of successful execution results for agents with a cache TTL
+type ResultCache struct {
+	maxEntries int
+
+	mutex   sync.Mutex
+	order   *list.List // Most recently used at the front
+	entries map[string]*list.Element
+}
+
+// cachedResult is a cached execution result and the execution that produced it
+type cachedResult struct {
+	key         string
+	executionID string
+	result      *models.ExecutionResult
+	storedAt    time.Time
+}
+
+// NewResultCache creates a result cache holding at most maxEntries results
+func NewResultCache(maxEntries int) *ResultCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultResultCacheEntries
+	}
+	return &ResultCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached result for key and the ID of the execution that produced it, if younger than ttl
+func (rc *ResultCache) Get(key string, ttl time.Duration) (*models.ExecutionResult, string, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	element, exists := rc.entries[key]
+	if !exists {
+		return nil, "", false
+	}
+
+	entry := element.Value.(*cachedResult)
+	if time.Since(entry.storedAt) > ttl {
+		rc.order.Remove(element)
+		delete(rc.entries, key)
+		return nil, "", false
+	}
+
+	rc.order.MoveToFront(element)
+	return entry.result, entry.executionID, true
+}
+
+// Put stores the result of executionID under key, evicting the least recently used entry when full
+func (rc *ResultCache) Put(key, executionID string, result *models.ExecutionResult) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	entry := &cachedResult{key: key, executionID: executionID, result: result, storedAt: time.Now()}
+	if element, exists := rc.entries[key]; exists {
+		element.Value = entry
+		rc.order.MoveToFront(element)
+		return
+	}
+
+	rc.entries[key] = rc.order.PushFront(entry)
+	for rc.order.Len() > rc.maxEntries {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cachedResult).key)
+	}
+}
+
+// Len returns the number of cached results
+func (rc *ResultCache) Len() int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.order.Len()
+}
+
+// resultCacheKey hashes the agent's configuration, including its update time, together with the
+// input and output encoding, so updating the agent invalidates the results cached under its
+// previous configuration
+func resultCacheKey(config *models.AgentConfiguration, input string, encoding models.OutputEncoding) string {
+	configJSON, _ := json.Marshal(config)
+
+	hash := sha256.New()
+	hash.Write([]byte(config.ID))
+	hash.Write([]byte{0})
+	hash.Write(configJSON)
+	hash.Write([]byte{0})
+	hash.Write([]byte(input))
+	hash.Write([]byte{0})
+	hash.Write([]byte(encoding))
+	return hex.EncodeToString(hash.Sum(nil))
+}
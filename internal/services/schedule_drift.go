@@ -0,0 +1,332 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Defaults of scheduler drift and missed fire detection
+const (
+	DefaultDriftWarnThreshold  = time.Second // Drift past which a fire is logged as late
+	DefaultMissedFireTolerance = time.Minute // How long after its planned time a fire that has not happened counts as missed
+)
+
+// missedFireCheckInterval is how often planned fires are checked for having happened
+const missedFireCheckInterval = time.Second
+
+// driftWindow is how many recent fires of a task the rolling maximum drift covers
+const driftWindow = 20
+
+// scheduledFire is a fire of a task's cron schedule: when it was planned and how late it ran
+type scheduledFire struct {
+	planned time.Time
+	drift   time.Duration
+	late    bool // drift is past the warning threshold
+}
+
+// apply records the fire on the history record of a run it started; runs the cron schedule did not
+// fire, such as catch-up runs, have none
+func (f *scheduledFire) apply(history *models.ExecutionHistory) {
+	if f == nil {
+		return
+	}
+	planned := f.planned
+	history.PlannedTime = &planned
+	history.DriftMs = f.drift.Milliseconds()
+}
+
+// plannedFire is a fire the cron scheduler planned for a task
+type plannedFire struct {
+	at       time.Time
+	reported bool // Reported missed; it is still measured if it happens late after all
+}
+
+// trackedSchedule is the schedule of a task as handed to the cron scheduler; it hands the tracker
+// every fire time the cron scheduler plans, so fires are measured against the time they were
+// actually planned for
+type trackedSchedule struct {
+	cron.Schedule
+	taskID  string
+	tracker *scheduleDriftTracker
+}
+
+// Next returns the next fire time after t and records it as planned
+func (s *trackedSchedule) Next(t time.Time) time.Time {
+	next := s.Schedule.Next(t)
+	s.tracker.plan(s, next)
+	return next
+}
+
+// untracked returns the schedule of a cron entry without recording the fire times asked of it
+func untracked(schedule cron.Schedule) cron.Schedule {
+	if tracked, ok := schedule.(*trackedSchedule); ok {
+		return tracked.Schedule
+	}
+	return schedule
+}
+
+// taskDrift is the fire bookkeeping of one task
+type taskDrift struct {
+	schedule *trackedSchedule // nil while the task is paused
+	planned  []plannedFire    // Fires planned that have not happened yet, oldest first
+	drifts   []time.Duration  // Drift of the last driftWindow fires, oldest first
+	summary  models.ScheduleDrift
+}
+
+// scheduleDriftTracker compares the fires of the cron scheduler with the times it planned them
+// for, to measure how late they run and detect planned fires that never happen
+type scheduleDriftTracker struct {
+	mutex         sync.Mutex
+	tasks         map[string]*taskDrift
+	now           func() time.Time
+	warnThreshold time.Duration
+	tolerance     time.Duration
+}
+
+// newScheduleDriftTracker creates a tracker with the default threshold and tolerance
+func newScheduleDriftTracker() *scheduleDriftTracker {
+	return &scheduleDriftTracker{
+		tasks:         make(map[string]*taskDrift),
+		now:           time.Now,
+		warnThreshold: DefaultDriftWarnThreshold,
+		tolerance:     DefaultMissedFireTolerance,
+	}
+}
+
+// track returns schedule wrapped to record the fires planned for the task, replacing the fires
+// planned with its previous schedule
+func (dt *scheduleDriftTracker) track(taskID string, schedule cron.Schedule) cron.Schedule {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	drift, exists := dt.tasks[taskID]
+	if !exists {
+		drift = &taskDrift{}
+		dt.tasks[taskID] = drift
+	}
+	drift.schedule = &trackedSchedule{Schedule: schedule, taskID: taskID, tracker: dt}
+	drift.planned = nil
+	return drift.schedule
+}
+
+// plan records a fire the cron scheduler planned with schedule; schedules replaced since are ignored
+func (dt *scheduleDriftTracker) plan(schedule *trackedSchedule, at time.Time) {
+	if at.IsZero() {
+		return
+	}
+
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	if drift, exists := dt.tasks[schedule.taskID]; exists && drift.schedule == schedule {
+		drift.planned = append(drift.planned, plannedFire{at: at})
+	}
+}
+
+// unschedule stops expecting fires of a paused task, keeping its measurements
+func (dt *scheduleDriftTracker) unschedule(taskID string) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	if drift, exists := dt.tasks[taskID]; exists {
+		drift.schedule = nil
+		drift.planned = nil
+	}
+}
+
+// forget drops the measurements of a deleted task
+func (dt *scheduleDriftTracker) forget(taskID string) {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+	delete(dt.tasks, taskID)
+}
+
+// fire measures a fire of the task happening now against the earliest fire planned for it; nil
+// when no fire was planned
+func (dt *scheduleDriftTracker) fire(taskID string) *scheduledFire {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	drift, exists := dt.tasks[taskID]
+	if !exists || len(drift.planned) == 0 {
+		return nil
+	}
+
+	invoked := dt.now()
+	planned := drift.planned[0].at
+	drift.planned = drift.planned[1:]
+
+	fire := &scheduledFire{planned: planned}
+	if invoked.After(planned) {
+		fire.drift = invoked.Sub(planned)
+	}
+	fire.late = fire.drift > dt.warnThreshold
+
+	drift.drifts = append(drift.drifts, fire.drift)
+	if len(drift.drifts) > driftWindow {
+		drift.drifts = drift.drifts[len(drift.drifts)-driftWindow:]
+	}
+	maxDrift := time.Duration(0)
+	for _, recent := range drift.drifts {
+		if recent > maxDrift {
+			maxDrift = recent
+		}
+	}
+	drift.summary.LastDriftMs = fire.drift.Milliseconds()
+	drift.summary.MaxDriftMs = maxDrift.Milliseconds()
+	drift.summary.WindowFires = len(drift.drifts)
+	drift.summary.Fires++
+	drift.summary.LastFireAt = &planned
+	return fire
+}
+
+// missed returns the planned fires that have not happened within the tolerance and were not
+// reported before
+func (dt *scheduleDriftTracker) missed() []models.MissedFire {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	now := dt.now()
+	var missed []models.MissedFire
+	for taskID, drift := range dt.tasks {
+		for i := range drift.planned {
+			planned := &drift.planned[i]
+			if !planned.at.Add(dt.tolerance).Before(now) {
+				break
+			}
+			if planned.reported {
+				continue
+			}
+			planned.reported = true
+			at := planned.at
+			missed = append(missed, models.MissedFire{
+				TaskID:      taskID,
+				PlannedTime: at,
+				DetectedAt:  now,
+				ToleranceMs: dt.tolerance.Milliseconds(),
+			})
+			drift.summary.MissedFires++
+			drift.summary.LastMissedAt = &at
+		}
+	}
+	return missed
+}
+
+// summary returns the measurements of the task, nil before it was scheduled
+func (dt *scheduleDriftTracker) summary(taskID string) *models.ScheduleDrift {
+	dt.mutex.Lock()
+	defer dt.mutex.Unlock()
+
+	drift, exists := dt.tasks[taskID]
+	if !exists {
+		return nil
+	}
+	summary := drift.summary
+	return &summary
+}
+
+// SetClock replaces the clock fires and missed fires are timed with, e.g. to skew it in tests; the
+// cron scheduler keeps planning and firing on the system clock
+func (ss *SchedulerService) SetClock(now func() time.Time) {
+	ss.drift.mutex.Lock()
+	defer ss.drift.mutex.Unlock()
+	ss.drift.now = now
+}
+
+// SetDriftDetection sets the drift past which a fire is logged as late, and how long after its
+// planned time a fire that has not happened is reported missed
+func (ss *SchedulerService) SetDriftDetection(warnThreshold, missedFireTolerance time.Duration) {
+	ss.drift.mutex.Lock()
+	defer ss.drift.mutex.Unlock()
+	ss.drift.warnThreshold = warnThreshold
+	ss.drift.tolerance = missedFireTolerance
+}
+
+// SetMetricsCollector sets the collector receiving the drift of fires and missed fires
+func (ss *SchedulerService) SetMetricsCollector(collector *MetricsCollector) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.metricsCollector = collector
+}
+
+// ScheduleDrift returns how late the cron scheduler fired the task, nil before it was scheduled
+func (ss *SchedulerService) ScheduleDrift(taskID string) *models.ScheduleDrift {
+	return ss.drift.summary(taskID)
+}
+
+// measureFire measures a fire of the task's schedule, recording its drift and warning when it ran late
+func (ss *SchedulerService) measureFire(taskID string) *scheduledFire {
+	fire := ss.drift.fire(taskID)
+	if fire == nil {
+		return nil
+	}
+
+	ss.mutex.RLock()
+	collector := ss.metricsCollector
+	ss.mutex.RUnlock()
+	if collector != nil {
+		collector.RecordScheduleDrift(taskID, fire.drift)
+	}
+	if fire.late {
+		ss.logger.Warn("scheduled task fired late",
+			zap.String("task_id", taskID),
+			zap.Time("planned_time", fire.planned),
+			zap.Duration("drift", fire.drift))
+	}
+	return fire
+}
+
+// watchMissedFires reports planned fires that did not happen within the tolerance until the
+// scheduler stops
+func (ss *SchedulerService) watchMissedFires() {
+	ticker := time.NewTicker(missedFireCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ss.reportMissedFires()
+		case <-ss.ctx.Done():
+			return
+		}
+	}
+}
+
+// reportMissedFires logs, counts and publishes the fires missed since the last check
+func (ss *SchedulerService) reportMissedFires() {
+	missed := ss.drift.missed()
+	if len(missed) == 0 {
+		return
+	}
+
+	ss.mutex.RLock()
+	collector := ss.metricsCollector
+	events := ss.events
+	agentIDs := make(map[string]string, len(missed))
+	for _, fire := range missed {
+		if task, err := ss.taskStore.GetTask(fire.TaskID); err == nil {
+			agentIDs[fire.TaskID] = task.AgentID
+		}
+	}
+	ss.mutex.RUnlock()
+
+	for _, fire := range missed {
+		ss.logger.Warn("scheduled task missed a fire",
+			zap.String("task_id", fire.TaskID),
+			zap.Time("planned_time", fire.PlannedTime),
+			zap.Int64("tolerance_ms", fire.ToleranceMs))
+		if collector != nil {
+			collector.RecordMissedFire(fire.TaskID)
+		}
+		events.Publish(models.Event{
+			Type:    models.EventTaskMissedFire,
+			AgentID: agentIDs[fire.TaskID],
+			TaskID:  fire.TaskID,
+			Data:    &fire,
+		})
+	}
+}
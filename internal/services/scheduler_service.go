@@ -2,11 +2,14 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/algonius/algonius-supervisor/internal/definitions"
 	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
 
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
@@ -20,11 +23,15 @@ type ISchedulerService interface {
 	// UnscheduleTask removes a scheduled task by its ID
 	UnscheduleTask(taskID string) error
 
-	// ListScheduledTasks returns all currently scheduled tasks
+	// ListScheduledTasks returns all currently scheduled tasks, ordered by ID
 	ListScheduledTasks() ([]*models.ScheduledTask, error)
 
-	// ExecuteTask immediately executes a task regardless of its schedule
-	ExecuteTask(taskID string) (*models.ExecutionResult, error)
+	// QueryScheduledTasks returns the page of tasks matching the options and how many match in total
+	QueryScheduledTasks(options TaskListOptions) ([]*models.ScheduledTask, int, error)
+
+	// ExecuteTask immediately executes a task regardless of its schedule; the run is attributed to
+	// the trigger on ctx, or counts as a manual run of the scheduler when it has none
+	ExecuteTask(ctx context.Context, taskID string) (*models.ExecutionResult, error)
 
 	// PauseTask pauses a scheduled task (prevents it from executing according to schedule)
 	PauseTask(taskID string) error
@@ -37,6 +44,41 @@ type ISchedulerService interface {
 
 	// GetTask returns a specific task by its ID
 	GetTask(taskID string) (*models.ScheduledTask, error)
+
+	// GetTaskHistory returns the most recent execution history records for a task
+	GetTaskHistory(taskID string, limit int) ([]*models.ExecutionHistory, error)
+
+	// GetNextRun returns the next time the task is due to fire, or nil when it is not scheduled
+	GetNextRun(taskID string) (*time.Time, error)
+
+	// NextRuns returns the next n times the task is due to fire, in its time zone; a paused task
+	// has none
+	NextRuns(taskID string, n int) ([]time.Time, error)
+
+	// Location returns the time zone the scheduler evaluates cron expressions in
+	Location() *time.Location
+
+	// IsRunning reports whether the scheduler fires tasks, i.e. it has not been stopped
+	IsRunning() bool
+
+	// PreviewTaskInput renders the input a run of the task would receive now, without running it
+	PreviewTaskInput(taskID string) (string, error)
+
+	// PlanTaskOperation checks an action's preconditions and reports its outcome without performing it
+	PlanTaskOperation(taskID string, action models.TaskAction) *models.OperationResult
+
+	// BulkTaskOperation applies an action to every task the selector picks and reports the outcome per task
+	BulkTaskOperation(ctx context.Context, action models.TaskAction, selector models.TaskSelector, dryRun bool) (*models.BatchOperationResult, error)
+
+	// CancelActiveRuns cancels every unfinished execution the task started and reports the outcome per execution
+	CancelActiveRuns(taskID, requestedBy string) (*models.CancelAllResult, error)
+
+	// ScheduleDrift returns how late the cron scheduler fired the task, nil before it was scheduled
+	ScheduleDrift(taskID string) *models.ScheduleDrift
+
+	// Shutdown stops firing tasks, cancels the runs in progress and waits until they returned or ctx
+	// is done; tasks can be neither scheduled nor executed afterwards
+	Shutdown(ctx context.Context) error
 }
 
 // TaskState represents the state of a scheduled task
@@ -49,13 +91,44 @@ const (
 	TaskExecuting TaskState = "executing"
 )
 
+// defaultMaxCatchUpRuns caps run_all catch-up when the task doesn't set its own limit
+const defaultMaxCatchUpRuns = 100
+
+// maxExcludedFires caps how many consecutive fires calendars may exclude while looking for the next
+// fire of a task, so a calendar excluding every day does not loop for ever
+const maxExcludedFires = 10000
+
+// maxQueuedRuns caps how many overlapping runs a queue-policy task may defer
+const maxQueuedRuns = 10
+
+// runDecision is the outcome of checking a task's overlap policy before a run
+type runDecision int
+
+const (
+	runNow runDecision = iota
+	runQueued
+	runSkipped
+)
+
+// taskRunState tracks in-flight and deferred runs of a single task
+type taskRunState struct {
+	running int
+	queued  []queuedRun
+}
+
+// queuedRun is a run of a queue-policy task waiting for the task's in-flight run to finish
+type queuedRun struct {
+	trigger types.TaskTriggerType
+	fire    *scheduledFire
+}
+
 // SchedulerService implements ISchedulerService interface
 type SchedulerService struct {
 	// Internal cron scheduler
 	cronScheduler *cron.Cron
 
-	// Map of scheduled tasks by ID
-	tasks map[string]*models.ScheduledTask
+	// Store keeping the scheduled tasks
+	taskStore models.TaskStore
 
 	// Map of cron entry IDs for tracking
 	entryIDs map[string]cron.EntryID
@@ -66,15 +139,58 @@ type SchedulerService struct {
 	// Execution service for executing agents
 	executionService IExecutionService
 
+	// Router running agents through the read-write queue or read-only pool of executionService
+	router *ExecutionRouter
+
+	// Pipeline service for tasks that run a pipeline instead of a single agent
+	pipelineService IPipelineService
+
 	// Logger for logging
 	logger *zap.Logger
 
 	// Mutex for thread safety
 	mutex sync.RWMutex
 
-	// Context for cancellation
+	// Execution history for scheduled runs
+	historyRepo models.ExecutionHistoryRepository
+
+	// Bus finished runs are published on, when set
+	events *EventBus
+
+	// Maintenance windows during which runs of an agent's tasks are skipped, when set
+	maintenance *MaintenanceService
+
+	// Calendars whose days the tasks skipping them do not run on, when set
+	calendars ICalendarService
+
+	// Upper bound for task-level timeouts, 0 means no cap
+	maxTaskTimeout time.Duration
+
+	// Delay between consecutive catch-up runs so missed runs don't stampede the agent
+	catchUpInterval time.Duration
+
+	// Time zone cron expressions are evaluated in
+	location *time.Location
+
+	// In-flight run tracking per task, used to enforce overlap policies
+	runStates map[string]*taskRunState
+	runMutex  sync.Mutex
+
+	// Drift of fires from their planned times, and planned fires that never happened
+	drift *scheduleDriftTracker
+
+	// Collector receiving the drift of fires and missed fires, when set
+	metricsCollector *MetricsCollector
+
+	// Whether another supervisor instance leads, so this one keeps tasks without firing them
+	standby bool
+
+	// Context every run derives from, cancelled when the scheduler stops
 	ctx context.Context
 	cancel context.CancelFunc
+
+	// Runs in progress, which Shutdown waits for
+	runs sync.WaitGroup
 }
 
 // NewSchedulerService creates a new instance of SchedulerService
@@ -100,17 +216,24 @@ func NewSchedulerService(agentService IAgentService, executionService IExecution
 
 	service := &SchedulerService{
 		cronScheduler:  cronScheduler,
-		tasks:          make(map[string]*models.ScheduledTask),
+		taskStore:      models.NewInMemoryTaskStore(),
 		entryIDs:       make(map[string]cron.EntryID),
 		agentService:   agentService,
 		executionService: executionService,
+		router:         ExecutionRouterFor(executionService, logger),
 		logger:         logger,
+		historyRepo:    models.NewInMemoryExecutionHistoryRepository(),
+		catchUpInterval: time.Second,
+		location:       time.Local,
+		runStates:      make(map[string]*taskRunState),
+		drift:          newScheduleDriftTracker(),
 		ctx:            ctx,
 		cancel:         cancel,
 	}
 
-	// Start the cron scheduler
+	// Start the cron scheduler, and check that the fires it plans happen
 	service.cronScheduler.Start()
+	go service.watchMissedFires()
 
 	return service
 }
@@ -120,15 +243,19 @@ func (ss *SchedulerService) ScheduleTask(task *models.ScheduledTask) error {
 	ss.mutex.Lock()
 	defer ss.mutex.Unlock()
 
+	if err := ss.checkRunning(); err != nil {
+		return err
+	}
+
 	// Validate the task
 	if err := ss.validateTask(task); err != nil {
 		ss.logger.Error("invalid task configuration", zap.Error(err))
-		return fmt.Errorf("invalid task configuration: %w", err)
+		return fmt.Errorf("%w: %w", models.ErrInvalidTask, err)
 	}
 
 	// Check if task with this ID already exists
-	if _, exists := ss.tasks[task.ID]; exists {
-		return fmt.Errorf("task with ID %s already exists", task.ID)
+	if _, err := ss.taskStore.GetTask(task.ID); err == nil {
+		return models.NewKindError(models.ErrTaskConflict, "task with ID %s already exists", task.ID)
 	}
 
 	// Set the initial state to active
@@ -136,24 +263,27 @@ func (ss *SchedulerService) ScheduleTask(task *models.ScheduledTask) error {
 	task.CreatedAt = time.Now()
 	task.UpdatedAt = time.Now()
 
-	// Parse the cron expression to validate it
-	_, err := cron.ParseStandard(task.CronExpression)
-	if err != nil {
-		return fmt.Errorf("invalid cron expression '%s': %w", task.CronExpression, err)
+	// Store the task; the store refuses an ID that is taken, even when another supervisor sharing
+	// it stored the task since the check above
+	if err := ss.taskStore.CreateTask(task); err != nil {
+		return err
 	}
 
 	// Schedule the task with the cron scheduler
-	entryID, err := ss.cronScheduler.AddFunc(task.CronExpression, func() {
-		ss.executeScheduledTask(task)
-	})
+	entryID, err := ss.addCronEntry(task)
 	if err != nil {
+		ss.taskStore.DeleteTask(task.ID)
 		return fmt.Errorf("failed to schedule task: %w", err)
 	}
 
-	// Store the task and its entry ID
-	ss.tasks[task.ID] = task
+	// Store the entry ID
 	ss.entryIDs[task.ID] = entryID
 
+	// Replay fire times missed since the task's last recorded run
+	if missed := ss.missedRuns(task, time.Now()); missed > 0 {
+		go ss.runCatchUp(task, missed)
+	}
+
 	ss.logger.Info("task scheduled successfully",
 		zap.String("task_id", task.ID),
 		zap.String("agent_id", task.AgentID),
@@ -168,9 +298,9 @@ func (ss *SchedulerService) UnscheduleTask(taskID string) error {
 	defer ss.mutex.Unlock()
 
 	// Check if task exists
-	task, exists := ss.tasks[taskID]
-	if !exists {
-		return fmt.Errorf("task with ID %s not found", taskID)
+	task, err := ss.taskStore.GetTask(taskID)
+	if err != nil {
+		return err
 	}
 
 	// Remove from cron scheduler
@@ -178,9 +308,12 @@ func (ss *SchedulerService) UnscheduleTask(taskID string) error {
 		ss.cronScheduler.Remove(entryID)
 		delete(ss.entryIDs, taskID)
 	}
+	ss.drift.forget(taskID)
 
-	// Remove from internal map
-	delete(ss.tasks, taskID)
+	// Remove from the store
+	if err := ss.taskStore.DeleteTask(taskID); err != nil {
+		return err
+	}
 
 	ss.logger.Info("task unscheduled successfully",
 		zap.String("task_id", taskID),
@@ -189,27 +322,67 @@ func (ss *SchedulerService) UnscheduleTask(taskID string) error {
 	return nil
 }
 
-// ListScheduledTasks returns all currently scheduled tasks
+// ListScheduledTasks returns all currently scheduled tasks, ordered by ID
 func (ss *SchedulerService) ListScheduledTasks() ([]*models.ScheduledTask, error) {
+	tasks, _, err := ss.QueryScheduledTasks(TaskListOptions{})
+	return tasks, err
+}
+
+// QueryScheduledTasks returns the tasks matching the options' filters, sorted and paged as they ask,
+// along with how many tasks match across all pages
+func (ss *SchedulerService) QueryScheduledTasks(options TaskListOptions) ([]*models.ScheduledTask, int, error) {
+	if err := options.Validate(); err != nil {
+		return nil, 0, err
+	}
+
 	ss.mutex.RLock()
 	defer ss.mutex.RUnlock()
 
-	tasks := make([]*models.ScheduledTask, 0, len(ss.tasks))
-	for _, task := range ss.tasks {
+	stored, err := ss.taskStore.ListTasks()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tasks := make([]*models.ScheduledTask, 0, len(stored))
+	for _, task := range stored {
+		if options.Enabled != nil && task.Enabled != *options.Enabled {
+			continue
+		}
+		if options.AgentID != "" && task.AgentID != options.AgentID {
+			continue
+		}
 		tasks = append(tasks, task)
 	}
 
-	return tasks, nil
+	total := len(tasks)
+	return sortAndPage(tasks, options.ListOptions, taskListKeys), total, nil
 }
 
 // ExecuteTask immediately executes a task regardless of its schedule
-func (ss *SchedulerService) ExecuteTask(taskID string) (*models.ExecutionResult, error) {
-	ss.mutex.RLock()
-	task, exists := ss.tasks[taskID]
-	ss.mutex.RUnlock()
+func (ss *SchedulerService) ExecuteTask(ctx context.Context, taskID string) (*models.ExecutionResult, error) {
+	task, err := ss.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !ss.beginTracking() {
+		return nil, models.NewKindError(models.ErrSchedulerStopped, "scheduler stopped, task %s cannot be executed", taskID)
+	}
+	defer ss.runs.Done()
 
-	if !exists {
-		return nil, fmt.Errorf("task with ID %s not found", taskID)
+	if ExecutionTriggerFromContext(ctx).Type == "" {
+		ctx = WithExecutionTrigger(ctx, types.TaskTriggerTypeManual, SchedulerTriggeredBy(task.ID))
+	}
+	ctx = WithExecutionTask(ctx, task.ID)
+	// The run keeps the caller's values but is not cut short when the caller goes away, only when
+	// the scheduler stops
+	ctx, cancel := ss.detach(ctx)
+	defer cancel()
+
+	if task.PipelineID != "" {
+		return ss.executePipelineTask(ctx, task)
+	}
+	if task.IsFanOut() {
+		return ss.executeFanOutTask(ctx, task)
 	}
 
 	// Get the agent configuration
@@ -217,20 +390,26 @@ func (ss *SchedulerService) ExecuteTask(taskID string) (*models.ExecutionResult,
 	if err != nil {
 		return nil, fmt.Errorf("agent not found: %w", err)
 	}
+	if err := checkAgentEnabled(agentConfig); err != nil {
+		return nil, err
+	}
 
 	// Create an agent instance
-	agent := &ScheduledAgent{
-		config: agentConfig,
-		logger: ss.logger,
+	agent, err := ss.router.CreateAgent(agentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent: %w", err)
 	}
 
-	// Execute the agent with the task's input parameters
-	input := ss.buildInputFromParameters(task.InputParameters)
-	
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(agentConfig.Timeout)*time.Second)
-	defer cancel()
+	// Execute the agent with the task's rendered input
+	input, err := ss.taskInput(task)
+	if err != nil {
+		return nil, err
+	}
 
-	execution, err := ss.executionService.ExecuteAgent(ctx, agent, input)
+	ctx, cancelTimeout := context.WithTimeout(WithExecutionLabels(ctx, task.Labels), taskTimeout(task, agentConfig))
+	defer cancelTimeout()
+
+	execution, err := ss.router.ExecuteAgent(ctx, agent, input)
 	if err != nil {
 		return nil, fmt.Errorf("agent execution failed: %w", err)
 	}
@@ -241,18 +420,38 @@ func (ss *SchedulerService) ExecuteTask(taskID string) (*models.ExecutionResult,
 		AgentID:   task.AgentID,
 		TaskID:    task.ID,
 		StartTime: execution.StartTime,
-		EndTime:   *execution.EndTime,
-		Status:    models.SuccessStatus, // This should be set based on the execution status
 		Input:     input,
-		Output:    "Execution completed successfully", // In a real implementation, this would come from the result
-		ExecutionTime: execution.EndTime.Sub(execution.StartTime).Milliseconds(),
+		Labels:    execution.Labels,
+		TriggerType: execution.TriggerType,
+		TriggeredBy: execution.TriggeredBy,
+	}
+	if execution.EndTime != nil {
+		result.EndTime = *execution.EndTime
+		result.ExecutionTime = execution.EndTime.Sub(execution.StartTime).Milliseconds()
+	}
+
+	// Report what the agent process actually produced; without a stored result only an execution
+	// that ended without success tells its status
+	if stored, err := ss.executionService.GetExecutionResult(execution.ID); err == nil {
+		result.Status = stored.Status
+		result.Output = stored.Output
+		result.Stderr = stored.Stderr
+		result.ExitCode = stored.ExitCode
+		result.FromCache = stored.FromCache
+		result.CachedExecutionID = stored.CachedExecutionID
+	} else if endStatus, ok := execution.EndStatus(); ok {
+		result.Status = endStatus
+	} else {
+		return nil, fmt.Errorf("execution %s of task %s produced no result: %w", execution.ID, taskID, err)
 	}
 
 	// Log the task execution
 	ss.logger.Info("scheduled task executed",
 		zap.String("task_id", taskID),
 		zap.String("agent_id", task.AgentID),
-		zap.String("execution_id", execution.ID))
+		zap.String("execution_id", execution.ID),
+		zap.String("trigger_type", string(execution.TriggerType)),
+		zap.String("triggered_by", execution.TriggeredBy))
 
 	return result, nil
 }
@@ -262,14 +461,14 @@ func (ss *SchedulerService) PauseTask(taskID string) error {
 	ss.mutex.Lock()
 	defer ss.mutex.Unlock()
 
-	task, exists := ss.tasks[taskID]
-	if !exists {
-		return fmt.Errorf("task with ID %s not found", taskID)
+	task, err := ss.taskStore.GetTask(taskID)
+	if err != nil {
+		return err
 	}
 
 	// If already paused, return error
 	if !task.Active {
-		return fmt.Errorf("task with ID %s is already paused", taskID)
+		return models.NewKindError(models.ErrTaskConflict, "task with ID %s is already paused", taskID)
 	}
 
 	// Remove from cron scheduler
@@ -277,10 +476,14 @@ func (ss *SchedulerService) PauseTask(taskID string) error {
 		ss.cronScheduler.Remove(entryID)
 		delete(ss.entryIDs, taskID)
 	}
+	ss.drift.unschedule(taskID)
 
 	// Update task state
 	task.Active = false
 	task.UpdatedAt = time.Now()
+	if err := ss.taskStore.SaveTask(task); err != nil {
+		return err
+	}
 
 	ss.logger.Info("task paused",
 		zap.String("task_id", taskID),
@@ -294,20 +497,18 @@ func (ss *SchedulerService) ResumeTask(taskID string) error {
 	ss.mutex.Lock()
 	defer ss.mutex.Unlock()
 
-	task, exists := ss.tasks[taskID]
-	if !exists {
-		return fmt.Errorf("task with ID %s not found", taskID)
+	task, err := ss.taskStore.GetTask(taskID)
+	if err != nil {
+		return err
 	}
 
 	// If not paused, return error
 	if task.Active {
-		return fmt.Errorf("task with ID %s is not paused", taskID)
+		return models.NewKindError(models.ErrTaskConflict, "task with ID %s is not paused", taskID)
 	}
 
 	// Schedule the task again with the cron scheduler
-	entryID, err := ss.cronScheduler.AddFunc(task.CronExpression, func() {
-		ss.executeScheduledTask(task)
-	})
+	entryID, err := ss.addCronEntry(task)
 	if err != nil {
 		return fmt.Errorf("failed to resume task: %w", err)
 	}
@@ -318,6 +519,9 @@ func (ss *SchedulerService) ResumeTask(taskID string) error {
 	// Update task state
 	task.Active = true
 	task.UpdatedAt = time.Now()
+	if err := ss.taskStore.SaveTask(task); err != nil {
+		return err
+	}
 
 	ss.logger.Info("task resumed",
 		zap.String("task_id", taskID),
@@ -332,30 +536,29 @@ func (ss *SchedulerService) UpdateTask(task *models.ScheduledTask) error {
 	defer ss.mutex.Unlock()
 
 	// Check if task exists
-	existingTask, exists := ss.tasks[task.ID]
-	if !exists {
-		return fmt.Errorf("task with ID %s not found", task.ID)
+	existingTask, err := ss.taskStore.GetTask(task.ID)
+	if err != nil {
+		return err
 	}
 
 	// Validate the updated task
 	if err := ss.validateTask(task); err != nil {
 		ss.logger.Error("invalid updated task configuration", zap.Error(err))
-		return fmt.Errorf("invalid task configuration: %w", err)
+		return fmt.Errorf("%w: %w", models.ErrInvalidTask, err)
 	}
 
-	// If the cron expression changed, we need to reschedule
-	if existingTask.CronExpression != task.CronExpression {
+	// Reschedule whenever the task is replaced, as its cron expression or time zone may have changed
+	if existingTask != task {
 		// Remove the old schedule
 		if entryID, found := ss.entryIDs[task.ID]; found {
 			ss.cronScheduler.Remove(entryID)
 			delete(ss.entryIDs, task.ID)
 		}
+		ss.drift.unschedule(task.ID)
 
 		// Add the new schedule if the task is active
 		if task.Active {
-			entryID, err := ss.cronScheduler.AddFunc(task.CronExpression, func() {
-				ss.executeScheduledTask(task)
-			})
+			entryID, err := ss.addCronEntry(task)
 			if err != nil {
 				return fmt.Errorf("failed to reschedule task: %w", err)
 			}
@@ -365,7 +568,9 @@ func (ss *SchedulerService) UpdateTask(task *models.ScheduledTask) error {
 
 	// Update the task
 	task.UpdatedAt = time.Now()
-	ss.tasks[task.ID] = task
+	if err := ss.taskStore.SaveTask(task); err != nil {
+		return err
+	}
 
 	ss.logger.Info("task updated",
 		zap.String("task_id", task.ID),
@@ -374,150 +579,1183 @@ func (ss *SchedulerService) UpdateTask(task *models.ScheduledTask) error {
 	return nil
 }
 
-// GetTask returns a specific task by its ID
+// GetTask returns a snapshot of a specific task by its ID, which the task's runs do not change
+// under the caller
 func (ss *SchedulerService) GetTask(taskID string) (*models.ScheduledTask, error) {
 	ss.mutex.RLock()
 	defer ss.mutex.RUnlock()
 
-	task, exists := ss.tasks[taskID]
-	if !exists {
-		return nil, fmt.Errorf("task with ID %s not found", taskID)
+	task, err := ss.taskStore.GetTask(taskID)
+	if err != nil {
+		return nil, err
 	}
+	snapshot := *task
+	return &snapshot, nil
+}
 
-	return task, nil
+// CancelActiveRuns cancels the queued, starting and running executions of the task's scheduled and
+// manual runs, fanned-out ones included, so the task stops doing anything until it next fires
+func (ss *SchedulerService) CancelActiveRuns(taskID, requestedBy string) (*models.CancelAllResult, error) {
+	if _, err := ss.GetTask(taskID); err != nil {
+		return nil, err
+	}
+
+	result := ss.executionService.CancelActiveExecutions(ExecutionFilter{TaskID: taskID}, "active runs of task cancelled", requestedBy)
+	result.TaskID = taskID
+	ss.logger.Info("cancelled active runs of task",
+		zap.String("task_id", taskID),
+		zap.Int("matched", result.Matched),
+		zap.Int("cancelled", result.Cancelled),
+		zap.String("requested_by", requestedBy))
+	return result, nil
 }
 
-// validateTask validates a task before scheduling
+// validateTask validates a task before scheduling, returning every problem found as
+// models.ValidationErrors
 func (ss *SchedulerService) validateTask(task *models.ScheduledTask) error {
-	if task.ID == "" {
-		return fmt.Errorf("task ID cannot be empty")
+	// The definition itself is checked as supervisorctl lint checks it
+	errs := definitions.ValidateTask(task)
+
+	if task.Timeout > 0 && ss.maxTaskTimeout > 0 && time.Duration(task.Timeout)*time.Second > ss.maxTaskTimeout {
+		errs.Add("timeout", models.ValidationOutOfRange,
+			fmt.Sprintf("timeout of %ds exceeds the maximum task timeout of %s", task.Timeout, ss.maxTaskTimeout))
 	}
 
-	if task.AgentID == "" {
-		return fmt.Errorf("agent ID cannot be empty")
+	switch {
+	case task.PipelineID != "" && task.AgentID != "":
+		// Already reported
+	case task.PipelineID != "" && ss.pipelineService == nil:
+		errs.Add("pipeline_id", models.ValidationUnavailable,
+			fmt.Sprintf("pipeline %s cannot be scheduled, pipelines are not enabled", task.PipelineID))
+	case task.PipelineID != "":
+		if _, err := ss.pipelineService.GetPipeline(task.PipelineID); err != nil {
+			errs.AddError("pipeline_id", models.ValidationNotFound, err)
+		}
+	case task.AgentID != "":
+		// Check if agent exists
+		if _, err := ss.agentService.GetAgent(task.AgentID); err != nil {
+			errs.AddError("agent_id", models.ValidationNotFound, fmt.Errorf("agent not found: %w", err))
+		}
 	}
 
-	if task.CronExpression == "" {
-		return fmt.Errorf("cron expression cannot be empty")
+	for i, name := range task.SkipCalendars {
+		field := fmt.Sprintf("skip_calendars[%d]", i)
+		switch {
+		case name == "":
+			// Already reported
+		case ss.calendars == nil:
+			errs.Add(field, models.ValidationUnavailable,
+				fmt.Sprintf("calendar %s cannot be skipped, calendars are not enabled", name))
+		default:
+			if _, err := ss.calendars.GetCalendar(name); err != nil {
+				errs.AddError(field, models.ValidationNotFound, err)
+			}
+		}
 	}
 
-	// Validate cron expression
-	_, err := cron.ParseStandard(task.CronExpression)
+	return errs.Err()
+}
+
+// parseSchedule parses a task's cron expression evaluated in its time zone, or the scheduler's
+// when it names none
+func (ss *SchedulerService) parseSchedule(task *models.ScheduledTask) (cron.Schedule, error) {
+	return TaskSchedule(task, ss.location)
+}
+
+// addCronEntry registers a task with the cron scheduler using its parsed schedule
+func (ss *SchedulerService) addCronEntry(task *models.ScheduledTask) (cron.EntryID, error) {
+	schedule, err := ss.parseSchedule(task)
 	if err != nil {
-		return fmt.Errorf("invalid cron expression: %w", err)
+		return 0, err
 	}
 
-	// Check if agent exists
-	_, err = ss.agentService.GetAgent(task.AgentID)
+	// The job fires whatever the task is by then, not the version it was scheduled with
+	taskID := task.ID
+	return ss.cronScheduler.Schedule(ss.drift.track(taskID, schedule), cron.FuncJob(func() {
+		ss.fireScheduledTask(taskID, ss.measureFire(taskID))
+	})), nil
+}
+
+// FireTask fires a task's schedule once now, as its cron entry does, and returns once the run
+// finished. The stored version of the task runs unless it was paused or deleted; the fire is not
+// measured for schedule drift.
+func (ss *SchedulerService) FireTask(taskID string) {
+	ss.fireScheduledTask(taskID, nil)
+}
+
+// GetNextRun returns the next time the task's cron entry fires on a day none of its calendars
+// exclude, or nil when it has none (e.g. paused)
+func (ss *SchedulerService) GetNextRun(taskID string) (*time.Time, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	task, err := ss.taskStore.GetTask(taskID)
 	if err != nil {
-		return fmt.Errorf("agent not found: %w", err)
+		return nil, err
+	}
+
+	entryID, scheduled := ss.entryIDs[taskID]
+	if !scheduled {
+		return nil, nil
+	}
+	entry := ss.cronScheduler.Entry(entryID)
+	if !entry.Valid() {
+		return nil, nil
+	}
+
+	// The cron scheduler only computes Next once it is running
+	schedule := untracked(entry.Schedule)
+	next := entry.Next
+	if next.IsZero() {
+		next = ss.nextFire(task, schedule, time.Now())
+	} else if ss.excluded(task, next) {
+		next = ss.nextFire(task, schedule, next)
+	}
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// MaxNextRuns caps how many upcoming fire times NextRuns computes at once
+const MaxNextRuns = 100
+
+// NextRuns returns the next n times the task's cron entry fires after now, in the task's time zone,
+// leaving out the days its calendars exclude. A paused task has no cron entry and so no upcoming runs.
+func (ss *SchedulerService) NextRuns(taskID string, n int) ([]time.Time, error) {
+	if n <= 0 || n > MaxNextRuns {
+		return nil, models.ValidationError(fmt.Sprintf("count must be between 1 and %d", MaxNextRuns))
+	}
+
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	task, err := ss.taskStore.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []time.Time{}
+	entryID, scheduled := ss.entryIDs[taskID]
+	if !scheduled {
+		return runs, nil
+	}
+	entry := ss.cronScheduler.Entry(entryID)
+	if !entry.Valid() {
+		return runs, nil
+	}
+
+	schedule := untracked(entry.Schedule)
+	for next := ss.nextFire(task, schedule, time.Now()); !next.IsZero() && len(runs) < n; next = ss.nextFire(task, schedule, next) {
+		runs = append(runs, next)
+	}
+	return runs, nil
+}
+
+// nextFire returns the first fire of a task's schedule after from on a day none of its calendars
+// exclude, or the zero time when there is none within maxExcludedFires fires; callers hold the mutex
+func (ss *SchedulerService) nextFire(task *models.ScheduledTask, schedule cron.Schedule, from time.Time) time.Time {
+	next := schedule.Next(from)
+	for skipped := 0; !next.IsZero() && ss.excluded(task, next); skipped++ {
+		if skipped >= maxExcludedFires {
+			return time.Time{}
+		}
+		next = schedule.Next(next)
 	}
+	return next
+}
+
+// excluded reports whether a calendar of the task excludes the day of a fire time; callers hold
+// the mutex
+func (ss *SchedulerService) excluded(task *models.ScheduledTask, t time.Time) bool {
+	_, excluded := ss.calendarExclusion(task, t)
+	return excluded
+}
 
+// calendarExclusion returns the calendar of the task excluding the day of a fire time, taken in the
+// task's time zone; callers hold the mutex
+func (ss *SchedulerService) calendarExclusion(task *models.ScheduledTask, t time.Time) (*models.CalendarExclusion, bool) {
+	if ss.calendars == nil || len(task.SkipCalendars) == 0 {
+		return nil, false
+	}
+	location, err := definitions.TaskLocation(task, ss.location)
+	if err != nil {
+		location = ss.location
+	}
+	return ss.calendars.Exclusion(task.SkipCalendars, t.In(location))
+}
+
+// SetLocation sets the time zone cron expressions are evaluated in; it applies to tasks scheduled
+// afterwards, so set it before loading tasks
+func (ss *SchedulerService) SetLocation(location *time.Location) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.location = location
+}
+
+// Location returns the time zone cron expressions are evaluated in
+func (ss *SchedulerService) Location() *time.Location {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	return ss.location
+}
+
+// Stop stops firing tasks and cancels the runs in progress, without waiting for them to return
+func (ss *SchedulerService) Stop() {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	ss.cronScheduler.Stop()
+	ss.cancel()
+}
+
+// Shutdown stops firing tasks, cancels the runs in progress and waits until they returned or ctx
+// is done, whose error it returns then; tasks can be neither scheduled nor executed afterwards
+func (ss *SchedulerService) Shutdown(ctx context.Context) error {
+	ss.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		ss.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		ss.logger.Info("scheduler shut down")
+		return nil
+	case <-ctx.Done():
+		ss.logger.Warn("scheduler shut down before its runs in progress returned", zap.Error(ctx.Err()))
+		return ctx.Err()
+	}
+}
+
+// checkRunning returns an ErrSchedulerStopped error once the scheduler stopped; the caller holds
+// the mutex
+func (ss *SchedulerService) checkRunning() error {
+	if ss.ctx.Err() != nil {
+		return models.NewKindError(models.ErrSchedulerStopped, "scheduler stopped")
+	}
 	return nil
 }
 
-// executeScheduledTask is called by the cron scheduler to execute a scheduled task
-func (ss *SchedulerService) executeScheduledTask(task *models.ScheduledTask) {
-	ss.logger.Info("executing scheduled task",
+// beginTracking registers a run Shutdown waits for, and returns false instead once the scheduler
+// stopped; the caller calls ss.runs.Done when the run returns
+func (ss *SchedulerService) beginTracking() bool {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	if ss.ctx.Err() != nil {
+		return false
+	}
+	ss.runs.Add(1)
+	return true
+}
+
+// detach returns a context carrying the values of ctx that is cancelled when the scheduler stops
+// instead of when ctx is
+func (ss *SchedulerService) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ss.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// IsRunning reports whether the scheduler fires tasks, i.e. Stop has not been called and it is not
+// on standby
+func (ss *SchedulerService) IsRunning() bool {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	return ss.ctx.Err() == nil && !ss.standby
+}
+
+// IsStandby reports whether the scheduler stands by while another supervisor instance leads
+func (ss *SchedulerService) IsStandby() bool {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	return ss.standby
+}
+
+// SetStandby stops firing tasks while another supervisor instance leads, and starts again once this
+// one leads. Runs in progress finish; tasks are rescheduled from the task store on resuming, since
+// the leader may have changed them meanwhile, and runs missed while no instance led are caught up
+// according to each task's catch-up policy.
+func (ss *SchedulerService) SetStandby(standby bool) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if ss.standby == standby || ss.ctx.Err() != nil {
+		return
+	}
+	ss.standby = standby
+
+	for taskID, entryID := range ss.entryIDs {
+		ss.cronScheduler.Remove(entryID)
+		ss.drift.unschedule(taskID)
+	}
+	ss.entryIDs = make(map[string]cron.EntryID)
+
+	if standby {
+		ss.cronScheduler.Stop()
+		ss.logger.Info("scheduler on standby")
+		return
+	}
+	loaded, err := ss.loadTasks()
+	if err != nil {
+		ss.logger.Error("failed to reschedule stored tasks", zap.Error(err))
+	}
+	ss.cronScheduler.Start()
+	ss.logger.Info("scheduler resumed", zap.Int("tasks", loaded))
+}
+
+// PreviewTaskInput renders the input a run of the task would receive now, without running it
+func (ss *SchedulerService) PreviewTaskInput(taskID string) (string, error) {
+	task, err := ss.GetTask(taskID)
+	if err != nil {
+		return "", err
+	}
+	return ss.taskInput(task)
+}
+
+// taskInput renders the input of a run of the task starting now
+func (ss *SchedulerService) taskInput(task *models.ScheduledTask) (string, error) {
+	ss.mutex.RLock()
+	snapshot := *task
+	ss.mutex.RUnlock()
+
+	return definitions.RenderTaskInput(&snapshot, time.Now())
+}
+
+// PlanTaskOperation checks an action's preconditions and reports its outcome without performing it
+func (ss *SchedulerService) PlanTaskOperation(taskID string, action models.TaskAction) *models.OperationResult {
+	result := &models.OperationResult{Target: taskID, Action: action, Status: models.OperationPending}
+
+	ss.mutex.RLock()
+	task, err := ss.taskStore.GetTask(taskID)
+	var agentID, pipelineID string
+	var selector *models.AgentSelector
+	state := TaskPaused
+	if err == nil {
+		agentID = task.AgentID
+		pipelineID = task.PipelineID
+		selector = task.AgentSelector
+		if task.Active {
+			state = TaskActive
+		}
+	}
+	ss.mutex.RUnlock()
+
+	if err != nil {
+		result.Status = models.OperationFailed
+		result.Message = err.Error()
+		return result
+	}
+	result.CurrentState = string(state)
+	result.ExpectedState = string(state)
+
+	fail := func(err error) *models.OperationResult {
+		result.Status = models.OperationFailed
+		result.Message = err.Error()
+		return result
+	}
+
+	switch action {
+	case models.TaskActionPause:
+		if state == TaskPaused {
+			result.Status = models.OperationSkipped
+			result.Message = "task is already paused"
+			return result
+		}
+		result.ExpectedState = string(TaskPaused)
+
+	case models.TaskActionResume:
+		if state == TaskActive {
+			result.Status = models.OperationSkipped
+			result.Message = "task is already active"
+			return result
+		}
+		if err := ss.checkTaskTarget(agentID, pipelineID, selector); err != nil {
+			return fail(err)
+		}
+		result.ExpectedState = string(TaskActive)
+
+	case models.TaskActionExecute:
+		// Running a task immediately leaves its schedule unchanged
+		if err := ss.checkTaskTarget(agentID, pipelineID, selector); err != nil {
+			return fail(err)
+		}
+
+	case models.TaskActionDelete:
+		result.ExpectedState = "removed"
+
+	default:
+		return fail(fmt.Errorf("unknown task action %q", action))
+	}
+
+	return result
+}
+
+// checkTaskTarget verifies that the pipeline a task targets exists, that its agent selector picks
+// an agent, or else that its agent exists and is enabled
+func (ss *SchedulerService) checkTaskTarget(agentID, pipelineID string, selector *models.AgentSelector) error {
+	if selector != nil {
+		agentIDs, err := ss.fanOutAgents(selector)
+		if err == nil && len(agentIDs) == 0 {
+			err = fmt.Errorf("agent selector matches no enabled agents")
+		}
+		return err
+	}
+	if pipelineID == "" {
+		return ss.checkTaskAgent(agentID)
+	}
+
+	pipelineService := ss.getPipelineService()
+	if pipelineService == nil {
+		return fmt.Errorf("pipeline %s cannot run, pipelines are not enabled", pipelineID)
+	}
+	_, err := pipelineService.GetPipeline(pipelineID)
+	return err
+}
+
+// checkTaskAgent verifies that the agent a task targets exists and is enabled
+func (ss *SchedulerService) checkTaskAgent(agentID string) error {
+	agentConfig, err := ss.agentService.GetAgent(agentID)
+	if err != nil {
+		return fmt.Errorf("agent not found: %w", err)
+	}
+	return checkAgentEnabled(agentConfig)
+}
+
+// GetTaskHistory returns the most recent execution history records for a task
+func (ss *SchedulerService) GetTaskHistory(taskID string, limit int) ([]*models.ExecutionHistory, error) {
+	return ss.historyRepo.GetExecutionHistory(taskID, limit)
+}
+
+// SetPipelineService lets tasks run pipelines instead of single agents
+func (ss *SchedulerService) SetPipelineService(pipelineService IPipelineService) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.pipelineService = pipelineService
+}
+
+// getPipelineService returns the pipeline service, or nil when pipelines are not enabled
+func (ss *SchedulerService) getPipelineService() IPipelineService {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	return ss.pipelineService
+}
+
+// SetMaxTaskTimeout sets the upper bound accepted for task-level timeouts
+func (ss *SchedulerService) SetMaxTaskTimeout(timeout time.Duration) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.maxTaskTimeout = timeout
+}
+
+// taskTimeout returns the task's timeout, falling back to the agent's when unset
+func taskTimeout(task *models.ScheduledTask, agentConfig *models.AgentConfiguration) time.Duration {
+	if task.Timeout > 0 {
+		return time.Duration(task.Timeout) * time.Second
+	}
+	return time.Duration(agentConfig.Timeout) * time.Second
+}
+
+// SetCatchUpInterval sets the delay between consecutive catch-up runs of a task
+func (ss *SchedulerService) SetCatchUpInterval(interval time.Duration) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.catchUpInterval = interval
+}
+
+// missedRuns returns how many catch-up runs the task's policy calls for at now
+func (ss *SchedulerService) missedRuns(task *models.ScheduledTask, now time.Time) int {
+	if task.LastScheduledRun == nil || task.CatchUpPolicy == "" || task.CatchUpPolicy == types.CatchUpPolicyNone {
+		return 0
+	}
+
+	schedule, err := ss.parseSchedule(task)
+	if err != nil {
+		return 0
+	}
+
+	limit := task.MaxCatchUpRuns
+	if limit == 0 {
+		limit = defaultMaxCatchUpRuns
+	}
+	if task.CatchUpPolicy == types.CatchUpPolicyRunOnce {
+		limit = 1
+	}
+
+	missed := 0
+	for next := schedule.Next(*task.LastScheduledRun); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		// Fires on excluded days would have been skipped anyway
+		if ss.excluded(task, next) {
+			continue
+		}
+		missed++
+		if missed >= limit {
+			break
+		}
+	}
+
+	return missed
+}
+
+// runCatchUp executes missed runs of a task one after another, spaced by the catch-up interval
+func (ss *SchedulerService) runCatchUp(task *models.ScheduledTask, count int) {
+	ss.logger.Info("catching up missed scheduled runs",
 		zap.String("task_id", task.ID),
-		zap.String("agent_id", task.AgentID))
+		zap.String("catch_up_policy", string(task.CatchUpPolicy)),
+		zap.Int("runs", count))
 
-	// Get the agent configuration
-	agentConfig, err := ss.agentService.GetAgent(task.AgentID)
+	ss.runSpaced(task, types.TaskTriggerTypeCatchUp, count)
+}
+
+// runDeferred executes the runs of a task that calendars deferred, one after another, spaced by
+// the catch-up interval
+func (ss *SchedulerService) runDeferred(task *models.ScheduledTask, count int) {
+	ss.logger.Info("running scheduled runs deferred by calendars",
+		zap.String("task_id", task.ID),
+		zap.Int("runs", count))
+
+	ss.runSpaced(task, types.TaskTriggerTypeDeferred, count)
+}
+
+// runSpaced executes count runs of a task one after another, spaced by the catch-up interval
+func (ss *SchedulerService) runSpaced(task *models.ScheduledTask, trigger types.TaskTriggerType, count int) {
+	ss.mutex.RLock()
+	interval := ss.catchUpInterval
+	ss.mutex.RUnlock()
+
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ss.ctx.Done():
+				return
+			}
+		}
+		ss.executeScheduledTask(task, trigger, nil)
+	}
+}
+
+// SetTaskStore replaces the store keeping the scheduled tasks; it is set before tasks are scheduled,
+// and LoadTasks schedules the tasks it holds already
+func (ss *SchedulerService) SetTaskStore(store models.TaskStore) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.taskStore = store
+}
+
+// LoadTasks adds the cron entries of the active tasks in the task store that are not scheduled yet,
+// such as tasks a previous run of the supervisor stored, and returns how many it scheduled
+func (ss *SchedulerService) LoadTasks() (int, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.loadTasks()
+}
+
+// loadTasks schedules the stored tasks for LoadTasks; missed runs are only caught up off standby.
+// Callers hold the mutex.
+func (ss *SchedulerService) loadTasks() (int, error) {
+	tasks, err := ss.taskStore.ListTasks()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored tasks: %w", err)
+	}
+
+	loaded := 0
+	for _, task := range tasks {
+		if _, scheduled := ss.entryIDs[task.ID]; scheduled || !task.Active {
+			continue
+		}
+		entryID, err := ss.addCronEntry(task)
+		if err != nil {
+			ss.logger.Error("failed to schedule stored task", zap.String("task_id", task.ID), zap.Error(err))
+			continue
+		}
+		ss.entryIDs[task.ID] = entryID
+		loaded++
+
+		if missed := ss.missedRuns(task, time.Now()); missed > 0 && !ss.standby {
+			go ss.runCatchUp(task, missed)
+		}
+	}
+	return loaded, nil
+}
+
+// saveTaskRun applies update, the run bookkeeping of a task, to the task's stored version and
+// writes it back; callers hold the mutex. Re-reading the task keeps updates made while it ran, and a
+// task unscheduled while it ran is not stored again.
+func (ss *SchedulerService) saveTaskRun(taskID string, update func(task *models.ScheduledTask)) {
+	task, err := ss.taskStore.GetTask(taskID)
 	if err != nil {
-		ss.logger.Error("agent not found for scheduled task",
+		return
+	}
+	update(task)
+	if err := ss.taskStore.SaveTask(task); err != nil && !errors.Is(err, models.ErrTaskNotFound) {
+		ss.logger.Error("failed to store task", zap.String("task_id", taskID), zap.Error(err))
+	}
+}
+
+// SetHistoryRepository replaces the repository used to record scheduled runs
+func (ss *SchedulerService) SetHistoryRepository(repo models.ExecutionHistoryRepository) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.historyRepo = repo
+}
+
+// SetEventBus sets the bus finished task runs are published on
+func (ss *SchedulerService) SetEventBus(bus *EventBus) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.events = bus
+}
+
+// SetMaintenanceService sets the maintenance windows during which scheduled runs of the tasks of
+// an agent are skipped
+func (ss *SchedulerService) SetMaintenanceService(maintenance *MaintenanceService) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.maintenance = maintenance
+}
+
+// SetCalendarService sets the calendars whose days the tasks skipping them do not run on
+func (ss *SchedulerService) SetCalendarService(calendars ICalendarService) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.calendars = calendars
+}
+
+// fireScheduledTask is called by the cron scheduler when a task's schedule fires, with the measured
+// fire or nil. A fire on a day one of the task's calendars excludes is skipped, or deferred to run
+// after the task's next fire on a day none excludes when the task defers skipped runs.
+func (ss *SchedulerService) fireScheduledTask(taskID string, fire *scheduledFire) {
+	task, ok := ss.firedTask(taskID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	planned := now
+	if fire != nil {
+		planned = fire.planned
+	}
+
+	ss.mutex.Lock()
+	exclusion, excluded := ss.calendarExclusion(task, planned)
+	deferred := 0
+	ss.saveTaskRun(taskID, func(stored *models.ScheduledTask) {
+		stored.LastScheduledRun = &now
+		switch {
+		case excluded && stored.DeferOnSkip:
+			limit := stored.MaxCatchUpRuns
+			if limit == 0 {
+				limit = defaultMaxCatchUpRuns
+			}
+			if stored.DeferredRuns < limit {
+				stored.DeferredRuns++
+			}
+		case !excluded:
+			deferred = stored.DeferredRuns
+			stored.DeferredRuns = 0
+		}
+	})
+	ss.mutex.Unlock()
+
+	if excluded {
+		ss.skipExcludedFire(task, fire, exclusion)
+		return
+	}
+
+	ss.executeScheduledTask(task, types.TaskTriggerTypeScheduled, fire)
+	if deferred > 0 {
+		ss.runDeferred(task, deferred)
+	}
+}
+
+// firedTask returns a snapshot of the current version of a task whose schedule fired, or false when
+// the task was deleted or paused since and the fire is skipped
+func (ss *SchedulerService) firedTask(taskID string) (*models.ScheduledTask, bool) {
+	ss.mutex.RLock()
+	task, err := ss.taskStore.GetTask(taskID)
+	var snapshot models.ScheduledTask
+	if err == nil {
+		snapshot = *task
+	}
+	ss.mutex.RUnlock()
+	if err != nil {
+		ss.logger.Info("skipping scheduled task run, task no longer exists",
+			zap.String("task_id", taskID),
+			zap.Error(err))
+		return nil, false
+	}
+	if !snapshot.Active {
+		ss.logger.Info("skipping scheduled task run, task is paused",
+			zap.String("task_id", taskID))
+		return nil, false
+	}
+	return &snapshot, true
+}
+
+// skipExcludedFire records a fire of a task that one of its calendars excludes
+func (ss *SchedulerService) skipExcludedFire(task *models.ScheduledTask, fire *scheduledFire, exclusion *models.CalendarExclusion) {
+	message := "skipped: " + exclusion.String()
+	if task.DeferOnSkip {
+		message = "deferred: " + exclusion.String() + "; runs after the next fire on a day no calendar excludes"
+	}
+	ss.logger.Info("skipping scheduled task run, day is excluded by a calendar",
+		zap.String("task_id", task.ID),
+		zap.String("calendar", exclusion.Calendar),
+		zap.String("date", exclusion.Date),
+		zap.String("reason", exclusion.Reason),
+		zap.Bool("deferred", task.DeferOnSkip))
+
+	now := time.Now()
+	ss.recordHistory(task, types.TaskTriggerTypeScheduled, fire, &models.ExecutionHistory{
+		ExecutionID: generateExecutionID(),
+		StartTime:   now,
+		EndTime:     now,
+		Status:      types.SkippedStatus,
+		Error:       message,
+		SkipReason:  models.SkipReasonCalendar,
+	})
+}
+
+// executeScheduledTask runs a task, applying its overlap policy; fire is the fire of the task's
+// schedule that started the run, nil for catch-up runs
+func (ss *SchedulerService) executeScheduledTask(task *models.ScheduledTask, trigger types.TaskTriggerType, fire *scheduledFire) {
+	// Fires the cron scheduler started before it stopped do not run
+	if !ss.beginTracking() {
+		ss.logger.Info("skipping scheduled task run, scheduler stopped",
+			zap.String("task_id", task.ID))
+		return
+	}
+	defer ss.runs.Done()
+
+	policy := task.GetOverlapPolicy()
+
+	// Runs of a disabled agent's tasks are skipped until it is enabled again
+	if ss.agentDisabled(task) {
+		ss.logger.Warn("skipping scheduled task run, agent is disabled",
+			zap.String("task_id", task.ID),
+			zap.String("agent_id", task.AgentID))
+		now := time.Now()
+		ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+			ExecutionID: generateExecutionID(),
+			StartTime:   now,
+			EndTime:     now,
+			Status:      types.SkippedStatus,
+			Error:       fmt.Sprintf("skipped: agent %s is disabled", task.AgentID),
+			SkipReason:  models.SkipReasonAgentDisabled,
+		})
+		return
+	}
+
+	// So are runs during the agent's maintenance windows
+	if period, ok := ss.agentInMaintenance(task); ok {
+		ss.logger.Info("skipping scheduled task run, agent is in maintenance",
 			zap.String("task_id", task.ID),
 			zap.String("agent_id", task.AgentID),
-			zap.Error(err))
+			zap.Time("until", period.End),
+			zap.String("reason", period.Reason))
+		now := time.Now()
+		ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+			ExecutionID: generateExecutionID(),
+			StartTime:   now,
+			EndTime:     now,
+			Status:      types.SkippedStatus,
+			Error:       fmt.Sprintf("skipped: agent %s is in maintenance until %s", task.AgentID, period.End.Format(time.RFC3339)),
+			SkipReason:  models.SkipReasonMaintenance,
+		})
 		return
 	}
 
-	// Create an agent instance
-	agent := &ScheduledAgent{
-		config: agentConfig,
-		logger: ss.logger,
+	switch ss.beginRun(task.ID, policy, queuedRun{trigger: trigger, fire: fire}) {
+	case runSkipped:
+		ss.logger.Warn("skipping scheduled task run, previous run still in progress",
+			zap.String("task_id", task.ID),
+			zap.String("agent_id", task.AgentID),
+			zap.String("overlap_policy", string(policy)))
+		now := time.Now()
+		ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+			ExecutionID: generateExecutionID(),
+			StartTime:   now,
+			EndTime:     now,
+			Status:      types.SkippedStatus,
+			Error:       "skipped: previous run still in progress",
+			SkipReason:  models.SkipReasonOverlap,
+		})
+		return
+	case runQueued:
+		ss.logger.Info("queued scheduled task run behind in-flight run",
+			zap.String("task_id", task.ID),
+			zap.String("agent_id", task.AgentID))
+		return
 	}
 
-	// Execute the agent with the task's input parameters
-	input := ss.buildInputFromParameters(task.InputParameters)
+	for {
+		ss.runScheduledTask(task, trigger, fire)
+		next, queued := ss.finishRun(task.ID)
+		if !queued {
+			return
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(agentConfig.Timeout)*time.Second)
-	defer cancel()
+		// Queued runs are dropped once the scheduler stopped or the task was paused or deleted; the
+		// others run the task as stored when they start, with the trigger and fire that queued them
+		var current *models.ScheduledTask
+		ok := false
+		if ss.ctx.Err() == nil {
+			current, ok = ss.firedTask(task.ID)
+		}
+		if !ok {
+			for queued {
+				_, queued = ss.finishRun(task.ID)
+			}
+			return
+		}
+		task, trigger, fire = current, next.trigger, next.fire
+	}
+}
+
+// agentDisabled reports whether the task runs a single agent that is disabled
+func (ss *SchedulerService) agentDisabled(task *models.ScheduledTask) bool {
+	if task.PipelineID != "" || task.IsFanOut() {
+		return false
+	}
+	return errors.Is(ss.checkTaskAgent(task.AgentID), models.ErrAgentDisabled)
+}
+
+// agentInMaintenance reports whether the task runs a single agent that is in maintenance, and the
+// maintenance period it is in
+func (ss *SchedulerService) agentInMaintenance(task *models.ScheduledTask) (*models.MaintenancePeriod, bool) {
+	ss.mutex.RLock()
+	maintenance := ss.maintenance
+	ss.mutex.RUnlock()
+
+	if maintenance == nil || task.PipelineID != "" || task.IsFanOut() {
+		return nil, false
+	}
+	return maintenance.InMaintenance(task.AgentID)
+}
+
+// beginRun applies the overlap policy and registers a run for the task when it may start, or queues
+// run when the policy says so
+func (ss *SchedulerService) beginRun(taskID string, policy types.OverlapPolicy, run queuedRun) runDecision {
+	ss.runMutex.Lock()
+	defer ss.runMutex.Unlock()
+
+	state, exists := ss.runStates[taskID]
+	if !exists {
+		state = &taskRunState{}
+		ss.runStates[taskID] = state
+	}
 
-	execution, err := ss.executionService.ExecuteAgent(ctx, agent, input)
+	if state.running > 0 {
+		switch policy {
+		case types.OverlapPolicyAllow:
+			// Fall through and start a concurrent run
+		case types.OverlapPolicyQueue:
+			if len(state.queued) < maxQueuedRuns {
+				state.queued = append(state.queued, run)
+				return runQueued
+			}
+			return runSkipped
+		default:
+			return runSkipped
+		}
+	}
+
+	state.running++
+	return runNow
+}
+
+// finishRun releases a run slot; it returns the queued run that should start in its place, or
+// false when none is queued
+func (ss *SchedulerService) finishRun(taskID string) (queuedRun, bool) {
+	ss.runMutex.Lock()
+	defer ss.runMutex.Unlock()
+
+	state := ss.runStates[taskID]
+	if len(state.queued) > 0 {
+		next := state.queued[0]
+		state.queued = state.queued[1:]
+		return next, true
+	}
+
+	state.running--
+	if state.running == 0 {
+		delete(ss.runStates, taskID)
+	}
+	return queuedRun{}, false
+}
+
+// recordHistory completes and stores a history record for a scheduled run, with the fire that
+// started it if any
+func (ss *SchedulerService) recordHistory(task *models.ScheduledTask, trigger types.TaskTriggerType, fire *scheduledFire, history *models.ExecutionHistory) {
+	ss.mutex.RLock()
+	repo := ss.historyRepo
+	events := ss.events
+	ss.mutex.RUnlock()
+
+	if history.ID == "" {
+		history.ID = taskHistoryID(task.ID)
+	}
+	history.TaskID = task.ID
+	history.ExecutionTimeMs = history.EndTime.Sub(history.StartTime).Milliseconds()
+	history.TriggerType = trigger
+	history.TriggeredBy = SchedulerTriggeredBy(task.ID)
+	fire.apply(history)
+	history.Labels = task.Labels
+	history.CreatedAt = time.Now()
+
+	if err := repo.StoreExecutionHistory(history); err != nil {
+		ss.logger.Error("failed to store execution history",
+			zap.String("task_id", task.ID),
+			zap.Error(err))
+	}
+
+	agentID := history.AgentID
+	if agentID == "" {
+		agentID = task.AgentID
+	}
+	events.Publish(models.Event{
+		Type:        models.EventTaskRun,
+		AgentID:     agentID,
+		ExecutionID: history.ExecutionID,
+		TaskID:      task.ID,
+		Data:        history,
+	})
+}
+
+// runScheduledTask executes a single run of a scheduled task
+func (ss *SchedulerService) runScheduledTask(task *models.ScheduledTask, trigger types.TaskTriggerType, fire *scheduledFire) {
+	ss.logger.Info("executing scheduled task",
+		zap.String("task_id", task.ID),
+		zap.String("agent_id", task.AgentID),
+		zap.String("pipeline_id", task.PipelineID),
+		zap.String("trigger_type", string(trigger)))
+
+	// Execute the agent or pipeline with the task's rendered input; a template that fails to
+	// render fails the run instead of reaching the agent unrendered
+	input, err := ss.taskInput(task)
 	if err != nil {
+		ss.logger.Error("failed to render scheduled task input",
+			zap.String("task_id", task.ID),
+			zap.Error(err))
+		now := time.Now()
+		ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+			ExecutionID: generateExecutionID(),
+			StartTime:   now,
+			EndTime:     now,
+			Status:      types.FailureStatus,
+			Error:       err.Error(),
+		})
+		return
+	}
+	if task.IsFanOut() {
+		ss.runFanOutTask(task, trigger, input, fire)
+		return
+	}
+	run, timeout, err := ss.taskRunner(task, input)
+	if err != nil {
+		ss.logger.Error("target not found for scheduled task",
+			zap.String("task_id", task.ID),
+			zap.String("agent_id", task.AgentID),
+			zap.String("pipeline_id", task.PipelineID),
+			zap.Error(err))
+		return
+	}
+
+	var executionID string
+	for attempt := 0; attempt <= task.MaxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(task.RetryBackoff*attempt) * time.Second
+			ss.logger.Info("retrying scheduled task",
+				zap.String("task_id", task.ID),
+				zap.Int("attempt", attempt+1),
+				zap.Duration("backoff", backoff))
+
+			select {
+			case <-time.After(backoff):
+			case <-ss.ctx.Done():
+				return
+			}
+		}
+
+		startTime := time.Now()
+		runCtx := WithExecutionTask(WithExecutionTrigger(WithExecutionLabels(ss.ctx, task.Labels), trigger, SchedulerTriggeredBy(task.ID)), task.ID)
+		ctx, cancel := attemptContext(runCtx, timeout)
+		var status types.ExecutionStatus
+		executionID, status, err = run(ctx)
+		timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		if err == nil {
+			finished := time.Now()
+			ss.mutex.Lock()
+			ss.saveTaskRun(task.ID, func(stored *models.ScheduledTask) { stored.LastExecution = &finished })
+			ss.mutex.Unlock()
+
+			ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+				ExecutionID: executionID,
+				StartTime:   startTime,
+				EndTime:     time.Now(),
+				Status:      status,
+				Input:       input,
+				RetryCount:  attempt,
+			})
+			break
+		}
+
+		status = types.FailureStatus
+		if timedOut {
+			status = types.TimeoutStatus
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+
 		ss.logger.Error("scheduled task execution failed",
 			zap.String("task_id", task.ID),
 			zap.String("agent_id", task.AgentID),
+			zap.String("pipeline_id", task.PipelineID),
+			zap.Int("attempt", attempt+1),
 			zap.Error(err))
+
+		if executionID == "" {
+			executionID = generateExecutionID()
+		}
+		ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+			ExecutionID: executionID,
+			StartTime:   startTime,
+			EndTime:     time.Now(),
+			Status:      status,
+			Input:       input,
+			Error:       err.Error(),
+			RetryCount:  attempt,
+		})
+	}
+
+	if err != nil {
 		return
 	}
 
 	ss.logger.Info("scheduled task execution completed",
 		zap.String("task_id", task.ID),
 		zap.String("agent_id", task.AgentID),
-		zap.String("execution_id", execution.ID))
+		zap.String("pipeline_id", task.PipelineID),
+		zap.String("execution_id", executionID))
 }
 
-// buildInputFromParameters builds an input string from task parameters
-func (ss *SchedulerService) buildInputFromParameters(params map[string]interface{}) string {
-	// In a real implementation, this would construct the input based on the agent type and parameters
-	// For now, we'll just return a simple string representation
-	if params == nil || len(params) == 0 {
-		return ""
-	}
+// taskRun executes one attempt of a scheduled task and returns the ID of the execution it started
+// and, when the attempt succeeded, its status: success, or warning when the agent exited with a
+// code mapped to warning
+type taskRun func(ctx context.Context) (string, types.ExecutionStatus, error)
+
+// taskRunner returns how to run the task's agent or pipeline and the timeout of each attempt,
+// where 0 means none
+func (ss *SchedulerService) taskRunner(task *models.ScheduledTask, input string) (taskRun, time.Duration, error) {
+	if task.PipelineID != "" {
+		pipelineService := ss.getPipelineService()
+		if pipelineService == nil {
+			return nil, 0, fmt.Errorf("pipeline %s cannot run, pipelines are not enabled", task.PipelineID)
+		}
+		if _, err := pipelineService.GetPipeline(task.PipelineID); err != nil {
+			return nil, 0, err
+		}
 
-	input := ""
-	for key, value := range params {
-		input += fmt.Sprintf("%s=%v ", key, value)
+		// Each step is bounded by its agent's timeout; the task's timeout bounds the whole pipeline
+		return func(ctx context.Context) (string, types.ExecutionStatus, error) {
+			execution, err := pipelineService.ExecutePipeline(ctx, task.PipelineID, input, task.Labels)
+			if err != nil {
+				return "", types.FailureStatus, err
+			}
+			if execution.State == types.FailedState {
+				return execution.ID, types.FailureStatus, errors.New(execution.Error)
+			}
+			return execution.ID, types.SuccessStatus, nil
+		}, time.Duration(task.Timeout) * time.Second, nil
 	}
 
-	return input
-}
+	agentConfig, err := ss.agentService.GetAgent(task.AgentID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("agent not found: %w", err)
+	}
 
-// ScheduledAgent is a wrapper to make our agent configuration compatible with the execution service
-type ScheduledAgent struct {
-	config *models.AgentConfiguration
-	logger *zap.Logger
+	// Create an agent instance
+	agent, err := ss.router.CreateAgent(agentConfig)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create agent: %w", err)
+	}
+	return func(ctx context.Context) (string, types.ExecutionStatus, error) {
+		execution, err := ss.router.ExecuteAgent(ctx, agent, input)
+		if execution == nil {
+			return "", types.FailureStatus, err
+		}
+		if err == nil && execution.Status != types.WarningStatus {
+			return execution.ID, types.SuccessStatus, nil
+		}
+		return execution.ID, execution.Status, err
+	}, taskTimeout(task, agentConfig), nil
 }
 
-func (sa *ScheduledAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
-	// In a real implementation, this would execute the actual agent process
-	// For this implementation, we'll return a mock result
-	result := &models.ExecutionResult{
-		ID:        "sched-" + time.Now().Format("20060102-150405"),
-		AgentID:   sa.config.ID,
-		Status:    models.SuccessStatus,
-		Input:     input,
-		Output:    fmt.Sprintf("Executed scheduled command: %s with input: %s", sa.config.ExecutablePath, input),
-		StartTime: time.Now(),
-		EndTime:   time.Now(),
+// attemptContext bounds an attempt by timeout, or only lets it be cancelled when timeout is 0
+func attemptContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
 	}
-	return result, nil
+	return context.WithCancel(parent)
 }
 
-func (sa *ScheduledAgent) GetID() string {
-	return sa.config.ID
-}
+// executePipelineTask runs a pipeline task immediately and reports the pipeline run as its result
+func (ss *SchedulerService) executePipelineTask(parent context.Context, task *models.ScheduledTask) (*models.ExecutionResult, error) {
+	input, err := ss.taskInput(task)
+	if err != nil {
+		return nil, err
+	}
+	run, timeout, err := ss.taskRunner(task, input)
+	if err != nil {
+		return nil, err
+	}
 
-func (sa *ScheduledAgent) GetName() string {
-	return sa.config.Name
-}
+	ctx, cancel := attemptContext(parent, timeout)
+	defer cancel()
 
-func (sa *ScheduledAgent) GetType() string {
-	return sa.config.AgentType
-}
+	startTime := time.Now()
+	executionID, _, err := run(ctx)
+	if executionID == "" {
+		return nil, fmt.Errorf("pipeline execution failed: %w", err)
+	}
+	execution, getErr := ss.getPipelineService().GetPipelineExecution(executionID)
+	if getErr != nil {
+		return nil, getErr
+	}
 
-func (sa *ScheduledAgent) IsReadOnly() bool {
-	return sa.config.AccessType == models.ReadOnlyAccessType
-}
+	// A failed step is part of the result rather than an error, like a failed agent process
+	result := &models.ExecutionResult{
+		ID:            execution.ID,
+		TaskID:        task.ID,
+		StartTime:     startTime,
+		EndTime:       time.Now(),
+		Status:        types.SuccessStatus,
+		Input:         input,
+		Output:        execution.Output,
+		Error:         execution.Error,
+		ExecutionTime: time.Since(startTime).Milliseconds(),
+		Labels:        task.Labels,
+		TriggerType:   execution.TriggerType,
+		TriggeredBy:   execution.TriggeredBy,
+	}
+	if err != nil {
+		result.Status = types.FailureStatus
+	}
 
-func (sa *ScheduledAgent) GetConfig() *models.AgentConfiguration {
-	return sa.config
-}
+	ss.logger.Info("scheduled pipeline task executed",
+		zap.String("task_id", task.ID),
+		zap.String("pipeline_id", task.PipelineID),
+		zap.String("pipeline_execution_id", execution.ID),
+		zap.String("state", string(execution.State)))
 
-func (sa *ScheduledAgent) Validate() error {
-	return sa.config.Validate()
+	return result, nil
 }
 
 // CronLogger adapts zap logger to cron logger interface
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxExecutionBacklog is how many executions may wait to start before the supervisor reports
+// itself not ready
+const DefaultMaxExecutionBacklog = 100
+
+// BuildInfo identifies the running supervisor binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// NewBuildInfo returns the build info of the running binary. version, commit and date are set at
+// link time (see the Makefile); empty ones fall back to the VCS stamp go build embeds.
+func NewBuildInfo(version, commit, date string) BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version()}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range embedded.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+		if info.Version == "" && embedded.Main.Version != "(devel)" {
+			info.Version = embedded.Main.Version
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// MemoryStats is the heap usage of the supervisor process
+type MemoryStats struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"` // Bytes of allocated heap objects
+	HeapSysBytes   uint64 `json:"heap_sys_bytes"`   // Bytes of heap memory obtained from the OS
+	HeapObjects    uint64 `json:"heap_objects"`
+	GCCycles       uint32 `json:"gc_cycles"`
+}
+
+// SchedulerStatus is the state of the task scheduler
+type SchedulerStatus struct {
+	Running     bool   `json:"running"`
+	Tasks       int    `json:"tasks"`
+	ActiveTasks int    `json:"active_tasks"` // Tasks that are not paused
+	Timezone    string `json:"timezone"`
+}
+
+// ServerInfo describes the running supervisor, as returned by GET /api/v1/server/info
+type ServerInfo struct {
+	BuildInfo
+	StartedAt        time.Time               `json:"started_at"`
+	UptimeSeconds    float64                 `json:"uptime_seconds"`
+	Goroutines       int                     `json:"goroutines"`
+	Memory           MemoryStats             `json:"memory"`
+	Agents           int                     `json:"agents"`
+	ActiveExecutions int                     `json:"active_executions"`
+	QueuedExecutions int                     `json:"queued_executions"` // Executions waiting to start
+	Scheduler        SchedulerStatus         `json:"scheduler"`
+	Leadership       models.LeadershipStatus `json:"leadership"` // Always the leader unless leader election is enabled
+}
+
+// ReadinessCheck is the outcome of one readiness check
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	Ready   bool   `json:"ready"`
+	Message string `json:"message,omitempty"` // Why the check failed
+}
+
+// Readiness reports whether the supervisor can take work, as returned by GET /health/ready
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ServerMonitor reports on the supervisor process itself: build, runtime and workload info, and
+// whether it is ready to take work
+type ServerMonitor struct {
+	build            BuildInfo
+	startedAt        time.Time
+	agentService     IAgentService
+	schedulerService ISchedulerService
+	executionService IExecutionService
+	router           *ExecutionRouter
+	collector        *MetricsCollector
+	events           *EventBus
+	elector          *LeaderElector
+	persistenceDirs  []string
+	maxBacklog       int
+	logger           *zap.Logger
+}
+
+// NewServerMonitor creates a ServerMonitor; the supervisor's uptime counts from now
+func NewServerMonitor(build BuildInfo, agentService IAgentService, schedulerService ISchedulerService, executionService IExecutionService, logger *zap.Logger) *ServerMonitor {
+	return &ServerMonitor{
+		build:            build,
+		startedAt:        time.Now(),
+		agentService:     agentService,
+		schedulerService: schedulerService,
+		executionService: executionService,
+		router:           ExecutionRouterFor(executionService, logger),
+		maxBacklog:       DefaultMaxExecutionBacklog,
+		logger:           logger,
+	}
+}
+
+// SetPersistenceDirs sets the directories the supervisor persists state in; readiness requires
+// each to be writable
+func (sm *ServerMonitor) SetPersistenceDirs(dirs ...string) {
+	sm.persistenceDirs = nil
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			sm.persistenceDirs = append(sm.persistenceDirs, dir)
+		}
+	}
+}
+
+// SetMaxExecutionBacklog sets how many executions may wait to start before the supervisor reports
+// itself not ready, 0 for DefaultMaxExecutionBacklog
+func (sm *ServerMonitor) SetMaxExecutionBacklog(max int) {
+	if max <= 0 {
+		max = DefaultMaxExecutionBacklog
+	}
+	sm.maxBacklog = max
+}
+
+// SetMetricsCollector sets the collector whose execution counts the Prometheus metrics include
+func (sm *ServerMonitor) SetMetricsCollector(collector *MetricsCollector) {
+	sm.collector = collector
+}
+
+// SetEventBus sets the event bus whose traffic the Prometheus metrics include
+func (sm *ServerMonitor) SetEventBus(bus *EventBus) {
+	sm.events = bus
+}
+
+// SetLeaderElector sets the elector whose role and lease the server info reports; a follower's
+// scheduler stands by, which readiness accepts
+func (sm *ServerMonitor) SetLeaderElector(elector *LeaderElector) {
+	sm.elector = elector
+}
+
+// Info returns the current build, runtime and workload info of the supervisor
+func (sm *ServerMonitor) Info() ServerInfo {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	info := ServerInfo{
+		BuildInfo:     sm.build,
+		StartedAt:     sm.startedAt,
+		UptimeSeconds: time.Since(sm.startedAt).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			HeapAllocBytes: memory.HeapAlloc,
+			HeapSysBytes:   memory.HeapSys,
+			HeapObjects:    memory.HeapObjects,
+			GCCycles:       memory.NumGC,
+		},
+		QueuedExecutions: sm.router.Backlog(),
+		Leadership:       models.LeadershipStatus{Role: models.LeaderRoleLeader},
+	}
+	if sm.elector != nil {
+		info.Leadership = sm.elector.Status()
+	}
+
+	if agents, err := sm.agentService.ListAgents(); err == nil {
+		info.Agents = len(agents)
+	}
+	if executions, err := sm.executionService.GetActiveExecutions(); err == nil {
+		info.ActiveExecutions = len(executions)
+	}
+	if sm.schedulerService != nil {
+		info.Scheduler.Running = sm.schedulerService.IsRunning()
+		info.Scheduler.Timezone = sm.schedulerService.Location().String()
+		if tasks, err := sm.schedulerService.ListScheduledTasks(); err == nil {
+			info.Scheduler.Tasks = len(tasks)
+			for _, task := range tasks {
+				if task.Active {
+					info.Scheduler.ActiveTasks++
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// Readiness checks that the scheduler is running, every persistence directory is writable and the
+// execution backlog is within its limit
+func (sm *ServerMonitor) Readiness() Readiness {
+	checks := []ReadinessCheck{sm.checkScheduler()}
+	for _, dir := range sm.persistenceDirs {
+		checks = append(checks, checkWritableDir(dir))
+	}
+	checks = append(checks, sm.checkBacklog())
+
+	readiness := Readiness{Ready: true, Checks: checks}
+	for _, check := range checks {
+		if !check.Ready {
+			readiness.Ready = false
+			sm.logger.Warn("readiness check failed",
+				zap.String("check", check.Name),
+				zap.String("reason", check.Message))
+		}
+	}
+	return readiness
+}
+
+// checkScheduler checks that the scheduler fires tasks, unless it stands by on a follower
+func (sm *ServerMonitor) checkScheduler() ReadinessCheck {
+	check := ReadinessCheck{Name: "scheduler", Ready: true}
+	if sm.elector != nil && !sm.elector.IsLeader() {
+		return check
+	}
+	if sm.schedulerService == nil || !sm.schedulerService.IsRunning() {
+		check.Ready = false
+		check.Message = "scheduler is not running"
+	}
+	return check
+}
+
+// checkBacklog checks that no more than the allowed number of executions wait to start
+func (sm *ServerMonitor) checkBacklog() ReadinessCheck {
+	check := ReadinessCheck{Name: "execution_backlog", Ready: true}
+	if backlog := sm.router.Backlog(); backlog > sm.maxBacklog {
+		check.Ready = false
+		check.Message = fmt.Sprintf("%d executions are waiting to start, more than the limit of %d", backlog, sm.maxBacklog)
+	}
+	return check
+}
+
+// checkWritableDir checks that files can be created in dir, creating it if needed. A directory
+// whose mode denies its owner writes counts as read-only even to a superuser, who could otherwise
+// write through it.
+func checkWritableDir(dir string) ReadinessCheck {
+	check := ReadinessCheck{Name: "persistence:" + dir}
+	fail := func(format string, args ...interface{}) ReadinessCheck {
+		check.Message = fmt.Sprintf(format, args...)
+		return check
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fail("cannot create %s: %v", dir, err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fail("cannot access %s: %v", dir, err)
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return fail("%s is read-only", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".ready-*")
+	if err != nil {
+		return fail("%s is not writable: %v", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	check.Ready = true
+	return check
+}
@@ -0,0 +1,763 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
+// Formats a state document can be encoded in
+const (
+	StateFormatJSON = "json"
+	StateFormatYAML = "yaml"
+)
+
+// ParseStateFormat returns the state document format named by format, JSON when it is empty
+func ParseStateFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", StateFormatJSON:
+		return StateFormatJSON, nil
+	case StateFormatYAML, "yml":
+		return StateFormatYAML, nil
+	}
+	return "", models.ValidationError(fmt.Sprintf("unknown format %q, expected json or yaml", format))
+}
+
+// EncodeStateDocument encodes doc as JSON or YAML. The YAML form has the same field names as the
+// JSON one.
+func EncodeStateDocument(doc *models.StateDocument, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state document: %w", err)
+	}
+	if format != StateFormatYAML {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to encode state document: %w", err)
+	}
+	data, err = yaml.Marshal(yamlNumbers(tree))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state document: %w", err)
+	}
+	return data, nil
+}
+
+// DecodeStateDocument decodes a JSON or YAML state document and checks its version
+func DecodeStateDocument(data []byte, format string) (*models.StateDocument, error) {
+	if format == StateFormatYAML {
+		var tree interface{}
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, models.ValidationError(fmt.Sprintf("invalid state document: %v", err))
+		}
+		converted, err := json.Marshal(tree)
+		if err != nil {
+			return nil, models.ValidationError(fmt.Sprintf("invalid state document: %v", err))
+		}
+		data = converted
+	}
+
+	var doc models.StateDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, models.ValidationError(fmt.Sprintf("invalid state document: %v", err))
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// yamlNumbers replaces the JSON numbers of a decoded JSON tree with integers or floats, so that YAML
+// writes them as numbers rather than strings
+func yamlNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = yamlNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlNumbers(item)
+		}
+	}
+	return value
+}
+
+// agentValidator is implemented by agent services that validate a configuration without storing it
+type agentValidator interface {
+	ValidateAgentConfiguration(config *models.AgentConfiguration) error
+}
+
+// StateService exports the supervisor's agents, templates, pipelines and scheduled tasks as a state
+// document, and imports such documents for migration and restore
+type StateService struct {
+	agentService     IAgentService
+	templateService  IAgentTemplateService
+	schedulerService ISchedulerService
+	pipelineService  IPipelineService
+	historyRepo      models.ExecutionHistoryRepository
+	mutex            sync.Mutex // Serializes imports
+	logger           *zap.Logger
+}
+
+// NewStateService creates a StateService. templateService may be nil when agent templates are not
+// served, in which case agents are exported with their settings merged.
+func NewStateService(agentService IAgentService, templateService IAgentTemplateService, schedulerService ISchedulerService, logger *zap.Logger) *StateService {
+	return &StateService{
+		agentService:     agentService,
+		templateService:  templateService,
+		schedulerService: schedulerService,
+		logger:           logger,
+	}
+}
+
+// SetPipelineService lets pipelines be exported and imported
+func (s *StateService) SetPipelineService(pipelineService IPipelineService) {
+	s.pipelineService = pipelineService
+}
+
+// SetHistoryRepository sets the repository imported execution history is stored in
+func (s *StateService) SetHistoryRepository(repo models.ExecutionHistoryRepository) {
+	s.historyRepo = repo
+}
+
+// Export returns the current state, each kind of item ordered by ID, with the execution history of
+// every task when includeHistory is set
+func (s *StateService) Export(includeHistory bool) (*models.StateDocument, error) {
+	state, err := s.currentState()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &models.StateDocument{
+		Version:    models.StateDocumentVersion,
+		ExportedAt: time.Now().UTC(),
+		Templates:  state.templateList(),
+		Agents:     state.agentList(),
+		Pipelines:  state.pipelineList(),
+		Tasks:      state.taskList(),
+	}
+	// Secrets stay on this server; importing the document here again keeps their current values
+	for i, template := range doc.Templates {
+		doc.Templates[i] = template.Masked()
+	}
+	for i, agent := range doc.Agents {
+		doc.Agents[i] = agent.Masked()
+	}
+
+	if includeHistory {
+		for _, task := range doc.Tasks {
+			history, err := s.schedulerService.GetTaskHistory(task.ID, 0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export history of task %s: %w", task.ID, err)
+			}
+			for _, record := range history {
+				copied := *record
+				doc.History = append(doc.History, &copied)
+			}
+		}
+	}
+
+	s.logger.Info("state exported",
+		zap.Int("templates", len(doc.Templates)),
+		zap.Int("agents", len(doc.Agents)),
+		zap.Int("pipelines", len(doc.Pipelines)),
+		zap.Int("tasks", len(doc.Tasks)),
+		zap.Int("history", len(doc.History)))
+
+	return doc, nil
+}
+
+// Import applies doc to the current state. Merge mode adds the items that do not exist and reports
+// those that differ as conflicts; replace mode also updates differing items and removes the ones the
+// document does not contain. The whole document is validated first, and nothing is applied when any
+// item is invalid.
+func (s *StateService) Import(doc *models.StateDocument, mode models.ImportMode) (*models.ImportResult, error) {
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current, err := s.currentState()
+	if err != nil {
+		return nil, err
+	}
+	imported, err := newStateSnapshot(doc)
+	if err != nil {
+		return nil, err
+	}
+	imported.unmask(current)
+	if err := s.validateImport(imported, current, mode); err != nil {
+		return nil, err
+	}
+
+	result := &models.ImportResult{Mode: mode}
+	replace := mode == models.ImportModeReplace
+
+	// Remove what the document does not contain, dependents first
+	if replace {
+		for _, id := range missingIDs(current.tasks, imported.tasks) {
+			result.Add(importOutcome(models.ImportScopeTask, id, models.ImportRemoved, s.schedulerService.UnscheduleTask(id)))
+		}
+		for _, id := range missingIDs(current.pipelines, imported.pipelines) {
+			result.Add(importOutcome(models.ImportScopePipeline, id, models.ImportRemoved, s.pipelineService.DeletePipeline(id)))
+		}
+		for _, id := range missingIDs(current.agents, imported.agents) {
+			result.Add(importOutcome(models.ImportScopeAgent, id, models.ImportRemoved, s.agentService.DeleteAgent(id)))
+		}
+	}
+
+	for _, template := range imported.templateList() {
+		status, message := planImport(current.templates[template.Name], template, replace)
+		item := models.ImportItem{Scope: models.ImportScopeTemplate, ID: template.Name, Status: status, Message: message}
+		switch status {
+		case models.ImportCreated:
+			item = importOutcome(item.Scope, item.ID, status, s.templateService.CreateTemplate(template))
+		case models.ImportUpdated:
+			item = importOutcome(item.Scope, item.ID, status, s.templateService.UpdateTemplate(template))
+		}
+		result.Add(item)
+	}
+
+	for _, agent := range imported.agentList() {
+		status, message := planImport(current.agents[agent.ID], agent, replace)
+		item := models.ImportItem{Scope: models.ImportScopeAgent, ID: agent.ID, Status: status, Message: message}
+		switch status {
+		case models.ImportCreated:
+			item = importOutcome(item.Scope, item.ID, status, s.agentService.RegisterAgent(agent))
+		case models.ImportUpdated:
+			item = importOutcome(item.Scope, item.ID, status, s.agentService.UpdateAgent(agent))
+		}
+		result.Add(item)
+	}
+
+	if replace {
+		for _, name := range missingIDs(current.templates, imported.templates) {
+			result.Add(importOutcome(models.ImportScopeTemplate, name, models.ImportRemoved, s.templateService.DeleteTemplate(name)))
+		}
+	}
+
+	for _, pipeline := range imported.pipelineList() {
+		status, message := planImport(current.pipelines[pipeline.ID], pipeline, replace)
+		item := models.ImportItem{Scope: models.ImportScopePipeline, ID: pipeline.ID, Status: status, Message: message}
+		switch status {
+		case models.ImportCreated:
+			item = importOutcome(item.Scope, item.ID, status, s.pipelineService.CreatePipeline(pipeline))
+		case models.ImportUpdated:
+			item = importOutcome(item.Scope, item.ID, status, s.pipelineService.UpdatePipeline(pipeline))
+		}
+		result.Add(item)
+	}
+
+	for _, task := range imported.taskList() {
+		status, message := planImport(current.tasks[task.ID], task, replace)
+		item := models.ImportItem{Scope: models.ImportScopeTask, ID: task.ID, Status: status, Message: message}
+		switch status {
+		case models.ImportCreated:
+			item = importOutcome(item.Scope, item.ID, status, s.createTask(task))
+		case models.ImportUpdated:
+			item = importOutcome(item.Scope, item.ID, status, s.schedulerService.UpdateTask(task))
+		}
+		result.Add(item)
+	}
+
+	for _, record := range imported.history {
+		result.Add(s.importHistory(record))
+	}
+
+	s.logger.Info("state imported",
+		zap.String("mode", string(mode)),
+		zap.Int("created", result.Created),
+		zap.Int("updated", result.Updated),
+		zap.Int("skipped", result.Skipped),
+		zap.Int("conflicts", result.Conflicts),
+		zap.Int("removed", result.Removed),
+		zap.Int("failed", result.Failed))
+
+	return result, nil
+}
+
+// createTask schedules an imported task and pauses it again if it was exported paused
+func (s *StateService) createTask(task *models.ScheduledTask) error {
+	active := task.Active
+	if err := s.schedulerService.ScheduleTask(task); err != nil {
+		return err
+	}
+	if !active {
+		return s.schedulerService.PauseTask(task.ID)
+	}
+	return nil
+}
+
+// importHistory stores an execution history record unless a record with its ID is already stored
+func (s *StateService) importHistory(record *models.ExecutionHistory) models.ImportItem {
+	item := models.ImportItem{Scope: models.ImportScopeHistory, ID: record.ID}
+	existing, err := s.historyRepo.GetExecutionHistory(record.TaskID, 0)
+	if err != nil {
+		return importOutcome(item.Scope, item.ID, models.ImportFailed, err)
+	}
+	for _, stored := range existing {
+		if stored.ID == record.ID {
+			item.Status = models.ImportSkipped
+			return item
+		}
+	}
+
+	copied := *record
+	return importOutcome(item.Scope, item.ID, models.ImportCreated, s.historyRepo.StoreExecutionHistory(&copied))
+}
+
+// validateImport checks every item of the document, and that the items it references exist once it
+// is applied. All problems are reported together.
+func (s *StateService) validateImport(imported, current *stateSnapshot, mode models.ImportMode) error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	problems = append(problems, imported.duplicates...)
+
+	// In merge mode items that already exist stay as they are, so references resolve against them
+	// first; in replace mode the document is the whole state.
+	merge := mode == models.ImportModeMerge
+	templateFor := func(name string) *models.AgentTemplate {
+		if existing, ok := current.templates[name]; ok && merge {
+			return existing
+		}
+		return imported.templates[name]
+	}
+	agentExists := func(id string) bool {
+		_, inDocument := imported.agents[id]
+		_, exists := current.agents[id]
+		return inDocument || (merge && exists)
+	}
+	pipelineExists := func(id string) bool {
+		_, inDocument := imported.pipelines[id]
+		_, exists := current.pipelines[id]
+		return inDocument || (merge && exists)
+	}
+
+	if len(imported.templates) > 0 && s.templateService == nil {
+		problem("agent templates cannot be imported, templates are not enabled")
+	}
+	for _, template := range imported.templateList() {
+		if err := template.Validate(); err != nil {
+			problem("template %s: %v", template.Name, err)
+		}
+		if keys := template.Settings.MaskedEnvKeys(); len(keys) > 0 {
+			problem("template %s: environment variables %s hold the masked value %s instead of their real values",
+				template.Name, strings.Join(keys, ", "), models.MaskedValue)
+		}
+	}
+
+	for _, agent := range imported.agentList() {
+		resolved := agent
+		if agent.Template != "" {
+			template := templateFor(agent.Template)
+			if template == nil {
+				problem("agent %s: references unknown template %s", agent.ID, agent.Template)
+				continue
+			}
+			resolved = template.Apply(agent)
+		}
+		if err := s.validateAgent(resolved); err != nil {
+			problem("agent %s: %v", agent.ID, err)
+		}
+	}
+
+	if len(imported.pipelines) > 0 && s.pipelineService == nil {
+		problem("pipelines cannot be imported, pipelines are not enabled")
+	}
+	for _, pipeline := range imported.pipelineList() {
+		if err := pipeline.Validate(); err != nil {
+			problem("pipeline %s: %v", pipeline.ID, err)
+			continue
+		}
+		for i, step := range pipeline.Steps {
+			if !agentExists(step.AgentID) {
+				problem("pipeline %s: step %s references unknown agent %s", pipeline.ID, step.StepName(i), step.AgentID)
+			}
+			if _, err := parameterArgs(step.Parameters); err != nil {
+				problem("pipeline %s: step %s: %v", pipeline.ID, step.StepName(i), err)
+			}
+		}
+	}
+
+	for _, task := range imported.taskList() {
+		if err := s.validateTask(task); err != nil {
+			problem("task %s: %v", task.ID, err)
+			continue
+		}
+		if task.AgentID != "" && !agentExists(task.AgentID) {
+			problem("task %s: references unknown agent %s", task.ID, task.AgentID)
+		}
+		if task.PipelineID != "" && !pipelineExists(task.PipelineID) {
+			problem("task %s: references unknown pipeline %s", task.ID, task.PipelineID)
+		}
+	}
+
+	if len(imported.history) > 0 && s.historyRepo == nil {
+		problem("execution history cannot be imported, no history repository is configured")
+	}
+	for _, record := range imported.history {
+		if err := record.Validate(); err != nil {
+			problem("history %s: %v", record.ID, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return models.ValidationError(fmt.Sprintf("state document is invalid, nothing was imported: %s", strings.Join(problems, "; ")))
+	}
+	return nil
+}
+
+// validateAgent checks an agent configuration the way registering it would
+func (s *StateService) validateAgent(config *models.AgentConfiguration) error {
+	if validator, ok := s.agentService.(agentValidator); ok {
+		return validator.ValidateAgentConfiguration(config)
+	}
+	return config.Validate()
+}
+
+// validateTask checks a scheduled task the way scheduling it would, except for its references
+func (s *StateService) validateTask(task *models.ScheduledTask) error {
+	if err := task.Validate(); err != nil {
+		return err
+	}
+	if _, err := definitions.ParseCronExpression(task.CronExpression); err != nil {
+		return err
+	}
+	if _, err := definitions.TaskLocation(task, s.schedulerService.Location()); err != nil {
+		return err
+	}
+	if err := models.ValidateLabels(task.Labels); err != nil {
+		return err
+	}
+	if task.InputTemplate != "" {
+		return definitions.ValidateTaskInputTemplate(task.InputTemplate)
+	}
+	return nil
+}
+
+// stateSnapshot indexes the items of a state by ID
+type stateSnapshot struct {
+	templates  map[string]*models.AgentTemplate
+	agents     map[string]*models.AgentConfiguration
+	pipelines  map[string]*models.Pipeline
+	tasks      map[string]*models.ScheduledTask
+	history    []*models.ExecutionHistory
+	duplicates []string // Problems with items whose ID is used more than once
+}
+
+// newStateSnapshot indexes copies of the items of doc, so applying them leaves doc untouched
+func newStateSnapshot(doc *models.StateDocument) (*stateSnapshot, error) {
+	for _, items := range []interface{}{doc.Templates, doc.Agents, doc.Pipelines, doc.Tasks, doc.History} {
+		if hasNilItem(items) {
+			return nil, models.ValidationError("state document contains an empty item")
+		}
+	}
+
+	snapshot := &stateSnapshot{
+		templates: make(map[string]*models.AgentTemplate),
+		agents:    make(map[string]*models.AgentConfiguration),
+		pipelines: make(map[string]*models.Pipeline),
+		tasks:     make(map[string]*models.ScheduledTask),
+	}
+	duplicate := func(scope models.ImportScope, id string) {
+		snapshot.duplicates = append(snapshot.duplicates, fmt.Sprintf("%s %s appears more than once", scope, id))
+	}
+
+	for _, template := range doc.Templates {
+		if _, exists := snapshot.templates[template.Name]; exists {
+			duplicate(models.ImportScopeTemplate, template.Name)
+		}
+		copied := *template
+		snapshot.templates[template.Name] = &copied
+	}
+	for _, agent := range doc.Agents {
+		if _, exists := snapshot.agents[agent.ID]; exists {
+			duplicate(models.ImportScopeAgent, agent.ID)
+		}
+		copied := *agent
+		snapshot.agents[agent.ID] = &copied
+	}
+	for _, pipeline := range doc.Pipelines {
+		if _, exists := snapshot.pipelines[pipeline.ID]; exists {
+			duplicate(models.ImportScopePipeline, pipeline.ID)
+		}
+		copied := *pipeline
+		copied.Steps = append([]models.PipelineStep(nil), pipeline.Steps...)
+		snapshot.pipelines[pipeline.ID] = &copied
+	}
+	for _, task := range doc.Tasks {
+		if _, exists := snapshot.tasks[task.ID]; exists {
+			duplicate(models.ImportScopeTask, task.ID)
+		}
+		copied := *task
+		snapshot.tasks[task.ID] = &copied
+	}
+	seen := make(map[string]bool, len(doc.History))
+	for _, record := range doc.History {
+		if seen[record.ID] {
+			duplicate(models.ImportScopeHistory, record.ID)
+		}
+		seen[record.ID] = true
+		snapshot.history = append(snapshot.history, record)
+	}
+
+	return snapshot, nil
+}
+
+// unmask restores the masked secrets of the items from the current items of the same name or ID,
+// so an exported document can be imported again
+func (ss *stateSnapshot) unmask(current *stateSnapshot) {
+	for name, template := range ss.templates {
+		if existing, ok := current.templates[name]; ok {
+			template.Settings.Unmask(&existing.Settings)
+		}
+	}
+	for id, agent := range ss.agents {
+		agent.Unmask(current.agents[id])
+	}
+}
+
+// hasNilItem reports whether a slice of pointers holds a nil pointer
+func hasNilItem(items interface{}) bool {
+	value := reflect.ValueOf(items)
+	for i := 0; i < value.Len(); i++ {
+		if value.Index(i).IsNil() {
+			return true
+		}
+	}
+	return false
+}
+
+// currentState returns copies of the current templates, agents as registered, pipelines and tasks
+func (s *StateService) currentState() (*stateSnapshot, error) {
+	state := &stateSnapshot{
+		templates: make(map[string]*models.AgentTemplate),
+		agents:    make(map[string]*models.AgentConfiguration),
+		pipelines: make(map[string]*models.Pipeline),
+		tasks:     make(map[string]*models.ScheduledTask),
+	}
+
+	if s.templateService != nil {
+		templates, err := s.templateService.ListTemplates()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list agent templates: %w", err)
+		}
+		for _, template := range templates {
+			copied := *template
+			state.templates[template.Name] = &copied
+		}
+	}
+
+	agents, err := s.agentService.ListAgents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+	for _, agent := range agents {
+		spec := *agent
+		if s.templateService != nil {
+			registered, err := s.templateService.GetAgentSpec(agent.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read agent %s: %w", agent.ID, err)
+			}
+			spec = *registered
+		}
+		state.agents[agent.ID] = &spec
+	}
+
+	if s.pipelineService != nil {
+		pipelines, err := s.pipelineService.ListPipelines()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pipelines: %w", err)
+		}
+		for _, pipeline := range pipelines {
+			copied := *pipeline
+			state.pipelines[pipeline.ID] = &copied
+		}
+	}
+
+	tasks, err := s.schedulerService.ListScheduledTasks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled tasks: %w", err)
+	}
+	for _, task := range tasks {
+		copied := *task
+		state.tasks[task.ID] = &copied
+	}
+
+	return state, nil
+}
+
+// templateList returns the templates ordered by name
+func (ss *stateSnapshot) templateList() []*models.AgentTemplate {
+	templates := make([]*models.AgentTemplate, 0, len(ss.templates))
+	for _, name := range sortedKeys(ss.templates) {
+		templates = append(templates, ss.templates[name])
+	}
+	return templates
+}
+
+// agentList returns the agents ordered by ID
+func (ss *stateSnapshot) agentList() []*models.AgentConfiguration {
+	agents := make([]*models.AgentConfiguration, 0, len(ss.agents))
+	for _, id := range sortedKeys(ss.agents) {
+		agents = append(agents, ss.agents[id])
+	}
+	return agents
+}
+
+// pipelineList returns the pipelines ordered by ID
+func (ss *stateSnapshot) pipelineList() []*models.Pipeline {
+	pipelines := make([]*models.Pipeline, 0, len(ss.pipelines))
+	for _, id := range sortedKeys(ss.pipelines) {
+		pipelines = append(pipelines, ss.pipelines[id])
+	}
+	return pipelines
+}
+
+// taskList returns the tasks ordered by ID
+func (ss *stateSnapshot) taskList() []*models.ScheduledTask {
+	tasks := make([]*models.ScheduledTask, 0, len(ss.tasks))
+	for _, id := range sortedKeys(ss.tasks) {
+		tasks = append(tasks, ss.tasks[id])
+	}
+	return tasks
+}
+
+// sortedKeys returns the keys of an item index, sorted
+func sortedKeys[T any](items map[string]T) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// missingIDs returns the IDs of current that imported does not contain, sorted
+func missingIDs[T any](current, imported map[string]T) []string {
+	var missing []string
+	for _, id := range sortedKeys(current) {
+		if _, exists := imported[id]; !exists {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// planImport decides what importing item does given the existing item, nil when there is none
+func planImport[T any](existing *T, item *T, replace bool) (models.ImportStatus, string) {
+	switch {
+	case existing == nil:
+		return models.ImportCreated, ""
+	case sameState(existing, item):
+		return models.ImportSkipped, ""
+	case replace:
+		return models.ImportUpdated, ""
+	}
+	return models.ImportConflict, "differs from the existing item, which was kept"
+}
+
+// importOutcome returns the item outcome of an apply step that reports status unless it failed
+func importOutcome(scope models.ImportScope, id string, status models.ImportStatus, err error) models.ImportItem {
+	if err != nil {
+		return models.ImportItem{Scope: scope, ID: id, Status: models.ImportFailed, Message: err.Error()}
+	}
+	return models.ImportItem{Scope: scope, ID: id, Status: status}
+}
+
+// stateRuntimeFields are the fields that record when or how an item ran rather than how it is
+// configured; they are ignored when deciding whether an imported item differs from an existing one
+var stateRuntimeFields = []string{
+	"created_at", "updated_at",
+	"last_execution", "next_execution", "last_result", "retry_count", "last_scheduled_run",
+}
+
+// sameState reports whether two items are configured the same, ignoring runtime fields and the
+// difference between empty and absent values
+func sameState(a, b interface{}) bool {
+	return reflect.DeepEqual(stateTree(a), stateTree(b))
+}
+
+// stateTree returns the JSON form of an item without its runtime fields and empty values
+func stateTree(item interface{}) interface{} {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil
+	}
+	if fields, ok := tree.(map[string]interface{}); ok {
+		for _, name := range stateRuntimeFields {
+			delete(fields, name)
+		}
+		if settings, ok := fields["settings"].(map[string]interface{}); ok {
+			delete(settings, "created_at")
+			delete(settings, "updated_at")
+		}
+	}
+	return pruneEmpty(tree)
+}
+
+// pruneEmpty removes null, zero and empty values from a decoded JSON tree
+func pruneEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if pruned := pruneEmpty(item); pruned == nil {
+				delete(v, key)
+			} else {
+				v[key] = pruned
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		for i, item := range v {
+			v[i] = pruneEmpty(item)
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	}
+	return value
+}
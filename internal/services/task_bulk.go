@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"go.uber.org/zap"
+)
+
+// BulkTaskOperation applies action to every task the selector picks and reports the outcome per task.
+// Each task is planned first: tasks already in the requested state are skipped, and tasks whose
+// preconditions fail are reported as failed without stopping the rest. With dryRun nothing is
+// performed and the plans are returned. Executions run concurrently; the other actions run in order.
+func (ss *SchedulerService) BulkTaskOperation(ctx context.Context, action models.TaskAction, selector models.TaskSelector, dryRun bool) (*models.BatchOperationResult, error) {
+	switch action {
+	case models.TaskActionPause, models.TaskActionResume, models.TaskActionDelete, models.TaskActionExecute:
+	default:
+		return nil, models.NewKindError(models.ErrInvalidTask, "unknown bulk task action %q, expected pause, resume, delete or execute", action)
+	}
+	if err := selector.Validate(); err != nil {
+		return nil, models.NewKindError(models.ErrInvalidTask, "%s", err.Error())
+	}
+
+	taskIDs := ss.selectTasks(selector)
+	batch := &models.BatchOperationResult{Action: action, DryRun: dryRun, Matched: len(taskIDs), Results: []models.OperationResult{}}
+
+	plans := make([]*models.OperationResult, len(taskIDs))
+	for i, taskID := range taskIDs {
+		plans[i] = ss.PlanTaskOperation(taskID, action)
+	}
+	if !dryRun {
+		if action == models.TaskActionExecute {
+			var wg sync.WaitGroup
+			for _, plan := range plans {
+				if plan.Status != models.OperationPending {
+					continue
+				}
+				wg.Add(1)
+				go func(plan *models.OperationResult) {
+					defer wg.Done()
+					ss.applyTaskOperation(ctx, plan)
+				}(plan)
+			}
+			wg.Wait()
+		} else {
+			for _, plan := range plans {
+				if plan.Status == models.OperationPending {
+					ss.applyTaskOperation(ctx, plan)
+				}
+			}
+		}
+	}
+	for _, plan := range plans {
+		batch.Add(*plan)
+	}
+
+	ss.logger.Info("bulk task operation finished",
+		zap.String("action", string(action)),
+		zap.String("agent_id", selector.AgentID),
+		zap.String("name_pattern", selector.NamePattern),
+		zap.Bool("dry_run", dryRun),
+		zap.Int("matched", batch.Matched),
+		zap.Int("succeeded", batch.Succeeded),
+		zap.Int("skipped", batch.Skipped),
+		zap.Int("failed", batch.Failed))
+
+	return batch, nil
+}
+
+// selectTasks returns the IDs of the tasks the selector picks: the listed IDs in order without
+// repeats, including unknown ones so they are reported, or else the matching tasks sorted by ID
+func (ss *SchedulerService) selectTasks(selector models.TaskSelector) []string {
+	if len(selector.TaskIDs) > 0 {
+		seen := make(map[string]bool, len(selector.TaskIDs))
+		var taskIDs []string
+		for _, taskID := range selector.TaskIDs {
+			if !seen[taskID] {
+				seen[taskID] = true
+				taskIDs = append(taskIDs, taskID)
+			}
+		}
+		return taskIDs
+	}
+
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+
+	tasks, err := ss.taskStore.ListTasks()
+	if err != nil {
+		ss.logger.Error("failed to list tasks", zap.Error(err))
+		return nil
+	}
+
+	var taskIDs []string
+	for _, task := range tasks {
+		if selector.Matches(task) {
+			taskIDs = append(taskIDs, task.ID)
+		}
+	}
+	sort.Strings(taskIDs)
+	return taskIDs
+}
+
+// applyTaskOperation performs a planned operation and records its outcome on the plan
+func (ss *SchedulerService) applyTaskOperation(ctx context.Context, plan *models.OperationResult) {
+	var err error
+	switch plan.Action {
+	case models.TaskActionPause:
+		err = ss.PauseTask(plan.Target)
+	case models.TaskActionResume:
+		err = ss.ResumeTask(plan.Target)
+	case models.TaskActionDelete:
+		err = ss.UnscheduleTask(plan.Target)
+	case models.TaskActionExecute:
+		var result *models.ExecutionResult
+		if result, err = ss.ExecuteTask(ctx, plan.Target); err == nil {
+			plan.Message = fmt.Sprintf("execution %s finished with status %s", result.ID, result.Status)
+		}
+	}
+
+	if err != nil {
+		plan.Status = models.OperationFailed
+		plan.Message = err.Error()
+		return
+	}
+	plan.Status = models.OperationApplied
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"go.uber.org/zap"
+)
+
+// taskHistoryID returns a new ID for a history record of the task
+func taskHistoryID(taskID string) string {
+	return fmt.Sprintf("hist-%s-%d", taskID, time.Now().UnixNano())
+}
+
+// fanOutAgents resolves the agents an agent selector picks, ordered by ID. Listed agents are picked
+// even when they are missing or disabled, so that their runs fail; a pattern picks the enabled
+// agents matching it.
+func (ss *SchedulerService) fanOutAgents(selector *models.AgentSelector) ([]string, error) {
+	if len(selector.AgentIDs) > 0 {
+		agentIDs := append([]string(nil), selector.AgentIDs...)
+		sort.Strings(agentIDs)
+		return agentIDs, nil
+	}
+
+	agents, err := ss.agentService.ListAgents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list agents: %w", err)
+	}
+	var agentIDs []string
+	for _, agent := range agents {
+		if agent.Enabled && selector.Matches(agent.ID) {
+			agentIDs = append(agentIDs, agent.ID)
+		}
+	}
+	return agentIDs, nil
+}
+
+// fanOut runs input against every agent the task's selector picks that is not in maintenance, at
+// most MaxParallel at a time, and decides the status of the run with the task's success policy
+func (ss *SchedulerService) fanOut(ctx context.Context, task *models.ScheduledTask, input string) (*models.FanOutResult, error) {
+	agentIDs, err := ss.fanOutAgents(task.AgentSelector)
+	if err != nil {
+		return nil, err
+	}
+	agentIDs = ss.withoutMaintenance(task, agentIDs)
+
+	parallel := task.MaxParallel
+	if parallel <= 0 || parallel > len(agentIDs) {
+		parallel = len(agentIDs)
+	}
+	results := make([]models.FanOutAgentResult, len(agentIDs))
+	slots := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, agentID := range agentIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = ss.runFanOutAgent(ctx, task, agentID, input)
+		}()
+	}
+	wg.Wait()
+
+	fanOut := &models.FanOutResult{
+		SuccessPolicy: task.GetSuccessPolicy(),
+		MinSuccesses:  task.MinSuccesses,
+		Matched:       len(agentIDs),
+		Results:       []models.FanOutAgentResult{},
+	}
+	for _, result := range results {
+		fanOut.Add(result)
+	}
+	fanOut.Decide()
+	return fanOut, nil
+}
+
+// runFanOutAgent runs input against one agent of a fan-out task, retrying a failed execution up to
+// the task's MaxRetries times
+func (ss *SchedulerService) runFanOutAgent(ctx context.Context, task *models.ScheduledTask, agentID, input string) models.FanOutAgentResult {
+	result := models.FanOutAgentResult{AgentID: agentID, Status: types.FailureStatus}
+
+	agentConfig, err := ss.agentService.GetAgent(agentID)
+	if err == nil {
+		err = checkAgentEnabled(agentConfig)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	agent, err := ss.router.CreateAgent(agentConfig)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create agent: %v", err)
+		return result
+	}
+
+	timeout := taskTimeout(task, agentConfig)
+	for attempt := 0; attempt <= task.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(task.RetryBackoff*attempt) * time.Second):
+			case <-ctx.Done():
+				return result
+			}
+		}
+
+		attemptCtx, cancel := attemptContext(ctx, timeout)
+		execution, err := ss.router.ExecuteAgent(attemptCtx, agent, input)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		result = models.FanOutAgentResult{AgentID: agentID, Status: types.SuccessStatus, RetryCount: attempt}
+		if execution != nil {
+			result.ExecutionID = execution.ID
+			if stored, storedErr := ss.executionService.GetExecutionResult(execution.ID); storedErr == nil {
+				result.Status = stored.Status
+				result.Output = stored.Output
+				result.Error = stored.Error
+			}
+		}
+		if err != nil {
+			result.Status = types.FailureStatus
+			if timedOut {
+				result.Status = types.TimeoutStatus
+				err = fmt.Errorf("timed out after %s: %w", timeout, err)
+			}
+			result.Error = err.Error()
+		}
+		if result.Status.Succeeded() {
+			return result
+		}
+
+		ss.logger.Warn("fan-out task execution failed",
+			zap.String("task_id", task.ID),
+			zap.String("agent_id", agentID),
+			zap.Int("attempt", attempt+1),
+			zap.String("error", result.Error))
+	}
+	return result
+}
+
+// runFanOutTask executes a scheduled run of a fan-out task, recording a parent history entry for
+// the run and a child entry for each agent
+func (ss *SchedulerService) runFanOutTask(task *models.ScheduledTask, trigger types.TaskTriggerType, input string, fire *scheduledFire) {
+	startTime := time.Now()
+	ctx := WithExecutionTask(WithExecutionTrigger(WithExecutionLabels(ss.ctx, task.Labels), trigger, SchedulerTriggeredBy(task.ID)), task.ID)
+	parent := &models.ExecutionHistory{
+		ID:          taskHistoryID(task.ID),
+		ExecutionID: generateExecutionID(),
+		StartTime:   startTime,
+		Input:       input,
+	}
+
+	fanOut, err := ss.fanOut(ctx, task, input)
+	if err != nil {
+		ss.logger.Error("failed to resolve fan-out task agents",
+			zap.String("task_id", task.ID),
+			zap.Error(err))
+		parent.EndTime = time.Now()
+		parent.Status = types.FailureStatus
+		parent.Error = err.Error()
+		ss.recordHistory(task, trigger, fire, parent)
+		return
+	}
+
+	for _, result := range fanOut.Results {
+		ss.recordHistory(task, trigger, fire, &models.ExecutionHistory{
+			ExecutionID: fanOutExecutionID(result),
+			AgentID:     result.AgentID,
+			ParentID:    parent.ID,
+			StartTime:   startTime,
+			EndTime:     time.Now(),
+			Status:      result.Status,
+			Input:       input,
+			Output:      result.Output,
+			Error:       result.Error,
+			RetryCount:  result.RetryCount,
+		})
+	}
+
+	finished := time.Now()
+	if fanOut.Status == types.SuccessStatus {
+		ss.mutex.Lock()
+		ss.saveTaskRun(task.ID, func(stored *models.ScheduledTask) { stored.LastExecution = &finished })
+		ss.mutex.Unlock()
+	} else {
+		parent.Error = fanOutError(fanOut)
+	}
+	parent.EndTime = finished
+	parent.Status = fanOut.Status
+	parent.FanOut = fanOut
+	ss.recordHistory(task, trigger, fire, parent)
+
+	ss.logger.Info("fan-out task run completed",
+		zap.String("task_id", task.ID),
+		zap.String("status", string(fanOut.Status)),
+		zap.Int("matched", fanOut.Matched),
+		zap.Int("succeeded", fanOut.Succeeded),
+		zap.Int("failed", fanOut.Failed))
+}
+
+// executeFanOutTask runs a fan-out task immediately and reports the aggregate as its result
+func (ss *SchedulerService) executeFanOutTask(ctx context.Context, task *models.ScheduledTask) (*models.ExecutionResult, error) {
+	input, err := ss.taskInput(task)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	fanOut, err := ss.fanOut(WithExecutionLabels(ctx, task.Labels), task, input)
+	if err != nil {
+		return nil, err
+	}
+	trigger := ExecutionTriggerFromContext(ctx)
+
+	result := &models.ExecutionResult{
+		ID:            generateExecutionID(),
+		TaskID:        task.ID,
+		StartTime:     startTime,
+		EndTime:       time.Now(),
+		Status:        fanOut.Status,
+		Input:         input,
+		ExecutionTime: time.Since(startTime).Milliseconds(),
+		Labels:        task.Labels,
+		TriggerType:   trigger.Type,
+		TriggeredBy:   trigger.By,
+		FanOut:        fanOut,
+	}
+	if fanOut.Status != types.SuccessStatus {
+		result.Error = fanOutError(fanOut)
+	}
+
+	ss.logger.Info("fan-out task executed",
+		zap.String("task_id", task.ID),
+		zap.String("status", string(fanOut.Status)),
+		zap.Int("matched", fanOut.Matched),
+		zap.Int("succeeded", fanOut.Succeeded))
+
+	return result, nil
+}
+
+// fanOutExecutionID returns the execution of an agent's fan-out result, or a new ID when the agent
+// never ran
+func fanOutExecutionID(result models.FanOutAgentResult) string {
+	if result.ExecutionID != "" {
+		return result.ExecutionID
+	}
+	return generateExecutionID()
+}
+
+// fanOutError explains why a fan-out run failed its success policy
+func fanOutError(fanOut *models.FanOutResult) string {
+	if fanOut.Matched == 0 {
+		return "agent selector matched no enabled agents"
+	}
+	return fmt.Sprintf("%d of %d agents succeeded, success policy %s", fanOut.Succeeded, fanOut.Matched, describeSuccessPolicy(fanOut))
+}
+
+// describeSuccessPolicy names the success policy of a fan-out run, with its threshold
+func describeSuccessPolicy(fanOut *models.FanOutResult) string {
+	if fanOut.SuccessPolicy == models.FanOutSuccessAtLeast {
+		return fmt.Sprintf("at_least %d", fanOut.MinSuccesses)
+	}
+	return string(fanOut.SuccessPolicy)
+}
+
+// withoutMaintenance drops the agents in maintenance from a fan-out run of the task
+func (ss *SchedulerService) withoutMaintenance(task *models.ScheduledTask, agentIDs []string) []string {
+	ss.mutex.RLock()
+	maintenance := ss.maintenance
+	ss.mutex.RUnlock()
+	if maintenance == nil {
+		return agentIDs
+	}
+
+	picked := agentIDs[:0:0]
+	for _, agentID := range agentIDs {
+		if period, ok := maintenance.InMaintenance(agentID); ok {
+			ss.logger.Info("skipping fan-out agent in maintenance",
+				zap.String("task_id", task.ID),
+				zap.String("agent_id", agentID),
+				zap.Time("until", period.End))
+			continue
+		}
+		picked = append(picked, agentID)
+	}
+	return picked
+}
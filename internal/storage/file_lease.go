@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Timing of the lock guarding a lease file
+const (
+	leaseLockWait  = 2 * time.Second       // How long AcquireLease waits for another instance's lock
+	leaseLockRetry = 10 * time.Millisecond // Delay between attempts to take the lock
+	leaseLockStale = 10 * time.Second      // Age after which a lock left by a crashed instance is broken
+)
+
+// FileLeaseStore keeps the leader lease in a file, for supervisor instances sharing one host. A lock
+// file created exclusively next to it serializes the instances reading and replacing the lease.
+type FileLeaseStore struct {
+	path string
+}
+
+// NewFileLeaseStore creates a lease store keeping the lease at path, creating its directory
+func NewFileLeaseStore(path string) (*FileLeaseStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("lease file path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lease directory: %w", err)
+	}
+	return &FileLeaseStore{path: path}, nil
+}
+
+// AcquireLease makes holder the leader when the lease is free, expired or already held by holder
+func (s *FileLeaseStore) AcquireLease(holder, address string, now time.Time, duration time.Duration) (*models.LeaderLease, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lease, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if lease != nil && lease.Holder != holder && lease.ExpiresAt.After(now) {
+		return lease, nil
+	}
+
+	lease = &models.LeaderLease{Holder: holder, Address: address, ExpiresAt: now.Add(duration)}
+	if err := s.write(lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// ReleaseLease expires the lease when holder holds it
+func (s *FileLeaseStore) ReleaseLease(holder string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lease, err := s.read()
+	if err != nil || lease == nil || lease.Holder != holder {
+		return err
+	}
+	lease.ExpiresAt = time.Unix(0, 0)
+	return s.write(lease)
+}
+
+// lock creates the lock file, waiting while another instance holds it, and returns the function
+// removing it
+func (s *FileLeaseStore) lock() (func(), error) {
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(leaseLockWait)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock lease file: %w", err)
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > leaseLockStale {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lease file lock %s", lockPath)
+		}
+		time.Sleep(leaseLockRetry)
+	}
+}
+
+// read returns the lease in the file, or nil when there is none yet
+func (s *FileLeaseStore) read() (*models.LeaderLease, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease file: %w", err)
+	}
+	var lease models.LeaderLease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, fmt.Errorf("failed to decode lease file: %w", err)
+	}
+	return &lease, nil
+}
+
+// write replaces the lease file atomically
+func (s *FileLeaseStore) write(lease *models.LeaderLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("failed to encode lease: %w", err)
+	}
+	temp := s.path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lease file: %w", err)
+	}
+	if err := os.Rename(temp, s.path); err != nil {
+		return fmt.Errorf("failed to replace lease file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Supported execution history backends
+const (
+	HistoryBackendMemory = "memory"
+	HistoryBackendSQLite = "sqlite"
+)
+
+// NewExecutionHistoryRepository creates the execution history repository for the configured backend
+func NewExecutionHistoryRepository(backend, path string) (models.ExecutionHistoryRepository, error) {
+	switch backend {
+	case "", HistoryBackendMemory:
+		return models.NewInMemoryExecutionHistoryRepository(), nil
+	case HistoryBackendSQLite:
+		if path == "" {
+			return nil, fmt.Errorf("history path is required for the sqlite backend")
+		}
+		return NewSQLiteExecutionHistoryRepository(path)
+	default:
+		return nil, fmt.Errorf("unknown history backend %q, expected %s or %s", backend, HistoryBackendMemory, HistoryBackendSQLite)
+	}
+}
@@ -0,0 +1,4 @@
+package storage
+
+// Registers the "pgx" database/sql driver used by the postgres storage backend
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -0,0 +1,464 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// storeMigrations are applied in order; never edit an entry once released, append a new one instead.
+// The statements are plain SQL both SQLite and PostgreSQL accept. Queries number their parameters
+// in the order they appear, since SQLite binds $N parameters by position rather than by number.
+var storeMigrations = []string{
+	`CREATE TABLE agents (
+		id         TEXT PRIMARY KEY,
+		data       TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE tasks (
+		id         TEXT PRIMARY KEY,
+		agent_id   TEXT NOT NULL DEFAULT '',
+		data       TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE executions (
+		id           TEXT PRIMARY KEY,
+		agent_id     TEXT NOT NULL,
+		task_id      TEXT NOT NULL DEFAULT '',
+		state        TEXT NOT NULL,
+		finished     INTEGER NOT NULL DEFAULT 0,
+		trigger_type TEXT NOT NULL DEFAULT '',
+		triggered_by TEXT NOT NULL DEFAULT '',
+		start_time   BIGINT NOT NULL,
+		data         TEXT NOT NULL
+	)`,
+	`CREATE INDEX idx_executions_agent_start ON executions (agent_id, start_time)`,
+	`CREATE INDEX idx_executions_task_start ON executions (task_id, start_time)`,
+	`CREATE TABLE execution_results (
+		execution_id TEXT PRIMARY KEY,
+		data         TEXT NOT NULL
+	)`,
+	`CREATE TABLE leader_lease (
+		name       TEXT PRIMARY KEY,
+		holder     TEXT NOT NULL,
+		address    TEXT NOT NULL DEFAULT '',
+		expires_at BIGINT NOT NULL
+	)`,
+}
+
+// leaderLeaseName is the row of the leader_lease table supervisor instances compete for
+const leaderLeaseName = "supervisor"
+
+// SQLStore keeps agents, tasks and executions in a SQL database through database/sql. Rows hold
+// the JSON of each record next to the columns queries select on; fields the API never serializes,
+// such as execution snapshots, stay with the instance that recorded them.
+//
+// Several supervisor instances may share the database: a primary key constraint makes registering
+// an agent or task atomic, and an execution's final state is only ever written once.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// newSQLStore wraps an open database and applies pending migrations
+func newSQLStore(db *sql.DB) (*SQLStore, error) {
+	store := &SQLStore{db: db}
+	if err := store.migrate(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies every migration newer than the recorded schema version. Instances starting
+// together each try to record a version; the primary key lets exactly one of them apply it.
+func (s *SQLStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS store_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM store_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(storeMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+		claimed, err := tx.Exec(`INSERT INTO store_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING`, i+1)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if rows, _ := claimed.RowsAffected(); rows == 0 {
+			// Another instance applied it
+			tx.Rollback()
+			continue
+		}
+		if _, err := tx.Exec(storeMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the underlying database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// CreateAgent stores a new agent
+func (s *SQLStore) CreateAgent(config *models.AgentConfiguration) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode agent: %w", err)
+	}
+
+	created, err := s.db.Exec(`INSERT INTO agents (id, data, updated_at) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`,
+		config.ID, string(data), config.UpdatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to store agent: %w", err)
+	}
+	if rows, _ := created.RowsAffected(); rows == 0 {
+		return models.NewKindError(models.ErrAgentConflict, "agent with ID %s already exists", config.ID)
+	}
+	return nil
+}
+
+// GetAgent returns the agent with the ID
+func (s *SQLStore) GetAgent(agentID string) (*models.AgentConfiguration, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM agents WHERE id = $1`, agentID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NewKindError(models.ErrAgentNotFound, "agent with ID %s not found", agentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent: %w", err)
+	}
+	return decodeRecord[models.AgentConfiguration](data)
+}
+
+// SaveAgent replaces a stored agent
+func (s *SQLStore) SaveAgent(config *models.AgentConfiguration) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode agent: %w", err)
+	}
+
+	updated, err := s.db.Exec(`UPDATE agents SET data = $1, updated_at = $2 WHERE id = $3`,
+		string(data), config.UpdatedAt.UnixNano(), config.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store agent: %w", err)
+	}
+	if rows, _ := updated.RowsAffected(); rows == 0 {
+		return models.NewKindError(models.ErrAgentNotFound, "agent with ID %s not found", config.ID)
+	}
+	return nil
+}
+
+// DeleteAgent removes the agent with the ID
+func (s *SQLStore) DeleteAgent(agentID string) error {
+	deleted, err := s.db.Exec(`DELETE FROM agents WHERE id = $1`, agentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete agent: %w", err)
+	}
+	if rows, _ := deleted.RowsAffected(); rows == 0 {
+		return models.NewKindError(models.ErrAgentNotFound, "agent with ID %s not found", agentID)
+	}
+	return nil
+}
+
+// ListAgents returns every stored agent ordered by ID
+func (s *SQLStore) ListAgents() ([]*models.AgentConfiguration, error) {
+	return queryRecords[models.AgentConfiguration](s.db, `SELECT data FROM agents ORDER BY id`)
+}
+
+// CreateTask stores a new task
+func (s *SQLStore) CreateTask(task *models.ScheduledTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	created, err := s.db.Exec(`INSERT INTO tasks (id, agent_id, data, updated_at) VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`,
+		task.ID, task.AgentID, string(data), task.UpdatedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to store task: %w", err)
+	}
+	if rows, _ := created.RowsAffected(); rows == 0 {
+		return models.NewKindError(models.ErrTaskConflict, "task with ID %s already exists", task.ID)
+	}
+	return nil
+}
+
+// GetTask returns the task with the ID
+func (s *SQLStore) GetTask(taskID string) (*models.ScheduledTask, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM tasks WHERE id = $1`, taskID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NewKindError(models.ErrTaskNotFound, "task with ID %s not found", taskID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task: %w", err)
+	}
+	return decodeRecord[models.ScheduledTask](data)
+}
+
+// SaveTask replaces a stored task
+func (s *SQLStore) SaveTask(task *models.ScheduledTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	updated, err := s.db.Exec(`UPDATE tasks SET agent_id = $1, data = $2, updated_at = $3 WHERE id = $4`,
+		task.AgentID, string(data), task.UpdatedAt.UnixNano(), task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store task: %w", err)
+	}
+	if rows, _ := updated.RowsAffected(); rows == 0 {
+		return models.NewKindError(models.ErrTaskNotFound, "task with ID %s not found", task.ID)
+	}
+	return nil
+}
+
+// DeleteTask removes the task with the ID
+func (s *SQLStore) DeleteTask(taskID string) error {
+	deleted, err := s.db.Exec(`DELETE FROM tasks WHERE id = $1`, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+	if rows, _ := deleted.RowsAffected(); rows == 0 {
+		return models.NewKindError(models.ErrTaskNotFound, "task with ID %s not found", taskID)
+	}
+	return nil
+}
+
+// ListTasks returns every stored task ordered by ID
+func (s *SQLStore) ListTasks() ([]*models.ScheduledTask, error) {
+	return queryRecords[models.ScheduledTask](s.db, `SELECT data FROM tasks ORDER BY id`)
+}
+
+// SaveExecution stores an execution or its new state. The upsert only overwrites a finished
+// execution with the same state, so of two instances racing to finish an execution the first one
+// wins and the other fails with ErrExecutionConflict.
+func (s *SQLStore) SaveExecution(execution *models.AgentExecution) error {
+	data, err := json.Marshal(execution)
+	if err != nil {
+		return fmt.Errorf("failed to encode execution: %w", err)
+	}
+
+	finished := 0
+	if execution.IsComplete() {
+		finished = 1
+	}
+	saved, err := s.db.Exec(`INSERT INTO executions (id, agent_id, task_id, state, finished, trigger_type, triggered_by, start_time, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			agent_id = excluded.agent_id, task_id = excluded.task_id, state = excluded.state, finished = excluded.finished,
+			trigger_type = excluded.trigger_type, triggered_by = excluded.triggered_by, start_time = excluded.start_time, data = excluded.data
+		WHERE executions.finished = 0 OR executions.state = excluded.state`,
+		execution.ID, execution.AgentID, execution.TaskID, string(execution.State), finished,
+		string(execution.TriggerType), execution.TriggeredBy, execution.StartTime.UnixNano(), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to store execution: %w", err)
+	}
+	if rows, _ := saved.RowsAffected(); rows == 0 {
+		var state string
+		if err := s.db.QueryRow(`SELECT state FROM executions WHERE id = $1`, execution.ID).Scan(&state); err != nil {
+			return fmt.Errorf("failed to read execution state: %w", err)
+		}
+		return models.NewKindError(models.ErrExecutionConflict, "execution with ID %s already finished as %s", execution.ID, state)
+	}
+	return nil
+}
+
+// GetExecution returns the execution with the ID
+func (s *SQLStore) GetExecution(executionID string) (*models.AgentExecution, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM executions WHERE id = $1`, executionID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "execution with ID %s not found", executionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution: %w", err)
+	}
+	return decodeRecord[models.AgentExecution](data)
+}
+
+// QueryExecutions returns the executions matching the filter, oldest first; labels and anomalies
+// are matched on the decoded executions
+func (s *SQLStore) QueryExecutions(filter models.ExecutionFilter) ([]*models.AgentExecution, error) {
+	query, args := executionQuery(filter)
+	query += ` ORDER BY start_time, id`
+
+	executions, err := queryRecords[models.AgentExecution](s.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	matching := executions[:0]
+	for _, execution := range executions {
+		if filter.Matches(execution) {
+			matching = append(matching, execution)
+		}
+	}
+	return matching, nil
+}
+
+// QueryExecutionsAfter returns at most limit executions matching the filter that follow the cursor,
+// ordered by start time then ID. Rows are read limit at a time until enough of them match labels
+// and anomalies, which are matched on the decoded executions.
+func (s *SQLStore) QueryExecutionsAfter(filter models.ExecutionFilter, after models.ExecutionCursor, limit int) ([]*models.AgentExecution, error) {
+	matching := []*models.AgentExecution{}
+	for len(matching) < limit {
+		query, args := executionQuery(filter)
+		if after != (models.ExecutionCursor{}) {
+			args = append(args, after.StartTime.UnixNano(), after.ID)
+			query += fmt.Sprintf(" AND (start_time > $%d OR (start_time = $%d AND id > $%d))", len(args)-1, len(args)-1, len(args))
+		}
+		args = append(args, limit)
+		query += fmt.Sprintf(" ORDER BY start_time, id LIMIT $%d", len(args))
+
+		executions, err := queryRecords[models.AgentExecution](s.db, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, execution := range executions {
+			if filter.Matches(execution) && len(matching) < limit {
+				matching = append(matching, execution)
+			}
+		}
+		if len(executions) < limit {
+			break
+		}
+		after = models.CursorAt(executions[len(executions)-1])
+	}
+	return matching, nil
+}
+
+// executionQuery returns the query selecting the executions whose columns match the filter, and
+// its arguments
+func executionQuery(filter models.ExecutionFilter) (string, []interface{}) {
+	query := `SELECT data FROM executions WHERE 1 = 1`
+	var args []interface{}
+	for _, condition := range []struct {
+		column string
+		value  string
+	}{
+		{"agent_id", filter.AgentID},
+		{"task_id", filter.TaskID},
+		{"trigger_type", string(filter.TriggerType)},
+		{"triggered_by", filter.TriggeredBy},
+	} {
+		if condition.value != "" {
+			args = append(args, condition.value)
+			query += fmt.Sprintf(" AND %s = $%d", condition.column, len(args))
+		}
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since.UnixNano())
+		query += fmt.Sprintf(" AND start_time >= $%d", len(args))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until.UnixNano())
+		query += fmt.Sprintf(" AND start_time < $%d", len(args))
+	}
+	return query, args
+}
+
+// SaveExecutionResult stores the result of a finished execution
+func (s *SQLStore) SaveExecutionResult(executionID string, result *models.ExecutionResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode execution result: %w", err)
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO execution_results (execution_id, data) VALUES ($1, $2)
+		ON CONFLICT (execution_id) DO UPDATE SET data = excluded.data`, executionID, string(data)); err != nil {
+		return fmt.Errorf("failed to store execution result: %w", err)
+	}
+	return nil
+}
+
+// GetExecutionResult returns the result of an execution
+func (s *SQLStore) GetExecutionResult(executionID string) (*models.ExecutionResult, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM execution_results WHERE execution_id = $1`, executionID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.NewKindError(models.ErrExecutionNotFound, "execution result with ID %s not found", executionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution result: %w", err)
+	}
+	return decodeRecord[models.ExecutionResult](data)
+}
+
+// AcquireLease makes holder the leader when the lease is free, expired or already held by holder.
+// The upsert only overwrites another holder's row once it has expired, so of the instances trying
+// at once exactly one takes the lease.
+func (s *SQLStore) AcquireLease(holder, address string, now time.Time, duration time.Duration) (*models.LeaderLease, error) {
+	if _, err := s.db.Exec(`INSERT INTO leader_lease (name, holder, address, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, address = excluded.address, expires_at = excluded.expires_at
+		WHERE leader_lease.holder = excluded.holder OR leader_lease.expires_at <= $5`,
+		leaderLeaseName, holder, address, now.Add(duration).UnixNano(), now.UnixNano()); err != nil {
+		return nil, fmt.Errorf("failed to acquire leader lease: %w", err)
+	}
+
+	var lease models.LeaderLease
+	var expiresAt int64
+	if err := s.db.QueryRow(`SELECT holder, address, expires_at FROM leader_lease WHERE name = $1`, leaderLeaseName).
+		Scan(&lease.Holder, &lease.Address, &expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to read leader lease: %w", err)
+	}
+	lease.ExpiresAt = time.Unix(0, expiresAt)
+	return &lease, nil
+}
+
+// ReleaseLease expires the lease when holder holds it
+func (s *SQLStore) ReleaseLease(holder string) error {
+	if _, err := s.db.Exec(`UPDATE leader_lease SET expires_at = 0 WHERE name = $1 AND holder = $2`, leaderLeaseName, holder); err != nil {
+		return fmt.Errorf("failed to release leader lease: %w", err)
+	}
+	return nil
+}
+
+// decodeRecord decodes the JSON of a stored record
+func decodeRecord[T any](data string) (*T, error) {
+	var record T
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode stored %T: %w", record, err)
+	}
+	return &record, nil
+}
+
+// queryRecords decodes the JSON records a query selects as its only column
+func queryRecords[T any](db *sql.DB, query string, args ...interface{}) ([]*T, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []*T{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read record: %w", err)
+		}
+		record, err := decodeRecord[T](data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+
+	// Registers the pure Go "sqlite" database/sql driver, so the supervisor builds without CGO
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDriver is the database/sql driver name used for SQLite
+const sqliteDriver = "sqlite"
+
+// sqliteDSN is the data source name of the SQLite database at path, waiting on a locked database
+// rather than failing and journaling in WAL mode
+func sqliteDSN(path string) string {
+	return path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
+
+// historyMigrations are applied in order; never edit an entry once released, append a new one instead
+var historyMigrations = []string{
+	`CREATE TABLE execution_history (
+		seq               INTEGER PRIMARY KEY AUTOINCREMENT,
+		id                TEXT NOT NULL UNIQUE,
+		task_id           TEXT NOT NULL,
+		execution_id      TEXT NOT NULL,
+		start_time        INTEGER NOT NULL,
+		end_time          INTEGER NOT NULL,
+		status            TEXT NOT NULL,
+		input             TEXT NOT NULL DEFAULT '',
+		output            TEXT NOT NULL DEFAULT '',
+		error             TEXT NOT NULL DEFAULT '',
+		execution_time_ms INTEGER NOT NULL DEFAULT 0,
+		retry_count       INTEGER NOT NULL DEFAULT 0,
+		trigger_type      TEXT NOT NULL DEFAULT '',
+		labels            TEXT NOT NULL DEFAULT '',
+		created_at        INTEGER NOT NULL
+	);
+	CREATE INDEX idx_execution_history_task_start ON execution_history (task_id, start_time);
+	CREATE INDEX idx_execution_history_status_start ON execution_history (status, start_time);
+	CREATE INDEX idx_execution_history_start ON execution_history (start_time);`,
+	`ALTER TABLE execution_history ADD COLUMN triggered_by TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE execution_history ADD COLUMN planned_time INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE execution_history ADD COLUMN drift_ms INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE execution_history ADD COLUMN skip_reason TEXT NOT NULL DEFAULT '';`,
+}
+
+// historyColumns lists the columns read by scanHistory, in order
+const historyColumns = `id, task_id, execution_id, start_time, end_time, status, input, output, error,
+	execution_time_ms, retry_count, trigger_type, labels, created_at, triggered_by, planned_time, drift_ms,
+	skip_reason`
+
+// SQLiteExecutionHistoryRepository stores execution history in a SQLite database
+type SQLiteExecutionHistoryRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteExecutionHistoryRepository opens (or creates) the database at path and applies pending migrations
+func NewSQLiteExecutionHistoryRepository(path string) (*SQLiteExecutionHistoryRepository, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create history directory: %w", err)
+		}
+	}
+
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	// SQLite allows a single writer; serialising through one connection avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	repo := &SQLiteExecutionHistoryRepository{db: db}
+	if err := repo.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// migrate applies every migration newer than the recorded schema version
+func (r *SQLiteExecutionHistoryRepository) migrate() error {
+	if _, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	if err := r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(historyMigrations); i++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(historyMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the underlying database
+func (r *SQLiteExecutionHistoryRepository) Close() error {
+	return r.db.Close()
+}
+
+// StoreExecutionHistory stores an execution history record
+func (r *SQLiteExecutionHistoryRepository) StoreExecutionHistory(history *models.ExecutionHistory) error {
+	if err := history.Validate(); err != nil {
+		return err
+	}
+
+	labels := ""
+	if len(history.Labels) > 0 {
+		encoded, err := json.Marshal(history.Labels)
+		if err != nil {
+			return fmt.Errorf("failed to encode labels: %w", err)
+		}
+		labels = string(encoded)
+	}
+
+	var plannedTime int64
+	if history.PlannedTime != nil {
+		plannedTime = toUnixNano(*history.PlannedTime)
+	}
+
+	_, err := r.db.Exec(`INSERT INTO execution_history (`+historyColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		history.ID, history.TaskID, history.ExecutionID,
+		toUnixNano(history.StartTime), toUnixNano(history.EndTime),
+		string(history.Status), history.Input, history.Output, history.Error,
+		history.ExecutionTimeMs, history.RetryCount, string(history.TriggerType),
+		labels, toUnixNano(history.CreatedAt), history.TriggeredBy, plannedTime, history.DriftMs,
+		history.SkipReason)
+	if err != nil {
+		return fmt.Errorf("failed to store execution history: %w", err)
+	}
+
+	return nil
+}
+
+// GetExecutionHistory retrieves the most recent records for a task, oldest first
+func (r *SQLiteExecutionHistoryRepository) GetExecutionHistory(taskID string, limit int) ([]*models.ExecutionHistory, error) {
+	return r.queryRecent(`WHERE task_id = ?`, limit, taskID)
+}
+
+// GetExecutionHistoryByTaskAndStatus retrieves the most recent records for a task with a specific status, oldest first
+func (r *SQLiteExecutionHistoryRepository) GetExecutionHistoryByTaskAndStatus(taskID string, status types.ExecutionStatus, limit int) ([]*models.ExecutionHistory, error) {
+	return r.queryRecent(`WHERE task_id = ? AND status = ?`, limit, taskID, string(status))
+}
+
+// GetExecutionHistoryByTimeRange retrieves records started strictly between start and end, newest first
+func (r *SQLiteExecutionHistoryRepository) GetExecutionHistoryByTimeRange(start, end time.Time, limit int) ([]*models.ExecutionHistory, error) {
+	query := `SELECT ` + historyColumns + ` FROM execution_history
+		WHERE start_time > ? AND start_time < ?
+		ORDER BY start_time DESC, seq ASC`
+	args := []interface{}{start.UnixNano(), end.UnixNano()}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	return r.query(query, args...)
+}
+
+// GetLatestExecutionHistory retrieves the most recent record for a task, or nil when there is none
+func (r *SQLiteExecutionHistoryRepository) GetLatestExecutionHistory(taskID string) (*models.ExecutionHistory, error) {
+	histories, err := r.query(`SELECT `+historyColumns+` FROM execution_history
+		WHERE task_id = ? ORDER BY start_time DESC, seq ASC LIMIT 1`, taskID)
+	if err != nil || len(histories) == 0 {
+		return nil, err
+	}
+	return histories[0], nil
+}
+
+// DeleteExecutionHistory deletes execution history records for a task
+func (r *SQLiteExecutionHistoryRepository) DeleteExecutionHistory(taskID string) error {
+	if _, err := r.db.Exec(`DELETE FROM execution_history WHERE task_id = ?`, taskID); err != nil {
+		return fmt.Errorf("failed to delete execution history: %w", err)
+	}
+	return nil
+}
+
+// DeleteExecutionHistoryBefore deletes records that started before the cutoff
+func (r *SQLiteExecutionHistoryRepository) DeleteExecutionHistoryBefore(cutoff time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM execution_history WHERE start_time < ?`, cutoff.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old execution history: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted execution history: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// queryRecent returns the newest limit rows matching where, in insertion order
+func (r *SQLiteExecutionHistoryRepository) queryRecent(where string, limit int, args ...interface{}) ([]*models.ExecutionHistory, error) {
+	query := `SELECT ` + historyColumns + ` FROM execution_history ` + where + ` ORDER BY seq DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	histories, err := r.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows were read newest first to apply the limit; return them oldest first
+	for i, j := 0, len(histories)-1; i < j; i, j = i+1, j-1 {
+		histories[i], histories[j] = histories[j], histories[i]
+	}
+	return histories, nil
+}
+
+// query runs a SELECT over historyColumns and scans every row
+func (r *SQLiteExecutionHistoryRepository) query(query string, args ...interface{}) ([]*models.ExecutionHistory, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query execution history: %w", err)
+	}
+	defer rows.Close()
+
+	histories := []*models.ExecutionHistory{}
+	for rows.Next() {
+		history, err := scanHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		histories = append(histories, history)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read execution history: %w", err)
+	}
+
+	return histories, nil
+}
+
+// scanHistory converts one row into an ExecutionHistory
+func scanHistory(rows *sql.Rows) (*models.ExecutionHistory, error) {
+	var (
+		history                                    models.ExecutionHistory
+		status, triggerType, labels                string
+		startTime, endTime, createdAt, plannedTime int64
+	)
+
+	err := rows.Scan(&history.ID, &history.TaskID, &history.ExecutionID, &startTime, &endTime,
+		&status, &history.Input, &history.Output, &history.Error,
+		&history.ExecutionTimeMs, &history.RetryCount, &triggerType, &labels, &createdAt, &history.TriggeredBy,
+		&plannedTime, &history.DriftMs, &history.SkipReason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan execution history: %w", err)
+	}
+
+	history.StartTime = fromUnixNano(startTime)
+	history.EndTime = fromUnixNano(endTime)
+	history.CreatedAt = fromUnixNano(createdAt)
+	history.Status = types.ExecutionStatus(status)
+	history.TriggerType = types.TaskTriggerType(triggerType)
+	if plannedTime != 0 {
+		planned := fromUnixNano(plannedTime)
+		history.PlannedTime = &planned
+	}
+
+	if labels != "" {
+		if err := json.Unmarshal([]byte(labels), &history.Labels); err != nil {
+			return nil, fmt.Errorf("failed to decode labels: %w", err)
+		}
+	}
+
+	return &history, nil
+}
+
+// toUnixNano stores zero times as 0 so they round-trip as zero
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of toUnixNano
+func fromUnixNano(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
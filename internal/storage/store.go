@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Supported state storage backends
+const (
+	StoreBackendMemory   = "memory"
+	StoreBackendSQLite   = "sqlite"
+	StoreBackendPostgres = "postgres"
+)
+
+// DefaultPostgresDriver is the database/sql driver the postgres backend uses unless configured
+// otherwise
+const DefaultPostgresDriver = "pgx"
+
+// StoreOptions configures the state storage backend
+type StoreOptions struct {
+	Backend      string // StoreBackendMemory, StoreBackendSQLite or StoreBackendPostgres
+	Path         string // Database file of the sqlite backend
+	DSN          string // Connection string of the postgres backend
+	Driver       string // database/sql driver of the postgres backend, DefaultPostgresDriver when empty
+	MaxOpenConns int    // Connections the postgres backend opens at most, 0 for no limit
+}
+
+// Stores holds the agent, task and execution stores of the configured backend
+type Stores struct {
+	Agents     models.AgentStore
+	Tasks      models.TaskStore
+	Executions models.ExecutionStore
+	Leases     models.LeaseStore // Leader lease in the database, nil for the memory backend
+
+	db *sql.DB
+}
+
+// NewStores opens the stores of the configured backend. The memory backend keeps the state of
+// this instance only; the sqlite backend keeps it in a file, and the postgres backend in a database
+// several supervisor instances can share.
+func NewStores(options StoreOptions) (*Stores, error) {
+	switch options.Backend {
+	case "", StoreBackendMemory:
+		return &Stores{
+			Agents:     models.NewInMemoryAgentStore(),
+			Tasks:      models.NewInMemoryTaskStore(),
+			Executions: models.NewInMemoryExecutionStore(),
+		}, nil
+	case StoreBackendSQLite:
+		if options.Path == "" {
+			return nil, fmt.Errorf("storage path is required for the sqlite backend")
+		}
+		if dir := filepath.Dir(options.Path); dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create storage directory: %w", err)
+			}
+		}
+		db, err := sql.Open(sqliteDriver, sqliteDSN(options.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage database: %w", err)
+		}
+		// SQLite allows a single writer; serialising through one connection avoids SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+		return openSQLStores(db)
+	case StoreBackendPostgres:
+		if options.DSN == "" {
+			return nil, fmt.Errorf("storage dsn is required for the postgres backend")
+		}
+		driver := options.Driver
+		if driver == "" {
+			driver = DefaultPostgresDriver
+		}
+		if !slices.Contains(sql.Drivers(), driver) {
+			return nil, fmt.Errorf("database driver %q is not registered", driver)
+		}
+		db, err := sql.Open(driver, options.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open storage database: %w", err)
+		}
+		db.SetMaxOpenConns(options.MaxOpenConns)
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to storage database: %w", err)
+		}
+		return openSQLStores(db)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, expected %s, %s or %s", options.Backend, StoreBackendMemory, StoreBackendSQLite, StoreBackendPostgres)
+	}
+}
+
+// openSQLStores migrates the database and serves every store from it
+func openSQLStores(db *sql.DB) (*Stores, error) {
+	store, err := newSQLStore(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Stores{Agents: store, Tasks: store, Executions: store, Leases: store, db: db}, nil
+}
+
+// Close closes the database of a SQL backend
+func (s *Stores) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,39 @@
+package a2a
+
+import (
+	"encoding/json"
+)
+
+// DecodeMessage decodes an incoming A2A message. Fields it does not know are ignored, so peers on
+// newer protocol versions may add optional fields; a missing required field is reported as an
+// InvalidParams error whose data is a FieldError naming it.
+func DecodeMessage(data []byte) (*A2AMessage, error) {
+	var message A2AMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, NewA2AErrorWithData(ParseError, "Parse error", err.Error())
+	}
+	if err := message.CheckRequired(); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// CheckRequired returns an InvalidParams error naming the first required field the message lacks:
+// its id, type and payload, and the method of a request's payload
+func (m *A2AMessage) CheckRequired() error {
+	missing := ""
+	switch {
+	case m.ID == "":
+		missing = "id"
+	case m.Type == "":
+		missing = "type"
+	case m.Payload == nil:
+		missing = "payload"
+	case m.Type == "request" && m.Payload.Method == "":
+		missing = "payload.method"
+	}
+	if missing == "" {
+		return nil
+	}
+	return NewA2AErrorWithData(InvalidParams, "Invalid params: "+missing+" is required", FieldError{Field: missing, Reason: "required"})
+}
@@ -25,8 +25,21 @@ const (
 	AgentConfigurationError        = -32011 // Agent configuration error
 	InvalidAgentStateError         = -32012 // Agent is in invalid state to process request
 	AgentTimeoutError              = -32013 // Agent execution timed out
+	UnsupportedProtocolVersionError = -32014 // Message protocol version not supported; data is an UnsupportedVersion
 )
 
+// UnsupportedVersion is the data of an UnsupportedProtocolVersionError
+type UnsupportedVersion struct {
+	Requested string   `json:"requested"`
+	Supported []string `json:"supported"`
+}
+
+// FieldError is the data of an InvalidParams error about one field of a message
+type FieldError struct {
+	Field  string `json:"field"`  // Dotted path of the field, e.g. payload.method
+	Reason string `json:"reason"` // e.g. required
+}
+
 // A2AError represents an error in the A2A protocol
 type A2AError struct {
 	Code    int         `json:"code"`
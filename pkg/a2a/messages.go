@@ -10,6 +10,7 @@ import (
 type A2AMessage struct {
 	Protocol    string      `json:"protocol"`
 	Version     string      `json:"version"`
+	ProtocolVersion string  `json:"protocol_version,omitempty"` // A2A message version the sender speaks; the receiver's preferred one when empty
 	ID          string      `json:"id"`
 	Type        string      `json:"type"` // "request", "response", "error", "stream"
 	Timestamp   time.Time   `json:"timestamp"`
@@ -0,0 +1,338 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/algonius/algonius-supervisor/pkg/types"
+)
+
+// AgentSpec is the configuration of an agent, as registered by supervisorctl's agent add command.
+// Fields left zero-valued are taken from Template, the --template flag, when it is set.
+type AgentSpec struct {
+	ID                        string                 `json:"id"`
+	Name                      string                 `json:"name"`
+	Template                  string                 `json:"template,omitempty"`
+	Description               string                 `json:"description,omitempty"`
+	InputSchema               map[string]interface{} `json:"input_schema,omitempty"` // JSON Schema of the parameters of execute requests
+	Examples                  []AgentExample         `json:"examples,omitempty"`
+	ValidateInput             bool                   `json:"validate_input,omitempty"` // The server rejects parameters violating InputSchema with 422
+	AgentType                 string                 `json:"agent_type,omitempty"`
+	ExecutablePath            string                 `json:"executable_path,omitempty"`
+	WorkingDirectory          string                 `json:"working_directory,omitempty"`
+	Envs                      map[string]string      `json:"envs,omitempty"`               // Merged with the template's, these entries winning
+	SensitiveEnvKeys          []string               `json:"sensitive_env_keys,omitempty"` // Envs whose values the server masks
+	CliArgs                   map[string]string      `json:"cli_args,omitempty"`
+	Parameters                map[string]string      `json:"parameters,omitempty"` // Settings of built-in agent types
+	Mode                      string                 `json:"mode,omitempty"`       // task, interactive or persistent
+	InputPattern              string                 `json:"input_pattern,omitempty"`
+	OutputPattern             string                 `json:"output_pattern,omitempty"`
+	InputFileTemplate         string                 `json:"input_file_template,omitempty"`
+	OutputFileTemplate        string                 `json:"output_file_template,omitempty"` // May hold a glob matching the newest file
+	OutputFileWaitSeconds     int                    `json:"output_file_wait_seconds,omitempty"`
+	OutputFileStable          bool                   `json:"output_file_stable,omitempty"`
+	OutputSelector            string                 `json:"output_selector,omitempty"`
+	AllowIncompatiblePatterns bool                   `json:"allow_incompatible_patterns,omitempty"` // Register despite an incompatible pattern pair
+	OutputEncoding            string                 `json:"output_encoding,omitempty"`             // text, json or base64
+	SandboxDir                string                 `json:"sandbox_dir,omitempty"`
+	KeepArtifacts             bool                   `json:"keep_artifacts,omitempty"`
+	MaxOutputBytes            int64                  `json:"max_output_bytes,omitempty"` // 0 for the server default
+	StdoutLogfile             string                 `json:"stdout_logfile,omitempty"`
+	StderrLogfile             string                 `json:"stderr_logfile,omitempty"`
+	CacheTTLSeconds           int                    `json:"cache_ttl_seconds,omitempty"`
+	RunAsUser                 string                 `json:"run_as_user,omitempty"`
+	RunAsGroup                string                 `json:"run_as_group,omitempty"`
+	NiceLevel                 int                    `json:"nice_level,omitempty"`
+	MaxMemoryMB               int64                  `json:"max_memory_mb,omitempty"`
+	MaxCPUSeconds             int64                  `json:"max_cpu_seconds,omitempty"`
+	SkipFSChecks              bool                   `json:"skip_fs_checks,omitempty"`
+	StopSignal                string                 `json:"stop_signal,omitempty"` // TERM, INT, QUIT, HUP, USR1, USR2 or KILL
+	StopWaitSeconds           int                    `json:"stop_wait_seconds,omitempty"`
+	MaxSilenceSeconds         int                    `json:"max_silence_seconds,omitempty"`   // Stop executions silent this long
+	HeartbeatFile             string                 `json:"heartbeat_file,omitempty"`        // Touching it counts as activity
+	HeartbeatLine             string                 `json:"heartbeat_line,omitempty"`        // Only this output line counts as activity
+	PingIntervalSeconds       int                    `json:"ping_interval_seconds,omitempty"` // Persistent mode only
+	PingTimeoutSeconds        int                    `json:"ping_timeout_seconds,omitempty"`  // Persistent mode only
+	StartRetries              int                    `json:"start_retries,omitempty"`         // Persistent mode only
+	StartSecs                 int                    `json:"start_secs,omitempty"`            // Persistent mode only
+	PostStartHook             *LifecycleHook         `json:"post_start_hook,omitempty"`       // Persistent mode only
+	PreStopHook               *LifecycleHook         `json:"pre_stop_hook,omitempty"`         // Persistent mode only
+	MaintenanceWindows        []MaintenanceWindow    `json:"maintenance_windows,omitempty"`
+	ExitCodeMap               map[string]string      `json:"exit_code_map,omitempty"` // e.g. {"1": "success", "2-5": "warning"}
+	AccessType                string                 `json:"access_type,omitempty"`
+	MaxConcurrentExecutions   int                    `json:"max_concurrent_executions,omitempty"`
+	Weight                    int                    `json:"weight,omitempty"`  // Share of contended read-only pool slots
+	Timeout                   int                    `json:"timeout,omitempty"` // Seconds
+	SessionTimeout            int                    `json:"session_timeout,omitempty"`
+	MaxTotalTimeout           int                    `json:"max_total_timeout,omitempty"` // Seconds, caps extended deadlines
+	KeepAlive                 bool                   `json:"keep_alive,omitempty"`
+	Enabled                   bool                   `json:"enabled,omitempty"`
+}
+
+// MaintenanceWindow is a recurring period, starting whenever the cron schedule fires and lasting for
+// the duration, during which the agent's scheduled tasks are skipped and it is not restarted
+type MaintenanceWindow struct {
+	Schedule string `json:"schedule"`
+	Duration string `json:"duration"`           // e.g. "1h30m"
+	Timezone string `json:"timezone,omitempty"` // IANA zone, the server's when empty
+	Reason   string `json:"reason,omitempty"`
+}
+
+// LifecycleHook is a command run, or a URL called, after a persistent agent's process started
+// running or before it is sent its stop signal
+type LifecycleHook struct {
+	Command        []string `json:"command,omitempty"`
+	URL            string   `json:"url,omitempty"`             // Called instead of running a command; 2xx responses succeed
+	Method         string   `json:"method,omitempty"`          // POST when empty
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"` // 30 when 0
+	OnFailure      string   `json:"on_failure,omitempty"`      // degrade or fail after starting, proceed or abort before stopping
+}
+
+// AgentExample is an example call of an agent
+type AgentExample struct {
+	Description string                 `json:"description,omitempty"`
+	Input       string                 `json:"input,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// AgentTemplate holds settings agents naming it inherit; the ID, Name and Template of its settings
+// are ignored
+type AgentTemplate struct {
+	Name     string    `json:"name"`
+	Settings AgentSpec `json:"settings"`
+}
+
+// SpecError is an agent spec the client rejected before sending it, with the field errors the
+// supervisor would have returned
+type SpecError struct {
+	Errors []FieldError
+}
+
+// Error implements the error interface
+func (e *SpecError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return "invalid agent spec: " + strings.Join(messages, "; ")
+}
+
+// Validate checks the spec against the pattern compatibility matrix the supervisor enforces, the
+// same table GET /api/v1/meta/patterns serves. Patterns left to a template are checked by the
+// supervisor once merged.
+func (spec AgentSpec) Validate() error {
+	if spec.AllowIncompatiblePatterns || spec.InputPattern == "" || spec.OutputPattern == "" {
+		return nil
+	}
+	if err := types.CheckPatternCompatibility(types.InputPattern(spec.InputPattern), types.OutputPattern(spec.OutputPattern)); err != nil {
+		return &SpecError{Errors: []FieldError{{Field: "output_pattern", Code: "conflict", Message: err.Error()}}}
+	}
+	return nil
+}
+
+// AddAgent registers an agent and returns its configuration with the template merged in. A spec
+// failing Validate is rejected without contacting the supervisor.
+func (c *Client) AddAgent(ctx context.Context, spec AgentSpec) (*AgentSpec, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	var registered AgentSpec
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/agents", spec, &registered); err != nil {
+		return nil, err
+	}
+	return &registered, nil
+}
+
+// GetAgent returns the configuration of an agent
+func (c *Client) GetAgent(ctx context.Context, agentID string) (*AgentSpec, error) {
+	var agent AgentSpec
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/agents/"+url.PathEscape(agentID), nil, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// GetAgentRaw returns an agent's configuration as it was submitted, before its template and the
+// server's agent defaults were merged in
+func (c *Client) GetAgentRaw(ctx context.Context, agentID string) (*AgentSpec, error) {
+	var agent AgentSpec
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/agents/"+url.PathEscape(agentID)+"?raw=true", nil, &agent); err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// AgentDefaultsResult is what reapplying the agent defaults did, or would do, to one agent
+type AgentDefaultsResult struct {
+	AgentID       string   `json:"agent_id"`
+	Status        string   `json:"status"` // applied, pending in dry runs, skipped or failed
+	ChangedFields []string `json:"changed_fields,omitempty"`
+	Message       string   `json:"message,omitempty"`
+}
+
+// ReapplyDefaultsResult summarizes reapplying the agent defaults
+type ReapplyDefaultsResult struct {
+	DryRun  bool                  `json:"dry_run,omitempty"`
+	Matched int                   `json:"matched"`
+	Updated int                   `json:"updated"`
+	Skipped int                   `json:"skipped"`
+	Failed  int                   `json:"failed"`
+	Results []AgentDefaultsResult `json:"results"`
+}
+
+// ReapplyAgentDefaults merges the server's current agent defaults into the given agents, or every
+// agent when none is given; with dryRun it only reports the settings each agent would change
+func (c *Client) ReapplyAgentDefaults(ctx context.Context, agentIDs []string, dryRun bool) (*ReapplyDefaultsResult, error) {
+	path := "/api/v1/agents/reapply-defaults"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+	var result ReapplyDefaultsResult
+	body := map[string]interface{}{"agent_ids": agentIDs}
+	if err := c.doJSON(ctx, http.MethodPost, path, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteAgent soft-deletes an agent, like supervisorctl agent delete. With force, the scheduled
+// tasks still running the agent are paused instead of failing the deletion.
+func (c *Client) DeleteAgent(ctx context.Context, agentID string, force bool) error {
+	path := "/api/v1/agents/" + url.PathEscape(agentID)
+	if force {
+		path += "?force=true"
+	}
+	return c.doJSON(ctx, http.MethodDelete, path, nil, &struct{}{})
+}
+
+// StartAgent starts a persistent agent's process, like supervisorctl start. It clears the agent's
+// failed starts, so an agent in the fatal state is restarted.
+func (c *Client) StartAgent(ctx context.Context, agentID string) (*ProcessStatus, error) {
+	var status ProcessStatus
+	path := "/api/v1/agents/" + url.PathEscape(agentID) + "/start"
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// AgentToggleResult reports an agent's enabled state after it was disabled or enabled, with its
+// in-flight executions
+type AgentToggleResult struct {
+	AgentID             string       `json:"agent_id"`
+	Enabled             bool         `json:"enabled"`
+	RunningExecutions   []string     `json:"running_executions"`             // In-flight executions left to finish
+	CancelledExecutions []string     `json:"cancelled_executions,omitempty"` // In-flight executions cancelled on disable
+	Hooks               []HookResult `json:"hooks,omitempty"`
+}
+
+// DisableOptions are the options of disabling an agent
+type DisableOptions struct {
+	CancelActive bool // Cancel the agent's in-flight executions, like --cancel-active; otherwise they finish
+}
+
+// DisableAgent makes an agent reject new executions from every protocol and the scheduler, like
+// supervisorctl disable <agent>. Its in-flight executions finish unless options.CancelActive is set.
+func (c *Client) DisableAgent(ctx context.Context, agentID string, options DisableOptions) (*AgentToggleResult, error) {
+	path := "/api/v1/agents/" + url.PathEscape(agentID) + "/disable"
+	if options.CancelActive {
+		path += "?cancel_active=true"
+	}
+	var result AgentToggleResult
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EnableAgent lets a disabled agent accept executions again, like supervisorctl enable <agent>
+func (c *Client) EnableAgent(ctx context.Context, agentID string) (*AgentToggleResult, error) {
+	var result AgentToggleResult
+	path := "/api/v1/agents/" + url.PathEscape(agentID) + "/enable"
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RestartAgent cancels an agent's in-flight executions, waits for them to exit and enables the
+// agent again, like supervisorctl restart <agent>; a persistent agent's pre-stop hook runs first
+func (c *Client) RestartAgent(ctx context.Context, agentID string) (*AgentToggleResult, error) {
+	var result AgentToggleResult
+	path := "/api/v1/agents/" + url.PathEscape(agentID) + "/restart"
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAgentTemplates returns all agent templates, ordered by name
+func (c *Client) ListAgentTemplates(ctx context.Context) ([]AgentTemplate, error) {
+	var response struct {
+		Templates []AgentTemplate `json:"templates"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/agent-templates", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Templates, nil
+}
+
+// GetAgentTemplate returns an agent template
+func (c *Client) GetAgentTemplate(ctx context.Context, name string) (*AgentTemplate, error) {
+	var template AgentTemplate
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/agent-templates/"+url.PathEscape(name), nil, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// CreateAgentTemplate creates an agent template
+func (c *Client) CreateAgentTemplate(ctx context.Context, template AgentTemplate) error {
+	return c.doJSON(ctx, http.MethodPost, "/api/v1/agent-templates", template, &struct{}{})
+}
+
+// UpdateAgentTemplate replaces the settings of an agent template. Whether agents already using it
+// pick up the change depends on the supervisor's agent_templates.propagate_updates setting.
+func (c *Client) UpdateAgentTemplate(ctx context.Context, template AgentTemplate) error {
+	return c.doJSON(ctx, http.MethodPut, "/api/v1/agent-templates/"+url.PathEscape(template.Name), template, &struct{}{})
+}
+
+// DeleteAgentTemplate deletes an agent template; it fails while agents still use the template
+func (c *Client) DeleteAgentTemplate(ctx context.Context, name string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/api/v1/agent-templates/"+url.PathEscape(name), nil, &struct{}{})
+}
+
+// PrintFieldErrors writes the field errors of a rejected request or spec as a table, one row per
+// problem, as supervisorctl agent add prints them. It reports whether err carried any.
+func PrintFieldErrors(w io.Writer, err error) bool {
+	var fieldErrs []FieldError
+	var apiErr *APIError
+	var specErr *SpecError
+	switch {
+	case errors.As(err, &apiErr):
+		fieldErrs = apiErr.Errors
+	case errors.As(err, &specErr):
+		fieldErrs = specErr.Errors
+	}
+	if len(fieldErrs) == 0 {
+		return false
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FIELD\tCODE\tMESSAGE")
+	for _, fieldErr := range fieldErrs {
+		field := fieldErr.Field
+		if field == "" {
+			field = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", field, fieldErr.Code, fieldErr.Message)
+	}
+	table.Flush()
+	return true
+}
@@ -0,0 +1,223 @@
+package supervisorctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// DefaultDetachKey detaches from an attached agent without stopping it: Ctrl-], as in telnet
+const DefaultDetachKey byte = 0x1d
+
+// Channels of an attach session; every message starts with the byte of its channel
+const (
+	attachChannelStdin  byte = 0
+	attachChannelStdout byte = 1
+	attachChannelStderr byte = 2
+	attachChannelStatus byte = 3
+)
+
+// ErrAttachedProcessExited is returned by Attach when the attached agent process exited
+var ErrAttachedProcessExited = errors.New("attached agent process exited")
+
+// AttachOptions changes how Attach relays the terminal
+type AttachOptions struct {
+	DetachKey byte // Typed on stdin to detach; DefaultDetachKey when 0
+}
+
+// ParseDetachKey parses a detach key given as ctrl-<key>, such as ctrl-] or ctrl-x, or as a single
+// character, as supervisorctl fg --detach-key takes it
+func ParseDetachKey(text string) (byte, error) {
+	if key, ok := strings.CutPrefix(strings.ToLower(text), "ctrl-"); ok && len(key) == 1 {
+		upper := strings.ToUpper(key)[0]
+		if upper >= '@' && upper <= '_' {
+			return upper & 0x1f, nil
+		}
+	}
+	if len(text) == 1 {
+		return text[0], nil
+	}
+	return 0, fmt.Errorf("invalid detach key %q: expected ctrl-<key>, such as ctrl-], or a single character", text)
+}
+
+// Attach attaches to the running process of a persistent agent, like supervisorctl fg <agent>:
+// what is read from stdin goes to the process's stdin, and what the process writes to its stdout
+// and stderr is written to stdout and stderr as it comes. Typing the detach key, or stdin ending,
+// detaches and returns nil, leaving the process running. The process exiting returns an error
+// wrapping ErrAttachedProcessExited, and attaching while another session is attached fails with a
+// 409 *APIError. Put a terminal in raw mode first, so the detach key is read as it is typed.
+func (c *Client) Attach(ctx context.Context, agentID string, stdin io.Reader, stdout, stderr io.Writer, options AttachOptions) error {
+	detachKey := options.DetachKey
+	if detachKey == 0 {
+		detachKey = DefaultDetachKey
+	}
+
+	ws, err := c.dialAttach(ctx, "/api/v1/agents/"+url.PathEscape(agentID)+"/attach")
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	var (
+		detachOnce sync.Once
+		detached   = make(chan struct{})
+	)
+	detach := func() {
+		detachOnce.Do(func() {
+			close(detached)
+			ws.Close()
+		})
+	}
+	stopOnCancel := context.AfterFunc(ctx, detach)
+	defer stopOnCancel()
+
+	// The goroutine reading stdin stays blocked in Read after detaching when stdin never ends
+	go func() {
+		defer detach()
+		buffer := make([]byte, 4096)
+		for {
+			n, err := stdin.Read(buffer)
+			input := buffer[:n]
+			at := bytes.IndexByte(input, detachKey)
+			if at >= 0 {
+				input = input[:at]
+			}
+			if len(input) > 0 {
+				if websocket.Message.Send(ws, append([]byte{attachChannelStdin}, input...)) != nil {
+					return
+				}
+			}
+			if at >= 0 || err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var message []byte
+		if err := websocket.Message.Receive(ws, &message); err != nil {
+			select {
+			case <-detached:
+				return ctx.Err()
+			default:
+			}
+			return fmt.Errorf("%w: attach session closed: %w", ErrUnreachable, err)
+		}
+		if len(message) == 0 {
+			continue
+		}
+		switch message[0] {
+		case attachChannelStdout:
+			stdout.Write(message[1:])
+		case attachChannelStderr:
+			stderr.Write(message[1:])
+		case attachChannelStatus:
+			detachOnce.Do(func() { close(detached) })
+			return fmt.Errorf("%w: %s", ErrAttachedProcessExited, message[1:])
+		}
+	}
+}
+
+// dialAttach opens the WebSocket of an attach session at path, over the unix socket when the
+// client has one. A rejected upgrade is returned as an *APIError.
+func (c *Client) dialAttach(ctx context.Context, path string) (*websocket.Conn, error) {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	location := *base
+	location.Scheme = "ws"
+	if base.Scheme == "https" {
+		location.Scheme = "wss"
+	}
+	location.Path = strings.TrimRight(base.Path, "/") + path
+	config, err := websocket.NewConfig(location.String(), base.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid attach URL: %w", err)
+	}
+	if c.token != "" {
+		config.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	transport, _ := c.httpClient.Transport.(*http.Transport)
+	dial := (&net.Dialer{}).DialContext
+	if transport != nil && transport.DialContext != nil {
+		dial = transport.DialContext
+	}
+	address := base.Host
+	if base.Port() == "" {
+		port := "80"
+		if base.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(base.Hostname(), port)
+	}
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect: %w", ErrUnreachable, err)
+	}
+	if base.Scheme == "https" {
+		tlsConfig := &tls.Config{}
+		if transport != nil && transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = base.Hostname()
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	// The handshake is abandoned when ctx ends first
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	recorder := &handshakeRecorder{Conn: conn}
+	ws, err := websocket.NewClient(config, recorder)
+	stop()
+	recorder.handshaken = true
+	if err == nil {
+		return ws, nil
+	}
+	defer conn.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// A rejected upgrade is an ordinary response, such as 409 when another session is attached
+	if errors.Is(err, websocket.ErrBadStatus) {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		response, readErr := http.ReadResponse(bufio.NewReader(io.MultiReader(bytes.NewReader(recorder.recorded), conn)), nil)
+		if readErr == nil {
+			defer response.Body.Close()
+			return nil, readAPIError(response)
+		}
+	}
+	return nil, fmt.Errorf("%w: failed to attach: %w", ErrUnreachable, err)
+}
+
+// handshakeRecorder keeps what is read from a connection during the WebSocket handshake, so a
+// response rejecting the upgrade can be read again
+type handshakeRecorder struct {
+	net.Conn
+	handshaken bool
+	recorded   []byte
+}
+
+// Read implements io.Reader
+func (r *handshakeRecorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	if !r.handshaken {
+		r.recorded = append(r.recorded, p[:n]...)
+	}
+	return n, err
+}
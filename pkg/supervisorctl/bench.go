@@ -0,0 +1,274 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchOptions controls Bench, like supervisorctl bench's --agents, --rate and --duration flags
+type BenchOptions struct {
+	Agents   int           // Synthetic agents the executions are spread over, 1 when 0
+	Rate     float64       // Executions started per second across all agents, see ParseRate
+	Duration time.Duration // How long executions keep being started
+	Agent    AgentSpec     // Settings of the synthetic agents, DefaultBenchAgent when zero-valued; Bench sets the ID and agent type
+}
+
+// LatencyPercentiles summarizes the latencies of the executions of a benchmark
+type LatencyPercentiles struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// BenchReport is the outcome of a benchmark
+type BenchReport struct {
+	Agents     int                `json:"agents"`
+	Duration   time.Duration      `json:"duration"` // From the first execution started to the last finished
+	Executions int                `json:"executions"`
+	Succeeded  int                `json:"succeeded"`
+	Failed     int                `json:"failed"`
+	Errors     map[string]int     `json:"errors"`     // Failed executions by result status, or by error code when the request failed
+	Throughput float64            `json:"throughput"` // Finished executions per second
+	Latency    LatencyPercentiles `json:"latency"`    // Of the executions that returned a result
+}
+
+// DefaultBenchAgent returns the settings of the synthetic agents Bench registers when
+// BenchOptions sets none: read-only agents taking 10ms per execution
+func DefaultBenchAgent() AgentSpec {
+	return AgentSpec{
+		Name:                    "Benchmark agent",
+		Mode:                    "task",
+		InputPattern:            "stdin",
+		OutputPattern:           "stdout",
+		AccessType:              "read-only",
+		MaxConcurrentExecutions: 10,
+		Enabled:                 true,
+		Parameters:              map[string]string{"duration": "10ms"},
+	}
+}
+
+// ParseRate parses an execution rate such as "100/s", "600/m" or "3600/h"; a bare number is per
+// second
+func ParseRate(value string) (float64, error) {
+	count, unit, found := strings.Cut(strings.TrimSpace(value), "/")
+	per := time.Second
+	if found {
+		switch unit {
+		case "s":
+		case "m":
+			per = time.Minute
+		case "h":
+			per = time.Hour
+		default:
+			return 0, fmt.Errorf("invalid rate %q: unit must be s, m or h", value)
+		}
+	}
+	rate, err := strconv.ParseFloat(count, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("invalid rate %q: must be a positive number of executions per s, m or h", value)
+	}
+	return rate * float64(time.Second) / float64(per), nil
+}
+
+// Bench registers synthetic agents, runs executions through them at the configured rate for the
+// configured duration and reports the throughput, latencies and errors, like supervisorctl bench
+// --agents 10 --rate 100/s --duration 60s. Executions run through the supervisor's real queues,
+// pools, history and metrics; only the agent processes are simulated. The agents are deleted
+// again once the executions in flight have finished.
+func (c *Client) Bench(ctx context.Context, options BenchOptions) (*BenchReport, error) {
+	if options.Rate <= 0 {
+		return nil, errors.New("bench rate must be positive")
+	}
+	if options.Duration <= 0 {
+		return nil, errors.New("bench duration must be positive")
+	}
+	if options.Agents <= 0 {
+		options.Agents = 1
+	}
+
+	agentIDs, err := c.registerBenchAgents(ctx, options)
+	defer c.deleteBenchAgents(ctx, agentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &benchRecorder{errors: make(map[string]int)}
+	interval := time.Duration(float64(time.Second) / options.Rate)
+	start := time.Now()
+	deadline := start.Add(options.Duration)
+
+	// Executions start on a fixed schedule, however long earlier ones take, so a slow supervisor
+	// shows as rising latencies rather than a lower request rate
+	var wg sync.WaitGroup
+	for n, next := 0, start; next.Before(deadline); n, next = n+1, next.Add(interval) {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		case <-time.After(time.Until(next)):
+		}
+
+		wg.Add(1)
+		go func(agentID string) {
+			defer wg.Done()
+			began := time.Now()
+			result, err := c.Execute(ctx, agentID, ExecuteRequest{Input: "bench", NoCache: true})
+			recorder.record(result, err, time.Since(began))
+		}(agentIDs[n%len(agentIDs)])
+	}
+	wg.Wait()
+
+	return recorder.report(options.Agents, time.Since(start)), nil
+}
+
+// registerBenchAgents registers the synthetic agents of a benchmark and returns the IDs of those
+// registered, under a prefix unique to the run
+func (c *Client) registerBenchAgents(ctx context.Context, options BenchOptions) ([]string, error) {
+	spec := options.Agent
+	if spec.Name == "" && spec.AccessType == "" && len(spec.Parameters) == 0 {
+		spec = DefaultBenchAgent()
+	}
+	spec.AgentType = "synthetic"
+
+	prefix := "bench-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	var agentIDs []string
+	for i := 1; i <= options.Agents; i++ {
+		spec.ID = fmt.Sprintf("%s-%d", prefix, i)
+		if _, err := c.AddAgent(ctx, spec); err != nil {
+			return agentIDs, fmt.Errorf("failed to register benchmark agent %s: %w", spec.ID, err)
+		}
+		agentIDs = append(agentIDs, spec.ID)
+	}
+	return agentIDs, nil
+}
+
+// deleteBenchAgents deletes the agents of a benchmark, even when ctx was cancelled
+func (c *Client) deleteBenchAgents(ctx context.Context, agentIDs []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, agentID := range agentIDs {
+		c.DeleteAgent(ctx, agentID, true)
+	}
+}
+
+// benchRecorder collects the outcomes of the executions of a benchmark
+type benchRecorder struct {
+	mutex     sync.Mutex
+	latencies []time.Duration
+	succeeded int
+	failed    int
+	errors    map[string]int
+}
+
+// record adds the outcome of one execution
+func (r *benchRecorder) record(result *ExecutionResult, err error, latency time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch {
+	case err != nil:
+		r.failed++
+		r.errors[benchErrorKind(err)]++
+	case result.Status != "success":
+		r.failed++
+		r.errors[result.Status]++
+		r.latencies = append(r.latencies, latency)
+	default:
+		r.succeeded++
+		r.latencies = append(r.latencies, latency)
+	}
+}
+
+// report summarizes the recorded executions
+func (r *benchRecorder) report(agents int, elapsed time.Duration) *BenchReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	report := &BenchReport{
+		Agents:     agents,
+		Duration:   elapsed,
+		Executions: r.succeeded + r.failed,
+		Succeeded:  r.succeeded,
+		Failed:     r.failed,
+		Errors:     r.errors,
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Executions) / elapsed.Seconds()
+	}
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	report.Latency = LatencyPercentiles{
+		P50: percentile(r.latencies, 50),
+		P90: percentile(r.latencies, 90),
+		P95: percentile(r.latencies, 95),
+		P99: percentile(r.latencies, 99),
+		Max: percentile(r.latencies, 100),
+	}
+	return report
+}
+
+// percentile returns the p-th percentile of sorted latencies by the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// benchErrorKind names a failed execute request by the supervisor's error code, or unreachable
+// when no response arrived
+func benchErrorKind(err error) string {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code != "":
+		return apiErr.Code
+	case errors.As(err, &apiErr):
+		return strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, ErrUnreachable):
+		return "unreachable"
+	default:
+		return "error"
+	}
+}
+
+// Print writes the report as supervisorctl bench prints it
+func (r *BenchReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "agents:      %d\n", r.Agents)
+	fmt.Fprintf(w, "executions:  %d (%d succeeded, %d failed)\n", r.Executions, r.Succeeded, r.Failed)
+	fmt.Fprintf(w, "duration:    %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput:  %.2f/s\n", r.Throughput)
+	fmt.Fprintf(w, "latency:     p50 %s  p90 %s  p95 %s  p99 %s  max %s\n",
+		roundLatency(r.Latency.P50), roundLatency(r.Latency.P90), roundLatency(r.Latency.P95),
+		roundLatency(r.Latency.P99), roundLatency(r.Latency.Max))
+	if len(r.Errors) == 0 {
+		return
+	}
+
+	kinds := make([]string, 0, len(r.Errors))
+	for kind := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	fmt.Fprintln(w, "errors:")
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %-20s %d\n", kind, r.Errors[kind])
+	}
+}
+
+// roundLatency rounds a latency for display
+func roundLatency(latency time.Duration) time.Duration {
+	return latency.Round(10 * time.Microsecond)
+}
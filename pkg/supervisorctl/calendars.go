@@ -0,0 +1,59 @@
+package supervisorctl
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CalendarDate is a day or a run of days a calendar excludes, both ends included
+type CalendarDate struct {
+	Start  string `json:"start"`         // e.g. 2026-12-24
+	End    string `json:"end,omitempty"` // Start alone when empty
+	Reason string `json:"reason,omitempty"`
+}
+
+// Calendar is a named list of days on which the scheduled tasks skipping it do not run
+type Calendar struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Dates       []CalendarDate `json:"dates"`
+	CreatedAt   time.Time      `json:"created_at,omitempty"`
+	UpdatedAt   time.Time      `json:"updated_at,omitempty"`
+}
+
+// ListCalendars returns all calendars, ordered by name
+func (c *Client) ListCalendars(ctx context.Context) ([]Calendar, error) {
+	var response struct {
+		Calendars []Calendar `json:"calendars"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/calendars", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Calendars, nil
+}
+
+// GetCalendar returns a calendar
+func (c *Client) GetCalendar(ctx context.Context, name string) (*Calendar, error) {
+	var calendar Calendar
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/calendars/"+url.PathEscape(name), nil, &calendar); err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+// CreateCalendar creates a calendar
+func (c *Client) CreateCalendar(ctx context.Context, calendar Calendar) error {
+	return c.doJSON(ctx, http.MethodPost, "/api/v1/calendars", calendar, &struct{}{})
+}
+
+// UpdateCalendar replaces the description and dates of a calendar
+func (c *Client) UpdateCalendar(ctx context.Context, calendar Calendar) error {
+	return c.doJSON(ctx, http.MethodPut, "/api/v1/calendars/"+url.PathEscape(calendar.Name), calendar, &struct{}{})
+}
+
+// DeleteCalendar deletes a calendar; the supervisor refuses while a scheduled task skips it
+func (c *Client) DeleteCalendar(ctx context.Context, name string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/api/v1/calendars/"+url.PathEscape(name), nil, &struct{}{})
+}
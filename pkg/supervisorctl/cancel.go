@@ -0,0 +1,97 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Outcomes of a cancellation on one execution
+const (
+	CancelOutcomeCancelled       = "cancelled"
+	CancelOutcomeAlreadyTerminal = "already_terminal"
+	CancelOutcomeNotCancellable  = "not_cancellable"
+)
+
+// CancelTarget picks what supervisorctl cancel stops: every unfinished execution of an agent
+// (--agent), of a task (--task), or a single execution (--execution). Exactly one is set.
+type CancelTarget struct {
+	AgentID     string
+	TaskID      string
+	ExecutionID string
+}
+
+// ExecutionCancellation is the outcome of a cancellation on one execution
+type ExecutionCancellation struct {
+	ExecutionID   string `json:"execution_id"`
+	AgentID       string `json:"agent_id"`
+	PreviousState string `json:"previous_state"`
+	Outcome       string `json:"outcome"` // cancelled, already_terminal or not_cancellable
+	Message       string `json:"message,omitempty"`
+}
+
+// CancelResult reports a cancellation's outcome on each execution it found, oldest first
+type CancelResult struct {
+	AgentID         string                  `json:"agent_id,omitempty"`
+	TaskID          string                  `json:"task_id,omitempty"`
+	Matched         int                     `json:"matched"`
+	Cancelled       int                     `json:"cancelled"`
+	AlreadyTerminal int                     `json:"already_terminal"`
+	NotCancellable  int                     `json:"not_cancellable"`
+	Results         []ExecutionCancellation `json:"results"`
+}
+
+// Cancel stops what target picks, like supervisorctl cancel --agent <id>: running executions have
+// their agent stopped and queued ones are cancelled without ever running. A single execution is
+// stopped like StopExecution with the agent's stop signal.
+func (c *Client) Cancel(ctx context.Context, target CancelTarget) (*CancelResult, error) {
+	set := 0
+	for _, value := range []string{target.AgentID, target.TaskID, target.ExecutionID} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("cancel needs exactly one of --agent, --task and --execution")
+	}
+
+	if target.ExecutionID != "" {
+		execution, err := c.StopExecution(ctx, target.ExecutionID, "")
+		if err != nil {
+			return nil, err
+		}
+		return &CancelResult{
+			Matched:   1,
+			Cancelled: 1,
+			Results: []ExecutionCancellation{
+				{ExecutionID: execution.ID, AgentID: execution.AgentID, PreviousState: execution.PreviousState, Outcome: CancelOutcomeCancelled},
+			},
+		}, nil
+	}
+
+	path := "/api/v1/agents/" + url.PathEscape(target.AgentID) + "/cancel-all"
+	if target.TaskID != "" {
+		path = "/tasks/" + url.PathEscape(target.TaskID) + "/cancel-active"
+	}
+	var result CancelResult
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Print writes the outcome per execution and the totals as supervisorctl cancel shows them
+func (r *CancelResult) Print(w io.Writer) {
+	for _, result := range r.Results {
+		line := fmt.Sprintf("%s  %s  %s -> %s", result.ExecutionID, result.AgentID, result.PreviousState, result.Outcome)
+		if result.Message != "" {
+			line += ": " + result.Message
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "%d matched, %d cancelled, %d already terminal, %d not cancellable\n",
+		r.Matched, r.Cancelled, r.AlreadyTerminal, r.NotCancellable)
+}
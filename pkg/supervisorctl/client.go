@@ -0,0 +1,356 @@
+package supervisorctl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event names of an execution stream
+const (
+	EventState     = "state"
+	EventOutput    = "output"
+	EventProgress  = "progress"
+	EventHeartbeat = "heartbeat"
+	EventResult    = "result"
+)
+
+// errUnknownEvent marks events added to the stream after this client was written; they are skipped
+var errUnknownEvent = errors.New("unknown stream event")
+
+// Client calls the supervisor's REST API
+type Client struct {
+	baseURL     string
+	token       string
+	httpClient  *http.Client
+	retryPolicy RetryPolicy
+	breaker     *circuitBreaker
+}
+
+// APIError is an error response from the supervisor
+type APIError struct {
+	StatusCode int
+	Code       string       `json:"code"`
+	Message    string       `json:"error"`
+	Errors     []FieldError `json:"-"` // Every problem found when the request failed validation
+
+	// Set on 403 responses when the token lacks the permission the request requires
+	RequiredPermission string `json:"-"`
+	RequiredRole       string `json:"-"` // Least privileged role granting RequiredPermission
+	Role               string `json:"-"` // Role of the token, empty when it is granted a list of permissions
+
+	// Set on 428 responses to group and pattern operations that must be resent with the token
+	ConfirmationToken string    `json:"-"`
+	ExpiresAt         time.Time `json:"-"` // When ConfirmationToken stops being accepted
+	Agents            []string  `json:"-"` // Agents the confirmed operation applies to
+}
+
+// FieldError is a problem with one field of a rejected agent or task
+type FieldError struct {
+	Field   string `json:"field"` // JSON path such as "access_type" or "parameters.duration"
+	Code    string `json:"code"`  // required, invalid, out_of_range, conflict, not_found or unavailable
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("supervisor returned %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("supervisor returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is matches ErrUnauthorized for 401 and 403 responses and ErrServerError for 5xx responses
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrServerError:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// PrintPermissionError explains a request rejected because the token lacks a permission, naming
+// the role needed, as supervisorctl prints it. It reports whether err was such a rejection.
+func PrintPermissionError(w io.Writer, err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.RequiredPermission == "" {
+		return false
+	}
+
+	fmt.Fprintf(w, "permission denied: this requires the %s permission, granted by the %s role", apiErr.RequiredPermission, apiErr.RequiredRole)
+	if apiErr.Role != "" {
+		fmt.Fprintf(w, "; your token has the %s role", apiErr.Role)
+	}
+	fmt.Fprintln(w)
+	return true
+}
+
+// StreamExecuteRequest is the request body of an execution stream
+type StreamExecuteRequest struct {
+	Input              string                 `json:"input"`
+	Parameters         map[string]interface{} `json:"parameters,omitempty"`
+	WorkingDir         string                 `json:"working_dir,omitempty"`
+	Env                map[string]string      `json:"env,omitempty"`
+	TimeoutSeconds     int                    `json:"timeout_seconds,omitempty"`
+	Labels             map[string]string      `json:"labels,omitempty"`
+	NoCache            bool                   `json:"no_cache,omitempty"`
+	CancelOnDisconnect bool                   `json:"cancel_on_disconnect,omitempty"` // Cancel the execution when the stream closes
+}
+
+// StateEvent reports that the execution entered a new state
+type StateEvent struct {
+	ExecutionID string `json:"execution_id"`
+	State       string `json:"state"`
+}
+
+// OutputEvent carries a chunk of the agent's output as it was written
+type OutputEvent struct {
+	ExecutionID string `json:"execution_id"`
+	Stream      string `json:"stream"` // stdout or stderr
+	Data        string `json:"data"`
+}
+
+// ProgressEvent carries a progress report the agent wrote to stderr as a @@progress marker
+type ProgressEvent struct {
+	ExecutionID string `json:"execution_id"`
+	Progress
+}
+
+// HeartbeatEvent is sent while the execution is quiet
+type HeartbeatEvent struct {
+	Time time.Time `json:"time"`
+}
+
+// ResultEvent summarizes the finished execution
+type ResultEvent struct {
+	ExecutionID   string `json:"execution_id,omitempty"`
+	AgentID       string `json:"agent_id"`
+	State         string `json:"state,omitempty"`
+	Status        string `json:"status,omitempty"`
+	ExitCode      int    `json:"exit_code"`
+	Signal        string `json:"signal,omitempty"`
+	Output        string `json:"output"`
+	Error         string `json:"error,omitempty"`
+	StderrTail    string `json:"stderr_tail,omitempty"`
+	ExecutionTime int64  `json:"execution_time"` // milliseconds
+	FromCache     bool   `json:"from_cache,omitempty"`
+	Deduplicated  bool   `json:"deduplicated,omitempty"`
+}
+
+// StreamEvent is one event of an execution stream; exactly one of its payloads is set. Err is set
+// on the last event when the stream broke off before its result.
+type StreamEvent struct {
+	Name      string
+	State     *StateEvent
+	Output    *OutputEvent
+	Progress  *ProgressEvent
+	Heartbeat *HeartbeatEvent
+	Result    *ResultEvent
+	Err       error
+}
+
+// NewClient creates a client of the supervisor serving at baseURL, such as http://localhost:8080, or
+// on a unix domain socket, such as unix:///var/run/supervisor.sock
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:     requestBaseURL(baseURL),
+		httpClient:  NewHTTPClient(baseURL, 0),
+		retryPolicy: DefaultRetryPolicy(),
+		breaker:     &circuitBreaker{},
+	}
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+// SetRetryPolicy sets how failed requests are retried; a zero RetryPolicy disables retries and the
+// circuit breaker
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetToken sets the bearer token sent with requests
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// StreamExecute runs an agent and returns its events as they arrive. The channel is closed after
+// the result event, when the stream breaks off, or when ctx is cancelled. Requests the supervisor
+// rejects before running the agent return an *APIError.
+func (c *Client) StreamExecute(ctx context.Context, agentID string, request StreamExecuteRequest) (<-chan StreamEvent, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode stream execute request: %w", err)
+	}
+
+	header := http.Header{"Accept": []string{"text/event-stream"}}
+	response, err := c.send(ctx, http.MethodPost, "/api/v1/agents/"+url.PathEscape(agentID)+"/execute/stream", body, header)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan StreamEvent)
+	go func() {
+		defer close(events)
+		defer response.Body.Close()
+		readStream(ctx, response.Body, events)
+	}()
+	return events, nil
+}
+
+// newRequest creates a request to the supervisor with a JSON body, attributed to a manual trigger
+func (c *Client) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("X-Trigger-Type", "manual")
+	if c.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return httpRequest, nil
+}
+
+// doJSON sends request as JSON and decodes the response into response
+func (c *Client) doJSON(ctx context.Context, method, path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	httpResponse, err := c.send(ctx, method, path, body, nil)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if err := json.NewDecoder(httpResponse.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	// Reading the body to its end lets the connection be reused
+	io.Copy(io.Discard, httpResponse.Body)
+	return nil
+}
+
+// readStream decodes server-sent events from body until the result event
+func readStream(ctx context.Context, body io.Reader, events chan<- StreamEvent) {
+	send := func(event StreamEvent) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var name string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if name == "" && len(data) == 0 {
+				continue
+			}
+			event, err := decodeEvent(name, strings.Join(data, "\n"))
+			name, data = "", nil
+			if errors.Is(err, errUnknownEvent) {
+				continue
+			}
+			if err != nil {
+				send(StreamEvent{Name: event.Name, Err: err})
+				return
+			}
+			if !send(event) || event.Result != nil {
+				return
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	send(StreamEvent{Err: fmt.Errorf("execution stream ended before its result: %w", err)})
+}
+
+// decodeEvent decodes the payload of the named event
+func decodeEvent(name, data string) (StreamEvent, error) {
+	event := StreamEvent{Name: name}
+	var payload interface{}
+	switch name {
+	case EventState:
+		event.State = &StateEvent{}
+		payload = event.State
+	case EventOutput:
+		event.Output = &OutputEvent{}
+		payload = event.Output
+	case EventProgress:
+		event.Progress = &ProgressEvent{}
+		payload = event.Progress
+	case EventHeartbeat:
+		event.Heartbeat = &HeartbeatEvent{}
+		payload = event.Heartbeat
+	case EventResult:
+		event.Result = &ResultEvent{}
+		payload = event.Result
+	default:
+		return event, errUnknownEvent
+	}
+
+	if err := json.Unmarshal([]byte(data), payload); err != nil {
+		return event, fmt.Errorf("failed to decode %s event: %w", name, err)
+	}
+	return event, nil
+}
+
+// readAPIError decodes the error envelope of a failed response
+func readAPIError(response *http.Response) error {
+	apiErr := &APIError{StatusCode: response.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	var envelope struct {
+		Details struct {
+			Errors             []FieldError `json:"errors"`
+			RequiredPermission string       `json:"required_permission"`
+			RequiredRole       string       `json:"required_role"`
+			Role               string       `json:"role"`
+			ConfirmationToken  string       `json:"confirmation_token"`
+			ExpiresAt          time.Time    `json:"expires_at"`
+			Agents             []string     `json:"agents"`
+		} `json:"details"`
+	}
+	if json.Unmarshal(body, &envelope) == nil {
+		apiErr.Errors = envelope.Details.Errors
+		apiErr.RequiredPermission = envelope.Details.RequiredPermission
+		apiErr.RequiredRole = envelope.Details.RequiredRole
+		apiErr.Role = envelope.Details.Role
+		apiErr.ConfirmationToken = envelope.Details.ConfirmationToken
+		apiErr.ExpiresAt = envelope.Details.ExpiresAt
+		apiErr.Agents = envelope.Details.Agents
+	}
+	return apiErr
+}
@@ -0,0 +1,288 @@
+package supervisorctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CompletionTimeout bounds the server queries of dynamic completion, so that an unreachable
+// supervisor never stalls the shell
+const CompletionTimeout = 2 * time.Second
+
+// CompleteCommand is the hidden command the completion scripts run to ask for candidates, as
+// supervisorctl __complete <args...> <word being completed>
+const CompleteCommand = "__complete"
+
+// CompletionShells are the shells supervisorctl completion generates scripts for
+var CompletionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// AgentTargetCommands take agent targets, an agent ID or group:<name>, as their arguments
+var AgentTargetCommands = []string{"start", "stop", "restart", "status", "logs", "wait"}
+
+// TaskCommands are the task subcommands taking a task ID as their argument
+var TaskCommands = []string{"get", "update", "delete", "pause", "resume", "run", "schedule", "preview-input"}
+
+// CompletionDirective tells the shell how to treat the candidates, with the values of cobra's
+// ShellCompDirective
+type CompletionDirective int
+
+const (
+	CompletionDefault    CompletionDirective = 0 // Candidates, falling back to file names
+	CompletionNoSpace    CompletionDirective = 2 // Do not add a space after the candidate
+	CompletionNoFileComp CompletionDirective = 4 // Never fall back to file names
+)
+
+// ICompletionClient is the part of the client dynamic completion queries
+type ICompletionClient interface {
+	// ListAgents returns a page of the agents
+	ListAgents(ctx context.Context, options ListOptions) (*AgentPage, error)
+
+	// ListGroups returns all agent groups
+	ListGroups(ctx context.Context) ([]AgentGroup, error)
+
+	// QueryTasks returns a page of the scheduled tasks
+	QueryTasks(ctx context.Context, options ListOptions) (*TaskPage, error)
+}
+
+// ValidArgsFunction completes the word toComplete following args, the arguments already typed after
+// the command's name. It never fails: when the supervisor cannot be reached it returns no candidates.
+type ValidArgsFunction func(ctx context.Context, args []string, toComplete string) ([]string, CompletionDirective)
+
+// CompleteAgentTargets completes agent targets for the lifecycle commands: the IDs of the agents and
+// group:<name> for the agent groups. Once the word starts with group: only groups are offered.
+func CompleteAgentTargets(client ICompletionClient) ValidArgsFunction {
+	return func(ctx context.Context, args []string, toComplete string) ([]string, CompletionDirective) {
+		ctx, cancel := context.WithTimeout(ctx, CompletionTimeout)
+		defer cancel()
+
+		var candidates []string
+		if !strings.HasPrefix(toComplete, GroupTargetPrefix) {
+			if page, err := client.ListAgents(ctx, ListOptions{}); err == nil {
+				for _, agent := range page.Agents {
+					candidates = append(candidates, agent.ID)
+				}
+			}
+		}
+		if groups, err := client.ListGroups(ctx); err == nil {
+			for _, group := range groups {
+				candidates = append(candidates, GroupTargetPrefix+group.Name)
+			}
+		}
+		return filterCandidates(candidates, args, toComplete), CompletionNoFileComp
+	}
+}
+
+// CompleteTaskIDs completes the task IDs for the task subcommands; they take a single task
+func CompleteTaskIDs(client ICompletionClient) ValidArgsFunction {
+	return func(ctx context.Context, args []string, toComplete string) ([]string, CompletionDirective) {
+		if len(args) > 0 {
+			return nil, CompletionNoFileComp
+		}
+		ctx, cancel := context.WithTimeout(ctx, CompletionTimeout)
+		defer cancel()
+
+		page, err := client.QueryTasks(ctx, ListOptions{})
+		if err != nil {
+			return nil, CompletionNoFileComp
+		}
+		candidates := make([]string, 0, len(page.Tasks))
+		for _, task := range page.Tasks {
+			candidates = append(candidates, task.ID)
+		}
+		return filterCandidates(candidates, args, toComplete), CompletionNoFileComp
+	}
+}
+
+// filterCandidates keeps the candidates starting with toComplete that are not already in args
+func filterCandidates(candidates, args []string, toComplete string) []string {
+	var filtered []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, toComplete) && !slices.Contains(args, candidate) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+// Complete answers supervisorctl __complete: words are the arguments after the program name, the
+// last being the word to complete. It writes one candidate per line followed by :<directive>, the
+// protocol of cobra's completion scripts, and never writes errors that would corrupt the shell's
+// completion output.
+func Complete(ctx context.Context, client ICompletionClient, w io.Writer, words []string) {
+	candidates, directive := completeWords(ctx, client, words)
+	writeCandidates(w, candidates, directive)
+}
+
+// writeCandidates writes candidates in the protocol of cobra's completion scripts
+func writeCandidates(w io.Writer, candidates []string, directive CompletionDirective) {
+	for _, candidate := range candidates {
+		fmt.Fprintln(w, candidate)
+	}
+	fmt.Fprintf(w, ":%d\n", directive)
+}
+
+// CompleteWithConfig answers supervisorctl __complete like Complete, querying the supervisor the
+// config resolves to once the global flags among words are applied, so that completion follows
+// --server, --token and --profile like any command. The word after --profile completes the
+// profile names; the words after --server and --token complete nothing.
+func CompleteWithConfig(ctx context.Context, manager *ConfigManager, w io.Writer, words []string) {
+	if len(words) >= 2 && slices.Contains(globalFlagNames, words[len(words)-2]) {
+		var candidates []string
+		if words[len(words)-2] == "--profile" {
+			names, _ := manager.Profiles()
+			candidates = filterCandidates(names, nil, words[len(words)-1])
+		}
+		writeCandidates(w, candidates, CompletionNoFileComp)
+		return
+	}
+
+	if len(words) == 0 {
+		writeCandidates(w, nil, CompletionNoFileComp)
+		return
+	}
+	flags, args, err := ParseGlobalFlags(words[:len(words)-1])
+	if err == nil {
+		err = manager.ApplyGlobalFlags(flags)
+	}
+	var client *Client
+	if err == nil {
+		var config *Config
+		if config, err = manager.Load(); err == nil {
+			client, err = NewClientFromConfig(config)
+		}
+	}
+	if err != nil {
+		// An unusable config leaves no candidates rather than corrupting the shell's output
+		writeCandidates(w, nil, CompletionNoFileComp)
+		return
+	}
+	Complete(ctx, client, w, append(args, words[len(words)-1:]...))
+}
+
+// completeWords picks the candidates for the last of words from the command the others name
+func completeWords(ctx context.Context, client ICompletionClient, words []string) ([]string, CompletionDirective) {
+	if len(words) == 0 {
+		return nil, CompletionNoFileComp
+	}
+	args, toComplete := words[:len(words)-1], words[len(words)-1]
+	if len(args) == 0 {
+		return nil, CompletionNoFileComp
+	}
+
+	// Global flags may come before the command's name
+	if _, rest, err := ParseGlobalFlags(args); err == nil {
+		args = rest
+	}
+	if len(args) == 0 {
+		return nil, CompletionNoFileComp
+	}
+	command, args := args[0], args[1:]
+	switch {
+	case slices.Contains(AgentTargetCommands, command):
+		return CompleteAgentTargets(client)(ctx, args, toComplete)
+	case command == "task" && len(args) == 0:
+		return filterCandidates(TaskCommands, nil, toComplete), CompletionNoFileComp
+	case command == "task" && slices.Contains(TaskCommands, args[0]):
+		return CompleteTaskIDs(client)(ctx, args[1:], toComplete)
+	case command == "completion" && len(args) == 0:
+		return filterCandidates(CompletionShells, nil, toComplete), CompletionNoFileComp
+	}
+	return nil, CompletionDefault
+}
+
+// WriteCompletionScript writes the completion script for shell, like supervisorctl completion
+// bash. The script asks supervisorctl __complete for its candidates.
+func WriteCompletionScript(w io.Writer, shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected one of %s", shell, strings.Join(CompletionShells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// completionScripts holds the completion script of each shell
+var completionScripts = map[string]string{
+	"bash": `# bash completion for supervisorctl, load with: source <(supervisorctl completion bash)
+_supervisorctl() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n =: cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+
+    local out directive
+    out=$(supervisorctl __complete "${words[@]:1:cword-1}" "$cur" 2>/dev/null) || return
+    directive=${out##*:}
+    out=${out%:*}
+
+    if (( directive & 2 )); then
+        compopt -o nospace 2>/dev/null
+    fi
+    if (( (directive & 4) == 0 )); then
+        compopt -o default 2>/dev/null
+    fi
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$out" -- "$cur"))
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+complete -F _supervisorctl supervisorctl
+`,
+	"zsh": `#compdef supervisorctl
+# zsh completion for supervisorctl, load with: source <(supervisorctl completion zsh)
+_supervisorctl() {
+    local out directive
+    local -a lines candidates
+    out=$(supervisorctl __complete "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null) || return
+    lines=("${(@f)out}")
+    directive=${lines[-1]#:}
+    candidates=("${(@)lines[1,-2]}")
+
+    if (( directive & 2 )); then
+        compadd -S '' -a candidates
+    else
+        compadd -a candidates
+    fi
+    if (( (directive & 4) == 0 )); then
+        _files
+    fi
+}
+compdef _supervisorctl supervisorctl
+`,
+	"fish": `# fish completion for supervisorctl, load with: supervisorctl completion fish | source
+function __supervisorctl_complete
+    set -l args (commandline -opc)
+    set -e args[1]
+    set -l out (supervisorctl __complete $args (commandline -ct) 2>/dev/null)
+    or return
+    set -e out[-1]
+    printf '%s\n' $out
+end
+complete -c supervisorctl -f -a '(__supervisorctl_complete)'
+`,
+	"powershell": `# powershell completion for supervisorctl, load with: supervisorctl completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName supervisorctl -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -ne '' -and $words.Count -gt 0) {
+        $words = @($words | Select-Object -SkipLast 1)
+    }
+    $out = @(& supervisorctl __complete @words "$wordToComplete" 2>$null)
+    if ($out.Count -eq 0) {
+        return
+    }
+    $out | Select-Object -SkipLast 1 | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
@@ -0,0 +1,154 @@
+package supervisorctl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Output formats of supervisorctl commands, as set by format in the config file
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// Config is the supervisorctl config file
+type Config struct {
+	Server         ServerConfig             `mapstructure:"server"`
+	Format         string                   `mapstructure:"format"`          // Output format of commands: table, json or yaml
+	CurrentProfile string                   `mapstructure:"current_profile"` // Profile used when neither --profile nor SUPERVISORCTL_PROFILE names one
+	Profiles       map[string]ProfileConfig `mapstructure:"profiles"`        // Supervisors by profile name, names being case-insensitive
+	Profile        string                   `mapstructure:"-"`               // Profile the effective config was resolved with, empty for none
+}
+
+// ServerConfig locates the supervisor and sets how requests to it are retried
+type ServerConfig struct {
+	URL     string        `mapstructure:"url"`
+	Token   string        `mapstructure:"token"`
+	Timeout time.Duration `mapstructure:"timeout"` // How long to wait for the supervisor to start responding, 0 waits indefinitely
+	Retries RetryPolicy   `mapstructure:"retries"`
+	TLS     TLSConfig     `mapstructure:"tls"`
+}
+
+// TLSConfig sets how https:// supervisors are verified
+type TLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`              // PEM certificates trusted besides the system's
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Accept any certificate, for test supervisors only
+}
+
+// ProfileConfig is one supervisor of the profiles section. A profile holds the same keys as the top
+// level of the file; those it sets override the top-level values while it is in use.
+type ProfileConfig struct {
+	Server ServerConfig `mapstructure:"server"`
+	Format string       `mapstructure:"format"`
+}
+
+// LoadConfig reads a supervisorctl config file such as
+//
+//	server:
+//	  url: http://localhost:8080
+//	  timeout: 45s
+//	  retries:
+//	    max_elapsed: 1m
+//	    breaker_threshold: 10
+//	format: json
+//	current_profile: prod
+//	profiles:
+//	  prod:
+//	    server:
+//	      url: https://supervisor.prod.example.com
+//	      token: s3cr3t-token
+//	      tls:
+//	        ca_file: /etc/ssl/prod-ca.pem
+//
+// Retry settings left out keep the values of DefaultRetryPolicy. The current profile's settings
+// override the top-level ones.
+func LoadConfig(path string) (*Config, error) {
+	v := newConfigViper()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read supervisorctl config %s: %w", path, err)
+	}
+	profile := v.GetString("current_profile")
+	if err := applyProfile(v, profile); err != nil {
+		return nil, err
+	}
+	config, err := decodeConfig(v, path)
+	if err != nil {
+		return nil, err
+	}
+	config.Profile = profile
+	return config, nil
+}
+
+// applyProfile merges the settings of the named profile over the top-level ones held by v, failing
+// when the file has no such profile. An empty name applies none.
+func applyProfile(v *viper.Viper, name string) error {
+	if name == "" {
+		return nil
+	}
+	settings, ok := profileSettings(v, name)
+	if !ok {
+		return fmt.Errorf("unknown supervisorctl profile %q, expected one of %s", name, strings.Join(profileNames(v), ", "))
+	}
+	return v.MergeConfigMap(settings)
+}
+
+// profileSettings returns the settings of the named profile held by v
+func profileSettings(v *viper.Viper, name string) (map[string]interface{}, bool) {
+	value, ok := v.GetStringMap("profiles")[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	settings, _ := value.(map[string]interface{})
+	return settings, true
+}
+
+// profileNames returns the sorted names of the profiles held by v
+func profileNames(v *viper.Viper) []string {
+	names := make([]string, 0)
+	for name := range v.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newConfigViper returns a viper instance holding the defaults of every config key
+func newConfigViper() *viper.Viper {
+	v := viper.New()
+	for _, key := range configKeys {
+		v.SetDefault(key.name, key.defaultValue)
+	}
+	return v
+}
+
+// decodeConfig decodes the config held by v, read from path
+func decodeConfig(v *viper.Viper, path string) (*Config, error) {
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to decode supervisorctl config %s: %w", path, err)
+	}
+	config.Format = strings.ToLower(config.Format)
+	return &config, nil
+}
+
+// NewClientFromConfig creates a client of the configured supervisor, failing when its TLS settings
+// cannot be loaded
+func NewClientFromConfig(config *Config) (*Client, error) {
+	client := NewClient(config.Server.URL)
+	client.SetToken(config.Server.Token)
+	client.SetRetryPolicy(config.Server.Retries)
+	if config.Server.Timeout > 0 || config.Server.TLS != (TLSConfig{}) {
+		httpClient, err := NewTLSHTTPClient(config.Server.URL, config.Server.Timeout, config.Server.TLS)
+		if err != nil {
+			return nil, err
+		}
+		client.SetHTTPClient(httpClient)
+	}
+	return client, nil
+}
@@ -0,0 +1,678 @@
+package supervisorctl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding config keys: server.url is overridden by
+// SUPERVISORCTL_SERVER_URL
+const EnvPrefix = "SUPERVISORCTL"
+
+// ProfileEnvVar names the profile to use when --profile is not given
+const ProfileEnvVar = EnvPrefix + "_PROFILE"
+
+// maskedSecret replaces secrets in shown configs unless they are revealed
+const maskedSecret = "********"
+
+// ErrConfigExists is returned by Init when the config file exists and may not be overwritten
+var ErrConfigExists = errors.New("supervisorctl config already exists")
+
+// configKey is a key of the config file
+type configKey struct {
+	name         string
+	defaultValue interface{}
+	secret       bool                      // Masked by Show unless secrets are revealed
+	envAlias     string                    // Shorter environment variable also overriding the key
+	parse        func(string) (any, error) // Validates a value set with Set and returns it as written to the file
+	get          func(*Config) string
+}
+
+// configKeys are the keys of the config file, in the order Show prints them
+var configKeys = []configKey{
+	{name: "server.url", defaultValue: "http://localhost:8080", envAlias: EnvPrefix + "_SERVER", parse: parseServerURL,
+		get: func(c *Config) string { return c.Server.URL }},
+	{name: "server.token", defaultValue: "", secret: true, envAlias: EnvPrefix + "_TOKEN", parse: parseString,
+		get: func(c *Config) string { return c.Server.Token }},
+	{name: "server.timeout", defaultValue: time.Duration(0), parse: parseDuration,
+		get: func(c *Config) string { return c.Server.Timeout.String() }},
+	{name: "server.retries.max_elapsed", defaultValue: DefaultRetryPolicy().MaxElapsed, parse: parseDuration,
+		get: func(c *Config) string { return c.Server.Retries.MaxElapsed.String() }},
+	{name: "server.retries.initial_interval", defaultValue: DefaultRetryPolicy().InitialInterval, parse: parseDuration,
+		get: func(c *Config) string { return c.Server.Retries.InitialInterval.String() }},
+	{name: "server.retries.max_interval", defaultValue: DefaultRetryPolicy().MaxInterval, parse: parseDuration,
+		get: func(c *Config) string { return c.Server.Retries.MaxInterval.String() }},
+	{name: "server.retries.breaker_threshold", defaultValue: DefaultRetryPolicy().BreakerThreshold, parse: parseCount,
+		get: func(c *Config) string { return strconv.Itoa(c.Server.Retries.BreakerThreshold) }},
+	{name: "server.retries.breaker_cooldown", defaultValue: DefaultRetryPolicy().BreakerCooldown, parse: parseDuration,
+		get: func(c *Config) string { return c.Server.Retries.BreakerCooldown.String() }},
+	{name: "server.tls.ca_file", defaultValue: "", parse: parseString,
+		get: func(c *Config) string { return c.Server.TLS.CAFile }},
+	{name: "server.tls.insecure_skip_verify", defaultValue: false, parse: parseBool,
+		get: func(c *Config) string { return strconv.FormatBool(c.Server.TLS.InsecureSkipVerify) }},
+	{name: "format", defaultValue: OutputTable, parse: parseFormat,
+		get: func(c *Config) string { return c.Format }},
+}
+
+// lookupConfigKey returns the config key named name
+func lookupConfigKey(name string) (configKey, error) {
+	for _, key := range configKeys {
+		if key.name == name {
+			return key, nil
+		}
+	}
+	names := make([]string, len(configKeys))
+	for i, key := range configKeys {
+		names[i] = key.name
+	}
+	return configKey{}, fmt.Errorf("unknown config key %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// envNames returns the environment variables overriding the key, in the order they win
+func (k configKey) envNames() []string {
+	names := []string{EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(k.name, ".", "_"))}
+	if k.envAlias != "" {
+		names = append(names, k.envAlias)
+	}
+	return names
+}
+
+// IConfigManager reads and writes the supervisorctl config file, as the supervisorctl config
+// subcommands do
+type IConfigManager interface {
+	// Path returns the config file the manager reads and writes
+	Path() string
+
+	// Load returns the effective config: defaults, overridden by the file, the selected profile, the
+	// environment and flags
+	Load() (*Config, error)
+
+	// Save writes every key of config to the file, or to the profile it was loaded with
+	Save(config *Config) error
+
+	// Get returns the effective value of a dot-separated key such as server.timeout
+	Get(key string) (string, error)
+
+	// Set validates value and writes it to the file under a dot-separated key
+	Set(key, value string) error
+
+	// UseProfile makes a profile of the file the one used when no other is selected
+	UseProfile(name string) error
+}
+
+// ConfigManager manages a supervisorctl config file. Set and Save edit the file in place, so
+// comments and keys supervisorctl does not know survive.
+type ConfigManager struct {
+	path      string
+	overrides map[string]string
+	profile   string
+}
+
+// resolution records where Load took the effective config from, as Show annotates it
+type resolution struct {
+	profile       string            // Empty when no profile is used
+	profileSource string            // What selected the profile
+	sources       map[string]string // Source of each key's value
+}
+
+// DefaultConfigPath returns the default config file, ~/.config/supervisorctl/config.yaml on Linux
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "supervisorctl", "config.yaml"), nil
+}
+
+// NewConfigManager creates a ConfigManager of the config file at path
+func NewConfigManager(path string) *ConfigManager {
+	return &ConfigManager{
+		path:      path,
+		overrides: make(map[string]string),
+	}
+}
+
+// SetOverride overrides a key with a command line flag value; overrides win over the environment
+// and the file, and are never written to the file
+func (m *ConfigManager) SetOverride(key, value string) error {
+	if _, err := lookupConfigKey(key); err != nil {
+		return err
+	}
+	m.overrides[key] = value
+	return nil
+}
+
+// SetProfile selects a profile with the --profile flag, winning over SUPERVISORCTL_PROFILE and the
+// file's current_profile
+func (m *ConfigManager) SetProfile(name string) {
+	m.profile = name
+}
+
+// ApplyGlobalFlags applies the global flags that are set, as every command does before it loads
+// the config
+func (m *ConfigManager) ApplyGlobalFlags(flags GlobalFlags) error {
+	if flags.Server != "" {
+		if err := m.SetOverride("server.url", flags.Server); err != nil {
+			return err
+		}
+	}
+	if flags.Token != "" {
+		if err := m.SetOverride("server.token", flags.Token); err != nil {
+			return err
+		}
+	}
+	if flags.Profile != "" {
+		m.SetProfile(flags.Profile)
+	}
+	return nil
+}
+
+// Path returns the config file the manager reads and writes
+func (m *ConfigManager) Path() string {
+	return m.path
+}
+
+// Load returns the effective config: defaults, overridden by the file when it exists, then by the
+// selected profile, then by SUPERVISORCTL_* environment variables, then by flags. The profile is
+// selected by --profile, else SUPERVISORCTL_PROFILE, else the file's current_profile.
+func (m *ConfigManager) Load() (*Config, error) {
+	config, _, err := m.resolve()
+	return config, err
+}
+
+// resolve loads the effective config and records where its values came from
+func (m *ConfigManager) resolve() (*Config, *resolution, error) {
+	v := newConfigViper()
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for _, key := range configKeys {
+		if key.envAlias != "" {
+			if err := v.BindEnv(key.name, key.envAlias); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err := m.readFile(v); err != nil {
+		return nil, nil, err
+	}
+
+	res := &resolution{sources: make(map[string]string)}
+	switch {
+	case m.profile != "":
+		res.profile, res.profileSource = m.profile, "flag --profile"
+	case os.Getenv(ProfileEnvVar) != "":
+		res.profile, res.profileSource = os.Getenv(ProfileEnvVar), "env "+ProfileEnvVar
+	case v.InConfig("current_profile"):
+		res.profile, res.profileSource = v.GetString("current_profile"), "file current_profile"
+	}
+	res.profile = strings.ToLower(res.profile)
+	settings, ok := profileSettings(v, res.profile)
+	if res.profile != "" && !ok {
+		return nil, nil, fmt.Errorf("unknown supervisorctl profile %q selected by %s, expected one of %s",
+			res.profile, res.profileSource, strings.Join(profileNames(v), ", "))
+	}
+	for _, key := range configKeys {
+		res.sources[key.name] = m.keySource(v, key, res.profile, settings)
+	}
+
+	if err := applyProfile(v, res.profile); err != nil {
+		return nil, nil, err
+	}
+	for key, value := range m.overrides {
+		v.Set(key, value)
+	}
+	config, err := decodeConfig(v, m.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.Profile = res.profile
+	return config, res, nil
+}
+
+// readFile reads the config file into v, leaving it empty when the file does not exist
+func (m *ConfigManager) readFile(v *viper.Viper) error {
+	if _, err := os.Stat(m.path); err == nil {
+		v.SetConfigFile(m.path)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read supervisorctl config %s: %w", m.path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read supervisorctl config %s: %w", m.path, err)
+	}
+	return nil
+}
+
+// keySource returns where the effective value of key comes from, in the order of precedence:
+// flag, env <variable>, profile <name>, file or default
+func (m *ConfigManager) keySource(v *viper.Viper, key configKey, profile string, settings map[string]interface{}) string {
+	if _, ok := m.overrides[key.name]; ok {
+		return "flag"
+	}
+	for _, name := range key.envNames() {
+		// Like viper, empty variables are treated as unset
+		if os.Getenv(name) != "" {
+			return "env " + name
+		}
+	}
+	if profile != "" && hasSetting(settings, key.name) {
+		return "profile " + profile
+	}
+	if v.InConfig(key.name) {
+		return "file"
+	}
+	return "default"
+}
+
+// hasSetting reports whether the nested settings of a profile set a dot-separated key
+func hasSetting(settings map[string]interface{}, key string) bool {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		value, ok := settings[part]
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		if settings, ok = value.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// Profiles returns the sorted names of the file's profiles
+func (m *ConfigManager) Profiles() ([]string, error) {
+	v := viper.New()
+	if err := m.readFile(v); err != nil {
+		return nil, err
+	}
+	return profileNames(v), nil
+}
+
+// UseProfile makes a profile of the file the one used when neither --profile nor
+// SUPERVISORCTL_PROFILE selects one, as supervisorctl config use-profile prod does. An empty name
+// goes back to the top-level settings.
+func (m *ConfigManager) UseProfile(name string) error {
+	name = strings.ToLower(name)
+	if name != "" {
+		v := viper.New()
+		if err := m.readFile(v); err != nil {
+			return err
+		}
+		if _, ok := profileSettings(v, name); !ok {
+			return fmt.Errorf("unknown supervisorctl profile %q, expected one of %s", name, strings.Join(profileNames(v), ", "))
+		}
+	}
+
+	doc, err := m.readDocument()
+	if err != nil {
+		return err
+	}
+	if err := setNode(doc, "current_profile", name); err != nil {
+		return err
+	}
+	return m.writeDocument(doc)
+}
+
+// Get returns the effective value of a dot-separated key such as server.timeout
+func (m *ConfigManager) Get(key string) (string, error) {
+	configKey, err := lookupConfigKey(key)
+	if err != nil {
+		return "", err
+	}
+	config, err := m.Load()
+	if err != nil {
+		return "", err
+	}
+	return configKey.get(config), nil
+}
+
+// Set validates value and writes it to the file under a dot-separated key, as supervisorctl config
+// set server.timeout 45s does. Keys of a profile are prefixed with profiles.<name>., as in
+// profiles.prod.server.url. The file is created when missing.
+func (m *ConfigManager) Set(key, value string) error {
+	name := key
+	if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+		profile, profileKey, _ := strings.Cut(rest, ".")
+		if profile == "" {
+			return fmt.Errorf("config key %q does not name a profile, as in profiles.prod.server.url", key)
+		}
+		name = profileKey
+		key = "profiles." + strings.ToLower(profile) + "." + profileKey
+	}
+	configKey, err := lookupConfigKey(name)
+	if err != nil {
+		return err
+	}
+	parsed, err := configKey.parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	doc, err := m.readDocument()
+	if err != nil {
+		return err
+	}
+	if err := setNode(doc, key, parsed); err != nil {
+		return err
+	}
+	return m.writeDocument(doc)
+}
+
+// Save writes every key of config to the file, keeping comments and unknown keys. A config loaded
+// with a profile is written to that profile.
+func (m *ConfigManager) Save(config *Config) error {
+	doc, err := m.readDocument()
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if config.Profile != "" {
+		prefix = "profiles." + config.Profile + "."
+	}
+	for _, key := range configKeys {
+		parsed, err := key.parse(key.get(config))
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key.name, err)
+		}
+		if err := setNode(doc, prefix+key.name, parsed); err != nil {
+			return err
+		}
+	}
+	return m.writeDocument(doc)
+}
+
+// Show writes the effective config as YAML, as supervisorctl config show does. A comment names the
+// profile in use and each value is annotated with its source: flag, env <variable>,
+// profile <name>, file or default. Secrets are masked unless revealSecrets is set, as with
+// --reveal-secrets.
+func (m *ConfigManager) Show(w io.Writer, revealSecrets bool) error {
+	config, res, err := m.resolve()
+	if err != nil {
+		return err
+	}
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	for _, key := range configKeys {
+		var value any = key.get(config)
+		if key.secret && value != "" && !revealSecrets {
+			value = maskedSecret
+		} else if parsed, err := key.parse(key.get(config)); err == nil {
+			value = parsed
+		}
+		if err := setNode(doc, key.name, value); err != nil {
+			return err
+		}
+		lookupNode(doc, key.name).LineComment = "from " + res.sources[key.name]
+	}
+	if res.profile != "" {
+		doc.Content[0].HeadComment = fmt.Sprintf("profile %s, selected by %s", res.profile, res.profileSource)
+	} else {
+		doc.Content[0].HeadComment = "no profile"
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode supervisorctl config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// Init asks for the server URL, token and output format on in, prompting on out, and writes them
+// to a new config file, as supervisorctl config init does. Empty answers keep the defaults. An
+// existing file is only replaced with force.
+func (m *ConfigManager) Init(in io.Reader, out io.Writer, force bool) (*Config, error) {
+	if _, err := os.Stat(m.path); err == nil && !force {
+		return nil, fmt.Errorf("%w: %s", ErrConfigExists, m.path)
+	}
+
+	config := &Config{Format: OutputTable, Server: ServerConfig{URL: "http://localhost:8080", Retries: DefaultRetryPolicy()}}
+	reader := bufio.NewReader(in)
+	prompts := []struct {
+		key    string
+		prompt string
+		value  *string
+	}{
+		{"server.url", "Supervisor URL", &config.Server.URL},
+		{"server.token", "API token (empty for none)", &config.Server.Token},
+		{"format", "Output format (table, json, yaml)", &config.Format},
+	}
+	for _, p := range prompts {
+		answer, err := promptValue(reader, out, p.key, p.prompt, *p.value)
+		if err != nil {
+			return nil, err
+		}
+		*p.value = answer
+	}
+
+	// Write the answers to a fresh file; the other keys keep their defaults
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	for _, p := range prompts {
+		if err := setNode(doc, p.key, *p.value); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.writeDocument(doc); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Wrote %s\n", m.path)
+	return config, nil
+}
+
+// promptValue asks for a key's value until a valid one is given; an empty answer keeps current
+func promptValue(reader *bufio.Reader, out io.Writer, key, prompt, current string) (string, error) {
+	configKey, err := lookupConfigKey(key)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if current != "" && !configKey.secret {
+			fmt.Fprintf(out, "%s [%s]: ", prompt, current)
+		} else {
+			fmt.Fprintf(out, "%s: ", prompt)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", fmt.Errorf("no answer for %s: %w", key, io.ErrUnexpectedEOF)
+			}
+			return "", fmt.Errorf("failed to read answer for %s: %w", key, err)
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			return current, nil
+		}
+		if _, err := configKey.parse(answer); err != nil {
+			fmt.Fprintf(out, "Invalid %s: %v\n", key, err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// readDocument parses the config file, returning an empty document when it does not exist
+func (m *ConfigManager) readDocument() (*yaml.Node, error) {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &yaml.Node{Kind: yaml.DocumentNode}, nil
+		}
+		return nil, fmt.Errorf("failed to read supervisorctl config %s: %w", m.path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse supervisorctl config %s: %w", m.path, err)
+	}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	return &doc, nil
+}
+
+// writeDocument replaces the config file with doc, readable by its owner only since it may hold a token
+func (m *ConfigManager) writeDocument(doc *yaml.Node) error {
+	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(m.path), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to write supervisorctl config %s: %w", m.path, err)
+	}
+	defer os.Remove(file.Name())
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	err = encoder.Encode(doc)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), m.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write supervisorctl config %s: %w", m.path, err)
+	}
+	return nil
+}
+
+// setNode sets the value under a dot-separated key in a YAML document, creating missing mappings
+func setNode(doc *yaml.Node, key string, value any) error {
+	if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	node := doc.Content[0]
+
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("cannot set %s: %s is not a mapping", key, strings.Join(parts[:i], "."))
+		}
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == part {
+				child = node.Content[j+1]
+				break
+			}
+		}
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, child)
+		}
+
+		if i == len(parts)-1 {
+			var encoded yaml.Node
+			if err := encoded.Encode(value); err != nil {
+				return fmt.Errorf("failed to encode %s: %w", key, err)
+			}
+			// Keep comments attached to the value being replaced
+			encoded.HeadComment, encoded.LineComment, encoded.FootComment = child.HeadComment, child.LineComment, child.FootComment
+			*child = encoded
+		}
+		node = child
+	}
+	return nil
+}
+
+// lookupNode returns the value under a dot-separated key of a YAML document, nil when missing
+func lookupNode(doc *yaml.Node, key string) *yaml.Node {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	node := doc.Content[0]
+	for _, part := range strings.Split(key, ".") {
+		var child *yaml.Node
+		for j := 0; node.Kind == yaml.MappingNode && j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == part {
+				child = node.Content[j+1]
+				break
+			}
+		}
+		if child == nil {
+			return nil
+		}
+		node = child
+	}
+	return node
+}
+
+// parseString accepts any value
+func parseString(value string) (any, error) {
+	return value, nil
+}
+
+// parseServerURL accepts absolute http and https URLs, and unix:// URLs with an absolute socket path
+func parseServerURL(value string) (any, error) {
+	if path, ok := unixSocketPath(value); ok {
+		if !filepath.IsAbs(path) && !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("%q does not name an absolute socket path, as in unix:///var/run/supervisor.sock", value)
+		}
+		return value, nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%q is not an http, https or unix URL", value)
+	}
+	return value, nil
+}
+
+// parseDuration accepts non-negative durations such as 45s, kept as written
+func parseDuration(value string) (any, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a duration such as 45s", value)
+	}
+	if duration < 0 {
+		return nil, fmt.Errorf("duration cannot be negative")
+	}
+	return duration.String(), nil
+}
+
+// parseCount accepts non-negative integers
+func parseCount(value string) (any, error) {
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("%q is not a non-negative integer", value)
+	}
+	return count, nil
+}
+
+// parseBool accepts true and false
+func parseBool(value string) (any, error) {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not true or false", value)
+	}
+	return parsed, nil
+}
+
+// parseFormat accepts the output formats
+func parseFormat(value string) (any, error) {
+	switch format := strings.ToLower(value); format {
+	case OutputTable, OutputJSON, OutputYAML:
+		return format, nil
+	}
+	return nil, fmt.Errorf("%q is not one of table, json, yaml", value)
+}
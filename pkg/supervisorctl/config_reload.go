@@ -0,0 +1,175 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrConfigUpdateFailed is wrapped by ConfigUpdateResult.Err when an agent or task failed to apply
+var ErrConfigUpdateFailed = errors.New("configuration update failed")
+
+// How an agent or task of the config file differs from the configuration the supervisor applied
+const (
+	ConfigAdded   = "added"
+	ConfigChanged = "changed"
+	ConfigRemoved = "removed"
+)
+
+// Outcomes of applying one change of a config update
+const (
+	ConfigUpdateApplied   = "applied"
+	ConfigUpdateRestarted = "restarted"
+	ConfigUpdateSkipped   = "skipped"
+	ConfigUpdateFailed    = "failed"
+)
+
+// ConfigChange is an agent or task of the config file that differs from the applied configuration
+type ConfigChange struct {
+	Scope  string   `json:"scope"` // agent or task
+	ID     string   `json:"id"`
+	Change string   `json:"change"`           // added, changed or removed
+	Fields []string `json:"fields,omitempty"` // Changed config keys, for changed items only
+}
+
+// ConfigDiff lists what updating would change, as supervisorctl reread reports it
+type ConfigDiff struct {
+	ConfigFile string         `json:"config_file"`
+	Changes    []ConfigChange `json:"changes"`
+	ReadAt     time.Time      `json:"read_at"`
+}
+
+// ConfigUpdateItem is the outcome of applying one change
+type ConfigUpdateItem struct {
+	ConfigChange
+	Status  string `json:"status"` // applied, restarted, skipped or failed
+	Message string `json:"message,omitempty"`
+}
+
+// ConfigUpdateResult reports the outcome of a config update per agent and task
+type ConfigUpdateResult struct {
+	ConfigFile string             `json:"config_file"`
+	Results    []ConfigUpdateItem `json:"results"`
+	AppliedAt  time.Time          `json:"applied_at"`
+}
+
+// ConfigUpdateOptions are the options of a config update
+type ConfigUpdateOptions struct {
+	RestartChanged bool // Cancel the running executions of changed agents, like --restart-changed; otherwise they are skipped
+}
+
+// ConfigConfirmFunc decides whether a config update goes ahead, given the diff it would apply
+type ConfigConfirmFunc func(diff *ConfigDiff) (bool, error)
+
+// RereadConfig reports how the supervisor's config file differs from the configuration it applied,
+// without applying anything, like supervisorctl reread
+func (c *Client) RereadConfig(ctx context.Context) (*ConfigDiff, error) {
+	var diff ConfigDiff
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/config/reread", nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// UpdateConfig applies the supervisor's config file as it is now, adding, changing and removing
+// agents and tasks, and reports the outcome of each change
+func (c *Client) UpdateConfig(ctx context.Context, options ConfigUpdateOptions) (*ConfigUpdateResult, error) {
+	request := map[string]interface{}{"restart_changed": options.RestartChanged}
+	var result ConfigUpdateResult
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/config/update", request, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ConfirmedUpdateConfig rereads the config file and, when it changed, asks confirm before updating,
+// like supervisorctl update. The result is nil when there was nothing to update; ErrNotConfirmed
+// is returned when confirm declines.
+func (c *Client) ConfirmedUpdateConfig(ctx context.Context, options ConfigUpdateOptions, confirm ConfigConfirmFunc) (*ConfigDiff, *ConfigUpdateResult, error) {
+	diff, err := c.RereadConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(diff.Changes) == 0 {
+		return diff, nil, nil
+	}
+
+	confirmed, err := confirm(diff)
+	if err != nil {
+		return diff, nil, err
+	}
+	if !confirmed {
+		return diff, nil, fmt.Errorf("update of %s: %w", diff.ConfigFile, ErrNotConfirmed)
+	}
+	result, err := c.UpdateConfig(ctx, options)
+	return diff, result, err
+}
+
+// PromptConfigConfirm returns a ConfigConfirmFunc that prints the diff on out and asks for a yes on
+// in, or that agrees without asking when assumeYes is set, as supervisorctl update --yes does
+func PromptConfigConfirm(in io.Reader, out io.Writer, assumeYes bool) ConfigConfirmFunc {
+	return func(diff *ConfigDiff) (bool, error) {
+		if assumeYes {
+			return true, nil
+		}
+		diff.Print(out)
+		fmt.Fprint(out, "Apply these changes? [y/N]: ")
+		return readConfirmation(in)
+	}
+}
+
+// Print writes the changes as the table supervisorctl reread shows
+func (d *ConfigDiff) Print(w io.Writer) {
+	if len(d.Changes) == 0 {
+		fmt.Fprintf(w, "%s: no changes\n", d.ConfigFile)
+		return
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SCOPE\tID\tCHANGE\tFIELDS")
+	for _, change := range d.Changes {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", change.Scope, change.ID, change.Change, changedFields(change.Fields))
+	}
+	table.Flush()
+}
+
+// Print writes the outcome per change as supervisorctl update shows them
+func (r *ConfigUpdateResult) Print(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SCOPE\tID\tCHANGE\tSTATUS\tMESSAGE")
+	for _, item := range r.Results {
+		message := item.Message
+		if message == "" {
+			message = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", item.Scope, item.ID, item.Change, item.Status, message)
+	}
+	table.Flush()
+}
+
+// Err returns an error wrapping ErrConfigUpdateFailed when a change failed to apply, for
+// supervisorctl update to exit with ExitFailure
+func (r *ConfigUpdateResult) Err() error {
+	failed := 0
+	for _, item := range r.Results {
+		if item.Status == ConfigUpdateFailed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d changes", ErrConfigUpdateFailed, failed, len(r.Results))
+}
+
+// changedFields joins the changed keys of a change for a table cell, - for none
+func changedFields(fields []string) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,77 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrConfigInvalid is wrapped by ConfigValidation.Err when the supervisor found errors in its
+// configuration
+var ErrConfigInvalid = errors.New("configuration is invalid")
+
+// ConfigIssue is a problem the supervisor found in its running configuration
+type ConfigIssue struct {
+	Scope   string `json:"scope"`           // supervisor, a2a, agent or task
+	ID      string `json:"id,omitempty"`    // ID of the agent or task
+	Field   string `json:"field,omitempty"` // Offending field, when known
+	Message string `json:"message"`
+}
+
+// String formats the issue as scope id.field: message
+func (i ConfigIssue) String() string {
+	location := i.Scope
+	if i.ID != "" {
+		location += " " + i.ID
+	}
+	if i.Field != "" {
+		if i.ID != "" {
+			location += "." + i.Field
+		} else {
+			location += " " + i.Field
+		}
+	}
+	return location + ": " + i.Message
+}
+
+// ConfigValidation is the result of validating the supervisor's configuration: the supervisor and
+// A2A settings, the registered agents and the scheduled tasks. Warnings do not make it invalid.
+type ConfigValidation struct {
+	Valid       bool          `json:"valid"`
+	Errors      []ConfigIssue `json:"errors"`
+	Warnings    []ConfigIssue `json:"warnings"`
+	ValidatedAt time.Time     `json:"validated_at"`
+}
+
+// ValidateConfig validates the configuration the supervisor is running with, like supervisorctl
+// validate, e.g. reporting tasks that run agents which no longer exist
+func (c *Client) ValidateConfig(ctx context.Context) (*ConfigValidation, error) {
+	var validation ConfigValidation
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/config/validate", nil, &validation); err != nil {
+		return nil, err
+	}
+	return &validation, nil
+}
+
+// Print writes one issue per line and the totals as supervisorctl validate shows them
+func (v *ConfigValidation) Print(w io.Writer) {
+	for _, issue := range v.Errors {
+		fmt.Fprintf(w, "error: %s\n", issue)
+	}
+	for _, issue := range v.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", issue)
+	}
+	fmt.Fprintf(w, "%d errors, %d warnings\n", len(v.Errors), len(v.Warnings))
+}
+
+// Err returns an error wrapping ErrConfigInvalid when the configuration is invalid, for
+// supervisorctl validate to exit with ExitFailure
+func (v *ConfigValidation) Err() error {
+	if v.Valid {
+		return nil
+	}
+	return fmt.Errorf("%w: %d errors", ErrConfigInvalid, len(v.Errors))
+}
@@ -0,0 +1,193 @@
+package supervisorctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// SchemaParameter is a property of an agent's input schema, a row of the parameter table of
+// supervisorctl agent describe
+type SchemaParameter struct {
+	Name        string // Nested object properties are named parent.child
+	Type        string // e.g. integer, string or array of string; empty when the schema sets none
+	Required    bool
+	Default     string // JSON of the default, empty when there is none
+	Constraints string // e.g. 1..500, one of "brief", "full" or matches ^[a-z]+$
+	Description string
+}
+
+// SchemaParameters lists the properties an input schema declares, in name order, each followed by
+// its nested properties
+func SchemaParameters(schema map[string]interface{}) []SchemaParameter {
+	var parameters []SchemaParameter
+	collectParameters(&parameters, "", schema)
+	return parameters
+}
+
+// collectParameters appends the properties of an object schema, prefixing their names
+func collectParameters(parameters *[]SchemaParameter, prefix string, schema map[string]interface{}) {
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		parameter := SchemaParameter{
+			Name:        prefix + name,
+			Type:        schemaTypeName(property),
+			Required:    required[name],
+			Constraints: schemaConstraints(property),
+		}
+		parameter.Description, _ = property["description"].(string)
+		if value, ok := property["default"]; ok {
+			parameter.Default = jsonText(value)
+		}
+		*parameters = append(*parameters, parameter)
+		collectParameters(parameters, parameter.Name+".", property)
+	}
+}
+
+// schemaTypeName renders the type keyword of a schema, with the item type of arrays
+func schemaTypeName(schema map[string]interface{}) string {
+	var names []string
+	switch v := schema["type"].(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		for _, name := range v {
+			names = append(names, fmt.Sprint(name))
+		}
+	}
+	typeName := strings.Join(names, " or ")
+	if items, ok := schema["items"].(map[string]interface{}); ok && typeName == "array" {
+		if itemType := schemaTypeName(items); itemType != "" {
+			typeName += " of " + itemType
+		}
+	}
+	return typeName
+}
+
+// schemaConstraints renders the enum, const, bounds and pattern of a schema
+func schemaConstraints(schema map[string]interface{}) string {
+	var constraints []string
+	if values, ok := schema["enum"].([]interface{}); ok {
+		rendered := make([]string, len(values))
+		for i, value := range values {
+			rendered[i] = jsonText(value)
+		}
+		constraints = append(constraints, "one of "+strings.Join(rendered, ", "))
+	}
+	if value, ok := schema["const"]; ok {
+		constraints = append(constraints, "always "+jsonText(value))
+	}
+	for _, bounds := range []struct{ low, high, label string }{
+		{"minimum", "maximum", ""},
+		{"minLength", "maxLength", "length "},
+		{"minItems", "maxItems", "items "},
+	} {
+		if bound := formatBounds(schema[bounds.low], schema[bounds.high]); bound != "" {
+			constraints = append(constraints, bounds.label+bound)
+		}
+	}
+	if value, ok := schema["exclusiveMinimum"]; ok {
+		constraints = append(constraints, "> "+jsonText(value))
+	}
+	if value, ok := schema["exclusiveMaximum"]; ok {
+		constraints = append(constraints, "< "+jsonText(value))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		constraints = append(constraints, "matches "+pattern)
+	}
+	return strings.Join(constraints, "; ")
+}
+
+// formatBounds renders an inclusive range such as 1..500, >= 1 or <= 500
+func formatBounds(low, high interface{}) string {
+	switch {
+	case low != nil && high != nil:
+		return jsonText(low) + ".." + jsonText(high)
+	case low != nil:
+		return ">= " + jsonText(low)
+	case high != nil:
+		return "<= " + jsonText(high)
+	}
+	return ""
+}
+
+// jsonText renders a value as JSON
+func jsonText(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// Describe writes how to call the agent, as supervisorctl agent describe <id> prints it: its
+// description, the parameters its input schema declares as a table and its examples as execute
+// request bodies
+func (spec AgentSpec) Describe(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "ID:\t%s\n", spec.ID)
+	fmt.Fprintf(table, "Name:\t%s\n", spec.Name)
+	fmt.Fprintf(table, "Description:\t%s\n", orDash(spec.Description))
+	validation := "off"
+	if spec.ValidateInput {
+		validation = "on"
+	}
+	fmt.Fprintf(table, "Input validation:\t%s\n", validation)
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	parameters := SchemaParameters(spec.InputSchema)
+	if len(parameters) == 0 {
+		fmt.Fprintln(w, "No parameters declared.")
+	} else {
+		table = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "PARAMETER\tTYPE\tREQUIRED\tDEFAULT\tCONSTRAINTS\tDESCRIPTION")
+		for _, parameter := range parameters {
+			required := "no"
+			if parameter.Required {
+				required = "yes"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", parameter.Name, orDash(parameter.Type), required,
+				orDash(parameter.Default), orDash(parameter.Constraints), orDash(parameter.Description))
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(spec.Examples) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Examples:")
+		for _, example := range spec.Examples {
+			if example.Description != "" {
+				fmt.Fprintf(w, "  # %s\n", example.Description)
+			}
+			body := struct {
+				Input      string                 `json:"input,omitempty"`
+				Parameters map[string]interface{} `json:"parameters,omitempty"`
+			}{example.Input, example.Parameters}
+			fmt.Fprintf(w, "  %s\n", jsonText(body))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// Package supervisorctl is a Go client for the supervisor's REST API, and the library behind the
+// supervisorctl command in cmd/supervisorctl.
+//
+// A Client calls the supervisor's endpoints; NewClientFromConfig builds one from the Config a
+// ConfigManager resolves from the config file, the SUPERVISORCTL_* environment variables and the
+// global flags. StreamExecute runs an agent and delivers its state changes, output and final result
+// as they happen:
+//
+//	client := supervisorctl.NewClient("http://localhost:8080")
+//	client.SetToken(os.Getenv("SUPERVISOR_TOKEN"))
+//
+//	events, err := client.StreamExecute(ctx, "code-reviewer", supervisorctl.StreamExecuteRequest{
+//		Input:              "review main.go",
+//		CancelOnDisconnect: true,
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	for event := range events {
+//		switch {
+//		case event.Output != nil:
+//			fmt.Print(event.Output.Data)
+//		case event.Result != nil:
+//			log.Printf("finished with status %s, exit code %d", event.Result.Status, event.Result.ExitCode)
+//		case event.Err != nil:
+//			log.Fatal(event.Err)
+//		}
+//	}
+//
+// Shell is the interactive shell supervisorctl starts without a command. The command covers the
+// operations an operator runs by hand; supervisorctl help lists them and supervisorctl help
+// <command> describes each. The rest of the API, such as agent templates, replays and execution
+// snapshots, is only available through the Client.
+//
+// ExitCode maps the errors of the Client to the exit codes of supervisorctl.
+package supervisorctl
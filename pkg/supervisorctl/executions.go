@@ -0,0 +1,455 @@
+package supervisorctl
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Execution is a run of an agent
+type Execution struct {
+	ID            string     `json:"id"`
+	AgentID       string     `json:"agent_id"`
+	State         string     `json:"state"`
+	PreviousState string     `json:"previous_state,omitempty"`
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       *time.Time `json:"end_time"` // Nil while the execution runs
+	ExitCode      int        `json:"exit_code"`
+	Status        string     `json:"status,omitempty"`      // Outcome once finished: success, warning, failure, timeout or cancelled
+	ForcedKill    bool       `json:"forced_kill,omitempty"` // The agent ignored its stop signal and was killed
+	Deadline      *time.Time `json:"deadline,omitempty"`    // When the running execution times out
+	ErrorMessage  string     `json:"error_message"`
+	TriggerType   string     `json:"trigger_type,omitempty"`
+	TriggeredBy   string     `json:"triggered_by,omitempty"`
+	ReplayOf      string     `json:"replay_of,omitempty"` // Execution this one replays
+	Anomalies     []string   `json:"anomalies,omitempty"` // How the finished execution deviated from its agent's and task's recent ones, e.g. duration_high
+	Progress      *Progress  `json:"progress,omitempty"`  // The latest progress the agent reported, nil until it reports any
+
+	// Set while the execution waits behind another execution of its agent, in state queued
+	QueuePosition   int   `json:"queue_position,omitempty"` // 1 runs next
+	EstimatedWaitMs int64 `json:"estimated_wait_ms,omitempty"`
+}
+
+// Progress is how far an execution's agent says it has come, from the @@progress markers it
+// writes to stderr
+type Progress struct {
+	Percent   float64   `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetExecution returns an execution, with the latest progress its agent reported
+func (c *Client) GetExecution(ctx context.Context, executionID string) (*Execution, error) {
+	var response struct {
+		Execution Execution `json:"execution"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/executions/"+url.PathEscape(executionID), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Execution, nil
+}
+
+// GetExecutionResult returns the result of an execution, with its output and error, or nil while
+// the execution has not finished
+func (c *Client) GetExecutionResult(ctx context.Context, executionID string) (*ExecutionResult, error) {
+	var response struct {
+		Result *ExecutionResult `json:"result"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/executions/"+url.PathEscape(executionID), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
+
+// ListExecutions returns the executions of an agent, or of every agent when agentID is empty, like
+// supervisorctl execution list; ExecutionColumns prints them
+func (c *Client) ListExecutions(ctx context.Context, agentID string) ([]Execution, error) {
+	return c.FilterExecutions(ctx, ExecutionFilter{AgentID: agentID})
+}
+
+// ExecutionFilter selects executions in FilterExecutions; zero-valued fields match everything
+type ExecutionFilter struct {
+	AgentID   string
+	TaskID    string
+	Anomalous *bool // Only executions flagged with anomalies when true, like --anomalous, or only unflagged ones when false
+}
+
+// FilterExecutions returns the executions matching the filter, oldest first, like supervisorctl
+// execution list --agent <id> --anomalous
+func (c *Client) FilterExecutions(ctx context.Context, filter ExecutionFilter) ([]Execution, error) {
+	values := url.Values{}
+	if filter.AgentID != "" {
+		values.Set("agent_id", filter.AgentID)
+	}
+	if filter.TaskID != "" {
+		values.Set("task_id", filter.TaskID)
+	}
+	if filter.Anomalous != nil {
+		values.Set("anomalous", strconv.FormatBool(*filter.Anomalous))
+	}
+	path := "/api/v1/executions"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	var response struct {
+		Executions []Execution `json:"executions"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Executions, nil
+}
+
+// Formats of ExportExecutions
+const (
+	ExportJSONL = "jsonl"
+	ExportCSV   = "csv"
+)
+
+// ExecutionExportOptions selects the executions ExportExecutions streams; zero-valued fields match
+// everything
+type ExecutionExportOptions struct {
+	Format  string    // ExportJSONL or ExportCSV, jsonl when empty
+	AgentID string    // Like --agent
+	Labels  []string  // key=value selectors every exported execution matches, like --label
+	Since   time.Time // Only executions started at or after, like --since 24h
+	Until   time.Time // Only executions started before, like --until
+}
+
+// ParseExportTime parses the value of --since or --until: an RFC 3339 time, or a duration such as
+// 24h meaning that long before now
+func ParseExportTime(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return now.Add(-duration), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration such as 24h nor an RFC 3339 time", value)
+	}
+	return parsed, nil
+}
+
+// ExportExecutions streams the matching executions to w as JSON lines or CSV, like supervisorctl
+// executions export, and returns the number of bytes written. The supervisor writes the export as
+// it reads the executions, so exports of any size stream through without being held in memory.
+func (c *Client) ExportExecutions(ctx context.Context, options ExecutionExportOptions, w io.Writer) (int64, error) {
+	values := url.Values{}
+	if options.Format != "" {
+		values.Set("format", options.Format)
+	}
+	if options.AgentID != "" {
+		values.Set("agent_id", options.AgentID)
+	}
+	for _, label := range options.Labels {
+		values.Add("label", label)
+	}
+	if !options.Since.IsZero() {
+		values.Set("since", options.Since.UTC().Format(time.RFC3339))
+	}
+	if !options.Until.IsZero() {
+		values.Set("until", options.Until.UTC().Format(time.RFC3339))
+	}
+	path := "/api/v1/executions/export"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	// The transport asks for a gzipped export and transparently decompresses it
+	response, err := c.send(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	written, err := io.Copy(w, response.Body)
+	if err != nil {
+		return written, fmt.Errorf("failed to read execution export: %w", err)
+	}
+	return written, nil
+}
+
+// ExportExecutionsToFile writes the export to path, like supervisorctl executions export -o
+// runs.csv. Without a format, a .csv path gets CSV and any other JSON lines. The file only replaces
+// an existing one once the export is complete.
+func (c *Client) ExportExecutionsToFile(ctx context.Context, path string, options ExecutionExportOptions) (int64, error) {
+	if options.Format == "" {
+		options.Format = ExportJSONL
+		if strings.EqualFold(filepath.Ext(path), "."+ExportCSV) {
+			options.Format = ExportCSV
+		}
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(file.Name())
+	written, err := c.ExportExecutions(ctx, options, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write %s: %w", path, closeErr)
+	}
+	if err == nil {
+		if err = os.Rename(file.Name(), path); err != nil {
+			err = fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return written, err
+}
+
+// StopExecution cancels a running execution, like supervisorctl stop. The agent is sent signal, as
+// with --signal HUP, or its configured stop signal when signal is empty, and is killed when it has
+// not exited after its stop wait. The returned execution is cancelled; GetExecution reports
+// whether a kill was needed once the agent has exited.
+func (c *Client) StopExecution(ctx context.Context, executionID, signal string) (*Execution, error) {
+	path := "/api/v1/executions/" + url.PathEscape(executionID) + "/stop"
+	if signal != "" {
+		path += "?signal=" + url.QueryEscape(signal)
+	}
+
+	var response struct {
+		Execution Execution `json:"execution"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Execution, nil
+}
+
+// DeadlineExtension reports how far ExtendExecution moved an execution's deadline
+type DeadlineExtension struct {
+	ExecutionID      string    `json:"execution_id"`
+	RequestedSeconds int       `json:"requested_seconds"`
+	GrantedSeconds   int       `json:"granted_seconds"` // Less than requested when max_total_timeout caps it
+	Deadline         time.Time `json:"deadline"`
+	MaxDeadline      time.Time `json:"max_deadline"`
+}
+
+// ExtendExecution gives a running execution more time before it times out, like supervisorctl extend.
+// Only agents with a max_total_timeout can be extended, and only up to it.
+func (c *Client) ExtendExecution(ctx context.Context, executionID string, by time.Duration, reason string) (*DeadlineExtension, error) {
+	request := struct {
+		Seconds int    `json:"seconds"`
+		Reason  string `json:"reason,omitempty"`
+	}{Seconds: int(by / time.Second), Reason: reason}
+
+	var extension DeadlineExtension
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/executions/"+url.PathEscape(executionID)+"/extend", request, &extension); err != nil {
+		return nil, err
+	}
+	return &extension, nil
+}
+
+// ExecuteRequest is the request body of a synchronous execution
+type ExecuteRequest struct {
+	Input          string                 `json:"input"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	WorkingDir     string                 `json:"working_dir,omitempty"`
+	Env            map[string]string      `json:"env,omitempty"`
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"`
+	Labels         map[string]string      `json:"labels,omitempty"`
+	NoCache        bool                   `json:"no_cache,omitempty"`
+	OutputEncoding string                 `json:"output_encoding,omitempty"` // text, json or base64; defaults to the agent's
+	QueueBehavior  string                 `json:"queue_behavior,omitempty"`  // Set by ExecuteOrQueue
+
+	// Binary input handed to the agent as a file; at most one of the two
+	InputBase64      string `json:"input_base64,omitempty"`
+	InputURL         string `json:"input_url,omitempty"`
+	InputContentType string `json:"input_content_type,omitempty"`
+}
+
+// QueueBehaviorReturnPosition asks the supervisor to return at once when the agent is busy
+const QueueBehaviorReturnPosition = "return_position"
+
+// QueuedExecution is an execution waiting behind another execution of its agent
+type QueuedExecution struct {
+	ExecutionID     string `json:"execution_id"`
+	AgentID         string `json:"agent_id"`
+	State           string `json:"state"` // queued
+	QueuePosition   int    `json:"queue_position"`
+	EstimatedWaitMs int64  `json:"estimated_wait_ms"` // From the agent's recent average duration, 0 when unknown
+}
+
+// Output encodings an execution can return its output in
+const (
+	OutputEncodingText   = "text"
+	OutputEncodingJSON   = "json"   // Output must be a JSON document, also returned in OutputJSON
+	OutputEncodingBase64 = "base64" // Output holds the raw bytes base64-encoded, for binary output
+)
+
+// ExecutionResult is the result of a finished execution
+type ExecutionResult struct {
+	ID            string          `json:"id"`
+	AgentID       string          `json:"agent_id"`
+	Status        string          `json:"status"` // success, failure, timeout or cancelled
+	ExitCode      int             `json:"exit_code"`
+	Output        string          `json:"output"`
+	Encoding      string          `json:"encoding,omitempty"`
+	OutputJSON    json.RawMessage `json:"output_json,omitempty"`
+	ContentLength int             `json:"content_length,omitempty"` // Size of the raw output with the base64 encoding
+	ContentType   string          `json:"content_type,omitempty"`   // Media type hint for base64 output
+	Error         string          `json:"error"`
+	ExecutionTime int64           `json:"execution_time"` // milliseconds
+	FromCache     bool            `json:"from_cache,omitempty"`
+	Deduplicated  bool            `json:"deduplicated,omitempty"`
+}
+
+// OutputData returns the raw output of the execution, decoding base64 output
+func (r *ExecutionResult) OutputData() ([]byte, error) {
+	if r.Encoding != OutputEncodingBase64 {
+		return []byte(r.Output), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(r.Output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 output: %w", err)
+	}
+	return data, nil
+}
+
+// Execute runs an agent and waits for its result, like supervisorctl execute. An execution that
+// ran and failed returns its result with a failure status and no error; requests the supervisor
+// rejects return an *APIError.
+func (c *Client) Execute(ctx context.Context, agentID string, request ExecuteRequest) (*ExecutionResult, error) {
+	var result ExecutionResult
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/agents/"+url.PathEscape(agentID)+"/execute", request, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ExecuteOrQueue runs an agent like Execute when it starts at once. When the agent is busy with
+// another execution it returns the queued execution instead of waiting, like supervisorctl execute
+// --queue-behavior return_position; GetExecution then shows its updated position until it starts.
+func (c *Client) ExecuteOrQueue(ctx context.Context, agentID string, request ExecuteRequest) (*ExecutionResult, *QueuedExecution, error) {
+	request.QueueBehavior = QueueBehaviorReturnPosition
+	var response json.RawMessage
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/agents/"+url.PathEscape(agentID)+"/execute", request, &response); err != nil {
+		return nil, nil, err
+	}
+
+	// A queued execution is answered with 202 and its position instead of a result
+	var queued QueuedExecution
+	if err := json.Unmarshal(response, &queued); err == nil && queued.State == "queued" {
+		return nil, &queued, nil
+	}
+	var result ExecutionResult
+	if err := json.Unmarshal(response, &result); err != nil {
+		return nil, nil, fmt.Errorf("invalid execute response: %w", err)
+	}
+	return &result, nil, nil
+}
+
+// ReplayRequest changes what a replay runs with; nil fields keep the replayed execution's values,
+// and Parameters and Env entries are merged over its own
+type ReplayRequest struct {
+	Input          *string                `json:"input,omitempty"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	WorkingDir     *string                `json:"working_dir,omitempty"`
+	Env            map[string]string      `json:"env,omitempty"`
+	TimeoutSeconds *int                   `json:"timeout_seconds,omitempty"`
+	OutputEncoding string                 `json:"output_encoding,omitempty"`
+	Async          bool                   `json:"async,omitempty"` // Return without waiting for the replay to finish
+}
+
+// Replay is a new execution replaying an earlier one
+type Replay struct {
+	ExecutionID string           `json:"execution_id"`
+	ReplayOf    string           `json:"replay_of"`
+	State       string           `json:"state"`
+	Result      *ExecutionResult `json:"result,omitempty"`   // Nil with Async
+	Warnings    []string         `json:"warnings,omitempty"` // How the replay's environment differs, such as a changed executable
+}
+
+// ReplayExecution runs an execution again with the inputs it ran with, like supervisorctl execution
+// replay <id>. Unless request.Async is set it waits for the replay and returns its result too.
+func (c *Client) ReplayExecution(ctx context.Context, executionID string, request ReplayRequest) (*Replay, error) {
+	var replay Replay
+	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/executions/"+url.PathEscape(executionID)+"/replay", request, &replay); err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+// ExecutionSnapshot is the environment an execution's agent process saw
+type ExecutionSnapshot struct {
+	ExecutablePath       string    `json:"executable_path"`
+	ExecutableSHA256     string    `json:"executable_sha256,omitempty"`
+	Argv                 []string  `json:"argv"`
+	WorkingDir           string    `json:"working_dir"`
+	EnvNames             []string  `json:"env_names"` // Names only; values are not recorded
+	SupervisorVersion    string    `json:"supervisor_version"`
+	AgentConfigUpdatedAt time.Time `json:"agent_config_updated_at"`
+	Host                 string    `json:"host"`
+	CapturedAt           time.Time `json:"captured_at"`
+}
+
+// GetExecutionSnapshot returns the environment snapshot of an execution, like supervisorctl
+// execution snapshot <id>
+func (c *Client) GetExecutionSnapshot(ctx context.Context, executionID string) (*ExecutionSnapshot, error) {
+	var snapshot ExecutionSnapshot
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/executions/"+url.PathEscape(executionID)+"/snapshot", nil, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ExecutionDiff compares two finished executions; Other* fields describe the second
+type ExecutionDiff struct {
+	ExecutionID         string   `json:"execution_id"`
+	OtherID             string   `json:"other_id"`
+	State               string   `json:"state"`
+	OtherState          string   `json:"other_state"`
+	Status              string   `json:"status,omitempty"`
+	OtherStatus         string   `json:"other_status,omitempty"`
+	ExitCode            int      `json:"exit_code"`
+	OtherExitCode       int      `json:"other_exit_code"`
+	DurationMs          int64    `json:"duration_ms"`
+	OtherDurationMs     int64    `json:"other_duration_ms"`
+	DurationDeltaMs     int64    `json:"duration_delta_ms"`
+	Changed             []string `json:"changed"` // Compared fields that differ
+	OutputDiff          string   `json:"output_diff,omitempty"`
+	OutputDiffTruncated bool     `json:"output_diff_truncated,omitempty"`
+}
+
+// DiffExecutions compares two finished executions, like supervisorctl execution diff <a> <b>. The
+// output diff is cut at limit bytes, or the supervisor's default when limit is 0.
+func (c *Client) DiffExecutions(ctx context.Context, executionID, otherID string, limit int) (*ExecutionDiff, error) {
+	path := "/api/v1/executions/" + url.PathEscape(executionID) + "/diff/" + url.PathEscape(otherID)
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+
+	var diff ExecutionDiff
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// Print writes the comparison as supervisorctl execution diff shows it
+func (d *ExecutionDiff) Print(w io.Writer) {
+	fmt.Fprintf(w, "executions:  %s -> %s\n", d.ExecutionID, d.OtherID)
+	fmt.Fprintf(w, "state:       %s -> %s\n", d.State, d.OtherState)
+	fmt.Fprintf(w, "status:      %s -> %s\n", d.Status, d.OtherStatus)
+	fmt.Fprintf(w, "exit code:   %d -> %d\n", d.ExitCode, d.OtherExitCode)
+	fmt.Fprintf(w, "duration:    %dms -> %dms (%+dms)\n", d.DurationMs, d.OtherDurationMs, d.DurationDeltaMs)
+	if len(d.Changed) == 0 {
+		fmt.Fprintln(w, "changed:     nothing")
+		return
+	}
+	fmt.Fprintf(w, "changed:     %s\n", strings.Join(d.Changed, ", "))
+	if d.OutputDiff != "" {
+		fmt.Fprint(w, d.OutputDiff)
+		if d.OutputDiffTruncated {
+			fmt.Fprintln(w, "... output diff truncated")
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package supervisorctl
+
+import "errors"
+
+// Exit codes of every supervisorctl command, as returned by ExitCode. Scripts can tell a failed
+// operation (1) apart from a supervisor that could not be reached (4).
+const (
+	ExitOK              = 0 // The command succeeded
+	ExitFailure         = 1 // The supervisor rejected or failed the operation, e.g. an unknown agent
+	ExitTimeout         = 2 // A wait command timed out before its target reached the awaited state
+	ExitTerminalFailure = 3 // A wait command's target ended in a failure state
+	ExitUnreachable     = 4 // The supervisor could not be reached, or the circuit breaker is open
+	ExitUnauthorized    = 5 // The supervisor rejected the token
+	ExitServerError     = 6 // The supervisor failed with a 5xx status
+)
+
+// ExitCode maps an error returned by the client to the exit code of a command
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrWaitTimeout):
+		return ExitTimeout
+	case errors.Is(err, ErrTerminalFailure):
+		return ExitTerminalFailure
+	case errors.Is(err, ErrUnreachable):
+		return ExitUnreachable
+	case errors.Is(err, ErrUnauthorized):
+		return ExitUnauthorized
+	case errors.Is(err, ErrServerError):
+		return ExitServerError
+	default:
+		return ExitFailure
+	}
+}
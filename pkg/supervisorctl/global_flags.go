@@ -0,0 +1,53 @@
+package supervisorctl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GlobalFlags are the persistent flags of the root command, accepted before or after any command's
+// name. They win over the environment, the profile and the file.
+type GlobalFlags struct {
+	Server  string // --server, overriding server.url
+	Token   string // --token, overriding server.token
+	Profile string // --profile, selecting a profile of the config file
+}
+
+// globalFlagNames are the names of the global flags, each taking a value
+var globalFlagNames = []string{"--server", "--token", "--profile"}
+
+// ParseGlobalFlags takes the global flags out of args, given as --server URL or --server=URL, and
+// returns them with the remaining args in order. Arguments after -- are left alone.
+func ParseGlobalFlags(args []string) (GlobalFlags, []string, error) {
+	var flags GlobalFlags
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		var target *string
+		switch name {
+		case "--server":
+			target = &flags.Server
+		case "--token":
+			target = &flags.Token
+		case "--profile":
+			target = &flags.Profile
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return GlobalFlags{}, nil, fmt.Errorf("flag %s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		*target = value
+	}
+	return flags, rest, nil
+}
@@ -0,0 +1,279 @@
+package supervisorctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GroupTargetPrefix marks a target naming an agent group instead of an agent, as in group:payments
+const GroupTargetPrefix = "group:"
+
+// ErrNotConfirmed is returned when a group or pattern operation the supervisor asked to confirm is
+// declined
+var ErrNotConfirmed = errors.New("operation not confirmed")
+
+// Lifecycle actions GroupOperation applies to a group's members
+const (
+	GroupActionStart   = "start"
+	GroupActionRestart = "restart"
+	GroupActionEnable  = "enable"
+	GroupActionDisable = "disable"
+)
+
+// AgentGroup is a named, ordered list of agents: members start in their order and stop in the
+// reverse order
+type AgentGroup struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Members     []string  `json:"members"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// GroupOperationStep reports what a group operation did to one member
+type GroupOperationStep struct {
+	AgentID             string   `json:"agent_id"`
+	Step                string   `json:"step"`   // stop or start
+	Status              string   `json:"status"` // applied, skipped or failed
+	Message             string   `json:"message,omitempty"`
+	CancelledExecutions []string `json:"cancelled_executions,omitempty"`
+}
+
+// GroupOperationResult reports a lifecycle operation on a group or agent pattern, its steps in the
+// order they were taken; it ends at the first failed step
+type GroupOperationResult struct {
+	Group     string               `json:"group,omitempty"`
+	Pattern   string               `json:"pattern,omitempty"`
+	Action    string               `json:"action"`
+	Steps     []GroupOperationStep `json:"steps"`
+	Protected []string             `json:"protected,omitempty"` // Protected agents left out, as force was not set
+}
+
+// BatchOptions are the options of a lifecycle operation on a group or agent pattern
+type BatchOptions struct {
+	Force        bool   // Include the agents the supervisor protects
+	Confirmation string // Token of the 428 response to an earlier attempt
+}
+
+// PlannedOperation is what a lifecycle operation would do to one agent, as a dry run reports it
+type PlannedOperation struct {
+	AgentID       string `json:"target"`
+	Action        string `json:"action"`
+	CurrentState  string `json:"current_state,omitempty"`
+	ExpectedState string `json:"expected_state,omitempty"`
+	Status        string `json:"status"` // pending, skipped or failed
+	Message       string `json:"message,omitempty"`
+}
+
+// OperationPlan reports what a lifecycle operation would do to each agent of its target, in the
+// order the operation would reach them, in the shape of bulk operation results
+type OperationPlan struct {
+	Action    string             `json:"action"`
+	DryRun    bool               `json:"dry_run,omitempty"`
+	Matched   int                `json:"matched"`
+	Succeeded int                `json:"succeeded"`
+	Skipped   int                `json:"skipped"`
+	Failed    int                `json:"failed"`
+	Results   []PlannedOperation `json:"results"`
+}
+
+// ConfirmFunc decides whether a group or pattern operation the supervisor asked to confirm goes
+// ahead, given the agents it applies to
+type ConfirmFunc func(target, action string, agents []string) (bool, error)
+
+// ListGroups returns all agent groups, ordered by name
+func (c *Client) ListGroups(ctx context.Context) ([]AgentGroup, error) {
+	var response struct {
+		Groups []AgentGroup `json:"groups"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/groups", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Groups, nil
+}
+
+// GetGroup returns an agent group
+func (c *Client) GetGroup(ctx context.Context, name string) (*AgentGroup, error) {
+	var group AgentGroup
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/groups/"+url.PathEscape(name), nil, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup creates an agent group; every member must be a registered agent
+func (c *Client) CreateGroup(ctx context.Context, group AgentGroup) error {
+	return c.doJSON(ctx, http.MethodPost, "/api/v1/groups", group, &struct{}{})
+}
+
+// UpdateGroup replaces the description and members of an agent group
+func (c *Client) UpdateGroup(ctx context.Context, group AgentGroup) error {
+	return c.doJSON(ctx, http.MethodPut, "/api/v1/groups/"+url.PathEscape(group.Name), group, &struct{}{})
+}
+
+// DeleteGroup deletes an agent group, leaving its members as they are
+func (c *Client) DeleteGroup(ctx context.Context, name string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/api/v1/groups/"+url.PathEscape(name), nil, &struct{}{})
+}
+
+// GroupOperation applies a lifecycle action to every member of a group, like supervisorctl restart
+// group:payments. The members' operation locks are all taken first, so a member busy with another
+// operation fails the whole request.
+func (c *Client) GroupOperation(ctx context.Context, group, action string) (*GroupOperationResult, error) {
+	return c.BatchOperation(ctx, GroupTargetPrefix+group, action, BatchOptions{})
+}
+
+// BatchOperation applies a lifecycle action to a group:<name> target or to the agents an agent
+// pattern such as * or prefix:payments- matches, like supervisorctl restart '*'. Operations on many
+// agents fail with a 428 APIError holding a confirmation token, which is resent in options.
+func (c *Client) BatchOperation(ctx context.Context, target, action string, options BatchOptions) (*GroupOperationResult, error) {
+	query := url.Values{}
+	if options.Force {
+		query.Set("force", strconv.FormatBool(true))
+	}
+	if options.Confirmation != "" {
+		query.Set("confirm", options.Confirmation)
+	}
+	path := "/api/v1/agents/" + url.PathEscape(target) + "/" + action
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result GroupOperationResult
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ConfirmedBatchOperation runs BatchOperation and, when the supervisor asks for confirmation, asks
+// confirm and resends the operation with the token; ErrNotConfirmed is returned when it declines
+func (c *Client) ConfirmedBatchOperation(ctx context.Context, target, action string, options BatchOptions, confirm ConfirmFunc) (*GroupOperationResult, error) {
+	result, err := c.BatchOperation(ctx, target, action, options)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusPreconditionRequired || apiErr.ConfirmationToken == "" {
+		return result, err
+	}
+
+	confirmed, err := confirm(target, action, apiErr.Agents)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("%s of %s: %w", action, target, ErrNotConfirmed)
+	}
+	options.Confirmation = apiErr.ConfirmationToken
+	return c.BatchOperation(ctx, target, action, options)
+}
+
+// PlanOperation reports what a lifecycle action on an agent, a group:<name> target or an agent
+// pattern would do, without doing it, like supervisorctl restart --dry-run. The supervisor checks
+// each agent's preconditions; those that fail, such as an unknown agent, are reported in the plan
+// rather than returned. Force includes protected agents as it would for BatchOperation.
+func (c *Client) PlanOperation(ctx context.Context, target, action string, options BatchOptions) (*OperationPlan, error) {
+	query := url.Values{"dry_run": {"true"}}
+	if options.Force {
+		query.Set("force", strconv.FormatBool(true))
+	}
+	path := "/api/v1/agents/" + url.PathEscape(target) + "/" + action + "?" + query.Encode()
+
+	var response json.RawMessage
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &response); err != nil {
+		return nil, err
+	}
+	var plan OperationPlan
+	if err := json.Unmarshal(response, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if plan.Results != nil {
+		return &plan, nil
+	}
+
+	// A single agent's plan is one operation, which is reported as a plan of one
+	var operation PlannedOperation
+	if err := json.Unmarshal(response, &operation); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	plan = OperationPlan{Action: action, DryRun: true, Matched: 1, Results: []PlannedOperation{operation}}
+	switch operation.Status {
+	case "skipped":
+		plan.Skipped++
+	case "failed":
+		plan.Failed++
+	}
+	return &plan, nil
+}
+
+// Print writes the planned operation per agent and the totals as supervisorctl --dry-run shows them
+func (p *OperationPlan) Print(w io.Writer) {
+	pending := 0
+	for _, operation := range p.Results {
+		line := fmt.Sprintf("%s  %s  %s -> %s  %s", operation.AgentID, operation.Action, operation.CurrentState, operation.ExpectedState, operation.Status)
+		if operation.Message != "" {
+			line += ": " + operation.Message
+		}
+		fmt.Fprintln(w, line)
+		if operation.Status == "pending" {
+			pending++
+		}
+	}
+	fmt.Fprintf(w, "%d matched, %d pending, %d skipped, %d failed\n", p.Matched, pending, p.Skipped, p.Failed)
+}
+
+// PromptConfirm returns a ConfirmFunc that lists the agents on out and asks for a yes on in, or that
+// agrees without asking when assumeYes is set, as supervisorctl --yes does for scripts
+func PromptConfirm(in io.Reader, out io.Writer, assumeYes bool) ConfirmFunc {
+	return func(target, action string, agents []string) (bool, error) {
+		if assumeYes {
+			return true, nil
+		}
+		printConfirmPrompt(out, target, action, agents)
+		return readConfirmation(in)
+	}
+}
+
+// printConfirmPrompt lists the agents an operation applies to and asks whether to continue
+func printConfirmPrompt(out io.Writer, target, action string, agents []string) {
+	fmt.Fprintf(out, "%s of %s applies to %d agents:\n", action, target, len(agents))
+	for _, agentID := range agents {
+		fmt.Fprintf(out, "  %s\n", agentID)
+	}
+	fmt.Fprint(out, "Continue? [y/N]: ")
+}
+
+// readConfirmation reads an answer line from in, reporting whether it is a yes; end of input is a no
+func readConfirmation(in io.Reader) (bool, error) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	return isYes(line), nil
+}
+
+// isYes reports whether an answer line is a yes
+func isYes(line string) bool {
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// Status returns the runtime status of a target, like supervisorctl status: an agent ID,
+// group:<name> for the group's members in member order, or every agent when empty
+func (c *Client) Status(ctx context.Context, target string) ([]AgentStatus, error) {
+	statuses, _, _, err := c.targetStatus(ctx, target, "", 0)
+	return statuses, err
+}
@@ -0,0 +1,326 @@
+package supervisorctl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+)
+
+// Lint rules, as reported in LintProblem.Rule and taken by supervisorctl lint --warn
+const (
+	LintRuleSyntax        = "syntax"         // A file cannot be decoded
+	LintRuleUnknownField  = "unknown-field"  // A key maps to no setting; a warning by default
+	LintRuleDuplicateID   = "duplicate-id"   // Two agents or two tasks of the linted files share an ID
+	LintRuleInvalidAgent  = "invalid-agent"  // The supervisor would reject an agent setting
+	LintRuleInvalidTask   = "invalid-task"   // The supervisor would reject a task setting
+	LintRuleInvalidCron   = "invalid-cron"   // A task's cron expression does not parse
+	LintRuleFilesystem    = "filesystem"     // An agent's executable or directory is missing or unusable on this host
+	LintRuleUnknownAgent  = "unknown-agent"  // A task runs an agent none of the linted files defines
+	LintRuleDisabledAgent = "disabled-agent" // A task runs a disabled agent; a warning by default
+	LintRuleTolerated     = "tolerated"      // A problem the agent opts to tolerate; always a warning
+)
+
+// LintRules lists every lint rule
+var LintRules = []string{
+	LintRuleSyntax, LintRuleUnknownField, LintRuleDuplicateID, LintRuleInvalidAgent, LintRuleInvalidTask,
+	LintRuleInvalidCron, LintRuleFilesystem, LintRuleUnknownAgent, LintRuleDisabledAgent, LintRuleTolerated,
+}
+
+// defaultWarningRules are the lint rules reported as warnings without --warn
+var defaultWarningRules = []string{LintRuleUnknownField, LintRuleDisabledAgent, LintRuleTolerated}
+
+// Severities of lint problems
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// ErrLintFailed is wrapped by LintReport.Err when lint found errors
+var ErrLintFailed = errors.New("lint found errors")
+
+// LintOptions configures Lint
+type LintOptions struct {
+	Warn []string // Rules reported as warnings rather than errors, like --warn filesystem,unknown-agent
+}
+
+// LintProblem is a problem lint found in a definition file
+type LintProblem struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"` // error or warning
+	Rule     string `json:"rule"`
+	Scope    string `json:"scope,omitempty"` // agent or task
+	ID       string `json:"id,omitempty"`    // ID of the agent or task
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+// String formats the problem as file:line:column: severity: message [rule]
+func (p LintProblem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location += ":" + strconv.Itoa(p.Line)
+		if p.Column > 0 {
+			location += ":" + strconv.Itoa(p.Column)
+		}
+	}
+	message := p.Message
+	if p.Field != "" {
+		message = p.Field + ": " + message
+	}
+	if p.Scope != "" {
+		message = p.Scope + " " + p.ID + ": " + message
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", location, p.Severity, message, p.Rule)
+}
+
+// LintReport is what supervisorctl lint found, ordered by file and position
+type LintReport struct {
+	Files    int           `json:"files"` // Definition files linted
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Problems []LintProblem `json:"problems"`
+}
+
+// Print writes one problem per line and the totals as supervisorctl lint shows them
+func (r *LintReport) Print(w io.Writer) {
+	for _, problem := range r.Problems {
+		fmt.Fprintln(w, problem.String())
+	}
+	fmt.Fprintf(w, "%d files linted, %d errors, %d warnings\n", r.Files, r.Errors, r.Warnings)
+}
+
+// Err returns an error wrapping ErrLintFailed when lint found errors, for supervisorctl lint to
+// exit with ExitFailure
+func (r *LintReport) Err() error {
+	if r.Errors == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %d errors in %d files", ErrLintFailed, r.Errors, r.Files)
+}
+
+// linter collects the problems of the definition files of one lint run
+type linter struct {
+	warn   map[string]bool
+	report *LintReport
+}
+
+// lintedAgent is an agent defined in a linted file
+type lintedAgent struct {
+	config *models.AgentConfiguration
+	file   *definitions.File
+	key    string
+}
+
+// Lint checks agent and task definition files offline, like supervisorctl lint config.d/: each
+// path is a .yaml, .yml or .json file, or a directory whose definition files are linted. Files
+// are decoded and validated as the supervisor decodes and validates them, and tasks must run agents
+// defined in one of the files. Lint fails only when a path cannot be read; the problems found are
+// in the report.
+func Lint(paths []string, options LintOptions) (*LintReport, error) {
+	l := &linter{warn: map[string]bool{}, report: &LintReport{Problems: []LintProblem{}}}
+	for _, rule := range defaultWarningRules {
+		l.warn[rule] = true
+	}
+	for _, rule := range options.Warn {
+		if !slices.Contains(LintRules, rule) {
+			return nil, fmt.Errorf("unknown lint rule %q", rule)
+		}
+		l.warn[rule] = true
+	}
+
+	filePaths, err := definitionFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*definitions.File
+	for _, path := range filePaths {
+		file, err := definitions.LoadFile(path)
+		var syntaxErr *definitions.SyntaxError
+		switch {
+		case errors.As(err, &syntaxErr):
+			l.add(LintProblem{File: path, Line: syntaxErr.Line, Rule: LintRuleSyntax, Message: syntaxErr.Err.Error()})
+		case err != nil:
+			return nil, err
+		default:
+			files = append(files, file)
+		}
+	}
+	l.report.Files = len(filePaths)
+
+	defined := l.lintAgents(files)
+	l.lintTasks(files, defined)
+
+	sort.SliceStable(l.report.Problems, func(i, j int) bool {
+		a, b := l.report.Problems[i], l.report.Problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.report, nil
+}
+
+// lintAgents checks every agent and returns them by ID, the first definition of each
+func (l *linter) lintAgents(files []*definitions.File) map[string]lintedAgent {
+	defined := map[string]lintedAgent{}
+	for _, file := range files {
+		for _, key := range file.Unknown {
+			l.addAt(file, key, LintProblem{Rule: LintRuleUnknownField, Field: key, Message: "unknown field"})
+		}
+
+		for i, agent := range file.Agents {
+			key := "agents[" + strconv.Itoa(i) + "]"
+			problem := func(rule, field, message string) {
+				at := key
+				if field != "" {
+					at += "." + field
+				}
+				l.addAt(file, at, LintProblem{Rule: rule, Scope: "agent", ID: agent.ID, Field: field, Message: message})
+			}
+
+			if first, ok := defined[agent.ID]; ok && agent.ID != "" {
+				line, _ := first.file.Position(first.key)
+				problem(LintRuleDuplicateID, "id", fmt.Sprintf("agent %s is already defined at %s:%d", agent.ID, first.file.Path, line))
+			} else {
+				defined[agent.ID] = lintedAgent{config: agent, file: file, key: key}
+			}
+
+			errs, warnings := definitions.ValidateAgent(agent)
+			for _, fieldErr := range errs {
+				problem(LintRuleInvalidAgent, fieldErr.Field, fieldErr.Message)
+			}
+			for _, warning := range warnings {
+				problem(LintRuleTolerated, warning.Field, warning.Message)
+			}
+			for _, issue := range agents.CheckFilesystem(agent) {
+				problem(LintRuleFilesystem, issue.Field, issue.Err.Error())
+			}
+		}
+	}
+	return defined
+}
+
+// lintTasks checks every task and the agents it runs
+func (l *linter) lintTasks(files []*definitions.File, defined map[string]lintedAgent) {
+	seen := map[string]string{}
+	for _, file := range files {
+		for i, task := range file.Tasks {
+			key := "tasks[" + strconv.Itoa(i) + "]"
+			problem := func(rule, field, message string) {
+				at := key
+				if field != "" {
+					at += "." + field
+				}
+				l.addAt(file, at, LintProblem{Rule: rule, Scope: "task", ID: task.ID, Field: field, Message: message})
+			}
+
+			if first, ok := seen[task.ID]; ok && task.ID != "" {
+				problem(LintRuleDuplicateID, "id", fmt.Sprintf("task %s is already defined at %s", task.ID, first))
+			} else {
+				line, _ := file.Position(key)
+				seen[task.ID] = file.Path + ":" + strconv.Itoa(line)
+			}
+
+			for _, fieldErr := range definitions.ValidateTask(task) {
+				rule := LintRuleInvalidTask
+				if fieldErr.Field == "cron_expression" {
+					rule = LintRuleInvalidCron
+				}
+				problem(rule, fieldErr.Field, fieldErr.Message)
+			}
+
+			// Agent patterns pick their agents when the task fires
+			references := map[string]string{}
+			if task.AgentID != "" {
+				references[task.AgentID] = "agent_id"
+			}
+			if task.AgentSelector != nil {
+				for _, agentID := range task.AgentSelector.AgentIDs {
+					references[agentID] = "agent_ids"
+				}
+			}
+			agentIDs := make([]string, 0, len(references))
+			for agentID := range references {
+				agentIDs = append(agentIDs, agentID)
+			}
+			sort.Strings(agentIDs)
+			for _, agentID := range agentIDs {
+				agent, ok := defined[agentID]
+				switch {
+				case !ok:
+					problem(LintRuleUnknownAgent, references[agentID], fmt.Sprintf("task runs agent %s which no linted file defines", agentID))
+				case !agent.config.Enabled:
+					problem(LintRuleDisabledAgent, references[agentID], fmt.Sprintf("task runs agent %s which is disabled", agentID))
+				}
+			}
+		}
+	}
+}
+
+// addAt adds problem, located at key in file
+func (l *linter) addAt(file *definitions.File, key string, problem LintProblem) {
+	problem.File = file.Path
+	problem.Line, problem.Column = file.Position(key)
+	l.add(problem)
+}
+
+// add adds problem with the severity of its rule
+func (l *linter) add(problem LintProblem) {
+	problem.Severity = LintError
+	if l.warn[problem.Rule] {
+		problem.Severity = LintWarning
+		l.report.Warnings++
+	} else {
+		l.report.Errors++
+	}
+	l.report.Problems = append(l.report.Problems, problem)
+}
+
+// definitionFiles expands paths into the definition files to lint: files as given, and the
+// definition files found in directories, in lexical order
+func definitionFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("lint needs at least one file or directory")
+	}
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(walked string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && definitions.IsDefinitionFile(walked) {
+				files = append(files, walked)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
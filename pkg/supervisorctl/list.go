@@ -0,0 +1,97 @@
+package supervisorctl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ListOptions orders, filters and pages the list commands, like supervisorctl agent list --sort name
+// --order desc --filter enabled=true --limit 20 --offset 40. Results are ordered by ID by default.
+type ListOptions struct {
+	Sort    string            // --sort: id, name or created_at
+	Order   string            // --order: asc or desc
+	Filters map[string]string // --filter key=value: enabled and access_type for agents, enabled and agent_id for tasks
+	Limit   int               // --limit, 0 for all
+	Offset  int               // --offset
+}
+
+// ParseFilters parses repeated --filter key=value flags
+func ParseFilters(flags []string) (map[string]string, error) {
+	filters := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected key=value", flag)
+		}
+		filters[key] = value
+	}
+	return filters, nil
+}
+
+// query encodes the options as a query string, empty when they are all unset
+func (o ListOptions) query() string {
+	values := url.Values{}
+	keys := make([]string, 0, len(o.Filters))
+	for key := range o.Filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values.Set(key, o.Filters[key])
+	}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	if o.Order != "" {
+		values.Set("order", o.Order)
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		values.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// AgentPage is a page of agents; Total counts the matching agents across all pages
+type AgentPage struct {
+	Agents []AgentSpec `json:"agents"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// TaskPage is a page of scheduled tasks; Total counts the matching tasks across all pages
+type TaskPage struct {
+	Tasks  []Task `json:"tasks"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// ListAgents returns a page of the agents, like supervisorctl agent list
+func (c *Client) ListAgents(ctx context.Context, options ListOptions) (*AgentPage, error) {
+	var page AgentPage
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/agents"+options.query(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// QueryTasks returns a page of the scheduled tasks, like supervisorctl task list with --sort or --filter
+func (c *Client) QueryTasks(ctx context.Context, options ListOptions) (*TaskPage, error) {
+	var page TaskPage
+	if err := c.doJSON(ctx, http.MethodGet, "/tasks"+options.query(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,160 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Errors callers can test for with errors.Is to tell failures apart, e.g. to pick an exit code
+var (
+	ErrUnreachable  = errors.New("supervisor unreachable")  // No response: connection failed or the circuit breaker is open
+	ErrUnauthorized = errors.New("unauthorized")            // The supervisor rejected the token with 401 or 403
+	ErrServerError  = errors.New("supervisor server error") // The supervisor failed the request with a 5xx status
+	ErrCircuitOpen  = errors.New("circuit breaker open")    // Repeated failures; requests fail fast until the cooldown passes
+)
+
+// RetryPolicy controls how the client retries failed requests, as set under server.retries in the
+// supervisorctl config file. GET requests are retried on connection errors and 5xx responses; other
+// requests only when the connection was refused or reset before any of the request was written.
+type RetryPolicy struct {
+	MaxElapsed       time.Duration `mapstructure:"max_elapsed" json:"max_elapsed"`             // Give up retrying after this long, 0 disables retries
+	InitialInterval  time.Duration `mapstructure:"initial_interval" json:"initial_interval"`   // Wait before the first retry, doubled for each further one
+	MaxInterval      time.Duration `mapstructure:"max_interval" json:"max_interval"`           // Cap on the wait between retries
+	BreakerThreshold int           `mapstructure:"breaker_threshold" json:"breaker_threshold"` // Consecutive failed attempts that open the circuit, 0 disables the breaker
+	BreakerCooldown  time.Duration `mapstructure:"breaker_cooldown" json:"breaker_cooldown"`   // How long an open circuit fails requests fast
+}
+
+// DefaultRetryPolicy returns the retry policy of new clients
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxElapsed:       30 * time.Second,
+		InitialInterval:  200 * time.Millisecond,
+		MaxInterval:      5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// backoff returns the wait before retry number attempt, starting at 1, with jitter of up to half
+// the interval
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	interval := p.InitialInterval
+	for i := 1; i < attempt && interval < p.MaxInterval; i++ {
+		interval *= 2
+	}
+	if p.MaxInterval > 0 && interval > p.MaxInterval {
+		interval = p.MaxInterval
+	}
+	if interval <= 0 {
+		return 0
+	}
+	return interval/2 + rand.N(interval/2+1)
+}
+
+// circuitBreaker fails requests fast after threshold consecutive failed attempts, until cooldown
+// has passed; the next attempt then decides whether the circuit closes again
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a request may be sent
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return time.Now().After(b.openUntil)
+}
+
+// record counts the outcome of an attempt, opening the circuit at the policy's threshold
+func (b *circuitBreaker) record(failed bool, policy RetryPolicy) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !failed {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.failures++
+	if policy.BreakerThreshold > 0 && b.failures >= policy.BreakerThreshold {
+		b.openUntil = time.Now().Add(policy.BreakerCooldown)
+	}
+}
+
+// send sends a request to the supervisor, retrying it as the retry policy allows. Transport
+// failures are returned wrapping ErrUnreachable and unsuccessful responses as an *APIError; the
+// caller closes the body of the returned response.
+func (c *Client) send(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	policy := c.retryPolicy
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			return nil, fmt.Errorf("%w: %w", ErrUnreachable, ErrCircuitOpen)
+		}
+
+		var written atomic.Bool
+		trace := &httptrace.ClientTrace{
+			WroteHeaderField: func(string, []string) { written.Store(true) },
+		}
+		httpRequest, err := c.newRequest(httptrace.WithClientTrace(ctx, trace), method, path, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		for name, values := range header {
+			httpRequest.Header[name] = values
+		}
+
+		response, err := c.httpClient.Do(httpRequest)
+		retryable := false
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			c.breaker.record(true, policy)
+			retryable = method == http.MethodGet || (!written.Load() && isConnectionError(err))
+			err = fmt.Errorf("%w: failed to send request: %w", ErrUnreachable, err)
+		case response.StatusCode >= 500:
+			c.breaker.record(true, policy)
+			retryable = method == http.MethodGet && response.StatusCode != http.StatusNotImplemented
+			err = readAPIError(response)
+			response.Body.Close()
+		case (response.StatusCode < 200 || response.StatusCode >= 300) && response.StatusCode != http.StatusNotModified:
+			// 304 answers a conditional request, which its caller handles
+			c.breaker.record(false, policy)
+			err = readAPIError(response)
+			response.Body.Close()
+			return nil, err
+		default:
+			c.breaker.record(false, policy)
+			return response, nil
+		}
+
+		wait := policy.backoff(attempt)
+		if !retryable || time.Since(start)+wait > policy.MaxElapsed {
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isConnectionError reports whether err is a failure to connect, or a refused or reset connection
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,54 @@
+package supervisorctl
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ServerInfo describes the running supervisor, as shown by supervisorctl server info
+type ServerInfo struct {
+	Version          string    `json:"version"`
+	Commit           string    `json:"commit"`
+	BuildDate        string    `json:"build_date"`
+	GoVersion        string    `json:"go_version"`
+	StartedAt        time.Time `json:"started_at"`
+	UptimeSeconds    float64   `json:"uptime_seconds"`
+	Goroutines       int       `json:"goroutines"`
+	Agents           int       `json:"agents"`
+	ActiveExecutions int       `json:"active_executions"`
+	QueuedExecutions int       `json:"queued_executions"` // Executions waiting to start
+	Memory           struct {
+		HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+		HeapSysBytes   uint64 `json:"heap_sys_bytes"`
+		HeapObjects    uint64 `json:"heap_objects"`
+		GCCycles       uint32 `json:"gc_cycles"`
+	} `json:"memory"`
+	Scheduler struct {
+		Running     bool   `json:"running"`
+		Tasks       int    `json:"tasks"`
+		ActiveTasks int    `json:"active_tasks"`
+		Timezone    string `json:"timezone"`
+	} `json:"scheduler"`
+	Leadership struct {
+		Role           string     `json:"role"` // leader or follower
+		Identity       string     `json:"identity"`
+		Leader         string     `json:"leader"`
+		LeaderAddress  string     `json:"leader_address"`
+		LeaseExpiresAt *time.Time `json:"lease_expires_at"`
+	} `json:"leadership"`
+}
+
+// Uptime returns how long the supervisor has been running
+func (si *ServerInfo) Uptime() time.Duration {
+	return time.Duration(si.UptimeSeconds * float64(time.Second))
+}
+
+// GetServerInfo returns the version, build, runtime and workload info of the supervisor
+func (c *Client) GetServerInfo(ctx context.Context) (*ServerInfo, error) {
+	var info ServerInfo
+	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/server/info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
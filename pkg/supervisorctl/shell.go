@@ -0,0 +1,415 @@
+package supervisorctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ShellPrompt is printed before each command the interactive shell reads
+const ShellPrompt = "supervisor> "
+
+// ShellCommands are the commands of the interactive shell, completed as the first word of a line
+var ShellCommands = []string{"status", "start", "stop", "restart", "task", "logs", "set", "history", "complete", "help", "exit", "quit"}
+
+// ShellTaskCommands are the task subcommands of the interactive shell
+var ShellTaskCommands = []string{"list", "run", "schedule", "preview-input"}
+
+// ShellFormats are the output formats set format accepts in the interactive shell
+var ShellFormats = []string{OutputTable, OutputJSON}
+
+// shellHelp lists the commands of the interactive shell
+const shellHelp = `status [target]                     show the status of an agent, group:<name> or every agent
+start <target>...                   start persistent agents
+stop <target>...                    disable agents; their in-flight executions finish
+restart <target>...                 cancel the agents' executions and enable them again
+task list                           list the scheduled tasks
+task run|schedule|preview-input <id>
+logs <agent>                        show the output of the agent's latest execution
+set format json|table               print the results of later commands as JSON or tables
+history                             list the commands of this session
+complete <line>                     list the completions of the line's last word
+exit, quit                          leave the shell
+`
+
+// Shell is an interactive supervisorctl session, like supervisorctl with no command: it reads one
+// command per line and runs it with the same client, so the session authenticates once, keeping
+// the command history and the output format until exit, quit or the end of the input. A command
+// that fails reports its error and the shell reads the next.
+type Shell struct {
+	client  *Client
+	in      *bufio.Scanner
+	out     io.Writer
+	format  string
+	table   TableOptions
+	history []string
+}
+
+// NewShell returns a shell reading commands from in and writing results and errors to out, printing
+// tables until set format changes it
+func NewShell(client *Client, in io.Reader, out io.Writer) *Shell {
+	return &Shell{client: client, in: bufio.NewScanner(in), out: out, format: OutputTable}
+}
+
+// SetFormat sets the output format of later commands, table or json, like set format in the shell
+func (s *Shell) SetFormat(format string) error {
+	if !slices.Contains(ShellFormats, format) {
+		return fmt.Errorf("invalid format %q: must be one of %s", format, strings.Join(ShellFormats, ", "))
+	}
+	s.format = format
+	return nil
+}
+
+// SetTableOptions sets how tables are printed, e.g. their width and colors
+func (s *Shell) SetTableOptions(options TableOptions) {
+	s.table = options
+}
+
+// Format returns the output format of the session
+func (s *Shell) Format() string {
+	return s.format
+}
+
+// History returns the command lines read so far, oldest first
+func (s *Shell) History() []string {
+	return slices.Clone(s.history)
+}
+
+// Run reads and runs commands until exit, quit or the end of the input, which end the session
+// without an error. It returns the error reading the input, or ctx's once it ends.
+func (s *Shell) Run(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fmt.Fprint(s.out, ShellPrompt)
+		line, ok := s.readLine()
+		if !ok {
+			fmt.Fprintln(s.out)
+			return s.in.Err()
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		s.history = append(s.history, strings.TrimSpace(line))
+		if words[0] == "exit" || words[0] == "quit" {
+			return nil
+		}
+		if err := s.Execute(ctx, line); err != nil && !PrintPermissionError(s.out, err) {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+// readLine reads the next line of the input, false at its end
+func (s *Shell) readLine() (string, bool) {
+	if !s.in.Scan() {
+		return "", false
+	}
+	return s.in.Text(), true
+}
+
+// Execute runs one command line of the shell
+func (s *Shell) Execute(ctx context.Context, line string) error {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return nil
+	}
+	command, args := words[0], words[1:]
+	switch command {
+	case "status":
+		return s.status(ctx, args)
+	case "start", "stop", "restart":
+		return s.lifecycle(ctx, command, args)
+	case "task":
+		return s.task(ctx, args)
+	case "logs":
+		return s.logs(ctx, args)
+	case "set":
+		if len(args) != 2 || args[0] != "format" {
+			return fmt.Errorf("usage: set format %s", strings.Join(ShellFormats, "|"))
+		}
+		return s.SetFormat(args[1])
+	case "history":
+		for i, line := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, line)
+		}
+		return nil
+	case "complete":
+		// The rest of the line is completed as typed, so a trailing space asks for a new word
+		rest := strings.TrimPrefix(strings.TrimLeft(line, " \t"), command)
+		for _, candidate := range s.Complete(ctx, strings.TrimLeft(rest, " \t")) {
+			fmt.Fprintln(s.out, candidate)
+		}
+		return nil
+	case "help":
+		fmt.Fprint(s.out, shellHelp)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q; help lists the commands", command)
+}
+
+// Complete returns the candidates for the last word of line: command names for the first word,
+// the live agent IDs and group:<name> targets after the lifecycle commands and logs, and the
+// task subcommands and task IDs after task. A line ending in a space completes a new word.
+func (s *Shell) Complete(ctx context.Context, line string) []string {
+	words := strings.Fields(line)
+	if line == "" || strings.TrimRight(line, " \t") != line {
+		words = append(words, "")
+	}
+	return s.complete(ctx, words)
+}
+
+// complete returns the candidates for the last of words given the others
+func (s *Shell) complete(ctx context.Context, words []string) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	args, toComplete := words[:len(words)-1], words[len(words)-1]
+	if len(args) == 0 {
+		return filterCandidates(ShellCommands, nil, toComplete)
+	}
+
+	command, args := args[0], args[1:]
+	switch {
+	case slices.Contains([]string{"status", "start", "stop", "restart", "logs"}, command):
+		candidates, _ := CompleteAgentTargets(s.client)(ctx, args, toComplete)
+		return candidates
+	case command == "task" && len(args) == 0:
+		return filterCandidates(ShellTaskCommands, nil, toComplete)
+	case command == "task" && args[0] != "list" && slices.Contains(ShellTaskCommands, args[0]):
+		candidates, _ := CompleteTaskIDs(s.client)(ctx, args[1:], toComplete)
+		return candidates
+	case command == "set" && len(args) == 0:
+		return filterCandidates([]string{"format"}, nil, toComplete)
+	case command == "set" && len(args) == 1 && args[0] == "format":
+		return filterCandidates(ShellFormats, nil, toComplete)
+	}
+	return nil
+}
+
+// status prints the status of a target, every agent without one
+func (s *Shell) status(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: status [target]")
+	}
+	target := ""
+	if len(args) == 1 {
+		target = args[0]
+	}
+	statuses, err := s.client.Status(ctx, target)
+	if err != nil {
+		return err
+	}
+	if s.format == OutputJSON {
+		return s.writeJSON(statuses)
+	}
+	return StatusColumns.Write(s.out, statuses, s.table)
+}
+
+// lifecycle starts, stops or restarts each target in turn: single agents directly, and groups and
+// agent patterns as batch operations, asking on the shell's input when the supervisor wants them
+// confirmed. It stops at the first target that fails.
+func (s *Shell) lifecycle(ctx context.Context, command string, targets []string) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("usage: %s <target>...", command)
+	}
+	action := command
+	if command == "stop" {
+		action = GroupActionDisable
+	}
+	for _, target := range targets {
+		var result interface{}
+		var err error
+		if isBatchTarget(target) {
+			result, err = s.client.ConfirmedBatchOperation(ctx, target, action, BatchOptions{}, s.confirm)
+		} else {
+			result, err = s.agentOperation(ctx, command, target)
+		}
+		if err != nil {
+			return err
+		}
+		if s.format == OutputJSON {
+			if err := s.writeJSON(result); err != nil {
+				return err
+			}
+			continue
+		}
+		s.printOperation(target, result)
+	}
+	return nil
+}
+
+// agentOperation starts, stops or restarts a single agent
+func (s *Shell) agentOperation(ctx context.Context, command, agentID string) (interface{}, error) {
+	switch command {
+	case "start":
+		return s.client.StartAgent(ctx, agentID)
+	case "stop":
+		return s.client.DisableAgent(ctx, agentID, DisableOptions{})
+	}
+	return s.client.RestartAgent(ctx, agentID)
+}
+
+// printOperation prints the outcome of a lifecycle command on a target
+func (s *Shell) printOperation(target string, result interface{}) {
+	switch result := result.(type) {
+	case *ProcessStatus:
+		fmt.Fprintf(s.out, "%s: %s\n", target, result.State)
+	case *AgentToggleResult:
+		state := "disabled"
+		if result.Enabled {
+			state = "enabled"
+		}
+		fmt.Fprintf(s.out, "%s: %s", target, state)
+		if len(result.RunningExecutions) > 0 {
+			fmt.Fprintf(s.out, ", %d executions still running", len(result.RunningExecutions))
+		}
+		if len(result.CancelledExecutions) > 0 {
+			fmt.Fprintf(s.out, ", %d executions cancelled", len(result.CancelledExecutions))
+		}
+		fmt.Fprintln(s.out)
+	case *GroupOperationResult:
+		for _, step := range result.Steps {
+			line := fmt.Sprintf("%s: %s %s", step.AgentID, step.Step, step.Status)
+			if step.Message != "" {
+				line += ": " + step.Message
+			}
+			fmt.Fprintln(s.out, line)
+		}
+		if len(result.Protected) > 0 {
+			fmt.Fprintf(s.out, "protected, left out: %s\n", strings.Join(result.Protected, ", "))
+		}
+	}
+}
+
+// confirm asks on the shell's input whether a batch operation the supervisor wants confirmed goes
+// ahead; the end of the input is a no
+func (s *Shell) confirm(target, action string, agents []string) (bool, error) {
+	printConfirmPrompt(s.out, target, action, agents)
+	line, ok := s.readLine()
+	if !ok {
+		fmt.Fprintln(s.out)
+		return false, s.in.Err()
+	}
+	return isYes(line), nil
+}
+
+// task runs a task subcommand
+func (s *Shell) task(ctx context.Context, args []string) error {
+	if len(args) == 1 && args[0] == "list" {
+		tasks, err := s.client.ListTasks(ctx)
+		if err != nil {
+			return err
+		}
+		if s.format == OutputJSON {
+			return s.writeJSON(tasks)
+		}
+		return TaskColumns.Write(s.out, tasks, s.table)
+	}
+	if len(args) != 2 || !slices.Contains(ShellTaskCommands, args[0]) {
+		return fmt.Errorf("usage: task list | task run|schedule|preview-input <id>")
+	}
+
+	subcommand, taskID := args[0], args[1]
+	switch subcommand {
+	case "run":
+		result, err := s.client.RunTask(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		if s.format == OutputJSON {
+			return s.writeJSON(result)
+		}
+		fmt.Fprintf(s.out, "execution %s: %s in %dms\n", result.ExecutionID, result.Status, result.ExecutionTimeMs)
+		s.printOutput(result.Output, result.Error)
+	case "schedule":
+		schedule, err := s.client.GetTaskSchedule(ctx, taskID, 0)
+		if err != nil {
+			return err
+		}
+		if s.format == OutputJSON {
+			return s.writeJSON(schedule)
+		}
+		if len(schedule.NextRuns) == 0 {
+			fmt.Fprintf(s.out, "%s is paused\n", taskID)
+		}
+		for _, run := range schedule.NextRuns {
+			fmt.Fprintln(s.out, run.Time.Format("2006-01-02 15:04:05 MST"))
+		}
+	default:
+		input, err := s.client.PreviewTaskInput(ctx, taskID)
+		if err != nil {
+			return err
+		}
+		if s.format == OutputJSON {
+			return s.writeJSON(map[string]string{"input": input})
+		}
+		fmt.Fprintln(s.out, input)
+	}
+	return nil
+}
+
+// logs prints the output and error of an agent's latest execution, as the supervisor keeps no
+// logs of its own for an agent
+func (s *Shell) logs(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: logs <agent>")
+	}
+	executions, err := s.client.ListExecutions(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if len(executions) == 0 {
+		fmt.Fprintf(s.out, "%s has no executions\n", args[0])
+		return nil
+	}
+
+	latest := executions[len(executions)-1]
+	result, err := s.client.GetExecutionResult(ctx, latest.ID)
+	if err != nil {
+		return err
+	}
+	if s.format == OutputJSON {
+		return s.writeJSON(map[string]interface{}{"execution": latest, "result": result})
+	}
+	if result == nil {
+		fmt.Fprintf(s.out, "execution %s is %s\n", latest.ID, latest.State)
+		return nil
+	}
+	fmt.Fprintf(s.out, "execution %s: %s, exit code %d\n", latest.ID, result.Status, result.ExitCode)
+	output := result.Output
+	if result.Encoding == OutputEncodingBase64 {
+		output = fmt.Sprintf("(%d bytes of %s output)", result.ContentLength, orDash(result.ContentType))
+	}
+	s.printOutput(output, result.Error)
+	return nil
+}
+
+// printOutput prints an execution's output and error, each ending in a newline
+func (s *Shell) printOutput(output, errorMessage string) {
+	if output != "" {
+		fmt.Fprintln(s.out, strings.TrimRight(output, "\n"))
+	}
+	if errorMessage != "" {
+		fmt.Fprintf(s.out, "error: %s\n", strings.TrimRight(errorMessage, "\n"))
+	}
+}
+
+// writeJSON prints a result as indented JSON
+func (s *Shell) writeJSON(value interface{}) error {
+	encoder := json.NewEncoder(s.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// isBatchTarget reports whether a lifecycle target names several agents: a group:<name> target or
+// an agent pattern such as * or prefix:payments-
+func isBatchTarget(target string) bool {
+	return strings.HasPrefix(target, GroupTargetPrefix) || strings.HasPrefix(target, "prefix:") || strings.ContainsAny(target, "*?[")
+}
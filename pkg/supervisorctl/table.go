@@ -0,0 +1,408 @@
+package supervisorctl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// OutputWide is the --output preset printing every column of a table
+const OutputWide = "wide"
+
+// Table layout
+const (
+	columnGap      = 2 // Spaces between columns
+	minColumnWidth = 4 // Truncation never narrows a column below its header or this
+	ellipsis       = "…"
+)
+
+// ANSI colors of states
+const (
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+	colorReset  = "\x1b[0m"
+)
+
+// TableOptions controls how the list commands print tables, like supervisorctl status --columns
+// name,state,pid --no-trunc
+type TableOptions struct {
+	Columns  []string       // --columns, in the order to print them; the table's default columns when empty
+	Wide     bool           // --output wide: every column, unless Columns are selected
+	Width    int            // Width to truncate cells to fit in, usually TerminalWidth; 0 never truncates
+	NoTrunc  bool           // --no-trunc
+	Colors   bool           // Color states, usually ColorsEnabled
+	Location *time.Location // Times are shown in this zone, the local one when nil
+	Now      time.Time      // Uptimes and durations are measured to this time, time.Now() when zero
+}
+
+// ParseColumns parses a --columns flag such as name,state,pid
+func ParseColumns(flag string) []string {
+	var columns []string
+	for _, name := range strings.Split(flag, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// now returns the time uptimes are measured to
+func (o TableOptions) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+// formatTime shows t in the options' zone, "-" when t is nil
+func (o TableOptions) formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	loc := o.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format("2006-01-02 15:04:05 MST")
+}
+
+// Column is a column of a table of rows of type T
+type Column[T any] struct {
+	Name    string // As selected by --columns, e.g. next_run
+	Header  string // e.g. NEXT RUN
+	Default bool   // Printed when no columns are selected; --output wide prints every column
+	State   bool   // The cells are states, colored when colors are on
+	Alert   bool   // Cells other than "-" are warnings, highlighted when colors are on
+	Value   func(row T, options TableOptions) string
+}
+
+// ColumnRegistry holds the columns of a table in the order --output wide prints them. The status,
+// task list and executions list commands print their tables from StatusColumns, TaskColumns and
+// ExecutionColumns, so a column registered there can be selected in that command.
+type ColumnRegistry[T any] struct {
+	columns []Column[T]
+}
+
+// NewColumnRegistry creates a registry of the columns
+func NewColumnRegistry[T any](columns ...Column[T]) *ColumnRegistry[T] {
+	registry := &ColumnRegistry[T]{}
+	for _, column := range columns {
+		registry.Register(column)
+	}
+	return registry
+}
+
+// Register adds a column to the table, replacing the column of the same name
+func (r *ColumnRegistry[T]) Register(column Column[T]) {
+	for i := range r.columns {
+		if r.columns[i].Name == column.Name {
+			r.columns[i] = column
+			return
+		}
+	}
+	r.columns = append(r.columns, column)
+}
+
+// Names returns the names of the columns
+func (r *ColumnRegistry[T]) Names() []string {
+	names := make([]string, 0, len(r.columns))
+	for _, column := range r.columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// Select returns the columns to print: the selected ones in their order, every column with Wide,
+// and the default ones otherwise
+func (r *ColumnRegistry[T]) Select(options TableOptions) ([]Column[T], error) {
+	if len(options.Columns) == 0 {
+		var columns []Column[T]
+		for _, column := range r.columns {
+			if column.Default || options.Wide {
+				columns = append(columns, column)
+			}
+		}
+		return columns, nil
+	}
+
+	columns := make([]Column[T], 0, len(options.Columns))
+	for _, name := range options.Columns {
+		index := slices.IndexFunc(r.columns, func(column Column[T]) bool { return column.Name == name })
+		if index < 0 {
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", name, strings.Join(r.Names(), ", "))
+		}
+		columns = append(columns, r.columns[index])
+	}
+	return columns, nil
+}
+
+// Write writes rows as a table of the selected columns, truncating cells with an ellipsis until the
+// table fits options.Width unless NoTrunc is set
+func (r *ColumnRegistry[T]) Write(w io.Writer, rows []T, options TableOptions) error {
+	columns, err := r.Select(options)
+	if err != nil {
+		return err
+	}
+
+	cells := make([][]string, 0, len(rows)+1)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+	}
+	cells = append(cells, header)
+	for _, row := range rows {
+		line := make([]string, len(columns))
+		for i, column := range columns {
+			line[i] = column.Value(row, options)
+		}
+		cells = append(cells, line)
+	}
+
+	widths := columnWidths(cells)
+	if options.Width > 0 && !options.NoTrunc {
+		fitWidths(widths, header, options.Width)
+	}
+
+	var out strings.Builder
+	for lineIndex, line := range cells {
+		for i, cell := range line {
+			cell = truncateCell(cell, widths[i])
+			padding := widths[i] - utf8.RuneCountInString(cell)
+			if lineIndex > 0 && options.Colors {
+				if columns[i].State {
+					cell = colorState(cell)
+				} else if columns[i].Alert && cell != "-" {
+					cell = colorYellow + cell + colorReset
+				}
+			}
+			out.WriteString(cell)
+			if i < len(line)-1 {
+				out.WriteString(strings.Repeat(" ", padding+columnGap))
+			}
+		}
+		out.WriteByte('\n')
+	}
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// columnWidths returns the widest cell of each column
+func columnWidths(cells [][]string) []int {
+	widths := make([]int, len(cells[0]))
+	for _, line := range cells {
+		for i, cell := range line {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	return widths
+}
+
+// fitWidths narrows the widest columns one character at a time until the table fits width, or every
+// column is down to its minimum
+func fitWidths(widths []int, header []string, width int) {
+	total := columnGap * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > width {
+		widest := -1
+		for i, w := range widths {
+			if w > max(utf8.RuneCountInString(header[i]), minColumnWidth) && (widest < 0 || w > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// truncateCell shortens cell to width, ending it with an ellipsis
+func truncateCell(cell string, width int) string {
+	if utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	runes := []rune(cell)
+	return string(runes[:width-1]) + ellipsis
+}
+
+// colorState colors a state or execution status: running and success green, starting and warning
+// yellow, and fatal, failed, error, failure and timeout red
+func colorState(state string) string {
+	switch strings.ToLower(strings.TrimSpace(state)) {
+	case "running", "success":
+		return colorGreen + state + colorReset
+	case "starting", "warning":
+		return colorYellow + state + colorReset
+	case "fatal", "failed", "error", "failure", "timeout":
+		return colorRed + state + colorReset
+	}
+	return state
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// TerminalWidth returns the width tables written to f are truncated to: $COLUMNS when set, the
+// terminal's width otherwise, and 0 when f is not a terminal
+func TerminalWidth(f *os.File) int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if !IsTerminal(f) {
+		return 0
+	}
+	return terminalWidth(f)
+}
+
+// ColorsEnabled reports whether tables written to f color states: when forced, like supervisorctl
+// --colors, or when f is a terminal
+func ColorsEnabled(f *os.File, force bool) bool {
+	return force || IsTerminal(f)
+}
+
+// formatAge shows a duration the way process tables do: 45s, 12m, 3h4m or 2d5h
+func formatAge(d time.Duration) string {
+	d = max(d, 0)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+}
+
+// orDash returns value, "-" when it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// StatusColumns are the columns of supervisorctl status. STATE is the process state of persistent
+// agents and the agent's status otherwise.
+var StatusColumns = NewColumnRegistry(
+	Column[AgentStatus]{Name: "id", Header: "ID", Default: true, Value: func(s AgentStatus, _ TableOptions) string { return s.ID }},
+	Column[AgentStatus]{Name: "name", Header: "NAME", Value: func(s AgentStatus, _ TableOptions) string { return orDash(s.Name) }},
+	Column[AgentStatus]{Name: "state", Header: "STATE", Default: true, State: true, Value: func(s AgentStatus, _ TableOptions) string {
+		if s.Process != nil {
+			return s.Process.State
+		}
+		return s.Status
+	}},
+	Column[AgentStatus]{Name: "pid", Header: "PID", Default: true, Value: func(s AgentStatus, _ TableOptions) string {
+		if s.Process == nil || s.Process.PID == 0 {
+			return "-"
+		}
+		return strconv.Itoa(s.Process.PID)
+	}},
+	Column[AgentStatus]{Name: "uptime", Header: "UPTIME", Default: true, Value: func(s AgentStatus, o TableOptions) string {
+		if s.Process == nil || s.Process.StartedAt == nil {
+			return "-"
+		}
+		return formatAge(o.now().Sub(*s.Process.StartedAt))
+	}},
+	Column[AgentStatus]{Name: "health", Header: "HEALTH", Default: true, Value: func(s AgentStatus, _ TableOptions) string { return orDash(s.Health) }},
+	Column[AgentStatus]{Name: "restarts", Header: "RESTARTS", Value: func(s AgentStatus, _ TableOptions) string {
+		if s.Process == nil {
+			return "-"
+		}
+		return strconv.Itoa(s.Process.Restarts)
+	}},
+	Column[AgentStatus]{Name: "active_tasks", Header: "ACTIVE TASKS", Value: func(s AgentStatus, _ TableOptions) string { return strconv.Itoa(s.ActiveTasks) }},
+	Column[AgentStatus]{Name: "last_run", Header: "LAST RUN", Value: func(s AgentStatus, o TableOptions) string { return o.formatTime(s.LastRun) }},
+	Column[AgentStatus]{Name: "next_run", Header: "NEXT RUN", Value: func(s AgentStatus, o TableOptions) string { return o.formatTime(s.NextRun) }},
+	Column[AgentStatus]{Name: "error", Header: "ERROR", Value: func(s AgentStatus, _ TableOptions) string {
+		if s.Process == nil {
+			return "-"
+		}
+		return orDash(s.Process.LastError)
+	}},
+)
+
+// TaskColumns are the columns of supervisorctl task list. NEXT RUN is "-" for a task that won't
+// run, e.g. because it is paused.
+var TaskColumns = NewColumnRegistry(
+	Column[Task]{Name: "id", Header: "ID", Default: true, Value: func(t Task, _ TableOptions) string { return t.ID }},
+	Column[Task]{Name: "name", Header: "NAME", Default: true, Value: func(t Task, _ TableOptions) string { return t.Name }},
+	Column[Task]{Name: "target", Header: "TARGET", Default: true, Value: func(t Task, _ TableOptions) string { return taskTarget(t) }},
+	Column[Task]{Name: "schedule", Header: "SCHEDULE", Default: true, Value: func(t Task, _ TableOptions) string { return t.CronExpression }},
+	Column[Task]{Name: "timezone", Header: "TIMEZONE", Value: func(t Task, _ TableOptions) string { return orDash(t.Timezone) }},
+	Column[Task]{Name: "state", Header: "STATE", Default: true, State: true, Value: func(t Task, _ TableOptions) string {
+		if !t.Active {
+			return "paused"
+		}
+		return "active"
+	}},
+	Column[Task]{Name: "enabled", Header: "ENABLED", Value: func(t Task, _ TableOptions) string { return strconv.FormatBool(t.Enabled) }},
+	Column[Task]{Name: "last_run", Header: "LAST RUN", Value: func(t Task, o TableOptions) string { return o.formatTime(t.LastRun) }},
+	Column[Task]{Name: "next_run", Header: "NEXT RUN", Default: true, Value: func(t Task, o TableOptions) string { return o.formatTime(t.NextRun) }},
+)
+
+// ExecutionColumns are the columns of supervisorctl execution list. STATUS is the outcome of
+// finished executions, PROGRESS the latest progress their agents reported, DURATION runs to now
+// for executions that have not ended, and ANOMALIES marks executions flagged as deviating from
+// their agent's or task's recent ones with "!".
+var ExecutionColumns = NewColumnRegistry(
+	Column[Execution]{Name: "id", Header: "ID", Default: true, Value: func(e Execution, _ TableOptions) string { return e.ID }},
+	Column[Execution]{Name: "agent", Header: "AGENT", Default: true, Value: func(e Execution, _ TableOptions) string { return e.AgentID }},
+	Column[Execution]{Name: "state", Header: "STATE", Default: true, State: true, Value: func(e Execution, _ TableOptions) string { return e.State }},
+	Column[Execution]{Name: "status", Header: "STATUS", State: true, Value: func(e Execution, _ TableOptions) string { return orDash(e.Status) }},
+	Column[Execution]{Name: "started", Header: "STARTED", Default: true, Value: func(e Execution, o TableOptions) string { return o.formatTime(&e.StartTime) }},
+	Column[Execution]{Name: "duration", Header: "DURATION", Default: true, Value: func(e Execution, o TableOptions) string {
+		if e.StartTime.IsZero() {
+			return "-"
+		}
+		end := o.now()
+		if e.EndTime != nil {
+			end = *e.EndTime
+		}
+		return formatAge(end.Sub(e.StartTime))
+	}},
+	Column[Execution]{Name: "exit_code", Header: "EXIT CODE", Default: true, Value: func(e Execution, _ TableOptions) string {
+		if e.EndTime == nil {
+			return "-"
+		}
+		return strconv.Itoa(e.ExitCode)
+	}},
+	Column[Execution]{Name: "anomalies", Header: "ANOMALIES", Default: true, Alert: true, Value: func(e Execution, _ TableOptions) string {
+		if len(e.Anomalies) == 0 {
+			return "-"
+		}
+		return "! " + strings.Join(e.Anomalies, ",")
+	}},
+	Column[Execution]{Name: "progress", Header: "PROGRESS", Value: func(e Execution, _ TableOptions) string {
+		if e.Progress == nil {
+			return "-"
+		}
+		progress := strconv.FormatFloat(e.Progress.Percent, 'f', -1, 64) + "%"
+		if e.Progress.Message != "" {
+			progress += " " + e.Progress.Message
+		}
+		return progress
+	}},
+	Column[Execution]{Name: "queue_position", Header: "QUEUE POSITION", Value: func(e Execution, _ TableOptions) string {
+		if e.QueuePosition == 0 {
+			return "-"
+		}
+		return strconv.Itoa(e.QueuePosition)
+	}},
+	Column[Execution]{Name: "trigger", Header: "TRIGGER", Value: func(e Execution, _ TableOptions) string { return orDash(e.TriggerType) }},
+	Column[Execution]{Name: "triggered_by", Header: "TRIGGERED BY", Value: func(e Execution, _ TableOptions) string { return orDash(e.TriggeredBy) }},
+	Column[Execution]{Name: "error", Header: "ERROR", Value: func(e Execution, _ TableOptions) string { return orDash(e.ErrorMessage) }},
+)
@@ -0,0 +1,245 @@
+package supervisorctl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of a bulk task operation
+const (
+	TaskActionPause   = "pause"
+	TaskActionResume  = "resume"
+	TaskActionDelete  = "delete"
+	TaskActionExecute = "execute"
+)
+
+// TaskSpec is a scheduled task, as created by supervisorctl task add
+type TaskSpec struct {
+	Name            string                 `json:"name"`
+	AgentID         string                 `json:"agent_id,omitempty"`
+	PipelineID      string                 `json:"pipeline_id,omitempty"`
+	AgentSelector   *AgentSelector         `json:"agent_selector,omitempty"` // --agents or --agent-pattern, runs every selected agent
+	MaxParallel     int                    `json:"max_parallel,omitempty"`   // --max-parallel, 0 runs every selected agent at once
+	SuccessPolicy   string                 `json:"success_policy,omitempty"` // --success-policy: all, any or at_least
+	MinSuccesses    int                    `json:"min_successes,omitempty"`  // --min-successes, for at_least
+	CronExpression  string                 `json:"cron_expression"`
+	Timezone        string                 `json:"timezone,omitempty"` // --timezone, an IANA name such as America/New_York
+	Enabled         bool                   `json:"enabled"`
+	InputParameters map[string]interface{} `json:"input_parameters,omitempty"`
+	InputTemplate   string                 `json:"input_template,omitempty"` // --input-template, e.g. "report for {{yesterday}}"
+	OverlapPolicy   string                 `json:"overlap_policy,omitempty"`
+	Timeout         int                    `json:"timeout,omitempty"` // Seconds
+	MaxRetries      int                    `json:"max_retries,omitempty"`
+	RetryBackoff    int                    `json:"retry_backoff,omitempty"`
+	CatchUpPolicy   string                 `json:"catch_up_policy,omitempty"`
+	MaxCatchUpRuns  int                    `json:"max_catch_up_runs,omitempty"`
+	SkipCalendars   []string               `json:"skip_calendars,omitempty"` // Calendars whose days the task does not run on
+	DeferOnSkip     bool                   `json:"defer_on_skip,omitempty"`  // Run excluded fires after the next fire instead
+	Labels          map[string]string      `json:"labels,omitempty"`
+}
+
+// AgentSelector picks the agents of a fan-out task: the listed agents, or the agents matching
+// Pattern, "prefix:<prefix>" or a glob such as region-*, when the task fires
+type AgentSelector struct {
+	AgentIDs []string `json:"agent_ids,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+}
+
+// Task is a scheduled task as listed by supervisorctl task list
+type Task struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	AgentID        string         `json:"agent_id"`
+	PipelineID     string         `json:"pipeline_id"`
+	AgentSelector  *AgentSelector `json:"agent_selector"` // Set for fan-out tasks
+	CronExpression string         `json:"cron_expression"`
+	Timezone       string         `json:"timezone"` // Empty when the task uses the scheduler's time zone
+	Enabled        bool           `json:"enabled"`
+	Active         bool           `json:"active"` // False while the task is paused
+	SkipCalendars  []string       `json:"skip_calendars,omitempty"`
+	NextRun        *time.Time     `json:"next_run"` // Leaves out the days of the task's calendars
+	LastRun        *time.Time     `json:"last_run"`
+}
+
+// FanOutAgentResult is the outcome of one agent's execution in a fan-out task run
+type FanOutAgentResult struct {
+	AgentID     string `json:"agent_id"`
+	ExecutionID string `json:"execution_id,omitempty"`
+	Status      string `json:"status"`
+	Output      string `json:"output,omitempty"`
+	Error       string `json:"error,omitempty"`
+	RetryCount  int    `json:"retry_count,omitempty"`
+}
+
+// FanOutResult aggregates the executions of a fan-out task run, ordered by agent ID
+type FanOutResult struct {
+	SuccessPolicy string              `json:"success_policy"`
+	MinSuccesses  int                 `json:"min_successes,omitempty"`
+	Matched       int                 `json:"matched"`
+	Succeeded     int                 `json:"succeeded"`
+	Failed        int                 `json:"failed"`
+	Status        string              `json:"status"`
+	Results       []FanOutAgentResult `json:"results"`
+}
+
+// TaskRunResult is the outcome of running a task immediately, as reported by supervisorctl task run
+type TaskRunResult struct {
+	ExecutionID     string        `json:"execution_id"`
+	Status          string        `json:"status"`
+	Output          string        `json:"output"`
+	Error           string        `json:"error,omitempty"`
+	ExecutionTimeMs int64         `json:"execution_time_ms"`
+	TriggerType     string        `json:"trigger_type"`
+	TriggeredBy     string        `json:"triggered_by"`
+	FanOut          *FanOutResult `json:"fan_out,omitempty"` // Set for fan-out tasks
+}
+
+// TaskFireTime is an upcoming run of a task, in the task's time zone and in UTC
+type TaskFireTime struct {
+	Time time.Time `json:"time"`
+	UTC  time.Time `json:"utc"`
+}
+
+// TaskSchedule is the upcoming runs of a task, as shown by supervisorctl task schedule
+type TaskSchedule struct {
+	TaskID         string         `json:"task_id"`
+	CronExpression string         `json:"cron_expression"`
+	Active         bool           `json:"active"`
+	Timezone       string         `json:"timezone"`
+	NextRuns       []TaskFireTime `json:"next_runs"` // Empty while the task is paused
+}
+
+// TaskSelector picks the tasks of a bulk operation, like the --agent and --pattern flags of
+// supervisorctl's task command. Agent and Pattern may be combined; TaskIDs stands alone.
+type TaskSelector struct {
+	AgentID string   `json:"agent_id,omitempty"`
+	Pattern string   `json:"name_pattern,omitempty"` // Glob over task names, such as nightly-*
+	TaskIDs []string `json:"task_ids,omitempty"`
+}
+
+// TaskOperationResult is the outcome of a bulk operation on one task
+type TaskOperationResult struct {
+	TaskID        string `json:"target"`
+	Action        string `json:"action"`
+	CurrentState  string `json:"current_state,omitempty"`
+	ExpectedState string `json:"expected_state,omitempty"`
+	Status        string `json:"status"` // applied, skipped or failed; pending in dry runs
+	Message       string `json:"message,omitempty"`
+}
+
+// BulkTaskResult reports a bulk operation's outcome on each task it selected
+type BulkTaskResult struct {
+	Action    string                `json:"action"`
+	DryRun    bool                  `json:"dry_run,omitempty"`
+	Matched   int                   `json:"matched"`
+	Succeeded int                   `json:"succeeded"`
+	Skipped   int                   `json:"skipped"`
+	Failed    int                   `json:"failed"`
+	Results   []TaskOperationResult `json:"results"`
+}
+
+// BulkTasks applies action to every task the selector picks. Failures on single tasks are reported
+// in the result rather than returned; with dryRun the supervisor only reports what it would do.
+func (c *Client) BulkTasks(ctx context.Context, action string, selector TaskSelector, dryRun bool) (*BulkTaskResult, error) {
+	path := "/tasks/bulk"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+
+	request := struct {
+		Action   string       `json:"action"`
+		Selector TaskSelector `json:"selector"`
+	}{action, selector}
+	var result BulkTaskResult
+	if err := c.doJSON(ctx, http.MethodPost, path, request, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateTask schedules a task and returns its ID
+func (c *Client) CreateTask(ctx context.Context, spec TaskSpec) (string, error) {
+	var response struct {
+		TaskID string `json:"task_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/tasks", spec, &response); err != nil {
+		return "", err
+	}
+	return response.TaskID, nil
+}
+
+// UpdateTask replaces the settings of a task
+func (c *Client) UpdateTask(ctx context.Context, taskID string, spec TaskSpec) error {
+	return c.doJSON(ctx, http.MethodPut, "/tasks/"+url.PathEscape(taskID), spec, &struct{}{})
+}
+
+// RunTask runs a task immediately and waits for it to finish. A fan-out task reports the aggregate
+// of its agents' executions in FanOut.
+func (c *Client) RunTask(ctx context.Context, taskID string) (*TaskRunResult, error) {
+	var response struct {
+		Result TaskRunResult `json:"result"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/tasks/"+url.PathEscape(taskID)+"/execute", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response.Result, nil
+}
+
+// PreviewTaskInput renders the input a run of the task would receive now, without running it
+func (c *Client) PreviewTaskInput(ctx context.Context, taskID string) (string, error) {
+	var response struct {
+		Input string `json:"input"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/tasks/"+url.PathEscape(taskID)+"/preview-input", nil, &response); err != nil {
+		return "", err
+	}
+	return response.Input, nil
+}
+
+// ListTasks returns every scheduled task, ordered by ID
+func (c *Client) ListTasks(ctx context.Context) ([]Task, error) {
+	page, err := c.QueryTasks(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return page.Tasks, nil
+}
+
+// GetTaskSchedule returns the next count runs of a task; count 0 lets the supervisor pick
+func (c *Client) GetTaskSchedule(ctx context.Context, taskID string, count int) (*TaskSchedule, error) {
+	path := "/tasks/" + url.PathEscape(taskID) + "/schedule"
+	if count > 0 {
+		path += "?count=" + strconv.Itoa(count)
+	}
+	var schedule TaskSchedule
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// WriteTaskTable writes tasks as the table supervisorctl task list prints by default, with NEXT RUN
+// shown in loc. TaskColumns.Write prints other columns.
+func WriteTaskTable(w io.Writer, tasks []Task, loc *time.Location) error {
+	return TaskColumns.Write(w, tasks, TableOptions{Location: loc})
+}
+
+// taskTarget names what a task runs: its agent, pipeline:<id>, or agents:<pattern or IDs> for
+// fan-out tasks
+func taskTarget(task Task) string {
+	if selector := task.AgentSelector; selector != nil {
+		if len(selector.AgentIDs) > 0 {
+			return "agents:" + strings.Join(selector.AgentIDs, ",")
+		}
+		return "agents:" + selector.Pattern
+	}
+	if task.PipelineID != "" {
+		return "pipeline:" + task.PipelineID
+	}
+	return task.AgentID
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package supervisorctl
+
+import "os"
+
+// terminalWidth cannot ask the terminal for its width on this platform; only $COLUMNS sets it
+func terminalWidth(f *os.File) int {
+	return 0
+}
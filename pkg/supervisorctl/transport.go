@@ -0,0 +1,114 @@
+package supervisorctl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UnixSocketPrefix starts server URLs naming the supervisor's unix domain socket, as in
+// unix:///var/run/supervisor.sock
+const UnixSocketPrefix = "unix://"
+
+// unixBaseURL is the base of the URLs of requests sent over a unix socket; the socket, not the host,
+// locates the supervisor
+const unixBaseURL = "http://supervisor"
+
+// transportKey identifies the transports clients share
+type transportKey struct {
+	socketPath            string // Empty for TCP
+	responseHeaderTimeout time.Duration
+	tls                   TLSConfig
+}
+
+var (
+	transportMutex sync.Mutex
+	transports     = make(map[transportKey]*http.Transport)
+)
+
+// NewHTTPClient returns an HTTP client of the supervisor at serverURL that waits at most
+// responseHeaderTimeout for responses to start, 0 waiting indefinitely. Clients of the same server
+// share a transport, so repeated commands reuse its idle connections. For a unix:// URL the
+// transport dials the socket; send the client's requests to the base URL of requestBaseURL.
+func NewHTTPClient(serverURL string, responseHeaderTimeout time.Duration) *http.Client {
+	// Without TLS settings there is no CA file that could fail to load
+	client, _ := NewTLSHTTPClient(serverURL, responseHeaderTimeout, TLSConfig{})
+	return client
+}
+
+// NewTLSHTTPClient is NewHTTPClient verifying https:// supervisors as tlsConfig sets, failing when
+// its CA file cannot be loaded
+func NewTLSHTTPClient(serverURL string, responseHeaderTimeout time.Duration, tlsConfig TLSConfig) (*http.Client, error) {
+	key := transportKey{responseHeaderTimeout: responseHeaderTimeout, tls: tlsConfig}
+	if path, ok := unixSocketPath(serverURL); ok {
+		key.socketPath = path
+	}
+
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	transport, ok := transports[key]
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = responseHeaderTimeout
+		if tlsConfig != (TLSConfig{}) {
+			clientConfig, err := newTLSClientConfig(tlsConfig)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = clientConfig
+		}
+		if key.socketPath != "" {
+			var dialer net.Dialer
+			transport.Proxy = nil
+			transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", key.socketPath)
+			}
+		}
+		transports[key] = transport
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// newTLSClientConfig returns the TLS config of a transport: the system's roots plus the CA file's
+// certificates
+func newTLSClientConfig(tlsConfig TLSConfig) (*tls.Config, error) {
+	clientConfig := &tls.Config{InsecureSkipVerify: tlsConfig.InsecureSkipVerify}
+	if tlsConfig.CAFile == "" {
+		return clientConfig, nil
+	}
+	pem, err := os.ReadFile(tlsConfig.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA file %s holds no PEM certificates", tlsConfig.CAFile)
+	}
+	clientConfig.RootCAs = roots
+	return clientConfig, nil
+}
+
+// unixSocketPath returns the socket path of a unix:// server URL
+func unixSocketPath(serverURL string) (string, bool) {
+	path, ok := strings.CutPrefix(serverURL, UnixSocketPrefix)
+	return path, ok && path != ""
+}
+
+// requestBaseURL returns the base URL requests to the supervisor at serverURL are sent to: the URL
+// itself, or a placeholder host for unix:// URLs
+func requestBaseURL(serverURL string) string {
+	if _, ok := unixSocketPath(serverURL); ok {
+		return unixBaseURL
+	}
+	return strings.TrimRight(serverURL, "/")
+}
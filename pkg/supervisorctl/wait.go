@@ -0,0 +1,183 @@
+package supervisorctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultWaitPollInterval is how often WaitAgent and WaitExecution poll when WaitOptions sets no interval
+const DefaultWaitPollInterval = time.Second
+
+// Errors of WaitAgent and WaitExecution
+var (
+	ErrWaitTimeout     = errors.New("timed out waiting")               // The target did not reach the awaited state in time
+	ErrTerminalFailure = errors.New("target ended in a failure state") // The target can no longer reach the awaited state
+)
+
+// WaitOptions controls WaitAgent and WaitExecution, like supervisorctl wait's --timeout flag
+type WaitOptions struct {
+	Timeout      time.Duration // Give up after this long, 0 waits until ctx ends
+	PollInterval time.Duration // DefaultWaitPollInterval when 0
+}
+
+// AgentStatus is the runtime status of an agent
+type AgentStatus struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Status      string         `json:"status"` // idle, running, disabled or error
+	Health      string         `json:"health"`
+	LastRun     *time.Time     `json:"last_run"`
+	NextRun     *time.Time     `json:"next_run"`
+	ActiveTasks int            `json:"active_tasks"`
+	Process     *ProcessStatus `json:"process,omitempty"` // Set for persistent agents
+}
+
+// ProcessStatus is the state of a persistent agent's process: starting, running, degraded, exited,
+// stopped, backoff or fatal, with its failed starts in a row
+type ProcessStatus struct {
+	State               string       `json:"state"`
+	PID                 int          `json:"pid,omitempty"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	BackoffUntil        *time.Time   `json:"backoff_until,omitempty"`
+	LastError           string       `json:"last_error,omitempty"`
+	StartedAt           *time.Time   `json:"started_at,omitempty"` // Set while the process is starting or running
+	Restarts            int          `json:"restarts"`
+	Hooks               []HookResult `json:"hooks,omitempty"` // Latest run of each lifecycle hook
+}
+
+// HookResult is a run of a persistent agent's post_start or pre_stop hook
+type HookResult struct {
+	Hook       string    `json:"hook"`
+	PID        int       `json:"pid,omitempty"`
+	Success    bool      `json:"success"`
+	Policy     string    `json:"policy"`
+	ExitCode   int       `json:"exit_code,omitempty"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// GetAgentStatus returns the runtime status of an agent
+func (c *Client) GetAgentStatus(ctx context.Context, agentID string) (*AgentStatus, error) {
+	var status AgentStatus
+	if err := c.doJSON(ctx, http.MethodGet, agentStatusPath(agentID), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// agentStatusPath returns the path of an agent's status
+func agentStatusPath(agentID string) string {
+	return "/api/v1/agents/" + url.PathEscape(agentID) + "/status"
+}
+
+// WaitAgent polls an agent until its status is state, compared case-insensitively, like
+// supervisorctl wait agent <name> --state RUNNING. It fails with ErrTerminalFailure when the agent
+// enters the error status instead and with ErrWaitTimeout when the timeout passes; both return the
+// last status seen, which --format json prints. Supervisors sending status ETags hold each poll
+// until the status changes, so a transition is seen as it happens rather than at the next poll.
+func (c *Client) WaitAgent(ctx context.Context, agentID, state string, options WaitOptions) (*AgentStatus, error) {
+	var last *AgentStatus
+	var etag string
+	err := c.poll(ctx, options, func(ctx context.Context) (bool, error) {
+		var wait time.Duration
+		if etag != "" {
+			wait = DefaultStatusWait
+		}
+		var status AgentStatus
+		newETag, modified, err := c.getStatus(ctx, agentStatusPath(agentID), etag, wait, &status)
+		if err != nil {
+			return false, err
+		}
+		etag = newETag
+		if !modified {
+			return false, nil
+		}
+		last = &status
+
+		switch {
+		case strings.EqualFold(status.Status, state):
+			return true, nil
+		case status.Status == "error":
+			return false, fmt.Errorf("agent %s: %w", agentID, ErrTerminalFailure)
+		}
+		return false, nil
+	})
+	return last, err
+}
+
+// WaitExecution polls an execution until it finishes, like supervisorctl wait execution <id>. It
+// fails with ErrTerminalFailure when the execution failed, timed out or was cancelled and with
+// ErrWaitTimeout when the timeout passes; both return the last state seen.
+func (c *Client) WaitExecution(ctx context.Context, executionID string, options WaitOptions) (*Execution, error) {
+	var last *Execution
+	err := c.poll(ctx, options, func(ctx context.Context) (bool, error) {
+		execution, err := c.GetExecution(ctx, executionID)
+		if err != nil {
+			return false, err
+		}
+		last = execution
+
+		switch execution.State {
+		case "completed":
+			return true, nil
+		case "failed", "timeout", "cancelled":
+			return false, fmt.Errorf("execution %s %s: %w", executionID, execution.State, ErrTerminalFailure)
+		}
+		return false, nil
+	})
+	return last, err
+}
+
+// poll calls check every poll interval until it reports done or fails, or the wait times out
+func (c *Client) poll(ctx context.Context, options WaitOptions, check func(context.Context) (bool, error)) error {
+	interval := options.PollInterval
+	if interval <= 0 {
+		interval = DefaultWaitPollInterval
+	}
+	waitCtx := ctx
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	// A request cut short by the timeout is reported as the timeout, not as a failed request
+	timedOut := func() error {
+		if ctx.Err() == nil && waitCtx.Err() != nil {
+			return fmt.Errorf("%w after %s", ErrWaitTimeout, options.Timeout)
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		done, err := check(waitCtx)
+		if err != nil {
+			if timeoutErr := timedOut(); timeoutErr != nil && !errors.Is(err, ErrTerminalFailure) {
+				return timeoutErr
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-waitCtx.Done():
+			if timeoutErr := timedOut(); timeoutErr != nil {
+				return timeoutErr
+			}
+			return ctx.Err()
+		}
+	}
+}
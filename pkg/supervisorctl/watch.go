@@ -0,0 +1,131 @@
+package supervisorctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DefaultStatusWait is how long WaitAgent and WatchStatus ask the supervisor to hold a status
+// request for a change
+const DefaultStatusWait = 30 * time.Second
+
+// AgentStatuses is the runtime status of every agent, with the ETag identifying it
+type AgentStatuses struct {
+	Agents []AgentStatus `json:"agents"`
+	ETag   string        `json:"-"`
+}
+
+// GetAgentStatuses returns the runtime status of every agent. Given the ETag of statuses returned
+// before, the supervisor holds the request for up to wait until they change; it returns nil when
+// they did not.
+func (c *Client) GetAgentStatuses(ctx context.Context, etag string, wait time.Duration) (*AgentStatuses, error) {
+	var statuses AgentStatuses
+	newETag, modified, err := c.getStatus(ctx, "/api/v1/agents/status", etag, wait, &statuses)
+	if err != nil || !modified {
+		return nil, err
+	}
+	statuses.ETag = newETag
+	return &statuses, nil
+}
+
+// WatchStatus calls render with the runtime status of a target, as Status returns it, then again
+// whenever it changes, until ctx ends or render fails, like supervisorctl status --watch. An empty
+// target watches every agent. Changes are long-polled for where the supervisor sends ETags;
+// otherwise the status is polled every pollInterval, DefaultWaitPollInterval when 0.
+func (c *Client) WatchStatus(ctx context.Context, target string, pollInterval time.Duration, render func([]AgentStatus) error) error {
+	if pollInterval <= 0 {
+		pollInterval = DefaultWaitPollInterval
+	}
+
+	var etag string
+	var last []AgentStatus
+	for rendered := false; ; {
+		var wait time.Duration
+		if etag != "" {
+			wait = DefaultStatusWait
+		}
+		statuses, newETag, modified, err := c.targetStatus(ctx, target, etag, wait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if modified && (!rendered || !reflect.DeepEqual(statuses, last)) {
+			if err := render(statuses); err != nil {
+				return err
+			}
+			rendered, last = true, statuses
+		}
+
+		// Without an ETag the supervisor cannot hold the request, so wait before asking again
+		if etag = newETag; etag == "" {
+			select {
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// targetStatus gets the status of a target like Status, conditionally on etag like getStatus
+func (c *Client) targetStatus(ctx context.Context, target, etag string, wait time.Duration) ([]AgentStatus, string, bool, error) {
+	var list struct {
+		Agents []AgentStatus `json:"agents"`
+	}
+	var single AgentStatus
+	var path string
+	var response interface{} = &list
+	switch group, ok := strings.CutPrefix(target, GroupTargetPrefix); {
+	case ok:
+		path = "/api/v1/groups/" + url.PathEscape(group) + "/status"
+	case target == "":
+		path = "/api/v1/agents/status"
+	default:
+		path, response = agentStatusPath(target), &single
+	}
+
+	etag, modified, err := c.getStatus(ctx, path, etag, wait, response)
+	if err != nil || !modified {
+		return nil, etag, modified, err
+	}
+	if response == &single {
+		return []AgentStatus{single}, etag, true, nil
+	}
+	return list.Agents, etag, true, nil
+}
+
+// getStatus gets a status from path into response and returns its ETag. Given the ETag of the
+// status seen before, the supervisor holds the request for up to wait until the status changes and
+// answers 304 when it did not, which getStatus reports as unmodified.
+func (c *Client) getStatus(ctx context.Context, path, etag string, wait time.Duration, response interface{}) (string, bool, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+		if wait > 0 {
+			path += "?wait=" + url.QueryEscape(wait.String())
+		}
+	}
+	httpResponse, err := c.send(ctx, http.MethodGet, path, nil, header)
+	if err != nil {
+		return "", false, err
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode == http.StatusNotModified {
+		return etag, false, nil
+	}
+	if err := json.NewDecoder(httpResponse.Body).Decode(response); err != nil {
+		return "", false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	// Reading the body to its end lets the connection be reused
+	io.Copy(io.Discard, httpResponse.Body)
+	return httpResponse.Header.Get("ETag"), true, nil
+}
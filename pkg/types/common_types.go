@@ -21,12 +21,33 @@ type ExecutionStatus string
 const (
 	// SuccessStatus execution completed successfully
 	SuccessStatus ExecutionStatus = "success"
+	// WarningStatus execution completed, but its agent exited with a code mapped to a warning
+	WarningStatus ExecutionStatus = "warning"
 	// FailureStatus execution failed due to an error
 	FailureStatus ExecutionStatus = "failure"
 	// TimeoutStatus execution exceeded timeout limit
 	TimeoutStatus ExecutionStatus = "timeout"
 	// CancelledStatus execution was cancelled externally
 	CancelledStatus ExecutionStatus = "cancelled"
+	// SkippedStatus execution was not started, e.g. due to a scheduling overlap
+	SkippedStatus ExecutionStatus = "skipped"
+)
+
+// Succeeded reports whether the execution completed without failing, with or without a warning
+func (s ExecutionStatus) Succeeded() bool {
+	return s == SuccessStatus || s == WarningStatus
+}
+
+// OverlapPolicy defines what happens when a scheduled task fires while a previous run is still in flight
+type OverlapPolicy string
+
+const (
+	// OverlapPolicySkip drops the new run and records it as skipped
+	OverlapPolicySkip OverlapPolicy = "skip"
+	// OverlapPolicyQueue defers the new run until the current one completes
+	OverlapPolicyQueue OverlapPolicy = "queue"
+	// OverlapPolicyAllow starts the new run concurrently
+	OverlapPolicyAllow OverlapPolicy = "allow"
 )
 
 // ResourceType represents the type of resource being managed
@@ -57,6 +78,23 @@ const (
 	TaskTriggerTypeManual    TaskTriggerType = "manual"
 	TaskTriggerTypeAPI       TaskTriggerType = "api"
 	TaskTriggerTypeEvent     TaskTriggerType = "event"
+	TaskTriggerTypeCatchUp   TaskTriggerType = "catch_up"
+	TaskTriggerTypeDeferred  TaskTriggerType = "deferred" // A run deferred past a calendar exclusion
+	TaskTriggerTypeJSONRPC   TaskTriggerType = "jsonrpc"
+	TaskTriggerTypeGRPC      TaskTriggerType = "grpc"
+	TaskTriggerTypeA2A       TaskTriggerType = "a2a"
+)
+
+// CatchUpPolicy defines how a scheduled task handles fire times missed while the supervisor was down
+type CatchUpPolicy string
+
+const (
+	// CatchUpPolicyNone drops missed runs
+	CatchUpPolicyNone CatchUpPolicy = "none"
+	// CatchUpPolicyRunOnce runs the task once if any runs were missed
+	CatchUpPolicyRunOnce CatchUpPolicy = "run_once"
+	// CatchUpPolicyRunAll runs every missed fire time, up to the task's cap
+	CatchUpPolicyRunAll CatchUpPolicy = "run_all"
 )
 
 // AgentAccessType defines whether an agent performs read-only or read-write operations
@@ -70,7 +108,7 @@ const (
 	ReadWriteAccessType AgentAccessType = "read-write"
 )
 
-// AgentMode defines whether an agent operates in task mode or interactive mode
+// AgentMode defines whether an agent operates in task, interactive or persistent mode
 type AgentMode string
 
 const (
@@ -79,6 +117,9 @@ const (
 	
 	// InteractiveMode: Agent runs in interactive mode - persistent session allowing multiple exchanges
 	InteractiveMode AgentMode = "interactive"
+
+	// PersistentMode: JSON-RPC agent kept running, serving every execution as a call over its stdin
+	PersistentMode AgentMode = "persistent"
 )
 
 // InputPattern defines how the agent accepts input
@@ -110,6 +151,9 @@ const (
 
 	// JsonRpcPatternOut: Agent returns output via JSON-RPC over stdin/stdout
 	JsonRpcPatternOut OutputPattern = "json-rpc"
+
+	// JsonPatternOut: Agent prints a JSON document on stdout; OutputSelector picks the output from it
+	JsonPatternOut OutputPattern = "json"
 )
 
 // AgentState represents the lifecycle state of an agent execution
@@ -119,6 +163,9 @@ const (
 	// IdleState: Agent is not currently executing
 	IdleState AgentState = "idle"
 
+	// QueuedState: Execution is waiting behind another execution of its read-write agent
+	QueuedState AgentState = "queued"
+
 	// StartingState: Agent is being initialized for execution
 	StartingState AgentState = "starting"
 
@@ -156,6 +203,15 @@ const (
 	
 	// SystemError: Errors from the algonius-supervisor system
 	SystemError ErrorCategory = "system"
+
+	// ResourceLimit: The agent exceeded its memory or CPU time limit
+	ResourceLimit ErrorCategory = "resource_limit"
+
+	// Hung: The watchdog stopped an agent that went silent for longer than its max silence
+	Hung ErrorCategory = "hung"
+
+	// InputFetchError: The input URL of the execution could not be fetched, so the agent never ran
+	InputFetchError ErrorCategory = "input_fetch"
 )
 
 // A2ATransportProtocol defines the protocol used for A2A communication
@@ -0,0 +1,62 @@
+package types
+
+import "fmt"
+
+// InputPatterns lists every input pattern, in the order of the compatibility matrix
+var InputPatterns = []InputPattern{StdinPattern, FilePattern, ArgsPattern, JsonRpcPattern}
+
+// OutputPatterns lists every output pattern, in the order of the compatibility matrix
+var OutputPatterns = []OutputPattern{StdoutPattern, FilePatternOut, JsonRpcPatternOut, JsonPatternOut}
+
+// PatternCompatibility tells whether an agent may combine an input pattern with an output pattern,
+// and why not when it may not
+type PatternCompatibility struct {
+	InputPattern  InputPattern  `json:"input_pattern"`
+	OutputPattern OutputPattern `json:"output_pattern"`
+	Compatible    bool          `json:"compatible"`
+	Reason        string        `json:"reason,omitempty"`
+}
+
+// patternPair is a cell of the compatibility matrix
+type patternPair struct {
+	input  InputPattern
+	output OutputPattern
+}
+
+// nonJSONRPCInputReason explains why only JSON-RPC requests get JSON-RPC responses
+const nonJSONRPCInputReason = "the json-rpc output pattern expects a JSON-RPC response, which an agent only sends in answer to a JSON-RPC request; use the json-rpc input pattern, or the stdout or json output pattern"
+
+// incompatiblePatterns holds the cells of the compatibility matrix an agent may not use, with the
+// reason; every other combination of known patterns is compatible
+var incompatiblePatterns = map[patternPair]string{
+	{StdinPattern, JsonRpcPatternOut}: nonJSONRPCInputReason,
+	{FilePattern, JsonRpcPatternOut}:  nonJSONRPCInputReason,
+	{ArgsPattern, JsonRpcPatternOut}:  nonJSONRPCInputReason,
+	{JsonRpcPattern, StdoutPattern}:   "the json-rpc input pattern reads stdout as a JSON-RPC response rather than plain output; use the json-rpc output pattern, or json to select the output from the response",
+}
+
+// PatternMatrix returns every combination of input and output pattern, input pattern first
+func PatternMatrix() []PatternCompatibility {
+	matrix := make([]PatternCompatibility, 0, len(InputPatterns)*len(OutputPatterns))
+	for _, input := range InputPatterns {
+		for _, output := range OutputPatterns {
+			reason, incompatible := incompatiblePatterns[patternPair{input, output}]
+			matrix = append(matrix, PatternCompatibility{
+				InputPattern:  input,
+				OutputPattern: output,
+				Compatible:    !incompatible,
+				Reason:        reason,
+			})
+		}
+	}
+	return matrix
+}
+
+// CheckPatternCompatibility returns an error with the reason when an agent may not combine input with
+// output. Unknown and empty patterns are left to the validation of each pattern.
+func CheckPatternCompatibility(input InputPattern, output OutputPattern) error {
+	if reason, incompatible := incompatiblePatterns[patternPair{input, output}]; incompatible {
+		return fmt.Errorf("input pattern '%s' is incompatible with output pattern '%s': %s", input, output, reason)
+	}
+	return nil
+}
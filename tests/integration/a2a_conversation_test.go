@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// conversationAgent returns a JSON-RPC-pattern agent replying with how many prior exchanges its
+// conversation history held
+func conversationAgent(t *testing.T, id string) *models.AgentConfiguration {
+	agent := scriptAgent(t, id, models.ReadOnlyAccessType, `cat > /dev/null
+seen=$(printf '%s' "$SUPERVISOR_CONVERSATION_HISTORY" | grep -o '"execution_id"' | wc -l | tr -d ' ')
+printf '{"jsonrpc":"2.0","id":1,"result":"seen %s"}' "$seen"
+`)
+	agent.InputPattern = models.JsonRpcPattern
+	agent.OutputPattern = models.JsonRpcPatternOut
+	return agent
+}
+
+// newConversationRouter serves JSON-RPC and the conversation route over a shared conversation store
+func newConversationRouter(t *testing.T, agents ...*models.AgentConfiguration) (*gin.Engine, *services.ExecutionService, *services.ConversationStore) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	store := services.NewConversationStore(time.Hour)
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+
+	router := gin.New()
+	jsonrpcHandlers := handlers.NewJSONRPCHandlers(agentService, services.NewExecutionCoordinator(agentService, executionService, logger), logger, a2aConfig)
+	jsonrpcHandlers.SetConversationStore(store)
+	jsonrpcHandlers.RegisterJSONRPCRoutes(router)
+	handlers.NewConversationHandlers(store, logger).RegisterConversationRoutes(router.Group("/api/v1"))
+	return router, executionService, store
+}
+
+// sendConversationMessage runs agentID through JSON-RPC as a message of the conversation
+func sendConversationMessage(t *testing.T, router *gin.Engine, agentID, conversationID, messageID, input string) map[string]interface{} {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "execute-agent",
+		"id":      1,
+		"params": map[string]interface{}{
+			"agent_id":        agentID,
+			"input":           input,
+			"conversation_id": conversationID,
+			"message_id":      messageID,
+		},
+	})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Nil(t, response["error"], recorder.Body.String())
+	return response["result"].(map[string]interface{})
+}
+
+func TestA2AConversationThreading(t *testing.T) {
+	router, executionService, _ := newConversationRouter(t, conversationAgent(t, "chat-agent"))
+
+	// Each message is given the exchanges before it
+	var executionIDs []string
+	for i, input := range []string{"hello", "what did I say?", "and before that?"} {
+		result := sendConversationMessage(t, router, "chat-agent", "conv-1", "msg-"+string(rune('a'+i)), input)
+		assert.Equal(t, "conv-1", result["conversation_id"])
+		assert.Contains(t, result["output"], "seen "+string(rune('0'+i)))
+		executionIDs = append(executionIDs, result["execution_id"].(string))
+	}
+
+	// The third execution recorded the history it ran with, so it can be replayed
+	execution, err := executionService.GetExecution(executionIDs[2])
+	require.NoError(t, err)
+	require.NotNil(t, execution.Inputs)
+	history, ok := execution.Inputs.Parameters[models.ConversationHistoryParameter].([]models.ConversationExchange)
+	require.True(t, ok, "%#v", execution.Inputs.Parameters)
+	require.Len(t, history, 2)
+	assert.Equal(t, executionIDs[0], history[0].ExecutionID)
+	assert.Equal(t, "msg-a", history[0].MessageID)
+	assert.Equal(t, "hello", history[0].Input)
+	assert.Contains(t, history[0].Output, "seen 0")
+	assert.Equal(t, executionIDs[1], history[1].ExecutionID)
+
+	// The whole thread is served in order with its executions
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/conversations/conv-1", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var conversation handlers.ConversationResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &conversation))
+	assert.Equal(t, executionIDs, conversation.ExecutionIDs)
+	require.Len(t, conversation.Exchanges, 3)
+	assert.Equal(t, "and before that?", conversation.Exchanges[2].Input)
+	assert.Contains(t, conversation.Exchanges[2].Output, "seen 2")
+
+	// Another conversation starts with no history
+	result := sendConversationMessage(t, router, "chat-agent", "conv-2", "msg-z", "hi")
+	assert.Contains(t, result["output"], "seen 0")
+}
+
+func TestA2AConversationExpiresWhenIdle(t *testing.T) {
+	router, _, store := newConversationRouter(t, conversationAgent(t, "idle-agent"))
+	var mutex sync.Mutex
+	now := time.Now()
+	store.SetClock(func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	})
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+	}
+
+	sendConversationMessage(t, router, "idle-agent", "conv-idle", "", "one")
+	advance(50 * time.Minute)
+	result := sendConversationMessage(t, router, "idle-agent", "conv-idle", "", "two")
+	assert.Contains(t, result["output"], "seen 1", "a message keeps the conversation alive")
+
+	// Past the idle TTL the thread is gone, and a new message starts it afresh
+	advance(61 * time.Minute)
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/conversations/conv-idle", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &envelope))
+	assert.Equal(t, string(api.CodeConversationNotFound), envelope["code"])
+
+	result = sendConversationMessage(t, router, "idle-agent", "conv-idle", "", "three")
+	assert.Contains(t, result["output"], "seen 0")
+}
@@ -0,0 +1,138 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	protocol "github.com/algonius/algonius-supervisor/pkg/a2a"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// callJSONRPC posts a JSON-RPC request to the fixture and returns the decoded response
+func callJSONRPC(t *testing.T, f *pipelineFixture, method string, params interface{}) handlers.JSONRPCResponse {
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "id": 1, "params": params})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body))
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response handlers.JSONRPCResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+func TestA2ANegotiateJSONRPC(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	response := callJSONRPC(t, f, "negotiate", map[string]interface{}{})
+	require.Nil(t, response.Error)
+	raw, err := json.Marshal(response.Result)
+	require.NoError(t, err)
+	var negotiation a2a.Negotiation
+	require.NoError(t, json.Unmarshal(raw, &negotiation))
+
+	config := a2a.DefaultA2AConfig()
+	assert.Equal(t, []string{config.Protocol.Version}, negotiation.ProtocolVersions)
+	assert.Equal(t, config.Protocol.Version, negotiation.PreferredVersion)
+	assert.Contains(t, negotiation.Methods, "negotiate")
+	assert.Contains(t, negotiation.Methods, "execute-agent")
+	assert.Equal(t, config.Protocol.MaxMessageSize, negotiation.MaxMessageSize)
+	assert.ElementsMatch(t, []string{"http_json", "grpc", "json_rpc"}, negotiation.Transports)
+	assert.Empty(t, negotiation.AuthSchemes, "the fixture requires no authentication")
+}
+
+func TestA2ANegotiateGRPC(t *testing.T) {
+	f := newTriggerFixture(t)
+	config := a2a.DefaultA2AConfig()
+	config.Protocol.SupportedVersions = []string{"0.2.0", "0.3.0"}
+	config.Protocol.Streaming = true
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, f.executionService, nil, zap.NewNop(), config)
+
+	response, err := grpcHandlers.Negotiate(context.Background(), &handlers.A2ANegotiateRequest{})
+	require.NoError(t, err)
+	negotiation := response.Negotiation
+	assert.Equal(t, []string{"0.2.0", "0.3.0"}, negotiation.ProtocolVersions)
+	assert.Equal(t, "0.3.0", negotiation.PreferredVersion)
+	assert.Contains(t, negotiation.Methods, "SendMessage")
+	assert.True(t, negotiation.Streaming)
+	assert.Equal(t, []a2a.AuthScheme{{Scheme: "bearer", Header: "Authorization"}}, negotiation.AuthSchemes)
+}
+
+func TestA2AContractAcceptsFutureFields(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	// A newer patch release may add optional fields the supervisor does not know
+	response := callJSONRPC(t, f, "execute-agent", map[string]interface{}{
+		"protocol_version": "0.3.7",
+		"agent_id":         "trigger-agent",
+		"input":            "hi",
+		"priority_hint":    "low",
+		"tracing":          map[string]interface{}{"span": "abc"},
+	})
+	require.Nil(t, response.Error)
+	assert.Equal(t, "hi\n", response.Result.(map[string]interface{})["output"])
+
+	message, err := protocol.DecodeMessage([]byte(`{
+		"protocol": "a2a", "protocol_version": "0.3.7", "id": "m-1", "type": "request",
+		"timestamp": "2025-11-20T10:30:00Z", "context": {"from": "a", "to": "b", "trace_parent": "00-abc"},
+		"payload": {"method": "greet", "params": {}, "attachments": []}, "signature": "sig"
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "0.3.7", message.ProtocolVersion)
+	assert.NoError(t, a2a.DefaultA2AConfig().CheckProtocolVersion(message.ProtocolVersion))
+}
+
+func TestA2AContractRejectsMissingRequiredFields(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	response := callJSONRPC(t, f, "execute-agent", map[string]interface{}{"agent_id": "trigger-agent"})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, protocol.InvalidParams, response.Error.Code)
+	assert.Equal(t, map[string]interface{}{"field": "input", "reason": "required"}, response.Error.Data)
+
+	_, err := protocol.DecodeMessage([]byte(`{"id": "m-1", "type": "request", "payload": {"params": {}}}`))
+	a2aErr, ok := protocol.AsA2AError(err)
+	require.True(t, ok)
+	assert.Equal(t, protocol.InvalidParams, a2aErr.Code)
+	assert.Equal(t, protocol.FieldError{Field: "payload.method", Reason: "required"}, a2aErr.Data)
+
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, f.executionService, nil, zap.NewNop(), a2a.DefaultA2AConfig())
+	_, err = grpcHandlers.SendMessage(context.Background(), &handlers.A2AMessageSendRequest{
+		AgentId: "trigger-agent",
+		Message: &handlers.A2AMessage{Id: "message-1"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "message.context")
+}
+
+func TestA2AContractRejectsUnsupportedVersion(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	response := callJSONRPC(t, f, "execute-agent", map[string]interface{}{
+		"protocol_version": "1.0.0",
+		"agent_id":         "trigger-agent",
+		"input":            "hi",
+	})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, protocol.UnsupportedProtocolVersionError, response.Error.Code)
+	assert.Equal(t, map[string]interface{}{"requested": "1.0.0", "supported": []interface{}{"0.3.0"}}, response.Error.Data)
+	assert.Empty(t, listTriggered(t, f, "agent_id=trigger-agent"), "the agent never runs")
+
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, f.executionService, nil, zap.NewNop(), a2a.DefaultA2AConfig())
+	_, err := grpcHandlers.SendMessage(context.Background(), &handlers.A2AMessageSendRequest{
+		AgentId: "trigger-agent",
+		Message: &handlers.A2AMessage{Id: "message-1", ProtocolVersion: "0.4.0", Context: &handlers.A2AContext{From: "client"}},
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,246 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// lockedBuffer is a buffer the attach client writes to while the test reads it
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// attachResult is what a client's Attach call returned
+type attachResult struct {
+	stdin  *io.PipeWriter
+	stdout *lockedBuffer
+	done   chan error
+}
+
+// attach attaches a client to an agent in the background, the test typing on the returned stdin
+func attach(client *supervisorctl.Client, agentID string) *attachResult {
+	stdin, stdinWriter := io.Pipe()
+	result := &attachResult{stdin: stdinWriter, stdout: &lockedBuffer{}, done: make(chan error, 1)}
+	go func() {
+		result.done <- client.Attach(context.Background(), agentID, stdin, result.stdout, io.Discard, supervisorctl.AttachOptions{})
+	}()
+	return result
+}
+
+// wait returns the error Attach returned
+func (a *attachResult) wait(t *testing.T) error {
+	select {
+	case err := <-a.done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("attach did not return")
+		return nil
+	}
+}
+
+func TestAttachToPersistentAgent(t *testing.T) {
+	catPath, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat is not available")
+	}
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	fixture := newPersistentFixture(t)
+
+	// cat echoes what it reads, JSON-RPC pings included, so it makes a healthy persistent agent
+	logfile := filepath.Join(t.TempDir(), "cat.log")
+	config := validationAgent("cat-agent", "")
+	config.ExecutablePath = catPath
+	config.Mode = models.PersistentMode
+	config.InputPattern = models.JsonRpcPattern
+	config.OutputPattern = models.JsonRpcPatternOut
+	config.AccessType = types.ReadWriteAccessType
+	config.StdoutLogfile = logfile
+	require.NoError(t, fixture.agentService.RegisterAgent(config))
+	t.Cleanup(func() { agents.StopPersistentProcess("cat-agent") })
+
+	router := gin.New()
+	router.Use(middleware.NewAuthorizer(middleware.AuthorizationConfig{Enabled: true, Tokens: authorizationTokens},
+		handlers.RoutePermissions(), logger).Middleware())
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     fixture.executionService,
+		ExecutionCoordinator: fixture.coordinator,
+		AgentService:         fixture.agentService,
+		Logger:               logger,
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := func(token string) *supervisorctl.Client {
+		client := supervisorctl.NewClient(server.URL)
+		client.SetToken(token)
+		return client
+	}
+
+	// Only running persistent agents can be attached to
+	var apiErr *supervisorctl.APIError
+	err = client("operator-token").Attach(context.Background(), "cat-agent", &bytes.Buffer{}, io.Discard, io.Discard, supervisorctl.AttachOptions{})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, "INVALID_STATE_TRANSITION", apiErr.Code)
+
+	status, err := fixture.coordinator.StartAgent("cat-agent", false)
+	require.NoError(t, err)
+	pid := status.PID
+
+	// Attaching needs the operator role
+	err = client("viewer-token").Attach(context.Background(), "cat-agent", &bytes.Buffer{}, io.Discard, io.Discard, supervisorctl.AttachOptions{})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+
+	// Typed bytes echo back through the stream, and still reach the log
+	session := attach(client("operator-token"), "cat-agent")
+	_, err = session.stdin.Write([]byte("hello from the terminal\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return bytes.Contains([]byte(session.stdout.String()), []byte("hello from the terminal\n"))
+	}, 10*time.Second, 20*time.Millisecond)
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(logfile)
+		return bytes.Contains(data, []byte("hello from the terminal\n"))
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// A second session is refused while the first is attached
+	err = client("operator-token").Attach(context.Background(), "cat-agent", &bytes.Buffer{}, io.Discard, io.Discard, supervisorctl.AttachOptions{})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, "ATTACH_CONFLICT", apiErr.Code)
+
+	// Ctrl-] detaches without stopping the process
+	_, err = session.stdin.Write([]byte("\x1d"))
+	require.NoError(t, err)
+	require.NoError(t, session.wait(t))
+	current, ok := agents.PersistentProcessStatus("cat-agent")
+	require.True(t, ok)
+	assert.Equal(t, pid, current.PID)
+
+	// A new session can attach once the old one is released
+	var second *attachResult
+	require.Eventually(t, func() bool {
+		second = attach(client("operator-token"), "cat-agent")
+		select {
+		case <-second.done:
+			return false // Refused while the server was still releasing the first session
+		case <-time.After(200 * time.Millisecond):
+			return true
+		}
+	}, 10*time.Second, 50*time.Millisecond)
+	_, err = second.stdin.Write([]byte("again\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return bytes.Contains([]byte(second.stdout.String()), []byte("again\n"))
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// Stopping the process ends the session
+	agents.StopPersistentProcess("cat-agent")
+	err = second.wait(t)
+	assert.True(t, errors.Is(err, supervisorctl.ErrAttachedProcessExited), "%v", err)
+}
+
+func TestAttachRejectsForeignOrigins(t *testing.T) {
+	catPath, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat is not available")
+	}
+	gin.SetMode(gin.TestMode)
+	fixture := newPersistentFixture(t)
+	config := validationAgent("origin-agent", "")
+	config.ExecutablePath = catPath
+	config.Mode = models.PersistentMode
+	config.InputPattern = models.JsonRpcPattern
+	config.OutputPattern = models.JsonRpcPatternOut
+	require.NoError(t, fixture.agentService.RegisterAgent(config))
+	t.Cleanup(func() { agents.StopPersistentProcess("origin-agent") })
+	_, err = fixture.coordinator.StartAgent("origin-agent", false)
+	require.NoError(t, err)
+
+	// Auth is disabled, so the origin is all that keeps other sites out
+	cors := middleware.NewCORS(middleware.CORSConfig{AllowedOrigins: []string{"https://console.example.com", "*"}})
+	router := gin.New()
+	router.Use(cors.Middleware("/api/v1"))
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     fixture.executionService,
+		ExecutionCoordinator: fixture.coordinator,
+		AgentService:         fixture.agentService,
+		CORS:                 cors,
+		Logger:               zap.NewNop(),
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	location := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/agents/origin-agent/attach"
+
+	upgrade := func(origin string) int {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/agents/origin-agent/attach", nil)
+		require.NoError(t, err)
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Origin", origin)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// An origin only the wildcard allows is rejected before a session is attached
+	assert.Equal(t, http.StatusForbidden, upgrade("https://evil.example.com"))
+	evilConfig, err := websocket.NewConfig(location, "https://evil.example.com")
+	require.NoError(t, err)
+	_, err = websocket.DialConfig(evilConfig)
+	assert.Error(t, err)
+
+	// Listed origins and the supervisor's own may attach
+	for _, origin := range []string{"https://console.example.com", server.URL} {
+		wsConfig, err := websocket.NewConfig(location, origin)
+		require.NoError(t, err)
+		var ws *websocket.Conn
+		require.Eventually(t, func() bool {
+			// The previous session may still be being released
+			ws, err = websocket.DialConfig(wsConfig)
+			return err == nil
+		}, 10*time.Second, 50*time.Millisecond, origin)
+		ws.Close()
+	}
+}
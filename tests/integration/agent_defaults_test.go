@@ -0,0 +1,101 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getAgentConfig returns the agent configuration a GET request to path answers with
+func getAgentConfig(t *testing.T, router *gin.Engine, path string) models.AgentConfiguration {
+	recorder := requestJSON(router, http.MethodGet, path, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var agent models.AgentConfiguration
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &agent))
+	return agent
+}
+
+func TestAgentDefaultsRawAndEffectiveConfiguration(t *testing.T) {
+	router, agentService := newTemplateRouter(t)
+	agentService.SetAgentDefaults(&models.AgentConfiguration{
+		Timeout:         90,
+		StopWaitSeconds: 5,
+		LogfileBackups:  7,
+		Envs:            map[string]string{"LOG_LEVEL": "warn", "TZ": "UTC"},
+	})
+
+	template := map[string]interface{}{}
+	for key, value := range templateSettings {
+		template[key] = value
+	}
+	template["stop_wait_seconds"] = 20
+	recorder := postJSON(router, "/api/v1/agent-templates", map[string]interface{}{"name": "shared", "settings": template})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = postJSON(router, "/api/v1/agents", map[string]interface{}{
+		"id": "agent-1", "name": "Agent 1", "template": "shared", "timeout": 30, "envs": map[string]string{"REGION": "eu"},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	// GET returns the effective configuration: submitted > template > defaults
+	effective := getAgentConfig(t, router, "/api/v1/agents/agent-1")
+	assert.Equal(t, 30, effective.Timeout)
+	assert.Equal(t, 20, effective.StopWaitSeconds)
+	assert.Equal(t, 7, effective.LogfileBackups)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "REGION": "eu", "TZ": "UTC"}, effective.Envs)
+
+	// raw=true returns what was submitted
+	raw := getAgentConfig(t, router, "/api/v1/agents/agent-1?raw=true")
+	assert.Equal(t, "shared", raw.Template)
+	assert.Equal(t, 30, raw.Timeout)
+	assert.Zero(t, raw.StopWaitSeconds)
+	assert.Zero(t, raw.LogfileBackups)
+	assert.Equal(t, map[string]string{"REGION": "eu"}, raw.Envs)
+	assert.Equal(t, effective.CreatedAt, raw.CreatedAt)
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents/agent-1?raw=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestReapplyAgentDefaults(t *testing.T) {
+	router, agentService := newTemplateRouter(t)
+	recorder := postJSON(router, "/api/v1/agent-templates", map[string]interface{}{"name": "shared", "settings": templateSettings})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	for _, id := range []string{"agent-1", "agent-2"} {
+		recorder = postJSON(router, "/api/v1/agents", map[string]interface{}{"id": id, "name": id, "template": "shared"})
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+
+	// Changed defaults only apply to agents registered afterwards
+	agentService.SetAgentDefaults(&models.AgentConfiguration{LogfileBackups: 7})
+	assert.Zero(t, getAgentConfig(t, router, "/api/v1/agents/agent-1").LogfileBackups)
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/reapply-defaults?dry_run=true", map[string]interface{}{"agent_ids": []string{"agent-1"}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ReapplyDefaultsResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.True(t, result.DryRun)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, models.OperationPending, result.Results[0].Status)
+	assert.Equal(t, []string{"logfile_backups"}, result.Results[0].ChangedFields)
+	assert.Zero(t, getAgentConfig(t, router, "/api/v1/agents/agent-1").LogfileBackups)
+
+	// Without agent IDs, every agent is retrofitted
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/reapply-defaults", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	result = models.ReapplyDefaultsResult{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Matched)
+	assert.Equal(t, 2, result.Updated)
+	assert.Equal(t, 7, getAgentConfig(t, router, "/api/v1/agents/agent-1").LogfileBackups)
+	assert.Equal(t, 7, getAgentConfig(t, router, "/api/v1/agents/agent-2").LogfileBackups)
+	assert.Zero(t, getAgentConfig(t, router, "/api/v1/agents/agent-2?raw=true").LogfileBackups)
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/reapply-defaults?dry_run=soon", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
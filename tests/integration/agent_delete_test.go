@@ -0,0 +1,233 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// deleteFixture serves REST and JSON-RPC over agents that scheduled tasks may run
+type deleteFixture struct {
+	router       *gin.Engine
+	agentService *services.AgentService
+	scheduler    *services.SchedulerService
+}
+
+func newDeleteFixture(t *testing.T, agents ...*models.AgentConfiguration) *deleteFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	t.Cleanup(scheduler.Stop)
+	agentService.SetExecutionService(executionService)
+	agentService.SetSchedulerService(scheduler)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		SchedulerService:     scheduler,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+	handlers.NewJSONRPCHandlers(agentService, coordinator, logger, a2aConfig).RegisterJSONRPCRoutes(router)
+
+	return &deleteFixture{router: router, agentService: agentService, scheduler: scheduler}
+}
+
+// scheduleTask schedules a task running agentID that does not fire during the test
+func (f *deleteFixture) scheduleTask(t *testing.T, taskID, agentID string) {
+	require.NoError(t, f.scheduler.ScheduleTask(&models.ScheduledTask{
+		ID:             taskID,
+		Name:           taskID,
+		AgentID:        agentID,
+		CronExpression: "0 0 1 1 *",
+		Enabled:        true,
+	}))
+}
+
+// listAgentIDs fetches GET /api/v1/agents with the given query and returns the agent IDs
+func (f *deleteFixture) listAgentIDs(t *testing.T, query string) []string {
+	recorder := requestJSON(f.router, http.MethodGet, "/api/v1/agents"+query, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Agents []models.AgentConfiguration `json:"agents"`
+		Total  int                         `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	ids := []string{}
+	for _, agent := range response.Agents {
+		ids = append(ids, agent.ID)
+	}
+	assert.Len(t, ids, response.Total)
+	return ids
+}
+
+func TestDeleteAgentRefusedWhileTasksReferenceIt(t *testing.T) {
+	f := newDeleteFixture(t, scriptAgent(t, "busy-agent", models.ReadOnlyAccessType, "echo ok\n"))
+	f.scheduleTask(t, "task-b", "busy-agent")
+	f.scheduleTask(t, "task-a", "busy-agent")
+
+	recorder := requestJSON(f.router, http.MethodDelete, "/api/v1/agents/busy-agent", nil)
+	require.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_IN_USE", "delete referenced agent")
+	var response struct {
+		Details struct {
+			TaskIDs []string `json:"task_ids"`
+		} `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, []string{"task-a", "task-b"}, response.Details.TaskIDs)
+
+	// Nothing changed
+	assert.Equal(t, []string{"busy-agent"}, f.listAgentIDs(t, ""))
+	task, err := f.scheduler.GetTask("task-a")
+	require.NoError(t, err)
+	assert.True(t, task.IsActive())
+
+	recorder = requestJSON(f.router, http.MethodDelete, "/api/v1/agents/busy-agent?force=perhaps", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = requestJSON(f.router, http.MethodDelete, "/api/v1/agents/missing-agent", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestForcedDeleteAgentPausesTasks(t *testing.T) {
+	f := newDeleteFixture(t,
+		scriptAgent(t, "busy-agent", models.ReadOnlyAccessType, "echo ok\n"),
+		scriptAgent(t, "other-agent", models.ReadOnlyAccessType, "echo ok\n"))
+	f.scheduleTask(t, "busy-task", "busy-agent")
+	f.scheduleTask(t, "paused-task", "busy-agent")
+	require.NoError(t, f.scheduler.PauseTask("paused-task"))
+	f.scheduleTask(t, "other-task", "other-agent")
+
+	recorder := requestJSON(f.router, http.MethodDelete, "/api/v1/agents/busy-agent?force=true", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result services.AgentDeleteResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, "busy-agent", result.AgentID)
+	assert.Equal(t, []string{"busy-task"}, result.PausedTasks)
+	assert.False(t, result.DeletedAt.IsZero())
+
+	// Tasks of the deleted agent are paused, others keep running
+	for taskID, active := range map[string]bool{"busy-task": false, "paused-task": false, "other-task": true} {
+		task, err := f.scheduler.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, active, task.IsActive(), taskID)
+	}
+
+	// The agent is hidden unless deleted agents are asked for
+	assert.Equal(t, []string{"other-agent"}, f.listAgentIDs(t, ""))
+	assert.Equal(t, []string{"busy-agent", "other-agent"}, f.listAgentIDs(t, "?include_deleted=true"))
+	agent, err := f.agentService.GetAgent("busy-agent")
+	require.NoError(t, err)
+	require.NotNil(t, agent.DeletedAt)
+	status, err := f.agentService.GetAgentStatus("busy-agent")
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", status.Status)
+
+	// Deleting it again is refused
+	recorder = requestJSON(f.router, http.MethodDelete, "/api/v1/agents/busy-agent", nil)
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_DELETED", "delete deleted agent")
+}
+
+func TestExecuteSoftDeletedAgentRejected(t *testing.T) {
+	f := newDeleteFixture(t, scriptAgent(t, "gone-agent", models.ReadOnlyAccessType, "echo ok\n"))
+	recorder := requestJSON(f.router, http.MethodDelete, "/api/v1/agents/gone-agent", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = postExecute(f.router, "gone-agent", map[string]interface{}{"input": "x"})
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_DELETED", "execute deleted agent")
+
+	recorder = requestJSON(f.router, http.MethodPost, "/jsonrpc", map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "execute-agent",
+		"params":  map[string]interface{}{"agent_id": "gone-agent", "input": "x"},
+	})
+	var response struct {
+		Error struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response), recorder.Body.String())
+	assert.Equal(t, "AGENT_DELETED", response.Error.Data["code"])
+
+	// Registering another agent under the same ID is refused until it is purged
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents", map[string]interface{}{
+		"id": "gone-agent", "name": "Replacement", "agent_type": "test-type", "executable_path": "/bin/echo",
+		"access_type": "read-only", "mode": "task", "input_pattern": "stdin", "output_pattern": "stdout",
+		"max_concurrent_executions": 1, "enabled": true,
+	})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_CONFLICT", "register over deleted agent")
+}
+
+func TestRestoreSoftDeletedAgent(t *testing.T) {
+	f := newDeleteFixture(t, scriptAgent(t, "restored-agent", models.ReadOnlyAccessType, "echo restored\n"))
+	f.scheduleTask(t, "restored-task", "restored-agent")
+	recorder := requestJSON(f.router, http.MethodDelete, "/api/v1/agents/restored-agent?force=true", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents/restored-agent/restore", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var restored models.AgentConfiguration
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &restored))
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, []string{"restored-agent"}, f.listAgentIDs(t, ""))
+
+	// It runs again; its task stays paused until resumed
+	recorder = postExecute(f.router, "restored-agent", map[string]interface{}{"input": "x"})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	task, err := f.scheduler.GetTask("restored-task")
+	require.NoError(t, err)
+	assert.False(t, task.IsActive())
+
+	// Only deleted agents can be restored
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents/restored-agent/restore", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_CONFLICT", "restore live agent")
+}
+
+func TestAgentRetentionPurgesDeletedAgents(t *testing.T) {
+	f := newDeleteFixture(t,
+		scriptAgent(t, "old-agent", models.ReadOnlyAccessType, "echo ok\n"),
+		scriptAgent(t, "live-agent", models.ReadOnlyAccessType, "echo ok\n"))
+	_, err := f.agentService.SoftDeleteAgent("old-agent", false)
+	require.NoError(t, err)
+
+	// Within the retention the agent is kept
+	job := services.NewAgentRetentionJob(f.agentService, time.Hour, time.Hour, zap.NewNop())
+	assert.Empty(t, job.RunOnce())
+	assert.Equal(t, []string{"live-agent", "old-agent"}, f.listAgentIDs(t, "?include_deleted=true"))
+
+	// Past it the agent is removed for good
+	time.Sleep(10 * time.Millisecond)
+	job = services.NewAgentRetentionJob(f.agentService, time.Millisecond, time.Hour, zap.NewNop())
+	assert.Equal(t, []string{"old-agent"}, job.RunOnce())
+	assert.Equal(t, []string{"live-agent"}, f.listAgentIDs(t, "?include_deleted=true"))
+	recorder := requestJSON(f.router, http.MethodPost, "/api/v1/agents/old-agent/restore", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,236 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// toggleFixture serves REST and JSON-RPC over one coordinator, with a scheduler on the same agents
+type toggleFixture struct {
+	router           *gin.Engine
+	executionService *services.ExecutionService
+	scheduler        *services.SchedulerService
+}
+
+func newToggleFixture(t *testing.T, agents ...*models.AgentConfiguration) *toggleFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		SchedulerService:     scheduler,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+	handlers.NewJSONRPCHandlers(agentService, coordinator, logger, a2aConfig).RegisterJSONRPCRoutes(router)
+
+	return &toggleFixture{router: router, executionService: executionService, scheduler: scheduler}
+}
+
+// toggle disables or enables an agent over REST
+func (f *toggleFixture) toggle(t *testing.T, agentID, action, query string) (*httptest.ResponseRecorder, services.AgentToggleResult) {
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/agents/"+agentID+"/"+action+query, nil))
+
+	var result services.AgentToggleResult
+	if recorder.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	}
+	return recorder, result
+}
+
+// startRunning starts an asynchronous execution and waits until its process runs
+func (f *toggleFixture) startRunning(t *testing.T, agentID string) string {
+	recorder := postExecute(f.router, agentID, map[string]interface{}{"input": "x", "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted handlers.AgentExecuteAccepted
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+
+	require.Eventually(t, func() bool {
+		execution, err := f.executionService.GetExecution(accepted.ExecutionID)
+		return err == nil && execution.State == models.RunningState
+	}, 5*time.Second, 10*time.Millisecond)
+	return accepted.ExecutionID
+}
+
+// waitFinished waits for an execution to finish and returns it
+func (f *toggleFixture) waitFinished(t *testing.T, executionID string) *models.AgentExecution {
+	var execution *models.AgentExecution
+	require.Eventually(t, func() bool {
+		var err error
+		execution, err = f.executionService.GetExecution(executionID)
+		return err == nil && execution.IsComplete()
+	}, 5*time.Second, 20*time.Millisecond)
+	return execution
+}
+
+func TestDisableAgentLetsInFlightExecutionsFinish(t *testing.T) {
+	agent := scriptAgent(t, "toggle-agent", models.ReadOnlyAccessType, "sleep 0.5\necho done\n")
+	f := newToggleFixture(t, agent)
+
+	executionID := f.startRunning(t, "toggle-agent")
+
+	recorder, result := f.toggle(t, "toggle-agent", "disable", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.False(t, result.Enabled)
+	assert.Equal(t, []string{executionID}, result.RunningExecutions)
+	assert.Empty(t, result.CancelledExecutions)
+
+	// New executions are rejected over REST
+	recorder = postExecute(f.router, "toggle-agent", map[string]interface{}{"input": "x"})
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_DISABLED", "execute disabled agent")
+
+	// and over JSON-RPC
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "execute-agent",
+		"id":      1,
+		"params":  map[string]interface{}{"agent_id": "toggle-agent", "input": "x"},
+	})
+	recorder = httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+	var response handlers.JSONRPCResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.NotNil(t, response.Error, recorder.Body.String())
+	assert.Equal(t, "Agent is disabled", response.Error.Message)
+	data, ok := response.Error.Data.(map[string]interface{})
+	require.True(t, ok, recorder.Body.String())
+	assert.Equal(t, "AGENT_DISABLED", data["code"])
+	assert.Equal(t, "toggle-agent", data["agent_id"])
+
+	// The execution that was running when the agent was disabled still completes
+	assert.EqualValues(t, models.CompletedState, f.waitFinished(t, executionID).State)
+
+	recorder, result = f.toggle(t, "toggle-agent", "enable", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, result.Enabled)
+	recorder = postExecute(f.router, "toggle-agent", map[string]interface{}{"input": "x"})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestDisableAgentCancelActive(t *testing.T) {
+	agent := scriptAgent(t, "cancel-agent", models.ReadOnlyAccessType, "sleep 5\necho done\n")
+	f := newToggleFixture(t, agent)
+
+	executionID := f.startRunning(t, "cancel-agent")
+
+	recorder, result := f.toggle(t, "cancel-agent", "disable", "?cancel_active=true")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.False(t, result.Enabled)
+	assert.Equal(t, []string{executionID}, result.CancelledExecutions)
+	assert.Empty(t, result.RunningExecutions)
+
+	assert.EqualValues(t, models.CancelledState, f.waitFinished(t, executionID).State)
+}
+
+func TestDisableAndEnableAgentClient(t *testing.T) {
+	f := newToggleFixture(t,
+		scriptAgent(t, "client-agent", models.ReadOnlyAccessType, "sleep 0.5\necho done\n"),
+		scriptAgent(t, "client-cancel-agent", models.ReadOnlyAccessType, "sleep 5\necho done\n"))
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	// In-flight executions finish by default
+	executionID := f.startRunning(t, "client-agent")
+	result, err := client.DisableAgent(ctx, "client-agent", supervisorctl.DisableOptions{})
+	require.NoError(t, err)
+	assert.False(t, result.Enabled)
+	assert.Equal(t, []string{executionID}, result.RunningExecutions)
+	assert.Empty(t, result.CancelledExecutions)
+	_, err = client.Execute(ctx, "client-agent", supervisorctl.ExecuteRequest{Input: "x"})
+	var apiErr *supervisorctl.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "AGENT_DISABLED", apiErr.Code)
+	assert.EqualValues(t, models.CompletedState, f.waitFinished(t, executionID).State)
+
+	result, err = client.EnableAgent(ctx, "client-agent")
+	require.NoError(t, err)
+	assert.True(t, result.Enabled)
+	_, err = client.Execute(ctx, "client-agent", supervisorctl.ExecuteRequest{Input: "x"})
+	assert.NoError(t, err)
+
+	// and are cancelled with CancelActive
+	executionID = f.startRunning(t, "client-cancel-agent")
+	result, err = client.DisableAgent(ctx, "client-cancel-agent", supervisorctl.DisableOptions{CancelActive: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{executionID}, result.CancelledExecutions)
+	assert.Empty(t, result.RunningExecutions)
+	assert.EqualValues(t, models.CancelledState, f.waitFinished(t, executionID).State)
+
+	_, err = client.DisableAgent(ctx, "missing-agent", supervisorctl.DisableOptions{})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestDisableUnknownAgent(t *testing.T) {
+	f := newToggleFixture(t)
+
+	recorder, _ := f.toggle(t, "missing-agent", "disable", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_NOT_FOUND", "disable unknown agent")
+}
+
+func TestDisabledAgentSkipsScheduledRuns(t *testing.T) {
+	agent := scriptAgent(t, "scheduled-toggle-agent", models.ReadOnlyAccessType, "echo done\n")
+	f := newToggleFixture(t, agent)
+
+	recorder, _ := f.toggle(t, "scheduled-toggle-agent", "disable", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	task := &models.ScheduledTask{
+		ID:             "disabled-agent-task",
+		Name:           "Disabled Agent Task",
+		AgentID:        "scheduled-toggle-agent",
+		CronExpression: "@every 1s",
+		Enabled:        true,
+	}
+	require.NoError(t, f.scheduler.ScheduleTask(task))
+	defer f.scheduler.UnscheduleTask(task.ID)
+
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = f.scheduler.GetTaskHistory(task.ID, 0)
+		return len(history) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, types.SkippedStatus, history[0].Status)
+	assert.True(t, strings.Contains(history[0].Error, "agent scheduled-toggle-agent is disabled"), history[0].Error)
+	executions, err := f.executionService.ListExecutions("scheduled-toggle-agent")
+	require.NoError(t, err)
+	assert.Empty(t, executions)
+}
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentDryRunPlansWithoutChangingState(t *testing.T) {
+	f, client := newSafetyFixture(t)
+	ctx := context.Background()
+	executionID := f.startRunning(t, "payments-api")
+
+	// Disabling stops members in reverse order; nothing is disabled
+	plan, err := client.PlanOperation(ctx, "payments-*", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{})
+	require.NoError(t, err)
+	assert.True(t, plan.DryRun)
+	assert.Equal(t, 3, plan.Matched)
+	require.Len(t, plan.Results, 3)
+	assert.Equal(t, "payments-worker", plan.Results[0].AgentID)
+	assert.Equal(t, "payments-api", plan.Results[2].AgentID)
+	for _, operation := range plan.Results {
+		assert.Equal(t, "pending", operation.Status, operation.AgentID)
+		assert.Equal(t, "enabled", operation.CurrentState)
+		assert.Equal(t, "disabled", operation.ExpectedState)
+	}
+
+	// Operations on many agents are planned without confirmation; protected agents are skipped
+	plan, err = client.PlanOperation(ctx, "*", supervisorctl.GroupActionRestart, supervisorctl.BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 5, plan.Matched)
+	assert.Equal(t, 1, plan.Skipped)
+	require.Len(t, plan.Results, 5)
+	assert.Equal(t, "ledger", plan.Results[4].AgentID)
+	assert.Equal(t, "skipped", plan.Results[4].Status)
+
+	f.assertEnabled(t, map[string]bool{"ledger": true, "notifier": true, "payments-api": true, "payments-web": true, "payments-worker": true})
+	execution, err := f.executionService.GetExecution(executionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.RunningState, execution.State)
+}
+
+func TestAgentDryRunReportsFailedPreconditions(t *testing.T) {
+	f, client := newSafetyFixture(t)
+	ctx := context.Background()
+
+	// An unknown agent is reported in the plan, not as an error
+	plan, err := client.PlanOperation(ctx, "missing-agent", supervisorctl.GroupActionRestart, supervisorctl.BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, plan.Failed)
+	require.Len(t, plan.Results, 1)
+	assert.Equal(t, "failed", plan.Results[0].Status)
+	assert.Contains(t, plan.Results[0].Message, "not found")
+
+	plan, err = client.PlanOperation(ctx, "notifier", supervisorctl.GroupActionStart, supervisorctl.BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "failed", plan.Results[0].Status)
+	assert.Contains(t, plan.Results[0].Message, "not a persistent agent")
+
+	// Agents already in the requested state are skipped
+	require.Equal(t, http.StatusOK, requestJSON(f.router, http.MethodPost, "/api/v1/agents/notifier/disable", nil).Code)
+	plan, err = client.PlanOperation(ctx, "notifier", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, plan.Skipped)
+	assert.Equal(t, "skipped", plan.Results[0].Status)
+
+	var out strings.Builder
+	plan.Print(&out)
+	assert.Contains(t, out.String(), "notifier  disable  disabled -> disabled  skipped: agent is already disabled")
+	assert.Contains(t, out.String(), "1 matched, 0 pending, 1 skipped, 0 failed")
+
+	// Unknown patterns still fail the request
+	_, err = client.PlanOperation(ctx, "nothing-*", supervisorctl.GroupActionEnable, supervisorctl.BatchOptions{})
+	var apiErr *supervisorctl.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestAgentDryRunRejectsMalformedFlag(t *testing.T) {
+	f, _ := newSafetyFixture(t)
+
+	for _, path := range []string{"/api/v1/agents/ledger/disable?dry_run=yes", "/api/v1/agents/payments-*/disable?dry_run=1x"} {
+		recorder := requestJSON(f.router, http.MethodPost, path, nil)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, path)
+	}
+	f.assertEnabled(t, map[string]bool{"ledger": true, "payments-api": true})
+}
@@ -0,0 +1,202 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// scriptAgent returns an agent configuration running a shell script with the given body
+func scriptAgent(t *testing.T, id string, accessType types.AgentAccessType, body string) *models.AgentConfiguration {
+	script := filepath.Join(t.TempDir(), id+".sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"+body), 0755))
+
+	config := validationAgent(id, "")
+	config.ExecutablePath = script
+	config.AccessType = accessType
+	return config
+}
+
+// newExecuteRouter serves the REST routes with an execution coordinator over the given agents
+func newExecuteRouter(t *testing.T, agents ...*models.AgentConfiguration) (*gin.Engine, *services.ExecutionService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	metricsCollector := services.NewMetricsCollector(logger)
+	executionService.SetMetricsCollector(metricsCollector)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     metricsCollector,
+		Logger:               logger,
+	})
+	return router, executionService
+}
+
+func postExecute(router *gin.Engine, agentID string, body map[string]interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents/"+agentID+"/execute", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestExecuteAgentSync(t *testing.T) {
+	agent := scriptAgent(t, "echo-agent", models.ReadOnlyAccessType, "echo \"$(cat) $@\"\n")
+	router, _ := newExecuteRouter(t, agent)
+
+	recorder := postExecute(router, "echo-agent", map[string]interface{}{
+		"input":      "hello",
+		"parameters": map[string]interface{}{"mode": "fast"},
+		"labels":     map[string]string{"team": "search"},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.EqualValues(t, models.SuccessStatus, result.Status)
+	assert.Equal(t, "hello --mode fast\n", result.Output)
+	assert.Equal(t, map[string]string{"team": "search"}, result.Labels)
+	assert.NotEmpty(t, result.ID)
+}
+
+func TestExecuteAgentAsync(t *testing.T) {
+	agent := scriptAgent(t, "slow-agent", models.ReadWriteAccessType, "sleep 0.3\necho \"done $(cat)\"\n")
+	router, executionService := newExecuteRouter(t, agent)
+
+	start := time.Now()
+	recorder := postExecute(router, "slow-agent", map[string]interface{}{"input": "job", "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+
+	var accepted map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	executionID := accepted["execution_id"].(string)
+	location := recorder.Header().Get("Location")
+	assert.Equal(t, "/api/v1/executions/"+executionID, location)
+	assert.Equal(t, location, accepted["location"])
+
+	// The execution can be polled at the Location until it completes
+	require.Eventually(t, func() bool {
+		poll := httptest.NewRecorder()
+		router.ServeHTTP(poll, httptest.NewRequest(http.MethodGet, location, nil))
+		if poll.Code != http.StatusOK {
+			return false
+		}
+		var body struct {
+			Execution models.AgentExecution `json:"execution"`
+		}
+		return json.Unmarshal(poll.Body.Bytes(), &body) == nil && body.Execution.IsComplete()
+	}, 5*time.Second, 50*time.Millisecond)
+
+	result, err := executionService.GetExecutionResult(executionID)
+	require.NoError(t, err)
+	assert.Equal(t, "done job\n", result.Output)
+}
+
+func TestExecuteAgentEnvOverride(t *testing.T) {
+	agent := scriptAgent(t, "env-agent", models.ReadOnlyAccessType, "echo \"$GREETING from $(pwd)\"\n")
+	agent.Envs = map[string]string{"GREETING": "configured"}
+	router, _ := newExecuteRouter(t, agent)
+	workingDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	output := func(body map[string]interface{}) string {
+		recorder := postExecute(router, "env-agent", body)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var result models.ExecutionResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		return result.Output
+	}
+
+	assert.Equal(t, "overridden from "+workingDir+"\n", output(map[string]interface{}{
+		"env":         map[string]string{"GREETING": "overridden"},
+		"working_dir": workingDir,
+	}))
+
+	// Overrides apply to that request only
+	assert.Contains(t, output(map[string]interface{}{}), "configured from ")
+}
+
+func TestExecuteAgentRejectsInvalidRequests(t *testing.T) {
+	disabled := scriptAgent(t, "disabled-agent", models.ReadOnlyAccessType, "echo hi\n")
+	disabled.Enabled = false
+	enabled := scriptAgent(t, "enabled-agent", models.ReadOnlyAccessType, "echo hi\n")
+	router, executionService := newExecuteRouter(t, disabled, enabled)
+
+	tests := []struct {
+		name    string
+		agentID string
+		body    map[string]interface{}
+		status  int
+		code    string
+	}{
+		{"disabled agent", "disabled-agent", map[string]interface{}{"input": "x"}, http.StatusForbidden, "AGENT_DISABLED"},
+		{"disabled agent async", "disabled-agent", map[string]interface{}{"input": "x", "async": true}, http.StatusForbidden, "AGENT_DISABLED"},
+		{"unknown agent", "missing-agent", map[string]interface{}{"input": "x"}, http.StatusNotFound, "AGENT_NOT_FOUND"},
+		{"object parameter", "enabled-agent", map[string]interface{}{"parameters": map[string]interface{}{"mode": map[string]interface{}{"a": 1}}}, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"list parameter", "enabled-agent", map[string]interface{}{"parameters": map[string]interface{}{"mode": []string{"a"}}}, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"relative working dir", "enabled-agent", map[string]interface{}{"working_dir": "relative"}, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"negative timeout", "enabled-agent", map[string]interface{}{"timeout_seconds": -1}, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"bad env name", "enabled-agent", map[string]interface{}{"env": map[string]string{"A=B": "x"}}, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"wrong field type", "enabled-agent", map[string]interface{}{"timeout_seconds": "soon"}, http.StatusBadRequest, "INVALID_REQUEST"},
+	}
+
+	for _, tt := range tests {
+		recorder := postExecute(router, tt.agentID, tt.body)
+		assert.Equal(t, tt.status, recorder.Code, "%s: %s", tt.name, recorder.Body.String())
+		assertErrorEnvelope(t, recorder.Body.Bytes(), tt.code, tt.name)
+	}
+
+	// Rejected requests never start an execution
+	executions, err := executionService.QueryExecutions(services.ExecutionFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, executions)
+}
+
+func TestExecuteAgentSerializesReadWriteAgents(t *testing.T) {
+	agent := scriptAgent(t, "writer-agent", models.ReadWriteAccessType, "sleep 0.2\necho written\n")
+	router, _ := newExecuteRouter(t, agent)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = postExecute(router, "writer-agent", map[string]interface{}{"input": "x"}).Code
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, codes)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond, "read-write executions must not overlap")
+}
@@ -0,0 +1,228 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// groupFixture serves the REST routes with agent groups over long-running agents
+type groupFixture struct {
+	router           *gin.Engine
+	agentService     *services.AgentService
+	executionService *services.ExecutionService
+	coordinator      *services.ExecutionCoordinator
+}
+
+// newGroupFixture registers an agent sleeping until cancelled for every ID
+func newGroupFixture(t *testing.T, agentIDs ...string) *groupFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agentID := range agentIDs {
+		require.NoError(t, agentService.RegisterAgent(scriptAgent(t, agentID, models.ReadOnlyAccessType, "sleep 30\n")))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	agentService.SetExecutionService(executionService)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	coordinator.SetGroupService(agentService)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	t.Cleanup(scheduler.Stop)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		AgentGroupService:    agentService,
+		SchedulerService:     scheduler,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	return &groupFixture{router: router, agentService: agentService, executionService: executionService, coordinator: coordinator}
+}
+
+// startRunning starts an asynchronous execution of the agent and waits until its process runs
+func (f *groupFixture) startRunning(t *testing.T, agentID string) string {
+	recorder := postExecute(f.router, agentID, map[string]interface{}{"input": "x", "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted handlers.AgentExecuteAccepted
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+
+	require.Eventually(t, func() bool {
+		execution, err := f.executionService.GetExecution(accepted.ExecutionID)
+		return err == nil && execution.State == models.RunningState
+	}, 5*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() { f.executionService.CancelExecution(accepted.ExecutionID, "test finished", "") })
+	return accepted.ExecutionID
+}
+
+func TestAgentGroupRestartOrdersMembers(t *testing.T) {
+	f := newGroupFixture(t, "ledger", "payments-api", "notifier", "reporting")
+	server := httptest.NewServer(f.router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	// Members are listed in start order, which is not their alphabetical order
+	members := []string{"ledger", "payments-api", "notifier"}
+	require.NoError(t, client.CreateGroup(ctx, supervisorctl.AgentGroup{Name: "payments", Description: "Payment flow", Members: members}))
+
+	running := make(map[string]string)
+	for _, agentID := range append(members, "reporting") {
+		running[agentID] = f.startRunning(t, agentID)
+	}
+
+	result, err := client.GroupOperation(ctx, "payments", supervisorctl.GroupActionRestart)
+	require.NoError(t, err)
+	assert.Equal(t, "payments", result.Group)
+	assert.Equal(t, "restart", result.Action)
+
+	// Members stop in reverse order, then start in order
+	var order []string
+	for _, step := range result.Steps {
+		assert.Equal(t, "applied", step.Status, step.Message)
+		order = append(order, step.Step+" "+step.AgentID)
+		if step.Step == "stop" {
+			assert.Equal(t, []string{running[step.AgentID]}, step.CancelledExecutions)
+		}
+	}
+	assert.Equal(t, []string{
+		"stop notifier", "stop payments-api", "stop ledger",
+		"start ledger", "start payments-api", "start notifier",
+	}, order)
+
+	for _, agentID := range members {
+		execution, err := f.executionService.GetExecution(running[agentID])
+		require.NoError(t, err)
+		assert.Equal(t, types.CancelledState, execution.State, agentID)
+		agent, err := f.agentService.GetAgent(agentID)
+		require.NoError(t, err)
+		assert.True(t, agent.Enabled, agentID)
+	}
+
+	// The agent outside the group is untouched
+	execution, err := f.executionService.GetExecution(running["reporting"])
+	require.NoError(t, err)
+	assert.Equal(t, types.RunningState, execution.State)
+
+	// Status of the group lists only its members, in order
+	statuses, err := client.Status(ctx, "group:payments")
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	for i, status := range statuses {
+		assert.Equal(t, members[i], status.ID)
+	}
+	statuses, err = client.Status(ctx, "reporting")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "running", statuses[0].Status)
+}
+
+func TestAgentGroupDisableAndEnable(t *testing.T) {
+	f := newGroupFixture(t, "first", "second", "outsider")
+	recorder := requestJSON(f.router, http.MethodPost, "/api/v1/groups", map[string]interface{}{"name": "pair", "members": []string{"first", "second"}})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents/group:pair/disable", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.GroupOperationResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, "second", result.Steps[0].AgentID)
+	assert.Equal(t, models.GroupStepStop, result.Steps[0].Step)
+	assert.Equal(t, "first", result.Steps[1].AgentID)
+
+	for agentID, enabled := range map[string]bool{"first": false, "second": false, "outsider": true} {
+		agent, err := f.agentService.GetAgent(agentID)
+		require.NoError(t, err)
+		assert.Equal(t, enabled, agent.Enabled, agentID)
+	}
+
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents/group:pair/enable", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	agent, err := f.agentService.GetAgent("second")
+	require.NoError(t, err)
+	assert.True(t, agent.Enabled)
+
+	// Group starts skip members without a persistent process
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents/group:pair/start", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	require.Len(t, result.Steps, 2)
+	assert.Equal(t, models.OperationSkipped, result.Steps[0].Status)
+
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents/group:missing/restart", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "GROUP_NOT_FOUND", "restart unknown group")
+}
+
+func TestAgentGroupMembershipValidation(t *testing.T) {
+	f := newGroupFixture(t, "known")
+
+	recorder := requestJSON(f.router, http.MethodPost, "/api/v1/groups", map[string]interface{}{"name": "bad", "members": []string{"known", "unknown", "known"}})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"members[1]": models.ValidationNotFound, "members[2]": models.ValidationConflict},
+		fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/groups", map[string]interface{}{"name": "a:b", "members": []string{}})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"name": models.ValidationInvalid, "members": models.ValidationRequired},
+		fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/groups", map[string]interface{}{"name": "solo", "members": []string{"known"}})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/groups", map[string]interface{}{"name": "solo", "members": []string{"known"}})
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "GROUP_CONFLICT", "duplicate group")
+
+	recorder = requestJSON(f.router, http.MethodPut, "/api/v1/groups/solo", map[string]interface{}{"members": []string{"known", "ghost"}})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	recorder = requestJSON(f.router, http.MethodPut, "/api/v1/groups/ghost", map[string]interface{}{"members": []string{"known"}})
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "GROUP_NOT_FOUND", "update unknown group")
+}
+
+func TestAgentGroupDeletedAgentLeavesGroups(t *testing.T) {
+	f := newGroupFixture(t, "stays", "goes")
+	recorder := requestJSON(f.router, http.MethodPost, "/api/v1/groups", map[string]interface{}{"name": "duo", "members": []string{"goes", "stays"}})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = requestJSON(f.router, http.MethodDelete, "/api/v1/agents/goes", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var deleted services.AgentDeleteResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &deleted))
+	assert.Equal(t, []string{"duo"}, deleted.Groups)
+
+	recorder = requestJSON(f.router, http.MethodGet, "/api/v1/groups/duo", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var group models.AgentGroup
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &group))
+	assert.Equal(t, []string{"stays"}, group.Members)
+
+	// Restoring the agent does not add it back
+	_, err := f.agentService.RestoreAgent("goes")
+	require.NoError(t, err)
+	current, err := f.agentService.GetGroup("duo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stays"}, current.Members)
+
+	recorder = requestJSON(f.router, http.MethodDelete, "/api/v1/groups/duo", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = requestJSON(f.router, http.MethodGet, "/api/v1/groups", nil)
+	assert.Contains(t, recorder.Body.String(), `"total":0`)
+}
@@ -0,0 +1,203 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// summarizerSchema takes a required max_words between 1 and 500 and an optional style
+var summarizerSchema = models.JSONSchema{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"max_words": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 500, "description": "Longest summary"},
+		"style":     map[string]interface{}{"type": "string", "enum": []interface{}{"brief", "full"}, "default": "brief"},
+	},
+	"required":             []interface{}{"max_words"},
+	"additionalProperties": false,
+}
+
+// newInputSchemaRouter serves the REST and A2A routes over no agents
+func newInputSchemaRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+
+	router := gin.New()
+	routes.SetupA2ARoutes(&routes.A2ARouteConfig{
+		Router:               router,
+		A2AService:           services.NewA2AService(agentService, executionService, logger),
+		AgentService:         agentService,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		A2AConfig:            a2aConfig,
+	})
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	return router
+}
+
+// registerAgent posts an agent configuration to the REST API
+func registerAgent(router *gin.Engine, agent *models.AgentConfiguration) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(agent)
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// summarizerAgent prints its arguments, documented by summarizerSchema
+func summarizerAgent(t *testing.T) *models.AgentConfiguration {
+	agent := scriptAgent(t, "summarizer", models.ReadOnlyAccessType, "echo \"$@\"\n")
+	agent.Description = "Summarizes the input text"
+	agent.InputSchema = summarizerSchema
+	agent.Examples = []models.AgentExample{{Description: "A short summary", Input: "Long text", Parameters: map[string]interface{}{"max_words": 50}}}
+	agent.ValidateInput = true
+	return agent
+}
+
+func TestAgentInputSchemaValidation(t *testing.T) {
+	router := newInputSchemaRouter(t)
+	recorder := registerAgent(router, summarizerAgent(t))
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	// Parameters violating the schema are rejected with the offending properties
+	recorder = postExecute(router, "summarizer", map[string]interface{}{
+		"input":      "text",
+		"parameters": map[string]interface{}{"max_words": 1000, "style": "epic", "tone": "dry"},
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	var response struct {
+		Code    string `json:"code"`
+		Details struct {
+			Errors []models.FieldError `json:"errors"`
+		} `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "INPUT_INVALID", response.Code)
+	fields := make(map[string]string)
+	for _, fieldErr := range response.Details.Errors {
+		fields[fieldErr.Field] = fieldErr.Code
+	}
+	assert.Equal(t, map[string]string{
+		"parameters.max_words": models.ValidationOutOfRange,
+		"parameters.style":     models.ValidationInvalid,
+		"parameters.tone":      models.ValidationInvalid,
+	}, fields)
+
+	recorder = postExecute(router, "summarizer", map[string]interface{}{"input": "text"})
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "parameters.max_words is required")
+
+	// Conforming parameters run
+	recorder = postExecute(router, "summarizer", map[string]interface{}{"input": "text", "parameters": map[string]interface{}{"max_words": 20}})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "--max_words 20")
+
+	// Without validate_input the schema only documents the agent
+	unchecked := summarizerAgent(t)
+	unchecked.ID = "unchecked"
+	unchecked.ValidateInput = false
+	require.Equal(t, http.StatusCreated, registerAgent(router, unchecked).Code)
+	recorder = postExecute(router, "unchecked", map[string]interface{}{"input": "text", "parameters": map[string]interface{}{"max_words": 1000}})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestAgentInputSchemaRejectedAtRegistration(t *testing.T) {
+	router := newInputSchemaRouter(t)
+
+	for name, schema := range map[string]models.JSONSchema{
+		"unknown type":      {"type": "text"},
+		"draft-04 boundary": {"type": "object", "properties": map[string]interface{}{"n": map[string]interface{}{"exclusiveMinimum": true}}},
+		"bad pattern":       {"type": "string", "pattern": "("},
+		"reference":         {"$ref": "#/definitions/input"},
+	} {
+		agent := summarizerAgent(t)
+		agent.InputSchema = schema
+		agent.Examples = nil
+		recorder := registerAgent(router, agent)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, name)
+		assert.Contains(t, recorder.Body.String(), `"field":"input_schema"`, name)
+	}
+
+	// Examples must follow the schema they document
+	agent := summarizerAgent(t)
+	agent.Examples[0].Parameters = map[string]interface{}{"max_words": 0}
+	recorder := registerAgent(router, agent)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"field":"examples[0].parameters.max_words"`)
+
+	agent = summarizerAgent(t)
+	agent.InputSchema, agent.Examples = nil, nil
+	recorder = registerAgent(router, agent)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"field":"validate_input"`)
+}
+
+func TestAgentInputSchemaDiscovery(t *testing.T) {
+	router := newInputSchemaRouter(t)
+	require.Equal(t, http.StatusCreated, registerAgent(router, summarizerAgent(t)).Code)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// GET /api/v1/agents/:id
+	agent, err := supervisorctl.NewClient(server.URL).GetAgent(context.Background(), "summarizer")
+	require.NoError(t, err)
+	assert.Equal(t, "Summarizes the input text", agent.Description)
+	assert.True(t, agent.ValidateInput)
+	require.Len(t, agent.Examples, 1)
+	assert.Equal(t, "object", agent.InputSchema["type"])
+
+	var described bytes.Buffer
+	require.NoError(t, agent.Describe(&described))
+	assert.Contains(t, described.String(), "max_words")
+	assert.Contains(t, described.String(), "1..500")
+
+	// The agent card lists the agent as a skill with its schema and examples
+	recorder := requestJSON(router, http.MethodGet, "/agents/summarizer/v1/.well-known/agent-card.json", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var card struct {
+		Description string `json:"description"`
+		Skills      []struct {
+			ID          string                 `json:"id"`
+			Description string                 `json:"description"`
+			Examples    []string               `json:"examples"`
+			InputSchema map[string]interface{} `json:"inputSchema"`
+		} `json:"skills"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &card))
+	assert.Equal(t, "Summarizes the input text", card.Description)
+	require.Len(t, card.Skills, 1)
+	assert.Equal(t, "summarizer", card.Skills[0].ID)
+	assert.Equal(t, []string{`{"input":"Long text","parameters":{"max_words":50}}`}, card.Skills[0].Examples)
+	assert.Contains(t, card.Skills[0].InputSchema, "properties")
+
+	recorder = requestJSON(router, http.MethodGet, "/agents/missing/v1/.well-known/agent-card.json", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,71 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getJSON(t *testing.T, router *gin.Engine, path string, body interface{}) int {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), body))
+	}
+	return recorder.Code
+}
+
+func TestAgentMetricsEndpoints(t *testing.T) {
+	passing := scriptAgent(t, "passing-agent", models.ReadOnlyAccessType, "echo ok\n")
+	failing := scriptAgent(t, "failing-agent", models.ReadOnlyAccessType, "exit 3\n")
+	idle := scriptAgent(t, "idle-agent", models.ReadOnlyAccessType, "echo ok\n")
+	router, _ := newExecuteRouter(t, passing, failing, idle)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, postExecute(router, "passing-agent", map[string]interface{}{}).Code)
+	}
+	postExecute(router, "failing-agent", map[string]interface{}{})
+
+	var metric services.AgentMetric
+	require.Equal(t, http.StatusOK, getJSON(t, router, "/api/v1/agents/passing-agent/metrics", &metric))
+	assert.Equal(t, "passing-agent", metric.ID)
+	assert.EqualValues(t, 3, metric.TotalExecutions)
+	assert.InDelta(t, 100.0, metric.SuccessRate, 0.01)
+	assert.Equal(t, 3, metric.WindowExecutions)
+	assert.Positive(t, int64(metric.P50ExecutionTime))
+	assert.LessOrEqual(t, metric.P50ExecutionTime, metric.P99ExecutionTime)
+	assert.Nil(t, metric.LastFailureTime)
+
+	var failed services.AgentMetric
+	require.Equal(t, http.StatusOK, getJSON(t, router, "/api/v1/agents/failing-agent/metrics", &failed))
+	assert.EqualValues(t, 1, failed.FailedExecutions)
+	assert.Zero(t, failed.SuccessRate)
+	assert.NotNil(t, failed.LastFailureTime)
+
+	// Registered agents that never ran have empty metrics; unknown agents are not found
+	var empty services.AgentMetric
+	require.Equal(t, http.StatusOK, getJSON(t, router, "/api/v1/agents/idle-agent/metrics", &empty))
+	assert.Equal(t, "idle-agent", empty.ID)
+	assert.Zero(t, empty.TotalExecutions)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/agents/missing-agent/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_NOT_FOUND", "missing agent metrics")
+
+	var summary handlers.AgentMetricsSummary
+	require.Equal(t, http.StatusOK, getJSON(t, router, "/metrics/json", &summary))
+	assert.Equal(t, 2, summary.Total)
+	require.Len(t, summary.Agents, 2)
+	assert.Equal(t, "failing-agent", summary.Agents[0].ID)
+	assert.Equal(t, "passing-agent", summary.Agents[1].ID)
+	assert.Equal(t, services.DefaultMetricsWindow.Seconds(), summary.WindowSeconds)
+}
@@ -0,0 +1,161 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOperationsFixture serves an agent whose executions run long enough for a restart to drain them;
+// they ignore the stop signal, so a restart waits for them to finish
+func newOperationsFixture(t *testing.T) *pipelineFixture {
+	return newPipelineFixture(t, scriptAgent(t, "ops-agent", models.ReadOnlyAccessType, "trap '' TERM\nsleep 0.5\necho done\n"))
+}
+
+// startOpsExecution starts an execution of ops-agent and waits until it runs
+func startOpsExecution(t *testing.T, f *pipelineFixture) string {
+	pending, _, err := f.coordinator.Start(context.Background(), services.ExecutionRequest{AgentID: "ops-agent", Input: "x"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		execution, err := f.executionService.GetExecution(pending.ID)
+		return err == nil && execution.State == models.RunningState
+	}, 5*time.Second, 10*time.Millisecond)
+	return pending.ID
+}
+
+// concurrentRestarts sends two restart requests at once and returns their responses, along with the
+// current operation observed while they ran
+func concurrentRestarts(t *testing.T, f *pipelineFixture, query string) ([]*httptest.ResponseRecorder, models.OperationResult) {
+	responses := make([]*httptest.ResponseRecorder, 2)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = f.request(http.MethodPost, "/api/v1/agents/ops-agent/restart"+query, nil)
+		}(i)
+	}
+
+	var current models.OperationResult
+	require.Eventually(t, func() bool {
+		recorder := f.request(http.MethodGet, "/api/v1/agents/ops-agent/operations/current", nil)
+		return recorder.Code == http.StatusOK && json.Unmarshal(recorder.Body.Bytes(), &current) == nil
+	}, 2*time.Second, 5*time.Millisecond)
+	wg.Wait()
+
+	return responses, current
+}
+
+func TestAgentRestartConflict(t *testing.T) {
+	f := newOperationsFixture(t)
+	executionID := startOpsExecution(t, f)
+
+	responses, current := concurrentRestarts(t, f, "")
+
+	// The restart in flight was reported as pending
+	assert.Equal(t, "ops-agent", current.Target)
+	assert.Equal(t, models.AgentActionRestart, current.Action)
+	assert.Equal(t, models.OperationPending, current.Status)
+	assert.Equal(t, "enabled", current.ExpectedState)
+	assert.NotNil(t, current.StartedAt)
+
+	var restarted []services.AgentToggleResult
+	conflicts := 0
+	for _, response := range responses {
+		switch response.Code {
+		case http.StatusOK:
+			var result services.AgentToggleResult
+			require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+			restarted = append(restarted, result)
+		case http.StatusConflict:
+			conflicts++
+			assertErrorEnvelope(t, response.Body.Bytes(), "OPERATION_IN_PROGRESS", "concurrent restart")
+			assert.Contains(t, response.Body.String(), "restart operation in progress")
+		default:
+			t.Fatalf("unexpected status %d: %s", response.Code, response.Body.String())
+		}
+	}
+
+	// Exactly one restart cancelled the execution and left the agent enabled
+	require.Len(t, restarted, 1)
+	assert.Equal(t, 1, conflicts)
+	assert.Equal(t, []string{executionID}, restarted[0].CancelledExecutions)
+	assert.True(t, restarted[0].Enabled)
+
+	execution, err := f.executionService.GetExecution(executionID)
+	require.NoError(t, err)
+	assert.EqualValues(t, models.CancelledState, execution.State)
+
+	// The executions API shows why the execution was cancelled
+	recorder := f.request(http.MethodGet, "/api/v1/executions/"+executionID, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var fetched struct {
+		Execution models.AgentExecution `json:"execution"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &fetched))
+	history := fetched.Execution.StateHistory
+	require.NotEmpty(t, history)
+	cancelled := history[len(history)-1]
+	assert.EqualValues(t, models.CancelledState, cancelled.ToState)
+	assert.Equal(t, "agent restarted", cancelled.Reason)
+	assert.NotEmpty(t, cancelled.RequestedBy)
+
+	// Nothing is in progress any more
+	assert.Equal(t, http.StatusNoContent, f.request(http.MethodGet, "/api/v1/agents/ops-agent/operations/current", nil).Code)
+}
+
+func TestAgentRestartWait(t *testing.T) {
+	f := newOperationsFixture(t)
+	executionID := startOpsExecution(t, f)
+
+	responses, _ := concurrentRestarts(t, f, "?wait=true")
+
+	// Both restarts succeed one after the other; only the first had an execution to cancel
+	var cancelled []string
+	for _, response := range responses {
+		require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+		var result services.AgentToggleResult
+		require.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+		cancelled = append(cancelled, result.CancelledExecutions...)
+	}
+	assert.Equal(t, []string{executionID}, cancelled)
+}
+
+func TestAgentOperationWaitTimeout(t *testing.T) {
+	f := newOperationsFixture(t)
+	f.coordinator.SetOperationWaitTimeout(50 * time.Millisecond)
+	startOpsExecution(t, f)
+
+	restarted := make(chan int, 1)
+	go func() {
+		restarted <- f.request(http.MethodPost, "/api/v1/agents/ops-agent/restart", nil).Code
+	}()
+	require.Eventually(t, func() bool {
+		return f.request(http.MethodGet, "/api/v1/agents/ops-agent/operations/current", nil).Code == http.StatusOK
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Enabling and disabling conflict with the restart too, and waiting gives up after the timeout
+	recorder := f.request(http.MethodPost, "/api/v1/agents/ops-agent/disable?wait=true", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "OPERATION_IN_PROGRESS", "disable while restarting")
+	assert.Contains(t, recorder.Body.String(), "after waiting 50ms")
+	recorder = f.request(http.MethodPost, "/api/v1/agents/ops-agent/enable", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	assert.Equal(t, http.StatusOK, <-restarted)
+	assert.Equal(t, http.StatusOK, f.request(http.MethodPost, "/api/v1/agents/ops-agent/disable", nil).Code)
+
+	// Unknown agents have no operations
+	recorder = f.request(http.MethodGet, "/api/v1/agents/missing/operations/current", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, http.StatusNotFound, f.request(http.MethodPost, "/api/v1/agents/missing/restart", nil).Code)
+}
@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newStatusPollRouter serves the REST routes with an event bus waking held status requests
+func newStatusPollRouter(t *testing.T, agents ...*models.AgentConfiguration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	agentService.SetExecutionService(executionService)
+	bus := services.NewEventBus(logger)
+	executionService.SetEventBus(bus)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		EventBus:             bus,
+		Logger:               logger,
+	})
+	return router
+}
+
+// getStatus requests path, naming etag in If-None-Match when set
+func getStatus(router *gin.Engine, path, etag string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAgentStatusConditionalRequests(t *testing.T) {
+	router := newStatusPollRouter(t,
+		scriptAgent(t, "status-a", models.ReadOnlyAccessType, "echo a\n"),
+		scriptAgent(t, "status-b", models.ReadOnlyAccessType, "echo b\n"))
+
+	recorder := getStatus(router, "/api/v1/agents/status", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	etag := recorder.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	var statuses handlers.AgentStatusesResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &statuses))
+	require.Len(t, statuses.Agents, 2)
+	assert.Equal(t, "status-a", statuses.Agents[0].ID)
+	assert.Equal(t, "idle", statuses.Agents[0].Status)
+
+	// Unchanged statuses are not sent again, whether the ETag is a header or a parameter
+	recorder = getStatus(router, "/api/v1/agents/status", etag)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+	assert.Equal(t, etag, recorder.Header().Get("ETag"))
+	recorder = getStatus(router, "/api/v1/agents/status?etag="+url.QueryEscape(etag), "")
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, http.StatusNotModified, getStatus(router, "/api/v1/agents/status", `"stale", `+etag).Code)
+
+	// A single agent's status has its own ETag
+	recorder = getStatus(router, "/api/v1/agents/status-a/status", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	agentETag := recorder.Header().Get("ETag")
+	assert.NotEqual(t, etag, agentETag)
+	assert.Equal(t, http.StatusNotModified, getStatus(router, "/api/v1/agents/status-a/status", agentETag).Code)
+
+	// A run changes the status of its agent and of the set
+	require.Equal(t, http.StatusOK, postExecute(router, "status-b", map[string]interface{}{"input": "x"}).Code)
+	recorder = getStatus(router, "/api/v1/agents/status", etag)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, getStatus(router, "/api/v1/agents/status-a/status", agentETag).Code)
+
+	assert.Equal(t, http.StatusBadRequest, getStatus(router, "/api/v1/agents/status?wait=soon", etag).Code)
+}
+
+func TestAgentStatusLongPollReturnsOnTransition(t *testing.T) {
+	router := newStatusPollRouter(t, scriptAgent(t, "poll-agent", models.ReadOnlyAccessType, "sleep 1\n"))
+	etag := getStatus(router, "/api/v1/agents/status", "").Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// The held request returns as soon as the agent starts running, long before the wait expires
+	responses := make(chan *httptest.ResponseRecorder, 1)
+	started := time.Now()
+	go func() {
+		responses <- getStatus(router, "/api/v1/agents/status?wait=30s&etag="+url.QueryEscape(etag), "")
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, http.StatusAccepted, postExecute(router, "poll-agent", map[string]interface{}{"input": "x", "async": true}).Code)
+
+	var recorder *httptest.ResponseRecorder
+	select {
+	case recorder = <-responses:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the held status request did not return on the transition")
+	}
+	assert.Less(t, time.Since(started), 5*time.Second)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+	var statuses handlers.AgentStatusesResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &statuses))
+	require.Len(t, statuses.Agents, 1)
+	assert.Equal(t, "running", statuses.Agents[0].Status)
+}
+
+func TestAgentStatusLongPollExpires(t *testing.T) {
+	router := newStatusPollRouter(t, scriptAgent(t, "quiet-agent", models.ReadOnlyAccessType, "echo quiet\n"))
+	etag := getStatus(router, "/api/v1/agents/quiet-agent/status", "").Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Nothing changes, so the request is held for the whole wait and answered with 304
+	started := time.Now()
+	recorder := getStatus(router, "/api/v1/agents/quiet-agent/status?wait=1500ms", etag)
+	elapsed := time.Since(started)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, etag, recorder.Header().Get("ETag"))
+	assert.GreaterOrEqual(t, elapsed, 1500*time.Millisecond)
+	assert.Less(t, elapsed, 5*time.Second)
+
+	// A stale ETag is answered at once, without waiting
+	started = time.Now()
+	recorder = getStatus(router, "/api/v1/agents/quiet-agent/status?wait=30s", `W/"stale"`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Less(t, time.Since(started), time.Second)
+}
@@ -0,0 +1,44 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentStatusEndpoint(t *testing.T) {
+	router, agentService := newTemplateRouter(t)
+	require.NoError(t, agentService.RegisterAgent(validationAgent("status-agent", "")))
+
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/agents/status-agent/status", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var status services.AgentStatus
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, "status-agent", status.ID)
+	assert.Equal(t, "idle", status.Status)
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents/missing/status", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AGENT_NOT_FOUND", "unknown agent")
+
+	// supervisorctl wait agent sees the agent disabled
+	require.NoError(t, agentService.SetAgentEnabled("status-agent", false))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+	waited, err := client.WaitAgent(context.Background(), "status-agent", "disabled",
+		supervisorctl.WaitOptions{Timeout: 5 * time.Second, PollInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, "disabled", waited.Status)
+
+	_, err = client.WaitAgent(context.Background(), "missing", "idle", supervisorctl.WaitOptions{Timeout: time.Second})
+	assert.Equal(t, supervisorctl.ExitFailure, supervisorctl.ExitCode(err))
+}
@@ -0,0 +1,169 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newStreamServer serves the REST routes over HTTP with quick stream heartbeats and returns a
+// client of it
+func newStreamServer(t *testing.T, agents ...*models.AgentConfiguration) (*supervisorctl.Client, *services.ExecutionService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+		StreamHeartbeat:      50 * time.Millisecond,
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return supervisorctl.NewClient(server.URL), executionService
+}
+
+// collectStream reads events until the stream closes
+func collectStream(t *testing.T, events <-chan supervisorctl.StreamEvent) []supervisorctl.StreamEvent {
+	var collected []supervisorctl.StreamEvent
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, event)
+		case <-timeout:
+			t.Fatal("execution stream did not close")
+		}
+	}
+}
+
+func TestStreamExecuteEventOrder(t *testing.T) {
+	client, _ := newStreamServer(t, scriptAgent(t, "slow-agent", models.ReadOnlyAccessType, "echo one\nsleep 0.3\necho two\n"))
+
+	events, err := client.StreamExecute(context.Background(), "slow-agent", supervisorctl.StreamExecuteRequest{Input: "x"})
+	require.NoError(t, err)
+	collected := collectStream(t, events)
+
+	// Heartbeats fill the quiet stretch; everything else arrives in execution order
+	var order []string
+	var output string
+	heartbeats := 0
+	for _, event := range collected {
+		require.NoError(t, event.Err)
+		switch event.Name {
+		case supervisorctl.EventHeartbeat:
+			heartbeats++
+			assert.False(t, event.Heartbeat.Time.IsZero())
+		case supervisorctl.EventState:
+			order = append(order, "state:"+event.State.State)
+		case supervisorctl.EventOutput:
+			assert.Equal(t, "stdout", event.Output.Stream)
+			if len(order) == 0 || order[len(order)-1] != "output" {
+				order = append(order, "output")
+			}
+			output += event.Output.Data
+		case supervisorctl.EventResult:
+			order = append(order, "result")
+		}
+	}
+	assert.Equal(t, []string{"state:starting", "state:running", "output", "result"}, order)
+	assert.Equal(t, "one\ntwo\n", output)
+	assert.Positive(t, heartbeats)
+
+	// The result closes the stream and names the execution its state events announced
+	last := collected[len(collected)-1]
+	require.NotNil(t, last.Result)
+	assert.Equal(t, collected[0].State.ExecutionID, last.Result.ExecutionID)
+	assert.Equal(t, "slow-agent", last.Result.AgentID)
+	assert.Equal(t, "completed", last.Result.State)
+	assert.Equal(t, "success", last.Result.Status)
+	assert.Equal(t, 0, last.Result.ExitCode)
+	assert.Contains(t, last.Result.Output, "one")
+	assert.Contains(t, last.Result.Output, "two")
+	assert.GreaterOrEqual(t, last.Result.ExecutionTime, int64(300))
+}
+
+func TestStreamExecuteUnknownAgent(t *testing.T) {
+	client, _ := newStreamServer(t)
+
+	_, err := client.StreamExecute(context.Background(), "missing", supervisorctl.StreamExecuteRequest{Input: "x"})
+	var apiErr *supervisorctl.APIError
+	require.True(t, errors.As(err, &apiErr), "expected an API error, got %v", err)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "AGENT_NOT_FOUND", apiErr.Code)
+}
+
+// disconnectMidRun starts a stream, closes it once the agent has written output and returns the
+// execution ID
+func disconnectMidRun(t *testing.T, client *supervisorctl.Client, cancelOnDisconnect bool) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := client.StreamExecute(ctx, "long-agent", supervisorctl.StreamExecuteRequest{
+		Input:              "x",
+		CancelOnDisconnect: cancelOnDisconnect,
+	})
+	require.NoError(t, err)
+
+	executionID := ""
+	for event := range events {
+		require.NoError(t, event.Err)
+		if event.State != nil {
+			executionID = event.State.ExecutionID
+		}
+		if event.Output != nil {
+			break
+		}
+	}
+	require.NotEmpty(t, executionID)
+	cancel()
+	return executionID
+}
+
+func TestStreamExecuteCancelOnDisconnect(t *testing.T) {
+	client, executionService := newStreamServer(t, scriptAgent(t, "long-agent", models.ReadOnlyAccessType, "echo started\nexec sleep 1\n"))
+
+	// Without the flag the agent outlives the stream
+	executionID := disconnectMidRun(t, client, false)
+	require.Eventually(t, func() bool {
+		execution, err := executionService.GetExecution(executionID)
+		return err == nil && execution.State == models.CompletedState
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// With it the execution stops well before the agent would have finished
+	executionID = disconnectMidRun(t, client, true)
+	var execution *models.AgentExecution
+	require.Eventually(t, func() bool {
+		var err error
+		execution, err = executionService.GetExecution(executionID)
+		return err == nil && execution.EndTime != nil
+	}, 700*time.Millisecond, 20*time.Millisecond)
+	assert.NotEqualValues(t, models.CompletedState, execution.State)
+}
@@ -0,0 +1,171 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newTemplateRouter serves the agent and agent template routes
+func newTemplateRouter(t *testing.T) (*gin.Engine, *services.AgentService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		AgentDefaultsService: agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	return router, agentService
+}
+
+// requestJSON sends body, when not nil, to path with method and returns the response
+func requestJSON(router *gin.Engine, method, path string, body map[string]interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// templateSettings are the settings shared by the agents of the tests
+var templateSettings = map[string]interface{}{
+	"agent_type":                "test-type",
+	"executable_path":           "/bin/cat",
+	"envs":                      map[string]string{"LOG_LEVEL": "info"},
+	"mode":                      "task",
+	"input_pattern":             "stdin",
+	"output_pattern":            "stdout",
+	"access_type":               "read-only",
+	"max_concurrent_executions": 2,
+	"timeout":                   60,
+	"enabled":                   true,
+}
+
+func TestAgentTemplateCRUD(t *testing.T) {
+	router, _ := newTemplateRouter(t)
+
+	recorder := postJSON(router, "/api/v1/agent-templates", map[string]interface{}{"name": "shared", "settings": templateSettings})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = postJSON(router, "/api/v1/agent-templates", map[string]interface{}{"name": "shared", "settings": templateSettings})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "TEMPLATE_CONFLICT", "duplicate template")
+
+	// The agent names only what differs from the template
+	recorder = postJSON(router, "/api/v1/agents", map[string]interface{}{
+		"id": "agent-1", "name": "Agent 1", "template": "shared",
+		"executable_path": "/bin/echo", "envs": map[string]string{"REGION": "eu"},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var agent models.AgentConfiguration
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &agent))
+	assert.Equal(t, "/bin/echo", agent.ExecutablePath)
+	assert.Equal(t, 60, agent.Timeout)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "REGION": "eu"}, agent.Envs)
+
+	recorder = postJSON(router, "/api/v1/agents", map[string]interface{}{"id": "agent-2", "name": "Agent 2", "template": "missing"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "unknown template")
+
+	// Updates propagate to the agents using the template by default
+	updated := map[string]interface{}{}
+	for key, value := range templateSettings {
+		updated[key] = value
+	}
+	updated["timeout"] = 120
+	recorder = requestJSON(router, http.MethodPut, "/api/v1/agent-templates/shared", map[string]interface{}{"settings": updated})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents/agent-1", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &agent))
+	assert.Equal(t, 120, agent.Timeout)
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agent-templates", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var list struct {
+		Templates []models.AgentTemplate `json:"templates"`
+		Total     int                    `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Equal(t, 1, list.Total)
+	assert.Equal(t, 120, list.Templates[0].Settings.Timeout)
+
+	// Templates in use cannot be deleted
+	recorder = requestJSON(router, http.MethodDelete, "/api/v1/agent-templates/shared", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "TEMPLATE_IN_USE", "template in use")
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agent-templates/missing", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "TEMPLATE_NOT_FOUND", "unknown template")
+}
+
+func TestAgentTemplateClient(t *testing.T) {
+	router, agentService := newTemplateRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	require.NoError(t, client.CreateAgentTemplate(ctx, supervisorctl.AgentTemplate{
+		Name: "shared",
+		Settings: supervisorctl.AgentSpec{
+			ExecutablePath: "/bin/cat", Mode: "task", InputPattern: "stdin", OutputPattern: "stdout",
+			AccessType: "read-only", MaxConcurrentExecutions: 2, Timeout: 60, Enabled: true,
+		},
+	}))
+
+	// supervisorctl agent add --template shared
+	agent, err := client.AddAgent(ctx, supervisorctl.AgentSpec{ID: "agent-1", Name: "Agent 1", Template: "shared", Timeout: 30})
+	require.NoError(t, err)
+	assert.Equal(t, "/bin/cat", agent.ExecutablePath)
+	assert.Equal(t, 30, agent.Timeout)
+
+	template, err := client.GetAgentTemplate(ctx, "shared")
+	require.NoError(t, err)
+	template.Settings.ExecutablePath = "/bin/echo"
+	require.NoError(t, client.UpdateAgentTemplate(ctx, *template))
+	agent, err = client.GetAgent(ctx, "agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, "/bin/echo", agent.ExecutablePath)
+
+	err = client.DeleteAgentTemplate(ctx, "shared")
+	var apiErr *supervisorctl.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, "TEMPLATE_IN_USE", apiErr.Code)
+
+	require.NoError(t, agentService.DeleteAgent("agent-1"))
+	require.NoError(t, client.DeleteAgentTemplate(ctx, "shared"))
+	templates, err := client.ListAgentTemplates(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, templates)
+}
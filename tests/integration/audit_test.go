@@ -0,0 +1,235 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newAuditRouter serves the REST API behind the audit middleware, recording to an audit log at path
+func newAuditRouter(t *testing.T, path string) (*gin.Engine, *services.AuditLog) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	auditLog, err := services.NewAuditLog(path, 1<<20, 3, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+
+	router := gin.New()
+	router.Use(logging.RequestIDMiddleware())
+	router.Use(middleware.Audit(auditLog, logger))
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		AuditLog:             auditLog,
+		Logger:               logger,
+	})
+	return router, auditLog
+}
+
+// requestAs sends body, when not nil, to path with method as the holder of token
+func requestAs(router *gin.Engine, token, method, path string, body map[string]interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// readAuditEntries decodes the entries of an audit file in order
+func readAuditEntries(t *testing.T, path string) []models.AuditEntry {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entries []models.AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry models.AuditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// queryAudit fetches GET /api/v1/audit with query
+func queryAudit(t *testing.T, router *gin.Engine, query string) services.AuditPage {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/audit?"+query, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var page services.AuditPage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	return page
+}
+
+func TestAuditLogRecordsMutatingRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	router, auditLog := newAuditRouter(t, path)
+
+	agent := map[string]interface{}{"id": "audited-agent", "name": "Audited agent"}
+	for key, value := range templateSettings {
+		agent[key] = value
+	}
+	recorder := requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents", agent)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = requestAs(router, "bob-token", http.MethodPost, "/tasks", map[string]interface{}{
+		"name": "nightly", "agent_id": "audited-agent", "cron_expression": "@every 1h", "enabled": true,
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	require.Equal(t, http.StatusOK, requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents/audited-agent/disable", nil).Code)
+	require.Equal(t, http.StatusOK, requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents/audited-agent/enable", nil).Code)
+	require.Equal(t, http.StatusOK, requestAs(router, "bob-token", http.MethodDelete, "/tasks/"+created.TaskID, nil).Code)
+	require.Equal(t, http.StatusNotFound, requestAs(router, "bob-token", http.MethodPost, "/api/v1/agents/missing/disable", nil).Code)
+
+	// Reads are not audited
+	require.Equal(t, http.StatusOK, requestAs(router, "alice-token", http.MethodGet, "/api/v1/agents/audited-agent", nil).Code)
+
+	alice := services.ClientIDForToken("alice-token")
+	bob := services.ClientIDForToken("bob-token")
+	expected := []struct {
+		actor, action, target, outcome string
+		status                         int
+	}{
+		{alice, "agents.create", "", models.AuditOutcomeSuccess, http.StatusCreated},
+		{bob, "tasks.create", "", models.AuditOutcomeSuccess, http.StatusCreated},
+		{alice, "agents.disable", "audited-agent", models.AuditOutcomeSuccess, http.StatusOK},
+		{alice, "agents.enable", "audited-agent", models.AuditOutcomeSuccess, http.StatusOK},
+		{bob, "tasks.delete", created.TaskID, models.AuditOutcomeSuccess, http.StatusOK},
+		{bob, "agents.disable", "missing", models.AuditOutcomeFailure, http.StatusNotFound},
+	}
+
+	entries := readAuditEntries(t, path)
+	require.Len(t, entries, len(expected))
+	for i, want := range expected {
+		entry := entries[i]
+		assert.Equal(t, int64(i+1), entry.Sequence)
+		assert.Equal(t, want.actor, entry.Actor, "entry %d", i)
+		assert.Equal(t, want.action, entry.Action, "entry %d", i)
+		assert.Equal(t, want.target, entry.Target, "entry %d", i)
+		assert.Equal(t, want.outcome, entry.Outcome, "entry %d", i)
+		assert.Equal(t, want.status, entry.Status, "entry %d", i)
+		assert.NotEmpty(t, entry.SourceIP)
+		assert.NotEmpty(t, entry.RequestID)
+		assert.NotEmpty(t, entry.Hash)
+		if i > 0 {
+			assert.Equal(t, entries[i-1].Hash, entry.PrevHash, "entry %d", i)
+		}
+	}
+	assert.Equal(t, "POST /api/v1/agents/audited-agent/disable", entries[2].Summary)
+	require.NoError(t, auditLog.Verify())
+
+	// Editing an entry breaks the chain
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	tampered := strings.Replace(string(data), `"actor":"`+bob+`"`, `"actor":"`+alice+`"`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(tampered), 0644))
+	assert.Error(t, auditLog.Verify())
+}
+
+func TestAuditQueryFilters(t *testing.T) {
+	router, _ := newAuditRouter(t, filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	agent := map[string]interface{}{"id": "queried-agent", "name": "Queried agent"}
+	for key, value := range templateSettings {
+		agent[key] = value
+	}
+	require.Equal(t, http.StatusCreated, requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents", agent).Code)
+	for i := 0; i < 2; i++ {
+		requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents/queried-agent/disable", nil)
+		requestAs(router, "bob-token", http.MethodPost, "/api/v1/agents/queried-agent/enable", nil)
+	}
+	requestAs(router, "bob-token", http.MethodPost, "/tasks", map[string]interface{}{
+		"name": "hourly", "agent_id": "queried-agent", "cron_expression": "@every 1h", "enabled": true,
+	})
+
+	all := queryAudit(t, router, "")
+	assert.Equal(t, 6, all.Total)
+	assert.Len(t, all.Entries, 6)
+
+	byActor := queryAudit(t, router, "actor="+services.ClientIDForToken("bob-token"))
+	assert.Equal(t, 3, byActor.Total)
+	for _, entry := range byActor.Entries {
+		assert.Equal(t, services.ClientIDForToken("bob-token"), entry.Actor)
+	}
+
+	assert.Equal(t, 5, queryAudit(t, router, "action=agents").Total)
+	assert.Equal(t, 2, queryAudit(t, router, "action=agents.disable").Total)
+	assert.Equal(t, 0, queryAudit(t, router, "action=agent").Total)
+	assert.Equal(t, 0, queryAudit(t, router, "since="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)).Total)
+	assert.Equal(t, 6, queryAudit(t, router, "since="+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)).Total)
+
+	page := queryAudit(t, router, "action=agents&offset=2&limit=2")
+	assert.Equal(t, 5, page.Total)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, int64(3), page.Entries[0].Sequence)
+	assert.Equal(t, int64(4), page.Entries[1].Sequence)
+
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/audit?since=yesterday", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "invalid since")
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/audit?limit=-1", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestAuditFailClosed(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "audit")
+	router, auditLog := newAuditRouter(t, filepath.Join(directory, "audit.jsonl"))
+
+	// Replacing the audit directory with a regular file makes the log impossible to create
+	require.NoError(t, os.RemoveAll(directory))
+	require.NoError(t, os.WriteFile(directory, nil, 0644))
+
+	agent := map[string]interface{}{"id": "blocked-agent", "name": "Blocked agent"}
+	for key, value := range templateSettings {
+		agent[key] = value
+	}
+
+	// Fail-open lets the request through although it cannot be recorded
+	recorder := requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents", agent)
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	auditLog.SetFailClosed(true)
+	agent["id"] = "rejected-agent"
+	recorder = requestAs(router, "alice-token", http.MethodPost, "/api/v1/agents", agent)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "AUDIT_UNAVAILABLE", "fail-closed")
+
+	// The rejected request never reached its handler, and reads are unaffected
+	assert.Equal(t, http.StatusNotFound, requestAs(router, "alice-token", http.MethodGet, "/api/v1/agents/rejected-agent", nil).Code)
+	assert.Equal(t, http.StatusOK, requestAs(router, "alice-token", http.MethodGet, "/api/v1/agents/blocked-agent", nil).Code)
+}
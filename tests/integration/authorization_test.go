@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// authorizationTokens grants each built-in role to the token named after it, and execute-token
+// a list of permissions
+var authorizationTokens = map[string]middleware.TokenGrant{
+	"viewer-token":   {Role: models.RoleViewer},
+	"operator-token": {Role: models.RoleOperator},
+	"admin-token":    {Role: models.RoleAdmin},
+	"execute-token":  {Permissions: []models.Permission{models.PermissionRead, models.PermissionExecute}},
+}
+
+// newAuthorizationRouter serves the REST API behind the audit and authorization middleware over
+// one agent, auth-agent, run by the scheduled task auth-task
+func newAuthorizationRouter(t *testing.T, auditPath string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	auditLog, err := services.NewAuditLog(auditPath, 1<<20, 3, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(scriptAgent(t, "auth-agent", models.ReadOnlyAccessType, "echo ok\n")))
+	executionService := services.NewExecutionService(agentService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	require.NoError(t, schedulerService.ScheduleTask(&models.ScheduledTask{
+		ID: "auth-task", Name: "Auth Task", AgentID: "auth-agent", CronExpression: "@every 1h", Enabled: true,
+	}))
+	t.Cleanup(func() { schedulerService.UnscheduleTask("auth-task") })
+
+	authorizer := middleware.NewAuthorizer(middleware.AuthorizationConfig{Enabled: true, Tokens: authorizationTokens},
+		handlers.RoutePermissions(), logger)
+
+	router := gin.New()
+	router.Use(middleware.Audit(auditLog, logger))
+	router.Use(authorizer.Middleware())
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		SchedulerService:     schedulerService,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		ConfigValidator:      services.NewConfigValidator(nil, a2a.DefaultA2AConfig(), agentService, schedulerService, logger),
+		AuditLog:             auditLog,
+		StateService:         services.NewStateService(agentService, agentService, schedulerService, logger),
+		Logger:               logger,
+	})
+	return router
+}
+
+func TestAuthorizationRoleMatrix(t *testing.T) {
+	router := newAuthorizationRouter(t, filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	// Each endpoint lists the least privileged role allowed to call it
+	endpoints := []struct {
+		method, path string
+		body         map[string]interface{}
+		role         models.Role
+	}{
+		{http.MethodGet, "/api/v1/agents", nil, models.RoleViewer},
+		{http.MethodGet, "/api/v1/agents/auth-agent/status", nil, models.RoleViewer},
+		{http.MethodGet, "/api/v1/executions", nil, models.RoleViewer},
+		{http.MethodGet, "/tasks", nil, models.RoleViewer},
+		{http.MethodGet, "/metrics", nil, models.RoleViewer},
+		{http.MethodPost, "/api/v1/agents/auth-agent/execute", map[string]interface{}{"input": "x"}, models.RoleOperator},
+		{http.MethodPost, "/tasks/auth-task/pause", nil, models.RoleOperator},
+		{http.MethodPost, "/tasks/auth-task/resume", nil, models.RoleOperator},
+		{http.MethodPost, "/api/v1/agents/auth-agent/disable", nil, models.RoleOperator},
+		{http.MethodPost, "/api/v1/agents/auth-agent/enable", nil, models.RoleOperator},
+		{http.MethodPost, "/api/v1/executions/missing/stop", nil, models.RoleOperator},
+		{http.MethodPost, "/api/v1/agent-templates", map[string]interface{}{"name": "auth-template"}, models.RoleAdmin},
+		{http.MethodDelete, "/api/v1/agents/missing", nil, models.RoleAdmin},
+		{http.MethodDelete, "/tasks/missing", nil, models.RoleAdmin},
+		{http.MethodGet, "/api/v1/export", nil, models.RoleAdmin},
+		{http.MethodPost, "/api/v1/config/validate", nil, models.RoleAdmin},
+		{http.MethodGet, "/api/v1/audit", nil, models.RoleAdmin},
+	}
+	rank := map[models.Role]int{models.RoleViewer: 0, models.RoleOperator: 1, models.RoleAdmin: 2}
+
+	for _, role := range models.Roles {
+		for _, endpoint := range endpoints {
+			recorder := requestAs(router, string(role)+"-token", endpoint.method, endpoint.path, endpoint.body)
+			if rank[role] >= rank[endpoint.role] {
+				assert.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, recorder.Code,
+					"%s should be allowed %s %s: %s", role, endpoint.method, endpoint.path, recorder.Body.String())
+				continue
+			}
+
+			require.Equal(t, http.StatusForbidden, recorder.Code, "%s should be denied %s %s", role, endpoint.method, endpoint.path)
+			assertErrorEnvelope(t, recorder.Body.Bytes(), "FORBIDDEN", "denied request")
+			var envelope struct {
+				Details map[string]string `json:"details"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &envelope))
+			assert.Equal(t, string(endpoint.role), envelope.Details["required_role"], "%s %s", endpoint.method, endpoint.path)
+			assert.Equal(t, string(role), envelope.Details["role"])
+			assert.NotEmpty(t, envelope.Details["required_permission"])
+		}
+	}
+}
+
+func TestAuthorizationPermissionListsAndMissingTokens(t *testing.T) {
+	router := newAuthorizationRouter(t, filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	// A token granted permissions rather than a role may run agents but not operate them
+	recorder := requestAs(router, "execute-token", http.MethodPost, "/api/v1/agents/auth-agent/execute", map[string]interface{}{"input": "x"})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = requestAs(router, "execute-token", http.MethodPost, "/tasks/auth-task/pause", nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	var envelope struct {
+		Details map[string]string `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &envelope))
+	assert.Equal(t, map[string]string{"required_permission": "operate", "required_role": "operator"}, envelope.Details)
+
+	// Unknown and missing tokens are not authenticated
+	recorder = requestAs(router, "stolen-token", http.MethodGet, "/api/v1/agents", nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "UNAUTHORIZED", "unknown token")
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents", nil)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// Health checks and the API description need no token
+	assert.Equal(t, http.StatusOK, requestJSON(router, http.MethodGet, "/health", nil).Code)
+	assert.Equal(t, http.StatusOK, requestJSON(router, http.MethodGet, "/api/v1/openapi.json", nil).Code)
+}
+
+func TestAuthorizationDecisionsAreAudited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	router := newAuthorizationRouter(t, path)
+
+	require.Equal(t, http.StatusForbidden, requestAs(router, "viewer-token", http.MethodPost, "/tasks/auth-task/pause", nil).Code)
+	require.Equal(t, http.StatusOK, requestAs(router, "operator-token", http.MethodPost, "/tasks/auth-task/pause", nil).Code)
+	require.Equal(t, http.StatusForbidden, requestAs(router, "operator-token", http.MethodGet, "/api/v1/audit", nil).Code)
+	// Permitted reads are not audited
+	require.Equal(t, http.StatusOK, requestAs(router, "admin-token", http.MethodGet, "/api/v1/audit", nil).Code)
+
+	entries := readAuditEntries(t, path)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "tasks.pause", entries[0].Action)
+	assert.Equal(t, services.ClientIDForToken("viewer-token"), entries[0].Actor)
+	assert.Equal(t, "viewer", entries[0].Role)
+	assert.Equal(t, "operate", entries[0].Permission)
+	assert.Equal(t, models.AuditDecisionDeny, entries[0].Decision)
+	assert.Equal(t, http.StatusForbidden, entries[0].Status)
+	assert.Equal(t, models.AuditOutcomeFailure, entries[0].Outcome)
+
+	assert.Equal(t, "operator", entries[1].Role)
+	assert.Equal(t, models.AuditDecisionAllow, entries[1].Decision)
+	assert.Equal(t, models.AuditOutcomeSuccess, entries[1].Outcome)
+
+	assert.Equal(t, "audit.read", entries[2].Action)
+	assert.Equal(t, "admin", entries[2].Permission)
+	assert.Equal(t, models.AuditDecisionDeny, entries[2].Decision)
+}
+
+func TestAuthorizationClientNamesRequiredRole(t *testing.T) {
+	server := httptest.NewServer(newAuthorizationRouter(t, filepath.Join(t.TempDir(), "audit.jsonl")))
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+	client.SetToken("viewer-token")
+
+	err := client.DeleteAgent(context.Background(), "auth-agent", false)
+	require.Error(t, err)
+	assert.Equal(t, supervisorctl.ExitUnauthorized, supervisorctl.ExitCode(err))
+
+	var output bytes.Buffer
+	require.True(t, supervisorctl.PrintPermissionError(&output, err))
+	assert.Equal(t, "permission denied: this requires the manage permission, granted by the admin role; your token has the viewer role\n", output.String())
+
+	// Other errors are left to the caller
+	client.SetToken("admin-token")
+	err = client.DeleteAgent(context.Background(), "missing", false)
+	require.Error(t, err)
+	assert.False(t, supervisorctl.PrintPermissionError(&output, err))
+}
+
+func TestAuthorizationConfigValidation(t *testing.T) {
+	load := func(yaml string) error {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(yaml), 0600))
+		_, err := config.LoadConfigFile(path)
+		return err
+	}
+
+	require.NoError(t, load("auth:\n  enabled: true\n  tokens:\n    - token: a\n      role: viewer\n    - token: b\n      permissions: [read, execute]\n"))
+
+	for yaml, message := range map[string]string{
+		"auth:\n  enabled: true\n":               "at least one token",
+		"auth:\n  tokens:\n    - role: viewer\n": "must specify a token",
+		"auth:\n  tokens:\n    - token: a\n      role: viewer\n    - token: a\n      role: admin\n": "listed twice",
+		"auth:\n  tokens:\n    - token: a\n":                                                "either a role or permissions",
+		"auth:\n  tokens:\n    - token: a\n      role: viewer\n      permissions: [read]\n": "either a role or permissions",
+		"auth:\n  tokens:\n    - token: a\n      role: superuser\n":                         "unknown role",
+		"auth:\n  tokens:\n    - token: a\n      permissions: [delete]\n":                   "unknown permission",
+	} {
+		err := load(yaml)
+		require.Error(t, err, yaml)
+		assert.True(t, strings.Contains(err.Error(), message), "%q: %v", yaml, err)
+	}
+}
@@ -0,0 +1,68 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchRunsSyntheticAgents(t *testing.T) {
+	f := newDeleteFixture(t)
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	rate, err := supervisorctl.ParseRate("100/s")
+	require.NoError(t, err)
+	spec := supervisorctl.DefaultBenchAgent()
+	spec.Parameters = map[string]string{"duration": "5ms", "duration_max": "15ms", "failure_rate": "0.5", "output_bytes": "64"}
+	report, err := client.Bench(context.Background(), supervisorctl.BenchOptions{
+		Agents:   3,
+		Rate:     rate,
+		Duration: 300 * time.Millisecond,
+		Agent:    spec,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Agents)
+	assert.InDelta(t, 30, report.Executions, 2)
+	assert.Equal(t, report.Executions, report.Succeeded+report.Failed)
+	assert.Equal(t, report.Failed, report.Errors["failure"])
+	assert.Greater(t, report.Throughput, 0.0)
+	assert.GreaterOrEqual(t, report.Latency.P50, 5*time.Millisecond)
+	assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+	assert.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), "throughput:")
+	assert.Contains(t, out.String(), "p99")
+
+	// The benchmark agents are deleted afterwards
+	assert.Empty(t, f.listAgentIDs(t, ""))
+	assert.Len(t, f.listAgentIDs(t, "?include_deleted=true"), 3)
+}
+
+func TestBenchRejectsInvalidOptions(t *testing.T) {
+	client := supervisorctl.NewClient("http://127.0.0.1:1")
+	_, err := client.Bench(context.Background(), supervisorctl.BenchOptions{Rate: 10})
+	assert.Error(t, err)
+	_, err = client.Bench(context.Background(), supervisorctl.BenchOptions{Duration: time.Second})
+	assert.Error(t, err)
+
+	for value, expected := range map[string]float64{"100/s": 100, "600/m": 10, "7200/h": 2, "5": 5, "0.5/s": 0.5} {
+		rate, err := supervisorctl.ParseRate(value)
+		require.NoError(t, err, value)
+		assert.InDelta(t, expected, rate, 1e-9, value)
+	}
+	for _, value := range []string{"", "fast", "100/d", "0/s", "-1/s"} {
+		_, err := supervisorctl.ParseRate(value)
+		assert.Error(t, err, value)
+	}
+}
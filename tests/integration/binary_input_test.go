@@ -0,0 +1,221 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// hexInputAgent prints the path of its input file, then the file's bytes in hex
+const hexInputAgent = `echo "$SUPERVISOR_INPUT_FILE"
+od -An -tx1 < "$SUPERVISOR_INPUT_FILE" | tr -d ' \n'
+`
+
+// newBinaryInputRouter serves the REST routes with a coordinator handing binary input through inputs
+func newBinaryInputRouter(t *testing.T, inputs *services.InputMaterializer, agents ...*models.AgentConfiguration) (*gin.Engine, *services.ExecutionService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	coordinator.SetInputMaterializer(inputs)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		Logger:               logger,
+	})
+	return router, executionService
+}
+
+// errorCode returns the code of an error envelope response
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &envelope), recorder.Body.String())
+	code, _ := envelope["code"].(string)
+	return code
+}
+
+func TestBinaryInputInlineRoundTrip(t *testing.T) {
+	fileAgent := scriptAgent(t, "file-input-agent", models.ReadOnlyAccessType, "od -An -tx1 < \"$1\" | tr -d ' \\n'\n")
+	fileAgent.InputPattern = models.FilePattern
+	fileAgent.InputFileTemplate = "input.bin"
+	spool := t.TempDir()
+	router, executionService := newBinaryInputRouter(t, services.NewInputMaterializer(spool, zap.NewNop()),
+		scriptAgent(t, "env-input-agent", models.ReadOnlyAccessType, hexInputAgent), fileAgent)
+
+	data := []byte{0x00, 0x01, 0xfe, 0xff, '\n', 'P', 'N', 'G', 0x00}
+	checksum := sha256.Sum256(data)
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	// Other agents read the decoded bytes at $SUPERVISOR_INPUT_FILE
+	recorder := postExecute(router, "env-input-agent", map[string]interface{}{
+		"input_base64":       encoded,
+		"input_content_type": "application/octet-stream",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	lines := strings.SplitN(result.Output, "\n", 2)
+	require.Len(t, lines, 2, result.Output)
+	assert.Equal(t, hex.EncodeToString(data), lines[1])
+
+	// The file is gone once the execution finished, and only metadata was recorded
+	_, err := os.Stat(lines[0])
+	assert.True(t, os.IsNotExist(err), "the input file %s must be removed", lines[0])
+	executions, err := executionService.ListExecutions("env-input-agent")
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	execution := executions[0]
+	require.NotNil(t, execution.Inputs)
+	assert.Equal(t, &models.InputContent{
+		Source:      models.InputContentInline,
+		ContentType: "application/octet-stream",
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(checksum[:]),
+	}, execution.Inputs.Content)
+	record, err := json.Marshal(execution)
+	require.NoError(t, err)
+	assert.NotContains(t, string(record), encoded)
+
+	// File-pattern agents find the bytes at their input file
+	recorder = postExecute(router, "file-input-agent", map[string]interface{}{"input_base64": encoded})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, hex.EncodeToString(data), result.Output)
+
+	// Malformed requests are refused before the agent runs
+	for _, body := range []map[string]interface{}{
+		{"input_base64": "not base64!"},
+		{"input_base64": encoded, "input_url": "https://example.com/a.bin"},
+		{"input_content_type": "image/png"},
+	} {
+		recorder = postExecute(router, "env-input-agent", body)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, "%v: %s", body, recorder.Body.String())
+	}
+	entries, err := os.ReadDir(spool)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestBinaryInputURLFetch(t *testing.T) {
+	image := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}
+	var bigHits, movedHits, targetHits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(image)
+		case "/big":
+			bigHits.Add(1)
+			// Streamed without a Content-Length, so the limit is enforced while reading
+			w.(http.Flusher).Flush()
+			w.Write(make([]byte, 2048))
+		case "/moved":
+			movedHits.Add(1)
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/target":
+			targetHits.Add(1)
+			w.Write(image)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	inputs := services.NewInputMaterializer(t.TempDir(), zap.NewNop())
+	inputs.SetFetchPolicy([]string{"http"}, []string{"127.0.0.1"}, 1024, 5*time.Second)
+	router, executionService := newBinaryInputRouter(t, inputs, scriptAgent(t, "url-agent", models.ReadOnlyAccessType, hexInputAgent))
+
+	// The fetched bytes are handed over like inline ones; the recorded URL drops its query
+	recorder := postExecute(router, "url-agent", map[string]interface{}{"input_url": server.URL + "/image.png?token=secret"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.True(t, strings.HasSuffix(result.Output, "\n"+hex.EncodeToString(image)), result.Output)
+	executions, err := executionService.ListExecutions("url-agent")
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	execution := executions[0]
+	require.NotNil(t, execution.Inputs.Content)
+	assert.Equal(t, models.InputContentURL, execution.Inputs.Content.Source)
+	assert.Equal(t, server.URL+"/image.png", execution.Inputs.Content.URL)
+	assert.Equal(t, "image/png", execution.Inputs.Content.ContentType)
+	assert.EqualValues(t, len(image), execution.Inputs.Content.Size)
+
+	// Content over the limit, error statuses and redirects fail the fetch, each URL requested once
+	for path, hits := range map[string]*atomic.Int64{"/big": &bigHits, "/moved": &movedHits, "/missing": nil} {
+		recorder = postExecute(router, "url-agent", map[string]interface{}{"input_url": server.URL + path})
+		assert.Equal(t, http.StatusBadGateway, recorder.Code, "%s: %s", path, recorder.Body.String())
+		assert.Equal(t, string(api.CodeInputFetchFailed), errorCode(t, recorder), path)
+		if hits != nil {
+			assert.EqualValues(t, 1, hits.Load(), path)
+		}
+	}
+	assert.Zero(t, targetHits.Load(), "redirects are not followed")
+
+	// An asynchronous execution whose input cannot be fetched fails with its own error category
+	recorder = postExecute(router, "url-agent", map[string]interface{}{"input_url": server.URL + "/big", "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted struct {
+		ExecutionID string `json:"execution_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	require.Eventually(t, func() bool {
+		execution, err := executionService.GetExecution(accepted.ExecutionID)
+		return err == nil && execution.IsComplete()
+	}, 10*time.Second, 20*time.Millisecond)
+	execution, err = executionService.GetExecution(accepted.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.FailedState, execution.State)
+	assert.Equal(t, types.InputFetchError, execution.ErrorCategory)
+	assert.Contains(t, execution.ErrorMessage, "input limit")
+	assert.EqualValues(t, 2, bigHits.Load())
+}
+
+func TestBinaryInputURLDisallowedHost(t *testing.T) {
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	inputs := services.NewInputMaterializer(t.TempDir(), zap.NewNop())
+	inputs.SetFetchPolicy([]string{"http"}, []string{"*.example.com"}, 0, 0)
+	router, _ := newBinaryInputRouter(t, inputs, scriptAgent(t, "guarded-agent", models.ReadOnlyAccessType, hexInputAgent))
+
+	for _, url := range []string{server.URL + "/data", "ftp://files.example.com/data", "http://example.com.evil.test/data"} {
+		for _, async := range []bool{false, true} {
+			recorder := postExecute(router, "guarded-agent", map[string]interface{}{"input_url": url, "async": async})
+			assert.Equal(t, http.StatusForbidden, recorder.Code, "%s: %s", url, recorder.Body.String())
+			assert.Equal(t, string(api.CodeInputURLNotAllowed), errorCode(t, recorder), url)
+		}
+	}
+	assert.Zero(t, hits.Load(), "disallowed URLs are never requested")
+}
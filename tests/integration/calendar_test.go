@@ -0,0 +1,182 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newCalendarRouter serves the REST routes with calendars over the given agents and returns the
+// scheduler running their tasks
+func newCalendarRouter(t *testing.T, agents ...*models.AgentConfiguration) (*gin.Engine, *services.SchedulerService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	scheduler.SetCatchUpInterval(0)
+	t.Cleanup(scheduler.Stop)
+
+	calendars := services.NewCalendarService(logger)
+	calendars.SetSchedulerService(scheduler)
+	scheduler.SetCalendarService(calendars)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:           router,
+		ExecutionService: executionService,
+		AgentService:     agentService,
+		SchedulerService: scheduler,
+		CalendarService:  calendars,
+		Logger:           logger,
+	})
+	return router, scheduler
+}
+
+// sendCalendar sends a calendar request with the given content type
+func sendCalendar(router *gin.Engine, method, path, contentType, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCalendarsAPI(t *testing.T) {
+	router, _ := newCalendarRouter(t)
+
+	// Calendars are created from JSON, an iCalendar file or a YAML list of dates
+	recorder := sendCalendar(router, http.MethodPost, "/api/v1/calendars", "application/json",
+		`{"name": "exchange", "description": "Exchange holidays", "dates": ["2026-12-25", {"start": "2026-12-31", "end": "2027-01-01", "reason": "New Year"}]}`)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = sendCalendar(router, http.MethodPost, "/api/v1/calendars?name=team", "text/calendar",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20261123\r\nDTEND;VALUE=DATE:20261125\r\nSUMMARY:Offsite\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = sendCalendar(router, http.MethodPost, "/api/v1/calendars?name=freeze", "application/yaml", "- 2026-12-01..2026-12-05\n")
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/calendars", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var listed struct {
+		Calendars []models.Calendar `json:"calendars"`
+		Total     int               `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listed))
+	require.Equal(t, 3, listed.Total)
+	assert.Equal(t, "exchange", listed.Calendars[0].Name)
+	assert.Equal(t, []models.DateRange{{Start: "2026-12-01", End: "2026-12-05"}}, listed.Calendars[1].Dates)
+	assert.Equal(t, []models.DateRange{{Start: "2026-11-23", End: "2026-11-24", Reason: "Offsite"}}, listed.Calendars[2].Dates)
+
+	// Updating replaces the dates
+	recorder = sendCalendar(router, http.MethodPut, "/api/v1/calendars/exchange", "application/json", `{"dates": ["2026-12-24"]}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/calendars/exchange", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var calendar models.Calendar
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &calendar))
+	assert.Equal(t, []models.DateRange{{Start: "2026-12-24"}}, calendar.Dates)
+	assert.Empty(t, calendar.Description)
+
+	// Errors use the error envelope
+	for _, tt := range []struct {
+		method, path, contentType, body string
+		status                          int
+		code                            api.ErrorCode
+	}{
+		{http.MethodPost, "/api/v1/calendars", "application/json", `{"name": "exchange"}`, http.StatusConflict, api.CodeCalendarConflict},
+		{http.MethodPost, "/api/v1/calendars", "application/json", `{"name": "bad", "dates": ["2026-02-30"]}`, http.StatusBadRequest, api.CodeInvalidRequest},
+		{http.MethodPost, "/api/v1/calendars", "text/calendar", "BEGIN:VCALENDAR\nEND:VCALENDAR\n", http.StatusBadRequest, api.CodeValidationFailed},
+		{http.MethodPut, "/api/v1/calendars/missing", "application/json", `{"dates": []}`, http.StatusNotFound, api.CodeCalendarNotFound},
+		{http.MethodDelete, "/api/v1/calendars/missing", "application/json", "", http.StatusNotFound, api.CodeCalendarNotFound},
+	} {
+		recorder := sendCalendar(router, tt.method, tt.path, tt.contentType, tt.body)
+		require.Equal(t, tt.status, recorder.Code, "%s %s: %s", tt.method, tt.path, recorder.Body.String())
+		assert.Contains(t, recorder.Body.String(), `"code":"`+string(tt.code)+`"`, "%s %s", tt.method, tt.path)
+	}
+
+	recorder = sendCalendar(router, http.MethodDelete, "/api/v1/calendars/team", "application/json", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestCalendarDefersExcludedScheduledRuns(t *testing.T) {
+	router, scheduler := newCalendarRouter(t, scriptAgent(t, "report-agent", models.ReadOnlyAccessType, "echo ok\n"))
+
+	// A calendar excluding today, skipped by a task firing every second
+	today := time.Now().In(scheduler.Location()).Format(models.CalendarDateLayout)
+	recorder := sendCalendar(router, http.MethodPost, "/api/v1/calendars", "application/json",
+		`{"name": "closed", "dates": [{"start": "`+today+`", "reason": "Holiday"}]}`)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"name": "report", "agent_id": "report-agent", "cron_expression": "* * * * * *", "enabled": true,
+		"skip_calendars": []string{"closed"}, "defer_on_skip": true,
+	})
+	request := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		TaskID        string      `json:"task_id"`
+		NextFireTimes []time.Time `json:"next_fire_times"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	for _, fire := range created.NextFireTimes {
+		assert.NotEqual(t, today, fire.In(scheduler.Location()).Format(models.CalendarDateLayout))
+	}
+
+	// Fires on the excluded day are recorded as deferred, without running the agent
+	require.Eventually(t, func() bool {
+		task, err := scheduler.GetTask(created.TaskID)
+		return err == nil && task.DeferredRuns >= 2
+	}, 10*time.Second, 50*time.Millisecond)
+	history, err := scheduler.GetTaskHistory(created.TaskID, 20)
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	for _, run := range history {
+		assert.Equal(t, types.SkippedStatus, run.Status)
+		assert.Equal(t, models.SkipReasonCalendar, run.SkipReason)
+		assert.Contains(t, run.Error, "deferred: "+today+" is excluded by calendar closed (Holiday)")
+	}
+
+	// The calendar cannot be deleted while the task skips it
+	recorder = sendCalendar(router, http.MethodDelete, "/api/v1/calendars/closed", "application/json", "")
+	require.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), api.CodeCalendarInUse)
+
+	// Once the day is no longer excluded, the next fire runs followed by the deferred runs
+	recorder = sendCalendar(router, http.MethodPut, "/api/v1/calendars/closed", "application/json", `{"dates": []}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Eventually(t, func() bool {
+		history, _ := scheduler.GetTaskHistory(created.TaskID, 50)
+		for _, run := range history {
+			if run.TriggerType == types.TaskTriggerTypeDeferred && run.Status == types.SuccessStatus {
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NoError(t, scheduler.PauseTask(created.TaskID))
+}
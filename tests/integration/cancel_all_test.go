@@ -0,0 +1,218 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// markingAgent returns an agent that marks its start with a started-<input> file in the returned
+// directory, then runs until a file named after its input appears there
+func markingAgent(t *testing.T, id string, accessType types.AgentAccessType) (*models.AgentConfiguration, string) {
+	dir := t.TempDir()
+	body := "name=$(cat)\ntouch \"" + dir + "/started-$name\"\nwhile [ ! -f \"" + dir + "/$name\" ]; do sleep 0.02; done\necho \"$name\"\n"
+	agent := scriptAgent(t, id, accessType, body)
+	agent.MaxConcurrentExecutions = 1
+	if accessType == models.ReadOnlyAccessType {
+		agent.MaxConcurrentExecutions = 4
+	}
+	return agent, dir
+}
+
+// startInput starts an asynchronous execution of the agent with input and returns its ID
+func startInput(t *testing.T, router *gin.Engine, agentID, input string) string {
+	recorder := postExecute(router, agentID, map[string]interface{}{"input": input, "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted struct {
+		ExecutionID string `json:"execution_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	return accepted.ExecutionID
+}
+
+// postCancel posts a cascading cancellation and decodes its result
+func postCancel(t *testing.T, router *gin.Engine, path string) models.CancelAllResult {
+	recorder := requestJSON(router, http.MethodPost, path, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.CancelAllResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return result
+}
+
+// agentStatus returns the runtime status of an agent
+func agentStatus(t *testing.T, router *gin.Engine, agentID string) string {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/agents/"+agentID+"/status", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var status struct {
+		Status string `json:"status"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	return status.Status
+}
+
+func TestCancelAllAgentExecutions(t *testing.T) {
+	writer, writerDir := markingAgent(t, "cancel-writer", models.ReadWriteAccessType)
+	reader, readerDir := markingAgent(t, "cancel-reader", models.ReadOnlyAccessType)
+	router, _ := newExecuteRouter(t, writer, reader)
+
+	// Two running executions of the read-only agent
+	running := []string{startInput(t, router, "cancel-reader", "r1"), startInput(t, router, "cancel-reader", "r2")}
+	for _, input := range []string{"r1", "r2"} {
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(filepath.Join(readerDir, "started-"+input))
+			return err == nil
+		}, 5*time.Second, 20*time.Millisecond, input)
+	}
+
+	// One running execution of the read-write agent and two queued behind it
+	running = append(running, startInput(t, router, "cancel-writer", "w1"))
+	waitForRunning(t, router, "cancel-writer")
+	queued := []string{startInput(t, router, "cancel-writer", "w2"), startInput(t, router, "cancel-writer", "w3")}
+	for _, executionID := range queued {
+		require.Eventually(t, func() bool {
+			return queuedExecution(t, router, executionID).State == types.QueuedState
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+
+	result := postCancel(t, router, "/api/v1/agents/cancel-writer/cancel-all")
+	assert.Equal(t, "cancel-writer", result.AgentID)
+	assert.Equal(t, 3, result.Matched)
+	assert.Equal(t, 3, result.Cancelled)
+	require.Len(t, result.Results, 3)
+	assert.Equal(t, running[2], result.Results[0].ExecutionID)
+	assert.Equal(t, types.RunningState, result.Results[0].PreviousState)
+	for i, executionID := range queued {
+		assert.Equal(t, executionID, result.Results[i+1].ExecutionID)
+		assert.Equal(t, types.QueuedState, result.Results[i+1].PreviousState)
+		assert.Equal(t, models.CancellationCancelled, result.Results[i+1].Outcome)
+	}
+
+	result = postCancel(t, router, "/api/v1/agents/cancel-reader/cancel-all")
+	assert.Equal(t, 2, result.Cancelled)
+
+	// Four cancelled records: the running executions were stopped and the queued ones never ran
+	for _, executionID := range append(running, queued...) {
+		assert.Equal(t, types.CancelledState, queuedExecution(t, router, executionID).State, executionID)
+	}
+	assert.Equal(t, "idle", agentStatus(t, router, "cancel-writer"))
+	assert.Equal(t, "idle", agentStatus(t, router, "cancel-reader"))
+	time.Sleep(200 * time.Millisecond)
+	for _, input := range []string{"w2", "w3"} {
+		assert.NoFileExists(t, filepath.Join(writerDir, "started-"+input))
+	}
+
+	// Nothing is left to cancel, and the agent still accepts executions
+	result = postCancel(t, router, "/api/v1/agents/cancel-writer/cancel-all")
+	assert.Zero(t, result.Matched)
+	assert.Empty(t, result.Results)
+	openGate(t, writerDir, "after")
+	recorder := postExecute(router, "cancel-writer", map[string]interface{}{"input": "after"})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/missing/cancel-all", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCancelAllTaskRuns(t *testing.T) {
+	agent, dir := markingAgent(t, "cancel-task-agent", models.ReadWriteAccessType)
+	router, _ := newExecuteRouter(t, agent)
+
+	recorder := requestJSON(router, http.MethodPost, "/tasks", map[string]interface{}{
+		"name":            "cancel-task",
+		"agent_id":        "cancel-task-agent",
+		"cron_expression": "0 0 1 1 *",
+		"enabled":         true,
+		"input_template":  "task-run",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	// A direct execution of the agent is not the task's and is left running
+	direct := startInput(t, router, "cancel-task-agent", "direct")
+	waitForRunning(t, router, "cancel-task-agent")
+	done := make(chan int, 1)
+	go func() {
+		done <- requestJSON(router, http.MethodPost, "/tasks/"+created.TaskID+"/execute", nil).Code
+	}()
+	var taskExecution string
+	require.Eventually(t, func() bool {
+		recorder := requestJSON(router, http.MethodGet, "/api/v1/executions?task_id="+created.TaskID, nil)
+		var list struct {
+			Executions []models.AgentExecution `json:"executions"`
+		}
+		if json.Unmarshal(recorder.Body.Bytes(), &list) != nil {
+			return false
+		}
+		for _, execution := range list.Executions {
+			if execution.State == types.QueuedState {
+				taskExecution = execution.ID
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+
+	result := postCancel(t, router, "/tasks/"+created.TaskID+"/cancel-active")
+	assert.Equal(t, created.TaskID, result.TaskID)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, taskExecution, result.Results[0].ExecutionID)
+	assert.Equal(t, models.CancellationCancelled, result.Results[0].Outcome)
+	assert.Equal(t, types.RunningState, queuedExecution(t, router, direct).State)
+
+	// The cancelled run is skipped once the direct execution is done, without starting
+	openGate(t, dir, "direct")
+	assert.NotEqual(t, http.StatusOK, <-done)
+	assert.NoFileExists(t, filepath.Join(dir, "started-task-run"))
+	assert.Equal(t, types.CancelledState, queuedExecution(t, router, taskExecution).State)
+
+	recorder = requestJSON(router, http.MethodPost, "/tasks/missing/cancel-active", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCancelAllClient(t *testing.T) {
+	agent, _ := markingAgent(t, "cancel-client-agent", models.ReadWriteAccessType)
+	router, _ := newExecuteRouter(t, agent)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	first := startInput(t, router, "cancel-client-agent", "first")
+	waitForRunning(t, router, "cancel-client-agent")
+	second := startInput(t, router, "cancel-client-agent", "second")
+
+	// --execution stops one execution
+	result, err := client.Cancel(ctx, supervisorctl.CancelTarget{ExecutionID: second})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Cancelled)
+	assert.Equal(t, "queued", result.Results[0].PreviousState)
+
+	// --agent stops the rest
+	result, err = client.Cancel(ctx, supervisorctl.CancelTarget{AgentID: "cancel-client-agent"})
+	require.NoError(t, err)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, first, result.Results[0].ExecutionID)
+	var output bytes.Buffer
+	result.Print(&output)
+	assert.Contains(t, output.String(), first+"  cancel-client-agent  running -> cancelled\n")
+	assert.Contains(t, output.String(), "1 matched, 1 cancelled, 0 already terminal, 0 not cancellable\n")
+
+	_, err = client.Cancel(ctx, supervisorctl.CancelTarget{AgentID: "cancel-client-agent", ExecutionID: first})
+	assert.ErrorContains(t, err, "exactly one")
+}
@@ -0,0 +1,260 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// reloadFixture wires a ConfigReloader for a config file in a temp dir behind the config routes
+type reloadFixture struct {
+	path             string
+	router           *gin.Engine
+	agentService     *services.AgentService
+	executionService *services.ExecutionService
+	schedulerService *services.SchedulerService
+}
+
+func newReloadFixture(t *testing.T) *reloadFixture {
+	gin.SetMode(gin.TestMode)
+	logger, _ := zap.NewDevelopment()
+
+	f := &reloadFixture{path: filepath.Join(t.TempDir(), "config.yaml")}
+	f.agentService = services.NewAgentService(logger)
+	f.executionService = services.NewExecutionService(f.agentService, logger)
+	f.schedulerService = services.NewSchedulerService(f.agentService, f.executionService, logger)
+
+	reloader := services.NewConfigReloader(f.path, f.agentService, f.executionService, f.schedulerService, logger)
+	f.router = gin.New()
+	handlers.NewConfigHandlers(nil, reloader, logger).RegisterConfigRoutes(f.router.Group("/api/v1"))
+
+	return f
+}
+
+// writeConfig writes a config file with one agent and, optionally, a task for it
+func (f *reloadFixture) writeConfig(t *testing.T, executable string, timeout int, withTask bool) {
+	content := fmt.Sprintf(`agents:
+  - id: reload-agent
+    name: Reload Agent
+    agent_type: script
+    executable_path: %s
+    timeout: %d
+    enabled: true
+`, executable, timeout)
+	if withTask {
+		content += `tasks:
+  - id: reload-task
+    agent_id: reload-agent
+    cron_expression: "0 0 * * *"
+    enabled: true
+`
+	}
+	require.NoError(t, os.WriteFile(f.path, []byte(content), 0644))
+}
+
+func (f *reloadFixture) reread(t *testing.T) *models.ConfigDiff {
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/config/reread", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var diff models.ConfigDiff
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &diff))
+	return &diff
+}
+
+func (f *reloadFixture) update(t *testing.T, restartChanged bool) *models.ConfigUpdateResult {
+	body, _ := json.Marshal(handlers.ConfigUpdateRequest{RestartChanged: restartChanged})
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/config/update", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result models.ConfigUpdateResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return &result
+}
+
+func TestConfigRereadAndUpdate(t *testing.T) {
+	f := newReloadFixture(t)
+	f.writeConfig(t, "/bin/echo", 30, true)
+
+	diff := f.reread(t)
+	require.Len(t, diff.Changes, 2)
+	assert.Equal(t, models.ConfigChange{Scope: services.ConfigScopeAgent, ID: "reload-agent", Change: models.ConfigAdded}, diff.Changes[0])
+	assert.Equal(t, models.ConfigChange{Scope: services.ConfigScopeTask, ID: "reload-task", Change: models.ConfigAdded}, diff.Changes[1])
+
+	// Reread never applies anything
+	_, err := f.agentService.GetAgent("reload-agent")
+	assert.Error(t, err)
+
+	result := f.update(t, false)
+	require.Len(t, result.Results, 2)
+	for _, item := range result.Results {
+		assert.Equal(t, models.ConfigUpdateApplied, item.Status, item.Message)
+	}
+	_, err = f.schedulerService.GetTask("reload-task")
+	require.NoError(t, err)
+	assert.Empty(t, f.reread(t).Changes)
+
+	// Edit the agent's timeout on disk
+	f.writeConfig(t, "/bin/echo", 90, true)
+
+	diff = f.reread(t)
+	require.Len(t, diff.Changes, 1)
+	assert.Equal(t, models.ConfigChanged, diff.Changes[0].Change)
+	assert.Equal(t, "reload-agent", diff.Changes[0].ID)
+	assert.Equal(t, []string{"timeout"}, diff.Changes[0].Fields)
+
+	result = f.update(t, false)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, models.ConfigUpdateApplied, result.Results[0].Status)
+
+	agent, err := f.agentService.GetAgent("reload-agent")
+	require.NoError(t, err)
+	assert.Equal(t, 90, agent.Timeout)
+	assert.Empty(t, f.reread(t).Changes)
+
+	// Dropping the task from the file removes it from the scheduler
+	f.writeConfig(t, "/bin/echo", 90, false)
+	result = f.update(t, false)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, models.ConfigRemoved, result.Results[0].Change)
+	_, err = f.schedulerService.GetTask("reload-task")
+	assert.Error(t, err)
+}
+
+func TestConfigUpdateRestartsRunningAgentOnlyWhenRequested(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "slow.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nsleep 2\n"), 0755))
+
+	f := newReloadFixture(t)
+	f.writeConfig(t, script, 30, false)
+	f.update(t, false)
+
+	agent, err := f.agentService.GetAgent("reload-agent")
+	require.NoError(t, err)
+	logger, _ := zap.NewDevelopment()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.executionService.ExecuteAgent(context.Background(), agents.NewGenericAgent(agent, logger), "")
+	}()
+	t.Cleanup(func() { <-done })
+
+	require.Eventually(t, func() bool {
+		executions, _ := f.executionService.GetActiveExecutions()
+		for _, execution := range executions {
+			if execution.AgentID == "reload-agent" && execution.State == models.RunningState {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+
+	f.writeConfig(t, script, 60, false)
+
+	result := f.update(t, false)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, models.ConfigUpdateSkipped, result.Results[0].Status)
+	agent, _ = f.agentService.GetAgent("reload-agent")
+	assert.Equal(t, 30, agent.Timeout)
+
+	// The skipped change is still pending
+	assert.Len(t, f.reread(t).Changes, 1)
+
+	result = f.update(t, true)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, models.ConfigUpdateRestarted, result.Results[0].Status, result.Results[0].Message)
+	agent, _ = f.agentService.GetAgent("reload-agent")
+	assert.Equal(t, 60, agent.Timeout)
+}
+
+func TestConfigRereadWithoutConfigFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, _ := zap.NewDevelopment()
+	router := gin.New()
+	handlers.NewConfigHandlers(nil, nil, logger).RegisterConfigRoutes(router.Group("/api/v1"))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/config/reread", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestConfigRereadAndUpdateClient(t *testing.T) {
+	f := newReloadFixture(t)
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	f.writeConfig(t, "/bin/echo", 30, true)
+	_, err := client.UpdateConfig(ctx, supervisorctl.ConfigUpdateOptions{})
+	require.NoError(t, err)
+	f.writeConfig(t, "/bin/echo", 90, false)
+
+	// Reread reports the diff as a table without applying it
+	diff, err := client.RereadConfig(ctx)
+	require.NoError(t, err)
+	require.Len(t, diff.Changes, 2)
+	assert.Equal(t, supervisorctl.ConfigChange{Scope: services.ConfigScopeAgent, ID: "reload-agent", Change: supervisorctl.ConfigChanged, Fields: []string{"timeout"}}, diff.Changes[0])
+	assert.Equal(t, supervisorctl.ConfigChange{Scope: services.ConfigScopeTask, ID: "reload-task", Change: supervisorctl.ConfigRemoved}, diff.Changes[1])
+	var table bytes.Buffer
+	diff.Print(&table)
+	assert.Equal(t, "SCOPE  ID            CHANGE   FIELDS\n"+
+		"agent  reload-agent  changed  timeout\n"+
+		"task   reload-task   removed  -\n", table.String())
+
+	// Declining the prompt applies nothing
+	var prompt bytes.Buffer
+	_, result, err := client.ConfirmedUpdateConfig(ctx, supervisorctl.ConfigUpdateOptions{}, supervisorctl.PromptConfigConfirm(strings.NewReader("n\n"), &prompt, false))
+	assert.ErrorIs(t, err, supervisorctl.ErrNotConfirmed)
+	assert.Nil(t, result)
+	assert.Contains(t, prompt.String(), "reload-agent  changed")
+	assert.Contains(t, prompt.String(), "Apply these changes? [y/N]: ")
+	agent, err := f.agentService.GetAgent("reload-agent")
+	require.NoError(t, err)
+	assert.Equal(t, 30, agent.Timeout)
+
+	// Confirming applies the diff and reports each change
+	prompt.Reset()
+	diff, result, err = client.ConfirmedUpdateConfig(ctx, supervisorctl.ConfigUpdateOptions{}, supervisorctl.PromptConfigConfirm(strings.NewReader("yes\n"), &prompt, false))
+	require.NoError(t, err)
+	assert.Len(t, diff.Changes, 2)
+	require.Len(t, result.Results, 2)
+	for _, item := range result.Results {
+		assert.Equal(t, supervisorctl.ConfigUpdateApplied, item.Status, item.Message)
+	}
+	assert.NoError(t, result.Err())
+	agent, err = f.agentService.GetAgent("reload-agent")
+	require.NoError(t, err)
+	assert.Equal(t, 90, agent.Timeout)
+
+	// Nothing left to update is not asked about
+	diff, result, err = client.ConfirmedUpdateConfig(ctx, supervisorctl.ConfigUpdateOptions{}, func(*supervisorctl.ConfigDiff) (bool, error) {
+		t.Fatal("asked to confirm an empty diff")
+		return false, nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, diff.Changes)
+	assert.Nil(t, result)
+}
@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func validationAgent(id, workingDirectory string) *models.AgentConfiguration {
+	return &models.AgentConfiguration{
+		ID:                      id,
+		Name:                    "Validation Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/echo",
+		WorkingDirectory:        workingDirectory,
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 1,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 30,
+		Enabled:                 true,
+	}
+}
+
+func newConfigValidateRouter(validator *services.ConfigValidator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger, _ := zap.NewDevelopment()
+	router := gin.New()
+	handlers.NewConfigHandlers(validator, nil, logger).RegisterConfigRoutes(router.Group("/api/v1"))
+	return router
+}
+
+func postConfigValidate(t *testing.T, validator *services.ConfigValidator) *models.ConfigValidation {
+	recorder := httptest.NewRecorder()
+	newConfigValidateRouter(validator).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/config/validate", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var result models.ConfigValidation
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return &result
+}
+
+func findIssue(issues []models.ConfigIssue, scope, id, field string) *models.ConfigIssue {
+	for i := range issues {
+		if issues[i].Scope == scope && issues[i].ID == id && issues[i].Field == field {
+			return &issues[i]
+		}
+	}
+	return nil
+}
+
+func TestConfigValidate_TaskWithMissingAgentIsError(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+
+	missingDir := filepath.Join(t.TempDir(), "does-not-exist")
+	optionalDirAgent := validationAgent("optional-dir-agent", missingDir)
+	optionalDirAgent.SkipFSChecks = true
+	require.NoError(t, agentService.RegisterAgent(optionalDirAgent))
+	require.NoError(t, agentService.RegisterAgent(validationAgent("removed-agent", "")))
+
+	task := &models.ScheduledTask{
+		ID:             "orphan-task",
+		Name:           "Orphan Task",
+		AgentID:        "removed-agent",
+		CronExpression: "0 0 * * *",
+		Enabled:        true,
+	}
+	require.NoError(t, scheduler.ScheduleTask(task))
+	defer scheduler.UnscheduleTask(task.ID)
+	require.NoError(t, agentService.DeleteAgent("removed-agent"))
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.ValidTokens = []string{"token"}
+	a2aConfig.Transports.HTTPConfig.AllowedOrigins = []string{"https://example.com"}
+
+	validator := services.NewConfigValidator(nil, a2aConfig, agentService, scheduler, logger)
+	result := postConfigValidate(t, validator)
+
+	assert.False(t, result.Valid)
+	assert.NotNil(t, findIssue(result.Errors, services.ConfigScopeTask, "orphan-task", "agent_id"))
+
+	// A missing working directory is only a warning for agents that skip the filesystem checks
+	assert.Nil(t, findIssue(result.Errors, services.ConfigScopeAgent, "optional-dir-agent", "working_directory"))
+	assert.NotNil(t, findIssue(result.Warnings, services.ConfigScopeAgent, "optional-dir-agent", "working_directory"))
+	assert.Len(t, result.Errors, 1)
+}
+
+func TestConfigValidate_A2AConfig(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.HeaderName = ""
+	a2aConfig.Transports.HTTPConfig.AllowedOrigins = []string{"*", "example.com", "https://example.com/path"}
+
+	result := postConfigValidate(t, services.NewConfigValidator(nil, a2aConfig, agentService, nil, logger))
+	assert.False(t, result.Valid)
+	require.Len(t, result.Errors, 3)
+	for _, issue := range result.Errors {
+		assert.Equal(t, services.ConfigScopeA2A, issue.Scope)
+	}
+	assert.NotEmpty(t, result.Warnings)
+
+	result = postConfigValidate(t, services.NewConfigValidator(nil, a2a.DefaultA2AConfig(), agentService, nil, logger))
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Errors)
+}
+
+func TestConfigValidate_ReportsFilesystemChecksPerAgent(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	agentService.SetStrictValidation(false)
+
+	missingDir := filepath.Join(t.TempDir(), "does-not-exist")
+	require.NoError(t, agentService.RegisterAgent(validationAgent("healthy-agent", "")))
+	require.NoError(t, agentService.RegisterAgent(validationAgent("missing-dir-agent", missingDir)))
+	missingBinary := validationAgent("missing-binary-agent", "")
+	missingBinary.ExecutablePath = filepath.Join(missingDir, "agent")
+	require.NoError(t, agentService.RegisterAgent(missingBinary))
+
+	// Agents registered while validation was relaxed are reported as warnings
+	validator := services.NewConfigValidator(nil, nil, agentService, nil, logger)
+	result := postConfigValidate(t, validator)
+	assert.True(t, result.Valid)
+	assert.NotNil(t, findIssue(result.Warnings, services.ConfigScopeAgent, "missing-dir-agent", "working_directory"))
+	assert.NotNil(t, findIssue(result.Warnings, services.ConfigScopeAgent, "missing-binary-agent", "executable_path"))
+
+	// and as errors once it is strict
+	agentService.SetStrictValidation(true)
+	result = postConfigValidate(t, validator)
+	assert.False(t, result.Valid)
+	require.Len(t, result.Errors, 2)
+	issue := findIssue(result.Errors, services.ConfigScopeAgent, "missing-dir-agent", "working_directory")
+	require.NotNil(t, issue)
+	assert.Contains(t, issue.Message, "working directory does not exist")
+	issue = findIssue(result.Errors, services.ConfigScopeAgent, "missing-binary-agent", "executable_path")
+	require.NotNil(t, issue)
+	assert.Contains(t, issue.Message, "executable not found")
+}
+
+func TestConfigValidate_Client(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(validationAgent("healthy-agent", "")))
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.HeaderName = ""
+	server := httptest.NewServer(newConfigValidateRouter(services.NewConfigValidator(nil, a2aConfig, agentService, nil, logger)))
+	t.Cleanup(server.Close)
+
+	validation, err := supervisorctl.NewClient(server.URL).ValidateConfig(context.Background())
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+	require.Len(t, validation.Errors, 1)
+	assert.Equal(t, services.ConfigScopeA2A, validation.Errors[0].Scope)
+	assert.ErrorIs(t, validation.Err(), supervisorctl.ErrConfigInvalid)
+	assert.Equal(t, supervisorctl.ExitFailure, supervisorctl.ExitCode(validation.Err()))
+
+	var out strings.Builder
+	validation.Print(&out)
+	assert.Contains(t, out.String(), "error: a2a: authentication.header_name cannot be empty")
+	assert.Contains(t, out.String(), fmt.Sprintf("1 errors, %d warnings\n", len(validation.Warnings)))
+
+	// A valid configuration exits cleanly
+	server = httptest.NewServer(newConfigValidateRouter(services.NewConfigValidator(nil, a2a.DefaultA2AConfig(), agentService, nil, logger)))
+	t.Cleanup(server.Close)
+	validation, err = supervisorctl.NewClient(server.URL).ValidateConfig(context.Background())
+	require.NoError(t, err)
+	assert.True(t, validation.Valid)
+	assert.NoError(t, validation.Err())
+}
@@ -0,0 +1,156 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newEnvelopeRouter serves the REST and A2A routes over one agent, one active and one paused task
+func newEnvelopeRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(validationAgent("envelope-agent", "")))
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+
+	for _, id := range []string{"active-task", "paused-task"} {
+		require.NoError(t, schedulerService.ScheduleTask(&models.ScheduledTask{
+			ID: id, Name: id, AgentID: "envelope-agent", CronExpression: "@every 1h", Enabled: true,
+		}))
+	}
+	require.NoError(t, schedulerService.PauseTask("paused-task"))
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.ValidTokens = []string{"envelope-token"}
+	router := gin.New()
+	routes.SetupA2ARoutes(&routes.A2ARouteConfig{
+		Router:               router,
+		A2AService:           services.NewA2AService(agentService, executionService, logger),
+		AgentService:         agentService,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		A2AConfig:            a2aConfig,
+	})
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		SchedulerService:     schedulerService,
+		ConfigValidator:      services.NewConfigValidator(nil, a2aConfig, agentService, schedulerService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	return router
+}
+
+// assertErrorEnvelope checks that body holds exactly the error envelope fields with the expected code
+func assertErrorEnvelope(t *testing.T, body []byte, code string, context string) {
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &envelope), context)
+
+	assert.Equal(t, false, envelope["success"], context)
+	assert.Equal(t, code, envelope["code"], context)
+	message, ok := envelope["error"].(string)
+	assert.True(t, ok && message != "", "%s: error message missing", context)
+	if details, exists := envelope["details"]; exists {
+		_, ok := details.(map[string]interface{})
+		assert.True(t, ok, "%s: details must be an object", context)
+	}
+	for key := range envelope {
+		assert.Contains(t, []string{"success", "code", "error", "details"}, key, context)
+	}
+}
+
+func TestErrorResponsesUseEnvelope(t *testing.T) {
+	router := newEnvelopeRouter(t)
+
+	tests := []struct {
+		method, path, contentType, body string
+		status                          int
+		code                            string
+	}{
+		{http.MethodPost, "/agents/envelope-agent/v1/message/send", "application/json", "{}", http.StatusUnauthorized, "UNAUTHORIZED"},
+		{http.MethodGet, "/tasks/missing", "", "", http.StatusNotFound, "TASK_NOT_FOUND"},
+		{http.MethodDelete, "/tasks/missing", "", "", http.StatusNotFound, "TASK_NOT_FOUND"},
+		{http.MethodPost, "/tasks/missing/pause", "", "", http.StatusNotFound, "TASK_NOT_FOUND"},
+		{http.MethodPost, "/tasks/missing/execute", "", "", http.StatusNotFound, "TASK_NOT_FOUND"},
+		{http.MethodPost, "/tasks/paused-task/pause", "", "", http.StatusConflict, "TASK_CONFLICT"},
+		{http.MethodPost, "/tasks/active-task/resume", "", "", http.StatusConflict, "TASK_CONFLICT"},
+		{http.MethodPost, "/tasks", "application/json", "{", http.StatusBadRequest, "INVALID_REQUEST"},
+		{http.MethodPost, "/tasks", "application/json", `{"agent_id":"envelope-agent","cron_expression":"not cron"}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{http.MethodPost, "/tasks", "application/json", `{"agent_id":"missing","cron_expression":"@every 1h"}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+		{http.MethodPut, "/tasks/missing", "application/json", `{"agent_id":"envelope-agent","cron_expression":"@every 1h"}`, http.StatusNotFound, "TASK_NOT_FOUND"},
+		{http.MethodGet, "/api/v1/executions/missing", "", "", http.StatusNotFound, "EXECUTION_NOT_FOUND"},
+		{http.MethodGet, "/api/v1/executions?label=novalue", "", "", http.StatusBadRequest, "VALIDATION_FAILED"},
+		{http.MethodPost, "/api/v1/config/reread", "", "", http.StatusServiceUnavailable, "CONFIG_UNAVAILABLE"},
+		{http.MethodPost, "/api/v1/config/update", "", "", http.StatusServiceUnavailable, "CONFIG_UNAVAILABLE"},
+		{http.MethodGet, "/discovery/agents/missing", "", "", http.StatusNotFound, "AGENT_NOT_FOUND"},
+		{http.MethodPost, "/agents/envelope-agent/v1/message/send", "text/plain", "hello", http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE"},
+		{http.MethodPost, "/agents/envelope-agent/v1/message/send", "application/json", "{", http.StatusBadRequest, "INVALID_REQUEST"},
+	}
+
+	for _, tt := range tests {
+		name := tt.method + " " + tt.path
+		request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			request.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.status != http.StatusUnauthorized {
+			request.Header.Set("Authorization", "Bearer envelope-token")
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		assert.Equal(t, tt.status, recorder.Code, "%s: %s", name, recorder.Body.String())
+		assertErrorEnvelope(t, recorder.Body.Bytes(), tt.code, name)
+	}
+}
+
+func TestServiceErrorsMapToCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{models.NewKindError(models.ErrAgentNotFound, "agent with ID a not found"), http.StatusNotFound, "AGENT_NOT_FOUND", "agent with ID a not found"},
+		{fmt.Errorf("agent not found: %w", models.NewKindError(models.ErrAgentNotFound, "agent with ID a not found")), http.StatusNotFound, "AGENT_NOT_FOUND", "agent not found: agent with ID a not found"},
+		{models.NewKindError(models.ErrAgentDisabled, "agent a is disabled"), http.StatusForbidden, "AGENT_DISABLED", "agent a is disabled"},
+		{fmt.Errorf("%w: client c is limited to 1 concurrent executions", models.ErrExecutionQuotaExceeded), http.StatusTooManyRequests, "QUOTA_EXCEEDED", "concurrent execution quota exceeded: client c is limited to 1 concurrent executions"},
+		{models.ValidationError("bad label"), http.StatusBadRequest, "VALIDATION_FAILED", "bad label"},
+		{errors.New("disk on fire"), http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to do it"},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		api.RespondServiceError(c, tt.err, "Failed to do it")
+
+		assert.Equal(t, tt.status, recorder.Code, tt.err.Error())
+		assertErrorEnvelope(t, recorder.Body.Bytes(), tt.code, tt.err.Error())
+		var envelope api.ErrorResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &envelope))
+		assert.Equal(t, tt.message, envelope.Message)
+	}
+}
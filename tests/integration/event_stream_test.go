@@ -0,0 +1,202 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// sseEvent is one server-sent event of GET /api/v1/events
+type sseEvent struct {
+	Name  string
+	Event models.Event
+}
+
+// newEventServer serves the REST routes with an event bus over the given agents
+func newEventServer(t *testing.T, agents ...*models.AgentConfiguration) (*httptest.Server, *services.EventBus) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	bus := services.NewEventBus(logger)
+	executionService.SetEventBus(bus)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		EventBus:             bus,
+		Logger:               logger,
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, bus
+}
+
+// openEventStream connects to the event stream with query and sends its events on the returned
+// channel until the stream ends
+func openEventStream(t *testing.T, ctx context.Context, server *httptest.Server, query string) <-chan sseEvent {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/events"+query, nil)
+	require.NoError(t, err)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Contains(t, response.Header.Get("Content-Type"), "text/event-stream")
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		defer response.Body.Close()
+		scanner := bufio.NewScanner(response.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		var current sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				current.Name = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &current.Event)
+			case line == "" && current.Name != "":
+				events <- current
+				current = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+// eventStats fetches GET /api/v1/events/stats
+func eventStats(t *testing.T, server *httptest.Server) models.EventBusStats {
+	response, err := http.Get(server.URL + "/api/v1/events/stats")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var stats models.EventBusStats
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&stats))
+	return stats
+}
+
+func TestEventStreamReportsExecutionStates(t *testing.T) {
+	server, bus := newEventServer(t, scriptAgent(t, "event-agent", models.ReadOnlyAccessType, "cat\n"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := openEventStream(t, ctx, server, "?types=execution.state&agent_id=event-agent")
+	require.Eventually(t, func() bool { return len(bus.Stats().Subscriptions) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	response, err := http.Post(server.URL+"/api/v1/agents/event-agent/execute", "application/json", strings.NewReader(`{"input":"hi"}`))
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var states []string
+	for len(states) < 3 {
+		select {
+		case event := <-events:
+			require.Equal(t, models.EventExecutionState, event.Name)
+			assert.Equal(t, "event-agent", event.Event.AgentID)
+			assert.NotEmpty(t, event.Event.ExecutionID)
+			states = append(states, event.Event.Data.(map[string]interface{})["state"].(string))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for execution states, got %v", states)
+		}
+	}
+	assert.Equal(t, []string{"starting", "running", "completed"}, states)
+
+	stats := eventStats(t, server)
+	assert.Equal(t, uint64(3), stats.Published)
+	assert.Equal(t, 1, stats.SubscriberTypes["sse"].Subscribers)
+	assert.Equal(t, uint64(3), stats.SubscriberTypes["sse"].Delivered)
+}
+
+func TestEventStreamSendsDropNotices(t *testing.T) {
+	server, bus := newEventServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := openEventStream(t, ctx, server, "?buffer=4")
+	require.Eventually(t, func() bool { return len(bus.Stats().Subscriptions) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Large events fill the connection while the client is not reading, so the stream falls behind
+	const total = 400
+	payload := strings.Repeat("x", 64*1024)
+	started := time.Now()
+	for i := 0; i < total; i++ {
+		bus.Publish(models.Event{Type: models.EventTaskRun, Data: payload})
+	}
+	assert.Less(t, time.Since(started), 5*time.Second, "publishing does not wait for the stream")
+
+	var received, dropped uint64
+	for received+dropped < total {
+		select {
+		case event := <-events:
+			if event.Name == models.EventEventsDropped {
+				dropped += uint64(event.Event.Data.(map[string]interface{})["dropped_count"].(float64))
+				continue
+			}
+			require.Equal(t, models.EventTaskRun, event.Name)
+			received++
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out after %d events and %d dropped", received, dropped)
+		}
+	}
+	assert.Equal(t, uint64(total), received+dropped)
+	assert.Greater(t, dropped, uint64(0))
+
+	stats := eventStats(t, server)
+	assert.Equal(t, received, stats.SubscriberTypes["sse"].Delivered)
+	assert.Equal(t, dropped, stats.SubscriberTypes["sse"].Dropped)
+}
+
+func TestEventStreamDisconnectsLaggingClient(t *testing.T) {
+	server, bus := newEventServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := openEventStream(t, ctx, server, "?buffer=4&overflow=disconnect&lag_limit=8")
+	require.Eventually(t, func() bool { return len(bus.Stats().Subscriptions) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	payload := strings.Repeat("x", 64*1024)
+	for i := 0; i < 400; i++ {
+		bus.Publish(models.Event{Type: models.EventTaskRun, Data: payload})
+	}
+
+	var last sseEvent
+	for event := range events {
+		last = event
+	}
+	assert.Equal(t, models.EventEventsDisconnected, last.Name)
+	require.Eventually(t, func() bool {
+		stats := eventStats(t, server)
+		return len(stats.Subscriptions) == 0 && stats.SubscriberTypes["sse"].Disconnected == 1
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestEventStreamRejectsInvalidSubscriptions(t *testing.T) {
+	server, _ := newEventServer(t)
+	for _, query := range []string{"?buffer=0", "?buffer=abc", "?overflow=block", "?lag_limit=-1", "?buffer=1000000"} {
+		response, err := http.Get(server.URL + "/api/v1/events" + query)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+}
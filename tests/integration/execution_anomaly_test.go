@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAnomalyFlagsSlowExecution(t *testing.T) {
+	slow := scriptAgent(t, "slow-agent", models.ReadOnlyAccessType, "sleep 0.5\necho done\n")
+	fast := scriptAgent(t, "fast-agent", models.ReadOnlyAccessType, "echo done\n")
+	router, executionService := newExecuteRouter(t, slow, fast)
+
+	bus := services.NewEventBus(zap.NewNop())
+	executionService.SetEventBus(bus)
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{Types: []string{models.EventExecutionAnomaly}})
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	// The slow agent usually finishes in 20ms
+	start := time.Now().Add(-time.Hour)
+	var history []*models.ExecutionHistory
+	for i := 0; i < 20; i++ {
+		startTime := start.Add(time.Duration(i) * time.Minute)
+		history = append(history, &models.ExecutionHistory{
+			ID:              fmt.Sprintf("history-%d", i),
+			ExecutionID:     fmt.Sprintf("past-%d", i),
+			AgentID:         "slow-agent",
+			StartTime:       startTime,
+			EndTime:         startTime.Add(20 * time.Millisecond),
+			Status:          types.SuccessStatus,
+			ExecutionTimeMs: 20,
+		})
+	}
+	detector := services.NewAnomalyDetector(services.DefaultAnomalyConfig())
+	detector.Seed(history)
+	executionService.SetAnomalyDetector(detector)
+
+	recorder := postExecute(router, "slow-agent", map[string]interface{}{"input": "go"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, []string{models.AnomalyDurationHigh}, result.Anomalies)
+
+	// The anomaly is published, found against the agent's baseline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	event, err := subscription.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "slow-agent", event.AgentID)
+	anomaly, ok := event.Data.(models.ExecutionAnomaly)
+	require.True(t, ok)
+	assert.Equal(t, models.AnomalyDurationHigh, anomaly.Anomaly)
+	assert.Equal(t, models.AnomalyScopeAgent, anomaly.Scope)
+	assert.Equal(t, 20.0, anomaly.BaselineMeanMs)
+
+	// Agents without a baseline are not flagged
+	recorder = postExecute(router, "fast-agent", map[string]interface{}{"input": "go"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	// The flags are served and filtered by the executions query API
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+
+	anomalous := true
+	executions, err := client.FilterExecutions(context.Background(), supervisorctl.ExecutionFilter{Anomalous: &anomalous})
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	assert.Equal(t, event.ExecutionID, executions[0].ID)
+	assert.Equal(t, []string{models.AnomalyDurationHigh}, executions[0].Anomalies)
+
+	anomalous = false
+	executions, err = client.FilterExecutions(context.Background(), supervisorctl.ExecutionFilter{Anomalous: &anomalous})
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	assert.Equal(t, "fast-agent", executions[0].AgentID)
+	assert.Empty(t, executions[0].Anomalies)
+
+	response, err := http.Get(server.URL + "/api/v1/executions?anomalous=maybe")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
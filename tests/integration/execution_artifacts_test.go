@@ -0,0 +1,193 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// artifactScript writes a CSV report and a PDF into the execution's artifacts directory
+const artifactScript = `printf 'name,count\nalpha,1\nbeta,2\n' > "$SUPERVISOR_ARTIFACTS_DIR/report.csv"
+printf '%%PDF-1.4\n%%fake document\n' > "$SUPERVISOR_ARTIFACTS_DIR/summary.pdf"
+echo written
+`
+
+// artifactsResponse is the body of the artifact listing route
+type artifactsResponse struct {
+	ExecutionID       string                    `json:"execution_id"`
+	Artifacts         []models.Artifact         `json:"artifacts"`
+	RejectedArtifacts []models.RejectedArtifact `json:"rejected_artifacts"`
+	Total             int                       `json:"total"`
+}
+
+// newArtifactRouter serves the REST routes with artifacts kept in store
+func newArtifactRouter(t *testing.T, store *services.ArtifactStore, agents ...*models.AgentConfiguration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetArtifactStore(store)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		ArtifactStore:        store,
+		Logger:               logger,
+	})
+	return router
+}
+
+// runToCompletion starts an asynchronous execution of agentID and waits for it to finish
+func runToCompletion(t *testing.T, router *gin.Engine, agentID string) string {
+	recorder := postExecute(router, agentID, map[string]interface{}{"input": "go", "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	executionID := accepted["execution_id"].(string)
+
+	require.Eventually(t, func() bool {
+		poll := httptest.NewRecorder()
+		router.ServeHTTP(poll, httptest.NewRequest(http.MethodGet, "/api/v1/executions/"+executionID, nil))
+		var body struct {
+			Execution models.AgentExecution   `json:"execution"`
+			Result    *models.ExecutionResult `json:"result"`
+		}
+		return json.Unmarshal(poll.Body.Bytes(), &body) == nil && body.Execution.IsComplete() && body.Result != nil
+	}, 5*time.Second, 50*time.Millisecond)
+	return executionID
+}
+
+func listArtifacts(t *testing.T, router *gin.Engine, executionID string) artifactsResponse {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions/"+executionID+"/artifacts", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var listing artifactsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listing))
+	return listing
+}
+
+func TestExecutionArtifactsListedAndDownloaded(t *testing.T) {
+	store := services.NewArtifactStore(t.TempDir(), 0, 0, zap.NewNop())
+	router := newArtifactRouter(t, store, scriptAgent(t, "report-agent", models.ReadOnlyAccessType, artifactScript))
+	executionID := runToCompletion(t, router, "report-agent")
+
+	listing := listArtifacts(t, router, executionID)
+	assert.Equal(t, executionID, listing.ExecutionID)
+	require.Equal(t, 2, listing.Total)
+	assert.Empty(t, listing.RejectedArtifacts)
+
+	csv := []byte("name,count\nalpha,1\nbeta,2\n")
+	csvSum := sha256.Sum256(csv)
+	report := listing.Artifacts[0]
+	assert.Equal(t, "report.csv", report.Name)
+	assert.Equal(t, int64(len(csv)), report.Size)
+	assert.Contains(t, report.ContentType, "text/csv")
+	assert.Equal(t, hex.EncodeToString(csvSum[:]), report.SHA256)
+	summary := listing.Artifacts[1]
+	assert.Equal(t, "summary.pdf", summary.Name)
+	assert.Equal(t, "application/pdf", summary.ContentType)
+
+	// Downloads carry the artifact's bytes, type, file name and checksum
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions/"+executionID+"/artifacts/report.csv", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, csv, recorder.Body.Bytes())
+	assert.Equal(t, report.ContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=report.csv", recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, `"`+report.SHA256+`"`, recorder.Header().Get("ETag"))
+	assert.Equal(t, "bytes", recorder.Header().Get("Accept-Ranges"))
+
+	// Range requests return the requested bytes only
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/executions/"+executionID+"/artifacts/report.csv", nil)
+	request.Header.Set("Range", "bytes=0-9")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, csv[:10], recorder.Body.Bytes())
+	assert.Equal(t, "bytes 0-9/26", recorder.Header().Get("Content-Range"))
+
+	// Unknown artifacts and executions are not found
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions/"+executionID+"/artifacts/missing.txt", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "ARTIFACT_NOT_FOUND", "unknown artifact")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions/missing/artifacts", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestExecutionArtifactLimitsRejectExcessFiles(t *testing.T) {
+	t.Run("count", func(t *testing.T) {
+		dir := t.TempDir()
+		store := services.NewArtifactStore(dir, 1, 0, zap.NewNop())
+		router := newArtifactRouter(t, store, scriptAgent(t, "count-agent", models.ReadOnlyAccessType, artifactScript))
+		executionID := runToCompletion(t, router, "count-agent")
+
+		listing := listArtifacts(t, router, executionID)
+		require.Equal(t, 1, listing.Total)
+		assert.Equal(t, "report.csv", listing.Artifacts[0].Name)
+		require.Len(t, listing.RejectedArtifacts, 1)
+		assert.Equal(t, "summary.pdf", listing.RejectedArtifacts[0].Name)
+		assert.Contains(t, listing.RejectedArtifacts[0].Reason, "limit of 1 artifacts")
+		assert.NoFileExists(t, filepath.Join(dir, executionID, "summary.pdf"))
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions/"+executionID+"/artifacts/summary.pdf", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("total size", func(t *testing.T) {
+		dir := t.TempDir()
+		store := services.NewArtifactStore(dir, 0, 30, zap.NewNop())
+		router := newArtifactRouter(t, store, scriptAgent(t, "size-agent", models.ReadOnlyAccessType, artifactScript))
+		executionID := runToCompletion(t, router, "size-agent")
+
+		listing := listArtifacts(t, router, executionID)
+		require.Equal(t, 1, listing.Total)
+		assert.Equal(t, "report.csv", listing.Artifacts[0].Name)
+		require.Len(t, listing.RejectedArtifacts, 1)
+		assert.Equal(t, "summary.pdf", listing.RejectedArtifacts[0].Name)
+		assert.Contains(t, listing.RejectedArtifacts[0].Reason, "limit of 30 bytes")
+		assert.NoFileExists(t, filepath.Join(dir, executionID, "summary.pdf"))
+	})
+}
+
+func TestExecutionArtifactRetention(t *testing.T) {
+	dir := t.TempDir()
+	store := services.NewArtifactStore(dir, 0, 0, zap.NewNop())
+	router := newArtifactRouter(t, store, scriptAgent(t, "retained-agent", models.ReadOnlyAccessType, artifactScript))
+	executionID := runToCompletion(t, router, "retained-agent")
+	require.DirExists(t, filepath.Join(dir, executionID))
+
+	removed, err := store.DeleteBefore(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	removed, err = store.DeleteBefore(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoDirExists(t, filepath.Join(dir, executionID))
+}
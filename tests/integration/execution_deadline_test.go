@@ -0,0 +1,143 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadlineAgent runs body with a 2s timeout that extensions may push out to maxTotal seconds
+func deadlineAgent(t *testing.T, id string, maxTotal int, body string) *models.AgentConfiguration {
+	agent := scriptAgent(t, id, models.ReadOnlyAccessType, body)
+	agent.Timeout = 2
+	agent.MaxTotalTimeout = maxTotal
+	return agent
+}
+
+// startAsync starts an asynchronous execution of the agent and returns its ID
+func startAsync(t *testing.T, router *gin.Engine, agentID string) string {
+	recorder := postExecute(router, agentID, map[string]interface{}{"input": "x", "async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted handlers.AgentExecuteAccepted
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	return accepted.ExecutionID
+}
+
+// awaitResult waits for the execution to finish and returns its result
+func awaitResult(t *testing.T, executionService *services.ExecutionService, executionID string, timeout time.Duration) *models.ExecutionResult {
+	require.Eventually(t, func() bool {
+		execution, err := executionService.GetExecution(executionID)
+		return err == nil && execution.EndTime != nil
+	}, timeout, 50*time.Millisecond)
+	result, err := executionService.GetExecutionResult(executionID)
+	require.NoError(t, err)
+	return result
+}
+
+func TestExecutionDeadlineExtensionLetsExecutionComplete(t *testing.T) {
+	router, executionService := newExecuteRouter(t, deadlineAgent(t, "approval-agent", 10, "sleep 5\necho approved\n"))
+	executionID := startAsync(t, router, "approval-agent")
+
+	time.Sleep(time.Second)
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/executions/"+executionID+"/extend", map[string]interface{}{"seconds": 5, "reason": "waiting for approval"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var extension models.DeadlineExtension
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extension))
+	assert.Equal(t, 5, extension.RequestedSeconds)
+	assert.Equal(t, 5, extension.GrantedSeconds)
+
+	result := awaitResult(t, executionService, executionID, 10*time.Second)
+	assert.Equal(t, types.SuccessStatus, result.Status, result.Error)
+	assert.Equal(t, "approved\n", result.Output)
+
+	// The extension is recorded between the running and completed states
+	execution, err := executionService.GetExecution(executionID)
+	require.NoError(t, err)
+	var extended *models.StateTransition
+	for i, transition := range execution.StateHistory {
+		if transition.FromState == types.RunningState && transition.ToState == types.RunningState {
+			extended = &execution.StateHistory[i]
+		}
+	}
+	require.NotNil(t, extended, "extension missing from %+v", execution.StateHistory)
+	assert.Contains(t, extended.Reason, "waiting for approval")
+	require.NotNil(t, execution.Deadline)
+	assert.WithinDuration(t, extension.Deadline, *execution.Deadline, time.Millisecond)
+
+	// Finished executions cannot be extended
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/"+executionID+"/extend", map[string]interface{}{"seconds": 5})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "INVALID_STATE_TRANSITION", "extend finished execution")
+}
+
+func TestExecutionDeadlineExtensionIsCapped(t *testing.T) {
+	router, executionService := newExecuteRouter(t,
+		deadlineAgent(t, "capped-agent", 3, "sleep 10\n"),
+		deadlineAgent(t, "fixed-agent", 0, "sleep 10\n"))
+	capped := startAsync(t, router, "capped-agent")
+	fixed := startAsync(t, router, "fixed-agent")
+	t.Cleanup(func() {
+		executionService.CancelExecution(capped, "test finished", "")
+		executionService.CancelExecution(fixed, "test finished", "")
+	})
+	require.Eventually(t, func() bool {
+		execution, err := executionService.GetExecution(capped)
+		return err == nil && execution.Deadline != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Only one second is left before the agent's 3s max total timeout
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/executions/"+capped+"/extend", map[string]interface{}{"seconds": 60})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var extension models.DeadlineExtension
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &extension))
+	assert.Equal(t, 1, extension.GrantedSeconds)
+	assert.Equal(t, extension.MaxDeadline, extension.Deadline)
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/"+capped+"/extend", map[string]interface{}{"seconds": 1})
+	assert.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+
+	// Agents without a max total timeout are not extended
+	require.Eventually(t, func() bool {
+		execution, err := executionService.GetExecution(fixed)
+		return err == nil && execution.Deadline != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/"+fixed+"/extend", map[string]interface{}{"seconds": 1})
+	assert.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/"+capped+"/extend", map[string]interface{}{"seconds": 0})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"seconds": models.ValidationOutOfRange}, fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/missing/extend", map[string]interface{}{"seconds": 1})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestExecutionDeadlineExtensionRequestedByAgent(t *testing.T) {
+	// The agent asks for more time through its control file descriptor before outliving its timeout
+	body := `echo '{"type":"extend_deadline","seconds":5,"reason":"waiting for input"}' >&"$SUPERVISOR_CONTROL_FD"` + "\nsleep 3\necho answered\n"
+	router, executionService := newExecuteRouter(t, deadlineAgent(t, "interactive-agent", 10, body))
+	executionID := startAsync(t, router, "interactive-agent")
+
+	result := awaitResult(t, executionService, executionID, 10*time.Second)
+	assert.Equal(t, types.SuccessStatus, result.Status, result.Error)
+	assert.Equal(t, "answered\n", result.Output)
+
+	execution, err := executionService.GetExecution(executionID)
+	require.NoError(t, err)
+	requestedBy := ""
+	for _, transition := range execution.StateHistory {
+		if transition.FromState == transition.ToState {
+			requestedBy = transition.RequestedBy
+		}
+	}
+	assert.Equal(t, "agent:interactive-agent", requestedBy)
+}
@@ -0,0 +1,215 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// gatedExecutionStore counts the executions its pages return and holds every page after the first
+// until it is released, so a test can look at the export while the store is still being read
+type gatedExecutionStore struct {
+	models.ExecutionStore
+	read     atomic.Int64
+	release  chan struct{}
+	released sync.Once
+}
+
+func (s *gatedExecutionStore) QueryExecutionsAfter(filter models.ExecutionFilter, after models.ExecutionCursor, limit int) ([]*models.AgentExecution, error) {
+	if after != (models.ExecutionCursor{}) {
+		<-s.release
+	}
+	page, err := s.ExecutionStore.QueryExecutionsAfter(filter, after, limit)
+	s.read.Add(int64(len(page)))
+	return page, err
+}
+
+func (s *gatedExecutionStore) open() {
+	s.released.Do(func() { close(s.release) })
+}
+
+// newExportServer serves the API over executions kept in store, with a column for the team label
+func newExportServer(t *testing.T, store models.ExecutionStore) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetExecutionStore(store)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		Logger:               logger,
+		ExportLabels:         []string{"team"},
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// exportedExecution is a finished execution of agentID that started at start
+func exportedExecution(id, agentID string, start time.Time) *models.AgentExecution {
+	end := start.Add(1500 * time.Millisecond)
+	return &models.AgentExecution{
+		ID:          id,
+		AgentID:     agentID,
+		State:       types.CompletedState,
+		StartTime:   start,
+		EndTime:     &end,
+		TriggerType: types.TaskTriggerTypeAPI,
+		Labels:      map[string]string{"team": "data", "ticket": "not-exported"},
+	}
+}
+
+func TestExecutionExportStreams(t *testing.T) {
+	store := &gatedExecutionStore{ExecutionStore: models.NewInMemoryExecutionStore(), release: make(chan struct{})}
+	defer store.open()
+	base := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	const total = 10000
+	for i := 0; i < total; i++ {
+		require.NoError(t, store.SaveExecution(exportedExecution(fmt.Sprintf("exec-%05d", i), "exporter", base.Add(time.Duration(i)*time.Second))))
+	}
+	server := newExportServer(t, store)
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/executions/export?format=jsonl", nil)
+	require.NoError(t, err)
+	request.Header.Set("Accept-Encoding", "gzip")
+	response, err := http.DefaultTransport.RoundTrip(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-ndjson", response.Header.Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename=executions-\d{8}T\d{6}Z\.jsonl$`, response.Header.Get("Content-Disposition"))
+
+	// The first page arrives while the rest of the executions have not been read
+	body, err := gzip.NewReader(response.Body)
+	require.NoError(t, err)
+	lines := bufio.NewScanner(body)
+	require.True(t, lines.Scan())
+	assert.EqualValues(t, services.ExecutionPageSize, store.read.Load())
+	var first models.ExecutionExportRecord
+	require.NoError(t, json.Unmarshal(lines.Bytes(), &first))
+	assert.Equal(t, "exec-00000", first.ID)
+	assert.Equal(t, "exporter", first.AgentID)
+	require.NotNil(t, first.DurationMs)
+	assert.EqualValues(t, 1500, *first.DurationMs)
+	assert.Equal(t, map[string]string{"team": "data"}, first.Labels)
+
+	// Every execution follows once the store is released, in order
+	store.open()
+	count := 1
+	var last models.ExecutionExportRecord
+	for lines.Scan() {
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &last))
+		count++
+	}
+	require.NoError(t, lines.Err())
+	assert.Equal(t, total, count)
+	assert.Equal(t, fmt.Sprintf("exec-%05d", total-1), last.ID)
+}
+
+func TestExecutionExportCSVAndFilters(t *testing.T) {
+	store := models.NewInMemoryExecutionStore()
+	base := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	tricky := exportedExecution("exec-tricky", "csv-agent", base)
+	tricky.State = types.FailedState
+	tricky.ErrorMessage = "step 1 failed, retrying\n\"quoted\" step 2 failed"
+	tricky.ErrorCategory = types.AgentError
+	tricky.ExitCode = 3
+	tricky.RetryCount = 2
+	tricky.Labels["team"] = "data, platform"
+	require.NoError(t, store.SaveExecution(tricky))
+	running := exportedExecution("exec-running", "csv-agent", base.Add(time.Hour))
+	running.State, running.EndTime = types.RunningState, nil
+	require.NoError(t, store.SaveExecution(running))
+	require.NoError(t, store.SaveExecution(exportedExecution("exec-other", "other-agent", base.Add(30*time.Minute))))
+	require.NoError(t, store.SaveExecution(exportedExecution("exec-late", "csv-agent", base.Add(48*time.Hour))))
+	server := newExportServer(t, store)
+
+	// Commas, quotes and newlines survive the CSV escaping
+	client := supervisorctl.NewClient(server.URL)
+	path := filepath.Join(t.TempDir(), "runs.csv")
+	_, err := client.ExportExecutionsToFile(context.Background(), path, supervisorctl.ExecutionExportOptions{
+		AgentID: "csv-agent",
+		Until:   base.Add(2 * time.Hour),
+	})
+	require.NoError(t, err)
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, []string{"id", "agent_id", "state", "trigger_type", "start_time", "end_time", "duration_ms",
+		"retry_count", "error_category", "exit_code", "error", "label_team"}, rows[0])
+	assert.Equal(t, []string{"exec-tricky", "csv-agent", "failed", "api", "2026-05-01T00:00:00Z", "2026-05-01T00:00:01.5Z", "1500",
+		"2", "agent", "3", tricky.ErrorMessage, "data, platform"}, rows[1])
+	// A running execution has no end or duration yet
+	assert.Equal(t, "exec-running", rows[2][0])
+	assert.Empty(t, rows[2][5])
+	assert.Empty(t, rows[2][6])
+
+	// since and until bound the start time, and labels select like the list endpoint
+	export := func(query string) []string {
+		var out bytes.Buffer
+		response, err := http.Get(server.URL + "/api/v1/executions/export?" + query)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		_, err = io.Copy(&out, response.Body)
+		require.NoError(t, err)
+		var ids []string
+		scanner := bufio.NewScanner(&out)
+		for scanner.Scan() {
+			var record models.ExecutionExportRecord
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			ids = append(ids, record.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"exec-other", "exec-running", "exec-late"}, export("since=2026-05-01T00:30:00Z"))
+	assert.Equal(t, []string{"exec-tricky", "exec-other"}, export("since=2026-05-01T00:00:00Z&until=2026-05-01T01:00:00Z"))
+	assert.Equal(t, []string{"exec-tricky"}, export("label=team=data,%20platform"))
+	assert.Equal(t, []string{"exec-late"}, export("agent_id=csv-agent&since=2026-05-02T00:00:00Z"))
+
+	// Invalid parameters are refused before anything is streamed
+	for _, query := range []string{"format=xml", "since=yesterday", "until=24h"} {
+		response, err := http.Get(server.URL + "/api/v1/executions/export?" + query)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+	}
+
+	// The client accepts durations before now for --since
+	since, err := supervisorctl.ParseExportTime("24h", base)
+	require.NoError(t, err)
+	assert.Equal(t, base.Add(-24*time.Hour), since)
+}
@@ -0,0 +1,179 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newLabelsTestRouter wires the JSON-RPC and execution query handlers around shared services
+func newLabelsTestRouter(t *testing.T) (*gin.Engine, *services.MetricsCollector) {
+	gin.SetMode(gin.TestMode)
+	logger, _ := zap.NewDevelopment()
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(&models.AgentConfiguration{
+		ID:                      "labels-agent",
+		Name:                    "Labels Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/echo",
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 5,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 30,
+		Enabled:                 true,
+	}))
+
+	metricsCollector := services.NewMetricsCollector(logger)
+	metricsCollector.SetLabelAllowList([]string{"team"})
+
+	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetMetricsCollector(metricsCollector)
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+
+	router := gin.New()
+	handlers.NewJSONRPCHandlers(agentService, services.NewExecutionCoordinator(agentService, executionService, logger), logger, a2aConfig).RegisterJSONRPCRoutes(router)
+	handlers.NewExecutionHandlers(executionService, logger).RegisterExecutionRoutes(router.Group("/api/v1"))
+
+	return router, metricsCollector
+}
+
+func executeWithLabels(t *testing.T, router *gin.Engine, labels map[string]interface{}) map[string]interface{} {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "execute-agent",
+		"id":      1,
+		"params": map[string]interface{}{
+			"agent_id": "labels-agent",
+			"input":    "hello",
+			"labels":   labels,
+		},
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+func TestExecutionLabelsPropagation(t *testing.T) {
+	router, metricsCollector := newLabelsTestRouter(t)
+
+	response := executeWithLabels(t, router, map[string]interface{}{"team": "payments", "request_source": "billing-cron"})
+	require.Nil(t, response["error"])
+	result := response["result"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"team": "payments", "request_source": "billing-cron"}, result["labels"])
+
+	response = executeWithLabels(t, router, map[string]interface{}{"team": "search"})
+	require.Nil(t, response["error"])
+
+	// Only the payments execution matches the label filter
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions?label=team=payments", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var listing struct {
+		Executions []models.AgentExecution `json:"executions"`
+		Total      int                     `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listing))
+	require.Equal(t, 1, listing.Total)
+	assert.Equal(t, "payments", listing.Executions[0].Labels["team"])
+	assert.Equal(t, "billing-cron", listing.Executions[0].Labels["request_source"])
+
+	// Metrics only track allow-listed label keys
+	labelMetrics := metricsCollector.GetLabelMetrics()
+	assert.Len(t, labelMetrics, 2)
+	assert.Equal(t, int64(1), labelMetrics["team=payments"].TotalExecutions)
+	assert.Equal(t, int64(1), labelMetrics["team=search"].TotalExecutions)
+	_, tracked := labelMetrics["request_source=billing-cron"]
+	assert.False(t, tracked)
+}
+
+func TestExecutionLabelsValidation(t *testing.T) {
+	router, _ := newLabelsTestRouter(t)
+
+	tooMany := make(map[string]interface{})
+	for i := 0; i <= models.MaxLabels; i++ {
+		tooMany[string(rune('a'+i))] = "x"
+	}
+	response := executeWithLabels(t, router, tooMany)
+	require.NotNil(t, response["error"])
+	assert.Equal(t, float64(-32602), response["error"].(map[string]interface{})["code"])
+
+	response = executeWithLabels(t, router, map[string]interface{}{"team": strings.Repeat("x", models.MaxLabelLength+1)})
+	require.NotNil(t, response["error"])
+
+	response = executeWithLabels(t, router, map[string]interface{}{"team": 42})
+	require.NotNil(t, response["error"])
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/executions?label=missing-equals", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestScheduledTaskLabelsRecordedInHistory(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(&models.AgentConfiguration{
+		ID:                      "labels-agent",
+		Name:                    "Labels Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/echo",
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 5,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 30,
+		Enabled:                 true,
+	}))
+	executionService := services.NewExecutionService(agentService, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	scheduler.SetCatchUpInterval(0)
+
+	// A catch-up run is the quickest way to force a scheduled execution
+	lastRun := time.Now().Add(-2*time.Hour - time.Minute)
+	task := &models.ScheduledTask{
+		ID:               "labelled-task",
+		AgentID:          "labels-agent",
+		CronExpression:   "@every 1h",
+		LastScheduledRun: &lastRun,
+		CatchUpPolicy:    types.CatchUpPolicyRunOnce,
+		Labels:           map[string]string{"team": "payments"},
+	}
+	require.NoError(t, scheduler.ScheduleTask(task))
+	defer scheduler.UnscheduleTask(task.ID)
+
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = scheduler.GetTaskHistory(task.ID, 0)
+		return len(history) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "payments", history[0].Labels["team"])
+
+	execution, err := executionService.GetExecution(history[0].ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, "payments", execution.Labels["team"])
+}
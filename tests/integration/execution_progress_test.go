@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutionProgressReporting(t *testing.T) {
+	client, executionService := newStreamServer(t, scriptAgent(t, "progress-agent", models.ReadOnlyAccessType, `echo '@@progress {"percent": 10, "message": "fetching"}' >&2
+echo "fetched 3 pages"
+echo "retrying page 2" >&2
+echo '@@progress {"percent": 60, "message": "parsing"}' >&2
+echo '@@progress {"percent": "lots"}' >&2
+echo "parsed"
+echo '@@progress {"percent": 100, "message": "done"}' >&2
+`))
+
+	events, err := client.StreamExecute(context.Background(), "progress-agent", supervisorctl.StreamExecuteRequest{Input: "x"})
+	require.NoError(t, err)
+
+	// Progress arrives as its own events, never as stderr output
+	var progress []supervisorctl.ProgressEvent
+	var stderr string
+	var result *supervisorctl.ResultEvent
+	for _, event := range collectStream(t, events) {
+		require.NoError(t, event.Err)
+		switch event.Name {
+		case supervisorctl.EventProgress:
+			progress = append(progress, *event.Progress)
+		case supervisorctl.EventOutput:
+			if event.Output.Stream == "stderr" {
+				stderr += event.Output.Data
+			}
+		case supervisorctl.EventResult:
+			result = event.Result
+		}
+	}
+	require.NotNil(t, result)
+	assert.Equal(t, "success", result.Status)
+	require.Len(t, progress, 3)
+	assert.Equal(t, []string{"fetching", "parsing", "done"}, []string{progress[0].Message, progress[1].Message, progress[2].Message})
+	assert.Equal(t, result.ExecutionID, progress[0].ExecutionID)
+	assert.Equal(t, "retrying page 2\n@@progress {\"percent\": \"lots\"}\n", stderr)
+
+	// The execution keeps the latest progress; the stored stderr keeps only the other lines
+	execution, err := client.GetExecution(context.Background(), result.ExecutionID)
+	require.NoError(t, err)
+	require.NotNil(t, execution.Progress)
+	assert.Equal(t, 100.0, execution.Progress.Percent)
+	assert.Equal(t, "done", execution.Progress.Message)
+	assert.False(t, execution.Progress.UpdatedAt.IsZero())
+
+	stored, err := executionService.GetExecutionResult(result.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, "retrying page 2\n@@progress {\"percent\": \"lots\"}\n", stored.Stderr)
+}
@@ -0,0 +1,204 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedAgent returns a read-write agent that runs until a file named after its input appears in the
+// returned directory
+func gatedAgent(t *testing.T, id string) (*models.AgentConfiguration, string) {
+	gates := t.TempDir()
+	body := "name=$(cat)\nwhile [ ! -f \"" + gates + "/$name\" ]; do sleep 0.02; done\necho \"$name\"\n"
+	return scriptAgent(t, id, models.ReadWriteAccessType, body), gates
+}
+
+// openGate lets the gated agent's execution with the given input finish
+func openGate(t *testing.T, gates, input string) {
+	require.NoError(t, os.WriteFile(filepath.Join(gates, input), nil, 0644))
+}
+
+// queuedExecution returns the execution the supervisor reports for executionID
+func queuedExecution(t *testing.T, router *gin.Engine, executionID string) models.AgentExecution {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/executions/"+executionID, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response struct {
+		Execution models.AgentExecution `json:"execution"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response.Execution
+}
+
+// waitForRunning waits until one of the agent's executions runs
+func waitForRunning(t *testing.T, router *gin.Engine, agentID string) {
+	require.Eventually(t, func() bool {
+		recorder := requestJSON(router, http.MethodGet, "/api/v1/executions?agent_id="+agentID, nil)
+		var list struct {
+			Executions []models.AgentExecution `json:"executions"`
+		}
+		if json.Unmarshal(recorder.Body.Bytes(), &list) != nil {
+			return false
+		}
+		for _, execution := range list.Executions {
+			if execution.State == types.RunningState {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestExecutionQueueReturnsPositions(t *testing.T) {
+	agent, gates := gatedAgent(t, "gated-agent")
+	router, _ := newExecuteRouter(t, agent)
+
+	// A finished run gives the agent a recent average duration to estimate waits from
+	openGate(t, gates, "warm")
+	recorder := postExecute(router, "gated-agent", map[string]interface{}{"input": "warm"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	running := make(chan int, 1)
+	go func() {
+		running <- postExecute(router, "gated-agent", map[string]interface{}{"input": "run-0"}).Code
+	}()
+	waitForRunning(t, router, "gated-agent")
+
+	var queued []string
+	var previousWait int64
+	for i, input := range []string{"run-1", "run-2", "run-3"} {
+		recorder := postExecute(router, "gated-agent", map[string]interface{}{"input": input, "queue_behavior": "return_position"})
+		require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+
+		var accepted struct {
+			ExecutionID     string `json:"execution_id"`
+			State           string `json:"state"`
+			QueuePosition   int    `json:"queue_position"`
+			EstimatedWaitMs int64  `json:"estimated_wait_ms"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+		assert.Equal(t, "queued", accepted.State)
+		assert.Equal(t, i+1, accepted.QueuePosition)
+		assert.GreaterOrEqual(t, accepted.EstimatedWaitMs, previousWait)
+		assert.Equal(t, "/api/v1/executions/"+accepted.ExecutionID, recorder.Header().Get("Location"))
+		previousWait = accepted.EstimatedWaitMs
+		queued = append(queued, accepted.ExecutionID)
+	}
+
+	for i, executionID := range queued {
+		execution := queuedExecution(t, router, executionID)
+		assert.Equal(t, types.QueuedState, execution.State)
+		assert.Equal(t, i+1, execution.QueuePosition)
+	}
+
+	// Readers polling the queue while it moves see whole positions; under -race this also checks that
+	// the queue fields only change under the execution service's lock
+	stopPolling := make(chan struct{})
+	polled := make(chan []int, 1)
+	go func() {
+		var positions []int
+		defer func() { polled <- positions }()
+		for {
+			select {
+			case <-stopPolling:
+				return
+			default:
+			}
+			recorder := requestJSON(router, http.MethodGet, "/api/v1/executions?agent_id=gated-agent", nil)
+			var list struct {
+				Executions []models.AgentExecution `json:"executions"`
+			}
+			if json.Unmarshal(recorder.Body.Bytes(), &list) == nil {
+				for _, execution := range list.Executions {
+					positions = append(positions, execution.QueuePosition)
+				}
+			}
+		}
+	}()
+
+	// Each finished execution promotes the head of the queue and moves the others up
+	for i, input := range []string{"run-0", "run-1", "run-2"} {
+		openGate(t, gates, input)
+		require.Eventually(t, func() bool {
+			return queuedExecution(t, router, queued[i]).State == types.RunningState
+		}, 5*time.Second, 20*time.Millisecond, input)
+
+		assert.Zero(t, queuedExecution(t, router, queued[i]).QueuePosition)
+		for j := i + 1; j < len(queued); j++ {
+			execution := queuedExecution(t, router, queued[j])
+			assert.Equal(t, types.QueuedState, execution.State)
+			assert.Equal(t, j-i, execution.QueuePosition)
+		}
+	}
+	assert.Equal(t, http.StatusOK, <-running)
+
+	close(stopPolling)
+	positions := <-polled
+	assert.NotEmpty(t, positions)
+	for _, position := range positions {
+		assert.GreaterOrEqual(t, position, 0)
+		assert.LessOrEqual(t, position, len(queued))
+	}
+
+	openGate(t, gates, "run-3")
+	require.Eventually(t, func() bool {
+		return queuedExecution(t, router, queued[2]).State == types.CompletedState
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestExecutionQueueRunsIdleAgentsAtOnce(t *testing.T) {
+	agent, gates := gatedAgent(t, "idle-agent")
+	router, _ := newExecuteRouter(t, agent)
+
+	// Nothing to wait for: the execution runs and the result comes back as without queue_behavior
+	openGate(t, gates, "now")
+	recorder := postExecute(router, "idle-agent", map[string]interface{}{"input": "now", "queue_behavior": "return_position"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "now")
+
+	recorder = postExecute(router, "idle-agent", map[string]interface{}{"input": "now", "queue_behavior": "later"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "queue_behavior")
+}
+
+func TestExecutionQueueStopQueuedExecution(t *testing.T) {
+	agent, gates := gatedAgent(t, "stop-queued-agent")
+	router, _ := newExecuteRouter(t, agent)
+
+	running := make(chan int, 1)
+	go func() {
+		running <- postExecute(router, "stop-queued-agent", map[string]interface{}{"input": "first"}).Code
+	}()
+
+	waitForRunning(t, router, "stop-queued-agent")
+
+	recorder := postExecute(router, "stop-queued-agent", map[string]interface{}{"input": "second", "queue_behavior": "return_position"})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted struct {
+		ExecutionID   string `json:"execution_id"`
+		QueuePosition int    `json:"queue_position"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	assert.Equal(t, 1, accepted.QueuePosition)
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/"+accepted.ExecutionID+"/stop", nil)
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	assert.Equal(t, types.CancelledState, queuedExecution(t, router, accepted.ExecutionID).State)
+
+	// The stopped execution is skipped once the running one finishes
+	openGate(t, gates, "first")
+	openGate(t, gates, "second")
+	assert.Equal(t, http.StatusOK, <-running)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, types.CancelledState, queuedExecution(t, router, accepted.ExecutionID).State)
+}
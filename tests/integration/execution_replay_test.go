@@ -0,0 +1,177 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayAgent echoes its input, the GREETING environment variable and its arguments
+func replayAgent(t *testing.T) *models.AgentConfiguration {
+	return scriptAgent(t, "replay-agent", models.ReadOnlyAccessType, "echo \"$(cat) $GREETING $*\"\n")
+}
+
+// runOriginal executes the replay agent with overrides and returns the execution's ID
+func runOriginal(t *testing.T, router *gin.Engine, executionService *services.ExecutionService) string {
+	recorder := postExecute(router, "replay-agent", map[string]interface{}{
+		"input":      "hello",
+		"env":        map[string]string{"GREETING": "hi"},
+		"parameters": map[string]interface{}{"name": "world"},
+		"labels":     map[string]string{"team": "qa"},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	executions, err := executionService.ListExecutions("replay-agent")
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	return executions[0].ID
+}
+
+// postReplay replays an execution with body and decodes the response
+func postReplay(t *testing.T, router *gin.Engine, executionID string, body map[string]interface{}) handlers.ReplayExecutionResponse {
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/executions/"+executionID+"/replay", body)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response handlers.ReplayExecutionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+// getDiff fetches the comparison of two executions
+func getDiff(t *testing.T, router *gin.Engine, executionID, otherID, query string) models.ExecutionDiff {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/executions/"+executionID+"/diff/"+otherID+query, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var diff models.ExecutionDiff
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &diff))
+	return diff
+}
+
+func TestExecutionReplayRunsIdenticalInputs(t *testing.T) {
+	router, executionService := newExecuteRouter(t, replayAgent(t))
+	originalID := runOriginal(t, router, executionService)
+
+	original, err := executionService.GetExecution(originalID)
+	require.NoError(t, err)
+	require.NotNil(t, original.Inputs)
+	assert.Equal(t, "hello", original.Inputs.Input)
+	assert.Equal(t, []string{"GREETING"}, original.Inputs.EnvKeys)
+
+	replay := postReplay(t, router, originalID, nil)
+	assert.Equal(t, originalID, replay.ReplayOf)
+	assert.NotEqual(t, originalID, replay.ExecutionID)
+	require.NotNil(t, replay.Result)
+	assert.Equal(t, types.SuccessStatus, replay.Result.Status)
+	assert.Equal(t, "hello hi --name world\n", replay.Result.Output)
+
+	execution, err := executionService.GetExecution(replay.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, originalID, execution.ReplayOf)
+	assert.Equal(t, map[string]string{"team": "qa"}, execution.Labels)
+	originalResult, err := executionService.GetExecutionResult(originalID)
+	require.NoError(t, err)
+	assert.Equal(t, originalResult.Output, replay.Result.Output)
+
+	diff := getDiff(t, router, originalID, replay.ExecutionID, "")
+	assert.Empty(t, diff.Changed)
+	assert.Empty(t, diff.OutputDiff)
+	assert.Equal(t, "success", diff.Status)
+	assert.Equal(t, diff.OtherDurationMs-diff.DurationMs, diff.DurationDeltaMs)
+}
+
+func TestExecutionReplayOverridesAndDiff(t *testing.T) {
+	router, executionService := newExecuteRouter(t, replayAgent(t))
+	originalID := runOriginal(t, router, executionService)
+
+	replay := postReplay(t, router, originalID, map[string]interface{}{
+		"input": "goodbye",
+		"env":   map[string]string{"GREETING": "bye"},
+	})
+	require.NotNil(t, replay.Result)
+	assert.Equal(t, "goodbye bye --name world\n", replay.Result.Output, "parameters not overridden are kept")
+
+	diff := getDiff(t, router, originalID, replay.ExecutionID, "")
+	assert.Equal(t, []string{"input", "env", "output"}, diff.Changed)
+	assert.Contains(t, diff.OutputDiff, "--- "+originalID)
+	assert.Contains(t, diff.OutputDiff, "-hello hi --name world\n")
+	assert.Contains(t, diff.OutputDiff, "+goodbye bye --name world\n")
+	assert.False(t, diff.OutputDiffTruncated)
+
+	truncated := getDiff(t, router, originalID, replay.ExecutionID, "?limit=20")
+	assert.True(t, truncated.OutputDiffTruncated)
+	assert.LessOrEqual(t, len(truncated.OutputDiff), 20)
+}
+
+func TestExecutionReplayErrors(t *testing.T) {
+	router, executionService := newExecuteRouter(t, replayAgent(t))
+	originalID := runOriginal(t, router, executionService)
+
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/executions/missing/replay", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "EXECUTION_NOT_FOUND", "replay missing execution")
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/executions/"+originalID+"/diff/missing", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/executions/"+originalID+"/diff/"+originalID+"?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Invalid overrides are rejected like execute requests
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/executions/"+originalID+"/replay", map[string]interface{}{"working_dir": "relative"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+
+	// Executions still running cannot be compared
+	slow := scriptAgent(t, "slow-replay-agent", models.ReadOnlyAccessType, "sleep 2\n")
+	router, executionService = newExecuteRouter(t, slow)
+	recorder = postExecute(router, "slow-replay-agent", map[string]interface{}{"async": true})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var accepted handlers.AgentExecuteAccepted
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted))
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/executions/"+accepted.ExecutionID+"/diff/"+accepted.ExecutionID, nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "EXECUTION_CONFLICT", "diff running execution")
+
+	require.Eventually(t, func() bool {
+		return executionService.StopExecution(accepted.ExecutionID, "", "test done", "") == nil
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestExecutionReplayClient(t *testing.T) {
+	router, executionService := newExecuteRouter(t, replayAgent(t))
+	originalID := runOriginal(t, router, executionService)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+
+	replay, err := client.ReplayExecution(context.Background(), originalID, supervisorctl.ReplayRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, originalID, replay.ReplayOf)
+	require.NotNil(t, replay.Result)
+	assert.Equal(t, "hello hi --name world\n", replay.Result.Output)
+
+	execution, err := client.GetExecution(context.Background(), replay.ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, originalID, execution.ReplayOf)
+	assert.Empty(t, replay.Warnings)
+	snapshot, err := client.GetExecutionSnapshot(context.Background(), replay.ExecutionID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, snapshot.ExecutableSHA256)
+	assert.Contains(t, snapshot.EnvNames, "GREETING")
+
+	diff, err := client.DiffExecutions(context.Background(), originalID, replay.ExecutionID, 0)
+	require.NoError(t, err)
+	var output bytes.Buffer
+	diff.Print(&output)
+	assert.Contains(t, output.String(), "executions:  "+originalID+" -> "+replay.ExecutionID+"\n")
+	assert.Contains(t, output.String(), "changed:     nothing\n")
+}
@@ -0,0 +1,122 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// loggingAgent is an agent of accessType that logs when each run starts and ends to the returned log
+func loggingAgent(t *testing.T, id string, accessType types.AgentAccessType) (*models.AgentConfiguration, string) {
+	log := filepath.Join(t.TempDir(), "runs.log")
+	return scriptAgent(t, id, accessType, "echo start >> "+log+"\nsleep 0.3\necho end >> "+log+"\ncat\n"), log
+}
+
+// readRunLog returns the start and end lines of a logging agent's log
+func readRunLog(t *testing.T, log string) []string {
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	return strings.Fields(string(data))
+}
+
+func TestExecutionRouterSerializesReadWriteAcrossProtocols(t *testing.T) {
+	agent, log := loggingAgent(t, "rw-agent", models.ReadWriteAccessType)
+	f := newPipelineFixture(t, agent)
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+	handlers.NewJSONRPCHandlers(f.agentService, f.coordinator, zap.NewNop(), a2aConfig).RegisterJSONRPCRoutes(f.router)
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, f.executionService, nil, zap.NewNop(), a2aConfig)
+
+	require.NoError(t, f.scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "rw-task", Name: "rw-task", AgentID: "rw-agent", CronExpression: "0 0 1 1 *", Enabled: true,
+	}))
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	run := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, fn(), name)
+		}()
+	}
+
+	run("json-rpc", func() error {
+		body, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "execute-agent",
+			"id":      1,
+			"params":  map[string]interface{}{"agent_id": "rw-agent", "input": "rpc"},
+		})
+		recorder := httptest.NewRecorder()
+		f.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+		var response struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			return err
+		}
+		if response.Error != nil {
+			return fmt.Errorf("execute-agent failed: %s", response.Error)
+		}
+		return nil
+	})
+	run("scheduler", func() error {
+		_, err := f.scheduler.ExecuteTask(context.Background(), "rw-task")
+		return err
+	})
+	run("grpc", func() error {
+		_, err := grpcHandlers.SendMessage(context.Background(), &handlers.A2AMessageSendRequest{
+			AgentId: "rw-agent",
+			Message: &handlers.A2AMessage{Id: "message-1", Context: &handlers.A2AContext{From: "client", To: "rw-agent"}},
+		})
+		return err
+	})
+	close(start)
+	wg.Wait()
+
+	// Each run ends before the next one starts
+	assert.Equal(t, []string{"start", "end", "start", "end", "start", "end"}, readRunLog(t, log))
+}
+
+func TestExecutionRouterRunsReadOnlyConcurrently(t *testing.T) {
+	agent, log := loggingAgent(t, "ro-agent", models.ReadOnlyAccessType)
+	agent.MaxConcurrentExecutions = 2
+	f := newPipelineFixture(t, agent)
+	require.NoError(t, f.scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "ro-task", Name: "ro-task", AgentID: "ro-agent", CronExpression: "0 0 1 1 *", Enabled: true,
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		recorder := f.request(http.MethodPost, "/api/v1/agents/ro-agent/execute", map[string]string{"input": "rest"})
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := f.scheduler.ExecuteTask(context.Background(), "ro-task")
+		assert.NoError(t, err)
+	}()
+	wg.Wait()
+
+	assert.Equal(t, []string{"start", "start", "end", "end"}, readRunLog(t, log))
+}
@@ -0,0 +1,84 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getSnapshot fetches the environment snapshot of an execution
+func getSnapshot(t *testing.T, router *gin.Engine, executionID string) models.ExecutionSnapshot {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/executions/"+executionID+"/snapshot", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var snapshot models.ExecutionSnapshot
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &snapshot))
+	return snapshot
+}
+
+func TestExecutionSnapshotRecordsEnvironment(t *testing.T) {
+	agent := replayAgent(t)
+	agent.CliArgs = map[string]string{"--mode": "fast"}
+	router, executionService := newExecuteRouter(t, agent)
+	executionID := runOriginal(t, router, executionService)
+
+	snapshot := getSnapshot(t, router, executionID)
+	content, err := os.ReadFile(agent.ExecutablePath)
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, agent.ExecutablePath, snapshot.ExecutablePath)
+	assert.Equal(t, hex.EncodeToString(sum[:]), snapshot.ExecutableSHA256)
+	require.Len(t, snapshot.Argv, 5)
+	assert.Equal(t, agent.ExecutablePath, snapshot.Argv[0])
+	assert.Subset(t, snapshot.Argv, []string{"--mode", "fast", "--name", "world"})
+	assert.NotEmpty(t, snapshot.WorkingDir)
+	assert.NotEmpty(t, snapshot.SupervisorVersion)
+	assert.NotEmpty(t, snapshot.Host)
+	assert.False(t, snapshot.CapturedAt.IsZero())
+
+	// Names of the variables passed are kept, their values are not
+	assert.Contains(t, snapshot.EnvNames, "GREETING")
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/executions/"+executionID+"/snapshot", nil)
+	assert.NotContains(t, recorder.Body.String(), `"hi"`)
+
+	// The snapshot is served on its own, not with the execution
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/executions/"+executionID, nil)
+	assert.NotContains(t, recorder.Body.String(), "executable_sha256")
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/executions/missing/snapshot", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestExecutionSnapshotReplayWarnsOfChangedBinary(t *testing.T) {
+	agent := replayAgent(t)
+	router, executionService := newExecuteRouter(t, agent)
+	executionID := runOriginal(t, router, executionService)
+	original := getSnapshot(t, router, executionID)
+
+	// Replaying with the same binary runs without warnings
+	unchanged := postReplay(t, router, executionID, nil)
+	assert.Empty(t, unchanged.Warnings)
+	assert.Equal(t, original.ExecutableSHA256, getSnapshot(t, router, unchanged.ExecutionID).ExecutableSHA256)
+
+	// The binary is replaced between the original run and the replay
+	require.NoError(t, os.WriteFile(agent.ExecutablePath, []byte("#!/bin/sh\necho \"changed $(cat)\"\n"), 0755))
+	replay := postReplay(t, router, executionID, nil)
+	require.Len(t, replay.Warnings, 1)
+	assert.Contains(t, replay.Warnings[0], "executable "+agent.ExecutablePath+" changed")
+	assert.Contains(t, replay.Warnings[0], original.ExecutableSHA256)
+	assert.Contains(t, replay.Result.Output, "changed hello")
+
+	replayed := getSnapshot(t, router, replay.ExecutionID)
+	assert.NotEqual(t, original.ExecutableSHA256, replayed.ExecutableSHA256)
+	assert.Equal(t, original.ExecutablePath, replayed.ExecutablePath)
+	current, err := agents.HashExecutable(agent.ExecutablePath)
+	require.NoError(t, err)
+	assert.Equal(t, current, replayed.ExecutableSHA256)
+}
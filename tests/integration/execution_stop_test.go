@@ -0,0 +1,100 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interruptOnlyScript ignores SIGTERM and only exits on SIGINT. It reports "started" progress once
+// both traps are set, since a signal arriving before then kills the shell on the default disposition.
+const interruptOnlyScript = "trap '' TERM\ntrap 'echo interrupted; exit 0' INT\necho started\n" +
+	"echo '@@progress {\"percent\": 0, \"message\": \"started\"}' >&2\nwhile :; do sleep 0.1; done\n"
+
+// interruptOnlyAgent is stopped with SIGINT and killed when it has not exited after stopWait seconds
+func interruptOnlyAgent(t *testing.T, id string, stopWait int) *models.AgentConfiguration {
+	agent := scriptAgent(t, id, models.ReadOnlyAccessType, interruptOnlyScript)
+	agent.StopSignal = "INT"
+	agent.StopWaitSeconds = stopWait
+	return agent
+}
+
+// startExecution starts an execution of the agent and waits until the agent reports it started
+func startExecution(t *testing.T, f *pipelineFixture, agentID string) string {
+	pending, _, err := f.coordinator.Start(context.Background(), services.ExecutionRequest{AgentID: agentID, Input: "x"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		execution, err := f.executionService.GetExecution(pending.ID)
+		return err == nil && execution.State == models.RunningState &&
+			execution.Progress != nil && execution.Progress.Message == "started"
+	}, 5*time.Second, 10*time.Millisecond)
+	return pending.ID
+}
+
+// stopExecution stops an execution through the REST API and returns the time it took the agent to exit
+func stopExecution(t *testing.T, f *pipelineFixture, executionID, query string) (*models.AgentExecution, time.Duration) {
+	start := time.Now()
+	recorder := f.request(http.MethodPost, "/api/v1/executions/"+executionID+"/stop"+query, nil)
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+
+	var response struct {
+		Execution models.AgentExecution `json:"execution"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.EqualValues(t, models.CancelledState, response.Execution.State)
+
+	var execution *models.AgentExecution
+	require.Eventually(t, func() bool {
+		var err error
+		execution, err = f.executionService.GetExecution(executionID)
+		return err == nil && execution.EndTime != nil
+	}, 10*time.Second, 10*time.Millisecond)
+	return execution, time.Since(start)
+}
+
+func TestStopExecutionSendsConfiguredSignal(t *testing.T) {
+	f := newPipelineFixture(t, interruptOnlyAgent(t, "interrupt-agent", 5))
+	executionID := startExecution(t, f, "interrupt-agent")
+
+	execution, elapsed := stopExecution(t, f, executionID, "")
+	assert.EqualValues(t, models.CancelledState, execution.State)
+	assert.False(t, execution.ForcedKill)
+	assert.Less(t, elapsed, 3*time.Second)
+}
+
+func TestStopExecutionEscalatesToKill(t *testing.T) {
+	f := newPipelineFixture(t, interruptOnlyAgent(t, "interrupt-agent", 1))
+	executionID := startExecution(t, f, "interrupt-agent")
+
+	// The one-off TERM is ignored, so the agent is killed after its stop wait
+	execution, elapsed := stopExecution(t, f, executionID, "?signal=TERM")
+	assert.EqualValues(t, models.CancelledState, execution.State)
+	assert.True(t, execution.ForcedKill)
+	assert.GreaterOrEqual(t, elapsed, time.Second)
+	assert.Less(t, elapsed, 4*time.Second)
+}
+
+func TestStopExecutionErrors(t *testing.T) {
+	f := newPipelineFixture(t, interruptOnlyAgent(t, "interrupt-agent", 1))
+	executionID := startExecution(t, f, "interrupt-agent")
+
+	recorder := f.request(http.MethodPost, "/api/v1/executions/"+executionID+"/stop?signal=STOP", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "unsupported signal")
+
+	stopExecution(t, f, executionID, "?signal=int")
+	recorder = f.request(http.MethodPost, "/api/v1/executions/"+executionID+"/stop", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "INVALID_STATE_TRANSITION", "stopped execution")
+
+	recorder = f.request(http.MethodPost, "/api/v1/executions/missing/stop", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "EXECUTION_NOT_FOUND", "unknown execution")
+}
@@ -0,0 +1,299 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// newTriggerFixture serves the REST and JSON-RPC routes over a single echo agent
+func newTriggerFixture(t *testing.T) *pipelineFixture {
+	f := newPipelineFixture(t, scriptAgent(t, "trigger-agent", models.ReadOnlyAccessType, "echo \"$(cat)\"\n"))
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+	handlers.NewJSONRPCHandlers(f.agentService, f.coordinator, zap.NewNop(), a2aConfig).RegisterJSONRPCRoutes(f.router)
+	return f
+}
+
+// postTriggered runs the agent over REST with the given headers and returns the result
+func postTriggered(t *testing.T, f *pipelineFixture, headers map[string]string) models.ExecutionResult {
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents/trigger-agent/execute", bytes.NewReader([]byte(`{"input": "hi"}`)))
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return result
+}
+
+// listTriggered returns the executions matching the query string
+func listTriggered(t *testing.T, f *pipelineFixture, query string) []models.AgentExecution {
+	recorder := f.request(http.MethodGet, "/api/v1/executions?"+query, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var listing struct {
+		Executions []models.AgentExecution `json:"executions"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &listing))
+	return listing.Executions
+}
+
+func TestExecutionTriggerREST(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	// Plain REST calls are api executions of the token's client identity
+	result := postTriggered(t, f, map[string]string{"Authorization": "Bearer ci-token"})
+	assert.Equal(t, types.TaskTriggerTypeAPI, result.TriggerType)
+	assert.Equal(t, services.ClientIDForToken("ci-token"), result.TriggeredBy)
+
+	// Interactive clients mark their executions manual; callers without a token are known by address
+	result = postTriggered(t, f, map[string]string{handlers.TriggerTypeHeader: "manual"})
+	assert.Equal(t, types.TaskTriggerTypeManual, result.TriggerType)
+	assert.Equal(t, services.ClientIDForAddress("192.0.2.1"), result.TriggeredBy)
+
+	// The query API filters on both fields
+	manual := listTriggered(t, f, "trigger_type=manual")
+	require.Len(t, manual, 1)
+	assert.Equal(t, result.TriggeredBy, manual[0].TriggeredBy)
+	assert.Len(t, listTriggered(t, f, "triggered_by="+services.ClientIDForToken("ci-token")), 1)
+	assert.Empty(t, listTriggered(t, f, "trigger_type=manual&triggered_by="+services.ClientIDForToken("ci-token")))
+
+	// Other trigger types cannot be claimed over REST
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents/trigger-agent/execute", bytes.NewReader([]byte(`{"input": "hi"}`)))
+	request.Header.Set(handlers.TriggerTypeHeader, "scheduled")
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", handlers.TriggerTypeHeader)
+}
+
+func TestExecutionTriggerJSONRPC(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "execute-agent",
+		"id":      1,
+		"params":  map[string]interface{}{"agent_id": "trigger-agent", "input": "hi"},
+	})
+	request := httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body))
+	request.Header.Set("Authorization", "Bearer rpc-token")
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.NotNil(t, response.Result, recorder.Body.String())
+	assert.Equal(t, "jsonrpc", response.Result["trigger_type"])
+	assert.Equal(t, services.ClientIDForToken("rpc-token"), response.Result["triggered_by"])
+	assert.Equal(t, "hi\n", response.Result["output"])
+
+	result, err := f.executionService.GetExecutionResult(response.Result["execution_id"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, types.TaskTriggerTypeJSONRPC, result.TriggerType)
+}
+
+func TestExecutionTriggerGRPC(t *testing.T) {
+	f := newTriggerFixture(t)
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, f.executionService, nil, zap.NewNop(), a2a.DefaultA2AConfig())
+
+	send := func(ctx context.Context) {
+		_, err := grpcHandlers.SendMessage(ctx, &handlers.A2AMessageSendRequest{
+			AgentId: "trigger-agent",
+			Message: &handlers.A2AMessage{Id: "message-1", Context: &handlers.A2AContext{From: "client", To: "trigger-agent"}},
+		})
+		require.NoError(t, err)
+	}
+
+	// The bearer token identifies the caller; without one its peer address does
+	send(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer grpc-token")))
+	send(peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 5000}}))
+
+	executions := listTriggered(t, f, "trigger_type=grpc")
+	require.Len(t, executions, 2)
+	assert.Equal(t, services.ClientIDForToken("grpc-token"), executions[0].TriggeredBy)
+	assert.Equal(t, services.ClientIDForAddress("10.0.0.7:5000"), executions[1].TriggeredBy)
+}
+
+func TestExecutionTriggerGRPCRunsAgent(t *testing.T) {
+	f := newTriggerFixture(t)
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, f.executionService, nil, zap.NewNop(), a2a.DefaultA2AConfig())
+
+	// The response carries the output of the agent process, not a canned message
+	response, err := grpcHandlers.SendMessage(context.Background(), &handlers.A2AMessageSendRequest{
+		AgentId: "trigger-agent",
+		Message: &handlers.A2AMessage{
+			Id:      "message-1",
+			Context: &handlers.A2AContext{From: "client", To: "trigger-agent"},
+			Payload: &handlers.A2APayload{Method: "greet", Params: "world"},
+		},
+	})
+	require.NoError(t, err)
+	result := response.Message.Payload.Result
+	assert.Equal(t, string(types.SuccessStatus), result.Status)
+	assert.Equal(t, "greet: world\n", result.Output)
+
+	stored, err := f.executionService.GetExecutionResult(result.ExecutionId)
+	require.NoError(t, err)
+	assert.Equal(t, result.Output, stored.Output)
+}
+
+// resultlessExecutions loses the result of every execution and ends them in state, when set
+type resultlessExecutions struct {
+	services.IExecutionService
+	state types.AgentState
+}
+
+func (r *resultlessExecutions) ExecuteAgent(ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, error) {
+	execution, err := r.IExecutionService.ExecuteAgent(ctx, agent, input)
+	if err == nil && r.state != "" {
+		execution.State = r.state
+	}
+	return execution, err
+}
+
+func (r *resultlessExecutions) GetExecutionResult(executionID string) (*models.ExecutionResult, error) {
+	return nil, errors.New("result lost")
+}
+
+func TestExecutionTriggerGRPCWithoutResult(t *testing.T) {
+	f := newTriggerFixture(t)
+	executions := &resultlessExecutions{IExecutionService: f.executionService}
+	grpcHandlers := handlers.NewGRPCHandlers(f.agentService, executions, nil, zap.NewNop(), a2a.DefaultA2AConfig())
+	send := func() (*handlers.A2AMessageSendResponse, error) {
+		return grpcHandlers.SendMessage(context.Background(), &handlers.A2AMessageSendRequest{
+			AgentId: "trigger-agent",
+			Message: &handlers.A2AMessage{Id: "message-1", Context: &handlers.A2AContext{From: "client", To: "trigger-agent"}},
+		})
+	}
+
+	// A completed run whose result cannot be read is never reported as a success
+	_, err := send()
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// A run that ended without success reports how it ended
+	executions.state = models.FailedState
+	response, err := send()
+	require.NoError(t, err)
+	assert.Equal(t, string(types.FailureStatus), response.Message.Payload.Result.Status)
+
+	executions.state = models.CancelledState
+	response, err = send()
+	require.NoError(t, err)
+	assert.Equal(t, string(types.CancelledStatus), response.Message.Payload.Result.Status)
+}
+
+func TestExecutionTriggerScheduler(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	task := &models.ScheduledTask{
+		ID:             "trigger-task",
+		Name:           "Trigger Task",
+		AgentID:        "trigger-agent",
+		CronExpression: "@every 1s",
+		Enabled:        true,
+	}
+	require.NoError(t, f.scheduler.ScheduleTask(task))
+	defer f.scheduler.UnscheduleTask(task.ID)
+
+	// Scheduled runs are attributed to the scheduler in executions and history
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = f.scheduler.GetTaskHistory(task.ID, 0)
+		return len(history) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, types.TaskTriggerTypeScheduled, history[0].TriggerType)
+	assert.Equal(t, "scheduler:trigger-task", history[0].TriggeredBy)
+
+	execution, err := f.executionService.GetExecution(history[0].ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.TaskTriggerTypeScheduled, execution.TriggerType)
+	assert.Equal(t, "scheduler:trigger-task", execution.TriggeredBy)
+
+	// Running the task on demand over REST is a manual run by the caller
+	request := httptest.NewRequest(http.MethodPost, "/tasks/trigger-task/execute", nil)
+	request.Header.Set("Authorization", "Bearer operator-token")
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "manual", response.Result["trigger_type"])
+	assert.Equal(t, services.ClientIDForToken("operator-token"), response.Result["triggered_by"])
+
+	// Without a caller, ExecuteTask is a manual run by the scheduler
+	result, err := f.scheduler.ExecuteTask(context.Background(), task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.TaskTriggerTypeManual, result.TriggerType)
+	assert.Equal(t, "scheduler:trigger-task", result.TriggeredBy)
+	assert.Equal(t, types.SuccessStatus, result.Status)
+	assert.Equal(t, "\n", result.Output, "the agent echoes the task's empty input")
+
+	manual := listTriggered(t, f, "trigger_type=manual&triggered_by=scheduler:trigger-task")
+	require.Len(t, manual, 1)
+	assert.Equal(t, result.ID, manual[0].ID)
+}
+
+func TestExecutionTriggerPipelineSteps(t *testing.T) {
+	f := newTriggerFixture(t)
+
+	created := f.request(http.MethodPost, "/api/v1/pipelines", handlers.PipelineRequest{
+		ID:    "trigger-pipeline",
+		Name:  "Trigger Pipeline",
+		Steps: []models.PipelineStep{{AgentID: "trigger-agent"}, {AgentID: "trigger-agent"}},
+	})
+	require.Equal(t, http.StatusCreated, created.Code, created.Body.String())
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/pipelines/trigger-pipeline/execute", bytes.NewReader([]byte(`{"input": "hi"}`)))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(handlers.TriggerTypeHeader, "manual")
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var run models.PipelineExecution
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &run))
+	assert.Equal(t, types.TaskTriggerTypeManual, run.TriggerType)
+
+	// Every step inherits the pipeline run's trigger
+	steps := listTriggered(t, f, "label=pipeline_execution_id="+run.ID)
+	require.Len(t, steps, 2)
+	for _, step := range steps {
+		assert.Equal(t, types.TaskTriggerTypeManual, step.TriggerType)
+		assert.Equal(t, run.TriggeredBy, step.TriggeredBy)
+	}
+	assert.Empty(t, listTriggered(t, f, "trigger_type=api"))
+}
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// exitCodeAgent is a script agent printing its name and exiting with code, under an exit code map
+func exitCodeAgent(t *testing.T, id, code string, exitCodes models.ExitCodeMap) *models.AgentConfiguration {
+	config := scriptAgent(t, id, models.ReadOnlyAccessType, "echo "+id+"\nexit "+code+"\n")
+	config.ExitCodeMap = exitCodes
+	return config
+}
+
+// runRetriedTask schedules a task of the agent allowing two retries, waits for its first runs to
+// finish and returns their history
+func runRetriedTask(t *testing.T, scheduler *services.SchedulerService, agentID string, done func([]*models.ExecutionHistory) bool) []*models.ExecutionHistory {
+	taskID := agentID + "-task"
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: taskID, Name: taskID, AgentID: agentID, CronExpression: "* * * * * *", Enabled: true, MaxRetries: 2,
+	}))
+
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = scheduler.GetTaskHistory(taskID, 20)
+		return done(history)
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NoError(t, scheduler.PauseTask(taskID))
+	return history
+}
+
+func TestExitCodeMapStatuses(t *testing.T) {
+	logger := zap.NewNop()
+	exitCodes := models.ExitCodeMap{"1": types.SuccessStatus, "2-3": types.WarningStatus}
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range []*models.AgentConfiguration{
+		exitCodeAgent(t, "grep-agent", "1", exitCodes),
+		exitCodeAgent(t, "lint-agent", "3", exitCodes),
+		exitCodeAgent(t, "broken-agent", "4", exitCodes),
+	} {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	metrics := services.NewMetricsCollector(logger)
+	executionService.SetMetricsCollector(metrics)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	t.Cleanup(scheduler.Stop)
+
+	// An exit code mapped to success is a success, and is not retried
+	history := runRetriedTask(t, scheduler, "grep-agent", func(history []*models.ExecutionHistory) bool { return len(history) > 0 })
+	for _, run := range history {
+		assert.Equal(t, types.SuccessStatus, run.Status)
+		assert.Zero(t, run.RetryCount)
+		assert.Empty(t, run.Error)
+	}
+	execution, err := executionService.GetExecution(history[0].ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.CompletedState, execution.State)
+	assert.Equal(t, types.SuccessStatus, execution.Status)
+	assert.Equal(t, 1, execution.RetryCount)
+	assert.Equal(t, 1, execution.ExitCode)
+	result, err := executionService.GetExecutionResult(history[0].ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, "grep-agent\n", result.Output)
+
+	// An exit code mapped to warning completes with the warning status
+	history = runRetriedTask(t, scheduler, "lint-agent", func(history []*models.ExecutionHistory) bool { return len(history) > 0 })
+	for _, run := range history {
+		assert.Equal(t, types.WarningStatus, run.Status)
+		assert.Zero(t, run.RetryCount)
+	}
+	result, err = executionService.GetExecutionResult(history[0].ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.WarningStatus, result.Status)
+	assert.Contains(t, result.Error, "mapped to warning")
+
+	// Unmapped nonzero exit codes still fail, and are retried
+	history = runRetriedTask(t, scheduler, "broken-agent", func(history []*models.ExecutionHistory) bool {
+		for _, run := range history {
+			if run.RetryCount == 2 {
+				return true
+			}
+		}
+		return false
+	})
+	for _, run := range history {
+		assert.Equal(t, types.FailureStatus, run.Status)
+	}
+
+	// Warnings have their own counter and do not count as failures
+	time.Sleep(200 * time.Millisecond) // Lets runs fired before the pauses finish
+	grep, ok := metrics.GetAgentMetrics("grep-agent")
+	require.True(t, ok)
+	assert.Positive(t, grep.SuccessfulExecutions)
+	assert.Zero(t, grep.WarningExecutions)
+	assert.Zero(t, grep.FailedExecutions)
+	assert.Equal(t, 100.0, grep.SuccessRate)
+	lint, ok := metrics.GetAgentMetrics("lint-agent")
+	require.True(t, ok)
+	assert.Zero(t, lint.SuccessfulExecutions)
+	assert.Positive(t, lint.WarningExecutions)
+	assert.Zero(t, lint.FailedExecutions)
+	broken, ok := metrics.GetAgentMetrics("broken-agent")
+	require.True(t, ok)
+	assert.Positive(t, broken.FailedExecutions)
+
+	succeeded, warned, failed := metrics.ExecutionCounts()
+	assert.Equal(t, grep.SuccessfulExecutions, succeeded)
+	assert.Equal(t, lint.WarningExecutions, warned)
+	assert.Positive(t, failed)
+}
@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newFaultRouter serves the REST routes with fault injection enabled over the given agents
+func newFaultRouter(t *testing.T, agents ...*models.AgentConfiguration) (*gin.Engine, *services.ExecutionService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	faultInjector := services.NewFaultInjector(logger)
+	executionService.SetFaultInjector(faultInjector)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		FaultInjector:        faultInjector,
+		Logger:               logger,
+	})
+	return router, executionService
+}
+
+// addFault registers a fault rule through the API and returns it
+func addFault(t *testing.T, router *gin.Engine, rule map[string]interface{}) models.FaultRule {
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/debug/faults", rule)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var added models.FaultRule
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &added))
+	return added
+}
+
+// listFaults returns the fault rules that have not expired
+func listFaults(t *testing.T, router *gin.Engine) []models.FaultRule {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/debug/faults", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Faults []models.FaultRule `json:"faults"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response.Faults
+}
+
+// countFailed returns how many executions of the agent failed
+func countFailed(t *testing.T, executionService *services.ExecutionService, agentID string) int {
+	executions, err := executionService.ListExecutions(agentID)
+	require.NoError(t, err)
+	failed := 0
+	for _, execution := range executions {
+		if execution.State == models.FailedState {
+			assert.Contains(t, execution.ErrorMessage, "injected fault")
+			failed++
+		}
+	}
+	return failed
+}
+
+func TestFaultInjectionFailsShareOfExecutions(t *testing.T) {
+	router, executionService := newFaultRouter(t, validationAgent("flaky-agent", ""), validationAgent("steady-agent", ""))
+	rule := addFault(t, router, map[string]interface{}{
+		"point": "pre_execution", "action": "fail", "agent_id": "flaky-agent", "probability": 0.3,
+	})
+	assert.Equal(t, int(services.DefaultFaultRuleTTL/time.Second), rule.TTLSeconds)
+
+	const runs = 300
+	for i := 0; i < runs; i++ {
+		postExecute(router, "flaky-agent", map[string]interface{}{"input": "x"})
+	}
+	for i := 0; i < 20; i++ {
+		postExecute(router, "steady-agent", map[string]interface{}{"input": "x"})
+	}
+
+	// Permanent faults are not retried, so every trigger fails one execution
+	failed := countFailed(t, executionService, "flaky-agent")
+	assert.InDelta(t, 0.3, float64(failed)/runs, 0.1, "%d of %d executions failed", failed, runs)
+	assert.Zero(t, countFailed(t, executionService, "steady-agent"))
+
+	faults := listFaults(t, router)
+	require.Len(t, faults, 1)
+	assert.EqualValues(t, runs, faults[0].Matched)
+	assert.EqualValues(t, failed, faults[0].Triggered)
+}
+
+func TestFaultInjectionTransientFailuresAreRetried(t *testing.T) {
+	router, executionService := newFaultRouter(t, validationAgent("retried-agent", ""))
+	addFault(t, router, map[string]interface{}{
+		"point": "pre_execution", "action": "fail", "every_nth": 2, "transient": true, "message": "temporarily overloaded",
+	})
+
+	// The second attempt fails and its retry, the third attempt, succeeds
+	for i := 0; i < 2; i++ {
+		recorder := postExecute(router, "retried-agent", map[string]interface{}{"input": "x"})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	executions, err := executionService.ListExecutions("retried-agent")
+	require.NoError(t, err)
+	retries := 0
+	for _, execution := range executions {
+		assert.EqualValues(t, models.CompletedState, execution.State)
+		retries += execution.RetryCount - 1
+	}
+	assert.Equal(t, 1, retries)
+}
+
+func TestFaultInjectionDelaysAndExpires(t *testing.T) {
+	router, _ := newFaultRouter(t, validationAgent("slow-agent", ""))
+	delay := addFault(t, router, map[string]interface{}{
+		"point": "post_execution", "action": "delay", "delay_ms": 300,
+	})
+	addFault(t, router, map[string]interface{}{
+		"point": "pre_execution", "action": "fail", "agent_id": "slow-agent", "ttl_seconds": 1,
+	})
+	require.Len(t, listFaults(t, router), 2)
+
+	recorder := postExecute(router, "slow-agent", map[string]interface{}{"input": "x"})
+	assert.NotEqual(t, http.StatusOK, recorder.Code, "the failing rule has not expired yet")
+
+	// Once the failing rule expired only the delay applies
+	time.Sleep(1100 * time.Millisecond)
+	faults := listFaults(t, router)
+	require.Len(t, faults, 1)
+	assert.Equal(t, delay.ID, faults[0].ID)
+	started := time.Now()
+	recorder = postExecute(router, "slow-agent", map[string]interface{}{"input": "x"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.GreaterOrEqual(t, time.Since(started), 300*time.Millisecond)
+
+	recorder = requestJSON(router, http.MethodDelete, "/api/v1/debug/faults/"+delay.ID, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, listFaults(t, router))
+	recorder = requestJSON(router, http.MethodDelete, "/api/v1/debug/faults/"+delay.ID, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "FAULT_RULE_NOT_FOUND", "delete deleted rule")
+}
+
+func TestFaultInjectionRejectsInvalidRules(t *testing.T) {
+	router, _ := newFaultRouter(t)
+
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/debug/faults", map[string]interface{}{
+		"point": "pre_execution", "action": "drop", "probability": 1.5, "every_nth": 2, "ttl_seconds": -1,
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{
+		"action":      models.ValidationInvalid,
+		"probability": models.ValidationOutOfRange,
+		"every_nth":   models.ValidationConflict,
+		"ttl_seconds": models.ValidationOutOfRange,
+	}, fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/debug/faults", map[string]interface{}{"point": "webhook_send", "action": "delay"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"delay_ms": models.ValidationOutOfRange}, fieldErrorsOf(t, recorder.Body.Bytes()))
+}
+
+func TestFaultInjectionDropsWebhookDeliveries(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	faultInjector := services.NewFaultInjector(zap.NewNop())
+	_, err := faultInjector.AddRule(models.FaultRule{Point: models.FaultPointWebhookSend, Action: models.FaultActionDrop, EveryNth: 5})
+	require.NoError(t, err)
+	notifier := services.NewProcessEventNotifier(server.URL, "", zap.NewNop())
+	notifier.SetRetryPolicy(1, 0)
+	notifier.SetFaultInjector(faultInjector)
+
+	for i := 0; i < 10; i++ {
+		notifier.Notify(models.ProcessStateEvent{Type: models.ProcessStateEventType, AgentID: "a", Status: models.ProcessStatus{State: models.ProcessFatal}})
+	}
+	assert.EqualValues(t, 8, received.Load(), "every 5th delivery is dropped")
+}
+
+func TestFaultInjectionDisabledByDefault(t *testing.T) {
+	router, _ := newExecuteRouter(t, validationAgent("plain-agent", ""))
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/debug/faults"},
+		{http.MethodPost, "/api/v1/debug/faults"},
+		{http.MethodDelete, "/api/v1/debug/faults/fault-1"},
+	} {
+		recorder := requestJSON(router, request.method, request.path, map[string]interface{}{"point": "pre_execution", "action": "fail"})
+		assert.Equal(t, http.StatusNotFound, recorder.Code, "%s %s", request.method, request.path)
+	}
+
+	load := func(yaml string) (*config.Config, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(yaml), 0600))
+		return config.LoadConfigFile(path)
+	}
+	cfg, err := load("port: 8080\n")
+	require.NoError(t, err)
+	assert.False(t, cfg.Debug.FaultInjection)
+
+	cfg, err = load("debug:\n  fault_injection: true\n")
+	require.NoError(t, err)
+	assert.True(t, cfg.Debug.FaultInjection)
+
+	_, err = load("environment: production\ndebug:\n  fault_injection: true\n")
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "production"))
+}
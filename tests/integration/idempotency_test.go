@@ -0,0 +1,203 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// countingAgent returns a slow agent that appends a line to a file each time its process runs
+func countingAgent(t *testing.T, id string, accessType types.AgentAccessType) (*models.AgentConfiguration, string) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	return scriptAgent(t, id, accessType, "echo run >> "+runs+"\nsleep 0.3\necho done\n"), runs
+}
+
+// processRuns returns how many times an agent from countingAgent ran
+func processRuns(t *testing.T, runs string) int {
+	data, err := os.ReadFile(runs)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return strings.Count(string(data), "run\n")
+}
+
+func postExecuteWithKey(router *gin.Engine, agentID, key string, body map[string]interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents/"+agentID+"/execute", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(handlers.IdempotencyKeyHeader, key)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// parallel runs request twice at the same time and returns both responses
+func parallel(request func() *httptest.ResponseRecorder) []*httptest.ResponseRecorder {
+	responses := make([]*httptest.ResponseRecorder, 2)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = request()
+		}(i)
+	}
+	wg.Wait()
+	return responses
+}
+
+func TestExecuteAgentIdempotencyKeyDeduplicatesConcurrentRequests(t *testing.T) {
+	agent, runs := countingAgent(t, "idempotent-agent", models.ReadOnlyAccessType)
+	router, _ := newExecuteRouter(t, agent)
+
+	responses := parallel(func() *httptest.ResponseRecorder {
+		return postExecuteWithKey(router, "idempotent-agent", "retry-1", map[string]interface{}{"input": "x"})
+	})
+
+	results := make([]models.ExecutionResult, len(responses))
+	replayed := 0
+	for i, recorder := range responses {
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &results[i]))
+		assert.Equal(t, "done\n", results[i].Output)
+		if recorder.Header().Get(handlers.IdempotentReplayedHeader) == "true" {
+			replayed++
+		}
+	}
+
+	assert.Equal(t, 1, processRuns(t, runs), "the agent process must run once")
+	assert.Equal(t, results[0].ID, results[1].ID)
+	assert.NotEqual(t, results[0].Deduplicated, results[1].Deduplicated, "exactly one response is deduplicated")
+	assert.Equal(t, 1, replayed)
+
+	// A later retry returns the finished execution at once
+	recorder := postExecuteWithKey(router, "idempotent-agent", "retry-1", map[string]interface{}{"input": "x"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var retried models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &retried))
+	assert.Equal(t, results[0].ID, retried.ID)
+	assert.True(t, retried.Deduplicated)
+	assert.Equal(t, 1, processRuns(t, runs))
+}
+
+func TestExecuteAgentIdempotencyKeyAsync(t *testing.T) {
+	agent, runs := countingAgent(t, "async-idempotent-agent", models.ReadWriteAccessType)
+	router, executionService := newExecuteRouter(t, agent)
+
+	responses := parallel(func() *httptest.ResponseRecorder {
+		return postExecuteWithKey(router, "async-idempotent-agent", "job-7", map[string]interface{}{"input": "x", "async": true})
+	})
+
+	accepted := make([]handlers.AgentExecuteAccepted, len(responses))
+	for i, recorder := range responses {
+		require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &accepted[i]))
+	}
+	assert.Equal(t, accepted[0].ExecutionID, accepted[1].ExecutionID)
+	assert.NotEqual(t, accepted[0].Deduplicated, accepted[1].Deduplicated)
+
+	require.Eventually(t, func() bool {
+		execution, err := executionService.GetExecution(accepted[0].ExecutionID)
+		return err == nil && execution.IsComplete()
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 1, processRuns(t, runs))
+}
+
+func TestExecuteAgentIdempotencyKeysAreScopedAndExpire(t *testing.T) {
+	first, firstRuns := countingAgent(t, "first-agent", models.ReadOnlyAccessType)
+	second, secondRuns := countingAgent(t, "second-agent", models.ReadOnlyAccessType)
+	router, executionService := newExecuteRouter(t, first, second)
+	executionService.SetIdempotencyStore(services.NewIdempotencyStore(time.Second, 0))
+
+	execute := func(agentID string) bool {
+		recorder := postExecuteWithKey(router, agentID, "shared-key", map[string]interface{}{"input": "x"})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var result models.ExecutionResult
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+		return result.Deduplicated
+	}
+
+	// The same key names different requests for different agents
+	assert.False(t, execute("first-agent"))
+	assert.False(t, execute("second-agent"))
+	assert.True(t, execute("first-agent"))
+	assert.Equal(t, 1, processRuns(t, firstRuns))
+	assert.Equal(t, 1, processRuns(t, secondRuns))
+
+	// Once the window has passed, the key starts a new execution
+	time.Sleep(1200 * time.Millisecond)
+	assert.False(t, execute("first-agent"))
+	assert.Equal(t, 2, processRuns(t, firstRuns))
+}
+
+func TestExecuteAgentIdempotencyKeyValidation(t *testing.T) {
+	agent, runs := countingAgent(t, "validated-agent", models.ReadOnlyAccessType)
+	router, _ := newExecuteRouter(t, agent)
+
+	recorder := postExecuteWithKey(router, "validated-agent", strings.Repeat("k", 256), map[string]interface{}{"input": "x"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "long idempotency key")
+	assert.Zero(t, processRuns(t, runs))
+}
+
+func TestJSONRPCExecuteAgentIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	agent, runs := countingAgent(t, "rpc-idempotent-agent", models.ReadOnlyAccessType)
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(agent))
+	executionService := services.NewExecutionService(agentService, logger)
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+
+	router := gin.New()
+	handlers.NewJSONRPCHandlers(agentService, services.NewExecutionCoordinator(agentService, executionService, logger), logger, a2aConfig).RegisterJSONRPCRoutes(router)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "execute-agent",
+		"id":      1,
+		"params": map[string]interface{}{
+			"agent_id":        "rpc-idempotent-agent",
+			"input":           "x",
+			"idempotency_key": "rpc-retry",
+		},
+	})
+	responses := parallel(func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+		return recorder
+	})
+
+	results := make([]map[string]interface{}, len(responses))
+	for i, recorder := range responses {
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.Nil(t, response["error"], recorder.Body.String())
+		results[i] = response["result"].(map[string]interface{})
+	}
+
+	assert.Equal(t, results[0]["execution_id"], results[1]["execution_id"])
+	assert.NotEqual(t, results[0]["deduplicated"] == true, results[1]["deduplicated"] == true)
+	assert.Equal(t, 1, processRuns(t, runs))
+}
@@ -0,0 +1,205 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// unreachableLeases fails every lease operation while down is set, as if the shared database were
+// unreachable from one instance
+type unreachableLeases struct {
+	models.LeaseStore
+	down atomic.Bool
+}
+
+func (u *unreachableLeases) AcquireLease(holder, address string, now time.Time, duration time.Duration) (*models.LeaderLease, error) {
+	if u.down.Load() {
+		return nil, errors.New("lease store unreachable")
+	}
+	return u.LeaseStore.AcquireLease(holder, address, now, duration)
+}
+
+// electedInstance is a supervisor instance taking part in leader election, served over HTTP
+type electedInstance struct {
+	identity  string
+	leases    *unreachableLeases
+	elector   *services.LeaderElector
+	scheduler *services.SchedulerService
+	server    *httptest.Server
+}
+
+// newElectedInstance wires an instance over the stores in options whose scheduler only fires while
+// it leads, with followers handing mutations to the leader as mode says
+func newElectedInstance(t *testing.T, identity string, options storage.StoreOptions, mode models.FollowerRequestMode) *electedInstance {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	stores, err := storage.NewStores(options)
+	require.NoError(t, err)
+	t.Cleanup(func() { stores.Close() })
+
+	agentService := services.NewAgentService(logger)
+	agentService.SetAgentStore(stores.Agents)
+	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetExecutionStore(stores.Executions)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	schedulerService.SetTaskStore(stores.Tasks)
+	schedulerService.SetStandby(true)
+	t.Cleanup(schedulerService.Stop)
+
+	instance := &electedInstance{identity: identity, leases: &unreachableLeases{LeaseStore: stores.Leases}, scheduler: schedulerService}
+	instance.server = httptest.NewServer(nil)
+	t.Cleanup(instance.server.Close)
+
+	instance.elector = services.NewLeaderElector(instance.leases, identity, instance.server.URL, logger)
+	instance.elector.SetLeaseTiming(300*time.Millisecond, 50*time.Millisecond)
+	instance.elector.AddLeadershipHook(func(leader bool) {
+		schedulerService.SetStandby(!leader)
+	})
+
+	monitor := services.NewServerMonitor(services.NewBuildInfo("1.2.3", "", ""), agentService, schedulerService, executionService, logger)
+	monitor.SetLeaderElector(instance.elector)
+
+	router := gin.New()
+	router.Use(middleware.NewLeaderRouting(instance.elector, mode, logger).Middleware())
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     schedulerService,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		ServerMonitor:        monitor,
+		Logger:               logger,
+	})
+	instance.server.Config.Handler = router
+	return instance
+}
+
+// leadershipOf fetches the leadership an instance reports in its server info
+func leadershipOf(t *testing.T, instance *electedInstance) models.LeadershipStatus {
+	response, err := http.Get(instance.server.URL + "/api/v1/server/info")
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	var info services.ServerInfo
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&info))
+	return info.Leadership
+}
+
+// startElection starts the electors of both instances and waits for one of them to lead
+func startElection(t *testing.T, first, second *electedInstance) (leader, follower *electedInstance) {
+	first.elector.Start(t.Context())
+	t.Cleanup(first.elector.Stop)
+	second.elector.Start(t.Context())
+	t.Cleanup(second.elector.Stop)
+
+	require.Eventually(t, func() bool {
+		return first.elector.IsLeader() || second.elector.IsLeader()
+	}, 5*time.Second, 10*time.Millisecond)
+	if first.elector.IsLeader() {
+		return first, second
+	}
+	return second, first
+}
+
+// leaderElectionStore returns storage options both instances share
+func leaderElectionStore(t *testing.T) storage.StoreOptions {
+	return storage.StoreOptions{Backend: storage.StoreBackendSQLite, Path: filepath.Join(t.TempDir(), "state.db")}
+}
+
+func TestLeaderElectionFailover(t *testing.T) {
+	options := leaderElectionStore(t)
+	leader, follower := startElection(t,
+		newElectedInstance(t, "instance-a", options, models.FollowerRequestRedirect),
+		newElectedInstance(t, "instance-b", options, models.FollowerRequestRedirect))
+
+	// Only the leader fires tasks; both report their role and the lease
+	assert.True(t, leader.scheduler.IsRunning())
+	assert.False(t, follower.scheduler.IsRunning())
+	status := leadershipOf(t, follower)
+	assert.Equal(t, models.LeaderRoleFollower, status.Role)
+	assert.Equal(t, leader.identity, status.Leader)
+	require.NotNil(t, status.LeaseExpiresAt)
+	assert.Equal(t, models.LeaderRoleLeader, leadershipOf(t, leader).Role)
+
+	// The leader loses the shared database; its lease expires and the follower takes over. At no
+	// point do both instances schedule tasks.
+	leader.leases.down.Store(true)
+	deadline := time.Now().Add(5 * time.Second)
+	for !follower.elector.IsLeader() && time.Now().Before(deadline) {
+		require.False(t, leader.scheduler.IsRunning() && follower.scheduler.IsRunning(), "both instances schedule tasks")
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.True(t, follower.elector.IsLeader())
+	assert.False(t, leader.elector.IsLeader())
+	assert.True(t, follower.scheduler.IsRunning())
+	assert.False(t, leader.scheduler.IsRunning())
+
+	// Back in touch, the former leader stays a follower
+	leader.leases.down.Store(false)
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, leader.elector.IsLeader())
+	assert.Equal(t, follower.identity, leadershipOf(t, leader).Leader)
+}
+
+func TestLeaderElectionStepDown(t *testing.T) {
+	options := leaderElectionStore(t)
+	leader, follower := startElection(t,
+		newElectedInstance(t, "instance-a", options, models.FollowerRequestRedirect),
+		newElectedInstance(t, "instance-b", options, models.FollowerRequestRedirect))
+
+	// A stopping leader releases its lease, so the follower takes over before it would expire
+	leader.elector.Stop()
+	assert.False(t, leader.scheduler.IsRunning())
+	require.Eventually(t, follower.elector.IsLeader, 250*time.Millisecond, 5*time.Millisecond)
+	assert.True(t, follower.scheduler.IsRunning())
+}
+
+func TestLeaderElectionFollowerRequests(t *testing.T) {
+	options := leaderElectionStore(t)
+	leader, follower := startElection(t,
+		newElectedInstance(t, "instance-a", options, models.FollowerRequestProxy),
+		newElectedInstance(t, "instance-b", options, models.FollowerRequestProxy))
+
+	// Proxied: the follower relays the leader's answer to the mutation
+	response, err := http.Post(follower.server.URL+"/api/v1/agents/missing/execute", "application/json", strings.NewReader(`{"input":"hi"}`))
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	assert.Equal(t, leader.identity, response.Header.Get(middleware.LeaderHeader))
+
+	// Reads are served by the follower itself
+	response, err = http.Get(follower.server.URL + "/api/v1/agents")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, response.Header.Get(middleware.LeaderHeader))
+
+	// Redirected: the follower points the client at the request's URL on the leader
+	redirecting := newElectedInstance(t, "instance-c", options, models.FollowerRequestRedirect)
+	redirecting.elector.Campaign()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err = client.Post(redirecting.server.URL+"/api/v1/tasks/nightly/pause?dry_run=true", "application/json", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, response.StatusCode)
+	assert.Equal(t, leader.server.URL+"/api/v1/tasks/nightly/pause?dry_run=true", response.Header.Get("Location"))
+}
@@ -0,0 +1,208 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// hookedPersistentAgent registers a persistent agent that appends "started" to a marker file when
+// it starts and "signal" when it is sent the stop signal; it returns the marker file
+func hookedPersistentAgent(t *testing.T, id string) (*models.AgentConfiguration, string) {
+	markers := filepath.Join(t.TempDir(), "markers")
+	config := scriptAgent(t, id, types.ReadOnlyAccessType,
+		"echo started >> '"+markers+"'\ntrap \"echo signal >> '"+markers+"'; exit 0\" TERM\nwhile true; do sleep 0.1; done\n")
+	config.Mode = models.PersistentMode
+	config.InputPattern = models.JsonRpcPattern
+	config.OutputPattern = models.JsonRpcPatternOut
+	config.StartSecs = 1
+	t.Cleanup(func() { agents.StopPersistentProcess(id) })
+	return config, markers
+}
+
+// markerHook is a command hook appending its marker, the hook it runs as and the agent's PID to
+// the marker file, then exiting with exitCode
+func markerHook(markers, marker string, exitCode int) *models.LifecycleHook {
+	script := "echo " + marker + " $SUPERVISOR_HOOK $SUPERVISOR_AGENT_PID >> '" + markers + "'; exit " + strconv.Itoa(exitCode)
+	return &models.LifecycleHook{Command: []string{"/bin/sh", "-c", script}, TimeoutSeconds: 5}
+}
+
+// readMarkers returns the lines of the marker file
+func readMarkers(markers string) []string {
+	data, _ := os.ReadFile(markers)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// startHooked starts a persistent agent through the API, waits for it to write its started marker
+// and returns its process ID
+func startHooked(t *testing.T, router *gin.Engine, agentID, markers string) int {
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/agents/"+agentID+"/start", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var status models.ProcessStatus
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	require.NotZero(t, status.PID)
+	require.Eventually(t, func() bool {
+		return slices.Contains(readMarkers(markers), "started")
+	}, 5*time.Second, 10*time.Millisecond)
+	return status.PID
+}
+
+// processHook returns the latest result of an agent's hook of kind, false when it has not run
+func processHook(agentID string, kind models.HookKind) (models.HookResult, bool) {
+	status, _ := agents.PersistentProcessStatus(agentID)
+	for _, hook := range status.Hooks {
+		if hook.Hook == kind {
+			return hook, true
+		}
+	}
+	return models.HookResult{}, false
+}
+
+func TestLifecycleHooksRunAroundStartAndStop(t *testing.T) {
+	config, markers := hookedPersistentAgent(t, "hooked-agent")
+	config.PostStartHook = markerHook(markers, "post-start", 0)
+	config.PreStopHook = markerHook(markers, "pre-stop", 0)
+	router, _ := newExecuteRouter(t, config)
+
+	auditLog, err := services.NewAuditLog(filepath.Join(t.TempDir(), "audit.log"), 0, 0, zap.NewNop())
+	require.NoError(t, err)
+	defer auditLog.Close()
+	agents.AddLifecycleHookObserver(func(result models.HookResult) {
+		if result.AgentID == "hooked-agent" {
+			auditLog.RecordHook(result)
+		}
+	})
+
+	pid := startHooked(t, router, "hooked-agent", markers)
+	pidText := strconv.Itoa(pid)
+
+	// The post-start hook runs once the process reached the running state
+	require.Eventually(t, func() bool {
+		_, ran := processHook("hooked-agent", models.HookPostStart)
+		return ran
+	}, 10*time.Second, 20*time.Millisecond)
+	postStart, _ := processHook("hooked-agent", models.HookPostStart)
+	assert.True(t, postStart.Success)
+	assert.Equal(t, pid, postStart.PID)
+	assert.Equal(t, models.HookPolicyDegrade, postStart.Policy)
+	status, _ := agents.PersistentProcessStatus("hooked-agent")
+	assert.Equal(t, models.ProcessRunning, status.State)
+	assert.Equal(t, []string{"started", "post-start post_start " + pidText}, readMarkers(markers))
+
+	// Restarting runs the pre-stop hook before the stop signal and reports it
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/agents/hooked-agent/restart", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var restarted services.AgentToggleResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &restarted))
+	require.Len(t, restarted.Hooks, 1)
+	assert.Equal(t, models.HookPreStop, restarted.Hooks[0].Hook)
+	assert.True(t, restarted.Hooks[0].Success)
+	assert.Equal(t, []string{"started", "post-start post_start " + pidText, "pre-stop pre_stop " + pidText, "signal"}, readMarkers(markers))
+
+	// Both runs are audited as the supervisor's own actions
+	page, err := auditLog.Query(services.AuditFilter{Action: "agents.hooks"})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, "agents.hooks.post_start", page.Entries[0].Action)
+	assert.Equal(t, "agents.hooks.pre_stop", page.Entries[1].Action)
+	for _, entry := range page.Entries {
+		assert.Equal(t, "supervisor", entry.Actor)
+		assert.Equal(t, "hooked-agent", entry.Target)
+		assert.Equal(t, models.AuditOutcomeSuccess, entry.Outcome)
+	}
+}
+
+func TestPostStartHookFailurePolicies(t *testing.T) {
+	degraded, degradedMarkers := hookedPersistentAgent(t, "hook-degrades")
+	degraded.PostStartHook = markerHook(degradedMarkers, "post-start", 3)
+	failing, failingMarkers := hookedPersistentAgent(t, "hook-fails")
+	failing.PostStartHook = markerHook(failingMarkers, "post-start", 3)
+	failing.PostStartHook.OnFailure = models.HookPolicyFail
+	failing.StartRetries = 2
+	router, _ := newExecuteRouter(t, degraded, failing)
+
+	// Under the degrade policy the process keeps running in the degraded state
+	pid := startHooked(t, router, "hook-degrades", degradedMarkers)
+	require.Eventually(t, func() bool {
+		status, _ := agents.PersistentProcessStatus("hook-degrades")
+		return status.State == models.ProcessDegraded
+	}, 10*time.Second, 20*time.Millisecond)
+	status, _ := agents.PersistentProcessStatus("hook-degrades")
+	assert.Equal(t, pid, status.PID)
+	assert.Contains(t, status.LastError, "post-start hook")
+	require.Len(t, status.Hooks, 1)
+	assert.False(t, status.Hooks[0].Success)
+	assert.Equal(t, 3, status.Hooks[0].ExitCode)
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/agents/hook-degrades/status", nil)
+	assert.Contains(t, recorder.Body.String(), `"health":"degraded"`)
+	assert.Equal(t, []string{"started", "post-start post_start " + strconv.Itoa(pid)}, readMarkers(degradedMarkers))
+
+	// Under the fail policy every start fails, until the start retries run out
+	startHooked(t, router, "hook-fails", failingMarkers)
+	require.Eventually(t, func() bool {
+		status, _ := agents.PersistentProcessStatus("hook-fails")
+		return status.State == models.ProcessFatal
+	}, 15*time.Second, 20*time.Millisecond)
+	status, _ = agents.PersistentProcessStatus("hook-fails")
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+	assert.Equal(t, 1, status.Restarts)
+	assert.Contains(t, status.LastError, "post-start hook")
+	// The second process is signalled after the fatal state is entered
+	require.Eventually(t, func() bool { return len(readMarkers(failingMarkers)) == 6 }, 5*time.Second, 20*time.Millisecond)
+	lines := readMarkers(failingMarkers)
+	for i := 0; i < 6; i += 3 {
+		assert.Equal(t, "started", lines[i])
+		assert.True(t, strings.HasPrefix(lines[i+1], "post-start post_start "), lines[i+1])
+		assert.Equal(t, "signal", lines[i+2])
+	}
+}
+
+func TestPreStopHookFailurePolicies(t *testing.T) {
+	aborting, abortingMarkers := hookedPersistentAgent(t, "hook-aborts")
+	aborting.PreStopHook = markerHook(abortingMarkers, "pre-stop", 1)
+	aborting.PreStopHook.OnFailure = models.HookPolicyAbort
+	proceeding, proceedingMarkers := hookedPersistentAgent(t, "hook-proceeds")
+	proceeding.PreStopHook = markerHook(proceedingMarkers, "pre-stop", 1)
+	router, _ := newExecuteRouter(t, aborting, proceeding)
+
+	// Under the abort policy the restart fails and leaves the process and the agent untouched
+	pid := startHooked(t, router, "hook-aborts", abortingMarkers)
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/agents/hook-aborts/restart", nil)
+	require.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+	var apiErr api.ErrorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &apiErr))
+	assert.Equal(t, api.CodeHookFailed, apiErr.Code)
+	status, ok := agents.PersistentProcessStatus("hook-aborts")
+	require.True(t, ok)
+	assert.Equal(t, pid, status.PID)
+	assert.Equal(t, []string{"started", "pre-stop pre_stop " + strconv.Itoa(pid)}, readMarkers(abortingMarkers))
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents/hook-aborts", nil)
+	assert.Contains(t, recorder.Body.String(), `"enabled":true`)
+
+	// Under the proceed policy the process is stopped anyway, the failure being reported
+	pid = startHooked(t, router, "hook-proceeds", proceedingMarkers)
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/hook-proceeds/restart", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var restarted services.AgentToggleResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &restarted))
+	require.Len(t, restarted.Hooks, 1)
+	assert.False(t, restarted.Hooks[0].Success)
+	assert.Equal(t, models.HookPolicyProceed, restarted.Hooks[0].Policy)
+	assert.Equal(t, []string{"started", "pre-stop pre_stop " + strconv.Itoa(pid), "signal"}, readMarkers(proceedingMarkers))
+}
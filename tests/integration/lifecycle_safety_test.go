@@ -0,0 +1,154 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newSafetyFixture serves five agents, protecting ledger and confirming operations on more than two
+func newSafetyFixture(t *testing.T) (*groupFixture, *supervisorctl.Client) {
+	f := newGroupFixture(t, "ledger", "notifier", "payments-api", "payments-web", "payments-worker")
+	guard := services.NewOperationGuard(zap.NewNop())
+	require.NoError(t, guard.SetSafety(models.LifecycleSafety{
+		ProtectedAgents:    []string{"ledger"},
+		ConfirmAboveAgents: 2,
+		ConfirmationTTL:    time.Minute,
+	}))
+	f.coordinator.SetOperationGuard(guard)
+
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	return f, supervisorctl.NewClient(server.URL)
+}
+
+// assertEnabled checks whether each agent is enabled
+func (f *groupFixture) assertEnabled(t *testing.T, enabled map[string]bool) {
+	for agentID, want := range enabled {
+		agent, err := f.agentService.GetAgent(agentID)
+		require.NoError(t, err)
+		assert.Equal(t, want, agent.Enabled, agentID)
+	}
+}
+
+func TestLifecycleSafetySmallOperationsUnaffected(t *testing.T) {
+	f, client := newSafetyFixture(t)
+	ctx := context.Background()
+
+	result, err := client.BatchOperation(ctx, "payments-w*", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "payments-w*", result.Pattern)
+	require.Len(t, result.Steps, 2)
+	assert.Empty(t, result.Protected)
+	f.assertEnabled(t, map[string]bool{"payments-web": false, "payments-worker": false, "payments-api": true})
+
+	// Single agents are never confirmed nor protected
+	recorder := requestJSON(f.router, http.MethodPost, "/api/v1/agents/ledger/disable", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	f.assertEnabled(t, map[string]bool{"ledger": false})
+
+	_, err = client.BatchOperation(ctx, "nothing-*", supervisorctl.GroupActionEnable, supervisorctl.BatchOptions{})
+	var apiErr *supervisorctl.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestLifecycleSafetyExcludesProtectedAgents(t *testing.T) {
+	f, client := newSafetyFixture(t)
+	ctx := context.Background()
+	require.NoError(t, client.CreateGroup(ctx, supervisorctl.AgentGroup{Name: "core", Members: []string{"ledger", "notifier"}}))
+
+	result, err := client.GroupOperation(ctx, "core", supervisorctl.GroupActionDisable)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ledger"}, result.Protected)
+	require.Len(t, result.Steps, 1)
+	assert.Equal(t, "notifier", result.Steps[0].AgentID)
+	f.assertEnabled(t, map[string]bool{"ledger": true, "notifier": false})
+
+	// Forcing includes them
+	result, err = client.BatchOperation(ctx, "group:core", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{Force: true})
+	require.NoError(t, err)
+	assert.Empty(t, result.Protected)
+	require.Len(t, result.Steps, 2)
+	f.assertEnabled(t, map[string]bool{"ledger": false, "notifier": false})
+}
+
+func TestLifecycleSafetyConfirmsLargeOperations(t *testing.T) {
+	f, client := newSafetyFixture(t)
+	ctx := context.Background()
+
+	// Three agents are over the threshold: nothing is touched until the token is resent
+	_, err := client.BatchOperation(ctx, "prefix:payments-", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{})
+	var apiErr *supervisorctl.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusPreconditionRequired, apiErr.StatusCode)
+	assert.Equal(t, "CONFIRMATION_REQUIRED", apiErr.Code)
+	assert.Equal(t, []string{"payments-api", "payments-web", "payments-worker"}, apiErr.Agents)
+	require.NotEmpty(t, apiErr.ConfirmationToken)
+	assert.True(t, apiErr.ExpiresAt.After(time.Now()))
+	f.assertEnabled(t, map[string]bool{"payments-api": true, "payments-web": true, "payments-worker": true})
+	token := apiErr.ConfirmationToken
+
+	// A token only confirms the operation it was issued for
+	_, err = client.BatchOperation(ctx, "prefix:payments-", supervisorctl.GroupActionRestart, supervisorctl.BatchOptions{Confirmation: token})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusPreconditionRequired, apiErr.StatusCode)
+
+	result, err := client.BatchOperation(ctx, "prefix:payments-", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{Confirmation: token})
+	require.NoError(t, err)
+	require.Len(t, result.Steps, 3)
+	f.assertEnabled(t, map[string]bool{"payments-api": false, "payments-web": false, "payments-worker": false, "notifier": true})
+
+	// Tokens are used up
+	_, err = client.BatchOperation(ctx, "prefix:payments-", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{Confirmation: token})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusPreconditionRequired, apiErr.StatusCode)
+	assert.NotEqual(t, token, apiErr.ConfirmationToken)
+
+	// The protected agent is left out of the agents confirmed
+	_, err = client.BatchOperation(ctx, "*", supervisorctl.GroupActionEnable, supervisorctl.BatchOptions{})
+	require.ErrorAs(t, err, &apiErr)
+	assert.NotContains(t, apiErr.Agents, "ledger")
+	assert.Len(t, apiErr.Agents, 4)
+}
+
+func TestLifecycleSafetyPromptConfirm(t *testing.T) {
+	f, client := newSafetyFixture(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	_, err := client.ConfirmedBatchOperation(ctx, "*", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{},
+		supervisorctl.PromptConfirm(strings.NewReader("n\n"), &out, false))
+	assert.True(t, errors.Is(err, supervisorctl.ErrNotConfirmed))
+	assert.Contains(t, out.String(), "applies to 4 agents")
+	assert.Contains(t, out.String(), "  payments-worker\n")
+	f.assertEnabled(t, map[string]bool{"notifier": true})
+
+	out.Reset()
+	result, err := client.ConfirmedBatchOperation(ctx, "*", supervisorctl.GroupActionDisable, supervisorctl.BatchOptions{},
+		supervisorctl.PromptConfirm(strings.NewReader("yes\n"), &out, false))
+	require.NoError(t, err)
+	assert.Len(t, result.Steps, 4)
+	assert.Equal(t, []string{"ledger"}, result.Protected)
+	f.assertEnabled(t, map[string]bool{"notifier": false, "ledger": true})
+
+	// Scripts go ahead without a prompt
+	out.Reset()
+	result, err = client.ConfirmedBatchOperation(ctx, "*", supervisorctl.GroupActionEnable, supervisorctl.BatchOptions{},
+		supervisorctl.PromptConfirm(strings.NewReader(""), &out, true))
+	require.NoError(t, err)
+	assert.Len(t, result.Steps, 4)
+	assert.Empty(t, out.String())
+}
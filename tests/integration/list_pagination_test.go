@@ -0,0 +1,190 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// listedAgents are registered in this shuffled order; their names sort in the reverse of their IDs
+var listedAgents = []struct {
+	id, name   string
+	accessType types.AgentAccessType
+	enabled    bool
+}{
+	{"delta", "whiskey", models.ReadOnlyAccessType, true},
+	{"alpha", "zulu", models.ReadWriteAccessType, true},
+	{"echo", "victor", models.ReadWriteAccessType, true},
+	{"charlie", "xray", models.ReadWriteAccessType, true},
+	{"foxtrot", "uniform", models.ReadOnlyAccessType, false},
+	{"bravo", "yankee", models.ReadOnlyAccessType, true},
+}
+
+// newListRouter serves the agent routes over listedAgents, registered a millisecond apart
+func newListRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, listed := range listedAgents {
+		agent := validationAgent(listed.id, "")
+		agent.Name = listed.name
+		agent.AccessType = listed.accessType
+		agent.Enabled = listed.enabled
+		require.NoError(t, agentService.RegisterAgent(agent))
+		time.Sleep(time.Millisecond)
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:           router,
+		ExecutionService: executionService,
+		AgentService:     agentService,
+		SchedulerService: services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector: services.NewMetricsCollector(logger),
+		Logger:           logger,
+	})
+	return router
+}
+
+// listAgentIDs lists the agents with the query and returns their IDs and the total
+func listAgentIDs(t *testing.T, router *gin.Engine, query string) ([]string, int) {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/agents"+query, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var page supervisorctl.AgentPage
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+
+	ids := []string{}
+	for _, agent := range page.Agents {
+		ids = append(ids, agent.ID)
+	}
+	return ids, page.Total
+}
+
+func TestListAgentsSortedAndPaged(t *testing.T) {
+	router := newListRouter(t)
+	byID := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}
+
+	// Every call returns the same order, sorted by ID
+	for i := 0; i < 3; i++ {
+		ids, total := listAgentIDs(t, router, "")
+		assert.Equal(t, byID, ids)
+		assert.Equal(t, 6, total)
+	}
+
+	// Pages follow each other without gaps or repeats
+	var paged []string
+	for offset := 0; offset < 6; offset += 4 {
+		ids, total := listAgentIDs(t, router, "?limit=4&offset="+strconv.Itoa(offset))
+		assert.Equal(t, 6, total)
+		paged = append(paged, ids...)
+	}
+	assert.Equal(t, byID, paged)
+	ids, total := listAgentIDs(t, router, "?limit=2&offset=2")
+	assert.Equal(t, []string{"charlie", "delta"}, ids)
+	assert.Equal(t, 6, total)
+	ids, _ = listAgentIDs(t, router, "?limit=2&offset=6")
+	assert.Empty(t, ids)
+
+	ids, _ = listAgentIDs(t, router, "?sort=name")
+	assert.Equal(t, []string{"foxtrot", "echo", "delta", "charlie", "bravo", "alpha"}, ids)
+	ids, _ = listAgentIDs(t, router, "?sort=id&order=desc")
+	assert.Equal(t, []string{"foxtrot", "echo", "delta", "charlie", "bravo", "alpha"}, ids)
+	ids, _ = listAgentIDs(t, router, "?sort=created_at")
+	assert.Equal(t, []string{"delta", "alpha", "echo", "charlie", "foxtrot", "bravo"}, ids)
+	ids, _ = listAgentIDs(t, router, "?sort=created_at&order=desc&limit=2")
+	assert.Equal(t, []string{"bravo", "foxtrot"}, ids)
+}
+
+func TestListAgentsFiltered(t *testing.T) {
+	router := newListRouter(t)
+
+	ids, total := listAgentIDs(t, router, "?access_type=read_only")
+	assert.Equal(t, []string{"bravo", "delta", "foxtrot"}, ids)
+	assert.Equal(t, 3, total)
+	ids, total = listAgentIDs(t, router, "?access_type=read-write&limit=1&offset=1")
+	assert.Equal(t, []string{"charlie"}, ids)
+	assert.Equal(t, 3, total)
+	ids, _ = listAgentIDs(t, router, "?enabled=false")
+	assert.Equal(t, []string{"foxtrot"}, ids)
+
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/agents?sort=size&order=up&limit=-1&access_type=admin", nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{
+		"sort":        models.ValidationInvalid,
+		"order":       models.ValidationInvalid,
+		"limit":       models.ValidationOutOfRange,
+		"access_type": models.ValidationInvalid,
+	}, fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents?offset=ten", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// The client's list options carry the --sort and --filter flags
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+	filters, err := supervisorctl.ParseFilters([]string{"enabled=true", "access_type=read_only"})
+	require.NoError(t, err)
+	page, err := client.ListAgents(context.Background(), supervisorctl.ListOptions{Sort: "name", Filters: filters})
+	require.NoError(t, err)
+	require.Len(t, page.Agents, 2)
+	assert.Equal(t, "delta", page.Agents[0].ID)
+	assert.Equal(t, "bravo", page.Agents[1].ID)
+	assert.Equal(t, 2, page.Total)
+
+	_, err = supervisorctl.ParseFilters([]string{"enabled"})
+	assert.Error(t, err)
+}
+
+func TestListTasksSortedAndPaged(t *testing.T) {
+	router, _ := newBulkTaskRouter(t)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	tasks, err := client.ListTasks(ctx)
+	require.NoError(t, err)
+	var ids []string
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	assert.Equal(t, []string{"hourly-a3", "hourly-b2", "nightly-a1", "nightly-a2", "nightly-b1"}, ids)
+
+	page, err := client.QueryTasks(ctx, supervisorctl.ListOptions{Limit: 2, Offset: 4})
+	require.NoError(t, err)
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, "nightly-b1", page.Tasks[0].ID)
+	assert.Equal(t, 5, page.Total)
+
+	page, err = client.QueryTasks(ctx, supervisorctl.ListOptions{Order: "desc", Filters: map[string]string{"agent_id": "agent-b"}})
+	require.NoError(t, err)
+	require.Len(t, page.Tasks, 2)
+	assert.Equal(t, "nightly-b1", page.Tasks[0].ID)
+	assert.Equal(t, "hourly-b2", page.Tasks[1].ID)
+	assert.Equal(t, 2, page.Total)
+
+	page, err = client.QueryTasks(ctx, supervisorctl.ListOptions{Filters: map[string]string{"enabled": "false"}})
+	require.NoError(t, err)
+	assert.Empty(t, page.Tasks)
+	assert.Equal(t, 0, page.Total)
+
+	_, err = client.QueryTasks(ctx, supervisorctl.ListOptions{Sort: "agent"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newMaintenanceRouter serves the REST routes with maintenance windows over the given agents and
+// returns the scheduler running their tasks
+func newMaintenanceRouter(t *testing.T, agents ...*models.AgentConfiguration) (*gin.Engine, *services.SchedulerService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	t.Cleanup(scheduler.Stop)
+
+	maintenance := services.NewMaintenanceService(agentService, logger)
+	scheduler.SetMaintenanceService(maintenance)
+	agentService.SetMaintenanceService(maintenance)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     scheduler,
+		MaintenanceService:   maintenance,
+		Logger:               logger,
+	})
+	return router, scheduler
+}
+
+// postMaintenance starts an ad-hoc maintenance window of an agent
+func postMaintenance(router *gin.Engine, agentID string, body map[string]string) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents/"+agentID+"/maintenance", bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestMaintenanceSkipsScheduledRuns(t *testing.T) {
+	router, scheduler := newMaintenanceRouter(t, scriptAgent(t, "deploy-agent", models.ReadOnlyAccessType, "echo ok\n"))
+
+	recorder := postMaintenance(router, "deploy-agent", map[string]string{"duration": "2s", "reason": "deploy"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var status models.MaintenanceStatus
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	require.True(t, status.Active)
+	require.NotNil(t, status.Current)
+	assert.Equal(t, models.MaintenanceSourceAdHoc, status.Current.Source)
+	assert.Equal(t, "deploy", status.Current.Reason)
+	windowEnd := status.Current.End
+
+	// The agent status reports the window
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/agents/deploy-agent/status", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var agentStatus services.AgentStatus
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &agentStatus))
+	require.NotNil(t, agentStatus.Maintenance)
+	assert.True(t, agentStatus.Maintenance.Active)
+
+	// Manual executions still run, with a warning
+	recorder = postExecute(router, "deploy-agent", map[string]interface{}{"input": "go"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Header().Get("Warning"), "deploy-agent is in maintenance until")
+
+	// Scheduled runs during the window are skipped, and run normally once it ended
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "deploy-task", Name: "deploy-task", AgentID: "deploy-agent", CronExpression: "* * * * * *", Enabled: true,
+	}))
+	var skipped, succeeded *models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ := scheduler.GetTaskHistory("deploy-task", 20)
+		for _, run := range history {
+			switch {
+			case run.Status == types.SkippedStatus && skipped == nil:
+				skipped = run
+			case run.Status == types.SuccessStatus && succeeded == nil:
+				succeeded = run
+			}
+		}
+		return skipped != nil && succeeded != nil
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NoError(t, scheduler.PauseTask("deploy-task"))
+
+	assert.Equal(t, models.SkipReasonMaintenance, skipped.SkipReason)
+	assert.Contains(t, skipped.Error, "is in maintenance until")
+	assert.True(t, skipped.StartTime.Before(windowEnd))
+	assert.False(t, succeeded.StartTime.Before(windowEnd))
+	assert.Empty(t, succeeded.SkipReason)
+
+	// Once the window ended, manual executions no longer warn
+	recorder = postExecute(router, "deploy-agent", map[string]interface{}{"input": "go"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, recorder.Header().Get("Warning"))
+}
+
+func TestMaintenanceRequests(t *testing.T) {
+	router, _ := newMaintenanceRouter(t, scriptAgent(t, "deploy-agent", models.ReadOnlyAccessType, "echo ok\n"))
+
+	recorder := postMaintenance(router, "deploy-agent", map[string]string{"duration": "soon"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	recorder = postMaintenance(router, "missing-agent", map[string]string{"duration": "1h"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code, recorder.Body.String())
+
+	recorder = postMaintenance(router, "deploy-agent", map[string]string{"duration": "1h"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	// Ending the window early takes the agent out of maintenance
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/v1/agents/deploy-agent/maintenance", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var status models.MaintenanceStatus
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.False(t, status.Active)
+	assert.Nil(t, status.Current)
+}
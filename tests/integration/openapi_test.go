@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newFullRouter wires every route the supervisor registers in main
+func newFullRouter(t *testing.T, swaggerUI bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger, _ := zap.NewDevelopment()
+
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	a2aConfig := a2a.DefaultA2AConfig()
+	auditLog, err := services.NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0, logger)
+	require.NoError(t, err)
+
+	router := gin.New()
+	routes.SetupA2ARoutes(&routes.A2ARouteConfig{
+		Router:               router,
+		A2AService:           services.NewA2AService(agentService, executionService, logger),
+		AgentService:         agentService,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		A2AConfig:            a2aConfig,
+	})
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		AgentDefaultsService: agentService,
+		AgentGroupService:    agentService,
+		SchedulerService:     schedulerService,
+		PipelineService:      services.NewPipelineService(agentService, coordinator, logger),
+		ConfigValidator:      services.NewConfigValidator(nil, a2aConfig, agentService, schedulerService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		AuditLog:             auditLog,
+		ServerMonitor:        services.NewServerMonitor(services.NewBuildInfo("", "", ""), agentService, schedulerService, executionService, logger),
+		StateService:         services.NewStateService(agentService, agentService, schedulerService, logger),
+		ArtifactStore:        services.NewArtifactStore(t.TempDir(), 0, 0, logger),
+		OrphanService:        services.NewOrphanService(agents.NewProcessRegistry(t.TempDir(), logger), agentService, models.OrphanPolicyAuto, logger),
+		FaultInjector:        services.NewFaultInjector(logger),
+		EventBus:             services.NewEventBus(logger),
+		MaintenanceService:   services.NewMaintenanceService(agentService, logger),
+		CalendarService:      services.NewCalendarService(logger),
+		ConversationStore:    services.NewConversationStore(0),
+		Logger:               logger,
+		SwaggerUI:            swaggerUI,
+	})
+
+	return router
+}
+
+func TestOpenAPISpecIsValid(t *testing.T) {
+	router := newFullRouter(t, false)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	doc, err := openapi3.NewLoader().LoadFromData(recorder.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+	assert.NotNil(t, doc.Components.Schemas["ScheduledTask"])
+	assert.NotNil(t, doc.Paths.Find("/tasks/{taskId}"))
+}
+
+func TestOpenAPISpecCoversAllRoutes(t *testing.T) {
+	router := newFullRouter(t, true)
+	document := handlers.OpenAPIDocument()
+
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+		assert.True(t, document.HasOperation(route.Method, route.Path),
+			"route %s %s is registered but missing from the OpenAPI document", route.Method, route.Path)
+	}
+
+	// Every documented route must also be served
+	for _, route := range handlers.APIRoutes() {
+		assert.True(t, registered[route.Method+" "+route.Path],
+			"route %s %s is documented but not registered", route.Method, route.Path)
+	}
+}
+
+func TestSwaggerUIBehindFlag(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newFullRouter(t, false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	newFullRouter(t, true).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), "openapi.json"))
+}
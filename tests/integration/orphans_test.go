@@ -0,0 +1,279 @@
+//go:build !windows
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// startOrphan starts a long-running child in its own process group, as agents are started, and
+// returns it with a channel closed once it has exited
+func startOrphan(t *testing.T) (*exec.Cmd, <-chan struct{}) {
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(t, cmd.Start())
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-exited
+	})
+	return cmd, exited
+}
+
+// orphanFixture is a supervisor restarted over the state files a previous one left behind
+type orphanFixture struct {
+	dir          string
+	agentService *services.AgentService
+	service      *services.OrphanService
+	router       *gin.Engine
+	mutex        sync.Mutex
+	events       []models.OrphanProcess
+}
+
+// newOrphanFixture records cmd as a running execution of agent in a first supervisor's registry,
+// then starts a second supervisor applying policy over the same directory
+func newOrphanFixture(t *testing.T, agent *models.AgentConfiguration, cmd *exec.Cmd, policy models.OrphanPolicy) *orphanFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	f := &orphanFixture{dir: t.TempDir()}
+
+	previous := agents.NewProcessRegistry(f.dir, logger)
+	require.NoError(t, previous.Track(models.ProcessRecord{
+		PID:         cmd.Process.Pid,
+		AgentID:     agent.ID,
+		ExecutionID: "exec-before-crash",
+		StartedAt:   time.Now(),
+	}))
+
+	f.agentService = services.NewAgentService(logger)
+	require.NoError(t, f.agentService.RegisterAgent(agent))
+	f.service = services.NewOrphanService(agents.NewProcessRegistry(f.dir, logger), f.agentService, policy, logger)
+	f.service.SetWatchInterval(20 * time.Millisecond)
+	f.service.AddOrphanHook(func(orphan models.OrphanProcess) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.events = append(f.events, orphan)
+	})
+
+	f.router = gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:           f.router,
+		ExecutionService: services.NewExecutionService(f.agentService, logger),
+		MetricsCollector: services.NewMetricsCollector(logger),
+		OrphanService:    f.service,
+		Logger:           logger,
+	})
+	return f
+}
+
+// statusEvents returns the statuses passed to the orphan hook so far
+func (f *orphanFixture) statusEvents() []models.OrphanStatus {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var statuses []models.OrphanStatus
+	for _, event := range f.events {
+		statuses = append(statuses, event.Status)
+	}
+	return statuses
+}
+
+// listOrphans fetches GET /api/v1/orphans with the given query
+func (f *orphanFixture) listOrphans(t *testing.T, query string) []models.OrphanProcess {
+	recorder := requestJSON(f.router, http.MethodGet, "/api/v1/orphans"+query, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Orphans []models.OrphanProcess `json:"orphans"`
+		Total   int                    `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Len(t, response.Orphans, response.Total)
+	return response.Orphans
+}
+
+// stateFiles returns the names of the state files left in the registry directory
+func (f *orphanFixture) stateFiles(t *testing.T) []string {
+	entries, err := os.ReadDir(f.dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestOrphanTaskExecutionIsTerminated(t *testing.T) {
+	cmd, exited := startOrphan(t)
+	agent := validationAgent("task-agent", "")
+	agent.StopWaitSeconds = 1
+	f := newOrphanFixture(t, agent, cmd, models.OrphanPolicyAuto)
+
+	found, err := f.service.Recover(context.Background())
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, cmd.Process.Pid, found[0].PID)
+	assert.Equal(t, "task-agent", found[0].AgentID)
+	assert.Equal(t, "exec-before-crash", found[0].ExecutionID)
+	assert.Equal(t, string(models.TaskMode), found[0].AgentMode)
+	assert.Equal(t, models.OrphanTerminated, found[0].Status)
+	assert.NotNil(t, found[0].HandledAt)
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphaned process was not terminated")
+	}
+	assert.Empty(t, f.stateFiles(t))
+	assert.Equal(t, []models.OrphanStatus{models.OrphanTerminated}, f.statusEvents())
+
+	// Handled orphans are only listed on request
+	assert.Empty(t, f.listOrphans(t, ""))
+	all := f.listOrphans(t, "?all=true")
+	require.Len(t, all, 1)
+	assert.Equal(t, models.OrphanTerminated, all[0].Status)
+}
+
+func TestOrphanInteractiveAgentIsAdopted(t *testing.T) {
+	cmd, exited := startOrphan(t)
+	agent := validationAgent("interactive-agent", "")
+	agent.Mode = models.InteractiveMode
+	f := newOrphanFixture(t, agent, cmd, models.OrphanPolicyAuto)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	found, err := f.service.Recover(ctx)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, models.OrphanAdopted, found[0].Status)
+
+	// The adopted process keeps running and keeps its state file
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-exited:
+		t.Fatal("adopted process was stopped")
+	default:
+	}
+	assert.Equal(t, []string{strconv.Itoa(cmd.Process.Pid) + ".json"}, f.stateFiles(t))
+
+	// Once it exits on its own the watcher forgets it
+	require.NoError(t, syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM))
+	<-exited
+	require.Eventually(t, func() bool {
+		statuses := f.statusEvents()
+		return len(statuses) == 2 && statuses[1] == models.OrphanExited
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Empty(t, f.stateFiles(t))
+}
+
+func TestOrphanReportPolicyLeavesProcessRunning(t *testing.T) {
+	cmd, exited := startOrphan(t)
+	f := newOrphanFixture(t, validationAgent("task-agent", ""), cmd, models.OrphanPolicyReport)
+
+	found, err := f.service.Recover(context.Background())
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, models.OrphanDetected, found[0].Status)
+	assert.Nil(t, found[0].HandledAt)
+
+	select {
+	case <-exited:
+		t.Fatal("reported process was stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	orphans := f.listOrphans(t, "")
+	require.Len(t, orphans, 1)
+	assert.Equal(t, cmd.Process.Pid, orphans[0].PID)
+	assert.Equal(t, models.OrphanDetected, orphans[0].Status)
+
+	recorder := requestJSON(f.router, http.MethodGet, "/api/v1/orphans?all=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "INVALID_REQUEST", "invalid all")
+}
+
+func TestOrphanStateOfReusedPIDIsDiscarded(t *testing.T) {
+	cmd, exited := startOrphan(t)
+	dir := t.TempDir()
+	logger := zap.NewNop()
+
+	// The recorded start identity belongs to an earlier process with the same PID
+	previous := agents.NewProcessRegistry(dir, logger)
+	require.NoError(t, previous.Track(models.ProcessRecord{
+		PID:           cmd.Process.Pid,
+		AgentID:       "task-agent",
+		StartedAt:     time.Now().Add(-time.Hour),
+		StartIdentity: "1",
+	}))
+
+	agentService := services.NewAgentService(logger)
+	service := services.NewOrphanService(agents.NewProcessRegistry(dir, logger), agentService, models.OrphanPolicyTerminate, logger)
+	found, err := service.Recover(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	assert.Empty(t, service.List(true))
+
+	select {
+	case <-exited:
+		t.Fatal("process reusing the PID was stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestExecutionTracksAgentProcess(t *testing.T) {
+	agent := scriptAgent(t, "tracked-agent", models.ReadOnlyAccessType, "sleep 0.5\necho done\n")
+	f := newServerMonitorFixture(t, agent)
+	dir := t.TempDir()
+	f.executionService.SetProcessRegistry(agents.NewProcessRegistry(dir, zap.NewNop()))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router := f.executionService.Router()
+		runtimeAgent, err := router.CreateAgent(agent)
+		if assert.NoError(t, err) {
+			router.ExecuteAgent(context.Background(), runtimeAgent, "")
+		}
+	}()
+
+	// A supervisor starting now would find the running agent process
+	observer := agents.NewProcessRegistry(dir, zap.NewNop())
+	var records []models.ProcessRecord
+	require.Eventually(t, func() bool {
+		records, _ = observer.Records()
+		return len(records) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "tracked-agent", records[0].AgentID)
+	assert.NotEmpty(t, records[0].ExecutionID)
+	assert.True(t, observer.Alive(records[0]))
+
+	// Its state file is removed once it exits
+	<-done
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
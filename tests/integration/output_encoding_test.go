@@ -0,0 +1,130 @@
+package integration
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// binaryOutput is what the binary agent writes: invalid UTF-8 with a NUL byte in between
+var binaryOutput = []byte{0xff, 0xfe, 0x00, 'a', 'b', 'c', 0x80}
+
+// binaryAgent prints binaryOutput on stdout
+func binaryAgent(t *testing.T, id string) *models.AgentConfiguration {
+	return scriptAgent(t, id, models.ReadOnlyAccessType, "printf '\\377\\376\\000abc\\200'\n")
+}
+
+// decodeResult returns the execution result of a successful execute response
+func decodeResult(t *testing.T, recorder *httptest.ResponseRecorder) models.ExecutionResult {
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return result
+}
+
+func TestOutputEncodingBase64RoundTripsBinaryOutput(t *testing.T) {
+	router, executionService := newExecuteRouter(t, binaryAgent(t, "binary-agent"))
+
+	result := decodeResult(t, postExecute(router, "binary-agent", map[string]interface{}{"output_encoding": "base64"}))
+	assert.Equal(t, types.SuccessStatus, result.Status)
+	assert.Equal(t, models.OutputEncodingBase64, result.Encoding)
+	assert.Equal(t, len(binaryOutput), result.ContentLength)
+	decoded, err := base64.StdEncoding.DecodeString(result.Output)
+	require.NoError(t, err)
+	assert.Equal(t, binaryOutput, decoded)
+
+	// The stored result is returned in the same encoding
+	executions, err := executionService.ListExecutions("binary-agent")
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/executions/"+executions[0].ID, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var fetched struct {
+		Result models.ExecutionResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &fetched))
+	assert.Equal(t, result.Output, fetched.Result.Output)
+
+	// Text output, the default, cannot carry the bytes through JSON
+	result = decodeResult(t, postExecute(router, "binary-agent", map[string]interface{}{}))
+	assert.Equal(t, models.OutputEncodingText, result.Encoding)
+	assert.NotEqual(t, string(binaryOutput), result.Output)
+}
+
+func TestOutputEncodingAgentDefault(t *testing.T) {
+	agent := binaryAgent(t, "default-base64-agent")
+	agent.OutputEncoding = models.OutputEncodingBase64
+	router, _ := newExecuteRouter(t, agent)
+
+	result := decodeResult(t, postExecute(router, "default-base64-agent", map[string]interface{}{}))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(binaryOutput), result.Output)
+
+	// Requests override the agent's default
+	result = decodeResult(t, postExecute(router, "default-base64-agent", map[string]interface{}{"output_encoding": "text"}))
+	assert.Equal(t, models.OutputEncodingText, result.Encoding)
+	assert.Zero(t, result.ContentLength)
+}
+
+func TestOutputEncodingJSON(t *testing.T) {
+	router, executionService := newExecuteRouter(t,
+		scriptAgent(t, "json-agent", models.ReadOnlyAccessType, "echo '{\"answer\": 42, \"tags\": [\"a\"]}'\n"),
+		scriptAgent(t, "prose-agent", models.ReadOnlyAccessType, "echo 'the answer is 42'\n"))
+
+	result := decodeResult(t, postExecute(router, "json-agent", map[string]interface{}{"output_encoding": "json"}))
+	assert.Equal(t, types.SuccessStatus, result.Status)
+	assert.JSONEq(t, `{"answer": 42, "tags": ["a"]}`, string(result.OutputJSON))
+
+	// Output that is not JSON fails the execution with the parser's reason
+	result = decodeResult(t, postExecute(router, "prose-agent", map[string]interface{}{"output_encoding": "json"}))
+	assert.Equal(t, types.FailureStatus, result.Status)
+	assert.Contains(t, result.Error, "agent output is not valid JSON")
+	assert.Contains(t, result.Error, "invalid character")
+	assert.Empty(t, result.OutputJSON)
+	assert.Equal(t, "the answer is 42\n", result.Output)
+
+	executions, err := executionService.ListExecutions("prose-agent")
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	assert.EqualValues(t, models.FailedState, executions[0].State)
+	assert.Contains(t, executions[0].ErrorMessage, "not valid JSON")
+}
+
+func TestOutputEncodingRejectsUnknownEncodings(t *testing.T) {
+	router, _ := newExecuteRouter(t, binaryAgent(t, "binary-agent"))
+
+	recorder := postExecute(router, "binary-agent", map[string]interface{}{"output_encoding": "hex"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "unknown output encoding")
+	assert.Equal(t, map[string]string{"output_encoding": models.ValidationInvalid}, fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	agent := binaryAgent(t, "hex-agent")
+	agent.OutputEncoding = "hex"
+	errs := agent.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "output_encoding", errs[0].Field)
+	assert.Equal(t, models.ValidationInvalid, errs[0].Code)
+}
+
+func TestOutputEncodingClientDecodesBase64(t *testing.T) {
+	router, _ := newExecuteRouter(t, binaryAgent(t, "binary-agent"))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+
+	result, err := client.Execute(context.Background(), "binary-agent", supervisorctl.ExecuteRequest{OutputEncoding: supervisorctl.OutputEncodingBase64})
+	require.NoError(t, err)
+	assert.Equal(t, supervisorctl.OutputEncodingBase64, result.Encoding)
+	data, err := result.OutputData()
+	require.NoError(t, err)
+	assert.Equal(t, binaryOutput, data)
+	assert.Equal(t, len(data), result.ContentLength)
+}
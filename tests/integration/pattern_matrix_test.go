@@ -0,0 +1,70 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternMatrixEndpoint(t *testing.T) {
+	f := newDeleteFixture(t)
+
+	recorder := requestJSON(f.router, http.MethodGet, "/api/v1/meta/patterns", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response handlers.PatternMatrixResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, types.InputPatterns, response.InputPatterns)
+	assert.Equal(t, types.OutputPatterns, response.OutputPatterns)
+	assert.Equal(t, types.PatternMatrix(), response.Matrix)
+
+	// Registering an incompatible pair fails with the reason the matrix gives
+	agent := validationAgent("rpc-output-agent", "")
+	agent.OutputPattern = models.JsonRpcPatternOut
+	body, _ := json.Marshal(agent)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &fields))
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents", fields)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"output_pattern": models.ValidationConflict}, fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	// The escape hatch registers it anyway
+	fields["allow_incompatible_patterns"] = true
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents", fields)
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+}
+
+func TestClientRejectsIncompatiblePatternsLocally(t *testing.T) {
+	f := newDeleteFixture(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		f.router.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	_, err := client.AddAgent(context.Background(), supervisorctl.AgentSpec{
+		ID: "rpc-agent", Name: "RPC", AgentType: "test-type", ExecutablePath: "/bin/echo", AccessType: "read-only",
+		Mode: "task", InputPattern: "json-rpc", OutputPattern: "stdout", MaxConcurrentExecutions: 1, Timeout: 30, Enabled: true,
+	})
+	var specErr *supervisorctl.SpecError
+	require.True(t, errors.As(err, &specErr), "%v", err)
+	assert.Zero(t, requests.Load(), "the spec was sent to the supervisor")
+	assert.Equal(t, supervisorctl.ExitFailure, supervisorctl.ExitCode(err))
+
+	var out bytes.Buffer
+	assert.True(t, supervisorctl.PrintFieldErrors(&out, err))
+	assert.Regexp(t, `output_pattern\s+conflict\s+input pattern 'json-rpc' is incompatible`, out.String())
+}
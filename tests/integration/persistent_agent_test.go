@@ -0,0 +1,230 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var (
+	jsonrpcAgentOnce  sync.Once
+	jsonrpcAgentPath  string
+	jsonrpcAgentError error
+)
+
+// jsonrpcAgentBinary builds the JSON-RPC test agent once per test run and returns its path
+func jsonrpcAgentBinary(t *testing.T) string {
+	jsonrpcAgentOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "jsonrpcagent")
+		if err != nil {
+			jsonrpcAgentError = err
+			return
+		}
+		jsonrpcAgentPath = filepath.Join(dir, "jsonrpcagent")
+		if runtime.GOOS == "windows" {
+			jsonrpcAgentPath += ".exe"
+		}
+		output, err := exec.Command("go", "build", "-o", jsonrpcAgentPath, "../testdata/jsonrpcagent").CombinedOutput()
+		if err != nil {
+			jsonrpcAgentError = err
+			jsonrpcAgentPath = string(output)
+		}
+	})
+	require.NoError(t, jsonrpcAgentError, jsonrpcAgentPath)
+	return jsonrpcAgentPath
+}
+
+// persistentFixture runs persistent agents of the JSON-RPC test agent through an execution coordinator
+type persistentFixture struct {
+	agentService     *services.AgentService
+	executionService *services.ExecutionService
+	coordinator      *services.ExecutionCoordinator
+	spawnLog         string
+}
+
+func newPersistentFixture(t *testing.T) *persistentFixture {
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+	return &persistentFixture{
+		agentService:     agentService,
+		executionService: executionService,
+		coordinator:      services.NewExecutionCoordinator(agentService, executionService, logger),
+		spawnLog:         filepath.Join(t.TempDir(), "spawns.log"),
+	}
+}
+
+// register registers a persistent agent running the test agent, stopping its process after the test
+func (f *persistentFixture) register(t *testing.T, id string, accessType types.AgentAccessType, maxConcurrent int) *models.AgentConfiguration {
+	config := validationAgent(id, "")
+	config.ExecutablePath = jsonrpcAgentBinary(t)
+	config.Mode = models.PersistentMode
+	config.InputPattern = models.JsonRpcPattern
+	config.OutputPattern = models.JsonRpcPatternOut
+	config.AccessType = accessType
+	config.MaxConcurrentExecutions = maxConcurrent
+	config.Envs = map[string]string{"JSONRPC_AGENT_SPAWN_LOG": f.spawnLog}
+	require.NoError(t, f.agentService.RegisterAgent(config))
+	t.Cleanup(func() { agents.StopPersistentProcess(id) })
+	return config
+}
+
+// spawns returns the number of test agent processes started
+func (f *persistentFixture) spawns(t *testing.T) int {
+	data, err := os.ReadFile(f.spawnLog)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return len(strings.Fields(string(data)))
+}
+
+// echo is the output of an execution of the test agent
+type echo struct {
+	Echo     string `json:"echo"`
+	InFlight int    `json:"in_flight"`
+	PID      int    `json:"pid"`
+}
+
+// execute runs an execution of the agent and returns its result
+func (f *persistentFixture) execute(t *testing.T, agentID, input string) (*models.ExecutionResult, error) {
+	execution, _, err := f.coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: agentID, Input: input})
+	require.NotNil(t, execution, "execution of %q: %v", input, err)
+	result, resultErr := f.executionService.GetExecutionResult(execution.ID)
+	require.NoError(t, resultErr)
+	return result, err
+}
+
+// executeAll runs executions of the inputs in parallel and returns their decoded outputs
+func (f *persistentFixture) executeAll(t *testing.T, agentID string, inputs []string) []echo {
+	outputs := make([]echo, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			result, err := f.execute(t, agentID, input)
+			if assert.NoError(t, err, input) {
+				assert.NoError(t, json.Unmarshal([]byte(result.Output), &outputs[i]), result.Output)
+			}
+		}(i, input)
+	}
+	wg.Wait()
+	return outputs
+}
+
+func TestPersistentAgentServesExecutionsFromOneProcess(t *testing.T) {
+	f := newPersistentFixture(t)
+	f.register(t, "persistent-reader", models.ReadOnlyAccessType, 5)
+
+	inputs := make([]string, 20)
+	for i := range inputs {
+		inputs[i] = "sleep:30ms"
+	}
+	outputs := f.executeAll(t, "persistent-reader", inputs)
+
+	assert.Equal(t, 1, f.spawns(t))
+	maxInFlight := 0
+	for _, output := range outputs {
+		assert.Equal(t, "sleep:30ms", output.Echo)
+		assert.Equal(t, outputs[0].PID, output.PID)
+		assert.LessOrEqual(t, output.InFlight, 5)
+		if output.InFlight > maxInFlight {
+			maxInFlight = output.InFlight
+		}
+	}
+	// Read-only executions share the pipe concurrently
+	assert.Greater(t, maxInFlight, 1)
+}
+
+func TestPersistentReadWriteAgentRunsOneExecutionAtATime(t *testing.T) {
+	f := newPersistentFixture(t)
+	f.register(t, "persistent-writer", models.ReadWriteAccessType, 1)
+
+	outputs := f.executeAll(t, "persistent-writer", []string{"sleep:20ms", "sleep:20ms", "sleep:20ms", "sleep:20ms", "sleep:20ms"})
+	assert.Equal(t, 1, f.spawns(t))
+	for _, output := range outputs {
+		assert.Equal(t, 1, output.InFlight)
+	}
+}
+
+func TestPersistentAgentRestartsAfterExit(t *testing.T) {
+	f := newPersistentFixture(t)
+	f.register(t, "persistent-crasher", models.ReadWriteAccessType, 1)
+
+	first, err := f.execute(t, "persistent-crasher", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, types.SuccessStatus, first.Status)
+
+	// A JSON-RPC error fails the execution but leaves the process running
+	failed, err := f.execute(t, "persistent-crasher", "fail")
+	require.Error(t, err)
+	assert.Equal(t, types.FailureStatus, failed.Status)
+	assert.Contains(t, failed.Error, "failed on purpose")
+	assert.Equal(t, 1, f.spawns(t))
+
+	crashed, err := f.execute(t, "persistent-crasher", "exit")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, agents.ErrPersistentProcessExited)
+	assert.Equal(t, types.FailureStatus, crashed.Status)
+
+	restarted, err := f.execute(t, "persistent-crasher", "again")
+	require.NoError(t, err)
+	assert.Contains(t, restarted.Output, `"echo":"again"`)
+	assert.NotEqual(t, first.ProcessID, restarted.ProcessID)
+	assert.Equal(t, 2, f.spawns(t))
+}
+
+func TestPersistentAgentRestartsWhenUnresponsive(t *testing.T) {
+	f := newPersistentFixture(t)
+	config := f.register(t, "persistent-hanger", models.ReadOnlyAccessType, 1)
+	config.Timeout = 1
+	config.PingIntervalSeconds = 1
+	config.PingTimeoutSeconds = 1
+	// Run the agent directly, so the execution service doesn't retry the timed out execution
+	agent := agents.NewPersistentAgent(config, zap.NewNop())
+
+	hung, err := agent.Execute(context.Background(), "hang")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, types.TimeoutStatus, hung.Status)
+
+	// The unanswered ping stops the process, so a later execution starts a new one
+	require.Eventually(t, func() bool {
+		result, err := agent.Execute(context.Background(), "alive")
+		return err == nil && result.ProcessID != hung.ProcessID
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 2, f.spawns(t))
+}
+
+func TestPersistentModeRequiresJSONRPCPatterns(t *testing.T) {
+	config := validationAgent("persistent-stdin", "")
+	config.Mode = models.PersistentMode
+	errs := config.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "mode", errs[0].Field)
+	assert.Equal(t, models.ValidationConflict, errs[0].Code)
+
+	// Executions of persistent agents share one process, so they cannot override how it runs
+	f := newPersistentFixture(t)
+	f.register(t, "persistent-shared", models.ReadOnlyAccessType, 1)
+	_, _, err := f.coordinator.Execute(context.Background(), services.ExecutionRequest{
+		AgentID: "persistent-shared", Input: "hello", Env: map[string]string{"EXTRA": "1"},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// pipelineFixture serves the REST routes with pipelines, and a scheduler that can run them
+type pipelineFixture struct {
+	router           *gin.Engine
+	agentService     *services.AgentService
+	coordinator      *services.ExecutionCoordinator
+	executionService *services.ExecutionService
+	pipelineService  *services.PipelineService
+	scheduler        *services.SchedulerService
+}
+
+func newPipelineFixture(t *testing.T, agents ...*models.AgentConfiguration) *pipelineFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	pipelineService := services.NewPipelineService(agentService, coordinator, logger)
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	scheduler.SetPipelineService(pipelineService)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		SchedulerService:     scheduler,
+		PipelineService:      pipelineService,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+
+	return &pipelineFixture{router: router, agentService: agentService, coordinator: coordinator, executionService: executionService, pipelineService: pipelineService, scheduler: scheduler}
+}
+
+func (f *pipelineFixture) request(method, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// execute runs a pipeline over REST and returns the run
+func (f *pipelineFixture) execute(t *testing.T, pipelineID, input string) models.PipelineExecution {
+	recorder := f.request(http.MethodPost, "/api/v1/pipelines/"+pipelineID+"/execute", handlers.PipelineExecuteRequest{Input: input})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var execution models.PipelineExecution
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &execution))
+	return execution
+}
+
+// pipelineAgents returns an extractor, transformer and uploader that wrap their input in their name
+func pipelineAgents(t *testing.T) []*models.AgentConfiguration {
+	return []*models.AgentConfiguration{
+		scriptAgent(t, "extractor", models.ReadOnlyAccessType, "echo \"extracted($(cat))\"\n"),
+		scriptAgent(t, "transformer", models.ReadOnlyAccessType, "echo \"transformed($(cat) $@)\"\n"),
+		scriptAgent(t, "uploader", models.ReadWriteAccessType, "echo \"uploaded($(cat))\"\n"),
+	}
+}
+
+func TestPipelinePropagatesOutputBetweenSteps(t *testing.T) {
+	f := newPipelineFixture(t, pipelineAgents(t)...)
+
+	recorder := f.request(http.MethodPost, "/api/v1/pipelines", handlers.PipelineRequest{
+		ID:   "etl",
+		Name: "ETL",
+		Steps: []models.PipelineStep{
+			{AgentID: "extractor"},
+			{Name: "transform", AgentID: "transformer", Parameters: map[string]interface{}{"format": "csv"}},
+			{AgentID: "uploader", InputMapping: "{{output}} of {{input}}"},
+		},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	execution := f.execute(t, "etl", "raw")
+	assert.EqualValues(t, models.CompletedState, execution.State)
+	assert.Empty(t, execution.Error)
+	// {{output}} is substituted verbatim, trailing newline included
+	assert.Equal(t, "uploaded(transformed(extracted(raw) --format csv)\n of raw)\n", execution.Output)
+	assert.NotNil(t, execution.EndTime)
+
+	require.Len(t, execution.Steps, 3)
+	assert.Equal(t, []string{"step-1", "transform", "step-3"},
+		[]string{execution.Steps[0].Name, execution.Steps[1].Name, execution.Steps[2].Name})
+	assert.Equal(t, "extracted(raw)\n", execution.Steps[0].Output)
+	assert.Equal(t, "transformed(extracted(raw) --format csv)\n", execution.Steps[1].Output)
+	for _, step := range execution.Steps {
+		assert.Equal(t, types.SuccessStatus, step.Status, step.Name)
+		assert.NotEmpty(t, step.ExecutionID, step.Name)
+	}
+
+	// The run links its child executions, which carry the run's labels
+	require.Len(t, execution.ExecutionIDs, 3)
+	for i, executionID := range execution.ExecutionIDs {
+		child, err := f.executionService.GetExecution(executionID)
+		require.NoError(t, err)
+		assert.Equal(t, execution.Steps[i].AgentID, child.AgentID)
+		assert.Equal(t, "etl", child.Labels[services.PipelineIDLabel])
+		assert.Equal(t, execution.ID, child.Labels[services.PipelineExecutionIDLabel])
+	}
+
+	// The run is recorded under the pipeline
+	recorder = f.request(http.MethodGet, "/api/v1/pipelines/etl/executions/"+execution.ID, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var stored models.PipelineExecution
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &stored))
+	assert.Equal(t, execution.ExecutionIDs, stored.ExecutionIDs)
+}
+
+func TestPipelineFailureShortCircuits(t *testing.T) {
+	agents := pipelineAgents(t)
+	agents[1] = scriptAgent(t, "transformer", models.ReadOnlyAccessType, "echo broken >&2\nexit 2\n")
+	f := newPipelineFixture(t, agents...)
+
+	require.NoError(t, f.pipelineService.CreatePipeline(&models.Pipeline{
+		ID:    "failing-etl",
+		Name:  "Failing ETL",
+		Steps: []models.PipelineStep{{AgentID: "extractor"}, {AgentID: "transformer"}, {AgentID: "uploader"}},
+	}))
+
+	execution := f.execute(t, "failing-etl", "raw")
+	assert.EqualValues(t, models.FailedState, execution.State)
+	assert.Contains(t, execution.Error, "step step-2 failed")
+	assert.Equal(t, "extracted(raw)\n", execution.Output, "the output of the last step that succeeded is kept")
+
+	require.Len(t, execution.Steps, 3)
+	assert.Equal(t, types.SuccessStatus, execution.Steps[0].Status)
+	assert.Equal(t, types.FailureStatus, execution.Steps[1].Status)
+	assert.NotEmpty(t, execution.Steps[1].Error)
+	assert.Equal(t, types.SkippedStatus, execution.Steps[2].Status)
+	assert.Empty(t, execution.Steps[2].ExecutionID)
+	assert.Len(t, execution.ExecutionIDs, 2)
+
+	// The uploader never ran
+	executions, err := f.executionService.ListExecutions("uploader")
+	require.NoError(t, err)
+	assert.Empty(t, executions)
+
+	// With continue_on_error the next step gets the last successful output
+	pipeline, err := f.pipelineService.GetPipeline("failing-etl")
+	require.NoError(t, err)
+	updated := *pipeline
+	updated.Steps = []models.PipelineStep{{AgentID: "extractor"}, {AgentID: "transformer", ContinueOnError: true}, {AgentID: "uploader"}}
+	require.NoError(t, f.pipelineService.UpdatePipeline(&updated))
+
+	execution = f.execute(t, "failing-etl", "raw")
+	assert.EqualValues(t, models.CompletedState, execution.State)
+	assert.Equal(t, types.FailureStatus, execution.Steps[1].Status)
+	assert.Equal(t, types.SuccessStatus, execution.Steps[2].Status)
+	assert.Equal(t, "uploaded(extracted(raw))\n", execution.Output)
+}
+
+func TestPipelineCRUDErrors(t *testing.T) {
+	f := newPipelineFixture(t, pipelineAgents(t)...)
+
+	recorder := f.request(http.MethodPost, "/api/v1/pipelines", handlers.PipelineRequest{
+		ID: "unknown-agent", Name: "Unknown", Steps: []models.PipelineStep{{AgentID: "missing-agent"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "step with unknown agent")
+
+	recorder = f.request(http.MethodPost, "/api/v1/pipelines", handlers.PipelineRequest{ID: "empty", Name: "Empty"})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "pipeline without steps")
+
+	valid := handlers.PipelineRequest{ID: "etl", Name: "ETL", Steps: []models.PipelineStep{{AgentID: "extractor"}}}
+	require.Equal(t, http.StatusCreated, f.request(http.MethodPost, "/api/v1/pipelines", valid).Code)
+	recorder = f.request(http.MethodPost, "/api/v1/pipelines", valid)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "PIPELINE_CONFLICT", "duplicate pipeline")
+
+	recorder = f.request(http.MethodPost, "/api/v1/pipelines/missing/execute", handlers.PipelineExecuteRequest{})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "PIPELINE_NOT_FOUND", "execute unknown pipeline")
+
+	recorder = f.request(http.MethodDelete, "/api/v1/pipelines/etl", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = f.request(http.MethodGet, "/api/v1/pipelines/etl", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestScheduledTaskRunsPipeline(t *testing.T) {
+	f := newPipelineFixture(t, pipelineAgents(t)...)
+	require.NoError(t, f.pipelineService.CreatePipeline(&models.Pipeline{
+		ID:    "scheduled-etl",
+		Name:  "Scheduled ETL",
+		Steps: []models.PipelineStep{{AgentID: "extractor"}, {AgentID: "uploader"}},
+	}))
+
+	// A task targets either an agent or a pipeline
+	both := &models.ScheduledTask{ID: "both", Name: "Both", AgentID: "extractor", PipelineID: "scheduled-etl", CronExpression: "@every 1h", Enabled: true}
+	assert.ErrorIs(t, f.scheduler.ScheduleTask(both), models.ErrInvalidTask)
+	missing := &models.ScheduledTask{ID: "missing", Name: "Missing", PipelineID: "missing-pipeline", CronExpression: "@every 1h", Enabled: true}
+	assert.ErrorIs(t, f.scheduler.ScheduleTask(missing), models.ErrPipelineNotFound)
+
+	task := &models.ScheduledTask{
+		ID:             "pipeline-task",
+		Name:           "Pipeline Task",
+		PipelineID:     "scheduled-etl",
+		CronExpression: "@every 1s",
+		Enabled:        true,
+	}
+	require.NoError(t, f.scheduler.ScheduleTask(task))
+	defer f.scheduler.UnscheduleTask(task.ID)
+
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = f.scheduler.GetTaskHistory(task.ID, 0)
+		return len(history) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, types.SuccessStatus, history[0].Status, history[0].Error)
+	execution, err := f.pipelineService.GetPipelineExecution(history[0].ExecutionID)
+	require.NoError(t, err)
+	assert.Equal(t, "scheduled-etl", execution.PipelineID)
+	assert.Equal(t, "uploaded(extracted())\n", execution.Output)
+
+	// Running the task immediately reports the pipeline run
+	result, err := f.scheduler.ExecuteTask(context.Background(), task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.SuccessStatus, result.Status)
+	assert.Equal(t, "uploaded(extracted())\n", result.Output)
+	_, err = f.pipelineService.GetPipelineExecution(result.ID)
+	assert.NoError(t, err)
+}
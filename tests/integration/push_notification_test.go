@@ -0,0 +1,281 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// callbackRecorder is a push notification receiver answering with a scripted sequence of statuses
+type callbackRecorder struct {
+	mutex    sync.Mutex
+	statuses []int // Answered in order; the last one repeats
+	requests []recordedCallback
+}
+
+type recordedCallback struct {
+	authorization string
+	payload       models.PushNotificationPayload
+}
+
+func (cr *callbackRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var payload models.PushNotificationPayload
+	_ = json.Unmarshal(body, &payload)
+
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	cr.requests = append(cr.requests, recordedCallback{authorization: r.Header.Get("Authorization"), payload: payload})
+	status := http.StatusOK
+	if len(cr.statuses) > 0 {
+		status = cr.statuses[0]
+		if len(cr.statuses) > 1 {
+			cr.statuses = cr.statuses[1:]
+		}
+	}
+	w.WriteHeader(status)
+}
+
+func (cr *callbackRecorder) received() []recordedCallback {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+	return append([]recordedCallback{}, cr.requests...)
+}
+
+// pushFixture serves JSON-RPC with push notifications over a slow and a fast agent
+type pushFixture struct {
+	*pipelineFixture
+	notifier *services.PushNotifier
+}
+
+func newPushFixture(t *testing.T) *pushFixture {
+	f := newPipelineFixture(t,
+		scriptAgent(t, "slow-agent", models.ReadOnlyAccessType, "sleep 0.3\necho done\n"),
+		scriptAgent(t, "fast-agent", models.ReadOnlyAccessType, "echo fast\n"),
+		scriptAgent(t, "broken-agent", models.ReadOnlyAccessType, "echo broken >&2\nexit 3\n"),
+	)
+
+	notifier := services.NewPushNotifier(f.executionService, zap.NewNop())
+	notifier.SetRetryPolicy(5, 10*time.Millisecond)
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+	jsonrpc := handlers.NewJSONRPCHandlers(f.agentService, f.coordinator, zap.NewNop(), a2aConfig)
+	jsonrpc.SetPushNotifier(notifier)
+	jsonrpc.RegisterJSONRPCRoutes(f.router)
+
+	return &pushFixture{pipelineFixture: f, notifier: notifier}
+}
+
+// rpc calls a JSON-RPC method and returns the decoded response
+func (f *pushFixture) rpc(t *testing.T, method string, params map[string]interface{}) handlers.JSONRPCResponse {
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "id": 1, "params": params})
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response handlers.JSONRPCResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response
+}
+
+func (f *pushFixture) setPushNotification(t *testing.T, taskID, url, token string) handlers.JSONRPCResponse {
+	return f.rpc(t, "tasks/pushNotificationConfig/set", map[string]interface{}{
+		"taskId":                 taskID,
+		"pushNotificationConfig": map[string]interface{}{"url": url, "token": token},
+	})
+}
+
+// delivery returns the delivery status of the task's push notification
+func (f *pushFixture) delivery(t *testing.T, taskID string) *models.PushNotificationDelivery {
+	config, err := f.notifier.GetTaskPushNotification(taskID)
+	require.NoError(t, err)
+	require.NotNil(t, config)
+	return config.Delivery
+}
+
+func TestPushNotificationDeliveredOnceWhenTaskCompletes(t *testing.T) {
+	f := newPushFixture(t)
+	callbacks := &callbackRecorder{}
+	server := httptest.NewTLSServer(callbacks)
+	defer server.Close()
+	f.notifier.SetHTTPClient(server.Client())
+
+	pending, _, err := f.coordinator.Start(context.Background(), services.ExecutionRequest{AgentID: "slow-agent", Input: "hi"})
+	require.NoError(t, err)
+
+	response := f.setPushNotification(t, pending.ID, server.URL+"/hooks/a2a", "callback-secret")
+	require.Nil(t, response.Error)
+	result := response.Result.(map[string]interface{})
+	assert.Equal(t, pending.ID, result["taskId"])
+	config := result["pushNotificationConfig"].(map[string]interface{})
+	assert.Equal(t, server.URL+"/hooks/a2a", config["url"])
+	assert.NotContains(t, config, "token")
+
+	require.Eventually(t, func() bool {
+		delivery := f.delivery(t, pending.ID)
+		return delivery != nil && delivery.Status == models.PushDeliveryDelivered
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Give a duplicate delivery the chance to show up
+	time.Sleep(100 * time.Millisecond)
+	received := callbacks.received()
+	require.Len(t, received, 1)
+	assert.Equal(t, "Bearer callback-secret", received[0].authorization)
+	assert.Equal(t, pending.ID, received[0].payload.TaskID)
+	assert.Equal(t, types.CompletedState, received[0].payload.State)
+	require.NotNil(t, received[0].payload.Result)
+	assert.Contains(t, received[0].payload.Result.Output, "done")
+
+	delivery := f.delivery(t, pending.ID)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.LastStatusCode)
+	assert.NotNil(t, delivery.DeliveredAt)
+
+	// The delivery status is recorded on the task and returned by the get method
+	execution, err := f.executionService.GetExecution(pending.ID)
+	require.NoError(t, err)
+	require.NotNil(t, execution.PushNotification)
+	assert.Equal(t, models.PushDeliveryDelivered, execution.PushNotification.Delivery.Status)
+
+	response = f.rpc(t, "tasks/pushNotificationConfig/get", map[string]interface{}{"id": pending.ID})
+	require.Nil(t, response.Error)
+	config = response.Result.(map[string]interface{})["pushNotificationConfig"].(map[string]interface{})
+	assert.Equal(t, "delivered", config["delivery"].(map[string]interface{})["status"])
+}
+
+func TestPushNotificationRetriesTransientFailures(t *testing.T) {
+	f := newPushFixture(t)
+	f.notifier.SetAllowInsecureURLs(true)
+	callbacks := &callbackRecorder{statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}}
+	server := httptest.NewServer(callbacks)
+	defer server.Close()
+
+	// Registering on a task that already finished delivers right away
+	execution, _, err := f.coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: "fast-agent", Input: "hi"})
+	require.NoError(t, err)
+	require.Nil(t, f.setPushNotification(t, execution.ID, server.URL, "").Error)
+
+	require.Eventually(t, func() bool {
+		delivery := f.delivery(t, execution.ID)
+		return delivery != nil && delivery.Status == models.PushDeliveryDelivered
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 3, f.delivery(t, execution.ID).Attempts)
+	received := callbacks.received()
+	require.Len(t, received, 3)
+	assert.Empty(t, received[0].authorization)
+}
+
+func TestPushNotificationFailedDelivery(t *testing.T) {
+	f := newPushFixture(t)
+	f.notifier.SetAllowInsecureURLs(true)
+
+	// Client errors are not retried
+	rejecting := &callbackRecorder{statuses: []int{http.StatusForbidden}}
+	server := httptest.NewServer(rejecting)
+	defer server.Close()
+
+	execution, _, _ := f.coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: "broken-agent", Input: "hi"})
+	require.NotNil(t, execution)
+	require.Nil(t, f.setPushNotification(t, execution.ID, server.URL, "").Error)
+
+	require.Eventually(t, func() bool {
+		delivery := f.delivery(t, execution.ID)
+		return delivery != nil && delivery.Status == models.PushDeliveryFailed
+	}, 5*time.Second, 20*time.Millisecond)
+	delivery := f.delivery(t, execution.ID)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusForbidden, delivery.LastStatusCode)
+	require.Len(t, rejecting.received(), 1)
+	assert.Equal(t, types.FailedState, rejecting.received()[0].payload.State)
+
+	// Persistent server errors give up after the configured attempts
+	f.notifier.SetRetryPolicy(2, time.Millisecond)
+	unavailable := &callbackRecorder{statuses: []int{http.StatusServiceUnavailable}}
+	server = httptest.NewServer(unavailable)
+	defer server.Close()
+
+	execution, _, err := f.coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: "fast-agent", Input: "hi"})
+	require.NoError(t, err)
+	require.Nil(t, f.setPushNotification(t, execution.ID, server.URL, "").Error)
+
+	require.Eventually(t, func() bool {
+		delivery := f.delivery(t, execution.ID)
+		return delivery != nil && delivery.Status == models.PushDeliveryFailed
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 2, f.delivery(t, execution.ID).Attempts)
+	assert.Contains(t, f.delivery(t, execution.ID).LastError, "503")
+}
+
+func TestPushNotificationValidation(t *testing.T) {
+	f := newPushFixture(t)
+	execution, _, err := f.coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: "fast-agent", Input: "hi"})
+	require.NoError(t, err)
+
+	// Plain HTTP callbacks need allow_insecure_urls
+	response := f.setPushNotification(t, execution.ID, "http://callbacks.example.com/hook", "")
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32602, response.Error.Code)
+	assert.Contains(t, response.Error.Data, "https")
+
+	response = f.setPushNotification(t, execution.ID, "callbacks.example.com/hook", "")
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32602, response.Error.Code)
+
+	response = f.rpc(t, "tasks/pushNotificationConfig/set", map[string]interface{}{"taskId": execution.ID})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32602, response.Error.Code)
+
+	// Unknown tasks
+	response = f.setPushNotification(t, "missing-task", "https://callbacks.example.com/hook", "")
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32001, response.Error.Code)
+	response = f.rpc(t, "tasks/pushNotificationConfig/get", map[string]interface{}{"id": "missing-task"})
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32001, response.Error.Code)
+
+	// A task without a callback has no config
+	response = f.rpc(t, "tasks/pushNotificationConfig/get", map[string]interface{}{"id": execution.ID})
+	require.Nil(t, response.Error)
+	assert.NotContains(t, response.Result.(map[string]interface{}), "pushNotificationConfig")
+
+	// Without a notifier the methods are unsupported
+	plain := newPipelineFixture(t)
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+	handlers.NewJSONRPCHandlers(plain.agentService, plain.coordinator, zap.NewNop(), a2aConfig).RegisterJSONRPCRoutes(plain.router)
+	response = (&pushFixture{pipelineFixture: plain}).setPushNotification(t, execution.ID, "https://callbacks.example.com/hook", "")
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32003, response.Error.Code)
+}
+
+func TestPushNotificationConfigValidation(t *testing.T) {
+	config := a2a.DefaultA2AConfig()
+	require.NoError(t, config.Validate())
+	assert.False(t, config.PushNotifications.AllowInsecureURLs)
+
+	config.PushNotifications.AllowInsecureURLs = true
+	assert.Contains(t, config.Warnings(), "push notifications may be sent to plain HTTP callback URLs")
+
+	config.PushNotifications.MaxAttempts = 0
+	config.PushNotifications.Timeout = 0
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "push_notifications.max_attempts")
+	assert.Contains(t, err.Error(), "push_notifications.timeout")
+}
@@ -0,0 +1,72 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestQueueAlertsOnReadWriteQueue(t *testing.T) {
+	agent := scriptAgent(t, "queued-agent", models.ReadWriteAccessType, "sleep 0.5\n")
+	f := newServerMonitorFixture(t, agent)
+	router := f.executionService.Router()
+
+	alerts := services.NewQueueAlertMonitor(router, services.QueueAlertThreshold{MaxQueueLength: 1, ClearQueueLength: 0}, time.Second, zap.NewNop())
+	var mutex sync.Mutex
+	var events []models.QueueAlertEvent
+	alerts.AddAlertHook(func(event models.QueueAlertEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, event)
+	})
+
+	runtimeAgent, err := router.CreateAgent(agent)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.ExecuteAgent(context.Background(), runtimeAgent, "")
+		}()
+	}
+
+	// One execution runs while two wait behind it
+	var stats services.AgentQueueStats
+	require.Eventually(t, func() bool {
+		for _, entry := range router.QueueStats() {
+			if entry.AgentID == "queued-agent" && entry.QueueLength == 2 && entry.CurrentExecutionID != "" {
+				stats = entry
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.False(t, stats.OldestQueuedAt.IsZero())
+
+	fired := alerts.Check()
+	require.Len(t, fired, 1)
+	assert.Equal(t, models.QueueAlertFired, fired[0].Type)
+	assert.Equal(t, "queued-agent", fired[0].AgentID)
+	assert.GreaterOrEqual(t, fired[0].QueueLength, 2)
+	assert.NotEmpty(t, fired[0].CurrentExecutionID)
+	assert.Positive(t, fired[0].OldestWaitSeconds)
+
+	// Once the queue drains the alert clears
+	wg.Wait()
+	cleared := alerts.Check()
+	require.Len(t, cleared, 1)
+	assert.Equal(t, models.QueueAlertCleared, cleared[0].Type)
+	assert.Zero(t, cleared[0].QueueLength)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Len(t, events, 2)
+}
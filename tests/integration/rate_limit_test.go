@@ -0,0 +1,217 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	rateLimitTokenA = "token-a"
+	rateLimitTokenB = "token-b"
+)
+
+// newRateLimitedRouter wires the JSON-RPC routes and /health behind a rate limiter
+func newRateLimitedRouter(t *testing.T, config middleware.RateLimitConfig) (*gin.Engine, *middleware.RateLimiter, *services.MetricsCollector) {
+	gin.SetMode(gin.TestMode)
+	logger, _ := zap.NewDevelopment()
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(validationAgent("limited-agent", "")))
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	metricsCollector := services.NewMetricsCollector(logger)
+	executionService.SetMetricsCollector(metricsCollector)
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = true
+	a2aConfig.Authentication.ValidTokens = []string{rateLimitTokenA, rateLimitTokenB}
+
+	limiter := middleware.NewRateLimiter(config, metricsCollector, logger)
+	limiter.SetTokenCheck(func(token string) bool { return slices.Contains(a2aConfig.Authentication.ValidTokens, token) })
+	router := gin.New()
+	router.Use(limiter.Middleware())
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	})
+	routes.SetupA2ARoutes(&routes.A2ARouteConfig{
+		Router:               router,
+		A2AService:           services.NewA2AService(agentService, executionService, logger),
+		AgentService:         agentService,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		A2AConfig:            a2aConfig,
+	})
+
+	return router, limiter, metricsCollector
+}
+
+func executeAgentRPC(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(handlers.JSONRPCRequest{
+		Jsonrpc: "2.0",
+		Method:  "execute-agent",
+		Params:  map[string]interface{}{"agentId": "limited-agent", "input": "hello"},
+		ID:      1,
+	})
+	request := httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRateLimitJSONRPCPerToken(t *testing.T) {
+	router, _, metricsCollector := newRateLimitedRouter(t, middleware.RateLimitConfig{
+		Enabled: true,
+		Default: middleware.RateLimit{RequestsPerSecond: 10, Burst: 10},
+	})
+
+	allowed, limited := 0, 0
+	for i := 0; i < 50; i++ {
+		recorder := executeAgentRPC(router, rateLimitTokenA)
+		switch recorder.Code {
+		case http.StatusOK:
+			allowed++
+		case http.StatusTooManyRequests:
+			limited++
+			assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+			var response handlers.JSONRPCResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			require.NotNil(t, response.Error)
+			assert.Equal(t, -32000, response.Error.Code)
+		default:
+			t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	// The burst is served immediately; a few more may refill while the loop runs
+	assert.GreaterOrEqual(t, allowed, 10)
+	assert.LessOrEqual(t, allowed, 15)
+	assert.Equal(t, 50, allowed+limited)
+
+	// A second token has its own bucket
+	assert.Equal(t, http.StatusOK, executeAgentRPC(router, rateLimitTokenB).Code)
+
+	metrics := metricsCollector.GetRateLimitMetrics()
+	assert.Equal(t, int64(limited), metrics[services.ClientIDForToken(rateLimitTokenA)].RateRejections)
+	_, tracked := metrics[services.ClientIDForToken(rateLimitTokenB)]
+	assert.False(t, tracked)
+}
+
+func TestRateLimitTokenOverrideAndReload(t *testing.T) {
+	config := middleware.RateLimitConfig{
+		Enabled:     true,
+		Default:     middleware.RateLimit{RequestsPerSecond: 1, Burst: 1},
+		Clients:     map[string]middleware.RateLimit{services.ClientIDForToken(rateLimitTokenB): {RequestsPerSecond: 100, Burst: 5}},
+		ExemptPaths: []string{"/health"},
+	}
+	router, limiter, _ := newRateLimitedRouter(t, config)
+
+	assert.Equal(t, http.StatusOK, executeAgentRPC(router, rateLimitTokenA).Code)
+	assert.Equal(t, http.StatusTooManyRequests, executeAgentRPC(router, rateLimitTokenA).Code)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, executeAgentRPC(router, rateLimitTokenB).Code)
+	}
+
+	// Exempt paths are never limited
+	for i := 0; i < 5; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	// Reloaded limits take effect immediately
+	config.Default = middleware.RateLimit{RequestsPerSecond: 100, Burst: 3}
+	limiter.UpdateConfig(config)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, executeAgentRPC(router, rateLimitTokenA).Code)
+	}
+}
+
+func TestRateLimitRESTResponse(t *testing.T) {
+	router, _, _ := newRateLimitedRouter(t, middleware.RateLimitConfig{
+		Enabled: true,
+		Default: middleware.RateLimit{RequestsPerSecond: 1, Burst: 1},
+	})
+
+	var recorder *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/a2a/status", nil))
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, "rate limit exceeded", body["error"])
+	assert.Equal(t, "RATE_LIMITED", body["code"])
+	assert.Equal(t, false, body["success"])
+	assert.Equal(t, float64(1), body["details"].(map[string]interface{})["retry_after"])
+}
+
+func TestRateLimitUnknownTokensShareAddressBucket(t *testing.T) {
+	router, limiter, metricsCollector := newRateLimitedRouter(t, middleware.RateLimitConfig{
+		Enabled: true,
+		Default: middleware.RateLimit{RequestsPerSecond: 1, Burst: 2},
+	})
+
+	// A new made-up token with every request is limited by address like no token at all
+	limited := 0
+	for i := 0; i < 20; i++ {
+		if executeAgentRPC(router, "made-up-"+strconv.Itoa(i)).Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	assert.GreaterOrEqual(t, limited, 17)
+	assert.Equal(t, 1, limiter.Buckets())
+	assert.Equal(t, int64(limited), metricsCollector.GetRateLimitMetrics()[services.ClientIDForAddress("192.0.2.1")].RateRejections)
+
+	// Known tokens keep buckets of their own
+	assert.Equal(t, http.StatusOK, executeAgentRPC(router, rateLimitTokenA).Code)
+	assert.Equal(t, 2, limiter.Buckets())
+}
+
+func TestRateLimitEvictsIdleBuckets(t *testing.T) {
+	limiter := middleware.NewRateLimiter(middleware.RateLimitConfig{
+		Enabled: true,
+		Default: middleware.RateLimit{RequestsPerSecond: 1, Burst: 5},
+		Clients: map[string]middleware.RateLimit{"slow-client": {RequestsPerSecond: 0.01, Burst: 2}},
+	}, nil, zap.NewNop())
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		allowed, _ := limiter.Allow("client-"+strconv.Itoa(i), start)
+		require.True(t, allowed)
+	}
+	for i := 0; i < 2; i++ {
+		limiter.Allow("slow-client", start)
+	}
+	assert.Equal(t, 101, limiter.Buckets())
+
+	// Buckets that refilled completely are dropped; the drained one is kept and stays drained
+	allowed, _ := limiter.Allow("new-client", start.Add(90*time.Second))
+	assert.True(t, allowed)
+	assert.Equal(t, 2, limiter.Buckets())
+	allowed, _ = limiter.Allow("slow-client", start.Add(90*time.Second))
+	assert.False(t, allowed)
+}
@@ -0,0 +1,154 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/logging"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func requestIDAgentConfig(id, executablePath string) *models.AgentConfiguration {
+	return &models.AgentConfiguration{
+		ID:                      id,
+		Name:                    "Request ID Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          executablePath,
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 5,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 30,
+		Enabled:                 true,
+	}
+}
+
+// fieldValue returns the string value of a logged field, or "" when absent
+func fieldValue(entry observer.LoggedEntry, key string) string {
+	value, _ := entry.ContextMap()[key].(string)
+	return value
+}
+
+func TestRequestIDPropagation_HTTPAndJSONRPC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(requestIDAgentConfig("request-id-agent", "/bin/echo")))
+	executionService := services.NewExecutionService(agentService, logger)
+
+	a2aConfig := a2a.DefaultA2AConfig()
+	a2aConfig.Authentication.Required = false
+
+	router := gin.New()
+	router.Use(logging.RequestIDMiddleware())
+	router.Use(logging.Middleware(logger))
+	handlers.NewJSONRPCHandlers(agentService, services.NewExecutionCoordinator(agentService, executionService, logger), logger, a2aConfig).RegisterJSONRPCRoutes(router)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "execute-agent",
+		"id":      1,
+		"params":  map[string]interface{}{"agent_id": "request-id-agent", "input": "hello"},
+	})
+	request := httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body))
+	request.Header.Set(logging.RequestIDHeader, "req-abc123")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "req-abc123", recorder.Header().Get(logging.RequestIDHeader))
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Nil(t, response["error"])
+	result := response["result"].(map[string]interface{})
+	assert.Equal(t, "req-abc123", result["request_id"])
+	executionID := result["execution_id"].(string)
+
+	execution, err := executionService.GetExecution(executionID)
+	require.NoError(t, err)
+	assert.Equal(t, "req-abc123", execution.Context["request_id"])
+
+	// Execution service logs carry the request ID alongside the execution ID
+	completed := logs.FilterMessage("agent execution completed successfully").All()
+	require.NotEmpty(t, completed)
+	assert.Equal(t, "req-abc123", fieldValue(completed[0], "request_id"))
+	assert.Equal(t, executionID, fieldValue(completed[0], "execution_id"))
+
+	// The request log line is correlated with the execution it started
+	requestLogs := logs.FilterMessage("HTTP Request").All()
+	require.Len(t, requestLogs, 1)
+	assert.Equal(t, "req-abc123", fieldValue(requestLogs[0], "request_id"))
+	assert.Equal(t, executionID, fieldValue(requestLogs[0], "execution_id"))
+}
+
+func TestRequestIDMiddleware_GeneratesID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logging.RequestIDMiddleware())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, logging.RequestIDFromContext(c.Request.Context()))
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	generated := recorder.Header().Get(logging.RequestIDHeader)
+	assert.NotEmpty(t, generated)
+	assert.Equal(t, generated, recorder.Body.String())
+
+	// IDs with unsafe characters are replaced rather than echoed into logs and process environments
+	request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	request.Header.Set(logging.RequestIDHeader, "bad id\nwith newline")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.NotEqual(t, "bad id\nwith newline", recorder.Header().Get(logging.RequestIDHeader))
+	assert.NotEmpty(t, recorder.Header().Get(logging.RequestIDHeader))
+}
+
+func TestRequestIDPropagation_AgentProcess(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	script := filepath.Join(t.TempDir(), "print-request-id.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nprintf '%s' \"$"+agents.RequestIDEnvVar+"\"\n"), 0755))
+
+	config := requestIDAgentConfig("process-agent", script)
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(config))
+	executionService := services.NewExecutionService(agentService, logger)
+
+	ctx := logging.ContextWithRequestID(context.Background(), "req-process-1")
+	execution, err := executionService.ExecuteAgent(ctx, agents.NewGenericAgent(config, logger), "")
+	require.NoError(t, err)
+
+	result, err := executionService.GetExecutionResult(execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "req-process-1", result.Output)
+
+	// Both the agent and the execution service log the same request and execution IDs
+	completed := logs.FilterMessage("agent execution completed successfully").All()
+	require.Len(t, completed, 2)
+	for _, entry := range completed {
+		assert.Equal(t, "req-process-1", fieldValue(entry, "request_id"))
+		assert.Equal(t, execution.ID, fieldValue(entry, "execution_id"))
+	}
+}
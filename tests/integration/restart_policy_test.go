@@ -0,0 +1,171 @@
+package integration
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// crashingPersistentAgent registers a persistent agent whose process exits right away while its
+// flag file exists and otherwise runs the JSON-RPC test agent; it returns the flag file
+func crashingPersistentAgent(t *testing.T, id string, startRetries int) (*models.AgentConfiguration, string) {
+	flag := filepath.Join(t.TempDir(), "crash")
+	require.NoError(t, os.WriteFile(flag, nil, 0644))
+
+	config := scriptAgent(t, id, models.ReadOnlyAccessType,
+		"if [ -e '"+flag+"' ]; then echo crashing >&2; exit 3; fi\nexec '"+jsonrpcAgentBinary(t)+"'\n")
+	config.Mode = models.PersistentMode
+	config.InputPattern = models.JsonRpcPattern
+	config.OutputPattern = models.JsonRpcPatternOut
+	config.StartRetries = startRetries
+	config.StartSecs = 1
+	t.Cleanup(func() { agents.StopPersistentProcess(id) })
+	return config, flag
+}
+
+// processStatusOf decodes the process status of an agent status response
+func processStatusOf(t *testing.T, body []byte) (string, *models.ProcessStatus) {
+	var status struct {
+		Status  string                `json:"status"`
+		Process *models.ProcessStatus `json:"process"`
+	}
+	require.NoError(t, json.Unmarshal(body, &status), string(body))
+	require.NotNil(t, status.Process, string(body))
+	return status.Status, status.Process
+}
+
+func TestRestartPolicyBacksOffThenEntersFatal(t *testing.T) {
+	config, _ := crashingPersistentAgent(t, "restart-crasher", 2)
+	router, _ := newExecuteRouter(t, config)
+
+	events := make(chan models.ProcessStateEvent, 10)
+	agents.AddProcessStateHook(func(event models.ProcessStateEvent) {
+		if event.AgentID == "restart-crasher" {
+			events <- event
+		}
+	})
+
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/agents/restart-crasher/start", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	// The first failed start backs off before the process is restarted
+	backoff := <-events
+	assert.Equal(t, models.ProcessStateEventType, backoff.Type)
+	assert.Equal(t, models.ProcessBackoff, backoff.Status.State)
+	assert.Equal(t, 1, backoff.Status.ConsecutiveFailures)
+	require.NotNil(t, backoff.Status.BackoffUntil)
+	assert.WithinDuration(t, time.Now().Add(time.Second), *backoff.Status.BackoffUntil, time.Second)
+
+	// The restart fails too, which exhausts the start retries
+	fatal := <-events
+	assert.Equal(t, models.ProcessFatal, fatal.Status.State)
+	assert.Equal(t, 2, fatal.Status.ConsecutiveFailures)
+	assert.Nil(t, fatal.Status.BackoffUntil)
+
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents/restart-crasher/status", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	state, process := processStatusOf(t, recorder.Body.Bytes())
+	assert.Equal(t, "error", state)
+	assert.Equal(t, models.ProcessFatal, process.State)
+	assert.Equal(t, 2, process.ConsecutiveFailures)
+	assert.Equal(t, 1, process.Restarts)
+	assert.Nil(t, process.StartedAt)
+
+	// Executions fail without starting the process again
+	recorder = postExecute(router, "restart-crasher", map[string]interface{}{"input": "hello"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, types.FailureStatus, result.Status)
+	assert.Contains(t, result.Error, "fatal state after 2 failed starts")
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected process state event %+v", event)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestRestartPolicyManualStartResetsFailures(t *testing.T) {
+	config, flag := crashingPersistentAgent(t, "restart-recovered", 1)
+	router, _ := newExecuteRouter(t, config)
+
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/agents/restart-recovered/start", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Eventually(t, func() bool {
+		status, ok := agents.PersistentProcessStatus("restart-recovered")
+		return ok && status.State == models.ProcessFatal
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Once the cause is fixed, an explicit start clears the failed starts
+	require.NoError(t, os.Remove(flag))
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/restart-recovered/start", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var started models.ProcessStatus
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &started))
+	assert.Equal(t, models.ProcessStarting, started.State)
+	assert.Equal(t, 0, started.ConsecutiveFailures)
+	assert.NotZero(t, started.PID)
+	assert.Equal(t, 1, started.Restarts)
+	require.NotNil(t, started.StartedAt)
+
+	recorder = postExecute(router, "restart-recovered", map[string]interface{}{"input": "hello"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "hello")
+
+	require.Eventually(t, func() bool {
+		status, ok := agents.PersistentProcessStatus("restart-recovered")
+		return ok && status.State == models.ProcessRunning
+	}, 5*time.Second, 20*time.Millisecond)
+	recorder = requestJSON(router, http.MethodGet, "/api/v1/agents/restart-recovered/status", nil)
+	state, process := processStatusOf(t, recorder.Body.Bytes())
+	assert.Equal(t, "idle", state)
+	assert.Equal(t, 0, process.ConsecutiveFailures)
+	assert.Equal(t, started.PID, process.PID)
+	require.NotNil(t, process.StartedAt)
+	assert.True(t, started.StartedAt.Equal(*process.StartedAt))
+}
+
+func TestRestartPolicyStartRejectsNonPersistentAgents(t *testing.T) {
+	agent := scriptAgent(t, "restart-task", models.ReadOnlyAccessType, "cat\n")
+	router, _ := newExecuteRouter(t, agent)
+
+	recorder := requestJSON(router, http.MethodPost, "/api/v1/agents/restart-task/start", nil)
+	assert.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+	recorder = requestJSON(router, http.MethodPost, "/api/v1/agents/missing/start", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code, recorder.Body.String())
+}
+
+func TestRestartPolicyFatalWebhook(t *testing.T) {
+	received := make(chan models.ProcessStateEvent, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer hook-token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		var event models.ProcessStateEvent
+		assert.NoError(t, json.Unmarshal(body, &event))
+		received <- event
+	}))
+	defer server.Close()
+
+	notifier := services.NewProcessEventNotifier(server.URL, "hook-token", zap.NewNop())
+	notifier.Notify(models.ProcessStateEvent{Type: models.ProcessStateEventType, AgentID: "a", Status: models.ProcessStatus{State: models.ProcessBackoff}})
+	notifier.Notify(models.ProcessStateEvent{Type: models.ProcessStateEventType, AgentID: "a", Status: models.ProcessStatus{State: models.ProcessFatal, ConsecutiveFailures: 3}})
+
+	// Only entering the fatal state is delivered
+	require.Len(t, received, 1)
+	event := <-received
+	assert.Equal(t, models.ProcessFatal, event.Status.State)
+	assert.Equal(t, 3, event.Status.ConsecutiveFailures)
+}
@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newDriftScheduler returns a scheduler whose fires are timed with a clock running skew ahead of
+// the system clock the cron scheduler fires on, and the warnings it logs
+func newDriftScheduler(t *testing.T, skew time.Duration) (*services.SchedulerService, *services.MetricsCollector, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	logger := zap.New(core)
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(scriptAgent(t, "drift-agent", models.ReadOnlyAccessType, "echo ok\n")))
+	executionService := services.NewExecutionService(agentService, logger)
+
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	t.Cleanup(scheduler.Stop)
+	scheduler.SetClock(func() time.Time { return time.Now().Add(skew) })
+	scheduler.SetDriftDetection(time.Second, time.Minute)
+	metrics := services.NewMetricsCollector(logger)
+	scheduler.SetMetricsCollector(metrics)
+	return scheduler, metrics, logs
+}
+
+func TestScheduleDriftRecordedPerFire(t *testing.T) {
+	scheduler, metrics, logs := newDriftScheduler(t, 1500*time.Millisecond)
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "drift-task", Name: "drift-task", AgentID: "drift-agent", CronExpression: "* * * * * *", Enabled: true,
+	}))
+
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = scheduler.GetTaskHistory("drift-task", 10)
+		return len(history) >= 2
+	}, 10*time.Second, 50*time.Millisecond)
+	require.NoError(t, scheduler.PauseTask("drift-task"))
+
+	// Every scheduled run records the second it was planned for and how late it fired
+	for _, run := range history {
+		assert.Equal(t, types.TaskTriggerTypeScheduled, run.TriggerType)
+		require.NotNil(t, run.PlannedTime)
+		assert.Zero(t, run.PlannedTime.Nanosecond(), "cron plans fires on whole seconds")
+		assert.InDelta(t, 1500, run.DriftMs, 400)
+	}
+	assert.Equal(t, history[0].PlannedTime.Add(time.Second), *history[1].PlannedTime)
+
+	drift := scheduler.ScheduleDrift("drift-task")
+	require.NotNil(t, drift)
+	assert.InDelta(t, 1500, drift.LastDriftMs, 400)
+	assert.GreaterOrEqual(t, drift.MaxDriftMs, drift.LastDriftMs)
+	assert.GreaterOrEqual(t, drift.Fires, int64(2))
+	assert.Equal(t, int(drift.Fires), drift.WindowFires)
+	assert.Zero(t, drift.MissedFires)
+
+	// Fires past the warning threshold are logged
+	late := logs.FilterMessage("scheduled task fired late").All()
+	require.NotEmpty(t, late)
+	assert.Equal(t, "drift-task", fieldValue(late[0], "task_id"))
+
+	// The drift histogram counts every fire, all of them between 1 and 5 seconds late
+	histogram := metrics.GetScheduleDrift()["drift-task"]
+	assert.Equal(t, drift.Fires, histogram.Count)
+	for i, bound := range services.ScheduleDriftBuckets {
+		if bound < 1 {
+			assert.Zero(t, histogram.Buckets[i], bound)
+		} else if bound >= 5 {
+			assert.Equal(t, histogram.Count, histogram.Buckets[i], bound)
+		}
+	}
+	assert.InDelta(t, 1.5*float64(histogram.Count), histogram.SumSeconds, 0.4*float64(histogram.Count))
+
+	// GET /tasks/:id shows the last and rolling maximum drift
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handlers.NewScheduledTaskHandlers(scheduler, zap.NewNop()).RegisterScheduledTaskRoutes(router)
+	recorder := requestJSON(router, http.MethodGet, "/tasks/drift-task", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		ScheduleDrift models.ScheduleDrift `json:"schedule_drift"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, drift.LastDriftMs, response.ScheduleDrift.LastDriftMs)
+	assert.Equal(t, drift.MaxDriftMs, response.ScheduleDrift.MaxDriftMs)
+}
+
+func TestScheduleDriftDetectsMissedFire(t *testing.T) {
+	scheduler, metrics, logs := newDriftScheduler(t, 0)
+	bus := services.NewEventBus(zap.NewNop())
+	scheduler.SetEventBus(bus)
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{Types: []string{models.EventTaskMissedFire}})
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "yearly-task", Name: "yearly-task", AgentID: "drift-agent", CronExpression: "0 0 1 1 *", Enabled: true,
+	}))
+	next, err := scheduler.GetNextRun("yearly-task")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+
+	// The clock jumps past the planned fire and its tolerance without the fire happening
+	skew := time.Until(*next) + 2*time.Minute
+	scheduler.SetClock(func() time.Time { return time.Now().Add(skew) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	event, err := subscription.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "yearly-task", event.TaskID)
+	assert.Equal(t, "drift-agent", event.AgentID)
+	missed, ok := event.Data.(*models.MissedFire)
+	require.True(t, ok)
+	assert.True(t, next.Equal(missed.PlannedTime))
+	assert.Equal(t, time.Minute.Milliseconds(), missed.ToleranceMs)
+
+	// The fire is reported once
+	time.Sleep(1500 * time.Millisecond)
+	drift := scheduler.ScheduleDrift("yearly-task")
+	require.NotNil(t, drift)
+	assert.Equal(t, int64(1), drift.MissedFires)
+	require.NotNil(t, drift.LastMissedAt)
+	assert.True(t, next.Equal(*drift.LastMissedAt))
+	assert.Zero(t, drift.Fires)
+	assert.Equal(t, int64(1), metrics.GetScheduleDrift()["yearly-task"].MissedFires)
+	assert.Len(t, logs.FilterMessage("scheduled task missed a fire").All(), 1)
+}
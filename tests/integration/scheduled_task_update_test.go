@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestScheduledTaskUpdateAppliesToNextFire(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(scriptAgent(t, "echo-agent", models.ReadOnlyAccessType, "cat\n")))
+	executionService := services.NewExecutionService(agentService, zap.NewNop())
+	scheduler := services.NewSchedulerService(agentService, executionService, zap.NewNop())
+	t.Cleanup(scheduler.Stop)
+
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "echo-task", Name: "echo-task", AgentID: "echo-agent", CronExpression: "* * * * * *", Enabled: true,
+		InputParameters: map[string]interface{}{"mode": "old"},
+	}))
+
+	// firedWith reports whether a run of the task got input holding param
+	firedWith := func(param string) bool {
+		executions, _ := executionService.ListExecutions("echo-agent")
+		for _, execution := range executions {
+			if execution.TaskID == "echo-task" && strings.Contains(execution.Input, param) {
+				return true
+			}
+		}
+		return false
+	}
+	require.Eventually(t, func() bool { return firedWith("mode=old") }, 10*time.Second, 20*time.Millisecond)
+
+	// Replace the task with new parameters but the same cron expression
+	current, err := scheduler.GetTask("echo-task")
+	require.NoError(t, err)
+	updated := *current
+	updated.InputParameters = map[string]interface{}{"mode": "new"}
+	require.NoError(t, scheduler.UpdateTask(&updated))
+	require.Eventually(t, func() bool { return firedWith("mode=new") }, 10*time.Second, 20*time.Millisecond)
+
+	// Once paused, the task no longer fires
+	require.NoError(t, scheduler.PauseTask("echo-task"))
+	time.Sleep(1500 * time.Millisecond)
+	before, err := executionService.ListExecutions("echo-agent")
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+	after, err := executionService.ListExecutions("echo-agent")
+	require.NoError(t, err)
+	assert.Len(t, after, len(before))
+}
+
+func TestScheduledTaskUpdateDuringRunIsKept(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(scriptAgent(t, "slow-agent", models.ReadOnlyAccessType, "sleep 1\ncat\n")))
+	executionService := services.NewExecutionService(agentService, zap.NewNop())
+	scheduler := services.NewSchedulerService(agentService, executionService, zap.NewNop())
+	t.Cleanup(scheduler.Stop)
+
+	// Yearly, so only the manual fire below runs the task
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "slow-task", Name: "slow-task", AgentID: "slow-agent", CronExpression: "0 0 0 1 1 *", Enabled: true,
+		InputParameters: map[string]interface{}{"mode": "old"},
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.FireTask("slow-task")
+	}()
+
+	// Replace the task while its run is in flight
+	require.Eventually(t, func() bool {
+		executions, _ := executionService.ListExecutions("slow-agent")
+		return len(executions) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	current, err := scheduler.GetTask("slow-task")
+	require.NoError(t, err)
+	updated := *current
+	updated.InputParameters = map[string]interface{}{"mode": "new"}
+	require.NoError(t, scheduler.UpdateTask(&updated))
+	<-done
+
+	// The finished run records its bookkeeping without reverting the update
+	stored, err := scheduler.GetTask("slow-task")
+	require.NoError(t, err)
+	assert.Equal(t, "new", stored.InputParameters["mode"])
+	assert.NotNil(t, stored.LastScheduledRun)
+	assert.NotNil(t, stored.LastExecution)
+}
@@ -0,0 +1,114 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSchedulerShutdownCancelsRunsInProgress(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(scriptAgent(t, "slow-agent", models.ReadOnlyAccessType, "sleep 30\n")))
+	executionService := services.NewExecutionService(agentService, zap.NewNop())
+	scheduler := services.NewSchedulerService(agentService, executionService, zap.NewNop())
+	t.Cleanup(scheduler.Stop)
+
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "slow-task", Name: "slow-task", AgentID: "slow-agent", CronExpression: "* * * * * *", Enabled: true,
+	}))
+
+	// Wait for a fire to start the agent
+	var running *models.AgentExecution
+	require.Eventually(t, func() bool {
+		active, _ := executionService.GetActiveExecutions()
+		for _, execution := range active {
+			if execution.TaskID == "slow-task" && execution.State == models.RunningState {
+				running = execution
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// Shutdown returns once the run was cancelled, long before the agent would have finished
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	started := time.Now()
+	require.NoError(t, scheduler.Shutdown(ctx))
+	assert.Less(t, time.Since(started), 10*time.Second)
+	assert.False(t, scheduler.IsRunning())
+
+	execution, err := executionService.GetExecution(running.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, models.RunningState, execution.State)
+	require.NotNil(t, execution.EndTime)
+	assert.Less(t, execution.EndTime.Sub(execution.StartTime), 10*time.Second)
+
+	// No fire happens afterwards
+	history, err := scheduler.GetTaskHistory("slow-task", 100)
+	require.NoError(t, err)
+	time.Sleep(2500 * time.Millisecond)
+	after, err := scheduler.GetTaskHistory("slow-task", 100)
+	require.NoError(t, err)
+	assert.Len(t, after, len(history))
+	executions, err := executionService.ListExecutions("slow-agent")
+	require.NoError(t, err)
+	assert.Len(t, executions, 1)
+
+	// Tasks can be neither scheduled nor executed anymore
+	err = scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "late-task", Name: "late-task", AgentID: "slow-agent", CronExpression: "* * * * * *", Enabled: true,
+	})
+	require.True(t, errors.Is(err, models.ErrSchedulerStopped), err)
+	_, err = scheduler.ExecuteTask(context.Background(), "slow-task")
+	require.True(t, errors.Is(err, models.ErrSchedulerStopped), err)
+	status, code := api.ClassifyError(err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, api.CodeSchedulerStopped, code)
+}
+
+func TestSchedulerShutdownGivesUpAtDeadline(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	// The agent ignores the stop signal for a while, so its run outlives the shutdown deadline
+	require.NoError(t, agentService.RegisterAgent(scriptAgent(t, "stubborn-agent", models.ReadOnlyAccessType, "trap '' TERM\nsleep 3\n")))
+	executionService := services.NewExecutionService(agentService, zap.NewNop())
+	scheduler := services.NewSchedulerService(agentService, executionService, zap.NewNop())
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "stubborn-task", Name: "stubborn-task", AgentID: "stubborn-agent", CronExpression: "0 0 1 1 *", Enabled: true,
+	}))
+
+	// A run executed on demand is cancelled by the shutdown too, not by its caller going away
+	callerCtx, cancelCaller := context.WithCancel(context.Background())
+	executed := make(chan error, 1)
+	go func() {
+		_, err := scheduler.ExecuteTask(callerCtx, "stubborn-task")
+		executed <- err
+	}()
+	require.Eventually(t, func() bool {
+		active, _ := executionService.GetActiveExecutions()
+		return len(active) == 1 && active[0].State == models.RunningState
+	}, 10*time.Second, 20*time.Millisecond)
+	cancelCaller()
+	time.Sleep(200 * time.Millisecond)
+	active, _ := executionService.GetActiveExecutions()
+	require.Len(t, active, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, scheduler.Shutdown(ctx), context.DeadlineExceeded)
+	select {
+	case err := <-executed:
+		assert.Error(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("the run did not return after the shutdown")
+	}
+}
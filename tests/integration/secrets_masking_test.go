@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// secretsFixture serves the REST routes behind the audit middleware over an agent holding secrets
+type secretsFixture struct {
+	router      *gin.Engine
+	coordinator *services.ExecutionCoordinator
+	executions  *services.ExecutionService
+	agents      *services.AgentService
+	auditPath   string
+}
+
+// newSecretsFixture registers the "secretive" agent, which prints its API_TOKEN and DB_DSN, and
+// serves the REST routes with revealing secrets allowed or not, for the holders of revealTokens
+func newSecretsFixture(t *testing.T, allowReveal bool, revealTokens ...string) *secretsFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := services.NewAuditLog(auditPath, 1<<20, 3, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+
+	agentService := services.NewAgentService(logger)
+	agent := scriptAgent(t, "secretive", models.ReadOnlyAccessType, "echo \"$API_TOKEN $DB_DSN $REGION\"\n")
+	agent.Envs = map[string]string{"API_TOKEN": "tok-123", "DB_DSN": "postgres://user:pw@db", "REGION": "eu"}
+	agent.SensitiveEnvKeys = []string{"API_TOKEN", "DB_DSN"}
+	require.NoError(t, agentService.RegisterAgent(agent))
+
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	t.Cleanup(schedulerService.Stop)
+
+	router := gin.New()
+	router.Use(middleware.Audit(auditLog, logger))
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		SchedulerService:     schedulerService,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		AuditLog:             auditLog,
+		StateService:         services.NewStateService(agentService, agentService, schedulerService, logger),
+		Logger:               logger,
+		AllowSecretReveal:    allowReveal,
+		SecretRevealTokens:   revealTokens,
+	})
+	return &secretsFixture{router: router, coordinator: coordinator, executions: executionService, agents: agentService, auditPath: auditPath}
+}
+
+// envsOf decodes the envs of an agent configuration in a response body
+func envsOf(t *testing.T, body []byte) map[string]string {
+	var agent models.AgentConfiguration
+	require.NoError(t, json.Unmarshal(body, &agent), string(body))
+	return agent.Envs
+}
+
+var maskedSecrets = map[string]string{"API_TOKEN": models.MaskedValue, "DB_DSN": models.MaskedValue, "REGION": "eu"}
+
+func TestSecretMaskingInAgentResponses(t *testing.T) {
+	f := newSecretsFixture(t, false)
+
+	recorder := requestJSON(f.router, http.MethodGet, "/api/v1/agents/secretive", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, maskedSecrets, envsOf(t, recorder.Body.Bytes()))
+	assert.NotContains(t, recorder.Body.String(), "tok-123")
+
+	recorder = requestJSON(f.router, http.MethodGet, "/api/v1/agents", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var list struct {
+		Agents []models.AgentConfiguration `json:"agents"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list.Agents, 1)
+	assert.Equal(t, maskedSecrets, list.Agents[0].Envs)
+
+	recorder = requestJSON(f.router, http.MethodGet, "/api/v1/export", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var doc models.StateDocument
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &doc))
+	require.Len(t, doc.Agents, 1)
+	assert.Equal(t, maskedSecrets, doc.Agents[0].Envs)
+	assert.NotContains(t, recorder.Body.String(), "postgres://")
+
+	// Names that look secret are masked without being listed
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents", map[string]interface{}{
+		"id": "guessed", "name": "Guessed", "agent_type": "test-type", "executable_path": "/bin/echo",
+		"mode": "task", "input_pattern": "stdin", "output_pattern": "stdout", "access_type": "read-only",
+		"max_concurrent_executions": 1, "enabled": true,
+		"envs": map[string]string{"OTHER": "plain", "SERVICE_PASSWORD": "hunter2"}, "sensitive_env_keys": []string{"SERVICE_PASSWORD"},
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"OTHER": "plain", "SERVICE_PASSWORD": models.MaskedValue}, envsOf(t, recorder.Body.Bytes()))
+
+	// Executions still see the real values
+	execution, _, err := f.coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: "secretive"})
+	require.NoError(t, err)
+	result, err := f.executions.GetExecutionResult(execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "tok-123 postgres://user:pw@db eu\n", result.Output)
+}
+
+func TestSecretMaskedValuesAreNotStored(t *testing.T) {
+	f := newSecretsFixture(t, false)
+
+	// Registering a configuration read back from the API would replace the secret with the mask
+	recorder := requestJSON(f.router, http.MethodGet, "/api/v1/agents/secretive", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var copied map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &copied))
+	copied["id"] = "copied"
+	recorder = requestJSON(f.router, http.MethodPost, "/api/v1/agents", copied)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"envs.API_TOKEN": models.ValidationInvalid, "envs.DB_DSN": models.ValidationInvalid},
+		fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	// Importing the masked export keeps the current secrets
+	recorder = requestJSON(f.router, http.MethodGet, "/api/v1/export", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	document := recorder.Body.Bytes()
+	recorder = importState(f.router, document, "application/json", "replace")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ImportResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, models.ImportSkipped, importStatuses(&result)["agent/secretive"])
+	agent, err := f.agents.GetAgent("secretive")
+	require.NoError(t, err)
+	assert.Equal(t, "tok-123", agent.Envs["API_TOKEN"])
+
+	// Without a current value to restore, a masked secret cannot be imported
+	require.NoError(t, f.agents.DeleteAgent("secretive"))
+	recorder = importState(f.router, document, "application/json", "merge")
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "holds the masked value")
+}
+
+func TestSecretRevealIsAuditedAndGated(t *testing.T) {
+	f := newSecretsFixture(t, true, "ops-token")
+
+	recorder := requestAs(f.router, "ops-token", http.MethodGet, "/api/v1/agents/secretive?reveal=true", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, map[string]string{"API_TOKEN": "tok-123", "DB_DSN": "postgres://user:pw@db", "REGION": "eu"},
+		envsOf(t, recorder.Body.Bytes()))
+
+	recorder = requestAs(f.router, "ops-token", http.MethodGet, "/api/v1/agents?reveal=true", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "tok-123")
+
+	// Other callers may not reveal, and plain reads are not audited
+	recorder = requestAs(f.router, "other-token", http.MethodGet, "/api/v1/agents/secretive?reveal=true", nil)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "FORBIDDEN", "reveal by other token")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	recorder = requestAs(f.router, "ops-token", http.MethodGet, "/api/v1/agents/secretive", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	entries := readAuditEntries(t, f.auditPath)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "agents.reveal", entries[0].Action)
+	assert.Equal(t, "secretive", entries[0].Target)
+	assert.Equal(t, services.ClientIDForToken("ops-token"), entries[0].Actor)
+	assert.Equal(t, models.AuditOutcomeSuccess, entries[0].Outcome)
+	assert.Equal(t, "agents.reveal", entries[1].Action)
+	assert.Equal(t, services.ClientIDForToken("other-token"), entries[2].Actor)
+	assert.Equal(t, models.AuditOutcomeFailure, entries[2].Outcome)
+}
+
+func TestSecretRevealDisabledByDefault(t *testing.T) {
+	f := newSecretsFixture(t, false)
+
+	recorder := requestAs(f.router, "ops-token", http.MethodGet, "/api/v1/agents/secretive?reveal=true", nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code, recorder.Body.String())
+	assert.NotContains(t, recorder.Body.String(), "tok-123")
+
+	recorder = requestAs(f.router, "ops-token", http.MethodGet, "/api/v1/agents/secretive?reveal=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,219 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// serverMonitorFixture serves the REST routes with a server monitor persisting to dataDir
+type serverMonitorFixture struct {
+	router           *gin.Engine
+	monitor          *services.ServerMonitor
+	agentService     *services.AgentService
+	executionService *services.ExecutionService
+	scheduler        *services.SchedulerService
+	metrics          *services.MetricsCollector
+	dataDir          string
+}
+
+func newServerMonitorFixture(t *testing.T, agents ...*models.AgentConfiguration) *serverMonitorFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	f := &serverMonitorFixture{dataDir: filepath.Join(t.TempDir(), "data")}
+	f.agentService = services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, f.agentService.RegisterAgent(agent))
+	}
+	f.executionService = services.NewExecutionService(f.agentService, logger)
+	metricsCollector := services.NewMetricsCollector(logger)
+	f.metrics = metricsCollector
+	f.executionService.SetMetricsCollector(metricsCollector)
+	f.scheduler = services.NewSchedulerService(f.agentService, f.executionService, logger)
+	f.scheduler.SetMetricsCollector(metricsCollector)
+	t.Cleanup(f.scheduler.Stop)
+
+	f.monitor = services.NewServerMonitor(services.NewBuildInfo("1.2.3", "abc123", "2026-01-02T03:04:05Z"),
+		f.agentService, f.scheduler, f.executionService, logger)
+	f.monitor.SetMetricsCollector(metricsCollector)
+	f.monitor.SetPersistenceDirs(f.dataDir)
+
+	f.router = gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:           f.router,
+		ExecutionService: f.executionService,
+		AgentService:     f.agentService,
+		SchedulerService: f.scheduler,
+		MetricsCollector: metricsCollector,
+		ServerMonitor:    f.monitor,
+		Logger:           logger,
+	})
+	return f
+}
+
+// readiness fetches /health/ready
+func (f *serverMonitorFixture) readiness(t *testing.T) (int, services.Readiness) {
+	recorder := requestJSON(f.router, http.MethodGet, "/health/ready", nil)
+	var readiness services.Readiness
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &readiness), recorder.Body.String())
+	return recorder.Code, readiness
+}
+
+// failedChecks returns the names of the failed readiness checks
+func failedChecks(readiness services.Readiness) []string {
+	var failed []string
+	for _, check := range readiness.Checks {
+		if !check.Ready {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+func TestServerInfoEndpoint(t *testing.T) {
+	f := newServerMonitorFixture(t, validationAgent("info-agent", ""))
+	require.NoError(t, f.scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "info-task", Name: "Info task", AgentID: "info-agent", CronExpression: "@every 1h",
+	}))
+	require.NoError(t, f.scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "paused-task", Name: "Paused task", AgentID: "info-agent", CronExpression: "@every 1h",
+	}))
+	require.NoError(t, f.scheduler.PauseTask("paused-task"))
+
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	info, err := supervisorctl.NewClient(server.URL).GetServerInfo(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, "abc123", info.Commit)
+	assert.Equal(t, "2026-01-02T03:04:05Z", info.BuildDate)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.WithinDuration(t, time.Now(), info.StartedAt, time.Minute)
+	assert.GreaterOrEqual(t, info.UptimeSeconds, 0.0)
+	assert.Positive(t, info.Goroutines)
+	assert.Positive(t, info.Memory.HeapAllocBytes)
+	assert.Positive(t, info.Memory.HeapSysBytes)
+	assert.Equal(t, 1, info.Agents)
+	assert.Equal(t, 0, info.ActiveExecutions)
+	assert.Equal(t, 0, info.QueuedExecutions)
+	assert.True(t, info.Scheduler.Running)
+	assert.Equal(t, 2, info.Scheduler.Tasks)
+	assert.Equal(t, 1, info.Scheduler.ActiveTasks)
+	assert.Equal(t, time.Local.String(), info.Scheduler.Timezone)
+}
+
+func TestServerHealthProbes(t *testing.T) {
+	f := newServerMonitorFixture(t)
+
+	recorder := requestJSON(f.router, http.MethodGet, "/health/live", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	code, readiness := f.readiness(t)
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, readiness.Ready)
+	assert.Empty(t, failedChecks(readiness))
+	assert.DirExists(t, f.dataDir)
+
+	// A read-only persistence directory makes the supervisor unready, but still alive
+	require.NoError(t, os.Chmod(f.dataDir, 0555))
+	t.Cleanup(func() { os.Chmod(f.dataDir, 0755) })
+	code, readiness = f.readiness(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, readiness.Ready)
+	assert.Equal(t, []string{"persistence:" + f.dataDir}, failedChecks(readiness))
+	recorder = requestJSON(f.router, http.MethodGet, "/health/live", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	require.NoError(t, os.Chmod(f.dataDir, 0755))
+	code, _ = f.readiness(t)
+	assert.Equal(t, http.StatusOK, code)
+
+	// So does a stopped scheduler
+	f.scheduler.Stop()
+	code, readiness = f.readiness(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"scheduler"}, failedChecks(readiness))
+}
+
+func TestServerReadinessExecutionBacklog(t *testing.T) {
+	agent := scriptAgent(t, "backlog-agent", models.ReadWriteAccessType, "sleep 0.5\n")
+	f := newServerMonitorFixture(t, agent)
+	f.monitor.SetMaxExecutionBacklog(1)
+
+	runtimeAgent, err := f.executionService.Router().CreateAgent(agent)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.executionService.Router().ExecuteAgent(context.Background(), runtimeAgent, "")
+		}()
+	}
+
+	// One execution runs while two wait behind it
+	require.Eventually(t, func() bool { return f.monitor.Info().QueuedExecutions == 2 }, 2*time.Second, 10*time.Millisecond)
+	code, readiness := f.readiness(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"execution_backlog"}, failedChecks(readiness))
+
+	wg.Wait()
+	code, _ = f.readiness(t)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestServerPrometheusMetrics(t *testing.T) {
+	f := newServerMonitorFixture(t, validationAgent("prom-agent", ""))
+	f.metrics.RecordScheduleDrift("nightly", 1500*time.Millisecond)
+	f.metrics.RecordMissedFire("nightly")
+
+	recorder := requestJSON(f.router, http.MethodGet, "/metrics/prometheus", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, services.PrometheusContentType, recorder.Header().Get("Content-Type"))
+
+	body := recorder.Body.String()
+	lines := strings.Split(body, "\n")
+	for _, metric := range []string{
+		`supervisor_build_info{version="1.2.3",commit="abc123",goversion="` + runtime.Version() + `"} 1`,
+		"supervisor_agents 1",
+		"supervisor_scheduler_running 1",
+		`supervisor_executions_total{status="failed"} 0`,
+		"# TYPE supervisor_schedule_drift_seconds histogram",
+		`supervisor_schedule_drift_seconds_bucket{task_id="nightly",le="1"} 0`,
+		`supervisor_schedule_drift_seconds_bucket{task_id="nightly",le="5"} 1`,
+		`supervisor_schedule_drift_seconds_bucket{task_id="nightly",le="+Inf"} 1`,
+		`supervisor_schedule_drift_seconds_sum{task_id="nightly"} 1.5`,
+		`supervisor_schedule_drift_seconds_count{task_id="nightly"} 1`,
+		`supervisor_schedule_missed_fires_total{task_id="nightly"} 1`,
+		"# TYPE go_goroutines gauge",
+		"# TYPE go_gc_duration_seconds summary",
+		"# TYPE go_memstats_alloc_bytes_total counter",
+		"# TYPE process_start_time_seconds gauge",
+	} {
+		assert.Contains(t, lines, metric)
+	}
+	if runtime.GOOS == "linux" {
+		assert.Contains(t, body, "\nprocess_resident_memory_bytes ")
+		assert.Contains(t, body, "\nprocess_open_fds ")
+		assert.Contains(t, body, "\nprocess_cpu_seconds_total ")
+	}
+}
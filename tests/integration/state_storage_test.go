@@ -0,0 +1,144 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/internal/storage"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// sharedStoreOptions returns storage options several supervisor instances can share: the postgres
+// database named by SUPERVISOR_TEST_POSTGRES_DSN when its driver is built in, a sqlite file otherwise
+func sharedStoreOptions(t *testing.T) storage.StoreOptions {
+	if dsn := os.Getenv("SUPERVISOR_TEST_POSTGRES_DSN"); dsn != "" {
+		options := storage.StoreOptions{Backend: storage.StoreBackendPostgres, DSN: dsn}
+		if stores, err := storage.NewStores(options); err == nil {
+			stores.Close()
+			return options
+		}
+	}
+	return storage.StoreOptions{Backend: storage.StoreBackendSQLite, Path: filepath.Join(t.TempDir(), "state.db")}
+}
+
+// storageInstance is one supervisor instance serving the REST routes over its own connection to
+// shared stores
+type storageInstance struct {
+	agents     *services.AgentService
+	executions *services.ExecutionService
+	scheduler  *services.SchedulerService
+	router     *gin.Engine
+}
+
+// newStorageInstance opens the stores described by options and wires the services of an instance
+func newStorageInstance(t *testing.T, options storage.StoreOptions) *storageInstance {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	stores, err := storage.NewStores(options)
+	require.NoError(t, err)
+	t.Cleanup(func() { stores.Close() })
+
+	agentService := services.NewAgentService(logger)
+	agentService.SetAgentStore(stores.Agents)
+	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetExecutionStore(stores.Executions)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	schedulerService.SetTaskStore(stores.Tasks)
+	t.Cleanup(schedulerService.Stop)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     schedulerService,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	return &storageInstance{agents: agentService, executions: executionService, scheduler: schedulerService, router: router}
+}
+
+func TestStateStorageSharedAcrossInstances(t *testing.T) {
+	options := sharedStoreOptions(t)
+	first := newStorageInstance(t, options)
+	second := newStorageInstance(t, options)
+
+	// Both instances register the same agent at once; the store lets exactly one of them win
+	agentID := fmt.Sprintf("shared-agent-%d", time.Now().UnixNano())
+	agent := scriptAgent(t, agentID, models.ReadOnlyAccessType, "echo \"stored $(cat)\"\n")
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, instance := range []*storageInstance{first, second} {
+		wg.Add(1)
+		go func(i int, instance *storageInstance) {
+			defer wg.Done()
+			config := *agent
+			errs[i] = instance.agents.RegisterAgent(&config)
+		}(i, instance)
+	}
+	wg.Wait()
+	if errs[0] == nil {
+		assert.ErrorIs(t, errs[1], models.ErrAgentConflict)
+	} else {
+		assert.ErrorIs(t, errs[0], models.ErrAgentConflict)
+		assert.NoError(t, errs[1])
+	}
+
+	// An execution run by the first instance is visible to the second one
+	recorder := postExecute(first.router, agentID, map[string]interface{}{"input": "hello"})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	executions, err := first.executions.ListExecutions(agentID)
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	executionID := executions[0].ID
+
+	execution, err := second.executions.GetExecution(executionID)
+	require.NoError(t, err)
+	assert.Equal(t, types.CompletedState, execution.State)
+	executions, err = second.executions.QueryExecutions(services.ExecutionFilter{AgentID: agentID})
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	assert.Equal(t, executionID, executions[0].ID)
+	result, err := second.executions.GetExecutionResult(executionID)
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, "stored hello")
+}
+
+func TestStateStorageReloadsTasksAfterRestart(t *testing.T) {
+	options := sharedStoreOptions(t)
+	instance := newStorageInstance(t, options)
+
+	agentID := fmt.Sprintf("restart-agent-%d", time.Now().UnixNano())
+	require.NoError(t, instance.agents.RegisterAgent(scriptAgent(t, agentID, models.ReadOnlyAccessType, "echo ok\n")))
+	taskID := "restart-task-" + agentID
+	require.NoError(t, instance.scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: taskID, Name: "Restart Task", AgentID: agentID, CronExpression: "@every 1h", Enabled: true, Active: true,
+	}))
+
+	// A restarted supervisor finds the agent and schedules the stored task again
+	restarted := newStorageInstance(t, options)
+	_, err := restarted.agents.GetAgent(agentID)
+	require.NoError(t, err)
+	loaded, err := restarted.scheduler.LoadTasks()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, loaded, 1)
+
+	next, err := restarted.scheduler.GetNextRun(taskID)
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.True(t, next.After(time.Now()))
+}
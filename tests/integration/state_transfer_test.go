@@ -0,0 +1,298 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// stateFixture is a supervisor serving the export and import routes
+type stateFixture struct {
+	router    *gin.Engine
+	agents    *services.AgentService
+	scheduler *services.SchedulerService
+	pipelines *services.PipelineService
+	history   *models.InMemoryExecutionHistoryRepository
+}
+
+// newStateFixture serves the REST routes over a template, two agents (one using the template and
+// holding an env placeholder, one disabled), a pipeline over both, a paused task in its own time
+// zone, a pipeline task and a history record
+func newStateFixture(t *testing.T) *stateFixture {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+	coordinator := services.NewExecutionCoordinator(agentService, executionService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	pipelineService := services.NewPipelineService(agentService, coordinator, logger)
+	schedulerService.SetPipelineService(pipelineService)
+	history := models.NewInMemoryExecutionHistoryRepository()
+	schedulerService.SetHistoryRepository(history)
+
+	stateService := services.NewStateService(agentService, agentService, schedulerService, logger)
+	stateService.SetPipelineService(pipelineService)
+	stateService.SetHistoryRepository(history)
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: coordinator,
+		AgentService:         agentService,
+		AgentTemplateService: agentService,
+		SchedulerService:     schedulerService,
+		PipelineService:      pipelineService,
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		StateService:         stateService,
+		Logger:               logger,
+	})
+
+	base := validationAgent("", "")
+	base.Name = ""
+	base.Envs = map[string]string{"DATABASE_URL": "${DATABASE_URL}"}
+	require.NoError(t, agentService.CreateTemplate(&models.AgentTemplate{Name: "base", Settings: *base}))
+	require.NoError(t, agentService.RegisterAgent(&models.AgentConfiguration{
+		ID: "templated", Name: "Templated", Template: "base", Enabled: true,
+		Envs: map[string]string{"REGION": "eu"},
+	}))
+	require.NoError(t, agentService.RegisterAgent(validationAgent("plain", "")))
+	require.NoError(t, agentService.SetAgentEnabled("plain", false))
+
+	require.NoError(t, pipelineService.CreatePipeline(&models.Pipeline{
+		ID: "chain", Name: "Chain",
+		Steps: []models.PipelineStep{{AgentID: "templated"}, {AgentID: "plain", InputMapping: "{{input}}: {{output}}"}},
+	}))
+
+	require.NoError(t, schedulerService.ScheduleTask(&models.ScheduledTask{
+		ID: "nightly", Name: "Nightly", AgentID: "plain", CronExpression: "0 2 * * *", Timezone: "Europe/Berlin",
+		Enabled: true, InputParameters: map[string]interface{}{"limit": 5}, Labels: map[string]string{"team": "ops"},
+	}))
+	require.NoError(t, schedulerService.PauseTask("nightly"))
+	require.NoError(t, schedulerService.ScheduleTask(&models.ScheduledTask{
+		ID: "hourly", Name: "Hourly", PipelineID: "chain", CronExpression: "@every 1h", Enabled: true,
+	}))
+
+	started := time.Date(2026, 10, 1, 2, 0, 0, 0, time.UTC)
+	require.NoError(t, history.StoreExecutionHistory(&models.ExecutionHistory{
+		ID: "history-1", TaskID: "nightly", ExecutionID: "exec-1", StartTime: started, EndTime: started.Add(time.Second),
+		Status: types.SuccessStatus, Output: "done", TriggerType: types.TaskTriggerTypeScheduled, CreatedAt: started,
+	}))
+
+	return &stateFixture{router, agentService, schedulerService, pipelineService, history}
+}
+
+// wipe removes every task, pipeline, agent, template and history record
+func (f *stateFixture) wipe(t *testing.T) {
+	for _, id := range []string{"nightly", "hourly"} {
+		require.NoError(t, f.scheduler.UnscheduleTask(id))
+		require.NoError(t, f.history.DeleteExecutionHistory(id))
+	}
+	require.NoError(t, f.pipelines.DeletePipeline("chain"))
+	require.NoError(t, f.agents.DeleteAgent("templated"))
+	require.NoError(t, f.agents.DeleteAgent("plain"))
+	require.NoError(t, f.agents.DeleteTemplate("base"))
+}
+
+// exportState returns the exported state with history as a tree without timestamps, for diffing
+func exportState(t *testing.T, router *gin.Engine) map[string]interface{} {
+	recorder := requestJSON(router, http.MethodGet, "/api/v1/export?include_history=true", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var state map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+	return withoutTimestamps(state).(map[string]interface{})
+}
+
+// withoutTimestamps drops the fields recording when an item was exported, created, updated or next runs
+func withoutTimestamps(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{"exported_at", "created_at", "updated_at", "next_execution"} {
+			delete(v, key)
+		}
+		for key, item := range v {
+			v[key] = withoutTimestamps(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withoutTimestamps(item)
+		}
+	}
+	return value
+}
+
+// importState posts a state document in mode and returns the response
+func importState(router *gin.Engine, document []byte, contentType, mode string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/import?mode="+mode, bytes.NewReader(document))
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// importStatuses returns the import status of each item by scope/id
+func importStatuses(result *models.ImportResult) map[string]models.ImportStatus {
+	statuses := make(map[string]models.ImportStatus, len(result.Results))
+	for _, item := range result.Results {
+		statuses[string(item.Scope)+"/"+item.ID] = item.Status
+	}
+	return statuses
+}
+
+func TestStateExportImportRoundTrip(t *testing.T) {
+	fixture := newStateFixture(t)
+	before := exportState(t, fixture.router)
+	require.Len(t, before["history"], 1)
+
+	server := httptest.NewServer(fixture.router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	// supervisorctl export > backup.yaml
+	backup, err := client.Export(context.Background(), supervisorctl.ExportOptions{IncludeHistory: true})
+	require.NoError(t, err)
+	assert.Contains(t, string(backup), "version: 1")
+	assert.Contains(t, string(backup), "${DATABASE_URL}", "env placeholders export as placeholders")
+	backupPath := filepath.Join(t.TempDir(), "backup.yaml")
+	require.NoError(t, os.WriteFile(backupPath, backup, 0600))
+
+	fixture.wipe(t)
+	agents, err := fixture.agents.ListAgents()
+	require.NoError(t, err)
+	assert.Empty(t, agents)
+
+	// supervisorctl import -f backup.yaml --mode merge
+	result, err := client.ImportFile(context.Background(), backupPath, supervisorctl.ImportMerge)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.Created, "template, 2 agents, pipeline, 2 tasks and a history record")
+	assert.Zero(t, result.Failed)
+
+	assert.Equal(t, before, exportState(t, fixture.router))
+
+	nightly, err := fixture.scheduler.GetTask("nightly")
+	require.NoError(t, err)
+	assert.False(t, nightly.Active, "the task is restored paused")
+	plain, err := fixture.agents.GetAgent("plain")
+	require.NoError(t, err)
+	assert.False(t, plain.Enabled)
+	templated, err := fixture.agents.GetAgent("templated")
+	require.NoError(t, err)
+	assert.Equal(t, "${DATABASE_URL}", templated.Envs["DATABASE_URL"], "placeholders are never resolved")
+	assert.Equal(t, "/bin/echo", templated.ExecutablePath, "the template is merged in again")
+
+	// Importing the same document again changes nothing
+	result, err = client.ImportFile(context.Background(), backupPath, supervisorctl.ImportMerge)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.Skipped)
+	assert.Zero(t, result.Created+result.Updated+result.Conflicts+result.Failed)
+}
+
+func TestStateImportMergeAndReplace(t *testing.T) {
+	fixture := newStateFixture(t)
+	recorder := requestJSON(fixture.router, http.MethodGet, "/api/v1/export", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var doc models.StateDocument
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &doc))
+	assert.Empty(t, doc.History, "history is only exported on request")
+
+	// Rename an agent, drop the pipeline task and add a task
+	for _, agent := range doc.Agents {
+		if agent.ID == "plain" {
+			agent.Name = "Renamed"
+		}
+	}
+	var tasks []*models.ScheduledTask
+	for _, task := range doc.Tasks {
+		if task.ID != "hourly" {
+			tasks = append(tasks, task)
+		}
+	}
+	doc.Tasks = append(tasks, &models.ScheduledTask{ID: "weekly", Name: "Weekly", AgentID: "templated", CronExpression: "0 3 * * 1", Active: true})
+	document, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	recorder = importState(fixture.router, document, "application/json", "merge")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ImportResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	statuses := importStatuses(&result)
+	assert.Equal(t, models.ImportConflict, statuses["agent/plain"])
+	assert.Equal(t, models.ImportSkipped, statuses["agent/templated"])
+	assert.Equal(t, models.ImportCreated, statuses["task/weekly"])
+	assert.NotContains(t, statuses, "task/hourly", "merge mode never removes")
+	plain, err := fixture.agents.GetAgent("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "Validation Agent", plain.Name, "conflicting items are left alone")
+
+	recorder = importState(fixture.router, document, "application/json", "replace")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	result = models.ImportResult{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	statuses = importStatuses(&result)
+	assert.Equal(t, models.ImportUpdated, statuses["agent/plain"])
+	assert.Equal(t, models.ImportRemoved, statuses["task/hourly"])
+	assert.Equal(t, models.ImportSkipped, statuses["task/weekly"])
+	assert.Zero(t, result.Failed)
+	plain, err = fixture.agents.GetAgent("plain")
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", plain.Name)
+	_, err = fixture.scheduler.GetTask("hourly")
+	assert.ErrorIs(t, err, models.ErrTaskNotFound)
+}
+
+func TestStateImportValidationAbortsWithoutApplying(t *testing.T) {
+	fixture := newStateFixture(t)
+	recorder := requestJSON(fixture.router, http.MethodGet, "/api/v1/export?format=yaml", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "yaml")
+	document, err := services.DecodeStateDocument(recorder.Body.Bytes(), services.StateFormatYAML)
+	require.NoError(t, err)
+
+	// A new agent, one removed task and a task with an invalid schedule
+	document.Agents = append(document.Agents, validationAgent("newcomer", ""))
+	document.Tasks = []*models.ScheduledTask{
+		{ID: "nightly", Name: "Nightly", AgentID: "plain", CronExpression: "not a schedule"},
+		{ID: "orphan", Name: "Orphan", AgentID: "missing", CronExpression: "@daily"},
+	}
+	data, err := services.EncodeStateDocument(document, services.StateFormatYAML)
+	require.NoError(t, err)
+
+	recorder = importState(fixture.router, data, "application/yaml", "replace")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "invalid document")
+	assert.Contains(t, recorder.Body.String(), "task nightly")
+	assert.Contains(t, recorder.Body.String(), "unknown agent missing")
+
+	_, err = fixture.agents.GetAgent("newcomer")
+	assert.ErrorIs(t, err, models.ErrAgentNotFound, "nothing is applied")
+	_, err = fixture.scheduler.GetTask("hourly")
+	assert.NoError(t, err, "nothing is removed")
+
+	// Unsupported versions and modes are rejected up front
+	recorder = importState(fixture.router, []byte(`{"version": 2}`), "application/json", "merge")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "unsupported version")
+	assert.True(t, strings.Contains(recorder.Body.String(), "version 2"))
+
+	recorder = importState(fixture.router, []byte(`{"version": 1}`), "application/json", "overwrite")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "INVALID_REQUEST", "unknown mode")
+}
@@ -0,0 +1,231 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newBulkTaskRouter serves the task routes over five active tasks: three of agent-a, two of agent-b
+func newBulkTaskRouter(t *testing.T) (*gin.Engine, *services.SchedulerService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(validationAgent("agent-a", "")))
+	require.NoError(t, agentService.RegisterAgent(validationAgent("agent-b", "")))
+	executionService := services.NewExecutionService(agentService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+
+	tasks := []struct{ id, agentID string }{
+		{"nightly-a1", "agent-a"},
+		{"nightly-a2", "agent-a"},
+		{"hourly-a3", "agent-a"},
+		{"nightly-b1", "agent-b"},
+		{"hourly-b2", "agent-b"},
+	}
+	for _, task := range tasks {
+		require.NoError(t, schedulerService.ScheduleTask(&models.ScheduledTask{
+			ID: task.id, Name: task.id, AgentID: task.agentID, CronExpression: "@every 1h", Enabled: true,
+		}))
+	}
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:           router,
+		ExecutionService: executionService,
+		SchedulerService: schedulerService,
+		MetricsCollector: services.NewMetricsCollector(logger),
+		Logger:           logger,
+	})
+	return router, schedulerService
+}
+
+// postJSON sends body to path and returns the response
+func postJSON(router *gin.Engine, path string, body map[string]interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func postBulk(t *testing.T, router *gin.Engine, body map[string]interface{}) models.BatchOperationResult {
+	recorder := postJSON(router, "/tasks/bulk", body)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result models.BatchOperationResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return result
+}
+
+// activeTasks returns whether each task is active
+func activeTasks(t *testing.T, schedulerService *services.SchedulerService) map[string]bool {
+	tasks, err := schedulerService.ListScheduledTasks()
+	require.NoError(t, err)
+	active := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		active[task.ID] = task.Active
+	}
+	return active
+}
+
+func TestBulkPauseByAgent(t *testing.T) {
+	router, schedulerService := newBulkTaskRouter(t)
+
+	result := postBulk(t, router, map[string]interface{}{
+		"action":   "pause",
+		"selector": map[string]interface{}{"agent_id": "agent-a"},
+	})
+
+	assert.Equal(t, models.TaskActionPause, result.Action)
+	assert.Equal(t, 3, result.Matched)
+	assert.Equal(t, 3, result.Succeeded)
+	assert.Zero(t, result.Skipped)
+	assert.Zero(t, result.Failed)
+	require.Len(t, result.Results, 3)
+	for i, taskID := range []string{"hourly-a3", "nightly-a1", "nightly-a2"} {
+		assert.Equal(t, taskID, result.Results[i].Target)
+		assert.Equal(t, models.TaskActionPause, result.Results[i].Action)
+		assert.Equal(t, models.OperationApplied, result.Results[i].Status)
+		assert.Equal(t, "active", result.Results[i].CurrentState)
+		assert.Equal(t, "paused", result.Results[i].ExpectedState)
+	}
+
+	assert.Equal(t, map[string]bool{
+		"nightly-a1": false,
+		"nightly-a2": false,
+		"hourly-a3":  false,
+		"nightly-b1": true,
+		"hourly-b2":  true,
+	}, activeTasks(t, schedulerService))
+
+	// Pausing again skips every task instead of failing
+	result = postBulk(t, router, map[string]interface{}{
+		"action":   "pause",
+		"selector": map[string]interface{}{"agent_id": "agent-a"},
+	})
+	assert.Equal(t, 3, result.Skipped)
+	assert.Zero(t, result.Succeeded)
+}
+
+func TestBulkResumeByPattern(t *testing.T) {
+	router, schedulerService := newBulkTaskRouter(t)
+	require.NoError(t, schedulerService.PauseTask("nightly-a1"))
+	require.NoError(t, schedulerService.PauseTask("nightly-b1"))
+
+	result := postBulk(t, router, map[string]interface{}{
+		"action":   "resume",
+		"selector": map[string]interface{}{"name_pattern": "nightly-*"},
+	})
+
+	assert.Equal(t, 3, result.Matched)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Skipped)
+	statuses := make(map[string]models.OperationStatus)
+	for _, item := range result.Results {
+		statuses[item.Target] = item.Status
+	}
+	assert.Equal(t, map[string]models.OperationStatus{
+		"nightly-a1": models.OperationApplied,
+		"nightly-a2": models.OperationSkipped,
+		"nightly-b1": models.OperationApplied,
+	}, statuses)
+
+	// Agent and pattern combine
+	result = postBulk(t, router, map[string]interface{}{
+		"action":   "pause",
+		"selector": map[string]interface{}{"agent_id": "agent-b", "name_pattern": "hourly-*"},
+	})
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, "hourly-b2", result.Results[0].Target)
+}
+
+func TestBulkDeleteByIDsReportsPartialFailures(t *testing.T) {
+	router, schedulerService := newBulkTaskRouter(t)
+
+	// Dry runs plan without deleting
+	recorder := postJSON(router, "/tasks/bulk?dry_run=true", map[string]interface{}{
+		"action":   "delete",
+		"selector": map[string]interface{}{"task_ids": []string{"nightly-a1", "missing", "hourly-b2"}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var planned models.BatchOperationResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &planned))
+	assert.True(t, planned.DryRun)
+	assert.Len(t, activeTasks(t, schedulerService), 5)
+
+	// A malformed dry_run is rejected rather than taken as a real delete
+	recorder = postJSON(router, "/tasks/bulk?dry_run=yes", map[string]interface{}{
+		"action":   "delete",
+		"selector": map[string]interface{}{"task_ids": []string{"nightly-a1"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Len(t, activeTasks(t, schedulerService), 5)
+
+	// An unknown task fails on its own; the listed tasks around it are still deleted
+	result := postBulk(t, router, map[string]interface{}{
+		"action":   "delete",
+		"selector": map[string]interface{}{"task_ids": []string{"nightly-a1", "missing", "hourly-b2", "nightly-a1"}},
+	})
+	assert.Equal(t, 3, result.Matched)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Results, 3)
+	assert.Equal(t, "missing", result.Results[1].Target)
+	assert.Equal(t, models.OperationFailed, result.Results[1].Status)
+	assert.Contains(t, result.Results[1].Message, "not found")
+
+	remaining := activeTasks(t, schedulerService)
+	assert.Len(t, remaining, 3)
+	assert.NotContains(t, remaining, "nightly-a1")
+	assert.NotContains(t, remaining, "hourly-b2")
+}
+
+func TestBulkTaskOperationValidation(t *testing.T) {
+	router, _ := newBulkTaskRouter(t)
+
+	for name, body := range map[string]map[string]interface{}{
+		"unknown action": {"action": "restart", "selector": map[string]interface{}{"agent_id": "agent-a"}},
+		"empty selector": {"action": "pause", "selector": map[string]interface{}{}},
+		"ids combined":   {"action": "pause", "selector": map[string]interface{}{"agent_id": "agent-a", "task_ids": []string{"nightly-a1"}}},
+		"bad pattern":    {"action": "pause", "selector": map[string]interface{}{"name_pattern": "nightly-["}},
+	} {
+		recorder := postJSON(router, "/tasks/bulk", body)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, name)
+		assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", name)
+	}
+}
+
+func TestBulkTasksClient(t *testing.T) {
+	router, schedulerService := newBulkTaskRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := supervisorctl.NewClient(server.URL)
+
+	result, err := client.BulkTasks(context.Background(), supervisorctl.TaskActionPause,
+		supervisorctl.TaskSelector{AgentID: "agent-b"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, "applied", result.Results[0].Status)
+	assert.False(t, activeTasks(t, schedulerService)["nightly-b1"])
+
+	_, err = client.BulkTasks(context.Background(), supervisorctl.TaskActionPause, supervisorctl.TaskSelector{}, false)
+	var apiErr *supervisorctl.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newDryRunRouter serves the task routes over a scheduler with one active and one paused task
+func newDryRunRouter(t *testing.T) (*gin.Engine, *services.AgentService, *services.SchedulerService) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(validationAgent("dry-run-agent", "")))
+	executionService := services.NewExecutionService(agentService, logger)
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+
+	for _, id := range []string{"active-task", "paused-task"} {
+		require.NoError(t, schedulerService.ScheduleTask(&models.ScheduledTask{
+			ID: id, Name: id, AgentID: "dry-run-agent", CronExpression: "@every 1h", Enabled: true,
+		}))
+	}
+	require.NoError(t, schedulerService.PauseTask("paused-task"))
+
+	router := gin.New()
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:           router,
+		ExecutionService: executionService,
+		SchedulerService: schedulerService,
+		MetricsCollector: services.NewMetricsCollector(logger),
+		Logger:           logger,
+	})
+	return router, agentService, schedulerService
+}
+
+func planTaskOperation(t *testing.T, router *gin.Engine, method, path string) models.OperationResult {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path+"?dry_run=true", nil))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var result models.OperationResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	return result
+}
+
+func TestTaskDryRunPlansWithoutChangingState(t *testing.T) {
+	router, _, schedulerService := newDryRunRouter(t)
+
+	tests := []struct {
+		method, path string
+		action       models.TaskAction
+		current      string
+		expected     string
+		status       models.OperationStatus
+	}{
+		{http.MethodPost, "/tasks/active-task/pause", models.TaskActionPause, "active", "paused", models.OperationPending},
+		{http.MethodPost, "/tasks/paused-task/pause", models.TaskActionPause, "paused", "paused", models.OperationSkipped},
+		{http.MethodPost, "/tasks/paused-task/resume", models.TaskActionResume, "paused", "active", models.OperationPending},
+		{http.MethodPost, "/tasks/active-task/resume", models.TaskActionResume, "active", "active", models.OperationSkipped},
+		{http.MethodPost, "/tasks/active-task/execute", models.TaskActionExecute, "active", "active", models.OperationPending},
+		{http.MethodDelete, "/tasks/active-task", models.TaskActionDelete, "active", "removed", models.OperationPending},
+	}
+
+	for _, tt := range tests {
+		result := planTaskOperation(t, router, tt.method, tt.path)
+		assert.Equal(t, tt.action, result.Action, tt.path)
+		assert.Equal(t, tt.current, result.CurrentState, tt.path)
+		assert.Equal(t, tt.expected, result.ExpectedState, tt.path)
+		assert.Equal(t, tt.status, result.Status, tt.path)
+	}
+
+	// Nothing was actually paused, resumed, run or deleted
+	active, err := schedulerService.GetTask("active-task")
+	require.NoError(t, err)
+	assert.True(t, active.Active)
+	assert.Nil(t, active.LastExecution)
+
+	paused, err := schedulerService.GetTask("paused-task")
+	require.NoError(t, err)
+	assert.False(t, paused.Active)
+}
+
+func TestTaskDryRunReportsFailedPreconditions(t *testing.T) {
+	router, agentService, _ := newDryRunRouter(t)
+
+	result := planTaskOperation(t, router, http.MethodPost, "/tasks/missing-task/pause")
+	assert.Equal(t, models.OperationFailed, result.Status)
+	assert.Contains(t, result.Message, "not found")
+
+	// Resuming or running a task whose agent is gone fails the dependency check
+	require.NoError(t, agentService.DeleteAgent("dry-run-agent"))
+	result = planTaskOperation(t, router, http.MethodPost, "/tasks/paused-task/resume")
+	assert.Equal(t, models.OperationFailed, result.Status)
+	assert.Contains(t, result.Message, "agent not found")
+
+	result = planTaskOperation(t, router, http.MethodPost, "/tasks/active-task/execute")
+	assert.Equal(t, models.OperationFailed, result.Status)
+}
+
+func TestTaskDryRunRejectsMalformedFlag(t *testing.T) {
+	router, _, schedulerService := newDryRunRouter(t)
+
+	tests := []struct{ method, path string }{
+		{http.MethodPost, "/tasks/active-task/pause?dry_run=yes"},
+		{http.MethodPost, "/tasks/active-task/execute?dry_run=1x"},
+		{http.MethodDelete, "/tasks/active-task?dry_run=maybe"},
+		{http.MethodPost, "/tasks/paused-task/resume?dry_run=on"},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, tt.path)
+	}
+
+	// The malformed requests were not taken as real ones
+	active, err := schedulerService.GetTask("active-task")
+	require.NoError(t, err)
+	assert.True(t, active.Active)
+	assert.Nil(t, active.LastExecution)
+	paused, err := schedulerService.GetTask("paused-task")
+	require.NoError(t, err)
+	assert.False(t, paused.Active)
+}
@@ -0,0 +1,174 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fanOutAgents returns three region agents echoing their input, of which region-c fails, and an
+// agent the region pattern does not match
+func fanOutAgents(t *testing.T) []*models.AgentConfiguration {
+	return []*models.AgentConfiguration{
+		scriptAgent(t, "region-a", models.ReadOnlyAccessType, "echo \"a($(cat))\"\n"),
+		scriptAgent(t, "region-b", models.ReadOnlyAccessType, "echo \"b($(cat))\"\n"),
+		scriptAgent(t, "region-c", models.ReadOnlyAccessType, "echo unreachable >&2\nexit 1\n"),
+		scriptAgent(t, "global", models.ReadOnlyAccessType, "echo global\n"),
+	}
+}
+
+// fanOutTask returns a fan-out task over the region agents with the given success policy
+func fanOutTask(id string, policy models.FanOutSuccessPolicy, minSuccesses int) *models.ScheduledTask {
+	return &models.ScheduledTask{
+		ID:             id,
+		Name:           id,
+		AgentSelector:  &models.AgentSelector{Pattern: "prefix:region-"},
+		MaxParallel:    2,
+		SuccessPolicy:  policy,
+		MinSuccesses:   minSuccesses,
+		CronExpression: "0 0 1 1 *",
+		Enabled:        true,
+		InputTemplate:  "sync",
+	}
+}
+
+func TestFanOutTaskSuccessPolicies(t *testing.T) {
+	f := newPipelineFixture(t, fanOutAgents(t)...)
+
+	tests := []struct {
+		policy       models.FanOutSuccessPolicy
+		minSuccesses int
+		status       types.ExecutionStatus
+	}{
+		{models.FanOutSuccessAll, 0, types.FailureStatus},
+		{models.FanOutSuccessAny, 0, types.SuccessStatus},
+		{models.FanOutSuccessAtLeast, 2, types.SuccessStatus},
+		{models.FanOutSuccessAtLeast, 3, types.FailureStatus},
+	}
+	for _, tt := range tests {
+		task := fanOutTask("fan-out-"+string(tt.policy), tt.policy, tt.minSuccesses)
+		require.NoError(t, f.scheduler.ScheduleTask(task))
+
+		result, err := f.scheduler.ExecuteTask(context.Background(), task.ID)
+		require.NoError(t, err)
+		require.NotNil(t, result.FanOut)
+		assert.Equal(t, tt.status, result.Status, "%s %d", tt.policy, tt.minSuccesses)
+
+		fanOut := result.FanOut
+		assert.Equal(t, 3, fanOut.Matched)
+		assert.Equal(t, 2, fanOut.Succeeded)
+		assert.Equal(t, 1, fanOut.Failed)
+		require.Len(t, fanOut.Results, 3)
+		for i, agentID := range []string{"region-a", "region-b", "region-c"} {
+			child := fanOut.Results[i]
+			assert.Equal(t, agentID, child.AgentID)
+			stored, err := f.executionService.GetExecutionResult(child.ExecutionID)
+			require.NoError(t, err, agentID)
+			assert.Equal(t, child.Status, stored.Status)
+		}
+		assert.Equal(t, "a(sync)\n", fanOut.Results[0].Output)
+		assert.Equal(t, types.FailureStatus, fanOut.Results[2].Status)
+		if tt.status == types.FailureStatus {
+			assert.Contains(t, result.Error, "2 of 3 agents succeeded")
+		}
+
+		require.NoError(t, f.scheduler.UnscheduleTask(task.ID))
+	}
+}
+
+func TestFanOutTaskRecordsChildHistory(t *testing.T) {
+	f := newPipelineFixture(t, fanOutAgents(t)...)
+
+	task := fanOutTask("fan-out-history", models.FanOutSuccessAny, 0)
+	task.AgentSelector = &models.AgentSelector{AgentIDs: []string{"region-c", "region-a", "region-b"}}
+	task.CronExpression = "@every 1s"
+	require.NoError(t, f.scheduler.ScheduleTask(task))
+	defer f.scheduler.UnscheduleTask(task.ID)
+
+	var parent *models.ExecutionHistory
+	var history []*models.ExecutionHistory
+	require.Eventually(t, func() bool {
+		history, _ = f.scheduler.GetTaskHistory(task.ID, 0)
+		for _, entry := range history {
+			if entry.FanOut != nil {
+				parent = entry
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, types.SuccessStatus, parent.Status)
+	assert.Empty(t, parent.ParentID)
+	assert.Equal(t, 3, parent.FanOut.Matched)
+
+	children := map[string]*models.ExecutionHistory{}
+	for _, entry := range history {
+		if entry.ParentID == parent.ID {
+			children[entry.AgentID] = entry
+		}
+	}
+	require.Len(t, children, 3)
+	assert.Equal(t, types.SuccessStatus, children["region-a"].Status)
+	assert.Equal(t, "b(sync)\n", children["region-b"].Output)
+	assert.Equal(t, types.FailureStatus, children["region-c"].Status)
+	for agentID, child := range children {
+		assert.Equal(t, task.ID, child.TaskID, agentID)
+		assert.NotEmpty(t, child.ExecutionID, agentID)
+	}
+}
+
+func TestFanOutTaskExecuteEndpoint(t *testing.T) {
+	f := newPipelineFixture(t, fanOutAgents(t)...)
+
+	recorder := f.request(http.MethodPost, "/tasks", map[string]interface{}{
+		"name":            "regional-sync",
+		"agent_selector":  map[string]interface{}{"pattern": "region-*"},
+		"success_policy":  "at_least",
+		"min_successes":   2,
+		"cron_expression": "0 0 1 1 *",
+		"enabled":         true,
+		"input_template":  "sync",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	recorder = f.request(http.MethodPost, "/tasks/"+created.TaskID+"/execute", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var response struct {
+		Result struct {
+			Status string               `json:"status"`
+			FanOut *models.FanOutResult `json:"fan_out"`
+		} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, string(types.SuccessStatus), response.Result.Status)
+	require.NotNil(t, response.Result.FanOut)
+	assert.Equal(t, models.FanOutSuccessAtLeast, response.Result.FanOut.SuccessPolicy)
+	assert.Equal(t, 3, response.Result.FanOut.Matched)
+	assert.Equal(t, 2, response.Result.FanOut.Succeeded)
+}
+
+func TestFanOutTaskRejectsInvalidSelector(t *testing.T) {
+	f := newPipelineFixture(t, fanOutAgents(t)...)
+
+	task := fanOutTask("fan-out-conflict", models.FanOutSuccessAll, 0)
+	task.AgentID = "global"
+	assert.ErrorContains(t, f.scheduler.ScheduleTask(task), "AgentSelector")
+
+	task = fanOutTask("fan-out-threshold", models.FanOutSuccessAtLeast, 0)
+	assert.ErrorContains(t, f.scheduler.ScheduleTask(task), "MinSuccesses")
+
+	task = fanOutTask("fan-out-policy", "most", 0)
+	assert.ErrorContains(t, f.scheduler.ScheduleTask(task), "SuccessPolicy")
+}
@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskInputTemplatePreview(t *testing.T) {
+	router, _ := newBulkTaskRouter(t)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+	ctx := context.Background()
+
+	taskID, err := client.CreateTask(ctx, supervisorctl.TaskSpec{
+		Name:            "daily-report",
+		AgentID:         "agent-a",
+		CronExpression:  "0 6 * * *",
+		InputParameters: map[string]interface{}{"region": "eu-west"},
+		InputTemplate:   "report {{task_id}} for {{yesterday}} in {{params.region}}",
+	})
+	require.NoError(t, err)
+
+	input, err := client.PreviewTaskInput(ctx, taskID)
+	require.NoError(t, err)
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	assert.Equal(t, "report "+taskID+" for "+yesterday+" in eu-west", input)
+
+	recorder := requestJSON(router, http.MethodGet, "/tasks/"+taskID, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var task map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+	assert.Equal(t, "report {{task_id}} for {{yesterday}} in {{params.region}}", task["input_template"])
+
+	require.NoError(t, client.UpdateTask(ctx, taskID, supervisorctl.TaskSpec{
+		Name:           "daily-report",
+		AgentID:        "agent-a",
+		CronExpression: "0 6 * * *",
+		InputTemplate:  "{{upper agent_id}}",
+	}))
+	input, err = client.PreviewTaskInput(ctx, taskID)
+	require.NoError(t, err)
+	assert.Equal(t, "AGENT-A", input)
+}
+
+func TestTaskInputTemplateRejected(t *testing.T) {
+	router, scheduler := newBulkTaskRouter(t)
+
+	recorder := requestJSON(router, http.MethodPost, "/tasks", map[string]interface{}{
+		"name":            "bad-template",
+		"agent_id":        "agent-a",
+		"cron_expression": "0 6 * * *",
+		"input_template":  "report for {{tomorrow}}",
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "undefined variable")
+
+	recorder = requestJSON(router, http.MethodPost, "/tasks/missing/preview-input", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// A parameter the template needs but the task lacks fails the preview and the run
+	recorder = requestJSON(router, http.MethodPost, "/tasks", map[string]interface{}{
+		"name":            "missing-param",
+		"agent_id":        "agent-a",
+		"cron_expression": "0 6 * * *",
+		"input_template":  "report for {{params.region}}",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	recorder = requestJSON(router, http.MethodPost, "/tasks/"+created.TaskID+"/preview-input", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "missing parameter")
+
+	_, err := scheduler.ExecuteTask(context.Background(), created.TaskID)
+	assert.ErrorContains(t, err, "region")
+}
@@ -0,0 +1,191 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskScheduleEndpoint(t *testing.T) {
+	router, scheduler := newBulkTaskRouter(t)
+	zone := time.FixedZone("UTC-5", -5*60*60)
+	scheduler.SetLocation(zone)
+
+	recorder := requestJSON(router, http.MethodPost, "/tasks", map[string]interface{}{
+		"name":            "daily-report",
+		"agent_id":        "agent-a",
+		"cron_expression": "0 6 * * *",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created struct {
+		TaskID string `json:"task_id"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	recorder = requestJSON(router, http.MethodGet, "/tasks/"+created.TaskID+"/schedule?count=3", nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var schedule handlers.TaskScheduleResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &schedule))
+	assert.Equal(t, "UTC-5", schedule.Timezone)
+	assert.True(t, schedule.Active)
+	require.Len(t, schedule.NextRuns, 3)
+	for i, run := range schedule.NextRuns {
+		// 06:00 at UTC-5 is 11:00 UTC, one day apart
+		assert.Equal(t, 6, run.Time.In(zone).Hour())
+		assert.Equal(t, 11, run.UTC.Hour())
+		assert.Equal(t, time.UTC, run.UTC.Location())
+		assert.True(t, run.Time.Equal(run.UTC))
+		if i > 0 {
+			assert.Equal(t, 24*time.Hour, run.UTC.Sub(schedule.NextRuns[i-1].UTC))
+		}
+	}
+	assert.True(t, schedule.NextRuns[0].UTC.After(time.Now()))
+	assert.True(t, schedule.NextRuns[0].UTC.Before(time.Now().Add(24*time.Hour)))
+
+	// The task listing and details carry the next run
+	recorder = requestJSON(router, http.MethodGet, "/tasks/"+created.TaskID, nil)
+	var task struct {
+		NextRun *time.Time `json:"next_run"`
+		LastRun *time.Time `json:"last_run"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+	require.NotNil(t, task.NextRun)
+	assert.True(t, schedule.NextRuns[0].UTC.Equal(*task.NextRun))
+	assert.Nil(t, task.LastRun)
+
+	// Without ?count the endpoint returns five runs; paused tasks have none
+	recorder = requestJSON(router, http.MethodGet, "/tasks/"+created.TaskID+"/schedule", nil)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &schedule))
+	assert.Len(t, schedule.NextRuns, handlers.DefaultScheduleCount)
+
+	require.NoError(t, scheduler.PauseTask(created.TaskID))
+	recorder = requestJSON(router, http.MethodGet, "/tasks/"+created.TaskID+"/schedule", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &schedule))
+	assert.False(t, schedule.Active)
+	assert.Empty(t, schedule.NextRuns)
+
+	recorder = requestJSON(router, http.MethodGet, "/tasks/"+created.TaskID+"/schedule?count=0", nil)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "zero count")
+
+	recorder = requestJSON(router, http.MethodGet, "/tasks/missing/schedule", nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestTaskScheduleListTable(t *testing.T) {
+	router, scheduler := newBulkTaskRouter(t)
+	require.NoError(t, scheduler.PauseTask("hourly-b2"))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	tasks, err := client.ListTasks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tasks, 5)
+
+	var table bytes.Buffer
+	require.NoError(t, supervisorctl.WriteTaskTable(&table, tasks, time.UTC))
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	require.Len(t, lines, 6)
+	assert.Contains(t, lines[0], "NEXT RUN")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if fields[0] == "hourly-b2" {
+			assert.Contains(t, line, "paused")
+			assert.Equal(t, "-", fields[len(fields)-1])
+			continue
+		}
+		assert.Equal(t, "UTC", fields[len(fields)-1], line)
+	}
+
+	schedule, err := client.GetTaskSchedule(context.Background(), "nightly-a1", 2)
+	require.NoError(t, err)
+	require.Len(t, schedule.NextRuns, 2)
+	assert.Equal(t, time.Hour, schedule.NextRuns[1].UTC.Sub(schedule.NextRuns[0].UTC))
+}
+
+func TestTaskScheduleTimezone(t *testing.T) {
+	router, scheduler := newBulkTaskRouter(t)
+	scheduler.SetLocation(time.UTC)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	spec := supervisorctl.TaskSpec{
+		Name:           "tokyo-report",
+		AgentID:        "agent-a",
+		CronExpression: "0 6 * * *",
+		Timezone:       "Asia/Tokyo",
+		Enabled:        true,
+	}
+	taskID, err := client.CreateTask(context.Background(), spec)
+	require.NoError(t, err)
+
+	// 06:00 in Tokyo is 21:00 UTC the day before
+	schedule, err := client.GetTaskSchedule(context.Background(), taskID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", schedule.Timezone)
+	require.Len(t, schedule.NextRuns, 2)
+	for _, run := range schedule.NextRuns {
+		assert.Contains(t, run.Time.Format(time.RFC3339), "T06:00:00+09:00")
+		assert.Equal(t, 21, run.UTC.Hour())
+	}
+
+	// Moving the task to another zone and time reschedules it
+	spec.Timezone = "America/New_York"
+	spec.CronExpression = "30 8 * * *"
+	require.NoError(t, client.UpdateTask(context.Background(), taskID, spec))
+	schedule, err = client.GetTaskSchedule(context.Background(), taskID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", schedule.Timezone)
+	require.Len(t, schedule.NextRuns, 1)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	local := schedule.NextRuns[0].UTC.In(newYork)
+	assert.Equal(t, 8, local.Hour())
+	assert.Equal(t, 30, local.Minute())
+
+	tasks, err := client.ListTasks(context.Background())
+	require.NoError(t, err)
+	for _, task := range tasks {
+		if task.ID == taskID {
+			assert.Equal(t, "America/New_York", task.Timezone)
+		}
+	}
+
+	// Unknown zones are rejected on create and update
+	recorder := requestJSON(router, http.MethodPost, "/tasks", map[string]interface{}{
+		"name":            "mars-report",
+		"agent_id":        "agent-a",
+		"cron_expression": "0 6 * * *",
+		"timezone":        "Mars/Olympus_Mons",
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "unknown zone on create")
+
+	recorder = requestJSON(router, http.MethodPut, "/tasks/"+taskID, map[string]interface{}{
+		"name":            "tokyo-report",
+		"agent_id":        "agent-a",
+		"cron_expression": "0 6 * * *",
+		"timezone":        "Mars/Olympus_Mons",
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "unknown zone on update")
+
+	// The rejected update leaves the task as it was
+	task, err := scheduler.GetTask(taskID)
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", task.Timezone)
+	assert.Equal(t, "30 8 * * *", task.CronExpression)
+}
@@ -0,0 +1,306 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/server"
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate is a PEM encoded certificate and key written to a temp dir
+type testCertificate struct {
+	certFile string
+	keyFile  string
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+}
+
+// issueCertificate writes a certificate signed by parent, or a self-signed CA when parent is nil
+func issueCertificate(t *testing.T, dir, name string, serial int64, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	issued := &testCertificate{
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+		cert:     cert,
+		key:      key,
+	}
+	require.NoError(t, os.WriteFile(issued.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(issued.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return issued
+}
+
+// serveTLS serves a health route with tlsConfig the way the supervisor does and returns its address
+func serveTLS(t *testing.T, tlsConfig *tls.Config) string {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "healthy"}) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer := &http.Server{Handler: router, TLSConfig: tlsConfig}
+	go httpServer.ServeTLS(listener, "", "")
+	t.Cleanup(func() { httpServer.Close() })
+
+	return listener.Addr().String()
+}
+
+// tlsClient trusts ca and presents clientCert when set
+func tlsClient(ca *testCertificate, clientCert *testCertificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clientConfig := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		certificate, _ := tls.LoadX509KeyPair(clientCert.certFile, clientCert.keyFile)
+		clientConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig, DisableKeepAlives: true}, Timeout: 5 * time.Second}
+}
+
+func TestTLSServer(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCertificate(t, dir, "ca", 1, nil)
+	serverCert := issueCertificate(t, dir, "server", 2, ca)
+
+	tlsConfig, certificates, err := server.NewTLSConfig(server.TLSOptions{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile})
+	require.NoError(t, err)
+	address := serveTLS(t, tlsConfig)
+
+	// HTTPS works with a client that trusts the CA
+	response, err := tlsClient(ca, nil).Get("https://" + address + "/health")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, big.NewInt(2), response.TLS.PeerCertificates[0].SerialNumber)
+
+	// Plain HTTP is rejected
+	response, err = http.Get("http://" + address + "/health")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	assert.Contains(t, string(body), "HTTPS")
+
+	// A renewed certificate is served after Reload without restarting the listener
+	issueCertificate(t, dir, "server", 3, ca)
+	require.NoError(t, certificates.Reload())
+	response, err = tlsClient(ca, nil).Get("https://" + address + "/health")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, big.NewInt(3), response.TLS.PeerCertificates[0].SerialNumber)
+
+	// A broken file keeps the previous certificate in use
+	require.NoError(t, os.WriteFile(serverCert.certFile, []byte("not a certificate"), 0600))
+	assert.Error(t, certificates.Reload())
+	response, err = tlsClient(ca, nil).Get("https://" + address + "/health")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, big.NewInt(3), response.TLS.PeerCertificates[0].SerialNumber)
+}
+
+func TestTLSServerClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCertificate(t, dir, "ca", 1, nil)
+	serverCert := issueCertificate(t, dir, "server", 2, ca)
+	clientCert := issueCertificate(t, dir, "client", 3, ca)
+
+	tlsConfig, _, err := server.NewTLSConfig(server.TLSOptions{
+		CertFile:     serverCert.certFile,
+		KeyFile:      serverCert.keyFile,
+		ClientCAFile: ca.certFile,
+	})
+	require.NoError(t, err)
+	address := serveTLS(t, tlsConfig)
+
+	response, err := tlsClient(ca, clientCert).Get("https://" + address + "/health")
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	// Clients without a certificate from the CA cannot connect
+	_, err = tlsClient(ca, nil).Get("https://" + address + "/health")
+	assert.Error(t, err)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCertificate(t, dir, "ca", 1, nil)
+	serverCert := issueCertificate(t, dir, "server", 2, ca)
+
+	tests := []struct {
+		name        string
+		options     server.TLSOptions
+		description string
+	}{
+		{"missing files", server.TLSOptions{CertFile: serverCert.certFile}, "requires both cert_file and key_file"},
+		{"unreadable cert", server.TLSOptions{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: serverCert.keyFile}, "missing.crt"},
+		{"mismatched key", server.TLSOptions{CertFile: serverCert.certFile, KeyFile: ca.keyFile}, "failed to load TLS certificate"},
+		{"unreadable client CA", server.TLSOptions{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, ClientCAFile: filepath.Join(dir, "missing-ca.crt")}, "failed to read TLS client CA"},
+		{"client CA without certificates", server.TLSOptions{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, ClientCAFile: serverCert.keyFile}, "contains no PEM certificates"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := server.NewTLSConfig(tt.options)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.description)
+		})
+	}
+}
+
+// newCORSRouter serves one API route and one route outside /api/v1 behind the CORS middleware
+func newCORSRouter(corsConfig middleware.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.NewCORS(corsConfig).Middleware("/api/v1"))
+	router.GET("/api/v1/executions", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"total": 0}) })
+	router.GET("/health", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "healthy"}) })
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, path, origin string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	request.Header.Set("Origin", origin)
+	if method == http.MethodOptions {
+		request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	router := newCORSRouter(middleware.CORSConfig{
+		AllowedOrigins:   []string{"https://console.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	recorder := corsRequest(router, http.MethodGet, "/api/v1/executions", "https://console.example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "https://console.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-ID", recorder.Header().Get("Access-Control-Expose-Headers"))
+
+	// Preflights are answered even though no OPTIONS route exists
+	recorder = corsRequest(router, http.MethodOptions, "/api/v1/agents/any/execute", "https://console.example.com")
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "GET, POST", recorder.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", recorder.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", recorder.Header().Get("Access-Control-Max-Age"))
+
+	// Disallowed origins get no CORS headers
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		recorder = corsRequest(router, method, "/api/v1/executions", "https://evil.example.com")
+		assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"), method)
+		assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Methods"), method)
+		assert.NotEqual(t, http.StatusNoContent, recorder.Code, method)
+	}
+
+	// Routes outside /api/v1 are left alone
+	recorder = corsRequest(router, http.MethodGet, "/health", "https://console.example.com")
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddlewareWildcardAndReload(t *testing.T) {
+	cors := middleware.NewCORS(middleware.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(cors.Middleware("/api/v1"))
+	router.GET("/api/v1/executions", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	recorder := corsRequest(router, http.MethodGet, "/api/v1/executions", "https://anywhere.example.com")
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Origins only the wildcard allows never get credentials, even when they are allowed
+	cors.UpdateConfig(middleware.CORSConfig{AllowedOrigins: []string{"https://console.example.com", "*"}, AllowCredentials: true})
+	recorder = corsRequest(router, http.MethodGet, "/api/v1/executions", "https://evil.example.com")
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"))
+	recorder = corsRequest(router, http.MethodGet, "/api/v1/executions", "https://console.example.com")
+	assert.Equal(t, "https://console.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+
+	// No allowed origins disables CORS
+	cors.UpdateConfig(middleware.CORSConfig{})
+	recorder = corsRequest(router, http.MethodGet, "/api/v1/executions", "https://anywhere.example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestTLSAndCORSConfig(t *testing.T) {
+	load := func(yaml string) (*config.Config, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(yaml), 0600))
+		return config.LoadConfigFile(path)
+	}
+
+	cfg, err := load("port: 8443\n")
+	require.NoError(t, err)
+	assert.False(t, cfg.TLS.Enabled)
+	assert.Empty(t, cfg.CORS.AllowedOrigins)
+	assert.Contains(t, cfg.CORS.AllowedHeaders, "Idempotency-Key")
+
+	cfg, err = load("tls:\n  enabled: true\n  cert_file: /etc/supervisor/tls.crt\n  key_file: /etc/supervisor/tls.key\ncors:\n  allowed_origins: [\"https://console.example.com\"]\n  allow_credentials: true\n")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/supervisor/tls.crt", cfg.TLS.CertFile)
+	assert.Equal(t, []string{"https://console.example.com"}, cfg.CORS.AllowedOrigins)
+	assert.True(t, cfg.CORS.AllowCredentials)
+
+	_, err = load("tls:\n  enabled: true\n  cert_file: /etc/supervisor/tls.crt\n")
+	assert.ErrorContains(t, err, "cert_file and key_file are required")
+
+	_, err = load("cors:\n  allowed_origins: [\"console.example.com\"]\n")
+	assert.ErrorContains(t, err, "cors allowed origin")
+
+	_, err = load("cors:\n  allowed_origins: [\"*\"]\n  allow_credentials: true\n")
+	assert.ErrorContains(t, err, "allow_credentials cannot be combined")
+}
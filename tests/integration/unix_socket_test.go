@@ -0,0 +1,216 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/api/server"
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// socketPath returns a path for a unix socket short enough for the platform's limit, which the
+// test's own temp dir may exceed
+func socketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "sock")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "supervisor.sock")
+}
+
+// newSocketRouter serves the REST API over the agents behind the authorization middleware; only
+// admin-token is known
+func newSocketRouter(t *testing.T, peers *middleware.SocketPeerAuth, agents ...*models.AgentConfiguration) http.Handler {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+	authorization := middleware.AuthorizationConfig{
+		Enabled:     true,
+		Tokens:      map[string]middleware.TokenGrant{"admin-token": {Role: models.RoleAdmin}},
+		SocketPeers: peers,
+	}
+
+	router := gin.New()
+	router.Use(middleware.NewAuthorizer(authorization, handlers.RoutePermissions(), logger).Middleware())
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		MetricsCollector:     services.NewMetricsCollector(logger),
+		Logger:               logger,
+	})
+	return router
+}
+
+// serveUnixSocket serves handler on a new unix socket with the given permissions and returns its path
+func serveUnixSocket(t *testing.T, handler http.Handler, mode os.FileMode) string {
+	path := socketPath(t)
+	listener, err := server.ListenUnix(server.UnixSocketOptions{Path: path, Mode: mode})
+	require.NoError(t, err)
+
+	httpServer := &http.Server{Handler: handler, ConnContext: server.ConnContext}
+	go httpServer.Serve(listener)
+	t.Cleanup(func() { httpServer.Close() })
+	return path
+}
+
+func TestUnixSocketDrivesAgents(t *testing.T) {
+	gated, gates := gatedAgent(t, "socket-gated")
+	persistent, flag := crashingPersistentAgent(t, "socket-persistent", 1)
+	require.NoError(t, os.Remove(flag))
+	router := newSocketRouter(t, &middleware.SocketPeerAuth{Role: models.RoleOperator}, gated, persistent)
+	path := serveUnixSocket(t, router, 0600)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Peer auth lets the client through without a token
+	client := supervisorctl.NewClient("unix://" + path)
+	ctx := context.Background()
+	statuses, err := client.Status(ctx, "socket-gated")
+	require.NoError(t, err)
+	assert.Equal(t, "idle", statuses[0].Status)
+
+	process, err := client.StartAgent(ctx, "socket-persistent")
+	require.NoError(t, err)
+	assert.Equal(t, "starting", process.State)
+	assert.NotZero(t, process.PID)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Execute(ctx, "socket-gated", supervisorctl.ExecuteRequest{Input: "never"})
+		done <- err
+	}()
+	var running supervisorctl.Execution
+	require.Eventually(t, func() bool {
+		executions, err := client.ListExecutions(ctx, "socket-gated")
+		if err != nil || len(executions) == 0 || executions[0].State != "running" {
+			return false
+		}
+		running = executions[0]
+		return true
+	}, 5*time.Second, 20*time.Millisecond)
+
+	stopped, err := client.StopExecution(ctx, running.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", stopped.State)
+	require.NoError(t, <-done)
+	openGate(t, gates, "never")
+
+	// Over TCP the same router still requires a token
+	tcp := httptest.NewServer(router)
+	t.Cleanup(tcp.Close)
+	_, err = supervisorctl.NewClient(tcp.URL).Status(ctx, "socket-gated")
+	assert.ErrorIs(t, err, supervisorctl.ErrUnauthorized)
+}
+
+func TestUnixSocketPeerPermissionDenied(t *testing.T) {
+	agent := scriptAgent(t, "socket-agent", models.ReadOnlyAccessType, "echo ok\n")
+	ctx := context.Background()
+
+	// Peers are granted the viewer role, which may read but not stop executions
+	viewer := serveUnixSocket(t, newSocketRouter(t, &middleware.SocketPeerAuth{Role: models.RoleViewer}, agent), 0)
+	client := supervisorctl.NewClient("unix://" + viewer)
+	_, err := client.Status(ctx, "socket-agent")
+	require.NoError(t, err)
+	_, err = client.StopExecution(ctx, "missing", "")
+	var apiErr *supervisorctl.APIError
+	require.True(t, errors.As(err, &apiErr), err)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, string(models.RoleOperator), apiErr.RequiredRole)
+
+	// Processes of users not allowed need a token
+	other := serveUnixSocket(t, newSocketRouter(t, &middleware.SocketPeerAuth{Role: models.RoleAdmin, AllowedUIDs: []int{os.Getuid() + 1}}, agent), 0)
+	client = supervisorctl.NewClient("unix://" + other)
+	_, err = client.Status(ctx, "socket-agent")
+	assert.ErrorIs(t, err, supervisorctl.ErrUnauthorized)
+	client.SetToken("admin-token")
+	_, err = client.Status(ctx, "socket-agent")
+	assert.NoError(t, err)
+
+	// Without peer auth the socket requires a token like TCP
+	tokens := serveUnixSocket(t, newSocketRouter(t, nil, agent), 0)
+	_, err = supervisorctl.NewClient("unix://"+tokens).Status(ctx, "socket-agent")
+	assert.ErrorIs(t, err, supervisorctl.ErrUnauthorized)
+}
+
+func TestUnixSocketListenReplacesStaleSocket(t *testing.T) {
+	path := socketPath(t)
+
+	// A socket file left behind by a supervisor that crashed
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	listener, err := server.ListenUnix(server.UnixSocketOptions{Path: path})
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, server.DefaultSocketMode, info.Mode().Perm())
+
+	// A socket something listens on, or another kind of file, is left alone
+	_, err = server.ListenUnix(server.UnixSocketOptions{Path: path})
+	assert.ErrorContains(t, err, "in use")
+	require.NoError(t, listener.Close())
+
+	file := filepath.Join(filepath.Dir(path), "regular")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	_, err = server.ListenUnix(server.UnixSocketOptions{Path: file})
+	assert.ErrorContains(t, err, "not a socket")
+}
+
+func TestUnixSocketConfig(t *testing.T) {
+	load := func(yaml string) (*config.Config, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(yaml), 0600))
+		return config.LoadConfigFile(path)
+	}
+
+	cfg, err := load("port: 8080\n")
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Socket.Path)
+	mode, err := cfg.SocketMode()
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), mode)
+
+	// A socket-only supervisor authorizing local users by their peer credentials needs no tokens
+	cfg, err = load("socket:\n  path: /var/run/supervisor.sock\n  mode: \"0600\"\n  disable_tcp: true\n  peer_auth:\n    enabled: true\n    role: operator\n    allowed_uids: [1000]\nauth:\n  enabled: true\n")
+	require.NoError(t, err)
+	assert.True(t, cfg.Socket.DisableTCP)
+	assert.Equal(t, []int{1000}, cfg.Socket.PeerAuth.AllowedUIDs)
+	mode, err = cfg.SocketMode()
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), mode)
+
+	_, err = load("socket:\n  disable_tcp: true\n")
+	assert.ErrorContains(t, err, "socket path is required")
+	_, err = load("socket:\n  path: /tmp/s.sock\n  mode: \"rw\"\n")
+	assert.ErrorContains(t, err, "socket mode must be octal")
+	_, err = load("socket:\n  path: /tmp/s.sock\n  peer_auth:\n    enabled: true\n    role: root\n")
+	assert.ErrorContains(t, err, "unknown role")
+}
@@ -0,0 +1,191 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/api"
+	"github.com/algonius/algonius-supervisor/internal/api/handlers"
+	"github.com/algonius/algonius-supervisor/internal/api/middleware"
+	"github.com/algonius/algonius-supervisor/internal/api/routes"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newUploadRouter serves the REST routes over the given agents with request bodies capped at
+// maxBodyBytes and execute uploads at maxUploadBytes, and returns the directory uploads are spooled to
+func newUploadRouter(t *testing.T, maxBodyBytes, maxUploadBytes int64, agents ...*models.AgentConfiguration) (*gin.Engine, string) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	agentService := services.NewAgentService(logger)
+	for _, agent := range agents {
+		require.NoError(t, agentService.RegisterAgent(agent))
+	}
+	executionService := services.NewExecutionService(agentService, logger)
+
+	uploadDir := t.TempDir()
+	router := gin.New()
+	router.Use(middleware.NewBodyLimit(middleware.BodyLimitConfig{
+		MaxBytes:     maxBodyBytes,
+		ExemptRoutes: []string{handlers.ExecuteUploadRoute},
+	}).Middleware())
+	routes.SetupAPIRoutes(&routes.APIRouteConfig{
+		Router:               router,
+		ExecutionService:     executionService,
+		ExecutionCoordinator: services.NewExecutionCoordinator(agentService, executionService, logger),
+		AgentService:         agentService,
+		SchedulerService:     services.NewSchedulerService(agentService, executionService, logger),
+		Logger:               logger,
+		UploadDir:            uploadDir,
+		MaxUploadBytes:       maxUploadBytes,
+	})
+	return router, uploadDir
+}
+
+// assertPayloadTooLarge checks a response is 413 in the standard error envelope
+func assertPayloadTooLarge(t *testing.T, status int, body []byte) {
+	require.Equal(t, http.StatusRequestEntityTooLarge, status, string(body))
+	var envelope api.ErrorResponse
+	require.NoError(t, json.Unmarshal(body, &envelope))
+	assert.False(t, envelope.Success)
+	assert.Equal(t, api.CodePayloadTooLarge, envelope.Code)
+	assert.Contains(t, envelope.Message, "max size is")
+}
+
+func TestBodyLimitRejectsOversizedJSON(t *testing.T) {
+	agent := scriptAgent(t, "echo-agent", models.ReadOnlyAccessType, "cat\n")
+	router, _ := newUploadRouter(t, 1024, 0, agent)
+
+	oversized, _ := json.Marshal(map[string]string{"input": strings.Repeat("x", 4096)})
+
+	// A Content-Length over the limit is rejected before the body is read
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/agents/echo-agent/execute", bytes.NewReader(oversized)))
+	assertPayloadTooLarge(t, recorder.Code, recorder.Body.Bytes())
+
+	// So is a chunked body, once reading it passes the limit
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/agents/echo-agent/execute", io.MultiReader(bytes.NewReader(oversized)))
+	request.ContentLength = -1
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assertPayloadTooLarge(t, recorder.Code, recorder.Body.Bytes())
+
+	// A chunked body within the limit reaches the handler whole
+	request = httptest.NewRequest(http.MethodPost, "/api/v1/agents/echo-agent/execute", io.MultiReader(strings.NewReader(`{"input":"hello"}`)))
+	request.ContentLength = -1
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, "hello", result.Output)
+}
+
+// randomReader returns size bytes of reproducible random data without holding them in memory
+func randomReader(size int64) io.Reader {
+	return io.LimitReader(rand.NewChaCha8([32]byte{42}), size)
+}
+
+func TestUploadExecuteStreamsLargeFile(t *testing.T) {
+	const size = 100 << 20
+	agent := scriptAgent(t, "hasher", models.ReadOnlyAccessType, "sha256sum \"$1\" | cut -d' ' -f1\n")
+	agent.InputPattern = models.FilePattern
+	agent.InputFileTemplate = "upload.bin"
+	agent.SandboxDir = t.TempDir()
+	agent.Timeout = 120
+
+	// The upload limit applies instead of the much smaller request body limit
+	router, uploadDir := newUploadRouter(t, 1024, 200<<20, agent)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// Sent chunked, so neither side knows the size up front
+	hash := sha256.New()
+	response, err := http.Post(server.URL+"/api/v1/agents/hasher/execute/upload", "application/octet-stream",
+		io.TeeReader(randomReader(size), hash))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	runtime.ReadMemStats(&after)
+	require.Equal(t, http.StatusOK, response.StatusCode, string(body))
+
+	// The agent read exactly the bytes that were sent
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(body, &result))
+	assert.EqualValues(t, models.SuccessStatus, result.Status)
+	assert.Equal(t, hex.EncodeToString(hash.Sum(nil)), strings.TrimSpace(result.Output))
+
+	// Client and server together allocated far less than the upload, which was never buffered
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.Less(t, allocated, uint64(size/4), "allocated %d bytes for a %d byte upload", allocated, size)
+
+	// The spool file is gone once the execution finished
+	entries, err := os.ReadDir(uploadDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestUploadExecuteMultipart(t *testing.T) {
+	agent := scriptAgent(t, "counter", models.ReadOnlyAccessType,
+		"printf '%s %s' \"$(cat)\" \"$(wc -c < \"$SUPERVISOR_INPUT_FILE\" | tr -d ' ')\"\n")
+	router, _ := newUploadRouter(t, 1024, 8192, agent)
+
+	post := func(file []byte, request string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if request != "" {
+			require.NoError(t, writer.WriteField(handlers.UploadRequestPart, request))
+		}
+		if file != nil {
+			part, err := writer.CreateFormFile(handlers.UploadFilePart, "data.bin")
+			require.NoError(t, err)
+			part.Write(file)
+		}
+		require.NoError(t, writer.Close())
+
+		httpRequest := httptest.NewRequest(http.MethodPost, "/api/v1/agents/counter/execute/upload", &body)
+		httpRequest.Header.Set("Content-Type", writer.FormDataContentType())
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httpRequest)
+		return recorder
+	}
+
+	// Agents without the file input pattern get their input as usual and the file's path in the environment
+	recorder := post(bytes.Repeat([]byte("a"), 5000), `{"input":"hello"}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var result models.ExecutionResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(t, "hello 5000", result.Output)
+
+	// Uploads have their own limit
+	recorder = post(bytes.Repeat([]byte("a"), 10000), "")
+	assertPayloadTooLarge(t, recorder.Code, recorder.Body.Bytes())
+
+	recorder = post(nil, `{"input":"hello"}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+
+	recorder = post([]byte("data"), `{"async":true}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+}
@@ -0,0 +1,123 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fieldErrorsOf decodes the field errors listed in the details of an error envelope
+func fieldErrorsOf(t *testing.T, body []byte) map[string]string {
+	var response struct {
+		Details struct {
+			Errors []models.FieldError `json:"errors"`
+		} `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(body, &response), string(body))
+	codes := make(map[string]string)
+	for _, fieldErr := range response.Details.Errors {
+		assert.NotEmpty(t, fieldErr.Message, fieldErr.Field)
+		codes[fieldErr.Field] = fieldErr.Code
+	}
+	return codes
+}
+
+func TestValidationErrorsListEveryAgentProblem(t *testing.T) {
+	f := newDeleteFixture(t)
+
+	// Four problems at once: no name, an unknown access type, a bad mode and a synthetic parameter
+	recorder := requestJSON(f.router, http.MethodPost, "/api/v1/agents", map[string]interface{}{
+		"id": "broken-agent", "agent_type": "synthetic", "access_type": "read-mostly", "mode": "batch",
+		"input_pattern": "stdin", "output_pattern": "stdout", "max_concurrent_executions": 1,
+		"parameters": map[string]string{"failure_rate": "2"},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "invalid agent")
+	assert.Equal(t, map[string]string{
+		"name":                    models.ValidationRequired,
+		"access_type":             models.ValidationInvalid,
+		"mode":                    models.ValidationInvalid,
+		"parameters.failure_rate": models.ValidationOutOfRange,
+	}, fieldErrorsOf(t, recorder.Body.Bytes()))
+
+	// The message still reads as before, joining the problems
+	var envelope struct {
+		Message string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &envelope))
+	assert.Contains(t, envelope.Message, "AgentConfiguration Name cannot be empty")
+	assert.Contains(t, envelope.Message, "AgentConfiguration Mode must be 'task', 'interactive' or 'persistent'")
+}
+
+func TestValidationErrorsOfValidAgentAreEmpty(t *testing.T) {
+	agent := validationAgent("valid-agent", "")
+	errs := agent.ValidateFields()
+	assert.NotNil(t, errs)
+	assert.Empty(t, errs)
+	assert.NoError(t, agent.Validate())
+	assert.NoError(t, errs.Err())
+
+	agent.Name = ""
+	agent.Weight = -1
+	err := agent.Validate()
+	var fieldErrs models.ValidationErrors
+	require.True(t, errors.As(err, &fieldErrs))
+	assert.Len(t, fieldErrs, 2)
+	assert.True(t, fieldErrs.Has("name"))
+	assert.True(t, fieldErrs.Has("weight"))
+
+	// Errors of the legacy string type are still found in the chain
+	var legacy models.ValidationError
+	assert.True(t, errors.As(err, &legacy))
+}
+
+func TestValidationErrorsListEveryTaskProblem(t *testing.T) {
+	f := newDeleteFixture(t, scriptAgent(t, "task-agent", models.ReadOnlyAccessType, "echo ok\n"))
+
+	recorder := requestJSON(f.router, http.MethodPost, "/tasks", map[string]interface{}{
+		"id": "broken-task", "name": "Broken", "agent_id": "missing-agent", "cron_expression": "every minute",
+		"max_retries": -1, "overlap_policy": "sometimes", "enabled": true,
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	assertErrorEnvelope(t, recorder.Body.Bytes(), "VALIDATION_FAILED", "invalid task")
+	assert.Equal(t, map[string]string{
+		"agent_id":        models.ValidationNotFound,
+		"cron_expression": models.ValidationInvalid,
+		"max_retries":     models.ValidationOutOfRange,
+		"overlap_policy":  models.ValidationInvalid,
+	}, fieldErrorsOf(t, recorder.Body.Bytes()))
+}
+
+func TestClientPrintsFieldErrors(t *testing.T) {
+	f := newDeleteFixture(t)
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	_, err := client.AddAgent(context.Background(), supervisorctl.AgentSpec{
+		ID: "broken-agent", AgentType: "synthetic", AccessType: "read-write", Mode: "task",
+		InputPattern: "stdin", OutputPattern: "stdout", MaxConcurrentExecutions: 3, CacheTTLSeconds: 60,
+	})
+	require.Error(t, err)
+	var apiErr *supervisorctl.APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.Len(t, apiErr.Errors, 3)
+
+	var out bytes.Buffer
+	assert.True(t, supervisorctl.PrintFieldErrors(&out, err))
+	assert.Contains(t, out.String(), "FIELD")
+	assert.Regexp(t, `name\s+required\s+AgentConfiguration Name cannot be empty`, out.String())
+	assert.Regexp(t, `max_concurrent_executions\s+conflict`, out.String())
+	assert.Regexp(t, `cache_ttl_seconds\s+conflict`, out.String())
+
+	assert.False(t, supervisorctl.PrintFieldErrors(&out, errors.New("plain failure")))
+}
@@ -0,0 +1,111 @@
+// Command jsonrpcagent is a persistent agent for tests: it answers JSON-RPC calls over stdin and
+// stdout, one message per line, handling each call concurrently.
+//
+// The execute method echoes its input along with the number of executions in flight. Inputs
+// starting with "sleep:<duration>" take that long, "fail" answers with an error, "exit" makes the
+// process exit and "hang" stops it answering anything, pings included. When JSONRPC_AGENT_SPAWN_LOG
+// is set, every start appends the process ID to that file.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type executeResult struct {
+	Echo     string `json:"echo"`
+	InFlight int64  `json:"in_flight"`
+	PID      int    `json:"pid"`
+}
+
+var (
+	writeMutex sync.Mutex
+	inFlight   atomic.Int64
+	hung       atomic.Bool
+)
+
+func main() {
+	if path := os.Getenv("JSONRPC_AGENT_SPAWN_LOG"); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			fmt.Fprintln(file, os.Getpid())
+			file.Close()
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var call request
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			continue
+		}
+		go handle(call)
+	}
+}
+
+// handle answers one call
+func handle(call request) {
+	if hung.Load() {
+		return
+	}
+	switch call.Method {
+	case "ping":
+		respond(call.ID, "pong", nil)
+	case "execute":
+		var input string
+		json.Unmarshal(call.Params, &input)
+		execute(call.ID, input)
+	default:
+		respond(call.ID, nil, map[string]interface{}{"code": -32601, "message": "method not found"})
+	}
+}
+
+// execute runs an execution; it no longer counts as in flight once it answers
+func execute(id json.RawMessage, input string) {
+	running := inFlight.Add(1)
+
+	switch {
+	case input == "fail":
+		inFlight.Add(-1)
+		respond(id, nil, map[string]interface{}{"code": 1, "message": "failed on purpose"})
+		return
+	case input == "exit":
+		os.Exit(3)
+	case input == "hang":
+		hung.Store(true)
+		return
+	case strings.HasPrefix(input, "sleep:"):
+		duration, _ := time.ParseDuration(strings.TrimPrefix(input, "sleep:"))
+		time.Sleep(duration)
+	}
+	inFlight.Add(-1)
+	respond(id, executeResult{Echo: input, InFlight: running, PID: os.Getpid()}, nil)
+}
+
+// respond writes the response to a call
+func respond(id json.RawMessage, result interface{}, rpcErr interface{}) {
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	data, _ := json.Marshal(response)
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	os.Stdout.Write(append(data, '\n'))
+}
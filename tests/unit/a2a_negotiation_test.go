@@ -0,0 +1,38 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/a2a"
+	protocol "github.com/algonius/algonius-supervisor/pkg/a2a"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestA2AProtocolVersionCompatibility(t *testing.T) {
+	config := a2a.DefaultA2AConfig()
+	config.Protocol.SupportedVersions = []string{"0.2.0", "0.3.0"}
+
+	// Patch releases of a supported version are compatible; an empty version means the preferred one
+	for _, version := range []string{"", "0.3.0", "0.3.9", "0.2.1"} {
+		assert.NoError(t, config.CheckProtocolVersion(version), version)
+	}
+	for _, version := range []string{"0.4.0", "1.3.0", "0.3", "v0.3.0", "latest"} {
+		err := config.CheckProtocolVersion(version)
+		a2aErr, ok := protocol.AsA2AError(err)
+		require.True(t, ok, version)
+		assert.Equal(t, protocol.UnsupportedProtocolVersionError, a2aErr.Code)
+		assert.Equal(t, protocol.UnsupportedVersion{Requested: version, Supported: []string{"0.2.0", "0.3.0"}}, a2aErr.Data)
+	}
+}
+
+func TestA2AProtocolVersionConfigValidation(t *testing.T) {
+	config := a2a.DefaultA2AConfig()
+	require.NoError(t, config.Validate())
+
+	config.Protocol.SupportedVersions = []string{"0.2.0"}
+	assert.ErrorContains(t, config.Validate(), "must include protocol.version 0.3.0")
+
+	config.Protocol.SupportedVersions = []string{"0.3.0", "next"}
+	assert.ErrorContains(t, config.Validate(), `got "next"`)
+}
@@ -0,0 +1,69 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutionDeadline_ExpiresLikeTimeout(t *testing.T) {
+	ctx, deadline, cancel := agents.WithExecutionDeadline(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	child, cancelChild := context.WithCancelCause(ctx)
+	defer cancelChild(nil)
+
+	assert.Same(t, deadline, agents.ExecutionDeadlineFromContext(child))
+	at, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, deadline.Deadline(), at)
+
+	select {
+	case <-child.Done():
+	case <-time.After(time.Second):
+		t.Fatal("deadline did not expire")
+	}
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	assert.Equal(t, context.DeadlineExceeded, child.Err())
+	assert.False(t, deadline.Extend(time.Now().Add(time.Minute)), "expired deadlines cannot be extended")
+}
+
+func TestExecutionDeadline_ExtendMovesDeadlineOutward(t *testing.T) {
+	ctx, deadline, cancel := agents.WithExecutionDeadline(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.False(t, deadline.Extend(deadline.Deadline().Add(-time.Millisecond)), "deadlines only move outward")
+	require.True(t, deadline.Extend(deadline.Start().Add(400*time.Millisecond)))
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("extended deadline expired early")
+	case <-time.After(250 * time.Millisecond):
+	}
+	assert.NoError(t, ctx.Err())
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("extended deadline did not expire")
+	}
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestExecutionDeadline_FollowsParentCancellation(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, deadline, cancel := agents.WithExecutionDeadline(parent, time.Minute)
+	defer cancel()
+
+	cancelParent()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("parent cancellation was not propagated")
+	}
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.False(t, deadline.Extend(time.Now().Add(time.Hour)))
+}
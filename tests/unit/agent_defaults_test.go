@@ -0,0 +1,152 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// agentDefaults returns server-wide defaults overlapping the settings of sharedTemplate
+func agentDefaults() *models.AgentConfiguration {
+	return &models.AgentConfiguration{
+		ID:              "ignored",
+		Timeout:         90,
+		StopWaitSeconds: 5,
+		LogfileBackups:  7,
+		Envs:            map[string]string{"LOG_LEVEL": "warn", "TZ": "UTC"},
+	}
+}
+
+func TestAgentDefaultsPrecedence(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	agentService.SetAgentDefaults(agentDefaults())
+	template := sharedTemplate("shared")
+	template.Settings.StopWaitSeconds = 20
+	require.NoError(t, agentService.CreateTemplate(template))
+
+	agent := templatedAgent("agent-1", "shared")
+	agent.Timeout = 30
+	agent.Envs = map[string]string{"REGION": "us"}
+	require.NoError(t, agentService.RegisterAgent(agent))
+
+	// What the agent sets wins over its template, which wins over the defaults
+	effective, err := agentService.GetAgent("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", effective.ID)
+	assert.Equal(t, 30, effective.Timeout)
+	assert.Equal(t, 20, effective.StopWaitSeconds)
+	assert.Equal(t, 7, effective.LogfileBackups)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "REGION": "us", "TZ": "UTC"}, effective.Envs)
+
+	// The spec is what was submitted
+	raw, err := agentService.GetAgentSpec("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, 30, raw.Timeout)
+	assert.Zero(t, raw.StopWaitSeconds)
+	assert.Zero(t, raw.LogfileBackups)
+	assert.Equal(t, map[string]string{"REGION": "us"}, raw.Envs)
+
+	// Agents without a template get the defaults alone
+	plain := templatedAgent("agent-2", "")
+	plain.AgentType, plain.ExecutablePath, plain.Mode = "plain", "/bin/cat", types.TaskMode
+	plain.InputPattern, plain.OutputPattern = types.StdinPattern, types.StdoutPattern
+	plain.AccessType, plain.MaxConcurrentExecutions = types.ReadOnlyAccessType, 1
+	require.NoError(t, agentService.RegisterAgent(plain))
+	effective, err = agentService.GetAgent("agent-2")
+	require.NoError(t, err)
+	assert.Equal(t, 90, effective.Timeout)
+	assert.Equal(t, 5, effective.StopWaitSeconds)
+}
+
+func TestAgentDefaultsOnlyApplyToNewAgentsUntilReapplied(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.CreateTemplate(sharedTemplate("shared")))
+	require.NoError(t, agentService.RegisterAgent(templatedAgent("agent-1", "shared")))
+	require.NoError(t, agentService.RegisterAgent(templatedAgent("agent-2", "shared")))
+
+	// New defaults leave the agents already registered as they are
+	agentService.SetAgentDefaults(agentDefaults())
+	before, err := agentService.GetAgent("agent-1")
+	require.NoError(t, err)
+	assert.Zero(t, before.LogfileBackups)
+
+	// A dry run reports what would change, without changing it
+	result, err := agentService.ReapplyDefaults([]string{"agent-1", "missing"}, true)
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 2, result.Matched)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, models.OperationPending, result.Results[0].Status)
+	assert.Equal(t, []string{"envs", "logfile_backups", "stop_wait_seconds"}, result.Results[0].ChangedFields)
+	assert.Equal(t, models.OperationFailed, result.Results[1].Status)
+	unchanged, err := agentService.GetAgent("agent-1")
+	require.NoError(t, err)
+	assert.Zero(t, unchanged.LogfileBackups)
+
+	// Reapplying one agent leaves the other alone
+	result, err = agentService.ReapplyDefaults([]string{"agent-1"}, false)
+	require.NoError(t, err)
+	require.Len(t, result.Results, 1)
+	assert.Equal(t, models.OperationApplied, result.Results[0].Status)
+	updated, err := agentService.GetAgent("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, 7, updated.LogfileBackups)
+	assert.Equal(t, 60, updated.Timeout) // The template still wins over the defaults
+	other, err := agentService.GetAgent("agent-2")
+	require.NoError(t, err)
+	assert.Zero(t, other.LogfileBackups)
+
+	// Template updates keep the defaults each agent was given
+	template := sharedTemplate("shared")
+	template.Settings.Timeout = 0
+	require.NoError(t, agentService.UpdateTemplate(template))
+	updated, err = agentService.GetAgent("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, 90, updated.Timeout)
+	other, err = agentService.GetAgent("agent-2")
+	require.NoError(t, err)
+	assert.Zero(t, other.Timeout)
+
+	// With no agents named every agent is reapplied; those already up to date are skipped
+	result, err = agentService.ReapplyDefaults(nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Matched)
+	assert.Equal(t, 1, result.Updated)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, "agent-1", result.Results[0].AgentID)
+	assert.Equal(t, models.OperationSkipped, result.Results[0].Status)
+}
+
+func TestConfigAgentDefaults(t *testing.T) {
+	defaults := config.AgentConfig{
+		ID:                      "ignored",
+		Mode:                    "task",
+		AccessType:              "read-only",
+		MaxConcurrentExecutions: 2,
+		Timeout:                 30,
+		Envs:                    map[string]string{"TZ": "UTC", "REGION": "eu"},
+	}
+	agent := config.AgentConfig{ID: "agent-1", Timeout: 10, Envs: map[string]string{"REGION": "us"}}
+
+	merged := agent.WithDefaults(defaults)
+	assert.Equal(t, "agent-1", merged.ID)
+	assert.Equal(t, 10, merged.Timeout)
+	assert.Equal(t, 2, merged.MaxConcurrentExecutions)
+	assert.Equal(t, map[string]string{"TZ": "UTC", "REGION": "us"}, merged.Envs)
+	assert.Equal(t, map[string]string{"REGION": "us"}, agent.Envs)
+
+	cfg := &config.Config{}
+	assert.Nil(t, config.ToAgentDefaults(cfg))
+	cfg.Defaults.Agent = defaults
+	converted := config.ToAgentDefaults(cfg)
+	require.NotNil(t, converted)
+	assert.Empty(t, converted.ID)
+	assert.Equal(t, types.ReadOnlyAccessType, converted.AccessType)
+}
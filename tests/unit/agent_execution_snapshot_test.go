@@ -0,0 +1,67 @@
+package unit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashExecutableCachesByModTimeAndSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\necho one\n"), 0755))
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	first, err := agents.HashExecutable(path)
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("#!/bin/sh\necho one\n"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), first)
+
+	// Same size and modification time: the cached hash is returned without reading the file
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\necho two\n"), 0755))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	cached, err := agents.HashExecutable(path)
+	require.NoError(t, err)
+	assert.Equal(t, first, cached)
+
+	// A new modification time invalidates it
+	require.NoError(t, os.Chtimes(path, modTime.Add(time.Second), modTime.Add(time.Second)))
+	changed, err := agents.HashExecutable(path)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+
+	_, err = agents.HashExecutable(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestReplayWarnings(t *testing.T) {
+	updated := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	original := &models.ExecutionSnapshot{ExecutablePath: "/opt/agent", ExecutableSHA256: "aaa", AgentConfigUpdatedAt: updated, Host: "web-1"}
+
+	same := *original
+	assert.Empty(t, models.ReplayWarnings(original, &same))
+	assert.Empty(t, models.ReplayWarnings(nil, &same))
+
+	changed := same
+	changed.ExecutableSHA256 = "bbb"
+	changed.AgentConfigUpdatedAt = updated.Add(time.Minute)
+	changed.Host = "web-2"
+	warnings := models.ReplayWarnings(original, &changed)
+	require.Len(t, warnings, 3)
+	assert.Equal(t, "executable /opt/agent changed: sha256 bbb, originally aaa", warnings[0])
+	assert.Contains(t, warnings[1], "agent configuration was updated")
+	assert.Equal(t, "running on host web-2 instead of web-1", warnings[2])
+
+	// Executables that could not be hashed are not reported as changed
+	unreadable := same
+	unreadable.ExecutableSHA256 = ""
+	assert.Empty(t, models.ReplayWarnings(original, &unreadable))
+}
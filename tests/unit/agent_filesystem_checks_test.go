@@ -0,0 +1,122 @@
+package unit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFilesystemChecks_ValidAgent(t *testing.T) {
+	config := scriptAgentConfig("valid-fs-agent", writeAgentScript(t, "echo ok\n"))
+	config.WorkingDirectory = t.TempDir()
+	assert.Empty(t, agents.CheckFilesystem(config))
+
+	// Bare command names are looked up in PATH
+	config.ExecutablePath = "sh"
+	assert.Empty(t, agents.CheckFilesystem(config))
+
+	// Relative paths are resolved against the working directory
+	require.NoError(t, os.WriteFile(filepath.Join(config.WorkingDirectory, "agent.sh"), []byte("#!/bin/sh\n"), 0755))
+	config.ExecutablePath = "./agent.sh"
+	assert.Empty(t, agents.CheckFilesystem(config))
+}
+
+func TestFilesystemChecks_RegistrationRejectsBrokenAgents(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "agent.txt")
+	require.NoError(t, os.WriteFile(notExecutable, []byte("echo ok\n"), 0644))
+	script := writeAgentScript(t, "echo ok\n")
+
+	tests := []struct {
+		name        string
+		executable  string
+		workingDir  string
+		field       string
+		kind        error
+		description string
+	}{
+		{"missing binary", filepath.Join(dir, "missing"), "", "executable_path", agents.ErrExecutableNotFound, "executable not found"},
+		{"missing command", "no-such-agent-command", "", "executable_path", agents.ErrExecutableNotFound, "not in PATH"},
+		{"non-executable file", notExecutable, "", "executable_path", agents.ErrExecutableNotExecutable, "is not executable"},
+		{"directory as binary", dir, "", "executable_path", agents.ErrExecutableNotExecutable, "is a directory"},
+		{"missing working directory", script, filepath.Join(dir, "missing"), "working_directory", agents.ErrWorkingDirectoryNotFound, "does not exist"},
+		{"file as working directory", script, notExecutable, "working_directory", agents.ErrWorkingDirectoryNotDirectory, "is not a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := scriptAgentConfig("broken-agent", tt.executable)
+			config.WorkingDirectory = tt.workingDir
+
+			issues := agents.CheckFilesystem(config)
+			require.Len(t, issues, 1)
+			assert.Equal(t, tt.field, issues[0].Field)
+			assert.True(t, errors.Is(issues[0], tt.kind), issues[0].Error())
+
+			agentService := services.NewAgentService(zap.NewNop())
+			err := agentService.RegisterAgent(config)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tt.kind), err.Error())
+			assert.Contains(t, err.Error(), tt.description)
+
+			_, err = agentService.GetAgent("broken-agent")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFilesystemChecks_TemplateDirectoryNotWritable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+
+	readOnly := filepath.Join(t.TempDir(), "read-only")
+	require.NoError(t, os.Mkdir(readOnly, 0555))
+
+	config := scriptAgentConfig("template-agent", writeAgentScript(t, "echo ok\n"))
+	config.OutputFileTemplate = "out.txt"
+	config.SandboxDir = filepath.Join(readOnly, "sandbox")
+
+	issues := agents.CheckFilesystem(config)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "output_file_template", issues[0].Field)
+	assert.True(t, errors.Is(issues[0], agents.ErrTemplateDirectoryNotWritable))
+
+	// A sandbox that can be created passes
+	config.SandboxDir = filepath.Join(t.TempDir(), "sandbox")
+	assert.Empty(t, agents.CheckFilesystem(config))
+}
+
+func TestFilesystemChecks_OptOut(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	// A single agent can opt out with skip_fs_checks
+	agentService := services.NewAgentService(zap.NewNop())
+	skipped := scriptAgentConfig("skipped-agent", missing)
+	skipped.WorkingDirectory = missing
+	skipped.SkipFSChecks = true
+	require.NoError(t, agentService.RegisterAgent(skipped))
+	assert.False(t, agentService.EnforcesFilesystemChecks(skipped))
+
+	// Non-strict validation downgrades the checks for every agent
+	agentService.SetStrictValidation(false)
+	relaxed := scriptAgentConfig("relaxed-agent", missing)
+	require.NoError(t, agentService.RegisterAgent(relaxed))
+	assert.False(t, agentService.EnforcesFilesystemChecks(relaxed))
+
+	// Other validation still applies
+	relaxed = scriptAgentConfig("relaxed-invalid-agent", missing)
+	relaxed.NiceLevel = 20
+	assert.Error(t, agentService.RegisterAgent(relaxed))
+
+	agentService.SetStrictValidation(true)
+	strict := scriptAgentConfig("strict-agent", missing)
+	assert.ErrorIs(t, agentService.RegisterAgent(strict), agents.ErrExecutableNotFound)
+}
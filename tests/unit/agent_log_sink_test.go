@@ -0,0 +1,141 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// readRotatedLog returns the content of path and its backups, oldest first
+func readRotatedLog(t *testing.T, path string, backups int) string {
+	var content strings.Builder
+	for i := backups; i >= 1; i-- {
+		data, err := os.ReadFile(fmt.Sprintf("%s.%d", path, i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		require.NoError(t, err)
+		content.Write(data)
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content.Write(data)
+	return content.String()
+}
+
+func TestRotatingFileKeepsConfiguredBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	sink := agents.NewRotatingFile(path, 100, 3)
+	defer sink.Close()
+
+	var lines []string
+	for i := 0; i < 40; i++ {
+		line := fmt.Sprintf("line-%04d\n", i) // 10 bytes, so each file holds 10 lines
+		lines = append(lines, line)
+		_, err := sink.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2", path + ".3"} {
+		info, err := os.Stat(name)
+		require.NoError(t, err, name)
+		assert.LessOrEqual(t, info.Size(), int64(100), name)
+	}
+	_, err := os.Stat(path + ".4")
+	assert.True(t, os.IsNotExist(err))
+
+	// The retained files hold the most recent lines, in order and without gaps
+	assert.Equal(t, strings.Join(lines, ""), readRotatedLog(t, path, 3))
+}
+
+func TestRotatingFileConcurrentWritesAreNotLost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	sink := agents.NewRotatingFile(path, 512, 1000)
+	defer sink.Close()
+
+	const writers, perWriter = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				sink.Write([]byte(fmt.Sprintf("writer-%d line-%04d\n", w, i)))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(readRotatedLog(t, path, 1000), "\n"), "\n")
+	require.Len(t, lines, writers*perWriter)
+
+	seen := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		assert.Regexp(t, `^writer-\d line-\d{4}$`, line)
+		seen[line] = true
+	}
+	assert.Len(t, seen, writers*perWriter)
+}
+
+func TestAgentOutputIsTeedToRotatingLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := scriptAgentConfig("logging-agent", writeAgentScript(t,
+		"i=0\nwhile [ $i -lt 200 ]; do echo \"stdout line $i\"; i=$((i+1)); done\necho \"stderr line\" >&2\n"))
+	config.StdoutLogfile = filepath.Join(dir, "{{agent_id}}-stdout.log")
+	config.StderrLogfile = filepath.Join(dir, "{{agent_id}}-stderr.log")
+	config.LogfileMaxBytes = 512
+	config.LogfileBackups = 50
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "")
+	require.NoError(t, err)
+	agents.CloseLogSinks()
+
+	// The capture buffer still receives everything
+	stdoutPath := filepath.Join(dir, "logging-agent-stdout.log")
+	assert.Equal(t, string(result.Stdout), readRotatedLog(t, stdoutPath, 50))
+	_, err = os.Stat(stdoutPath + ".1")
+	assert.NoError(t, err, "stdout log should have rotated")
+
+	stderr, err := os.ReadFile(filepath.Join(dir, "logging-agent-stderr.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "stderr line\n", string(stderr))
+
+	// The status response exposes the current log files
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(config))
+	status, err := agentService.GetAgentStatus("logging-agent")
+	require.NoError(t, err)
+	assert.Equal(t, stdoutPath, status.StdoutLogfile)
+	assert.Equal(t, filepath.Join(dir, "logging-agent-stderr.log"), status.StderrLogfile)
+}
+
+func TestAgentLogFilesDisabledByDefault(t *testing.T) {
+	dir := t.TempDir()
+	config := scriptAgentConfig("quiet-agent", writeAgentScript(t, "echo hello\n"))
+	config.WorkingDirectory = dir
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", result.Output)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(config))
+	status, err := agentService.GetAgentStatus("quiet-agent")
+	require.NoError(t, err)
+	assert.Empty(t, status.StdoutLogfile)
+	assert.Empty(t, status.StderrLogfile)
+}
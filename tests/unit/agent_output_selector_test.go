@@ -0,0 +1,121 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSelectJSON(t *testing.T) {
+	document := []byte(`{
+		"status": "ok",
+		"result": {"items": [{"name": "first"}, {"name": "second", "score": 2.5}]},
+		"key.with.dots": {"it's": true},
+		"count": 12345678901234567890
+	}`)
+
+	tests := []struct {
+		selector string
+		expected string
+	}{
+		{"status", "ok"},
+		{"$.status", "ok"},
+		{"result.items[1].name", "second"},
+		{"$.result.items[0]", `{"name":"first"}`},
+		{"result.items[1].score", "2.5"},
+		{`["key.with.dots"]["it's"]`, "true"},
+		{`$['key.with.dots']`, `{"it's":true}`},
+		{"count", "12345678901234567890"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			output, err := agents.SelectJSON(document, tt.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, output)
+		})
+	}
+
+	// An empty selector returns the whole document as compact JSON
+	output, err := agents.SelectJSON([]byte(" [1, \"two\"]\n"), "")
+	require.NoError(t, err)
+	assert.Equal(t, `[1,"two"]`, output)
+}
+
+func TestSelectJSON_Errors(t *testing.T) {
+	document := []byte(`{"items": [{"name": "first"}], "status": "ok"}`)
+
+	tests := []struct {
+		name        string
+		output      []byte
+		selector    string
+		kind        error
+		description string
+	}{
+		{"not json", []byte("plain text\n"), "status", agents.ErrOutputNotJSON, "not valid JSON"},
+		{"trailing data", []byte(`{"a": 1} {"b": 2}`), "a", agents.ErrOutputNotJSON, "after the JSON document"},
+		{"missing key", document, "result.name", agents.ErrOutputSelectorNotFound, `key "result" not found at $`},
+		{"index out of range", document, "items[3]", agents.ErrOutputSelectorNotFound, "out of range at $.items (length 1)"},
+		{"index into object", document, "status[0]", agents.ErrOutputSelectorNotFound, "$.status is a string, not an array"},
+		{"key into array", document, "items.name", agents.ErrOutputSelectorNotFound, "$.items is an array, not an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := agents.SelectJSON(tt.output, tt.selector)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Contains(t, err.Error(), tt.description)
+		})
+	}
+}
+
+func TestValidateOutputSelector(t *testing.T) {
+	for _, selector := range []string{"", "$", "a", "$.a.b[0]", `a["b c"]`, "[2].x"} {
+		assert.NoError(t, agents.ValidateOutputSelector(selector), selector)
+	}
+	for _, selector := range []string{"a..b", "a[x]", "a[-1]", "a[0", `a["b]`, "$a", "a.b."} {
+		assert.Error(t, agents.ValidateOutputSelector(selector), selector)
+	}
+}
+
+func TestJSONOutputPattern(t *testing.T) {
+	path := writeAgentScript(t, "cat >/dev/null\necho '{\"answer\": {\"text\": \"forty-two\"}}'\n")
+	config := scriptAgentConfig("json-agent", path)
+	config.OutputPattern = models.JsonPatternOut
+	config.OutputSelector = "$.answer.text"
+	require.NoError(t, config.Validate())
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "question")
+	require.NoError(t, err)
+	assert.Equal(t, "forty-two", result.Output)
+
+	// A selector that does not match fails the execution
+	config.OutputSelector = "answer.missing"
+	_, err = agents.ExecuteAgentWithPattern(context.Background(), config, "question")
+	assert.ErrorIs(t, err, agents.ErrOutputSelectorNotFound)
+}
+
+func TestJSONOutputPattern_Validation(t *testing.T) {
+	path := writeAgentScript(t, "echo '{}'\n")
+
+	// The selector only applies to the json output pattern
+	config := scriptAgentConfig("stdout-selector-agent", path)
+	config.OutputSelector = "a"
+	assert.Error(t, config.Validate())
+
+	// Registration rejects selectors that do not parse
+	config = scriptAgentConfig("bad-selector-agent", path)
+	config.OutputPattern = models.JsonPatternOut
+	config.OutputSelector = "a[b]"
+	agentService := services.NewAgentService(zap.NewNop())
+	err := agentService.RegisterAgent(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid output selector")
+}
@@ -0,0 +1,132 @@
+//go:build !windows
+
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// childScript starts a child that holds the agent's output open well past the test timeouts
+const childScript = "echo started\nsleep 30\necho finished\n"
+
+func TestGenericAgentCancelStopsChildProcesses(t *testing.T) {
+	config := scriptAgentConfig("child-agent", writeAgentScript(t, childScript))
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := agent.Execute(ctx, "")
+	require.Error(t, err)
+	assert.EqualValues(t, models.CancelledStatus, result.Status)
+
+	// The child's stdout closes with it, so the execution ends without waiting for sleep
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, "terminated", result.Signal)
+}
+
+func TestGenericAgentTimeoutKillsChildProcesses(t *testing.T) {
+	config := scriptAgentConfig("child-agent", writeAgentScript(t, childScript))
+	config.Timeout = 1
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+
+	start := time.Now()
+	result, err := agent.Execute(context.Background(), "")
+	require.Error(t, err)
+	assert.EqualValues(t, models.TimeoutStatus, result.Status)
+	assert.Less(t, time.Since(start), 6*time.Second)
+}
+
+func TestExecuteAgentWithPatternCancelStopsChildProcesses(t *testing.T) {
+	config := scriptAgentConfig("child-agent", writeAgentScript(t, childScript))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := agents.ExecuteAgentWithPattern(ctx, config, "")
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "started\n", string(result.Stdout))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+// interruptOnlyScript ignores SIGTERM and only exits on SIGINT
+const interruptOnlyScript = "trap '' TERM\ntrap 'echo interrupted; exit 0' INT\necho started\nwhile :; do sleep 0.1; done\n"
+
+// cancelAfter runs the agent and cancels its context with cause after delay, returning the result and
+// how long the agent took to exit after the cancellation
+func cancelAfter(t *testing.T, agent *agents.GenericAgent, delay time.Duration, cause error) (*models.ExecutionResult, time.Duration) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	var cancelled time.Time
+	time.AfterFunc(delay, func() {
+		cancelled = time.Now()
+		cancel(cause)
+	})
+
+	result, err := agent.Execute(ctx, "")
+	require.Error(t, err)
+	assert.EqualValues(t, models.CancelledStatus, result.Status)
+	return result, time.Since(cancelled)
+}
+
+func TestGenericAgentSendsConfiguredStopSignal(t *testing.T) {
+	config := scriptAgentConfig("interrupt-agent", writeAgentScript(t, interruptOnlyScript))
+	config.StopSignal = "SIGINT"
+	config.StopWaitSeconds = 5
+
+	result, stopped := cancelAfter(t, agents.NewGenericAgent(config, zap.NewNop()), 300*time.Millisecond, context.Canceled)
+	assert.False(t, result.ForcedKill)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Contains(t, result.Output, "interrupted")
+	assert.Less(t, stopped, 2*time.Second)
+}
+
+func TestGenericAgentKillsAfterStopWait(t *testing.T) {
+	config := scriptAgentConfig("interrupt-agent", writeAgentScript(t, interruptOnlyScript))
+	config.StopWaitSeconds = 1
+
+	// SIGTERM is ignored, so the agent is killed once the stop wait has passed
+	result, stopped := cancelAfter(t, agents.NewGenericAgent(config, zap.NewNop()), 300*time.Millisecond, context.Canceled)
+	assert.True(t, result.ForcedKill)
+	assert.Equal(t, "killed", result.Signal)
+	assert.GreaterOrEqual(t, stopped, time.Second)
+	assert.Less(t, stopped, 3*time.Second)
+}
+
+func TestStopRequestOverridesStopSignal(t *testing.T) {
+	config := scriptAgentConfig("interrupt-agent", writeAgentScript(t, interruptOnlyScript))
+	config.StopWaitSeconds = 5
+
+	result, stopped := cancelAfter(t, agents.NewGenericAgent(config, zap.NewNop()), 300*time.Millisecond, &agents.StopRequest{Signal: "INT"})
+	assert.False(t, result.ForcedKill)
+	assert.Less(t, stopped, 2*time.Second)
+}
+
+func TestStopSignalValidation(t *testing.T) {
+	signal, err := models.NormalizeStopSignal(" sighup ")
+	require.NoError(t, err)
+	assert.Equal(t, "HUP", signal)
+
+	_, err = models.NormalizeStopSignal("STOP")
+	assert.ErrorContains(t, err, "unsupported stop signal")
+
+	agentService := services.NewAgentService(zap.NewNop())
+	invalid := scriptAgentConfig("invalid-agent", writeAgentScript(t, "echo ok\n"))
+	invalid.StopSignal = "SIGSTOP"
+	assert.ErrorContains(t, agentService.RegisterAgent(invalid), "StopSignal is invalid")
+
+	invalid.StopSignal = "QUIT"
+	invalid.StopWaitSeconds = -1
+	assert.ErrorContains(t, agentService.RegisterAgent(invalid), "StopWaitSeconds cannot be negative")
+}
@@ -0,0 +1,144 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// requireLinux skips tests of process limits, which are only applied on Linux
+func requireLinux(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process limits are only supported on Linux")
+	}
+}
+
+// executeLimited registers the agent and runs it through an execution service
+func executeLimited(t *testing.T, config *models.AgentConfiguration) (*models.AgentExecution, *models.ExecutionResult, error) {
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(config))
+	executionService := services.NewExecutionService(agentService, logger)
+
+	execution, err := executionService.ExecuteAgent(context.Background(), agents.NewGenericAgent(config, logger), "")
+	require.NotNil(t, execution)
+	result, _ := executionService.GetExecutionResult(execution.ID)
+	return execution, result, err
+}
+
+func TestProcessLimits_MemoryLimitViolation(t *testing.T) {
+	requireLinux(t)
+	if _, err := exec.LookPath("perl"); err != nil {
+		t.Skip("perl is needed to allocate past the limit")
+	}
+
+	config := scriptAgentConfig("memory-agent", writeAgentScript(t, "exec perl -e '$x = \"a\" x (512 * 1024 * 1024); print length $x'\n"))
+	config.MaxMemoryMB = 64
+
+	execution, result, err := executeLimited(t, config)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, models.ErrResourceLimitExceeded), err.Error())
+	assert.Contains(t, err.Error(), "memory limit of 64 MB exceeded")
+	assert.EqualValues(t, models.ResourceLimitError, execution.ErrorCategory)
+	assert.EqualValues(t, models.FailedState, execution.State)
+	require.NotNil(t, result)
+	assert.EqualValues(t, models.FailureStatus, result.Status)
+}
+
+func TestProcessLimits_CPULimitViolation(t *testing.T) {
+	requireLinux(t)
+
+	config := scriptAgentConfig("cpu-agent", writeAgentScript(t, "while :; do :; done\n"))
+	config.MaxCPUSeconds = 1
+
+	execution, _, err := executeLimited(t, config)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, models.ErrResourceLimitExceeded), err.Error())
+	assert.Contains(t, err.Error(), "CPU time limit of 1 seconds exceeded")
+	assert.EqualValues(t, models.ResourceLimitError, execution.ErrorCategory)
+}
+
+func TestProcessLimits_AppliedWithinLimits(t *testing.T) {
+	requireLinux(t)
+
+	config := scriptAgentConfig("nice-agent", writeAgentScript(t, "nice\nulimit -v\nulimit -t\n"))
+	config.NiceLevel = 5
+	config.MaxMemoryMB = 256
+	config.MaxCPUSeconds = 30
+
+	execution, result, err := executeLimited(t, config)
+	require.NoError(t, err)
+	assert.Empty(t, execution.ErrorCategory)
+	assert.Equal(t, "5\n262144\n30\n", result.Output)
+}
+
+func TestProcessLimits_RunAsUser(t *testing.T) {
+	requireLinux(t)
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no nobody user")
+	}
+
+	// The script must be reachable by the other user, unlike the private test temp dir
+	dir, err := os.MkdirTemp("", "run-as-agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	require.NoError(t, os.Chmod(dir, 0755))
+	script := filepath.Join(dir, "agent.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\nid -u\n"), 0755))
+
+	config := scriptAgentConfig("run-as-agent", script)
+	config.RunAsUser = "nobody"
+	config.WorkingDirectory = dir
+
+	_, result, err := executeLimited(t, config)
+	require.NoError(t, err)
+	assert.Equal(t, nobody.Uid+"\n", result.Output)
+}
+
+func TestProcessLimits_RegistrationRejectsUnsupportedLimits(t *testing.T) {
+	requireLinux(t)
+	agentService := services.NewAgentService(zap.NewNop())
+
+	unknownUser := scriptAgentConfig("unknown-user-agent", "/bin/true")
+	unknownUser.RunAsUser = "no-such-user-for-agent-tests"
+	assert.ErrorContains(t, agentService.RegisterAgent(unknownUser), "run_as_user no-such-user-for-agent-tests")
+
+	outOfRange := scriptAgentConfig("nice-range-agent", "/bin/true")
+	outOfRange.NiceLevel = 20
+	assert.ErrorContains(t, agentService.RegisterAgent(outOfRange), "NiceLevel must be between -20 and 19")
+
+	negativeMemory := scriptAgentConfig("negative-memory-agent", "/bin/true")
+	negativeMemory.MaxMemoryMB = -1
+	assert.ErrorContains(t, agentService.RegisterAgent(negativeMemory), "cannot be negative")
+
+	if os.Geteuid() == 0 {
+		// Raising priority is a privilege the unprivileged agent user doesn't have
+		privileged := scriptAgentConfig("privileged-nice-agent", "/bin/true")
+		privileged.RunAsUser = "nobody"
+		privileged.NiceLevel = -5
+		assert.ErrorContains(t, agentService.RegisterAgent(privileged), "negative nice_level")
+	} else {
+		asRoot := scriptAgentConfig("as-root-agent", "/bin/true")
+		asRoot.RunAsUser = "root"
+		assert.ErrorContains(t, agentService.RegisterAgent(asRoot), "requires the supervisor to run as root")
+	}
+
+	_, err := agentService.GetAgent("unknown-user-agent")
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeAgentScript creates an executable shell script in a temp dir
+func writeAgentScript(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "agent.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755))
+	return path
+}
+
+func scriptAgentConfig(id, path string) *models.AgentConfiguration {
+	return &models.AgentConfiguration{
+		ID:                      id,
+		Name:                    "Script Agent",
+		AgentType:               "script",
+		ExecutablePath:          path,
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 1,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 10,
+		Enabled:                 true,
+	}
+}
+
+func TestExecuteAgentWithPattern_SeparatesStreams(t *testing.T) {
+	path := writeAgentScript(t, "echo to-stdout\necho to-stderr >&2\nexit 3\n")
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), scriptAgentConfig("script-agent", path), "")
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Contains(t, err.Error(), "exited with code 3")
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "to-stdout\n", string(result.Stdout))
+	assert.Equal(t, "to-stderr\n", string(result.Stderr))
+}
+
+func TestExecuteAgentWithPattern_OutputIsStdoutOnly(t *testing.T) {
+	path := writeAgentScript(t, "cat\necho noise >&2\n")
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), scriptAgentConfig("script-agent", path), "payload")
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "payload", result.Output)
+	assert.Equal(t, "noise\n", string(result.Stderr))
+}
+
+func TestExecutionService_RecordsExitCodeAndStderr(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	path := writeAgentScript(t, "echo to-stdout\necho to-stderr >&2\nexit 3\n")
+	config := scriptAgentConfig("failing-script", path)
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(config))
+	executionService := services.NewExecutionService(agentService, logger)
+
+	execution, err := executionService.ExecuteAgent(context.Background(), agents.NewGenericAgent(config, logger), "")
+	require.Error(t, err)
+	require.NotNil(t, execution)
+	assert.Equal(t, 3, execution.ExitCode)
+
+	result, err := executionService.GetExecutionResult(execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "to-stdout\n", result.Output)
+	assert.Equal(t, "to-stderr\n", result.Stderr)
+	assert.Equal(t, "stderr\n", result.StderrTail(7))
+}
+
+func TestExecuteAgentWithPattern_OutputCap(t *testing.T) {
+	path := writeAgentScript(t, "printf '%0100d' 0\n")
+	agents.SetMaxCapturedOutputBytes(10)
+	t.Cleanup(func() { agents.SetMaxCapturedOutputBytes(0) })
+
+	// The server-wide default caps agents that set no cap of their own
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), scriptAgentConfig("script-agent", path), "")
+	require.NoError(t, err)
+	assert.Len(t, result.Stdout, 10)
+	assert.True(t, result.Truncated)
+
+	config := scriptAgentConfig("script-agent", path)
+	config.MaxOutputBytes = 40
+	result, err = agents.ExecuteAgentWithPattern(context.Background(), config, "")
+	require.NoError(t, err)
+	assert.Len(t, result.Stdout, 40)
+	assert.True(t, result.Truncated)
+}
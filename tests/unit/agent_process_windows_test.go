@@ -0,0 +1,80 @@
+//go:build windows
+
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeBatchAgent creates a batch file agent, run through cmd.exe
+func writeBatchAgent(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "agent.cmd")
+	require.NoError(t, os.WriteFile(path, []byte("@echo off\r\n"+body), 0755))
+	return path
+}
+
+// batchChildScript starts a child that holds the agent's output open well past the test timeouts
+const batchChildScript = "echo started\r\nping -n 30 127.0.0.1 > nul\r\necho finished\r\n"
+
+func TestWindowsAgentCapturesOutput(t *testing.T) {
+	config := scriptAgentConfig("batch-agent", writeBatchAgent(t, "echo to-stdout\r\necho to-stderr 1>&2\r\nexit /b 3\r\n"))
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "")
+	require.Error(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "to-stdout", strings.TrimSpace(string(result.Stdout)))
+	assert.Equal(t, "to-stderr", strings.TrimSpace(string(result.Stderr)))
+}
+
+func TestWindowsAgentCancelStopsChildProcesses(t *testing.T) {
+	config := scriptAgentConfig("batch-agent", writeBatchAgent(t, batchChildScript))
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Second, cancel)
+
+	start := time.Now()
+	result, err := agent.Execute(ctx, "")
+	require.Error(t, err)
+	assert.EqualValues(t, models.CancelledStatus, result.Status)
+	assert.Less(t, time.Since(start), 15*time.Second)
+}
+
+func TestWindowsAgentTimeoutKillsChildProcesses(t *testing.T) {
+	config := scriptAgentConfig("batch-agent", writeBatchAgent(t, batchChildScript))
+	config.Timeout = 1
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+
+	start := time.Now()
+	result, err := agent.Execute(context.Background(), "")
+	require.Error(t, err)
+	assert.EqualValues(t, models.TimeoutStatus, result.Status)
+	assert.Less(t, time.Since(start), 15*time.Second)
+}
+
+func TestWindowsProcessLimitsAreIgnoredWithWarnings(t *testing.T) {
+	config := scriptAgentConfig("limited-agent", writeBatchAgent(t, "echo ok\r\n"))
+	config.RunAsUser = "nobody"
+	config.MaxMemoryMB = 64
+
+	require.NoError(t, services.NewAgentService(zap.NewNop()).RegisterAgent(config))
+
+	var fields []string
+	for _, warning := range agents.UnsupportedProcessLimits(config) {
+		fields = append(fields, warning.Field)
+	}
+	assert.Equal(t, []string{"run_as_user", "max_memory_mb"}, fields)
+}
@@ -0,0 +1,230 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fileAgentConfig returns a script agent that reads its input from and writes its output to sandbox files
+func fileAgentConfig(t *testing.T, id, script string) *models.AgentConfiguration {
+	config := scriptAgentConfig(id, writeAgentScript(t, script))
+	config.InputPattern = models.FilePattern
+	config.OutputPattern = models.FilePatternOut
+	config.InputFileTemplate = "input-{{execution_id}}.txt"
+	config.OutputFileTemplate = "out.txt"
+	config.SandboxDir = t.TempDir()
+	return config
+}
+
+// sandboxEntries lists the execution directories left in an agent's sandbox root
+func sandboxEntries(t *testing.T, root string) []os.DirEntry {
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	return entries
+}
+
+func TestValidateFileTemplate(t *testing.T) {
+	for _, template := range []string{"input.txt", "in/{{execution_id}}.json", "{{agent_id}}-{{timestamp}}.txt"} {
+		assert.NoError(t, agents.ValidateFileTemplate(template), template)
+	}
+
+	for _, template := range []string{"../../etc/cron.d/{{agent_id}}", "/etc/passwd", "a/../../x", ".."} {
+		err := agents.ValidateFileTemplate(template)
+		assert.ErrorIs(t, err, agents.ErrPathEscapesSandbox, template)
+	}
+}
+
+func TestRegisterAgentRejectsEscapingTemplates(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+
+	config := fileAgentConfig(t, "escaping-input", "exit 0\n")
+	config.InputFileTemplate = "../../etc/cron.d/{{agent_id}}"
+	err := agentService.RegisterAgent(config)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, agents.ErrPathEscapesSandbox)
+
+	config = fileAgentConfig(t, "escaping-output", "exit 0\n")
+	config.OutputFileTemplate = "/tmp/out.txt"
+	err = agentService.RegisterAgent(config)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, agents.ErrPathEscapesSandbox)
+
+	assert.NoError(t, agentService.RegisterAgent(fileAgentConfig(t, "contained", "exit 0\n")))
+}
+
+func TestGenericAgentRejectsInputInjectedTraversal(t *testing.T) {
+	config := fileAgentConfig(t, "injected-agent", "exit 0\n")
+	config.InputFileTemplate = "{{input}}.txt"
+
+	result, err := agents.NewGenericAgent(config, zap.NewNop()).Execute(context.Background(), "../../escaped")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, agents.ErrPathEscapesSandbox)
+	assert.EqualValues(t, models.FailureStatus, result.Status)
+
+	_, statErr := os.Stat(filepath.Join(filepath.Dir(config.SandboxDir), "escaped.txt"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestExecuteAgentWithPatternUsesSandbox(t *testing.T) {
+	config := fileAgentConfig(t, "pattern-agent", "tr a-z A-Z < \"$1\" > \"$SUPERVISOR_SANDBOX_DIR/out.txt\"\n")
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO", result.Output)
+
+	// Artifacts are removed once the execution finishes
+	assert.Empty(t, sandboxEntries(t, config.SandboxDir))
+}
+
+func TestConcurrentFileExecutionsDoNotCollide(t *testing.T) {
+	config := fileAgentConfig(t, "concurrent-agent", "sleep 0.1\ncat \"$1\" > \"$(dirname \"$1\")/out.txt\"\n")
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+
+	const runs = 10
+	outputs := make([]string, runs)
+	errs := make([]error, runs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := agent.Execute(context.Background(), fmt.Sprintf("input-%d", i))
+			errs[i] = err
+			if result != nil {
+				outputs[i] = result.Output
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, fmt.Sprintf("input-%d", i), outputs[i])
+	}
+	assert.Empty(t, sandboxEntries(t, config.SandboxDir))
+}
+
+func TestKeepArtifactsRetainsSandbox(t *testing.T) {
+	config := fileAgentConfig(t, "keeping-agent", "cp \"$1\" \"$(dirname \"$1\")/out.txt\"\n")
+	config.KeepArtifacts = true
+
+	result, err := agents.NewGenericAgent(config, zap.NewNop()).Execute(context.Background(), "kept")
+	require.NoError(t, err)
+	assert.Equal(t, "kept", result.Output)
+
+	entries := sandboxEntries(t, config.SandboxDir)
+	require.Len(t, entries, 1)
+
+	dir := filepath.Join(config.SandboxDir, entries[0].Name())
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	output, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "kept", string(output))
+}
+
+func TestExecutionSandboxPath(t *testing.T) {
+	config := &models.AgentConfiguration{ID: "path-agent", SandboxDir: t.TempDir()}
+
+	sandbox, err := agents.NewExecutionSandbox(config)
+	require.NoError(t, err)
+	defer sandbox.Cleanup()
+
+	path, err := sandbox.Path("nested/{{agent_id}}.txt", nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(sandbox.Dir, "nested", "path-agent.txt"), path)
+
+	_, err = sandbox.Path("{{name}}", map[string]interface{}{"name": "../outside"})
+	assert.True(t, errors.Is(err, agents.ErrPathEscapesSandbox))
+}
+
+func TestFileOutputWaitsForDelayedFile(t *testing.T) {
+	// The agent exits at once, leaving a child to write the output a moment later
+	config := fileAgentConfig(t, "delayed-agent", "dir=$(dirname \"$1\")\n(sleep 0.3; cat \"$1\" > \"$dir/out.tmp\"; mv \"$dir/out.tmp\" \"$dir/out.txt\") >/dev/null 2>&1 &\n")
+	config.OutputFileWaitSeconds = 5
+
+	result, err := agents.NewGenericAgent(config, zap.NewNop()).Execute(context.Background(), "late")
+	require.NoError(t, err)
+	assert.Equal(t, "late", result.Output)
+}
+
+func TestFileOutputMissingAfterWait(t *testing.T) {
+	config := fileAgentConfig(t, "missing-agent", "exit 0\n")
+	config.OutputFileTemplate = "results/{{agent_id}}.txt"
+	config.OutputFileWaitSeconds = 1
+
+	_, err := agents.ExecuteAgentWithPattern(context.Background(), config, "lost")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, agents.ErrOutputFileMissing)
+	assert.Contains(t, err.Error(), filepath.Join("results", "missing-agent.txt"), "the error names the resolved path")
+}
+
+func TestFileOutputGlobReadsNewestMatch(t *testing.T) {
+	// The agent reads stdin and names its report unpredictably, next to an older one
+	config := fileAgentConfig(t, "glob-agent", "dir=$SUPERVISOR_SANDBOX_DIR\necho old > \"$dir/report-1.txt\"\ntouch -t 200001010000 \"$dir/report-1.txt\"\ncat > \"$dir/report-$$.txt\"\n")
+	config.InputPattern = models.StdinPattern
+	config.OutputFileTemplate = "report-*.txt"
+	config.OutputFileWaitSeconds = 5
+	config.OutputFileStable = true
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "newest")
+	require.NoError(t, err)
+	assert.Equal(t, "newest", result.Output)
+	assert.Empty(t, sandboxEntries(t, config.SandboxDir))
+}
+
+func TestFileOutputRefusesSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0600))
+
+	// A symlinked output file, and an output file reached through a symlinked directory, are both
+	// outside the sandbox
+	for name, script := range map[string]string{
+		"file":      "ln -s \"" + secret + "\" \"$SUPERVISOR_SANDBOX_DIR/out.txt\"\n",
+		"directory": "echo leaked > \"" + outside + "/out.txt\"\nln -s \"" + outside + "\" \"$SUPERVISOR_SANDBOX_DIR/linked\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := fileAgentConfig(t, "symlink-agent", script)
+			config.InputPattern = models.StdinPattern
+			if name == "directory" {
+				config.OutputFileTemplate = "linked/out.txt"
+			}
+			config.OutputFileWaitSeconds = 1
+
+			_, err := agents.ExecuteAgentWithPattern(context.Background(), config, "ignored")
+			assert.ErrorIs(t, err, agents.ErrOutputFileMissing)
+		})
+	}
+	content, err := os.ReadFile(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(content), "the linked file is neither read nor removed")
+}
+
+func TestFileOutputWaitEndsWithContext(t *testing.T) {
+	config := fileAgentConfig(t, "cancelled-agent", "exit 0\n")
+	config.OutputFileWaitSeconds = 30
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+	started := time.Now()
+	_, err := agents.ExecuteAgentWithPattern(ctx, config, "never written")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(started), 5*time.Second)
+}
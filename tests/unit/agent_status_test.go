@@ -0,0 +1,98 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// StaticExecutionService serves a fixed set of executions
+type StaticExecutionService struct {
+	services.IExecutionService
+	executions []*models.AgentExecution
+}
+
+func (s *StaticExecutionService) ListExecutions(agentID string) ([]*models.AgentExecution, error) {
+	var executions []*models.AgentExecution
+	for _, execution := range s.executions {
+		if execution.AgentID == agentID {
+			executions = append(executions, execution)
+		}
+	}
+	return executions, nil
+}
+
+func statusTestExecution(id, agentID string, state types.AgentState, endTime *time.Time) *models.AgentExecution {
+	return &models.AgentExecution{ID: id, AgentID: agentID, State: state, StartTime: time.Now().Add(-3 * time.Hour), EndTime: endTime}
+}
+
+func TestGetAgentStatusIsPerAgent(t *testing.T) {
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	for _, id := range []string{"busy-agent", "idle-agent"} {
+		config := scriptAgentConfig(id, "/bin/echo")
+		config.AccessType = models.ReadWriteAccessType
+		require.NoError(t, agentService.RegisterAgent(config))
+	}
+
+	earlier := time.Now().Add(-2 * time.Hour)
+	latest := time.Now().Add(-time.Hour)
+	executionService := &StaticExecutionService{executions: []*models.AgentExecution{
+		statusTestExecution("exec-1", "busy-agent", models.CompletedState, &earlier),
+		statusTestExecution("exec-2", "busy-agent", models.FailedState, &latest),
+		statusTestExecution("exec-3", "busy-agent", models.RunningState, nil),
+	}}
+	agentService.SetExecutionService(executionService)
+
+	schedulerService := services.NewSchedulerService(agentService, executionService, logger)
+	agentService.SetSchedulerService(schedulerService)
+
+	for _, task := range []*models.ScheduledTask{
+		{ID: "hourly", Name: "Hourly", AgentID: "busy-agent", CronExpression: "@every 1h", Enabled: true},
+		{ID: "minutely", Name: "Minutely", AgentID: "busy-agent", CronExpression: "@every 1m", Enabled: true},
+		{ID: "paused", Name: "Paused", AgentID: "busy-agent", CronExpression: "@every 1s", Enabled: true},
+	} {
+		require.NoError(t, schedulerService.ScheduleTask(task))
+	}
+	require.NoError(t, schedulerService.PauseTask("paused"))
+
+	busy, err := agentService.GetAgentStatus("busy-agent")
+	require.NoError(t, err)
+	assert.Equal(t, "running", busy.Status)
+	require.Len(t, busy.Executions, 1)
+	assert.Equal(t, "exec-3", busy.Executions[0].ID)
+	require.NotNil(t, busy.LastRun)
+	assert.True(t, latest.Equal(*busy.LastRun))
+	assert.Equal(t, 2, busy.ActiveTasks)
+	require.NotNil(t, busy.NextRun)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *busy.NextRun, 5*time.Second)
+	assert.Equal(t, services.AgentHealthy, busy.Health)
+
+	idle, err := agentService.GetAgentStatus("idle-agent")
+	require.NoError(t, err)
+	assert.Equal(t, "idle", idle.Status)
+	assert.Empty(t, idle.Executions)
+	assert.Nil(t, idle.LastRun)
+	assert.Nil(t, idle.NextRun)
+	assert.Equal(t, 0, idle.ActiveTasks)
+}
+
+func TestGetAgentStatusDisabledAgent(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	config := scriptAgentConfig("disabled-agent", "/bin/echo")
+	config.Enabled = false
+	require.NoError(t, agentService.RegisterAgent(config))
+
+	status, err := agentService.GetAgentStatus("disabled-agent")
+	require.NoError(t, err)
+	assert.Equal(t, "disabled", status.Status)
+
+	_, err = agentService.GetAgentStatus("missing-agent")
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// sharedTemplate returns a template holding every setting its agents need except their identity
+func sharedTemplate(name string) *models.AgentTemplate {
+	return &models.AgentTemplate{
+		Name: name,
+		Settings: models.AgentConfiguration{
+			ID:                      "ignored",
+			Name:                    "Ignored",
+			AgentType:               "shared-type",
+			ExecutablePath:          "/bin/cat",
+			Envs:                    map[string]string{"LOG_LEVEL": "info", "REGION": "eu"},
+			Mode:                    types.TaskMode,
+			InputPattern:            types.StdinPattern,
+			OutputPattern:           types.StdoutPattern,
+			AccessType:              types.ReadOnlyAccessType,
+			MaxConcurrentExecutions: 4,
+			Timeout:                 60,
+			KeepArtifacts:           true,
+			Enabled:                 true,
+		},
+	}
+}
+
+func templatedAgent(id, template string) *models.AgentConfiguration {
+	return &models.AgentConfiguration{ID: id, Name: "Agent " + id, Template: template}
+}
+
+func TestAgentTemplateMergePrecedence(t *testing.T) {
+	template := sharedTemplate("shared")
+	agent := templatedAgent("agent-1", "shared")
+	agent.ExecutablePath = "/bin/echo"
+	agent.Envs = map[string]string{"REGION": "us", "TOKEN_FILE": "/run/token"}
+
+	merged := template.Apply(agent)
+
+	// The agent's own values win, and the template fills in the rest
+	assert.Equal(t, "agent-1", merged.ID)
+	assert.Equal(t, "Agent agent-1", merged.Name)
+	assert.Equal(t, "shared", merged.Template)
+	assert.Equal(t, "/bin/echo", merged.ExecutablePath)
+	assert.Equal(t, "shared-type", merged.AgentType)
+	assert.Equal(t, 60, merged.Timeout)
+	assert.Equal(t, 4, merged.MaxConcurrentExecutions)
+	assert.True(t, merged.KeepArtifacts)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "REGION": "us", "TOKEN_FILE": "/run/token"}, merged.Envs)
+
+	// Neither input is modified
+	assert.Zero(t, agent.Timeout)
+	assert.Equal(t, map[string]string{"REGION": "us", "TOKEN_FILE": "/run/token"}, agent.Envs)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "REGION": "eu"}, template.Settings.Envs)
+}
+
+func TestAgentTemplateValidation(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+
+	assert.ErrorIs(t, agentService.CreateTemplate(&models.AgentTemplate{}), models.ErrInvalidAgent)
+	nested := sharedTemplate("nested")
+	nested.Settings.Template = "shared"
+	assert.ErrorIs(t, agentService.CreateTemplate(nested), models.ErrInvalidAgent)
+
+	require.NoError(t, agentService.CreateTemplate(sharedTemplate("shared")))
+	assert.ErrorIs(t, agentService.CreateTemplate(sharedTemplate("shared")), models.ErrTemplateConflict)
+	assert.ErrorIs(t, agentService.UpdateTemplate(sharedTemplate("missing")), models.ErrTemplateNotFound)
+
+	// Agents naming an unknown template are rejected, and validation runs on the merged result
+	assert.ErrorIs(t, agentService.RegisterAgent(templatedAgent("agent-1", "missing")), models.ErrInvalidAgent)
+	invalid := templatedAgent("agent-2", "shared")
+	invalid.AccessType = types.ReadWriteAccessType
+	assert.ErrorIs(t, agentService.RegisterAgent(invalid), models.ErrInvalidAgent)
+}
+
+func TestAgentTemplatePropagation(t *testing.T) {
+	for _, propagate := range []bool{true, false} {
+		agentService := services.NewAgentService(zap.NewNop())
+		agentService.SetTemplatePropagation(propagate)
+		require.NoError(t, agentService.CreateTemplate(sharedTemplate("shared")))
+
+		require.NoError(t, agentService.RegisterAgent(templatedAgent("existing", "shared")))
+		require.NoError(t, agentService.SetAgentEnabled("existing", false))
+		registered, err := agentService.GetAgent("existing")
+		require.NoError(t, err)
+		createdAt := registered.CreatedAt
+
+		updatedTemplate := sharedTemplate("shared")
+		updatedTemplate.Settings.Timeout = 120
+		require.NoError(t, agentService.UpdateTemplate(updatedTemplate))
+
+		existing, err := agentService.GetAgent("existing")
+		require.NoError(t, err)
+		if propagate {
+			assert.Equal(t, 120, existing.Timeout)
+		} else {
+			assert.Equal(t, 60, existing.Timeout)
+		}
+		assert.False(t, existing.Enabled, "propagate=%v", propagate)
+		assert.Equal(t, createdAt, existing.CreatedAt)
+
+		// Agents registered after the update always see it
+		require.NoError(t, agentService.RegisterAgent(templatedAgent("later", "shared")))
+		later, err := agentService.GetAgent("later")
+		require.NoError(t, err)
+		assert.Equal(t, 120, later.Timeout)
+	}
+}
+
+func TestAgentTemplateUpdateRejectedWhenAgentBecomesInvalid(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.CreateTemplate(sharedTemplate("shared")))
+	require.NoError(t, agentService.RegisterAgent(templatedAgent("agent-1", "shared")))
+
+	// Read-write agents cannot run four executions at once
+	updatedTemplate := sharedTemplate("shared")
+	updatedTemplate.Settings.AccessType = types.ReadWriteAccessType
+	err := agentService.UpdateTemplate(updatedTemplate)
+	assert.ErrorIs(t, err, models.ErrInvalidAgent)
+	assert.Contains(t, err.Error(), "agent-1")
+
+	template, err := agentService.GetTemplate("shared")
+	require.NoError(t, err)
+	assert.Equal(t, types.ReadOnlyAccessType, template.Settings.AccessType)
+	agent, err := agentService.GetAgent("agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, types.ReadOnlyAccessType, agent.AccessType)
+}
+
+func TestAgentTemplateDeletionProtection(t *testing.T) {
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.CreateTemplate(sharedTemplate("shared")))
+	require.NoError(t, agentService.RegisterAgent(templatedAgent("agent-b", "shared")))
+	require.NoError(t, agentService.RegisterAgent(templatedAgent("agent-a", "shared")))
+
+	err := agentService.DeleteTemplate("shared")
+	assert.ErrorIs(t, err, models.ErrTemplateInUse)
+	assert.Contains(t, err.Error(), "agent-a, agent-b")
+
+	// Updating an agent to stand alone releases the template
+	standalone, err := agentService.GetAgent("agent-a")
+	require.NoError(t, err)
+	detached := *standalone
+	detached.Template = ""
+	require.NoError(t, agentService.UpdateAgent(&detached))
+	require.NoError(t, agentService.DeleteAgent("agent-b"))
+
+	require.NoError(t, agentService.DeleteTemplate("shared"))
+	assert.ErrorIs(t, agentService.DeleteTemplate("shared"), models.ErrTemplateNotFound)
+	templates, err := agentService.ListTemplates()
+	require.NoError(t, err)
+	assert.Empty(t, templates)
+}
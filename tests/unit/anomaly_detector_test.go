@@ -0,0 +1,107 @@
+package unit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// anomalyRuns returns count runs of the task's agent, one a minute from start, each taking duration
+func anomalyRuns(start time.Time, count int, duration time.Duration, status types.ExecutionStatus) []*models.ExecutionHistory {
+	runs := make([]*models.ExecutionHistory, 0, count)
+	for i := 0; i < count; i++ {
+		startTime := start.Add(time.Duration(i) * time.Minute)
+		runs = append(runs, &models.ExecutionHistory{
+			ID:              fmt.Sprintf("history-%d", i),
+			ExecutionID:     fmt.Sprintf("exec-%d", i),
+			TaskID:          "nightly",
+			AgentID:         "reporter",
+			StartTime:       startTime,
+			EndTime:         startTime.Add(duration),
+			Status:          status,
+			ExecutionTimeMs: duration.Milliseconds(),
+		})
+	}
+	return runs
+}
+
+func TestAnomalyDetectorFlagsLongDuration(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	detector := services.NewAnomalyDetector(services.DefaultAnomalyConfig())
+	detector.Seed(anomalyRuns(start, 20, time.Second, types.SuccessStatus))
+
+	// A 30s run against a history of 1s runs is flagged against both the agent and the task
+	slow := anomalyRuns(start.Add(time.Hour), 1, 30*time.Second, types.SuccessStatus)[0]
+	flags, appeared := detector.Observe(slow)
+	assert.Equal(t, []string{models.AnomalyDurationHigh}, flags)
+	require.Len(t, appeared, 2)
+	assert.Equal(t, models.AnomalyScopeAgent, appeared[0].Scope)
+	assert.Equal(t, models.AnomalyScopeTask, appeared[1].Scope)
+	assert.Equal(t, int64(30000), appeared[0].ExecutionTimeMs)
+	assert.Equal(t, 1000.0, appeared[0].BaselineMeanMs)
+	assert.Equal(t, 20, appeared[0].Samples)
+
+	// A run in line with the history is not
+	flags, appeared = detector.Observe(anomalyRuns(start.Add(2*time.Hour), 1, 1100*time.Millisecond, types.SuccessStatus)[0])
+	assert.Empty(t, flags)
+	assert.Empty(t, appeared)
+
+	// Nothing is flagged until a baseline has enough samples
+	fresh := services.NewAnomalyDetector(services.DefaultAnomalyConfig())
+	fresh.Seed(anomalyRuns(start, 5, time.Second, types.SuccessStatus))
+	flags, _ = fresh.Observe(slow)
+	assert.Empty(t, flags)
+}
+
+func TestAnomalyDetectorFailureRateCrossing(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := services.DefaultAnomalyConfig()
+	config.Window = 10
+	config.MinSamples = 10
+	detector := services.NewAnomalyDetector(config)
+	detector.Seed(anomalyRuns(start, 10, time.Second, types.SuccessStatus))
+
+	// Failures are flagged once half of the window failed, and the anomaly appears only when the rate
+	// crosses the threshold
+	var appearedCount int
+	for i := 0; i < 5; i++ {
+		flags, appeared := detector.Observe(anomalyRuns(start.Add(time.Hour), 1, time.Second, types.FailureStatus)[0])
+		if i < 4 {
+			assert.Empty(t, flags, "failure %d", i+1)
+		} else {
+			assert.Equal(t, []string{models.AnomalyFailureRateHigh}, flags)
+		}
+		appearedCount += len(appeared)
+	}
+	assert.Equal(t, 2, appearedCount)
+
+	flags, appeared := detector.Observe(anomalyRuns(start.Add(time.Hour), 1, time.Second, types.FailureStatus)[0])
+	assert.Equal(t, []string{models.AnomalyFailureRateHigh}, flags)
+	assert.Empty(t, appeared)
+
+	// Once the rate fell back, crossing it again is a new anomaly
+	for i := 0; i < 10; i++ {
+		detector.Observe(anomalyRuns(start.Add(2*time.Hour), 1, time.Second, types.SuccessStatus)[0])
+	}
+	for i := 0; i < 5; i++ {
+		flags, appeared = detector.Observe(anomalyRuns(start.Add(3*time.Hour), 1, time.Second, types.FailureStatus)[0])
+	}
+	assert.Equal(t, []string{models.AnomalyFailureRateHigh}, flags)
+	assert.Len(t, appeared, 2)
+}
+
+func TestCalculateExecutionStatsDeviation(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	histories := append(anomalyRuns(start, 2, time.Second, types.SuccessStatus), anomalyRuns(start, 2, 3*time.Second, types.FailureStatus)...)
+
+	stats := models.CalculateExecutionStats(histories)
+	assert.Equal(t, 2000.0, stats.AverageTimeMs)
+	assert.Equal(t, 1000.0, stats.StdDevTimeMs)
+	assert.Equal(t, 0.5, stats.FailureRate)
+}
@@ -0,0 +1,50 @@
+package unit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAuditLogContinuesChainAcrossRotationAndRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// A tiny size limit rotates the file every few entries
+	auditLog, err := services.NewAuditLog(path, 1024, 10, zap.NewNop())
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, auditLog.Record(&models.AuditEntry{Actor: "ip:127.0.0.1", Action: "agents.create"}))
+	}
+	require.NoError(t, auditLog.Close())
+
+	reopened, err := services.NewAuditLog(path, 1024, 10, zap.NewNop())
+	require.NoError(t, err)
+	defer reopened.Close()
+	entry := &models.AuditEntry{Actor: "ip:127.0.0.1", Action: "agents.delete"}
+	require.NoError(t, reopened.Record(entry))
+	assert.Equal(t, int64(5), entry.Sequence)
+
+	require.NoError(t, reopened.Verify())
+	page, err := reopened.Query(services.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 5)
+	for i, recorded := range page.Entries {
+		assert.Equal(t, int64(i+1), recorded.Sequence)
+	}
+	assert.Equal(t, page.Entries[3].Hash, page.Entries[4].PrevHash)
+}
+
+func TestAuditLogRejectsInvalidMirrorLevel(t *testing.T) {
+	auditLog, err := services.NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, 0, zap.NewNop())
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	assert.NoError(t, auditLog.SetMirrorLevel("info"))
+	assert.NoError(t, auditLog.SetMirrorLevel(""))
+	assert.Error(t, auditLog.SetMirrorLevel("loud"))
+}
@@ -0,0 +1,231 @@
+package unit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseDateRange(t *testing.T) {
+	dates, err := models.ParseDateRange("2026-12-25")
+	require.NoError(t, err)
+	assert.Equal(t, models.DateRange{Start: "2026-12-25"}, dates)
+	assert.True(t, dates.Contains("2026-12-25"))
+	assert.False(t, dates.Contains("2026-12-26"))
+
+	dates, err = models.ParseDateRange(" 2026-12-24..2026-12-26 ")
+	require.NoError(t, err)
+	assert.Equal(t, "2026-12-24..2026-12-26", dates.String())
+	assert.True(t, dates.Contains("2026-12-26"))
+	assert.False(t, dates.Contains("2026-12-23"))
+
+	for _, text := range []string{"", "2026-13-01", "25/12/2026", "2026-12-26..2026-12-24", "2026-12-24..soon"} {
+		_, err := models.ParseDateRange(text)
+		assert.Error(t, err, text)
+	}
+
+	// JSON takes ranges as objects or as strings
+	var ranges []models.DateRange
+	require.NoError(t, json.Unmarshal([]byte(`["2026-01-01", {"start": "2026-12-24", "end": "2026-12-26", "reason": "Christmas"}]`), &ranges))
+	assert.Equal(t, []models.DateRange{
+		{Start: "2026-01-01"},
+		{Start: "2026-12-24", End: "2026-12-26", Reason: "Christmas"},
+	}, ranges)
+	assert.Error(t, json.Unmarshal([]byte(`["2026-02-30"]`), &ranges))
+}
+
+func TestCalendarValidateAndExcludes(t *testing.T) {
+	calendar := &models.Calendar{Name: "holidays", Dates: []models.DateRange{
+		{Start: "2026-12-24", End: "2026-12-26", Reason: "Christmas"},
+		{Start: "2027-01-01"},
+	}}
+	require.NoError(t, calendar.Validate())
+
+	// The day is the one of the time's own zone
+	tokyo := time.FixedZone("UTC+9", 9*60*60)
+	dates, excluded := calendar.Excludes(time.Date(2026, 12, 23, 20, 0, 0, 0, time.UTC).In(tokyo))
+	assert.True(t, excluded)
+	assert.Equal(t, "Christmas", dates.Reason)
+	_, excluded = calendar.Excludes(time.Date(2026, 12, 23, 20, 0, 0, 0, time.UTC))
+	assert.False(t, excluded)
+
+	invalid := &models.Calendar{Name: "a/b", Dates: []models.DateRange{{Start: "tomorrow"}}}
+	var errs models.ValidationErrors
+	require.ErrorAs(t, invalid.Validate(), &errs)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "name", errs[0].Field)
+	assert.Equal(t, "dates[0]", errs[1].Field)
+}
+
+func TestParseICalendar(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20261225\r\n" +
+		"DTEND;VALUE=DATE:20261226\r\n" +
+		"SUMMARY:Christmas\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20261231\r\n" +
+		"DTEND;VALUE=DATE:20270103\r\n" +
+		"SUMMARY:Year-end \r\n" +
+		" shutdown\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART:20270115T090000Z\r\n" +
+		"DTEND:20270115T170000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	dates, err := definitions.ParseICalendar([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, []models.DateRange{
+		{Start: "2026-12-25", Reason: "Christmas"},
+		{Start: "2026-12-31", End: "2027-01-02", Reason: "Year-end shutdown"},
+		{Start: "2027-01-15"},
+	}, dates)
+
+	_, err = definitions.ParseICalendar([]byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20261225\nRRULE:FREQ=YEARLY\nEND:VEVENT\nEND:VCALENDAR\n"))
+	assert.ErrorContains(t, err, "RRULE")
+	_, err = definitions.ParseICalendar([]byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:soon\nEND:VEVENT\nEND:VCALENDAR\n"))
+	assert.ErrorContains(t, err, "DTSTART")
+	_, err = definitions.ParseICalendar([]byte("- 2026-12-25\n"))
+	assert.ErrorContains(t, err, "VCALENDAR")
+}
+
+func TestParseDateList(t *testing.T) {
+	dates, err := definitions.ParseDateList([]byte(`
+- 2026-01-01
+- 2026-12-24..2026-12-26
+- start: 2026-07-03
+  reason: Independence Day observed
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []models.DateRange{
+		{Start: "2026-01-01"},
+		{Start: "2026-12-24", End: "2026-12-26"},
+		{Start: "2026-07-03", Reason: "Independence Day observed"},
+	}, dates)
+
+	_, err = definitions.ParseDateList([]byte("- 2026-01-01\n- never\n"))
+	assert.ErrorContains(t, err, "entry 1")
+	_, err = definitions.ParseDateList([]byte("holidays: 2026-01-01\n"))
+	assert.Error(t, err)
+}
+
+func TestLoadCalendar(t *testing.T) {
+	dir := t.TempDir()
+	icalFile := filepath.Join(dir, "holidays.ics")
+	require.NoError(t, os.WriteFile(icalFile, []byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20261225\nSUMMARY:Christmas\nEND:VEVENT\nEND:VCALENDAR\n"), 0o644))
+	datesFile := filepath.Join(dir, "blackout.yaml")
+	require.NoError(t, os.WriteFile(datesFile, []byte("- 2026-11-27\n"), 0o644))
+
+	calendar, err := definitions.LoadCalendar(config.CalendarConfig{
+		Name:      "exchange",
+		Dates:     []string{"2026-01-01"},
+		ICalFile:  icalFile,
+		DatesFile: datesFile,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "exchange", calendar.Name)
+	assert.Equal(t, []models.DateRange{
+		{Start: "2026-01-01"},
+		{Start: "2026-12-25", Reason: "Christmas"},
+		{Start: "2026-11-27"},
+	}, calendar.Dates)
+
+	_, err = definitions.LoadCalendar(config.CalendarConfig{Name: "missing", ICalFile: filepath.Join(dir, "missing.ics")})
+	assert.Error(t, err)
+}
+
+func TestCalendarServiceDeleteInUse(t *testing.T) {
+	scheduler := newSchedulerTestService(t)
+	calendars := services.NewCalendarService(zap.NewNop())
+	calendars.SetSchedulerService(scheduler)
+	scheduler.SetCalendarService(calendars)
+
+	require.NoError(t, calendars.CreateCalendar(&models.Calendar{Name: "holidays", Dates: []models.DateRange{{Start: "2026-12-25"}}}))
+	assert.ErrorIs(t, calendars.CreateCalendar(&models.Calendar{Name: "holidays"}), models.ErrCalendarConflict)
+
+	// Tasks can only skip calendars that exist
+	err := scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "skipping", Name: "skipping", AgentID: "sched-agent", CronExpression: "0 9 * * *", SkipCalendars: []string{"holidays", "unknown"},
+	})
+	var errs models.ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "skip_calendars[1]", errs[0].Field)
+	assert.Equal(t, models.ValidationNotFound, errs[0].Code)
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "skipping", Name: "skipping", AgentID: "sched-agent", CronExpression: "0 9 * * *", SkipCalendars: []string{"holidays"},
+	}))
+
+	assert.ErrorIs(t, calendars.DeleteCalendar("holidays"), models.ErrCalendarInUse)
+	require.NoError(t, scheduler.UnscheduleTask("skipping"))
+	require.NoError(t, calendars.DeleteCalendar("holidays"))
+	assert.ErrorIs(t, calendars.DeleteCalendar("holidays"), models.ErrCalendarNotFound)
+}
+
+func TestSchedulerService_NextRunsSkipExcludedDays(t *testing.T) {
+	scheduler := newSchedulerTestService(t)
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	scheduler.SetLocation(zone)
+	calendars := services.NewCalendarService(zap.NewNop())
+	scheduler.SetCalendarService(calendars)
+
+	// A calendar holding tomorrow, and a task running every day at 09:30
+	now := time.Now().In(zone)
+	first := time.Date(now.Year(), now.Month(), now.Day(), 9, 30, 0, 0, zone)
+	if !first.After(now) {
+		first = first.AddDate(0, 0, 1)
+	}
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, zone).Format(models.CalendarDateLayout)
+	require.NoError(t, calendars.CreateCalendar(&models.Calendar{Name: "holidays", Dates: []models.DateRange{{Start: tomorrow, Reason: "Holiday"}}}))
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID: "daily", Name: "Daily", AgentID: "sched-agent", CronExpression: "30 9 * * *", SkipCalendars: []string{"holidays"},
+	}))
+
+	var expected []time.Time
+	for day := first; len(expected) < 3; day = day.AddDate(0, 0, 1) {
+		if day.Format(models.CalendarDateLayout) != tomorrow {
+			expected = append(expected, day)
+		}
+	}
+
+	runs, err := scheduler.NextRuns("daily", 3)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	for i, run := range runs {
+		assert.True(t, expected[i].Equal(run), "run %d: expected %s, got %s", i, expected[i], run)
+		assert.NotEqual(t, tomorrow, run.Format(models.CalendarDateLayout))
+	}
+
+	next, err := scheduler.GetNextRun("daily")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.True(t, expected[0].Equal(*next))
+
+	// Calendars that do not exist exclude nothing
+	exclusion, excluded := calendars.Exclusion([]string{"unknown", "holidays"}, time.Date(now.Year(), now.Month(), now.Day()+1, 12, 0, 0, 0, zone))
+	require.True(t, excluded)
+	assert.Equal(t, tomorrow+" is excluded by calendar holidays (Holiday)", exclusion.String())
+
+	// A calendar excluding every day leaves no upcoming runs rather than looping
+	require.NoError(t, calendars.UpdateCalendar(&models.Calendar{Name: "holidays", Dates: []models.DateRange{{Start: "2000-01-01", End: "2999-12-31"}}}))
+	runs, err = scheduler.NextRuns("daily", 3)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+	next, err = scheduler.GetNextRun("daily")
+	require.NoError(t, err)
+	assert.Nil(t, next)
+}
@@ -0,0 +1,172 @@
+package unit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// drainEvents reads the subscription until no event arrives for a while, counting the events and
+// the events the drop notices report
+func drainEvents(t *testing.T, subscription *services.EventSubscription, pause time.Duration) (events, dropped uint64, lastID uint64) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		event, err := subscription.Next(ctx)
+		cancel()
+		if err != nil {
+			return events, dropped, lastID
+		}
+		if event.Type == models.EventEventsDropped {
+			dropped += event.Data.(models.EventsDropped).DroppedCount
+			continue
+		}
+		assert.Greater(t, event.ID, lastID, "events arrive in publish order")
+		lastID = event.ID
+		events++
+		if pause > 0 {
+			time.Sleep(pause)
+		}
+	}
+}
+
+func TestEventBusSlowSubscriberNeverBlocksPublishers(t *testing.T) {
+	bus := services.NewEventBus(zap.NewNop())
+	slow, err := bus.Subscribe(services.SubscriptionOptions{SubscriberType: "slow", BufferSize: 64})
+	require.NoError(t, err)
+	defer slow.Close()
+	fast, err := bus.Subscribe(services.SubscriptionOptions{SubscriberType: "fast", BufferSize: 10000})
+	require.NoError(t, err)
+	defer fast.Close()
+
+	// The slow subscriber reads one event per millisecond while 10k are published
+	type drained struct{ events, dropped uint64 }
+	slowResult := make(chan drained, 1)
+	go func() {
+		events, dropped, _ := drainEvents(t, slow, time.Millisecond)
+		slowResult <- drained{events, dropped}
+	}()
+
+	const total = 10000
+	var worst time.Duration
+	var worstMutex sync.Mutex
+	var publishers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		publishers.Add(1)
+		go func() {
+			defer publishers.Done()
+			for i := 0; i < total/4; i++ {
+				started := time.Now()
+				bus.Publish(models.Event{Type: models.EventExecutionState, AgentID: "agent"})
+				elapsed := time.Since(started)
+				worstMutex.Lock()
+				if elapsed > worst {
+					worst = elapsed
+				}
+				worstMutex.Unlock()
+			}
+		}()
+	}
+	publishers.Wait()
+	assert.Less(t, worst, 50*time.Millisecond, "publishing must not wait for the slow subscriber")
+
+	result := <-slowResult
+	assert.Equal(t, uint64(total), result.events+result.dropped, "every event is delivered or counted as dropped")
+	assert.Greater(t, result.dropped, uint64(0))
+
+	fastEvents, fastDropped, _ := drainEvents(t, fast, 0)
+	assert.Equal(t, uint64(total), fastEvents)
+	assert.Zero(t, fastDropped)
+
+	stats := bus.Stats()
+	assert.Equal(t, uint64(total), stats.Published)
+	assert.Equal(t, result.events, stats.SubscriberTypes["slow"].Delivered)
+	assert.Equal(t, result.dropped, stats.SubscriberTypes["slow"].Dropped)
+	assert.Equal(t, uint64(total), stats.SubscriberTypes["fast"].Delivered)
+	assert.Zero(t, stats.SubscriberTypes["fast"].Dropped)
+}
+
+func TestEventBusDropNoticePrecedesRemainingEvents(t *testing.T) {
+	bus := services.NewEventBus(zap.NewNop())
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{BufferSize: 3})
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(models.Event{Type: models.EventTaskRun})
+	}
+
+	notice, err := subscription.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, models.EventEventsDropped, notice.Type)
+	assert.Equal(t, models.EventsDropped{DroppedCount: 7}, notice.Data)
+	for _, id := range []uint64{8, 9, 10} {
+		event, err := subscription.Next(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, id, event.ID, "the oldest events are dropped")
+	}
+	current := bus.Stats().Subscriptions[0]
+	assert.Equal(t, uint64(3), current.Delivered)
+	assert.Equal(t, uint64(7), current.Dropped)
+}
+
+func TestEventBusDisconnectsLaggingSubscriber(t *testing.T) {
+	bus := services.NewEventBus(zap.NewNop())
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{
+		SubscriberType: "sse",
+		BufferSize:     4,
+		Overflow:       services.EventOverflowDisconnect,
+		LagLimit:       6,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(models.Event{Type: models.EventTaskRun})
+	}
+
+	// The 7th unread event exceeds the lag limit; everything published up to it is dropped
+	notice, err := subscription.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, models.EventsDropped{DroppedCount: 7}, notice.Data)
+	_, err = subscription.Next(context.Background())
+	assert.ErrorIs(t, err, services.ErrSubscriberLagging)
+
+	subscription.Close()
+	stats := bus.Stats()
+	assert.Empty(t, stats.Subscriptions)
+	assert.Equal(t, models.EventSubscriberStats{Dropped: 7, Disconnected: 1}, stats.SubscriberTypes["sse"])
+}
+
+func TestEventBusFiltersAndValidation(t *testing.T) {
+	bus := services.NewEventBus(zap.NewNop())
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{Types: []string{models.EventTaskRun}, AgentID: "a"})
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	bus.Publish(models.Event{Type: models.EventExecutionState, AgentID: "a"})
+	bus.Publish(models.Event{Type: models.EventTaskRun, AgentID: "b"})
+	bus.Publish(models.Event{Type: models.EventTaskRun, AgentID: "a", TaskID: "task"})
+
+	event, err := subscription.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "task", event.TaskID)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = subscription.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = bus.Subscribe(services.SubscriptionOptions{BufferSize: services.MaxEventBufferSize + 1})
+	assert.Error(t, err)
+	_, err = bus.Subscribe(services.SubscriptionOptions{Overflow: "block"})
+	assert.Error(t, err)
+
+	// Publishing without a bus is a no-op
+	var none *services.EventBus
+	none.Publish(models.Event{Type: models.EventTaskRun})
+}
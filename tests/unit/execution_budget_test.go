@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// flakyAgent fails every attempt with a transient error after running for attemptTime, or earlier
+// when the attempt's context is done
+type flakyAgent struct {
+	config      *models.AgentConfiguration
+	attemptTime time.Duration
+	attempts    atomic.Int32
+}
+
+func newFlakyAgent(id string, timeout int, attemptTime time.Duration) *flakyAgent {
+	return &flakyAgent{
+		config: &models.AgentConfiguration{
+			ID: id, Name: id, AgentType: "test-type", ExecutablePath: "/bin/true",
+			AccessType: models.ReadOnlyAccessType, MaxConcurrentExecutions: 1, Mode: models.TaskMode,
+			InputPattern: models.StdinPattern, OutputPattern: models.StdoutPattern, Timeout: timeout, Enabled: true,
+		},
+		attemptTime: attemptTime,
+	}
+}
+
+func (a *flakyAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
+	a.attempts.Add(1)
+	select {
+	case <-time.After(a.attemptTime):
+	case <-ctx.Done():
+	}
+	return nil, errors.New("backend temporarily unavailable")
+}
+
+func (a *flakyAgent) GetID() string                         { return a.config.ID }
+func (a *flakyAgent) GetName() string                       { return a.config.Name }
+func (a *flakyAgent) GetType() string                       { return a.config.AgentType }
+func (a *flakyAgent) IsReadOnly() bool                      { return true }
+func (a *flakyAgent) GetConfig() *models.AgentConfiguration { return a.config }
+func (a *flakyAgent) Validate() error                       { return nil }
+
+func TestRetriesShareTheExecutionBudget(t *testing.T) {
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+	agent := newFlakyAgent("flaky-agent", 5, 2*time.Second)
+
+	// Two 2s attempts and the 1s wait between them spend the 5s budget; the third retry the
+	// execution allows is abandoned
+	start := time.Now()
+	execution, err := executionService.ExecuteAgent(context.Background(), agent, "input")
+	require.Error(t, err)
+	assert.LessOrEqual(t, agent.attempts.Load(), int32(2))
+	assert.Less(t, time.Since(start), 6*time.Second)
+	assert.Regexp(t, `retries abandoned: [0-9.]+m?s remaining of 5s budget`, err.Error())
+	assert.Contains(t, err.Error(), "temporarily unavailable")
+	assert.EqualValues(t, models.FailedState, execution.State)
+}
+
+func TestAttemptDeadlineIsCappedByTheRemainingBudget(t *testing.T) {
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+	executionService.SetMinAttemptDuration(500 * time.Millisecond)
+	agent := newFlakyAgent("blocking-agent", 30, time.Minute)
+
+	// The caller's 1.5s deadline is the budget: the attempt stops with it rather than after the
+	// agent's 30s timeout, and nothing is left to retry in
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := executionService.ExecuteAgent(ctx, agent, "input")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, int32(1), agent.attempts.Load())
+	assert.Contains(t, err.Error(), "remaining of 1.5s budget")
+}
+
+func TestExecutionDefaultsApplyToAgentsWithoutTheirOwn(t *testing.T) {
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+	executionService.SetExecutionDefaults(services.ExecutionDefaults{MaxRetries: 2, RetryBackoff: 10 * time.Millisecond})
+
+	// The default retry policy replaces three attempts one second apart
+	agent := newFlakyAgent("quick-flaky-agent", 0, 0)
+	start := time.Now()
+	execution, err := executionService.ExecuteAgent(context.Background(), agent, "input")
+	require.Error(t, err)
+	assert.Equal(t, int32(2), agent.attempts.Load())
+	assert.Equal(t, 2, execution.MaxRetries)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Agents without a timeout get the default one
+	executionService.SetExecutionDefaults(services.ExecutionDefaults{Timeout: time.Second, MaxRetries: 3, RetryBackoff: 10 * time.Millisecond})
+	blocking := newFlakyAgent("untimed-agent", 0, time.Minute)
+	start = time.Now()
+	execution, err = executionService.ExecuteAgent(context.Background(), blocking, "input")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	assert.Equal(t, int32(1), blocking.attempts.Load())
+	assert.Equal(t, 1, execution.Timeout)
+	assert.Contains(t, err.Error(), "of 1s budget")
+}
+
+func TestRetryBackoffEndsWithTheContext(t *testing.T) {
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+	executionService.SetExecutionDefaults(services.ExecutionDefaults{MaxRetries: 3, RetryBackoff: time.Minute})
+	agent := newFlakyAgent("backoff-agent", 0, 0)
+
+	// The caller giving up during the minute-long wait ends the execution without another attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := executionService.ExecuteAgent(ctx, agent, "input")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, int32(1), agent.attempts.Load())
+}
@@ -0,0 +1,214 @@
+package unit
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/internal/storage"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// historyBackends returns a fresh repository for every supported backend
+func historyBackends(t *testing.T) map[string]models.ExecutionHistoryRepository {
+	sqliteRepo, err := storage.NewSQLiteExecutionHistoryRepository(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqliteRepo.Close() })
+
+	return map[string]models.ExecutionHistoryRepository{
+		storage.HistoryBackendMemory: models.NewInMemoryExecutionHistoryRepository(),
+		storage.HistoryBackendSQLite: sqliteRepo,
+	}
+}
+
+// newHistoryRecord creates a record for taskID that started at start
+func newHistoryRecord(id, taskID string, status types.ExecutionStatus, start time.Time) *models.ExecutionHistory {
+	return &models.ExecutionHistory{
+		ID:              id,
+		TaskID:          taskID,
+		ExecutionID:     "exec-" + id,
+		StartTime:       start,
+		EndTime:         start.Add(time.Second),
+		Status:          status,
+		Input:           "input " + id,
+		Output:          "output " + id,
+		ExecutionTimeMs: 1000,
+		TriggerType:     types.TaskTriggerTypeScheduled,
+		TriggeredBy:     "scheduler:" + taskID,
+		CreatedAt:       start,
+	}
+}
+
+// historyIDs returns the IDs of histories in order
+func historyIDs(histories []*models.ExecutionHistory) []string {
+	ids := make([]string, len(histories))
+	for i, history := range histories {
+		ids[i] = history.ID
+	}
+	return ids
+}
+
+func TestExecutionHistoryRepositoryParity(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	for name, repo := range historyBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			statuses := []types.ExecutionStatus{types.SuccessStatus, types.FailureStatus, types.SuccessStatus, types.TimeoutStatus}
+			for i, status := range statuses {
+				require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord(fmt.Sprintf("h%d", i), "task-a", status, base.Add(time.Duration(i)*time.Minute))))
+			}
+			require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord("other", "task-b", types.SuccessStatus, base.Add(30*time.Second))))
+
+			// Invalid records are rejected
+			assert.Error(t, repo.StoreExecutionHistory(&models.ExecutionHistory{TaskID: "task-a"}))
+
+			histories, err := repo.GetExecutionHistory("task-a", 0)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h0", "h1", "h2", "h3"}, historyIDs(histories))
+
+			histories, err = repo.GetExecutionHistory("task-a", 2)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h2", "h3"}, historyIDs(histories))
+
+			histories, err = repo.GetExecutionHistory("missing", 10)
+			require.NoError(t, err)
+			assert.Empty(t, histories)
+
+			histories, err = repo.GetExecutionHistoryByTaskAndStatus("task-a", types.SuccessStatus, 0)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h0", "h2"}, historyIDs(histories))
+
+			histories, err = repo.GetExecutionHistoryByTaskAndStatus("task-a", types.SuccessStatus, 1)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h2"}, historyIDs(histories))
+
+			// Bounds are exclusive and results are newest first
+			histories, err = repo.GetExecutionHistoryByTimeRange(base, base.Add(3*time.Minute), 0)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h2", "h1", "other"}, historyIDs(histories))
+
+			histories, err = repo.GetExecutionHistoryByTimeRange(base.Add(-time.Second), base.Add(time.Hour), 2)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h3", "h2"}, historyIDs(histories))
+
+			latest, err := repo.GetLatestExecutionHistory("task-a")
+			require.NoError(t, err)
+			require.NotNil(t, latest)
+			assert.Equal(t, "h3", latest.ID)
+			assert.Equal(t, types.TimeoutStatus, latest.Status)
+			assert.Equal(t, "output h3", latest.Output)
+			assert.True(t, latest.StartTime.Equal(base.Add(3*time.Minute)))
+			assert.True(t, latest.EndTime.Equal(base.Add(3*time.Minute+time.Second)))
+
+			latest, err = repo.GetLatestExecutionHistory("missing")
+			require.NoError(t, err)
+			assert.Nil(t, latest)
+
+			deleted, err := repo.DeleteExecutionHistoryBefore(base.Add(90 * time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, 3, deleted)
+
+			histories, err = repo.GetExecutionHistory("task-a", 0)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"h2", "h3"}, historyIDs(histories))
+
+			require.NoError(t, repo.DeleteExecutionHistory("task-a"))
+			histories, err = repo.GetExecutionHistory("task-a", 0)
+			require.NoError(t, err)
+			assert.Empty(t, histories)
+		})
+	}
+}
+
+func TestExecutionHistoryRepositoryLabels(t *testing.T) {
+	for name, repo := range historyBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			record := newHistoryRecord("labelled", "task-l", types.SuccessStatus, time.Now())
+			record.Labels = map[string]string{"team": "infra", "env": "prod"}
+			require.NoError(t, repo.StoreExecutionHistory(record))
+			require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord("plain", "task-l", types.SuccessStatus, time.Now())))
+
+			histories, err := repo.GetExecutionHistory("task-l", 0)
+			require.NoError(t, err)
+			require.Len(t, histories, 2)
+			assert.Equal(t, record.Labels, histories[0].Labels)
+			assert.Empty(t, histories[1].Labels)
+		})
+	}
+}
+
+func TestExecutionHistoryRepositoryScheduleDrift(t *testing.T) {
+	for name, repo := range historyBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			planned := time.Now().Truncate(time.Second)
+			record := newHistoryRecord("late", "task-d", types.SuccessStatus, planned.Add(1500*time.Millisecond))
+			record.PlannedTime = &planned
+			record.DriftMs = 1500
+			require.NoError(t, repo.StoreExecutionHistory(record))
+			require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord("manual", "task-d", types.SuccessStatus, time.Now())))
+
+			histories, err := repo.GetExecutionHistory("task-d", 0)
+			require.NoError(t, err)
+			require.Len(t, histories, 2)
+			require.NotNil(t, histories[0].PlannedTime)
+			assert.True(t, planned.Equal(*histories[0].PlannedTime))
+			assert.Equal(t, int64(1500), histories[0].DriftMs)
+			assert.Nil(t, histories[1].PlannedTime, "runs not fired by the schedule have no planned time")
+			assert.Zero(t, histories[1].DriftMs)
+		})
+	}
+}
+
+func TestSQLiteExecutionHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "history.db")
+
+	repo, err := storage.NewSQLiteExecutionHistoryRepository(path)
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord("persisted", "task-p", types.FailureStatus, time.Now())))
+	require.NoError(t, repo.Close())
+
+	// Reopening applies no migrations twice and keeps existing rows
+	repo, err = storage.NewSQLiteExecutionHistoryRepository(path)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	latest, err := repo.GetLatestExecutionHistory("task-p")
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, "persisted", latest.ID)
+	assert.Equal(t, types.FailureStatus, latest.Status)
+	assert.Equal(t, types.TaskTriggerTypeScheduled, latest.TriggerType)
+	assert.Equal(t, "scheduler:task-p", latest.TriggeredBy)
+}
+
+func TestNewExecutionHistoryRepository(t *testing.T) {
+	repo, err := storage.NewExecutionHistoryRepository("", "")
+	require.NoError(t, err)
+	assert.IsType(t, &models.InMemoryExecutionHistoryRepository{}, repo)
+
+	_, err = storage.NewExecutionHistoryRepository(storage.HistoryBackendSQLite, "")
+	assert.Error(t, err)
+
+	_, err = storage.NewExecutionHistoryRepository("postgres", "")
+	assert.Error(t, err)
+}
+
+func TestHistoryRetentionJobRunOnce(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	repo := models.NewInMemoryExecutionHistoryRepository()
+	require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord("old", "task-r", types.SuccessStatus, time.Now().Add(-48*time.Hour))))
+	require.NoError(t, repo.StoreExecutionHistory(newHistoryRecord("new", "task-r", types.SuccessStatus, time.Now())))
+
+	job := services.NewHistoryRetentionJob(repo, 24*time.Hour, time.Hour, logger)
+	assert.Equal(t, 1, job.RunOnce())
+
+	histories, err := repo.GetExecutionHistory("task-r", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new"}, historyIDs(histories))
+}
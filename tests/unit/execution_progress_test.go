@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	progress, ok := agents.ParseProgressLine([]byte(`@@progress {"percent": 42, "message": "indexing"}` + "\n"))
+	require.True(t, ok)
+	assert.Equal(t, 42.0, progress.Percent)
+	assert.Equal(t, "indexing", progress.Message)
+	assert.False(t, progress.UpdatedAt.IsZero())
+
+	progress, ok = agents.ParseProgressLine([]byte(`@@progress {"percent": 7.5}` + "\r\n"))
+	require.True(t, ok)
+	assert.Equal(t, 7.5, progress.Percent)
+	assert.Empty(t, progress.Message)
+
+	for _, line := range []string{
+		`progress {"percent": 42}`,
+		`@@progress`,
+		`@@progress {"percent": 42`,
+		`@@progress {"message": "no percent"}`,
+		`@@progress {"percent": 101}`,
+		`@@progress {"percent": -1}`,
+		`@@progress {"percent": "42"}`,
+		` @@progress {"percent": 42}`,
+	} {
+		_, ok := agents.ParseProgressLine([]byte(line))
+		assert.False(t, ok, line)
+	}
+}
+
+func TestProgressMarkersLeaveStderr(t *testing.T) {
+	// The last marker has no newline and is only seen once the agent exits
+	path := writeAgentScript(t, `echo "starting" >&2
+echo '@@progress {"percent": 10, "message": "fetching"}' >&2
+echo output
+printf '@@progress {"percent": 50' >&2
+printf ', "message": "halfway"}\n' >&2
+echo '@@progress {"percent": oops}' >&2
+printf '@@prog' >&2
+printf 'ressive mood\n' >&2
+printf '@@progress {"percent": 100, "message": "done"}' >&2
+`)
+	config := scriptAgentConfig("progress-agent", path)
+
+	var mutex sync.Mutex
+	var reports []models.ExecutionProgress
+	ctx := agents.WithProgressReporter(context.Background(), func(progress models.ExecutionProgress) {
+		mutex.Lock()
+		reports = append(reports, progress)
+		mutex.Unlock()
+	})
+	result, err := agents.NewGenericAgent(config, zap.NewNop()).Execute(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, "output")
+
+	// Malformed markers and lines merely starting like one stay ordinary stderr
+	assert.Equal(t, "starting\n@@progress {\"percent\": oops}\n@@progressive mood\n", result.Stderr)
+	require.Len(t, reports, 3)
+	assert.Equal(t, []float64{10, 50, 100}, []float64{reports[0].Percent, reports[1].Percent, reports[2].Percent})
+	assert.Equal(t, "halfway", reports[1].Message)
+
+	// Without a reporter the markers are kept
+	result, err = agents.NewGenericAgent(config, zap.NewNop()).Execute(context.Background(), "")
+	require.NoError(t, err)
+	assert.Contains(t, result.Stderr, `@@progress {"percent": 10, "message": "fetching"}`)
+}
+
+func TestExecutionServiceRecordsProgress(t *testing.T) {
+	path := writeAgentScript(t, `echo '@@progress {"percent": 25, "message": "reading"}' >&2
+echo working
+echo '@@progress {"percent": 75, "message": "writing"}' >&2
+echo "warning: slow disk" >&2
+echo '@@progress {"percent": 100, "message": "done"}' >&2
+`)
+	config := scriptAgentConfig("progress-agent", path)
+
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(config))
+	executionService := services.NewExecutionService(agentService, zap.NewNop())
+	bus := services.NewEventBus(zap.NewNop())
+	executionService.SetEventBus(bus)
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{BufferSize: 64, Types: []string{models.EventExecutionProgress}})
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	var observed []string
+	ctx := services.WithProgressObserver(context.Background(), func(executionID string, progress models.ExecutionProgress) {
+		observed = append(observed, progress.Message)
+	})
+	execution, err := executionService.ExecuteAgent(ctx, agents.NewGenericAgent(config, zap.NewNop()), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reading", "writing", "done"}, observed)
+
+	require.NotNil(t, execution.Progress)
+	assert.Equal(t, 100.0, execution.Progress.Percent)
+	assert.Equal(t, "done", execution.Progress.Message)
+	stored, err := executionService.GetExecution(execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, execution.Progress, stored.Progress)
+
+	result, err := executionService.GetExecutionResult(execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "warning: slow disk\n", result.Stderr)
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, message := range observed {
+		event, err := subscription.Next(waitCtx)
+		require.NoError(t, err)
+		assert.Equal(t, execution.ID, event.ExecutionID)
+		progress, ok := event.Data.(models.ExecutionProgress)
+		require.True(t, ok)
+		assert.Equal(t, message, progress.Message)
+	}
+}
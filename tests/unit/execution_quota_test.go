@@ -0,0 +1,77 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestExecutionQuotaLimits(t *testing.T) {
+	quota := services.NewExecutionQuota(1, map[string]int{"vip": 2})
+
+	require.NoError(t, quota.Acquire("client"))
+	assert.True(t, errors.Is(quota.Acquire("client"), services.ErrExecutionQuotaExceeded))
+
+	require.NoError(t, quota.Acquire("vip"))
+	require.NoError(t, quota.Acquire("vip"))
+	assert.Error(t, quota.Acquire("vip"))
+
+	quota.Release("client")
+	assert.Equal(t, 0, quota.Active("client"))
+	assert.NoError(t, quota.Acquire("client"))
+
+	// Raising the limit applies to the next acquisition
+	quota.SetLimits(0, nil)
+	assert.NoError(t, quota.Acquire("client"))
+	assert.Equal(t, 2, quota.Active("client"))
+}
+
+func TestExecutionServiceEnforcesClientQuota(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	config := scriptAgentConfig("quota-agent", writeAgentScript(t, "sleep 1\n"))
+	config.MaxConcurrentExecutions = 5
+
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(config))
+	executionService := services.NewExecutionService(agentService, logger)
+	metricsCollector := services.NewMetricsCollector(logger)
+	executionService.SetMetricsCollector(metricsCollector)
+	executionService.SetExecutionQuota(services.NewExecutionQuota(1, nil))
+
+	ctx := services.WithClientID(context.Background(), "client-a")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		executionService.ExecuteAgent(ctx, agents.NewGenericAgent(config, logger), "")
+	}()
+
+	require.Eventually(t, func() bool {
+		executions, _ := executionService.GetActiveExecutions()
+		for _, execution := range executions {
+			if execution.State == models.RunningState {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err := executionService.ExecuteAgent(ctx, agents.NewGenericAgent(config, logger), "")
+	assert.True(t, errors.Is(err, services.ErrExecutionQuotaExceeded))
+	assert.Equal(t, int64(1), metricsCollector.GetRateLimitMetrics()["client-a"].ConcurrencyRejections)
+
+	// Other clients have their own quota
+	_, err = executionService.ExecuteAgent(services.WithClientID(context.Background(), "client-b"), agents.NewGenericAgent(config, logger), "")
+	assert.False(t, errors.Is(err, services.ErrExecutionQuotaExceeded))
+
+	<-done
+	_, err = executionService.ExecuteAgent(ctx, agents.NewGenericAgent(config, logger), "")
+	assert.False(t, errors.Is(err, services.ErrExecutionQuotaExceeded))
+}
@@ -163,7 +163,7 @@ func TestExecutionService_CancelExecution(t *testing.T) {
 	assert.NotNil(t, execution)
 
 	// Cancel the execution (note: this is a simplified test, actual cancellation would require more complex handling)
-	err = executionService.CancelExecution(execution.ID)
+	err = executionService.CancelExecution(execution.ID, "test", "tester")
 	// The current implementation returns an error, which is expected
 	// assert.NoError(t, err) // This would fail with current implementation
 }
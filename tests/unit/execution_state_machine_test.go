@@ -0,0 +1,173 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var allAgentStates = []types.AgentState{
+	types.IdleState, types.QueuedState, types.StartingState, types.RunningState, types.CompletedState,
+	types.FailedState, types.CleanupState, types.TimeoutState, types.CancelledState,
+}
+
+// allowedTransitions is the expected table of the default state machine
+var allowedTransitions = map[types.AgentState][]types.AgentState{
+	types.IdleState:      {types.StartingState, types.QueuedState, types.FailedState},
+	types.QueuedState:    {types.StartingState, types.FailedState, types.CancelledState},
+	types.StartingState:  {types.RunningState, types.FailedState, types.CancelledState},
+	types.RunningState:   {types.CompletedState, types.FailedState, types.TimeoutState, types.CancelledState},
+	types.CompletedState: {types.CleanupState},
+	types.FailedState:    {types.CleanupState, types.StartingState},
+	types.TimeoutState:   {types.CleanupState},
+	types.CancelledState: {types.CleanupState},
+	types.CleanupState:   {types.IdleState},
+}
+
+func isAllowed(from, to types.AgentState) bool {
+	for _, allowed := range allowedTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStateMachineTransitionTable(t *testing.T) {
+	assert.Equal(t, allowedTransitions, models.DefaultStateMachine().Transitions())
+
+	for _, from := range allAgentStates {
+		for _, to := range allAgentStates {
+			execution := &models.AgentExecution{ID: "exec-1", State: from}
+			err := execution.Transition(models.DefaultStateMachine(), to, "because", "client-a")
+
+			if isAllowed(from, to) {
+				require.NoError(t, err, "%s -> %s", from, to)
+				assert.Equal(t, to, execution.State)
+				assert.Equal(t, from, execution.PreviousState)
+				require.Len(t, execution.StateHistory, 1)
+				transition := execution.StateHistory[0]
+				assert.Equal(t, from, transition.FromState)
+				assert.Equal(t, to, transition.ToState)
+				assert.Equal(t, "because", transition.Reason)
+				assert.Equal(t, "client-a", transition.RequestedBy)
+				assert.False(t, transition.Timestamp.IsZero())
+				continue
+			}
+
+			require.Error(t, err, "%s -> %s", from, to)
+			assert.True(t, errors.Is(err, models.ErrInvalidTransition))
+			var invalid *models.InvalidTransitionError
+			require.True(t, errors.As(err, &invalid))
+			assert.Equal(t, "exec-1", invalid.ExecutionID)
+			assert.Equal(t, from, invalid.From)
+			assert.Equal(t, to, invalid.To)
+
+			// A rejected transition leaves the execution untouched
+			assert.Equal(t, from, execution.State)
+			assert.Empty(t, execution.PreviousState)
+			assert.Empty(t, execution.StateHistory)
+		}
+	}
+}
+
+func TestCustomStateMachine(t *testing.T) {
+	transitions := map[types.AgentState][]types.AgentState{
+		types.IdleState: {types.StartingState},
+	}
+	sm := models.NewStateMachine(transitions)
+
+	// The table is copied both ways
+	transitions[types.IdleState] = append(transitions[types.IdleState], types.CompletedState)
+	assert.False(t, sm.Allows(types.IdleState, types.CompletedState))
+	sm.Transitions()[types.StartingState] = []types.AgentState{types.RunningState}
+	assert.False(t, sm.Allows(types.StartingState, types.RunningState))
+
+	// States without an entry are final
+	execution := &models.AgentExecution{ID: "exec-1", State: types.IdleState}
+	require.NoError(t, execution.Transition(sm, types.StartingState, "", ""))
+	assert.ErrorIs(t, execution.Transition(sm, types.RunningState, "", ""), models.ErrInvalidTransition)
+	assert.Len(t, execution.StateHistory, 1)
+}
+
+func TestExecutionStateHistory(t *testing.T) {
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+
+	execution, err := executionService.ExecuteAgent(context.Background(), &TestAgent{}, "test input")
+	require.NoError(t, err)
+
+	var path [][2]types.AgentState
+	for _, transition := range execution.StateHistory {
+		path = append(path, [2]types.AgentState{transition.FromState, transition.ToState})
+	}
+	assert.Equal(t, [][2]types.AgentState{
+		{types.IdleState, types.StartingState},
+		{types.StartingState, types.RunningState},
+		{types.RunningState, types.CompletedState},
+	}, path)
+
+	// Finished executions cannot be moved back
+	err = executionService.UpdateExecutionState(execution.ID, types.RunningState)
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+	assert.EqualValues(t, types.CompletedState, execution.State)
+	assert.Len(t, execution.StateHistory, 3)
+}
+
+// blockingAgent runs until its context is cancelled or release is closed
+type blockingAgent struct {
+	TestAgent
+	started chan struct{}
+	release chan struct{}
+}
+
+func (ba *blockingAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
+	close(ba.started)
+	<-ba.release
+	return ba.TestAgent.Execute(ctx, input)
+}
+
+func TestCancelExecutionRecordsReason(t *testing.T) {
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+	agent := &blockingAgent{started: make(chan struct{}), release: make(chan struct{})}
+
+	done := make(chan *models.AgentExecution, 1)
+	go func() {
+		execution, _ := executionService.ExecuteAgent(context.Background(), agent, "test input")
+		done <- execution
+	}()
+	<-agent.started
+
+	active, err := executionService.GetActiveExecutions()
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	require.NoError(t, executionService.CancelExecution(active[0].ID, "agent disabled", "token:abc"))
+
+	// The agent finishing afterwards does not overwrite the cancellation
+	close(agent.release)
+	var execution *models.AgentExecution
+	select {
+	case execution = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("execution did not finish")
+	}
+	require.NotNil(t, execution)
+	assert.EqualValues(t, types.CancelledState, execution.State)
+
+	last := execution.StateHistory[len(execution.StateHistory)-1]
+	assert.Equal(t, types.RunningState, last.FromState)
+	assert.Equal(t, types.CancelledState, last.ToState)
+	assert.Equal(t, "agent disabled", last.Reason)
+	assert.Equal(t, "token:abc", last.RequestedBy)
+
+	// A second cancellation is rejected
+	assert.Error(t, executionService.CancelExecution(execution.ID, "again", "token:abc"))
+	assert.Len(t, execution.StateHistory, 3)
+}
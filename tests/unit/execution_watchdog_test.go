@@ -0,0 +1,121 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWatchdogStopsSilentAgent(t *testing.T) {
+	path := writeAgentScript(t, "echo started\nsleep 600\n")
+	config := scriptAgentConfig("silent-agent", path)
+	config.Timeout = 30
+	config.MaxSilenceSeconds = 1
+
+	agentService := services.NewAgentService(zap.NewNop())
+	require.NoError(t, agentService.RegisterAgent(config))
+	executionService := services.NewExecutionService(agentService, zap.NewNop())
+	bus := services.NewEventBus(zap.NewNop())
+	executionService.SetEventBus(bus)
+	subscription, err := bus.Subscribe(services.SubscriptionOptions{BufferSize: 64})
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	// The agent is stopped at the silence threshold, long before its timeout
+	start := time.Now()
+	execution, err := executionService.ExecuteAgent(context.Background(), agents.NewGenericAgent(config, zap.NewNop()), "")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.True(t, errors.Is(err, models.ErrAgentHung), "%v", err)
+	assert.Contains(t, err.Error(), "no output for 1s")
+	assert.Equal(t, models.HungError, string(execution.ErrorCategory))
+	assert.EqualValues(t, models.FailedState, execution.State)
+
+	// The event bus is told which execution hung
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for {
+		event, err := subscription.Next(ctx)
+		require.NoError(t, err, "no execution.hung event")
+		if event.Type != models.EventExecutionHung {
+			continue
+		}
+		assert.Equal(t, execution.ID, event.ExecutionID)
+		hung, ok := event.Data.(models.ExecutionHung)
+		require.True(t, ok)
+		assert.Equal(t, 1, hung.SilenceSeconds)
+		break
+	}
+}
+
+func TestWatchdogHeartbeatLine(t *testing.T) {
+	// Heartbeats keep an agent alive through a run longer than the silence threshold
+	path := writeAgentScript(t, "for i in 1 2 3 4 5 6; do echo ping; sleep 0.3; done\necho finished\n")
+	config := scriptAgentConfig("heartbeat-agent", path)
+	config.MaxSilenceSeconds = 1
+	config.HeartbeatLine = "ping"
+	result, err := agents.NewGenericAgent(config, zap.NewNop()).Execute(context.Background(), "")
+	require.NoError(t, err)
+	assert.Contains(t, result.Output, "finished")
+
+	// Other output does not count once the agent has a heartbeat
+	path = writeAgentScript(t, "while true; do echo working; sleep 0.2; done\n")
+	config = scriptAgentConfig("chatty-agent", path)
+	config.MaxSilenceSeconds = 1
+	config.HeartbeatLine = "ping"
+	start := time.Now()
+	_, err = agents.NewGenericAgent(config, zap.NewNop()).Execute(context.Background(), "")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.True(t, errors.Is(err, models.ErrAgentHung), "%v", err)
+	assert.Contains(t, err.Error(), "no heartbeat for 1s")
+}
+
+func TestWatchdogHeartbeatFile(t *testing.T) {
+	path := writeAgentScript(t, "for i in 1 2 3 4 5 6; do touch alive; sleep 0.3; done\necho finished\n")
+	config := scriptAgentConfig("heartbeat-file-agent", path)
+	config.WorkingDirectory = t.TempDir()
+	config.MaxSilenceSeconds = 1
+	config.HeartbeatFile = "alive"
+
+	result, err := agents.ExecuteAgentWithPattern(context.Background(), config, "")
+	require.NoError(t, err)
+	assert.Equal(t, "finished\n", result.Output)
+
+	// An agent that stops touching its heartbeat file is stopped
+	config.ExecutablePath = writeAgentScript(t, "touch alive\nsleep 600\n")
+	start := time.Now()
+	_, err = agents.ExecuteAgentWithPattern(context.Background(), config, "")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 4*time.Second)
+	assert.True(t, errors.Is(err, models.ErrAgentHung), "%v", err)
+}
+
+func TestMaxSilenceCannotExceedTimeout(t *testing.T) {
+	config := scriptAgentConfig("watchdog-agent", "/bin/true")
+	config.Timeout = 30
+	config.MaxSilenceSeconds = 60
+	errs := config.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "max_silence_seconds", errs[0].Field)
+	assert.Equal(t, models.ValidationOutOfRange, errs[0].Code)
+
+	config.MaxSilenceSeconds = 30
+	assert.Empty(t, config.ValidateFields())
+
+	// Heartbeats mean nothing without a silence threshold
+	config.MaxSilenceSeconds = 0
+	config.HeartbeatLine = "ping"
+	errs = config.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "heartbeat_line", errs[0].Field)
+	assert.Equal(t, models.ValidationConflict, errs[0].Code)
+}
@@ -0,0 +1,46 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCodeMapStatusOf(t *testing.T) {
+	exitCodes := models.ExitCodeMap{"1": types.SuccessStatus, "2-5": types.WarningStatus, "6": types.FailureStatus}
+	require.NoError(t, exitCodes.Validate())
+
+	for code, expected := range map[int]types.ExecutionStatus{1: types.SuccessStatus, 2: types.WarningStatus, 5: types.WarningStatus, 6: types.FailureStatus} {
+		status, ok := exitCodes.StatusOf(code)
+		assert.True(t, ok, code)
+		assert.Equal(t, expected, status, code)
+	}
+	_, ok := exitCodes.StatusOf(7)
+	assert.False(t, ok)
+
+	assert.True(t, types.WarningStatus.Succeeded())
+	assert.False(t, types.FailureStatus.Succeeded())
+}
+
+func TestExitCodeMapValidation(t *testing.T) {
+	for name, exitCodes := range map[string]models.ExitCodeMap{
+		"code":     {"one": types.SuccessStatus},
+		"zero":     {"0": types.SuccessStatus},
+		"too high": {"256": types.SuccessStatus},
+		"reversed": {"5-2": types.SuccessStatus},
+		"status":   {"1": types.TimeoutStatus},
+		"overlap":  {"1-3": types.SuccessStatus, "3": types.WarningStatus},
+	} {
+		assert.Error(t, exitCodes.Validate(), name)
+	}
+
+	// Agents with an invalid map are rejected
+	agent := patternAgent(types.StdinPattern, types.StdoutPattern)
+	agent.ExitCodeMap = models.ExitCodeMap{"1": "ignored"}
+	errs := agent.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "exit_code_map", errs[0].Field)
+}
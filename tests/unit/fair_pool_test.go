@@ -0,0 +1,197 @@
+package unit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// gatedAgent is a read-only agent whose executions record their start and run until proceed
+// receives a value
+type gatedAgent struct {
+	id      string
+	weight  int
+	started *startLog
+	proceed chan struct{}
+}
+
+// startLog records the agents of executions in the order they started
+type startLog struct {
+	mutex  sync.Mutex
+	agents []string
+}
+
+func (l *startLog) add(agentID string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.agents = append(l.agents, agentID)
+}
+
+func (l *startLog) snapshot() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.agents...)
+}
+
+func (ga *gatedAgent) Execute(ctx context.Context, input string) (*models.ExecutionResult, error) {
+	ga.started.add(ga.id)
+	select {
+	case <-ga.proceed:
+	case <-ctx.Done():
+	}
+	return &models.ExecutionResult{AgentID: ga.id, Status: models.SuccessStatus, Input: input}, nil
+}
+
+func (ga *gatedAgent) GetID() string    { return ga.id }
+func (ga *gatedAgent) GetName() string  { return ga.id }
+func (ga *gatedAgent) GetType() string  { return "gated" }
+func (ga *gatedAgent) IsReadOnly() bool { return true }
+func (ga *gatedAgent) Validate() error  { return nil }
+
+func (ga *gatedAgent) GetConfig() *models.AgentConfiguration {
+	return &models.AgentConfiguration{ID: ga.id, Name: ga.id, AccessType: models.ReadOnlyAccessType, Weight: ga.weight}
+}
+
+// pendingTotal returns the executions waiting in the read-only pool
+func pendingTotal(t *testing.T, service *services.ReadOnlyExecutionService) int {
+	metrics, err := service.GetResourcePoolMetrics()
+	require.NoError(t, err)
+	return metrics.PendingCount
+}
+
+func TestReadOnlyPoolSharesSlotsAcrossAgents(t *testing.T) {
+	service := services.NewReadOnlyExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop(), 2)
+	started := &startLog{}
+	proceed := make(chan struct{})
+	agentA := &gatedAgent{id: "agent-a", started: started, proceed: proceed}
+	agentB := &gatedAgent{id: "agent-b", started: started, proceed: proceed}
+
+	// Queue 50 executions of A, then 5 of B, one at a time so their order is known
+	var wg sync.WaitGroup
+	submit := func(agent *gatedAgent, count int) {
+		for i := 0; i < count; i++ {
+			before := len(started.snapshot()) + pendingTotal(t, service)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := service.ExecuteAgent(context.Background(), agent, "input")
+				assert.NoError(t, err)
+			}()
+			require.Eventually(t, func() bool {
+				return len(started.snapshot())+pendingTotal(t, service) == before+1
+			}, 5*time.Second, time.Millisecond)
+		}
+	}
+	submit(agentA, 50)
+	submit(agentB, 5)
+
+	metrics, err := service.GetResourcePoolMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, 2, metrics.UsedCapacity)
+	assert.Equal(t, 53, metrics.PendingCount)
+	assert.Equal(t, map[string]int{"agent-a": 48, "agent-b": 5}, metrics.PendingByAgent)
+
+	// Finish executions one at a time; each frees the slot for the next grant
+	for i := 2; i < 55; i++ {
+		proceed <- struct{}{}
+		require.Eventually(t, func() bool { return len(started.snapshot()) == i+1 }, 5*time.Second, time.Millisecond)
+	}
+	proceed <- struct{}{}
+	proceed <- struct{}{}
+	wg.Wait()
+
+	order := started.snapshot()
+	require.Len(t, order, 55)
+	grantedB := 0
+	for _, agentID := range order[:20] {
+		if agentID == "agent-b" {
+			grantedB++
+		}
+	}
+	assert.Equal(t, 5, grantedB, "B's executions waited behind A's backlog: %v", order[:20])
+	assert.Equal(t, 0, pendingTotal(t, service))
+}
+
+// acquireInOrder starts Acquire calls for agents one at a time, so they queue in that order, and
+// reports the agents as they are granted
+func acquireInOrder(t *testing.T, pool *services.FairPool, agents []string, weights map[string]int) <-chan string {
+	granted := make(chan string, len(agents))
+	for i, agentID := range agents {
+		agentID := agentID
+		go func() {
+			assert.NoError(t, pool.Acquire(context.Background(), agentID, weights[agentID], 0))
+			granted <- agentID
+		}()
+		require.Eventually(t, func() bool {
+			total := 0
+			for _, count := range pool.Pending() {
+				total += count
+			}
+			return total == i+1
+		}, 5*time.Second, time.Millisecond)
+	}
+	return granted
+}
+
+func TestFairPoolWeightsShares(t *testing.T) {
+	pool := services.NewFairPool(1)
+	require.NoError(t, pool.Acquire(context.Background(), "holder", 1, 0))
+
+	var agents []string
+	for i := 0; i < 6; i++ {
+		agents = append(agents, "heavy")
+	}
+	for i := 0; i < 6; i++ {
+		agents = append(agents, "light")
+	}
+	granted := acquireInOrder(t, pool, agents, map[string]int{"heavy": 3, "light": 1})
+
+	// Each grant is released before the next, so the grants follow the turns exactly
+	pool.Release("holder")
+	var order []string
+	for range agents {
+		agentID := <-granted
+		order = append(order, agentID)
+		pool.Release(agentID)
+	}
+	assert.Equal(t, []string{
+		"heavy", "heavy", "heavy", "light",
+		"heavy", "heavy", "heavy", "light",
+		"light", "light", "light", "light",
+	}, order)
+	assert.Equal(t, 0, pool.InUse())
+}
+
+func TestFairPoolRespectsAgentLimit(t *testing.T) {
+	pool := services.NewFairPool(3)
+	require.NoError(t, pool.Acquire(context.Background(), "limited", 1, 1))
+
+	// A second execution of the limited agent waits although slots are free
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- pool.Acquire(ctx, "limited", 1, 1) }()
+	require.Eventually(t, func() bool { return pool.Pending()["limited"] == 1 }, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, pool.Acquire(context.Background(), "other", 1, 0))
+	assert.Equal(t, 2, pool.InUse())
+
+	// Giving up leaves the queue
+	cancel()
+	assert.ErrorIs(t, <-result, context.Canceled)
+	assert.Empty(t, pool.Pending())
+	assert.Equal(t, 2, pool.InUse())
+
+	// Once the running execution finishes, the next one is granted
+	go func() { result <- pool.Acquire(context.Background(), "limited", 1, 1) }()
+	require.Eventually(t, func() bool { return pool.Pending()["limited"] == 1 }, 5*time.Second, time.Millisecond)
+	pool.Release("limited")
+	assert.NoError(t, <-result)
+	assert.Equal(t, 2, pool.InUse())
+}
@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/config"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	valid := models.JSONSchema{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"count": map[string]interface{}{"type": []interface{}{"integer", "null"}, "exclusiveMinimum": 0},
+			"tags":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "uniqueItems": true},
+			"mode":  map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"const": "fast"}, map[string]interface{}{"const": "slow"}}},
+		},
+		"additionalProperties": false,
+		"title":                "Unchecked keywords are kept",
+	}
+	assert.NoError(t, valid.Validate())
+	assert.NoError(t, models.JSONSchema(nil).Validate())
+
+	for name, schema := range map[string]models.JSONSchema{
+		"draft-04":            {"$schema": "http://json-schema.org/draft-04/schema#"},
+		"unknown type":        {"type": "text"},
+		"boolean exclusive":   {"exclusiveMaximum": true},
+		"negative length":     {"maxLength": -1},
+		"fractional length":   {"minItems": 1.5},
+		"bad pattern":         {"pattern": "(["},
+		"required not a list": {"required": "name"},
+		"empty anyOf":         {"anyOf": []interface{}{}},
+		"nested problem":      {"properties": map[string]interface{}{"n": map[string]interface{}{"minimum": "1"}}},
+		"reference":           {"$ref": "#/$defs/input"},
+	} {
+		assert.Error(t, schema.Validate(), name)
+	}
+
+	err := models.JSONSchema{"properties": map[string]interface{}{"n": map[string]interface{}{"minimum": "1"}}}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "properties.n.minimum")
+}
+
+func TestJSONSchemaValidateParameters(t *testing.T) {
+	schema := models.JSONSchema{
+		"type":     "object",
+		"required": []interface{}{"count"},
+		"properties": map[string]interface{}{
+			"count": map[string]interface{}{"type": "integer", "minimum": 1},
+			"ratio": map[string]interface{}{"type": "number", "exclusiveMaximum": 1},
+			"name":  map[string]interface{}{"type": "string", "pattern": "^[a-z]+$", "maxLength": 5},
+			"tags":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		"additionalProperties": false,
+	}
+
+	assert.Empty(t, schema.ValidateParameters(map[string]interface{}{"count": 3.0, "ratio": 0.5, "name": "abc", "tags": []interface{}{"a"}}))
+	assert.Empty(t, schema.ValidateParameters(map[string]interface{}{"count": 3}), "Go integers count as JSON integers")
+
+	errs := schema.ValidateParameters(map[string]interface{}{
+		"count": 1.5,
+		"ratio": 1.0,
+		"name":  "ABCDEFG",
+		"tags":  []interface{}{"a", 2.0},
+		"extra": true,
+	})
+	codes := make(map[string]string)
+	for _, fieldErr := range errs {
+		codes[fieldErr.Field] = fieldErr.Code
+		assert.True(t, errors.Is(fieldErr, models.ErrInvalidInput), fieldErr.Field)
+	}
+	assert.Equal(t, map[string]string{
+		"parameters.count":   models.ValidationInvalid,
+		"parameters.ratio":   models.ValidationOutOfRange,
+		"parameters.name":    models.ValidationInvalid,
+		"parameters.tags[1]": models.ValidationInvalid,
+		"parameters.extra":   models.ValidationInvalid,
+	}, codes)
+	assert.True(t, errs.Has("parameters.name"))
+
+	errs = schema.ValidateParameters(nil)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "parameters.count", errs[0].Field)
+	assert.Equal(t, models.ValidationRequired, errs[0].Code)
+	assert.True(t, errors.Is(errs.Err(), models.ErrInvalidInput))
+}
+
+func TestJSONSchemaCombinators(t *testing.T) {
+	schema := models.JSONSchema{
+		"properties": map[string]interface{}{
+			"mode":  map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"const": "fast"}, map[string]interface{}{"const": "slow"}}},
+			"level": map[string]interface{}{"anyOf": []interface{}{map[string]interface{}{"type": "integer"}, map[string]interface{}{"enum": []interface{}{"max"}}}},
+			"label": map[string]interface{}{"not": map[string]interface{}{"const": "reserved"}},
+		},
+	}
+	assert.Empty(t, schema.ValidateParameters(map[string]interface{}{"mode": "fast", "level": "max", "label": "ok"}))
+
+	errs := schema.ValidateParameters(map[string]interface{}{"mode": "medium", "level": "min", "label": "reserved"})
+	assert.True(t, errs.Has("parameters.mode"))
+	assert.True(t, errs.Has("parameters.level"))
+	assert.True(t, errs.Has("parameters.label"))
+}
+
+func TestConfigAgentInputSchema(t *testing.T) {
+	schema, err := config.ToInputSchema(`{"type": "object", "properties": {"maxWords": {"type": "integer"}}}`)
+	require.NoError(t, err)
+	assert.Contains(t, schema["properties"], "maxWords", "keywords and properties keep their case")
+
+	schema, err = config.ToInputSchema("  ")
+	require.NoError(t, err)
+	assert.Nil(t, schema)
+	_, err = config.ToInputSchema(`["type"]`)
+	assert.Error(t, err)
+
+	examples, err := config.ToAgentExamples([]config.AgentExampleConfig{{Input: "text", Parameters: `{"maxWords": 10}`}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.AgentExample{{Input: "text", Parameters: map[string]interface{}{"maxWords": 10.0}}}, examples)
+	_, err = config.ToAgentExamples([]config.AgentExampleConfig{{Parameters: "max_words=10"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package unit
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// leaseBackends returns a fresh lease store of each backend
+func leaseBackends(t *testing.T) map[string]models.LeaseStore {
+	fileLeases, err := storage.NewFileLeaseStore(filepath.Join(t.TempDir(), "leader.lease"))
+	require.NoError(t, err)
+
+	stores, err := storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendSQLite, Path: filepath.Join(t.TempDir(), "state.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { stores.Close() })
+
+	return map[string]models.LeaseStore{"file": fileLeases, storage.StoreBackendSQLite: stores.Leases}
+}
+
+// partitionedLeases fails every lease operation while partitioned is set
+type partitionedLeases struct {
+	models.LeaseStore
+	partitioned atomic.Bool
+}
+
+func (p *partitionedLeases) AcquireLease(holder, address string, now time.Time, duration time.Duration) (*models.LeaderLease, error) {
+	if p.partitioned.Load() {
+		return nil, errors.New("lease store unreachable")
+	}
+	return p.LeaseStore.AcquireLease(holder, address, now, duration)
+}
+
+func TestLeaderLeaseStores(t *testing.T) {
+	now := time.Now()
+	for name, leases := range leaseBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			lease, err := leases.AcquireLease("a", "http://a:8080", now, 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "a", lease.Holder)
+			assert.Equal(t, "http://a:8080", lease.Address)
+
+			// The lease stays with its holder until it expires
+			lease, err = leases.AcquireLease("b", "http://b:8080", now.Add(5*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "a", lease.Holder)
+			lease, err = leases.AcquireLease("a", "http://a:8080", now.Add(5*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "a", lease.Holder)
+			assert.WithinDuration(t, now.Add(15*time.Second), lease.ExpiresAt, time.Millisecond)
+
+			lease, err = leases.AcquireLease("b", "http://b:8080", now.Add(16*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "b", lease.Holder)
+
+			// Only the holder releases the lease, which frees it at once
+			require.NoError(t, leases.ReleaseLease("a"))
+			lease, err = leases.AcquireLease("a", "http://a:8080", now.Add(17*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "b", lease.Holder)
+			require.NoError(t, leases.ReleaseLease("b"))
+			lease, err = leases.AcquireLease("a", "http://a:8080", now.Add(17*time.Second), 10*time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "a", lease.Holder)
+		})
+	}
+}
+
+func TestLeaderElectorFailover(t *testing.T) {
+	for name, leases := range leaseBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			var clockMutex sync.Mutex
+			now := time.Now()
+			clock := func() time.Time {
+				clockMutex.Lock()
+				defer clockMutex.Unlock()
+				return now
+			}
+			advance := func(d time.Duration) {
+				clockMutex.Lock()
+				now = now.Add(d)
+				clockMutex.Unlock()
+			}
+
+			partitioned := &partitionedLeases{LeaseStore: leases}
+			first := services.NewLeaderElector(partitioned, "first", "http://first:8080", zap.NewNop())
+			second := services.NewLeaderElector(leases, "second", "http://second:8080", zap.NewNop())
+			var transitions []string
+			for _, elector := range []*services.LeaderElector{first, second} {
+				elector.SetClock(clock)
+				elector.SetLeaseTiming(9*time.Second, 3*time.Second)
+				identity := elector.Status().Identity
+				elector.AddLeadershipHook(func(leader bool) {
+					if leader {
+						transitions = append(transitions, identity+" elected")
+					} else {
+						transitions = append(transitions, identity+" demoted")
+					}
+				})
+			}
+			campaign := func() {
+				first.Campaign()
+				second.Campaign()
+				assert.False(t, first.IsLeader() && second.IsLeader(), "both instances lead")
+			}
+
+			campaign()
+			assert.True(t, first.IsLeader())
+			status := second.Status()
+			assert.Equal(t, models.LeaderRoleFollower, status.Role)
+			assert.Equal(t, "first", status.Leader)
+			assert.Equal(t, "http://first:8080", status.LeaderAddress)
+			require.NotNil(t, status.LeaseExpiresAt)
+
+			// The leader loses the lease store; it leads until its lease is about to expire, and the
+			// follower takes over only once the lease has expired
+			partitioned.partitioned.Store(true)
+			for i := 0; i < 4; i++ {
+				advance(3 * time.Second)
+				campaign()
+			}
+			assert.False(t, first.IsLeader())
+			assert.True(t, second.IsLeader())
+			assert.Equal(t, []string{"first elected", "first demoted", "second elected"}, transitions)
+
+			// Back in touch, the former leader follows
+			partitioned.partitioned.Store(false)
+			advance(3 * time.Second)
+			campaign()
+			assert.False(t, first.IsLeader())
+			assert.Equal(t, "second", first.Status().Leader)
+		})
+	}
+}
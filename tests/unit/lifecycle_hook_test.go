@@ -0,0 +1,59 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleHookDefaults(t *testing.T) {
+	hook := &models.LifecycleHook{Command: []string{"warm-up"}}
+	require.NoError(t, hook.Validate(models.HookPostStart))
+	assert.Equal(t, models.DefaultHookTimeoutSeconds*time.Second, hook.Timeout())
+	assert.Equal(t, models.HookPolicyDegrade, hook.Policy(models.HookPostStart))
+	assert.Equal(t, models.HookPolicyProceed, hook.Policy(models.HookPreStop))
+
+	hook = &models.LifecycleHook{URL: "http://localhost:8080/drain", TimeoutSeconds: 5, OnFailure: models.HookPolicyAbort}
+	require.NoError(t, hook.Validate(models.HookPreStop))
+	assert.Equal(t, 5*time.Second, hook.Timeout())
+	assert.Equal(t, models.HookPolicyAbort, hook.Policy(models.HookPreStop))
+}
+
+func TestLifecycleHookValidation(t *testing.T) {
+	for name, test := range map[string]struct {
+		kind models.HookKind
+		hook models.LifecycleHook
+	}{
+		"nothing to run":    {models.HookPostStart, models.LifecycleHook{}},
+		"command and url":   {models.HookPostStart, models.LifecycleHook{Command: []string{"true"}, URL: "http://localhost/"}},
+		"empty program":     {models.HookPostStart, models.LifecycleHook{Command: []string{""}}},
+		"command method":    {models.HookPostStart, models.LifecycleHook{Command: []string{"true"}, Method: "PUT"}},
+		"relative url":      {models.HookPreStop, models.LifecycleHook{URL: "/drain"}},
+		"negative timeout":  {models.HookPreStop, models.LifecycleHook{Command: []string{"true"}, TimeoutSeconds: -1}},
+		"pre-stop policy":   {models.HookPostStart, models.LifecycleHook{Command: []string{"true"}, OnFailure: models.HookPolicyAbort}},
+		"post-start policy": {models.HookPreStop, models.LifecycleHook{Command: []string{"true"}, OnFailure: models.HookPolicyFail}},
+		"unknown policy":    {models.HookPreStop, models.LifecycleHook{Command: []string{"true"}, OnFailure: "retry"}},
+	} {
+		assert.Error(t, test.hook.Validate(test.kind), name)
+	}
+
+	// Hooks only apply to persistent agents
+	agent := patternAgent(types.StdinPattern, types.StdoutPattern)
+	agent.PreStopHook = &models.LifecycleHook{Command: []string{"drain"}}
+	errs := agent.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "pre_stop_hook", errs[0].Field)
+	assert.Equal(t, models.ValidationConflict, errs[0].Code)
+
+	agent = patternAgent(types.JsonRpcPattern, types.JsonRpcPatternOut)
+	agent.Mode = types.PersistentMode
+	agent.PostStartHook = &models.LifecycleHook{Command: []string{"warm-up"}, OnFailure: models.HookPolicyProceed}
+	errs = agent.ValidateFields()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "post_start_hook", errs[0].Field)
+	assert.Equal(t, models.ValidationInvalid, errs[0].Code)
+}
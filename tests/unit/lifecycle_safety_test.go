@@ -0,0 +1,43 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternTarget(t *testing.T) {
+	for target, want := range map[string]bool{
+		"*":                true,
+		"payments-*":       true,
+		"prefix:payments-": true,
+		"worker-[12]":      true,
+		"payments-api":     false,
+		"group:payments":   false,
+	} {
+		_, ok := models.PatternTarget(target)
+		assert.Equal(t, want, ok, target)
+	}
+}
+
+func TestLifecycleSafetyValidate(t *testing.T) {
+	assert.NoError(t, models.LifecycleSafety{ProtectedAgents: []string{"ledger", "prefix:prod-"}, ConfirmAboveAgents: 10, ConfirmAbovePercent: 50}.Validate())
+	assert.Error(t, models.LifecycleSafety{ConfirmAboveAgents: -1}.Validate())
+	assert.Error(t, models.LifecycleSafety{ConfirmAbovePercent: 101}.Validate())
+	assert.Error(t, models.LifecycleSafety{ProtectedAgents: []string{""}}.Validate())
+	assert.Error(t, models.LifecycleSafety{ProtectedAgents: []string{"prefix:"}}.Validate())
+}
+
+func TestLifecycleSafetyConfirmationReason(t *testing.T) {
+	safety := models.LifecycleSafety{ProtectedAgents: []string{"prod-*"}, ConfirmAboveAgents: 3, ConfirmAbovePercent: 50}
+
+	assert.True(t, safety.Protects("prod-db"))
+	assert.False(t, safety.Protects("staging-db"))
+
+	assert.Empty(t, safety.ConfirmationReason(1, 1), "a single agent never needs confirming")
+	assert.Empty(t, safety.ConfirmationReason(2, 10))
+	assert.Contains(t, safety.ConfirmationReason(4, 100), "more than 3")
+	assert.Contains(t, safety.ConfirmationReason(3, 4), "more than 50%")
+	assert.Empty(t, models.LifecycleSafety{}.ConfirmationReason(100, 100), "no thresholds confirm nothing")
+}
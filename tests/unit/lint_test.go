@@ -0,0 +1,164 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLintFixture writes a config.d tree with one bad cron expression, one missing executable
+// and one agent ID defined twice, and returns its root
+func writeLintFixture(t *testing.T) string {
+	root := filepath.Join(t.TempDir(), "config.d")
+	files := map[string]string{
+		"agents.yaml": `agents:
+  - id: reviewer
+    name: Reviewer
+    agent_type: cli
+    executable_path: /bin/echo
+    enabled: true
+  - id: builder
+    name: Builder
+    agent_type: cli
+    executable_path: /nonexistent/bin/build-agent
+    enabled: true
+`,
+		"team/more-agents.json": `{
+  "agents": [
+    {
+      "id": "reviewer",
+      "name": "Another reviewer",
+      "agent_type": "cli",
+      "executable_path": "/bin/cat",
+      "enabled": true
+    }
+  ]
+}
+`,
+		"tasks.yaml": `tasks:
+  - id: nightly-review
+    agent_id: reviewer
+    cron_expression: "0 61 * * *"
+    enabled: true
+  - id: hourly-build
+    agent_id: builder
+    cron_expression: "@hourly"
+    enabled: true
+`,
+		"README.md": "not a definition file\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestLintFixtureTree(t *testing.T) {
+	root := writeLintFixture(t)
+
+	report, err := supervisorctl.Lint([]string{root}, supervisorctl.LintOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Files)
+	assert.Equal(t, 3, report.Errors, "%v", report.Problems)
+	assert.Zero(t, report.Warnings)
+	require.Len(t, report.Problems, 3)
+
+	// Problems are ordered by file and point at the offending key
+	assert.Equal(t, filepath.Join(root, "agents.yaml"), report.Problems[0].File)
+	assert.Equal(t, supervisorctl.LintRuleFilesystem, report.Problems[0].Rule)
+	assert.Equal(t, "builder", report.Problems[0].ID)
+	assert.Equal(t, "executable_path", report.Problems[0].Field)
+	assert.Equal(t, 10, report.Problems[0].Line)
+
+	assert.Equal(t, filepath.Join(root, "tasks.yaml"), report.Problems[1].File)
+	assert.Equal(t, supervisorctl.LintRuleInvalidCron, report.Problems[1].Rule)
+	assert.Equal(t, "nightly-review", report.Problems[1].ID)
+	assert.Equal(t, 4, report.Problems[1].Line)
+	assert.Equal(t, 5, report.Problems[1].Column)
+
+	assert.Equal(t, filepath.Join(root, "team", "more-agents.json"), report.Problems[2].File)
+	assert.Equal(t, supervisorctl.LintRuleDuplicateID, report.Problems[2].Rule)
+	assert.Equal(t, 4, report.Problems[2].Line)
+	assert.Contains(t, report.Problems[2].Message, filepath.Join(root, "agents.yaml")+":2")
+
+	// Tasks may run agents defined in other files of the tree, so hourly-build is fine
+	for _, problem := range report.Problems {
+		assert.NotEqual(t, supervisorctl.LintRuleUnknownAgent, problem.Rule)
+	}
+
+	assert.Equal(t, supervisorctl.ExitFailure, supervisorctl.ExitCode(report.Err()))
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), filepath.Join(root, "tasks.yaml")+":4:5: error: task nightly-review: cron_expression: invalid cron expression")
+	assert.Contains(t, out.String(), "3 files linted, 3 errors, 0 warnings")
+
+	// The report encodes for CI annotation tools as --format json prints it
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	var decoded struct {
+		Problems []map[string]interface{} `json:"problems"`
+	}
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, "invalid-cron", decoded.Problems[1]["rule"])
+	assert.Equal(t, "error", decoded.Problems[1]["severity"])
+	assert.EqualValues(t, 4, decoded.Problems[1]["line"])
+}
+
+func TestLintWarnRules(t *testing.T) {
+	root := writeLintFixture(t)
+
+	// Rules named by --warn no longer fail the lint
+	report, err := supervisorctl.Lint([]string{root}, supervisorctl.LintOptions{
+		Warn: []string{supervisorctl.LintRuleFilesystem, supervisorctl.LintRuleInvalidCron, supervisorctl.LintRuleDuplicateID},
+	})
+	require.NoError(t, err)
+	assert.Zero(t, report.Errors)
+	assert.Equal(t, 3, report.Warnings)
+	assert.NoError(t, report.Err())
+	for _, problem := range report.Problems {
+		assert.Equal(t, supervisorctl.LintWarning, problem.Severity)
+	}
+
+	_, err = supervisorctl.Lint([]string{root}, supervisorctl.LintOptions{Warn: []string{"no-such-rule"}})
+	assert.ErrorContains(t, err, `unknown lint rule "no-such-rule"`)
+}
+
+func TestLintSingleFileProblems(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tasks.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`tasks:
+  - id: orphan
+    agent_id: ghost
+    cron_expression: "*/5 * * * *"
+    timeot: 30
+`), 0644))
+
+	// Linting one file alone, the agent the task runs is unknown
+	report, err := supervisorctl.Lint([]string{path}, supervisorctl.LintOptions{})
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 2, "%v", report.Problems)
+	assert.Equal(t, supervisorctl.LintRuleUnknownAgent, report.Problems[0].Rule)
+	assert.Equal(t, 3, report.Problems[0].Line)
+	assert.Equal(t, supervisorctl.LintRuleUnknownField, report.Problems[1].Rule)
+	assert.Equal(t, supervisorctl.LintWarning, report.Problems[1].Severity)
+	assert.Equal(t, 5, report.Problems[1].Line)
+
+	broken := filepath.Join(dir, "broken.yaml")
+	require.NoError(t, os.WriteFile(broken, []byte("agents:\n  - id: a\n\tname: b\n"), 0644))
+	report, err = supervisorctl.Lint([]string{broken}, supervisorctl.LintOptions{})
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 1)
+	assert.Equal(t, supervisorctl.LintRuleSyntax, report.Problems[0].Rule)
+	assert.Positive(t, report.Problems[0].Line, "the yaml parser reports the line")
+
+	_, err = supervisorctl.Lint([]string{filepath.Join(dir, "missing.yaml")}, supervisorctl.LintOptions{})
+	assert.Error(t, err)
+}
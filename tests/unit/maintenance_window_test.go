@@ -0,0 +1,72 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceWindowPeriods(t *testing.T) {
+	schedule, err := definitions.ParseMaintenanceWindow(models.MaintenanceWindow{Schedule: "0 2 * * *", Duration: "1h", Reason: "backup"}, time.UTC)
+	require.NoError(t, err)
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	// In progress from its start until, excluding, its end
+	current, ok := schedule.Current(day.Add(2*time.Hour + 30*time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, day.Add(2*time.Hour), current.Start)
+	assert.Equal(t, day.Add(3*time.Hour), current.End)
+	assert.Equal(t, "backup", current.Reason)
+
+	_, ok = schedule.Current(day.Add(2 * time.Hour))
+	assert.True(t, ok)
+	_, ok = schedule.Current(day.Add(3 * time.Hour))
+	assert.False(t, ok)
+
+	next, ok := schedule.Next(day.Add(3 * time.Hour))
+	require.True(t, ok)
+	assert.True(t, next.Start.Equal(day.Add(26*time.Hour)))
+}
+
+func TestMaintenanceWindowOverlapsAndTimezone(t *testing.T) {
+	// Overlapping periods are in progress until the last of them ends
+	schedule, err := definitions.ParseMaintenanceWindow(models.MaintenanceWindow{Schedule: "*/10 * * * *", Duration: "15m"}, time.UTC)
+	require.NoError(t, err)
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	current, ok := schedule.Current(day.Add(12 * time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, day, current.Start)
+	assert.Equal(t, day.Add(25*time.Minute), current.End)
+
+	// The window's own time zone wins over the fallback: 02:00 in New York is 07:00 UTC in winter
+	schedule, err = definitions.ParseMaintenanceWindow(models.MaintenanceWindow{Schedule: "0 2 * * *", Duration: "1h", Timezone: "America/New_York"}, time.UTC)
+	require.NoError(t, err)
+	_, ok = schedule.Current(time.Date(2026, 1, 10, 7, 30, 0, 0, time.UTC))
+	assert.True(t, ok)
+	_, ok = schedule.Current(time.Date(2026, 1, 10, 2, 30, 0, 0, time.UTC))
+	assert.False(t, ok)
+}
+
+func TestMaintenanceWindowValidation(t *testing.T) {
+	for name, window := range map[string]models.MaintenanceWindow{
+		"schedule": {Schedule: "every night", Duration: "1h"},
+		"duration": {Schedule: "0 2 * * *", Duration: "an hour"},
+		"negative": {Schedule: "0 2 * * *", Duration: "-1h"},
+		"timezone": {Schedule: "0 2 * * *", Duration: "1h", Timezone: "Mars/Olympus"},
+	} {
+		_, err := definitions.ParseMaintenanceWindow(window, time.UTC)
+		assert.Error(t, err, name)
+	}
+
+	// Agents with an invalid window are rejected
+	agent := patternAgent(types.StdinPattern, types.StdoutPattern)
+	agent.MaintenanceWindows = []models.MaintenanceWindow{{Schedule: "0 2 * * *", Duration: "1h"}, {Schedule: "0 2 * * *"}}
+	errs, _ := definitions.ValidateAgent(agent)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "maintenance_windows[1]", errs[0].Field)
+}
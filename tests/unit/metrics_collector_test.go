@@ -0,0 +1,86 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMetricsCollectorAgentPercentiles(t *testing.T) {
+	collector := services.NewMetricsCollector(zap.NewNop())
+
+	// Durations 1ms..100ms in shuffled order, every tenth execution failing
+	for i := 0; i < 100; i++ {
+		ms := (i*37)%100 + 1
+		status := types.SuccessStatus
+		if ms%10 == 0 {
+			status = types.FailureStatus
+		}
+		collector.RecordExecution("agent-a", time.Duration(ms)*time.Millisecond, status, &models.ResourceUsage{PeakMemoryMB: int64(ms)})
+	}
+	collector.RecordExecution("agent-b", time.Second, types.SuccessStatus, nil)
+
+	metric, exists := collector.GetAgentMetrics("agent-a")
+	require.True(t, exists)
+	assert.EqualValues(t, 100, metric.TotalExecutions)
+	assert.EqualValues(t, 90, metric.SuccessfulExecutions)
+	assert.InDelta(t, 90.0, metric.SuccessRate, 0.01)
+	assert.InDelta(t, 90.0, metric.WindowSuccessRate, 0.01)
+	assert.Equal(t, 100, metric.WindowExecutions)
+	assert.InDelta(t, float64(50*time.Millisecond), float64(metric.P50ExecutionTime), float64(time.Millisecond))
+	assert.InDelta(t, float64(95*time.Millisecond), float64(metric.P95ExecutionTime), float64(time.Millisecond))
+	assert.InDelta(t, float64(99*time.Millisecond), float64(metric.P99ExecutionTime), float64(time.Millisecond))
+	assert.InDelta(t, float64(50500*time.Microsecond), float64(metric.AvgExecutionTime), float64(time.Millisecond))
+	assert.EqualValues(t, 100, metric.PeakMemoryMB)
+	require.NotNil(t, metric.LastFailureTime)
+	assert.WithinDuration(t, time.Now(), *metric.LastFailureTime, time.Second)
+
+	// Agents are aggregated separately
+	other, exists := collector.GetAgentMetrics("agent-b")
+	require.True(t, exists)
+	assert.EqualValues(t, 1, other.TotalExecutions)
+	assert.Equal(t, time.Second, other.P99ExecutionTime)
+	assert.Nil(t, other.LastFailureTime)
+	assert.Len(t, collector.GetAllAgentMetrics(), 2)
+
+	_, exists = collector.GetAgentMetrics("agent-c")
+	assert.False(t, exists)
+}
+
+func TestMetricsCollectorWindowKeepsRecentSamples(t *testing.T) {
+	collector := services.NewMetricsCollector(zap.NewNop())
+	collector.SetDurationWindow(time.Hour, 10)
+
+	// Only the last 10 of 20 executions stay in the ring buffer
+	for i := 1; i <= 20; i++ {
+		collector.RecordExecution("agent", time.Duration(i)*time.Millisecond, types.SuccessStatus, nil)
+	}
+
+	metric, _ := collector.GetAgentMetrics("agent")
+	assert.EqualValues(t, 20, metric.TotalExecutions)
+	assert.Equal(t, 10, metric.WindowExecutions)
+	assert.Equal(t, 15*time.Millisecond, metric.P50ExecutionTime)
+	assert.Equal(t, 20*time.Millisecond, metric.P99ExecutionTime)
+}
+
+func TestMetricsCollectorWindowExpiresOldSamples(t *testing.T) {
+	collector := services.NewMetricsCollector(zap.NewNop())
+	collector.SetDurationWindow(50*time.Millisecond, 0)
+
+	collector.RecordExecution("agent", time.Second, types.FailureStatus, nil)
+	time.Sleep(100 * time.Millisecond)
+	collector.RecordExecution("agent", 10*time.Millisecond, types.SuccessStatus, nil)
+
+	metric, _ := collector.GetAgentMetrics("agent")
+	assert.EqualValues(t, 2, metric.TotalExecutions)
+	assert.InDelta(t, 50.0, metric.SuccessRate, 0.01)
+	assert.Equal(t, 1, metric.WindowExecutions)
+	assert.InDelta(t, 100.0, metric.WindowSuccessRate, 0.01)
+	assert.Equal(t, 10*time.Millisecond, metric.P99ExecutionTime)
+}
@@ -0,0 +1,93 @@
+package unit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// patternAgent returns a valid agent combining input with output
+func patternAgent(input types.InputPattern, output types.OutputPattern) *models.AgentConfiguration {
+	return &models.AgentConfiguration{
+		ID:                      "pattern-agent",
+		Name:                    "Pattern Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/echo",
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 1,
+		Mode:                    models.TaskMode,
+		InputPattern:            input,
+		OutputPattern:           output,
+		InputFileTemplate:       "input.txt",
+		OutputFileTemplate:      "output.txt",
+		Timeout:                 30,
+		Enabled:                 true,
+	}
+}
+
+func TestPatternMatrix(t *testing.T) {
+	matrix := types.PatternMatrix()
+	require.Len(t, matrix, len(types.InputPatterns)*len(types.OutputPatterns))
+
+	expectedIncompatible := map[string]bool{
+		"stdin/json-rpc":  true,
+		"file/json-rpc":   true,
+		"args/json-rpc":   true,
+		"json-rpc/stdout": true,
+	}
+	agentService := services.NewAgentService(zap.NewNop())
+	for _, cell := range matrix {
+		name := string(cell.InputPattern) + "/" + string(cell.OutputPattern)
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, !expectedIncompatible[name], cell.Compatible)
+			assert.Equal(t, cell.Compatible, cell.Reason == "", "only incompatible pairs have a reason")
+
+			// The supervisor rejects exactly the incompatible pairs, naming the output pattern
+			err := agentService.ValidateAgentConfiguration(patternAgent(cell.InputPattern, cell.OutputPattern))
+			if cell.Compatible {
+				assert.NoError(t, err)
+			} else {
+				var fieldErrs models.ValidationErrors
+				require.True(t, errors.As(err, &fieldErrs), "%v", err)
+				require.Len(t, fieldErrs, 1)
+				assert.Equal(t, "output_pattern", fieldErrs[0].Field)
+				assert.Equal(t, models.ValidationConflict, fieldErrs[0].Code)
+				assert.Contains(t, fieldErrs[0].Message, cell.Reason)
+			}
+
+			// The escape hatch registers any pair
+			agent := patternAgent(cell.InputPattern, cell.OutputPattern)
+			agent.AllowIncompatiblePatterns = true
+			assert.NoError(t, agentService.ValidateAgentConfiguration(agent))
+
+			// The client rejects the same pairs before sending them
+			spec := supervisorctl.AgentSpec{ID: "pattern-agent", InputPattern: string(cell.InputPattern), OutputPattern: string(cell.OutputPattern)}
+			err = spec.Validate()
+			if cell.Compatible {
+				assert.NoError(t, err)
+			} else {
+				var specErr *supervisorctl.SpecError
+				require.True(t, errors.As(err, &specErr))
+				assert.Equal(t, "output_pattern", specErr.Errors[0].Field)
+				assert.Equal(t, models.ValidationConflict, specErr.Errors[0].Code)
+			}
+			spec.AllowIncompatiblePatterns = true
+			assert.NoError(t, spec.Validate())
+		})
+	}
+}
+
+func TestPatternCompatibilityIgnoresUnknownPatterns(t *testing.T) {
+	assert.NoError(t, types.CheckPatternCompatibility("", types.JsonRpcPatternOut))
+	assert.NoError(t, types.CheckPatternCompatibility("pipe", types.StdoutPattern))
+
+	// Patterns a template provides are left to the supervisor
+	assert.NoError(t, supervisorctl.AgentSpec{ID: "templated", Template: "rpc", OutputPattern: "json-rpc"}.Validate())
+}
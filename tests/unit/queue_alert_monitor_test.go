@@ -0,0 +1,132 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeQueue is a read-write agent queue filled by hand
+type fakeQueue struct {
+	stats []services.AgentQueueStats
+}
+
+func (q *fakeQueue) QueueStats() []services.AgentQueueStats {
+	return q.stats
+}
+
+// set replaces the queue of agentID
+func (q *fakeQueue) set(agentID string, length int, oldestQueuedAt time.Time, currentExecutionID string) {
+	q.stats = []services.AgentQueueStats{{
+		AgentID:            agentID,
+		QueueLength:        length,
+		OldestQueuedAt:     oldestQueuedAt,
+		CurrentExecutionID: currentExecutionID,
+	}}
+}
+
+// fakeClock is a clock advanced by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time                 { return c.now }
+func (c *fakeClock) Advance(duration time.Duration) { c.now = c.now.Add(duration) }
+
+func newQueueAlertMonitor(queue *fakeQueue, clock *fakeClock, defaults services.QueueAlertThreshold) (*services.QueueAlertMonitor, *[]models.QueueAlertEvent, *services.MetricsCollector) {
+	monitor := services.NewQueueAlertMonitor(queue, defaults, time.Second, zap.NewNop())
+	monitor.SetClock(clock.Now)
+	collector := services.NewMetricsCollector(zap.NewNop())
+	monitor.SetMetricsCollector(collector)
+
+	events := &[]models.QueueAlertEvent{}
+	monitor.AddAlertHook(func(event models.QueueAlertEvent) {
+		*events = append(*events, event)
+	})
+	return monitor, events, collector
+}
+
+func TestQueueAlertMonitorLengthHysteresis(t *testing.T) {
+	queue := &fakeQueue{}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)}
+	monitor, events, collector := newQueueAlertMonitor(queue, clock, services.QueueAlertThreshold{MaxQueueLength: 4, ClearQueueLength: 1})
+
+	// The queue fills behind a stuck execution and oscillates around the threshold
+	queuedAt := clock.Now()
+	for _, length := range []int{2, 4, 5, 3, 6, 4, 2, 5, 2, 1} {
+		clock.Advance(time.Second)
+		queue.set("rw-agent", length, queuedAt, "exec-stuck")
+		monitor.Check()
+	}
+
+	require.Len(t, *events, 2)
+	fired, cleared := (*events)[0], (*events)[1]
+	assert.Equal(t, models.QueueAlertFired, fired.Type)
+	assert.Equal(t, "rw-agent", fired.AgentID)
+	assert.Equal(t, 5, fired.QueueLength)
+	assert.Equal(t, float64(3), fired.OldestWaitSeconds)
+	assert.Equal(t, "exec-stuck", fired.CurrentExecutionID)
+	assert.Equal(t, []string{models.QueueAlertReasonLength}, fired.Reasons)
+
+	assert.Equal(t, models.QueueAlertCleared, cleared.Type)
+	assert.Equal(t, 1, cleared.QueueLength)
+	assert.Empty(t, monitor.ActiveAlerts())
+	assert.Equal(t, map[string]int64{"rw-agent": 1}, collector.GetQueueAlertCounts())
+}
+
+func TestQueueAlertMonitorWaitHysteresis(t *testing.T) {
+	queue := &fakeQueue{}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)}
+	monitor, events, _ := newQueueAlertMonitor(queue, clock, services.QueueAlertThreshold{MaxWait: time.Minute})
+
+	// One execution waits behind a stuck one; nothing fires until it has waited a minute
+	queuedAt := clock.Now()
+	queue.set("rw-agent", 1, queuedAt, "exec-stuck")
+	clock.Advance(59 * time.Second)
+	assert.Empty(t, monitor.Check())
+
+	clock.Advance(2 * time.Second)
+	fired := monitor.Check()
+	require.Len(t, fired, 1)
+	assert.Equal(t, models.QueueAlertFired, fired[0].Type)
+	assert.Equal(t, []string{models.QueueAlertReasonWait}, fired[0].Reasons)
+	require.Len(t, monitor.ActiveAlerts(), 1)
+
+	// The stuck execution finishes; the next waiter has waited 40s, above the 30s clear bound
+	clock.Advance(time.Minute)
+	queue.set("rw-agent", 1, clock.Now().Add(-40*time.Second), "exec-next")
+	assert.Empty(t, monitor.Check())
+
+	// The queue drains and disappears
+	clock.Advance(time.Minute)
+	queue.stats = nil
+	cleared := monitor.Check()
+	require.Len(t, cleared, 1)
+	assert.Equal(t, models.QueueAlertCleared, cleared[0].Type)
+	assert.Zero(t, cleared[0].QueueLength)
+
+	assert.Len(t, *events, 2)
+}
+
+func TestQueueAlertMonitorAgentThresholds(t *testing.T) {
+	queue := &fakeQueue{}
+	clock := &fakeClock{now: time.Now()}
+	monitor, events, _ := newQueueAlertMonitor(queue, clock, services.QueueAlertThreshold{MaxQueueLength: 2})
+	monitor.SetThresholds(services.QueueAlertThreshold{MaxQueueLength: 2}, map[string]services.QueueAlertThreshold{
+		"busy-agent": {MaxQueueLength: 8},
+	})
+
+	queue.stats = []services.AgentQueueStats{
+		{AgentID: "busy-agent", QueueLength: 5, OldestQueuedAt: clock.Now()},
+		{AgentID: "quiet-agent", QueueLength: 3, OldestQueuedAt: clock.Now()},
+	}
+	monitor.Check()
+
+	require.Len(t, *events, 1)
+	assert.Equal(t, "quiet-agent", (*events)[0].AgentID)
+}
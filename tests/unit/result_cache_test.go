@@ -0,0 +1,150 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// cachingAgent returns a read-only script agent with a cache TTL that counts its runs in a file
+func cachingAgent(t *testing.T, id, body string) (*models.AgentConfiguration, string) {
+	runs := filepath.Join(t.TempDir(), "runs")
+	config := scriptAgentConfig(id, writeAgentScript(t, fmt.Sprintf("echo run >> %s\n%s", runs, body)))
+	config.CacheTTLSeconds = 60
+	config.UpdatedAt = time.Now()
+	return config, runs
+}
+
+// countRuns returns how many times the agent process ran
+func countRuns(t *testing.T, runs string) int {
+	data, err := os.ReadFile(runs)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return strings.Count(string(data), "run\n")
+}
+
+func executeForResult(t *testing.T, executionService *services.ExecutionService, ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, *models.ExecutionResult, error) {
+	execution, err := executionService.ExecuteAgent(ctx, agent, input)
+	require.NotNil(t, execution)
+	result, resultErr := executionService.GetExecutionResult(execution.ID)
+	require.NoError(t, resultErr)
+	return execution, result, err
+}
+
+func TestResultCacheServesRepeatedInput(t *testing.T) {
+	config, runs := cachingAgent(t, "lookup-agent", "sleep 0.3\necho \"looked up $(cat)\"\n")
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+
+	first, firstResult, err := executeForResult(t, executionService, context.Background(), agent, "key")
+	require.NoError(t, err)
+	assert.False(t, firstResult.FromCache)
+
+	start := time.Now()
+	second, secondResult, err := executeForResult(t, executionService, context.Background(), agent, "key")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.EqualValues(t, models.CompletedState, second.State)
+	assert.True(t, secondResult.FromCache)
+	assert.Equal(t, first.ID, secondResult.CachedExecutionID)
+	assert.Equal(t, "looked up key\n", secondResult.Output)
+	assert.Equal(t, 1, countRuns(t, runs))
+
+	// Different input is a different cache entry
+	_, otherResult, err := executeForResult(t, executionService, context.Background(), agent, "other")
+	require.NoError(t, err)
+	assert.False(t, otherResult.FromCache)
+	assert.Equal(t, 2, countRuns(t, runs))
+}
+
+func TestResultCacheBypassAndInvalidation(t *testing.T) {
+	config, runs := cachingAgent(t, "bypass-agent", "cat\n")
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+
+	_, _, err := executeForResult(t, executionService, context.Background(), agents.NewGenericAgent(config, zap.NewNop()), "in")
+	require.NoError(t, err)
+
+	// no_cache runs the agent again and refreshes the entry
+	ctx := services.WithNoCache(context.Background(), true)
+	_, result, err := executeForResult(t, executionService, ctx, agents.NewGenericAgent(config, zap.NewNop()), "in")
+	require.NoError(t, err)
+	assert.False(t, result.FromCache)
+	assert.Equal(t, 2, countRuns(t, runs))
+
+	_, result, err = executeForResult(t, executionService, context.Background(), agents.NewGenericAgent(config, zap.NewNop()), "in")
+	require.NoError(t, err)
+	assert.True(t, result.FromCache)
+
+	// Updating the agent invalidates results cached under its previous configuration
+	updated := *config
+	updated.UpdatedAt = config.UpdatedAt.Add(time.Second)
+	_, result, err = executeForResult(t, executionService, context.Background(), agents.NewGenericAgent(&updated, zap.NewNop()), "in")
+	require.NoError(t, err)
+	assert.False(t, result.FromCache)
+	assert.Equal(t, 3, countRuns(t, runs))
+}
+
+func TestResultCacheNeverCachesFailures(t *testing.T) {
+	config, runs := cachingAgent(t, "failing-agent", "echo broken >&2\nexit 1\n")
+	agent := agents.NewGenericAgent(config, zap.NewNop())
+	executionService := services.NewExecutionService(services.NewAgentService(zap.NewNop()), zap.NewNop())
+
+	_, _, err := executeForResult(t, executionService, context.Background(), agent, "in")
+	require.Error(t, err)
+	firstRuns := countRuns(t, runs)
+	require.GreaterOrEqual(t, firstRuns, 1)
+
+	_, result, err := executeForResult(t, executionService, context.Background(), agent, "in")
+	require.Error(t, err)
+	assert.False(t, result.FromCache)
+	assert.Greater(t, countRuns(t, runs), firstRuns)
+}
+
+func TestResultCacheIsBoundedLRU(t *testing.T) {
+	cache := services.NewResultCache(2)
+	cache.Put("a", "exec-a", &models.ExecutionResult{Output: "a"})
+	cache.Put("b", "exec-b", &models.ExecutionResult{Output: "b"})
+
+	// Reading "a" makes "b" the least recently used entry
+	_, executionID, hit := cache.Get("a", time.Minute)
+	require.True(t, hit)
+	assert.Equal(t, "exec-a", executionID)
+
+	cache.Put("c", "exec-c", &models.ExecutionResult{Output: "c"})
+	assert.Equal(t, 2, cache.Len())
+	_, _, hit = cache.Get("b", time.Minute)
+	assert.False(t, hit)
+	_, _, hit = cache.Get("a", time.Minute)
+	assert.True(t, hit)
+
+	// Entries older than the TTL are dropped
+	time.Sleep(20 * time.Millisecond)
+	_, _, hit = cache.Get("c", 10*time.Millisecond)
+	assert.False(t, hit)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestResultCacheRequiresReadOnlyAgent(t *testing.T) {
+	config, _ := cachingAgent(t, "writer-agent", "cat\n")
+	config.AccessType = models.ReadWriteAccessType
+	assert.Error(t, config.Validate())
+
+	config.AccessType = models.ReadOnlyAccessType
+	config.CacheTTLSeconds = -1
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,562 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newSchedulerTestService creates a scheduler with a single registered agent
+func newSchedulerTestService(t *testing.T) *services.SchedulerService {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	executionService := services.NewExecutionService(agentService, logger)
+
+	err := agentService.RegisterAgent(&models.AgentConfiguration{
+		ID:                      "sched-agent",
+		Name:                    "Scheduler Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/echo",
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 1,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 30,
+		Enabled:                 true,
+	})
+	require.NoError(t, err)
+
+	return services.NewSchedulerService(agentService, executionService, logger)
+}
+
+func TestSchedulerService_CronExpressionFormats(t *testing.T) {
+	scheduler := newSchedulerTestService(t)
+
+	tests := []struct {
+		name       string
+		expression string
+		valid      bool
+	}{
+		{"five field", "*/5 * * * *", true},
+		{"six field", "*/10 * * * * *", true},
+		{"every descriptor", "@every 1m30s", true},
+		{"named descriptor", "@daily", true},
+		{"too few fields", "* * *", false},
+		{"out of range", "61 * * * *", false},
+		{"garbage", "not a cron", false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &models.ScheduledTask{
+				ID:             "task-" + string(rune('a'+i)),
+				Name:           tt.name,
+				AgentID:        "sched-agent",
+				CronExpression: tt.expression,
+			}
+
+			err := scheduler.ScheduleTask(task)
+			if tt.valid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "accepted formats")
+		})
+	}
+}
+
+func TestNextFireTimes(t *testing.T) {
+	from := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	times, err := services.NextFireTimes("*/15 * * * *", from, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		from.Add(15 * time.Minute),
+		from.Add(30 * time.Minute),
+		from.Add(45 * time.Minute),
+	}, times)
+
+	times, err = services.NextFireTimes("*/20 * * * * *", from, 3)
+	require.NoError(t, err)
+	assert.Equal(t, from.Add(20*time.Second), times[0])
+	assert.Equal(t, from.Add(60*time.Second), times[2])
+
+	times, err = services.NextFireTimes("@every 90s", from, 2)
+	require.NoError(t, err)
+	assert.Equal(t, from.Add(90*time.Second), times[0])
+	assert.Equal(t, from.Add(180*time.Second), times[1])
+
+	_, err = services.NextFireTimes("* * * * * * *", from, 3)
+	assert.Error(t, err)
+}
+
+func TestSchedulerService_NextRuns(t *testing.T) {
+	scheduler := newSchedulerTestService(t)
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	scheduler.SetLocation(zone)
+
+	// Mondays at 09:30 in the scheduler's time zone
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID:             "weekly",
+		Name:           "Weekly",
+		AgentID:        "sched-agent",
+		CronExpression: "30 9 * * 1",
+	}))
+
+	now := time.Now().In(zone)
+	first := time.Date(now.Year(), now.Month(), now.Day(), 9, 30, 0, 0, zone)
+	for first.Weekday() != time.Monday || !first.After(now) {
+		first = first.AddDate(0, 0, 1)
+	}
+
+	runs, err := scheduler.NextRuns("weekly", 3)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	for i, run := range runs {
+		expected := first.AddDate(0, 0, 7*i)
+		assert.True(t, expected.Equal(run), "run %d: expected %s, got %s", i, expected, run)
+		assert.Equal(t, zone, run.Location())
+		assert.Equal(t, 7, run.UTC().Hour())
+	}
+
+	next, err := scheduler.GetNextRun("weekly")
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	assert.True(t, first.Equal(*next))
+
+	// A paused task reports no upcoming runs until it is resumed
+	require.NoError(t, scheduler.PauseTask("weekly"))
+	runs, err = scheduler.NextRuns("weekly", 3)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	require.NoError(t, scheduler.ResumeTask("weekly"))
+	runs, err = scheduler.NextRuns("weekly", 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.True(t, first.Equal(runs[0]))
+
+	_, err = scheduler.NextRuns("weekly", 0)
+	assert.Error(t, err)
+	_, err = scheduler.NextRuns("weekly", services.MaxNextRuns+1)
+	assert.Error(t, err)
+	_, err = scheduler.NextRuns("missing", 1)
+	assert.ErrorIs(t, err, models.ErrTaskNotFound)
+}
+
+func TestTaskFireTimesAcrossDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	task := &models.ScheduledTask{CronExpression: "0 6 * * *", Timezone: "America/New_York"}
+
+	// Clocks spring forward on 2026-03-08: 06:00 stays 06:00 local, one hour earlier in UTC
+	runs, err := services.TaskFireTimes(task, time.UTC, time.Date(2026, 3, 6, 12, 0, 0, 0, time.UTC), 3)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	for i, utcHour := range []int{11, 10, 10} {
+		assert.Equal(t, newYork, runs[i].Location())
+		assert.Equal(t, 6, runs[i].Hour())
+		assert.Equal(t, 7+i, runs[i].Day())
+		assert.Equal(t, utcHour, runs[i].UTC().Hour(), "run %d", i)
+	}
+
+	// Clocks fall back on 2026-11-01
+	runs, err = services.TaskFireTimes(task, time.UTC, time.Date(2026, 10, 30, 12, 0, 0, 0, time.UTC), 3)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	for i, utcHour := range []int{10, 11, 11} {
+		assert.Equal(t, 6, runs[i].Hour())
+		assert.Equal(t, utcHour, runs[i].UTC().Hour(), "run %d", i)
+	}
+
+	// A run in the skipped hour doesn't happen that day, one in the repeated hour happens twice
+	task.CronExpression = "30 2 * * *"
+	runs, err = services.TaskFireTimes(task, time.UTC, time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC), 1)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 9, 2, 30, 0, 0, newYork), runs[0])
+
+	task.CronExpression = "30 1 * * *"
+	runs, err = services.TaskFireTimes(task, time.UTC, time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC), 3)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, time.Hour, runs[1].Sub(runs[0]))
+	assert.Equal(t, 1, runs[1].Hour())
+	assert.Equal(t, 2, runs[2].Day())
+
+	// Without a zone the fallback applies
+	task.Timezone = ""
+	runs, err = services.TaskFireTimes(task, time.UTC, time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC), 1)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 8, 1, 30, 0, 0, time.UTC), runs[0])
+}
+
+func TestSchedulerService_TaskTimezone(t *testing.T) {
+	scheduler := newSchedulerTestService(t)
+	scheduler.SetLocation(time.UTC)
+
+	task := &models.ScheduledTask{
+		ID:             "zoned",
+		Name:           "Zoned",
+		AgentID:        "sched-agent",
+		CronExpression: "0 6 * * *",
+		Timezone:       "Asia/Tokyo",
+	}
+	require.NoError(t, scheduler.ScheduleTask(task))
+
+	runs, err := scheduler.NextRuns("zoned", 2)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	for _, run := range runs {
+		assert.Equal(t, "Asia/Tokyo", run.Location().String())
+		assert.Equal(t, 6, run.Hour())
+		assert.Equal(t, 21, run.UTC().Hour())
+	}
+
+	// Changing the zone reschedules the task
+	updated := *task
+	updated.Timezone = "Europe/London"
+	require.NoError(t, scheduler.UpdateTask(&updated))
+	runs, err = scheduler.NextRuns("zoned", 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "Europe/London", runs[0].Location().String())
+	assert.Equal(t, 6, runs[0].Hour())
+
+	// Unknown zones are rejected when scheduling and updating
+	invalid := updated
+	invalid.Timezone = "Mars/Olympus_Mons"
+	err = scheduler.UpdateTask(&invalid)
+	assert.ErrorIs(t, err, models.ErrInvalidTask)
+	assert.ErrorContains(t, err, "Mars/Olympus_Mons")
+
+	invalid.ID = "zoned-invalid"
+	assert.ErrorIs(t, scheduler.ScheduleTask(&invalid), models.ErrInvalidTask)
+	_, err = scheduler.GetTask("zoned-invalid")
+	assert.ErrorIs(t, err, models.ErrTaskNotFound)
+}
+
+func TestSchedulerService_QueuedRunOfPausedTask(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	require.NoError(t, agentService.RegisterAgent(&models.AgentConfiguration{
+		ID:                      "queued-agent",
+		Name:                    "Queued Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/sleep",
+		AccessType:              models.ReadWriteAccessType,
+		MaxConcurrentExecutions: 1,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 30,
+		Enabled:                 true,
+	}))
+
+	executionService := &SlowExecutionService{delay: time.Second}
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	require.NoError(t, scheduler.ScheduleTask(&models.ScheduledTask{
+		ID:             "queued-task",
+		Name:           "Queued Task",
+		AgentID:        "queued-agent",
+		CronExpression: "@every 1h",
+		OverlapPolicy:  types.OverlapPolicyQueue,
+	}))
+
+	// The second fire queues behind the first, which is in flight when the task is paused
+	fired := make(chan struct{})
+	go func() {
+		scheduler.FireTask("queued-task")
+		close(fired)
+	}()
+	require.Eventually(t, func() bool {
+		_, started := executionService.stats()
+		return started == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	scheduler.FireTask("queued-task")
+	require.NoError(t, scheduler.PauseTask("queued-task"))
+
+	// The queued run is dropped instead of running the task as it was when it queued
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first run did not finish")
+	}
+	_, started := executionService.stats()
+	assert.Equal(t, 1, started)
+
+	// The task runs again once it is resumed; nothing is left queued
+	require.NoError(t, scheduler.ResumeTask("queued-task"))
+	scheduler.FireTask("queued-task")
+	_, started = executionService.stats()
+	assert.Equal(t, 2, started)
+}
+
+// SlowExecutionService simulates a long-running agent and tracks run concurrency
+type SlowExecutionService struct {
+	services.IExecutionService
+	delay         time.Duration
+	mutex         sync.Mutex
+	running       int
+	maxConcurrent int
+	started       int
+	failures      int
+}
+
+func (s *SlowExecutionService) ExecuteAgent(ctx context.Context, agent agents.IAgent, input string) (*models.AgentExecution, error) {
+	s.mutex.Lock()
+	s.running++
+	s.started++
+	if s.running > s.maxConcurrent {
+		s.maxConcurrent = s.running
+	}
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.running--
+		s.mutex.Unlock()
+	}()
+
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mutex.Lock()
+	fail := s.started <= s.failures
+	s.mutex.Unlock()
+	if fail {
+		return nil, fmt.Errorf("flaky agent failure")
+	}
+
+	now := time.Now()
+	return &models.AgentExecution{ID: fmt.Sprintf("exec-%d", now.UnixNano()), AgentID: agent.GetID(), StartTime: now, EndTime: &now}, nil
+}
+
+func (s *SlowExecutionService) stats() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.maxConcurrent, s.started
+}
+
+func TestSchedulerService_OverlapPolicy(t *testing.T) {
+	for _, policy := range []types.OverlapPolicy{types.OverlapPolicySkip, types.OverlapPolicyQueue} {
+		policy := policy
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+
+			logger, _ := zap.NewDevelopment()
+			agentService := services.NewAgentService(logger)
+			err := agentService.RegisterAgent(&models.AgentConfiguration{
+				ID:                      "slow-agent",
+				Name:                    "Slow Agent",
+				AgentType:               "test-type",
+				ExecutablePath:          "/bin/sleep",
+				AccessType:              models.ReadWriteAccessType,
+				MaxConcurrentExecutions: 1,
+				Mode:                    models.TaskMode,
+				InputPattern:            models.StdinPattern,
+				OutputPattern:           models.StdoutPattern,
+				Timeout:                 30,
+				Enabled:                 true,
+			})
+			require.NoError(t, err)
+
+			executionService := &SlowExecutionService{delay: 3 * time.Second}
+			scheduler := services.NewSchedulerService(agentService, executionService, logger)
+
+			task := &models.ScheduledTask{
+				ID:             "overlap-" + string(policy),
+				Name:           "Overlap Task",
+				AgentID:        "slow-agent",
+				CronExpression: "@every 1s",
+				OverlapPolicy:  policy,
+			}
+			require.NoError(t, scheduler.ScheduleTask(task))
+
+			time.Sleep(5500 * time.Millisecond)
+			require.NoError(t, scheduler.UnscheduleTask(task.ID))
+
+			maxConcurrent, started := executionService.stats()
+			assert.Equal(t, 1, maxConcurrent)
+
+			history, err := scheduler.GetTaskHistory(task.ID, 0)
+			require.NoError(t, err)
+
+			skipped := 0
+			for _, h := range history {
+				if h.Status == types.SkippedStatus {
+					skipped++
+				}
+			}
+
+			// The first run occupies roughly 3 of the elapsed seconds either way
+			assert.GreaterOrEqual(t, started, 1)
+			if policy == types.OverlapPolicySkip {
+				assert.GreaterOrEqual(t, skipped, 2)
+			} else {
+				// Queued runs start back to back as soon as the previous one completes
+				assert.GreaterOrEqual(t, started, 2)
+				assert.Equal(t, 0, skipped)
+			}
+		})
+	}
+}
+
+func TestSchedulerService_TaskTimeoutAndRetries(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	agentService := services.NewAgentService(logger)
+	err := agentService.RegisterAgent(&models.AgentConfiguration{
+		ID:                      "batch-agent",
+		Name:                    "Batch Agent",
+		AgentType:               "test-type",
+		ExecutablePath:          "/bin/sleep",
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 1,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Timeout:                 60,
+		Enabled:                 true,
+	})
+	require.NoError(t, err)
+
+	t.Run("timeout cap", func(t *testing.T) {
+		scheduler := services.NewSchedulerService(agentService, &SlowExecutionService{}, logger)
+		scheduler.SetMaxTaskTimeout(time.Minute)
+
+		err := scheduler.ScheduleTask(&models.ScheduledTask{
+			ID:             "capped-task",
+			AgentID:        "batch-agent",
+			CronExpression: "@hourly",
+			Timeout:        7200,
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds the maximum task timeout")
+	})
+
+	t.Run("task timeout overrides agent", func(t *testing.T) {
+		executionService := &SlowExecutionService{delay: 5 * time.Second}
+		scheduler := services.NewSchedulerService(agentService, executionService, logger)
+
+		task := &models.ScheduledTask{
+			ID:             "timeout-task",
+			AgentID:        "batch-agent",
+			CronExpression: "@every 1s",
+			Timeout:        1,
+		}
+		require.NoError(t, scheduler.ScheduleTask(task))
+		defer scheduler.UnscheduleTask(task.ID)
+
+		// Fires overlapping the timed-out run may be recorded as skipped first
+		var run *models.ExecutionHistory
+		assert.Eventually(t, func() bool {
+			history, _ := scheduler.GetTaskHistory(task.ID, 0)
+			for _, entry := range history {
+				if entry.Status != types.SkippedStatus {
+					run = entry
+					return true
+				}
+			}
+			return false
+		}, 5*time.Second, 50*time.Millisecond)
+
+		require.NotNil(t, run)
+		assert.Equal(t, types.TimeoutStatus, run.Status)
+		assert.Less(t, run.ExecutionTimeMs, int64(2000))
+	})
+
+	t.Run("retries until success", func(t *testing.T) {
+		executionService := &SlowExecutionService{delay: 10 * time.Millisecond, failures: 2}
+		scheduler := services.NewSchedulerService(agentService, executionService, logger)
+
+		task := &models.ScheduledTask{
+			ID:             "retry-task",
+			AgentID:        "batch-agent",
+			CronExpression: "@every 1s",
+			MaxRetries:     2,
+		}
+		require.NoError(t, scheduler.ScheduleTask(task))
+		defer scheduler.UnscheduleTask(task.ID)
+
+		var history []*models.ExecutionHistory
+		assert.Eventually(t, func() bool {
+			history, _ = scheduler.GetTaskHistory(task.ID, 0)
+			return len(history) >= 3
+		}, 5*time.Second, 50*time.Millisecond)
+
+		require.GreaterOrEqual(t, len(history), 3)
+		assert.Equal(t, types.FailureStatus, history[0].Status)
+		assert.Equal(t, types.FailureStatus, history[1].Status)
+		assert.Equal(t, types.SuccessStatus, history[2].Status)
+		assert.Equal(t, []int{0, 1, 2}, []int{history[0].RetryCount, history[1].RetryCount, history[2].RetryCount})
+	})
+}
+
+func TestSchedulerService_CatchUpPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   types.CatchUpPolicy
+		maxRuns  int
+		expected int
+	}{
+		{"none", types.CatchUpPolicyNone, 0, 0},
+		{"run once", types.CatchUpPolicyRunOnce, 0, 1},
+		{"run all", types.CatchUpPolicyRunAll, 0, 3},
+		{"run all capped", types.CatchUpPolicyRunAll, 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := newSchedulerTestService(t)
+			scheduler.SetCatchUpInterval(0)
+
+			// The last run happened just over three intervals ago
+			lastRun := time.Now().Add(-3*time.Hour - time.Minute)
+			task := &models.ScheduledTask{
+				ID:               "catch-up-task",
+				AgentID:          "sched-agent",
+				CronExpression:   "@every 1h",
+				LastScheduledRun: &lastRun,
+				CatchUpPolicy:    tt.policy,
+				MaxCatchUpRuns:   tt.maxRuns,
+			}
+			require.NoError(t, scheduler.ScheduleTask(task))
+			defer scheduler.UnscheduleTask(task.ID)
+
+			countCatchUps := func() int {
+				history, _ := scheduler.GetTaskHistory(task.ID, 0)
+				count := 0
+				for _, h := range history {
+					if h.TriggerType == types.TaskTriggerTypeCatchUp {
+						count++
+					}
+				}
+				return count
+			}
+
+			if tt.expected > 0 {
+				assert.Eventually(t, func() bool {
+					return countCatchUps() >= tt.expected
+				}, 10*time.Second, 50*time.Millisecond)
+			}
+
+			// Give any extra runs a chance to show up before asserting the exact count
+			time.Sleep(200 * time.Millisecond)
+			assert.Equal(t, tt.expected, countCatchUps())
+		})
+	}
+}
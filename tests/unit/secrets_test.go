@@ -0,0 +1,43 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretKeyDetection(t *testing.T) {
+	for _, key := range []string{"API_KEY", "db_password", "GithubToken", "AUTH_HEADER", "TLS_CERT"} {
+		assert.True(t, models.IsSensitiveEnvKey(key), key)
+	}
+	for _, key := range []string{"REGION", "LOG_LEVEL", "DATABASE_URL"} {
+		assert.False(t, models.IsSensitiveEnvKey(key), key)
+	}
+
+	config := &models.AgentConfiguration{SensitiveEnvKeys: []string{"DATABASE_URL"}}
+	assert.True(t, config.IsSensitiveEnv("DATABASE_URL"))
+	assert.False(t, config.IsSensitiveEnv("REGION"))
+}
+
+func TestSecretMaskingCopiesConfiguration(t *testing.T) {
+	config := &models.AgentConfiguration{
+		ID:               "agent",
+		Envs:             map[string]string{"API_KEY": "k", "DATABASE_URL": "postgres://", "REGION": "eu"},
+		SensitiveEnvKeys: []string{"DATABASE_URL"},
+	}
+
+	masked := config.Masked()
+	assert.Equal(t, map[string]string{"API_KEY": models.MaskedValue, "DATABASE_URL": models.MaskedValue, "REGION": "eu"}, masked.Envs)
+	assert.Equal(t, "k", config.Envs["API_KEY"], "the original keeps its values")
+	assert.Equal(t, []string{"API_KEY", "DATABASE_URL"}, masked.MaskedEnvKeys())
+
+	// Unmasking restores the values the current configuration has, replacing the shared map
+	restored := *masked
+	restored.Unmask(&models.AgentConfiguration{Envs: map[string]string{"API_KEY": "k2"}})
+	assert.Equal(t, map[string]string{"API_KEY": "k2", "DATABASE_URL": models.MaskedValue, "REGION": "eu"}, restored.Envs)
+	assert.Equal(t, models.MaskedValue, masked.Envs["API_KEY"])
+
+	empty := (&models.AgentConfiguration{}).Masked()
+	assert.Nil(t, empty.Envs)
+}
@@ -0,0 +1,329 @@
+package unit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/storage"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresTestDSN returns a connection string to a schema of its own in the database
+// SUPERVISOR_TEST_POSTGRES_DSN names, dropped when the test ends, and skips the test without one
+func postgresTestDSN(t *testing.T) string {
+	dsn := os.Getenv("SUPERVISOR_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SUPERVISOR_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open(storage.DefaultPostgresDriver, dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	schema := fmt.Sprintf("supervisor_test_%d", time.Now().UnixNano())
+	_, err = db.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// Unknown settings are sent as run-time parameters, so search_path scopes every connection
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		parsed, err := url.Parse(dsn)
+		require.NoError(t, err)
+		query := parsed.Query()
+		query.Set("search_path", schema)
+		parsed.RawQuery = query.Encode()
+		return parsed.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// storeBackends returns fresh stores for every backend available; postgres is included when
+// SUPERVISOR_TEST_POSTGRES_DSN names a database
+func storeBackends(t *testing.T) map[string]*storage.Stores {
+	backends := map[string]*storage.Stores{}
+
+	memory, err := storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendMemory})
+	require.NoError(t, err)
+	backends[storage.StoreBackendMemory] = memory
+
+	sqlite, err := storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendSQLite, Path: filepath.Join(t.TempDir(), "state.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlite.Close() })
+	backends[storage.StoreBackendSQLite] = sqlite
+
+	if os.Getenv("SUPERVISOR_TEST_POSTGRES_DSN") != "" {
+		postgres, err := storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendPostgres, DSN: postgresTestDSN(t)})
+		require.NoError(t, err)
+		t.Cleanup(func() { postgres.Close() })
+		backends[storage.StoreBackendPostgres] = postgres
+	}
+	return backends
+}
+
+// storedExecution creates an execution of agentID that started at start
+func storedExecution(id, agentID string, state types.AgentState, start time.Time) *models.AgentExecution {
+	return &models.AgentExecution{
+		ID:          id,
+		AgentID:     agentID,
+		State:       state,
+		StartTime:   start,
+		Labels:      map[string]string{"team": agentID},
+		TriggerType: types.TaskTriggerTypeAPI,
+		TriggeredBy: "client-" + agentID,
+		CreatedAt:   start,
+		UpdatedAt:   start,
+	}
+}
+
+// executionIDs returns the IDs of executions in order
+func executionIDs(executions []*models.AgentExecution) []string {
+	ids := make([]string, len(executions))
+	for i, execution := range executions {
+		ids[i] = execution.ID
+	}
+	return ids
+}
+
+func TestStateStoreAgentsAndTasks(t *testing.T) {
+	for name, stores := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			agent := &models.AgentConfiguration{ID: "store-agent-" + name, Name: "first", AccessType: models.ReadOnlyAccessType, UpdatedAt: time.Now()}
+			require.NoError(t, stores.Agents.CreateAgent(agent))
+			assert.ErrorIs(t, stores.Agents.CreateAgent(&models.AgentConfiguration{ID: agent.ID, Name: "second"}), models.ErrAgentConflict)
+
+			stored, err := stores.Agents.GetAgent(agent.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "first", stored.Name)
+
+			renamed := *stored
+			renamed.Name = "renamed"
+			require.NoError(t, stores.Agents.SaveAgent(&renamed))
+			stored, err = stores.Agents.GetAgent(agent.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "renamed", stored.Name)
+
+			agents, err := stores.Agents.ListAgents()
+			require.NoError(t, err)
+			listed := false
+			for _, config := range agents {
+				listed = listed || config.ID == agent.ID
+			}
+			assert.True(t, listed)
+
+			_, err = stores.Agents.GetAgent("missing")
+			assert.ErrorIs(t, err, models.ErrAgentNotFound)
+			assert.ErrorIs(t, stores.Agents.SaveAgent(&models.AgentConfiguration{ID: "missing"}), models.ErrAgentNotFound)
+			require.NoError(t, stores.Agents.DeleteAgent(agent.ID))
+			assert.ErrorIs(t, stores.Agents.DeleteAgent(agent.ID), models.ErrAgentNotFound)
+
+			task := &models.ScheduledTask{ID: "store-task-" + name, AgentID: agent.ID, CronExpression: "0 * * * * *", Active: true}
+			require.NoError(t, stores.Tasks.CreateTask(task))
+			assert.ErrorIs(t, stores.Tasks.CreateTask(task), models.ErrTaskConflict)
+
+			paused := *task
+			paused.Active = false
+			require.NoError(t, stores.Tasks.SaveTask(&paused))
+			storedTask, err := stores.Tasks.GetTask(task.ID)
+			require.NoError(t, err)
+			assert.False(t, storedTask.Active)
+			assert.Equal(t, "0 * * * * *", storedTask.CronExpression)
+
+			require.NoError(t, stores.Tasks.DeleteTask(task.ID))
+			_, err = stores.Tasks.GetTask(task.ID)
+			assert.ErrorIs(t, err, models.ErrTaskNotFound)
+		})
+	}
+}
+
+func TestStateStoreConcurrentRegistration(t *testing.T) {
+	for name, stores := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			const attempts = 8
+			var wg sync.WaitGroup
+			errs := make(chan error, attempts)
+			for i := 0; i < attempts; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- stores.Agents.CreateAgent(&models.AgentConfiguration{ID: "contended-" + name, UpdatedAt: time.Now()})
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			// Exactly one registration wins, the others conflict
+			created := 0
+			for err := range errs {
+				if err == nil {
+					created++
+					continue
+				}
+				assert.True(t, errors.Is(err, models.ErrAgentConflict), err)
+			}
+			assert.Equal(t, 1, created)
+		})
+	}
+}
+
+func TestStateStoreExecutions(t *testing.T) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	for name, stores := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			agentID := "exec-agent-" + name
+			first := storedExecution("e1-"+name, agentID, models.RunningState, base.Add(2*time.Minute))
+			second := storedExecution("e2-"+name, agentID, models.QueuedState, base.Add(time.Minute))
+			other := storedExecution("e3-"+name, "other-"+name, models.RunningState, base)
+			other.TaskID = "nightly-" + name
+			for _, execution := range []*models.AgentExecution{first, second, other} {
+				require.NoError(t, stores.Executions.SaveExecution(execution))
+			}
+
+			// Queries select on the filter, oldest first
+			executions, err := stores.Executions.QueryExecutions(models.ExecutionFilter{AgentID: agentID})
+			require.NoError(t, err)
+			assert.Equal(t, []string{second.ID, first.ID}, executionIDs(executions))
+			executions, err = stores.Executions.QueryExecutions(models.ExecutionFilter{TaskID: other.TaskID})
+			require.NoError(t, err)
+			assert.Equal(t, []string{other.ID}, executionIDs(executions))
+			executions, err = stores.Executions.QueryExecutions(models.ExecutionFilter{AgentID: agentID, Labels: map[string]string{"team": "nobody"}})
+			require.NoError(t, err)
+			assert.Empty(t, executions)
+
+			// An execution finishes once; another final state cannot replace it
+			finished := *first
+			finished.State = models.CompletedState
+			require.NoError(t, stores.Executions.SaveExecution(&finished))
+			finished.ExitCode = 3
+			require.NoError(t, stores.Executions.SaveExecution(&finished))
+			cancelled := finished
+			cancelled.State = models.CancelledState
+			assert.ErrorIs(t, stores.Executions.SaveExecution(&cancelled), models.ErrExecutionConflict)
+
+			stored, err := stores.Executions.GetExecution(first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, types.CompletedState, stored.State)
+			assert.Equal(t, 3, stored.ExitCode)
+			assert.True(t, stored.StartTime.Equal(first.StartTime))
+
+			_, err = stores.Executions.GetExecution("missing")
+			assert.ErrorIs(t, err, models.ErrExecutionNotFound)
+
+			require.NoError(t, stores.Executions.SaveExecutionResult(first.ID, &models.ExecutionResult{ID: first.ID, Output: "done", Status: types.SuccessStatus}))
+			result, err := stores.Executions.GetExecutionResult(first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "done", result.Output)
+			_, err = stores.Executions.GetExecutionResult(second.ID)
+			assert.ErrorIs(t, err, models.ErrExecutionNotFound)
+		})
+	}
+}
+
+func TestStateStoreExecutionCursor(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, stores := range storeBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			// Two executions share each start time, so the ID breaks ties
+			for i := 0; i < 10; i++ {
+				execution := storedExecution(string(rune('a'+i)), "agent-a", types.CompletedState, base.Add(time.Duration(i/2)*time.Minute))
+				if i%3 == 0 {
+					execution.AgentID, execution.Labels = "agent-b", map[string]string{"team": "agent-b"}
+				}
+				require.NoError(t, stores.Executions.SaveExecution(execution))
+			}
+
+			// Pages follow each other without gaps or repeats
+			var pages [][]string
+			var cursor models.ExecutionCursor
+			for {
+				page, err := stores.Executions.QueryExecutionsAfter(models.ExecutionFilter{}, cursor, 4)
+				require.NoError(t, err)
+				pages = append(pages, executionIDs(page))
+				if len(page) < 4 {
+					break
+				}
+				cursor = models.CursorAt(page[len(page)-1])
+			}
+			assert.Equal(t, [][]string{{"a", "b", "c", "d"}, {"e", "f", "g", "h"}, {"i", "j"}}, pages)
+
+			// Labels are matched past the rows they skip, and the start time bounds apply
+			page, err := stores.Executions.QueryExecutionsAfter(models.ExecutionFilter{Labels: map[string]string{"team": "agent-b"}}, models.ExecutionCursor{}, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "d"}, executionIDs(page))
+			filter := models.ExecutionFilter{AgentID: "agent-a", Since: base.Add(time.Minute), Until: base.Add(4 * time.Minute)}
+			page, err = stores.Executions.QueryExecutionsAfter(filter, models.ExecutionCursor{}, 100)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"c", "e", "f", "h"}, executionIDs(page))
+			all, err := stores.Executions.QueryExecutions(filter)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"c", "e", "f", "h"}, executionIDs(all))
+		})
+	}
+}
+
+func TestStateStoreSQLiteMigratesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	stores, err := storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendSQLite, Path: path})
+	require.NoError(t, err)
+	require.NoError(t, stores.Agents.CreateAgent(&models.AgentConfiguration{ID: "kept", UpdatedAt: time.Now()}))
+	require.NoError(t, stores.Close())
+
+	// Reopening keeps the data and applies no migration twice
+	stores, err = storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendSQLite, Path: path})
+	require.NoError(t, err)
+	defer stores.Close()
+	_, err = stores.Agents.GetAgent("kept")
+	assert.NoError(t, err)
+
+	_, err = storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendPostgres, DSN: "postgres://localhost/none", Driver: "missing-driver"})
+	assert.ErrorContains(t, err, "not registered")
+	assert.Contains(t, sql.Drivers(), storage.DefaultPostgresDriver)
+	_, err = storage.NewStores(storage.StoreOptions{Backend: "etcd"})
+	assert.Error(t, err)
+}
+
+func TestStateStorePostgresSharedByInstances(t *testing.T) {
+	dsn := postgresTestDSN(t)
+
+	// Instances starting together migrate the shared database exactly once
+	const instances = 4
+	var wg sync.WaitGroup
+	opened := make([]*storage.Stores, instances)
+	errs := make([]error, instances)
+	for i := range opened {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opened[i], errs[i] = storage.NewStores(storage.StoreOptions{Backend: storage.StoreBackendPostgres, DSN: dsn, MaxOpenConns: 2})
+		}()
+	}
+	wg.Wait()
+	for i := range opened {
+		require.NoError(t, errs[i])
+		t.Cleanup(func() { opened[i].Close() })
+	}
+
+	// What one instance stores, the others read
+	require.NoError(t, opened[0].Agents.CreateAgent(&models.AgentConfiguration{ID: "shared", Name: "Shared", UpdatedAt: time.Now()}))
+	agent, err := opened[1].Agents.GetAgent("shared")
+	require.NoError(t, err)
+	assert.Equal(t, "Shared", agent.Name)
+	assert.ErrorIs(t, opened[2].Agents.CreateAgent(&models.AgentConfiguration{ID: "shared", UpdatedAt: time.Now()}), models.ErrAgentConflict)
+
+	start := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, opened[3].Executions.SaveExecution(storedExecution("shared-run", "shared", models.RunningState, start)))
+	execution, err := opened[0].Executions.GetExecution("shared-run")
+	require.NoError(t, err)
+	assert.Equal(t, "shared", execution.AgentID)
+	assert.Equal(t, "client-shared", execution.TriggeredBy)
+}
@@ -0,0 +1,194 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// quickRetries retries within a second with short waits and no circuit breaker
+var quickRetries = supervisorctl.RetryPolicy{
+	MaxElapsed:      time.Second,
+	InitialInterval: 10 * time.Millisecond,
+	MaxInterval:     50 * time.Millisecond,
+}
+
+// flakyServer fails the first failures requests with status and answers the rest with body
+func flakyServer(t *testing.T, failures int32, status int, body string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if requests.Add(1) <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"unavailable","code":"INTERNAL_ERROR"}`))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestClientRetriesIdempotentRequests(t *testing.T) {
+	server, requests := flakyServer(t, 2, http.StatusServiceUnavailable, `{"execution":{"id":"exec-1","state":"completed"}}`)
+	client := supervisorctl.NewClient(server.URL)
+	client.SetRetryPolicy(quickRetries)
+
+	execution, err := client.GetExecution(context.Background(), "exec-1")
+	require.NoError(t, err)
+	assert.Equal(t, "completed", execution.State)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestClientDoesNotRetryFailedPost(t *testing.T) {
+	server, requests := flakyServer(t, 2, http.StatusInternalServerError, `{"execution":{"id":"exec-1"}}`)
+	client := supervisorctl.NewClient(server.URL)
+	client.SetRetryPolicy(quickRetries)
+
+	_, err := client.StopExecution(context.Background(), "exec-1", "")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, supervisorctl.ErrServerError)
+	assert.Equal(t, supervisorctl.ExitServerError, supervisorctl.ExitCode(err))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestClientRetriesPostUntilServerAcceptsConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	// The supervisor comes back after a restart; until then connections are refused
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"execution":{"id":"exec-1","state":"cancelled"}}`))
+	}))
+	t.Cleanup(server.Close)
+	time.AfterFunc(200*time.Millisecond, func() {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return
+		}
+		server.Listener = listener
+		server.Start()
+	})
+
+	client := supervisorctl.NewClient("http://" + address)
+	client.SetRetryPolicy(supervisorctl.RetryPolicy{MaxElapsed: 3 * time.Second, InitialInterval: 20 * time.Millisecond, MaxInterval: 100 * time.Millisecond})
+
+	execution, err := client.StopExecution(context.Background(), "exec-1", "HUP")
+	require.NoError(t, err)
+	assert.Equal(t, "cancelled", execution.State)
+}
+
+func TestClientErrorKinds(t *testing.T) {
+	// Nothing listens on a closed listener's address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	client := supervisorctl.NewClient("http://" + address)
+	client.SetRetryPolicy(quickRetries)
+	_, err = client.GetExecution(context.Background(), "exec-1")
+	assert.ErrorIs(t, err, supervisorctl.ErrUnreachable)
+	assert.Equal(t, supervisorctl.ExitUnreachable, supervisorctl.ExitCode(err))
+
+	// Rejected tokens are not retried
+	server, requests := flakyServer(t, 1, http.StatusUnauthorized, `{}`)
+	client = supervisorctl.NewClient(server.URL)
+	client.SetRetryPolicy(quickRetries)
+	_, err = client.GetExecution(context.Background(), "exec-1")
+	assert.ErrorIs(t, err, supervisorctl.ErrUnauthorized)
+	assert.Equal(t, supervisorctl.ExitUnauthorized, supervisorctl.ExitCode(err))
+	assert.Equal(t, int32(1), requests.Load())
+
+	var apiErr *supervisorctl.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestClientCircuitBreakerFailsFast(t *testing.T) {
+	server, requests := flakyServer(t, 100, http.StatusServiceUnavailable, `{}`)
+	client := supervisorctl.NewClient(server.URL)
+	client.SetRetryPolicy(supervisorctl.RetryPolicy{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetExecution(context.Background(), "exec-1")
+		assert.ErrorIs(t, err, supervisorctl.ErrServerError)
+	}
+
+	// The circuit is open, so the request fails without reaching the supervisor
+	_, err := client.GetExecution(context.Background(), "exec-1")
+	assert.ErrorIs(t, err, supervisorctl.ErrCircuitOpen)
+	assert.ErrorIs(t, err, supervisorctl.ErrUnreachable)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestLoadClientConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "supervisorctl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`server:
+  url: http://supervisor:9090
+  token: secret
+  retries:
+    max_elapsed: 1m
+    breaker_threshold: 10
+`), 0644))
+
+	config, err := supervisorctl.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "http://supervisor:9090", config.Server.URL)
+	assert.Equal(t, "secret", config.Server.Token)
+	assert.Equal(t, time.Minute, config.Server.Retries.MaxElapsed)
+	assert.Equal(t, 10, config.Server.Retries.BreakerThreshold)
+
+	// Settings left out keep their defaults
+	defaults := supervisorctl.DefaultRetryPolicy()
+	assert.Equal(t, defaults.InitialInterval, config.Server.Retries.InitialInterval)
+	assert.Equal(t, defaults.BreakerCooldown, config.Server.Retries.BreakerCooldown)
+}
+
+func TestClientExecuteOrQueue(t *testing.T) {
+	queued := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"execution_id":"exec-2","agent_id":"builder","state":"queued","queue_position":2,"estimated_wait_ms":3000}`))
+	}))
+	t.Cleanup(queued.Close)
+
+	result, execution, err := supervisorctl.NewClient(queued.URL).ExecuteOrQueue(context.Background(), "builder", supervisorctl.ExecuteRequest{Input: "make"})
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	require.NotNil(t, execution)
+	assert.Equal(t, "exec-2", execution.ExecutionID)
+	assert.Equal(t, 2, execution.QueuePosition)
+	assert.Equal(t, int64(3000), execution.EstimatedWaitMs)
+
+	server, _ := flakyServer(t, 0, http.StatusOK, `{"id":"exec-3","status":"success","output":"done"}`)
+	result, execution, err = supervisorctl.NewClient(server.URL).ExecuteOrQueue(context.Background(), "builder", supervisorctl.ExecuteRequest{Input: "make"})
+	require.NoError(t, err)
+	assert.Nil(t, execution)
+	require.NotNil(t, result)
+	assert.Equal(t, "done", result.Output)
+}
+
+func TestParseDetachKey(t *testing.T) {
+	for text, expected := range map[string]byte{"ctrl-]": 0x1d, "CTRL-X": 0x18, "ctrl-a": 0x01, "q": 'q'} {
+		key, err := supervisorctl.ParseDetachKey(text)
+		require.NoError(t, err, text)
+		assert.Equal(t, expected, key, text)
+	}
+	for _, text := range []string{"", "ctrl-", "ctrl-1", "alt-x"} {
+		_, err := supervisorctl.ParseDetachKey(text)
+		assert.Error(t, err, text)
+	}
+}
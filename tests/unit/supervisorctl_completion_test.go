@@ -0,0 +1,206 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCompletionClient answers completion queries from fixed agents, groups and tasks, or fails them
+// all with err
+type mockCompletionClient struct {
+	agents []string
+	groups []string
+	tasks  []string
+	err    error
+}
+
+func (m *mockCompletionClient) ListAgents(ctx context.Context, options supervisorctl.ListOptions) (*supervisorctl.AgentPage, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := &supervisorctl.AgentPage{}
+	for _, id := range m.agents {
+		page.Agents = append(page.Agents, supervisorctl.AgentSpec{ID: id})
+	}
+	return page, nil
+}
+
+func (m *mockCompletionClient) ListGroups(ctx context.Context) ([]supervisorctl.AgentGroup, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var groups []supervisorctl.AgentGroup
+	for _, name := range m.groups {
+		groups = append(groups, supervisorctl.AgentGroup{Name: name})
+	}
+	return groups, nil
+}
+
+func (m *mockCompletionClient) QueryTasks(ctx context.Context, options supervisorctl.ListOptions) (*supervisorctl.TaskPage, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := &supervisorctl.TaskPage{}
+	for _, id := range m.tasks {
+		page.Tasks = append(page.Tasks, supervisorctl.Task{ID: id})
+	}
+	return page, nil
+}
+
+func newMockCompletionClient() *mockCompletionClient {
+	return &mockCompletionClient{
+		agents: []string{"ledger", "payments-api", "payments-worker"},
+		groups: []string{"payments"},
+		tasks:  []string{"nightly-report", "nightly-sync", "hourly-check"},
+	}
+}
+
+func TestCompleteAgentTargets(t *testing.T) {
+	complete := supervisorctl.CompleteAgentTargets(newMockCompletionClient())
+	ctx := context.Background()
+
+	candidates, directive := complete(ctx, nil, "")
+	assert.Equal(t, []string{"ledger", "payments-api", "payments-worker", "group:payments"}, candidates)
+	assert.Equal(t, supervisorctl.CompletionNoFileComp, directive)
+
+	candidates, _ = complete(ctx, nil, "pay")
+	assert.Equal(t, []string{"payments-api", "payments-worker"}, candidates)
+
+	candidates, _ = complete(ctx, nil, "group:")
+	assert.Equal(t, []string{"group:payments"}, candidates)
+
+	// Targets already on the command line are not offered again
+	candidates, _ = complete(ctx, []string{"payments-api"}, "payments")
+	assert.Equal(t, []string{"payments-worker"}, candidates)
+}
+
+func TestCompleteTaskIDs(t *testing.T) {
+	complete := supervisorctl.CompleteTaskIDs(newMockCompletionClient())
+
+	candidates, directive := complete(context.Background(), nil, "nightly-")
+	assert.Equal(t, []string{"nightly-report", "nightly-sync"}, candidates)
+	assert.Equal(t, supervisorctl.CompletionNoFileComp, directive)
+
+	// Task subcommands take a single task
+	candidates, _ = complete(context.Background(), []string{"nightly-sync"}, "")
+	assert.Empty(t, candidates)
+}
+
+func TestCompletionOfflineFallback(t *testing.T) {
+	failing := &mockCompletionClient{err: errors.New("connection refused")}
+	candidates, directive := supervisorctl.CompleteAgentTargets(failing)(context.Background(), nil, "")
+	assert.Empty(t, candidates)
+	assert.Equal(t, supervisorctl.CompletionNoFileComp, directive)
+
+	// A real client pointed at a closed port falls back the same way
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	client := supervisorctl.NewClient("http://" + address)
+	client.SetRetryPolicy(quickRetries)
+
+	candidates, _ = supervisorctl.CompleteTaskIDs(client)(context.Background(), nil, "")
+	assert.Empty(t, candidates)
+
+	// The output stays well formed: no candidates, only the directive
+	var out bytes.Buffer
+	supervisorctl.Complete(context.Background(), client, &out, []string{"restart", ""})
+	assert.Equal(t, ":4\n", out.String())
+}
+
+func TestCompleteProtocolOutput(t *testing.T) {
+	client := newMockCompletionClient()
+
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"status", "led"}, "ledger\n:4\n"},
+		{[]string{"restart", "group:"}, "group:payments\n:4\n"},
+		{[]string{"task", "p"}, "pause\npreview-input\n:4\n"},
+		{[]string{"task", "run", "hourly"}, "hourly-check\n:4\n"},
+		{[]string{"completion", "f"}, "fish\n:4\n"},
+		{[]string{"agent", "add", ""}, ":0\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		supervisorctl.Complete(context.Background(), client, &out, tt.words)
+		assert.Equal(t, tt.want, out.String(), tt.words)
+	}
+}
+
+// agentsServer is a supervisor listing agentIDs to requests bearing token
+func agentsServer(t *testing.T, token string, agentIDs ...string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page := supervisorctl.AgentPage{Total: len(agentIDs)}
+		for _, id := range agentIDs {
+			page.Agents = append(page.Agents, supervisorctl.AgentSpec{ID: id})
+		}
+		if r.URL.Path == "/api/v1/groups" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"groups": []interface{}{}})
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCompleteWithConfigFollowsProfile(t *testing.T) {
+	staging := agentsServer(t, "staging-token", "staging-agent")
+	prod := agentsServer(t, "prod-token", "prod-agent")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "current_profile: staging\nserver:\n  retries:\n    max_elapsed: 0s\nprofiles:\n" +
+		"  staging:\n    server:\n      url: " + staging.URL + "\n      token: staging-token\n" +
+		"  prod:\n    server:\n      url: " + prod.URL + "\n      token: prod-token\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+	t.Setenv("SUPERVISORCTL_PROFILE", "")
+
+	complete := func(words ...string) string {
+		var out bytes.Buffer
+		supervisorctl.CompleteWithConfig(context.Background(), supervisorctl.NewConfigManager(path), &out, words)
+		return out.String()
+	}
+
+	// Dynamic lookups query the supervisor of the selected profile with its token
+	assert.Equal(t, "staging-agent\n:4\n", complete("status", ""))
+	assert.Equal(t, "prod-agent\n:4\n", complete("--profile", "prod", "status", ""))
+	assert.Equal(t, "prod-agent\n:4\n", complete("status", "--profile=prod", ""))
+	t.Setenv("SUPERVISORCTL_PROFILE", "prod")
+	assert.Equal(t, "prod-agent\n:4\n", complete("restart", ""))
+
+	// --server and --token win over the profile
+	assert.Equal(t, "staging-agent\n:4\n", complete("--server", staging.URL, "--token", "staging-token", "status", ""))
+
+	// The profile names complete --profile; an unknown profile leaves no candidates
+	assert.Equal(t, "prod\n:4\n", complete("--profile", "p"))
+	assert.Equal(t, ":4\n", complete("--profile", "qa", "status", ""))
+}
+
+func TestWriteCompletionScript(t *testing.T) {
+	for _, shell := range supervisorctl.CompletionShells {
+		var out bytes.Buffer
+		require.NoError(t, supervisorctl.WriteCompletionScript(&out, shell))
+		assert.Contains(t, out.String(), "supervisorctl __complete", shell)
+	}
+
+	err := supervisorctl.WriteCompletionScript(&bytes.Buffer{}, "tcsh")
+	assert.ErrorContains(t, err, "unsupported shell \"tcsh\"")
+}
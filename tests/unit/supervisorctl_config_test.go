@@ -0,0 +1,332 @@
+package unit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+)
+
+// shownConfig is the output of ConfigManager.Show
+type shownConfig struct {
+	Server struct {
+		URL     string `yaml:"url"`
+		Token   string `yaml:"token"`
+		Timeout string `yaml:"timeout"`
+		Retries struct {
+			MaxElapsed       string `yaml:"max_elapsed"`
+			BreakerThreshold int    `yaml:"breaker_threshold"`
+		} `yaml:"retries"`
+	} `yaml:"server"`
+	Format string `yaml:"format"`
+}
+
+func showConfig(t *testing.T, manager *supervisorctl.ConfigManager, revealSecrets bool) shownConfig {
+	var out bytes.Buffer
+	require.NoError(t, manager.Show(&out, revealSecrets))
+	var shown shownConfig
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &shown), out.String())
+	return shown
+}
+
+func TestSupervisorctlConfigInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "supervisorctl", "config.yaml")
+	manager := supervisorctl.NewConfigManager(path)
+
+	// An invalid URL is asked for again; an empty format answer keeps the default
+	var out bytes.Buffer
+	in := strings.NewReader("localhost:9090\nhttps://supervisor.example.com:9443\ns3cr3t-token\n\n")
+	config, err := manager.Init(in, &out, false)
+	require.NoError(t, err)
+	assert.Equal(t, "https://supervisor.example.com:9443", config.Server.URL)
+	assert.Equal(t, "s3cr3t-token", config.Server.Token)
+	assert.Equal(t, supervisorctl.OutputTable, config.Format)
+	assert.Contains(t, out.String(), "Invalid server.url")
+	assert.Contains(t, out.String(), "Supervisor URL [http://localhost:8080]: ")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "server:\n  url: https://supervisor.example.com:9443\n  token: s3cr3t-token\nformat: table\n", string(data))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// The written file loads like any other config file
+	loaded, err := supervisorctl.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, config.Server.URL, loaded.Server.URL)
+	assert.Equal(t, supervisorctl.DefaultRetryPolicy(), loaded.Server.Retries)
+
+	// An existing file is only replaced with force
+	_, err = manager.Init(strings.NewReader("\n\n\n"), &out, false)
+	assert.True(t, errors.Is(err, supervisorctl.ErrConfigExists))
+	config, err = manager.Init(strings.NewReader("http://other:8080\n\njson\n"), &out, true)
+	require.NoError(t, err)
+	assert.Equal(t, "http://other:8080", config.Server.URL)
+	assert.Empty(t, config.Server.Token)
+	assert.Equal(t, supervisorctl.OutputJSON, config.Format)
+}
+
+func TestSupervisorctlConfigShowMasksSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  url: http://supervisor:8080\n  token: s3cr3t-token\n"), 0600))
+	manager := supervisorctl.NewConfigManager(path)
+
+	shown := showConfig(t, manager, false)
+	assert.Equal(t, "http://supervisor:8080", shown.Server.URL)
+	assert.Equal(t, "********", shown.Server.Token)
+	assert.Equal(t, "30s", shown.Server.Retries.MaxElapsed)
+	assert.Equal(t, 5, shown.Server.Retries.BreakerThreshold)
+	assert.Equal(t, "table", shown.Format)
+
+	var out bytes.Buffer
+	require.NoError(t, manager.Show(&out, false))
+	assert.NotContains(t, out.String(), "s3cr3t-token")
+
+	assert.Equal(t, "s3cr3t-token", showConfig(t, manager, true).Server.Token)
+}
+
+func TestSupervisorctlConfigEffectiveValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  url: http://file:8080\n  timeout: 10s\nformat: yaml\n"), 0600))
+	manager := supervisorctl.NewConfigManager(path)
+
+	// The environment overrides the file, and flags override the environment
+	t.Setenv("SUPERVISORCTL_SERVER_URL", "http://env:8080")
+	t.Setenv("SUPERVISORCTL_SERVER_TOKEN", "env-token")
+	require.NoError(t, manager.SetOverride("format", "json"))
+
+	config, err := manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "http://env:8080", config.Server.URL)
+	assert.Equal(t, "env-token", config.Server.Token)
+	assert.Equal(t, 10*time.Second, config.Server.Timeout)
+	assert.Equal(t, supervisorctl.OutputJSON, config.Format)
+
+	// Neither is written to the file
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "env")
+
+	assert.Error(t, manager.SetOverride("server.unknown", "x"))
+
+	// A missing file leaves the defaults
+	config, err = supervisorctl.NewConfigManager(filepath.Join(t.TempDir(), "missing.yaml")).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "http://env:8080", config.Server.URL)
+	assert.Zero(t, config.Server.Timeout)
+}
+
+func TestSupervisorctlConfigSetRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := `# Supervisor used by the deploy scripts
+server:
+  url: http://supervisor:8080 # production
+  token: s3cr3t-token
+  proxy: http://proxy:3128
+plugins:
+  - name: notify
+`
+	require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+	manager := supervisorctl.NewConfigManager(path)
+
+	require.NoError(t, manager.Set("server.timeout", "45s"))
+	require.NoError(t, manager.Set("server.url", "https://supervisor:9443"))
+	require.NoError(t, manager.Set("server.retries.breaker_threshold", "8"))
+	require.NoError(t, manager.Set("format", "JSON"))
+
+	value, err := manager.Get("server.timeout")
+	require.NoError(t, err)
+	assert.Equal(t, "45s", value)
+
+	shown := showConfig(t, manager, false)
+	assert.Equal(t, "https://supervisor:9443", shown.Server.URL)
+	assert.Equal(t, "45s", shown.Server.Timeout)
+	assert.Equal(t, 8, shown.Server.Retries.BreakerThreshold)
+	assert.Equal(t, "json", shown.Format)
+
+	// Comments and keys supervisorctl does not know survive, and the file becomes owner-only
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for _, kept := range []string{"# Supervisor used by the deploy scripts", "# production", "proxy: http://proxy:3128", "- name: notify", "token: s3cr3t-token"} {
+		assert.Contains(t, string(data), kept)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// Invalid values and unknown keys leave the file untouched
+	for key, value := range map[string]string{
+		"server.timeout":                   "soon",
+		"server.url":                       "supervisor:8080",
+		"server.retries.breaker_threshold": "-1",
+		"format":                           "xml",
+		"server.unknown":                   "x",
+	} {
+		assert.Error(t, manager.Set(key, value), key)
+	}
+	unchanged, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(unchanged))
+
+	// Saving the loaded config writes every key back
+	config, err := manager.Load()
+	require.NoError(t, err)
+	config.Server.Retries.MaxElapsed = time.Minute
+	require.NoError(t, manager.Save(config))
+	reloaded, err := supervisorctl.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, reloaded.Server.Retries.MaxElapsed)
+	assert.Equal(t, 45*time.Second, reloaded.Server.Timeout)
+	assert.Equal(t, "s3cr3t-token", reloaded.Server.Token)
+}
+
+// profilesConfig is a config file with a top-level server and two profiles, staging selected
+const profilesConfig = `server:
+  url: http://file:8080
+  token: file-token
+  timeout: 10s
+format: yaml
+current_profile: staging
+profiles:
+  staging:
+    server:
+      url: https://staging:9443
+      token: staging-token
+      tls:
+        insecure_skip_verify: true
+  prod:
+    server:
+      url: https://prod:9443
+    format: json
+`
+
+func TestSupervisorctlConfigProfilePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(profilesConfig), 0600))
+	t.Setenv("SUPERVISORCTL_PROFILE", "")
+	t.Setenv("SUPERVISORCTL_SERVER", "")
+	t.Setenv("SUPERVISORCTL_TOKEN", "")
+
+	// The current profile overrides the top level, which fills in what the profile leaves out
+	config, err := supervisorctl.NewConfigManager(path).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "staging", config.Profile)
+	assert.Equal(t, "https://staging:9443", config.Server.URL)
+	assert.Equal(t, "staging-token", config.Server.Token)
+	assert.True(t, config.Server.TLS.InsecureSkipVerify)
+	assert.Equal(t, 10*time.Second, config.Server.Timeout)
+	assert.Equal(t, supervisorctl.OutputYAML, config.Format)
+	assert.Len(t, config.Profiles, 2)
+
+	// The environment selects another profile and overrides it
+	t.Setenv("SUPERVISORCTL_PROFILE", "prod")
+	t.Setenv("SUPERVISORCTL_TOKEN", "env-token")
+	config, err = supervisorctl.NewConfigManager(path).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "prod", config.Profile)
+	assert.Equal(t, "https://prod:9443", config.Server.URL)
+	assert.Equal(t, "env-token", config.Server.Token)
+	assert.False(t, config.Server.TLS.InsecureSkipVerify)
+	assert.Equal(t, supervisorctl.OutputJSON, config.Format)
+
+	// Flags override the environment, in any position among the args
+	flags, args, err := supervisorctl.ParseGlobalFlags([]string{"--profile", "staging", "status", "--server=http://flag:8080", "ledger"})
+	require.NoError(t, err)
+	assert.Equal(t, supervisorctl.GlobalFlags{Server: "http://flag:8080", Profile: "staging"}, flags)
+	assert.Equal(t, []string{"status", "ledger"}, args)
+	manager := supervisorctl.NewConfigManager(path)
+	require.NoError(t, manager.ApplyGlobalFlags(flags))
+	config, err = manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "staging", config.Profile)
+	assert.Equal(t, "http://flag:8080", config.Server.URL)
+	assert.Equal(t, "env-token", config.Server.Token)
+
+	// Show names the profile and the source of every value
+	var out bytes.Buffer
+	require.NoError(t, manager.Show(&out, false))
+	for _, line := range []string{
+		"# profile staging, selected by flag --profile",
+		"url: http://flag:8080 # from flag",
+		"token: '********' # from env SUPERVISORCTL_TOKEN",
+		"timeout: 10s # from file",
+		"insecure_skip_verify: true # from profile staging",
+		"max_elapsed: 30s # from default",
+	} {
+		assert.Contains(t, out.String(), line)
+	}
+
+	// Unknown profiles and flags missing their value fail
+	manager.SetProfile("qa")
+	_, err = manager.Load()
+	assert.ErrorContains(t, err, `unknown supervisorctl profile "qa" selected by flag --profile, expected one of prod, staging`)
+	_, _, err = supervisorctl.ParseGlobalFlags([]string{"status", "--token"})
+	assert.Error(t, err)
+
+	// Arguments after -- are not flags
+	_, args, err = supervisorctl.ParseGlobalFlags([]string{"exec", "--", "--server", "x"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exec", "--", "--server", "x"}, args)
+
+	// A profile's TLS settings reach the client, which fails on an unusable CA file
+	config.Server.TLS.CAFile = filepath.Join(t.TempDir(), "missing-ca.pem")
+	_, err = supervisorctl.NewClientFromConfig(config)
+	assert.ErrorContains(t, err, "failed to read CA file")
+	config.Server.TLS.CAFile = path
+	_, err = supervisorctl.NewClientFromConfig(config)
+	assert.ErrorContains(t, err, "holds no PEM certificates")
+}
+
+func TestSupervisorctlConfigUseProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(profilesConfig), 0600))
+	t.Setenv("SUPERVISORCTL_PROFILE", "")
+	manager := supervisorctl.NewConfigManager(path)
+
+	profiles, err := manager.Profiles()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod", "staging"}, profiles)
+
+	// Switching the default profile keeps the rest of the file
+	require.NoError(t, manager.UseProfile("prod"))
+	config, err := manager.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "prod", config.Profile)
+	assert.Equal(t, "https://prod:9443", config.Server.URL)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "current_profile: prod\n")
+	assert.Contains(t, string(data), "token: staging-token")
+	var out bytes.Buffer
+	require.NoError(t, manager.Show(&out, false))
+	assert.Contains(t, out.String(), "# profile prod, selected by file current_profile")
+
+	// Profiles are edited through their own keys
+	require.NoError(t, manager.Set("profiles.prod.server.token", "prod-token"))
+	assert.Error(t, manager.Set("profiles.prod.server.url", "prod:9443"))
+	token, err := manager.Get("server.token")
+	require.NoError(t, err)
+	assert.Equal(t, "prod-token", token)
+
+	// Unknown profiles are refused; an empty name goes back to the top level
+	assert.ErrorContains(t, manager.UseProfile("qa"), `unknown supervisorctl profile "qa"`)
+	require.NoError(t, manager.UseProfile(""))
+	config, err = manager.Load()
+	require.NoError(t, err)
+	assert.Empty(t, config.Profile)
+	assert.Equal(t, "http://file:8080", config.Server.URL)
+}
@@ -0,0 +1,197 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shellServer is a supervisor serving the requests of the interactive shell from fixed agents,
+// groups and tasks, recording each request and the token it carried
+type shellServer struct {
+	mu       sync.Mutex
+	requests []string
+	tokens   map[string]bool
+}
+
+func (s *shellServer) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func newShellServer(t *testing.T) (*httptest.Server, *shellServer) {
+	recorder := &shellServer{tokens: map[string]bool{}}
+	respond := func(w http.ResponseWriter, status int, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/agents", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{"agents": []map[string]string{{"id": "ledger"}, {"id": "payments-api"}, {"id": "payments-worker"}}})
+	})
+	mux.HandleFunc("GET /api/v1/groups", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{"groups": []map[string]interface{}{{"name": "payments", "members": []string{"payments-api", "payments-worker"}}}})
+	})
+	mux.HandleFunc("GET /tasks", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{"tasks": []map[string]interface{}{{"id": "nightly-report", "name": "Nightly report", "agent_id": "ledger", "cron_expression": "0 2 * * *", "active": true}}})
+	})
+	mux.HandleFunc("GET /api/v1/agents/status", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{"agents": []map[string]string{{"id": "ledger", "status": "idle"}, {"id": "payments-api", "status": "running"}}})
+	})
+	mux.HandleFunc("GET /api/v1/agents/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "ledger" {
+			respond(w, http.StatusNotFound, map[string]string{"error": "agent " + r.PathValue("id") + " not found", "code": "AGENT_NOT_FOUND"})
+			return
+		}
+		respond(w, http.StatusOK, map[string]string{"id": "ledger", "status": "idle"})
+	})
+	mux.HandleFunc("POST /api/v1/agents/{target}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		target, action := r.PathValue("target"), r.PathValue("action")
+		switch {
+		case strings.HasPrefix(target, "group:") && r.URL.Query().Get("confirm") == "":
+			respond(w, http.StatusPreconditionRequired, map[string]interface{}{
+				"error": "confirm the operation", "code": "CONFIRMATION_REQUIRED",
+				"details": map[string]interface{}{"confirmation_token": "token-1", "agents": []string{"payments-api", "payments-worker"}},
+			})
+		case strings.HasPrefix(target, "group:"):
+			respond(w, http.StatusOK, map[string]interface{}{"group": "payments", "action": action, "steps": []map[string]string{
+				{"agent_id": "payments-worker", "step": "stop", "status": "applied"},
+				{"agent_id": "payments-api", "step": "stop", "status": "applied"},
+			}})
+		case action == "start":
+			respond(w, http.StatusOK, map[string]interface{}{"state": "running", "pid": 4242})
+		default:
+			respond(w, http.StatusOK, map[string]interface{}{"agent_id": target, "enabled": action != "disable", "running_executions": []string{}})
+		}
+	})
+	mux.HandleFunc("GET /api/v1/executions", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{"executions": []map[string]string{
+			{"id": "exec-1", "agent_id": r.URL.Query().Get("agent_id"), "state": "completed"},
+			{"id": "exec-2", "agent_id": r.URL.Query().Get("agent_id"), "state": "completed"},
+		}})
+	})
+	mux.HandleFunc("GET /api/v1/executions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{
+			"execution": map[string]string{"id": r.PathValue("id"), "state": "completed"},
+			"result":    map[string]interface{}{"id": r.PathValue("id"), "status": "success", "output": "ledger balanced\n"},
+		})
+	})
+	mux.HandleFunc("POST /tasks/{id}/execute", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, map[string]interface{}{"result": map[string]interface{}{"execution_id": "exec-3", "status": "success", "output": "report sent", "execution_time_ms": 12}})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.mu.Lock()
+		recorder.requests = append(recorder.requests, r.Method+" "+r.URL.Path)
+		recorder.tokens[r.Header.Get("Authorization")] = true
+		recorder.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, recorder
+}
+
+// runShell runs a shell on the supervisor with input as the typed lines and returns its output
+func runShell(t *testing.T, server *httptest.Server, input string) (*supervisorctl.Shell, string) {
+	client := supervisorctl.NewClient(server.URL)
+	client.SetToken("operator-token")
+	client.SetRetryPolicy(quickRetries)
+
+	var out bytes.Buffer
+	shell := supervisorctl.NewShell(client, strings.NewReader(input), &out)
+	require.NoError(t, shell.Run(context.Background()))
+	return shell, out.String()
+}
+
+func TestShellCompletion(t *testing.T) {
+	server, _ := newShellServer(t)
+	client := supervisorctl.NewClient(server.URL)
+	shell := supervisorctl.NewShell(client, strings.NewReader(""), &bytes.Buffer{})
+	ctx := context.Background()
+
+	assert.Equal(t, []string{"status", "start", "stop"}, shell.Complete(ctx, "st"))
+	assert.Equal(t, []string{"restart"}, shell.Complete(ctx, "re"))
+
+	// Lifecycle commands complete the live agents and groups
+	assert.Equal(t, []string{"ledger", "payments-api", "payments-worker", "group:payments"}, shell.Complete(ctx, "restart "))
+	assert.Equal(t, []string{"payments-worker"}, shell.Complete(ctx, "stop payments-api payments"))
+	assert.Equal(t, []string{"group:payments"}, shell.Complete(ctx, "status group:"))
+
+	assert.Equal(t, []string{"run"}, shell.Complete(ctx, "task r"))
+	assert.Equal(t, []string{"nightly-report"}, shell.Complete(ctx, "task run n"))
+	assert.Equal(t, []string{"json"}, shell.Complete(ctx, "set format j"))
+
+	// The complete command answers on the output
+	_, out := runShell(t, server, "complete logs pay\n")
+	assert.Contains(t, out, "payments-api\npayments-worker\n")
+}
+
+func TestShellDispatch(t *testing.T) {
+	server, recorder := newShellServer(t)
+	input := strings.Join([]string{
+		"status",
+		"start ledger",
+		"stop group:payments",
+		"y",
+		"restart ledger",
+		"logs ledger",
+		"task run nightly-report",
+		"exit",
+		"status",
+	}, "\n")
+	shell, out := runShell(t, server, input)
+
+	assert.Equal(t, []string{
+		"GET /api/v1/agents/status",
+		"POST /api/v1/agents/ledger/start",
+		"POST /api/v1/agents/group:payments/disable",
+		"POST /api/v1/agents/group:payments/disable",
+		"POST /api/v1/agents/ledger/restart",
+		"GET /api/v1/executions",
+		"GET /api/v1/executions/exec-2",
+		"POST /tasks/nightly-report/execute",
+	}, recorder.recorded(), "exit ends the session before the last status")
+	assert.Equal(t, map[string]bool{"Bearer operator-token": true}, recorder.tokens)
+
+	assert.Contains(t, out, "payments-api")
+	assert.Contains(t, out, "ledger: running\n")
+	assert.Contains(t, out, "disable of group:payments applies to 2 agents:")
+	assert.Contains(t, out, "payments-worker: stop applied\n")
+	assert.Contains(t, out, "ledger: enabled\n")
+	assert.Contains(t, out, "execution exec-2: success, exit code 0\nledger balanced\n")
+	assert.Contains(t, out, "execution exec-3: success in 12ms\nreport sent\n")
+
+	// The confirmation answer is not a command of the session
+	assert.Equal(t, []string{"status", "start ledger", "stop group:payments", "restart ledger", "logs ledger", "task run nightly-report", "exit"}, shell.History())
+}
+
+func TestShellFormatAndErrors(t *testing.T) {
+	server, recorder := newShellServer(t)
+	shell, out := runShell(t, server, "status missing\nset format yaml\nfrobnicate\nset format json\nstatus ledger\nhistory\n")
+
+	// Errors are reported and the session goes on
+	assert.Contains(t, out, "error: supervisor returned 404 AGENT_NOT_FOUND: agent missing not found\n")
+	assert.Contains(t, out, `error: invalid format "yaml"`)
+	assert.Contains(t, out, `error: unknown command "frobnicate"`)
+
+	// The format set stays for the rest of the session
+	assert.Equal(t, supervisorctl.OutputJSON, shell.Format())
+	assert.Contains(t, out, "[\n  {\n    \"id\": \"ledger\",")
+	assert.Contains(t, out, "   5  status ledger\n")
+	assert.Equal(t, []string{"GET /api/v1/agents/missing/status", "GET /api/v1/agents/ledger/status"}, recorder.recorded())
+
+	// The end of the input ends the session like exit
+	assert.True(t, strings.HasSuffix(out, supervisorctl.ShellPrompt+"\n"))
+}
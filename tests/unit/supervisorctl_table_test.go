@@ -0,0 +1,187 @@
+package unit
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// updateGolden rewrites the golden files from the current output: go test ./tests/unit -run Table -update
+var updateGolden = flag.Bool("update", false, "rewrite golden files")
+
+// tableNow is the time the golden tables measure uptimes and durations to
+var tableNow = time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+
+// assertGolden compares output with tests/testdata/table/<name>.golden
+func assertGolden(t *testing.T, name string, output []byte) {
+	path := filepath.Join("..", "testdata", "table", name+".golden")
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, output, 0644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(output))
+}
+
+// tableStatuses returns a persistent agent running for three hours, one that failed to start, and
+// a task agent
+func tableStatuses() []supervisorctl.AgentStatus {
+	started := tableNow.Add(-3*time.Hour - 25*time.Minute)
+	nextRun := tableNow.Add(30 * time.Minute)
+	return []supervisorctl.AgentStatus{
+		{ID: "payments-api", Name: "Payments API gateway", Status: "running", Health: "healthy",
+			Process: &supervisorctl.ProcessStatus{State: "running", PID: 4121, StartedAt: &started, Restarts: 2}},
+		{ID: "ledger-reconciliation-worker", Name: "Ledger reconciliation", Status: "error", Health: "unhealthy",
+			Process: &supervisorctl.ProcessStatus{State: "fatal", ConsecutiveFailures: 3, Restarts: 2, LastError: "exit status 1: cannot open ledger database"}},
+		{ID: "nightly-report", Name: "Nightly report", Status: "idle", Health: "healthy", NextRun: &nextRun},
+	}
+}
+
+func TestTableColumnSelection(t *testing.T) {
+	var out bytes.Buffer
+	err := supervisorctl.StatusColumns.Write(&out, tableStatuses(), supervisorctl.TableOptions{
+		Columns: supervisorctl.ParseColumns("name, state,pid,uptime,HEALTH"),
+		Now:     tableNow,
+	})
+	require.NoError(t, err)
+	assertGolden(t, "status_columns", out.Bytes())
+
+	err = supervisorctl.StatusColumns.Write(&out, tableStatuses(), supervisorctl.TableOptions{Columns: []string{"state", "memory"}})
+	assert.ErrorContains(t, err, `unknown column "memory"`)
+	assert.ErrorContains(t, err, "restarts")
+}
+
+func TestTableWideOutput(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, supervisorctl.StatusColumns.Write(&out, tableStatuses(), supervisorctl.TableOptions{Wide: true, Location: time.UTC, Now: tableNow}))
+	assertGolden(t, "status_wide", out.Bytes())
+
+	end := tableNow.Add(-time.Minute)
+	executions := []supervisorctl.Execution{
+		{ID: "exec-1", AgentID: "nightly-report", State: "completed", Status: "success", StartTime: tableNow.Add(-2 * time.Minute), EndTime: &end, TriggerType: "schedule", TriggeredBy: "task:nightly"},
+		{ID: "exec-2", AgentID: "payments-api", State: "failed", Status: "failure", StartTime: tableNow.Add(-90 * time.Second), EndTime: &end, ExitCode: 2, ErrorMessage: "exit status 2", Anomalies: []string{"duration_high", "failure_rate_high"}},
+		{ID: "exec-3", AgentID: "payments-api", State: "queued", StartTime: tableNow, QueuePosition: 1},
+		{ID: "exec-4", AgentID: "indexer", State: "running", StartTime: tableNow.Add(-30 * time.Second), Progress: &supervisorctl.Progress{Percent: 42.5, Message: "indexing", UpdatedAt: tableNow}},
+	}
+	out.Reset()
+	require.NoError(t, supervisorctl.ExecutionColumns.Write(&out, executions, supervisorctl.TableOptions{Wide: true, Location: time.UTC, Now: tableNow}))
+	assertGolden(t, "executions_wide", out.Bytes())
+}
+
+func TestTableNarrowTerminalTruncation(t *testing.T) {
+	options := supervisorctl.TableOptions{Columns: []string{"id", "name", "state", "restarts", "error"}, Width: 60, Now: tableNow}
+
+	var out bytes.Buffer
+	require.NoError(t, supervisorctl.StatusColumns.Write(&out, tableStatuses(), options))
+	assertGolden(t, "status_narrow", out.Bytes())
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		assert.LessOrEqual(t, len([]rune(string(line))), 60, string(line))
+	}
+
+	// --no-trunc keeps every cell whole
+	options.NoTrunc = true
+	out.Reset()
+	require.NoError(t, supervisorctl.StatusColumns.Write(&out, tableStatuses(), options))
+	assert.Contains(t, out.String(), "exit status 1: cannot open ledger database")
+	assert.NotContains(t, out.String(), "…")
+}
+
+func TestTableStateColors(t *testing.T) {
+	var out bytes.Buffer
+	options := supervisorctl.TableOptions{Columns: []string{"id", "state"}, Colors: true}
+	require.NoError(t, supervisorctl.StatusColumns.Write(&out, tableStatuses(), options))
+	assert.Contains(t, out.String(), "\x1b[32mrunning\x1b[0m")
+	assert.Contains(t, out.String(), "\x1b[31mfatal\x1b[0m")
+	assert.Contains(t, out.String(), "nightly-report                idle\n")
+
+	// Colors leave the columns aligned as without them
+	options.Colors = false
+	var plain bytes.Buffer
+	require.NoError(t, supervisorctl.StatusColumns.Write(&plain, tableStatuses(), options))
+	colorless := bytes.ReplaceAll(bytes.ReplaceAll(out.Bytes(), []byte("\x1b[32m"), nil), []byte("\x1b[31m"), nil)
+	assert.Equal(t, plain.String(), string(bytes.ReplaceAll(colorless, []byte("\x1b[0m"), nil)))
+
+	// A pipe is not a terminal, so colors stay off unless forced
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+	assert.False(t, supervisorctl.ColorsEnabled(writer, false))
+	assert.True(t, supervisorctl.ColorsEnabled(writer, true))
+	t.Setenv("COLUMNS", "")
+	assert.Zero(t, supervisorctl.TerminalWidth(writer))
+	t.Setenv("COLUMNS", "72")
+	assert.Equal(t, 72, supervisorctl.TerminalWidth(writer))
+
+	// Anomaly markers are highlighted, executions without anomalies are not
+	end := tableNow
+	executions := []supervisorctl.Execution{
+		{ID: "exec-1", State: "completed", EndTime: &end, Anomalies: []string{"duration_high"}},
+		{ID: "exec-2", State: "completed", EndTime: &end},
+	}
+	out.Reset()
+	require.NoError(t, supervisorctl.ExecutionColumns.Write(&out, executions, supervisorctl.TableOptions{Columns: []string{"id", "anomalies"}, Colors: true}))
+	assert.Contains(t, out.String(), "\x1b[33m! duration_high\x1b[0m")
+	assert.Contains(t, out.String(), "exec-2  -\n")
+
+	// Execution statuses are colored like states, warnings in yellow
+	executions[0].Status, executions[1].Status = "warning", "failure"
+	out.Reset()
+	require.NoError(t, supervisorctl.ExecutionColumns.Write(&out, executions, supervisorctl.TableOptions{Columns: []string{"id", "status"}, Colors: true}))
+	assert.Contains(t, out.String(), "\x1b[33mwarning\x1b[0m")
+	assert.Contains(t, out.String(), "\x1b[31mfailure\x1b[0m")
+}
+
+func TestTaskTableDefaultColumns(t *testing.T) {
+	nextRun := tableNow.Add(time.Hour)
+	tasks := []supervisorctl.Task{
+		{ID: "regional-sync", Name: "Regional sync", AgentSelector: &supervisorctl.AgentSelector{Pattern: "prefix:region-"}, CronExpression: "0 * * * *", Active: true, NextRun: &nextRun},
+		{ID: "weekly-digest", Name: "Weekly digest", PipelineID: "digest", CronExpression: "0 9 * * 1", Timezone: "Europe/Paris"},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, supervisorctl.WriteTaskTable(&out, tasks, time.UTC))
+	assertGolden(t, "tasks_default", out.Bytes())
+}
+
+func TestTableAgentDescribe(t *testing.T) {
+	agent := supervisorctl.AgentSpec{
+		ID:          "summarizer",
+		Name:        "Summarizer",
+		Description: "Summarizes the input text",
+		InputSchema: map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"max_words"},
+			"properties": map[string]interface{}{
+				"max_words": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 500, "description": "Longest summary"},
+				"style":     map[string]interface{}{"type": "string", "enum": []interface{}{"brief", "full"}, "default": "brief"},
+				"tags":      map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 5},
+				"output": map[string]interface{}{
+					"type":       "object",
+					"required":   []interface{}{"format"},
+					"properties": map[string]interface{}{"format": map[string]interface{}{"type": "string", "minLength": 1}},
+				},
+			},
+		},
+		Examples:      []supervisorctl.AgentExample{{Description: "A short summary", Input: "Long text", Parameters: map[string]interface{}{"max_words": 50}}},
+		ValidateInput: true,
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, agent.Describe(&out))
+	assertGolden(t, "agent_describe", out.Bytes())
+
+	// Agents without a schema say so
+	out.Reset()
+	require.NoError(t, supervisorctl.AgentSpec{ID: "plain", Name: "Plain"}.Describe(&out))
+	assert.Contains(t, out.String(), "Description:       -\n")
+	assert.Contains(t, out.String(), "No parameters declared.")
+}
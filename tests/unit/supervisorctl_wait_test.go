@@ -0,0 +1,186 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/pkg/supervisorctl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pollInterval is the wait poll interval of the tests
+const pollInterval = 20 * time.Millisecond
+
+// transitioningServer answers the first two polls with before and later ones with after, wrapped by
+// format
+func transitioningServer(t *testing.T, format, before, after string) (*httptest.Server, *atomic.Int32) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		state := after
+		if polls.Add(1) <= 2 {
+			state = before
+		}
+		fmt.Fprintf(w, format, state)
+	}))
+	t.Cleanup(server.Close)
+	return server, &polls
+}
+
+func TestWaitAgentReachesState(t *testing.T) {
+	server, polls := transitioningServer(t, `{"id":"worker","status":%q}`, "idle", "running")
+	client := supervisorctl.NewClient(server.URL)
+
+	start := time.Now()
+	status, err := client.WaitAgent(context.Background(), "worker", "RUNNING",
+		supervisorctl.WaitOptions{Timeout: 5 * time.Second, PollInterval: pollInterval})
+	require.NoError(t, err)
+	assert.Equal(t, supervisorctl.ExitOK, supervisorctl.ExitCode(err))
+	assert.Equal(t, "running", status.Status)
+	assert.Equal(t, int32(3), polls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 2*pollInterval)
+}
+
+func TestWaitAgentTimesOut(t *testing.T) {
+	server, _ := transitioningServer(t, `{"id":"worker","status":%q}`, "idle", "idle")
+	client := supervisorctl.NewClient(server.URL)
+
+	start := time.Now()
+	status, err := client.WaitAgent(context.Background(), "worker", "running",
+		supervisorctl.WaitOptions{Timeout: 100 * time.Millisecond, PollInterval: pollInterval})
+	elapsed := time.Since(start)
+	assert.ErrorIs(t, err, supervisorctl.ErrWaitTimeout)
+	assert.Equal(t, supervisorctl.ExitTimeout, supervisorctl.ExitCode(err))
+	require.NotNil(t, status)
+	assert.Equal(t, "idle", status.Status)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestWaitAgentStopsOnError(t *testing.T) {
+	server, polls := transitioningServer(t, `{"id":"worker","status":%q}`, "idle", "error")
+	client := supervisorctl.NewClient(server.URL)
+
+	_, err := client.WaitAgent(context.Background(), "worker", "running",
+		supervisorctl.WaitOptions{Timeout: 5 * time.Second, PollInterval: pollInterval})
+	assert.ErrorIs(t, err, supervisorctl.ErrTerminalFailure)
+	assert.Equal(t, supervisorctl.ExitTerminalFailure, supervisorctl.ExitCode(err))
+	assert.Equal(t, int32(3), polls.Load())
+}
+
+func TestWaitExecutionOutcomes(t *testing.T) {
+	tests := []struct {
+		finalState string
+		exitCode   int
+	}{
+		{"completed", supervisorctl.ExitOK},
+		{"failed", supervisorctl.ExitTerminalFailure},
+		{"timeout", supervisorctl.ExitTerminalFailure},
+		{"cancelled", supervisorctl.ExitTerminalFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.finalState, func(t *testing.T) {
+			server, polls := transitioningServer(t, `{"execution":{"id":"exec-1","state":%q}}`, "running", test.finalState)
+			client := supervisorctl.NewClient(server.URL)
+
+			execution, err := client.WaitExecution(context.Background(), "exec-1",
+				supervisorctl.WaitOptions{Timeout: 5 * time.Second, PollInterval: pollInterval})
+			assert.Equal(t, test.exitCode, supervisorctl.ExitCode(err))
+			require.NotNil(t, execution)
+			assert.Equal(t, test.finalState, execution.State)
+			assert.Equal(t, int32(3), polls.Load())
+		})
+	}
+}
+
+func TestWaitExecutionReportsUnknownExecution(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"execution not found","code":"EXECUTION_NOT_FOUND"}`))
+	}))
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	_, err := client.WaitExecution(context.Background(), "missing",
+		supervisorctl.WaitOptions{Timeout: 5 * time.Second, PollInterval: pollInterval})
+	require.Error(t, err)
+	assert.Equal(t, supervisorctl.ExitFailure, supervisorctl.ExitCode(err))
+}
+
+func TestWaitAgentLongPollsWithETag(t *testing.T) {
+	var requests []*http.Request
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r)
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("If-None-Match") == "" {
+			w.Header().Set("ETag", `W/"1"`)
+			w.Write([]byte(`{"id":"worker","status":"idle"}`))
+			return
+		}
+		// The held request returns once the agent transitions
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("ETag", `W/"2"`)
+		w.Write([]byte(`{"id":"worker","status":"running"}`))
+	}))
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	status, err := client.WaitAgent(context.Background(), "worker", "running",
+		supervisorctl.WaitOptions{Timeout: 5 * time.Second, PollInterval: pollInterval})
+	require.NoError(t, err)
+	assert.Equal(t, "running", status.Status)
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, requests, 2)
+	assert.Equal(t, `W/"1"`, requests[1].Header.Get("If-None-Match"))
+	assert.Equal(t, supervisorctl.DefaultStatusWait.String(), requests[1].URL.Query().Get("wait"))
+}
+
+func TestWatchStatusRendersChanges(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/agents/status", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch requests.Add(1) {
+		case 1:
+			w.Header().Set("ETag", `W/"1"`)
+			w.Write([]byte(`{"agents":[{"id":"worker","status":"idle"}]}`))
+		case 2:
+			// The wait expired without a change
+			assert.Equal(t, `W/"1"`, r.Header.Get("If-None-Match"))
+			w.WriteHeader(http.StatusNotModified)
+		case 3:
+			w.Header().Set("ETag", `W/"2"`)
+			w.Write([]byte(`{"agents":[{"id":"worker","status":"running"}]}`))
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := supervisorctl.NewClient(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rendered []string
+	err := client.WatchStatus(ctx, "", pollInterval, func(statuses []supervisorctl.AgentStatus) error {
+		require.Len(t, statuses, 1)
+		rendered = append(rendered, statuses[0].Status)
+		if len(rendered) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"idle", "running"}, rendered)
+}
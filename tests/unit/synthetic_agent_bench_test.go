@@ -0,0 +1,104 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/internal/services"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// benchAgents is the number of synthetic agents the benchmarks spread executions over
+const benchAgents = 10
+
+// maxExecutionOverhead is the regression threshold of the supervisor's own cost per execution of
+// an instant synthetic agent, in nanoseconds; it leaves room for slow and instrumented runs
+const maxExecutionOverhead = 2_000_000
+
+// newBenchServices registers benchAgents instant synthetic agents of the access type and returns
+// the services running them
+func newBenchServices(b *testing.B, accessType types.AgentAccessType) (*services.ExecutionCoordinator, *services.SchedulerService, []string) {
+	logger := zap.NewNop()
+	agentService := services.NewAgentService(logger)
+	var agentIDs []string
+	for i := 0; i < benchAgents; i++ {
+		config := syntheticAgentConfig(fmt.Sprintf("bench-%d", i), nil)
+		config.AccessType = accessType
+		if accessType == models.ReadWriteAccessType {
+			config.MaxConcurrentExecutions = 1
+		}
+		require.NoError(b, agentService.RegisterAgent(config))
+		agentIDs = append(agentIDs, config.ID)
+	}
+
+	executionService := services.NewExecutionService(agentService, logger)
+	executionService.SetMetricsCollector(services.NewMetricsCollector(logger))
+	scheduler := services.NewSchedulerService(agentService, executionService, logger)
+	b.Cleanup(scheduler.Stop)
+	return services.NewExecutionCoordinator(agentService, executionService, logger), scheduler, agentIDs
+}
+
+// benchmarkCoordinator runs executions through the coordinator from parallel callers, round robin
+// over the agents
+func benchmarkCoordinator(b *testing.B, accessType types.AgentAccessType) {
+	coordinator, _, agentIDs := newBenchServices(b, accessType)
+	var next atomic.Int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			agentID := agentIDs[next.Add(1)%int64(len(agentIDs))]
+			if _, _, err := coordinator.Execute(context.Background(), services.ExecutionRequest{AgentID: agentID, Input: "bench"}); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkReadOnlyExecutions(b *testing.B) {
+	benchmarkCoordinator(b, models.ReadOnlyAccessType)
+}
+
+func BenchmarkReadWriteExecutions(b *testing.B) {
+	benchmarkCoordinator(b, models.ReadWriteAccessType)
+}
+
+func BenchmarkScheduledTaskExecutions(b *testing.B) {
+	_, scheduler, agentIDs := newBenchServices(b, models.ReadOnlyAccessType)
+	for _, agentID := range agentIDs {
+		require.NoError(b, scheduler.ScheduleTask(&models.ScheduledTask{
+			ID:             "task-" + agentID,
+			Name:           "task-" + agentID,
+			AgentID:        agentID,
+			CronExpression: "0 0 1 1 *",
+			Timeout:        60,
+			Enabled:        true,
+		}))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scheduler.ExecuteTask(context.Background(), "task-"+agentIDs[i%len(agentIDs)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExecutionOverheadRegression(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmark regression check skipped in short mode")
+	}
+
+	result := testing.Benchmark(BenchmarkReadOnlyExecutions)
+	t.Logf("read-only executions: %s %s", result, result.MemString())
+	if result.N > 0 && result.NsPerOp() > maxExecutionOverhead {
+		t.Errorf("execution overhead %dns/op exceeds the %dns/op threshold", result.NsPerOp(), maxExecutionOverhead)
+	}
+}
@@ -0,0 +1,122 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/agents"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/algonius/algonius-supervisor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// syntheticAgentConfig returns a read-only synthetic agent configured by parameters
+func syntheticAgentConfig(id string, parameters map[string]string) *models.AgentConfiguration {
+	return &models.AgentConfiguration{
+		ID:                      id,
+		Name:                    id,
+		AgentType:               models.SyntheticAgentType,
+		Parameters:              parameters,
+		AccessType:              models.ReadOnlyAccessType,
+		MaxConcurrentExecutions: 100,
+		Mode:                    models.TaskMode,
+		InputPattern:            models.StdinPattern,
+		OutputPattern:           models.StdoutPattern,
+		Enabled:                 true,
+	}
+}
+
+func TestSyntheticAgentCreatedByFactory(t *testing.T) {
+	factory := agents.NewAgentFactory(zap.NewNop())
+	config := syntheticAgentConfig("synthetic", nil)
+
+	// No executable is needed
+	require.NoError(t, factory.ValidateConfig(config))
+	agent, err := factory.CreateAgent(config)
+	require.NoError(t, err)
+	assert.IsType(t, &agents.SyntheticAgent{}, agent)
+	assert.True(t, factory.IsAgentTypeSupported(models.SyntheticAgentType))
+
+	config.AgentType = "generic"
+	assert.Error(t, config.Validate())
+}
+
+func TestSyntheticAgentSleepsAndProducesOutput(t *testing.T) {
+	agent := agents.NewSyntheticAgent(syntheticAgentConfig("synthetic", map[string]string{
+		"duration":     "30ms",
+		"output_bytes": "1024",
+	}), zap.NewNop())
+
+	start := time.Now()
+	result, err := agent.Execute(context.Background(), "input")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+	assert.Equal(t, types.SuccessStatus, result.Status)
+	assert.Len(t, result.Output, 1024)
+	assert.Equal(t, "synthetic", result.AgentID)
+}
+
+func TestSyntheticAgentRandomizedDuration(t *testing.T) {
+	settings, err := models.ParseSyntheticSettings(map[string]string{"duration": "10ms", "duration_max": "40ms"})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Millisecond, settings.Duration)
+	assert.Equal(t, 40*time.Millisecond, settings.DurationMax)
+
+	agent := agents.NewSyntheticAgent(syntheticAgentConfig("synthetic", map[string]string{
+		"duration": "10ms", "duration_max": "40ms",
+	}), zap.NewNop())
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		_, err := agent.Execute(context.Background(), "")
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	}
+}
+
+func TestSyntheticAgentFailureRate(t *testing.T) {
+	failing := agents.NewSyntheticAgent(syntheticAgentConfig("failing", map[string]string{"failure_rate": "1"}), zap.NewNop())
+	result, err := failing.Execute(context.Background(), "")
+	assert.ErrorIs(t, err, agents.ErrSyntheticFailure)
+	assert.Equal(t, types.FailureStatus, result.Status)
+	assert.Equal(t, 1, result.ExitCode)
+
+	passing := agents.NewSyntheticAgent(syntheticAgentConfig("passing", map[string]string{"failure_rate": "0"}), zap.NewNop())
+	for i := 0; i < 20; i++ {
+		result, err := passing.Execute(context.Background(), "")
+		require.NoError(t, err)
+		assert.Equal(t, types.SuccessStatus, result.Status)
+	}
+}
+
+func TestSyntheticAgentCancelled(t *testing.T) {
+	agent := agents.NewSyntheticAgent(syntheticAgentConfig("synthetic", map[string]string{"duration": "10s"}), zap.NewNop())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := agent.Execute(ctx, "")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, types.TimeoutStatus, result.Status)
+}
+
+func TestSyntheticAgentInvalidParameters(t *testing.T) {
+	for _, parameters := range []map[string]string{
+		{"duration": "soon"},
+		{"duration": "-1s"},
+		{"duration": "50ms", "duration_max": "10ms"},
+		{"output_bytes": "-1"},
+		{"failure_rate": "1.5"},
+		{"failure_rate": "often"},
+	} {
+		config := syntheticAgentConfig("synthetic", parameters)
+		assert.Error(t, config.Validate(), parameters)
+
+		result, err := agents.NewSyntheticAgent(config, zap.NewNop()).Execute(context.Background(), "")
+		assert.Error(t, err, parameters)
+		assert.Equal(t, types.FailureStatus, result.Status)
+	}
+}
@@ -0,0 +1,90 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/algonius/algonius-supervisor/internal/definitions"
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTaskInputVariables(t *testing.T) {
+	now := time.Date(2026, 3, 1, 6, 30, 0, 0, time.UTC)
+	lastRun := time.Date(2026, 2, 28, 6, 30, 0, 0, time.UTC)
+	task := &models.ScheduledTask{
+		ID:            "nightly-report",
+		AgentID:       "reporter",
+		LastExecution: &lastRun,
+		InputParameters: map[string]interface{}{
+			"region": "eu-west",
+			"limit":  10,
+		},
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{{now}}", "2026-03-01T06:30:00Z"},
+		{"{{today}}", "2026-03-01"},
+		{"{{yesterday}}", "2026-02-28"},
+		{"{{last_run}}", "2026-02-28T06:30:00Z"},
+		{"{{task_id}}", "nightly-report"},
+		{"{{agent_id}}", "reporter"},
+		{"{{.today}} {{.task_id}}", "2026-03-01 nightly-report"},
+		{"{{params.region}}", "eu-west"},
+		{"{{.params.limit}}", "10"},
+		{"summarize logs for {{yesterday}} in {{params.region}}", "summarize logs for 2026-02-28 in eu-west"},
+		{`{{date "Jan 2" yesterday}}`, "Feb 28"},
+		{"{{upper params.region}}", "EU-WEST"},
+		{`{{default "none" params.region}}`, "eu-west"},
+	}
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			task.InputTemplate = test.template
+			input, err := definitions.RenderTaskInput(task, now)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, input)
+		})
+	}
+}
+
+func TestRenderTaskInputWithoutLastRun(t *testing.T) {
+	task := &models.ScheduledTask{ID: "first-run", InputTemplate: `since {{default "the beginning" last_run}}|{{last_run}}|`}
+
+	input, err := definitions.RenderTaskInput(task, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "since the beginning||", input)
+}
+
+func TestRenderTaskInputYesterdayCrossesMonth(t *testing.T) {
+	task := &models.ScheduledTask{InputTemplate: "{{yesterday}}"}
+
+	input, err := definitions.RenderTaskInput(task, time.Date(2026, 1, 1, 0, 5, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "2025-12-31", input)
+}
+
+func TestRenderTaskInputFallsBackToParameters(t *testing.T) {
+	task := &models.ScheduledTask{InputParameters: map[string]interface{}{"region": "eu-west"}}
+
+	input, err := definitions.RenderTaskInput(task, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "region=eu-west ", input)
+}
+
+func TestTaskInputTemplateUndefinedVariable(t *testing.T) {
+	err := definitions.ValidateTaskInputTemplate("report for {{tomorrow}}")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tomorrow")
+
+	assert.NoError(t, definitions.ValidateTaskInputTemplate("report for {{yesterday}} in {{params.region}}"))
+
+	// A missing parameter only shows up when the template renders
+	task := &models.ScheduledTask{InputTemplate: "{{params.region}}"}
+	_, err = definitions.RenderTaskInput(task, time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "region")
+}
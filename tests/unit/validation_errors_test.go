@@ -0,0 +1,61 @@
+package unit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/algonius/algonius-supervisor/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationErrorsJoinMessages(t *testing.T) {
+	errs := models.ValidationErrors{}
+	assert.NoError(t, errs.Err())
+
+	errs.Add("name", models.ValidationRequired, "name cannot be empty")
+	errs.Add("weight", models.ValidationOutOfRange, "weight cannot be negative")
+	require.Error(t, errs.Err())
+	assert.Equal(t, "name cannot be empty; weight cannot be negative", errs.Error())
+	assert.True(t, errs.Has("weight"))
+	assert.False(t, errs.Has("mode"))
+}
+
+func TestValidationErrorsAddError(t *testing.T) {
+	sentinel := errors.New("missing executable")
+	errs := models.ValidationErrors{}
+
+	// Plain errors are recorded under the given field and stay matchable
+	errs.AddError("executable_path", models.ValidationUnavailable, fmt.Errorf("checking: %w", sentinel))
+	// A field error keeps its own field and code
+	errs.AddError("", models.ValidationUnavailable, models.NewFieldError("nice_level", models.ValidationOutOfRange, errors.New("too nice")))
+	// Nested problems are merged, filling in the field where they have none
+	nested := models.ValidationErrors{}
+	nested.Add("parameters.duration", models.ValidationInvalid, "bad duration")
+	nested.Add("", models.ValidationInvalid, "bad parameters")
+	errs.AddError("parameters", models.ValidationInvalid, nested)
+
+	require.Len(t, errs, 4)
+	assert.Equal(t, "executable_path", errs[0].Field)
+	assert.Equal(t, models.ValidationUnavailable, errs[0].Code)
+	assert.Equal(t, "nice_level", errs[1].Field)
+	assert.Equal(t, models.ValidationOutOfRange, errs[1].Code)
+	assert.Equal(t, "parameters.duration", errs[2].Field)
+	assert.Equal(t, "parameters", errs[3].Field)
+	assert.ErrorIs(t, errs.Err(), sentinel)
+}
+
+func TestSyntheticSettingsReportEveryParameter(t *testing.T) {
+	_, err := models.ParseSyntheticSettings(map[string]string{
+		models.SyntheticDurationParam:    "soon",
+		models.SyntheticOutputBytesParam: "-1",
+		models.SyntheticFailureRateParam: "1.5",
+	})
+	var errs models.ValidationErrors
+	require.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 3)
+	assert.True(t, errs.Has("parameters.duration"))
+	assert.True(t, errs.Has("parameters.output_bytes"))
+	assert.True(t, errs.Has("parameters.failure_rate"))
+}